@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// API key flags
+var keyScope string
+var keyRateLimit int
+var keyWorkspace string
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage server API keys",
+	Long: `Manage the API keys the server accepts as bearer tokens. Each key has a
+scope - read, run or admin - and an optional rate limit in requests per minute.
+Once any key is configured, every request must authenticate.`,
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List server API keys",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		serverConfig := envConfig.GetServerConfig()
+		if len(serverConfig.APIKeys) == 0 {
+			fmt.Println("No API keys configured.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCOPE\tRATE LIMIT\tWORKSPACE\tKEY")
+		for _, key := range serverConfig.APIKeys {
+			limit := "-"
+			if key.RateLimit > 0 {
+				limit = fmt.Sprintf("%d/min", key.RateLimit)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", key.Name, key.Scope, limit, orDash(key.Workspace), maskKey(key.Key))
+		}
+		w.Flush()
+	},
+}
+
+var keysAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Create a server API key",
+	Long: `Create an API key and print it. The key is stored in the environment file;
+keep the printed value, as 'keys list' only shows its last characters.`,
+	Example: `  comanda server keys add ci --scope run --rate-limit 30
+  comanda server keys add dashboard --scope read
+  comanda server keys add marketing-ci --scope run --workspace marketing`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if !config.ValidScope(keyScope) {
+			return fmt.Errorf("invalid scope '%s': use read, run or admin", keyScope)
+		}
+		if keyRateLimit < 0 {
+			return fmt.Errorf("rate limit cannot be negative")
+		}
+		serverConfig := envConfig.GetServerConfig()
+		if serverConfig.FindAPIKey(name) != nil {
+			return fmt.Errorf("an API key named '%s' already exists", name)
+		}
+		if keyWorkspace != "" && serverConfig.FindWorkspace(keyWorkspace) == nil {
+			return fmt.Errorf("no workspace named '%s'", keyWorkspace)
+		}
+		key, err := config.GenerateBearerToken()
+		if err != nil {
+			return fmt.Errorf("error generating API key: %w", err)
+		}
+		serverConfig.APIKeys = append(serverConfig.APIKeys, config.APIKey{
+			Name:      name,
+			Key:       key,
+			Scope:     keyScope,
+			RateLimit: keyRateLimit,
+			Workspace: keyWorkspace,
+		})
+		envConfig.UpdateServerConfig(*serverConfig)
+		if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+			return fmt.Errorf("error saving configuration: %w", err)
+		}
+		fmt.Printf("Created API key '%s' with scope %s: %s\n", name, keyScope, key)
+		return nil
+	},
+}
+
+var keysRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a server API key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serverConfig := envConfig.GetServerConfig()
+		var kept []config.APIKey
+		for _, key := range serverConfig.APIKeys {
+			if key.Name != args[0] {
+				kept = append(kept, key)
+			}
+		}
+		if len(kept) == len(serverConfig.APIKeys) {
+			return fmt.Errorf("no API key named '%s'", args[0])
+		}
+		serverConfig.APIKeys = kept
+		envConfig.UpdateServerConfig(*serverConfig)
+		if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+			return fmt.Errorf("error saving configuration: %w", err)
+		}
+		fmt.Printf("Removed API key '%s'\n", args[0])
+		return nil
+	},
+}
+
+// orDash returns s, or "-" if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	keysAddCmd.Flags().StringVar(&keyScope, "scope", config.ScopeRun, "Key scope: read, run or admin")
+	keysAddCmd.Flags().IntVar(&keyRateLimit, "rate-limit", 0, "Requests per minute (0 for no limit)")
+	keysAddCmd.Flags().StringVar(&keyWorkspace, "workspace", "", "Confine the key to this workspace")
+	keysCmd.AddCommand(keysListCmd, keysAddCmd, keysRemoveCmd)
+	serverCmd.AddCommand(keysCmd)
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// terminalApprover asks the user to decide a workflow's approval steps. It
+// writes to stderr so workflow output on stdout can still be piped.
+type terminalApprover struct {
+	mu  sync.Mutex // Parallel steps take turns
+	in  *bufio.Reader
+	out io.Writer
+	by  string
+}
+
+// newTerminalApprover reads answers from the terminal, even when a
+// workflow's input is piped to STDIN
+func newTerminalApprover() (*terminalApprover, error) {
+	tty := os.Stdin
+	if !term.IsTerminal(int(tty.Fd())) {
+		var err error
+		if tty, err = os.Open("/dev/tty"); err != nil {
+			return nil, fmt.Errorf("approval steps need a terminal: %w", err)
+		}
+	}
+	a := &terminalApprover{in: bufio.NewReader(tty), out: os.Stderr}
+	if u, err := user.Current(); err == nil {
+		a.by = u.Username
+	}
+	return a, nil
+}
+
+// Approve shows an approval request and returns the user's decision
+func (a *terminalApprover) Approve(ctx context.Context, req processor.ApprovalRequest) (processor.ApprovalDecision, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fmt.Fprintf(a.out, "\n=== Approval needed: %s ===\n", req.Step)
+	if req.Content != "" {
+		fmt.Fprintf(a.out, "%s\n\n", req.Content)
+	}
+	if !req.Expires.IsZero() {
+		fmt.Fprintf(a.out, "(waiting until %s)\n", req.Expires.Format("15:04:05"))
+	}
+
+	type answer struct {
+		line string
+		err  error
+	}
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(a.out, prompt)
+		answers := make(chan answer, 1)
+		go func() {
+			line, err := a.in.ReadString('\n')
+			answers <- answer{line, err}
+		}()
+		select {
+		case ans := <-answers:
+			if ans.err != nil && ans.line == "" {
+				return "", fmt.Errorf("error reading answer: %w", ans.err)
+			}
+			return strings.TrimSpace(ans.line), nil
+		case <-ctx.Done():
+			fmt.Fprintln(a.out)
+			return "", ctx.Err()
+		}
+	}
+
+	line, err := ask(req.Message + " [y/N]: ")
+	if err != nil {
+		return processor.ApprovalDecision{}, err
+	}
+	decision := processor.ApprovalDecision{By: a.by}
+	switch strings.ToLower(line) {
+	case "y", "yes":
+		decision.Approved = true
+	default:
+		if decision.Reason, err = ask("Reason (optional): "); err != nil {
+			return processor.ApprovalDecision{}, err
+		}
+	}
+	return decision, nil
+}
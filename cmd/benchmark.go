@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/workflowtest"
+)
+
+// Benchmark command flags
+var benchmarkModels []string
+var benchmarkStep string
+var benchmarkRuns int
+var benchmarkAssertions string
+
+// benchmarkSample is the measurement of one run of the workflow with one model
+type benchmarkSample struct {
+	Err              error
+	Latency          time.Duration
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	Passed           int // Assertions that held
+	Checked          int // Assertions expected to be checked, including those of steps that did not run
+}
+
+// benchmarkRow summarizes the samples of one model
+type benchmarkRow struct {
+	Model            string
+	Runs             int
+	Succeeded        int
+	Latency          time.Duration // Averages over successful runs
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	Passed           int
+	Checked          int
+	FirstErr         error
+}
+
+var benchmarkCmd = &cobra.Command{
+	Use:   "benchmark <workflow.yaml>",
+	Short: "Compare models on a workflow by latency, cost and assertion pass rate",
+	Long: `Run a workflow once per model (or --runs times), with every LLM step, or only
+--step, switched to that model. Prints each model's success rate, average
+latency, estimated tokens and cost, and how many assertions held.
+
+Assertions are read from testdata/<workflow>/assertions.yaml, the same file
+'comanda test' uses, or from --assertions. Every model must be configured.
+
+Example:
+  comanda benchmark --models gpt-4o,claude-3-5-sonnet-latest,gemini-2.5-pro review.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(benchmarkModels) == 0 {
+			return fmt.Errorf("--models is required")
+		}
+		if benchmarkRuns < 1 {
+			return fmt.Errorf("--runs must be at least 1")
+		}
+		file := args[0]
+		assertionsPath := benchmarkAssertions
+		if assertionsPath == "" {
+			assertionsPath = workflowtest.AssertionsPath(file)
+		}
+		assertions, err := workflowtest.LoadAssertions(assertionsPath)
+		if err != nil {
+			return err
+		}
+
+		var rows []benchmarkRow
+		for _, model := range benchmarkModels {
+			var samples []benchmarkSample
+			for run := 1; run <= benchmarkRuns; run++ {
+				fmt.Fprintf(os.Stderr, "Running %s with %s (%d/%d)\n", file, model, run, benchmarkRuns)
+				sample, err := runBenchmark(file, model, benchmarkStep, assertions)
+				if err != nil {
+					return err
+				}
+				samples = append(samples, sample)
+			}
+			rows = append(rows, summarizeBenchmark(model, samples))
+		}
+		fmt.Fprintln(os.Stderr)
+		printBenchmarkTable(os.Stdout, rows)
+		return nil
+	},
+}
+
+// benchmarkRecorder collects the steps of one benchmark run
+type benchmarkRecorder struct {
+	mu      sync.Mutex
+	records []processor.StepRecord
+}
+
+func (r *benchmarkRecorder) RecordStep(record processor.StepRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+// runBenchmark runs the workflow once with model and measures it. Errors
+// from the workflow itself are part of the sample; the returned error means
+// the workflow could not be set up.
+func runBenchmark(file, model, step string, assertions map[string][]workflowtest.Assertion) (benchmarkSample, error) {
+	_, dslConfig, err := readWorkflowFile(file)
+	if err != nil {
+		return benchmarkSample{}, err
+	}
+	if overrideModel(dslConfig, model, step) == 0 {
+		if step != "" {
+			return benchmarkSample{}, fmt.Errorf("workflow has no LLM step named '%s'", step)
+		}
+		return benchmarkSample{}, fmt.Errorf("workflow has no LLM steps to benchmark")
+	}
+
+	recorder := &benchmarkRecorder{}
+	proc := processor.NewProcessor(dslConfig, envConfig, &config.ServerConfig{}, verbose, runtimeDir)
+	proc.DisableSpinner()
+	proc.SetStepRecorder(recorder)
+
+	var sample benchmarkSample
+	started := time.Now()
+	discardStdout(!verbose, func() {
+		sample.Err = proc.Process()
+	})
+	sample.Latency = time.Since(started)
+	measureSample(&sample, recorder.records, step, assertions)
+	return sample, nil
+}
+
+// measureSample adds tokens, cost and assertion results from the recorded
+// steps to a sample. With a step name, only that step is measured.
+func measureSample(sample *benchmarkSample, records []processor.StepRecord, step string, assertions map[string][]workflowtest.Assertion) {
+	for name, checks := range assertions {
+		if step == "" || name == step {
+			sample.Checked += len(checks)
+		}
+	}
+	for _, record := range records {
+		if step != "" && record.Name != step {
+			continue
+		}
+		if step != "" {
+			sample.Latency = record.Finished.Sub(record.Started)
+		}
+		sample.PromptTokens += record.Metrics.PromptTokens
+		sample.CompletionTokens += record.Metrics.CompletionTokens
+		if cost, ok := models.EstimateCost(record.Model, record.Metrics.PromptTokens, record.Metrics.CompletionTokens); ok {
+			sample.Cost += cost
+		}
+		if record.Err != nil {
+			continue
+		}
+		for _, a := range assertions[record.Name] {
+			if a.Check(record.Response) == nil {
+				sample.Passed++
+			}
+		}
+	}
+}
+
+// overrideModel switches the LLM steps of a workflow, or only the named
+// step, to model and returns how many steps were changed. Steps without a
+// model and steps that pick their own models, such as ensembles, are left alone.
+func overrideModel(dslConfig *processor.DSLConfig, model, step string) int {
+	changed := 0
+	override := func(name string, cfg *processor.StepConfig) {
+		if step != "" && name != step {
+			return
+		}
+		if cfg.Generate != nil || cfg.Process != nil || cfg.Ensemble != nil {
+			return
+		}
+		if cfg.Type != "" && cfg.Type != "agent" {
+			return
+		}
+		if stepModel(*cfg) == "" {
+			return
+		}
+		cfg.Model = model
+		changed++
+	}
+
+	for i := range dslConfig.Steps {
+		override(dslConfig.Steps[i].Name, &dslConfig.Steps[i].Config)
+	}
+	for _, steps := range dslConfig.ParallelSteps {
+		for i := range steps {
+			override(steps[i].Name, &steps[i].Config)
+		}
+	}
+	for name, cfg := range dslConfig.Defer {
+		override(name, &cfg)
+		dslConfig.Defer[name] = cfg
+	}
+	return changed
+}
+
+// summarizeBenchmark averages the samples of one model
+func summarizeBenchmark(model string, samples []benchmarkSample) benchmarkRow {
+	row := benchmarkRow{Model: model, Runs: len(samples)}
+	for _, s := range samples {
+		row.Passed += s.Passed
+		row.Checked += s.Checked
+		if s.Err != nil {
+			if row.FirstErr == nil {
+				row.FirstErr = s.Err
+			}
+			continue
+		}
+		row.Succeeded++
+		row.Latency += s.Latency
+		row.PromptTokens += s.PromptTokens
+		row.CompletionTokens += s.CompletionTokens
+		row.Cost += s.Cost
+	}
+	if row.Succeeded > 0 {
+		n := row.Succeeded
+		row.Latency /= time.Duration(n)
+		row.PromptTokens /= n
+		row.CompletionTokens /= n
+		row.Cost /= float64(n)
+	}
+	return row
+}
+
+// printBenchmarkTable writes one line per model, followed by any errors
+func printBenchmarkTable(out io.Writer, rows []benchmarkRow) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tSUCCEEDED\tAVG LATENCY\tAVG TOKENS IN/OUT\tAVG COST\tASSERTIONS")
+	for _, r := range rows {
+		latency, tokens, cost := "-", "-", "-"
+		if r.Succeeded > 0 {
+			latency = r.Latency.Round(100 * time.Millisecond).String()
+			tokens = fmt.Sprintf("~%d/~%d", r.PromptTokens, r.CompletionTokens)
+			cost = formatCost(r.Cost)
+		}
+		assertions := "-"
+		if r.Checked > 0 {
+			assertions = fmt.Sprintf("%d/%d (%.0f%%)", r.Passed, r.Checked, 100*float64(r.Passed)/float64(r.Checked))
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\t%s\t%s\t%s\t%s\n", r.Model, r.Succeeded, r.Runs, latency, tokens, cost, assertions)
+	}
+	w.Flush()
+
+	for _, r := range rows {
+		if r.FirstErr != nil {
+			fmt.Fprintf(out, "\n%s: %v\n", r.Model, r.FirstErr)
+		}
+	}
+}
+
+func init() {
+	benchmarkCmd.Flags().StringSliceVar(&benchmarkModels, "models", nil, "Comma-separated models to compare")
+	benchmarkCmd.RegisterFlagCompletionFunc("models", completeModelListFlag)
+	benchmarkCmd.Flags().StringVar(&benchmarkStep, "step", "", "Only switch and measure this step")
+	benchmarkCmd.Flags().IntVar(&benchmarkRuns, "runs", 1, "Runs per model")
+	benchmarkCmd.Flags().StringVar(&benchmarkAssertions, "assertions", "", "Assertions file (default testdata/<workflow>/assertions.yaml)")
+	benchmarkCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory that input paths are relative to")
+	benchmarkCmd.ValidArgsFunction = completeWorkflowArgs(1)
+	rootCmd.AddCommand(benchmarkCmd)
+}
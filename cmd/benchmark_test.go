@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/workflowtest"
+)
+
+const benchmarkWorkflow = `
+draft:
+  input: NA
+  model: gpt-4o
+  action: Draft release notes
+  output: STDOUT
+check:
+  type: validate-data
+  input: notes.csv
+  output: STDOUT
+review:
+  input: STDIN
+  model: [gpt-4o, claude-sonnet-4-20250514]
+  action: Review the draft
+  output: STDOUT
+  ensemble:
+    judge_model: gpt-4o
+`
+
+func TestOverrideModel(t *testing.T) {
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal([]byte(benchmarkWorkflow), &dslConfig); err != nil {
+		t.Fatal(err)
+	}
+	if n := overrideModel(&dslConfig, "gemini-2.5-pro", ""); n != 1 {
+		t.Fatalf("overrideModel() changed %d steps, want 1", n)
+	}
+	if dslConfig.Steps[0].Config.Model != "gemini-2.5-pro" {
+		t.Errorf("draft model = %v", dslConfig.Steps[0].Config.Model)
+	}
+	if n := overrideModel(&dslConfig, "gpt-4o-mini", "review"); n != 0 {
+		t.Errorf("overrideModel() of an ensemble step changed %d steps", n)
+	}
+}
+
+func TestMeasureAndSummarizeBenchmark(t *testing.T) {
+	assertions := map[string][]workflowtest.Assertion{
+		"draft":  {{Contains: "Features"}, {NotContains: "TODO"}},
+		"review": {{Contains: "LGTM"}},
+	}
+	started := time.Now()
+	records := []processor.StepRecord{{
+		Name: "draft", Model: "gpt-4o", Response: "Features: faster builds. TODO: docs",
+		Started: started, Finished: started.Add(2 * time.Second),
+		Metrics: processor.PerformanceMetrics{PromptTokens: 1000, CompletionTokens: 100},
+	}}
+
+	var sample benchmarkSample
+	measureSample(&sample, records, "", assertions)
+	if sample.Passed != 1 || sample.Checked != 3 || sample.PromptTokens != 1000 || sample.Cost < 0.0034 || sample.Cost > 0.0036 {
+		t.Errorf("measureSample() = %+v", sample)
+	}
+
+	stepSample := benchmarkSample{Latency: time.Minute}
+	measureSample(&stepSample, records, "draft", assertions)
+	if stepSample.Latency != 2*time.Second || stepSample.Checked != 2 {
+		t.Errorf("measureSample(step) = %+v", stepSample)
+	}
+
+	row := summarizeBenchmark("gpt-4o", []benchmarkSample{
+		sample,
+		{Latency: 4 * time.Second, PromptTokens: 3000, Passed: 3, Checked: 3},
+		{Err: errors.New("rate limited"), Checked: 3},
+	})
+	if row.Succeeded != 2 || row.PromptTokens != 2000 || row.Passed != 4 || row.Checked != 9 || row.FirstErr == nil {
+		t.Errorf("summarizeBenchmark() = %+v", row)
+	}
+
+	var buf bytes.Buffer
+	printBenchmarkTable(&buf, []benchmarkRow{row})
+	if out := buf.String(); !strings.Contains(out, "2/3") || !strings.Contains(out, "4/9 (44%)") || !strings.Contains(out, "gpt-4o: rate limited") {
+		t.Errorf("printBenchmarkTable() =\n%s", out)
+	}
+}
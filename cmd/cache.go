@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/respcache"
+)
+
+// Cache flags
+var noCache bool
+var cacheJSON bool
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect or clear the response cache",
+	Long: `The response cache keeps model responses on disk, so a prompt sent again to the
+same model is answered without calling it. Enable it with response_cache in
+the env file.`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the size and number of entries of the response cache",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := respcache.OpenSettings(envConfig.ResponseCacheSettings())
+		if err != nil {
+			return err
+		}
+		stats, err := cache.Stats()
+		if err != nil {
+			return err
+		}
+		if cacheJSON {
+			return printJSON(os.Stdout, stats)
+		}
+		printCacheStats(os.Stdout, stats, envConfig.ResponseCacheSettings().Enabled)
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every entry of the response cache",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := respcache.OpenSettings(envConfig.ResponseCacheSettings())
+		if err != nil {
+			return err
+		}
+		stats, err := cache.Clear()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d cached %s (%s)\n", stats.Entries, plural(stats.Entries, "response", "responses"), formatBytes(stats.Size))
+		return nil
+	},
+}
+
+// printCacheStats writes the cache's location, size and entries
+func printCacheStats(out io.Writer, stats respcache.Stats, enabled bool) {
+	status := "enabled"
+	if !enabled {
+		status = "disabled (set response_cache.enabled in the env file)"
+	}
+	fmt.Fprintf(out, "Response cache: %s\n", status)
+	fmt.Fprintf(out, "Directory:      %s\n", stats.Dir)
+	fmt.Fprintf(out, "Entries:        %d\n", stats.Entries)
+	fmt.Fprintf(out, "Size:           %s of %s\n", formatBytes(stats.Size), formatBytes(stats.MaxSize))
+	if stats.Entries > 0 {
+		fmt.Fprintf(out, "Last used:      %s\n", stats.Newest.Local().Format("2006-01-02 15:04"))
+		fmt.Fprintf(out, "Oldest use:     %s\n", stats.Oldest.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+// responseCache returns the response cache for a run, or nil when it is
+// disabled or --no-cache is set
+func responseCache() (*respcache.Cache, error) {
+	if noCache {
+		return nil, nil
+	}
+	return respcache.FromConfig(envConfig)
+}
+
+func init() {
+	cacheStatsCmd.Flags().BoolVar(&cacheJSON, "json", false, "Print the statistics as JSON")
+	cacheCmd.AddCommand(cacheStatsCmd, cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/respcache"
+)
+
+func TestPrintCacheStats(t *testing.T) {
+	var out bytes.Buffer
+	printCacheStats(&out, respcache.Stats{Dir: "/cache/responses", MaxSize: 512 << 20}, false)
+	if got := out.String(); !strings.Contains(got, "disabled") || !strings.Contains(got, "0 B of 512.0 MB") || strings.Contains(got, "Last used") {
+		t.Errorf("stats of an empty, disabled cache = %q", got)
+	}
+
+	out.Reset()
+	used := time.Date(2026, 3, 1, 9, 30, 0, 0, time.Local)
+	printCacheStats(&out, respcache.Stats{Dir: "/cache/responses", Entries: 12, Size: 3 << 20, MaxSize: 1 << 30, Oldest: used, Newest: used}, true)
+	for _, want := range []string{"Response cache: enabled", "Entries:        12", "3.0 MB of 1.0 GB", "Last used:      2026-03-01 09:30"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("stats = %q, want %q", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/client"
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Cancel flags
+var cancelServer string
+var cancelToken string
+var cancelWorkspace string
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel <run-id>",
+	Short: "Cancel a run on a comanda server",
+	Long: `Cancel a queued or running run on a comanda server. A running run stops its
+provider calls in flight and starts no further steps; it is recorded as
+canceled with the steps, output and artifacts it finished.
+
+The server is --server, or COMANDA_SERVER, or the one configured here on
+localhost. The token is --token, or COMANDA_TOKEN, or the configured bearer
+token; it needs the run scope.
+
+Examples:
+  comanda cancel 20250114-093012-a1b2c3
+  comanda cancel 20250114-093012-a1b2c3 --server https://comanda.example.com --workspace ml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := serverClient(cancelServer, cancelToken)
+		c.Workspace = cancelWorkspace
+		resp, err := c.CancelRun(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		printCanceled(os.Stdout, args[0], resp)
+		return nil
+	},
+}
+
+// serverClient returns a client of the server at addr authenticating with
+// token, falling back to the environment and then to the server configured
+// here
+func serverClient(addr, token string) *client.Client {
+	if addr == "" {
+		addr = os.Getenv("COMANDA_SERVER")
+	}
+	if token == "" {
+		token = os.Getenv("COMANDA_TOKEN")
+	}
+	server := &config.ServerConfig{Port: 8080}
+	if envConfig != nil {
+		server = envConfig.GetServerConfig()
+	}
+	if addr == "" {
+		scheme := "http"
+		if server.TLS != nil {
+			scheme = "https"
+		}
+		addr = fmt.Sprintf("%s://localhost:%d", scheme, server.Port)
+		if path := strings.Trim(server.BasePath, "/"); path != "" {
+			addr += "/" + path
+		}
+	}
+	if token == "" {
+		token = server.BearerToken
+	}
+	return client.New(addr, token)
+}
+
+// printCanceled reports what became of a cancelled run
+func printCanceled(w io.Writer, id string, resp *client.RunResponse) {
+	if resp.Run == nil || resp.Run.Done() {
+		fmt.Fprintf(w, "Run %s canceled\n", id)
+		return
+	}
+	fmt.Fprintf(w, "Run %s is stopping; it is recorded as canceled once its worker stops it\n", id)
+}
+
+func init() {
+	cancelCmd.Flags().StringVar(&cancelServer, "server", "", "Server address (default: COMANDA_SERVER, or the configured server on localhost)")
+	cancelCmd.Flags().StringVar(&cancelToken, "token", "", "Bearer token or API key (default: COMANDA_TOKEN, or the configured bearer token)")
+	cancelCmd.Flags().StringVar(&cancelWorkspace, "workspace", "", "Workspace the run belongs to")
+	rootCmd.AddCommand(cancelCmd)
+}
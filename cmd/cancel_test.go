@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/client"
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestServerClient(t *testing.T) {
+	previous := envConfig
+	t.Cleanup(func() { envConfig = previous })
+	envConfig = &config.EnvConfig{Server: &config.ServerConfig{Port: 9090, BasePath: "/comanda/", BearerToken: "configured"}}
+	t.Setenv("COMANDA_SERVER", "")
+	t.Setenv("COMANDA_TOKEN", "")
+
+	c := serverClient("", "")
+	if c.BaseURL != "http://localhost:9090/comanda" || c.Token != "configured" {
+		t.Errorf("configured server: %s with token %q", c.BaseURL, c.Token)
+	}
+
+	t.Setenv("COMANDA_SERVER", "https://comanda.example.com")
+	t.Setenv("COMANDA_TOKEN", "from-env")
+	if c := serverClient("", ""); c.BaseURL != "https://comanda.example.com" || c.Token != "from-env" {
+		t.Errorf("environment: %s with token %q", c.BaseURL, c.Token)
+	}
+	if c := serverClient("http://other:8080", "flag"); c.BaseURL != "http://other:8080" || c.Token != "flag" {
+		t.Errorf("flags: %s with token %q", c.BaseURL, c.Token)
+	}
+}
+
+func TestPrintCanceled(t *testing.T) {
+	var out bytes.Buffer
+	printCanceled(&out, "r1", &client.RunResponse{Run: &client.Run{ID: "r1", Status: client.StatusCanceled}})
+	if out.String() != "Run r1 canceled\n" {
+		t.Errorf("canceled run = %q", out.String())
+	}
+	out.Reset()
+	printCanceled(&out, "r1", &client.RunResponse{Run: &client.Run{ID: "r1", Status: client.StatusRunning}})
+	if !bytes.Contains(out.Bytes(), []byte("is stopping")) {
+		t.Errorf("stopping run = %q", out.String())
+	}
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Chat command flags
+var chatModel string
+var chatNoStream bool
+
+const chatHelp = `Commands:
+  /attach <path...>      Attach files, directories or globs to your next message
+  /model <name>          Switch to another model (the conversation is kept)
+  /save <file> [step]    Append the conversation as a step to a workflow file
+  /clear                 Start a new conversation
+  /help                  Show this help
+  /exit                  Leave the chat (Ctrl-D also works)`
+
+// chatTurn is one message in the conversation
+type chatTurn struct {
+	role    string // "User" or "Assistant"
+	content string
+}
+
+// chatSession holds the state of an interactive chat
+type chatSession struct {
+	model       string
+	provider    models.Provider
+	stream      bool
+	history     []chatTurn
+	attachments []*input.Input // Sent with the next message
+	attached    []string       // Every path attached this session, for /save
+	out         io.Writer
+	resolve     func(modelName string) (models.Provider, error)
+}
+
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "Start an interactive chat session with a model",
+	Long: `Open an interactive session with any configured model to iterate on a prompt.
+Type /help inside the session for commands to attach files and to save the
+conversation as a workflow step.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modelName := chatModel
+		if modelName == "" {
+			modelName = envConfig.DefaultGenerationModel
+		}
+		if modelName == "" {
+			return fmt.Errorf("no model specified and no default_generation_model configured. Use --model or configure a default")
+		}
+
+		session := &chatSession{out: os.Stdout, stream: !chatNoStream, resolve: providerForModel}
+		if err := session.switchModel(modelName); err != nil {
+			return err
+		}
+		fmt.Printf("Chatting with %s. Type /help for commands.\n", modelName)
+		return session.run(os.Stdin)
+	},
+}
+
+// providerForModel detects the provider for a model and configures it with
+// the API key from the env config
+func providerForModel(modelName string) (models.Provider, error) {
+	provider := models.DetectProviderWithPriority(modelName, envConfig.ProviderPriority)
+	if provider == nil {
+		return nil, fmt.Errorf("could not detect provider for model: %s", modelName)
+	}
+	apiKey := "LOCAL" // Ollama runs locally and expects this placeholder
+	if provider.Name() != "ollama" {
+		providerConfig, err := envConfig.GetProviderConfig(provider.Name())
+		if err != nil || providerConfig.APIKey == "" {
+			return nil, fmt.Errorf("missing API key for provider %s. Use 'comanda configure' to add it", provider.Name())
+		}
+		apiKey = providerConfig.APIKey
+	}
+	if err := provider.Configure(apiKey); err != nil {
+		return nil, fmt.Errorf("failed to configure provider %s: %w", provider.Name(), err)
+	}
+	provider.SetVerbose(verbose)
+	return provider, nil
+}
+
+// run reads lines until /exit or end of input
+func (s *chatSession) run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for {
+		fmt.Fprint(s.out, "\n> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return scanner.Err()
+		}
+		quit, err := s.handleLine(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(s.out, "Error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// handleLine runs a slash command or sends a message, reporting whether the session should end
+func (s *chatSession) handleLine(line string) (bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false, nil
+	}
+	if !strings.HasPrefix(line, "/") {
+		return false, s.send(line)
+	}
+
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "/exit", "/quit":
+		return true, nil
+	case "/help":
+		fmt.Fprintln(s.out, chatHelp)
+	case "/clear":
+		s.history = nil
+		s.attachments = nil
+		s.attached = nil
+		fmt.Fprintln(s.out, "Conversation cleared.")
+	case "/model":
+		if len(fields) != 2 {
+			return false, fmt.Errorf("usage: /model <name>")
+		}
+		if err := s.switchModel(fields[1]); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(s.out, "Switched to %s.\n", fields[1])
+	case "/attach":
+		if len(fields) < 2 {
+			return false, fmt.Errorf("usage: /attach <path...>")
+		}
+		return false, s.attach(fields[1:])
+	case "/save":
+		if len(fields) < 2 || len(fields) > 3 {
+			return false, fmt.Errorf("usage: /save <file> [step]")
+		}
+		stepName := "chat_step"
+		if len(fields) == 3 {
+			stepName = fields[2]
+		}
+		if err := s.save(fields[1], stepName); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(s.out, "Saved step '%s' to %s.\n", stepName, fields[1])
+	default:
+		return false, fmt.Errorf("unknown command %s (try /help)", fields[0])
+	}
+	return false, nil
+}
+
+// switchModel resolves and configures the provider for a model
+func (s *chatSession) switchModel(modelName string) error {
+	provider, err := s.resolve(modelName)
+	if err != nil {
+		return err
+	}
+	s.model = modelName
+	s.provider = provider
+	return nil
+}
+
+// attach loads files for the next message
+func (s *chatSession) attach(paths []string) error {
+	handler := input.NewHandler()
+	for _, path := range paths {
+		if err := handler.ProcessPath(path); err != nil {
+			return err
+		}
+		s.attached = append(s.attached, path)
+	}
+	for _, in := range handler.GetInputs() {
+		s.attachments = append(s.attachments, in)
+		fmt.Fprintf(s.out, "Attached %s\n", in.Path)
+	}
+	return nil
+}
+
+// send sends a message with the conversation so far and prints the reply
+func (s *chatSession) send(message string) error {
+	attachments := s.attachments
+	s.attachments = nil
+
+	prompt, file, err := s.buildPrompt(message, attachments)
+	if err != nil {
+		return err
+	}
+
+	var reply string
+	if file != nil {
+		reply, err = s.provider.SendPromptWithFile(s.model, prompt, *file)
+		if err == nil {
+			fmt.Fprintln(s.out, reply)
+		}
+	} else {
+		reply, err = s.complete(prompt)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.history = append(s.history, chatTurn{role: "User", content: message}, chatTurn{role: "Assistant", content: reply})
+	return nil
+}
+
+// complete sends a text prompt, streaming the reply when the provider supports it
+func (s *chatSession) complete(prompt string) (string, error) {
+	if rp, ok := s.provider.(models.ResponsesProvider); ok && s.stream {
+		handler := &chatStreamHandler{out: s.out}
+		err := rp.SendPromptWithResponsesStream(models.ResponsesConfig{Model: s.model, Input: prompt, Stream: true}, handler)
+		if err == nil {
+			fmt.Fprintln(s.out)
+			return handler.text.String(), nil
+		}
+		if handler.text.Len() > 0 {
+			return "", err
+		}
+		// Fall back to a regular request if streaming failed before any output
+	}
+	reply, err := s.provider.SendPrompt(s.model, prompt)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(s.out, reply)
+	return reply, nil
+}
+
+// buildPrompt renders the conversation and attachments. A single attachment
+// is returned as a file so images and documents reach the model intact;
+// several attachments must all be text and are inlined.
+func (s *chatSession) buildPrompt(message string, attachments []*input.Input) (string, *models.FileInput, error) {
+	var sb strings.Builder
+	for _, turn := range s.history {
+		sb.WriteString(fmt.Sprintf("%s: %s\n\n", turn.role, turn.content))
+	}
+
+	var file *models.FileInput
+	if len(attachments) == 1 && attachments[0].Type != input.SourceCodeInput {
+		file = &models.FileInput{Path: attachments[0].Path, MimeType: attachments[0].MimeType}
+	} else {
+		for _, in := range attachments {
+			if in.Type == input.ImageInput || (in.Type != input.SourceCodeInput && !isTextMimeType(in.MimeType)) {
+				return "", nil, fmt.Errorf("%s is not a text file; attach images and documents one at a time", in.Path)
+			}
+			sb.WriteString(fmt.Sprintf("--- %s ---\n%s\n\n", in.Path, in.Contents))
+		}
+	}
+
+	if len(s.history) == 0 && len(attachments) == 0 {
+		return message, nil, nil
+	}
+	sb.WriteString("User: " + message)
+	return sb.String(), file, nil
+}
+
+// isTextMimeType reports whether contents of this type can be inlined in a prompt
+func isTextMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" || mimeType == ""
+}
+
+// save appends the conversation's prompts as a standard step to a workflow file
+func (s *chatSession) save(file, stepName string) error {
+	var prompts []string
+	for _, turn := range s.history {
+		if turn.role == "User" {
+			prompts = append(prompts, turn.content)
+		}
+	}
+	if len(prompts) == 0 {
+		return fmt.Errorf("nothing to save yet")
+	}
+
+	existing, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s: %w", file, err)
+	}
+	if len(existing) > 0 {
+		var current processor.DSLConfig
+		if err := yaml.Unmarshal(existing, &current); err != nil {
+			return fmt.Errorf("error parsing %s: %w", file, err)
+		}
+		for _, step := range current.Steps {
+			if step.Name == stepName {
+				return fmt.Errorf("step '%s' already exists in %s", stepName, file)
+			}
+		}
+	}
+
+	var stepInput interface{} = "NA"
+	if len(s.attached) == 1 {
+		stepInput = s.attached[0]
+	} else if len(s.attached) > 1 {
+		stepInput = s.attached
+	}
+	step := map[string]interface{}{
+		stepName: struct {
+			Input  interface{} `yaml:"input"`
+			Model  string      `yaml:"model"`
+			Action string      `yaml:"action"`
+			Output string      `yaml:"output"`
+		}{stepInput, s.model, strings.Join(prompts, "\n\n"), "STDOUT"},
+	}
+	data, err := yaml.Marshal(step)
+	if err != nil {
+		return fmt.Errorf("error encoding step: %w", err)
+	}
+	if len(existing) > 0 {
+		if !strings.HasSuffix(string(existing), "\n") {
+			existing = append(existing, '\n')
+		}
+		data = append(append(existing, '\n'), data...)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", file, err)
+	}
+	return nil
+}
+
+// chatStreamHandler prints streamed text as it arrives
+type chatStreamHandler struct {
+	out  io.Writer
+	text strings.Builder
+}
+
+func (h *chatStreamHandler) OnResponseCreated(response map[string]interface{})        {}
+func (h *chatStreamHandler) OnResponseInProgress(response map[string]interface{})     {}
+func (h *chatStreamHandler) OnOutputItemAdded(index int, item map[string]interface{}) {}
+func (h *chatStreamHandler) OnResponseCompleted(response map[string]interface{})      {}
+func (h *chatStreamHandler) OnError(err error)                                        {}
+
+func (h *chatStreamHandler) OnOutputTextDelta(itemID string, index int, contentIndex int, delta string) {
+	h.text.WriteString(delta)
+	fmt.Fprint(h.out, delta)
+}
+
+func init() {
+	chatCmd.Flags().StringVarP(&chatModel, "model", "m", "", "Model to chat with (defaults to default_generation_model)")
+	chatCmd.RegisterFlagCompletionFunc("model", completeModelFlag)
+	chatCmd.Flags().BoolVar(&chatNoStream, "no-stream", false, "Wait for complete replies instead of streaming them")
+	rootCmd.AddCommand(chatCmd)
+}
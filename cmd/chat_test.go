@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"gopkg.in/yaml.v3"
+)
+
+// echoProvider records prompts and answers with a fixed reply
+type echoProvider struct {
+	prompts []string
+	files   []models.FileInput
+}
+
+func (e *echoProvider) Name() string                        { return "echo" }
+func (e *echoProvider) SupportsModel(modelName string) bool { return true }
+func (e *echoProvider) Configure(apiKey string) error       { return nil }
+func (e *echoProvider) SetVerbose(verbose bool)             {}
+
+func (e *echoProvider) SendPrompt(modelName string, prompt string) (string, error) {
+	e.prompts = append(e.prompts, prompt)
+	return "reply", nil
+}
+
+func (e *echoProvider) SendPromptWithFile(modelName string, prompt string, file models.FileInput) (string, error) {
+	e.files = append(e.files, file)
+	return e.SendPrompt(modelName, prompt)
+}
+
+func TestChatSession(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("buy milk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &echoProvider{}
+	var out bytes.Buffer
+	session := &chatSession{out: &out, resolve: func(string) (models.Provider, error) { return provider, nil }}
+	if err := session.switchModel("gpt-4o"); err != nil {
+		t.Fatal(err)
+	}
+
+	workflow := filepath.Join(dir, "chat.yaml")
+	script := strings.Join([]string{
+		"hello",
+		"/attach " + notes,
+		"summarize this",
+		"/save " + workflow + " summarize",
+		"/exit",
+		"never sent",
+	}, "\n")
+	if err := session.run(strings.NewReader(script)); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	if len(provider.prompts) != 2 {
+		t.Fatalf("expected 2 prompts, got %d", len(provider.prompts))
+	}
+	if provider.prompts[0] != "hello" {
+		t.Errorf("first prompt = %q", provider.prompts[0])
+	}
+	if !strings.Contains(provider.prompts[1], "User: hello\n\nAssistant: reply\n\nUser: summarize this") {
+		t.Errorf("second prompt missing history: %q", provider.prompts[1])
+	}
+	if len(provider.files) != 1 || provider.files[0].Path != notes {
+		t.Errorf("attachment not sent as a file: %v", provider.files)
+	}
+
+	data, err := os.ReadFile(workflow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg processor.DSLConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("saved workflow does not parse: %v", err)
+	}
+	if len(cfg.Steps) != 1 || cfg.Steps[0].Name != "summarize" {
+		t.Fatalf("unexpected steps: %+v", cfg.Steps)
+	}
+	step := cfg.Steps[0].Config
+	if step.Input != notes || step.Model != "gpt-4o" || step.Action != "hello\n\nsummarize this" {
+		t.Errorf("unexpected saved step: %+v", step)
+	}
+
+	if _, err := session.handleLine("/save " + workflow + " summarize"); err == nil {
+		t.Error("expected error saving a duplicate step name")
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Clipboard flag: copy the final output to the system clipboard
+var copyOutput bool
+
+// clipboardCommands are the tools tried, in order, to set the clipboard on
+// each platform
+var clipboardCommands = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip"}},
+	"linux": {
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+		{"clip.exe"}, // WSL
+	},
+}
+
+// clipboardCommand returns the first clipboard tool found for the platform.
+// wl-copy is only used in Wayland sessions.
+func clipboardCommand(goos string, getenv func(string) string, lookPath func(string) (string, error)) ([]string, error) {
+	candidates, ok := clipboardCommands[goos]
+	if !ok {
+		candidates = clipboardCommands["linux"]
+	}
+	var names []string
+	for _, candidate := range candidates {
+		names = append(names, candidate[0])
+		if candidate[0] == "wl-copy" && getenv("WAYLAND_DISPLAY") == "" {
+			continue
+		}
+		if _, err := lookPath(candidate[0]); err == nil {
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("no clipboard tool found (install one of: %s)", strings.Join(names, ", "))
+}
+
+// copyToClipboard places text on the system clipboard
+func copyToClipboard(text string) error {
+	command, err := clipboardCommand(runtime.GOOS, os.Getenv, exec.LookPath)
+	if err != nil {
+		return err
+	}
+	c := exec.Command(command[0], command[1:]...)
+	c.Stdin = strings.NewReader(text)
+	if out, err := c.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w %s", command[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// copyFinalOutput copies a run's final output when --copy or the env
+// config's output.copy is set
+func copyFinalOutput(output string) {
+	if !copyOutput && !envConfig.OutputSettings().Copy {
+		return
+	}
+	if strings.TrimSpace(output) == "" {
+		config.InfoLog("Nothing to copy: the workflow produced no output")
+		return
+	}
+	if err := copyToClipboard(output); err != nil {
+		log.Printf("Error copying output to clipboard: %v\n", err)
+		return
+	}
+	config.InfoLog("Output copied to clipboard")
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClipboardCommand(t *testing.T) {
+	installed := func(names ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			for _, n := range names {
+				if n == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", errors.New("not found")
+		}
+	}
+	noEnv := func(string) string { return "" }
+	wayland := func(key string) string {
+		if key == "WAYLAND_DISPLAY" {
+			return "wayland-0"
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name     string
+		goos     string
+		getenv   func(string) string
+		lookPath func(string) (string, error)
+		want     []string
+	}{
+		{"macOS", "darwin", noEnv, installed("pbcopy"), []string{"pbcopy"}},
+		{"X11", "linux", noEnv, installed("wl-copy", "xclip"), []string{"xclip", "-selection", "clipboard"}},
+		{"Wayland", "linux", wayland, installed("wl-copy", "xclip"), []string{"wl-copy"}},
+		{"xsel", "freebsd", noEnv, installed("xsel"), []string{"xsel", "--clipboard", "--input"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clipboardCommand(tt.goos, tt.getenv, tt.lookPath)
+			if err != nil {
+				t.Fatalf("clipboardCommand() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clipboardCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := clipboardCommand("linux", noEnv, installed())
+	if err == nil || !strings.Contains(err.Error(), "xclip") {
+		t.Errorf("clipboardCommand() error = %v, want the tools to install", err)
+	}
+}
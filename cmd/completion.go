@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// ollamaCompletionTimeout bounds how long completion waits for Ollama, so a
+// stopped or remote server doesn't stall the shell
+const ollamaCompletionTimeout = time.Second
+
+// completionModels lists the registered, configured and local Ollama models.
+// The root command skips its setup for completion requests, so the env
+// config is loaded here without prompting; when it can't be read, such as
+// when it is encrypted, there are no completions.
+func completionModels() []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(list []string) {
+		for _, name := range list {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	cfg := envConfig
+	if cfg == nil {
+		var err error
+		cfg, err = config.LoadEnvConfig(config.GetEnvPath())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+	add(models.GetRegistry().GetAllModelsList())
+	if cfg != nil {
+		add(cfg.GetAllConfiguredModels())
+	}
+
+	local := make(chan []string, 1)
+	go func() { local <- localModels() }()
+	select {
+	case ollama := <-local:
+		add(ollama)
+	case <-time.After(ollamaCompletionTimeout):
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// completeModelFlag completes a --model flag
+func completeModelFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var matches []string
+	for _, name := range completionModels() {
+		if strings.HasPrefix(name, toComplete) {
+			matches = append(matches, name)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeModelListFlag completes the last entry of a comma-separated
+// model list such as --models gpt-4o,cla
+func completeModelListFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix, last := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, last = toComplete[:i+1], toComplete[i+1:]
+	}
+	var matches []string
+	for _, name := range completionModels() {
+		if strings.HasPrefix(name, last) {
+			matches = append(matches, prefix+name)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// isWorkflowFile reports whether a YAML file has at least one step and only
+// known step fields, which rules out other YAML such as CI configs
+func isWorkflowFile(path string) bool {
+	data, cfg, err := readWorkflowFile(path)
+	if err != nil || len(cfg.Steps)+len(cfg.ParallelSteps)+len(cfg.Defer) == 0 {
+		return false
+	}
+	issues, err := processor.CheckStepFields(data)
+	return err == nil && len(issues) == 0
+}
+
+// completeWorkflowFiles completes workflow files and the directories that
+// may contain them
+func completeWorkflowFiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	dir, base := filepath.Split(toComplete)
+	entries, err := os.ReadDir(filepath.Join(".", dir))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		path := dir + name
+		if entry.IsDir() {
+			matches = append(matches, path+string(filepath.Separator))
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(name))
+		if (ext == ".yaml" || ext == ".yml") && isWorkflowFile(path) {
+			matches = append(matches, path)
+		}
+	}
+	// A lone directory match shouldn't be followed by a space, so the user
+	// can keep completing inside it
+	directive := cobra.ShellCompDirectiveNoFileComp
+	if len(matches) == 1 && strings.HasSuffix(matches[0], string(filepath.Separator)) {
+		directive |= cobra.ShellCompDirectiveNoSpace
+	}
+	return matches, directive
+}
+
+// completeWorkflowArgs completes workflow files for the first n positional
+// arguments, or for every argument when n is 0
+func completeWorkflowArgs(n int) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if n > 0 && len(args) >= n {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeWorkflowFiles(cmd, args, toComplete)
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestCompleteWorkflowFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"review.yaml":           "review:\n  input: NA\n  model: gpt-4o\n  action: Review\n  output: STDOUT\n",
+		"notes.yml":             "parallel-process:\n  a:\n    input: NA\n    model: gpt-4o\n    action: A\n    output: STDOUT\n",
+		"ci.yaml":               "jobs:\n  build:\n    runs-on: ubuntu-latest\n",
+		"broken.yaml":           "review: [\n",
+		"readme.md":             "# Notes\n",
+		"flows/digest.yaml":     "digest:\n  input: NA\n  model: gpt-4o\n  action: Digest\n  output: STDOUT\n",
+		".hidden/secret.yaml":   "x:\n  input: NA\n",
+		"flows/empty/.keep.txt": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	sep := string(filepath.Separator)
+	tests := []struct {
+		toComplete string
+		want       []string
+		noSpace    bool
+	}{
+		{"", []string{"flows" + sep, "notes.yml", "review.yaml"}, false},
+		{"re", []string{"review.yaml"}, false},
+		{"fl", []string{"flows" + sep}, true},
+		{"flows/", []string{"flows/digest.yaml", "flows/empty" + sep}, false},
+		{".h", []string{".hidden" + sep}, true},
+	}
+	for _, tt := range tests {
+		got, directive := completeWorkflowFiles(nil, nil, tt.toComplete)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("completeWorkflowFiles(%q) = %v, want %v", tt.toComplete, got, tt.want)
+		}
+		if noSpace := directive&cobra.ShellCompDirectiveNoSpace != 0; noSpace != tt.noSpace {
+			t.Errorf("completeWorkflowFiles(%q) NoSpace = %v", tt.toComplete, noSpace)
+		}
+	}
+}
+
+func TestCompleteModelListFlag(t *testing.T) {
+	got, _ := completeModelListFlag(nil, nil, "gpt-4o,gpt")
+	if len(got) == 0 {
+		t.Fatal("expected completions")
+	}
+	for _, c := range got {
+		if !strings.HasPrefix(c, "gpt-4o,gpt") {
+			t.Errorf("completion %q does not extend the list", c)
+		}
+	}
+}
+
+func TestCompletionSkipsRootSetup(t *testing.T) {
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, ".env")
+	plain := "providers:\n  openai:\n    api_key: sk-test\n    models:\n      - name: gpt-custom\n        type: external\n        modes: [text]\n"
+	if err := os.WriteFile(envPath, []byte(plain), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("COMANDA_ENV", envPath)
+	saved := envConfig
+	defer func() { envConfig = saved }()
+
+	complete := func() string {
+		envConfig = nil
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		rootCmd.SetErr(&out)
+		rootCmd.SetArgs([]string{cobra.ShellCompRequestCmd, "chat", "--model", "gpt-c"})
+		defer rootCmd.SetArgs(nil)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("completion failed: %v\n%s", err, out.String())
+		}
+		return out.String()
+	}
+
+	if out := complete(); !strings.Contains(out, "gpt-custom") {
+		t.Errorf("completion doesn't offer the configured model:\n%s", out)
+	}
+
+	if err := config.EncryptConfig(envPath, "secret-password"); err != nil {
+		t.Fatal(err)
+	}
+	if out := complete(); strings.Contains(out, "gpt-") || strings.Contains(out, "error") {
+		t.Errorf("completion with an encrypted config should quietly offer nothing:\n%s", out)
+	}
+}
@@ -10,13 +10,16 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/database"
+	"github.com/kris-hansen/comanda/utils/history"
 	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/schedule"
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
@@ -30,6 +33,8 @@ var (
 	databaseFlag                  bool
 	setDefaultGenerationModelFlag string
 	defaultFlag                   bool
+	wizardFlag                    bool
+	migrateFlag                   bool
 )
 
 // Green checkmark for successful operations
@@ -564,15 +569,36 @@ func getAllConfiguredModelNames(envConfig *config.EnvConfig) []string {
 var configureCmd = &cobra.Command{
 	Use:   "configure",
 	Short: "Configure model settings",
-	Long:  `Configure model settings including provider model name and API key`,
+	Long: `Configure model settings including provider model name and API key.
+
+Use --wizard for guided setup: it walks through every supported provider,
+tests each API key live, lists the models the key can use, sets the default
+generation model and saves the configuration, encrypted if you choose.
+
+Use --migrate to move a .env in the working directory, and history and
+schedules from ~/.comanda, to the XDG config and data directories.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if listFlag {
 			listConfiguration()
 			return
 		}
 
+		if migrateFlag {
+			if err := migrateDirs(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			return
+		}
+
 		configPath := config.GetEnvPath()
 
+		if wizardFlag {
+			if err := runConfigWizard(newConfigWizard(envConfig), configPath); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			return
+		}
+
 		if encryptFlag {
 			password, err := config.PromptPassword("Enter encryption password (minimum 6 characters): ")
 			if err != nil {
@@ -617,7 +643,7 @@ var configureCmd = &cobra.Command{
 				return
 			}
 
-			password, err := config.PromptPassword("Enter decryption password: ")
+			password, err := config.ReadPassphrase("Enter decryption password: ")
 			if err != nil {
 				fmt.Printf("Error reading password: %v\n", err)
 				return
@@ -647,7 +673,7 @@ var configureCmd = &cobra.Command{
 			data, err := os.ReadFile(configPath)
 			if err == nil && config.IsEncrypted(data) {
 				wasEncrypted = true
-				password, err := config.PromptPassword("Enter decryption password: ")
+				password, err := config.ReadPassphrase("Enter decryption password: ")
 				if err != nil {
 					fmt.Printf("Error reading password: %v\n", err)
 					return
@@ -757,6 +783,7 @@ var configureCmd = &cobra.Command{
 			} else {
 				apiKey = existingProvider.APIKey
 			}
+			config.AddSecret(apiKey)
 
 			// Get available models based on provider
 			var selectedModels []string
@@ -770,7 +797,7 @@ var configureCmd = &cobra.Command{
 				// Fetch and categorize OpenAI models
 				primaryModels, otherModels, err := getOpenAIModelsAndCategorize(apiKey)
 				if err != nil {
-					fmt.Printf("Error fetching OpenAI models: %v\n", err)
+					fmt.Printf("Error fetching OpenAI models: %s\n", config.RedactError(err))
 					return
 				}
 
@@ -844,7 +871,7 @@ var configureCmd = &cobra.Command{
 			case "ollama":
 				models, err := getOllamaModels()
 				if err != nil {
-					fmt.Printf("Error fetching Ollama models: %v\n", err)
+					fmt.Printf("Error fetching Ollama models: %s\n", config.RedactError(err))
 					return
 				}
 				modelNames := make([]string, len(models))
@@ -977,6 +1004,51 @@ func listConfiguration() {
 		fmt.Printf("Default Generation Model: %s\n\n", cfg.DefaultGenerationModel)
 	}
 
+	// List profiles, marking the one in use
+	if names := cfg.ProfileNames(); len(names) > 0 {
+		fmt.Println("Profiles:")
+		for _, name := range names {
+			marker := ""
+			if name == cfg.ProfileName() {
+				marker = " (in use)"
+			}
+			fmt.Printf("  - %s%s\n", name, marker)
+		}
+		fmt.Println()
+	}
+
+	// List the model policy runs follow
+	if policy := cfg.PolicySettings(); !reflect.DeepEqual(policy, config.Policy{}) {
+		fmt.Println("Model Policy:")
+		if len(policy.AllowedProviders) > 0 {
+			fmt.Printf("  Allowed providers: %s\n", strings.Join(policy.AllowedProviders, ", "))
+		}
+		if len(policy.DeniedModels) > 0 {
+			fmt.Printf("  Denied models: %s\n", strings.Join(policy.DeniedModels, ", "))
+		}
+		stepTypes := make([]string, 0, len(policy.DefaultModels))
+		for stepType := range policy.DefaultModels {
+			stepTypes = append(stepTypes, stepType)
+		}
+		sort.Strings(stepTypes)
+		for _, stepType := range stepTypes {
+			fmt.Printf("  Default model for %s steps: %s\n", stepType, policy.DefaultModels[stepType])
+		}
+		if policy.MaxTemperature > 0 {
+			fmt.Printf("  Max temperature: %g\n", policy.MaxTemperature)
+		}
+		fmt.Println()
+	}
+
+	// List the environment variables overriding settings
+	if names := cfg.EnvVarNames(); len(names) > 0 {
+		fmt.Println("Overridden by environment variables:")
+		for _, name := range names {
+			fmt.Printf("  - %s\n", name)
+		}
+		fmt.Println()
+	}
+
 	// List server configuration if it exists
 	if server := cfg.GetServerConfig(); server != nil {
 		fmt.Println("Server Configuration:")
@@ -1031,6 +1103,23 @@ func listConfiguration() {
 	}
 }
 
+// migrateDirs moves the env config, history and schedules of earlier
+// versions to the config and data directories and prints where each is kept
+func migrateDirs() error {
+	if _, err := os.Stat(".env"); err == nil && os.Getenv("COMANDA_ENV") == "" {
+		path, err := config.MigrateEnvFile()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s Moved .env to %s\n", greenCheckmark, path)
+	}
+	fmt.Printf("Env config: %s\n", config.GetEnvPath())
+	fmt.Printf("History:    %s\n", history.DefaultDir())
+	fmt.Printf("Schedules:  %s\n", schedule.DefaultPath())
+	fmt.Printf("Cache:      %s\n", config.CacheDir())
+	return nil
+}
+
 func init() {
 	configureCmd.Flags().BoolVar(&listFlag, "list", false, "List all configured providers and models")
 	configureCmd.Flags().BoolVar(&encryptFlag, "encrypt", false, "Encrypt the configuration file")
@@ -1040,5 +1129,7 @@ func init() {
 	configureCmd.Flags().BoolVar(&databaseFlag, "database", false, "Configure database settings")
 	configureCmd.Flags().StringVar(&setDefaultGenerationModelFlag, "set-default-generation-model", "", "Set the default model for workflow generation")
 	configureCmd.Flags().BoolVar(&defaultFlag, "default", false, "Interactively set the default model for workflow generation")
+	configureCmd.Flags().BoolVar(&wizardFlag, "wizard", false, "Set up every provider step by step, testing each API key")
+	configureCmd.Flags().BoolVar(&migrateFlag, "migrate", false, "Move .env and ~/.comanda contents to the XDG config and data directories")
 	rootCmd.AddCommand(configureCmd)
 }
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// newPassphraseEnv supplies the new passphrase to rotate-key without a prompt
+const newPassphraseEnv = "COMANDA_NEW_PASSPHRASE"
+
+var newPassphraseFile string
+var agentSocket string
+
+// loadNothing replaces the root command's setup for commands that read the
+// encrypted env file themselves
+func loadNothing(cmd *cobra.Command, args []string) error {
+	return setLogLevel()
+}
+
+var configureRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Re-encrypt the env config with a new passphrase",
+	Long: `Decrypt the env config with its current passphrase and encrypt it again
+with a new one. The file is replaced in one step, so it is never left half
+written or unencrypted.
+
+The current passphrase comes from COMANDA_PASSPHRASE, COMANDA_PASSPHRASE_FILE,
+the passphrase agent or a prompt; the new one from --new-passphrase-file,
+COMANDA_NEW_PASSPHRASE or a prompt. Update whatever supplies the passphrase to
+servers, and restart the passphrase agent, afterwards.`,
+	Args:              cobra.NoArgs,
+	PersistentPreRunE: loadNothing,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := config.GetEnvPath()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading env file: %w", err)
+		}
+		if !config.IsEncrypted(data) {
+			return fmt.Errorf("%s is not encrypted; use 'comanda configure --encrypt' to encrypt it", path)
+		}
+
+		current, err := config.ReadPassphrase("Enter current passphrase: ")
+		if err != nil {
+			return err
+		}
+		plaintext, err := config.DecryptConfig(data, current)
+		if err != nil {
+			return err
+		}
+
+		next, err := readNewPassphrase()
+		if err != nil {
+			return err
+		}
+		if next == current {
+			return errors.New("the new passphrase is the same as the current one")
+		}
+		encrypted, err := config.EncryptData(plaintext, next)
+		if err != nil {
+			return err
+		}
+		if _, err := config.DecryptConfig(encrypted, next); err != nil {
+			return fmt.Errorf("error checking the re-encrypted config: %w", err)
+		}
+		if err := config.WriteFileAtomic(path, encrypted); err != nil {
+			return fmt.Errorf("error writing env file: %w", err)
+		}
+		fmt.Printf("%s Re-encrypted %s with the new passphrase\n", greenCheckmark, path)
+		return nil
+	},
+}
+
+// readNewPassphrase returns the passphrase rotate-key encrypts with
+func readNewPassphrase() (string, error) {
+	passphrase := os.Getenv(newPassphraseEnv)
+	if newPassphraseFile != "" {
+		data, err := os.ReadFile(newPassphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading new passphrase file: %w", err)
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+	if passphrase == "" {
+		var err error
+		passphrase, err = config.PromptPassword("Enter new passphrase (minimum 6 characters): ")
+		if err != nil {
+			return "", err
+		}
+		confirm, err := config.PromptPassword("Confirm new passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if passphrase != confirm {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	if err := validatePassword(passphrase); err != nil {
+		return "", err
+	}
+	return passphrase, nil
+}
+
+var configureAgentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Hand the env config passphrase to comanda processes over a socket",
+	Long: `Ask for the passphrase of the encrypted env config once, check it, and
+keep it in memory, handing it to every comanda process of this user that reads
+the env config, such as a server started by a service manager. The agent
+listens on a Unix socket readable only by you, $XDG_RUNTIME_DIR/comanda/passphrase.sock
+by default, until interrupted. Processes find it there, or at
+COMANDA_PASSPHRASE_SOCKET.`,
+	Args:              cobra.NoArgs,
+	PersistentPreRunE: loadNothing,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := config.GetEnvPath()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading env file: %w", err)
+		}
+		if !config.IsEncrypted(data) {
+			return fmt.Errorf("%s is not encrypted, so it needs no passphrase", path)
+		}
+
+		// The agent's own socket can't supply the passphrase
+		passphrase := os.Getenv(config.PassphraseEnv)
+		if passphrase == "" {
+			passphrase, err = config.PromptPassword("Enter decryption password: ")
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := config.DecryptConfig(data, passphrase); err != nil {
+			return err
+		}
+
+		socket := agentSocket
+		if socket == "" {
+			socket = config.PassphraseSocketPath()
+		}
+		listener, err := config.ListenPassphraseSocket(socket)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(socket)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			listener.Close()
+		}()
+		fmt.Printf("Passphrase agent listening on %s\n", socket)
+		if agentSocket != "" {
+			fmt.Printf("Set %s=%s for comanda to find it\n", config.PassphraseSocketEnv, socket)
+		}
+		return config.ServePassphrase(listener, passphrase)
+	},
+}
+
+func init() {
+	configureRotateKeyCmd.Flags().StringVar(&newPassphraseFile, "new-passphrase-file", "", "Read the new passphrase from a file instead of prompting")
+	configureAgentCmd.Flags().StringVar(&agentSocket, "socket", "", "Listen on this socket instead of the default")
+	configureCmd.AddCommand(configureRotateKeyCmd, configureAgentCmd)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestRotateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	plaintext := []byte("default_generation_model: gpt-4o\n")
+	encrypted, _ := config.EncryptData(plaintext, "old-passphrase")
+	os.WriteFile(path, encrypted, 0600)
+	t.Setenv("COMANDA_ENV", path)
+	t.Setenv(config.PassphraseEnv, "old-passphrase")
+	t.Setenv(config.PassphraseFileEnv, "")
+
+	t.Setenv(newPassphraseEnv, "old-passphrase")
+	if err := configureRotateKeyCmd.RunE(configureRotateKeyCmd, nil); err == nil || !strings.Contains(err.Error(), "same as the current") {
+		t.Errorf("rotating to the same passphrase: error = %v", err)
+	}
+
+	t.Setenv(newPassphraseEnv, "new-passphrase")
+	if err := configureRotateKeyCmd.RunE(configureRotateKeyCmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if _, err := config.DecryptConfig(data, "old-passphrase"); err == nil {
+		t.Error("the old passphrase still decrypts the file")
+	}
+	if got, err := config.DecryptConfig(data, "new-passphrase"); err != nil || string(got) != string(plaintext) {
+		t.Errorf("DecryptConfig() with the new passphrase = %q, %v", got, err)
+	}
+
+	// A wrong current passphrase leaves the file alone
+	t.Setenv(newPassphraseEnv, "third-passphrase")
+	if err := configureRotateKeyCmd.RunE(configureRotateKeyCmd, nil); err == nil {
+		t.Error("rotated with the wrong current passphrase")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Error("a failed rotation changed the file")
+	}
+}
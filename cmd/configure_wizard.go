@@ -0,0 +1,455 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// wizardProviders lists the providers the wizard walks through, in order
+var wizardProviders = []struct {
+	name, title, keyURL string
+}{
+	{"openai", "OpenAI", "https://platform.openai.com/api-keys"},
+	{"anthropic", "Anthropic", "https://console.anthropic.com/settings/keys"},
+	{"google", "Google", "https://aistudio.google.com/app/apikey"},
+	{"xai", "X.AI", "https://console.x.ai"},
+	{"deepseek", "Deepseek", "https://platform.deepseek.com/api_keys"},
+	{"moonshot", "Moonshot", "https://platform.moonshot.ai/console/api-keys"},
+	{"ollama", "Ollama (local models)", ""},
+}
+
+// configWizard walks through setting up every provider. The network and
+// terminal are reached through its function fields so tests can replace them.
+type configWizard struct {
+	in  *bufio.Reader
+	out io.Writer
+	cfg *config.EnvConfig
+
+	secret       func(prompt string) (string, error) // Reads a key or password without echoing it
+	checkKey     func(provider, apiKey string) doctorCheck
+	listModels   func(provider, apiKey string) ([]string, error)
+	ollamaModels func() ([]OllamaModel, error)
+}
+
+// newConfigWizard returns a wizard reading from the terminal
+func newConfigWizard(cfg *config.EnvConfig) *configWizard {
+	client := &http.Client{Timeout: 15 * time.Second}
+	w := &configWizard{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+		cfg: cfg,
+		checkKey: func(provider, apiKey string) doctorCheck {
+			check, _ := checkProviderKey(client, provider, apiKey)
+			return check
+		},
+		listModels: func(provider, apiKey string) ([]string, error) {
+			return fetchProviderModels(client, provider, apiKey)
+		},
+		ollamaModels: getOllamaModels,
+	}
+	w.secret = w.readLine
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		w.secret = config.PromptPassword
+	}
+	return w
+}
+
+// readLine prompts for and reads one trimmed line
+func (w *configWizard) readLine(prompt string) (string, error) {
+	fmt.Fprint(w.out, prompt)
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("input ended before the wizard finished")
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// confirm asks a yes/no question; an empty answer picks the default
+func (w *configWizard) confirm(prompt string, def bool) (bool, error) {
+	hint := " [y/N]: "
+	if def {
+		hint = " [Y/n]: "
+	}
+	for {
+		answer, err := w.readLine(prompt + hint)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(w.out, "Please answer y or n.")
+	}
+}
+
+// run walks through the providers and the default generation model. It
+// changes w.cfg; saving is left to the caller.
+func (w *configWizard) run() error {
+	fmt.Fprintln(w.out, "This wizard sets up the model providers comanda can use. Press Enter to skip a provider.")
+	for _, p := range wizardProviders {
+		fmt.Fprintf(w.out, "\n== %s ==\n", p.title)
+		var err error
+		if p.name == "ollama" {
+			err = w.configureOllama()
+		} else {
+			err = w.configureProvider(p.name, p.keyURL)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return w.chooseDefaultModel()
+}
+
+// configureProvider asks for a provider's key, checks it live and lets the
+// user pick from the models the key can use
+func (w *configWizard) configureProvider(name, keyURL string) error {
+	existing, _ := w.cfg.GetProviderConfig(name)
+	prompt := "API key (Enter to skip): "
+	if existing != nil && existing.APIKey != "" {
+		prompt = fmt.Sprintf("API key (Enter to keep %s): ", maskKey(existing.APIKey))
+	} else if keyURL != "" {
+		fmt.Fprintf(w.out, "Create a key at %s\n", keyURL)
+	}
+
+	var apiKey string
+	for {
+		key, err := w.secret(prompt)
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			if existing == nil || existing.APIKey == "" {
+				fmt.Fprintln(w.out, "Skipped")
+				return nil
+			}
+			key = existing.APIKey
+		}
+
+		check := w.checkKey(name, key)
+		fmt.Fprintf(w.out, "Testing key... %s\n", check.Detail)
+		if check.Status != checkFail {
+			apiKey = key
+			break
+		}
+		if check.Fix != "" {
+			fmt.Fprintln(w.out, check.Fix)
+		}
+		retry, err := w.confirm("Try another key?", true)
+		if err != nil {
+			return err
+		}
+		if !retry {
+			fmt.Fprintln(w.out, "Skipped")
+			return nil
+		}
+	}
+
+	available, err := w.listModels(name, apiKey)
+	if err != nil || len(available) == 0 {
+		if err != nil {
+			fmt.Fprintf(w.out, "Could not fetch the model list (%v); showing the models comanda knows.\n", err)
+		}
+		available = models.GetRegistry().GetModels(name)
+	}
+	return w.pickModels(name, apiKey, "external", available)
+}
+
+// configureOllama offers the models pulled into a local Ollama server
+func (w *configWizard) configureOllama() error {
+	pulled, err := w.ollamaModels()
+	if err != nil {
+		fmt.Fprintln(w.out, "Ollama is not running; skipped. Start it with 'ollama serve' to use local models.")
+		return nil
+	}
+	if len(pulled) == 0 {
+		fmt.Fprintln(w.out, "No models pulled yet; skipped. Pull one with 'ollama pull <model>'.")
+		return nil
+	}
+	use, err := w.confirm(fmt.Sprintf("Ollama is running with %d model(s). Use them?", len(pulled)), true)
+	if err != nil || !use {
+		return err
+	}
+	names := make([]string, len(pulled))
+	for i, m := range pulled {
+		names[i] = m.Name
+	}
+	return w.pickModels("ollama", "", "local", names)
+}
+
+// pickModels lets the user choose models, and the modes of newly added ones,
+// then stores the provider. Models already configured are preselected.
+func (w *configWizard) pickModels(provider, apiKey, modelType string, available []string) error {
+	existing, _ := w.cfg.GetProviderConfig(provider)
+	configured := make(map[string]bool)
+	if existing != nil {
+		for _, m := range existing.Models {
+			configured[m.Name] = true
+		}
+	}
+
+	fmt.Fprintln(w.out, "Available models:")
+	var current []string
+	for i, name := range available {
+		mark := ""
+		if configured[name] {
+			mark = " (configured)"
+			current = append(current, strconv.Itoa(i+1))
+		}
+		fmt.Fprintf(w.out, "  %d. %s%s\n", i+1, name, mark)
+	}
+
+	var selected []int
+	for {
+		prompt := "Models to use (e.g. 1,3-4): "
+		if len(current) > 0 {
+			prompt = fmt.Sprintf("Models to use (Enter keeps %s): ", strings.Join(current, ","))
+		}
+		input, err := w.readLine(prompt)
+		if err != nil {
+			return err
+		}
+		if input == "" {
+			input = strings.Join(current, ",")
+		}
+		if input == "" {
+			fmt.Fprintln(w.out, "Choose at least one model.")
+			continue
+		}
+		if selected, err = parseModelSelection(input, len(available)); err != nil {
+			fmt.Fprintf(w.out, "Error: %v\n", err)
+			continue
+		}
+		break
+	}
+
+	if existing == nil {
+		w.cfg.AddProvider(provider, config.Provider{APIKey: apiKey})
+	} else {
+		existing.APIKey = apiKey
+	}
+	var added []string
+	for _, n := range selected {
+		if name := available[n-1]; !configured[name] {
+			added = append(added, name)
+		}
+	}
+	// Models that were already configured keep their modes
+	if len(added) > 0 {
+		modes, err := w.chooseModes()
+		if err != nil {
+			return err
+		}
+		for _, name := range added {
+			if err := w.cfg.AddModelToProvider(provider, config.Model{Name: name, Type: modelType, Modes: modes}); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(w.out, "%s %s: %d model(s) configured\n", greenCheckmark, provider, len(selected))
+	return nil
+}
+
+// chooseModes asks once for the modes of the models being added
+func (w *configWizard) chooseModes() ([]config.ModelMode, error) {
+	choices := []config.ModelMode{config.TextMode, config.VisionMode, config.MultiMode, config.FileMode}
+	for {
+		input, err := w.readLine("Modes for these models: 1. text 2. vision 3. multi 4. file (Enter for text): ")
+		if err != nil {
+			return nil, err
+		}
+		if input == "" {
+			return []config.ModelMode{config.TextMode}, nil
+		}
+		selected, err := parseModelSelection(input, len(choices))
+		if err != nil {
+			fmt.Fprintf(w.out, "Error: %v\n", err)
+			continue
+		}
+		modes := make([]config.ModelMode, len(selected))
+		for i, n := range selected {
+			modes[i] = choices[n-1]
+		}
+		return modes, nil
+	}
+}
+
+// chooseDefaultModel sets the default model for 'comanda generate'
+func (w *configWizard) chooseDefaultModel() error {
+	all := getAllConfiguredModelNames(w.cfg)
+	if len(all) == 0 {
+		fmt.Fprintln(w.out, "\nNo models configured. Run 'comanda configure --wizard' again when you have an API key or Ollama running.")
+		return nil
+	}
+	sort.Strings(all)
+	fmt.Fprintln(w.out, "\n== Default model for 'comanda generate' ==")
+	for i, name := range all {
+		mark := ""
+		if name == w.cfg.DefaultGenerationModel {
+			mark = " (current default)"
+		}
+		fmt.Fprintf(w.out, "  %d. %s%s\n", i+1, name, mark)
+	}
+	for {
+		input, err := w.readLine("Default model number (Enter to leave unchanged): ")
+		if err != nil {
+			return err
+		}
+		if input == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(input)
+		if err != nil || n < 1 || n > len(all) {
+			fmt.Fprintln(w.out, "Please enter a number from the list.")
+			continue
+		}
+		w.cfg.DefaultGenerationModel = all[n-1]
+		return nil
+	}
+}
+
+// choosePassword asks whether to encrypt the env file and for its password
+func (w *configWizard) choosePassword() (string, error) {
+	encrypt, err := w.confirm("\nEncrypt the configuration file with a password? API keys are stored in it.", true)
+	if err != nil || !encrypt {
+		return "", err
+	}
+	for {
+		password, err := w.secret("Encryption password (minimum 6 characters): ")
+		if err != nil {
+			return "", err
+		}
+		if err := validatePassword(password); err != nil {
+			fmt.Fprintf(w.out, "Error: %v\n", err)
+			continue
+		}
+		confirmPassword, err := w.secret("Confirm encryption password: ")
+		if err != nil {
+			return "", err
+		}
+		if password != confirmPassword {
+			fmt.Fprintln(w.out, "Passwords do not match.")
+			continue
+		}
+		return password, nil
+	}
+}
+
+// runConfigWizard runs the wizard and saves the configuration, encrypted if
+// the user chooses a password
+func runConfigWizard(w *configWizard, configPath string) error {
+	if err := w.run(); err != nil {
+		return err
+	}
+	password, err := w.choosePassword()
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(configPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creating directory: %w", err)
+		}
+	}
+	if err := config.SaveEnvConfig(configPath, w.cfg); err != nil {
+		return fmt.Errorf("error saving configuration: %w", err)
+	}
+	if password != "" {
+		if err := config.EncryptConfig(configPath, password); err != nil {
+			return fmt.Errorf("error encrypting configuration: %w", err)
+		}
+	}
+	fmt.Fprintf(w.out, "\n%s Configuration saved to %s", greenCheckmark, configPath)
+	if password != "" {
+		fmt.Fprint(w.out, " (encrypted)")
+	}
+	fmt.Fprintln(w.out, "\nTry it with 'comanda doctor', or 'comanda generate \"<what you want done>\"'.")
+	return nil
+}
+
+// fetchProviderModels lists the models an API key can use, keeping those
+// comanda supports. Models comanda knows come first, in its registry order.
+func fetchProviderModels(client *http.Client, provider, apiKey string) ([]string, error) {
+	endpoint, ok := providerEndpoints[provider]
+	if !ok {
+		return nil, fmt.Errorf("no model listing for %s", provider)
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.auth(req, apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	var listing struct {
+		Data   []struct{ ID string }   `json:"data"`   // OpenAI compatible and Anthropic
+		Models []struct{ Name string } `json:"models"` // Google
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("error decoding model list: %w", err)
+	}
+	var ids []string
+	for _, m := range listing.Data {
+		ids = append(ids, m.ID)
+	}
+	for _, m := range listing.Models {
+		ids = append(ids, strings.TrimPrefix(m.Name, "models/"))
+	}
+	return supportedModels(provider, ids), nil
+}
+
+// supportedModels filters a provider's model list down to models comanda can
+// call, known models first
+func supportedModels(provider string, ids []string) []string {
+	p := models.ProviderByName(provider)
+	listed := make(map[string]bool)
+	for _, id := range ids {
+		if p != nil && p.SupportsModel(id) && !isUnsupportedModel(id) {
+			listed[id] = true
+		}
+	}
+	var known, others []string
+	for _, id := range models.GetRegistry().GetModels(provider) {
+		if listed[id] {
+			known = append(known, id)
+			delete(listed, id)
+		}
+	}
+	for id := range listed {
+		others = append(others, id)
+	}
+	sort.Strings(others)
+	return append(known, others...)
+}
+
+// maskKey shows the end of an API key
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// scriptedWizard returns a wizard that answers prompts from lines and fakes
+// the provider APIs: only keys starting with "good-" are accepted
+func scriptedWizard(cfg *config.EnvConfig, lines ...string) (*configWizard, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	w := &configWizard{
+		in:  bufio.NewReader(strings.NewReader(strings.Join(lines, "\n") + "\n")),
+		out: out,
+		cfg: cfg,
+		checkKey: func(provider, apiKey string) doctorCheck {
+			if strings.HasPrefix(apiKey, "good-") {
+				return doctorCheck{Status: checkOK, Detail: "accepted"}
+			}
+			return doctorCheck{Status: checkFail, Detail: "rejected (HTTP 401)"}
+		},
+		listModels: func(provider, apiKey string) ([]string, error) {
+			if provider == "anthropic" {
+				return nil, fmt.Errorf("HTTP 500")
+			}
+			return []string{provider + "-large", provider + "-small"}, nil
+		},
+		ollamaModels: func() ([]OllamaModel, error) {
+			return []OllamaModel{{Name: "llama3:8b"}}, nil
+		},
+	}
+	w.secret = w.readLine
+	return w, out
+}
+
+func TestConfigWizard(t *testing.T) {
+	cfg := &config.EnvConfig{}
+	w, out := scriptedWizard(cfg,
+		"bad-key", "y", "good-openai", "2", "1,2", // OpenAI: retry after a rejected key, pick model 2 as text+vision
+		"good-anthropic", "1", "", // Anthropic: listing fails, falls back to the registry
+		"", "", "", "", // Skip Google, X.AI, Deepseek and Moonshot
+		"", "1", "4", // Ollama: use the pulled model in file mode
+		"2", // Default generation model
+		"n", // Don't encrypt
+	)
+	path := filepath.Join(t.TempDir(), "conf", ".env")
+	if err := runConfigWizard(w, path); err != nil {
+		t.Fatalf("runConfigWizard() error = %v\n%s", err, out)
+	}
+
+	openai := cfg.Providers["openai"]
+	if openai == nil || openai.APIKey != "good-openai" || len(openai.Models) != 1 || openai.Models[0].Name != "openai-small" {
+		t.Fatalf("unexpected openai config: %+v", openai)
+	}
+	if !reflect.DeepEqual(openai.Models[0].Modes, []config.ModelMode{config.TextMode, config.VisionMode}) {
+		t.Errorf("openai modes = %v", openai.Models[0].Modes)
+	}
+	if anthropic := cfg.Providers["anthropic"]; anthropic == nil || len(anthropic.Models) != 1 || !strings.HasPrefix(anthropic.Models[0].Name, "claude-") {
+		t.Errorf("expected a registry model for anthropic, got %+v", anthropic)
+	}
+	if _, ok := cfg.Providers["google"]; ok {
+		t.Error("skipped provider was configured")
+	}
+	ollama := cfg.Providers["ollama"]
+	if ollama == nil || ollama.Models[0].Name != "llama3:8b" || ollama.Models[0].Type != "local" || ollama.Models[0].Modes[0] != config.FileMode {
+		t.Errorf("unexpected ollama config: %+v", ollama)
+	}
+	// Configured models are listed sorted: claude-..., llama3:8b, openai-small
+	if cfg.DefaultGenerationModel != "llama3:8b" {
+		t.Errorf("DefaultGenerationModel = %q", cfg.DefaultGenerationModel)
+	}
+	if !strings.Contains(out.String(), "Could not fetch the model list") {
+		t.Errorf("missing fallback notice in output:\n%s", out)
+	}
+
+	saved, err := config.LoadEnvConfig(path)
+	if err != nil {
+		t.Fatalf("error loading saved config: %v", err)
+	}
+	if saved.Providers["openai"].APIKey != "good-openai" {
+		t.Errorf("saved config is missing the openai key")
+	}
+}
+
+func TestConfigWizardKeepsExistingSettings(t *testing.T) {
+	cfg := &config.EnvConfig{DefaultGenerationModel: "openai-large"}
+	cfg.AddProvider("openai", config.Provider{APIKey: "good-existing", Models: []config.Model{
+		{Name: "openai-large", Type: "external", Modes: []config.ModelMode{config.VisionMode}},
+	}})
+	w, out := scriptedWizard(cfg,
+		"", "", // OpenAI: keep the key and the configured model
+		"", "", "", "", "", // Skip the other hosted providers
+		"n",                                           // Don't use Ollama
+		"",                                            // Keep the default model
+		"y", "short", "secret1", "secret1", "secret1", // Encrypt, after a too-short password
+	)
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := runConfigWizard(w, path); err != nil {
+		t.Fatalf("runConfigWizard() error = %v\n%s", err, out)
+	}
+
+	models := cfg.Providers["openai"].Models
+	if len(models) != 1 || !reflect.DeepEqual(models[0].Modes, []config.ModelMode{config.VisionMode}) {
+		t.Errorf("existing model changed: %+v", models)
+	}
+	if cfg.DefaultGenerationModel != "openai-large" {
+		t.Errorf("DefaultGenerationModel = %q", cfg.DefaultGenerationModel)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.IsEncrypted(data) {
+		t.Error("configuration was not encrypted")
+	}
+	if !strings.Contains(out.String(), "password must be at least 6 characters") {
+		t.Errorf("short password was not rejected:\n%s", out)
+	}
+}
+
+func TestSupportedModels(t *testing.T) {
+	got := supportedModels("openai", []string{"whisper-1", "gpt-4o", "gpt-zeta-test", "claude-3-opus", "text-embedding-3-small"})
+	if len(got) == 0 || got[0] != "gpt-4o" {
+		t.Fatalf("supportedModels() = %v, expected gpt-4o first", got)
+	}
+	for _, id := range got {
+		if id == "whisper-1" || id == "claude-3-opus" || id == "text-embedding-3-small" {
+			t.Errorf("supportedModels() kept %s: %v", id, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/convert"
+)
+
+// Convert command flags
+var convertFrom string
+var convertOutput string
+var convertModel string
+var convertForce bool
+
+var convertCmd = &cobra.Command{
+	Use:   "convert <file>",
+	Short: "Convert OpenAI, LangChain or plain prompt files into a workflow",
+	Long: `Convert prompts written for other tools into a comanda workflow:
+
+  openai     An Assistant or a list holding one, a Playground preset or a
+             chat completions request body
+  langchain  An LCEL chain serialized with langchain's dumps() or dumpd()
+  text       A prompt file; lines of "---" split it into chained steps
+
+The format is detected from the file unless --from is given. Prompt variables
+such as {question} or {{question}} become workflow params. Settings with no
+comanda equivalent are listed as warnings. Use "-" to read from STDIN.
+
+Examples:
+  comanda convert assistant.json -o assistant.yaml
+  comanda convert chain.json --model claude-sonnet-4-5
+  comanda convert prompt.txt --from text > prompt.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", args[0], err)
+		}
+
+		model := convertModel
+		if model == "" && envConfig != nil {
+			model = envConfig.DefaultGenerationModel
+		}
+		result, err := convert.Convert(data, convert.Options{
+			Format: convertFrom,
+			Model:  model,
+			Name:   convertStepName(args[0]),
+			Source: filepath.Base(args[0]),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Warnings go to stderr so the workflow can be redirected
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		if convertOutput == "" || convertOutput == "-" {
+			_, err := os.Stdout.Write(result.Workflow)
+			return err
+		}
+		if _, err := os.Stat(convertOutput); err == nil && !convertForce {
+			return fmt.Errorf("%s already exists; use --force to replace it", convertOutput)
+		}
+		if err := os.WriteFile(convertOutput, result.Workflow, 0644); err != nil {
+			return fmt.Errorf("error writing workflow: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Converted %s (%s) to %s\n", args[0], result.Format, convertOutput)
+		return nil
+	},
+}
+
+// convertStepName names the steps after the source file
+func convertStepName(path string) string {
+	if path == "-" {
+		return ""
+	}
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func init() {
+	convertCmd.Flags().StringVar(&convertFrom, "from", "", "Source format: "+strings.Join(convert.Formats, ", ")+" (detected when omitted)")
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "Workflow file to write (default STDOUT)")
+	convertCmd.Flags().StringVarP(&convertModel, "model", "m", "", "Model for prompts whose source names none (defaults to default_generation_model)")
+	convertCmd.Flags().BoolVar(&convertForce, "force", false, "Replace an existing output file")
+	rootCmd.AddCommand(convertCmd)
+}
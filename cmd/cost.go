@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+// Cost command flags
+var costLast string
+var costBy []string
+var costCSV bool
+
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Report token usage and estimated cost from the run history",
+	Long: `Total the estimated tokens and cost of recorded runs, grouped by workflow,
+step, model and provider. Costs are estimates from list prices; check your
+provider's invoice for billed amounts.
+
+Examples:
+  comanda cost                         # Last 30 days, all groupings
+  comanda cost --last 7d --by model
+  comanda cost --last 1m --by run --csv > usage.csv`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		window, err := parseAge(costLast)
+		if err != nil {
+			return err
+		}
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		runs, err := store.List()
+		if err != nil {
+			return err
+		}
+		if window > 0 {
+			runs = history.Since(runs, time.Now().Add(-window))
+		}
+
+		reports := make(map[string][]history.Usage, len(costBy))
+		for _, by := range costBy {
+			if reports[by], err = history.Aggregate(runs, by); err != nil {
+				return err
+			}
+		}
+
+		if costCSV {
+			return writeUsageCSV(os.Stdout, costBy, reports)
+		}
+		if len(runs) == 0 {
+			fmt.Println("No runs recorded in this period.")
+			return nil
+		}
+		printUsageReport(os.Stdout, runs, costBy, reports)
+		return nil
+	},
+}
+
+// parseAge parses a period such as 30d, 2w, 1m (30 days) or 12h. "all"
+// or "0" means no limit and returns 0.
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "all" || s == "0" {
+		return 0, nil
+	}
+	days := map[string]int{"d": 1, "w": 7, "m": 30, "y": 365}
+	if n := len(s); n > 1 {
+		if perUnit, ok := days[s[n-1:]]; ok {
+			count, err := strconv.Atoi(s[:n-1])
+			if err == nil && count > 0 {
+				return time.Duration(count*perUnit) * 24 * time.Hour, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid period '%s' (use e.g. 30d, 2w, 1m, 12h or all)", s)
+	}
+	return d, nil
+}
+
+// printUsageReport writes the period totals followed by one table per grouping
+func printUsageReport(out io.Writer, runs []history.Run, groupings []string, reports map[string][]history.Usage) {
+	var prompt, completion int
+	var cost float64
+	for _, run := range runs {
+		p, c := run.Tokens()
+		prompt += p
+		completion += c
+		cost += run.Cost()
+	}
+	fmt.Fprintf(out, "%d run(s), ~%d input / ~%d output tokens, estimated %s\n", len(runs), prompt, completion, formatCost(cost))
+
+	for _, by := range groupings {
+		fmt.Fprintf(out, "\nBy %s:\n", by)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\tRUNS\tSTEPS\tINPUT TOKENS\tOUTPUT TOKENS\tCOST\n", strings.ToUpper(by))
+		for _, u := range reports[by] {
+			fmt.Fprintf(w, "%s\t%d\t%d\t~%d\t~%d\t%s\n", u.Key, u.Runs, u.Steps, u.PromptTokens, u.CompletionTokens, formatCost(u.Cost))
+		}
+		w.Flush()
+	}
+}
+
+// writeUsageCSV writes every grouping as rows of a single CSV table
+func writeUsageCSV(out io.Writer, groupings []string, reports map[string][]history.Usage) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"group_by", "key", "runs", "steps", "input_tokens", "output_tokens", "cost_usd"})
+	for _, by := range groupings {
+		for _, u := range reports[by] {
+			w.Write([]string{by, u.Key, strconv.Itoa(u.Runs), strconv.Itoa(u.Steps),
+				strconv.Itoa(u.PromptTokens), strconv.Itoa(u.CompletionTokens), strconv.FormatFloat(u.Cost, 'f', 6, 64)})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing CSV: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	costCmd.Flags().StringVar(&costLast, "last", "30d", "Period to report, e.g. 7d, 2w, 1m, 12h, or all")
+	costCmd.Flags().StringSliceVar(&costBy, "by", []string{history.ByWorkflow, history.ByStep, history.ByModel, history.ByProvider},
+		"Groupings to report: run, workflow, step, model, provider, variant")
+	costCmd.Flags().BoolVar(&costCSV, "csv", false, "Write the report as CSV")
+	rootCmd.AddCommand(costCmd)
+}
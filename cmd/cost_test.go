@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"1m":  30 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+		"all": 0,
+	}
+	for in, want := range tests {
+		if got, err := parseAge(in); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "d", "-3d", "soon"} {
+		if _, err := parseAge(in); err == nil {
+			t.Errorf("parseAge(%q): expected an error", in)
+		}
+	}
+}
+
+func TestWriteUsageCSV(t *testing.T) {
+	reports := map[string][]history.Usage{
+		history.ByModel: {{Key: "gpt-4o", Runs: 2, Steps: 3, PromptTokens: 1200, CompletionTokens: 300, Cost: 0.006}},
+		history.ByStep:  {{Key: "review.yaml:summarize, final", Runs: 1, Steps: 1}},
+	}
+	var buf bytes.Buffer
+	if err := writeUsageCSV(&buf, []string{history.ByModel, history.ByStep}, reports); err != nil {
+		t.Fatal(err)
+	}
+	want := "group_by,key,runs,steps,input_tokens,output_tokens,cost_usd\n" +
+		"model,gpt-4o,2,3,1200,300,0.006000\n" +
+		"step,\"review.yaml:summarize, final\",1,1,0,0,0.000000\n"
+	if buf.String() != want {
+		t.Errorf("writeUsageCSV() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
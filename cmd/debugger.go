@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// terminalDebugger pauses before each prompt and asks the user what to do.
+// It writes to stderr so workflow output on stdout can still be piped.
+type terminalDebugger struct {
+	mu   sync.Mutex // Parallel steps take turns
+	tty  *os.File   // Terminal the editor runs on
+	in   *bufio.Reader
+	out  io.Writer
+	edit func(text string) (string, error)
+}
+
+// newTerminalDebugger reads answers from the terminal, even when a
+// workflow's input is piped to STDIN
+func newTerminalDebugger() (*terminalDebugger, error) {
+	tty := os.Stdin
+	if !term.IsTerminal(int(tty.Fd())) {
+		var err error
+		if tty, err = os.Open("/dev/tty"); err != nil {
+			return nil, fmt.Errorf("the debugger needs a terminal: %w", err)
+		}
+	}
+	d := &terminalDebugger{tty: tty, in: bufio.NewReader(tty), out: os.Stderr}
+	d.edit = d.editText
+	return d, nil
+}
+
+// BeforePrompt shows a prompt and returns the user's decision
+func (d *terminalDebugger) BeforePrompt(req processor.PromptRequest) processor.PromptDecision {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prompt := req.Prompt
+	d.showPrompt(req, prompt)
+	for {
+		fmt.Fprint(d.out, "[c]ontinue  [e]dit prompt  [r]espond with fake response  [s]kip step  [q]uit > ")
+		line, err := d.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(d.out)
+			return processor.PromptDecision{Action: processor.DebugAbort}
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "", "c", "continue":
+			return processor.PromptDecision{Action: processor.DebugSend, Prompt: prompt}
+		case "e", "edit":
+			edited, err := d.edit(prompt)
+			if err != nil {
+				fmt.Fprintf(d.out, "Error editing prompt: %v\n", err)
+				continue
+			}
+			prompt = edited
+			d.showPrompt(req, prompt)
+		case "r", "respond":
+			response, err := d.edit("")
+			if err != nil {
+				fmt.Fprintf(d.out, "Error reading response: %v\n", err)
+				continue
+			}
+			return processor.PromptDecision{Action: processor.DebugRespond, Response: response}
+		case "s", "skip":
+			return processor.PromptDecision{Action: processor.DebugSkip}
+		case "q", "quit":
+			return processor.PromptDecision{Action: processor.DebugAbort}
+		default:
+			fmt.Fprintf(d.out, "Unknown command %q\n", strings.TrimSpace(line))
+		}
+	}
+}
+
+// showPrompt prints the prompt a step is about to send
+func (d *terminalDebugger) showPrompt(req processor.PromptRequest, prompt string) {
+	fmt.Fprintf(d.out, "\n── Step '%s' → %s ──\n", req.Step, req.Model)
+	if req.File != "" {
+		fmt.Fprintf(d.out, "Attached file: %s\n", req.File)
+	}
+	fmt.Fprintln(d.out, prompt)
+	fmt.Fprintln(d.out, "──")
+}
+
+// editText opens $VISUAL or $EDITOR on text. Without an editor, it reads
+// lines from the terminal until a line containing only ".".
+func (d *terminalDebugger) editText(text string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		fmt.Fprintln(d.out, "Enter text, then a line with only \".\" to finish (set EDITOR to use an editor):")
+		return readUntilDot(d.in)
+	}
+
+	f, err := os.CreateTemp("", "comanda-debug-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = d.tty, d.out, d.out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s failed: %w", args[0], err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
+
+// readUntilDot reads lines up to a line containing only "." or the end of input
+func readUntilDot(in *bufio.Reader) (string, error) {
+	var lines []string
+	for {
+		line, err := in.ReadString('\n')
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "." {
+			break
+		}
+		if line != "" {
+			lines = append(lines, trimmed)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func newTestDebugger(input string) (*terminalDebugger, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	d := &terminalDebugger{in: bufio.NewReader(strings.NewReader(input)), out: out}
+	d.edit = func(text string) (string, error) {
+		if text == "" {
+			return readUntilDot(d.in)
+		}
+		return strings.ToUpper(text), nil
+	}
+	return d, out
+}
+
+func TestTerminalDebugger(t *testing.T) {
+	req := processor.PromptRequest{Step: "draft", Model: "gpt-4o", Prompt: "draft the notes", File: "notes.md"}
+	tests := []struct {
+		name  string
+		input string
+		want  processor.PromptDecision
+	}{
+		{"continue", "\n", processor.PromptDecision{Action: processor.DebugSend, Prompt: "draft the notes"}},
+		{"edit then continue", "e\nc\n", processor.PromptDecision{Action: processor.DebugSend, Prompt: "DRAFT THE NOTES"}},
+		{"respond", "bogus\nr\nline one\nline two\n.\n", processor.PromptDecision{Action: processor.DebugRespond, Response: "line one\nline two"}},
+		{"skip", "s\n", processor.PromptDecision{Action: processor.DebugSkip}},
+		{"quit", "q\n", processor.PromptDecision{Action: processor.DebugAbort}},
+		{"end of input", "", processor.PromptDecision{Action: processor.DebugAbort}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, out := newTestDebugger(tt.input)
+			if got := d.BeforePrompt(req); got != tt.want {
+				t.Errorf("BeforePrompt() = %+v, want %+v", got, tt.want)
+			}
+			if !strings.Contains(out.String(), "Step 'draft' → gpt-4o") || !strings.Contains(out.String(), "Attached file: notes.md") {
+				t.Errorf("output missing step header:\n%s", out.String())
+			}
+		})
+	}
+}
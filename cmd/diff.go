@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/textdiff"
+)
+
+// Diff flags
+var diffWords bool
+var diffStep string
+var diffContext int
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <run-id-1> <run-id-2>",
+	Short: "Compare the step outputs of two past runs",
+	Long: `Show how each step's output changed between two runs from the run history,
+as a unified diff per step, to review the effect of a prompt or model change
+across a whole workflow. --words marks changed words inline instead, which
+reads better for prose. Run IDs can be shortened to any unique prefix, or
+given as "last".
+
+Examples:
+  comanda diff 20260301-0700-ab12 last
+  comanda diff 20260301-0700-ab12 20260302-0700-cd34 --step summarize --words`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		from, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		to, err := store.Get(args[1])
+		if err != nil {
+			return err
+		}
+		return writeRunDiff(os.Stdout, from, to, diffStep, diffWords, diffContext)
+	},
+}
+
+// stepPair is a step as it appears in each of two runs; either side is nil
+// when only one run has the step
+type stepPair struct {
+	name     string
+	from, to *history.Step
+}
+
+// pairSteps matches the steps of two runs by name, in the order of the first
+// run followed by steps only the second run has. A step that ran several
+// times is matched occurrence by occurrence.
+func pairSteps(from, to *history.Run) []stepPair {
+	toSteps := make(map[string][]*history.Step)
+	for i := range to.Steps {
+		name := to.Steps[i].Name
+		toSteps[name] = append(toSteps[name], &to.Steps[i])
+	}
+
+	var pairs []stepPair
+	for i := range from.Steps {
+		pair := stepPair{name: from.Steps[i].Name, from: &from.Steps[i]}
+		if matches := toSteps[pair.name]; len(matches) > 0 {
+			pair.to = matches[0]
+			toSteps[pair.name] = matches[1:]
+		}
+		pairs = append(pairs, pair)
+	}
+	for i := range to.Steps {
+		step := &to.Steps[i]
+		for _, unmatched := range toSteps[step.Name] {
+			if unmatched == step {
+				pairs = append(pairs, stepPair{name: step.Name, to: step})
+			}
+		}
+	}
+	return pairs
+}
+
+// stepOutput reads a step's stored response; steps without one have none
+func stepOutput(step *history.Step) (string, error) {
+	if step == nil || step.OutputFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(step.OutputFile)
+	if err != nil {
+		return "", fmt.Errorf("error reading output of step '%s': %w", step.Name, err)
+	}
+	return string(data), nil
+}
+
+// writeRunDiff writes the per-step differences between two runs, limited to
+// one step when only is set
+func writeRunDiff(out io.Writer, from, to *history.Run, only string, words bool, context int) error {
+	fmt.Fprintf(out, "Comparing %s (%s) with %s (%s)\n", from.ID, from.Workflow, to.ID, to.Workflow)
+
+	var compared, changed int
+	var unchanged []string
+	for _, pair := range pairSteps(from, to) {
+		if only != "" && pair.name != only {
+			continue
+		}
+		compared++
+		if pair.from == nil || pair.to == nil {
+			changed++
+			runID := from.ID
+			if pair.from == nil {
+				runID = to.ID
+			}
+			fmt.Fprintf(out, "\n== %s: only in %s ==\n", pair.name, runID)
+			continue
+		}
+
+		a, err := stepOutput(pair.from)
+		if err != nil {
+			return err
+		}
+		b, err := stepOutput(pair.to)
+		if err != nil {
+			return err
+		}
+		if a == b && pair.from.Model == pair.to.Model && pair.from.Status == pair.to.Status {
+			unchanged = append(unchanged, pair.name)
+			continue
+		}
+		changed++
+
+		fmt.Fprintf(out, "\n== %s ==\n", pair.name)
+		if pair.from.Model != pair.to.Model {
+			fmt.Fprintf(out, "Model: %s → %s\n", pair.from.Model, pair.to.Model)
+		}
+		if pair.from.Status != pair.to.Status {
+			fmt.Fprintf(out, "Status: %s → %s\n", pair.from.Status, pair.to.Status)
+		}
+		switch {
+		case a == b:
+			fmt.Fprintln(out, "Output unchanged")
+		case words:
+			fmt.Fprintln(out, strings.TrimRight(textdiff.Words(a, b), "\n"))
+		default:
+			fmt.Fprint(out, textdiff.Unified(from.ID+"/"+pair.name, to.ID+"/"+pair.name, a, b, context))
+		}
+	}
+
+	if only != "" && compared == 0 {
+		return fmt.Errorf("neither run has a step '%s'", only)
+	}
+	if len(unchanged) > 0 {
+		fmt.Fprintf(out, "\nUnchanged: %s\n", strings.Join(unchanged, ", "))
+	}
+	fmt.Fprintf(out, "\n%d of %d step(s) changed\n", changed, compared)
+	return nil
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffWords, "words", false, "Show a word-level diff instead of a line diff")
+	diffCmd.Flags().StringVar(&diffStep, "step", "", "Only compare this step")
+	diffCmd.Flags().IntVarP(&diffContext, "context", "U", 3, "Lines of context around changes")
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+func TestWriteRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	step := func(name, model, output string) history.Step {
+		s := history.Step{Name: name, Model: model, Status: history.StatusSucceeded}
+		if output != "" {
+			s.OutputFile = filepath.Join(dir, strings.ReplaceAll(model+"-"+name, "/", "_")+".txt")
+			if err := os.WriteFile(s.OutputFile, []byte(output), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s
+	}
+	from := &history.Run{ID: "run-a", Workflow: "review.yaml", Steps: []history.Step{
+		step("extract", "gpt-4o", "alpha\nbeta\n"),
+		step("summarize", "gpt-4o", "The quick brown fox.\n"),
+		step("draft", "gpt-4o", "old draft\n"),
+	}}
+	to := &history.Run{ID: "run-b", Workflow: "review.yaml", Steps: []history.Step{
+		step("extract", "claude", "alpha\nbeta\n"),
+		step("summarize", "claude", "The slow brown fox.\n"),
+		step("publish", "claude", "done\n"),
+	}}
+	to.Steps[0].Model = "gpt-4o" // Same model and output: unchanged
+
+	var buf bytes.Buffer
+	if err := writeRunDiff(&buf, from, to, "", false, 3); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"== summarize ==\nModel: gpt-4o → claude\n--- run-a/summarize\n+++ run-b/summarize\n@@ -1 +1 @@\n-The quick brown fox.\n+The slow brown fox.\n",
+		"== draft: only in run-a ==",
+		"== publish: only in run-b ==",
+		"Unchanged: extract\n",
+		"3 of 4 step(s) changed",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("diff missing %q:\n%s", want, got)
+		}
+	}
+
+	buf.Reset()
+	if err := writeRunDiff(&buf, from, to, "summarize", true, 3); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "The [-quick-]{+slow+} brown fox.") || strings.Contains(buf.String(), "draft") {
+		t.Errorf("word diff =\n%s", buf.String())
+	}
+
+	if err := writeRunDiff(&buf, from, to, "missing", false, 3); err == nil {
+		t.Error("expected an error for an unknown step")
+	}
+}
+
+func TestPairStepsRepeated(t *testing.T) {
+	from := &history.Run{Steps: []history.Step{{Name: "loop"}, {Name: "loop"}}}
+	to := &history.Run{Steps: []history.Step{{Name: "loop"}, {Name: "loop"}, {Name: "loop"}}}
+	pairs := pairSteps(from, to)
+	if len(pairs) != 3 || pairs[1].to != &to.Steps[1] || pairs[2].from != nil || pairs[2].to != &to.Steps[2] {
+		t.Errorf("pairSteps() = %+v", pairs)
+	}
+}
@@ -0,0 +1,410 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+// Doctor check results
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// maxClockSkew is the clock difference to a provider that triggers a warning
+const maxClockSkew = 2 * time.Minute
+
+// doctorCheck is the result of one diagnostic
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+	Fix    string // What the user should do, for warnings and failures
+}
+
+// providerEndpoint describes a cheap authenticated request used to check an API key
+type providerEndpoint struct {
+	url  string
+	auth func(req *http.Request, apiKey string)
+}
+
+func bearerAuth(req *http.Request, apiKey string) {
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+}
+
+// providerEndpoints lists the model listing endpoint of each hosted provider
+var providerEndpoints = map[string]providerEndpoint{
+	"openai": {url: "https://api.openai.com/v1/models", auth: bearerAuth},
+	"anthropic": {url: "https://api.anthropic.com/v1/models", auth: func(req *http.Request, apiKey string) {
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+	}},
+	"google": {url: "https://generativelanguage.googleapis.com/v1beta/models", auth: func(req *http.Request, apiKey string) {
+		req.Header.Set("x-goog-api-key", apiKey)
+	}},
+	"xai":      {url: "https://api.x.ai/v1/models", auth: bearerAuth},
+	"deepseek": {url: "https://api.deepseek.com/v1/models", auth: bearerAuth},
+	"moonshot": {url: "https://api.moonshot.ai/v1/models", auth: bearerAuth},
+}
+
+// doctorLoadErr records why the env config could not be loaded, so doctor
+// can report it instead of exiting
+var doctorLoadErr error
+
+// doctorSecretsErr records why a secret the env config references could
+// not be resolved
+var doctorSecretsErr error
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose configuration, API key and connectivity problems",
+	Long: `Check that the env config can be read, that each provider's API key is
+accepted, that Ollama is reachable, that the runtime directory is writable, and
+that the system clock and TLS certificates work with provider APIs. Each problem
+is printed with a suggested fix. Exits non-zero if any check fails.`,
+	Args: cobra.NoArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setLogLevel(); err != nil {
+			return err
+		}
+		envConfig, doctorLoadErr = config.LoadEnvConfigWithPassword(config.GetEnvPath())
+		if envConfig != nil {
+			if err := envConfig.ApplyEnvVars(os.Environ()); err != nil {
+				return err
+			}
+			doctorSecretsErr = resolveConfigSecrets(envConfig)
+			if err := applyConfigOverrides(envConfig); err != nil {
+				return err
+			}
+			envConfig.AddSecrets()
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		checks := runDoctorChecks(config.GetEnvPath(), envConfig, doctorLoadErr, runtimeDir)
+		failed := printDoctorChecks(os.Stdout, checks)
+		if failed > 0 {
+			return fmt.Errorf("%d check(s) failed", failed)
+		}
+		return nil
+	},
+}
+
+// runDoctorChecks runs every diagnostic and returns the results in display order
+func runDoctorChecks(envPath string, cfg *config.EnvConfig, loadErr error, dir string) []doctorCheck {
+	checks := []doctorCheck{checkEnvConfig(envPath, cfg, loadErr)}
+	if doctorSecretsErr != nil {
+		checks = append(checks, checkSecretRefs(doctorSecretsErr))
+	}
+	if cfg == nil {
+		cfg = &config.EnvConfig{}
+	}
+
+	providerChecks, serverDate := checkProviderKeys(cfg)
+	checks = append(checks, providerChecks...)
+	checks = append(checks, checkOllama(cfg))
+	checks = append(checks, checkRuntimeDir(cfg, dir))
+	checks = append(checks, checkHistory(cfg))
+	checks = append(checks, checkClock(serverDate, time.Now()))
+	checks = append(checks, checkCertFile())
+	return checks
+}
+
+// checkEnvConfig reports whether the env config exists and could be loaded
+func checkEnvConfig(envPath string, cfg *config.EnvConfig, loadErr error) doctorCheck {
+	check := doctorCheck{Name: "Env config"}
+	if loadErr != nil {
+		check.Status = checkFail
+		check.Detail = fmt.Sprintf("%s: %v", envPath, loadErr)
+		check.Fix = "Fix the YAML syntax or file permissions, or set COMANDA_ENV to a working config file"
+		if errors.Is(loadErr, config.ErrNoPassphrase) {
+			check.Fix = "Set COMANDA_PASSPHRASE_FILE to a file holding the passphrase, or run 'comanda configure agent'"
+		}
+		return check
+	}
+	if _, err := os.Stat(envPath); os.IsNotExist(err) {
+		check.Status = checkWarn
+		check.Detail = envPath + " does not exist"
+		check.Fix = "Run 'comanda configure' to add a provider"
+		return check
+	}
+	check.Status = checkOK
+	check.Detail = fmt.Sprintf("%s (%d provider(s))", envPath, len(cfg.Providers))
+	return check
+}
+
+// checkSecretRefs reports a secret the env config references that could not
+// be resolved
+func checkSecretRefs(err error) doctorCheck {
+	return doctorCheck{
+		Name:   "Secret references",
+		Status: checkFail,
+		Detail: err.Error(),
+		Fix:    "Check the reference and the secret manager's credentials (VAULT_TOKEN, AWS_ACCESS_KEY_ID, GOOGLE_APPLICATION_CREDENTIALS or AZURE_CLIENT_SECRET)",
+	}
+}
+
+// checkProviderKeys validates each configured API key with a model listing
+// request. It also returns the Date header of the first response, used to
+// check the local clock.
+func checkProviderKeys(cfg *config.EnvConfig) ([]doctorCheck, time.Time) {
+	var names []string
+	for name, provider := range cfg.Providers {
+		if name != "ollama" && provider != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	checks := make([]doctorCheck, len(names))
+	dates := make([]time.Time, len(names))
+	client := &http.Client{Timeout: 10 * time.Second}
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			checks[i], dates[i] = checkProviderKey(client, name, cfg.Providers[name].APIKey)
+		}(i, name)
+	}
+	wg.Wait()
+
+	var serverDate time.Time
+	for _, date := range dates {
+		if !date.IsZero() {
+			serverDate = date
+			break
+		}
+	}
+	return checks, serverDate
+}
+
+// checkProviderKey checks a single provider's API key
+func checkProviderKey(client *http.Client, name, apiKey string) (doctorCheck, time.Time) {
+	check := doctorCheck{Name: name + " API key"}
+	if apiKey == "" {
+		check.Status = checkFail
+		check.Detail = "no API key configured"
+		check.Fix = fmt.Sprintf("Run 'comanda configure --update-key=%s'", name)
+		return check, time.Time{}
+	}
+	endpoint, ok := providerEndpoints[name]
+	if !ok {
+		check.Status = checkSkip
+		check.Detail = "no check available for this provider"
+		return check, time.Time{}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint.url, nil)
+	if err != nil {
+		check.Status = checkFail
+		check.Detail = err.Error()
+		return check, time.Time{}
+	}
+	endpoint.auth(req, apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		check.Status = checkFail
+		check.Detail = err.Error()
+		var certErr x509.UnknownAuthorityError
+		var hostErr x509.HostnameError
+		var invalidErr x509.CertificateInvalidError
+		switch {
+		case errors.As(err, &certErr):
+			check.Fix = "TLS certificate not trusted. If you are behind a proxy that inspects traffic, set SSL_CERT_FILE to its CA bundle"
+		case errors.As(err, &invalidErr):
+			check.Fix = "TLS certificate rejected. Check that the system clock is correct and the CA bundle is up to date"
+		case errors.As(err, &hostErr):
+			check.Fix = "TLS certificate does not match the host. Check HTTPS_PROXY and any DNS overrides"
+		default:
+			check.Fix = "Check your network connection, and HTTPS_PROXY if you use a proxy"
+		}
+		return check, time.Time{}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	date, _ := http.ParseTime(resp.Header.Get("Date"))
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		check.Status = checkOK
+		check.Detail = "accepted"
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		check.Status = checkFail
+		check.Detail = fmt.Sprintf("rejected (HTTP %d)", resp.StatusCode)
+		check.Fix = fmt.Sprintf("The key is invalid or revoked. Run 'comanda configure --update-key=%s' with a new key", name)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		check.Status = checkWarn
+		check.Detail = "rate limited (HTTP 429)"
+		check.Fix = "The key works but is rate limited or out of credit; check your plan and billing"
+	default:
+		check.Status = checkWarn
+		check.Detail = fmt.Sprintf("unexpected response (HTTP %d)", resp.StatusCode)
+		check.Fix = "The provider may be having an outage; try again later"
+	}
+	return check, date
+}
+
+// checkOllama reports whether the local Ollama server is reachable
+func checkOllama(cfg *config.EnvConfig) doctorCheck {
+	check := doctorCheck{Name: "Ollama"}
+	_, configured := cfg.Providers["ollama"]
+	ollamaModels, err := getOllamaModels()
+	switch {
+	case err == nil:
+		check.Status = checkOK
+		check.Detail = fmt.Sprintf("reachable, %d model(s) pulled", len(ollamaModels))
+	case configured:
+		check.Status = checkFail
+		check.Detail = err.Error()
+		check.Fix = "Start Ollama with 'ollama serve', or set OLLAMA_HOST if it runs elsewhere"
+	default:
+		check.Status = checkSkip
+		check.Detail = "not running (only needed for local models)"
+	}
+	return check
+}
+
+// checkRuntimeDir checks that workflow outputs can be written. The CLI writes
+// relative to the working directory; the server writes under its data directory.
+func checkRuntimeDir(cfg *config.EnvConfig, dir string) doctorCheck {
+	check := doctorCheck{Name: "Runtime directory"}
+	target, err := os.Getwd()
+	if err != nil {
+		target = "."
+	}
+	if cfg.Server != nil && cfg.Server.DataDir != "" {
+		target = cfg.Server.DataDir
+	}
+	if dir != "" {
+		target = filepath.Join(target, dir)
+	}
+
+	f, err := os.CreateTemp(target, ".comanda-doctor-*")
+	if err != nil {
+		check.Status = checkFail
+		check.Detail = err.Error()
+		check.Fix = fmt.Sprintf("Create %s or fix its permissions, or run comanda from a writable directory", target)
+		return check
+	}
+	f.Close()
+	os.Remove(f.Name())
+	check.Status = checkOK
+	check.Detail = target + " is writable"
+	return check
+}
+
+// checkHistory reports where run history is kept. Builds without cgo can't
+// use SQLite and fall back to runs.jsonl, which is slower to search.
+func checkHistory(cfg *config.EnvConfig) doctorCheck {
+	check := doctorCheck{Name: "Run history"}
+	store, err := history.OpenConfigured(historyDir(cfg), cfg)
+	if err != nil {
+		check.Status = checkFail
+		check.Detail = err.Error()
+		check.Fix = "Check the history directory's permissions and the history database settings in the env config"
+		return check
+	}
+	defer store.Close()
+	switch store.Backend() {
+	case "files":
+		check.Status = checkWarn
+		check.Detail = filepath.Join(store.Dir(), "runs.jsonl") + " (this build can't use SQLite)"
+		check.Fix = "Install a release binary, or build with CGO_ENABLED=1 and a C compiler"
+	case "postgres":
+		check.Status = checkOK
+		check.Detail = "PostgreSQL database " + cfg.HistorySettings().Database
+	default:
+		check.Status = checkOK
+		check.Detail = filepath.Join(store.Dir(), "history.db")
+	}
+	return check
+}
+
+// checkClock compares the local clock with a provider's Date header. Large
+// skew breaks TLS validation and request signing.
+func checkClock(serverDate, now time.Time) doctorCheck {
+	check := doctorCheck{Name: "System clock"}
+	if serverDate.IsZero() {
+		check.Status = checkSkip
+		check.Detail = "no provider response to compare against"
+		return check
+	}
+	skew := now.Sub(serverDate)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		check.Status = checkWarn
+		check.Detail = fmt.Sprintf("local clock differs from provider time by %s", skew.Round(time.Second))
+		check.Fix = "Enable network time sync (NTP) on this machine"
+		return check
+	}
+	check.Status = checkOK
+	check.Detail = "in sync with provider time"
+	return check
+}
+
+// checkCertFile checks that a custom CA bundle, if set, can be read
+func checkCertFile() doctorCheck {
+	check := doctorCheck{Name: "TLS certificates"}
+	path := os.Getenv("SSL_CERT_FILE")
+	if path == "" {
+		check.Status = checkOK
+		check.Detail = "using the system CA bundle"
+		return check
+	}
+	if _, err := os.ReadFile(path); err != nil {
+		check.Status = checkFail
+		check.Detail = fmt.Sprintf("SSL_CERT_FILE is set but unreadable: %v", err)
+		check.Fix = "Point SSL_CERT_FILE at a readable PEM bundle or unset it"
+		return check
+	}
+	check.Status = checkOK
+	check.Detail = "using SSL_CERT_FILE " + path
+	return check
+}
+
+// printDoctorChecks writes the results and returns the number of failures
+func printDoctorChecks(out io.Writer, checks []doctorCheck) int {
+	failed := 0
+	for _, c := range checks {
+		var icon string
+		switch c.Status {
+		case checkOK:
+			icon = "✓"
+		case checkWarn:
+			icon = "!"
+		case checkFail:
+			icon = "✗"
+			failed++
+		default:
+			icon = "-"
+		}
+		fmt.Fprintf(out, "%s %-20s %s\n", icon, c.Name, c.Detail)
+		if c.Fix != "" {
+			fmt.Fprintf(out, "  Fix: %s\n", c.Fix)
+		}
+	}
+	return failed
+}
+
+func init() {
+	doctorCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory to check for write access")
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestDoctorChecks(t *testing.T) {
+	accepted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer accepted.Close()
+
+	saved := providerEndpoints
+	defer func() { providerEndpoints = saved }()
+	providerEndpoints = map[string]providerEndpoint{
+		"openai":   {url: accepted.URL, auth: bearerAuth},
+		"deepseek": {url: accepted.URL, auth: bearerAuth},
+	}
+	t.Setenv("OLLAMA_HOST", "http://127.0.0.1:1")
+	t.Setenv("SSL_CERT_FILE", "")
+	t.Setenv("COMANDA_HISTORY_DIR", t.TempDir())
+
+	envPath := filepath.Join(t.TempDir(), "env.yaml")
+	os.WriteFile(envPath, []byte("providers: {}\n"), 0644)
+	cfg := &config.EnvConfig{Providers: map[string]*config.Provider{
+		"openai":    {APIKey: "good-key"},
+		"deepseek":  {APIKey: "revoked-key"},
+		"anthropic": {},
+		"ollama":    {APIKey: "LOCAL"},
+	}}
+
+	status := make(map[string]doctorCheck)
+	for _, c := range runDoctorChecks(envPath, cfg, nil, "") {
+		status[c.Name] = c
+	}
+	for name, want := range map[string]string{
+		"Env config":        checkOK,
+		"openai API key":    checkOK,
+		"deepseek API key":  checkFail,
+		"anthropic API key": checkFail,
+		"Ollama":            checkFail,
+		"Runtime directory": checkOK,
+		"Run history":       checkOK,
+		"System clock":      checkOK,
+		"TLS certificates":  checkOK,
+	} {
+		if status[name].Status != want {
+			t.Errorf("%s = %+v, want %s", name, status[name], want)
+		}
+	}
+	if !strings.Contains(status["deepseek API key"].Fix, "--update-key=deepseek") {
+		t.Errorf("deepseek fix = %q", status["deepseek API key"].Fix)
+	}
+
+	var out bytes.Buffer
+	if failed := printDoctorChecks(&out, runDoctorChecks(envPath, nil, errors.New("yaml: bad indentation"), "missing-dir")); failed != 2 {
+		t.Errorf("failed = %d, want 2 (env config and runtime dir):\n%s", failed, out.String())
+	}
+	if !strings.Contains(out.String(), "Fix: Fix the YAML syntax") {
+		t.Errorf("output missing fix:\n%s", out.String())
+	}
+
+	now := time.Now()
+	if c := checkClock(now.Add(-5*time.Minute), now); c.Status != checkWarn || !strings.Contains(c.Detail, "5m0s") {
+		t.Errorf("checkClock() = %+v", c)
+	}
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/evaluate"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Eval command flags
+var evalJudge string
+var evalRubric string
+var evalThreshold float64
+var evalStep string
+var evalOutput string
+var evalFailUnder float64
+var evalVariants map[string]string
+
+var evalCmd = &cobra.Command{
+	Use:   "eval <dataset.jsonl> <workflow.yaml>",
+	Short: "Score a workflow's outputs over a dataset with a judge model",
+	Long: `Run a workflow once per dataset item and have a judge model score each output
+from 1 to 5 against a rubric. Prints the pass rate, mean score, average
+latency and cost, followed by the items that failed, so the effect of a
+prompt or model change can be measured.
+
+The dataset is a JSONL file with one item per line:
+  {"id": "refund", "input": "...", "params": {"tone": "formal"}, "expected": "..."}
+input is piped to the workflow as STDIN, params are bound to its parameters
+and expected, if given, is shown to the judge as a reference answer. Only
+input or params is needed.
+
+The judged output is the workflow's last output, or that of --step.
+
+Steps with prompt variants split the dataset between them by item ID, and
+the report compares the variants. --variant runs every item with one
+variant instead. Each item's run and score is recorded in the run history,
+where 'comanda variants' compares variants across evaluations.
+
+Examples:
+  comanda eval support.jsonl reply.yaml --judge gpt-4o --rubric rubric.md
+  comanda eval support.jsonl reply.yaml --judge gpt-4o --output results.jsonl --fail-under 90
+  comanda eval support.jsonl reply.yaml --judge gpt-4o --variant reply=concise`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if evalJudge == "" {
+			return errors.New("--judge is required")
+		}
+		if evalThreshold < evaluate.MinScore || evalThreshold > evaluate.MaxScore {
+			return fmt.Errorf("--threshold must be between %d and %d", evaluate.MinScore, evaluate.MaxScore)
+		}
+		items, err := evaluate.LoadDataset(args[0])
+		if err != nil {
+			return err
+		}
+		var rubric string
+		if evalRubric != "" {
+			data, err := os.ReadFile(evalRubric)
+			if err != nil {
+				return fmt.Errorf("error reading rubric: %w", err)
+			}
+			rubric = string(data)
+		}
+
+		policy := envConfig.PolicySettings()
+		if err := policy.CheckModel(evalJudge); err != nil {
+			return fmt.Errorf("%w: %v", processor.ErrPolicy, err)
+		}
+		judge, err := providerForModel(evalJudge)
+		if err != nil {
+			return err
+		}
+		if err := policy.CheckProvider(judge.Name()); err != nil {
+			return fmt.Errorf("%w: %v", processor.ErrPolicy, err)
+		}
+
+		opts := evaluate.Options{
+			Judge: judge, JudgeModel: evalJudge, Rubric: rubric, Threshold: evalThreshold, Step: evalStep,
+			EnvConfig: envConfig, RuntimeDir: runtimeDir, Verbose: verbose,
+			Variants: evalVariants, Dataset: args[0],
+			Progress: func(n, total int, item evaluate.Item) {
+				fmt.Fprintf(os.Stderr, "Evaluating item %s (%d/%d)\n", item.ID, n, total)
+			},
+		}
+		if abs, err := filepath.Abs(args[0]); err == nil {
+			opts.Dataset = abs
+		}
+		if !noHistory {
+			store, err := openHistory()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: run history disabled: %v\n", err)
+			} else {
+				defer store.Close()
+				opts.Store = store
+			}
+		}
+		var results []evaluate.ItemResult
+		discardStdout(!verbose, func() {
+			results, err = evaluate.Run(args[1], items, opts)
+		})
+		if err != nil {
+			return err
+		}
+		if evalOutput != "" {
+			if err := writeEvalResults(evalOutput, results); err != nil {
+				return err
+			}
+		}
+
+		summary := evaluate.Summarize(results)
+		fmt.Fprintln(os.Stderr)
+		printEvalReport(os.Stdout, summary, results)
+		if evalFailUnder > 0 && 100*summary.PassRate < evalFailUnder {
+			return fmt.Errorf("pass rate %.0f%% is below %.0f%%", 100*summary.PassRate, evalFailUnder)
+		}
+		return nil
+	},
+}
+
+// writeEvalResults writes one JSON line per item result
+func writeEvalResults(path string, results []evaluate.ItemResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating results file: %w", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("error writing results: %w", err)
+		}
+	}
+	return nil
+}
+
+// printEvalReport writes the aggregate metrics followed by the items that
+// failed or errored
+func printEvalReport(out io.Writer, summary evaluate.Summary, results []evaluate.ItemResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Items\t%d\n", summary.Items)
+	fmt.Fprintf(w, "Passed\t%d (%.0f%%)\n", summary.Passed, 100*summary.PassRate)
+	meanScore := "-"
+	if summary.Scored > 0 {
+		meanScore = fmt.Sprintf("%.2f", summary.MeanScore)
+	}
+	fmt.Fprintf(w, "Mean score\t%s\n", meanScore)
+	fmt.Fprintf(w, "Errors\t%d\n", summary.Errors)
+	fmt.Fprintf(w, "Avg latency\t%s\n", summary.Latency.Round(100*time.Millisecond))
+	fmt.Fprintf(w, "Cost\t%s (judge %s)\n", formatCost(summary.Cost), formatCost(summary.JudgeCost))
+	w.Flush()
+
+	if variants := evaluate.SummarizeVariants(results); len(variants) > 0 {
+		fmt.Fprintln(out, "\nVariants:")
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  STEP\tVARIANT\tITEMS\tPASSED\tMEAN SCORE\tAVG COST")
+		for _, v := range variants {
+			meanScore := "-"
+			if v.Scored > 0 {
+				meanScore = fmt.Sprintf("%.2f", v.MeanScore)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%d (%.0f%%)\t%s\t%s\n", v.Step, v.Variant, v.Items, v.Passed, 100*v.PassRate, meanScore, formatCost(v.Cost/float64(v.Items)))
+		}
+		w.Flush()
+	}
+
+	if summary.Passed == summary.Items {
+		return
+	}
+	fmt.Fprintln(out, "\nFailures:")
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(w, "  %s\terror\t%s\n", r.ID, firstLine(r.Error))
+		case !r.Passed:
+			fmt.Fprintf(w, "  %s\tscore %g\t%s\n", r.ID, r.Score, firstLine(r.Reason))
+		}
+	}
+	w.Flush()
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+func init() {
+	evalCmd.Flags().StringVar(&evalJudge, "judge", "", "Model that scores the outputs")
+	evalCmd.RegisterFlagCompletionFunc("judge", completeModelFlag)
+	evalCmd.Flags().StringVar(&evalRubric, "rubric", "", "File with the rubric the judge scores against")
+	evalCmd.Flags().Float64Var(&evalThreshold, "threshold", evaluate.DefaultThreshold, "Lowest score that passes")
+	evalCmd.Flags().StringVar(&evalStep, "step", "", "Judge this step's output instead of the last output")
+	evalCmd.Flags().StringVar(&evalOutput, "output", "", "Write per-item results to this JSONL file")
+	evalCmd.Flags().Float64Var(&evalFailUnder, "fail-under", 0, "Exit with an error when the pass rate is below this percentage")
+	evalCmd.Flags().StringToStringVar(&evalVariants, "variant", nil, "Run every item with this prompt variant of a step, as step=variant (repeatable)")
+	evalCmd.Flags().BoolVar(&noHistory, "no-history", false, "Do not record the runs in the run history")
+	evalCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory that input paths are relative to")
+	evalCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		switch len(args) {
+		case 0:
+			return nil, cobra.ShellCompDirectiveDefault // The dataset
+		case 1:
+			return completeWorkflowFiles(cmd, args, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	rootCmd.AddCommand(evalCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/evaluate"
+)
+
+func TestPrintEvalReport(t *testing.T) {
+	results := []evaluate.ItemResult{
+		{ID: "refund", Score: 5, Passed: true, LatencyMS: 1000, Cost: 0.002},
+		{ID: "tone", Score: 2.5, Reason: "Too casual.\nIt uses slang.", LatencyMS: 3000, Cost: 0.002, JudgeCost: 0.001},
+		{ID: "empty", Error: "step 'reply' did not run"},
+	}
+	var out bytes.Buffer
+	printEvalReport(&out, evaluate.Summarize(results), results)
+	for _, want := range []string{"Passed       1 (33%)", "Mean score   3.75", "Errors       1", "Avg latency  1.3s", "Cost         $0.0040 (judge $0.0010)", "tone   score 2.5  Too casual.\n", "empty  error      step 'reply' did not run"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	printEvalReport(&out, evaluate.Summarize(results[:1]), results[:1])
+	if strings.Contains(out.String(), "Failures") || strings.Contains(out.String(), "Variants") {
+		t.Errorf("report lists failures or variants it shouldn't:\n%s", out.String())
+	}
+
+	results[0].Variants = map[string]string{"reply": "short"}
+	results[1].Variants = map[string]string{"reply": "long"}
+	out.Reset()
+	printEvalReport(&out, evaluate.Summarize(results), results)
+	for _, want := range []string{"STEP   VARIANT  ITEMS  PASSED    MEAN SCORE  AVG COST", "reply  long     1      0 (0%)    2.50        $0.0020", "reply  short    1      1 (100%)  5.00"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Explain command flags
+var explainOutputTokens int
+var explainJSON bool
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <file> [-- name=value...]",
+	Short: "Estimate a workflow's prompt sizes and cost without running it",
+	Long: `Estimate the prompt size of every model call in a workflow, its cost from the
+model's list price, and whether it fits the model's context window. Nothing
+is sent to any provider.
+
+Prompt sizes are counted with a tokenizer estimate for each model family,
+from the step's action and input files. Responses are assumed to be
+--output-tokens long (or max_output_tokens when a step sets it), and that
+size is carried into the steps that read them.
+
+Examples:
+  comanda explain review.yaml
+  cat diff.txt | comanda explain review.yaml --output-tokens 4000
+  comanda explain review.yaml --json
+  comanda explain review.yaml -- repo=comanda pr=123`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files, params, err := splitParamArgs(cmd, args)
+		if err != nil {
+			return err
+		}
+		if len(files) != 1 {
+			return fmt.Errorf("explain takes one workflow file, got %d", len(files))
+		}
+		dslConfig, err := readWorkflowWithParams(files[0], params)
+		if err != nil {
+			return err
+		}
+		stdinData, err := readPipedStdin()
+		if err != nil {
+			return fmt.Errorf("error reading from STDIN: %w", err)
+		}
+		defer stdinData.remove()
+
+		proc := processor.NewProcessor(dslConfig, envConfig, &config.ServerConfig{Enabled: false}, verbose, runtimeDir)
+		opts := processor.ExplainOptions{OutputTokens: explainOutputTokens, Stdin: stdinData.data}
+		if stdinData.path != "" {
+			// Too large to tokenize; estimate from its size
+			if info, err := os.Stat(stdinData.path); err == nil {
+				opts.StdinTokens = int(info.Size() / 4)
+			}
+		}
+		estimates := proc.Explain(opts)
+		if explainJSON {
+			return printJSON(os.Stdout, estimates)
+		}
+		if len(estimates) == 0 {
+			fmt.Println("The workflow makes no model calls.")
+			return nil
+		}
+		printExplanation(os.Stdout, estimates)
+		return nil
+	},
+}
+
+// printExplanation writes the per-step table, the total and the notes
+func printExplanation(out io.Writer, estimates []processor.StepEstimate) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tMODEL\tCALLS\tPROMPT\tOUTPUT\tCOST\tCONTEXT")
+	var total float64
+	unpriced := 0
+	for _, e := range estimates {
+		name := e.Step
+		if e.Group != "" {
+			name = e.Group + "/" + e.Step
+		}
+		cost := formatCost(e.Cost)
+		if !e.Priced {
+			cost = "?"
+			if e.Model != "-" {
+				unpriced++
+			}
+		}
+		total += e.Cost
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", name, e.Model, e.Requests,
+			formatTokens(e.PromptTokens), formatTokens(e.OutputTokens), cost, contextSummary(e))
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\nEstimated total: %s", formatCost(total))
+	if unpriced > 0 {
+		fmt.Fprintf(out, " (plus %d call(s) with no known price)", unpriced)
+	}
+	fmt.Fprintln(out)
+
+	var notes []string
+	for _, e := range estimates {
+		if e.Context == processor.ContextExceeds || e.Context == processor.ContextNear {
+			notes = append(notes, fmt.Sprintf("⚠ %s with %s: %s of %s context window tokens used", e.Step, e.Model,
+				formatTokens(e.LargestPrompt+e.OutputTokens/max(e.Requests, 1)), formatTokens(e.ContextWindow)))
+		}
+	}
+	seen := make(map[string]bool)
+	for _, e := range estimates {
+		for _, note := range e.Notes {
+			if key := e.Step + note; !seen[key] {
+				seen[key] = true
+				notes = append(notes, fmt.Sprintf("- %s: %s", e.Step, note))
+			}
+		}
+	}
+	if len(notes) > 0 {
+		fmt.Fprintln(out)
+		for _, note := range notes {
+			fmt.Fprintln(out, note)
+		}
+	}
+}
+
+// contextSummary describes a step's context window use for the table
+func contextSummary(e processor.StepEstimate) string {
+	if e.Context == processor.ContextUnknown || e.ContextWindow == 0 {
+		return "-"
+	}
+	used := e.LargestPrompt + e.OutputTokens/max(e.Requests, 1)
+	percent := fmt.Sprintf("%d%%", used*100/e.ContextWindow)
+	if e.Context != processor.ContextOK {
+		return percent + " " + e.Context
+	}
+	return percent
+}
+
+func init() {
+	explainCmd.Flags().IntVar(&explainOutputTokens, "output-tokens", processor.DefaultExplainOutputTokens, "Response size assumed for steps without max_output_tokens")
+	explainCmd.Flags().BoolVar(&explainJSON, "json", false, "Print the estimates as JSON")
+	explainCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory that relative input paths are read from")
+	explainCmd.ValidArgsFunction = completeWorkflowArgs(1)
+	rootCmd.AddCommand(explainCmd)
+}
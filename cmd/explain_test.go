@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestPrintExplanation(t *testing.T) {
+	estimates := []processor.StepEstimate{
+		{Step: "summarize", Model: "gpt-4o", Requests: 1, PromptTokens: 4200, LargestPrompt: 4200, OutputTokens: 1000, Cost: 0.0205, Priced: true, ContextWindow: 128000, Context: processor.ContextOK},
+		{Step: "review", Group: "checks", Model: "moonshot-v1-8k", Requests: 1, PromptTokens: 7000, LargestPrompt: 7000, OutputTokens: 1000, ContextWindow: 8192, Context: processor.ContextNear, Notes: []string{"https://example.com: URL content not fetched"}},
+	}
+	var out bytes.Buffer
+	printExplanation(&out, estimates)
+	got := out.String()
+
+	for _, want := range []string{
+		"checks/review",
+		"4.2k",
+		"$0.0205",
+		"97% near limit",
+		"Estimated total: $0.0205 (plus 1 call(s) with no known price)",
+		"⚠ review with moonshot-v1-8k: 8.0k of 8.2k context window tokens used",
+		"- review: https://example.com: URL content not fetched",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
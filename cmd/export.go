@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/bundle"
+)
+
+// Export and import flags
+var exportOutput string
+var importDir string
+var importForce bool
+
+var exportCmd = &cobra.Command{
+	Use:   "export <workflow.yaml>",
+	Short: "Package a workflow and the files it reads into a bundle",
+	Long: `Write a portable .tgz bundle with the workflow, its markdown prompts, generate
+context files, sub-workflows run by process steps and its static input files,
+so it can be shared or moved to another machine and unpacked with
+'comanda import'. Paths are kept relative to the current directory, the one
+the workflow is run from; files outside it, files the workflow's own steps
+write, and env files are left out and listed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manifest, err := bundle.Collect(args[0], dir)
+		if err != nil {
+			return err
+		}
+
+		output := exportOutput
+		if output == "" {
+			base := filepath.Base(args[0])
+			output = strings.TrimSuffix(base, filepath.Ext(base)) + ".tgz"
+		}
+		var w io.Writer = os.Stdout
+		if output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("error creating bundle: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := bundle.Write(w, manifest, dir); err != nil {
+			if output != "-" {
+				os.Remove(output)
+			}
+			return err
+		}
+
+		// Keep stdout clean when the bundle is written to it
+		printBundleSummary(os.Stderr, manifest)
+		if output != "-" {
+			fmt.Fprintf(os.Stderr, "Wrote %s\n", output)
+		}
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <bundle.tgz>",
+	Short: "Unpack a workflow bundle created by 'comanda export'",
+	Long: `Unpack a bundle into the current directory, or the one given with --dir,
+after checking every file against the bundle's checksums. Existing files with
+different contents are only replaced with --force. Use "-" to read the bundle
+from STDIN.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("error opening bundle: %w", err)
+			}
+			defer f.Close()
+			r = f
+		}
+		manifest, err := bundle.Extract(r, importDir, importForce)
+		if err != nil {
+			return err
+		}
+
+		printBundleSummary(os.Stdout, manifest)
+		// Workflow paths are relative to the import directory
+		run := "comanda process " + manifest.Workflow
+		if importDir != "." {
+			run = fmt.Sprintf("cd %s && %s", importDir, run)
+		}
+		fmt.Printf("\nRun it with:\n\n   %s\n", run)
+		return nil
+	},
+}
+
+// printBundleSummary lists a bundle's files and the files left out of it
+func printBundleSummary(out io.Writer, m *bundle.Manifest) {
+	fmt.Fprintf(out, "Bundle of %s (%d file(s)):\n", m.Workflow, len(m.Files))
+	for _, file := range m.Files {
+		fmt.Fprintf(out, "  %-9s %s\n", file.Kind, file.Path)
+	}
+	if len(m.Skipped) > 0 {
+		fmt.Fprintln(out, "Not included:")
+		for _, s := range m.Skipped {
+			fmt.Fprintf(out, "  %-9s %s (%s)\n", s.Kind, s.Path, s.Reason)
+		}
+	}
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Bundle file to write, or - for STDOUT (default: <workflow>.tgz)")
+	exportCmd.ValidArgsFunction = completeWorkflowArgs(1)
+	importCmd.Flags().StringVar(&importDir, "dir", ".", "Directory to unpack the bundle into")
+	importCmd.Flags().BoolVar(&importForce, "force", false, "Replace existing files with different contents")
+	rootCmd.AddCommand(exportCmd, importCmd)
+}
@@ -0,0 +1,382 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/finetune"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Fine-tune command flags
+var finetuneStep string
+var finetuneMinScore float64
+var finetuneLast string
+var finetuneSystem string
+var finetuneOutput string
+var finetuneModel string
+var finetuneSuffix string
+var finetuneEpochs int
+var finetuneValidation string
+var finetuneAlias string
+var finetuneWait bool
+var finetuneInterval time.Duration
+
+var finetuneCmd = &cobra.Command{
+	Use:   "finetune",
+	Short: "Fine-tune models on the outputs of recorded runs",
+	Long: `Turn the prompts and responses of recorded runs into training data, fine-tune
+an OpenAI or Google model on it, and register the tuned model so workflows
+can use it, under an alias if one is given:
+
+  comanda finetune prepare reply.yaml --step reply --min-score 4 -o train.jsonl
+  comanda finetune submit train.jsonl --model gpt-4o-mini-2024-07-18 --alias support-bot
+  comanda finetune status last --wait
+
+Jobs are kept in finetune-jobs.json in the data directory.`,
+}
+
+var finetunePrepareCmd = &cobra.Command{
+	Use:   "prepare [workflow]",
+	Short: "Write the prompts and responses of recorded runs as JSONL training data",
+	Long: `Write one training example per distinct prompt that a workflow's steps sent in
+successful recorded runs, with the response it got, as JSONL in OpenAI's chat
+format. A prompt sent more than once keeps its latest response. Runs are
+those of workflows whose path contains the argument, or every run without
+one.
+
+--min-score keeps only runs that 'comanda eval' scored at least that high, so
+the model learns from the outputs the judge approved of.
+
+Examples:
+  comanda finetune prepare reply.yaml --step reply -o train.jsonl
+  comanda finetune prepare reply.yaml --step reply --min-score 4 --last all -o train.jsonl`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		window, err := parseAge(finetuneLast)
+		if err != nil {
+			return err
+		}
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		runs, err := store.List()
+		if err != nil {
+			return err
+		}
+		if window > 0 {
+			runs = history.Since(runs, time.Now().Add(-window))
+		}
+		if len(args) == 1 {
+			var matching []history.Run
+			for _, run := range runs {
+				if strings.Contains(run.Workflow, args[0]) {
+					matching = append(matching, run)
+				}
+			}
+			runs = matching
+		}
+
+		examples, stats, err := finetune.Collect(runs, finetune.Options{Step: finetuneStep, MinScore: finetuneMinScore, System: finetuneSystem})
+		if err != nil {
+			return err
+		}
+		printPrepareStats(os.Stderr, stats, len(examples))
+		if len(examples) == 0 {
+			return fmt.Errorf("no recorded prompts match; runs keep their prompts only when recorded in the run history")
+		}
+		out := io.Writer(os.Stdout)
+		if finetuneOutput != "" {
+			f, err := os.Create(finetuneOutput)
+			if err != nil {
+				return fmt.Errorf("error creating training data file: %w", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		return finetune.WriteJSONL(out, examples)
+	},
+}
+
+// printPrepareStats writes how many examples were kept and why prompts were
+// left out
+func printPrepareStats(out io.Writer, stats finetune.Stats, examples int) {
+	fmt.Fprintf(out, "%d examples from %d prompts of %d runs", examples, stats.Prompts, stats.Runs)
+	var skipped []string
+	for _, s := range []struct {
+		n      int
+		reason string
+	}{
+		{stats.Duplicates, "repeated"},
+		{stats.Failed, "failed"},
+		{stats.Unscored, "scored too low or never scored"},
+		{stats.MissingFiles, "attached file no longer available"},
+	} {
+		if s.n > 0 {
+			skipped = append(skipped, fmt.Sprintf("%d %s", s.n, s.reason))
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(out, " (skipped %s)", strings.Join(skipped, ", "))
+	}
+	fmt.Fprintln(out)
+}
+
+var finetuneSubmitCmd = &cobra.Command{
+	Use:   "submit <train.jsonl>",
+	Short: "Start a fine-tuning job on OpenAI or Google",
+	Long: `Start fine-tuning a base model on the examples of a JSONL file in OpenAI's chat
+format, as 'comanda finetune prepare' writes. The provider is the one serving
+the base model: OpenAI (such as gpt-4o-mini-2024-07-18) or Google (such as
+gemini-1.5-flash-001-tuning). Google receives the examples inline, with any
+system message put before the prompt.
+
+With --wait the command polls the job until it finishes and then registers
+the tuned model; otherwise 'comanda finetune status' does that later.
+
+Examples:
+  comanda finetune submit train.jsonl --model gpt-4o-mini-2024-07-18 --suffix support --alias support-bot
+  comanda finetune submit train.jsonl --model gemini-1.5-flash-001-tuning --epochs 5 --wait`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if finetuneModel == "" {
+			return fmt.Errorf("--model is required")
+		}
+		if finetuneAlias != "" {
+			if err := checkTunedAlias(finetuneAlias); err != nil {
+				return err
+			}
+		}
+		training, err := finetune.ReadJSONL(args[0])
+		if err != nil {
+			return err
+		}
+		var validation []models.TuningExample
+		if finetuneValidation != "" {
+			if validation, err = finetune.ReadJSONL(finetuneValidation); err != nil {
+				return err
+			}
+		}
+
+		policy := envConfig.PolicySettings()
+		if err := policy.CheckModel(finetuneModel); err != nil {
+			return fmt.Errorf("%w: %v", processor.ErrPolicy, err)
+		}
+		provider, err := providerForModel(finetuneModel)
+		if err != nil {
+			return err
+		}
+		if err := policy.CheckProvider(provider.Name()); err != nil {
+			return fmt.Errorf("%w: %v", processor.ErrPolicy, err)
+		}
+		tuner, ok := provider.(models.Tuner)
+		if !ok {
+			return fmt.Errorf("provider %s doesn't support fine-tuning; use an OpenAI or Google model", provider.Name())
+		}
+
+		state, err := tuner.StartTuning(models.TuningRequest{
+			BaseModel: finetuneModel, Training: training, Validation: validation,
+			Suffix: finetuneSuffix, Epochs: finetuneEpochs,
+		})
+		if err != nil {
+			return fmt.Errorf("error starting fine-tuning job: %w", err)
+		}
+		job := finetune.Job{
+			ID: state.ID, Provider: provider.Name(), BaseModel: finetuneModel, Examples: len(training),
+			Alias: finetuneAlias, Status: state.Status, Created: time.Now(),
+		}
+		if abs, err := filepath.Abs(args[0]); err == nil {
+			job.TrainingFile = abs
+		}
+		if err := finetune.Save(finetune.DefaultPath(), job); err != nil {
+			return err
+		}
+		fmt.Printf("Started fine-tuning job %s: %s on %d examples\n", job.ID, job.BaseModel, job.Examples)
+		if !finetuneWait {
+			fmt.Printf("Run 'comanda finetune status %s' to check on it.\n", job.ID)
+			return nil
+		}
+		return followJob(tuner, job, true)
+	},
+}
+
+var finetuneStatusCmd = &cobra.Command{
+	Use:   "status [job]",
+	Short: "Check fine-tuning jobs and register the models of finished ones",
+	Long: `Ask the providers for the status of fine-tuning jobs started with comanda and
+register the model of each job that succeeded: it is enabled in the env
+config, with the modes of its base model, and the job's alias is pointed at
+it. Without an argument every job is listed. A job can be named by the end
+of its ID or as "last".
+
+Examples:
+  comanda finetune status
+  comanda finetune status last --wait`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, err := finetune.Load(finetune.DefaultPath())
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			job, err := finetune.Find(jobs, args[0])
+			if err != nil {
+				return err
+			}
+			tuner, err := tunerByName(job.Provider)
+			if err != nil {
+				return err
+			}
+			return followJob(tuner, job, finetuneWait)
+		}
+
+		if len(jobs) == 0 {
+			fmt.Println("No fine-tuning jobs. Start one with 'comanda finetune submit'.")
+			return nil
+		}
+		for i, job := range jobs {
+			if job.Done() && (job.Registered || job.Status != models.TuningSucceeded) {
+				continue
+			}
+			tuner, err := tunerByName(job.Provider)
+			if err == nil {
+				job, err = finetune.Refresh(tuner, job)
+			}
+			if err == nil {
+				job, err = finishJob(job)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: job %s: %v\n", job.ID, err)
+			}
+			jobs[i] = job
+		}
+		printJobTable(os.Stdout, jobs)
+		return nil
+	},
+}
+
+// checkTunedAlias refuses an alias that already stands for a model other
+// than a tuned one, which registering the job would silently replace
+func checkTunedAlias(alias string) error {
+	model := envConfig.ResolveModel(alias)
+	if model == alias || strings.HasPrefix(model, "ft:") || strings.HasPrefix(model, "tunedModels/") {
+		return nil
+	}
+	return fmt.Errorf("alias '%s' already stands for %s, which isn't a tuned model; remove it with 'comanda models alias --remove %s'", alias, model, alias)
+}
+
+// tunerByName returns the configured provider of a job, as a tuner
+func tunerByName(name string) (models.Tuner, error) {
+	provider := models.ProviderByName(name)
+	if provider == nil {
+		return nil, fmt.Errorf("unknown provider %s", name)
+	}
+	providerConfig, err := envConfig.GetProviderConfig(name)
+	if err != nil || providerConfig.APIKey == "" {
+		return nil, fmt.Errorf("missing API key for provider %s. Use 'comanda configure' to add it", name)
+	}
+	if err := provider.Configure(providerConfig.APIKey); err != nil {
+		return nil, fmt.Errorf("failed to configure provider %s: %w", name, err)
+	}
+	provider.SetVerbose(verbose)
+	tuner, ok := provider.(models.Tuner)
+	if !ok {
+		return nil, fmt.Errorf("provider %s doesn't support fine-tuning", name)
+	}
+	return tuner, nil
+}
+
+// followJob refreshes a job, polling it until it is done when wait is set,
+// saves it and registers its model once it has succeeded
+func followJob(tuner models.Tuner, job finetune.Job, wait bool) error {
+	var err error
+	if wait {
+		ctx, stop := interruptContext()
+		defer stop()
+		fmt.Fprintf(os.Stderr, "Waiting for job %s (checking every %s)\n", job.ID, finetuneInterval)
+		job, err = finetune.Wait(ctx, tuner, job, finetuneInterval, func(j finetune.Job) {
+			fmt.Fprintf(os.Stderr, "%s  %s\n", time.Now().Format("15:04:05"), j.Status)
+		})
+	} else {
+		job, err = finetune.Refresh(tuner, job)
+	}
+	if err != nil {
+		return err
+	}
+	job, err = finishJob(job)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Job %s: %s\n", job.ID, job.Status)
+	switch {
+	case job.Status == models.TuningSucceeded && job.Alias != "":
+		fmt.Printf("Registered %s as %s\n", job.Model, job.Alias)
+	case job.Status == models.TuningSucceeded:
+		fmt.Printf("Registered %s\n", job.Model)
+	case job.Error != "":
+		fmt.Printf("Error: %s\n", job.Error)
+	}
+	return nil
+}
+
+// finishJob registers the model of a job that succeeded and hasn't been
+// registered yet, saving the env config, and saves the job
+func finishJob(job finetune.Job) (finetune.Job, error) {
+	if job.Status == models.TuningSucceeded && !job.Registered {
+		if err := finetune.Register(envConfig, job); err != nil {
+			return job, err
+		}
+		if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+			return job, fmt.Errorf("error saving configuration: %w", err)
+		}
+		job.Registered = true
+	}
+	return job, finetune.Save(finetune.DefaultPath(), job)
+}
+
+// printJobTable writes one line per fine-tuning job
+func printJobTable(out io.Writer, jobs []finetune.Job) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tPROVIDER\tBASE MODEL\tEXAMPLES\tSTATUS\tMODEL\tALIAS\tSTARTED")
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", job.ID, job.Provider, job.BaseModel, job.Examples,
+			job.Status, orDash(job.Model), orDash(job.Alias), job.Created.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+}
+
+func init() {
+	finetunePrepareCmd.Flags().StringVar(&finetuneStep, "step", "", "Only use the prompts of this step")
+	finetunePrepareCmd.Flags().Float64Var(&finetuneMinScore, "min-score", 0, "Only use runs 'comanda eval' scored at least this")
+	finetunePrepareCmd.Flags().StringVar(&finetuneLast, "last", "30d", "Period of runs to use, such as 7d, 2w, 1m or all")
+	finetunePrepareCmd.Flags().StringVar(&finetuneSystem, "system", "", "System message to add to every example")
+	finetunePrepareCmd.Flags().StringVarP(&finetuneOutput, "output", "o", "", "File to write the training data to instead of stdout")
+	finetunePrepareCmd.ValidArgsFunction = completeWorkflowArgs(1)
+
+	finetuneSubmitCmd.Flags().StringVar(&finetuneModel, "model", "", "Base model to fine-tune")
+	finetuneSubmitCmd.RegisterFlagCompletionFunc("model", completeModelFlag)
+	finetuneSubmitCmd.Flags().StringVar(&finetuneSuffix, "suffix", "", "Name added to the tuned model's name")
+	finetuneSubmitCmd.Flags().IntVar(&finetuneEpochs, "epochs", 0, "Passes over the training data; the provider's default when 0")
+	finetuneSubmitCmd.Flags().StringVar(&finetuneValidation, "validation", "", "JSONL file of held-out examples (OpenAI only)")
+	finetuneSubmitCmd.Flags().StringVar(&finetuneAlias, "alias", "", "Alias to register the tuned model under")
+	finetuneSubmitCmd.Flags().BoolVar(&finetuneWait, "wait", false, "Wait for the job to finish and register its model")
+	finetuneSubmitCmd.Flags().DurationVar(&finetuneInterval, "interval", time.Minute, "How often to check the job with --wait")
+
+	finetuneStatusCmd.Flags().BoolVar(&finetuneWait, "wait", false, "Wait for the job to finish and register its model")
+	finetuneStatusCmd.Flags().DurationVar(&finetuneInterval, "interval", time.Minute, "How often to check the job with --wait")
+
+	finetuneCmd.AddCommand(finetunePrepareCmd, finetuneSubmitCmd, finetuneStatusCmd)
+	rootCmd.AddCommand(finetuneCmd)
+}
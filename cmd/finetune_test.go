@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/finetune"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+func TestPrintPrepareStats(t *testing.T) {
+	var out bytes.Buffer
+	printPrepareStats(&out, finetune.Stats{Runs: 4, Prompts: 9, Duplicates: 2, Unscored: 3}, 4)
+	if want := "4 examples from 9 prompts of 4 runs (skipped 2 repeated, 3 scored too low or never scored)\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	printPrepareStats(&out, finetune.Stats{Runs: 1, Prompts: 1}, 1)
+	if want := "1 examples from 1 prompts of 1 runs\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestPrintJobTable(t *testing.T) {
+	created := time.Date(2026, 3, 2, 9, 30, 0, 0, time.Local)
+	jobs := []finetune.Job{
+		{ID: "ftjob-abc", Provider: "openai", BaseModel: "gpt-4o-mini-2024-07-18", Examples: 120, Status: models.TuningSucceeded,
+			Model: "ft:gpt-4o-mini-2024-07-18:org:support:xyz", Alias: "support-bot", Created: created},
+		{ID: "tunedModels/reply-1", Provider: "google", BaseModel: "gemini-1.5-flash-001-tuning", Examples: 40, Status: models.TuningRunning, Created: created},
+	}
+	var out bytes.Buffer
+	printJobTable(&out, jobs)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), out.String())
+	}
+	for i, want := range [][]string{
+		{"JOB", "PROVIDER", "BASE MODEL", "STATUS", "MODEL", "ALIAS"},
+		{"ftjob-abc", "openai", "120", "succeeded", "ft:gpt-4o-mini-2024-07-18:org:support:xyz", "support-bot", "2026-03-02 09:30"},
+		{"tunedModels/reply-1", "google", "40", "running", "-  "},
+	} {
+		for _, field := range want {
+			if !strings.Contains(lines[i], field) {
+				t.Errorf("line %d doesn't contain %q: %s", i, field, lines[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Generate flags
+var generateModelName string
+var generateOutput string
+var generateMaxAttempts int
+
+var generateCmd = &cobra.Command{
+	Use:   "generate [output.yaml] \"<description>\"",
+	Short: "Generate a new Comanda workflow YAML file using an LLM",
+	Long: `Describe what you want in plain words and a model drafts the workflow for you.
+The draft is checked the way 'comanda validate' checks a workflow, and when it
+has problems they are sent back to the model to fix, up to --max-attempts
+times. Missing input files and API keys are reported but not sent back, since
+they depend on your machine rather than on the workflow.
+
+The workflow is saved to the output file given as the first argument or with
+--output, or to a file named after the description. The default_generation_model
+from your configuration is used unless --model is given.`,
+	Example: `  comanda generate "watch the inbox folder, summarize new PDFs, email me"
+  comanda generate review.yaml "review a Go file for bugs and suggest fixes"
+  comanda generate "summarize a CSV file" -o csv.yaml --model claude-3-opus`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("requires a description of the workflow, optionally after an output filename\nExample: comanda generate \"Create a workflow to summarize a file and save it.\"")
+		}
+		if len(args) == 2 && generateOutput != "" {
+			return fmt.Errorf("give the output filename as an argument or with --output, not both")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		request := args[len(args)-1]
+		output := generateOutput
+		if len(args) == 2 {
+			output = args[0]
+		}
+		if output == "" {
+			output = workflowFileName(request)
+		}
+		if generateMaxAttempts < 1 {
+			return fmt.Errorf("--max-attempts must be at least 1")
+		}
+
+		modelForGeneration := generateModelName
+		if modelForGeneration == "" {
+			modelForGeneration = envConfig.DefaultGenerationModel
+		}
+		if modelForGeneration == "" {
+			return fmt.Errorf("no model specified for generation and no default_generation_model configured. Use --model or configure a default")
+		}
+
+		fmt.Printf("Generating workflow using model: %s\n", modelForGeneration)
+		fmt.Printf("Output file: %s\n", output)
+
+		provider, err := generationProvider(modelForGeneration)
+		if err != nil {
+			return err
+		}
+		send := func(prompt string) (string, error) {
+			response, err := provider.SendPrompt(modelForGeneration, prompt)
+			if err != nil {
+				return "", fmt.Errorf("LLM execution failed for model '%s': %w", modelForGeneration, err)
+			}
+			return response, nil
+		}
+
+		result, err := generateWorkflow(send, request, envConfig.GetAllConfiguredModels(), generateMaxAttempts, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(output, []byte(result.YAML), 0644); err != nil {
+			return fmt.Errorf("failed to write generated workflow to '%s': %w", output, err)
+		}
+
+		if len(result.Issues) > 0 {
+			fmt.Printf("\nThe workflow still has problems after %d attempt(s):\n", result.Attempts)
+			for _, issue := range result.Issues {
+				fmt.Printf("  - %s\n", issue)
+			}
+			return fmt.Errorf("generated workflow is not valid; it was saved to %s for you to fix", output)
+		}
+
+		fmt.Printf("\n%s Workflow successfully generated and saved to %s\n", "✅", output)
+		if notes := validateWorkflowFile(output); len(notes) > 0 {
+			fmt.Println("\nBefore running it:")
+			for _, issue := range notes {
+				fmt.Printf("  - %s\n", issue)
+			}
+		}
+		fmt.Printf("\nRun it with:\n\n   comanda process %s\n", output)
+		return nil
+	},
+}
+
+// generationResult is the outcome of drafting a workflow
+type generationResult struct {
+	YAML     string
+	Issues   []processor.ValidationIssue // Problems left after the last attempt
+	Attempts int
+}
+
+// generateWorkflow asks the model for a workflow and sends validation
+// problems back to it until the workflow passes or attempts run out
+func generateWorkflow(send func(prompt string) (string, error), request string, configured []string, attempts int, progress io.Writer) (*generationResult, error) {
+	prompt := generationPrompt(request, configured)
+	result := &generationResult{}
+	for result.Attempts < attempts {
+		result.Attempts++
+		response, err := send(prompt)
+		if err != nil {
+			return nil, err
+		}
+		result.YAML = extractYAML(response)
+		result.Issues = checkGeneratedWorkflow([]byte(result.YAML))
+		if len(result.Issues) == 0 {
+			fmt.Fprintf(progress, "Attempt %d: workflow is valid\n", result.Attempts)
+			return result, nil
+		}
+		fmt.Fprintf(progress, "Attempt %d: found %d problem(s)\n", result.Attempts, len(result.Issues))
+		prompt = repairPrompt(request, result.YAML, result.Issues, configured)
+	}
+	return result, nil
+}
+
+// checkGeneratedWorkflow validates a drafted workflow, leaving out problems
+// with the local setup that the model can't fix
+func checkGeneratedWorkflow(data []byte) []processor.ValidationIssue {
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(data, &dslConfig); err != nil {
+		return []processor.ValidationIssue{{Message: fmt.Sprintf("error parsing YAML: %v", err)}}
+	}
+	issues, err := processor.CheckStepFields(data)
+	if err != nil {
+		return []processor.ValidationIssue{{Message: fmt.Sprintf("error parsing YAML: %v", err)}}
+	}
+	proc := processor.NewProcessor(&dslConfig, envConfig, &config.ServerConfig{Enabled: false}, verbose)
+	return append(issues, proc.ValidateStructure()...)
+}
+
+// generationPrompt is the first prompt sent for a workflow
+func generationPrompt(request string, configured []string) string {
+	return fmt.Sprintf(`SYSTEM: You are a YAML generator. You MUST output ONLY valid YAML content. No explanations, no markdown, no code blocks, no commentary - just raw YAML.
+
+--- BEGIN COMANDA DSL SPECIFICATION ---
+%s
+--- END COMANDA DSL SPECIFICATION ---
+%s
+User's request: %s
+
+CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be directly saved to a .yaml file. Do not include ANY text before or after the YAML content. Start your response with the first line of YAML and end with the last line of YAML.`,
+		processor.EmbeddedLLMGuide, modelHint(configured), request)
+}
+
+// repairPrompt asks the model to fix the problems found in its last draft
+func repairPrompt(request, draft string, issues []processor.ValidationIssue, configured []string) string {
+	var problems strings.Builder
+	for _, issue := range issues {
+		fmt.Fprintf(&problems, "- %s\n", issue)
+	}
+	return fmt.Sprintf(`SYSTEM: You are a YAML generator. You MUST output ONLY valid YAML content. No explanations, no markdown, no code blocks, no commentary - just raw YAML.
+
+--- BEGIN COMANDA DSL SPECIFICATION ---
+%s
+--- END COMANDA DSL SPECIFICATION ---
+%s
+User's request: %s
+
+You wrote this workflow for the request:
+
+%s
+
+Validating it found these problems:
+%s
+CRITICAL INSTRUCTION: Respond with the complete corrected workflow as valid YAML only, fixing every problem listed while still doing what the user asked. Do not include ANY text before or after the YAML content.`,
+		processor.EmbeddedLLMGuide, modelHint(configured), request, draft, problems.String())
+}
+
+// modelHint tells the model which models the workflow may use
+func modelHint(configured []string) string {
+	if len(configured) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nUse only these configured models in the workflow: %s\n", strings.Join(configured, ", "))
+}
+
+// extractYAML returns the YAML in a model response, taking it out of a
+// markdown code block if the model used one
+func extractYAML(response string) string {
+	if strings.Contains(response, "```yaml") {
+		_, rest, _ := strings.Cut(response, "```yaml")
+		if block, _, found := strings.Cut(rest, "```"); found {
+			return strings.TrimSpace(block)
+		}
+	} else if parts := strings.Split(response, "```"); len(parts) >= 3 {
+		// Take the first code block, dropping a language identifier
+		block := strings.TrimSpace(parts[1])
+		lines := strings.Split(block, "\n")
+		if !strings.Contains(lines[0], ":") {
+			block = strings.Join(lines[1:], "\n")
+		}
+		return block
+	}
+	return response
+}
+
+// workflowFileName names a workflow after the first words of its
+// description, without replacing an existing file
+func workflowFileName(request string) string {
+	words := strings.FieldsFunc(strings.ToLower(request), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	if len(words) > 5 {
+		words = words[:5]
+	}
+	base := strings.Join(words, "-")
+	if base == "" {
+		base = "workflow"
+	}
+	name := base + ".yaml"
+	for i := 2; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d.yaml", base, i)
+	}
+}
+
+// generationProvider returns the provider for a model, configured with its
+// API key when the env configuration has one
+func generationProvider(modelName string) (models.Provider, error) {
+	provider := models.DetectProvider(modelName)
+	if provider == nil {
+		return nil, fmt.Errorf("could not detect provider for model: %s", modelName)
+	}
+	providerConfig, err := envConfig.GetProviderConfig(provider.Name())
+	if err != nil {
+		// Providers such as Ollama don't need an API key
+		fmt.Printf("Warning: Provider %s not found in env configuration. Assuming it does not require an API key or is pre-configured.\n", provider.Name())
+	} else if err := provider.Configure(providerConfig.APIKey); err != nil {
+		return nil, fmt.Errorf("failed to configure provider %s: %w", provider.Name(), err)
+	}
+	provider.SetVerbose(verbose)
+	return provider, nil
+}
+
+func init() {
+	generateCmd.Flags().StringVarP(&generateModelName, "model", "m", "", "Model to use for workflow generation (optional, uses default if not set)")
+	generateCmd.Flags().StringVarP(&generateOutput, "output", "o", "", "File to save the workflow to (default: named after the description)")
+	generateCmd.Flags().IntVar(&generateMaxAttempts, "max-attempts", 3, "Times to ask the model for a workflow that passes validation")
+	generateCmd.RegisterFlagCompletionFunc("model", completeModelFlag)
+	rootCmd.AddCommand(generateCmd)
+}
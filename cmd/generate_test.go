@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestExtractYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"raw", "step:\n  input: NA\n", "step:\n  input: NA\n"},
+		{"yaml fence", "Here you go:\n```yaml\nstep:\n  input: NA\n```\nEnjoy", "step:\n  input: NA"},
+		{"bare fence", "```\nstep:\n  input: NA\n```", "step:\n  input: NA"},
+		{"other language", "```yml\nstep:\n  input: NA\n```", "step:\n  input: NA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractYAML(tt.response); got != tt.want {
+				t.Errorf("extractYAML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkflowFileName(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	name := workflowFileName("Watch the inbox folder, summarize new PDFs, email me")
+	if name != "watch-the-inbox-folder-summarize.yaml" {
+		t.Errorf("workflowFileName() = %q", name)
+	}
+	if err := os.WriteFile(name, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := workflowFileName("Watch the inbox folder, summarize new PDFs"); got != "watch-the-inbox-folder-summarize-2.yaml" {
+		t.Errorf("workflowFileName() with existing file = %q", got)
+	}
+	if got := workflowFileName("!!!"); got != "workflow.yaml" {
+		t.Errorf("workflowFileName() without words = %q", got)
+	}
+}
+
+func TestGenerateWorkflowRetriesUntilValid(t *testing.T) {
+	saved := envConfig
+	envConfig = &config.EnvConfig{}
+	defer func() { envConfig = saved }()
+
+	responses := []string{
+		"```yaml\nsummarize:\n  input: NA\n  model: NA\n  acton: Summarize\n  output: STDOUT\n```",
+		"summarize:\n  input: inbox/*.pdf\n  model: NA\n  action: Summarize\n  output: STDOUT\n",
+	}
+	var prompts []string
+	send := func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return responses[len(prompts)-1], nil
+	}
+
+	result, err := generateWorkflow(send, "summarize PDFs", []string{"gpt-4o"}, 3, io.Discard)
+	if err != nil {
+		t.Fatalf("generateWorkflow() error = %v", err)
+	}
+	if result.Attempts != 2 || len(result.Issues) != 0 {
+		t.Fatalf("expected a valid workflow on attempt 2, got %d attempt(s) and %v", result.Attempts, result.Issues)
+	}
+	if !strings.Contains(result.YAML, "action: Summarize") {
+		t.Errorf("unexpected workflow:\n%s", result.YAML)
+	}
+	if !strings.Contains(prompts[0], "Use only these configured models in the workflow: gpt-4o") {
+		t.Error("first prompt does not list the configured models")
+	}
+	// The second prompt carries the draft and what was wrong with it
+	if !strings.Contains(prompts[1], "acton: Summarize") || !strings.Contains(prompts[1], "unknown field 'acton'") {
+		t.Errorf("repair prompt is missing the draft or its problems:\n%s", prompts[1])
+	}
+}
+
+func TestGenerateWorkflowStopsAfterMaxAttempts(t *testing.T) {
+	saved := envConfig
+	envConfig = &config.EnvConfig{}
+	defer func() { envConfig = saved }()
+
+	calls := 0
+	send := func(prompt string) (string, error) {
+		calls++
+		return "summarize: [\n", nil
+	}
+	result, err := generateWorkflow(send, "summarize PDFs", nil, 2, io.Discard)
+	if err != nil {
+		t.Fatalf("generateWorkflow() error = %v", err)
+	}
+	if calls != 2 || result.Attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d call(s) and %d attempt(s)", calls, result.Attempts)
+	}
+	if len(result.Issues) != 1 || !strings.Contains(result.Issues[0].Message, "error parsing YAML") {
+		t.Errorf("expected a parse error, got %v", result.Issues)
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Graph command flags
+var graphFormat string
+var graphOutput string
+
+var graphCmd = &cobra.Command{
+	Use:   "graph <file>",
+	Short: "Render a workflow as a Mermaid or Graphviz DOT diagram",
+	Long: `Render the steps, parallel groups and dependencies of a workflow file as a
+Mermaid flowchart (default) or a Graphviz DOT digraph, without running it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, dslConfig, err := readWorkflowFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		proc := processor.NewProcessor(dslConfig, envConfig, &config.ServerConfig{Enabled: false}, verbose, "")
+		rendered, err := proc.Graph().Render(graphFormat)
+		if err != nil {
+			return err
+		}
+
+		if graphOutput == "" {
+			fmt.Print(rendered)
+			return nil
+		}
+		if err := os.WriteFile(graphOutput, []byte(rendered), 0644); err != nil {
+			return fmt.Errorf("error writing graph to %s: %w", graphOutput, err)
+		}
+		fmt.Printf("Graph written to %s\n", graphOutput)
+		return nil
+	},
+}
+
+func init() {
+	graphCmd.Flags().StringVarP(&graphFormat, "format", "f", processor.GraphMermaid, "Output format: mermaid or dot")
+	graphCmd.Flags().StringVarP(&graphOutput, "output", "o", "", "Write the graph to a file instead of STDOUT")
+	graphCmd.ValidArgsFunction = completeWorkflowArgs(1)
+	rootCmd.AddCommand(graphCmd)
+}
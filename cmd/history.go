@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// History flags
+var noHistory bool
+var historyLimit int
+var historyWorkflow string
+var historyJSON bool
+var logsStep string
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past workflow runs",
+	Long: `List past runs of 'comanda process' and 'comanda run', most recent first, with
+their status, duration and estimated cost. Use 'comanda logs <run-id>' for details.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		runs, err := store.List()
+		if err != nil {
+			return err
+		}
+
+		var shown []history.Run
+		for _, run := range runs {
+			if historyWorkflow != "" && !strings.Contains(run.Workflow, historyWorkflow) {
+				continue
+			}
+			shown = append(shown, run)
+			if historyLimit > 0 && len(shown) == historyLimit {
+				break
+			}
+		}
+
+		if historyJSON {
+			return printJSON(os.Stdout, shown)
+		}
+		if len(shown) == 0 {
+			fmt.Println("No runs recorded yet.")
+			return nil
+		}
+		printRunTable(os.Stdout, shown)
+		return nil
+	},
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <run-id>",
+	Short: "Show the details and step outputs of a past run",
+	Long: `Show a past run's status, timing, cost, output locations and steps. The run ID
+can be shortened to any unique prefix, or given as "last". With --step, print
+that step's stored output instead.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		run, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+
+		if logsStep != "" {
+			step, ok := run.Step(logsStep)
+			if !ok {
+				return fmt.Errorf("run %s has no step '%s'", run.ID, logsStep)
+			}
+			if step.OutputFile == "" {
+				return fmt.Errorf("step '%s' has no stored output", logsStep)
+			}
+			data, err := os.ReadFile(step.OutputFile)
+			if err != nil {
+				return fmt.Errorf("error reading output of step '%s': %w", logsStep, err)
+			}
+			os.Stdout.Write(data)
+			return nil
+		}
+
+		if historyJSON {
+			return printJSON(os.Stdout, run)
+		}
+		printRunDetails(os.Stdout, run)
+		return nil
+	},
+}
+
+// openHistory opens the run history store. Run records go to the configured
+// database, if there is one.
+func openHistory() (*history.Store, error) {
+	return history.OpenConfigured(historyDir(envConfig), envConfig)
+}
+
+// historyDir returns the history directory: COMANDA_HISTORY_DIR, then the
+// env config's history settings, then the default
+func historyDir(cfg *config.EnvConfig) string {
+	dir := history.DefaultDir()
+	if settings := cfg.HistorySettings(); settings.Dir != "" && os.Getenv("COMANDA_HISTORY_DIR") == "" {
+		dir = settings.Dir
+	}
+	return dir
+}
+
+// recordRun starts recording a run in the history store and returns the
+// function that finishes the record. History problems never stop a run.
+func recordRun(workflow string, proc *processor.Processor) func(error) {
+	if noHistory {
+		return func(error) {}
+	}
+	store, err := openHistory()
+	if err == nil {
+		var recorder *history.Recorder
+		if recorder, err = store.Start(workflow); err == nil {
+			proc.SetStepRecorder(recorder)
+			return func(runErr error) {
+				if err := recorder.Finish(runErr); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to record run: %v\n", err)
+				}
+				store.Close()
+			}
+		}
+		store.Close()
+	}
+	fmt.Fprintf(os.Stderr, "Warning: run history disabled: %v\n", err)
+	return func(error) {}
+}
+
+// printRunTable writes one line per run
+func printRunTable(out io.Writer, runs []history.Run) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN ID\tSTARTED\tDURATION\tSTATUS\tCOST\tWORKFLOW")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", run.ID, run.Started.Local().Format("2006-01-02 15:04"),
+			runDuration(run.Started, run.Finished), run.Status, formatCost(run.Cost()), run.Workflow)
+	}
+	w.Flush()
+}
+
+// printRunDetails writes a run's summary followed by its steps
+func printRunDetails(out io.Writer, run *history.Run) {
+	prompt, completion := run.Tokens()
+	fmt.Fprintf(out, "Run:      %s\n", run.ID)
+	fmt.Fprintf(out, "Workflow: %s\n", run.Workflow)
+	if run.ReplayOf != "" {
+		fmt.Fprintf(out, "Replay of: %s\n", run.ReplayOf)
+	}
+	fmt.Fprintf(out, "Status:   %s\n", run.Status)
+	if run.Error != "" {
+		fmt.Fprintf(out, "Error:    %s\n", run.Error)
+	}
+	fmt.Fprintf(out, "Started:  %s\n", run.Started.Local().Format(time.RFC1123))
+	fmt.Fprintf(out, "Duration: %s\n", runDuration(run.Started, run.Finished))
+	fmt.Fprintf(out, "Tokens:   ~%d in / ~%d out\n", prompt, completion)
+	fmt.Fprintf(out, "Cost:     %s\n", formatCost(run.Cost()))
+	if outputs := run.Outputs(); len(outputs) > 0 {
+		fmt.Fprintf(out, "Outputs:  %s\n", strings.Join(outputs, ", "))
+	}
+	if len(run.Steps) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tMODEL\tSTATUS\tDURATION\tTOKENS\tRETRIES\tCACHE HITS\tCOST\tSTORED OUTPUT")
+	for _, s := range run.Steps {
+		status := s.Status
+		if s.Error != "" {
+			status += ": " + s.Error
+		}
+		stored := s.OutputFile
+		if stored == "" {
+			stored = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t~%d/~%d\t%d\t%d\t%s\t%s\n", s.Name, s.Model, status,
+			runDuration(s.Started, s.Finished), s.PromptTokens, s.CompletionTokens, s.Retries, s.CacheHits, formatCost(s.Cost), stored)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\nPrint a step's output with: comanda logs %s --step <name>\n", run.ID)
+}
+
+// runDuration renders the time between two instants, or "-" if unfinished
+func runDuration(started, finished time.Time) string {
+	if finished.IsZero() || finished.Before(started) {
+		return "-"
+	}
+	return finished.Sub(started).Round(100 * time.Millisecond).String()
+}
+
+// formatCost renders an estimated cost in US dollars
+func formatCost(cost float64) string {
+	if cost == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("$%.4f", cost)
+}
+
+// printJSON writes v as indented JSON
+func printJSON(out io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %w", err)
+	}
+	fmt.Fprintln(out, string(data))
+	return nil
+}
+
+func init() {
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Number of runs to show (0 for all)")
+	historyCmd.Flags().StringVar(&historyWorkflow, "workflow", "", "Only show runs of workflows whose path contains this text")
+	historyCmd.Flags().BoolVar(&historyJSON, "json", false, "Print runs as JSON")
+	logsCmd.Flags().StringVar(&logsStep, "step", "", "Print the stored output of this step")
+	logsCmd.Flags().BoolVar(&historyJSON, "json", false, "Print the run as JSON")
+	rootCmd.AddCommand(historyCmd, logsCmd)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Init command flags
+var initDir string
+var initModel string
+var initForce bool
+
+var initCmd = &cobra.Command{
+	Use:   "init [template]",
+	Short: "Create a starter workflow from a built-in template",
+	Long: `Create a ready-to-edit workflow and sample inputs from a built-in template.
+Run without a template to list the available templates.
+
+Example:
+  comanda init summarize-docs
+  comanda init code-review --dir review --model claude-3-5-sonnet-latest`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			fmt.Println("Available templates:")
+			for _, name := range templateNames() {
+				fmt.Printf("  %-16s %s\n", name, workflowTemplates[name].description)
+			}
+			fmt.Println("\nRun 'comanda init <template>' to create one.")
+			return nil
+		}
+
+		model := initModel
+		if model == "" && envConfig != nil {
+			model = envConfig.DefaultGenerationModel
+		}
+		if model == "" {
+			model = "gpt-4o-mini"
+		}
+
+		created, err := scaffoldTemplate(args[0], initDir, model, initForce)
+		if err != nil {
+			return err
+		}
+		for _, path := range created {
+			fmt.Printf("Created %s\n", path)
+		}
+		// Workflow inputs are resolved from the working directory
+		if filepath.Clean(initDir) == "." {
+			fmt.Printf("\nRun it with: comanda process %s.yaml\n", args[0])
+		} else {
+			fmt.Printf("\nRun it with: cd %s && comanda process %s.yaml\n", initDir, args[0])
+		}
+		return nil
+	},
+}
+
+// templateNames lists the built-in templates in alphabetical order
+func templateNames() []string {
+	names := make([]string, 0, len(workflowTemplates))
+	for name := range workflowTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scaffoldTemplate writes a template's workflow and sample inputs into dir and
+// returns the created paths, workflow first. Existing files are left alone
+// unless force is set.
+func scaffoldTemplate(name, dir, model string, force bool) ([]string, error) {
+	tmpl, ok := workflowTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown template '%s' (available: %s)", name, strings.Join(templateNames(), ", "))
+	}
+
+	files := map[string]string{name + ".yaml": strings.ReplaceAll(tmpl.workflow, "{{MODEL}}", model)}
+	paths := []string{name + ".yaml"}
+	var samples []string
+	for path, contents := range tmpl.files {
+		files[path] = contents
+		samples = append(samples, path)
+	}
+	sort.Strings(samples)
+	paths = append(paths, samples...)
+
+	if !force {
+		for _, path := range paths {
+			target := filepath.Join(dir, path)
+			if _, err := os.Stat(target); err == nil {
+				return nil, fmt.Errorf("%s already exists (use --force to overwrite)", target)
+			}
+		}
+	}
+
+	created := make([]string, 0, len(paths))
+	for _, path := range paths {
+		target := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", target, err)
+		}
+		if err := os.WriteFile(target, []byte(files[path]), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", target, err)
+		}
+		created = append(created, target)
+	}
+	return created, nil
+}
+
+func init() {
+	initCmd.Flags().StringVar(&initDir, "dir", ".", "Directory to create the workflow in")
+	initCmd.Flags().StringVarP(&initModel, "model", "m", "", "Model to use in the workflow (defaults to default_generation_model)")
+	initCmd.RegisterFlagCompletionFunc("model", completeModelFlag)
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Overwrite existing files")
+	rootCmd.AddCommand(initCmd)
+}
@@ -0,0 +1,182 @@
+package cmd
+
+// workflowTemplate is a starter workflow created by `comanda init`
+type workflowTemplate struct {
+	description string
+	workflow    string            // Workflow YAML; {{MODEL}} is replaced with the chosen model
+	files       map[string]string // Sample inputs, relative to the target directory
+}
+
+// workflowTemplates are the built-in templates, keyed by name
+var workflowTemplates = map[string]workflowTemplate{
+	"summarize-docs": {
+		description: "Summarize a folder of documents, then write an executive overview",
+		workflow: `# Summarize every Markdown file in docs/ and combine the summaries.
+# Run with: comanda process summarize-docs.yaml
+
+summarize_each:
+  input: "docs/*.md"
+  model: {{MODEL}}
+  action: |
+    Summarize each of these documents in 3-5 bullet points.
+    Start each summary with the document's file name as a heading.
+  output: summaries.md
+
+overview:
+  input: summaries.md
+  model: {{MODEL}}
+  action: |
+    Write a one-paragraph executive overview of these summaries, followed by
+    a short list of decisions or follow-ups that need an owner.
+  output: STDOUT
+`,
+		files: map[string]string{
+			"docs/meeting-notes.md": `# Weekly sync - platform team
+
+- Migration of the billing service to the new cluster slipped a week; the
+  database cutover needs a maintenance window.
+- On-call load dropped 30% after the alert cleanup.
+- We agreed to deprecate the v1 export API at the end of the quarter, pending
+  a customer email.
+`,
+			"docs/project-update.md": `# Search relaunch - status update
+
+The new ranking model is live for 20% of traffic. Click-through is up 8% and
+zero-result searches are down by a third. Remaining work: synonym support for
+product names and a rollback plan before going to 100%. Target date is the
+end of next month.
+`,
+		},
+	},
+	"code-review": {
+		description: "Review source code for bugs and risks, then prioritize the findings",
+		workflow: `# Review a source file and turn the findings into a prioritized checklist.
+# Run with: comanda process code-review.yaml
+
+review:
+  input: src/inventory.go
+  model: {{MODEL}}
+  action: |
+    Review this code as a senior engineer. List bugs, concurrency issues,
+    error handling gaps and security risks. For each finding give the line,
+    the problem and a suggested fix.
+  output: review.md
+
+prioritize:
+  input: review.md
+  model: {{MODEL}}
+  action: |
+    Turn this review into a checklist ordered by severity (critical, high,
+    medium, low). Keep each item to one line.
+  output: STDOUT
+`,
+		files: map[string]string{
+			"src/inventory.go": `package inventory
+
+import "strconv"
+
+var stock = map[string]int{}
+
+// Reserve takes quantity items of sku out of stock
+func Reserve(sku string, quantity string) bool {
+	n, _ := strconv.Atoi(quantity)
+	if stock[sku] > n {
+		stock[sku] -= n
+		return true
+	}
+	return false
+}
+
+// Restock adds items back, called from several goroutines
+func Restock(sku string, n int) {
+	go func() {
+		stock[sku] += n
+	}()
+}
+`,
+		},
+	},
+	"rag-qa": {
+		description: "Answer a question from a small knowledge base, citing sources",
+		workflow: `# Answer the question in question.txt using only the files in knowledge/.
+# Run with: comanda process rag-qa.yaml
+
+answer:
+  input: [knowledge/faq.md, knowledge/policies.md, question.txt]
+  model: {{MODEL}}
+  action: |
+    Answer the question in question.txt using only the knowledge base files.
+    Cite the file each fact comes from in brackets, e.g. [faq.md]. If the
+    knowledge base does not contain the answer, say so instead of guessing.
+  output: answer.md
+
+check:
+  input: [answer.md, knowledge/faq.md, knowledge/policies.md]
+  model: {{MODEL}}
+  action: |
+    Check answer.md against the knowledge base. List any claim that is not
+    supported by the cited file, or reply "All claims supported."
+  output: STDOUT
+`,
+		files: map[string]string{
+			"knowledge/faq.md": `# FAQ
+
+**How long does shipping take?** Standard shipping takes 3-5 business days.
+Express shipping takes 1-2 business days and costs $12.
+
+**Do you ship internationally?** Yes, to the EU, UK and Canada.
+`,
+			"knowledge/policies.md": `# Returns policy
+
+Unused items can be returned within 30 days of delivery for a full refund.
+Sale items can be exchanged but not refunded. Return shipping is free for
+orders over $50.
+`,
+			"question.txt": "Can I get a refund on a discounted jacket I bought two weeks ago, and who pays for shipping it back?\n",
+		},
+	},
+	"data-extract": {
+		description: "Extract structured fields from documents into a validated CSV",
+		workflow: `# Extract invoice fields into a CSV file and check it before using it.
+# Run with: comanda process data-extract.yaml
+
+extract:
+  input: "invoices/*.txt"
+  model: {{MODEL}}
+  action: |
+    Extract one row per invoice as CSV with the header
+    invoice_id,vendor,issued_on,total
+    Use YYYY-MM-DD dates and plain numbers for totals. Reply with the CSV only.
+  postprocess: [strip_fences, trim]
+  output: invoices.csv
+
+check:
+  type: validate-data
+  input: invoices.csv
+  schema:
+    columns:
+      invoice_id: {type: string, required: true}
+      vendor: {type: string, required: true}
+      issued_on: {type: date, required: true}
+      total: {type: number, required: true}
+  output: STDOUT
+`,
+		files: map[string]string{
+			"invoices/invoice-1041.txt": `ACME OFFICE SUPPLY
+Invoice #INV-1041
+Date: March 4, 2025
+
+12 x Printer paper (A4)      $54.00
+ 3 x Toner cartridge        $210.00
+Total due:                  $264.00
+`,
+			"invoices/invoice-1042.txt": `Northwind Cleaning Services
+Invoice no. INV-1042   issued 2025-03-11
+
+Monthly office cleaning (March)     1,150.00 USD
+Window cleaning                       180.00 USD
+TOTAL                               1,330.00 USD
+`,
+		},
+	},
+}
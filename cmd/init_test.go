@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestScaffoldTemplates(t *testing.T) {
+	for _, name := range templateNames() {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			created, err := scaffoldTemplate(name, dir, "gpt-4o", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created[0] != filepath.Join(dir, name+".yaml") || len(created) != len(workflowTemplates[name].files)+1 {
+				t.Fatalf("created = %v", created)
+			}
+
+			data, err := os.ReadFile(created[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "{{MODEL}}") {
+				t.Error("model placeholder was not replaced")
+			}
+			issues, err := processor.CheckStepFields(data)
+			if err != nil || len(issues) > 0 {
+				t.Fatalf("CheckStepFields() = %v, %v", issues, err)
+			}
+			var cfg processor.DSLConfig
+			if err := yaml.Unmarshal(data, &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if len(cfg.Steps) == 0 {
+				t.Fatal("template has no steps")
+			}
+
+			// Every file input the template reads must be a sample or an earlier step's output
+			wd, _ := os.Getwd()
+			defer os.Chdir(wd)
+			os.Chdir(dir)
+			proc := processor.NewProcessor(&cfg, &config.EnvConfig{}, &config.ServerConfig{}, false)
+			for _, issue := range proc.Validate() {
+				if strings.Contains(issue.Message, "does not exist") || strings.Contains(issue.Message, "matches no files") {
+					t.Errorf("missing sample input: %v", issue)
+				}
+			}
+
+			if _, err := scaffoldTemplate(name, dir, "gpt-4o", false); err == nil || !strings.Contains(err.Error(), "already exists") {
+				t.Errorf("second scaffold error = %v, want already exists", err)
+			}
+			if _, err := scaffoldTemplate(name, dir, "gpt-4o", true); err != nil {
+				t.Errorf("scaffold with force: %v", err)
+			}
+		})
+	}
+
+	if _, err := scaffoldTemplate("nope", t.TempDir(), "gpt-4o", false); err == nil || !strings.Contains(err.Error(), "summarize-docs") {
+		t.Errorf("unknown template error = %v", err)
+	}
+}
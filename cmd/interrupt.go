@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Resume flag: skip the steps a previous, stopped run finished
+var resumeRun bool
+
+// Max duration flag: the longest a run may take, replacing its workflow's
+// max_duration
+var maxDuration time.Duration
+
+// interruptContext returns a context cancelled by the first Ctrl-C or
+// SIGTERM. Later signals get the default behaviour, so a second Ctrl-C
+// exits at once. Call stop when the run is over.
+func interruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			fmt.Fprintln(os.Stderr, "\nInterrupted: cancelling requests in flight (press Ctrl-C again to quit at once)")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// interruptTransport ties every HTTP request to a context, so provider
+// calls in flight are abandoned when the run is interrupted
+func interruptTransport(base http.RoundTripper, ctx context.Context) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t, ok := base.(*cancelTransport); ok {
+		base = t.base // Replace the context of an earlier run
+	}
+	return &cancelTransport{base: base, ctx: ctx}
+}
+
+type cancelTransport struct {
+	base http.RoundTripper
+	ctx  context.Context
+}
+
+func (t *cancelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	stop := context.AfterFunc(t.ctx, cancel)
+	release := func() {
+		stop()
+		cancel()
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// The body is read after RoundTrip returns, so the request's context
+	// lives until it is closed
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnClose runs release when the body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// runContext ties a run to ctx and to its max duration, so provider calls
+// and the HTTP requests made for them stop at the run's deadline. Call
+// cancel when the run is over.
+func runContext(ctx context.Context, proc *processor.Processor) (context.Context, context.CancelFunc) {
+	proc.SetMaxDuration(maxDuration)
+	ctx, cancel := processor.WithMaxDuration(ctx, proc.MaxDuration())
+	http.DefaultTransport = interruptTransport(http.DefaultTransport, ctx)
+	proc.SetContext(ctx)
+	return ctx, cancel
+}
+
+// reportStopped tells the user what finished before a run stopped and how
+// to resume it. It reports whether the run was interrupted, rather than
+// stopped by its max duration or an error.
+func reportStopped(out io.Writer, file string, proc *processor.Processor, runErr error) bool {
+	interrupted := errors.Is(runErr, processor.ErrInterrupted)
+	timedOut := errors.Is(runErr, processor.ErrMaxDuration)
+	if interrupted || timedOut {
+		if interrupted {
+			fmt.Fprintf(out, "\n%s was interrupted.\n", file)
+		} else {
+			fmt.Fprintf(out, "\n%s ran out of time after %s.\n", file, proc.MaxDuration())
+		}
+		if done := proc.CompletedSteps(); len(done) > 0 {
+			fmt.Fprintf(out, "Finished before stopping: %s\n", strings.Join(done, ", "))
+		} else {
+			fmt.Fprintln(out, "No steps finished.")
+		}
+	}
+	checkpoint := processor.DefaultCheckpointPath(file)
+	if _, err := os.Stat(checkpoint); err == nil {
+		fmt.Fprintf(out, "Progress saved to %s. Continue with:\n\n   comanda process --resume %s\n", checkpoint, file)
+	}
+	return interrupted
+}
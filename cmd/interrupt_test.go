@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestInterruptTransport(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &http.Client{Transport: interruptTransport(http.DefaultTransport, ctx)}
+
+	// Bodies stay readable after RoundTrip returns
+	resp, err := client.Get(server.URL + "/fast")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "ok" {
+		t.Fatalf("body = %q, %v", body, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Get(server.URL + "/slow")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("request in flight was not cancelled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request in flight was not cancelled")
+	}
+
+	if _, err := client.Get(server.URL + "/fast"); err == nil {
+		t.Error("request after the interrupt was sent")
+	}
+}
+
+func TestReportStopped(t *testing.T) {
+	proc := processor.NewProcessor(&processor.DSLConfig{}, nil, nil, false)
+	var out bytes.Buffer
+	if !reportStopped(&out, "review.yaml", proc, fmt.Errorf("%w: context canceled", processor.ErrInterrupted)) {
+		t.Error("reportStopped() = false for an interrupted run")
+	}
+	if !strings.Contains(out.String(), "review.yaml was interrupted") || !strings.Contains(out.String(), "No steps finished") {
+		t.Errorf("report = %q", out.String())
+	}
+
+	out.Reset()
+	if reportStopped(&out, "review.yaml", proc, fmt.Errorf("step failed")) {
+		t.Error("reportStopped() = true for a failed run")
+	}
+}
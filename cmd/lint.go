@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Lint command output format
+var lintFormat string
+
+// fileFinding is a lint finding tagged with the workflow file it was found in
+type fileFinding struct {
+	File string `json:"file"`
+	processor.LintFinding
+}
+
+// SARIF 2.1.0 log structure, limited to the fields code scanning tools read
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [files...]",
+	Short: "Check workflow files against best-practice rules",
+	Long: `Check workflow files for unreachable deferred steps, outputs that no step reads,
+chunked inputs without overlap, deprecated models, and sampling parameters set on
+reasoning models that ignore them. Output as text, JSON or SARIF for CI
+annotations. Exits non-zero if any warning is found.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch lintFormat {
+		case "text", "json", "sarif":
+		default:
+			return fmt.Errorf("unknown format '%s' (expected text, json or sarif)", lintFormat)
+		}
+
+		findings := []fileFinding{}
+		for _, file := range args {
+			yamlFile, dslConfig, err := readWorkflowFile(file)
+			if err != nil {
+				return err
+			}
+			lines := processor.StepLines(yamlFile)
+			proc := processor.NewProcessor(dslConfig, envConfig, &config.ServerConfig{Enabled: false}, verbose)
+			for _, finding := range proc.Lint() {
+				finding.Line = lines[finding.Step]
+				findings = append(findings, fileFinding{File: file, LintFinding: finding})
+			}
+		}
+
+		switch lintFormat {
+		case "json":
+			data, err := json.MarshalIndent(findings, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error encoding lint results: %w", err)
+			}
+			fmt.Println(string(data))
+		case "sarif":
+			data, err := json.MarshalIndent(buildSARIF(findings), "", "  ")
+			if err != nil {
+				return fmt.Errorf("error encoding SARIF log: %w", err)
+			}
+			fmt.Println(string(data))
+		default:
+			for _, f := range findings {
+				location := f.File
+				if f.Line > 0 {
+					location = fmt.Sprintf("%s:%d", f.File, f.Line)
+				}
+				fmt.Printf("%s: %s [%s] step '%s': %s\n", location, f.Level, f.Rule, f.Step, f.Message)
+			}
+		}
+
+		warnings := 0
+		for _, f := range findings {
+			if f.Level == processor.LintWarning {
+				warnings++
+			}
+		}
+		if warnings > 0 {
+			return fmt.Errorf("lint found %d warning(s)", warnings)
+		}
+		return nil
+	},
+}
+
+// buildSARIF converts lint findings into a SARIF log
+func buildSARIF(findings []fileFinding) sarifLog {
+	ruleIDs := make([]string, 0, len(processor.LintRules))
+	for id := range processor.LintRules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Strings(ruleIDs)
+	rules := make([]sarifRule, 0, len(ruleIDs))
+	for _, id := range ruleIDs {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: processor.LintRules[id]}})
+	}
+
+	results := make([]sarifResult, 0, len(findings))
+	for _, f := range findings {
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifact{URI: f.File}}}
+		if f.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+		}
+		results = append(results, sarifResult{
+			RuleID:    f.Rule,
+			Level:     f.Level,
+			Message:   sarifMessage{Text: fmt.Sprintf("step '%s': %s", f.Step, f.Message)},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "comanda",
+				InformationURI: "https://github.com/kris-hansen/comanda",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
+
+func init() {
+	lintCmd.Flags().StringVar(&lintFormat, "format", "text", "Output format: text, json or sarif")
+	lintCmd.ValidArgsFunction = completeWorkflowArgs(0)
+	rootCmd.AddCommand(lintCmd)
+}
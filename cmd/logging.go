@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/logfile"
+)
+
+// Log file flags
+var logFilePath string
+var logMaxSizeMB int
+var logMaxAge time.Duration
+var logMaxBackups int
+
+// Log file defaults when neither flags nor the env config set them
+const (
+	defaultLogMaxSizeMB  = 10
+	defaultLogMaxBackups = 5
+)
+
+// setupLogFile starts writing debug, verbose and run logs to the log file
+// set with --log-file or the env config's logging section. Flags take
+// precedence over the config.
+func setupLogFile(cmd *cobra.Command, args []string) error {
+	opts, path, err := logFileOptions(cmd.Flags().Changed, envConfig.Logging)
+	if err != nil || path == "" {
+		return err
+	}
+	w, err := logfile.Open(path, opts)
+	if err != nil {
+		return err
+	}
+	config.SetLogOutput(w)
+	// Standard library logging, used for errors and server request logs
+	log.SetOutput(config.RedactWriter(config.ConsoleAndLog(os.Stderr)))
+	config.WriteLog("[RUN] ", "%s %s (version %s)", cmd.CommandPath(), strings.Join(args, " "), getVersionFromFile())
+	return nil
+}
+
+// logFileOptions combines the log file flags with the env config
+func logFileOptions(changed func(string) bool, cfg *config.LoggingConfig) (logfile.Options, string, error) {
+	if cfg == nil {
+		cfg = &config.LoggingConfig{}
+	}
+	path := cfg.File
+	if changed("log-file") {
+		path = logFilePath
+	}
+
+	sizeMB := defaultLogMaxSizeMB
+	if cfg.MaxSizeMB > 0 {
+		sizeMB = cfg.MaxSizeMB
+	}
+	if changed("log-max-size") {
+		sizeMB = logMaxSizeMB
+	}
+
+	backups := defaultLogMaxBackups
+	if cfg.MaxBackups > 0 {
+		backups = cfg.MaxBackups
+	}
+	if changed("log-max-backups") {
+		backups = logMaxBackups
+	}
+
+	var age time.Duration
+	if cfg.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.MaxAge)
+		if err != nil {
+			return logfile.Options{}, "", fmt.Errorf("invalid logging max_age '%s': %w", cfg.MaxAge, err)
+		}
+		age = d
+	}
+	if changed("log-max-age") {
+		age = logMaxAge
+	}
+
+	if sizeMB < 0 || backups < 0 || age < 0 {
+		return logfile.Options{}, "", fmt.Errorf("log rotation settings can't be negative")
+	}
+	return logfile.Options{MaxSize: int64(sizeMB) << 20, MaxAge: age, MaxBackups: backups}, path, nil
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&logFilePath, "log-file", "", "Also write debug and run logs to this file, whatever the console verbosity")
+	flags.IntVar(&logMaxSizeMB, "log-max-size", defaultLogMaxSizeMB, "Rotate the log file when it reaches this many megabytes (0 never rotates)")
+	flags.DurationVar(&logMaxAge, "log-max-age", 0, "Remove rotated log files older than this, e.g. 168h (0 keeps them)")
+	flags.IntVar(&logMaxBackups, "log-max-backups", defaultLogMaxBackups, "Number of rotated log files to keep (0 keeps all)")
+}
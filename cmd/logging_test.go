@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestLogFileOptions(t *testing.T) {
+	none := func(string) bool { return false }
+
+	opts, path, err := logFileOptions(none, nil)
+	if err != nil || path != "" {
+		t.Fatalf("logFileOptions() without settings = %q, %v", path, err)
+	}
+	if opts.MaxSize != 10<<20 || opts.MaxBackups != 5 || opts.MaxAge != 0 {
+		t.Errorf("unexpected defaults: %+v", opts)
+	}
+
+	cfg := &config.LoggingConfig{File: "/var/log/comanda.log", MaxSizeMB: 50, MaxAge: "72h", MaxBackups: 3}
+	opts, path, err = logFileOptions(none, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/var/log/comanda.log" || opts.MaxSize != 50<<20 || opts.MaxAge != 72*time.Hour || opts.MaxBackups != 3 {
+		t.Errorf("config not applied: %q %+v", path, opts)
+	}
+
+	// Flags win over the config
+	logFilePath, logMaxSizeMB, logMaxAge = "run.log", 1, time.Hour
+	defer func() { logFilePath, logMaxSizeMB, logMaxAge = "", defaultLogMaxSizeMB, 0 }()
+	changed := func(name string) bool { return name != "log-max-backups" }
+	opts, path, err = logFileOptions(changed, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "run.log" || opts.MaxSize != 1<<20 || opts.MaxAge != time.Hour || opts.MaxBackups != 3 {
+		t.Errorf("flags not applied: %q %+v", path, opts)
+	}
+
+	if _, _, err := logFileOptions(none, &config.LoggingConfig{MaxAge: "a week"}); err == nil {
+		t.Error("expected an error for an invalid max_age")
+	}
+}
+
+func TestWriteLogIgnoresConsoleVerbosity(t *testing.T) {
+	var buf bytes.Buffer
+	config.SetLogOutput(&buf)
+	defer config.SetLogOutput(nil)
+
+	config.DebugLog("loaded %d providers", 2)
+	config.VerboseLog("using model %s", "gpt-4o")
+	out := buf.String()
+	if !strings.Contains(out, "[DEBUG] loaded 2 providers\n") || !strings.Contains(out, "[VERBOSE] using model gpt-4o\n") {
+		t.Errorf("log file missing messages:\n%s", out)
+	}
+
+	var console bytes.Buffer
+	config.ConsoleAndLog(&console).Write([]byte("step output\n"))
+	if console.String() != "step output\n" || !strings.HasSuffix(buf.String(), "step output\n") {
+		t.Errorf("ConsoleAndLog() did not write to both: console %q, log %q", console.String(), buf.String())
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	defer func() { verbosity, quiet, debug = 0, false, false }()
+	tests := []struct {
+		verbosity    int
+		quiet, debug bool
+		want         config.LogLevel
+	}{
+		{want: config.LevelInfo},
+		{quiet: true, want: config.LevelWarn},
+		{verbosity: 1, want: config.LevelDebug},
+		{debug: true, want: config.LevelDebug},
+		{verbosity: 2, want: config.LevelTrace},
+		{verbosity: 3, want: config.LevelTrace},
+	}
+	for _, tt := range tests {
+		verbosity, quiet, debug = tt.verbosity, tt.quiet, tt.debug
+		if got, err := logLevel(); err != nil || got != tt.want {
+			t.Errorf("logLevel() with -v×%d quiet=%v debug=%v = %v, %v; want %v", tt.verbosity, tt.quiet, tt.debug, got, err, tt.want)
+		}
+	}
+
+	verbosity, quiet = 1, true
+	if _, err := logLevel(); err == nil {
+		t.Error("expected an error for --quiet with -v")
+	}
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// Models command flags
+var modelsProvider string
+var modelsAliasRemove bool
+
+// modelEntry is one row of the models listing
+type modelEntry struct {
+	Name       string
+	Provider   string
+	Registered bool // Listed in the built-in registry
+	Configured bool // Added to the env config with 'comanda configure'
+	Local      bool // Pulled into the local Ollama install
+	Ready      bool // The provider has an API key, or the model is available locally
+}
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List, search and describe the models this install supports",
+	Long: `Show the models comanda knows about: the built-in registry, the models added
+with 'comanda configure', and models pulled into a local Ollama install, along
+with whether a configured provider can serve them.`,
+}
+
+var modelsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List known models",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printModelTable(os.Stdout, filterModels(knownModels(envConfig, localModels()), modelsProvider, ""))
+	},
+}
+
+var modelsSearchCmd = &cobra.Command{
+	Use:   "search <term>",
+	Short: "List known models whose name contains a term",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries := filterModels(knownModels(envConfig, localModels()), modelsProvider, args[0])
+		if len(entries) == 0 {
+			return fmt.Errorf("no models match '%s'", args[0])
+		}
+		return printModelTable(os.Stdout, entries)
+	},
+}
+
+var modelsDescribeCmd = &cobra.Command{
+	Use:   "describe <model>",
+	Short: "Show details for a model and which provider would serve it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		describeModel(os.Stdout, args[0], envConfig, localModels())
+		return nil
+	},
+}
+
+var modelsAliasCmd = &cobra.Command{
+	Use:   "alias [alias [model]]",
+	Short: "List, set or remove names that stand for models",
+	Long: `Give a model a short name that workflow steps can use in its place. An alias
+keeps workflows unchanged when the model behind it changes, such as when a
+new fine-tuned model replaces the last one.
+
+Examples:
+  comanda models alias                                  # List aliases
+  comanda models alias support-bot ft:gpt-4o-mini-2024-07-18:acme:support:abc123
+  comanda models alias support-bot --remove`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case modelsAliasRemove:
+			if len(args) != 1 {
+				return fmt.Errorf("--remove takes the alias to remove")
+			}
+			if !envConfig.RemoveModelAlias(args[0]) {
+				return fmt.Errorf("no model alias '%s'", args[0])
+			}
+			if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+				return fmt.Errorf("error saving configuration: %w", err)
+			}
+			fmt.Printf("Removed model alias '%s'\n", args[0])
+		case len(args) == 2:
+			if err := envConfig.SetModelAlias(args[0], args[1]); err != nil {
+				return err
+			}
+			if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+				return fmt.Errorf("error saving configuration: %w", err)
+			}
+			fmt.Printf("%s now stands for %s\n", args[0], args[1])
+		default:
+			return printAliasTable(os.Stdout, envConfig.ModelAliases, args)
+		}
+		return nil
+	},
+}
+
+// printAliasTable writes the aliases, or only the one named in args
+func printAliasTable(out io.Writer, aliases map[string]string, args []string) error {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		if len(args) == 0 || name == args[0] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		if len(args) > 0 {
+			return fmt.Errorf("no model alias '%s'", args[0])
+		}
+		fmt.Fprintln(out, "No model aliases. Add one with 'comanda models alias <alias> <model>'.")
+		return nil
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tMODEL")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", name, aliases[name])
+	}
+	return w.Flush()
+}
+
+// localModels returns the models pulled into Ollama, or nil when Ollama is
+// not reachable
+func localModels() []string {
+	ollamaModels, err := getOllamaModels()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(ollamaModels))
+	for _, m := range ollamaModels {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// knownModels merges the registry, the env config and local Ollama models
+// into one list sorted by provider and name
+func knownModels(cfg *config.EnvConfig, local []string) []modelEntry {
+	byKey := make(map[string]*modelEntry)
+	entry := func(provider, name string) *modelEntry {
+		key := provider + "/" + name
+		if e, ok := byKey[key]; ok {
+			return e
+		}
+		e := &modelEntry{Name: name, Provider: provider}
+		byKey[key] = e
+		return e
+	}
+
+	for provider, names := range models.GetRegistry().GetAllModels() {
+		for _, name := range names {
+			entry(provider, name).Registered = true
+		}
+	}
+	if cfg != nil {
+		for provider, providerConfig := range cfg.Providers {
+			if providerConfig == nil {
+				continue
+			}
+			for _, m := range providerConfig.Models {
+				entry(provider, m.Name).Configured = true
+			}
+		}
+	}
+	for _, name := range local {
+		entry("ollama", name).Local = true
+	}
+
+	entries := make([]modelEntry, 0, len(byKey))
+	for _, e := range byKey {
+		if e.Provider == "ollama" {
+			e.Ready = e.Local
+		} else if cfg != nil {
+			providerConfig, err := cfg.GetProviderConfig(e.Provider)
+			e.Ready = err == nil && providerConfig.APIKey != ""
+		}
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Provider != entries[j].Provider {
+			return entries[i].Provider < entries[j].Provider
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// filterModels keeps entries for a provider and whose name contains term;
+// empty filters match everything
+func filterModels(entries []modelEntry, provider, term string) []modelEntry {
+	var filtered []modelEntry
+	for _, e := range entries {
+		if provider != "" && !strings.EqualFold(e.Provider, provider) {
+			continue
+		}
+		if term != "" && !strings.Contains(strings.ToLower(e.Name), strings.ToLower(term)) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+// printModelTable writes entries as an aligned table
+func printModelTable(out io.Writer, entries []modelEntry) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tPROVIDER\tCONTEXT\tPRICE IN/OUT (PER 1M)\tSTATUS")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Name, e.Provider, formatContextWindow(e.Name), formatPrice(e.Name), modelStatus(e))
+	}
+	return w.Flush()
+}
+
+// modelStatus summarizes whether a model can be used right now
+func modelStatus(e modelEntry) string {
+	var status []string
+	switch {
+	case e.Ready && e.Provider == "ollama":
+		status = append(status, "local")
+	case e.Ready:
+		status = append(status, "ready")
+	case e.Provider == "ollama":
+		status = append(status, "not pulled")
+	default:
+		status = append(status, "no API key")
+	}
+	if e.Configured {
+		status = append(status, "configured")
+	}
+	if replacement, ok := models.DeprecatedReplacement(e.Name); ok {
+		status = append(status, "deprecated, use "+replacement)
+	}
+	return strings.Join(status, ", ")
+}
+
+// formatContextWindow renders a model's context window, e.g. 128k
+func formatContextWindow(modelName string) string {
+	window, ok := models.ContextWindow(modelName)
+	if !ok {
+		return "-"
+	}
+	if window >= 1000000 {
+		return fmt.Sprintf("%.1fM", float64(window)/1000000)
+	}
+	return fmt.Sprintf("%dk", window/1000)
+}
+
+// formatPrice renders a model's list price per million tokens
+func formatPrice(modelName string) string {
+	price, ok := models.PriceFor(modelName)
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("$%g / $%g", price.Input, price.Output)
+}
+
+// describeModel writes everything comanda knows about a model
+func describeModel(out io.Writer, modelName string, cfg *config.EnvConfig, local []string) {
+	alias := ""
+	if resolved := cfg.ResolveModel(modelName); resolved != modelName {
+		alias, modelName = modelName, resolved
+	}
+	var priority []string
+	if cfg != nil {
+		priority = cfg.ProviderPriority
+	}
+	providerName := "unknown"
+	if provider := models.DetectProviderWithPriority(modelName, priority); provider != nil {
+		providerName = provider.Name()
+	}
+
+	var entry modelEntry
+	for _, e := range knownModels(cfg, local) {
+		matches := e.Name == modelName || (e.Provider == "ollama" && strings.HasPrefix(e.Name, modelName+":"))
+		if matches && (entry.Name == "" || e.Provider == providerName) {
+			entry = e
+		}
+	}
+	if entry.Name == "" {
+		entry = modelEntry{Name: modelName, Provider: providerName}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Model:\t%s\n", modelName)
+	if alias != "" {
+		fmt.Fprintf(w, "Alias:\t%s\n", alias)
+	}
+	fmt.Fprintf(w, "Provider:\t%s\n", providerName)
+	fmt.Fprintf(w, "Context window:\t%s\n", formatContextWindow(modelName))
+	fmt.Fprintf(w, "Price in/out (per 1M tokens):\t%s\n", formatPrice(modelName))
+	fmt.Fprintf(w, "Reasoning model:\t%s\n", yesNo(models.IsReasoningModel(modelName)))
+	fmt.Fprintf(w, "In registry:\t%s\n", yesNo(entry.Registered || models.GetRegistry().ValidateModel(providerName, modelName)))
+	fmt.Fprintf(w, "Configured:\t%s\n", yesNo(entry.Configured))
+	if cfg != nil && entry.Configured {
+		if m, err := cfg.GetModelConfig(entry.Provider, modelName); err == nil && len(m.Modes) > 0 {
+			modes := make([]string, 0, len(m.Modes))
+			for _, mode := range m.Modes {
+				modes = append(modes, string(mode))
+			}
+			fmt.Fprintf(w, "Modes:\t%s\n", strings.Join(modes, ", "))
+		}
+	}
+	fmt.Fprintf(w, "Status:\t%s\n", modelStatus(entry))
+	w.Flush()
+
+	if !entry.Ready {
+		if providerName == "ollama" {
+			fmt.Fprintf(out, "\nRun 'ollama pull %s' to use this model locally.\n", modelName)
+		} else {
+			fmt.Fprintf(out, "\nRun 'comanda configure' to add an API key for %s.\n", providerName)
+		}
+	}
+}
+
+// yesNo renders a boolean for display
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func init() {
+	modelsListCmd.Flags().StringVar(&modelsProvider, "provider", "", "Only show models from this provider")
+	modelsSearchCmd.Flags().StringVar(&modelsProvider, "provider", "", "Only show models from this provider")
+	modelsAliasCmd.Flags().BoolVar(&modelsAliasRemove, "remove", false, "Remove the alias")
+	modelsCmd.AddCommand(modelsListCmd, modelsSearchCmd, modelsDescribeCmd, modelsAliasCmd)
+	rootCmd.AddCommand(modelsCmd)
+}
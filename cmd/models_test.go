@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestModelsListing(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models": [{"name": "llama3.2:latest"}]}`))
+	}))
+	defer ollama.Close()
+	t.Setenv("OLLAMA_HOST", ollama.URL)
+
+	cfg := &config.EnvConfig{Providers: map[string]*config.Provider{
+		"openai": {APIKey: "sk-test", Models: []config.Model{{Name: "gpt-4o", Modes: []config.ModelMode{config.TextMode, config.VisionMode}}}},
+	}}
+	local := localModels()
+	if len(local) != 1 || local[0] != "llama3.2:latest" {
+		t.Fatalf("localModels() = %v", local)
+	}
+
+	entries := knownModels(cfg, local)
+	status := make(map[string]string)
+	for _, e := range entries {
+		status[e.Provider+"/"+e.Name] = modelStatus(e)
+	}
+	for key, want := range map[string]string{
+		"openai/gpt-4o":                    "ready, configured",
+		"openai/gpt-5":                     "ready",
+		"anthropic/claude-opus-4-20250514": "no API key",
+		"ollama/llama3.2:latest":           "local",
+		"google/gemini-1.5-pro":            "no API key, deprecated, use gemini-2.5-pro",
+	} {
+		if status[key] != want {
+			t.Errorf("status of %s = %q, want %q", key, status[key], want)
+		}
+	}
+
+	filtered := filterModels(entries, "Google", "flash")
+	for _, e := range filtered {
+		if e.Provider != "google" || !strings.Contains(e.Name, "flash") {
+			t.Errorf("filterModels() kept %v", e)
+		}
+	}
+	if len(filtered) == 0 {
+		t.Error("filterModels() returned nothing")
+	}
+
+	var table bytes.Buffer
+	printModelTable(&table, filterModels(entries, "openai", "gpt-4o"))
+	if !strings.Contains(table.String(), "128k") || !strings.Contains(table.String(), "$2.5 / $10") {
+		t.Errorf("table missing context window or price:\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	describeModel(&out, "gpt-4o", cfg, local)
+	for _, want := range []string{"openai", "128k", "text, vision", "ready, configured"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("describe gpt-4o missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	describeModel(&out, "llama3.2", cfg, local)
+	if !strings.Contains(out.String(), "ollama") || !strings.Contains(out.String(), "local") {
+		t.Errorf("describe llama3.2:\n%s", out.String())
+	}
+
+	out.Reset()
+	describeModel(&out, "claude-3-5-haiku-latest", cfg, local)
+	if !strings.Contains(out.String(), "comanda configure") {
+		t.Errorf("describe without API key should suggest configure:\n%s", out.String())
+	}
+
+	cfg.ModelAliases = map[string]string{"writer": "gpt-4o"}
+	out.Reset()
+	describeModel(&out, "writer", cfg, local)
+	if !strings.Contains(out.String(), "Model:                         gpt-4o\nAlias:                         writer") {
+		t.Errorf("describe of an alias:\n%s", out.String())
+	}
+	out.Reset()
+	if err := printAliasTable(&out, cfg.ModelAliases, nil); err != nil || !strings.Contains(out.String(), "writer  gpt-4o") {
+		t.Errorf("printAliasTable() = %v:\n%s", err, out.String())
+	}
+	if err := printAliasTable(&out, cfg.ModelAliases, []string{"reader"}); err == nil {
+		t.Error("printAliasTable() of an unknown alias succeeded")
+	}
+}
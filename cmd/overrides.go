@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Per-invocation override flags
+var providerKeyFlags []string
+var modelDefaultFlag string
+var profileFlag string
+
+// applyConfigOverrides applies the profile selected with --profile or
+// COMANDA_PROFILE, then the COMANDA_<PROVIDER>_KEY and COMANDA_DEFAULT_MODEL
+// environment variables, then the --provider-key and --model-default flags,
+// to cfg. Overrides are never written to the env file.
+func applyConfigOverrides(cfg *config.EnvConfig) error {
+	overrides, err := configOverrides(os.Getenv, providerKeyFlags, modelDefaultFlag)
+	if err != nil {
+		return err
+	}
+	if profile := selectedProfile(os.Getenv, profileFlag); profile != "" {
+		if err := cfg.UseProfile(profile); err != nil {
+			return err
+		}
+	}
+	cfg.ApplyOverrides(overrides)
+	return nil
+}
+
+// selectedProfile returns the profile named by the flag, or else by
+// COMANDA_PROFILE
+func selectedProfile(getenv func(string) string, flag string) string {
+	if flag != "" {
+		return flag
+	}
+	return getenv(config.ProfileEnv)
+}
+
+// configOverrides combines the environment variables with the flags, which
+// take precedence
+func configOverrides(getenv func(string) string, keyPairs []string, defaultModel string) (config.Overrides, error) {
+	keys, err := config.ParseProviderKeys(keyPairs)
+	if err != nil {
+		return config.Overrides{}, err
+	}
+	flags := config.Overrides{ProviderKeys: keys, DefaultModel: defaultModel}
+	return config.OverridesFromEnv(getenv).Merge(flags), nil
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringArrayVar(&providerKeyFlags, "provider-key", nil, "Use this API key for a provider for this run only, as provider=key (repeatable; prefer COMANDA_<PROVIDER>_KEY, which stays out of the process list)")
+	flags.StringVar(&modelDefaultFlag, "model-default", "", "Use this default generation model for this run only (or set COMANDA_DEFAULT_MODEL)")
+	flags.StringVar(&profileFlag, "profile", "", "Use this profile of the env config, such as dev or prod (or set COMANDA_PROFILE)")
+}
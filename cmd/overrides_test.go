@@ -0,0 +1,30 @@
+package cmd
+
+import "testing"
+
+func TestConfigOverrides(t *testing.T) {
+	env := map[string]string{"COMANDA_OPENAI_KEY": "sk-env", "COMANDA_DEFAULT_MODEL": "gpt-4o"}
+	getenv := func(name string) string { return env[name] }
+
+	o, err := configOverrides(getenv, []string{"openai=sk-flag", "deepseek=ds-flag"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.ProviderKeys["openai"] != "sk-flag" || o.ProviderKeys["deepseek"] != "ds-flag" || o.DefaultModel != "gpt-4o" {
+		t.Errorf("configOverrides() = %+v", o)
+	}
+
+	if _, err := configOverrides(getenv, []string{"mistral=key"}, ""); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+}
+
+func TestSelectedProfile(t *testing.T) {
+	getenv := func(name string) string { return map[string]string{"COMANDA_PROFILE": "staging"}[name] }
+	if got := selectedProfile(getenv, "prod"); got != "prod" {
+		t.Errorf("flag: selectedProfile() = %q", got)
+	}
+	if got := selectedProfile(getenv, ""); got != "staging" {
+		t.Errorf("environment: selectedProfile() = %q", got)
+	}
+}
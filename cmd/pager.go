@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// No-pager flag: never send long responses through the pager
+var noPager bool
+
+// pagerCommand returns the pager for long responses, or an empty string
+// when paging is off
+func pagerCommand() string {
+	if noPager {
+		return ""
+	}
+	return envConfig.OutputSettings().PagerCommand(os.Getenv)
+}
+
+// needsPager reports whether text is too long to read on a terminal of the
+// given height without scrolling
+func needsPager(text string, height int) bool {
+	return height > 0 && strings.Count(text, "\n") >= height-1
+}
+
+// writePaged writes text to out, through the pager when out is a terminal
+// the text does not fit on. It falls back to writing directly when the
+// pager cannot be started.
+func writePaged(out io.Writer, fd int, pager, text string) {
+	if pager != "" && fd >= 0 && term.IsTerminal(fd) {
+		if _, height, err := term.GetSize(fd); err == nil && needsPager(text, height) {
+			if err := runPager(out, pager, text); err == nil {
+				return
+			}
+		}
+	}
+	fmt.Fprint(out, text)
+}
+
+// runPager pipes text through the pager command
+func runPager(out io.Writer, pager, text string) error {
+	fields := strings.Fields(pager)
+	c := exec.Command(fields[0], fields[1:]...)
+	c.Stdin = strings.NewReader(text)
+	c.Stdout = out
+	c.Stderr = os.Stderr
+	if err := c.Start(); err != nil {
+		return err
+	}
+	c.Wait() // The text has been shown even if the pager exits with an error
+	return nil
+}
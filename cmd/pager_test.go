@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNeedsPager(t *testing.T) {
+	short := strings.Repeat("line\n", 10)
+	long := strings.Repeat("line\n", 40)
+	if needsPager(short, 24) {
+		t.Error("needsPager() = true for text that fits")
+	}
+	if !needsPager(long, 24) {
+		t.Error("needsPager() = false for text longer than the terminal")
+	}
+	if needsPager(long, 0) {
+		t.Error("needsPager() = true with an unknown terminal height")
+	}
+}
+
+func TestWritePagedNotTerminal(t *testing.T) {
+	var out bytes.Buffer
+	text := strings.Repeat("line\n", 100)
+	writePaged(&out, -1, "less", text)
+	if out.String() != text {
+		t.Errorf("writePaged() wrote %d bytes, want the text unchanged", out.Len())
+	}
+}
@@ -1,28 +1,46 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"log"
+	"net/http"
 	"os"
-	"strings"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"gopkg.in/yaml.v3"
 
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/processor"
 )
 
 // Runtime directory flag
 var runtimeDir string
 
+// Changed-only flag: skip inputs whose contents match the last run
+var changedOnly bool
+
+// Plain flag: print plain output instead of the live progress view
+var plainOutput bool
+
+// Debugger flag: pause before each prompt to review, edit, skip or fake it
+var stepDebugger bool
+
+// Variant flag: step name -> prompt variant to run instead of picking one
+var processVariants map[string]string
+
 var processCmd = &cobra.Command{
-	Use:   "process [files...]",
+	Use:   "process [files...] [-- name=value...]",
 	Short: "Process YAML workflow files",
-	Long:  `Process one or more workflow files and execute the specified actions.`,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Process one or more workflow files and execute the specified actions.
+
+Values for the parameters a workflow declares in its params section follow
+a "--" as name=value pairs. They are checked before anything runs.`,
+	Example: `  comanda process review.yaml
+  comanda process review.yaml -- repo=comanda pr=123`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		// The environment configuration is already loaded in rootCmd's PersistentPreRunE
 		// and available in the package-level envConfig variable
@@ -31,28 +49,45 @@ var processCmd = &cobra.Command{
 			fmt.Println("[DEBUG] Using centralized environment configuration")
 		}
 
-		// Check if there's data on STDIN
-		stat, _ := os.Stdin.Stat()
-		var stdinData string
-		if (stat.Mode() & os.ModeCharDevice) == 0 {
-			// Read from STDIN
-			reader := bufio.NewReader(os.Stdin)
-			var builder strings.Builder
-			for {
-				input, err := reader.ReadString('\n')
-				if err != nil && err != io.EOF {
-					log.Fatalf("Error reading from STDIN: %v", err)
-				}
-				builder.WriteString(input)
-				if err == io.EOF {
-					break
-				}
+		args, params, err := splitParamArgs(cmd, args)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if err := checkSummaryFormat(); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		stdinData, err := readPipedStdin()
+		if err != nil {
+			log.Fatalf("Error reading from STDIN: %v", err)
+		}
+		defer stdinData.remove()
+
+		cache, err := responseCache()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		var debugger *terminalDebugger
+		if stepDebugger {
+			if debugger, err = newTerminalDebugger(); err != nil {
+				log.Fatalf("Error starting debugger: %v", err)
 			}
-			stdinData = builder.String()
 		}
 
+		useTUI := !plainOutput && !verbose && !quiet && !stepDebugger && term.IsTerminal(int(os.Stdout.Fd()))
+
+		// Ctrl-C cancels requests in flight and stops the run after saving
+		// a checkpoint
+		ctx, stop := interruptContext()
+		defer stop()
+		http.DefaultTransport = interruptTransport(http.DefaultTransport, ctx)
+		interrupted := false
+
 		for _, file := range args {
-			fmt.Printf("\nProcessing workflow file: %s\n", file)
+			if !useTUI {
+				config.InfoLog("\nProcessing workflow file: %s", file)
+			}
 
 			// Read YAML file
 			if verbose {
@@ -63,6 +98,10 @@ var processCmd = &cobra.Command{
 				log.Printf("Error reading YAML file %s: %v\n", file, err)
 				continue
 			}
+			if yamlFile, err = processor.BindParams(yamlFile, params); err != nil {
+				log.Printf("Error in %s: %v\n", file, err)
+				continue
+			}
 
 			// Unmarshal YAML into the DSLConfig struct, which will use the custom unmarshaler
 			var dslConfig processor.DSLConfig
@@ -82,76 +121,251 @@ var processCmd = &cobra.Command{
 			}
 			proc := processor.NewProcessor(&dslConfig, envConfig, serverConfig, verbose, runtimeDir)
 
-			// If we have STDIN data, set it as initial output
-			if stdinData != "" {
-				proc.SetLastOutput(stdinData)
+			_, cancelRun := runContext(ctx, proc)
+			defer cancelRun()
+			proc.SetResponseCache(cache)
+			if err := proc.EnableCheckpoint(processor.DefaultCheckpointPath(file), resumeRun); err != nil {
+				log.Printf("Error in %s: %v\n", file, err)
+				continue
 			}
 
-			// Print configuration summary before processing
-			fmt.Println("\nConfiguration:")
-
-			// Print parallel steps if any
-			for groupName, parallelSteps := range dslConfig.ParallelSteps {
-				fmt.Printf("\nParallel Process Group: %s\n", groupName)
-				for _, step := range parallelSteps {
-					fmt.Printf("\n  Parallel Step: %s\n", step.Name)
-					inputs := proc.NormalizeStringSlice(step.Config.Input)
-					if len(inputs) > 0 && inputs[0] != "NA" {
-						fmt.Printf("  - Input: %v\n", inputs)
-					}
-					fmt.Printf("  - Model: %v\n", proc.NormalizeStringSlice(step.Config.Model))
+			if changedOnly {
+				if err := proc.EnableChangedOnly(processor.DefaultStatePath(file)); err != nil {
+					log.Printf("Error loading input state for %s: %v\n", file, err)
+					continue
+				}
+			}
 
-					// Display instructions for openai-responses type steps, otherwise display action
-					if step.Config.Type == "openai-responses" && step.Config.Instructions != "" {
-						fmt.Printf("  - Instructions: %v\n", step.Config.Instructions)
-					} else {
-						fmt.Printf("  - Action: %v\n", proc.NormalizeStringSlice(step.Config.Action))
-					}
+			if debugger != nil {
+				proc.SetDebugger(debugger)
+			}
 
-					fmt.Printf("  - Output: %v\n", proc.NormalizeStringSlice(step.Config.Output))
-					nextActions := proc.NormalizeStringSlice(step.Config.NextAction)
-					if len(nextActions) > 0 {
-						fmt.Printf("  - Next Action: %v\n", nextActions)
-					}
+			// Approval steps ask on the terminal, which the progress view
+			// would take over
+			fileTUI := useTUI
+			if dslConfig.HasApprovalSteps() {
+				if approver, err := newTerminalApprover(); err == nil {
+					proc.SetApprover(approver.Approve)
+					fileTUI = false
 				}
 			}
+			for step, variant := range processVariants {
+				proc.SetVariant(step, variant)
+			}
 
-			// Print sequential steps
-			for _, step := range dslConfig.Steps {
-				fmt.Printf("\nStep: %s\n", step.Name)
-				inputs := proc.NormalizeStringSlice(step.Config.Input)
-				if len(inputs) > 0 && inputs[0] != "NA" {
-					fmt.Printf("- Input: %v\n", inputs)
-				}
-				fmt.Printf("- Model: %v\n", proc.NormalizeStringSlice(step.Config.Model))
+			// If we have STDIN data, set it as initial output
+			stdinData.apply(proc)
 
-				// Display instructions for openai-responses type steps, otherwise display action
-				if step.Config.Type == "openai-responses" && step.Config.Instructions != "" {
-					fmt.Printf("- Instructions: %v\n", step.Config.Instructions)
-				} else {
-					fmt.Printf("- Action: %v\n", proc.NormalizeStringSlice(step.Config.Action))
-				}
+			// Record the run in the history store
+			workflowPath, err := filepath.Abs(file)
+			if err != nil {
+				workflowPath = file
+			}
+			finishRun := recordRun(workflowPath, proc)
 
-				fmt.Printf("- Output: %v\n", proc.NormalizeStringSlice(step.Config.Output))
-				nextActions := proc.NormalizeStringSlice(step.Config.NextAction)
-				if len(nextActions) > 0 {
-					fmt.Printf("- Next Action: %v\n", nextActions)
+			// Show the live progress view on a terminal, or the configuration
+			// summary followed by plain output
+			if fileTUI {
+				view := newProgressTUI(file, &dslConfig, os.Stdout, int(os.Stdout.Fd()))
+				view.pager = pagerCommand()
+				proc.SetProgressWriter(view)
+				proc.DisableSpinner()
+				if err := view.Start(); err != nil {
+					log.Printf("Error starting progress view: %v\n", err)
+					continue
 				}
+				err := proc.Process()
+				view.Stop(err)
+				finishRun(err)
+				printSummary(os.Stdout, file, proc)
+				if err != nil {
+					log.Printf("Error processing workflow file %s: %v\n", file, err)
+					if interrupted = reportStopped(os.Stderr, file, proc, err); interrupted {
+						break
+					}
+					continue
+				}
+				copyFinalOutput(proc.LastOutput())
+				continue
+			}
+			if quiet {
+				proc.DisableSpinner()
+			} else {
+				printConfiguration(proc, &dslConfig)
+				proc.SetProgressWriter(newProgressPrinter(os.Stdout))
+				proc.DisableSpinner()
 			}
-			fmt.Println()
 
 			// Run processor
-			if err := proc.Process(); err != nil {
+			err = proc.Process()
+			finishRun(err)
+			printSummary(os.Stdout, file, proc)
+			if err != nil {
 				log.Printf("Error processing workflow file %s: %v\n", file, err)
+				if interrupted = reportStopped(os.Stderr, file, proc, err); interrupted {
+					break
+				}
 				continue
 			}
+			copyFinalOutput(proc.LastOutput())
+		}
+		if interrupted {
+			stop()
+			os.Exit(130) // The conventional status for a run stopped by Ctrl-C
 		}
 	},
 }
 
+// splitParamArgs separates workflow files from the name=value parameters
+// given after "--"
+func splitParamArgs(cmd *cobra.Command, args []string) ([]string, map[string]string, error) {
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 {
+		return args, nil, nil
+	}
+	if dash == 0 {
+		return nil, nil, fmt.Errorf("a workflow file is required before --")
+	}
+	params, err := processor.ParseParamArgs(args[dash:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return args[:dash], params, nil
+}
+
+// printConfiguration prints each step's inputs, model, action and outputs
+func printConfiguration(proc *processor.Processor, dslConfig *processor.DSLConfig) {
+	fmt.Println("\nConfiguration:")
+
+	// Print parallel steps if any
+	for groupName, parallelSteps := range dslConfig.ParallelSteps {
+		fmt.Printf("\nParallel Process Group: %s\n", groupName)
+		for _, step := range parallelSteps {
+			fmt.Printf("\n  Parallel Step: %s\n", step.Name)
+			inputs := proc.NormalizeStringSlice(step.Config.Input)
+			if len(inputs) > 0 && inputs[0] != "NA" {
+				fmt.Printf("  - Input: %v\n", inputs)
+			}
+			fmt.Printf("  - Model: %v\n", proc.NormalizeStringSlice(step.Config.Model))
+
+			// Display instructions for openai-responses type steps, otherwise display action
+			if step.Config.Type == "openai-responses" && step.Config.Instructions != "" {
+				fmt.Printf("  - Instructions: %v\n", step.Config.Instructions)
+			} else {
+				fmt.Printf("  - Action: %v\n", proc.NormalizeStringSlice(step.Config.Action))
+			}
+
+			fmt.Printf("  - Output: %v\n", proc.NormalizeStringSlice(step.Config.Output))
+			nextActions := proc.NormalizeStringSlice(step.Config.NextAction)
+			if len(nextActions) > 0 {
+				fmt.Printf("  - Next Action: %v\n", nextActions)
+			}
+		}
+	}
+
+	// Print sequential steps
+	for _, step := range dslConfig.Steps {
+		fmt.Printf("\nStep: %s\n", step.Name)
+		inputs := proc.NormalizeStringSlice(step.Config.Input)
+		if len(inputs) > 0 && inputs[0] != "NA" {
+			fmt.Printf("- Input: %v\n", inputs)
+		}
+		fmt.Printf("- Model: %v\n", proc.NormalizeStringSlice(step.Config.Model))
+
+		// Display instructions for openai-responses type steps, otherwise display action
+		if step.Config.Type == "openai-responses" && step.Config.Instructions != "" {
+			fmt.Printf("- Instructions: %v\n", step.Config.Instructions)
+		} else {
+			fmt.Printf("- Action: %v\n", proc.NormalizeStringSlice(step.Config.Action))
+		}
+
+		fmt.Printf("- Output: %v\n", proc.NormalizeStringSlice(step.Config.Output))
+		nextActions := proc.NormalizeStringSlice(step.Config.NextAction)
+		if len(nextActions) > 0 {
+			fmt.Printf("- Next Action: %v\n", nextActions)
+		}
+	}
+	fmt.Println()
+}
+
+// stdinMemoryLimit is the most piped data kept in memory; more is written
+// to a temporary file so inputs such as multi-gigabyte logs can be chunked
+const stdinMemoryLimit = 8 << 20
+
+// pipedStdin is the data piped to comanda
+type pipedStdin struct {
+	data string // The data, when it fits in memory
+	path string // Temporary file holding the data otherwise
+}
+
+// empty reports whether nothing was piped
+func (s pipedStdin) empty() bool {
+	return s.data == "" && s.path == ""
+}
+
+// apply makes the piped data the processor's initial STDIN
+func (s pipedStdin) apply(proc *processor.Processor) {
+	if s.path != "" {
+		proc.SetLastOutputFile(s.path)
+	} else if s.data != "" {
+		proc.SetLastOutput(s.data)
+	}
+}
+
+// remove deletes the temporary file, if any
+func (s pipedStdin) remove() {
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+}
+
+// readPipedStdin returns the data piped to comanda, which is empty when
+// STDIN is a terminal. The caller removes it when done.
+func readPipedStdin() (pipedStdin, error) {
+	stat, _ := os.Stdin.Stat()
+	if (stat.Mode() & os.ModeCharDevice) != 0 {
+		return pipedStdin{}, nil
+	}
+	data, path, err := fileutil.Spill(os.Stdin, stdinMemoryLimit, config.TempDir(), "comanda-stdin-*.txt")
+	if err != nil {
+		return pipedStdin{}, err
+	}
+	return pipedStdin{data: string(data), path: path}, nil
+}
+
 func init() {
+	processCmd.ValidArgsFunction = completeWorkflowArgs(0)
 	rootCmd.AddCommand(processCmd)
 
 	// Add runtime directory flag
 	processCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory for file operations (relative to data directory)")
+
+	// Add changed-only flag
+	processCmd.Flags().BoolVar(&changedOnly, "changed-only", false, "Only process inputs whose contents changed since the last run")
+
+	// Add history flag
+	processCmd.Flags().BoolVar(&noHistory, "no-history", false, "Do not record this run in the run history")
+	processCmd.Flags().BoolVar(&noCache, "no-cache", false, "Call the models even for prompts the response cache has answers to")
+
+	// Add plain output flag
+	processCmd.Flags().BoolVar(&plainOutput, "plain", false, "Print plain output instead of the live progress view")
+
+	// Add debugger flag (--debug already enables debug logging)
+	processCmd.Flags().BoolVar(&stepDebugger, "debugger", false, "Pause before each prompt to review, edit, skip or fake it")
+
+	// Add max duration flag
+	processCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Stop each run that takes longer than this, such as 30m (overrides max_duration)")
+
+	// Add resume flag
+	processCmd.Flags().BoolVar(&resumeRun, "resume", false, "Skip the steps an interrupted or failed run finished, using its checkpoint")
+
+	// Add clipboard and pager flags
+	processCmd.Flags().BoolVar(&copyOutput, "copy", false, "Copy the final output to the system clipboard")
+	processCmd.Flags().BoolVar(&noPager, "no-pager", false, "Print long responses without the pager")
+
+	// Add variant flag
+	processCmd.Flags().StringToStringVar(&processVariants, "variant", nil, "Run this prompt variant of a step, as step=variant (repeatable)")
+
+	// Add summary flag
+	processCmd.Flags().StringVar(&summaryFormat, "summary", summaryTable, "Print a per-step summary after each run: table, json or none")
 }
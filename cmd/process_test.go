@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSplitParamArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantFiles int
+		want      map[string]string
+		wantErr   bool
+	}{
+		{"no params", []string{"a.yaml", "b.yaml"}, 2, nil, false},
+		{"params", []string{"review.yaml", "--", "repo=foo", "pr=123"}, 1, map[string]string{"repo": "foo", "pr": "123"}, false},
+		{"no file", []string{"--", "repo=foo"}, 0, nil, true},
+		{"bad param", []string{"review.yaml", "--", "repo"}, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			files, params, err := splitParamArgs(cmd, cmd.Flags().Args())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitParamArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(files) != tt.wantFiles {
+				t.Errorf("files = %v, want %d", files, tt.wantFiles)
+			}
+			for name, value := range tt.want {
+				if params[name] != value {
+					t.Errorf("params[%s] = %q, want %q", name, params[name], value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// progressPrinter prints one line per step, chunk and retry of a workflow
+// run, followed by each response written to STDOUT. It is the progress
+// display when the live view is not used, such as with --plain or when
+// output is redirected. It implements processor.ProgressWriter.
+type progressPrinter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// newProgressPrinter creates a progress printer writing to out
+func newProgressPrinter(out io.Writer) *progressPrinter {
+	return &progressPrinter{out: out}
+}
+
+// WriteProgress prints a processor progress event
+func (p *progressPrinter) WriteProgress(update processor.ProgressUpdate) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var name string
+	if update.Step != nil {
+		name = update.Step.Name
+	}
+	switch update.Type {
+	case processor.ProgressStepStarted:
+		if update.IsParallel {
+			fmt.Fprintf(p.out, "Processing parallel step: %s (group %s)\n", name, update.ParallelID)
+		} else {
+			fmt.Fprintf(p.out, "Processing step: %s\n", name)
+		}
+	case processor.ProgressStepFinished:
+		var took string
+		if m := update.PerformanceMetrics; m != nil {
+			took = " in " + formatMillis(m.TotalProcessingTime)
+		}
+		if update.Error != nil {
+			fmt.Fprintf(p.out, "Step %s failed%s\n", name, took)
+		} else {
+			fmt.Fprintf(p.out, "Completed step: %s%s\n", name, took)
+		}
+	case processor.ProgressStep, processor.ProgressParallelStep:
+		if strings.HasPrefix(update.Message, "Skipping") || strings.HasPrefix(update.Message, "Skipped") {
+			fmt.Fprintln(p.out, update.Message)
+		}
+	case processor.ProgressChunk:
+		fmt.Fprintf(p.out, "  %s: chunk %d/%d\n", name, update.Chunk, update.Chunks)
+	case processor.ProgressRetry:
+		if name == "" {
+			name = update.Provider // Retries made while parallel steps run are not attributed to one
+		}
+		fmt.Fprintf(p.out, "  %s: %s\n", name, update.Message)
+	case processor.ProgressOutput:
+		var model string
+		if update.Step != nil {
+			model = update.Step.Model
+		}
+		fmt.Fprintf(p.out, "\nResponse from %s:\n%s\n", model, strings.TrimRight(update.Stdout, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestProgressPrinter(t *testing.T) {
+	var out bytes.Buffer
+	printer := newProgressPrinter(&out)
+	review := &processor.StepInfo{Name: "review", Model: "gpt-4o"}
+
+	for _, update := range []processor.ProgressUpdate{
+		{Type: processor.ProgressStep, Message: "Processing step 1/1: review", Step: review},
+		{Type: processor.ProgressStepStarted, Step: review},
+		{Type: processor.ProgressChunk, Step: review, Chunk: 1, Chunks: 2},
+		{Type: processor.ProgressRetry, Provider: "openai", Message: "Rate limit detected, retrying in 1s (attempt 1/5)..."},
+		{Type: processor.ProgressDelta, Step: review, Delta: "partial"},
+		{Type: processor.ProgressOutput, Step: &processor.StepInfo{Model: "gpt-4o"}, Stdout: "looks good\n"},
+		{Type: processor.ProgressStepFinished, Step: review, PerformanceMetrics: &processor.PerformanceMetrics{TotalProcessingTime: 1200}},
+		{Type: processor.ProgressStepFinished, Step: review, Error: errors.New("model unavailable")},
+	} {
+		printer.WriteProgress(update)
+	}
+
+	want := "Processing step: review\n" +
+		"  review: chunk 1/2\n" +
+		"  openai: Rate limit detected, retrying in 1s (attempt 1/5)...\n" +
+		"\nResponse from gpt-4o:\nlooks good\n" +
+		"Completed step: review in 1.2s\n" +
+		"Step review failed\n"
+	if got := out.String(); got != want {
+		t.Errorf("printed:\n%q\nwant:\n%q", got, want)
+	}
+}
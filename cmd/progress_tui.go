@@ -0,0 +1,466 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// tuiPaneLines is the number of output lines kept visible under the step list
+const tuiPaneLines = 8
+
+// tuiFrames are the spinner frames shown next to running steps
+var tuiFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// stepState is the status of a step in the progress view
+type stepState int
+
+const (
+	stepPending stepState = iota
+	stepRunning
+	stepDone
+	stepSkipped
+	stepFailed
+)
+
+// tuiStep is one row of the progress view
+type tuiStep struct {
+	name             string
+	model            string
+	parallel         bool
+	state            stepState
+	started          time.Time
+	finished         time.Time
+	promptTokens     int
+	completionTokens int
+	cost             float64
+	priced           bool
+	chunk            int // Chunk being processed, from 1
+	chunks           int
+	retries          int
+}
+
+// progressTUI draws a live view of a workflow run: per-step status,
+// elapsed time, token and cost counters, and the most recent output.
+// It implements processor.ProgressWriter.
+type progressTUI struct {
+	mu        sync.Mutex
+	out       io.Writer
+	fd        int // Terminal file descriptor used to size the view, -1 if none
+	title     string
+	steps     []*tuiStep
+	byName    map[string]*tuiStep
+	pane      []string // Recent output lines
+	streaming bool     // Whether the last pane line is a response still streaming
+	outputs   []string // Complete STDOUT responses, printed when the run ends
+	pager     string   // Pager for responses longer than the terminal, if any
+	errMsg    string
+	started   time.Time
+	frame     int
+	drawn     int // Lines drawn by the previous render
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	stdout   *os.File // The real STDOUT while it is captured
+	pipe     *os.File
+	captured chan struct{}
+}
+
+// newProgressTUI creates a progress view listing the workflow's parallel and
+// sequential steps. Deferred steps are added when they start.
+func newProgressTUI(title string, cfg *processor.DSLConfig, out io.Writer, fd int) *progressTUI {
+	t := &progressTUI{
+		out:     out,
+		fd:      fd,
+		title:   title,
+		byName:  make(map[string]*tuiStep),
+		started: time.Now(),
+	}
+
+	groups := make([]string, 0, len(cfg.ParallelSteps))
+	for group := range cfg.ParallelSteps {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		for _, step := range cfg.ParallelSteps[group] {
+			t.step(step.Name, stepModel(step.Config)).parallel = true
+		}
+	}
+	for _, step := range cfg.Steps {
+		t.step(step.Name, stepModel(step.Config))
+	}
+	return t
+}
+
+// stepModel returns the model a step runs, or an empty string for steps that
+// do not call a model directly
+func stepModel(cfg processor.StepConfig) string {
+	model := cfg.Model
+	if cfg.Generate != nil {
+		model = cfg.Generate.Model
+	}
+	switch v := model.(type) {
+	case string:
+		if v == "NA" {
+			return ""
+		}
+		return v
+	case []interface{}:
+		names := make([]string, 0, len(v))
+		for _, name := range v {
+			names = append(names, fmt.Sprintf("%v", name))
+		}
+		return strings.Join(names, ",")
+	}
+	return ""
+}
+
+// step returns the row for a step, adding it if it is not listed yet
+func (t *progressTUI) step(name, model string) *tuiStep {
+	if s, ok := t.byName[name]; ok {
+		return s
+	}
+	s := &tuiStep{name: name, model: model}
+	t.steps = append(t.steps, s)
+	t.byName[name] = s
+	return s
+}
+
+// WriteProgress updates the view from a processor progress event
+func (t *progressTUI) WriteProgress(update processor.ProgressUpdate) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	switch update.Type {
+	case processor.ProgressStepStarted:
+		s := t.updateStep(update.Step)
+		if s == nil || s.state == stepSkipped {
+			return nil
+		}
+		s.state = stepRunning
+		s.started = now
+	case processor.ProgressStepFinished:
+		s := t.updateStep(update.Step)
+		if s == nil {
+			return nil
+		}
+		if s.started.IsZero() {
+			s.started = now
+		}
+		s.finished = now
+		switch {
+		case update.Error != nil:
+			s.state = stepFailed
+		case s.state != stepSkipped:
+			s.state = stepDone
+		}
+		if m := update.PerformanceMetrics; m != nil {
+			s.promptTokens = m.PromptTokens
+			s.completionTokens = m.CompletionTokens
+			s.cost, s.priced = models.EstimateCost(s.model, s.promptTokens, s.completionTokens)
+		}
+	case processor.ProgressStep, processor.ProgressParallelStep:
+		// Steps skipped for unchanged inputs or by a condition say so in a
+		// message before they finish
+		if s := t.updateStep(update.Step); s != nil && (strings.HasPrefix(update.Message, "Skipping") || strings.HasPrefix(update.Message, "Skipped")) {
+			s.state = stepSkipped
+		}
+	case processor.ProgressChunk:
+		if s := t.updateStep(update.Step); s != nil {
+			s.chunk, s.chunks = update.Chunk, update.Chunks
+		}
+	case processor.ProgressRetry:
+		if s := t.updateStep(update.Step); s != nil {
+			s.retries++
+		}
+		t.appendPane(update.Message)
+	case processor.ProgressDelta:
+		t.appendDelta(update.Delta)
+	case processor.ProgressError:
+		if update.Error != nil {
+			t.errMsg = config.RedactError(update.Error)
+		}
+		t.finishRunning(stepFailed, now, true)
+	case processor.ProgressOutput:
+		if text := update.Response(); strings.TrimSpace(text) != "" {
+			t.outputs = append(t.outputs, text)
+			t.appendPane(text)
+		}
+	}
+	return nil
+}
+
+// updateStep returns the row for the step of an update, filling in its
+// model if the row has none, or nil when the update names no step
+func (t *progressTUI) updateStep(info *processor.StepInfo) *tuiStep {
+	if info == nil || info.Name == "" {
+		return nil
+	}
+	model := info.Model
+	if model == "N/A" || model == "NA" || model == "<nil>" {
+		model = ""
+	}
+	s := t.step(info.Name, model)
+	if s.model == "" {
+		s.model = model
+	}
+	return s
+}
+
+// finishRunning moves running steps to a final state. Parallel steps are
+// only included when all is set.
+func (t *progressTUI) finishRunning(state stepState, now time.Time, all bool) {
+	for _, s := range t.steps {
+		if s.state == stepRunning && (all || !s.parallel) {
+			s.state = state
+			s.finished = now
+		}
+	}
+}
+
+// appendPane adds text to the output pane, keeping only the last lines
+func (t *progressTUI) appendPane(text string) {
+	t.streaming = false
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		t.pane = append(t.pane, strings.TrimRight(line, "\r"))
+	}
+	t.trimPane()
+}
+
+// appendDelta adds streamed text to the output pane, continuing the last
+// line while a response is streaming
+func (t *progressTUI) appendDelta(delta string) {
+	lines := strings.Split(strings.ReplaceAll(delta, "\r", ""), "\n")
+	if t.streaming && len(t.pane) > 0 {
+		t.pane[len(t.pane)-1] += lines[0]
+		lines = lines[1:]
+	}
+	t.pane = append(t.pane, lines...)
+	t.streaming = true
+	t.trimPane()
+}
+
+// trimPane keeps only the last lines of the output pane
+func (t *progressTUI) trimPane() {
+	if len(t.pane) > tuiPaneLines {
+		t.pane = t.pane[len(t.pane)-tuiPaneLines:]
+	}
+}
+
+// Start begins redrawing the view. Anything else written to STDOUT while
+// the view is running is shown in the output pane instead of breaking the
+// display.
+func (t *progressTUI) Start() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("error capturing output: %w", err)
+	}
+	t.stdout, t.pipe = os.Stdout, w
+	os.Stdout = w
+	t.captured = make(chan struct{})
+	go func() {
+		defer close(t.captured)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			t.mu.Lock()
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				t.appendPane(line)
+			}
+			t.mu.Unlock()
+		}
+		r.Close()
+	}()
+
+	t.stop = make(chan struct{})
+	t.stopped = make(chan struct{})
+	fmt.Fprint(t.out, "\x1b[?25l") // Hide the cursor while drawing
+	go func() {
+		defer close(t.stopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			t.mu.Lock()
+			t.draw()
+			t.frame++
+			t.mu.Unlock()
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop draws the final state of the run, restores STDOUT and prints the
+// complete responses that were sent to STDOUT, through the pager when they
+// do not fit on the terminal
+func (t *progressTUI) Stop(runErr error) {
+	if t.stop != nil {
+		close(t.stop)
+		<-t.stopped
+	}
+	if t.pipe != nil {
+		os.Stdout = t.stdout
+		t.pipe.Close()
+		<-t.captured
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if runErr != nil {
+		t.finishRunning(stepFailed, time.Now(), true)
+	} else {
+		t.finishRunning(stepDone, time.Now(), true)
+	}
+	t.draw()
+	fmt.Fprint(t.out, "\x1b[?25h")
+	var b strings.Builder
+	for _, output := range t.outputs {
+		fmt.Fprintf(&b, "\n%s\n", strings.TrimRight(output, "\n"))
+	}
+	writePaged(t.out, t.fd, t.pager, b.String())
+}
+
+// draw redraws the view over the previous frame
+func (t *progressTUI) draw() {
+	width := 100
+	if t.fd >= 0 {
+		if w, _, err := term.GetSize(t.fd); err == nil && w > 0 {
+			width = w
+		}
+	}
+
+	lines := t.render(width, time.Now())
+	var buf bytes.Buffer
+	if t.drawn > 0 {
+		fmt.Fprintf(&buf, "\x1b[%dA", t.drawn)
+	}
+	for _, line := range lines {
+		buf.WriteString("\r\x1b[2K" + line + "\n")
+	}
+	buf.WriteString("\x1b[J")
+	t.out.Write(buf.Bytes())
+	t.drawn = len(lines)
+}
+
+// render returns the lines of the view, each at most width columns wide
+func (t *progressTUI) render(width int, now time.Time) []string {
+	nameWidth, modelWidth := 4, 0
+	for _, s := range t.steps {
+		nameWidth = max(nameWidth, min(utf8.RuneCountInString(s.name), 24))
+		modelWidth = max(modelWidth, min(utf8.RuneCountInString(s.model), 28))
+	}
+
+	var lines []string
+	lines = append(lines, fitWidth(fmt.Sprintf("%s  %s", t.title, formatElapsed(now.Sub(t.started))), width))
+
+	var promptTokens, completionTokens int
+	var cost float64
+	var priced bool
+	for _, s := range t.steps {
+		var icon, color string
+		switch s.state {
+		case stepPending:
+			icon, color = "·", "\x1b[2m"
+		case stepRunning:
+			icon, color = tuiFrames[t.frame%len(tuiFrames)], "\x1b[33m"
+		case stepDone:
+			icon, color = "✓", "\x1b[32m"
+		case stepSkipped:
+			icon, color = "↷", "\x1b[2m"
+		case stepFailed:
+			icon, color = "✗", "\x1b[31m"
+		}
+
+		row := fmt.Sprintf("%-*s  %-*s", nameWidth, fitWidth(s.name, nameWidth), modelWidth, fitWidth(s.model, modelWidth))
+		switch {
+		case s.state == stepRunning:
+			row += "  " + formatElapsed(now.Sub(s.started))
+		case !s.finished.IsZero() && !s.started.IsZero():
+			row += "  " + formatElapsed(s.finished.Sub(s.started))
+		}
+		if s.state == stepRunning && s.chunks > 0 {
+			row += fmt.Sprintf("  chunk %d/%d", s.chunk, s.chunks)
+		}
+		if s.retries > 0 {
+			row += fmt.Sprintf("  retries %d", s.retries)
+		}
+		if s.promptTokens > 0 || s.completionTokens > 0 {
+			row += fmt.Sprintf("  ~%s→%s tok", formatTokens(s.promptTokens), formatTokens(s.completionTokens))
+			if s.priced {
+				row += fmt.Sprintf("  $%.4f", s.cost)
+			}
+		}
+		lines = append(lines, color+icon+"\x1b[0m "+fitWidth(strings.TrimRight(row, " "), width-2))
+
+		promptTokens += s.promptTokens
+		completionTokens += s.completionTokens
+		cost += s.cost
+		priced = priced || s.priced
+	}
+
+	if len(t.pane) > 0 {
+		lines = append(lines, fitWidth("── output "+strings.Repeat("─", max(width-10, 0)), width))
+		for _, line := range t.pane {
+			lines = append(lines, fitWidth(line, width))
+		}
+	}
+	if t.errMsg != "" {
+		lines = append(lines, "\x1b[31m"+fitWidth("Error: "+t.errMsg, width)+"\x1b[0m")
+	}
+
+	footer := fmt.Sprintf("tokens ~%s in / ~%s out", formatTokens(promptTokens), formatTokens(completionTokens))
+	if priced {
+		footer += fmt.Sprintf("  ·  est. cost $%.4f", cost)
+	}
+	footer += "  ·  elapsed " + formatElapsed(now.Sub(t.started))
+	lines = append(lines, "\x1b[2m"+fitWidth(footer, width)+"\x1b[0m")
+	return lines
+}
+
+// fitWidth truncates s to at most width runes
+func fitWidth(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// formatElapsed renders a duration as m:ss, or as seconds with one decimal
+// under a minute
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// formatTokens renders a token count compactly, e.g. 950 or 12.3k
+func formatTokens(n int) string {
+	if n < 1000 {
+		return fmt.Sprintf("%d", n)
+	}
+	return fmt.Sprintf("%.1fk", float64(n)/1000)
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestProgressTUI(t *testing.T) {
+	cfg := &processor.DSLConfig{
+		Steps: []processor.Step{
+			{Name: "extract", Config: processor.StepConfig{Model: "gpt-4o"}},
+			{Name: "summarize", Config: processor.StepConfig{Model: "llama3"}},
+			{Name: "publish", Config: processor.StepConfig{Model: "NA"}},
+		},
+	}
+	var out bytes.Buffer
+	view := newProgressTUI("workflow.yaml", cfg, &out, -1)
+
+	extract := &processor.StepInfo{Name: "extract", Model: "gpt-4o"}
+	summarize := &processor.StepInfo{Name: "summarize", Model: "llama3"}
+	view.WriteProgress(processor.ProgressUpdate{Type: processor.ProgressStepStarted, Step: extract})
+	view.WriteProgress(processor.ProgressUpdate{
+		Type:               processor.ProgressStepFinished,
+		Step:               extract,
+		PerformanceMetrics: &processor.PerformanceMetrics{PromptTokens: 1500, CompletionTokens: 300},
+	})
+	view.WriteProgress(processor.ProgressUpdate{Type: processor.ProgressStepStarted, Step: summarize})
+	view.WriteProgress(processor.ProgressUpdate{Type: processor.ProgressChunk, Step: summarize, Chunk: 2, Chunks: 5})
+	view.WriteProgress(processor.ProgressUpdate{Type: processor.ProgressRetry, Step: summarize, Message: "Rate limit detected, retrying in 1s (attempt 1/5)..."})
+	view.WriteProgress(processor.ProgressUpdate{Type: processor.ProgressDelta, Delta: "streamed "})
+	view.WriteProgress(processor.ProgressUpdate{Type: processor.ProgressDelta, Delta: "text"})
+	view.WriteProgress(processor.ProgressUpdate{
+		Type:               processor.ProgressOutput,
+		Stdout:             "first line\nsecond line\n\nPerformance Metrics:\n- Input processing: 1 ms\n",
+		PerformanceMetrics: &processor.PerformanceMetrics{},
+	})
+
+	lines := view.render(120, time.Now())
+	text := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"workflow.yaml",
+		"✓\x1b[0m extract",
+		"~1.5k→300 tok  $0.0067",
+		"\x1b[0m summarize",
+		"chunk 2/5  retries 1",
+		"retrying in 1s",
+		"streamed text\n",
+		"·\x1b[0m publish",
+		"second line",
+		"est. cost $0.0067",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("view missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Performance Metrics") {
+		t.Errorf("output pane should not include performance metrics:\n%s", text)
+	}
+	if got := view.byName["summarize"].state; got != stepRunning {
+		t.Errorf("summarize state = %v, want running", got)
+	}
+
+	view.WriteProgress(processor.ProgressUpdate{Type: processor.ProgressError, Error: errors.New("model unavailable")})
+	if got := view.byName["summarize"].state; got != stepFailed {
+		t.Errorf("summarize state = %v, want failed", got)
+	}
+
+	view.Stop(errors.New("model unavailable"))
+	if !strings.HasSuffix(out.String(), "\nfirst line\nsecond line\n") {
+		t.Errorf("responses not printed after the view:\n%q", out.String())
+	}
+	for _, line := range view.render(20, time.Now()) {
+		if visible := strings.NewReplacer("\x1b[0m", "", "\x1b[2m", "", "\x1b[31m", "", "\x1b[32m", "", "\x1b[33m", "").Replace(line); len([]rune(visible)) > 20 {
+			t.Errorf("line wider than the terminal: %q", visible)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+// Prune flags
+var pruneOlderThan string
+var pruneTempAge time.Duration
+var pruneDryRun bool
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove leftover temp files and old run history",
+	Long: `Remove temporary files and directories left behind by interrupted runs, and
+recorded runs (with their stored step outputs) older than the retention period.
+
+Temp files are only removed once they are older than --temp-age, so runs in
+progress keep theirs. Use --dry-run to see what would be removed.
+
+Examples:
+  comanda prune --dry-run
+  comanda prune --older-than 2w
+  comanda prune --older-than all   # Keep all run history, clean temp files only`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		retention, err := parseAge(pruneOlderThan)
+		if err != nil {
+			return err
+		}
+		if pruneTempAge < 0 {
+			return fmt.Errorf("--temp-age can't be negative")
+		}
+		now := time.Now()
+
+		artifacts, err := fileutil.FindTempFiles(os.TempDir(), now.Add(-pruneTempAge))
+		if err != nil {
+			return err
+		}
+		var tempBytes int64
+		for _, a := range artifacts {
+			if pruneDryRun {
+				fmt.Printf("Would remove %s (%s)\n", a.Path, formatBytes(a.Size))
+			} else if err := os.RemoveAll(a.Path); err != nil {
+				return fmt.Errorf("error removing %s: %w", a.Path, err)
+			}
+			tempBytes += a.Size
+		}
+
+		var pruned history.PruneResult
+		if retention > 0 {
+			store, err := openHistory()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			result, err := store.Prune(now.Add(-retention), pruneDryRun)
+			if err != nil {
+				return err
+			}
+			pruned = *result
+			if pruneDryRun {
+				for _, run := range pruned.Runs {
+					fmt.Printf("Would remove run %s (%s, %s)\n", run.ID, run.Workflow, run.Started.Local().Format("2006-01-02 15:04"))
+				}
+			}
+		}
+
+		printPruneSummary(os.Stdout, len(artifacts), tempBytes, &pruned, pruneDryRun)
+		return nil
+	},
+}
+
+// printPruneSummary writes what was, or on a dry run would be, removed
+func printPruneSummary(out io.Writer, tempCount int, tempBytes int64, pruned *history.PruneResult, dryRun bool) {
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	if tempCount == 0 && len(pruned.Runs) == 0 {
+		fmt.Fprintln(out, "Nothing to prune.")
+		return
+	}
+	fmt.Fprintf(out, "%s %d temp %s (%s) and %d %s from the history (%s).\n",
+		verb, tempCount, plural(tempCount, "item", "items"), formatBytes(tempBytes),
+		len(pruned.Runs), plural(len(pruned.Runs), "run", "runs"), formatBytes(pruned.Bytes))
+}
+
+// formatBytes formats a size such as 512 B, 1.5 KB or 2.3 GB
+func formatBytes(n int64) string {
+	return fileutil.FormatSize(n)
+}
+
+// plural returns one when n is 1 and many otherwise
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func init() {
+	pruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "30d", "Remove recorded runs older than this, e.g. 7d, 2w, 1m, or all to keep every run")
+	pruneCmd.Flags().DurationVar(&pruneTempAge, "temp-age", 24*time.Hour, "Only remove temp files last modified longer ago than this")
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "List what would be removed without removing anything")
+	rootCmd.AddCommand(pruneCmd)
+}
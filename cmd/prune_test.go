@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+func TestPrintPruneSummary(t *testing.T) {
+	var out bytes.Buffer
+	printPruneSummary(&out, 0, 0, &history.PruneResult{}, false)
+	if out.String() != "Nothing to prune.\n" {
+		t.Errorf("empty summary = %q", out.String())
+	}
+
+	out.Reset()
+	printPruneSummary(&out, 1, 1536, &history.PruneResult{Runs: make([]history.Run, 3), Bytes: 3 << 30}, true)
+	want := "Would remove 1 temp item (1.5 KB) and 3 runs from the history (3.0 GB).\n"
+	if out.String() != want {
+		t.Errorf("summary = %q, want %q", out.String(), want)
+	}
+	if formatBytes(512) != "512 B" || !strings.HasSuffix(formatBytes(5<<20), "MB") {
+		t.Errorf("unexpected formatBytes() output: %s, %s", formatBytes(512), formatBytes(5<<20))
+	}
+}
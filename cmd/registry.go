@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/bundle"
+	"github.com/kris-hansen/comanda/utils/registry"
+)
+
+// Registry flags
+var registrySignKey string
+var registryVerifyKey string
+var registryDigest string
+var registryOutput string
+var registryDir string
+var registryForce bool
+var registryKeyFile string
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Share versioned workflows through a registry",
+	Long: `Push workflow bundles to a registry and pull them elsewhere, the way container
+images are shared. References name the registry, the workflow and a tag:
+
+  oci://ghcr.io/team/review:1.2.0           OCI registry (GHCR, ECR, Harbor, ...)
+  https://workflows.example.com/review:1.2  Static index served over HTTPS
+  file:///mnt/shared/workflows/review:1.2   Index directory on a shared drive
+
+Credentials come from COMANDA_REGISTRY_USER and COMANDA_REGISTRY_PASSWORD, or
+COMANDA_REGISTRY_TOKEN. Pin a pulled workflow with --digest, and sign pushes
+with a key from 'comanda registry keygen' to let others verify them.`,
+}
+
+var registryPushCmd = &cobra.Command{
+	Use:   "push <workflow.yaml|bundle.tgz> <reference>",
+	Short: "Push a workflow to a registry",
+	Long: `Bundle a workflow with the files it reads, as 'comanda export' does, and push
+it to a registry. A .tgz created by 'comanda export' is pushed as is. Index
+registries refuse to replace a version with different contents unless --force
+is given; OCI tags move to the new push, like image tags.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ref, err := registry.ParseRef(args[1])
+		if err != nil {
+			return err
+		}
+		data, err := bundleForPush(args[0])
+		if err != nil {
+			return err
+		}
+
+		artifact := registry.Artifact{Bundle: data, Digest: registry.Digest(data)}
+		if registrySignKey != "" {
+			if artifact.Signature, err = registry.Sign(artifact.Digest, registrySignKey); err != nil {
+				return err
+			}
+		}
+		if err := registry.Open(ref).Push(ref, artifact, registryForce); err != nil {
+			return err
+		}
+		fmt.Printf("Pushed %s\nDigest: %s\n", ref, artifact.Digest)
+		if artifact.Signature != "" {
+			fmt.Println("Signed with", registrySignKey)
+		}
+		return nil
+	},
+}
+
+var registryPullCmd = &cobra.Command{
+	Use:   "pull <reference>",
+	Short: "Pull a workflow from a registry",
+	Long: `Download a workflow bundle, check it, and unpack it into the current directory
+(or --dir) as 'comanda import' does. --digest fails the pull unless the bundle
+has exactly that digest, and --verify-key requires a valid signature from the
+matching signing key. With -o the bundle is saved instead of unpacked.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ref, err := registry.ParseRef(args[0])
+		if err != nil {
+			return err
+		}
+		artifact, err := registry.Open(ref).Pull(ref)
+		if err != nil {
+			return err
+		}
+		if registryDigest != "" && artifact.Digest != registryDigest {
+			return fmt.Errorf("%s has digest %s, not the pinned %s", ref, artifact.Digest, registryDigest)
+		}
+		if registryVerifyKey != "" {
+			if err := registry.Verify(artifact, registryVerifyKey); err != nil {
+				return fmt.Errorf("%s: %w", ref, err)
+			}
+		}
+
+		if registryOutput != "" {
+			if err := os.WriteFile(registryOutput, artifact.Bundle, 0644); err != nil {
+				return fmt.Errorf("error writing bundle: %w", err)
+			}
+			fmt.Printf("Saved %s to %s\nDigest: %s\n", ref, registryOutput, artifact.Digest)
+			return nil
+		}
+		manifest, err := bundle.Extract(bytes.NewReader(artifact.Bundle), registryDir, registryForce)
+		if err != nil {
+			return err
+		}
+		printBundleSummary(os.Stdout, manifest)
+		fmt.Printf("\nPulled %s\nDigest: %s\n", ref, artifact.Digest)
+		if registryVerifyKey != "" {
+			fmt.Println("Signature verified")
+		}
+		return nil
+	},
+}
+
+var registryTagsCmd = &cobra.Command{
+	Use:   "tags <reference>",
+	Short: "List the tags of a workflow in a registry",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ref, err := registry.ParseRef(args[0])
+		if err != nil {
+			return err
+		}
+		tags, err := registry.Open(ref).Tags(ref)
+		if err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			fmt.Printf("No tags for %s\n", ref.Name)
+		}
+		for _, tag := range tags {
+			fmt.Println(tag)
+		}
+		return nil
+	},
+}
+
+var registryKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Create a key pair for signing pushed workflows",
+	Long: `Write an Ed25519 signing key and its public key (with a .pub suffix). Push with
+--sign-key <key> and share the .pub file so others can pull with
+--verify-key <key.pub>.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		public := registryKeyFile + ".pub"
+		for _, path := range []string{registryKeyFile, public} {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists", path)
+			}
+		}
+		if err := registry.GenerateKeys(registryKeyFile, public); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote signing key %s and public key %s\n", registryKeyFile, public)
+		return nil
+	},
+}
+
+// bundleForPush returns the bundle to push: an existing bundle file, or a
+// new bundle of a workflow
+func bundleForPush(path string) ([]byte, error) {
+	if strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading bundle: %w", err)
+		}
+		if _, _, err := bundle.Read(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := bundle.Collect(path, dir)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, manifest, dir); err != nil {
+		return nil, err
+	}
+	printBundleSummary(os.Stdout, manifest)
+	return buf.Bytes(), nil
+}
+
+func init() {
+	registryPushCmd.Flags().StringVar(&registrySignKey, "sign-key", "", "Sign the push with this key from 'registry keygen'")
+	registryPushCmd.Flags().BoolVar(&registryForce, "force", false, "Replace an existing version with different contents")
+	registryPushCmd.ValidArgsFunction = completeWorkflowArgs(1)
+	registryPullCmd.Flags().StringVar(&registryDigest, "digest", "", "Fail unless the bundle has this digest (sha256:...)")
+	registryPullCmd.Flags().StringVar(&registryVerifyKey, "verify-key", "", "Require a valid signature from the key matching this public key")
+	registryPullCmd.Flags().StringVarP(&registryOutput, "output", "o", "", "Save the bundle to this file instead of unpacking it")
+	registryPullCmd.Flags().StringVar(&registryDir, "dir", ".", "Directory to unpack the workflow into")
+	registryPullCmd.Flags().BoolVar(&registryForce, "force", false, "Replace existing files with different contents")
+	registryKeygenCmd.Flags().StringVar(&registryKeyFile, "out", "comanda-signing.key", "Signing key file; the public key gets a .pub suffix")
+	registryCmd.AddCommand(registryPushCmd, registryPullCmd, registryTagsCmd, registryKeygenCmd)
+	rootCmd.AddCommand(registryCmd)
+}
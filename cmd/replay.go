@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/textdiff"
+)
+
+// Replay flags
+var replayModel string
+var replayStep string
+var replayWords bool
+var replayContext int
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <run-id> --model <model>",
+	Short: "Send a past run's prompts to another model and compare the responses",
+	Long: `Send the prompts a run from the run history sent, exactly as they were
+rendered, to another model, and show how each step's responses changed, to
+check a workflow for regressions before switching models. Steps run no
+actions, write no outputs and read no inputs again, except files that were
+attached to a prompt.
+
+The replay is recorded in the run history like any other run, so it can be
+compared again with 'comanda diff'. Only runs recorded by this version keep
+their prompts. Run IDs can be shortened to any unique prefix, or given as
+"last".
+
+Examples:
+  comanda replay last --model claude-opus-4
+  comanda replay 20260301-0700-ab12 --model gpt-4o-mini --step summarize --words`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if replayModel == "" {
+			return errors.New("--model is required")
+		}
+		policy := envConfig.PolicySettings()
+		if err := policy.CheckModel(replayModel); err != nil {
+			return fmt.Errorf("%w: %v", processor.ErrPolicy, err)
+		}
+		provider, err := providerForModel(replayModel)
+		if err != nil {
+			return err
+		}
+		if err := policy.CheckProvider(provider.Name()); err != nil {
+			return fmt.Errorf("%w: %v", processor.ErrPolicy, err)
+		}
+
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		run, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		steps, err := replayableSteps(run, replayStep)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+		http.DefaultTransport = interruptTransport(http.DefaultTransport, ctx)
+
+		var recorder *history.Recorder
+		if !noHistory {
+			if recorder, err = store.StartReplay(run); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: run history disabled: %v\n", err)
+			}
+		}
+
+		replayed := replaySteps(ctx, provider, replayModel, steps, recorder)
+		if recorder != nil {
+			var runErr error
+			if ctx.Err() != nil {
+				runErr = processor.ErrInterrupted
+			} else if failed := failedSteps(replayed); len(failed) > 0 {
+				runErr = fmt.Errorf("replay failed at step(s) %s", strings.Join(failed, ", "))
+			}
+			if err := recorder.Finish(runErr); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to record run: %v\n", err)
+			}
+		}
+
+		replayID := "replay"
+		if recorder != nil {
+			replayID = recorder.ID()
+		}
+		writeReplayReport(os.Stdout, run, replayID, replayModel, replayed, replayWords, replayContext)
+		if ctx.Err() != nil {
+			return processor.ErrInterrupted
+		}
+		return nil
+	},
+}
+
+// recordedStep is a step of a past run with the prompts it sent
+type recordedStep struct {
+	step    history.Step
+	prompts []processor.PromptRecord
+}
+
+// replayResult is a step's original prompts and the replayed ones
+type replayResult struct {
+	recordedStep
+	replayed []processor.PromptRecord
+}
+
+// replayableSteps returns the steps of run that kept their prompts, limited
+// to one step when only is set
+func replayableSteps(run *history.Run, only string) ([]recordedStep, error) {
+	var steps []recordedStep
+	for _, step := range run.Steps {
+		if only != "" && step.Name != only {
+			continue
+		}
+		prompts, err := step.Prompts()
+		if err != nil {
+			return nil, err
+		}
+		if len(prompts) > 0 {
+			steps = append(steps, recordedStep{step: step, prompts: prompts})
+		}
+	}
+	if len(steps) > 0 {
+		return steps, nil
+	}
+	if only != "" {
+		return nil, fmt.Errorf("run %s has no step '%s' with stored prompts", run.ID, only)
+	}
+	return nil, fmt.Errorf("run %s has no stored prompts to replay; only runs recorded by this version of comanda keep them", run.ID)
+}
+
+// replaySteps sends each step's prompts to model, recording each step with
+// recorder when it is set. It stops starting prompts once ctx is done.
+func replaySteps(ctx context.Context, provider models.Provider, model string, steps []recordedStep, recorder *history.Recorder) []replayResult {
+	var results []replayResult
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			break
+		}
+		config.InfoLog("Replaying %s (%d prompt(s)) with %s", step.step.Name, len(step.prompts), model)
+		started := time.Now()
+		result := replayResult{recordedStep: step}
+		var metrics processor.PerformanceMetrics
+		var stepErr error
+		for _, prompt := range step.prompts {
+			if ctx.Err() != nil {
+				stepErr = processor.ErrInterrupted
+				break
+			}
+			sent := replayPrompt(provider, model, prompt)
+			if sent.Error != "" && stepErr == nil {
+				stepErr = errors.New(sent.Error)
+			}
+			metrics.PromptTokens += processor.EstimateTokens(sent.Prompt)
+			metrics.CompletionTokens += processor.EstimateTokens(sent.Response)
+			result.replayed = append(result.replayed, sent)
+		}
+		results = append(results, result)
+
+		if recorder != nil {
+			recorder.RecordStep(processor.StepRecord{
+				Name:     step.step.Name,
+				Model:    model,
+				Provider: provider.Name(),
+				Response: joinResponses(result.replayed),
+				Started:  started,
+				Finished: time.Now(),
+				Metrics:  metrics,
+				Err:      stepErr,
+				Prompts:  result.replayed,
+			})
+		}
+	}
+	return results
+}
+
+// replayPrompt sends one recorded prompt to model, attaching its file again
+// when it had one
+func replayPrompt(provider models.Provider, model string, prompt processor.PromptRecord) processor.PromptRecord {
+	sent := processor.PromptRecord{Model: model, Prompt: prompt.Prompt, File: prompt.File, MimeType: prompt.MimeType}
+	var err error
+	if prompt.File != "" {
+		if _, statErr := os.Stat(prompt.File); statErr != nil {
+			sent.Error = fmt.Sprintf("attached file %s can't be read: %v", prompt.File, statErr)
+			return sent
+		}
+		sent.Response, err = provider.SendPromptWithFile(model, prompt.Prompt, models.FileInput{Path: prompt.File, MimeType: prompt.MimeType})
+	} else {
+		sent.Response, err = provider.SendPrompt(model, prompt.Prompt)
+	}
+	if err != nil {
+		sent.Error = err.Error()
+	}
+	return sent
+}
+
+// joinResponses combines the responses of a step's prompts, in order
+func joinResponses(prompts []processor.PromptRecord) string {
+	responses := make([]string, 0, len(prompts))
+	for _, prompt := range prompts {
+		responses = append(responses, prompt.Response)
+	}
+	return strings.Join(responses, "\n\n")
+}
+
+// failedSteps names the steps with a prompt that failed when replayed
+func failedSteps(results []replayResult) []string {
+	var failed []string
+	for _, result := range results {
+		for _, prompt := range result.replayed {
+			if prompt.Error != "" {
+				failed = append(failed, result.step.Name)
+				break
+			}
+		}
+	}
+	return failed
+}
+
+// writeReplayReport writes how each replayed step's responses differ from
+// the original run's
+func writeReplayReport(out io.Writer, run *history.Run, replayID, model string, results []replayResult, words bool, context int) {
+	fmt.Fprintf(out, "Replaying %s (%s) with %s\n", run.ID, run.Workflow, model)
+
+	var changed int
+	var unchanged []string
+	for _, result := range results {
+		name := result.step.Name
+		a, b := joinResponses(result.prompts), joinResponses(result.replayed)
+		var errs []string
+		for _, prompt := range result.replayed {
+			if prompt.Error != "" {
+				errs = append(errs, prompt.Error)
+			}
+		}
+		if a == b && len(errs) == 0 {
+			unchanged = append(unchanged, name)
+			continue
+		}
+		changed++
+
+		fmt.Fprintf(out, "\n== %s ==\n", name)
+		fmt.Fprintf(out, "Model: %s → %s\n", result.step.Model, model)
+		if missing := len(result.prompts) - len(result.replayed); missing > 0 {
+			fmt.Fprintf(out, "Not replayed: %d of %d prompt(s)\n", missing, len(result.prompts))
+		}
+		for _, err := range errs {
+			fmt.Fprintf(out, "Error: %s\n", err)
+		}
+		switch {
+		case a == b:
+			fmt.Fprintln(out, "Output unchanged")
+		case words:
+			fmt.Fprintln(out, strings.TrimRight(textdiff.Words(a, b), "\n"))
+		default:
+			fmt.Fprint(out, textdiff.Unified(run.ID+"/"+name, replayID+"/"+name, a, b, context))
+		}
+	}
+
+	if len(unchanged) > 0 {
+		fmt.Fprintf(out, "\nUnchanged: %s\n", strings.Join(unchanged, ", "))
+	}
+	fmt.Fprintf(out, "\n%d of %d step(s) changed\n", changed, len(results))
+	if replayID != "replay" {
+		fmt.Fprintf(out, "Recorded as %s; compare again with: comanda diff %s %s\n", replayID, run.ID, replayID)
+	}
+}
+
+func init() {
+	replayCmd.Flags().StringVarP(&replayModel, "model", "m", "", "Model to send the prompts to")
+	replayCmd.RegisterFlagCompletionFunc("model", completeModelFlag)
+	replayCmd.Flags().StringVar(&replayStep, "step", "", "Only replay this step")
+	replayCmd.Flags().BoolVar(&replayWords, "words", false, "Show a word-level diff instead of a line diff")
+	replayCmd.Flags().IntVarP(&replayContext, "context", "U", 3, "Lines of context around changes")
+	replayCmd.Flags().BoolVar(&noHistory, "no-history", false, "Do not record the replay in the run history")
+	rootCmd.AddCommand(replayCmd)
+}
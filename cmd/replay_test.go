@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestReplay(t *testing.T) {
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	original, err := store.Start("review.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original.RecordStep(processor.StepRecord{Name: "summarize", Model: "gpt-4o", Response: "summary", Prompts: []processor.PromptRecord{
+		{Model: "gpt-4o", Prompt: "Summarize: notes", Response: "summary"},
+	}})
+	original.RecordStep(processor.StepRecord{Name: "echo", Model: "gpt-4o", Response: "reply", Prompts: []processor.PromptRecord{
+		{Model: "gpt-4o", Prompt: "Say reply", Response: "reply"},
+	}})
+	original.RecordStep(processor.StepRecord{Name: "copy", Response: "no model"})
+	if err := original.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	run, err := store.Get(original.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps, err := replayableSteps(run, "")
+	if err != nil || len(steps) != 2 {
+		t.Fatalf("replayableSteps() = %d steps, %v; want the 2 with prompts", len(steps), err)
+	}
+	if _, err := replayableSteps(run, "copy"); err == nil {
+		t.Error("replayableSteps() accepted a step without prompts")
+	}
+
+	provider := &echoProvider{}
+	recorder, err := store.StartReplay(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := replaySteps(context.Background(), provider, "claude-opus-4", steps, recorder)
+	if err := recorder.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(provider.prompts, "|") != "Summarize: notes|Say reply" {
+		t.Errorf("prompts sent = %q, want the recorded ones", provider.prompts)
+	}
+
+	var buf bytes.Buffer
+	writeReplayReport(&buf, run, recorder.ID(), "claude-opus-4", results, false, 3)
+	got := buf.String()
+	for _, want := range []string{
+		"== summarize ==\nModel: gpt-4o → claude-opus-4\n",
+		"-summary\n+reply\n",
+		"Unchanged: echo\n",
+		"1 of 2 step(s) changed",
+		"comanda diff " + run.ID + " " + recorder.ID(),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report missing %q:\n%s", want, got)
+		}
+	}
+
+	replay, err := store.Get(recorder.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ReplayOf != run.ID || len(replay.Steps) != 2 || replay.Steps[0].Model != "claude-opus-4" || replay.Steps[0].PromptFile == "" {
+		t.Errorf("replay run = %+v", replay)
+	}
+}
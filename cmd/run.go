@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Run command flags
+var runModel string
+var runAction string
+var runInputs []string
+var runOutputs []string
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run a single prompt without writing a workflow file",
+	Long: `Build a one-step workflow from flags and run it. Data piped to comanda is used
+as the input when no --input is given.
+
+Example:
+  comanda run --model gpt-4o --action "Summarize the key findings" --input report.pdf`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stdinData, err := readPipedStdin()
+		if err != nil {
+			return fmt.Errorf("error reading from STDIN: %w", err)
+		}
+		defer stdinData.remove()
+
+		dslConfig, err := oneStepWorkflow(runModel, runAction, runInputs, runOutputs, !stdinData.empty())
+		if err != nil {
+			return err
+		}
+
+		proc := processor.NewProcessor(dslConfig, envConfig, &config.ServerConfig{Enabled: false}, verbose, runtimeDir)
+		if quiet {
+			proc.DisableSpinner()
+		}
+		stdinData.apply(proc)
+		ctx, stop := interruptContext()
+		defer stop()
+		_, cancelRun := runContext(ctx, proc)
+		defer cancelRun()
+		cache, err := responseCache()
+		if err != nil {
+			return err
+		}
+		proc.SetResponseCache(cache)
+
+		finishRun := recordRun("(run)", proc)
+		err = proc.Process()
+		finishRun(err)
+		if err != nil {
+			return err
+		}
+		copyFinalOutput(proc.LastOutput())
+		return nil
+	},
+}
+
+// oneStepWorkflow builds the in-memory workflow for the run command
+func oneStepWorkflow(model, action string, inputs, outputs []string, hasStdin bool) (*processor.DSLConfig, error) {
+	if action == "" {
+		return nil, fmt.Errorf("--action is required")
+	}
+	if model == "" {
+		model = envConfig.DefaultGenerationModel
+	}
+	if model == "" {
+		return nil, fmt.Errorf("no model specified and no default_generation_model configured. Use --model or configure a default")
+	}
+
+	var input interface{} = "NA"
+	switch {
+	case len(inputs) == 1:
+		input = inputs[0]
+	case len(inputs) > 1:
+		input = inputs
+	case hasStdin:
+		input = "STDIN"
+	}
+	var output interface{} = "STDOUT"
+	if len(outputs) == 1 {
+		output = outputs[0]
+	} else if len(outputs) > 1 {
+		output = outputs
+	}
+
+	return &processor.DSLConfig{
+		Steps: []processor.Step{{
+			Name: "run",
+			Config: processor.StepConfig{
+				Input:  input,
+				Model:  model,
+				Action: action,
+				Output: output,
+			},
+		}},
+	}, nil
+}
+
+func init() {
+	runCmd.Flags().StringVarP(&runModel, "model", "m", "", "Model to use (defaults to default_generation_model)")
+	runCmd.RegisterFlagCompletionFunc("model", completeModelFlag)
+	runCmd.Flags().StringVarP(&runAction, "action", "a", "", "Prompt to run")
+	runCmd.Flags().StringArrayVarP(&runInputs, "input", "i", nil, "Input file, glob or URL (repeatable)")
+	runCmd.Flags().StringArrayVarP(&runOutputs, "output", "o", nil, "Output file (repeatable, default STDOUT)")
+	runCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory for file operations")
+	runCmd.Flags().BoolVar(&noHistory, "no-history", false, "Do not record this run in the run history")
+	runCmd.Flags().BoolVar(&noCache, "no-cache", false, "Call the model even when the response cache has an answer to the prompt")
+	runCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Stop the run if it takes longer than this, such as 5m")
+	runCmd.Flags().BoolVar(&copyOutput, "copy", false, "Copy the final output to the system clipboard")
+	rootCmd.AddCommand(runCmd)
+}
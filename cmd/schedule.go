@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/schedule"
+)
+
+// Schedule flags
+var scheduleName string
+var scheduleJitter string
+var scheduleAllowOverlap bool
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run workflows on cron schedules",
+	Long: `Manage scheduled workflows and run the scheduler. Jobs are kept in
+schedules.json in the data directory (or COMANDA_SCHEDULE_FILE) and run by
+'comanda schedule run', which stays in the foreground; run it under systemd,
+launchd or a terminal multiplexer. Each run is recorded in the run history.`,
+}
+
+var scheduleAddCmd = &cobra.Command{
+	Use:   "add <cron> <workflow.yaml>",
+	Short: "Schedule a workflow",
+	Long: `Schedule a workflow with a five-field cron expression (minute hour
+day-of-month month day-of-week) or @hourly, @daily, @weekly, @monthly.
+The workflow runs in the current directory, so relative inputs and outputs
+resolve as they do with 'comanda process'.
+
+Examples:
+  comanda schedule add "0 7 * * *" daily-digest.yaml
+  comanda schedule add "*/30 9-17 * * mon-fri" triage.yaml --jitter 2m`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, _, err := readWorkflowFile(args[1]); err != nil {
+			return err
+		}
+		workflow, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		job, err := schedule.Add(schedule.DefaultPath(), schedule.Job{
+			ID:           scheduleName,
+			Cron:         args[0],
+			Workflow:     workflow,
+			Dir:          dir,
+			Jitter:       scheduleJitter,
+			AllowOverlap: scheduleAllowOverlap,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Scheduled %s, next run %s\n", job.ID, nextRun(job, time.Now()))
+		fmt.Println("Start the scheduler with 'comanda schedule run' if it is not already running.")
+		return nil
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List scheduled workflows",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, err := schedule.Load(schedule.DefaultPath())
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No scheduled workflows.")
+			return nil
+		}
+		printScheduleTable(os.Stdout, jobs, time.Now())
+		return nil
+	},
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Remove a scheduled workflow",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := schedule.Remove(schedule.DefaultPath(), args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", args[0])
+		return nil
+	},
+}
+
+var scheduleRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the scheduler in the foreground",
+	Long: `Run scheduled workflows until interrupted. Changes made with 'schedule add'
+and 'schedule remove' are picked up without a restart. A job whose previous
+run is still going is skipped unless it was added with --allow-overlap. On
+SIGINT or SIGTERM the scheduler waits for running workflows to finish.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("cannot find the comanda executable: %w", err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		logger := log.New(config.ConsoleAndLog(os.Stderr), "[schedule] ", log.LstdFlags)
+		path := schedule.DefaultPath()
+		logger.Printf("Watching %s", path)
+		scheduler := &schedule.Scheduler{
+			Path: path,
+			Logf: logger.Printf,
+			Run: func(job schedule.Job) error {
+				return runScheduledJob(executable, job)
+			},
+		}
+		return scheduler.Start(ctx)
+	},
+}
+
+// runScheduledJob processes a job's workflow in a separate comanda process,
+// so each run has its own working directory and is recorded in the history.
+// Its output is copied to the log file, if there is one.
+func runScheduledJob(executable string, job schedule.Job) error {
+	cmd := exec.Command(executable, "process", "--plain", job.Workflow)
+	cmd.Dir = job.Dir
+	cmd.Stdout = config.ConsoleAndLog(os.Stdout)
+	cmd.Stderr = config.ConsoleAndLog(os.Stderr)
+	return cmd.Run()
+}
+
+// nextRun describes when a job runs next
+func nextRun(job schedule.Job, now time.Time) string {
+	cron, err := schedule.ParseCron(job.Cron)
+	if err != nil {
+		return "never (" + err.Error() + ")"
+	}
+	next := cron.Next(now)
+	if next.IsZero() {
+		return "never"
+	}
+	return next.Format("Mon 2006-01-02 15:04")
+}
+
+// printScheduleTable writes one line per job
+func printScheduleTable(out io.Writer, jobs []schedule.Job, now time.Time) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSCHEDULE\tNEXT RUN\tJITTER\tOVERLAP\tWORKFLOW")
+	for _, job := range jobs {
+		jitter := job.Jitter
+		if jitter == "" {
+			jitter = "-"
+		}
+		overlap := "skip"
+		if job.AllowOverlap {
+			overlap = "allow"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Cron, nextRun(job, now), jitter, overlap, job.Workflow)
+	}
+	w.Flush()
+}
+
+func init() {
+	scheduleAddCmd.Flags().StringVar(&scheduleName, "name", "", "Job ID (default: the workflow file name)")
+	scheduleAddCmd.Flags().StringVar(&scheduleJitter, "jitter", "", "Delay each run by a random time up to this long, e.g. 5m")
+	scheduleAddCmd.Flags().BoolVar(&scheduleAllowOverlap, "allow-overlap", false, "Start a run even if the previous one is still running")
+	// The first argument is the cron expression
+	scheduleAddCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 1 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeWorkflowFiles(cmd, args, toComplete)
+	}
+	scheduleCmd.AddCommand(scheduleAddCmd, scheduleListCmd, scheduleRemoveCmd, scheduleRunCmd)
+	rootCmd.AddCommand(scheduleCmd)
+}
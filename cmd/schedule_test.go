@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/schedule"
+)
+
+func TestPrintScheduleTable(t *testing.T) {
+	now := time.Date(2026, 3, 2, 8, 30, 0, 0, time.Local) // A Monday
+	jobs := []schedule.Job{
+		{ID: "daily-digest", Cron: "0 7 * * *", Workflow: "/work/daily-digest.yaml", Jitter: "5m"},
+		{ID: "triage", Cron: "*/30 9-17 * * mon-fri", Workflow: "/work/triage.yaml", AllowOverlap: true},
+	}
+	var buf bytes.Buffer
+	printScheduleTable(&buf, jobs, now)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("table =\n%s", buf.String())
+	}
+	for i, want := range [][]string{
+		{"daily-digest", "Tue 2026-03-03 07:00", "5m", "skip", "/work/daily-digest.yaml"},
+		{"triage", "Mon 2026-03-02 09:00", "-", "allow", "/work/triage.yaml"},
+	} {
+		for _, field := range want {
+			if !strings.Contains(lines[i+1], field) {
+				t.Errorf("row %q missing %q", lines[i+1], field)
+			}
+		}
+	}
+}
+
+func TestNextRunInvalidCron(t *testing.T) {
+	if got := nextRun(schedule.Job{Cron: "0 0 30 2 *"}, time.Now()); got != "never" {
+		t.Errorf("nextRun() = %q, want never", got)
+	}
+	if got := nextRun(schedule.Job{Cron: "bad"}, time.Now()); !strings.HasPrefix(got, "never (") {
+		t.Errorf("nextRun() = %q", got)
+	}
+}
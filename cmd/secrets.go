@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/secrets"
+)
+
+// resolveConfigSecrets replaces the settings of cfg that reference a secret
+// manager with the secrets, and keeps renewing their leases while the
+// command runs. Workflow env values that reference secrets resolve through
+// the same cache.
+func resolveConfigSecrets(cfg *config.EnvConfig) error {
+	resolver := secrets.New(cfg.SecretsSettings())
+	secrets.SetDefault(resolver)
+	ctx := context.Background()
+	if err := cfg.ResolveSecretRefs(func(ref string) (string, error) {
+		return resolver.Resolve(ctx, ref)
+	}); err != nil {
+		return err
+	}
+	go resolver.Run(ctx)
+	return nil
+}
+
+// reloadEnvConfig loads the environment file again for a running server,
+// the way the root command loaded it. An encrypted file is decrypted with
+// the passphrase from the environment or the passphrase agent. Secret references resolve through
+// the cache already in use, so secrets are fetched again once their cache
+// entries expire and leases keep being renewed.
+func reloadEnvConfig() (*config.EnvConfig, error) {
+	path := config.GetEnvPath()
+	if data, err := os.ReadFile(path); err == nil && config.IsEncrypted(data) {
+		// Only a passphrase supplied without a prompt can be read again
+		if _, ok, err := config.LookupPassphrase(); err != nil || !ok {
+			return nil, errors.New("the environment file is encrypted and its passphrase was typed at startup; restart the server to apply its changes")
+		}
+	}
+	cfg, err := config.LoadEnvConfigWithPassword(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ApplyEnvVars(os.Environ()); err != nil {
+		return nil, err
+	}
+	resolver := secrets.Default()
+	ctx := context.Background()
+	if err := cfg.ResolveSecretRefs(func(ref string) (string, error) {
+		return resolver.Resolve(ctx, ref)
+	}); err != nil {
+		return nil, err
+	}
+	if err := applyConfigOverrides(cfg); err != nil {
+		return nil, err
+	}
+	cfg.AddSecrets()
+	return cfg, nil
+}
@@ -21,6 +21,8 @@ var serverCmd = &cobra.Command{
 		// Default behavior (no subcommand) is to start the server
 		// Use the centralized configuration that was loaded in rootCmd's PersistentPreRunE
 
+		server.Version = getVersionFromFile()
+		server.ReloadConfig = reloadEnvConfig
 		if err := server.Run(envConfig); err != nil {
 			fmt.Printf("Server failed to start: %v\n", err)
 			return
@@ -28,6 +30,23 @@ var serverCmd = &cobra.Command{
 	},
 }
 
+var openAPICmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Print the OpenAPI specification of the server API",
+	Long: `Print the OpenAPI 3 specification of the server API, as served at /openapi.json,
+for generating clients in other languages.`,
+	Example: `  comanda server openapi > openapi.json`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spec, err := server.OpenAPISpec(getVersionFromFile())
+		if err != nil {
+			return fmt.Errorf("error generating specification: %w", err)
+		}
+		fmt.Println(string(spec))
+		return nil
+	},
+}
+
 var configureServerCmd = &cobra.Command{
 	Use:   "configure",
 	Short: "Configure server settings",
@@ -66,6 +85,25 @@ var showServerCmd = &cobra.Command{
 		if server.BearerToken != "" {
 			fmt.Printf("Bearer Token: %s\n", server.BearerToken)
 		}
+		fmt.Printf("Run Queue: %d workers, up to %d waiting\n", server.Queue.WorkerCount(), server.Queue.MaxQueued())
+		if len(server.APIKeys) > 0 {
+			fmt.Printf("API Keys: %d (see 'comanda server keys list')\n", len(server.APIKeys))
+		}
+		if len(server.Workspaces) > 0 {
+			fmt.Printf("Workspaces: %d (see 'comanda server workspaces list')\n", len(server.Workspaces))
+		}
+		if len(server.Triggers) > 0 {
+			fmt.Printf("Webhook Triggers: %d (see 'comanda server triggers list')\n", len(server.Triggers))
+		}
+		if len(server.MailTriggers) > 0 {
+			fmt.Printf("Mail Triggers: %d\n", len(server.MailTriggers))
+		}
+		if server.JWT != nil {
+			fmt.Printf("JWT Bearer Tokens: accepted (issuer: %s, audience: %s)\n", orDash(server.JWT.Issuer), orDash(server.JWT.Audience))
+		}
+		if server.OIDC != nil {
+			fmt.Printf("OIDC Sign-In: %s (client: %s, %d role(s))\n", server.OIDC.Issuer, server.OIDC.ClientID, len(server.OIDC.Roles))
+		}
 
 		// Display CORS configuration
 		fmt.Println("\nCORS Configuration:")
@@ -399,5 +437,6 @@ func init() {
 	serverCmd.AddCommand(toggleAuthCmd)
 	serverCmd.AddCommand(newTokenCmd)
 	serverCmd.AddCommand(corsCmd)
+	serverCmd.AddCommand(openAPICmd)
 	rootCmd.AddCommand(serverCmd)
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Summary flag: how to print the per-step summary after a run
+var summaryFormat string
+
+// Formats of the per-step summary
+const (
+	summaryTable = "table"
+	summaryJSON  = "json"
+	summaryNone  = "none"
+)
+
+// runSummary is the per-step summary of a run as --summary json prints it
+type runSummary struct {
+	Workflow string                  `json:"workflow"`
+	Steps    []processor.StepSummary `json:"steps"`
+	Total    processor.StepSummary   `json:"total"`
+}
+
+// checkSummaryFormat rejects unknown --summary values before anything runs
+func checkSummaryFormat() error {
+	switch summaryFormat {
+	case summaryTable, summaryJSON, summaryNone:
+		return nil
+	}
+	return fmt.Errorf("unknown --summary format '%s': use table, json or none", summaryFormat)
+}
+
+// summarize totals the steps a run finished
+func summarize(workflow string, steps []processor.StepSummary) runSummary {
+	summary := runSummary{Workflow: workflow, Steps: steps}
+	summary.Total.Name = "total"
+	summary.Total.Status = processor.StepSucceeded
+	for _, step := range steps {
+		if step.Status == processor.StepFailed {
+			summary.Total.Status = processor.StepFailed
+		}
+		summary.Total.DurationMS += step.DurationMS
+		summary.Total.PromptTokens += step.PromptTokens
+		summary.Total.CompletionTokens += step.CompletionTokens
+		summary.Total.Retries += step.Retries
+		summary.Total.CacheHits += step.CacheHits
+		summary.Total.Cost += step.Cost
+	}
+	if summary.Steps == nil {
+		summary.Steps = []processor.StepSummary{}
+	}
+	return summary
+}
+
+// printSummary writes the per-step summary of a run in the --summary
+// format. The table is left out in quiet mode; JSON, asked for explicitly,
+// is not.
+func printSummary(out io.Writer, workflow string, proc *processor.Processor) {
+	summary := summarize(workflow, proc.Summary())
+	switch summaryFormat {
+	case summaryJSON:
+		if err := printJSON(out, summary); err != nil {
+			fmt.Fprintf(out, "Warning: %v\n", err)
+		}
+	case summaryTable:
+		if quiet || len(summary.Steps) == 0 {
+			return
+		}
+		fmt.Fprintln(out)
+		printSummaryTable(out, summary)
+	}
+}
+
+// printSummaryTable writes one line per step followed by the totals
+func printSummaryTable(out io.Writer, summary runSummary) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tMODEL\tSTATUS\tDURATION\tPROMPT\tCOMPLETION\tRETRIES\tCACHE HITS\tCOST")
+	line := func(s processor.StepSummary) {
+		model := s.Model
+		if model == "" {
+			model = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t~%d\t~%d\t%d\t%d\t%s\n", s.Name, model, s.Status,
+			formatMillis(s.DurationMS), s.PromptTokens, s.CompletionTokens, s.Retries, s.CacheHits, formatCost(s.Cost))
+	}
+	for _, step := range summary.Steps {
+		line(step)
+	}
+	line(summary.Total)
+	w.Flush()
+}
+
+// formatMillis renders a duration in milliseconds like runDuration does
+func formatMillis(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(100 * time.Millisecond).String()
+}
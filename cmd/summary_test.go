@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestSummarize(t *testing.T) {
+	steps := []processor.StepSummary{
+		{Name: "fetch", Status: processor.StepSucceeded, DurationMS: 1200, CacheHits: 2},
+		{Name: "review", Model: "gpt-4o", Status: processor.StepFailed, DurationMS: 3400,
+			PromptTokens: 1000, CompletionTokens: 200, Retries: 1, Cost: 0.0045, Error: "rate limited"},
+	}
+	summary := summarize("review.yaml", steps)
+	total := summary.Total
+	if total.Status != processor.StepFailed || total.DurationMS != 4600 || total.PromptTokens != 1000 ||
+		total.Retries != 1 || total.CacheHits != 2 || total.Cost != 0.0045 {
+		t.Errorf("total = %+v", total)
+	}
+
+	var out bytes.Buffer
+	printSummaryTable(&out, summary)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("table has %d lines, want 4:\n%s", len(lines), out.String())
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "review gpt-4o failed 3.4s ~1000 ~200 1 0 $0.0045" {
+		t.Errorf("step line = %q", lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "total") {
+		t.Errorf("last line = %q, want the totals", lines[3])
+	}
+}
+
+func TestPrintSummaryJSON(t *testing.T) {
+	previous := summaryFormat
+	summaryFormat = summaryJSON
+	t.Cleanup(func() { summaryFormat = previous })
+
+	var out bytes.Buffer
+	printSummary(&out, "review.yaml", processor.NewProcessor(&processor.DSLConfig{}, nil, nil, false))
+	var decoded runSummary
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if decoded.Workflow != "review.yaml" || decoded.Steps == nil || decoded.Total.Name != "total" {
+		t.Errorf("summary = %+v", decoded)
+	}
+
+	summaryFormat = "yaml"
+	if err := checkSummaryFormat(); err == nil {
+		t.Error("checkSummaryFormat() accepted yaml")
+	}
+}
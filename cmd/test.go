@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/workflowtest"
+)
+
+// Test command flags
+var testMode string
+var testUpdate bool
+
+var testCmd = &cobra.Command{
+	Use:   "test [files or directories...]",
+	Short: "Run workflows against recorded responses and check their outputs",
+	Long: `Run workflows with recorded (or mock) provider responses and compare each
+step's output with its golden file and assertions, so workflow changes that
+alter behavior are caught in CI without calling any provider.
+
+Test data for a workflow foo.yaml lives in testdata/foo/ next to it:
+  cassette.json      provider responses, written with --mode record
+  golden/<step>.txt  expected step outputs, written with --update
+  assertions.yaml    optional checks, e.g. summarize: [{contains: "Risks"}]
+
+Directories are searched for workflows that have a testdata directory; the
+default is the current directory.
+
+Examples:
+  comanda test --mode record --update review.yaml  # Record responses and bless outputs
+  comanda test                                     # Replay and compare
+  comanda test --mode mock --update flows/         # Test plumbing with mock responses`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		workflows, err := findTestWorkflows(args)
+		if err != nil {
+			return err
+		}
+		if len(workflows) == 0 {
+			return fmt.Errorf("no workflows with test data found (test data for foo.yaml goes in testdata/foo/)")
+		}
+
+		opts := workflowtest.Options{Mode: testMode, Update: testUpdate, EnvConfig: envConfig, Verbose: verbose}
+		failed := 0
+		for _, workflow := range workflows {
+			var result *workflowtest.Result
+			discardStdout(!verbose, func() {
+				result = workflowtest.Run(workflow, opts)
+			})
+			if !printTestResult(os.Stdout, result) {
+				failed++
+			}
+		}
+
+		fmt.Printf("\n%d passed, %d failed\n", len(workflows)-failed, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d of %d workflow test(s) failed", failed, len(workflows))
+		}
+		return nil
+	},
+}
+
+// findTestWorkflows expands the arguments into workflow files. Files are
+// always included; directories contribute workflows that have test data.
+func findTestWorkflows(args []string) ([]string, error) {
+	var workflows []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			workflows = append(workflows, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != arg && (d.Name() == "testdata" || strings.HasPrefix(d.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			ext := filepath.Ext(path)
+			if (ext == ".yaml" || ext == ".yml") && workflowtest.HasTestData(path) {
+				workflows = append(workflows, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error searching %s: %w", arg, err)
+		}
+	}
+	sort.Strings(workflows)
+	return workflows, nil
+}
+
+// discardStdout runs fn with os.Stdout sent to the null device, so step
+// outputs written to STDOUT don't clutter the test report
+func discardStdout(discard bool, fn func()) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if !discard || err != nil {
+		fn()
+		return
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+	fn()
+}
+
+// printTestResult writes a workflow's result and reports whether it passed
+func printTestResult(out io.Writer, result *workflowtest.Result) bool {
+	passed := result.Passed()
+	status := "PASS"
+	if !passed {
+		status = "FAIL"
+	}
+	fmt.Fprintf(out, "%s  %s (%d step(s))\n", status, result.Workflow, len(result.Steps))
+	if result.Err != nil {
+		fmt.Fprintf(out, "  error: %v\n", result.Err)
+	}
+	for _, step := range result.Steps {
+		if step.Status != workflowtest.StatusPass {
+			fmt.Fprintf(out, "  step '%s': %s\n", step.Name, step.Message)
+		}
+	}
+	return passed
+}
+
+func init() {
+	testCmd.Flags().StringVar(&testMode, "mode", workflowtest.ModeReplay, "Provider responses: replay (from the cassette), record (call providers) or mock")
+	testCmd.Flags().BoolVar(&testUpdate, "update", false, "Rewrite golden files with the current step outputs")
+	testCmd.ValidArgsFunction = completeWorkflowArgs(0)
+	rootCmd.AddCommand(testCmd)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/telemetry"
+)
+
+// stopTracing flushes and stops the trace exporter started by setupTracing
+var stopTracing = func(context.Context) error { return nil }
+
+// setupTracing starts exporting traces when the env config's tracing
+// section or the OTEL_EXPORTER_OTLP_* environment variables enable it
+func setupTracing() error {
+	stop, err := telemetry.Setup(context.Background(), envConfig.TracingSettings(), getVersionFromFile())
+	if err != nil {
+		return err
+	}
+	stopTracing = stop
+	return nil
+}
+
+// flushTraces exports the spans still buffered, waiting a few seconds at most
+func flushTraces() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := stopTracing(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to export traces: %v\n", err)
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Trigger flags
+var triggerWorkflow string
+var triggerSource string
+var triggerSecret string
+var triggerEvents []string
+var triggerParams []string
+var triggerWorkspace string
+
+var triggersCmd = &cobra.Command{
+	Use:   "triggers",
+	Short: "Manage webhook triggers",
+	Long: `Manage the triggers that start stored workflows when another service sends a
+webhook. Each trigger listens at /hooks/<name>, checks the payload's signature
+with its secret, and passes the payload to the workflow as its input, along with
+any params read from payload fields.`,
+}
+
+var triggersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List webhook triggers",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		serverConfig := envConfig.GetServerConfig()
+		if len(serverConfig.Triggers) == 0 {
+			fmt.Println("No triggers configured.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSOURCE\tWORKFLOW\tEVENTS\tWORKSPACE\tPATH")
+		for _, t := range serverConfig.Triggers {
+			source := t.Source
+			if source == "" {
+				source = config.TriggerGeneric
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t/hooks/%s\n", t.Name, source, t.Workflow,
+				orDash(strings.Join(t.Events, ",")), orDash(t.Workspace), t.Name)
+		}
+		w.Flush()
+	},
+}
+
+var triggersAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Create a webhook trigger",
+	Long: `Create a trigger that runs a workflow when a webhook arrives at /hooks/<name>.
+Without --secret a random secret is generated and printed; give it to the
+sending service. Stripe generates its own signing secret, so pass that one.`,
+	Example: `  comanda server triggers add deploys --source github --workflow release-notes \
+    --event push --param repo=repository.full_name --param branch=ref
+  comanda server triggers add payments --source stripe --secret whsec_... \
+    --workflow receipt --event checkout.session.completed --param customer=data.object.customer_email`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.ValidateTriggerName(name); err != nil {
+			return err
+		}
+		if triggerWorkflow == "" {
+			return fmt.Errorf("--workflow is required")
+		}
+		if !config.ValidTriggerSource(triggerSource) {
+			return fmt.Errorf("invalid source '%s': use github, stripe or generic", triggerSource)
+		}
+		if triggerSource == config.TriggerStripe && triggerSecret == "" {
+			return fmt.Errorf("--secret is required for Stripe triggers: use the endpoint's signing secret")
+		}
+		params := make(map[string]string)
+		for _, p := range triggerParams {
+			param, path, ok := strings.Cut(p, "=")
+			if !ok || param == "" || path == "" {
+				return fmt.Errorf("invalid param '%s': use name=payload.path", p)
+			}
+			params[param] = path
+		}
+		serverConfig := envConfig.GetServerConfig()
+		if serverConfig.FindTrigger(name) != nil {
+			return fmt.Errorf("a trigger named '%s' already exists", name)
+		}
+		if triggerWorkspace != "" && serverConfig.FindWorkspace(triggerWorkspace) == nil {
+			return fmt.Errorf("no workspace named '%s'", triggerWorkspace)
+		}
+		secret := triggerSecret
+		if secret == "" {
+			var err error
+			if secret, err = config.GenerateBearerToken(); err != nil {
+				return fmt.Errorf("error generating secret: %w", err)
+			}
+		}
+		serverConfig.Triggers = append(serverConfig.Triggers, config.Trigger{
+			Name:      name,
+			Workflow:  triggerWorkflow,
+			Source:    triggerSource,
+			Secret:    secret,
+			Events:    triggerEvents,
+			Params:    params,
+			Workspace: triggerWorkspace,
+		})
+		envConfig.UpdateServerConfig(*serverConfig)
+		if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+			return fmt.Errorf("error saving configuration: %w", err)
+		}
+		fmt.Printf("Created trigger '%s' at /hooks/%s running workflow '%s'\n", name, name, triggerWorkflow)
+		if triggerSecret == "" {
+			fmt.Printf("Secret: %s\n", secret)
+		}
+		if len(params) > 0 {
+			names := make([]string, 0, len(params))
+			for param := range params {
+				names = append(names, param)
+			}
+			sort.Strings(names)
+			for _, param := range names {
+				fmt.Printf("  params.%s <- %s\n", param, params[param])
+			}
+		}
+		return nil
+	},
+}
+
+var triggersRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a webhook trigger",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serverConfig := envConfig.GetServerConfig()
+		var kept []config.Trigger
+		for _, t := range serverConfig.Triggers {
+			if t.Name != args[0] {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == len(serverConfig.Triggers) {
+			return fmt.Errorf("no trigger named '%s'", args[0])
+		}
+		serverConfig.Triggers = kept
+		envConfig.UpdateServerConfig(*serverConfig)
+		if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+			return fmt.Errorf("error saving configuration: %w", err)
+		}
+		fmt.Printf("Removed trigger '%s'\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	triggersAddCmd.Flags().StringVar(&triggerWorkflow, "workflow", "", "Stored workflow to run")
+	triggersAddCmd.Flags().StringVar(&triggerSource, "source", config.TriggerGeneric, "Webhook sender: github, stripe or generic")
+	triggersAddCmd.Flags().StringVar(&triggerSecret, "secret", "", "Signing secret (generated when omitted)")
+	triggersAddCmd.Flags().StringSliceVar(&triggerEvents, "event", nil, "Event that starts a run (repeatable; any event when omitted)")
+	triggersAddCmd.Flags().StringArrayVar(&triggerParams, "param", nil, "Workflow param read from a payload field, as name=path (repeatable)")
+	triggersAddCmd.Flags().StringVar(&triggerWorkspace, "workspace", "", "Run the workflow in this workspace")
+	triggersCmd.AddCommand(triggersListCmd, triggersAddCmd, triggersRemoveCmd)
+	serverCmd.AddCommand(triggersCmd)
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/selfupdate"
+)
+
+// releaseRepo is the GitHub repository releases are published to
+const releaseRepo = "kris-hansen/comanda"
+
+// releaseKey is the base64 encoded PEM public key that release checksums are
+// signed with. It is set at build time with -ldflags; when set, upgrades
+// require a valid signature.
+var releaseKey string
+
+// Upgrade flags
+var upgradeCheck bool
+var upgradeVersion string
+var upgradeVerifyKey string
+var upgradeForce bool
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Update comanda to the latest release",
+	Long: `Download the latest release from GitHub (or the one given with --version),
+check the binary against the release's checksums.txt and replace the running
+executable with it. When the build carries a release key, or --verify-key
+points to one, the checksums must also be signed by that key.
+
+With --check nothing is downloaded: the command prints the installed and
+latest versions and exits non-zero when an update is available, for CI.
+Installs managed by Homebrew are left to 'brew upgrade'. Set GITHUB_TOKEN to
+avoid GitHub API rate limits.`,
+	Example: `  comanda upgrade
+  comanda upgrade --check
+  comanda upgrade --version v0.0.70 --verify-key comanda-release.pub`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		current := getVersionFromFile()
+		updater := selfupdate.New(releaseRepo)
+		release, err := updater.Release(upgradeVersion)
+		if err != nil {
+			return err
+		}
+		known := selfupdate.ValidVersion(current)
+		newer := !known || selfupdate.CompareVersions(current, release.Tag) < 0
+
+		if upgradeCheck {
+			fmt.Printf("Installed version: %s\n", current)
+			fmt.Printf("Latest version:    %s\n", release.Tag)
+			if !known {
+				return fmt.Errorf("the installed version is unknown; run 'comanda upgrade' to install %s", release.Tag)
+			}
+			if newer {
+				return fmt.Errorf("comanda %s is available (run 'comanda upgrade')", release.Tag)
+			}
+			fmt.Println("comanda is up to date")
+			return nil
+		}
+		// An explicit --version may also be a downgrade
+		if !newer && upgradeVersion == "" && !upgradeForce {
+			fmt.Printf("comanda %s is up to date\n", current)
+			return nil
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("cannot find the comanda executable: %w", err)
+		}
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		if strings.Contains(filepath.ToSlash(exe), "/Cellar/") {
+			return fmt.Errorf("comanda was installed with Homebrew; run 'brew upgrade comanda' instead")
+		}
+
+		binary, err := downloadRelease(updater, release)
+		if err != nil {
+			return err
+		}
+		if err := selfupdate.Replace(exe, binary); err != nil {
+			return fmt.Errorf("error replacing %s: %w (try again with permission to write it)", exe, err)
+		}
+		// Keep a VERSION file next to the binary, which takes precedence, in step
+		versionFile := filepath.Join(filepath.Dir(exe), "VERSION")
+		if _, err := os.Stat(versionFile); err == nil {
+			os.WriteFile(versionFile, []byte(strings.TrimPrefix(release.Tag, "v")+"\n"), 0644)
+		}
+		fmt.Printf("Upgraded comanda from %s to %s (%s)\n", current, release.Tag, exe)
+		return nil
+	},
+}
+
+// downloadRelease downloads the binary for this platform and verifies it
+// against the release's checksums, and their signature when a key is known
+func downloadRelease(updater *selfupdate.Updater, release *selfupdate.Release) ([]byte, error) {
+	name := selfupdate.CurrentAssetName()
+	asset, ok := release.Find(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s binary", release.Tag, name)
+	}
+	sumsAsset, ok := release.Find(selfupdate.ChecksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s to verify the download with", release.Tag, selfupdate.ChecksumsAsset)
+	}
+	checksums, err := updater.Download(sumsAsset)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := releasePublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		sigAsset, ok := release.Find(selfupdate.SignatureAsset)
+		if !ok {
+			return nil, fmt.Errorf("release %s is not signed", release.Tag)
+		}
+		signature, err := updater.Download(sigAsset)
+		if err != nil {
+			return nil, err
+		}
+		if err := selfupdate.VerifySignature(checksums, signature, key); err != nil {
+			return nil, err
+		}
+		fmt.Println("Release signature verified")
+	}
+
+	fmt.Printf("Downloading %s %s...\n", name, release.Tag)
+	binary, err := updater.Download(asset)
+	if err != nil {
+		return nil, err
+	}
+	if err := selfupdate.VerifyChecksum(checksums, name, binary); err != nil {
+		return nil, err
+	}
+	fmt.Println("Checksum verified")
+	return binary, nil
+}
+
+// releasePublicKey returns the PEM key release signatures are checked with:
+// --verify-key, else the key built into the binary, else none
+func releasePublicKey() ([]byte, error) {
+	if upgradeVerifyKey != "" {
+		data, err := os.ReadFile(upgradeVerifyKey)
+		if err != nil {
+			return nil, fmt.Errorf("error reading release public key: %w", err)
+		}
+		return data, nil
+	}
+	if releaseKey == "" {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(releaseKey)
+	if err != nil {
+		return nil, fmt.Errorf("built-in release key is not valid base64: %w", err)
+	}
+	return data, nil
+}
+
+func init() {
+	upgradeCmd.Flags().BoolVar(&upgradeCheck, "check", false, "Only report whether an update is available; exits non-zero if one is")
+	upgradeCmd.Flags().StringVar(&upgradeVersion, "version", "", "Install this release instead of the latest (e.g. v0.0.70)")
+	upgradeCmd.Flags().StringVar(&upgradeVerifyKey, "verify-key", "", "Require release checksums signed by the key matching this PEM public key")
+	upgradeCmd.Flags().BoolVar(&upgradeForce, "force", false, "Reinstall even when already up to date")
+	rootCmd.AddCommand(upgradeCmd)
+}
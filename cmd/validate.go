@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Validate command output format
+var validateFormat string
+
+// fileIssue is a validation issue tagged with the workflow file it was found in
+type fileIssue struct {
+	File string `json:"file"`
+	processor.ValidationIssue
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [files...]",
+	Short: "Check workflow files for errors without running them",
+	Long: `Parse each workflow file and check step fields and configuration, referenced
+input files and glob patterns, models and provider API keys, and dependencies
+between steps. Exits non-zero if any problem is found, so it can be used as a
+pre-commit hook.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if validateFormat != "text" && validateFormat != "json" {
+			return fmt.Errorf("unknown format '%s' (expected text or json)", validateFormat)
+		}
+
+		issues := []fileIssue{}
+		for _, file := range args {
+			for _, issue := range validateWorkflowFile(file) {
+				issues = append(issues, fileIssue{File: file, ValidationIssue: issue})
+			}
+		}
+
+		if validateFormat == "json" {
+			data, err := json.MarshalIndent(issues, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error encoding validation results: %w", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			failed := make(map[string]bool)
+			for _, issue := range issues {
+				failed[issue.File] = true
+				fmt.Printf("%s: %s\n", issue.File, issue)
+			}
+			for _, file := range args {
+				if !failed[file] {
+					fmt.Printf("%s: OK\n", file)
+				}
+			}
+		}
+
+		if len(issues) > 0 {
+			return fmt.Errorf("validation failed with %d issue(s)", len(issues))
+		}
+		return nil
+	},
+}
+
+// validateWorkflowFile collects the issues for a single workflow file
+func validateWorkflowFile(file string) []processor.ValidationIssue {
+	yamlFile, dslConfig, err := readWorkflowFile(file)
+	if err != nil {
+		return []processor.ValidationIssue{{Message: err.Error()}}
+	}
+	issues, err := processor.CheckStepFields(yamlFile)
+	if err != nil {
+		return []processor.ValidationIssue{{Message: fmt.Sprintf("error parsing YAML: %v", err)}}
+	}
+	proc := processor.NewProcessor(dslConfig, envConfig, &config.ServerConfig{Enabled: false}, verbose, runtimeDir)
+	return append(issues, proc.Validate()...)
+}
+
+// readWorkflowFile reads and parses a workflow file for commands that inspect
+// a workflow without running it
+func readWorkflowFile(file string) ([]byte, *processor.DSLConfig, error) {
+	yamlFile, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading YAML file %s: %w", file, err)
+	}
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(yamlFile, &dslConfig); err != nil {
+		return nil, nil, fmt.Errorf("error parsing YAML file %s: %w", file, err)
+	}
+	return yamlFile, &dslConfig, nil
+}
+
+// readWorkflowWithParams reads a workflow file with its parameters bound
+func readWorkflowWithParams(file string, params map[string]string) (*processor.DSLConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading YAML file %s: %w", file, err)
+	}
+	if data, err = processor.BindParams(data, params); err != nil {
+		return nil, err
+	}
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(data, &dslConfig); err != nil {
+		return nil, fmt.Errorf("error parsing YAML file %s: %w", file, err)
+	}
+	return &dslConfig, nil
+}
+
+func init() {
+	validateCmd.Flags().StringVar(&validateFormat, "format", "text", "Output format: text or json")
+	validateCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory that input paths are relative to")
+	validateCmd.ValidArgsFunction = completeWorkflowArgs(0)
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+// Variants command flags
+var variantsLast string
+var variantsJSON bool
+
+var variantsCmd = &cobra.Command{
+	Use:   "variants [workflow]",
+	Short: "Compare the prompt variants of workflow steps from the run history",
+	Long: `Compare the quality and cost of each prompt variant of the steps that declare
+variants, over the recorded runs. Quality comes from the judge scores of
+'comanda eval' runs; cost and latency come from every run. Variants are
+listed best first, so the one to promote is at the top of each step.
+
+Examples:
+  comanda variants                  # Every workflow, last 30 days
+  comanda variants reply.yaml --last all
+  comanda variants --json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		window, err := parseAge(variantsLast)
+		if err != nil {
+			return err
+		}
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		runs, err := store.List()
+		if err != nil {
+			return err
+		}
+		if window > 0 {
+			runs = history.Since(runs, time.Now().Add(-window))
+		}
+		if len(args) == 1 {
+			var matching []history.Run
+			for _, run := range runs {
+				if strings.Contains(run.Workflow, args[0]) {
+					matching = append(matching, run)
+				}
+			}
+			runs = matching
+		}
+
+		stats := history.CompareVariants(runs)
+		if variantsJSON {
+			return printJSON(os.Stdout, stats)
+		}
+		if len(stats) == 0 {
+			fmt.Println("No runs of steps with prompt variants recorded in this period.")
+			return nil
+		}
+		printVariantTable(os.Stdout, stats)
+		return nil
+	},
+}
+
+// printVariantTable writes one line per step variant
+func printVariantTable(out io.Writer, stats []history.VariantStats) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKFLOW\tSTEP\tVARIANT\tRUNS\tFAILED\tAVG LATENCY\tAVG COST\tSCORED\tMEAN SCORE\tPASSED")
+	for _, s := range stats {
+		meanScore, passed := "-", "-"
+		if s.Scored > 0 {
+			meanScore = fmt.Sprintf("%.2f", s.MeanScore)
+			passed = fmt.Sprintf("%d (%.0f%%)", s.Passed, 100*float64(s.Passed)/float64(s.Scored))
+		}
+		latency := (time.Duration(s.LatencyMS) * time.Millisecond).Round(100 * time.Millisecond)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%d\t%s\t%s\n", filepath.Base(s.Workflow), s.Step, s.Variant,
+			s.Runs, s.Failed, latency, formatCost(s.Cost), s.Scored, meanScore, passed)
+	}
+	w.Flush()
+}
+
+func init() {
+	variantsCmd.Flags().StringVar(&variantsLast, "last", "30d", "Period to report, such as 7d, 2w, 1m or all")
+	variantsCmd.Flags().BoolVar(&variantsJSON, "json", false, "Print the comparison as JSON")
+	variantsCmd.ValidArgsFunction = completeWorkflowArgs(1)
+	rootCmd.AddCommand(variantsCmd)
+}
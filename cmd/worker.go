@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/worker"
+)
+
+// Worker flags
+var workerJoin string
+var workerToken string
+var workerName string
+var workerLabels []string
+var workerDir string
+var workerSlots int
+var workerTLS bool
+var workerCA string
+var workerCert string
+var workerKey string
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Execute a server's runs on this machine",
+	Long: `Join a comanda server as a remote worker and execute runs of workflows whose
+runs_on labels this worker carries, using the providers configured here. The
+server needs a remoteWorkers section; --join is its host and worker port, and
+the token is the one that section sets (or COMANDA_WORKER_TOKEN).
+
+Each run works in its own directory under --dir with the input files the
+server sends, and the files its steps write are sent back. On SIGINT or
+SIGTERM the worker stops taking runs and finishes the ones it has.
+
+Examples:
+  comanda worker --join comanda.example.com:9090 --labels gpu,ollama
+  comanda worker --join 10.0.0.5:9090 --labels gpu --slots 2 --tls --ca ca.pem`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if workerJoin == "" {
+			return fmt.Errorf("--join is required")
+		}
+		token := workerToken
+		if token == "" {
+			token = os.Getenv("COMANDA_WORKER_TOKEN")
+		}
+		if token == "" {
+			return fmt.Errorf("a token is required: use --token or set COMANDA_WORKER_TOKEN")
+		}
+		name := workerName
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		dir := workerDir
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "comanda-worker")
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creating work directory: %w", err)
+		}
+		creds, err := workerCredentials()
+		if err != nil {
+			return err
+		}
+		client, err := worker.NewClient(workerJoin, token, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return fmt.Errorf("error connecting to %s: %w", workerJoin, err)
+		}
+		defer client.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		logger := log.New(config.ConsoleAndLog(os.Stderr), "[worker] ", log.LstdFlags)
+		logger.Printf("Worker %s joining %s with labels %v", name, workerJoin, workerLabels)
+		agent := &worker.Agent{
+			Client:    client,
+			Name:      name,
+			Labels:    workerLabels,
+			EnvConfig: envConfig,
+			Dir:       dir,
+			Slots:     workerSlots,
+			Logf:      logger.Printf,
+		}
+		return agent.Run(ctx)
+	},
+}
+
+// workerCredentials returns how the worker's connection is secured: TLS
+// trusting --ca or the system's roots, with a client certificate when the
+// server asks for one, or no TLS at all
+func workerCredentials() (credentials.TransportCredentials, error) {
+	if !workerTLS && workerCA == "" {
+		return insecure.NewCredentials(), nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if workerCA != "" {
+		pem, err := os.ReadFile(workerCA)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", workerCA)
+		}
+	}
+	if workerCert != "" || workerKey != "" {
+		cert, err := tls.LoadX509KeyPair(workerCert, workerKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+func init() {
+	workerCmd.Flags().StringVar(&workerJoin, "join", "", "Server to join, as host:port of its worker port")
+	workerCmd.Flags().StringVar(&workerToken, "token", "", "Token the server's remoteWorkers section sets (default: COMANDA_WORKER_TOKEN)")
+	workerCmd.Flags().StringVar(&workerName, "name", "", "Name to report runs under (default: the host name)")
+	workerCmd.Flags().StringSliceVar(&workerLabels, "labels", nil, "Labels this worker carries, matched against runs_on")
+	workerCmd.Flags().StringVar(&workerDir, "dir", "", "Directory runs work in (default: a directory under the system temp directory)")
+	workerCmd.Flags().IntVar(&workerSlots, "slots", 1, "Runs to execute at once")
+	workerCmd.Flags().BoolVar(&workerTLS, "tls", false, "Connect over TLS, for servers serving HTTPS")
+	workerCmd.Flags().StringVar(&workerCA, "ca", "", "CA certificate to trust the server with (implies --tls)")
+	workerCmd.Flags().StringVar(&workerCert, "cert", "", "Client certificate, for servers that require one")
+	workerCmd.Flags().StringVar(&workerKey, "key", "", "Client certificate's key")
+	rootCmd.AddCommand(workerCmd)
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Workspace flags
+var workspaceDataDir string
+var workspaceRunsPerDay int
+var workspaceWorkers int
+
+var workspacesCmd = &cobra.Command{
+	Use:   "workspaces",
+	Short: "Manage server workspaces",
+	Long: `Manage the workspaces that isolate teams sharing one server. Each workspace has
+its own workflows, runs, uploads and runtime directories, and can have its own
+provider credentials and run limits. API keys created with --workspace, and JWTs
+carrying a workspace claim, only see their workspace.`,
+}
+
+var workspacesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List server workspaces",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		serverConfig := envConfig.GetServerConfig()
+		if len(serverConfig.Workspaces) == 0 {
+			fmt.Println("No workspaces configured.")
+			return
+		}
+		keys := make(map[string]int)
+		for _, key := range serverConfig.APIKeys {
+			keys[key.Workspace]++
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tAPI KEYS\tRUNS/DAY\tDATA DIRECTORY")
+		for i := range serverConfig.Workspaces {
+			ws := &serverConfig.Workspaces[i]
+			limit := "-"
+			if ws.RunsPerDay > 0 {
+				limit = fmt.Sprint(ws.RunsPerDay)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", ws.Name, keys[ws.Name], limit, serverConfig.WorkspaceDataDir(ws))
+		}
+		w.Flush()
+	},
+}
+
+var workspacesAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Create a server workspace",
+	Long: `Create a workspace. Its data lives in workspaces/<name> inside the server's data
+directory unless --data-dir is given. Add provider credentials for the
+workspace under its 'providers' entry in the environment file.`,
+	Example: `  comanda server workspaces add marketing --runs-per-day 200
+  comanda server keys add marketing-ci --workspace marketing --scope run`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.ValidateWorkspaceName(name); err != nil {
+			return err
+		}
+		serverConfig := envConfig.GetServerConfig()
+		if serverConfig.FindWorkspace(name) != nil {
+			return fmt.Errorf("a workspace named '%s' already exists", name)
+		}
+		ws := config.Workspace{
+			Name:       name,
+			DataDir:    workspaceDataDir,
+			RunsPerDay: workspaceRunsPerDay,
+			Queue:      config.Queue{Workers: workspaceWorkers},
+		}
+		serverConfig.Workspaces = append(serverConfig.Workspaces, ws)
+		envConfig.UpdateServerConfig(*serverConfig)
+		if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+			return fmt.Errorf("error saving configuration: %w", err)
+		}
+		fmt.Printf("Created workspace '%s' in %s\n", name, serverConfig.WorkspaceDataDir(&ws))
+		return nil
+	},
+}
+
+var workspacesRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a server workspace",
+	Long: `Remove a workspace from the configuration. Its data directory is left in place.
+API keys confined to the workspace must be removed first.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		serverConfig := envConfig.GetServerConfig()
+		ws := serverConfig.FindWorkspace(name)
+		if ws == nil {
+			return fmt.Errorf("no workspace named '%s'", name)
+		}
+		for _, key := range serverConfig.APIKeys {
+			if key.Workspace == name {
+				return fmt.Errorf("API key '%s' belongs to workspace '%s'; remove it first", key.Name, name)
+			}
+		}
+		dataDir := serverConfig.WorkspaceDataDir(ws)
+		var kept []config.Workspace
+		for _, w := range serverConfig.Workspaces {
+			if w.Name != name {
+				kept = append(kept, w)
+			}
+		}
+		serverConfig.Workspaces = kept
+		envConfig.UpdateServerConfig(*serverConfig)
+		if err := config.SaveEnvConfig(config.GetEnvPath(), envConfig); err != nil {
+			return fmt.Errorf("error saving configuration: %w", err)
+		}
+		fmt.Printf("Removed workspace '%s'; its data remains in %s\n", name, dataDir)
+		return nil
+	},
+}
+
+func init() {
+	workspacesAddCmd.Flags().StringVar(&workspaceDataDir, "data-dir", "", "Directory for the workspace's data")
+	workspacesAddCmd.Flags().IntVar(&workspaceRunsPerDay, "runs-per-day", 0, "Runs the workspace may start each day (0 for no limit)")
+	workspacesAddCmd.Flags().IntVar(&workspaceWorkers, "workers", 0, "Runs the workspace may execute at once (default 4)")
+	workspacesCmd.AddCommand(workspacesListCmd, workspacesAddCmd, workspacesRemoveCmd)
+	serverCmd.AddCommand(workspacesCmd)
+}
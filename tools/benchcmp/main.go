@@ -0,0 +1,205 @@
+// Command benchcmp compares two runs of Go benchmarks and fails when the
+// new run is slower than the baseline by more than a threshold. It is the
+// gate behind make bench-compare.
+//
+// Each file holds the output of go test -bench, ideally with -count above
+// one; the median of a benchmark's runs is compared, so a single noisy run
+// doesn't fail the gate. Benchmarks only in one file are listed but not
+// compared.
+//
+//	benchcmp [-threshold 10] [-allocs] base.txt head.txt
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Units compared; the others, such as MB/s, are derived from them
+const (
+	unitTime   = "ns/op"
+	unitBytes  = "B/op"
+	unitAllocs = "allocs/op"
+)
+
+// results holds each benchmark's measurements by unit, across runs
+type results map[string]map[string][]float64
+
+// procSuffix is the GOMAXPROCS suffix go test adds to benchmark names
+var procSuffix = regexp.MustCompile(`-\d+$`)
+
+// parse reads the benchmark lines of go test -bench output
+func parse(r io.Reader) (results, error) {
+	res := make(results)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue // Not a result line, such as a benchmark's log output
+		}
+		name := procSuffix.ReplaceAllString(fields[0], "")
+		if res[name] == nil {
+			res[name] = make(map[string][]float64)
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			unit := fields[i+1]
+			res[name][unit] = append(res[name][unit], value)
+		}
+	}
+	return res, scanner.Err()
+}
+
+// parseFile parses the benchmark output in path
+func parseFile(path string) (results, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return res, nil
+}
+
+// median returns the middle of values
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// change is a benchmark's median in both runs for one unit
+type change struct {
+	name, unit string
+	base, head float64
+}
+
+// delta returns the change as a percentage of the baseline
+func (c change) delta() float64 {
+	if c.base == 0 {
+		if c.head == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (c.head - c.base) / c.base * 100
+}
+
+// compare pairs the medians of the benchmarks in both runs, and lists the
+// benchmarks found in only one of them
+func compare(base, head results, units []string) (changes []change, unmatched []string) {
+	names := make(map[string]bool)
+	for name := range base {
+		names[name] = true
+	}
+	for name := range head {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		if base[name] == nil || head[name] == nil {
+			unmatched = append(unmatched, name)
+			continue
+		}
+		for _, unit := range units {
+			o, n := base[name][unit], head[name][unit]
+			if len(o) == 0 || len(n) == 0 {
+				continue
+			}
+			changes = append(changes, change{name: name, unit: unit, base: median(o), head: median(n)})
+		}
+	}
+	return changes, unmatched
+}
+
+func main() {
+	threshold := flag.Float64("threshold", 10, "Fail when a benchmark is slower by more than this percentage")
+	allocs := flag.Bool("allocs", false, "Also fail when bytes or allocations per op grow by more than the threshold")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: benchcmp [-threshold 10] [-allocs] base.txt head.txt")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	os.Exit(run(os.Stdout, flag.Arg(0), flag.Arg(1), *threshold, *allocs))
+}
+
+// run prints the comparison of the runs in basePath and headPath, and returns
+// the exit status: 1 when a benchmark regressed past threshold
+func run(out io.Writer, basePath, headPath string, threshold float64, gateAllocs bool) int {
+	base, err := parseFile(basePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	head, err := parseFile(headPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	changes, unmatched := compare(base, head, []string{unitTime, unitBytes, unitAllocs})
+	gated := map[string]bool{unitTime: true, unitBytes: gateAllocs, unitAllocs: gateAllocs}
+	var regressions []change
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if len(changes) > 0 {
+		fmt.Fprintln(w, "BENCHMARK\tUNIT\tBASE\tHEAD\tDELTA\t")
+	}
+	for _, c := range changes {
+		mark := ""
+		if gated[c.unit] && c.delta() > threshold {
+			mark = "REGRESSION"
+			regressions = append(regressions, c)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.4g\t%.4g\t%+.1f%%\t%s\n", c.name, c.unit, c.base, c.head, c.delta(), mark)
+	}
+	w.Flush()
+
+	for _, name := range unmatched {
+		where := "baseline"
+		if base[name] == nil {
+			where = "new run"
+		}
+		fmt.Fprintf(out, "%s: only in the %s, not compared\n", name, where)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "No benchmarks in common to compare.")
+		return 0
+	}
+	if len(regressions) > 0 {
+		fmt.Fprintf(out, "\n%d regression(s) over %.0f%%\n", len(regressions), threshold)
+		return 1
+	}
+	fmt.Fprintf(out, "\nNo regressions over %.0f%%\n", threshold)
+	return 0
+}
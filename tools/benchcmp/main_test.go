@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const baseOutput = `goos: linux
+pkg: github.com/kris-hansen/comanda/utils/chunker
+BenchmarkSplitFile/lines-8   	      30	  36000000 ns/op	 462.93 MB/s	54588989 B/op	  204895 allocs/op
+BenchmarkSplitFile/lines-8   	      30	  38000000 ns/op	 450.00 MB/s	54588989 B/op	  204895 allocs/op
+BenchmarkSplitFile/lines-8   	      30	  90000000 ns/op	 180.00 MB/s	54588989 B/op	  204895 allocs/op
+BenchmarkSplitFile/bytes-8   	     100	   8000000 ns/op	2075.05 MB/s	16810805 B/op	     185 allocs/op
+BenchmarkRemoved-8           	     100	      1000 ns/op
+PASS
+`
+
+func TestParseTakesMedian(t *testing.T) {
+	res, err := parse(strings.NewReader(baseOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := res["BenchmarkSplitFile/lines"]
+	if lines == nil {
+		t.Fatalf("parse() = %v, want the GOMAXPROCS suffix dropped", res)
+	}
+	if got := median(lines[unitTime]); got != 38000000 {
+		t.Errorf("median ns/op = %v, want 38000000: one slow run shouldn't count", got)
+	}
+	if got := len(lines["MB/s"]); got != 3 {
+		t.Errorf("got %d MB/s values, want 3", got)
+	}
+}
+
+func TestRunGatesRegressions(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "base.txt")
+	headPath := filepath.Join(dir, "head.txt")
+	if err := os.WriteFile(basePath, []byte(baseOutput), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(lines, bytesOp string) {
+		head := "BenchmarkSplitFile/lines-8 30 " + lines + " ns/op 54588989 B/op 204895 allocs/op\n" +
+			"BenchmarkSplitFile/bytes-8 100 8000000 ns/op " + bytesOp + " B/op 185 allocs/op\n" +
+			"BenchmarkAdded-8 100 1000 ns/op\n"
+		if err := os.WriteFile(headPath, []byte(head), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("39000000", "16810805")
+	var out bytes.Buffer
+	if status := run(&out, basePath, headPath, 10, false); status != 0 {
+		t.Errorf("run() = %d for a 2.6%% change, want 0:\n%s", status, out.String())
+	}
+	for _, want := range []string{"BenchmarkRemoved: only in the baseline", "BenchmarkAdded: only in the new run"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	write("45000000", "16810805")
+	out.Reset()
+	if status := run(&out, basePath, headPath, 10, false); status != 1 {
+		t.Errorf("run() = %d for an 18%% slowdown, want 1:\n%s", status, out.String())
+	}
+
+	// More memory only fails the gate with -allocs
+	write("38000000", "33000000")
+	if status := run(&out, basePath, headPath, 10, false); status != 0 {
+		t.Errorf("run() = %d for more B/op without -allocs, want 0", status)
+	}
+	if status := run(&out, basePath, headPath, 10, true); status != 1 {
+		t.Errorf("run() = %d for more B/op with -allocs, want 1", status)
+	}
+}
@@ -0,0 +1,204 @@
+// Package audit keeps an append-only log of what is done through the
+// server: who made each request, which runs they started with which
+// parameters, which provider calls the runs made, and what they produced.
+// Each event carries the hash of the one before it, so removing or editing
+// an event breaks the chain and is found by Verify.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the log
+const (
+	ActionRequest      = "request"       // An API request and its response status
+	ActionRunQueued    = "run.queued"    // A run was accepted, with its parameters
+	ActionProviderCall = "provider.call" // A step of a run called a model
+	ActionRunFinished  = "run.finished"  // A run finished, with what it produced
+)
+
+// Event is one entry of the audit log
+type Event struct {
+	Seq              int64             `json:"seq"`
+	Time             time.Time         `json:"time"`
+	Action           string            `json:"action"`
+	Actor            string            `json:"actor,omitempty"`     // Who the action was done for, such as an API key
+	Workspace        string            `json:"workspace,omitempty"` // The workspace it was done in, if any
+	Client           string            `json:"client,omitempty"`    // Address the request came from
+	Method           string            `json:"method,omitempty"`
+	Path             string            `json:"path,omitempty"`
+	Status           int               `json:"status,omitempty"` // HTTP status of the response
+	RunID            string            `json:"run_id,omitempty"`
+	Workflow         string            `json:"workflow,omitempty"`
+	Params           map[string]string `json:"params,omitempty"`
+	Input            *Output           `json:"input,omitempty"` // Digest of the run's input
+	Step             string            `json:"step,omitempty"`
+	Provider         string            `json:"provider,omitempty"`
+	Model            string            `json:"model,omitempty"`
+	PromptTokens     int               `json:"prompt_tokens,omitempty"`
+	CompletionTokens int               `json:"completion_tokens,omitempty"`
+	Result           string            `json:"result,omitempty"` // succeeded or failed
+	Error            string            `json:"error,omitempty"`
+	Outputs          []Output          `json:"outputs,omitempty"`
+	PrevHash         string            `json:"prev_hash"`
+	Hash             string            `json:"hash"`
+}
+
+// Output identifies something read or produced by its digest, so the log
+// proves what was produced without holding customer data itself
+type Output struct {
+	Name   string `json:"name"` // Where it went, such as STDOUT or a file path
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Digest returns the Output for content written to name
+func Digest(name string, content []byte) Output {
+	sum := sha256.Sum256(content)
+	return Output{Name: name, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+}
+
+// DigestFile returns the Output for the file at path, recorded as name
+func DigestFile(name, path string) (Output, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Output{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return Output{}, err
+	}
+	return Output{Name: name, SHA256: hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+}
+
+// hash returns the hash chaining e to the event before it
+func (e Event) hash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Filter selects events to export. Zero fields match every event.
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Actor  string
+	RunID  string
+	Action string
+}
+
+// Match reports whether e is selected by the filter
+func (f Filter) Match(e Event) bool {
+	switch {
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case f.RunID != "" && e.RunID != f.RunID:
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	}
+	return true
+}
+
+// sink is where a log's events are kept
+type sink interface {
+	append(e Event) error
+	// each calls fn with every event, in the order they were recorded
+	each(fn func(Event) error) error
+	close() error
+}
+
+// Log appends events to a sink, chaining each to the one before
+type Log struct {
+	mu   sync.Mutex
+	sink sink
+	seq  int64
+	last string // Hash of the latest event
+}
+
+// newLog returns the log kept in s, continuing its chain
+func newLog(s sink) (*Log, error) {
+	l := &Log{sink: s}
+	err := s.each(func(e Event) error {
+		l.seq, l.last = e.Seq, e.Hash
+		return nil
+	})
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends an event to the log, numbering and chaining it
+func (l *Log) Record(e Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Seq = l.seq + 1
+	e.PrevHash = l.last
+	e.Hash = e.hash()
+	if err := l.sink.append(e); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	l.seq, l.last = e.Seq, e.Hash
+	return nil
+}
+
+// Export calls fn with the events f selects, oldest first
+func (l *Log) Export(f Filter, fn func(Event) error) error {
+	return l.sink.each(func(e Event) error {
+		if !f.Match(e) {
+			return nil
+		}
+		return fn(e)
+	})
+}
+
+// ErrTampered is returned by Verify when the chain of events is broken
+var ErrTampered = errors.New("audit log chain is broken")
+
+// Verify checks that no event was changed, removed or inserted since it was
+// recorded, returning the number of events checked
+func (l *Log) Verify() (int, error) {
+	count := 0
+	var prev string
+	err := l.sink.each(func(e Event) error {
+		count++
+		if e.Seq != int64(count) {
+			return fmt.Errorf("%w: event %d found where %d was expected", ErrTampered, e.Seq, count)
+		}
+		if e.PrevHash != prev {
+			return fmt.Errorf("%w: event %d does not follow event %d", ErrTampered, e.Seq, count-1)
+		}
+		if e.Hash != e.hash() {
+			return fmt.Errorf("%w: event %d was modified", ErrTampered, e.Seq)
+		}
+		prev = e.Hash
+		return nil
+	})
+	return count, err
+}
+
+// Close closes the log
+func (l *Log) Close() error {
+	return l.sink.close()
+}
@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogChainsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{ActionRequest, ActionRunQueued} {
+		if err := log.Record(Event{Action: action, Actor: "ci"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.Close()
+
+	// A reopened log continues the chain where it left off
+	log, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if err := log.Record(Event{Action: ActionRunFinished, Actor: "ops", RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []Event
+	log.Export(Filter{}, func(e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if len(events) != 3 || events[2].Seq != 3 || events[2].PrevHash != events[1].Hash {
+		t.Fatalf("events = %+v", events)
+	}
+	if count, err := log.Verify(); err != nil || count != 3 {
+		t.Fatalf("Verify() = %d, %v", count, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	e := Event{Time: now, Action: ActionRunQueued, Actor: "ci", RunID: "r1"}
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{Actor: "ci", RunID: "r1", Action: ActionRunQueued}, true},
+		{Filter{Actor: "ops"}, false},
+		{Filter{Action: ActionRequest}, false},
+		{Filter{Since: now.Add(-time.Minute), Until: now.Add(time.Minute)}, true},
+		{Filter{Since: now.Add(time.Minute)}, false},
+		{Filter{Until: now}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(e); got != tt.want {
+			t.Errorf("%+v.Match() = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyFindsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines []string) []string
+		want   string
+	}{
+		{"edited", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"actor":"ci"`, `"actor":"someone"`, 1)
+			return lines
+		}, "event 2 was modified"},
+		{"removed", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, "event 3 found where 2 was expected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			log, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				log.Record(Event{Action: ActionRequest, Actor: "ci"})
+			}
+			log.Close()
+
+			data, _ := os.ReadFile(path)
+			lines := tt.tamper(strings.Split(strings.TrimSpace(string(data)), "\n"))
+			os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+
+			log, err = Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+			_, err = log.Verify()
+			if !errors.Is(err, ErrTampered) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Verify() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	os.WriteFile(path, []byte("hello"), 0644)
+	got, err := DigestFile("out.txt", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := Digest("out.txt", []byte("hello")); got != want {
+		t.Errorf("DigestFile() = %+v, want %+v", got, want)
+	}
+}
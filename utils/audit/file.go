@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileSink keeps events in a JSONL file, one event per line. The file is
+// only ever opened for appending.
+type fileSink struct {
+	path string
+	f    *os.File
+}
+
+// Open returns the log kept in the JSONL file at path, creating it if
+// needed
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	return newLog(&fileSink{path: path, f: f})
+}
+
+func (s *fileSink) append(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *fileSink) each(fn func(Event) error) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("error reading audit log %s line %d: %w", s.path, line, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSink) close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	_ "github.com/lib/pq" // Registers the postgres driver
+)
+
+// postgresSchema creates the audit table. Each event is kept as JSON, with
+// the fields exports filter on in columns.
+const postgresSchema = `CREATE TABLE IF NOT EXISTS comanda_audit (
+	seq BIGINT PRIMARY KEY,
+	time TIMESTAMPTZ NOT NULL,
+	action TEXT NOT NULL,
+	actor TEXT NOT NULL DEFAULT '',
+	run_id TEXT NOT NULL DEFAULT '',
+	hash TEXT NOT NULL,
+	record JSONB NOT NULL
+)`
+
+// postgresSink keeps events in the comanda_audit table. Rows are only
+// inserted, never updated or deleted.
+type postgresSink struct {
+	db *sql.DB
+}
+
+// OpenPostgres returns the log kept in the Postgres database at connStr,
+// creating its table if needed
+func OpenPostgres(connStr string) (*Log, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to audit database: %w", err)
+	}
+	if _, err := db.Exec(postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create audit table: %w", err)
+	}
+	return newLog(&postgresSink{db: db})
+}
+
+// OpenConfigured returns the log in the database named by database, from
+// the env config's databases section, or in the JSONL file at path when
+// database is empty
+func OpenConfigured(path, database string, envConfig *config.EnvConfig) (*Log, error) {
+	if database == "" {
+		return Open(path)
+	}
+	dbConfig, err := envConfig.GetDatabaseConfig(database)
+	if err != nil {
+		return nil, fmt.Errorf("audit database %s: %w", database, err)
+	}
+	if dbConfig.Type != config.PostgreSQL {
+		return nil, fmt.Errorf("audit database %s has type '%s'; only postgres is supported", database, dbConfig.Type)
+	}
+	return OpenPostgres(dbConfig.GetConnectionString())
+}
+
+func (s *postgresSink) append(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO comanda_audit (seq, time, action, actor, run_id, hash, record)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		e.Seq, e.Time, e.Action, e.Actor, e.RunID, e.Hash, data)
+	return err
+}
+
+func (s *postgresSink) each(fn func(Event) error) error {
+	rows, err := s.db.Query(`SELECT record FROM comanda_audit ORDER BY seq`)
+	if err != nil {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return fmt.Errorf("error reading audit log: %w", err)
+		}
+		var e Event
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("error decoding audit log: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+	return nil
+}
+
+func (s *postgresSink) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,114 @@
+// Package broker consumes messages from and publishes messages to Kafka,
+// through a REST proxy, and NATS, with or without JetStream. Consumed
+// messages are acknowledged only when the caller says they were handled,
+// so a failed run leaves them to be delivered again.
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Defaults of a consume's batch size and wait
+const (
+	DefaultBatch = 100
+	DefaultWait  = 5 * time.Second
+)
+
+// Message is a message consumed from or published to a topic or subject
+type Message struct {
+	Topic     string // Kafka topic or NATS subject
+	Key       []byte // Kafka only
+	Value     []byte
+	Partition int   // Kafka only
+	Offset    int64 // Kafka offset, or JetStream stream sequence
+}
+
+// ConsumeOptions selects the messages a consume receives
+type ConsumeOptions struct {
+	Topic string        // Kafka topic, or NATS subject for core NATS
+	Group string        // Kafka consumer group, JetStream durable consumer, or core NATS queue group
+	Batch int           // Stop once this many messages arrived
+	Wait  time.Duration // Stop once this long passed, with whatever arrived
+}
+
+// Batch is messages received in a consume. Ack acknowledges them, so they
+// aren't delivered again; Release gives them back unacknowledged. Either
+// one ends the consume.
+type Batch struct {
+	Messages []Message
+	ack      func(context.Context) error
+	release  func() error
+	done     bool
+}
+
+// NewBatch returns a batch of messages that ack acknowledges and release
+// gives back
+func NewBatch(messages []Message, ack func(context.Context) error, release func() error) *Batch {
+	return &Batch{Messages: messages, ack: ack, release: release}
+}
+
+// Ack acknowledges the batch's messages and ends the consume
+func (b *Batch) Ack(ctx context.Context) error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+	return b.ack(ctx)
+}
+
+// Release ends the consume without acknowledging the batch's messages,
+// which are delivered again to a later consume
+func (b *Batch) Release() error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+	return b.release()
+}
+
+// Consume receives up to opts.Batch messages, waiting at most opts.Wait
+// for them
+func Consume(ctx context.Context, cfg config.BrokerConfig, opts ConsumeOptions) (*Batch, error) {
+	if opts.Batch <= 0 {
+		opts.Batch = DefaultBatch
+	}
+	if opts.Wait <= 0 {
+		opts.Wait = DefaultWait
+	}
+	switch cfg.Type {
+	case config.BrokerKafka:
+		if opts.Topic == "" || opts.Group == "" {
+			return nil, errors.New("consuming from Kafka needs a topic and group")
+		}
+		return consumeKafka(ctx, cfg, opts)
+	case config.BrokerNATS:
+		if cfg.Stream != "" && opts.Group == "" {
+			return nil, fmt.Errorf("consuming from JetStream stream %s needs the consumer to pull from", cfg.Stream)
+		}
+		if cfg.Stream == "" && opts.Topic == "" {
+			return nil, errors.New("consuming from NATS needs a subject")
+		}
+		return consumeNATS(ctx, cfg, opts)
+	}
+	return nil, fmt.Errorf("unknown broker type %q", cfg.Type)
+}
+
+// Publish sends messages to a topic or subject, returning once the broker
+// has taken them all
+func Publish(ctx context.Context, cfg config.BrokerConfig, topic string, messages []Message) error {
+	if topic == "" {
+		return errors.New("publishing needs a topic or subject")
+	}
+	switch cfg.Type {
+	case config.BrokerKafka:
+		return publishKafka(ctx, cfg, topic, messages)
+	case config.BrokerNATS:
+		return publishNATS(ctx, cfg, topic, messages)
+	}
+	return fmt.Errorf("unknown broker type %q", cfg.Type)
+}
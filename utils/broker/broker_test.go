@@ -0,0 +1,298 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// fakeKafkaProxy serves the consumer and producer endpoints of a REST
+// proxy for one topic
+type fakeKafkaProxy struct {
+	mu        sync.Mutex
+	records   []kafkaRecord
+	fetches   int
+	committed bool
+	deleted   bool
+	produced  []kafkaRecord
+}
+
+func (f *fakeKafkaProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, pass, _ := r.BasicAuth(); user != "svc" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error_code":40101,"message":"Unauthorized"}`)
+		return
+	}
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && path == "/consumers/triage":
+		var create map[string]string
+		json.NewDecoder(r.Body).Decode(&create)
+		if create["auto.commit.enable"] != "false" || create["format"] != "binary" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"instance_id":%q,"base_uri":"http://internal/consumers/triage/instances/%s"}`, create["name"], create["name"])
+	case strings.HasSuffix(path, "/subscription"):
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(path, "/records"):
+		if r.Header.Get("Accept") != kafkaBinary {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		f.fetches++
+		if f.fetches == 1 {
+			fmt.Fprint(w, `[]`) // Joining the group
+			return
+		}
+		json.NewEncoder(w).Encode(f.records)
+		f.records = nil
+	case strings.HasSuffix(path, "/offsets"):
+		f.committed = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		f.deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/topics/summaries":
+		var body struct {
+			Records []kafkaRecord `json:"records"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.produced = append(f.produced, body.Records...)
+		fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":7}]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestKafkaConsumeAndPublish(t *testing.T) {
+	proxy := &fakeKafkaProxy{records: []kafkaRecord{
+		{Topic: "orders", Key: []byte("a"), Value: []byte(`{"id":1}`), Partition: 0, Offset: 10},
+		{Topic: "orders", Value: []byte(`{"id":2}`), Partition: 1, Offset: 4},
+	}}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+	cfg := config.BrokerConfig{Type: config.BrokerKafka, URL: srv.URL, Username: "svc", Password: "secret"}
+	ctx := context.Background()
+
+	batch, err := Consume(ctx, cfg, ConsumeOptions{Topic: "orders", Group: "triage", Batch: 2, Wait: 3 * time.Second})
+	if err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+	if len(batch.Messages) != 2 || string(batch.Messages[1].Value) != `{"id":2}` || batch.Messages[1].Offset != 4 {
+		t.Fatalf("Messages = %+v", batch.Messages)
+	}
+	if proxy.committed || proxy.deleted {
+		t.Fatal("offsets committed before the batch was acked")
+	}
+	if err := batch.Ack(ctx); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if !proxy.committed || !proxy.deleted {
+		t.Errorf("committed = %v, deleted = %v, want both after Ack", proxy.committed, proxy.deleted)
+	}
+
+	if err := Publish(ctx, cfg, "summaries", []Message{{Key: []byte("k"), Value: []byte("two orders")}}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if len(proxy.produced) != 1 || string(proxy.produced[0].Value) != "two orders" || string(proxy.produced[0].Key) != "k" {
+		t.Errorf("produced %+v", proxy.produced)
+	}
+
+	cfg.Password = "wrong"
+	if _, err := Consume(ctx, cfg, ConsumeOptions{Topic: "orders", Group: "triage"}); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("Consume() error = %v, want the proxy's message", err)
+	}
+}
+
+func TestKafkaRelease(t *testing.T) {
+	proxy := &fakeKafkaProxy{records: []kafkaRecord{{Topic: "orders", Value: []byte("x")}}}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+	cfg := config.BrokerConfig{Type: config.BrokerKafka, URL: srv.URL, Username: "svc", Password: "secret"}
+
+	batch, err := Consume(context.Background(), cfg, ConsumeOptions{Topic: "orders", Group: "triage", Batch: 1, Wait: 3 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if proxy.committed || !proxy.deleted {
+		t.Errorf("committed = %v, deleted = %v, want the instance deleted without a commit", proxy.committed, proxy.deleted)
+	}
+}
+
+// fakeNATS is a NATS server with a JetStream stream ORDERS, whose consumer
+// triage holds pending, and a core subject that echoes nothing
+type fakeNATS struct {
+	mu        sync.Mutex
+	pending   []string
+	acks      map[string]string // Ack subject -> +ACK or -NAK
+	published []string
+	connects  []string
+}
+
+func (f *fakeNATS) serve(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return "nats://" + ln.Addr().String()
+}
+
+func (f *fakeNATS) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"headers\":true}\r\n")
+	seq := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch op {
+		case "CONNECT":
+			f.mu.Lock()
+			f.connects = append(f.connects, args)
+			f.mu.Unlock()
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			data := make([]byte, size+2)
+			io.ReadFull(r, data)
+			data = data[:size]
+			subject, reply := fields[0], ""
+			if len(fields) == 3 {
+				reply = fields[1]
+			}
+			f.mu.Lock()
+			switch {
+			case strings.HasPrefix(subject, "$JS.API.CONSUMER.MSG.NEXT.ORDERS.triage"):
+				var req struct{ Batch int }
+				json.Unmarshal(data, &req)
+				n := 0
+				for i, msg := range f.pending {
+					if n == req.Batch {
+						break
+					}
+					ack := fmt.Sprintf("$JS.ACK.ORDERS.triage.1.%d.%d.0.0", i+1, i+1)
+					fmt.Fprintf(conn, "MSG orders.new 1 %s %d\r\n%s\r\n", ack, len(msg), msg)
+					n++
+				}
+				status := "NATS/1.0 404 No Messages\r\n\r\n"
+				fmt.Fprintf(conn, "HMSG %s 1 %d %d\r\n%s\r\n", reply, len(status), len(status), status)
+			case strings.HasPrefix(subject, "$JS.ACK."):
+				f.acks[subject] = string(data)
+			default:
+				f.published = append(f.published, subject+" "+string(data))
+				if reply != "" {
+					seq++
+					ack := fmt.Sprintf(`{"stream":"ORDERS","seq":%d}`, seq)
+					fmt.Fprintf(conn, "MSG %s 1 %d\r\n%s\r\n", reply, len(ack), ack)
+				}
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+func TestJetStreamConsumeAckAndPublish(t *testing.T) {
+	f := &fakeNATS{pending: []string{`{"id":1}`, `{"id":2}`, `{"id":3}`}, acks: map[string]string{}}
+	cfg := config.BrokerConfig{Type: config.BrokerNATS, URL: f.serve(t), Token: "s3cret", Stream: "ORDERS"}
+	ctx := context.Background()
+
+	batch, err := Consume(ctx, cfg, ConsumeOptions{Group: "triage", Batch: 2, Wait: time.Second})
+	if err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+	if len(batch.Messages) != 2 || string(batch.Messages[0].Value) != `{"id":1}` || batch.Messages[1].Offset != 2 {
+		t.Fatalf("Messages = %+v", batch.Messages)
+	}
+	if err := batch.Ack(ctx); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	f.mu.Lock()
+	if len(f.acks) != 2 || f.acks["$JS.ACK.ORDERS.triage.1.1.1.0.0"] != "+ACK" {
+		t.Errorf("acks = %v, want both messages acked", f.acks)
+	}
+	if !strings.Contains(f.connects[0], `"auth_token":"s3cret"`) {
+		t.Errorf("CONNECT %s, want the token", f.connects[0])
+	}
+	f.mu.Unlock()
+
+	if err := Publish(ctx, cfg, "summaries", []Message{{Value: []byte("one")}, {Value: []byte("two")}}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if strings.Join(f.published, ",") != "summaries one,summaries two" {
+		t.Errorf("published %v", f.published)
+	}
+}
+
+func TestJetStreamRelease(t *testing.T) {
+	f := &fakeNATS{pending: []string{"a"}, acks: map[string]string{}}
+	cfg := config.BrokerConfig{Type: config.BrokerNATS, URL: f.serve(t), Stream: "ORDERS"}
+	batch, err := Consume(context.Background(), cfg, ConsumeOptions{Group: "triage", Wait: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Release(); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.acks["$JS.ACK.ORDERS.triage.1.1.1.0.0"] != "-NAK" {
+		t.Errorf("acks = %v, want the message nacked", f.acks)
+	}
+}
+
+func TestCoreNATSConsumeWaits(t *testing.T) {
+	f := &fakeNATS{acks: map[string]string{}}
+	cfg := config.BrokerConfig{Type: config.BrokerNATS, URL: f.serve(t)}
+	start := time.Now()
+	batch, err := Consume(context.Background(), cfg, ConsumeOptions{Topic: "orders.>", Wait: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+	if len(batch.Messages) != 0 || time.Since(start) < 200*time.Millisecond {
+		t.Errorf("Consume() returned %d messages after %v, want none after the wait", len(batch.Messages), time.Since(start))
+	}
+	if err := batch.Ack(context.Background()); err != nil {
+		t.Errorf("Ack() error = %v, want nothing to ack", err)
+	}
+}
+
+func TestStreamSequence(t *testing.T) {
+	if seq := streamSequence("$JS.ACK.ORDERS.triage.1.42.7.1700000000.3"); seq != 42 {
+		t.Errorf("streamSequence() = %d, want 42", seq)
+	}
+}
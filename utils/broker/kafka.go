@@ -0,0 +1,198 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/httpclient"
+)
+
+// Content types of the Kafka REST Proxy v2 API
+const (
+	kafkaV2     = "application/vnd.kafka.v2+json"
+	kafkaBinary = "application/vnd.kafka.binary.v2+json"
+)
+
+// kafkaPoll is the longest a single records request waits for messages
+const kafkaPoll = time.Second
+
+// kafkaProxy sends requests to a Kafka REST proxy
+type kafkaProxy struct {
+	baseURL            string
+	username, password string
+}
+
+func newKafkaProxy(cfg config.BrokerConfig) kafkaProxy {
+	return kafkaProxy{baseURL: strings.TrimRight(cfg.URL, "/"), username: cfg.Username, password: cfg.Password}
+}
+
+// do sends body, if not nil, as contentType to path and decodes the JSON
+// response into out, if not nil
+func (k kafkaProxy) do(ctx context.Context, method, path, contentType, accept string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, k.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", accept)
+	if k.username != "" {
+		req.SetBasicAuth(k.username, k.password)
+	}
+	resp, err := httpclient.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling Kafka REST proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var proxyErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &proxyErr) == nil && proxyErr.Message != "" {
+			return fmt.Errorf("Kafka REST proxy error (status %d): %s", resp.StatusCode, proxyErr.Message)
+		}
+		return fmt.Errorf("Kafka REST proxy error (status %d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// kafkaRecord is a record in the binary embedded format, with its key and
+// value base64 encoded
+type kafkaRecord struct {
+	Topic     string `json:"topic,omitempty"`
+	Key       []byte `json:"key,omitempty"`
+	Value     []byte `json:"value"`
+	Partition int    `json:"partition,omitempty"`
+	Offset    int64  `json:"offset,omitempty"`
+}
+
+// consumeKafka joins the consumer group with a consumer instance of its
+// own, which fetches records until the batch is full or the wait is over.
+// Acking commits the offsets of the records fetched; either way the
+// instance is deleted, so the group rebalances at once.
+func consumeKafka(ctx context.Context, cfg config.BrokerConfig, opts ConsumeOptions) (*Batch, error) {
+	k := newKafkaProxy(cfg)
+	id := make([]byte, 8)
+	rand.Read(id)
+	instance := "comanda-" + hex.EncodeToString(id)
+	group := "/consumers/" + url.PathEscape(opts.Group)
+	instancePath := group + "/instances/" + instance
+
+	create := map[string]string{
+		"name":               instance,
+		"format":             "binary",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}
+	if err := k.do(ctx, http.MethodPost, group, kafkaV2, kafkaV2, create, nil); err != nil {
+		return nil, fmt.Errorf("error joining consumer group %s: %w", opts.Group, err)
+	}
+	release := func() error {
+		// The instance is deleted even when the run's context was cancelled
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return k.do(ctx, http.MethodDelete, instancePath, kafkaV2, kafkaV2, nil, nil)
+	}
+	subscribe := map[string][]string{"topics": {opts.Topic}}
+	if err := k.do(ctx, http.MethodPost, instancePath+"/subscription", kafkaV2, kafkaV2, subscribe, nil); err != nil {
+		release()
+		return nil, fmt.Errorf("error subscribing to %s: %w", opts.Topic, err)
+	}
+
+	var messages []Message
+	deadline := time.Now().Add(opts.Wait)
+	for len(messages) < opts.Batch {
+		poll := time.Until(deadline)
+		if poll <= 0 {
+			break
+		}
+		if poll > kafkaPoll {
+			poll = kafkaPoll
+		}
+		var records []kafkaRecord
+		path := fmt.Sprintf("%s/records?timeout=%d", instancePath, poll.Milliseconds())
+		if err := k.do(ctx, http.MethodGet, path, "", kafkaBinary, nil, &records); err != nil {
+			release()
+			return nil, fmt.Errorf("error fetching records from %s: %w", opts.Topic, err)
+		}
+		for _, r := range records {
+			messages = append(messages, Message{Topic: r.Topic, Key: r.Key, Value: r.Value, Partition: r.Partition, Offset: r.Offset})
+		}
+		if len(records) == 0 {
+			// An empty fetch returns at once while the group rebalances
+			select {
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			case <-time.After(poll / 4):
+			}
+		}
+	}
+
+	ack := func(ctx context.Context) error {
+		// An empty body commits the offsets of every record fetched
+		if err := k.do(ctx, http.MethodPost, instancePath+"/offsets", kafkaV2, kafkaV2, nil, nil); err != nil {
+			release()
+			return fmt.Errorf("error committing offsets of %s: %w", opts.Topic, err)
+		}
+		return release()
+	}
+	return NewBatch(messages, ack, release), nil
+}
+
+// publishKafka produces messages to a topic in one request
+func publishKafka(ctx context.Context, cfg config.BrokerConfig, topic string, messages []Message) error {
+	records := make([]kafkaRecord, len(messages))
+	for i, m := range messages {
+		records[i] = kafkaRecord{Key: m.Key, Value: m.Value}
+	}
+	var result struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	k := newKafkaProxy(cfg)
+	if err := k.do(ctx, http.MethodPost, "/topics/"+url.PathEscape(topic), kafkaBinary, kafkaV2, map[string]interface{}{"records": records}, &result); err != nil {
+		return fmt.Errorf("error producing to %s: %w", topic, err)
+	}
+	failed := 0
+	var first string
+	for _, offset := range result.Offsets {
+		if offset.Error != "" {
+			if failed == 0 {
+				first = offset.Error
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d messages not produced to %s: %s", failed, len(messages), topic, first)
+	}
+	return nil
+}
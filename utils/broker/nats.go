@@ -0,0 +1,388 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// natsTimeout bounds connecting and each exchange with a NATS server
+const natsTimeout = 10 * time.Second
+
+// natsConn is a connection to a NATS server speaking the client protocol
+type natsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// natsMsg is a message delivered to a subscription
+type natsMsg struct {
+	subject string
+	reply   string
+	status  string // Status of a header-only message, such as 404 for no messages
+	data    []byte
+}
+
+// dialNATS connects and authenticates to the server at cfg.URL
+func dialNATS(ctx context.Context, cfg config.BrokerConfig) (*natsConn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS url %q: use one such as nats://localhost:4222", cfg.URL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	dialer := &net.Dialer{Timeout: natsTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NATS at %s: %w", host, err)
+	}
+	c := &natsConn{conn: conn, r: bufio.NewReader(conn)}
+	c.conn.SetDeadline(time.Now().Add(natsTimeout))
+
+	line, err := c.r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("error reading NATS server info from %s: %v", host, err)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "INFO ")), &info)
+	if u.Scheme == "tls" || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error starting TLS with NATS at %s: %w", host, err)
+		}
+		c.conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	connect := map[string]interface{}{
+		"verbose": false, "pedantic": false, "name": "comanda", "lang": "go",
+		"protocol": 1, "headers": true, "no_responders": true,
+	}
+	user, pass := cfg.Username, cfg.Password
+	if u.User != nil && user == "" {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+	if user != "" {
+		connect["user"], connect["pass"] = user, pass
+	}
+	if cfg.Token != "" {
+		connect["auth_token"] = cfg.Token
+	}
+	data, _ := json.Marshal(connect)
+	if _, err := fmt.Fprintf(c.conn, "CONNECT %s\r\n", data); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.flush(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("error connecting to NATS at %s: %w", host, err)
+	}
+	return c, nil
+}
+
+// Close closes the connection
+func (c *natsConn) Close() error {
+	return c.conn.Close()
+}
+
+// flush waits until the server has processed everything sent so far
+func (c *natsConn) flush() error {
+	c.conn.SetDeadline(time.Now().Add(natsTimeout))
+	if _, err := io.WriteString(c.conn, "PING\r\n"); err != nil {
+		return err
+	}
+	for {
+		op, _, err := c.read()
+		if err != nil {
+			return err
+		}
+		if op == "PONG" {
+			return nil
+		}
+	}
+}
+
+// read returns the next operation the server sends, answering its pings
+// and returning the messages it delivers
+func (c *natsConn) read() (string, natsMsg, error) {
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", natsMsg{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "PING":
+			if _, err := io.WriteString(c.conn, "PONG\r\n"); err != nil {
+				return "", natsMsg{}, err
+			}
+		case "+OK", "INFO":
+		case "-ERR":
+			return "", natsMsg{}, fmt.Errorf("NATS error: %s", strings.Trim(args, "' "))
+		case "MSG", "HMSG":
+			msg, err := c.readMsg(strings.ToUpper(op) == "HMSG", strings.Fields(args))
+			return "MSG", msg, err
+		default:
+			return strings.ToUpper(op), natsMsg{}, nil
+		}
+	}
+}
+
+// readMsg reads the payload of a MSG or HMSG operation with the given
+// arguments: subject, sid, an optional reply subject and the sizes
+func (c *natsConn) readMsg(headers bool, args []string) (natsMsg, error) {
+	sizes := 1
+	if headers {
+		sizes = 2
+	}
+	if len(args) < 2+sizes || len(args) > 3+sizes {
+		return natsMsg{}, fmt.Errorf("malformed NATS message: %v", args)
+	}
+	msg := natsMsg{subject: args[0]}
+	if len(args) == 3+sizes {
+		msg.reply = args[2]
+	}
+	total, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || total < 0 {
+		return natsMsg{}, fmt.Errorf("malformed NATS message size: %v", args)
+	}
+	headerSize := 0
+	if headers {
+		if headerSize, err = strconv.Atoi(args[len(args)-2]); err != nil || headerSize > total {
+			return natsMsg{}, fmt.Errorf("malformed NATS header size: %v", args)
+		}
+	}
+	payload := make([]byte, total+2) // With the trailing CRLF
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return natsMsg{}, err
+	}
+	if headers {
+		// The first header line is NATS/1.0, followed by a status for
+		// messages from the server itself
+		statusLine, _, _ := strings.Cut(string(payload[:headerSize]), "\r\n")
+		if fields := strings.Fields(statusLine); len(fields) > 1 {
+			msg.status = fields[1]
+		}
+	}
+	msg.data = payload[headerSize:total]
+	return msg, nil
+}
+
+// pub publishes data to subject, asking for replies on reply if not empty
+func (c *natsConn) pub(subject, reply string, data []byte) error {
+	if reply != "" {
+		subject += " " + reply
+	}
+	_, err := fmt.Fprintf(c.conn, "PUB %s %d\r\n%s\r\n", subject, len(data), data)
+	return err
+}
+
+// newInbox returns a unique subject to receive replies on
+func newInbox() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return "_INBOX." + hex.EncodeToString(id)
+}
+
+// consumeNATS receives messages: pulled from a JetStream consumer, which
+// holds them for this consume until they are acked or nacked, or from a
+// core NATS subscription, which has no acknowledgements
+func consumeNATS(ctx context.Context, cfg config.BrokerConfig, opts ConsumeOptions) (*Batch, error) {
+	c, err := dialNATS(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	deadline := time.Now().Add(opts.Wait)
+	subject := opts.Topic
+	if cfg.Stream != "" {
+		subject = newInbox()
+	}
+	sub := "SUB " + subject
+	if cfg.Stream == "" && opts.Group != "" {
+		sub += " " + opts.Group
+	}
+	if _, err := io.WriteString(c.conn, sub+" 1\r\n"); err != nil {
+		return nil, err
+	}
+	if cfg.Stream != "" {
+		request, _ := json.Marshal(map[string]interface{}{"batch": opts.Batch, "expires": opts.Wait.Nanoseconds()})
+		next := fmt.Sprintf("$JS.API.CONSUMER.MSG.NEXT.%s.%s", cfg.Stream, opts.Group)
+		if err := c.pub(next, subject, request); err != nil {
+			return nil, err
+		}
+		deadline = deadline.Add(time.Second) // The server answers once the pull expires
+	}
+
+	var messages []Message
+	var replies []string
+	c.conn.SetDeadline(deadline)
+	for len(messages) < opts.Batch {
+		op, msg, err := c.read()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+			break // The wait is over
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			nakAll(cfg, replies)
+			return nil, fmt.Errorf("error receiving messages: %w", err)
+		}
+		if op != "MSG" {
+			continue
+		}
+		if msg.status != "" {
+			if cfg.Stream != "" {
+				break // No more messages (404), the pull expired (408) or was ended (409)
+			}
+			continue
+		}
+		m := Message{Topic: msg.subject, Value: msg.data}
+		if cfg.Stream != "" {
+			if msg.reply == "" {
+				continue
+			}
+			m.Offset = streamSequence(msg.reply)
+			replies = append(replies, msg.reply)
+		}
+		messages = append(messages, m)
+	}
+
+	ack := func(ctx context.Context) error {
+		return replyAll(ctx, cfg, replies, "+ACK")
+	}
+	release := func() error {
+		return nakAll(cfg, replies)
+	}
+	return NewBatch(messages, ack, release), nil
+}
+
+// streamSequence returns the stream sequence in a JetStream ack subject:
+// $JS.ACK.<stream>.<consumer>.<delivered>.<stream seq>.<consumer seq>...
+func streamSequence(reply string) int64 {
+	tokens := strings.Split(reply, ".")
+	if len(tokens) < 6 {
+		return 0
+	}
+	seq, _ := strconv.ParseInt(tokens[5], 10, 64)
+	return seq
+}
+
+// replyAll sends body to each ack subject, over a connection of its own
+// since the run may have outlasted the one the messages came on
+func replyAll(ctx context.Context, cfg config.BrokerConfig, replies []string, body string) error {
+	if len(replies) == 0 {
+		return nil
+	}
+	c, err := dialNATS(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, reply := range replies {
+		if err := c.pub(reply, "", []byte(body)); err != nil {
+			return err
+		}
+	}
+	return c.flush()
+}
+
+// nakAll asks for the messages to be redelivered at once, rather than once
+// their ack wait runs out
+func nakAll(cfg config.BrokerConfig, replies []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	return replyAll(ctx, cfg, replies, "-NAK")
+}
+
+// publishNATS publishes messages to a subject. With a JetStream stream,
+// each is confirmed by the stream before the next is sent.
+func publishNATS(ctx context.Context, cfg config.BrokerConfig, subject string, messages []Message) error {
+	c, err := dialNATS(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if cfg.Stream == "" {
+		for _, m := range messages {
+			if err := c.pub(subject, "", m.Value); err != nil {
+				return fmt.Errorf("error publishing to %s: %w", subject, err)
+			}
+		}
+		if err := c.flush(); err != nil {
+			return fmt.Errorf("error publishing to %s: %w", subject, err)
+		}
+		return nil
+	}
+
+	inbox := newInbox()
+	if _, err := fmt.Fprintf(c.conn, "SUB %s 1\r\n", inbox); err != nil {
+		return err
+	}
+	for i, m := range messages {
+		c.conn.SetDeadline(time.Now().Add(natsTimeout))
+		if err := c.pub(subject, inbox, m.Value); err != nil {
+			return fmt.Errorf("error publishing to %s: %w", subject, err)
+		}
+		if err := c.pubAck(); err != nil {
+			return fmt.Errorf("message %d of %d not stored by stream %s: %w", i+1, len(messages), cfg.Stream, err)
+		}
+	}
+	return nil
+}
+
+// pubAck waits for JetStream's confirmation of a published message
+func (c *natsConn) pubAck() error {
+	for {
+		op, msg, err := c.read()
+		if err != nil {
+			return err
+		}
+		if op != "MSG" {
+			continue
+		}
+		if msg.status == "503" {
+			return errors.New("no stream listens on the subject")
+		}
+		var ack struct {
+			Error *struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(msg.data, &ack); err != nil {
+			return fmt.Errorf("unexpected reply %q", msg.data)
+		}
+		if ack.Error != nil {
+			return errors.New(ack.Error.Description)
+		}
+		return nil
+	}
+}
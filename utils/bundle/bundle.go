@@ -0,0 +1,345 @@
+// Package bundle packages a workflow and the files it reads into a portable
+// archive, and unpacks such archives.
+//
+// A bundle is a gzipped tar of the files at their paths relative to the
+// directory the workflow is run from, preceded by a comanda-bundle.json
+// manifest listing each file with its SHA-256.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// ManifestName is the manifest's name inside a bundle
+const ManifestName = "comanda-bundle.json"
+
+// FormatVersion is the bundle format this package writes
+const FormatVersion = 1
+
+// maxFileSize bounds a single file when importing, to stop a hostile bundle
+// from filling the disk
+const maxFileSize = 512 << 20
+
+// File is a file in a bundle
+type File struct {
+	Path   string `json:"path"` // Slash-separated, relative to the bundle root
+	Kind   string `json:"kind"` // Workflow or one of the processor asset kinds
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Skipped is a file the workflow reads that was left out of the bundle
+type Skipped struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+}
+
+// Manifest describes a bundle
+type Manifest struct {
+	Version  int       `json:"version"`
+	Workflow string    `json:"workflow"` // Path of the main workflow
+	Files    []File    `json:"files"`
+	Skipped  []Skipped `json:"skipped,omitempty"`
+}
+
+// Collect builds the manifest for a workflow, resolving the paths it reads
+// against baseDir, the directory it is run from. Sub-workflows are followed
+// recursively. Env files are always skipped since they usually hold secrets.
+func Collect(workflowPath, baseDir string) (*Manifest, error) {
+	m := &Manifest{Version: FormatVersion}
+	rel, err := relativePath(baseDir, workflowPath)
+	if err != nil {
+		return nil, fmt.Errorf("workflow %s must be inside %s: %w", workflowPath, baseDir, err)
+	}
+	m.Workflow = rel
+
+	included := make(map[string]bool)
+	var addWorkflow func(rel string) error
+	addFile := func(rel, kind string) error {
+		if included[rel] {
+			return nil
+		}
+		file, err := describeFile(baseDir, rel, kind)
+		if err != nil {
+			return err
+		}
+		included[rel] = true
+		m.Files = append(m.Files, file)
+		if kind == processor.AssetWorkflow {
+			return addWorkflow(rel)
+		}
+		return nil
+	}
+	addWorkflow = func(rel string) error {
+		data, err := os.ReadFile(filepath.Join(baseDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return fmt.Errorf("error reading workflow %s: %w", rel, err)
+		}
+		var dslConfig processor.DSLConfig
+		if err := yaml.Unmarshal(data, &dslConfig); err != nil {
+			return fmt.Errorf("error parsing workflow %s: %w", rel, err)
+		}
+		proc := processor.NewProcessor(&dslConfig, &config.EnvConfig{}, &config.ServerConfig{}, false)
+		for _, asset := range proc.Assets() {
+			if asset.Kind == processor.AssetEnvFile {
+				m.skip(asset.Path, asset.Kind, "env files usually hold secrets; copy it separately")
+				continue
+			}
+			if filepath.IsAbs(asset.Path) {
+				m.skip(asset.Path, asset.Kind, "absolute path")
+				continue
+			}
+			paths := []string{asset.Path}
+			if strings.ContainsAny(asset.Path, "*?[") {
+				paths, _ = filepath.Glob(filepath.Join(baseDir, asset.Path))
+				if len(paths) == 0 {
+					m.skip(asset.Path, asset.Kind, "no files match")
+					continue
+				}
+				for i := range paths {
+					paths[i], _ = filepath.Rel(baseDir, paths[i])
+				}
+			}
+			for _, p := range paths {
+				assetRel, err := relativePath(baseDir, filepath.Join(baseDir, p))
+				if err != nil {
+					m.skip(p, asset.Kind, "outside the workflow's directory")
+					continue
+				}
+				if err := addFile(assetRel, asset.Kind); os.IsNotExist(err) {
+					m.skip(p, asset.Kind, "not found")
+				} else if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := addFile(rel, processor.AssetWorkflow); err != nil {
+		return nil, fmt.Errorf("error reading workflow: %w", err)
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m, nil
+}
+
+// skip records a file left out of the bundle
+func (m *Manifest) skip(path, kind, reason string) {
+	for _, s := range m.Skipped {
+		if s.Path == path && s.Kind == kind {
+			return
+		}
+	}
+	m.Skipped = append(m.Skipped, Skipped{Path: path, Kind: kind, Reason: reason})
+}
+
+// relativePath returns target relative to base as a slash path, failing if
+// it is outside base
+func relativePath(base, target string) (string, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absBase, absTarget)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", target, base)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// describeFile hashes a file for the manifest
+func describeFile(baseDir, rel, kind string) (File, error) {
+	f, err := os.Open(filepath.Join(baseDir, filepath.FromSlash(rel)))
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	if info.IsDir() {
+		return File{}, fmt.Errorf("%s is a directory", rel)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return File{}, err
+	}
+	return File{Path: rel, Kind: kind, Size: info.Size(), SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Write writes a bundle of the manifest's files, read from baseDir. Entries
+// carry no timestamps, so bundling the same files gives the same digest.
+func Write(w io.Writer, m *Manifest, baseDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+	if err := writeEntry(tw, ManifestName, manifest); err != nil {
+		return err
+	}
+	for _, file := range m.Files {
+		data, err := os.ReadFile(filepath.Join(baseDir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file.Path, err)
+		}
+		if err := writeEntry(tw, file.Path, data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error writing bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("error writing bundle: %w", err)
+	}
+	return nil
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Unix(0, 0), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing %s to bundle: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("error writing %s to bundle: %w", name, err)
+	}
+	return nil
+}
+
+// Read reads a bundle and checks its files against the manifest, returning
+// the manifest and the file contents by path
+func Read(r io.Reader) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a comanda bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var m *Manifest
+	contents := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("bundle entry %s is not a regular file", header.Name)
+		}
+		if header.Size > maxFileSize {
+			return nil, nil, fmt.Errorf("bundle entry %s is too large", header.Name)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxFileSize))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading %s from bundle: %w", header.Name, err)
+		}
+		if header.Name == ManifestName {
+			m = &Manifest{}
+			if err := json.Unmarshal(data, m); err != nil {
+				return nil, nil, fmt.Errorf("error parsing bundle manifest: %w", err)
+			}
+			continue
+		}
+		if err := checkPath(header.Name); err != nil {
+			return nil, nil, err
+		}
+		contents[header.Name] = data
+	}
+
+	if m == nil {
+		return nil, nil, fmt.Errorf("not a comanda bundle: %s is missing", ManifestName)
+	}
+	if m.Version > FormatVersion {
+		return nil, nil, fmt.Errorf("bundle format %d is newer than this comanda supports (%d); upgrade comanda", m.Version, FormatVersion)
+	}
+	for _, file := range m.Files {
+		if err := checkPath(file.Path); err != nil {
+			return nil, nil, err
+		}
+		data, ok := contents[file.Path]
+		if !ok {
+			return nil, nil, fmt.Errorf("bundle is missing %s", file.Path)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != file.SHA256 {
+			return nil, nil, fmt.Errorf("checksum mismatch for %s; the bundle is corrupt", file.Path)
+		}
+	}
+	return m, contents, nil
+}
+
+// checkPath rejects paths that would escape the import directory
+func checkPath(p string) error {
+	clean := path.Clean(p)
+	if p == "" || path.IsAbs(p) || strings.Contains(p, `\`) || clean != p || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("bundle contains an unsafe path: %s", p)
+	}
+	return nil
+}
+
+// Extract writes a bundle's files under dir. Existing files with different
+// contents are only replaced when overwrite is set; the check happens before
+// anything is written.
+func Extract(r io.Reader, dir string, overwrite bool) (*Manifest, error) {
+	m, contents, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !overwrite {
+		var conflicts []string
+		for _, file := range m.Files {
+			existing, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file.Path)))
+			if err == nil && string(existing) != string(contents[file.Path]) {
+				conflicts = append(conflicts, file.Path)
+			}
+		}
+		if len(conflicts) > 0 {
+			return nil, fmt.Errorf("would overwrite existing files with different contents: %s (use --force to replace them)", strings.Join(conflicts, ", "))
+		}
+	}
+
+	for _, file := range m.Files {
+		target := filepath.Join(dir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", file.Path, err)
+		}
+		if err := os.WriteFile(target, contents[file.Path], 0644); err != nil {
+			return nil, fmt.Errorf("error writing %s: %w", file.Path, err)
+		}
+	}
+	return m, nil
+}
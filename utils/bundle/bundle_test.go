@@ -0,0 +1,141 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectAndExtract(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"flows/review.yaml": `env_file: .env
+extract:
+  input: [data/report.txt, "data/*.csv as $tables", STDIN, https://example.com/page]
+  model: gpt-4o
+  action: prompts/extract.md
+  output: out/facts.txt
+review:
+  input: out/facts.txt
+  model: gpt-4o
+  action: Review the facts
+  output: STDOUT
+sub:
+  process:
+    workflow_file: flows/sub.yaml
+`,
+		"flows/sub.yaml": `publish:
+  input: missing.txt
+  model: gpt-4o
+  action: [prompts/publish.md, prompts/extract.md]
+  output: STDOUT
+`,
+		"data/report.txt":    "report",
+		"data/a.csv":         "a,b\n1,2\n",
+		"data/b.csv":         "a,b\n3,4\n",
+		"prompts/extract.md": "Extract the facts",
+		"prompts/publish.md": "Publish",
+		".env":               "OPENAI_API_KEY=secret",
+		"out/facts.txt":      "stale output",
+	})
+
+	m, err := Collect(filepath.Join(src, "flows/review.yaml"), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range m.Files {
+		paths = append(paths, f.Kind+":"+f.Path)
+	}
+	want := "input:data/a.csv input:data/b.csv input:data/report.txt workflow:flows/review.yaml workflow:flows/sub.yaml prompt:prompts/extract.md prompt:prompts/publish.md"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("files =\n%s\nwant\n%s", got, want)
+	}
+	var skipped []string
+	for _, s := range m.Skipped {
+		skipped = append(skipped, s.Path)
+	}
+	if got := strings.Join(skipped, " "); got != ".env missing.txt" {
+		t.Errorf("skipped = %s", got)
+	}
+	if m.Workflow != "flows/review.yaml" {
+		t.Errorf("workflow = %s", m.Workflow)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, m, src); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	dst := t.TempDir()
+	if _, err := Extract(bytes.NewReader(archive), dst, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range m.Files {
+		got, _ := os.ReadFile(filepath.Join(dst, f.Path))
+		orig, _ := os.ReadFile(filepath.Join(src, f.Path))
+		if string(got) != string(orig) {
+			t.Errorf("%s = %q, want %q", f.Path, got, orig)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, ".env")); !os.IsNotExist(err) {
+		t.Error(".env must not be bundled")
+	}
+
+	// Importing again is fine; a changed file needs overwrite
+	if _, err := Extract(bytes.NewReader(archive), dst, false); err != nil {
+		t.Errorf("re-import: %v", err)
+	}
+	writeFiles(t, dst, map[string]string{"prompts/publish.md": "edited"})
+	if _, err := Extract(bytes.NewReader(archive), dst, false); err == nil || !strings.Contains(err.Error(), "prompts/publish.md") {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+	if _, err := Extract(bytes.NewReader(archive), dst, true); err != nil {
+		t.Errorf("forced import: %v", err)
+	}
+}
+
+func TestReadRejectsUnsafeBundles(t *testing.T) {
+	bundle := func(entries map[string]string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, content := range entries {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(content))
+		}
+		tw.Close()
+		gz.Close()
+		return buf.Bytes()
+	}
+	manifest := `{"version":1,"workflow":"w.yaml","files":[{"path":"w.yaml","sha256":"00"}]}`
+	tests := map[string]map[string]string{
+		"unsafe path":      {ManifestName: manifest, "../evil": "x"},
+		"checksum":         {ManifestName: manifest, "w.yaml": "x"},
+		"missing manifest": {"w.yaml": "x"},
+		"newer format":     {ManifestName: `{"version":99}`},
+	}
+	for name, entries := range tests {
+		if _, _, err := Read(bytes.NewReader(bundle(entries))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package calendar reads events from ICS feeds and Google Calendar for
+// workflows that prepare meetings, such as daily briefings
+package calendar
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one occurrence of a calendar event; recurring events are
+// expanded into one Event per occurrence
+type Event struct {
+	UID         string
+	Summary     string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Location    string
+	Description string
+	Organizer   string
+	Attendees   []string
+	URL         string
+	Status      string // confirmed, tentative or cancelled
+}
+
+// Render returns the event as markdown, the way a briefing prompt reads it
+func (e Event) Render() string {
+	var b strings.Builder
+	summary := e.Summary
+	if summary == "" {
+		summary = "(no title)"
+	}
+	fmt.Fprintf(&b, "## %s\n\n", summary)
+	fmt.Fprintf(&b, "- When: %s\n", e.When())
+	if e.Status != "" && e.Status != "confirmed" {
+		fmt.Fprintf(&b, "- Status: %s\n", e.Status)
+	}
+	if e.Location != "" {
+		fmt.Fprintf(&b, "- Where: %s\n", e.Location)
+	}
+	if e.Organizer != "" {
+		fmt.Fprintf(&b, "- Organizer: %s\n", e.Organizer)
+	}
+	if len(e.Attendees) > 0 {
+		fmt.Fprintf(&b, "- Attendees: %s\n", strings.Join(e.Attendees, ", "))
+	}
+	if e.URL != "" {
+		fmt.Fprintf(&b, "- Link: %s\n", e.URL)
+	}
+	if description := strings.TrimSpace(e.Description); description != "" {
+		fmt.Fprintf(&b, "\n%s\n", description)
+	}
+	return b.String()
+}
+
+// When returns the event's time span, such as "Mon 2 Jun 2025 10:00-10:30
+// CEST" or "Mon 2 Jun 2025 (all day)"
+func (e Event) When() string {
+	const day = "Mon 2 Jan 2006"
+	if e.AllDay {
+		last := e.End.AddDate(0, 0, -1)
+		if !last.After(e.Start) {
+			return e.Start.Format(day) + " (all day)"
+		}
+		return e.Start.Format(day) + " - " + last.Format(day) + " (all day)"
+	}
+	if !e.End.After(e.Start) {
+		return e.Start.Format(day + " 15:04 MST")
+	}
+	if e.Start.Format("2006-01-02") == e.End.Format("2006-01-02") {
+		return e.Start.Format(day+" 15:04") + "-" + e.End.Format("15:04 MST")
+	}
+	return e.Start.Format(day+" 15:04") + " - " + e.End.Format(day+" 15:04 MST")
+}
+
+// Overlaps reports whether the event happens between from and to. Events
+// without a duration happen at their start.
+func (e Event) Overlaps(from, to time.Time) bool {
+	if !e.Start.Before(to) {
+		return false
+	}
+	if e.End.After(e.Start) {
+		return e.End.After(from)
+	}
+	return !e.Start.Before(from)
+}
+
+// Sort orders events by start, then by summary
+func Sort(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Start.Equal(events[j].Start) {
+			return events[i].Start.Before(events[j].Start)
+		}
+		return events[i].Summary < events[j].Summary
+	})
+}
+
+var relativeTime = regexp.MustCompile(`^([+-]?)(\d+)([mhdw])$`)
+
+// ParseTime reads a time relative to now, in now's zone: now, today,
+// tomorrow or yesterday (at midnight), an offset such as -7d, +2d, 12h or
+// 30m (w is weeks), a date such as 2025-06-01 or a time such as
+// 2025-06-01T09:00 or 2025-06-01T09:00:00Z
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	switch strings.ToLower(s) {
+	case "now":
+		return now, nil
+	case "today":
+		return midnight, nil
+	case "tomorrow":
+		return midnight.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	}
+	if match := relativeTime.FindStringSubmatch(s); match != nil {
+		n, err := strconv.Atoi(match[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q: %w", s, err)
+		}
+		if match[1] == "-" {
+			n = -n
+		}
+		switch match[3] {
+		case "m":
+			return now.Add(time.Duration(n) * time.Minute), nil
+		case "h":
+			return now.Add(time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, n), nil
+		default:
+			return now.AddDate(0, 0, 7*n), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(now.Location()), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected now, today, tomorrow, yesterday, an offset such as -7d or 12h, or a date such as 2025-06-01)", s)
+}
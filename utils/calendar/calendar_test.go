@@ -0,0 +1,204 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const teamICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"SUMMARY:Stand-up\\, team A\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20250602T093000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20250602T094500\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=6\r\n" +
+	"EXDATE;TZID=Europe/Berlin:20250604T093000\r\n" +
+	"ORGANIZER;CN=Ana Silva:mailto:ana@example.com\r\n" +
+	"ATTENDEE;CN=\"Bo, Li\";PARTSTAT=ACCEPTED:mailto:bo@example.com\r\n" +
+	"ATTENDEE;CUTYPE=ROOM;CN=Room 4:mailto:room4@example.com\r\n" +
+	"DESCRIPTION:Agenda:\\n- blockers\\n- demos with a long line th\r\n" +
+	" at is folded\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"DESCRIPTION:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Berlin:20250606T093000\r\n" +
+	"SUMMARY:Stand-up (moved)\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20250606T110000\r\n" +
+	"DURATION:PT15M\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:offsite\r\n" +
+	"SUMMARY:Offsite\r\n" +
+	"DTSTART;VALUE=DATE:20250605\r\n" +
+	"DTEND;VALUE=DATE:20250607\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:review\r\n" +
+	"SUMMARY:Monthly review\r\n" +
+	"DTSTART:20250131T150000Z\r\n" +
+	"DTEND:20250131T160000Z\r\n" +
+	"RRULE:FREQ=MONTHLY;BYDAY=-1FR\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:cancelled\r\n" +
+	"SUMMARY:Old sync\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"DTSTART:20250603T080000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICS(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, berlin)
+	events, err := ParseICS([]byte(teamICS), from, from.AddDate(0, 0, 14), berlin)
+	if err != nil {
+		t.Fatalf("ParseICS() error = %v", err)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Start.Format("Jan 2 15:04")+" "+e.Summary)
+	}
+	want := []string{
+		"Jun 2 09:30 Stand-up, team A",
+		"Jun 5 00:00 Offsite",
+		"Jun 6 11:00 Stand-up (moved)",
+		"Jun 9 09:30 Stand-up, team A",
+		"Jun 11 09:30 Stand-up, team A",
+		"Jun 13 09:30 Stand-up, team A",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	standup := events[0].Render()
+	for _, line := range []string{
+		"## Stand-up, team A",
+		"- When: Mon 2 Jun 2025 09:30-09:45 CEST",
+		"- Organizer: Ana Silva <ana@example.com>",
+		"- Attendees: Bo, Li <bo@example.com>\n",
+		"- demos with a long line that is folded",
+	} {
+		if !strings.Contains(standup, line) {
+			t.Errorf("Render() = %s\nwant %q", standup, line)
+		}
+	}
+	if when := events[1].When(); when != "Thu 5 Jun 2025 - Fri 6 Jun 2025 (all day)" {
+		t.Errorf("When() = %q", when)
+	}
+
+	events, err = ParseICS([]byte(teamICS), from.AddDate(0, 0, 20), from.AddDate(0, 2, 0), berlin)
+	if err != nil {
+		t.Fatalf("ParseICS() error = %v", err)
+	}
+	got = nil
+	for _, e := range events {
+		got = append(got, e.Start.Format("Jan 2 15:04"))
+	}
+	if strings.Join(got, ",") != "Jun 27 17:00,Jul 25 17:00" {
+		t.Errorf("last Fridays = %v", got)
+	}
+
+	if _, err := ParseICS([]byte("<html>Sign in</html>"), from, from, berlin); err == nil {
+		t.Error("ParseICS accepted HTML")
+	}
+}
+
+func TestRRuleUntilAndMonthDays(t *testing.T) {
+	start := time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC)
+	rule, err := parseRRule("FREQ=MONTHLY;UNTIL=20250601", start)
+	if err != nil {
+		t.Fatalf("parseRRule() error = %v", err)
+	}
+	var got []string
+	for _, t := range rule.occurrences(start, start.AddDate(1, 0, 0)) {
+		got = append(got, t.Format("Jan 2"))
+	}
+	// Months without a 31st are skipped
+	if strings.Join(got, ",") != "Jan 31,Mar 31,May 31" {
+		t.Errorf("occurrences = %v", got)
+	}
+	if _, err := parseRRule("FREQ=HOURLY", start); err == nil {
+		t.Error("parseRRule accepted FREQ=HOURLY")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2025, 6, 2, 15, 4, 0, 0, time.UTC)
+	for in, want := range map[string]string{
+		"now":              "2025-06-02 15:04",
+		"today":            "2025-06-02 00:00",
+		"tomorrow":         "2025-06-03 00:00",
+		"-7d":              "2025-05-26 15:04",
+		"12h":              "2025-06-03 03:04",
+		"+1w":              "2025-06-09 15:04",
+		"2025-07-01":       "2025-07-01 00:00",
+		"2025-07-01T09:30": "2025-07-01 09:30",
+	} {
+		got, err := ParseTime(in, now)
+		if err != nil || got.Format("2006-01-02 15:04") != want {
+			t.Errorf("ParseTime(%q) = %v, %v, want %s", in, got, err, want)
+		}
+	}
+	if _, err := ParseTime("next week", now); err == nil {
+		t.Error("ParseTime accepted next week")
+	}
+}
+
+func TestFetchGoogle(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"message":"Invalid Credentials"}}`)
+			return
+		}
+		if r.URL.Path != "/calendars/team@group.calendar.google.com/events" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.RawQuery
+		if r.URL.Query().Get("pageToken") == "" {
+			fmt.Fprint(w, `{"items":[
+				{"id":"1","status":"confirmed","summary":"Customer call","start":{"dateTime":"2025-06-02T10:00:00Z"},"end":{"dateTime":"2025-06-02T10:30:00Z"},
+				 "hangoutLink":"https://meet.google.com/abc","organizer":{"email":"ana@example.com"},
+				 "attendees":[{"email":"bo@example.com","displayName":"Bo","responseStatus":"declined"},{"email":"room@resource.calendar.google.com","resource":true}]},
+				{"id":"2","status":"cancelled"}],"nextPageToken":"p2"}`)
+			return
+		}
+		fmt.Fprint(w, `{"items":[{"id":"3","status":"tentative","summary":"Holiday","start":{"date":"2025-06-03"},"end":{"date":"2025-06-04"}}]}`)
+	}))
+	defer srv.Close()
+	previous := calendarAPI
+	calendarAPI = srv.URL
+	defer func() { calendarAPI = previous }()
+
+	from := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	events, err := FetchGoogle(context.Background(), "tok", "team@group.calendar.google.com", from, from.AddDate(0, 0, 2), time.UTC)
+	if err != nil {
+		t.Fatalf("FetchGoogle() error = %v", err)
+	}
+	if len(events) != 2 || events[0].URL != "https://meet.google.com/abc" || !events[1].AllDay {
+		t.Fatalf("events = %+v", events)
+	}
+	if got := strings.Join(events[0].Attendees, ","); got != "Bo <bo@example.com> (declined)" {
+		t.Errorf("attendees = %s", got)
+	}
+	if !strings.Contains(query, "singleEvents=true") || !strings.Contains(query, "timeMin=2025-06-02T00%3A00%3A00Z") {
+		t.Errorf("query = %s", query)
+	}
+	if _, err := FetchGoogle(context.Background(), "bad", "team@group.calendar.google.com", from, from, time.UTC); err == nil || !strings.Contains(err.Error(), "Invalid Credentials") {
+		t.Errorf("FetchGoogle() error = %v, want the API's message", err)
+	}
+}
@@ -0,0 +1,181 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// calendarAPI is the Google Calendar API; tests point it at a fake server
+var calendarAPI = "https://www.googleapis.com/calendar/v3"
+
+// googleTime is the start or end of a Google Calendar event: a date for
+// all-day events, a dateTime for the others
+type googleTime struct {
+	Date     string `json:"date"`
+	DateTime string `json:"dateTime"`
+}
+
+type googleEvent struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Summary     string     `json:"summary"`
+	Description string     `json:"description"`
+	Location    string     `json:"location"`
+	HTMLLink    string     `json:"htmlLink"`
+	HangoutLink string     `json:"hangoutLink"`
+	Start       googleTime `json:"start"`
+	End         googleTime `json:"end"`
+	Organizer   struct {
+		Email       string `json:"email"`
+		DisplayName string `json:"displayName"`
+	} `json:"organizer"`
+	Attendees []struct {
+		Email          string `json:"email"`
+		DisplayName    string `json:"displayName"`
+		ResponseStatus string `json:"responseStatus"`
+		Resource       bool   `json:"resource"`
+	} `json:"attendees"`
+	ConferenceData struct {
+		EntryPoints []struct {
+			EntryPointType string `json:"entryPointType"`
+			URI            string `json:"uri"`
+		} `json:"entryPoints"`
+	} `json:"conferenceData"`
+}
+
+// FetchGoogle returns the events of a Google Calendar, such as primary or
+// team@group.calendar.google.com, that happen between from and to, with
+// recurring events expanded and cancelled ones skipped. token is an OAuth
+// access token allowed to read calendars.
+func FetchGoogle(ctx context.Context, token, calendarID string, from, to time.Time, loc *time.Location) ([]Event, error) {
+	query := url.Values{}
+	query.Set("timeMin", from.Format(time.RFC3339))
+	query.Set("timeMax", to.Format(time.RFC3339))
+	query.Set("singleEvents", "true")
+	query.Set("orderBy", "startTime")
+	query.Set("maxResults", "250")
+	if loc != time.Local && loc != time.UTC {
+		query.Set("timeZone", loc.String())
+	}
+
+	var events []Event
+	for {
+		var page struct {
+			Items         []googleEvent `json:"items"`
+			NextPageToken string        `json:"nextPageToken"`
+		}
+		endpoint := calendarAPI + "/calendars/" + url.PathEscape(calendarID) + "/events?" + query.Encode()
+		if err := getGoogle(ctx, token, endpoint, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			if item.Status == "cancelled" {
+				continue
+			}
+			e, err := item.event(loc)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+	Sort(events)
+	return events, nil
+}
+
+func (g googleEvent) event(loc *time.Location) (Event, error) {
+	e := Event{
+		UID:         g.ID,
+		Summary:     g.Summary,
+		Description: g.Description,
+		Location:    g.Location,
+		URL:         g.HTMLLink,
+		Status:      g.Status,
+		Organizer:   g.Organizer.Email,
+	}
+	if g.Organizer.DisplayName != "" {
+		e.Organizer = g.Organizer.DisplayName + " <" + g.Organizer.Email + ">"
+	}
+	if g.HangoutLink != "" {
+		e.URL = g.HangoutLink
+	}
+	for _, entry := range g.ConferenceData.EntryPoints {
+		if entry.EntryPointType == "video" {
+			e.URL = entry.URI
+			break
+		}
+	}
+	for _, a := range g.Attendees {
+		if a.Resource {
+			continue
+		}
+		attendee := a.Email
+		if a.DisplayName != "" {
+			attendee = a.DisplayName + " <" + a.Email + ">"
+		}
+		if a.ResponseStatus == "declined" {
+			attendee += " (declined)"
+		}
+		e.Attendees = append(e.Attendees, attendee)
+	}
+
+	var err error
+	if g.Start.Date != "" {
+		e.AllDay = true
+		if e.Start, err = time.ParseInLocation("2006-01-02", g.Start.Date, loc); err == nil {
+			e.End, err = time.ParseInLocation("2006-01-02", g.End.Date, loc)
+		}
+	} else if e.Start, err = time.Parse(time.RFC3339, g.Start.DateTime); err == nil {
+		e.Start = e.Start.In(loc)
+		if e.End, err = time.Parse(time.RFC3339, g.End.DateTime); err == nil {
+			e.End = e.End.In(loc)
+		}
+	}
+	if err != nil {
+		return e, fmt.Errorf("event %q has an invalid start or end: %w", g.Summary, err)
+	}
+	return e, nil
+}
+
+func getGoogle(ctx context.Context, token, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error fetching calendar: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			msg = apiErr.Error.Message
+		}
+		return fmt.Errorf("Google Calendar API error (status %d): %s", resp.StatusCode, msg)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing Google Calendar response: %w", err)
+	}
+	return nil
+}
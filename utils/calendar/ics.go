@@ -0,0 +1,575 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPeriods caps the days, weeks, months or years a recurring event is
+// expanded over
+const maxPeriods = 50000
+
+var client = &http.Client{Timeout: 60 * time.Second}
+
+// IsURL reports whether an ICS source is a URL rather than a file
+func IsURL(src string) bool {
+	for _, scheme := range []string{"http://", "https://", "webcal://", "webcals://"} {
+		if strings.HasPrefix(strings.ToLower(src), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchICS reads an ICS calendar from a URL, webcal:// ones included, or
+// from a file
+func FetchICS(ctx context.Context, src string) ([]byte, error) {
+	if !IsURL(src) {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, fmt.Errorf("error reading calendar file: %w", err)
+		}
+		return data, nil
+	}
+	if scheme, rest, _ := strings.Cut(src, "://"); strings.HasPrefix(strings.ToLower(scheme), "webcal") {
+		src = "https://" + rest
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar URL: %w", err)
+	}
+	req.Header.Set("Accept", "text/calendar")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching calendar: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		// The URL of a private feed is a secret, so it stays out of the error
+		return nil, fmt.Errorf("error fetching calendar: status %d", resp.StatusCode)
+	}
+	return data, nil
+}
+
+// property is a content line of an ICS calendar
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// contentLines returns the unfolded lines of an ICS calendar
+func contentLines(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+	return lines
+}
+
+// parseLine reads a content line such as
+// DTSTART;TZID=Europe/Berlin:20250602T100000
+func parseLine(line string) (property, bool) {
+	p := property{params: make(map[string]string)}
+	i := strings.IndexAny(line, ";:")
+	if i < 0 {
+		return p, false
+	}
+	p.name = strings.ToUpper(line[:i])
+	for line[i] == ';' {
+		rest := line[i+1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			return p, false
+		}
+		var value strings.Builder
+		quoted := false
+		j := eq + 1
+		for ; j < len(rest); j++ {
+			c := rest[j]
+			if c == '"' {
+				quoted = !quoted
+				continue
+			}
+			if !quoted && (c == ';' || c == ':') {
+				break
+			}
+			value.WriteByte(c)
+		}
+		if j == len(rest) {
+			return p, false
+		}
+		p.params[strings.ToUpper(rest[:eq])] = value.String()
+		i += 1 + j
+	}
+	p.value = line[i+1:]
+	return p, true
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";")
+
+// icsEvent is a VEVENT before its recurrences are expanded
+type icsEvent struct {
+	Event
+	days         int           // Length of an all-day event
+	length       time.Duration // Length of a timed event
+	rrule        string
+	exdates      map[int64]bool
+	recurrenceID time.Time // Start of the occurrence this event replaces
+}
+
+// ParseICS returns the events of an ICS calendar that happen between from
+// and to, expanding recurring events and skipping cancelled ones. Times
+// are shown in loc, which is also the zone of floating times and of TZIDs
+// that aren't IANA zone names.
+func ParseICS(data []byte, from, to time.Time, loc *time.Location) ([]Event, error) {
+	var parsed []icsEvent
+	var props []property
+	var stack []string
+	for _, line := range contentLines(data) {
+		if line == "" {
+			continue
+		}
+		p, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		switch p.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(p.value))
+			if strings.EqualFold(p.value, "VEVENT") {
+				props = nil
+			}
+			continue
+		case "END":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			if strings.EqualFold(p.value, "VEVENT") {
+				e, err := parseEvent(props, loc)
+				if err != nil {
+					return nil, err
+				}
+				parsed = append(parsed, e)
+			}
+			continue
+		}
+		if len(stack) > 0 && stack[len(stack)-1] == "VEVENT" {
+			props = append(props, p)
+		}
+	}
+	if len(stack) > 0 || (len(parsed) == 0 && !strings.Contains(strings.ToUpper(string(data)), "BEGIN:VCALENDAR")) {
+		return nil, fmt.Errorf("not an ICS calendar")
+	}
+
+	// Occurrences replaced by an event of their own, by UID and start
+	replaced := make(map[string]map[int64]bool)
+	for _, e := range parsed {
+		if !e.recurrenceID.IsZero() {
+			if replaced[e.UID] == nil {
+				replaced[e.UID] = make(map[int64]bool)
+			}
+			replaced[e.UID][e.recurrenceID.Unix()] = true
+		}
+	}
+
+	var events []Event
+	add := func(e icsEvent, start time.Time) {
+		occurrence := e.Event
+		occurrence.Start = start
+		if e.AllDay {
+			occurrence.End = start.AddDate(0, 0, e.days)
+		} else {
+			occurrence.Start = start.In(loc)
+			occurrence.End = start.Add(e.length).In(loc)
+		}
+		if occurrence.Status != "cancelled" && occurrence.Overlaps(from, to) {
+			events = append(events, occurrence)
+		}
+	}
+	for _, e := range parsed {
+		if e.rrule == "" || !e.recurrenceID.IsZero() {
+			add(e, e.Start)
+			continue
+		}
+		rule, err := parseRRule(e.rrule, e.Start)
+		if err != nil {
+			// Rules this package can't expand keep their first occurrence
+			add(e, e.Start)
+			continue
+		}
+		for _, start := range rule.occurrences(e.Start, to) {
+			if !e.exdates[start.Unix()] && !replaced[e.UID][start.Unix()] {
+				add(e, start)
+			}
+		}
+	}
+	Sort(events)
+	return events, nil
+}
+
+// parseEvent reads the properties of a VEVENT
+func parseEvent(props []property, loc *time.Location) (icsEvent, error) {
+	e := icsEvent{exdates: make(map[int64]bool)}
+	var end time.Time
+	var duration string
+	for _, p := range props {
+		var err error
+		switch p.name {
+		case "UID":
+			e.UID = p.value
+		case "SUMMARY":
+			e.Summary = textUnescaper.Replace(p.value)
+		case "DESCRIPTION":
+			e.Description = textUnescaper.Replace(p.value)
+		case "LOCATION":
+			e.Location = textUnescaper.Replace(p.value)
+		case "URL":
+			e.URL = p.value
+		case "STATUS":
+			e.Status = strings.ToLower(p.value)
+		case "ORGANIZER":
+			e.Organizer = person(p)
+		case "ATTENDEE":
+			if cutype := strings.ToUpper(p.params["CUTYPE"]); cutype != "ROOM" && cutype != "RESOURCE" {
+				attendee := person(p)
+				if strings.EqualFold(p.params["PARTSTAT"], "DECLINED") {
+					attendee += " (declined)"
+				}
+				e.Attendees = append(e.Attendees, attendee)
+			}
+		case "DTSTART":
+			e.Start, e.AllDay, err = parseDateTime(p.value, p.params, loc)
+		case "DTEND":
+			end, _, err = parseDateTime(p.value, p.params, loc)
+		case "DURATION":
+			duration = p.value
+		case "RRULE":
+			e.rrule = p.value
+		case "EXDATE":
+			for _, v := range strings.Split(p.value, ",") {
+				t, _, err := parseDateTime(v, p.params, loc)
+				if err != nil {
+					return e, fmt.Errorf("event %q: invalid EXDATE: %w", e.Summary, err)
+				}
+				e.exdates[t.Unix()] = true
+			}
+		case "RECURRENCE-ID":
+			e.recurrenceID, _, err = parseDateTime(p.value, p.params, loc)
+		}
+		if err != nil {
+			return e, fmt.Errorf("event %q: invalid %s: %w", e.Summary, p.name, err)
+		}
+	}
+	if e.Start.IsZero() {
+		return e, fmt.Errorf("event %q has no DTSTART", e.Summary)
+	}
+
+	switch {
+	case !end.IsZero() && e.AllDay:
+		e.days = int(end.Sub(e.Start).Hours()+12) / 24
+	case !end.IsZero():
+		e.length = end.Sub(e.Start)
+	case duration != "":
+		days, length, err := parseDuration(duration)
+		if err != nil {
+			return e, fmt.Errorf("event %q: invalid DURATION: %w", e.Summary, err)
+		}
+		e.days = days
+		e.length = time.Duration(days)*24*time.Hour + length
+	case e.AllDay:
+		e.days = 1
+	}
+	if e.AllDay && e.days < 1 {
+		e.days = 1
+	}
+	return e, nil
+}
+
+// person returns an organizer or attendee as "Name <email>"
+func person(p property) string {
+	email := p.value
+	if len(email) >= 7 && strings.EqualFold(email[:7], "mailto:") {
+		email = email[7:]
+	}
+	name := p.params["CN"]
+	switch {
+	case name == "" || name == email:
+		return email
+	case email == "":
+		return name
+	}
+	return name + " <" + email + ">"
+}
+
+// parseDateTime reads a DATE or DATE-TIME value: in UTC when it ends in Z,
+// in its TZID or else in loc
+func parseDateTime(v string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(v) == 8 {
+		t, err := time.ParseInLocation("20060102", v, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		return t, false, err
+	}
+	zone := loc
+	if tzid := strings.TrimPrefix(params["TZID"], "/"); tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			zone = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", v, zone)
+	return t, false, err
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration reads a DURATION such as PT1H30M or P2D, returning its
+// days and the rest
+func parseDuration(v string) (int, time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(strings.ToUpper(v))
+	if m == nil {
+		return 0, 0, fmt.Errorf("%q is not a duration", v)
+	}
+	n := func(s string) int {
+		i, _ := strconv.Atoi(s)
+		return i
+	}
+	days := n(m[2])*7 + n(m[3])
+	length := time.Duration(n(m[4]))*time.Hour + time.Duration(n(m[5]))*time.Minute + time.Duration(n(m[6]))*time.Second
+	if m[1] == "-" {
+		return -days, -length, nil
+	}
+	return days, length, nil
+}
+
+// weekdayNum is a BYDAY value such as MO, 2TU or -1FR
+type weekdayNum struct {
+	n   int
+	day time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday}
+
+// rrule is a recurrence rule: DAILY, WEEKLY, MONTHLY or YEARLY, with
+// INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and BYMONTH
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []weekdayNum
+	byMonthDay []int
+	byMonth    []int
+}
+
+func parseRRule(v string, start time.Time) (rrule, error) {
+	r := rrule{interval: 1}
+	for _, part := range strings.Split(v, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.freq = strings.ToUpper(value)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("INTERVAL must be positive")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(value)
+		case "UNTIL":
+			var allDay bool
+			r.until, allDay, err = parseDateTime(value, nil, start.Location())
+			if allDay {
+				r.until = r.until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				d = strings.ToUpper(strings.TrimSpace(d))
+				if len(d) < 2 {
+					return r, fmt.Errorf("invalid BYDAY %q", d)
+				}
+				day, ok := weekdays[d[len(d)-2:]]
+				if !ok {
+					return r, fmt.Errorf("invalid BYDAY %q", d)
+				}
+				wd := weekdayNum{day: day}
+				if prefix := d[:len(d)-2]; prefix != "" {
+					if wd.n, err = strconv.Atoi(prefix); err != nil {
+						return r, fmt.Errorf("invalid BYDAY %q", d)
+					}
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		case "BYMONTHDAY", "BYMONTH":
+			for _, s := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(s)
+				if err != nil {
+					return r, fmt.Errorf("invalid %s %q", key, s)
+				}
+				if strings.ToUpper(key) == "BYMONTH" {
+					r.byMonth = append(r.byMonth, n)
+				} else {
+					r.byMonthDay = append(r.byMonthDay, n)
+				}
+			}
+		case "BYSETPOS", "BYYEARDAY", "BYWEEKNO", "BYHOUR", "BYMINUTE", "BYSECOND":
+			return r, fmt.Errorf("%s is not supported", key)
+		}
+		if err != nil {
+			return r, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+		return r, nil
+	}
+	return r, fmt.Errorf("FREQ %q is not supported", r.freq)
+}
+
+// occurrences returns the starts of a recurring event before to
+func (r rrule) occurrences(start, to time.Time) []time.Time {
+	var starts []time.Time
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.period(start, period*r.interval) {
+			switch {
+			case t.Before(start):
+				continue
+			case !r.until.IsZero() && t.After(r.until), r.count > 0 && len(starts) >= r.count, !t.Before(to):
+				return starts
+			}
+			starts = append(starts, t)
+		}
+	}
+	return starts
+}
+
+// period returns the candidate starts, in order, of the k-th day, week,
+// month or year after the event's first
+func (r rrule) period(start time.Time, k int) []time.Time {
+	y, m, d := start.Date()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+	var starts []time.Time
+	switch r.freq {
+	case "DAILY":
+		t := at(y, m, d+k)
+		if r.matchesDay(t) {
+			starts = append(starts, t)
+		}
+	case "WEEKLY":
+		monday := d - (int(start.Weekday())+6)%7 + 7*k
+		days := r.byDay
+		if len(days) == 0 {
+			days = []weekdayNum{{day: start.Weekday()}}
+		}
+		for _, wd := range days {
+			starts = append(starts, at(y, m, monday+(int(wd.day)+6)%7))
+		}
+	case "MONTHLY":
+		first := time.Date(y, m+time.Month(k), 1, 0, 0, 0, 0, time.UTC)
+		for _, day := range r.monthDays(first.Year(), first.Month(), d) {
+			starts = append(starts, at(first.Year(), first.Month(), day))
+		}
+	case "YEARLY":
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []int{int(m)}
+		}
+		for _, month := range months {
+			for _, day := range r.monthDays(y+k, time.Month(month), d) {
+				starts = append(starts, at(y+k, time.Month(month), day))
+			}
+		}
+	}
+	kept := starts[:0]
+	for _, t := range starts {
+		if r.freq == "YEARLY" || len(r.byMonth) == 0 || slices.Contains(r.byMonth, int(t.Month())) {
+			kept = append(kept, t)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Before(kept[j]) })
+	return kept
+}
+
+// matchesDay reports whether a DAILY occurrence falls on BYDAY and
+// BYMONTHDAY
+func (r rrule) matchesDay(t time.Time) bool {
+	if len(r.byDay) > 0 {
+		found := false
+		for _, wd := range r.byDay {
+			found = found || wd.day == t.Weekday()
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.byMonthDay) > 0 {
+		last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		found := false
+		for _, md := range r.byMonthDay {
+			found = found || md == t.Day() || md == t.Day()-last-1
+		}
+		return found
+	}
+	return true
+}
+
+// monthDays returns the days of a month an occurrence falls on: BYMONTHDAY,
+// BYDAY such as 2TU or -1FR, or else the event's first day when the month
+// has it
+func (r rrule) monthDays(y int, m time.Month, firstDay int) []int {
+	last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	var days []int
+	switch {
+	case len(r.byMonthDay) > 0:
+		for _, md := range r.byMonthDay {
+			if md < 0 {
+				md = last + md + 1
+			}
+			if md >= 1 && md <= last {
+				days = append(days, md)
+			}
+		}
+	case len(r.byDay) > 0:
+		for _, wd := range r.byDay {
+			var matches []int
+			for day := 1; day <= last; day++ {
+				if time.Date(y, m, day, 0, 0, 0, 0, time.UTC).Weekday() == wd.day {
+					matches = append(matches, day)
+				}
+			}
+			switch {
+			case wd.n == 0:
+				days = append(days, matches...)
+			case wd.n > 0 && wd.n <= len(matches):
+				days = append(days, matches[wd.n-1])
+			case wd.n < 0 && -wd.n <= len(matches):
+				days = append(days, matches[len(matches)+wd.n])
+			}
+		}
+	case firstDay <= last:
+		days = append(days, firstDay)
+	}
+	return days
+}
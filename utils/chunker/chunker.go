@@ -2,13 +2,20 @@ package chunker
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
 )
 
+// DefaultMaxChunks is the most chunks a file is split into when MaxChunks
+// is not set
+const DefaultMaxChunks = 100
+
 // ChunkConfig represents the configuration for chunking a large file
 type ChunkConfig struct {
 	By        string // How to split the file: "lines", "bytes", or "tokens"
@@ -24,6 +31,11 @@ type ChunkResult struct {
 	TotalChunks int      // Total number of chunks created
 }
 
+// chunkDir returns where chunk directories are created
+func chunkDir() string {
+	return config.TempDir()
+}
+
 // SplitFile splits a file into chunks based on the provided configuration
 // It returns the paths to the temporary chunk files and a cleanup function
 func SplitFile(filePath string, config ChunkConfig) (*ChunkResult, error) {
@@ -33,7 +45,7 @@ func SplitFile(filePath string, config ChunkConfig) (*ChunkResult, error) {
 	}
 
 	// Create a temporary directory for the chunks
-	tempDir, err := os.MkdirTemp("", "comanda-chunks-*")
+	tempDir, err := os.MkdirTemp(chunkDir(), "comanda-chunks-*")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
 	}
@@ -97,83 +109,88 @@ func validateConfig(config *ChunkConfig) error {
 	if config.Overlap < 0 {
 		config.Overlap = 0
 	}
+	if config.Overlap >= config.Size {
+		return fmt.Errorf("chunk overlap must be less than the chunk size %d, got %d", config.Size, config.Overlap)
+	}
 
 	if config.MaxChunks <= 0 {
-		config.MaxChunks = 100 // Default to 100 chunks maximum
+		config.MaxChunks = DefaultMaxChunks
 	}
 
 	return nil
 }
 
-// splitByLines splits a file into chunks based on line count
-func splitByLines(filePath, tempDir string, config ChunkConfig) ([]string, int, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+// maxLineSize is the longest line or word read when chunking by lines or
+// tokens
+const maxLineSize = 16 * 1024 * 1024
+
+// chunkWriter writes chunks to numbered files in a directory
+type chunkWriter struct {
+	dir   string
+	max   int
+	paths []string
+}
+
+// write adds a chunk, failing once the maximum number of chunks is reached
+func (w *chunkWriter) write(content []byte) error {
+	if len(w.paths) >= w.max {
+		return fmt.Errorf("file would generate more than %d chunks, the maximum; raise max_chunks or the chunk size", w.max)
 	}
-	defer file.Close()
+	chunkPath := filepath.Join(w.dir, fmt.Sprintf("chunk_%d.txt", len(w.paths)))
+	if err := os.WriteFile(chunkPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write chunk %d: %w", len(w.paths), err)
+	}
+	w.paths = append(w.paths, chunkPath)
+	return nil
+}
 
-	scanner := bufio.NewScanner(file)
-	var chunkPaths []string
-	var lineBuffer []string
-	lineCount := 0
-	chunkIndex := 0
+// splitScanned writes the lines or words read by scanner as chunks of
+// config.Size items joined by sep, each starting config.Overlap items before
+// the previous one ended. Only one chunk is held in memory, so files of any
+// size can be split. An empty file gives one empty chunk.
+func splitScanned(scanner *bufio.Scanner, sep string, tempDir string, config ChunkConfig) ([]string, int, error) {
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	w := &chunkWriter{dir: tempDir, max: config.MaxChunks}
+	var window []string
+	fresh := 0 // Items in the window that are not in an earlier chunk
 
-	// Read all lines into memory
 	for scanner.Scan() {
-		lineBuffer = append(lineBuffer, scanner.Text())
-		lineCount++
+		window = append(window, scanner.Text())
+		fresh++
+		if len(window) < config.Size {
+			continue
+		}
+		if err := w.write([]byte(strings.Join(window, sep))); err != nil {
+			return nil, 0, err
+		}
+		kept := copy(window, window[len(window)-config.Overlap:])
+		window = window[:kept]
+		fresh = 0
 	}
-
 	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, 0, fmt.Errorf("error reading file: a line is longer than %d bytes; chunk it by bytes instead", maxLineSize)
+		}
 		return nil, 0, fmt.Errorf("error reading file: %w", err)
 	}
 
-	// If the file is empty, return an empty chunk
-	if lineCount == 0 {
-		chunkPath := filepath.Join(tempDir, fmt.Sprintf("chunk_0.txt"))
-		if err := os.WriteFile(chunkPath, []byte(""), 0644); err != nil {
-			return nil, 0, fmt.Errorf("failed to write empty chunk: %w", err)
+	if fresh > 0 || len(w.paths) == 0 {
+		if err := w.write([]byte(strings.Join(window, sep))); err != nil {
+			return nil, 0, err
 		}
-		return []string{chunkPath}, 1, nil
 	}
+	return w.paths, len(w.paths), nil
+}
 
-	// Calculate how many chunks we'll create
-	totalChunks := (lineCount + config.Size - 1) / config.Size
-	if totalChunks > config.MaxChunks {
-		return nil, 0, fmt.Errorf("file would generate %d chunks, exceeding the maximum of %d", totalChunks, config.MaxChunks)
-	}
-
-	// Create chunks
-	for start := 0; start < lineCount; start += config.Size - config.Overlap {
-		// Ensure we don't go beyond the maximum number of chunks
-		if chunkIndex >= config.MaxChunks {
-			break
-		}
-
-		end := start + config.Size
-		if end > lineCount {
-			end = lineCount
-		}
-
-		// Create a chunk file
-		chunkPath := filepath.Join(tempDir, fmt.Sprintf("chunk_%d.txt", chunkIndex))
-		chunkContent := strings.Join(lineBuffer[start:end], "\n")
-
-		if err := os.WriteFile(chunkPath, []byte(chunkContent), 0644); err != nil {
-			return nil, 0, fmt.Errorf("failed to write chunk %d: %w", chunkIndex, err)
-		}
-
-		chunkPaths = append(chunkPaths, chunkPath)
-		chunkIndex++
-
-		// If we've reached the end of the file, break
-		if end >= lineCount {
-			break
-		}
+// splitByLines splits a file into chunks based on line count
+func splitByLines(filePath, tempDir string, config ChunkConfig) ([]string, int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer file.Close()
 
-	return chunkPaths, chunkIndex, nil
+	return splitScanned(bufio.NewScanner(file), "\n", tempDir, config)
 }
 
 // splitByBytes splits a file into chunks based on byte size
@@ -265,67 +282,6 @@ func splitByTokens(filePath, tempDir string, config ChunkConfig) ([]string, int,
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
-	var tokens []string
-	var tokenCount int
-
-	// Read the file and split into tokens
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineTokens := strings.Fields(line)
-		tokens = append(tokens, lineTokens...)
-		tokenCount += len(lineTokens)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error reading file: %w", err)
-	}
-
-	// If the file is empty, return an empty chunk
-	if tokenCount == 0 {
-		chunkPath := filepath.Join(tempDir, fmt.Sprintf("chunk_0.txt"))
-		if err := os.WriteFile(chunkPath, []byte(""), 0644); err != nil {
-			return nil, 0, fmt.Errorf("failed to write empty chunk: %w", err)
-		}
-		return []string{chunkPath}, 1, nil
-	}
-
-	// Calculate how many chunks we'll create
-	totalChunks := (tokenCount + config.Size - 1) / config.Size
-	if totalChunks > config.MaxChunks {
-		return nil, 0, fmt.Errorf("file would generate %d chunks, exceeding the maximum of %d", totalChunks, config.MaxChunks)
-	}
-
-	var chunkPaths []string
-	chunkIndex := 0
-
-	// Create chunks
-	for start := 0; start < tokenCount; start += config.Size - config.Overlap {
-		// Ensure we don't go beyond the maximum number of chunks
-		if chunkIndex >= config.MaxChunks {
-			break
-		}
-
-		end := start + config.Size
-		if end > tokenCount {
-			end = tokenCount
-		}
-
-		// Create a chunk file
-		chunkPath := filepath.Join(tempDir, fmt.Sprintf("chunk_%d.txt", chunkIndex))
-		chunkContent := strings.Join(tokens[start:end], " ")
-
-		if err := os.WriteFile(chunkPath, []byte(chunkContent), 0644); err != nil {
-			return nil, 0, fmt.Errorf("failed to write chunk %d: %w", chunkIndex, err)
-		}
-
-		chunkPaths = append(chunkPaths, chunkPath)
-		chunkIndex++
-
-		// If we've reached the end of the file, break
-		if end >= tokenCount {
-			break
-		}
-	}
-
-	return chunkPaths, chunkIndex, nil
+	scanner.Split(bufio.ScanWords)
+	return splitScanned(scanner, " ", tempDir, config)
 }
@@ -0,0 +1,118 @@
+package chunker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readChunks returns the contents of the chunk files
+func readChunks(t *testing.T, paths []string) []string {
+	t.Helper()
+	var chunks []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, string(data))
+	}
+	return chunks
+}
+
+// writeInput writes a file to chunk
+func writeInput(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.log")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSplitByLines(t *testing.T) {
+	path := writeInput(t, "1\n2\n3\n4\n5\n6\n7\n")
+	config := ChunkConfig{By: "lines", Size: 3, Overlap: 1}
+	if err := validateConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, total, err := splitByLines(path, t.TempDir(), config)
+	if err != nil {
+		t.Fatalf("splitByLines() error = %v", err)
+	}
+	want := []string{"1\n2\n3", "3\n4\n5", "5\n6\n7"}
+	got := readChunks(t, paths)
+	if total != len(want) || strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("splitByLines() = %q (%d), want %q", got, total, want)
+	}
+}
+
+func TestSplitByTokensRemainder(t *testing.T) {
+	path := writeInput(t, "a b c d e")
+	paths, total, err := splitByTokens(path, t.TempDir(), ChunkConfig{Size: 2, MaxChunks: DefaultMaxChunks})
+	if err != nil {
+		t.Fatalf("splitByTokens() error = %v", err)
+	}
+	want := []string{"a b", "c d", "e"}
+	got := readChunks(t, paths)
+	if total != len(want) || strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("splitByTokens() = %q (%d), want %q", got, total, want)
+	}
+}
+
+func TestSplitEmptyFile(t *testing.T) {
+	paths, total, err := splitByLines(writeInput(t, ""), t.TempDir(), ChunkConfig{Size: 10, MaxChunks: DefaultMaxChunks})
+	if err != nil || total != 1 || readChunks(t, paths)[0] != "" {
+		t.Errorf("splitByLines() of an empty file = %v, %d, %v, want one empty chunk", paths, total, err)
+	}
+}
+
+func TestSplitMaxChunks(t *testing.T) {
+	path := writeInput(t, strings.Repeat("line\n", 10))
+	_, _, err := splitByLines(path, t.TempDir(), ChunkConfig{Size: 2, MaxChunks: 3})
+	if err == nil || !strings.Contains(err.Error(), "more than 3 chunks") {
+		t.Errorf("splitByLines() error = %v, want the chunk limit", err)
+	}
+}
+
+func TestValidateConfigOverlap(t *testing.T) {
+	config := ChunkConfig{By: "lines", Size: 5, Overlap: 5}
+	if err := validateConfig(&config); err == nil {
+		t.Error("validateConfig() accepted an overlap as large as the chunk size")
+	}
+}
+
+// benchmarkInput writes a file of about size bytes of short text lines
+func benchmarkInput(b *testing.B, size int) string {
+	b.Helper()
+	line := "2024-05-01T12:00:00Z INFO request served path=/api/items status=200 duration=12ms\n"
+	path := filepath.Join(b.TempDir(), "input.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat(line, size/len(line))), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func BenchmarkSplitFile(b *testing.B) {
+	const size = 16 << 20
+	path := benchmarkInput(b, size)
+	for _, config := range []ChunkConfig{
+		{By: "lines", Size: 10000, Overlap: 100, MaxChunks: 1000},
+		{By: "bytes", Size: 1 << 20, Overlap: 1024, MaxChunks: 1000},
+		{By: "tokens", Size: 100000, MaxChunks: 1000},
+	} {
+		b.Run(config.By, func(b *testing.B) {
+			b.SetBytes(size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				result, err := SplitFile(path, config)
+				if err != nil {
+					b.Fatal(err)
+				}
+				CleanupChunks(result)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+// Package client calls the comanda server API. It follows the OpenAPI
+// specification the server publishes at /openapi.json, naming each method
+// after the operation it calls.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls a comanda server
+type Client struct {
+	BaseURL    string       // Server address, such as http://localhost:8080
+	Token      string       // Bearer token, API key or JWT; omitted when empty
+	Workspace  string       // Sent as X-Comanda-Workspace when set
+	HTTPClient *http.Client // http.DefaultClient when nil
+}
+
+// New returns a client for the server at baseURL authenticating with token
+func New(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+// APIError is an error response from the server
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("comanda server: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// GetHealth checks that the server is up
+func (c *Client) GetHealth(ctx context.Context) (*HealthResponse, error) {
+	var resp HealthResponse
+	return &resp, c.do(ctx, http.MethodGet, "/health", nil, nil, &resp)
+}
+
+// ListWorkflows lists the stored workflows
+func (c *Client) ListWorkflows(ctx context.Context) ([]WorkflowInfo, error) {
+	var resp struct {
+		Workflows []WorkflowInfo `json:"workflows"`
+	}
+	err := c.do(ctx, http.MethodGet, "/workflows", nil, nil, &resp)
+	return resp.Workflows, err
+}
+
+// GetWorkflow returns a stored workflow with its YAML
+func (c *Client) GetWorkflow(ctx context.Context, name string) (*WorkflowInfo, error) {
+	var resp WorkflowResponse
+	if err := c.do(ctx, http.MethodGet, "/workflows/"+url.PathEscape(name), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Workflow, nil
+}
+
+// CreateWorkflow stores a new workflow, failing if one with the name exists
+func (c *Client) CreateWorkflow(ctx context.Context, name, content string) (*WorkflowResponse, error) {
+	var resp WorkflowResponse
+	return &resp, c.do(ctx, http.MethodPost, "/workflows", nil, WorkflowRequest{Name: name, Content: content}, &resp)
+}
+
+// PutWorkflow creates or replaces a workflow
+func (c *Client) PutWorkflow(ctx context.Context, name, content string) (*WorkflowResponse, error) {
+	var resp WorkflowResponse
+	return &resp, c.do(ctx, http.MethodPut, "/workflows/"+url.PathEscape(name), nil, WorkflowRequest{Content: content}, &resp)
+}
+
+// DeleteWorkflow deletes a workflow; its runs are kept
+func (c *Client) DeleteWorkflow(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/workflows/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// StartRun queues a run of a stored workflow. Unless req.Wait is set, the
+// returned run is queued and can be followed with GetRun or WaitForRun.
+func (c *Client) StartRun(ctx context.Context, req RunRequest) (*RunResponse, error) {
+	var resp RunResponse
+	return &resp, c.do(ctx, http.MethodPost, "/runs", nil, req, &resp)
+}
+
+// ListRuns lists runs, most recent first. An empty workflow lists runs of
+// every workflow, and a limit of 0 the server's default number.
+func (c *Client) ListRuns(ctx context.Context, workflow string, limit int) ([]Run, error) {
+	query := url.Values{}
+	if workflow != "" {
+		query.Set("workflow", workflow)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var resp struct {
+		Runs []Run `json:"runs"`
+	}
+	err := c.do(ctx, http.MethodGet, "/runs", query, nil, &resp)
+	return resp.Runs, err
+}
+
+// GetRun returns a run's status and steps, and its output once it finished
+func (c *Client) GetRun(ctx context.Context, id string) (*RunResponse, error) {
+	var resp RunResponse
+	return &resp, c.do(ctx, http.MethodGet, "/runs/"+url.PathEscape(id), nil, nil, &resp)
+}
+
+// CancelRun cancels a queued or running run. The run keeps the steps,
+// output and artifacts it finished; it may still be stopping when CancelRun
+// returns, if it runs on a remote worker.
+func (c *Client) CancelRun(ctx context.Context, id string) (*RunResponse, error) {
+	var resp RunResponse
+	return &resp, c.do(ctx, http.MethodDelete, "/runs/"+url.PathEscape(id), nil, nil, &resp)
+}
+
+// DecideApproval approves or rejects the approval step a run waits at. The
+// run goes on once approved; a rejection fails it with the reason.
+func (c *Client) DecideApproval(ctx context.Context, id string, decision ApprovalDecision) (*RunResponse, error) {
+	var resp RunResponse
+	return &resp, c.do(ctx, http.MethodPost, "/runs/"+url.PathEscape(id)+"/approval", nil, decision, &resp)
+}
+
+// WaitForRun polls a run every interval until it finishes or ctx is done
+func (c *Client) WaitForRun(ctx context.Context, id string, interval time.Duration) (*RunResponse, error) {
+	for {
+		resp, err := c.GetRun(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Run != nil && resp.Run.Done() {
+			return resp, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// GetStepOutput returns the response of one of a run's steps
+func (c *Client) GetStepOutput(ctx context.Context, id, step string) (string, error) {
+	body, err := c.download(ctx, "/runs/"+url.PathEscape(id)+"/steps/"+url.PathEscape(step)+"/output")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	return string(data), err
+}
+
+// ListArtifacts lists the files a run wrote
+func (c *Client) ListArtifacts(ctx context.Context, id string) ([]ArtifactInfo, error) {
+	var resp struct {
+		Artifacts []ArtifactInfo `json:"artifacts"`
+	}
+	err := c.do(ctx, http.MethodGet, "/runs/"+url.PathEscape(id)+"/artifacts", nil, nil, &resp)
+	return resp.Artifacts, err
+}
+
+// DownloadArtifact returns the content of a file a run wrote. The caller
+// must close it.
+func (c *Client) DownloadArtifact(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return c.download(ctx, "/runs/"+url.PathEscape(id)+"/artifacts/"+strings.Join(parts, "/"))
+}
+
+// UploadFiles uploads local files into a runtime directory on the server,
+// for a run started with the same runtime directory to read
+func (c *Client) UploadFiles(ctx context.Context, runtimeDir string, paths ...string) ([]FileInfo, error) {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	for _, path := range paths {
+		if err := addFormFile(form, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	if runtimeDir != "" {
+		query.Set("runtimeDir", runtimeDir)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "/files", query, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	var resp struct {
+		Files []FileInfo `json:"files"`
+	}
+	err = c.send(req, &resp)
+	return resp.Files, err
+}
+
+func addFormFile(form *multipart.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("error encoding request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.send(req, out)
+}
+
+// download sends a GET request and returns the response body
+func (c *Client) download(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Workspace != "" {
+		req.Header.Set("X-Comanda-Workspace", c.Workspace)
+	}
+	return req, nil
+}
+
+func (c *Client) send(req *http.Request, out interface{}) error {
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// responseError reads the error message of a failed response
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &body) != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(data))
+		if body.Error == "" {
+			body.Error = http.StatusText(resp.StatusCode)
+		}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: body.Error}
+}
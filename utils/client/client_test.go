@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/server"
+)
+
+// echoProvider answers every prompt with the prompt itself
+type echoProvider struct{}
+
+func (echoProvider) Name() string                    { return "openai" }
+func (echoProvider) SupportsModel(model string) bool { return model == "gpt-4o" }
+func (echoProvider) Configure(apiKey string) error   { return nil }
+func (echoProvider) SetVerbose(verbose bool)         {}
+func (echoProvider) SendPrompt(model, prompt string) (string, error) {
+	return "echo: " + prompt, nil
+}
+func (echoProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+	return "echo: " + prompt, nil
+}
+
+func newTestServer(t *testing.T) *Client {
+	t.Helper()
+	detect := models.DetectProvider
+	models.DetectProvider = func(model string) models.Provider {
+		if model == "gpt-4o" {
+			return echoProvider{}
+		}
+		return detect(model)
+	}
+	t.Cleanup(func() { models.DetectProvider = detect })
+
+	envConfig := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {APIKey: "test-key", Models: []config.Model{{Name: "gpt-4o", Type: "external", Modes: []config.ModelMode{config.TextMode}}}},
+		},
+		Server: &config.ServerConfig{DataDir: t.TempDir(), Enabled: true, BearerToken: "test-token"},
+	}
+	srv, err := server.New(envConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler)
+	t.Cleanup(ts.Close)
+	return New(ts.URL, "test-token")
+}
+
+const summaryWorkflow = `summarize:
+  input: notes.txt
+  model: gpt-4o
+  action: Summarize this
+  output: summary.md
+`
+
+func TestClientRunsWorkflow(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := c.GetHealth(ctx); err != nil {
+		t.Fatalf("GetHealth: %v", err)
+	}
+	if _, err := c.CreateWorkflow(ctx, "summary", summaryWorkflow); err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+	workflows, err := c.ListWorkflows(ctx)
+	if err != nil || len(workflows) != 1 || workflows[0].Name != "summary" {
+		t.Fatalf("ListWorkflows = %+v, %v", workflows, err)
+	}
+
+	notes := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(notes, []byte("the meeting notes"), 0644)
+	files, err := c.UploadFiles(ctx, "job1", notes)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("UploadFiles = %+v, %v", files, err)
+	}
+
+	started, err := c.StartRun(ctx, RunRequest{Workflow: "summary", RuntimeDir: "job1"})
+	if err != nil || started.Run == nil {
+		t.Fatalf("StartRun = %+v, %v", started, err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	finished, err := c.WaitForRun(waitCtx, started.Run.ID, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitForRun: %v", err)
+	}
+	if finished.Run.Status != StatusSucceeded {
+		t.Fatalf("run %s: %s", finished.Run.Status, finished.Run.Error)
+	}
+	var apiErr *APIError
+	if _, err := c.CancelRun(ctx, started.Run.ID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("CancelRun of a finished run: expected a 409 APIError, got %v", err)
+	}
+
+	output, err := c.GetStepOutput(ctx, started.Run.ID, "summarize")
+	if err != nil || !strings.Contains(output, "Summarize this") {
+		t.Errorf("GetStepOutput = %q, %v", output, err)
+	}
+	artifacts, err := c.ListArtifacts(ctx, started.Run.ID)
+	if err != nil || len(artifacts) != 1 || artifacts[0].Path != "summary.md" {
+		t.Fatalf("ListArtifacts = %+v, %v", artifacts, err)
+	}
+	body, err := c.DownloadArtifact(ctx, started.Run.ID, "summary.md")
+	if err != nil {
+		t.Fatalf("DownloadArtifact: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if !strings.Contains(string(data), "echo:") {
+		t.Errorf("artifact = %q", data)
+	}
+
+	runs, err := c.ListRuns(ctx, "summary", 5)
+	if err != nil || len(runs) != 1 {
+		t.Errorf("ListRuns = %+v, %v", runs, err)
+	}
+	if err := c.DeleteWorkflow(ctx, "summary"); err != nil {
+		t.Errorf("DeleteWorkflow: %v", err)
+	}
+}
+
+func TestClientDecidesApproval(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+	if _, err := c.CreateWorkflow(ctx, "publish", `review:
+  type: approval
+  input: STDIN
+  approval:
+    message: Publish this draft?
+  output: STDOUT
+`); err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+	started, err := c.StartRun(ctx, RunRequest{Workflow: "publish", Input: "the draft"})
+	if err != nil || started.Run == nil {
+		t.Fatalf("StartRun = %+v, %v", started, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := c.GetRun(ctx, started.Run.ID)
+		if err != nil {
+			t.Fatalf("GetRun: %v", err)
+		}
+		if len(resp.Approvals) == 1 {
+			if resp.Approvals[0].Step != "review" || resp.Approvals[0].Content != "the draft" {
+				t.Errorf("Approvals = %+v", resp.Approvals)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run never waited for approval: %+v", resp.Run)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if _, err := c.DecideApproval(ctx, started.Run.ID, ApprovalDecision{Approved: true}); err != nil {
+		t.Fatalf("DecideApproval: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	finished, err := c.WaitForRun(waitCtx, started.Run.ID, 20*time.Millisecond)
+	if err != nil || finished.Run.Status != StatusSucceeded {
+		t.Fatalf("WaitForRun = %+v, %v", finished, err)
+	}
+	var apiErr *APIError
+	if _, err := c.DecideApproval(ctx, started.Run.ID, ApprovalDecision{Approved: true}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("DecideApproval of a finished run: expected a 409 APIError, got %v", err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+
+	_, err := c.GetRun(ctx, "20200101-000000-0000")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 APIError, got %v", err)
+	}
+
+	c.Token = "wrong"
+	if _, err := c.ListWorkflows(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a 401 APIError, got %v", err)
+	}
+}
+
+// TestClientFollowsSpec checks that every client method calling the API is
+// named after an operation in the server's specification
+func TestClientFollowsSpec(t *testing.T) {
+	data, err := server.OpenAPISpec("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	json.Unmarshal(data, &spec)
+	operations := make(map[string]bool)
+	for _, methods := range spec.Paths {
+		for _, op := range methods {
+			operations[strings.ToUpper(op.OperationID[:1])+op.OperationID[1:]] = true
+		}
+	}
+
+	helpers := map[string]bool{"WaitForRun": true}
+	clientType := reflect.TypeOf(&Client{})
+	for i := 0; i < clientType.NumMethod(); i++ {
+		name := clientType.Method(i).Name
+		if !helpers[name] && !operations[name] {
+			t.Errorf("client method %s has no operation in the spec", name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import "time"
+
+// Run statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Run priority classes
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+// HealthResponse is the server's health check
+type HealthResponse struct {
+	Status    string `json:"status"`
+	Timestamp string `json:"timestamp"`
+}
+
+// WorkflowInfo describes a stored workflow
+type WorkflowInfo struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+	Content    string    `json:"content,omitempty"` // Only when a single workflow is requested
+}
+
+// WorkflowRequest creates or replaces a workflow
+type WorkflowRequest struct {
+	Name    string `json:"name,omitempty"`
+	Content string `json:"content"`
+}
+
+// ValidationIssue is a problem that kept a workflow from being saved
+type ValidationIssue struct {
+	Step    string `json:"step,omitempty"`
+	Message string `json:"message"`
+}
+
+// WorkflowResponse is the result of a workflow operation
+type WorkflowResponse struct {
+	Success  bool              `json:"success"`
+	Message  string            `json:"message,omitempty"`
+	Workflow *WorkflowInfo     `json:"workflow,omitempty"`
+	Issues   []ValidationIssue `json:"issues,omitempty"`
+}
+
+// Webhook is notified when a run finishes
+type Webhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"` // completed and/or failed; both when empty
+}
+
+// RunRequest starts a run of a stored workflow
+type RunRequest struct {
+	Workflow   string                 `json:"workflow"`
+	Input      string                 `json:"input,omitempty"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	RuntimeDir string                 `json:"runtimeDir,omitempty"`
+	Wait       bool                   `json:"wait,omitempty"` // Respond when the run finished rather than once it is queued
+	Webhooks   []Webhook              `json:"webhooks,omitempty"`
+	Priority   string                 `json:"priority,omitempty"` // PriorityInteractive (the default) or PriorityBatch
+}
+
+// Step is the record of one step of a run
+type Step struct {
+	Name             string    `json:"name"`
+	Model            string    `json:"model,omitempty"`
+	Provider         string    `json:"provider,omitempty"`
+	Status           string    `json:"status"`
+	Error            string    `json:"error,omitempty"`
+	Started          time.Time `json:"started"`
+	Finished         time.Time `json:"finished"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	Cost             float64   `json:"cost,omitempty"`
+	Outputs          []string  `json:"outputs,omitempty"`
+}
+
+// Run is the record of a workflow run
+type Run struct {
+	ID       string    `json:"id"`
+	Workflow string    `json:"workflow"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+	Steps    []Step    `json:"steps,omitempty"`
+}
+
+// Done reports whether the run succeeded, failed or was canceled
+func (r *Run) Done() bool {
+	return r.Status == StatusSucceeded || r.Status == StatusFailed || r.Status == StatusCanceled
+}
+
+// RunResponse is a run and, once it finished, its final output
+type RunResponse struct {
+	Success     bool       `json:"success"`
+	Error       string     `json:"error,omitempty"`
+	Run         *Run       `json:"run,omitempty"`
+	Progress    string     `json:"progress,omitempty"`  // Latest step message while the run is in progress
+	Approvals   []Approval `json:"approvals,omitempty"` // Approval steps the run waits at
+	Output      string     `json:"output,omitempty"`
+	Adjustments []string   `json:"adjustments,omitempty"` // Workflow settings lowered to fit the server\'s run limits
+}
+
+// Approval is an approval step a run waits at
+type Approval struct {
+	Step    string    `json:"step"`
+	Message string    `json:"message"`
+	Content string    `json:"content,omitempty"` // The step's input, passed on once approved
+	Expires time.Time `json:"expires,omitempty"` // When the step gives up waiting; never when zero
+}
+
+// ApprovalDecision approves or rejects an approval step a run waits at
+type ApprovalDecision struct {
+	Step     string `json:"step,omitempty"` // Needed only while the run waits at several steps
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ArtifactInfo describes a file written by a run
+type ArtifactInfo struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// FileInfo describes a file on the server
+type FileInfo struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	IsDir      bool      `json:"isDir"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+	MimeType   string    `json:"mimeType,omitempty"`
+}
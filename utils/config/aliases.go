@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResolveModel returns the model an alias stands for, or name itself when
+// it is not an alias
+func (c *EnvConfig) ResolveModel(name string) string {
+	if c == nil {
+		return name
+	}
+	if model, ok := c.ModelAliases[strings.TrimSpace(name)]; ok {
+		return model
+	}
+	return name
+}
+
+// SetModelAlias makes alias stand for model, replacing what it stood for
+func (c *EnvConfig) SetModelAlias(alias, model string) error {
+	alias, model = strings.TrimSpace(alias), strings.TrimSpace(model)
+	switch {
+	case alias == "" || model == "":
+		return fmt.Errorf("an alias needs a name and a model")
+	case alias == model:
+		return fmt.Errorf("alias '%s' can't stand for itself", alias)
+	case strings.ContainsAny(alias, ", "):
+		return fmt.Errorf("alias '%s' can't contain commas or spaces", alias)
+	}
+	if _, ok := c.ModelAliases[model]; ok {
+		return fmt.Errorf("'%s' is an alias itself; aliases must name a model", model)
+	}
+	if c.ModelAliases == nil {
+		c.ModelAliases = make(map[string]string)
+	}
+	c.ModelAliases[alias] = model
+	return nil
+}
+
+// RemoveModelAlias removes an alias, reporting whether it existed
+func (c *EnvConfig) RemoveModelAlias(alias string) bool {
+	if _, ok := c.ModelAliases[alias]; !ok {
+		return false
+	}
+	delete(c.ModelAliases, alias)
+	return true
+}
@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestModelAliases(t *testing.T) {
+	cfg := &EnvConfig{}
+	if err := cfg.SetModelAlias("support-bot", "ft:gpt-4o-mini-2024-07-18:acme:support:abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.ResolveModel("support-bot"); got != "ft:gpt-4o-mini-2024-07-18:acme:support:abc123" {
+		t.Errorf("ResolveModel(support-bot) = %s", got)
+	}
+	if got := cfg.ResolveModel("gpt-4o"); got != "gpt-4o" {
+		t.Errorf("ResolveModel(gpt-4o) = %s, want the name itself", got)
+	}
+	for _, bad := range [][2]string{{"", "gpt-4o"}, {"gpt-4o", "gpt-4o"}, {"my bot", "gpt-4o"}, {"bot", "support-bot"}} {
+		if err := cfg.SetModelAlias(bad[0], bad[1]); err == nil {
+			t.Errorf("SetModelAlias(%q, %q) succeeded", bad[0], bad[1])
+		}
+	}
+	if !cfg.RemoveModelAlias("support-bot") || cfg.RemoveModelAlias("support-bot") {
+		t.Error("RemoveModelAlias() doesn't report whether the alias existed")
+	}
+	var unset *EnvConfig
+	if unset.ResolveModel("gpt-4o") != "gpt-4o" {
+		t.Error("ResolveModel() on a nil config changed the name")
+	}
+}
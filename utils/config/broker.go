@@ -0,0 +1,38 @@
+package config
+
+import "fmt"
+
+// Message broker types
+const (
+	BrokerKafka = "kafka"
+	BrokerNATS  = "nats"
+)
+
+// BrokerConfig is a Kafka cluster or NATS server that steps consume
+// messages from and publish outputs to. Kafka is reached through a REST
+// proxy, such as Confluent REST Proxy or Redpanda's HTTP proxy.
+type BrokerConfig struct {
+	Type     string `yaml:"type"`               // kafka or nats
+	URL      string `yaml:"url"`                // Kafka REST proxy URL, or NATS server such as nats://localhost:4222 (tls:// for TLS)
+	Username string `yaml:"username,omitempty"` // With password: REST proxy basic auth or NATS user
+	Password string `yaml:"password,omitempty"`
+	Token    string `yaml:"token,omitempty"`  // NATS auth token
+	Stream   string `yaml:"stream,omitempty"` // NATS JetStream stream; consumed messages are acked and published ones confirmed
+}
+
+// Broker returns the message broker configured under name
+func (c *EnvConfig) Broker(name string) (BrokerConfig, error) {
+	broker, ok := c.Brokers[name]
+	if !ok {
+		return BrokerConfig{}, fmt.Errorf("broker %q is not configured in brokers", name)
+	}
+	switch broker.Type {
+	case BrokerKafka, BrokerNATS:
+	default:
+		return BrokerConfig{}, fmt.Errorf("broker %q has unknown type %q (expected kafka or nats)", name, broker.Type)
+	}
+	if broker.URL == "" {
+		return BrokerConfig{}, fmt.Errorf("broker %q needs a url", name)
+	}
+	return broker, nil
+}
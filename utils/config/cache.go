@@ -0,0 +1,24 @@
+package config
+
+import "path/filepath"
+
+// ResponseCacheConfig saves model responses on disk, so a prompt sent again
+// to the same model is answered from the cache
+type ResponseCacheConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	MaxSize string `yaml:"max_size,omitempty"` // Size the cache is kept under, e.g. "1GB"; 512MB by default
+	Dir     string `yaml:"dir,omitempty"`      // Defaults to responses in the cache directory
+}
+
+// ResponseCacheSettings returns the response cache settings, with the
+// directory filled in
+func (c *EnvConfig) ResponseCacheSettings() ResponseCacheConfig {
+	var settings ResponseCacheConfig
+	if c != nil && c.ResponseCache != nil {
+		settings = *c.ResponseCache
+	}
+	if settings.Dir == "" {
+		settings.Dir = filepath.Join(CacheDir(), "responses")
+	}
+	return settings
+}
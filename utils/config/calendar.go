@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CalendarConfig is a calendar that calendar inputs read events from: an
+// ICS feed, such as a calendar's secret address, or a Google Calendar read
+// with the google_drive connector's credentials
+type CalendarConfig struct {
+	ICS      string `yaml:"ics,omitempty"`      // Feed URL (webcal:// too) or file path
+	Google   string `yaml:"google,omitempty"`   // Google Calendar ID, such as primary or team@group.calendar.google.com
+	Timezone string `yaml:"timezone,omitempty"` // Zone events are shown in, such as Europe/Berlin; defaults to the local zone
+}
+
+// Location returns the zone the calendar's events are shown in
+func (c CalendarConfig) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+	}
+	return loc, nil
+}
+
+// Calendar returns the calendar configured under name
+func (c *EnvConfig) Calendar(name string) (CalendarConfig, error) {
+	calendar, ok := c.Calendars[name]
+	if !ok {
+		return CalendarConfig{}, fmt.Errorf("calendar %q is not configured in calendars", name)
+	}
+	if (calendar.ICS == "") == (calendar.Google == "") {
+		return CalendarConfig{}, fmt.Errorf("calendar %q needs either an ics feed or a google calendar ID", name)
+	}
+	return calendar, nil
+}
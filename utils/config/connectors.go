@@ -0,0 +1,42 @@
+package config
+
+// ConnectorsConfig holds the credentials of the services input connectors
+// fetch documents from
+type ConnectorsConfig struct {
+	GoogleDrive *GoogleDriveConfig `yaml:"google_drive,omitempty"`
+	Notion      *NotionConfig      `yaml:"notion,omitempty"`
+	Confluence  *ConfluenceConfig  `yaml:"confluence,omitempty"`
+}
+
+// GoogleDriveConfig authorizes Google Drive requests, with an OAuth access
+// token or with a refresh token exchanged for access tokens as needed
+type GoogleDriveConfig struct {
+	AccessToken  string `yaml:"access_token,omitempty"`
+	ClientID     string `yaml:"client_id,omitempty"`
+	ClientSecret string `yaml:"client_secret,omitempty"`
+	RefreshToken string `yaml:"refresh_token,omitempty"`
+}
+
+// NotionConfig authorizes Notion requests with an integration token
+type NotionConfig struct {
+	Token string `yaml:"token"`
+}
+
+// ConfluenceConfig is a Confluence site and the credentials to read it:
+// an Atlassian account email and API token for Confluence Cloud, or a
+// personal access token for Confluence Data Center
+type ConfluenceConfig struct {
+	URL      string `yaml:"url"`                 // Site base URL, such as https://acme.atlassian.net/wiki
+	Email    string `yaml:"email,omitempty"`     // With api_token
+	APIToken string `yaml:"api_token,omitempty"` // With email
+	Token    string `yaml:"token,omitempty"`     // Personal access token, sent as a bearer token
+}
+
+// ConnectorSettings returns the connector credentials, empty when none are
+// configured
+func (c *EnvConfig) ConnectorSettings() ConnectorsConfig {
+	if c == nil || c.Connectors == nil {
+		return ConnectorsConfig{}
+	}
+	return *c.Connectors
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CredentialSet holds secret references to the API keys of an alternate
+// account, such as a customer's own OpenAI organization, by provider
+type CredentialSet map[string]string
+
+// CredentialSetNames returns the names of the credential sets, sorted
+func (c *EnvConfig) CredentialSetNames() []string {
+	return sortedNames(c.Credentials)
+}
+
+// CheckCredentialSet returns an error when there is no credential set
+// named name
+func (c *EnvConfig) CheckCredentialSet(name string) error {
+	if _, ok := c.Credentials[name]; ok {
+		return nil
+	}
+	if len(c.Credentials) == 0 {
+		return fmt.Errorf("credential set '%s' not found: the env config has no credentials section", name)
+	}
+	return fmt.Errorf("credential set '%s' not found (expected one of %s)", name, strings.Join(c.CredentialSetNames(), ", "))
+}
+
+// WithCredentials returns a copy of this config whose providers use the API
+// keys of the credential set name, fetched with resolve. The keys must be
+// secret references, so they never sit in the env file. Providers the set
+// names that aren't configured are added with every model they support
+// enabled. This config is left as it is.
+func (c *EnvConfig) WithCredentials(name string, resolve func(ref string) (string, error)) (*EnvConfig, error) {
+	if err := c.CheckCredentialSet(name); err != nil {
+		return nil, err
+	}
+	set := c.Credentials[name]
+	withKeys := *c
+	withKeys.Providers = make(map[string]*Provider, len(c.Providers)+len(set))
+	for provider, config := range c.Providers {
+		withKeys.Providers[provider] = config
+	}
+	for _, provider := range sortedNames(set) {
+		ref := set[provider]
+		if !isKeyedProvider(provider) {
+			return nil, fmt.Errorf("credential set '%s': unknown provider '%s' (expected one of %s)", name, provider, strings.Join(KeyedProviders, ", "))
+		}
+		if !IsSecretRef(ref) {
+			return nil, fmt.Errorf("credential set '%s': the %s key must reference a secret manager (%s)", name, provider, strings.Join(SecretSchemes, ", "))
+		}
+		key, err := resolve(ref)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving the %s key of credential set '%s': %w", provider, name, err)
+		}
+		merged := Provider{AnyModel: true}
+		if shared := c.Providers[provider]; shared != nil {
+			merged = *shared
+		}
+		merged.APIKey = key
+		withKeys.Providers[provider] = &merged
+	}
+	return &withKeys, nil
+}
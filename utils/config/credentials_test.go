@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithCredentials(t *testing.T) {
+	models := []Model{{Name: "gpt-4o", Type: "external", Modes: []ModelMode{TextMode}}}
+	cfg := &EnvConfig{
+		Providers: map[string]*Provider{"openai": {APIKey: "sk-shared", Models: models}},
+		Credentials: map[string]CredentialSet{
+			"acme":    {"openai": "vault://secret/data/acme#openai", "anthropic": "vault://secret/data/acme#anthropic"},
+			"plain":   {"openai": "sk-in-the-file"},
+			"unknown": {"ollama": "vault://secret/data/acme#ollama"},
+		},
+	}
+	resolve := func(ref string) (string, error) {
+		if strings.HasSuffix(ref, "#missing") {
+			return "", errors.New("no such field")
+		}
+		return "key-from-" + ref[strings.Index(ref, "#")+1:], nil
+	}
+
+	acme, err := cfg.WithCredentials("acme", resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := acme.Providers["openai"]; p.APIKey != "key-from-openai" || len(p.Models) != 1 || p.AnyModel {
+		t.Errorf("openai = %+v, want the set's key with the shared models", p)
+	}
+	if p := acme.Providers["anthropic"]; p == nil || p.APIKey != "key-from-anthropic" || !p.AnyModel {
+		t.Errorf("anthropic = %+v, want a provider added with any model", p)
+	}
+	if cfg.Providers["openai"].APIKey != "sk-shared" || cfg.Providers["anthropic"] != nil {
+		t.Errorf("the shared providers changed: %+v", cfg.Providers)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"globex", "credential set 'globex' not found (expected one of acme, plain, unknown)"},
+		{"plain", "the openai key must reference a secret manager"},
+		{"unknown", "unknown provider 'ollama'"},
+	}
+	for _, tt := range tests {
+		if _, err := cfg.WithCredentials(tt.name, resolve); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("WithCredentials(%s) error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	cfg.Credentials["acme"]["openai"] = "vault://secret/data/acme#missing"
+	if _, err := cfg.WithCredentials("acme", resolve); err == nil || !strings.Contains(err.Error(), "error resolving the openai key of credential set 'acme': no such field") {
+		t.Errorf("WithCredentials error = %v", err)
+	}
+	if err := (&EnvConfig{}).CheckCredentialSet("acme"); err == nil || !strings.Contains(err.Error(), "no credentials section") {
+		t.Errorf("CheckCredentialSet error = %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Directories chosen with the --config-dir, --cache-dir and --data-dir
+// flags. They take precedence over the environment.
+var (
+	ConfigDirFlag string
+	CacheDirFlag  string
+	DataDirFlag   string
+)
+
+// Environment variables that choose each directory
+const (
+	ConfigDirEnv = "COMANDA_CONFIG_DIR"
+	CacheDirEnv  = "COMANDA_CACHE_DIR"
+	DataDirEnv   = "COMANDA_DATA_DIR"
+)
+
+// EnvFileName is the name of the env config in the config directory
+const EnvFileName = "config.yaml"
+
+// ConfigDir returns the directory of the env config: --config-dir,
+// COMANDA_CONFIG_DIR, $XDG_CONFIG_HOME/comanda or ~/.config/comanda
+func ConfigDir() string {
+	return userDir("config", ConfigDirFlag, ConfigDirEnv, "XDG_CONFIG_HOME", ".config")
+}
+
+// CacheDir returns the directory of files comanda can fetch or compute
+// again: --cache-dir, COMANDA_CACHE_DIR, $XDG_CACHE_HOME/comanda or
+// ~/.cache/comanda
+func CacheDir() string {
+	return userDir("cache", CacheDirFlag, CacheDirEnv, "XDG_CACHE_HOME", ".cache")
+}
+
+// DataDir returns the directory of run history and schedules: --data-dir,
+// COMANDA_DATA_DIR, $XDG_DATA_HOME/comanda or ~/.local/share/comanda
+func DataDir() string {
+	return userDir("data", DataDirFlag, DataDirEnv, "XDG_DATA_HOME", ".local", "share")
+}
+
+// LegacyDir returns ~/.comanda, where history and schedules were kept
+// before comanda followed the XDG base directories
+func LegacyDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".comanda"
+	}
+	return filepath.Join(home, ".comanda")
+}
+
+// userDir resolves a directory from its flag, its environment variable, an
+// XDG variable and finally the default below the home directory, or
+// .comanda/<kind> without one. Relative XDG paths are ignored, as the
+// specification requires.
+func userDir(kind, flag, env, xdg string, defaultPath ...string) string {
+	if flag != "" {
+		return flag
+	}
+	if dir := os.Getenv(env); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv(xdg); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "comanda")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".comanda", kind)
+	}
+	return filepath.Join(append(append([]string{home}, defaultPath...), "comanda")...)
+}
+
+// DefaultEnvPath returns the env config in the config directory
+func DefaultEnvPath() string {
+	return filepath.Join(ConfigDir(), EnvFileName)
+}
+
+// configDirChosen reports whether the config directory was set explicitly
+func configDirChosen() bool {
+	return ConfigDirFlag != "" || os.Getenv(ConfigDirEnv) != ""
+}
+
+// MigrateLegacy returns path, first moving name from the legacy directory
+// there when only the legacy copy exists. If the move fails the legacy path
+// is returned, so existing history and schedules are never lost.
+func MigrateLegacy(name, path string) string {
+	legacy := filepath.Join(LegacyDir(), name)
+	if filepath.Clean(legacy) == filepath.Clean(path) {
+		return path
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return path
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		return path
+	}
+	if err := movePath(legacy, path); err != nil {
+		DebugLog("Keeping %s where it is: %v", legacy, err)
+		return legacy
+	}
+	migrationNotice(legacy, path)
+	return path
+}
+
+// MigrateEnvFile moves a .env in the working directory, which earlier
+// versions read by default, to the config directory. It returns the new
+// path.
+func MigrateEnvFile() (string, error) {
+	target := DefaultEnvPath()
+	if _, err := os.Stat(".env"); err != nil {
+		return "", fmt.Errorf("no .env in the working directory to migrate")
+	}
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("%s already exists; merge .env into it by hand", target)
+	}
+	if err := movePath(".env", target); err != nil {
+		return "", fmt.Errorf("error moving .env to %s: %w", target, err)
+	}
+	return target, nil
+}
+
+// movePath renames from to to, creating the parent directory
+func movePath(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// migrationNotice tells the user once that something they own moved
+func migrationNotice(from, to string) {
+	fmt.Fprintf(os.Stderr, "Moved %s to %s\n", from, to)
+	WriteLog("[INFO] ", "Moved %s to %s", from, to)
+}
+
+// TempDir returns the directory for temporary files such as fetched URLs
+// and file chunks: tmp in the cache directory, or the system temporary
+// directory when that can't be created
+func TempDir() string {
+	dir := filepath.Join(CacheDir(), "tmp")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		DebugLog("Using the system temporary directory: %v", err)
+		return os.TempDir()
+	}
+	return dir
+}
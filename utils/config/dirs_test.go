@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserDirs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, name := range []string{"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME", ConfigDirEnv, CacheDirEnv, DataDirEnv} {
+		t.Setenv(name, "")
+	}
+
+	if got, want := ConfigDir(), filepath.Join(home, ".config", "comanda"); got != want {
+		t.Errorf("ConfigDir() = %s, want %s", got, want)
+	}
+	if got, want := DataDir(), filepath.Join(home, ".local", "share", "comanda"); got != want {
+		t.Errorf("DataDir() = %s, want %s", got, want)
+	}
+
+	// XDG variables must be absolute
+	t.Setenv("XDG_CACHE_HOME", "relative")
+	if got, want := CacheDir(), filepath.Join(home, ".cache", "comanda"); got != want {
+		t.Errorf("CacheDir() = %s, want %s", got, want)
+	}
+	t.Setenv("XDG_CACHE_HOME", "/var/cache")
+	if got, want := CacheDir(), filepath.Join("/var/cache", "comanda"); got != want {
+		t.Errorf("CacheDir() = %s, want %s", got, want)
+	}
+
+	// The variable, then the flag, take precedence
+	t.Setenv(CacheDirEnv, "/srv/cache")
+	if got := CacheDir(); got != "/srv/cache" {
+		t.Errorf("CacheDir() = %s, want /srv/cache", got)
+	}
+	CacheDirFlag = "/tmp/cache"
+	t.Cleanup(func() { CacheDirFlag = "" })
+	if got := CacheDir(); got != "/tmp/cache" {
+		t.Errorf("CacheDir() = %s, want /tmp/cache", got)
+	}
+}
+
+func TestGetEnvPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv(ConfigDirEnv, "")
+	t.Setenv("COMANDA_ENV", "")
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if got, want := GetEnvPath(), filepath.Join(home, ".config", "comanda", "config.yaml"); got != want {
+		t.Errorf("GetEnvPath() = %s, want %s", got, want)
+	}
+
+	// A .env in the working directory is still read until it is migrated
+	os.WriteFile(".env", []byte("providers: {}\n"), 0644)
+	if got := GetEnvPath(); got != ".env" {
+		t.Errorf("GetEnvPath() = %s, want .env", got)
+	}
+	t.Setenv(ConfigDirEnv, filepath.Join(home, "conf"))
+	if got, want := GetEnvPath(), filepath.Join(home, "conf", "config.yaml"); got != want {
+		t.Errorf("GetEnvPath() with %s = %s, want %s", ConfigDirEnv, got, want)
+	}
+	t.Setenv(ConfigDirEnv, "")
+
+	path, err := MigrateEnvFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := GetEnvPath(); got != path {
+		t.Errorf("GetEnvPath() after migrating = %s, want %s", got, path)
+	}
+	if _, err := MigrateEnvFile(); err == nil {
+		t.Error("MigrateEnvFile() without a .env succeeded")
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	legacy := filepath.Join(home, ".comanda", "history")
+	os.MkdirAll(legacy, 0755)
+	os.WriteFile(filepath.Join(legacy, "runs.jsonl"), []byte("{}\n"), 0644)
+
+	path := filepath.Join(home, "data", "history")
+	if got := MigrateLegacy("history", path); got != path {
+		t.Fatalf("MigrateLegacy() = %s, want %s", got, path)
+	}
+	if _, err := os.Stat(filepath.Join(path, "runs.jsonl")); err != nil {
+		t.Errorf("history was not moved: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("legacy history is still there: %v", err)
+	}
+
+	// An existing new location is never replaced
+	os.MkdirAll(legacy, 0755)
+	if got := MigrateLegacy("history", path); got != path {
+		t.Errorf("MigrateLegacy() = %s, want %s", got, path)
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		t.Errorf("legacy history was touched: %v", err)
+	}
+}
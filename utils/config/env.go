@@ -53,16 +53,42 @@ type Model struct {
 
 // Provider represents a provider's configuration
 type Provider struct {
-	APIKey string  `yaml:"api_key"`
-	Models []Model `yaml:"models"`
+	APIKey   string  `yaml:"api_key"`
+	Models   []Model `yaml:"models"`
+	AnyModel bool    `yaml:"-"` // Set for providers added by overrides: every model they support is enabled
 }
 
 // EnvConfig represents the complete environment configuration
 type EnvConfig struct {
-	Providers              map[string]*Provider      `yaml:"providers"` // Changed to store pointers to Provider
-	Server                 *ServerConfig             `yaml:"server,omitempty"`
-	Databases              map[string]DatabaseConfig `yaml:"databases,omitempty"` // Added database configurations
-	DefaultGenerationModel string                    `yaml:"default_generation_model,omitempty"`
+	Providers              map[string]*Provider         `yaml:"providers"` // Changed to store pointers to Provider
+	Server                 *ServerConfig                `yaml:"server,omitempty"`
+	Databases              map[string]DatabaseConfig    `yaml:"databases,omitempty"` // Added database configurations
+	DefaultGenerationModel string                       `yaml:"default_generation_model,omitempty"`
+	ProviderPriority       []string                     `yaml:"provider_priority,omitempty"` // Providers tried first, in order, when detecting a model's provider
+	MCPServers             map[string]MCPServerConfig   `yaml:"mcp_servers,omitempty"`       // MCP servers whose tools agent steps can use
+	Logging                *LoggingConfig               `yaml:"logging,omitempty"`           // Rotating log file for debug and run logs
+	Output                 *OutputConfig                `yaml:"output,omitempty"`            // Pager and clipboard settings for terminal output
+	History                *HistoryConfig               `yaml:"history,omitempty"`           // Where run history is kept
+	Tracing                *TracingConfig               `yaml:"tracing,omitempty"`           // OpenTelemetry trace export
+	Budget                 *Budget                      `yaml:"budget,omitempty"`            // Estimated tokens and cost each run may use
+	Profiles               map[string]*Profile          `yaml:"profiles,omitempty"`          // Named settings selected with --profile or COMANDA_PROFILE
+	Secrets                *SecretsConfig               `yaml:"secrets,omitempty"`           // Secret managers that settings and workflow env values can reference
+	Credentials            map[string]CredentialSet     `yaml:"credentials,omitempty"`       // Named sets of provider keys that workflows and runs can use instead of the shared ones
+	Policy                 *Policy                      `yaml:"policy,omitempty"`            // Providers, models and settings workflows may use
+	HTTP                   *HTTPConfig                  `yaml:"http,omitempty"`              // Connection pooling and timeouts of requests to providers
+	ResponseCache          *ResponseCacheConfig         `yaml:"response_cache,omitempty"`    // Model responses kept on disk and reused for repeated prompts
+	VectorStores           map[string]VectorStoreConfig `yaml:"vector_stores,omitempty"`     // Vector stores that index and retrieve steps use, by name
+	Connectors             *ConnectorsConfig            `yaml:"connectors,omitempty"`        // Credentials of Google Drive, Notion and Confluence inputs
+	Mailboxes              map[string]MailboxConfig     `yaml:"mailboxes,omitempty"`         // IMAP accounts that email inputs and mail triggers read, by name
+	Brokers                map[string]BrokerConfig      `yaml:"brokers,omitempty"`           // Kafka and NATS servers that steps consume from and publish to, by name
+	Trackers               *TrackersConfig              `yaml:"trackers,omitempty"`          // Credentials of jira and linear steps
+	Calendars              map[string]CalendarConfig    `yaml:"calendars,omitempty"`         // ICS feeds and Google Calendars that calendar inputs read, by name
+	ModelAliases           map[string]string            `yaml:"model_aliases,omitempty"`     // Names workflows can use in place of a model's, such as a fine-tuned model's
+
+	overrides  *appliedOverrides    // Per-invocation overrides, restored before saving
+	profile    string               // Name of the profile in use
+	secretRefs map[string]secretRef // Settings whose referenced secret was resolved, by path
+	envVars    []envVarSetting      // Settings COMANDA_<PATH> variables replaced, restored before saving
 }
 
 // Verbose indicates whether verbose logging is enabled
@@ -74,25 +100,36 @@ var Debug bool
 // DebugLog prints debug information if debug mode is enabled
 func DebugLog(format string, args ...interface{}) {
 	if Debug {
-		fmt.Printf("[DEBUG] "+format+"\n", args...)
+		ConsoleLog("[DEBUG] "+format, args...)
 	}
+	WriteLog("[DEBUG] ", format, args...)
 }
 
 // VerboseLog prints verbose information if verbose mode is enabled
 func VerboseLog(format string, args ...interface{}) {
 	if Verbose {
-		fmt.Printf("[VERBOSE] "+format+"\n", args...)
+		ConsoleLog("[VERBOSE] "+format, args...)
 	}
+	WriteLog("[VERBOSE] ", format, args...)
 }
 
-// GetEnvPath returns the environment file path from COMANDA_ENV or the default
+// GetEnvPath returns the environment file path from COMANDA_ENV, a .env in
+// the working directory as earlier versions used, or config.yaml in the
+// config directory
 func GetEnvPath() string {
 	if envPath := os.Getenv("COMANDA_ENV"); envPath != "" {
 		DebugLog("Using environment file from COMANDA_ENV: %s", envPath)
 		return envPath
 	}
-	DebugLog("Using default environment file: .env")
-	return ".env"
+	if !configDirChosen() {
+		if _, err := os.Stat(".env"); err == nil {
+			DebugLog("Using environment file .env in the working directory (comanda configure --migrate moves it to %s)", DefaultEnvPath())
+			return ".env"
+		}
+	}
+	envPath := DefaultEnvPath()
+	DebugLog("Using default environment file: %s", envPath)
+	return envPath
 }
 
 // PromptPassword prompts the user for a password securely
@@ -127,22 +164,39 @@ func EncryptConfig(path string, password string) error {
 		return fmt.Errorf("error reading file: %w", err)
 	}
 
+	encrypted, err := EncryptData(plaintext, password)
+	if err != nil {
+		return err
+	}
+
+	// Write the encrypted data back to the file
+	if err := WriteFileAtomic(path, encrypted); err != nil {
+		return fmt.Errorf("error writing encrypted file: %w", err)
+	}
+
+	DebugLog("Successfully encrypted configuration")
+	return nil
+}
+
+// EncryptData encrypts configuration data with password, in the format
+// DecryptConfig reads
+func EncryptData(plaintext []byte, password string) ([]byte, error) {
 	// Generate a random nonce
 	nonce := make([]byte, 12)
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return fmt.Errorf("error generating nonce: %w", err)
+		return nil, fmt.Errorf("error generating nonce: %w", err)
 	}
 
 	// Create cipher
 	key := deriveKey(password)
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return fmt.Errorf("error creating cipher: %w", err)
+		return nil, fmt.Errorf("error creating cipher: %w", err)
 	}
 
 	aesgcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return fmt.Errorf("error creating GCM: %w", err)
+		return nil, fmt.Errorf("error creating GCM: %w", err)
 	}
 
 	// Encrypt the data
@@ -152,15 +206,37 @@ func EncryptConfig(path string, password string) error {
 	encrypted := append(nonce, ciphertext...)
 
 	// Encode as base64 and add prefix
-	encodedData := "ENCRYPTED:" + base64.StdEncoding.EncodeToString(encrypted)
+	return []byte("ENCRYPTED:" + base64.StdEncoding.EncodeToString(encrypted)), nil
+}
 
-	// Write the encrypted data back to the file
-	if err := os.WriteFile(path, []byte(encodedData), 0644); err != nil {
-		return fmt.Errorf("error writing encrypted file: %w", err)
+// WriteFileAtomic replaces the file at path with data, keeping its
+// permissions, so a reader sees either the old or the new contents and an
+// interrupted write leaves the old file in place
+func WriteFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
 	}
-
-	DebugLog("Successfully encrypted configuration")
-	return nil
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
 // DecryptConfig decrypts the configuration data
@@ -284,7 +360,8 @@ func LoadEncryptedEnvConfig(path string, password string) (*EnvConfig, error) {
 	return &config, nil
 }
 
-// LoadEnvConfigWithPassword attempts to load the config, prompting for password if encrypted
+// LoadEnvConfigWithPassword attempts to load the config, reading the
+// passphrase with ReadPassphrase if it is encrypted
 func LoadEnvConfigWithPassword(path string) (*EnvConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -298,7 +375,7 @@ func LoadEnvConfigWithPassword(path string) (*EnvConfig, error) {
 	}
 
 	if IsEncrypted(data) {
-		password, err := PromptPassword("Enter decryption password: ")
+		password, err := ReadPassphrase("Enter decryption password: ")
 		if err != nil {
 			return nil, err
 		}
@@ -312,12 +389,22 @@ func LoadEnvConfigWithPassword(path string) (*EnvConfig, error) {
 func SaveEnvConfig(path string, config *EnvConfig) error {
 	DebugLog("Attempting to save environment configuration to: %s", path)
 
-	data, err := yaml.Marshal(config)
+	saved, err := config.restoreSecretRefs(config.forSaving())
+	if err == nil {
+		saved, err = config.restoreEnvVars(saved)
+	}
+	if err != nil {
+		return fmt.Errorf("error marshaling env config: %w", err)
+	}
+	data, err := yaml.Marshal(saved)
 	if err != nil {
 		DebugLog("Error marshaling environment config: %v", err)
 		return fmt.Errorf("error marshaling env config: %w", err)
 	}
 
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating env config directory: %w", err)
+	}
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		DebugLog("Error writing environment file: %v", err)
 		return fmt.Errorf("error writing env file: %w", err)
@@ -382,6 +469,12 @@ func (c *EnvConfig) UpdateServerConfig(serverConfig ServerConfig) {
 	c.Server.Enabled = serverConfig.Enabled
 	c.Server.DataDir = serverConfig.DataDir
 	c.Server.CORS = serverConfig.CORS
+	c.Server.AllowedPaths = serverConfig.AllowedPaths
+	c.Server.APIKeys = serverConfig.APIKeys
+	c.Server.Workspaces = serverConfig.Workspaces
+	c.Server.Triggers = serverConfig.Triggers
+	c.Server.MailTriggers = serverConfig.MailTriggers
+	c.Server.WatchTriggers = serverConfig.WatchTriggers
 }
 
 // GetProviderConfig retrieves configuration for a specific provider
@@ -456,31 +549,31 @@ func (c *EnvConfig) GetModelConfig(providerName, modelName string) (*Model, erro
 
 	var exactMatch *Model
 	var baseMatches []*Model
-	
+
 	for _, model := range provider.Models {
 		// Check for exact match first
 		if model.Name == modelName {
 			exactMatch = &model
 			break
 		}
-		
+
 		// Check if this model matches the base name (before any tag)
 		modelBaseName := strings.Split(model.Name, ":")[0]
 		if modelBaseName == modelName {
 			baseMatches = append(baseMatches, &model)
 		}
 	}
-	
+
 	// Return exact match if found
 	if exactMatch != nil {
 		return exactMatch, nil
 	}
-	
+
 	// If no exact match but exactly one base name match, use that
 	if len(baseMatches) == 1 {
 		return baseMatches[0], nil
 	}
-	
+
 	// If multiple base name matches, it's ambiguous
 	if len(baseMatches) > 1 {
 		var modelNames []string
@@ -490,6 +583,10 @@ func (c *EnvConfig) GetModelConfig(providerName, modelName string) (*Model, erro
 		return nil, fmt.Errorf("ambiguous model name %s for provider %s, matches: %v", modelName, providerName, modelNames)
 	}
 
+	if provider.AnyModel {
+		return &Model{Name: modelName, Type: "external", Modes: GetSupportedModes()}, nil
+	}
+
 	return nil, fmt.Errorf("model %s not found for provider %s", modelName, providerName)
 }
 
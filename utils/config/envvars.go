@@ -0,0 +1,472 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvVarPrefix starts the names of the environment variables that set the
+// env config's settings
+const EnvVarPrefix = "COMANDA_"
+
+// envVarSeparator separates the keys of a setting's path in the name of its
+// variable
+const envVarSeparator = "__"
+
+// notCreated is the depth reported when setting a variable added nothing
+const notCreated = -1
+
+// errNoSetting is returned for paths that name no setting
+var errNoSetting = errors.New("no such setting")
+
+// EnvVarName returns the variable that sets the setting at path, such as
+// COMANDA_SERVER__BEARER_TOKEN for server bearerToken
+func EnvVarName(path ...string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = envVarKey(key)
+	}
+	return EnvVarPrefix + strings.Join(keys, envVarSeparator)
+}
+
+// envVarKey spells a YAML key or name the way variable names do, such as
+// BEARER_TOKEN for bearerToken or GPT_4O for gpt-4o
+func envVarKey(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		upper := r >= 'A' && r <= 'Z'
+		if upper && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z'
+			if (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9') || (prev >= 'A' && prev <= 'Z' && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		switch {
+		case r >= 'a' && r <= 'z':
+			b.WriteRune(r - 'a' + 'A')
+		case upper || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// envVarSetting is a setting a variable replaced
+type envVarSetting struct {
+	name      string
+	path      []string
+	value     string // The variable's value
+	fileValue string // The setting's value before, when it existed
+	created   int    // Index of the first key whose entry the variable added, or notCreated
+}
+
+// ApplyEnvVars sets the settings named by the COMANDA_<PATH> variables of
+// environ, a list of NAME=value pairs such as os.Environ returns. The keys
+// of a path are separated by double underscores and spelled in upper case
+// with underscores between words, such as COMANDA_SERVER__PORT or
+// COMANDA_PROVIDERS__OPENAI__API_KEY; named entries of maps and lists are
+// added when missing. Lists of values are comma-separated. Variables whose
+// single key names no setting, such as COMANDA_ENV, are left alone. The
+// settings are never saved to the file.
+func (c *EnvConfig) ApplyEnvVars(environ []string) error {
+	environ = append([]string(nil), environ...)
+	sort.Strings(environ)
+	for _, pair := range environ {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || !strings.HasPrefix(name, EnvVarPrefix) {
+			continue
+		}
+		path := strings.Split(strings.TrimPrefix(name, EnvVarPrefix), envVarSeparator)
+		// Check the path and value before adding anything to the config
+		leaf, err := settingType(reflect.TypeOf(c).Elem(), path)
+		if len(path) == 1 && (err != nil || !settable(leaf)) {
+			continue // Another of comanda's variables, such as COMANDA_ENV
+		}
+		if err == nil {
+			err = parseSetting(reflect.New(leaf).Elem(), value)
+		}
+		if err != nil {
+			return fmt.Errorf("error applying %s: %w", name, err)
+		}
+
+		setting := envVarSetting{name: name, path: path}
+		setting.created, err = visitSetting(reflect.ValueOf(c).Elem(), path, 0, true, func(v reflect.Value) error {
+			setting.fileValue = formatSetting(v)
+			if err := parseSetting(v, value); err != nil {
+				return err
+			}
+			setting.value = formatSetting(v)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error applying %s: %w", name, err)
+		}
+		c.envVars = append(c.envVars, setting)
+		DebugLog("Using %s for %s", name, strings.Join(path, "."))
+	}
+	return nil
+}
+
+// settingValue returns the setting at path below root, or an invalid value
+// when there is none
+func settingValue(root reflect.Value, path []string) reflect.Value {
+	var found reflect.Value
+	visitSetting(root, path, 0, false, func(setting reflect.Value) error {
+		found = setting
+		return nil
+	})
+	return found
+}
+
+// EnvVarNames returns the variables that set settings, sorted
+func (c *EnvConfig) EnvVarNames() []string {
+	names := make([]string, len(c.envVars))
+	for i, setting := range c.envVars {
+		names[i] = setting.name
+	}
+	return names
+}
+
+// restoreEnvVars returns a copy of saved with the settings variables set
+// holding the file's values again, unless they were changed since, and
+// without the entries variables added
+func (c *EnvConfig) restoreEnvVars(saved *EnvConfig) (*EnvConfig, error) {
+	if len(c.envVars) == 0 {
+		return saved, nil
+	}
+	data, err := yaml.Marshal(saved)
+	if err != nil {
+		return nil, err
+	}
+	var restored EnvConfig
+	if err := yaml.Unmarshal(data, &restored); err != nil {
+		return nil, err
+	}
+	root := reflect.ValueOf(&restored).Elem()
+	// Latest first, so the earliest variable's file value is the one kept
+	for i := len(c.envVars) - 1; i >= 0; i-- {
+		setting := c.envVars[i]
+		if current := settingValue(root, setting.path); !current.IsValid() || formatSetting(current) != setting.value {
+			continue // Changed since
+		}
+		if setting.created != notCreated {
+			removeSetting(root, setting.path[:setting.created+1])
+			continue
+		}
+		visitSetting(root, setting.path, 0, false, func(v reflect.Value) error {
+			return parseSetting(v, setting.fileValue)
+		})
+	}
+	return &restored, nil
+}
+
+// settingType returns the type of the setting at path below a section of
+// type t, or an error when path names no setting a variable can set
+func settingType(t reflect.Type, path []string) (reflect.Type, error) {
+	for depth, key := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch {
+		case t.Kind() == reflect.Struct:
+			field, ok := structFieldType(t, key)
+			if !ok {
+				return nil, fmt.Errorf("%w '%s'", errNoSetting, strings.Join(path[:depth+1], "."))
+			}
+			t = field
+		case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+			t = t.Elem()
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct:
+			if namedField(t.Elem()) < 0 {
+				return nil, fmt.Errorf("'%s' has no names to pick an entry by", strings.Join(path[:depth], "."))
+			}
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("'%s' has no settings below it", strings.Join(path[:depth], "."))
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t, nil
+}
+
+// visitSetting calls fn with the setting at path below v, the first depth
+// keys of which were already followed. With create, missing sections and
+// named entries are added on the way, and the index of the first key whose
+// section or entry was added is returned, or notCreated.
+func visitSetting(v reflect.Value, path []string, depth int, create bool, fn func(reflect.Value) error) (int, error) {
+	created := notCreated
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if !create {
+				return notCreated, errNoSetting
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+			created = depth - 1
+		}
+		v = v.Elem()
+	}
+	if depth == len(path) {
+		return created, fn(v)
+	}
+	key := path[depth]
+	deeper := func(c int, err error) (int, error) {
+		if created == notCreated {
+			created = c
+		}
+		return created, err
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok := structField(v, key)
+		if !ok {
+			return notCreated, fmt.Errorf("%w '%s'", errNoSetting, strings.Join(path[:depth+1], "."))
+		}
+		return deeper(visitSetting(field, path, depth+1, create, fn))
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return notCreated, fmt.Errorf("'%s' can't be set from a variable", strings.Join(path[:depth], "."))
+		}
+		if v.IsNil() {
+			if !create {
+				return notCreated, errNoSetting
+			}
+			v.Set(reflect.MakeMap(v.Type()))
+			if created == notCreated {
+				created = depth - 1
+			}
+		}
+		mapKey, ok := mapKeyFor(v, key)
+		entry := reflect.New(v.Type().Elem()).Elem()
+		if ok {
+			entry.Set(v.MapIndex(mapKey))
+		} else if !create {
+			return notCreated, errNoSetting
+		} else {
+			mapKey = reflect.ValueOf(strings.ToLower(key)).Convert(v.Type().Key())
+			if created == notCreated {
+				created = depth
+			}
+		}
+		// Map entries aren't addressable, so the entry is set on a copy
+		c, err := visitSetting(entry, path, depth+1, create, fn)
+		if err == nil || ok {
+			v.SetMapIndex(mapKey, entry)
+		}
+		return deeper(c, err)
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+		nameField := namedField(v.Type().Elem())
+		if nameField < 0 {
+			return notCreated, fmt.Errorf("the entries of '%s' have no names to pick one by", strings.Join(path[:depth], "."))
+		}
+		for i := 0; i < v.Len(); i++ {
+			if sameKey(v.Index(i).Field(nameField).String(), key) {
+				return deeper(visitSetting(v.Index(i), path, depth+1, create, fn))
+			}
+		}
+		if !create {
+			return notCreated, errNoSetting
+		}
+		entry := reflect.New(v.Type().Elem()).Elem()
+		entry.Field(nameField).SetString(strings.ToLower(key))
+		v.Set(reflect.Append(v, entry))
+		if created == notCreated {
+			created = depth
+		}
+		return deeper(visitSetting(v.Index(v.Len()-1), path, depth+1, create, fn))
+	}
+	return notCreated, fmt.Errorf("'%s' has no settings below it", strings.Join(path[:depth], "."))
+}
+
+// removeSetting removes the entry or section at path below root
+func removeSetting(root reflect.Value, path []string) {
+	last := path[len(path)-1]
+	visitSetting(root, path[:len(path)-1], 0, false, func(parent reflect.Value) error {
+		switch parent.Kind() {
+		case reflect.Struct:
+			if field, ok := structField(parent, last); ok {
+				field.Set(reflect.Zero(field.Type()))
+			}
+		case reflect.Map:
+			if key, ok := mapKeyFor(parent, last); ok {
+				parent.SetMapIndex(key, reflect.Value{})
+			}
+		case reflect.Slice:
+			nameField := namedField(parent.Type().Elem())
+			kept := reflect.MakeSlice(parent.Type(), 0, parent.Len())
+			for i := 0; i < parent.Len(); i++ {
+				if !sameKey(parent.Index(i).Field(nameField).String(), last) {
+					kept = reflect.Append(kept, parent.Index(i))
+				}
+			}
+			parent.Set(kept)
+		}
+		return nil
+	})
+}
+
+// structField returns the field of a struct whose YAML key is key
+func structField(v reflect.Value, key string) (reflect.Value, bool) {
+	if i := fieldIndex(v.Type(), key); i >= 0 {
+		return v.Field(i), true
+	}
+	return reflect.Value{}, false
+}
+
+// structFieldType returns the type of the field of a struct type whose
+// YAML key is key
+func structFieldType(t reflect.Type, key string) (reflect.Type, bool) {
+	if i := fieldIndex(t, key); i >= 0 {
+		return t.Field(i).Type, true
+	}
+	return nil, false
+}
+
+// fieldIndex returns the index of the field of a struct type whose YAML key
+// is key, or -1
+func fieldIndex(t reflect.Type, key string) int {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if field.IsExported() && name != "-" && name != "" && sameKey(name, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// mapKeyFor returns the key of a map's entry named key
+func mapKeyFor(m reflect.Value, key string) (reflect.Value, bool) {
+	for _, k := range m.MapKeys() {
+		if sameKey(k.String(), key) {
+			return k, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// namedField returns the index of the name field of a list's entries, or -1
+func namedField(t reflect.Type) int {
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); name == "name" && t.Field(i).Type.Kind() == reflect.String {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameKey reports whether a YAML key or name is spelled key in a variable
+// name
+func sameKey(name, key string) bool {
+	return strings.EqualFold(strings.ReplaceAll(envVarKey(name), "_", ""), strings.ReplaceAll(key, "_", ""))
+}
+
+// settable reports whether a variable can set a setting of type t
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// parseSetting sets a setting from the text of a variable
+func parseSetting(v reflect.Value, text string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("'%s' is not true or false", text)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if text == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a whole number", text)
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		if text == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", text)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.New("it is a list of sections; set the settings of its entries by name")
+		}
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item).Convert(v.Type().Elem()))
+			}
+		}
+		if text == "" {
+			list = reflect.Zero(v.Type())
+		}
+		v.Set(list)
+	default:
+		return errors.New("it is a section; set one of its settings")
+	}
+	return nil
+}
+
+// formatSetting returns the text of a variable that would set a setting as
+// it is
+func formatSetting(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() == 0 {
+			return ""
+		}
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float32, reflect.Float64:
+		if v.Float() == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return ""
+		}
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	}
+	return ""
+}
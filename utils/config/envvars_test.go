@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvVarName(t *testing.T) {
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"server", "bearerToken"}, "COMANDA_SERVER__BEARER_TOKEN"},
+		{[]string{"providers", "openai", "api_key"}, "COMANDA_PROVIDERS__OPENAI__API_KEY"},
+		{[]string{"server", "cors", "allowedOrigins"}, "COMANDA_SERVER__CORS__ALLOWED_ORIGINS"},
+		{[]string{"providers", "openai", "models", "gpt-4o", "type"}, "COMANDA_PROVIDERS__OPENAI__MODELS__GPT_4O__TYPE"},
+		{[]string{"server", "reusePort"}, "COMANDA_SERVER__REUSE_PORT"},
+	}
+	for _, tt := range tests {
+		if got := EnvVarName(tt.path...); got != tt.want {
+			t.Errorf("EnvVarName(%v) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestApplyEnvVars(t *testing.T) {
+	cfg := &EnvConfig{Server: &ServerConfig{Port: 8080, DataDir: "data"}}
+	cfg.AddProvider("openai", Provider{APIKey: "sk-file", Models: []Model{{Name: "gpt-4o", Type: "external", Modes: []ModelMode{TextMode}}}})
+
+	err := cfg.ApplyEnvVars([]string{
+		"HOME=/root",
+		"COMANDA_ENV=/etc/comanda/.env",
+		"COMANDA_SERVER=http://localhost:8080",
+		"COMANDA_OPENAI_KEY=sk-shorthand",
+		"COMANDA_SERVER__PORT=9090",
+		"COMANDA_SERVER__CORS__ALLOWED_ORIGINS=https://a.example, https://b.example",
+		"COMANDA_PROVIDERS__OPENAI__API_KEY=sk-env",
+		"COMANDA_PROVIDERS__OPENAI__MODELS__GPT_4O__TYPE=local",
+		"COMANDA_PROVIDERS__ANTHROPIC__API_KEY=sk-ant-env",
+		"COMANDA_DEFAULT_GENERATION_MODEL=claude-sonnet",
+		"COMANDA_PROVIDER_PRIORITY=anthropic,openai",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9090 || cfg.Server.DataDir != "data" {
+		t.Errorf("server = %d %s", cfg.Server.Port, cfg.Server.DataDir)
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !reflect.DeepEqual(cfg.Server.CORS.AllowedOrigins, want) {
+		t.Errorf("allowed origins = %v, want %v", cfg.Server.CORS.AllowedOrigins, want)
+	}
+	if cfg.Providers["openai"].APIKey != "sk-env" || cfg.Providers["openai"].Models[0].Type != "local" {
+		t.Errorf("openai = %+v", cfg.Providers["openai"])
+	}
+	if p := cfg.Providers["anthropic"]; p == nil || p.APIKey != "sk-ant-env" {
+		t.Errorf("anthropic = %+v, want the provider added", p)
+	}
+	if cfg.DefaultGenerationModel != "claude-sonnet" || !reflect.DeepEqual(cfg.ProviderPriority, []string{"anthropic", "openai"}) {
+		t.Errorf("default model %s, priority %v", cfg.DefaultGenerationModel, cfg.ProviderPriority)
+	}
+	if names := cfg.EnvVarNames(); len(names) != 7 || names[0] != "COMANDA_DEFAULT_GENERATION_MODEL" {
+		t.Errorf("EnvVarNames() = %v", names)
+	}
+
+	// The file's values are saved, without the entries the variables added
+	cfg.Server.BearerToken = "changed-since"
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := SaveEnvConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	saved := string(data)
+	for _, want := range []string{"port: 8080", "api_key: sk-file", "type: external", "bearerToken: changed-since"} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved config lacks %q:\n%s", want, saved)
+		}
+	}
+	for _, unwanted := range []string{"9090", "sk-env", "anthropic", "claude-sonnet", "a.example"} {
+		if strings.Contains(saved, unwanted) {
+			t.Errorf("saved config has %q:\n%s", unwanted, saved)
+		}
+	}
+	if cfg.Server.Port != 9090 {
+		t.Errorf("saving changed the config in use: port %d", cfg.Server.Port)
+	}
+}
+
+func TestApplyEnvVarsErrors(t *testing.T) {
+	tests := []struct {
+		variable string
+		want     string
+	}{
+		{"COMANDA_SERVER__PORT=eighty", "'eighty' is not a whole number"},
+		{"COMANDA_SERVER__ENABLED=maybe", "'maybe' is not true or false"},
+		{"COMANDA_SERVER__NO_SUCH=1", "no such setting 'SERVER.NO_SUCH'"},
+		{"COMANDA_SERVER__CORS=1", "it is a section"},
+		{"COMANDA_SERVER__PORT__X=1", "has no settings below it"},
+	}
+	for _, tt := range tests {
+		cfg := &EnvConfig{}
+		err := cfg.ApplyEnvVars([]string{tt.variable})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ApplyEnvVars(%s) error = %v, want %q", tt.variable, err, tt.want)
+		}
+		if cfg.Server != nil {
+			t.Errorf("ApplyEnvVars(%s) added the server section", tt.variable)
+		}
+	}
+}
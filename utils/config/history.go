@@ -0,0 +1,16 @@
+package config
+
+// HistoryConfig sets where run history is kept
+type HistoryConfig struct {
+	Dir      string `yaml:"dir,omitempty"`      // Step outputs and artifacts, and run records unless Database is set
+	Database string `yaml:"database,omitempty"` // Name of a databases entry that keeps run records
+}
+
+// HistorySettings returns the history settings, or the defaults when the
+// env config has none
+func (c *EnvConfig) HistorySettings() HistoryConfig {
+	if c == nil || c.History == nil {
+		return HistoryConfig{}
+	}
+	return *c.History
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPConfig tunes the connections comanda makes to model providers and
+// other services. Unset fields take the defaults below.
+type HTTPConfig struct {
+	MaxIdleConnsPerHost   int  `yaml:"max_idle_conns_per_host,omitempty"` // Idle connections kept open to each host; 100 by default
+	MaxConnsPerHost       int  `yaml:"max_conns_per_host,omitempty"`      // Connections open to each host at once; unlimited by default
+	IdleConnTimeout       int  `yaml:"idle_conn_timeout,omitempty"`       // Seconds an idle connection is kept; 90 by default
+	DialTimeout           int  `yaml:"dial_timeout,omitempty"`            // Seconds to connect; 30 by default
+	TLSHandshakeTimeout   int  `yaml:"tls_handshake_timeout,omitempty"`   // Seconds for the TLS handshake; 10 by default
+	ResponseHeaderTimeout int  `yaml:"response_header_timeout,omitempty"` // Seconds to wait for a response to start; unlimited by default
+	DNSCacheTTL           int  `yaml:"dns_cache_ttl,omitempty"`           // Seconds host lookups are reused; 60 by default, -1 disables
+	DisableHTTP2          bool `yaml:"disable_http2,omitempty"`           // Only use HTTP/1.1
+}
+
+// Defaults of HTTPConfig
+const (
+	DefaultMaxIdleConnsPerHost = 100
+	DefaultIdleConnTimeout     = 90
+	DefaultDialTimeout         = 30
+	DefaultTLSHandshakeTimeout = 10
+	DefaultDNSCacheTTL         = 60
+)
+
+// HTTPSettings returns the HTTP settings with defaults filled in
+func (c *EnvConfig) HTTPSettings() HTTPConfig {
+	var settings HTTPConfig
+	if c != nil && c.HTTP != nil {
+		settings = *c.HTTP
+	}
+	if settings.MaxIdleConnsPerHost <= 0 {
+		settings.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if settings.IdleConnTimeout <= 0 {
+		settings.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if settings.DialTimeout <= 0 {
+		settings.DialTimeout = DefaultDialTimeout
+	}
+	if settings.TLSHandshakeTimeout <= 0 {
+		settings.TLSHandshakeTimeout = DefaultTLSHandshakeTimeout
+	}
+	if settings.DNSCacheTTL == 0 {
+		settings.DNSCacheTTL = DefaultDNSCacheTTL
+	}
+	return settings
+}
+
+// seconds converts a setting in seconds to a duration
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// NewTransport builds the transport shared by every request comanda makes.
+// Connections are pooled per host and kept alive between requests, so
+// parallel steps calling the same provider reuse them rather than opening a
+// connection and negotiating TLS for each call. HTTP/2 is used when the
+// server offers it.
+func NewTransport(settings HTTPConfig) *http.Transport {
+	dialer := &net.Dialer{Timeout: seconds(settings.DialTimeout), KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+	if settings.DNSCacheTTL > 0 {
+		dial = (&dnsCache{ttl: seconds(settings.DNSCacheTTL), entries: make(map[string]dnsEntry)}).dialer(dialer)
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
+		ForceAttemptHTTP2:     !settings.DisableHTTP2,
+		MaxIdleConns:          0, // Limited per host instead
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		IdleConnTimeout:       seconds(settings.IdleConnTimeout),
+		TLSHandshakeTimeout:   seconds(settings.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: seconds(settings.ResponseHeaderTimeout),
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// dnsCache reuses host lookups for a while, so a burst of new connections
+// to one provider doesn't make a lookup each
+type dnsCache struct {
+	ttl     time.Duration
+	lookup  func(ctx context.Context, host string) ([]string, error) // net.DefaultResolver.LookupHost when nil
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// resolve returns the addresses of host, looking it up when the cached
+// addresses have expired
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	lookup := c.lookup
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupHost
+	}
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// dialer returns a dial function connecting to the cached addresses of a
+// host in turn
+func (c *dnsCache) dialer(d *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return d.DialContext(ctx, network, address)
+		}
+		addrs, err := c.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, addr := range addrs {
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSettingsDefaults(t *testing.T) {
+	var cfg *EnvConfig
+	got := cfg.HTTPSettings()
+	if got.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost || got.DNSCacheTTL != DefaultDNSCacheTTL || got.DialTimeout != DefaultDialTimeout {
+		t.Errorf("HTTPSettings() = %+v, want the defaults", got)
+	}
+
+	cfg = &EnvConfig{HTTP: &HTTPConfig{MaxIdleConnsPerHost: 8, DNSCacheTTL: -1, ResponseHeaderTimeout: 120}}
+	got = cfg.HTTPSettings()
+	if got.MaxIdleConnsPerHost != 8 || got.DNSCacheTTL != -1 || got.ResponseHeaderTimeout != 120 || got.IdleConnTimeout != DefaultIdleConnTimeout {
+		t.Errorf("HTTPSettings() = %+v, want the settings with defaults for the rest", got)
+	}
+}
+
+func TestTransportReusesConnections(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport((&EnvConfig{}).HTTPSettings())}
+	var wg sync.WaitGroup
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := client.Get(server.URL)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}()
+		}
+		wg.Wait()
+	}
+
+	if conns > 10 {
+		t.Errorf("30 requests, 10 at a time, opened %d connections, want at most 10", conns)
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	lookups := 0
+	cache := &dnsCache{
+		ttl:     time.Hour,
+		entries: make(map[string]dnsEntry),
+		lookup: func(ctx context.Context, host string) ([]string, error) {
+			lookups++
+			return []string{"127.0.0.1"}, nil
+		},
+	}
+	for i := 0; i < 3; i++ {
+		addrs, err := cache.resolve(context.Background(), "api.example.com")
+		if err != nil || len(addrs) != 1 {
+			t.Fatalf("resolve() = %v, %v", addrs, err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("made %d lookups, want 1", lookups)
+	}
+
+	cache.entries["api.example.com"] = dnsEntry{addrs: []string{"127.0.0.1"}, expires: time.Now().Add(-time.Second)}
+	cache.resolve(context.Background(), "api.example.com")
+	if lookups != 2 {
+		t.Errorf("made %d lookups after expiry, want 2", lookups)
+	}
+}
+
+func TestDNSCacheDial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	cache := &dnsCache{
+		ttl:     time.Hour,
+		entries: make(map[string]dnsEntry),
+		lookup: func(ctx context.Context, host string) ([]string, error) {
+			return []string{"127.0.0.1"}, nil
+		},
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	conn, err := cache.dialer(&net.Dialer{Timeout: time.Second})(context.Background(), "tcp", net.JoinHostPort("provider.invalid", port))
+	if err != nil {
+		t.Fatalf("dial through the cache error = %v", err)
+	}
+	conn.Close()
+}
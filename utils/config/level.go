@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// LogLevel is how much comanda prints to the console. The log file always
+// receives debug output, whatever the level.
+type LogLevel int
+
+const (
+	LevelWarn  LogLevel = iota // --quiet: only warnings, errors and results
+	LevelInfo                  // Default: progress and status messages
+	LevelDebug                 // -v: debug messages from comanda and the providers
+	LevelTrace                 // -vv: also full HTTP requests and responses, secrets redacted
+)
+
+// Level is the console verbosity
+var Level = LevelInfo
+
+// SetLevel sets the console verbosity, and Verbose and Debug to match
+func SetLevel(level LogLevel) {
+	Level = level
+	Verbose = level >= LevelDebug
+	Debug = level >= LevelDebug
+}
+
+// Quiet reports whether informational messages should be suppressed
+func Quiet() bool {
+	return Level < LevelInfo
+}
+
+// InfoLog prints a status message unless --quiet is set
+func InfoLog(format string, args ...interface{}) {
+	if !Quiet() {
+		ConsoleLog(format, args...)
+	}
+	WriteLog("[INFO] ", format, args...)
+}
+
+// WarnLog prints a warning to stderr, so it shows with --quiet and doesn't
+// mix with results on stdout
+func WarnLog(format string, args ...interface{}) {
+	fmt.Fprintln(os.Stderr, Redact(fmt.Sprintf("Warning: "+format, args...)))
+	WriteLog("[WARN] ", format, args...)
+}
+
+// TraceLog prints a message at the trace level. Trace messages are only
+// written to the log file while tracing, since they include full bodies.
+func TraceLog(format string, args ...interface{}) {
+	if Level < LevelTrace {
+		return
+	}
+	ConsoleLog("[TRACE] "+format, args...)
+	WriteLog("[TRACE] ", format, args...)
+}
+
+// TraceTransport wraps an HTTP transport to print every request and
+// response, with credentials redacted, at the trace level
+func TraceTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t, ok := base.(*traceTransport); ok {
+		return t
+	}
+	return &traceTransport{base: base}
+}
+
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Level < LevelTrace {
+		return t.base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	TraceLog("HTTP request %s %s\n%s%s", req.Method, redactURL(req.URL), RedactHeaders(req.Header), Redact(string(body)))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		TraceLog("HTTP request %s %s failed: %v", req.Method, redactURL(req.URL), err)
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err != nil {
+		return nil, err
+	}
+	TraceLog("HTTP response %s from %s\n%s%s", resp.Status, redactURL(req.URL), RedactHeaders(resp.Header), Redact(string(respBody)))
+	return resp, nil
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTraceTransportRedactsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	defer server.Close()
+
+	SetLevel(LevelTrace)
+	defer SetLevel(LevelInfo)
+	AddSecret("sk-trace-secret-123")
+
+	var out string
+	captureStdout(t, &out, func() {
+		client := &http.Client{Transport: TraceTransport(nil)}
+		req, _ := http.NewRequest("POST", server.URL+"/v1/chat?key=goog-secret", strings.NewReader(`"token sk-trace-secret-123"`))
+		req.Header.Set("Authorization", "Bearer sk-trace-secret-123")
+		req.Header.Set("X-Goog-Api-Key", "goog-secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), "sk-trace-secret-123") {
+			t.Errorf("response body was altered: %s", body)
+		}
+	})
+
+	if strings.Contains(out, "sk-trace-secret-123") || strings.Contains(out, "goog-secret") {
+		t.Errorf("trace output leaks a secret:\n%s", out)
+	}
+	if !strings.Contains(out, "[TRACE] HTTP request POST") || !strings.Contains(out, "HTTP response 200 OK") || !strings.Contains(out, `"token ***"`) {
+		t.Errorf("unexpected trace output:\n%s", out)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel(LevelInfo)
+	SetLevel(LevelWarn)
+	if !Quiet() || Verbose || Debug {
+		t.Errorf("LevelWarn: Quiet=%v Verbose=%v Debug=%v", Quiet(), Verbose, Debug)
+	}
+	SetLevel(LevelDebug)
+	if Quiet() || !Verbose || !Debug {
+		t.Errorf("LevelDebug: Quiet=%v Verbose=%v Debug=%v", Quiet(), Verbose, Debug)
+	}
+}
+
+func TestWarnLogShowsWhenQuiet(t *testing.T) {
+	defer SetLevel(LevelInfo)
+	SetLevel(LevelWarn)
+	AddSecret("warn-secret-456")
+
+	var stdout, stderr string
+	captureStdout(t, &stdout, func() {
+		captureOutput(t, &os.Stderr, &stderr, func() {
+			WarnLog("feed %s skipped", "warn-secret-456")
+			InfoLog("progress")
+		})
+	})
+	if stderr != "Warning: feed *** skipped\n" {
+		t.Errorf("stderr = %q", stderr)
+	}
+	if stdout != "" {
+		t.Errorf("stdout = %q, want nothing with --quiet", stdout)
+	}
+}
+
+// captureStdout runs fn and stores what it printed in out
+func captureStdout(t *testing.T, out *string, fn func()) {
+	t.Helper()
+	captureOutput(t, &os.Stdout, out, fn)
+}
+
+// captureOutput runs fn and stores what it wrote to *file in out
+func captureOutput(t *testing.T, file **os.File, out *string, fn func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := *file
+	*file = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	defer func() {
+		w.Close()
+		*file = original
+		*out = string(<-done)
+	}()
+	fn()
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoggingConfig sets up the log file in the env config. The --log-file flags
+// take precedence.
+type LoggingConfig struct {
+	File       string `yaml:"file,omitempty"`        // Log file path; empty disables file logging
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"` // Size in megabytes at which the file is rotated
+	MaxAge     string `yaml:"max_age,omitempty"`     // Duration rotated files are kept for, e.g. 168h
+	MaxBackups int    `yaml:"max_backups,omitempty"` // Number of rotated files kept
+}
+
+var (
+	logMu     sync.Mutex
+	logOutput io.Writer
+)
+
+// SetLogOutput sends every debug, verbose and run log line to w, whatever
+// the console verbosity. Pass nil to stop.
+func SetLogOutput(w io.Writer) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logOutput = w
+}
+
+// LogOutput returns the log file writer, or nil when there is none
+func LogOutput() io.Writer {
+	logMu.Lock()
+	defer logMu.Unlock()
+	return logOutput
+}
+
+// WriteLog writes a timestamped line to the log file, if one is set, with
+// secrets redacted
+func WriteLog(prefix, format string, args ...interface{}) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if logOutput == nil {
+		return
+	}
+	msg := strings.TrimRight(Redact(fmt.Sprintf(format, args...)), "\n")
+	fmt.Fprintf(logOutput, "%s %s%s\n", time.Now().Format("2006-01-02T15:04:05.000Z07:00"), prefix, msg)
+}
+
+// ConsoleAndLog returns a writer that writes to console and, when a log file
+// is set, to the log file too
+func ConsoleAndLog(console io.Writer) io.Writer {
+	if w := LogOutput(); w != nil {
+		return io.MultiWriter(console, w)
+	}
+	return console
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultMailFolder is the folder email inputs and mail triggers read when
+// neither they nor their mailbox name one
+const DefaultMailFolder = "INBOX"
+
+// DefaultMailPollInterval is how often a mail trigger checks its folder
+const DefaultMailPollInterval = 60 * time.Second
+
+// MailboxConfig is an IMAP account that email inputs and mail triggers
+// read messages from
+type MailboxConfig struct {
+	Host      string `yaml:"host"`
+	Port      int    `yaml:"port,omitempty"` // Defaults to 993, or 143 with plaintext
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`            // Or an app password
+	Folder    string `yaml:"folder,omitempty"`    // Read when an input or trigger names none; defaults to INBOX
+	Plaintext bool   `yaml:"plaintext,omitempty"` // Connect without TLS, such as to a local mail bridge
+}
+
+// FolderOr returns folder, or the mailbox's default folder when it is empty
+func (m MailboxConfig) FolderOr(folder string) string {
+	if folder != "" {
+		return folder
+	}
+	if m.Folder != "" {
+		return m.Folder
+	}
+	return DefaultMailFolder
+}
+
+// Mailbox returns the mailbox configured under name
+func (c *EnvConfig) Mailbox(name string) (MailboxConfig, error) {
+	mailbox, ok := c.Mailboxes[name]
+	if !ok {
+		return MailboxConfig{}, fmt.Errorf("mailbox %q is not configured in mailboxes", name)
+	}
+	if mailbox.Host == "" || mailbox.Username == "" {
+		return MailboxConfig{}, fmt.Errorf("mailbox %q needs a host and username", name)
+	}
+	return mailbox, nil
+}
+
+// MailTrigger starts a stored workflow for each new message that arrives
+// in a mailbox folder. The message is the run's input; its attachments are
+// saved in the run's runtime directory.
+type MailTrigger struct {
+	Name      string            `yaml:"name"`
+	Workflow  string            `yaml:"workflow"`
+	Mailbox   string            `yaml:"mailbox"`            // Name in the mailboxes section of the environment
+	Folder    string            `yaml:"folder,omitempty"`   // Defaults to the mailbox's folder
+	From      string            `yaml:"from,omitempty"`     // Only messages whose sender contains this
+	Subject   string            `yaml:"subject,omitempty"`  // Only messages whose subject contains this
+	Interval  int               `yaml:"interval,omitempty"` // Seconds between checks; defaults to 60
+	Params    map[string]string `yaml:"params,omitempty"`   // Workflow params read from message fields: from, to, cc, subject, date, message_id
+	Workspace string            `yaml:"workspace,omitempty"`
+}
+
+// PollInterval returns how often the trigger checks its folder
+func (t MailTrigger) PollInterval() time.Duration {
+	if t.Interval > 0 {
+		return time.Duration(t.Interval) * time.Second
+	}
+	return DefaultMailPollInterval
+}
@@ -0,0 +1,10 @@
+package config
+
+// MCPServerConfig describes a Model Context Protocol server launched over stdio
+type MCPServerConfig struct {
+	Command string            `yaml:"command"`           // Executable that starts the server
+	Args    []string          `yaml:"args,omitempty"`    // Arguments passed to the command
+	Env     map[string]string `yaml:"env,omitempty"`     // Extra environment variables for the server process
+	Dir     string            `yaml:"dir,omitempty"`     // Working directory for the server process
+	Timeout int               `yaml:"timeout,omitempty"` // Seconds to wait for each request (default 60)
+}
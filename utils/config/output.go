@@ -0,0 +1,39 @@
+package config
+
+import "strings"
+
+// DefaultPager is used when neither the env config nor $PAGER names one.
+// -F quits straight away when the text fits on one screen, -R keeps colors
+// and -X leaves the text on the terminal afterwards.
+const DefaultPager = "less -FRX"
+
+// OutputConfig sets how workflow responses are shown on a terminal
+type OutputConfig struct {
+	Pager string `yaml:"pager,omitempty"` // Pager command for long responses; "never" disables paging
+	Copy  bool   `yaml:"copy,omitempty"`  // Always copy the final output to the clipboard
+}
+
+// OutputSettings returns the output settings, or the defaults when the env
+// config has none
+func (c *EnvConfig) OutputSettings() OutputConfig {
+	if c == nil || c.Output == nil {
+		return OutputConfig{}
+	}
+	return *c.Output
+}
+
+// PagerCommand returns the pager to use, or an empty string when paging is
+// disabled. getenv is consulted for $PAGER when the config sets none.
+func (o OutputConfig) PagerCommand(getenv func(string) string) string {
+	pager := strings.TrimSpace(o.Pager)
+	if pager == "" {
+		pager = strings.TrimSpace(getenv("PAGER"))
+	}
+	if pager == "never" || pager == "cat" {
+		return ""
+	}
+	if pager == "" {
+		return DefaultPager
+	}
+	return pager
+}
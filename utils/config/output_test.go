@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestPagerCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		config OutputConfig
+		pager  string
+		want   string
+	}{
+		{"default", OutputConfig{}, "", DefaultPager},
+		{"from environment", OutputConfig{}, "more", "more"},
+		{"config wins", OutputConfig{Pager: "bat -p"}, "more", "bat -p"},
+		{"never", OutputConfig{Pager: "never"}, "more", ""},
+		{"cat disables", OutputConfig{}, "cat", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string {
+				if key == "PAGER" {
+					return tt.pager
+				}
+				return ""
+			}
+			if got := tt.config.PagerCommand(getenv); got != tt.want {
+				t.Errorf("PagerCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputSettings(t *testing.T) {
+	var nilConfig *EnvConfig
+	if got := nilConfig.OutputSettings(); got.Copy || got.Pager != "" {
+		t.Errorf("OutputSettings() on nil config = %+v, want defaults", got)
+	}
+	cfg := &EnvConfig{Output: &OutputConfig{Copy: true}}
+	if !cfg.OutputSettings().Copy {
+		t.Error("OutputSettings().Copy = false, want true")
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeyedProviders are the hosted providers whose API key can be overridden
+// per invocation
+var KeyedProviders = []string{"openai", "anthropic", "google", "xai", "deepseek", "moonshot"}
+
+// DefaultModelEnv is the environment variable that overrides the default
+// generation model
+const DefaultModelEnv = "COMANDA_DEFAULT_MODEL"
+
+// ProviderKeyEnv returns the environment variable that overrides a
+// provider's API key, e.g. COMANDA_OPENAI_KEY
+func ProviderKeyEnv(provider string) string {
+	return "COMANDA_" + strings.ToUpper(provider) + "_KEY"
+}
+
+// Overrides are settings for a single invocation, from flags or environment
+// variables. They take precedence over the env config file and are never
+// saved to it.
+type Overrides struct {
+	ProviderKeys map[string]string // API keys by provider name
+	DefaultModel string            // Default generation model
+}
+
+// OverridesFromEnv reads COMANDA_<PROVIDER>_KEY and COMANDA_DEFAULT_MODEL
+// using getenv
+func OverridesFromEnv(getenv func(string) string) Overrides {
+	o := Overrides{ProviderKeys: make(map[string]string), DefaultModel: getenv(DefaultModelEnv)}
+	for _, name := range KeyedProviders {
+		if key := getenv(ProviderKeyEnv(name)); key != "" {
+			o.ProviderKeys[name] = key
+		}
+	}
+	return o
+}
+
+// ParseProviderKeys parses provider=key pairs such as openai=sk-...
+func ParseProviderKeys(pairs []string) (map[string]string, error) {
+	keys := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, key, ok := strings.Cut(pair, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid provider key '%s': expected provider=key", redactPair(pair))
+		}
+		if !isKeyedProvider(name) {
+			return nil, fmt.Errorf("unknown provider '%s' (expected one of %s)", name, strings.Join(KeyedProviders, ", "))
+		}
+		keys[name] = strings.TrimSpace(key)
+	}
+	return keys, nil
+}
+
+// Merge returns o with the settings of other added, other taking precedence
+func (o Overrides) Merge(other Overrides) Overrides {
+	merged := Overrides{ProviderKeys: make(map[string]string), DefaultModel: o.DefaultModel}
+	for name, key := range o.ProviderKeys {
+		merged.ProviderKeys[name] = key
+	}
+	for name, key := range other.ProviderKeys {
+		merged.ProviderKeys[name] = key
+	}
+	if other.DefaultModel != "" {
+		merged.DefaultModel = other.DefaultModel
+	}
+	return merged
+}
+
+// appliedOverrides remembers the file's values that overrides replaced, so
+// that saving the config never writes injected secrets
+type appliedOverrides struct {
+	fileKeys     map[string]string // Replaced API keys by provider
+	added        map[string]bool   // Providers that only exist through an override
+	keys         map[string]string // Injected API keys by provider
+	fileDefault  string
+	defaultModel string
+}
+
+// ApplyOverrides sets the override API keys and default model. Providers
+// missing from the file are added with every model they support enabled,
+// so workflows run without an env config file.
+func (c *EnvConfig) ApplyOverrides(o Overrides) {
+	if len(o.ProviderKeys) == 0 && o.DefaultModel == "" {
+		return
+	}
+	if c.Providers == nil {
+		c.Providers = make(map[string]*Provider)
+	}
+	if c.overrides == nil {
+		c.overrides = &appliedOverrides{fileKeys: make(map[string]string), added: make(map[string]bool), keys: make(map[string]string), fileDefault: c.DefaultGenerationModel}
+	}
+
+	names := make([]string, 0, len(o.ProviderKeys))
+	for name := range o.ProviderKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := o.ProviderKeys[name]
+		provider := c.Providers[name]
+		if provider == nil {
+			provider = &Provider{AnyModel: true}
+			c.Providers[name] = provider
+			c.overrides.added[name] = true
+		} else if _, seen := c.overrides.fileKeys[name]; !seen && !c.overrides.added[name] {
+			c.overrides.fileKeys[name] = provider.APIKey
+		}
+		provider.APIKey = key
+		c.overrides.keys[name] = key
+		DebugLog("Using API key override for provider %s", name)
+	}
+
+	if o.DefaultModel != "" {
+		c.DefaultGenerationModel = o.DefaultModel
+		c.overrides.defaultModel = o.DefaultModel
+		DebugLog("Using default model override %s", o.DefaultModel)
+	}
+}
+
+// forSaving returns the config as it should be written to the file, with
+// the values replaced by overrides restored
+func (c *EnvConfig) forSaving() *EnvConfig {
+	if c.overrides == nil {
+		return c
+	}
+	saved := *c
+	saved.Providers = make(map[string]*Provider, len(c.Providers))
+	for name, provider := range c.Providers {
+		if provider == nil || provider.APIKey != c.overrides.keys[name] {
+			saved.Providers[name] = provider // Not overridden, or changed since
+			continue
+		}
+		if c.overrides.added[name] && len(provider.Models) == 0 {
+			continue
+		}
+		restored := *provider
+		restored.APIKey = c.overrides.fileKeys[name]
+		saved.Providers[name] = &restored
+	}
+	if c.overrides.defaultModel != "" && c.DefaultGenerationModel == c.overrides.defaultModel {
+		saved.DefaultGenerationModel = c.overrides.fileDefault
+	}
+	return &saved
+}
+
+func isKeyedProvider(name string) bool {
+	for _, p := range KeyedProviders {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// redactPair hides the key of a provider=key pair in error messages
+func redactPair(pair string) string {
+	if name, _, ok := strings.Cut(pair, "="); ok {
+		return name + "=***"
+	}
+	if len(pair) > 4 {
+		return pair[:4] + "***"
+	}
+	return pair
+}
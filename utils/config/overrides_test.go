@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseProviderKeys(t *testing.T) {
+	keys, err := ParseProviderKeys([]string{"openai=sk-one", "Anthropic = sk-ant=x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys["openai"] != "sk-one" || keys["anthropic"] != "sk-ant=x" {
+		t.Errorf("ParseProviderKeys() = %v", keys)
+	}
+
+	for _, pair := range []string{"sk-secret-value", "openai=", "ollama=LOCAL"} {
+		_, err := ParseProviderKeys([]string{pair})
+		if err == nil {
+			t.Errorf("ParseProviderKeys(%q) expected an error", pair)
+		} else if strings.Contains(err.Error(), "secret-value") {
+			t.Errorf("error leaks the key: %v", err)
+		}
+	}
+}
+
+func TestOverridesFromEnv(t *testing.T) {
+	env := map[string]string{"COMANDA_OPENAI_KEY": "sk-env", "COMANDA_XAI_KEY": "xai-env", DefaultModelEnv: "gpt-4o"}
+	o := OverridesFromEnv(func(name string) string { return env[name] })
+	merged := o.Merge(Overrides{ProviderKeys: map[string]string{"openai": "sk-flag"}})
+	if merged.ProviderKeys["openai"] != "sk-flag" || merged.ProviderKeys["xai"] != "xai-env" || merged.DefaultModel != "gpt-4o" {
+		t.Errorf("merged overrides = %+v", merged)
+	}
+}
+
+func TestApplyOverridesAreNotSaved(t *testing.T) {
+	cfg := &EnvConfig{DefaultGenerationModel: "claude-3-5-sonnet-latest"}
+	cfg.AddProvider("openai", Provider{APIKey: "sk-file", Models: []Model{{Name: "gpt-4o", Type: "external", Modes: []ModelMode{TextMode}}}})
+	cfg.ApplyOverrides(Overrides{
+		ProviderKeys: map[string]string{"openai": "sk-injected", "google": "g-injected"},
+		DefaultModel: "gpt-4o-mini",
+	})
+
+	if cfg.Providers["openai"].APIKey != "sk-injected" || cfg.DefaultGenerationModel != "gpt-4o-mini" {
+		t.Fatalf("overrides not applied: %+v", cfg)
+	}
+	// Added providers enable every model, configured providers keep their list
+	if m, err := cfg.GetModelConfig("google", "gemini-2.0-flash"); err != nil || !m.HasMode(FileMode) {
+		t.Errorf("GetModelConfig(google) = %+v, %v", m, err)
+	}
+	if _, err := cfg.GetModelConfig("openai", "o1"); err == nil {
+		t.Error("expected unconfigured openai model to be rejected")
+	}
+
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := SaveEnvConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "injected") || strings.Contains(string(data), "google") || strings.Contains(string(data), "gpt-4o-mini") {
+		t.Errorf("saved config contains overrides:\n%s", data)
+	}
+	saved, err := LoadEnvConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Providers["openai"].APIKey != "sk-file" || saved.DefaultGenerationModel != "claude-3-5-sonnet-latest" {
+		t.Errorf("file values not restored: %+v", saved)
+	}
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Environment variables that supply the passphrase of an encrypted env
+// config, so headless deployments can start without a prompt
+const (
+	PassphraseEnv       = "COMANDA_PASSPHRASE"        // The passphrase itself
+	PassphraseFileEnv   = "COMANDA_PASSPHRASE_FILE"   // A file holding it, such as a mounted container secret
+	PassphraseSocketEnv = "COMANDA_PASSPHRASE_SOCKET" // The socket of a passphrase agent
+)
+
+// PassphraseSocketName is the name of the passphrase agent's socket
+const PassphraseSocketName = "passphrase.sock"
+
+// ErrNoPassphrase is returned when an encrypted env config is read without
+// a terminal and nothing supplies its passphrase
+var ErrNoPassphrase = errors.New("the env config is encrypted and no passphrase was supplied: set " +
+	PassphraseEnv + " or " + PassphraseFileEnv + ", or run 'comanda configure agent'")
+
+// PassphraseSocketPath returns the socket of the passphrase agent:
+// COMANDA_PASSPHRASE_SOCKET, or passphrase.sock in $XDG_RUNTIME_DIR/comanda
+// or, without a runtime directory, the cache directory
+func PassphraseSocketPath() string {
+	if path := os.Getenv(PassphraseSocketEnv); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "comanda", PassphraseSocketName)
+	}
+	return filepath.Join(CacheDir(), PassphraseSocketName)
+}
+
+// LookupPassphrase returns the passphrase supplied without a prompt: from
+// COMANDA_PASSPHRASE, the file COMANDA_PASSPHRASE_FILE names, or a running
+// passphrase agent. ok is false when none supplies one.
+func LookupPassphrase() (passphrase string, ok bool, err error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		DebugLog("Using the passphrase from %s", PassphraseEnv)
+		return passphrase, true, nil
+	}
+	if path := os.Getenv(PassphraseFileEnv); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("error reading passphrase file: %w", err)
+		}
+		DebugLog("Using the passphrase from %s", path)
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	path := PassphraseSocketPath()
+	if _, err := os.Stat(path); err != nil {
+		if os.Getenv(PassphraseSocketEnv) != "" {
+			return "", false, fmt.Errorf("no passphrase agent at %s: %w", path, err)
+		}
+		return "", false, nil
+	}
+	passphrase, err = askAgent(path)
+	if err != nil {
+		if os.Getenv(PassphraseSocketEnv) != "" {
+			return "", false, fmt.Errorf("error asking the passphrase agent: %w", err)
+		}
+		// A socket left behind by an agent that exited
+		DebugLog("Ignoring passphrase agent at %s: %v", path, err)
+		return "", false, nil
+	}
+	DebugLog("Using the passphrase from the agent at %s", path)
+	return passphrase, true, nil
+}
+
+// ReadPassphrase returns the passphrase LookupPassphrase finds, or prompts
+// for it when stdin is a terminal
+func ReadPassphrase(prompt string) (string, error) {
+	if passphrase, ok, err := LookupPassphrase(); err != nil || ok {
+		return passphrase, err
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", ErrNoPassphrase
+	}
+	return PromptPassword(prompt)
+}
+
+// askAgent reads the passphrase from the agent listening on path
+func askAgent(path string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(io.LimitReader(conn, 4096))
+	if err != nil {
+		return "", err
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return "", errors.New("the agent sent no passphrase")
+	}
+	return passphrase, nil
+}
+
+// ListenPassphraseSocket creates the passphrase agent's socket at path,
+// usable only by the current user. A socket left behind by an agent that
+// exited is replaced; one in use is an error.
+func ListenPassphraseSocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating socket directory: %w", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a passphrase agent is already listening on %s", path)
+		}
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error restricting %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// ServePassphrase hands passphrase to each process that connects to
+// listener, until the listener is closed
+func ServePassphrase(listener net.Listener, passphrase string) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		io.WriteString(conn, passphrase+"\n")
+		conn.Close()
+	}
+}
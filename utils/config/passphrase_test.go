@@ -0,0 +1,85 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(PassphraseEnv, "")
+	t.Setenv(PassphraseFileEnv, "")
+	t.Setenv(PassphraseSocketEnv, filepath.Join(dir, "missing.sock"))
+	if _, _, err := LookupPassphrase(); err == nil {
+		t.Error("LookupPassphrase() with a missing agent socket succeeded")
+	}
+
+	// The agent hands out its passphrase
+	socket := filepath.Join(dir, PassphraseSocketName)
+	t.Setenv(PassphraseSocketEnv, socket)
+	listener, err := ListenPassphraseSocket(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServePassphrase(listener, "from-agent")
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+	if _, err := ListenPassphraseSocket(socket); err == nil {
+		t.Error("a second agent listened on the same socket")
+	}
+	if got, ok, err := LookupPassphrase(); err != nil || !ok || got != "from-agent" {
+		t.Errorf("LookupPassphrase() = %q, %v, %v; want the agent's", got, ok, err)
+	}
+	listener.Close()
+
+	// A file, then the variable, take precedence
+	file := filepath.Join(dir, "passphrase")
+	os.WriteFile(file, []byte("from-file\n"), 0600)
+	t.Setenv(PassphraseFileEnv, file)
+	if got, _, _ := LookupPassphrase(); got != "from-file" {
+		t.Errorf("LookupPassphrase() = %q, want from-file", got)
+	}
+	t.Setenv(PassphraseEnv, "from-env")
+	if got, _, _ := LookupPassphrase(); got != "from-env" {
+		t.Errorf("LookupPassphrase() = %q, want from-env", got)
+	}
+
+	// Without a terminal or a source, reading fails instead of prompting
+	t.Setenv(PassphraseEnv, "")
+	t.Setenv(PassphraseFileEnv, "")
+	t.Setenv(PassphraseSocketEnv, "")
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	stdin, _ := os.Open(os.DevNull)
+	defer stdin.Close()
+	previous := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = previous }()
+	if _, err := ReadPassphrase("Password: "); !errors.Is(err, ErrNoPassphrase) {
+		t.Errorf("ReadPassphrase() error = %v, want ErrNoPassphrase", err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("providers: {}\n"), 0600)
+	encrypted, err := EncryptData([]byte("providers: {}\n"), "secret-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, encrypted); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if plaintext, err := DecryptConfig(data, "secret-pass"); err != nil || string(plaintext) != "providers: {}\n" {
+		t.Errorf("DecryptConfig() = %q, %v", plaintext, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want the file's 0600 kept", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Policy is an organization's rules for the models workflows use. The
+// processor refuses to run a workflow that breaks them.
+type Policy struct {
+	AllowedProviders []string          `yaml:"allowed_providers,omitempty"` // Only these providers may be called; any when empty
+	DeniedModels     []string          `yaml:"denied_models,omitempty"`     // Model names or glob patterns, e.g. "*-preview"
+	DefaultModels    map[string]string `yaml:"default_models,omitempty"`    // Model of steps that name none, by step type or "default" for any
+	MaxTemperature   float64           `yaml:"max_temperature,omitempty"`   // Highest temperature a step may set
+}
+
+// DefaultModelKey is the default_models entry used for step types that have
+// no entry of their own
+const DefaultModelKey = "default"
+
+// Merge returns this policy with the rules set in override replacing it
+func (p Policy) Merge(override Policy) Policy {
+	if len(override.AllowedProviders) > 0 {
+		p.AllowedProviders = override.AllowedProviders
+	}
+	if len(override.DeniedModels) > 0 {
+		p.DeniedModels = override.DeniedModels
+	}
+	if len(override.DefaultModels) > 0 {
+		merged := make(map[string]string, len(p.DefaultModels)+len(override.DefaultModels))
+		for stepType, model := range p.DefaultModels {
+			merged[stepType] = model
+		}
+		for stepType, model := range override.DefaultModels {
+			merged[stepType] = model
+		}
+		p.DefaultModels = merged
+	}
+	if override.MaxTemperature > 0 {
+		p.MaxTemperature = override.MaxTemperature
+	}
+	return p
+}
+
+// PolicySettings returns the policy runs follow: the top-level policy with
+// the rules set by the profile in use replacing it
+func (c *EnvConfig) PolicySettings() Policy {
+	var policy Policy
+	if c == nil {
+		return policy
+	}
+	if c.Policy != nil {
+		policy = *c.Policy
+	}
+	if profile := c.Profiles[c.profile]; profile != nil && profile.Policy != nil {
+		policy = policy.Merge(*profile.Policy)
+	}
+	return policy
+}
+
+// DefaultModel returns the model for steps of stepType that name none, or
+// empty when the policy sets none
+func (p Policy) DefaultModel(stepType string) string {
+	if model := p.DefaultModels[stepType]; model != "" {
+		return model
+	}
+	return p.DefaultModels[DefaultModelKey]
+}
+
+// CheckProvider returns an error when the policy doesn't allow provider
+func (p Policy) CheckProvider(provider string) error {
+	if len(p.AllowedProviders) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowedProviders {
+		if strings.EqualFold(allowed, provider) {
+			return nil
+		}
+	}
+	return fmt.Errorf("provider %s is not in allowed_providers (%s)", provider, strings.Join(p.AllowedProviders, ", "))
+}
+
+// CheckModel returns an error when the policy denies model
+func (p Policy) CheckModel(model string) error {
+	for _, pattern := range p.DeniedModels {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(model)); matched {
+			if pattern == model {
+				return fmt.Errorf("model %s is in denied_models", model)
+			}
+			return fmt.Errorf("model %s is in denied_models (matches '%s')", model, pattern)
+		}
+	}
+	return nil
+}
+
+// CheckTemperature returns an error when temperature is above the
+// policy's maximum
+func (p Policy) CheckTemperature(temperature float64) error {
+	if p.MaxTemperature > 0 && temperature > p.MaxTemperature {
+		return fmt.Errorf("temperature %g is above max_temperature %g", temperature, p.MaxTemperature)
+	}
+	return nil
+}
+
+// Validate reports malformed denied_models patterns and a negative
+// max_temperature
+func (p Policy) Validate() error {
+	for _, pattern := range p.DeniedModels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid denied_models pattern '%s': %w", pattern, err)
+		}
+	}
+	if p.MaxTemperature < 0 {
+		return fmt.Errorf("max_temperature must not be negative")
+	}
+	return nil
+}
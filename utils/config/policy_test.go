@@ -0,0 +1,47 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicySettings(t *testing.T) {
+	cfg := &EnvConfig{
+		Policy: &Policy{
+			AllowedProviders: []string{"openai", "anthropic"},
+			DefaultModels:    map[string]string{"default": "gpt-4o-mini", "agent": "gpt-4o"},
+			MaxTemperature:   1,
+		},
+		Profiles: map[string]*Profile{
+			"prod": {Policy: &Policy{DeniedModels: []string{"*-preview"}, DefaultModels: map[string]string{"agent": "claude-3-5-sonnet-latest"}}},
+		},
+	}
+	if got := cfg.PolicySettings(); got.CheckModel("o1-preview") != nil {
+		t.Errorf("policy without a profile denies o1-preview: %+v", got)
+	}
+	if err := cfg.UseProfile("prod"); err != nil {
+		t.Fatal(err)
+	}
+	policy := cfg.PolicySettings()
+	if !reflect.DeepEqual(policy.AllowedProviders, []string{"openai", "anthropic"}) || policy.MaxTemperature != 1 {
+		t.Errorf("profile replaced rules it doesn't set: %+v", policy)
+	}
+	if policy.CheckModel("O1-Preview") == nil || policy.CheckModel("gpt-4o") != nil {
+		t.Errorf("denied models = %v", policy.DeniedModels)
+	}
+	if got := policy.DefaultModel("agent"); got != "claude-3-5-sonnet-latest" {
+		t.Errorf("DefaultModel(agent) = %s", got)
+	}
+	if got := policy.DefaultModel("standard"); got != "gpt-4o-mini" {
+		t.Errorf("DefaultModel(standard) = %s", got)
+	}
+	if policy.CheckProvider("Anthropic") != nil || policy.CheckProvider("xai") == nil {
+		t.Errorf("CheckProvider doesn't follow allowed_providers %v", policy.AllowedProviders)
+	}
+	if policy.CheckTemperature(1) != nil || policy.CheckTemperature(1.1) == nil {
+		t.Errorf("CheckTemperature doesn't follow max_temperature %g", policy.MaxTemperature)
+	}
+	if err := (Policy{DeniedModels: []string{"gpt-["}}).Validate(); err == nil {
+		t.Error("Validate() accepted a malformed pattern")
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProfileEnv is the environment variable that selects a profile of the env
+// config
+const ProfileEnv = "COMANDA_PROFILE"
+
+// Profile is a named set of settings, such as dev, staging or prod, used
+// instead of the env config's own when it is selected
+type Profile struct {
+	APIKeys                map[string]string `yaml:"api_keys,omitempty"` // API keys by provider name
+	DefaultGenerationModel string            `yaml:"default_generation_model,omitempty"`
+	Budget                 *Budget           `yaml:"budget,omitempty"` // Replaces the limits of the top-level budget that are set here
+	Policy                 *Policy           `yaml:"policy,omitempty"` // Replaces the rules of the top-level policy that are set here
+}
+
+// Budget caps the estimated tokens and cost of each run. A run that goes
+// over it starts no further steps.
+type Budget struct {
+	MaxRunTokens int     `yaml:"max_run_tokens,omitempty"` // Prompt and completion tokens across a run's steps
+	MaxRunCost   float64 `yaml:"max_run_cost,omitempty"`   // US dollars across a run's steps, from list prices
+}
+
+// Merge returns this budget with the limits set in override replacing it
+func (b Budget) Merge(override Budget) Budget {
+	if override.MaxRunTokens > 0 {
+		b.MaxRunTokens = override.MaxRunTokens
+	}
+	if override.MaxRunCost > 0 {
+		b.MaxRunCost = override.MaxRunCost
+	}
+	return b
+}
+
+// UseProfile applies the API keys and default model of the named profile,
+// which are never saved to the file, and makes its budget and policy the
+// ones runs get. Overrides applied afterwards take precedence over the profile.
+func (c *EnvConfig) UseProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return fmt.Errorf("unknown profile '%s': the env config has no profiles", name)
+		}
+		return fmt.Errorf("unknown profile '%s' (the env config has %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	c.profile = name
+	if profile == nil {
+		return nil
+	}
+	c.ApplyOverrides(Overrides{ProviderKeys: profile.APIKeys, DefaultModel: profile.DefaultGenerationModel})
+	DebugLog("Using profile %s", name)
+	return nil
+}
+
+// ProfileName returns the name of the profile in use, or empty when none is
+func (c *EnvConfig) ProfileName() string {
+	return c.profile
+}
+
+// ProfileNames returns the names of the env config's profiles, sorted
+func (c *EnvConfig) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BudgetSettings returns the budget runs get: the top-level budget with
+// the limits set by the profile in use replacing it
+func (c *EnvConfig) BudgetSettings() Budget {
+	var budget Budget
+	if c == nil {
+		return budget
+	}
+	if c.Budget != nil {
+		budget = *c.Budget
+	}
+	if profile := c.Profiles[c.profile]; profile != nil && profile.Budget != nil {
+		budget = budget.Merge(*profile.Budget)
+	}
+	return budget
+}
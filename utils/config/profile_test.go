@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUseProfile(t *testing.T) {
+	cfg := &EnvConfig{
+		DefaultGenerationModel: "gpt-4o",
+		Budget:                 &Budget{MaxRunTokens: 100000, MaxRunCost: 1},
+		Profiles: map[string]*Profile{
+			"dev":  {APIKeys: map[string]string{"openai": "sk-dev"}, DefaultGenerationModel: "gpt-4o-mini", Budget: &Budget{MaxRunCost: 0.25}},
+			"prod": {APIKeys: map[string]string{"openai": "sk-prod"}},
+		},
+	}
+	cfg.AddProvider("openai", Provider{APIKey: "sk-file", Models: []Model{{Name: "gpt-4o", Type: "external", Modes: []ModelMode{TextMode}}}})
+
+	if err := cfg.UseProfile("staging"); err == nil || !strings.Contains(err.Error(), "dev, prod") {
+		t.Errorf("UseProfile(staging) error = %v, want one listing the profiles", err)
+	}
+	if err := cfg.UseProfile("dev"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Providers["openai"].APIKey != "sk-dev" || cfg.DefaultGenerationModel != "gpt-4o-mini" || cfg.ProfileName() != "dev" {
+		t.Errorf("profile not applied: key %s, model %s", cfg.Providers["openai"].APIKey, cfg.DefaultGenerationModel)
+	}
+	if budget := cfg.BudgetSettings(); budget.MaxRunTokens != 100000 || budget.MaxRunCost != 0.25 {
+		t.Errorf("BudgetSettings() = %+v", budget)
+	}
+
+	// Overrides win over the profile, and neither is saved
+	cfg.ApplyOverrides(Overrides{ProviderKeys: map[string]string{"openai": "sk-flag"}})
+	if cfg.Providers["openai"].APIKey != "sk-flag" {
+		t.Errorf("override lost to the profile: %s", cfg.Providers["openai"].APIKey)
+	}
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := SaveEnvConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	saved := string(data)
+	if !strings.Contains(saved, "api_key: sk-file") || strings.Contains(saved, "sk-flag") || !strings.Contains(saved, "default_generation_model: gpt-4o\n") {
+		t.Errorf("saved config has the profile's settings:\n%s", saved)
+	}
+	if !strings.Contains(saved, "sk-dev") || !strings.Contains(saved, "max_run_cost: 0.25") {
+		t.Errorf("saved config lost its profiles:\n%s", saved)
+	}
+
+	if err := (&EnvConfig{}).UseProfile("dev"); err == nil || !strings.Contains(err.Error(), "no profiles") {
+		t.Errorf("UseProfile without profiles error = %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// sensitiveHeaders are the request headers that carry credentials
+var sensitiveHeaders = []string{"Authorization", "X-Api-Key", "Api-Key", "X-Goog-Api-Key", "Cookie", "Proxy-Authorization"}
+
+// sensitiveParams are the query parameters that carry credentials
+var sensitiveParams = []string{"key", "api_key", "access_token", "token"}
+
+// secretPattern matches a credential. The first group, if any, is kept.
+// Patterns that can match prose, such as "bearer authentication", only hide
+// values with a digit in them.
+type secretPattern struct {
+	re    *regexp.Regexp
+	prose bool
+}
+
+// secretPatterns match credentials that were never registered, such as a
+// bearer token sent by an API client or a key pasted into a workflow
+var secretPatterns = []secretPattern{
+	{re: regexp.MustCompile(`(?i)(\b(?:bearer|basic)\s+)[A-Za-z0-9._~+/=-]{8,}`), prose: true},
+	{re: regexp.MustCompile(`(?i)((?:x-api-key|api-key|x-goog-api-key)["']?\s*[:=]\s*\[?["']?)[^\s"',\]]{8,}`), prose: true},
+	{re: regexp.MustCompile(`(?i)([?&](?:key|api_key|access_token|token)=)[^&\s"']+`)},
+	{re: regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},           // OpenAI, Anthropic, Deepseek and Moonshot keys
+	{re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},           // Google keys
+	{re: regexp.MustCompile(`\b(?:xai|gsk)[-_][A-Za-z0-9]{20,}`)}, // xAI and Groq keys
+}
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// AddSecret registers a value, such as an API key, that Redact hides
+func AddSecret(value string) {
+	if len(value) < 6 {
+		return // Too short to redact without mangling unrelated text
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+}
+
+// AddSecrets registers every secret setting of the config, such as API
+// keys, database passwords and the server's tokens, so Redact hides them
+func (c *EnvConfig) AddSecrets() {
+	for _, field := range c.secretFields() {
+		AddSecret(field.get())
+	}
+}
+
+// Redact replaces every registered secret, and anything that looks like a
+// bearer token or provider API key, in s with ***
+func Redact(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	secretsMu.RUnlock()
+	for _, pattern := range secretPatterns {
+		s = pattern.re.ReplaceAllStringFunc(s, func(match string) string {
+			var kept string
+			if groups := pattern.re.FindStringSubmatch(match); len(groups) > 1 {
+				kept = groups[1]
+			}
+			if pattern.prose && !strings.ContainsAny(match[len(kept):], "0123456789") {
+				return match
+			}
+			return kept + "***"
+		})
+	}
+	return s
+}
+
+// RedactError returns err's message with secrets redacted, or empty when err
+// is nil
+func RedactError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Redact(err.Error())
+}
+
+// ConsoleLog prints a log line to stdout with secrets redacted
+func ConsoleLog(format string, args ...interface{}) {
+	fmt.Println(Redact(fmt.Sprintf(format, args...)))
+}
+
+// RedactWriter returns a writer that redacts secrets from what is written
+// to w. Each write is redacted on its own, as log.Logger writes each message.
+func RedactWriter(w io.Writer) io.Writer {
+	if _, ok := w.(redactWriter); ok {
+		return w
+	}
+	return redactWriter{w: w}
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// RedactHeaders formats headers one per line, hiding credentials
+func RedactHeaders(h http.Header) string {
+	hidden := h.Clone()
+	for _, name := range sensitiveHeaders {
+		if hidden.Get(name) != "" {
+			hidden.Set(name, "***")
+		}
+	}
+	var b strings.Builder
+	hidden.Write(&b)
+	return Redact(b.String())
+}
+
+// redactURL returns the URL with credential query parameters hidden
+func redactURL(u *url.URL) string {
+	redacted := *u
+	q := redacted.Query()
+	for _, name := range sensitiveParams {
+		if q.Has(name) {
+			q.Set(name, "***")
+		}
+	}
+	redacted.RawQuery = q.Encode()
+	return Redact(redacted.String())
+}
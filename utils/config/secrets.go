@@ -0,0 +1,322 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schemes of references to secrets kept in a secret manager, such as
+// vault://secret/data/comanda#openai
+var SecretSchemes = []string{"vault", "aws-sm", "gcp-sm", "azure-kv"}
+
+// DefaultSecretCacheTTL is how long a fetched secret is reused when no
+// cache_ttl is set
+const DefaultSecretCacheTTL = 5 * time.Minute
+
+// SecretsConfig configures the secret managers that API keys, passwords and
+// workflow env values can reference instead of holding the secret
+type SecretsConfig struct {
+	CacheTTL int                  `yaml:"cache_ttl,omitempty"` // Seconds a fetched secret is reused, unless its lease says otherwise
+	Vault    *VaultConfig         `yaml:"vault,omitempty"`
+	AWS      *AWSSecretsConfig    `yaml:"aws,omitempty"`
+	GCP      *GCPSecretsConfig    `yaml:"gcp,omitempty"`
+	Azure    *AzureKeyVaultConfig `yaml:"azure,omitempty"`
+}
+
+// VaultConfig reaches a HashiCorp Vault server. The token comes from
+// VAULT_TOKEN, then token_file, then ~/.vault-token.
+type VaultConfig struct {
+	Address   string `yaml:"address,omitempty"`    // VAULT_ADDR by default
+	Namespace string `yaml:"namespace,omitempty"`  // VAULT_NAMESPACE by default
+	TokenFile string `yaml:"token_file,omitempty"` // File holding the token, such as one an agent writes
+}
+
+// AWSSecretsConfig reaches AWS Secrets Manager with the credentials in
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+type AWSSecretsConfig struct {
+	Region   string `yaml:"region,omitempty"`   // AWS_REGION by default
+	Endpoint string `yaml:"endpoint,omitempty"` // Replaces the regional endpoint, such as for a VPC endpoint
+}
+
+// GCPSecretsConfig reaches Google Secret Manager with the application
+// default credentials
+type GCPSecretsConfig struct {
+	Project         string `yaml:"project,omitempty"`          // Project of references that don't name one
+	CredentialsFile string `yaml:"credentials_file,omitempty"` // Service account key used instead of the default credentials
+}
+
+// AzureKeyVaultConfig reaches Azure Key Vault as a service principal whose
+// secret is in AZURE_CLIENT_SECRET, or else as the managed identity of the
+// machine
+type AzureKeyVaultConfig struct {
+	TenantID string `yaml:"tenant_id,omitempty"` // AZURE_TENANT_ID by default
+	ClientID string `yaml:"client_id,omitempty"` // AZURE_CLIENT_ID by default
+}
+
+// CacheDuration returns how long a fetched secret is reused
+func (s SecretsConfig) CacheDuration() time.Duration {
+	if s.CacheTTL > 0 {
+		return time.Duration(s.CacheTTL) * time.Second
+	}
+	return DefaultSecretCacheTTL
+}
+
+// SecretsSettings returns the secret manager settings, or the defaults
+// when the env config has none
+func (c *EnvConfig) SecretsSettings() SecretsConfig {
+	if c == nil || c.Secrets == nil {
+		return SecretsConfig{}
+	}
+	return *c.Secrets
+}
+
+// IsSecretRef reports whether value references a secret in a secret
+// manager rather than holding it
+func IsSecretRef(value string) bool {
+	scheme, rest, ok := strings.Cut(value, "://")
+	if !ok || rest == "" {
+		return false
+	}
+	for _, s := range SecretSchemes {
+		if scheme == s {
+			return true
+		}
+	}
+	return false
+}
+
+// secretRef is a setting that held a reference, and the secret it was
+// replaced with
+type secretRef struct {
+	ref   string
+	value string
+}
+
+// secretField is a setting of the env config that may reference a secret
+type secretField struct {
+	path string
+	get  func() string
+	set  func(string)
+}
+
+// ResolveSecretRefs replaces the settings that reference secrets, such as
+// API keys, database passwords and server tokens, with the secrets resolve
+// returns for them. The references are what SaveEnvConfig writes.
+func (c *EnvConfig) ResolveSecretRefs(resolve func(ref string) (string, error)) error {
+	for _, field := range c.secretFields() {
+		ref := field.get()
+		if !IsSecretRef(ref) {
+			continue
+		}
+		value, err := resolve(ref)
+		if err != nil {
+			return fmt.Errorf("error resolving the secret of %s: %w", field.path, err)
+		}
+		field.set(value)
+		if c.secretRefs == nil {
+			c.secretRefs = make(map[string]secretRef)
+		}
+		c.secretRefs[field.path] = secretRef{ref: ref, value: value}
+		DebugLog("Resolved the secret of %s", field.path)
+	}
+	return nil
+}
+
+// HasSecretRefs reports whether any setting was resolved from a secret
+// manager
+func (c *EnvConfig) HasSecretRefs() bool {
+	return len(c.secretRefs) > 0
+}
+
+// restoreSecretRefs returns a copy of saved with the settings whose secret
+// was resolved holding their reference again, unless they were changed
+// since
+func (c *EnvConfig) restoreSecretRefs(saved *EnvConfig) (*EnvConfig, error) {
+	if len(c.secretRefs) == 0 {
+		return saved, nil
+	}
+	data, err := yaml.Marshal(saved)
+	if err != nil {
+		return nil, err
+	}
+	var restored EnvConfig
+	if err := yaml.Unmarshal(data, &restored); err != nil {
+		return nil, err
+	}
+	for _, field := range restored.secretFields() {
+		if ref, ok := c.secretRefs[field.path]; ok && field.get() == ref.value {
+			field.set(ref.ref)
+		}
+	}
+	return &restored, nil
+}
+
+// secretFields returns the settings that may reference a secret, in the
+// same order every time
+func (c *EnvConfig) secretFields() []secretField {
+	var fields []secretField
+	str := func(path string, p *string) {
+		fields = append(fields, secretField{path: path, get: func() string { return *p }, set: func(v string) { *p = v }})
+	}
+
+	for _, name := range sortedNames(c.Providers) {
+		if provider := c.Providers[name]; provider != nil {
+			str("providers."+name+".api_key", &provider.APIKey)
+		}
+	}
+	for _, name := range c.ProfileNames() {
+		profile := c.Profiles[name]
+		if profile == nil {
+			continue
+		}
+		for _, provider := range sortedNames(profile.APIKeys) {
+			keys, provider := profile.APIKeys, provider
+			fields = append(fields, secretField{
+				path: "profiles." + name + ".api_keys." + provider,
+				get:  func() string { return keys[provider] },
+				set:  func(v string) { keys[provider] = v },
+			})
+		}
+	}
+	for _, name := range sortedNames(c.Databases) {
+		databases, name := c.Databases, name
+		fields = append(fields, secretField{
+			path: "databases." + name + ".password",
+			get:  func() string { return databases[name].Password },
+			set: func(v string) {
+				db := databases[name]
+				db.Password = v
+				databases[name] = db
+			},
+		})
+	}
+	for _, name := range sortedNames(c.VectorStores) {
+		stores, name := c.VectorStores, name
+		fields = append(fields, secretField{
+			path: "vector_stores." + name + ".api_key",
+			get:  func() string { return stores[name].APIKey },
+			set: func(v string) {
+				store := stores[name]
+				store.APIKey = v
+				stores[name] = store
+			},
+		})
+	}
+	for _, name := range sortedNames(c.Mailboxes) {
+		mailboxes, name := c.Mailboxes, name
+		fields = append(fields, secretField{
+			path: "mailboxes." + name + ".password",
+			get:  func() string { return mailboxes[name].Password },
+			set: func(v string) {
+				mailbox := mailboxes[name]
+				mailbox.Password = v
+				mailboxes[name] = mailbox
+			},
+		})
+	}
+	for _, name := range sortedNames(c.Calendars) {
+		calendars, name := c.Calendars, name
+		fields = append(fields, secretField{
+			path: "calendars." + name + ".ics",
+			get:  func() string { return calendars[name].ICS },
+			set: func(v string) {
+				calendar := calendars[name]
+				calendar.ICS = v
+				calendars[name] = calendar
+			},
+		})
+	}
+	for _, name := range sortedNames(c.Brokers) {
+		brokers, name := c.Brokers, name
+		fields = append(fields,
+			secretField{
+				path: "brokers." + name + ".password",
+				get:  func() string { return brokers[name].Password },
+				set: func(v string) {
+					broker := brokers[name]
+					broker.Password = v
+					brokers[name] = broker
+				},
+			},
+			secretField{
+				path: "brokers." + name + ".token",
+				get:  func() string { return brokers[name].Token },
+				set: func(v string) {
+					broker := brokers[name]
+					broker.Token = v
+					brokers[name] = broker
+				},
+			})
+	}
+
+	if connectors := c.Connectors; connectors != nil {
+		if drive := connectors.GoogleDrive; drive != nil {
+			str("connectors.google_drive.access_token", &drive.AccessToken)
+			str("connectors.google_drive.client_secret", &drive.ClientSecret)
+			str("connectors.google_drive.refresh_token", &drive.RefreshToken)
+		}
+		if notion := connectors.Notion; notion != nil {
+			str("connectors.notion.token", &notion.Token)
+		}
+		if confluence := connectors.Confluence; confluence != nil {
+			str("connectors.confluence.api_token", &confluence.APIToken)
+			str("connectors.confluence.token", &confluence.Token)
+		}
+	}
+	trackerFields := func(prefix string, trackers *TrackersConfig) {
+		if trackers == nil {
+			return
+		}
+		if jira := trackers.Jira; jira != nil {
+			str(prefix+"trackers.jira.api_token", &jira.APIToken)
+			str(prefix+"trackers.jira.token", &jira.Token)
+		}
+		if linear := trackers.Linear; linear != nil {
+			str(prefix+"trackers.linear.api_key", &linear.APIKey)
+		}
+	}
+	trackerFields("", c.Trackers)
+
+	server := c.Server
+	if server == nil {
+		return fields
+	}
+	str("server.bearerToken", &server.BearerToken)
+	for i := range server.APIKeys {
+		str(fmt.Sprintf("server.apiKeys.%s.key", server.APIKeys[i].Name), &server.APIKeys[i].Key)
+	}
+	str("server.webhooks.secret", &server.Webhooks.Secret)
+	if server.JWT != nil {
+		str("server.jwt.secret", &server.JWT.Secret)
+	}
+	if server.OIDC != nil {
+		str("server.oidc.clientSecret", &server.OIDC.ClientSecret)
+		str("server.oidc.sessionSecret", &server.OIDC.SessionSecret)
+	}
+	for i := range server.Triggers {
+		str(fmt.Sprintf("server.triggers.%s.secret", server.Triggers[i].Name), &server.Triggers[i].Secret)
+	}
+	for _, ws := range server.Workspaces {
+		for _, name := range sortedNames(ws.Providers) {
+			if provider := ws.Providers[name]; provider != nil {
+				str("server.workspaces."+ws.Name+".providers."+name+".api_key", &provider.APIKey)
+			}
+		}
+		trackerFields("server.workspaces."+ws.Name+".", ws.Trackers)
+	}
+	return fields
+}
+
+// sortedNames returns the keys of a map in sorted order
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
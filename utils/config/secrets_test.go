@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecretRefs(t *testing.T) {
+	cfg := &EnvConfig{
+		Profiles:  map[string]*Profile{"prod": {APIKeys: map[string]string{"anthropic": "aws-sm://prod/comanda#anthropic"}}},
+		Databases: map[string]DatabaseConfig{"warehouse": {Type: "postgres", Password: "gcp-sm://acme/warehouse-password"}},
+		Server:    &ServerConfig{BearerToken: "azure-kv://acme-kv/comanda-token"},
+	}
+	cfg.AddProvider("openai", Provider{APIKey: "vault://secret/data/comanda#openai"})
+	cfg.AddProvider("ollama", Provider{APIKey: "LOCAL"})
+	resolved := map[string]string{
+		"vault://secret/data/comanda#openai": "sk-openai",
+		"aws-sm://prod/comanda#anthropic":    "sk-ant",
+		"gcp-sm://acme/warehouse-password":   "db-pass",
+		"azure-kv://acme-kv/comanda-token":   "server-token",
+	}
+	var asked []string
+	err := cfg.ResolveSecretRefs(func(ref string) (string, error) {
+		asked = append(asked, ref)
+		return resolved[ref], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 4 {
+		t.Errorf("resolved %v, want the 4 references", asked)
+	}
+	if cfg.Providers["openai"].APIKey != "sk-openai" || cfg.Profiles["prod"].APIKeys["anthropic"] != "sk-ant" ||
+		cfg.Databases["warehouse"].Password != "db-pass" || cfg.Server.BearerToken != "server-token" {
+		t.Errorf("references not replaced: %+v", cfg)
+	}
+
+	// The file keeps the references, except for settings changed since
+	cfg.Server.BearerToken = "rotated"
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := SaveEnvConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	saved := string(data)
+	for _, want := range []string{"vault://secret/data/comanda#openai", "aws-sm://prod/comanda#anthropic", "gcp-sm://acme/warehouse-password", "bearerToken: rotated"} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved config is missing %q:\n%s", want, saved)
+		}
+	}
+	if strings.Contains(saved, "sk-openai") || strings.Contains(saved, "db-pass") {
+		t.Errorf("saved config has resolved secrets:\n%s", saved)
+	}
+	if cfg.Providers["openai"].APIKey != "sk-openai" {
+		t.Errorf("saving changed the loaded config: %s", cfg.Providers["openai"].APIKey)
+	}
+
+	err = (&EnvConfig{Server: &ServerConfig{JWT: &JWTConfig{Secret: "vault://secret/data/jwt"}}}).ResolveSecretRefs(func(string) (string, error) {
+		return "", errors.New("permission denied")
+	})
+	if err == nil || err.Error() != "error resolving the secret of server.jwt.secret: permission denied" {
+		t.Errorf("ResolveSecretRefs() error = %v", err)
+	}
+}
@@ -1,13 +1,403 @@
 package config
 
+import (
+	"path/filepath"
+	"time"
+)
+
 // ServerConfig holds configuration for the HTTP server
 type ServerConfig struct {
-	Port        int    `yaml:"port"`
-	DataDir     string `yaml:"dataDir"`
-	RuntimeDir  string `yaml:"runtimeDir"` // Directory for runtime files like uploads and YAML processing
-	Enabled     bool   `yaml:"enabled"`
-	BearerToken string `yaml:"bearerToken"`
-	CORS        CORS   `yaml:"cors"`
+	Port          int            `yaml:"port"`
+	DataDir       string         `yaml:"dataDir"`
+	RuntimeDir    string         `yaml:"runtimeDir"` // Directory for runtime files like uploads and YAML processing
+	Enabled       bool           `yaml:"enabled"`
+	BearerToken   string         `yaml:"bearerToken"`
+	CORS          CORS           `yaml:"cors"`
+	AllowedPaths  []string       `yaml:"allowedPaths,omitempty"` // Absolute paths workflows may access outside the runtime sandbox
+	HistoryDir    string         `yaml:"historyDir,omitempty"`   // Run records and artifacts; defaults to .comanda/runs in DataDir
+	Queue         Queue          `yaml:"queue,omitempty"`
+	APIKeys       []APIKey       `yaml:"apiKeys,omitempty"`    // Named keys with their own scopes and rate limits
+	JWT           *JWTConfig     `yaml:"jwt,omitempty"`        // Accept signed bearer tokens from an identity provider
+	Workspaces    []Workspace    `yaml:"workspaces,omitempty"` // Tenants sharing the server, each isolated from the others
+	Webhooks      Webhooks       `yaml:"webhooks,omitempty"`
+	Triggers      []Trigger      `yaml:"triggers,omitempty"`      // Webhooks from other services that start workflows
+	MailTriggers  []MailTrigger  `yaml:"mailTriggers,omitempty"`  // Mailbox folders whose new messages start workflows
+	WatchTriggers []WatchTrigger `yaml:"watchTriggers,omitempty"` // Folders whose new files start workflows
+	Uploads       Uploads        `yaml:"uploads,omitempty"`
+	RunLimits     RunLimits      `yaml:"runLimits,omitempty"`    // What each run may use; workspaces may set their own
+	Audit         *AuditConfig   `yaml:"audit,omitempty"`        // Keep an append-only log of requests, runs and provider calls
+	Chat          *ChatConfig    `yaml:"chat,omitempty"`         // Answer OpenAI-style chat completion requests with workflows or models
+	DisableUI     bool           `yaml:"disableUI,omitempty"`    // Don't serve the web UI at /ui/
+	DrainTimeout  int            `yaml:"drainTimeout,omitempty"` // Seconds runs get to finish their current step on shutdown
+	ReusePort     bool           `yaml:"reusePort,omitempty"`    // Bind the port with SO_REUSEPORT, so a new server can start before this one stops
+	TLS           *TLSConfig     `yaml:"tls,omitempty"`          // Serve HTTPS instead of plain HTTP
+	BasePath      string         `yaml:"basePath,omitempty"`     // Path prefix the server is reached under behind a proxy, such as /comanda
+	// Seconds between checks of the environment file, and of the secret
+	// manager when settings reference one, for changed keys and models; -1
+	// turns hot reloading off
+	ReloadInterval int `yaml:"reloadInterval,omitempty"`
+	// Proxies, as addresses or CIDR ranges, whose X-Forwarded-For,
+	// X-Forwarded-Proto and X-Forwarded-Host headers are believed
+	TrustedProxies []string `yaml:"trustedProxies,omitempty"`
+	// Agents that join over gRPC to execute runs of workflows with runs_on
+	// labels
+	RemoteWorkers *RemoteWorkers `yaml:"remoteWorkers,omitempty"`
+	// How long stored runs, their artifacts and leftover temp files are
+	// kept; a background collection removes what is over the limits
+	Retention *Retention `yaml:"retention,omitempty"`
+	// Sign users in to the web UI with an OpenID Connect provider, and
+	// exchange its ID tokens for API tokens
+	OIDC *OIDCConfig `yaml:"oidc,omitempty"`
+	// What the tools of agent steps may do in server runs
+	AgentTools AgentTools `yaml:"agentTools,omitempty"`
+}
+
+// AgentTools limits the tools of agent steps in server runs, whose
+// workflows may come from any client
+type AgentTools struct {
+	ShellCommands     []string `yaml:"shellCommands,omitempty"`     // Commands the shell tool may run; the tool is off when empty
+	AllowPrivateHosts bool     `yaml:"allowPrivateHosts,omitempty"` // Let the http tool reach loopback and private addresses
+}
+
+// Webhooks sets how run notifications are sent
+type Webhooks struct {
+	Secret       string   `yaml:"secret,omitempty"`       // Signs each payload; payloads are unsigned without one
+	AllowedHosts []string `yaml:"allowedHosts,omitempty"` // Hosts notifications may be sent to; any host when empty
+}
+
+// AuditConfig sets where the audit log is kept
+type AuditConfig struct {
+	File     string `yaml:"file,omitempty"`     // JSONL file; defaults to .comanda/audit.jsonl in DataDir
+	Database string `yaml:"database,omitempty"` // A postgres database from the databases section to keep the log in instead
+}
+
+// ChatConfig sets how /v1/chat/completions answers requests. The model a
+// request names picks what answers it: a workflow listed in Models, then a
+// configured model when Direct is set, then Workflow.
+type ChatConfig struct {
+	Workflow string            `yaml:"workflow,omitempty"` // Stored workflow answering requests for any other model
+	Models   map[string]string `yaml:"models,omitempty"`   // Model names clients may ask for, each answered by a stored workflow
+	Direct   bool              `yaml:"direct,omitempty"`   // Send requests naming a configured model to that model
+}
+
+// AuditFile returns the JSONL file the audit log is kept in
+func (c *ServerConfig) AuditFile() string {
+	if c.Audit != nil && c.Audit.File != "" {
+		return c.Audit.File
+	}
+	return filepath.Join(c.DataDir, ".comanda", "audit.jsonl")
+}
+
+// Client certificate policies for TLSConfig.ClientAuth
+const (
+	ClientAuthRequire  = "require"  // Refuse connections without a certificate signed by clientCA
+	ClientAuthOptional = "optional" // Verify certificates clients present, but accept connections without one
+)
+
+// TLSConfig sets how the server serves HTTPS: with a certificate and key
+// from files, or with certificates obtained from an ACME CA such as Let's
+// Encrypt
+type TLSConfig struct {
+	CertFile   string      `yaml:"certFile,omitempty"`   // PEM certificate chain; reloaded when the file changes
+	KeyFile    string      `yaml:"keyFile,omitempty"`    // PEM private key
+	ACME       *ACMEConfig `yaml:"acme,omitempty"`       // Obtain certificates automatically instead
+	MinVersion string      `yaml:"minVersion,omitempty"` // "1.2" (the default) or "1.3"
+	ClientCA   string      `yaml:"clientCA,omitempty"`   // PEM CA certificates client certificates are verified against
+	ClientAuth string      `yaml:"clientAuth,omitempty"` // require (the default with clientCA) or optional
+}
+
+// ACMEConfig obtains and renews certificates from an ACME CA
+type ACMEConfig struct {
+	Domains      []string `yaml:"domains"`                // Names certificates are requested for
+	Email        string   `yaml:"email,omitempty"`        // Contact for the CA about expiring certificates
+	CacheDir     string   `yaml:"cacheDir,omitempty"`     // Where certificates are kept; defaults to .comanda/acme in DataDir
+	DirectoryURL string   `yaml:"directoryURL,omitempty"` // The CA's directory; Let's Encrypt when empty
+	HTTPPort     int      `yaml:"httpPort,omitempty"`     // Also answer HTTP-01 challenges on this port, such as 80
+}
+
+// API scopes, from least to most privileged. Each scope includes the ones
+// before it.
+const (
+	ScopeRead  = "read"  // Read workflows, runs, files and settings
+	ScopeRun   = "run"   // Also start runs and process workflows
+	ScopeAdmin = "admin" // Everything, including changing files, providers and keys
+)
+
+// APIKey is a static credential accepted as a bearer token
+type APIKey struct {
+	Name      string `yaml:"name"`
+	Key       string `yaml:"key"`
+	Scope     string `yaml:"scope"`               // read, run or admin
+	RateLimit int    `yaml:"rateLimit,omitempty"` // Requests per minute; 0 for no limit
+	Workspace string `yaml:"workspace,omitempty"` // Confines the key to this workspace
+}
+
+// JWTConfig validates bearer tokens issued elsewhere. Tokens are signed with
+// HS256 using Secret, or with RS256 or ES256 using PublicKey.
+type JWTConfig struct {
+	Secret         string `yaml:"secret,omitempty"`
+	PublicKey      string `yaml:"publicKey,omitempty"`      // PEM-encoded RSA or ECDSA public key
+	Issuer         string `yaml:"issuer,omitempty"`         // Required iss claim, if set
+	Audience       string `yaml:"audience,omitempty"`       // Required aud claim, if set
+	ScopeClaim     string `yaml:"scopeClaim,omitempty"`     // Claim holding the scopes; defaults to "scope"
+	RateLimit      int    `yaml:"rateLimit,omitempty"`      // Requests per minute for each token subject; 0 for no limit
+	WorkspaceClaim string `yaml:"workspaceClaim,omitempty"` // Claim naming the workspace a token is confined to; defaults to "workspace"
+}
+
+// DefaultSessionTTL is how long the tokens OIDC sign-in issues last
+const DefaultSessionTTL = 8 * time.Hour
+
+// OIDCConfig signs users in with an OpenID Connect provider such as Okta,
+// Azure AD or Google. The groups in a user's ID token pick their role; users
+// in none of the roles' groups get DefaultScope, or are refused without one.
+type OIDCConfig struct {
+	Issuer        string     `yaml:"issuer"`                 // Provider URL; its discovery document is read from /.well-known/openid-configuration
+	ClientID      string     `yaml:"clientId"`               // ID tokens must be issued to this client
+	ClientSecret  string     `yaml:"clientSecret,omitempty"` // Omit for public clients, which rely on PKCE alone
+	RedirectURL   string     `yaml:"redirectURL,omitempty"`  // Defaults to /auth/callback on the host the user signed in on
+	Scopes        []string   `yaml:"scopes,omitempty"`       // Requested besides openid; defaults to email and profile
+	GroupsClaim   string     `yaml:"groupsClaim,omitempty"`  // ID token claim listing the user's groups; defaults to "groups"
+	Roles         []OIDCRole `yaml:"roles,omitempty"`        // The first role whose group the user is in applies
+	DefaultScope  string     `yaml:"defaultScope,omitempty"` // Scope of users in none of the roles' groups
+	SessionSecret string     `yaml:"sessionSecret"`          // Signs the tokens sign-in issues and the sign-in state
+	SessionTTL    int        `yaml:"sessionTTL,omitempty"`   // Minutes the issued tokens last; 480 by default
+	RateLimit     int        `yaml:"rateLimit,omitempty"`    // Requests per minute for each user; 0 for no limit
+}
+
+// OIDCRole grants the members of a provider group a scope, optionally
+// confined to a workspace
+type OIDCRole struct {
+	Group     string `yaml:"group"`
+	Scope     string `yaml:"scope"`               // read, run or admin
+	Workspace string `yaml:"workspace,omitempty"` // Confines the group's members to this workspace
+}
+
+// SessionDuration returns how long issued tokens last, or the default when
+// unset
+func (o *OIDCConfig) SessionDuration() time.Duration {
+	if o.SessionTTL > 0 {
+		return time.Duration(o.SessionTTL) * time.Minute
+	}
+	return DefaultSessionTTL
+}
+
+// AuthRequired reports whether requests must carry a credential: when auth
+// is enabled, or when API keys, JWT validation or OIDC sign-in are configured
+func (c *ServerConfig) AuthRequired() bool {
+	return c.Enabled || len(c.APIKeys) > 0 || c.JWT != nil || c.OIDC != nil
+}
+
+// FindAPIKey returns the API key with the given name, or nil
+func (c *ServerConfig) FindAPIKey(name string) *APIKey {
+	for i := range c.APIKeys {
+		if c.APIKeys[i].Name == name {
+			return &c.APIKeys[i]
+		}
+	}
+	return nil
+}
+
+// ValidScope reports whether scope is one of read, run or admin
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeRun || scope == ScopeAdmin
+}
+
+// Default run queue sizes
+const (
+	DefaultQueueWorkers    = 4
+	DefaultQueueDepth      = 100
+	DefaultQueueBatchEvery = 5
+)
+
+// Queue sizes the worker pool that executes runs submitted to the server
+type Queue struct {
+	Workers int `yaml:"workers,omitempty"` // Runs executed at once
+	Depth   int `yaml:"depth,omitempty"`   // Runs that may wait for a worker before new ones are refused
+	// While batch runs wait, at least every this many runs started is one
+	// of them, however many interactive runs wait too
+	BatchEvery int `yaml:"batchEvery,omitempty"`
+}
+
+// WorkerCount returns the number of workers, or the default when unset
+func (q Queue) WorkerCount() int {
+	if q.Workers > 0 {
+		return q.Workers
+	}
+	return DefaultQueueWorkers
+}
+
+// MaxQueued returns the queue depth, or the default when unset
+func (q Queue) MaxQueued() int {
+	if q.Depth > 0 {
+		return q.Depth
+	}
+	return DefaultQueueDepth
+}
+
+// BatchInterval returns how often a waiting batch run is started ahead of
+// interactive runs, or the default when unset
+func (q Queue) BatchInterval() int {
+	if q.BatchEvery > 0 {
+		return q.BatchEvery
+	}
+	return DefaultQueueBatchEvery
+}
+
+// DefaultDrainTimeout is how long a stopping server waits for runs when no
+// drainTimeout is set
+const DefaultDrainTimeout = 30 * time.Second
+
+// DrainDuration returns how long a stopping server waits for runs to stop
+// at a step boundary, or the default when unset
+func (c *ServerConfig) DrainDuration() time.Duration {
+	if c.DrainTimeout > 0 {
+		return time.Duration(c.DrainTimeout) * time.Second
+	}
+	return DefaultDrainTimeout
+}
+
+// DefaultReloadInterval is how often a server checks for changed settings
+// when no reloadInterval is set
+const DefaultReloadInterval = 30 * time.Second
+
+// ReloadEvery returns how often a running server reloads changed settings,
+// or 0 when it doesn't
+func (c *ServerConfig) ReloadEvery() time.Duration {
+	switch {
+	case c.ReloadInterval < 0:
+		return 0
+	case c.ReloadInterval > 0:
+		return time.Duration(c.ReloadInterval) * time.Second
+	}
+	return DefaultReloadInterval
+}
+
+// Defaults for remote workers
+const (
+	DefaultWorkerPort    = 9090
+	DefaultWorkerTimeout = 60 * time.Second
+)
+
+// RemoteWorkers lets agents started with 'comanda worker' join the server
+// over gRPC and execute runs of workflows whose runs_on labels they carry
+type RemoteWorkers struct {
+	Port    int    `yaml:"port,omitempty"`    // gRPC port workers join on; 9090 by default
+	Token   string `yaml:"token"`             // Workers present it to join
+	Timeout int    `yaml:"timeout,omitempty"` // Seconds a worker may go without reporting before its run fails
+}
+
+// ListenPort returns the gRPC port, or the default when unset
+func (w *RemoteWorkers) ListenPort() int {
+	if w.Port > 0 {
+		return w.Port
+	}
+	return DefaultWorkerPort
+}
+
+// ReportTimeout returns how long a worker may go without reporting on a
+// run, or the default when unset
+func (w *RemoteWorkers) ReportTimeout() time.Duration {
+	if w.Timeout > 0 {
+		return time.Duration(w.Timeout) * time.Second
+	}
+	return DefaultWorkerTimeout
+}
+
+// Defaults for retention
+const (
+	DefaultRetentionInterval = time.Hour
+	DefaultCacheMaxAge       = 24 * time.Hour
+)
+
+// Retention limits what runs leave behind. Runs over any of the limits are
+// removed with their step outputs and artifacts, oldest first; queued and
+// running runs are always kept.
+type Retention struct {
+	MaxAgeDays         int `yaml:"maxAgeDays,omitempty"`         // Runs that started longer ago are removed
+	MaxRuns            int `yaml:"maxRuns,omitempty"`            // Most recent runs kept
+	MaxSizeMB          int `yaml:"maxSizeMB,omitempty"`          // Total size of the runs' step outputs and artifacts
+	ArtifactMaxAgeDays int `yaml:"artifactMaxAgeDays,omitempty"` // Artifacts of older runs are removed, keeping the runs' records
+	CacheMaxAgeHours   int `yaml:"cacheMaxAgeHours,omitempty"`   // Temp files runs left behind, such as chunked inputs; 24 by default
+	Interval           int `yaml:"interval,omitempty"`           // Minutes between collections; 60 by default
+}
+
+// CollectInterval returns how often retention is applied, or the default
+// when unset
+func (r *Retention) CollectInterval() time.Duration {
+	if r.Interval > 0 {
+		return time.Duration(r.Interval) * time.Minute
+	}
+	return DefaultRetentionInterval
+}
+
+// CacheMaxAge returns how old leftover temp files get before they are
+// removed, or the default when unset
+func (r *Retention) CacheMaxAge() time.Duration {
+	if r.CacheMaxAgeHours > 0 {
+		return time.Duration(r.CacheMaxAgeHours) * time.Hour
+	}
+	return DefaultCacheMaxAge
+}
+
+// Run limit policies decide what happens to a run that asks for more than
+// the run limits allow when it is submitted
+const (
+	OnExceedReject    = "reject"    // Refuse the run
+	OnExceedDowngrade = "downgrade" // Lower the settings over a limit to the limit and run it
+)
+
+// RunLimits caps what a single run may use. Runs are checked when they are
+// submitted, and stopped when they go over the token or time limit.
+type RunLimits struct {
+	MaxTokens     int    `yaml:"maxTokens,omitempty"`     // Prompt and completion tokens across the run's steps
+	MaxDuration   int    `yaml:"maxDuration,omitempty"`   // Seconds the run may take once it starts
+	MaxFileSizeMB int    `yaml:"maxFileSizeMB,omitempty"` // Largest input file a step may read
+	MaxChunks     int    `yaml:"maxChunks,omitempty"`     // Most chunks a step may split its input into
+	OnExceed      string `yaml:"onExceed,omitempty"`      // reject (the default) or downgrade
+}
+
+// Merge returns these limits with the ones set in override replacing them
+func (l RunLimits) Merge(override RunLimits) RunLimits {
+	if override.MaxTokens > 0 {
+		l.MaxTokens = override.MaxTokens
+	}
+	if override.MaxDuration > 0 {
+		l.MaxDuration = override.MaxDuration
+	}
+	if override.MaxFileSizeMB > 0 {
+		l.MaxFileSizeMB = override.MaxFileSizeMB
+	}
+	if override.MaxChunks > 0 {
+		l.MaxChunks = override.MaxChunks
+	}
+	if override.OnExceed != "" {
+		l.OnExceed = override.OnExceed
+	}
+	return l
+}
+
+// Downgrade reports whether settings over a limit are lowered rather than
+// the run refused
+func (l RunLimits) Downgrade() bool {
+	return l.OnExceed == OnExceedDowngrade
+}
+
+// DefaultMaxUploadMB is the largest upload request accepted when none is set
+const DefaultMaxUploadMB = 32
+
+// Uploads limits the files clients may upload
+type Uploads struct {
+	MaxSizeMB    int      `yaml:"maxSizeMB,omitempty"`    // Largest upload request, in megabytes
+	AllowedTypes []string `yaml:"allowedTypes,omitempty"` // MIME types, such as application/pdf or image/*, judged from content; any type when empty
+}
+
+// MaxBytes returns the largest upload request in bytes, or the default when
+// unset
+func (u Uploads) MaxBytes() int64 {
+	if u.MaxSizeMB > 0 {
+		return int64(u.MaxSizeMB) << 20
+	}
+	return DefaultMaxUploadMB << 20
 }
 
 // CORS holds Cross-Origin Resource Sharing settings
@@ -0,0 +1,22 @@
+package config
+
+// TracingConfig sends OpenTelemetry traces of workflow runs to an OTLP
+// collector. The standard OTEL_EXPORTER_OTLP_* environment variables also
+// enable and configure the exporter; settings here take precedence.
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	Endpoint    string            `yaml:"endpoint,omitempty"`     // OTLP/HTTP endpoint, e.g. localhost:4318 or https://otel.example.com
+	Insecure    bool              `yaml:"insecure,omitempty"`     // Use plain HTTP
+	Headers     map[string]string `yaml:"headers,omitempty"`      // Sent with every export, e.g. for collector auth
+	ServiceName string            `yaml:"service_name,omitempty"` // Defaults to "comanda"
+	SampleRatio float64           `yaml:"sample_ratio,omitempty"` // Fraction of runs traced; 0 traces all of them
+}
+
+// TracingSettings returns the tracing settings, or the defaults when the
+// env config has none
+func (c *EnvConfig) TracingSettings() TracingConfig {
+	if c == nil || c.Tracing == nil {
+		return TracingConfig{}
+	}
+	return *c.Tracing
+}
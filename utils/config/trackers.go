@@ -0,0 +1,50 @@
+package config
+
+// TrackersConfig holds the credentials of the issue trackers that jira and
+// linear steps read issues from and write issues to
+type TrackersConfig struct {
+	Jira   *JiraConfig   `yaml:"jira,omitempty"`
+	Linear *LinearConfig `yaml:"linear,omitempty"`
+}
+
+// JiraConfig is a Jira site and the credentials to use it: an Atlassian
+// account email and API token for Jira Cloud, or a personal access token
+// for Jira Data Center
+type JiraConfig struct {
+	URL      string `yaml:"url"`                 // Site base URL, such as https://acme.atlassian.net
+	Email    string `yaml:"email,omitempty"`     // With api_token
+	APIToken string `yaml:"api_token,omitempty"` // With email
+	Token    string `yaml:"token,omitempty"`     // Personal access token, sent as a bearer token
+}
+
+// LinearConfig authorizes Linear requests with a personal API key
+type LinearConfig struct {
+	APIKey string `yaml:"api_key"`
+}
+
+// TrackerSettings returns the issue tracker credentials, empty when none
+// are configured
+func (c *EnvConfig) TrackerSettings() TrackersConfig {
+	if c == nil || c.Trackers == nil {
+		return TrackersConfig{}
+	}
+	return *c.Trackers
+}
+
+// merge returns these trackers with the ones override sets replacing them
+func (t *TrackersConfig) merge(override *TrackersConfig) *TrackersConfig {
+	if override == nil {
+		return t
+	}
+	var merged TrackersConfig
+	if t != nil {
+		merged = *t
+	}
+	if override.Jira != nil {
+		merged.Jira = override.Jira
+	}
+	if override.Linear != nil {
+		merged.Linear = override.Linear
+	}
+	return &merged
+}
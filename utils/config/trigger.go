@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Trigger sources, which decide how a webhook's signature and event are read
+const (
+	TriggerGitHub  = "github"  // X-Hub-Signature-256 and X-GitHub-Event headers
+	TriggerStripe  = "stripe"  // Stripe-Signature header and the payload's type
+	TriggerGeneric = "generic" // X-Comanda-Signature, X-Comanda-Timestamp and X-Comanda-Event headers
+)
+
+// Trigger starts a stored workflow when a webhook from another service
+// arrives at /hooks/<name>
+type Trigger struct {
+	Name      string            `yaml:"name"`
+	Workflow  string            `yaml:"workflow"`
+	Source    string            `yaml:"source,omitempty"` // github, stripe or generic; defaults to generic
+	Secret    string            `yaml:"secret"`           // Verifies the signature of each payload
+	Events    []string          `yaml:"events,omitempty"` // Events that start a run; any event when empty
+	Params    map[string]string `yaml:"params,omitempty"` // Workflow params read from payload fields, by dotted path
+	Workspace string            `yaml:"workspace,omitempty"`
+}
+
+var triggerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// ValidateTriggerName checks that a trigger name is usable in a URL
+func ValidateTriggerName(name string) error {
+	if !triggerNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid trigger name '%s': use letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// ValidTriggerSource reports whether source is github, stripe or generic.
+// An empty source means generic.
+func ValidTriggerSource(source string) bool {
+	switch source {
+	case "", TriggerGitHub, TriggerStripe, TriggerGeneric:
+		return true
+	}
+	return false
+}
+
+// FindTrigger returns the trigger with the given name, or nil
+func (c *ServerConfig) FindTrigger(name string) *Trigger {
+	for i := range c.Triggers {
+		if c.Triggers[i].Name == name {
+			return &c.Triggers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import "fmt"
+
+// Vector store types
+const (
+	VectorStoreQdrant   = "qdrant"
+	VectorStorePgvector = "pgvector"
+	VectorStoreChroma   = "chroma"
+	VectorStorePinecone = "pinecone"
+)
+
+// VectorStoreConfig is a vector store that index and retrieve steps use
+type VectorStoreConfig struct {
+	Type       string `yaml:"type"`                 // qdrant, pgvector, chroma or pinecone
+	URL        string `yaml:"url,omitempty"`        // Qdrant or Chroma server, or Pinecone index host
+	APIKey     string `yaml:"api_key,omitempty"`    // Qdrant, Chroma or Pinecone key
+	Database   string `yaml:"database,omitempty"`   // pgvector: name of a PostgreSQL entry in databases
+	Collection string `yaml:"collection,omitempty"` // Used by steps that name none: a collection, table or Pinecone namespace
+}
+
+// VectorStore returns the vector store configured under name
+func (c *EnvConfig) VectorStore(name string) (VectorStoreConfig, error) {
+	store, ok := c.VectorStores[name]
+	if !ok {
+		return VectorStoreConfig{}, fmt.Errorf("vector store %q is not configured in vector_stores", name)
+	}
+	switch store.Type {
+	case VectorStoreQdrant, VectorStoreChroma, VectorStorePinecone:
+		if store.URL == "" {
+			return VectorStoreConfig{}, fmt.Errorf("vector store %q needs a url", name)
+		}
+	case VectorStorePgvector:
+		if store.Database == "" {
+			return VectorStoreConfig{}, fmt.Errorf("vector store %q needs a database", name)
+		}
+	default:
+		return VectorStoreConfig{}, fmt.Errorf("vector store %q has unknown type %q (expected qdrant, pgvector, chroma or pinecone)", name, store.Type)
+	}
+	return store, nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVectorStore(t *testing.T) {
+	env := &EnvConfig{VectorStores: map[string]VectorStoreConfig{
+		"kb":      {Type: VectorStoreQdrant, URL: "http://localhost:6333"},
+		"nourl":   {Type: VectorStoreChroma},
+		"nodb":    {Type: VectorStorePgvector},
+		"unknown": {Type: "milvus", URL: "http://localhost:19530"},
+	}}
+	if store, err := env.VectorStore("kb"); err != nil || store.URL != "http://localhost:6333" {
+		t.Errorf("VectorStore(kb) = %+v, %v", store, err)
+	}
+	for name, want := range map[string]string{
+		"missing": "not configured",
+		"nourl":   "needs a url",
+		"nodb":    "needs a database",
+		"unknown": "unknown type",
+	} {
+		if _, err := env.VectorStore(name); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("VectorStore(%s) error = %v, want %q", name, err, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import "time"
+
+// Defaults of watch triggers that don't set their timing
+const (
+	DefaultWatchInterval = 30 * time.Second
+	DefaultWatchSettle   = 10 * time.Second
+)
+
+// WatchTrigger starts a stored workflow for each new file in a folder of
+// the data directory, such as recordings a phone or recorder syncs there.
+// A file starts one run once it has stopped changing; a file replaced by
+// one of another size or time starts another. The run's relative paths
+// resolve in the folder, and a param names the file.
+type WatchTrigger struct {
+	Name      string `yaml:"name"`
+	Workflow  string `yaml:"workflow"`
+	Dir       string `yaml:"dir"`                // Folder in the data directory
+	Pattern   string `yaml:"pattern,omitempty"`  // Glob the file names match; audio recordings when empty
+	Param     string `yaml:"param,omitempty"`    // Workflow param given the file's name in the folder; defaults to file
+	Interval  int    `yaml:"interval,omitempty"` // Seconds between checks; defaults to 30
+	Settle    int    `yaml:"settle,omitempty"`   // Seconds a file must stay unchanged before its run; defaults to 10
+	Workspace string `yaml:"workspace,omitempty"`
+}
+
+// PollInterval returns how often the trigger checks its folder
+func (t WatchTrigger) PollInterval() time.Duration {
+	if t.Interval > 0 {
+		return time.Duration(t.Interval) * time.Second
+	}
+	return DefaultWatchInterval
+}
+
+// SettleTime returns how long a file must stay unchanged before it starts
+// a run, so files still being copied aren't read half written
+func (t WatchTrigger) SettleTime() time.Duration {
+	if t.Settle > 0 {
+		return time.Duration(t.Settle) * time.Second
+	}
+	return DefaultWatchSettle
+}
+
+// FileParam returns the workflow param given the file's name
+func (t WatchTrigger) FileParam() string {
+	if t.Param != "" {
+		return t.Param
+	}
+	return "file"
+}
+
+// workspaceWatchTriggers returns the triggers that start runs in a
+// workspace
+func workspaceWatchTriggers(triggers []WatchTrigger, workspace string) []WatchTrigger {
+	var result []WatchTrigger
+	for _, t := range triggers {
+		if t.Workspace == workspace {
+			result = append(result, t)
+		}
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+// workspaceNamePattern keeps workspace names usable as directory names
+var workspaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Workspace isolates a tenant of a shared server. Each workspace has its own
+// data directory, holding its workflows, runs, uploads and runtime
+// directories, its own provider credentials and its own run limits.
+type Workspace struct {
+	Name       string               `yaml:"name"`
+	DataDir    string               `yaml:"dataDir,omitempty"`    // Defaults to workspaces/<name> in the server's data directory
+	Providers  map[string]*Provider `yaml:"providers,omitempty"`  // Used instead of the shared providers of the same name
+	Queue      Queue                `yaml:"queue,omitempty"`      // Workers and queue depth for the workspace's runs
+	RunsPerDay int                  `yaml:"runsPerDay,omitempty"` // Runs that may be started each day; 0 for no limit
+	RunLimits  RunLimits            `yaml:"runLimits,omitempty"`  // Replace the server's run limits that are set here
+	Trackers   *TrackersConfig      `yaml:"trackers,omitempty"`   // Used instead of the shared Jira and Linear credentials
+}
+
+// ValidateWorkspaceName checks that a workspace name is usable
+func ValidateWorkspaceName(name string) error {
+	if !workspaceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid workspace name '%s': use letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// FindWorkspace returns the workspace with the given name, or nil
+func (c *ServerConfig) FindWorkspace(name string) *Workspace {
+	for i := range c.Workspaces {
+		if c.Workspaces[i].Name == name {
+			return &c.Workspaces[i]
+		}
+	}
+	return nil
+}
+
+// WorkspaceDataDir returns the data directory of a workspace
+func (c *ServerConfig) WorkspaceDataDir(ws *Workspace) string {
+	if ws.DataDir != "" {
+		return ws.DataDir
+	}
+	return filepath.Join(c.DataDir, "workspaces", ws.Name)
+}
+
+// ForWorkspace returns the settings a workspace's requests are served with:
+// these settings, with the workspace's data directory and run queue. Run
+// history is kept in the workspace's data directory.
+func (c *ServerConfig) ForWorkspace(ws *Workspace) *ServerConfig {
+	serverConfig := *c
+	serverConfig.DataDir = c.WorkspaceDataDir(ws)
+	serverConfig.HistoryDir = ""
+	serverConfig.Queue = ws.Queue
+	serverConfig.RunLimits = c.RunLimits.Merge(ws.RunLimits)
+	serverConfig.Workspaces = nil
+	serverConfig.Triggers = nil // Triggers name the workspace they run in
+	serverConfig.MailTriggers = nil
+	serverConfig.WatchTriggers = workspaceWatchTriggers(c.WatchTriggers, ws.Name) // Listed by the workspace; the server checks them
+	return &serverConfig
+}
+
+// ForWorkspace returns the env config a workspace's runs use: this config
+// with the workspace's server settings, provider and issue tracker
+// credentials, and no shared history database, so runs stay within the
+// workspace
+func (c *EnvConfig) ForWorkspace(serverConfig *ServerConfig, ws *Workspace) *EnvConfig {
+	wsConfig := *c
+	wsConfig.Server = serverConfig
+	wsConfig.History = nil
+	wsConfig.Providers = make(map[string]*Provider, len(c.Providers)+len(ws.Providers))
+	for name, provider := range c.Providers {
+		wsConfig.Providers[name] = provider
+	}
+	for name, provider := range ws.Providers {
+		if provider == nil {
+			continue
+		}
+		merged := *provider
+		if shared := c.Providers[name]; shared != nil && len(merged.Models) == 0 {
+			merged.Models = shared.Models // Credentials only: keep the shared model list
+		}
+		wsConfig.Providers[name] = &merged
+	}
+	wsConfig.Trackers = c.Trackers.merge(ws.Trackers)
+	return &wsConfig
+}
@@ -0,0 +1,109 @@
+package connectors
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// confluence reads pages from a Confluence site
+type confluence struct {
+	baseURL string
+	headers map[string]string
+}
+
+func newConfluence(settings *config.ConfluenceConfig) *confluence {
+	auth := "Bearer " + settings.Token
+	if settings.Token == "" {
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(settings.Email+":"+settings.APIToken))
+	}
+	return &confluence{
+		baseURL: strings.TrimRight(settings.URL, "/"),
+		headers: map[string]string{"Authorization": auth, "Accept": "application/json"},
+	}
+}
+
+var (
+	confluencePageID  = regexp.MustCompile(`/pages/(\d+)`)
+	confluenceDisplay = regexp.MustCompile(`/display/([^/]+)/([^/]+)$`)
+	confluenceID      = regexp.MustCompile(`^\d+$`)
+)
+
+// confluencePage is a page as the REST API returns it
+type confluencePage struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Body  struct {
+		Storage struct {
+			Value string `json:"value"`
+		} `json:"storage"`
+	} `json:"body"`
+}
+
+// baseFor returns the site to fetch a page from: the configured URL, or
+// the site of the page's URL when none is configured
+func (c *confluence) baseFor(u *url.URL) string {
+	if c.baseURL != "" || u == nil {
+		return c.baseURL
+	}
+	base := u.Scheme + "://" + u.Host
+	if strings.HasPrefix(u.Path, "/wiki/") {
+		base += "/wiki" // Confluence Cloud
+	}
+	return base
+}
+
+// fetch returns a page as markdown. ref is a page ID or URL, such as
+// https://acme.atlassian.net/wiki/spaces/ENG/pages/123456/Runbook or, on
+// Confluence Data Center, .../pages/viewpage.action?pageId=123456 or
+// .../display/ENG/Runbook.
+func (c *confluence) fetch(ctx context.Context, ref string) ([]Document, error) {
+	const expand = "body.storage"
+	var page confluencePage
+	u, err := url.Parse(ref)
+	switch {
+	case confluenceID.MatchString(ref):
+		if c.baseURL == "" {
+			return nil, fmt.Errorf("fetching a Confluence page by ID needs connectors.confluence.url in the env config")
+		}
+		err = getJSON(ctx, c.baseURL+"/rest/api/content/"+ref+"?expand="+expand, c.headers, &page)
+	case err != nil || u.Host == "":
+		return nil, fmt.Errorf("%q is not a Confluence page URL or ID", ref)
+	case u.Query().Get("pageId") != "":
+		err = getJSON(ctx, c.baseFor(u)+"/rest/api/content/"+url.PathEscape(u.Query().Get("pageId"))+"?expand="+expand, c.headers, &page)
+	case confluencePageID.MatchString(u.Path):
+		id := confluencePageID.FindStringSubmatch(u.Path)[1]
+		err = getJSON(ctx, c.baseFor(u)+"/rest/api/content/"+id+"?expand="+expand, c.headers, &page)
+	case confluenceDisplay.MatchString(u.Path):
+		m := confluenceDisplay.FindStringSubmatch(u.Path)
+		title, _ := url.PathUnescape(strings.ReplaceAll(m[2], "+", " "))
+		query := url.Values{"spaceKey": {m[1]}, "title": {title}, "expand": {expand}}
+		var found struct {
+			Results []confluencePage `json:"results"`
+		}
+		err = getJSON(ctx, c.baseFor(u)+"/rest/api/content?"+query.Encode(), c.headers, &found)
+		if err == nil && len(found.Results) == 0 {
+			err = fmt.Errorf("no page titled %q in space %s", title, m[1])
+		}
+		if err == nil {
+			page = found.Results[0]
+		}
+	default:
+		return nil, fmt.Errorf("%q is not a Confluence page URL or ID", ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := HTMLToMarkdown(page.Body.Storage.Value)
+	if err != nil {
+		return nil, err
+	}
+	md := tidyMarkdown("# " + page.Title + "\n\n" + body)
+	return []Document{{Title: page.Title, Source: ref, Content: []byte(md), Ext: ".md"}}, nil
+}
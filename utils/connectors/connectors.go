@@ -0,0 +1,140 @@
+// Package connectors fetches documents from Google Drive, Notion and
+// Confluence for workflow inputs, converted to markdown where the service
+// stores rich text, so steps and the chunker can read them like local files.
+//
+// A document is named by its URL, as copied from the browser, or by its ID.
+// Credentials come from the connectors section of the env config.
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/httpclient"
+)
+
+// Connector kinds, the keys of a step's input that name documents
+const (
+	KindGoogleDrive = "gdrive"
+	KindNotion      = "notion"
+	KindConfluence  = "confluence"
+)
+
+// Kinds lists the connector kinds
+var Kinds = []string{KindGoogleDrive, KindNotion, KindConfluence}
+
+// Document is a fetched document
+type Document struct {
+	Title   string // Name of the document in the service
+	Source  string // The URL or ID it was fetched by
+	Content []byte
+	Ext     string // File extension of Content, such as .md or .pdf
+}
+
+// Fetch returns the documents ref names: one page for Notion and
+// Confluence, and one file or every file of a folder for Google Drive
+func Fetch(ctx context.Context, settings config.ConnectorsConfig, kind, ref string) ([]Document, error) {
+	if err := CheckConfigured(settings, kind); err != nil {
+		return nil, err
+	}
+	var docs []Document
+	var err error
+	switch kind {
+	case KindGoogleDrive:
+		docs, err = newDrive(settings.GoogleDrive).fetch(ctx, ref)
+	case KindNotion:
+		docs, err = newNotion(settings.Notion).fetch(ctx, ref)
+	default:
+		docs, err = newConfluence(settings.Confluence).fetch(ctx, ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s from %s: %w", ref, kind, err)
+	}
+	return docs, nil
+}
+
+// CheckConfigured reports whether the env config has the credentials a
+// connector kind needs
+func CheckConfigured(settings config.ConnectorsConfig, kind string) error {
+	switch kind {
+	case KindGoogleDrive:
+		drive := settings.GoogleDrive
+		if drive == nil || (drive.AccessToken == "" && (drive.RefreshToken == "" || drive.ClientID == "" || drive.ClientSecret == "")) {
+			return fmt.Errorf("gdrive inputs need connectors.google_drive in the env config, with an access_token or a client_id, client_secret and refresh_token")
+		}
+	case KindNotion:
+		if settings.Notion == nil || settings.Notion.Token == "" {
+			return fmt.Errorf("notion inputs need connectors.notion.token in the env config")
+		}
+	case KindConfluence:
+		c := settings.Confluence
+		if c == nil || (c.Token == "" && (c.Email == "" || c.APIToken == "")) {
+			return fmt.Errorf("confluence inputs need connectors.confluence in the env config, with an email and api_token or a token")
+		}
+	default:
+		return fmt.Errorf("unknown connector %q (expected %s)", kind, strings.Join(Kinds, ", "))
+	}
+	return nil
+}
+
+// statusError is the error of a request the service answered with an
+// error status
+type statusError struct {
+	Status int
+	Body   string
+}
+
+func (e *statusError) Error() string {
+	switch e.Status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("access denied (status %d), check the credentials and that the document is shared with them: %s", e.Status, e.Body)
+	case http.StatusNotFound:
+		return fmt.Sprintf("not found (status 404), or not shared with the configured credentials: %s", e.Body)
+	}
+	return fmt.Sprintf("status %d: %s", e.Status, e.Body)
+}
+
+// get sends a GET request with headers and returns the response body
+func get(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := httpclient.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		body := strings.TrimSpace(string(data))
+		if len(body) > 300 {
+			body = body[:300] + "..."
+		}
+		return nil, &statusError{Status: resp.StatusCode, Body: body}
+	}
+	return data, nil
+}
+
+// getJSON sends a GET request and decodes the JSON response into out
+func getJSON(ctx context.Context, url string, headers map[string]string, out interface{}) error {
+	data, err := get(ctx, url, headers)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package connectors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// fakeService answers each request path, with its query when the response
+// depends on it, with the body in responses, or 404 when it has none. It
+// records the Authorization header of every request.
+func fakeService(t *testing.T, responses map[string]string) (*httptest.Server, *[]string) {
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			if r.Form.Get("refresh_token") != "refresh" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token":"fresh","expires_in":3600}`))
+			return
+		}
+		for _, key := range []string{r.URL.Path + "?" + r.URL.RawQuery, r.URL.Path} {
+			if body, ok := responses[key]; ok {
+				w.Write([]byte(body))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &auth
+}
+
+func TestGoogleDrive(t *testing.T) {
+	server, auth := fakeService(t, map[string]string{
+		"/files/doc1":          `{"id":"doc1","name":"Onboarding","mimeType":"application/vnd.google-apps.document"}`,
+		"/files/doc1/export":   "# Onboarding\n\nWelcome.\n",
+		"/files/folder1":       `{"id":"folder1","name":"Specs","mimeType":"application/vnd.google-apps.folder"}`,
+		"/files":               `{"files":[{"id":"sheet1","name":"Budget","mimeType":"application/vnd.google-apps.spreadsheet"},{"id":"sub","name":"Old","mimeType":"application/vnd.google-apps.folder"},{"id":"page1","name":"notes.html","mimeType":"text/html"}]}`,
+		"/files/sheet1/export": "item,cost\nlaptop,1200\n",
+		"/files/page1":         "<h2>Notes</h2><p>Hello</p>",
+	})
+	previousAPI, previousToken := driveAPI, googleTokenURL
+	driveAPI, googleTokenURL = server.URL, server.URL+"/token"
+	defer func() { driveAPI, googleTokenURL = previousAPI, previousToken }()
+
+	settings := config.ConnectorsConfig{GoogleDrive: &config.GoogleDriveConfig{ClientID: "id", ClientSecret: "secret", RefreshToken: "refresh"}}
+	ctx := context.Background()
+	docs, err := Fetch(ctx, settings, KindGoogleDrive, "https://docs.google.com/document/d/doc1/edit?usp=sharing")
+	if err != nil {
+		t.Fatalf("Fetch(doc) error = %v", err)
+	}
+	if len(docs) != 1 || docs[0].Title != "Onboarding" || docs[0].Ext != ".md" || !strings.Contains(string(docs[0].Content), "Welcome.") {
+		t.Errorf("Fetch(doc) = %+v", docs)
+	}
+	if (*auth)[1] != "Bearer fresh" {
+		t.Errorf("Authorization = %q, want the refreshed access token", (*auth)[1])
+	}
+
+	docs, err = Fetch(ctx, settings, KindGoogleDrive, "https://drive.google.com/drive/folders/folder1")
+	if err != nil {
+		t.Fatalf("Fetch(folder) error = %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("Fetch(folder) returned %d documents, want the sheet and the page but not the subfolder", len(docs))
+	}
+	if docs[0].Ext != ".csv" || !strings.HasPrefix(string(docs[0].Content), "item,cost") {
+		t.Errorf("sheet = %+v, want CSV", docs[0])
+	}
+	if docs[1].Ext != ".md" || string(docs[1].Content) != "## Notes\n\nHello\n" {
+		t.Errorf("HTML file = %q, want markdown", docs[1].Content)
+	}
+
+	settings.GoogleDrive.RefreshToken = "revoked"
+	if _, err := Fetch(ctx, settings, KindGoogleDrive, "doc1"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Fetch() with a revoked refresh token error = %v", err)
+	}
+}
+
+func TestNotion(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef"
+	const dashed = "01234567-89ab-cdef-0123-456789abcdef"
+	server, auth := fakeService(t, map[string]string{
+		"/pages/" + dashed: `{"properties":{"Name":{"type":"title","title":[{"plain_text":"Incident Runbook"}]}}}`,
+		"/blocks/" + dashed + "/children?page_size=100": `{"results":[
+			{"id":"h","type":"heading_1","heading_1":{"rich_text":[{"plain_text":"Triage"}]}},
+			{"id":"p","type":"paragraph","paragraph":{"rich_text":[{"plain_text":"Check the "},{"plain_text":"dashboard","href":"https://grafana","annotations":{"bold":true}}]}},
+			{"id":"n1","type":"numbered_list_item","has_children":true,"numbered_list_item":{"rich_text":[{"plain_text":"Page on-call"}]}}
+		],"has_more":true,"next_cursor":"c2"}`,
+		"/blocks/" + dashed + "/children?page_size=100&start_cursor=c2": `{"results":[
+			{"id":"n2","type":"numbered_list_item","numbered_list_item":{"rich_text":[{"plain_text":"Open a ticket"}]}},
+			{"id":"c","type":"code","code":{"language":"bash","rich_text":[{"plain_text":"kubectl get pods"}]}}
+		],"has_more":false}`,
+		"/blocks/n1/children?page_size=100": `{"results":[
+			{"id":"t","type":"to_do","to_do":{"checked":true,"rich_text":[{"plain_text":"Acknowledge"}]}}
+		]}`,
+	})
+	previous := notionAPI
+	notionAPI = server.URL
+	defer func() { notionAPI = previous }()
+
+	settings := config.ConnectorsConfig{Notion: &config.NotionConfig{Token: "secret_abc"}}
+	docs, err := Fetch(context.Background(), settings, KindNotion, "https://www.notion.so/acme/Incident-Runbook-"+id+"?pvs=4")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	want := "# Incident Runbook\n\n## Triage\n\nCheck the [**dashboard**](https://grafana)\n\n" +
+		"1. Page on-call\n   - [x] Acknowledge\n2. Open a ticket\n\n```bash\nkubectl get pods\n```\n"
+	if len(docs) != 1 || string(docs[0].Content) != want {
+		t.Errorf("Fetch() =\n%s\nwant\n%s", docs[0].Content, want)
+	}
+	if (*auth)[0] != "Bearer secret_abc" {
+		t.Errorf("Authorization = %q", (*auth)[0])
+	}
+}
+
+func TestConfluence(t *testing.T) {
+	page := `{"id":"42","title":"Deploys","body":{"storage":{"value":"<p>Use <strong>make deploy</strong>.</p>"}}}`
+	server, auth := fakeService(t, map[string]string{
+		"/wiki/rest/api/content/42?expand=body.storage":                         page,
+		"/rest/api/content?expand=body.storage&spaceKey=ENG&title=Deploy+Guide": `{"results":[` + page + `]}`,
+	})
+	ctx := context.Background()
+
+	// Confluence Cloud: the site comes from the URL, signed in with an API token
+	cloud := config.ConnectorsConfig{Confluence: &config.ConfluenceConfig{Email: "me@acme.com", APIToken: "tok"}}
+	docs, err := Fetch(ctx, cloud, KindConfluence, server.URL+"/wiki/spaces/ENG/pages/42/Deploys")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(docs) != 1 || string(docs[0].Content) != "# Deploys\n\nUse **make deploy**.\n" {
+		t.Errorf("Fetch() = %+v", docs)
+	}
+	if (*auth)[0] != "Basic bWVAYWNtZS5jb206dG9r" {
+		t.Errorf("Authorization = %q, want basic auth with the email and API token", (*auth)[0])
+	}
+
+	// Data Center: a display URL, with a personal access token
+	dc := config.ConnectorsConfig{Confluence: &config.ConfluenceConfig{URL: server.URL, Token: "pat"}}
+	if _, err := Fetch(ctx, dc, KindConfluence, server.URL+"/display/ENG/Deploy+Guide"); err != nil {
+		t.Fatalf("Fetch(display URL) error = %v", err)
+	}
+	if (*auth)[1] != "Bearer pat" {
+		t.Errorf("Authorization = %q, want the personal access token", (*auth)[1])
+	}
+
+	if _, err := Fetch(ctx, dc, KindConfluence, "99"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Fetch(missing page) error = %v, want not found", err)
+	}
+}
+
+func TestCheckConfigured(t *testing.T) {
+	for kind, want := range map[string]string{
+		KindGoogleDrive: "connectors.google_drive",
+		KindNotion:      "connectors.notion.token",
+		KindConfluence:  "connectors.confluence",
+		"dropbox":       "unknown connector",
+	} {
+		if err := CheckConfigured(config.ConnectorsConfig{}, kind); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("CheckConfigured(%s) = %v, want %q", kind, err, want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/httpclient"
+)
+
+// Google endpoints; tests point them at a fake server
+var (
+	driveAPI       = "https://www.googleapis.com/drive/v3"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+)
+
+// Google Drive MIME types
+const (
+	mimeFolder       = "application/vnd.google-apps.folder"
+	mimeGoogleApps   = "application/vnd.google-apps."
+	mimeDocument     = mimeGoogleApps + "document"
+	mimeSpreadsheet  = mimeGoogleApps + "spreadsheet"
+	mimePresentation = mimeGoogleApps + "presentation"
+)
+
+// driveExports are the formats Google's own file types are exported in
+var driveExports = map[string]struct{ mime, ext string }{
+	mimeDocument:     {"text/markdown", ".md"},
+	mimeSpreadsheet:  {"text/csv", ".csv"}, // The first sheet only
+	mimePresentation: {"text/plain", ".txt"},
+}
+
+// drive reads files from Google Drive
+type drive struct {
+	settings *config.GoogleDriveConfig
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newDrive(settings *config.GoogleDriveConfig) *drive {
+	return &drive{settings: settings}
+}
+
+var (
+	driveIDPath  = regexp.MustCompile(`/(?:d|folders)/([A-Za-z0-9_-]+)`)
+	driveIDValue = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// driveFileID returns the ID of a Drive file or folder from its URL, such
+// as https://docs.google.com/document/d/<id>/edit, or the ID itself
+func driveFileID(ref string) (string, error) {
+	if driveIDValue.MatchString(ref) {
+		return ref, nil
+	}
+	u, err := url.Parse(ref)
+	if err == nil && u.Host != "" {
+		if m := driveIDPath.FindStringSubmatch(u.Path); m != nil {
+			return m[1], nil
+		}
+		if id := u.Query().Get("id"); id != "" {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a Google Drive URL or file ID", ref)
+}
+
+// accessToken returns the configured access token, or one obtained with
+// the refresh token and reused until shortly before it expires
+func (d *drive) accessToken(ctx context.Context) (string, error) {
+	if d.settings.AccessToken != "" {
+		return d.settings.AccessToken, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.token != "" && time.Now().Before(d.expires) {
+		return d.token, nil
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {d.settings.ClientID},
+		"client_secret": {d.settings.ClientSecret},
+		"refresh_token": {d.settings.RefreshToken},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpclient.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error refreshing Google access token: %w", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error reading Google token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", fmt.Errorf("error refreshing Google access token: %s %s", token.Error, token.ErrorDescription)
+	}
+	d.token = token.AccessToken
+	d.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return d.token, nil
+}
+
+// GoogleAccessToken returns an access token for the Google Drive
+// credentials, which other Google APIs such as Sheets accept when the
+// token or refresh token was granted their scope
+func GoogleAccessToken(ctx context.Context, settings config.ConnectorsConfig) (string, error) {
+	if err := CheckConfigured(settings, KindGoogleDrive); err != nil {
+		return "", err
+	}
+	return newDrive(settings.GoogleDrive).accessToken(ctx)
+}
+
+// driveFile is the metadata of a Drive file
+type driveFile struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+}
+
+func (d *drive) get(ctx context.Context, endpoint string, query url.Values) ([]byte, error) {
+	token, err := d.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query.Set("supportsAllDrives", "true")
+	return get(ctx, driveAPI+endpoint+"?"+query.Encode(), map[string]string{"Authorization": "Bearer " + token})
+}
+
+func (d *drive) getJSON(ctx context.Context, endpoint string, query url.Values, out interface{}) error {
+	data, err := d.get(ctx, endpoint, query)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing Drive response: %w", err)
+	}
+	return nil
+}
+
+// fetch returns a file, or the files directly in a folder
+func (d *drive) fetch(ctx context.Context, ref string) ([]Document, error) {
+	id, err := driveFileID(ref)
+	if err != nil {
+		return nil, err
+	}
+	var file driveFile
+	if err := d.getJSON(ctx, "/files/"+url.PathEscape(id), url.Values{"fields": {"id,name,mimeType"}}, &file); err != nil {
+		return nil, err
+	}
+	if file.MimeType != mimeFolder {
+		doc, err := d.download(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		doc.Source = ref
+		return []Document{doc}, nil
+	}
+
+	var docs []Document
+	query := url.Values{
+		"q":                         {fmt.Sprintf("'%s' in parents and trashed = false", id)},
+		"fields":                    {"nextPageToken,files(id,name,mimeType)"},
+		"orderBy":                   {"name"},
+		"pageSize":                  {"100"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	for {
+		var page struct {
+			NextPageToken string      `json:"nextPageToken"`
+			Files         []driveFile `json:"files"`
+		}
+		if err := d.getJSON(ctx, "/files", query, &page); err != nil {
+			return nil, err
+		}
+		for _, f := range page.Files {
+			if f.MimeType == mimeFolder {
+				continue
+			}
+			doc, err := d.download(ctx, f)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			doc.Source = ref + "/" + f.Name
+			docs = append(docs, doc)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("folder %s has no files", file.Name)
+	}
+	return docs, nil
+}
+
+// download returns a file's contents: Google Docs as markdown, Sheets as
+// CSV and Slides as text, HTML files converted to markdown, and other
+// files as they are
+func (d *drive) download(ctx context.Context, file driveFile) (Document, error) {
+	endpoint := "/files/" + url.PathEscape(file.ID)
+	doc := Document{Title: file.Name}
+	if export, ok := driveExports[file.MimeType]; ok {
+		data, err := d.get(ctx, endpoint+"/export", url.Values{"mimeType": {export.mime}})
+		if err != nil {
+			return Document{}, err
+		}
+		doc.Content, doc.Ext = data, export.ext
+		return doc, nil
+	}
+	if strings.HasPrefix(file.MimeType, mimeGoogleApps) {
+		return Document{}, fmt.Errorf("%s is a %s, which can't be exported as text", file.Name, strings.TrimPrefix(file.MimeType, mimeGoogleApps))
+	}
+
+	data, err := d.get(ctx, endpoint, url.Values{"alt": {"media"}})
+	if err != nil {
+		return Document{}, err
+	}
+	if file.MimeType == "text/html" {
+		md, err := HTMLToMarkdown(string(data))
+		if err != nil {
+			return Document{}, err
+		}
+		doc.Content, doc.Ext = []byte(md), ".md"
+		return doc, nil
+	}
+	doc.Content, doc.Ext = data, path.Ext(file.Name)
+	if doc.Ext == "" {
+		doc.Ext = ".txt"
+	}
+	return doc, nil
+}
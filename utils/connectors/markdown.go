@@ -0,0 +1,318 @@
+package connectors
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTMLToMarkdown converts HTML, including the storage format of Confluence
+// pages, to markdown. Headings, paragraphs, emphasis, links, images,
+// lists, tables, quotes and code are kept; other markup is dropped and its
+// text kept.
+func HTMLToMarkdown(source string) (string, error) {
+	// CDATA sections, which hold the code of Confluence code blocks, are
+	// only parsed in foreign content such as SVG, so they become text first
+	source = cdata.ReplaceAllStringFunc(source, func(section string) string {
+		return html.EscapeString(section[len("<![CDATA[") : len(section)-len("]]>")])
+	})
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return "", fmt.Errorf("error parsing HTML: %w", err)
+	}
+	return tidyMarkdown(renderNodes(doc)), nil
+}
+
+var (
+	cdata      = regexp.MustCompile(`(?s)<!\[CDATA\[.*?\]\]>`)
+	spaces     = regexp.MustCompile(`[ \t\r\n\f]+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// tidyMarkdown drops trailing spaces and repeated blank lines
+func tidyMarkdown(md string) string {
+	lines := strings.Split(md, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")) + "\n"
+}
+
+// block sets text apart as a block
+func block(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	return "\n\n" + text + "\n\n"
+}
+
+// wrap surrounds inline text with a marker, such as ** for bold, keeping
+// the spaces around it outside
+func wrap(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trail := text[len(strings.TrimRight(text, " ")):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// indent prefixes every line but the first with pad
+func indent(text, pad string) string {
+	return strings.ReplaceAll(text, "\n", "\n"+pad)
+}
+
+// attr returns an attribute of a node
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// child returns the first child element of n named name
+func child(n *html.Node, name string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// rawText returns the text under n as written
+func rawText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func renderNodes(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(render(c))
+	}
+	return b.String()
+}
+
+func render(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return spaces.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	case html.DocumentNode:
+		return renderNodes(n)
+	default:
+		return ""
+	}
+
+	switch n.Data {
+	case "head", "script", "style", "title":
+		return ""
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(n.Data[1] - '0')
+		return block(strings.Repeat("#", level) + " " + strings.TrimSpace(renderNodes(n)))
+	case "p", "div", "section", "article", "header", "footer", "main":
+		return block(renderNodes(n))
+	case "br":
+		return "\n"
+	case "hr":
+		return block("---")
+	case "strong", "b":
+		return wrap(renderNodes(n), "**")
+	case "em", "i":
+		return wrap(renderNodes(n), "*")
+	case "s", "del", "strike":
+		return wrap(renderNodes(n), "~~")
+	case "code", "tt", "kbd":
+		return wrap(rawText(n), "`")
+	case "pre":
+		lang := ""
+		if code := child(n, "code"); code != nil {
+			lang = strings.TrimPrefix(attr(code, "class"), "language-")
+		}
+		return fence(rawText(n), lang)
+	case "a":
+		text := strings.TrimSpace(renderNodes(n))
+		href := attr(n, "href")
+		if href == "" || text == "" || strings.HasPrefix(href, "#") {
+			return text
+		}
+		return "[" + text + "](" + href + ")"
+	case "img":
+		return "![" + attr(n, "alt") + "](" + attr(n, "src") + ")"
+	case "ul", "ol":
+		return block(renderList(n))
+	case "blockquote":
+		return quote(renderNodes(n))
+	case "table":
+		return block(renderTable(n))
+
+	// Confluence storage format
+	case "ac:structured-macro":
+		return renderMacro(n)
+	case "ac:link":
+		if body := child(n, "ac:link-body"); body != nil {
+			return renderNodes(body)
+		}
+		if body := child(n, "ac:plain-text-link-body"); body != nil {
+			return rawText(body)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if title := attr(c, "ri:content-title"); title != "" {
+				return title
+			}
+		}
+		return ""
+	case "ac:image":
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.Data {
+			case "ri:url":
+				return "![" + attr(n, "ac:alt") + "](" + attr(c, "ri:value") + ")"
+			case "ri:attachment":
+				return "![" + attr(n, "ac:alt") + "](" + attr(c, "ri:filename") + ")"
+			}
+		}
+		return ""
+	case "ac:parameter", "ac:placeholder":
+		return ""
+	}
+	return renderNodes(n)
+}
+
+// fence formats code as a fenced block
+func fence(code, lang string) string {
+	code = strings.Trim(code, "\n")
+	marker := "```"
+	for strings.Contains(code, marker) {
+		marker += "`"
+	}
+	return "\n\n" + marker + lang + "\n" + code + "\n" + marker + "\n\n"
+}
+
+// quote formats text as a block quote
+func quote(text string) string {
+	text = tidyMarkdown(text)
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return block(strings.Join(lines, "\n"))
+}
+
+// renderList formats the items of a ul or ol element
+func renderList(n *html.Node) string {
+	var items []string
+	number := 1
+	if start := attr(n, "start"); start != "" {
+		fmt.Sscanf(start, "%d", &number)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		text := strings.TrimSpace(blankLines.ReplaceAllString(renderNodes(c), "\n\n"))
+		text = strings.ReplaceAll(text, "\n\n", "\n")
+		items = append(items, marker+indent(text, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// renderTable formats a table, its first row as the header
+func renderTable(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "tr" {
+			var cells []string
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+					cell := strings.TrimSpace(spaces.ReplaceAllString(renderNodes(c), " "))
+					cells = append(cells, strings.ReplaceAll(cell, "|", `\|`))
+				}
+			}
+			rows = append(rows, cells)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", width))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderMacro formats a Confluence macro: code blocks as fenced code,
+// panels such as info and note as quotes, and others as their body
+func renderMacro(n *html.Node) string {
+	name := attr(n, "ac:name")
+	param := func(key string) string {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Data == "ac:parameter" && attr(c, "ac:name") == key {
+				return rawText(c)
+			}
+		}
+		return ""
+	}
+	if body := child(n, "ac:plain-text-body"); body != nil {
+		if name == "code" || name == "noformat" {
+			return fence(rawText(body), param("language"))
+		}
+		return block(rawText(body))
+	}
+	body := child(n, "ac:rich-text-body")
+	if body == nil {
+		return ""
+	}
+	switch name {
+	case "info", "note", "tip", "warning", "panel":
+		text := renderNodes(body)
+		if title := param("title"); title != "" {
+			text = "**" + title + "**\n\n" + text
+		}
+		return quote(text)
+	}
+	return block(renderNodes(body))
+}
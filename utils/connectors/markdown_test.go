@@ -0,0 +1,52 @@
+package connectors
+
+import "testing"
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name, html, want string
+	}{
+		{
+			name: "blocks and inline",
+			html: `<h1>Runbook</h1>
+<p>Restart the <strong>worker</strong> with <code>systemctl restart</code>,
+then <a href="https://example.com/status">check status</a>.</p>
+<hr/>`,
+			want: "# Runbook\n\nRestart the **worker** with `systemctl restart`, then [check status](https://example.com/status).\n\n---\n",
+		},
+		{
+			name: "nested lists",
+			html: `<ol><li>Drain<ul><li>Stop traffic</li><li>Wait</li></ul></li><li>Restart</li></ol>`,
+			want: "1. Drain\n   - Stop traffic\n   - Wait\n2. Restart\n",
+		},
+		{
+			name: "table",
+			html: `<table><tr><th>Host</th><th>Role</th></tr><tr><td>a|b</td><td>db</td></tr></table>`,
+			want: "| Host | Role |\n| --- | --- |\n| a\\|b | db |\n",
+		},
+		{
+			name: "pre",
+			html: "<pre><code class=\"language-sh\">make build\nmake test</code></pre>",
+			want: "```sh\nmake build\nmake test\n```\n",
+		},
+		{
+			name: "confluence macros",
+			html: `<ac:structured-macro ac:name="code"><ac:parameter ac:name="language">go</ac:parameter>` +
+				`<ac:plain-text-body><![CDATA[fmt.Println("<hi>")]]></ac:plain-text-body></ac:structured-macro>` +
+				`<ac:structured-macro ac:name="info"><ac:rich-text-body><p>Page the on-call.</p></ac:rich-text-body></ac:structured-macro>` +
+				`<p>See <ac:link><ri:page ri:content-title="Escalation" /></ac:link>.</p>`,
+			want: "```go\nfmt.Println(\"<hi>\")\n```\n\n> Page the on-call.\n\nSee Escalation.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HTMLToMarkdown(tt.html)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("HTMLToMarkdown() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
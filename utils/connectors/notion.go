@@ -0,0 +1,293 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// notionAPI is Notion's API; tests point it at a fake server
+var notionAPI = "https://api.notion.com/v1"
+
+// notionVersion is the version of the Notion API the connector speaks
+const notionVersion = "2022-06-28"
+
+// notion reads pages from Notion
+type notion struct {
+	headers map[string]string
+}
+
+func newNotion(settings *config.NotionConfig) *notion {
+	return &notion{headers: map[string]string{
+		"Authorization":  "Bearer " + settings.Token,
+		"Notion-Version": notionVersion,
+	}}
+}
+
+var notionID = regexp.MustCompile(`([0-9a-fA-F]{8})-?([0-9a-fA-F]{4})-?([0-9a-fA-F]{4})-?([0-9a-fA-F]{4})-?([0-9a-fA-F]{12})$`)
+
+// notionPageID returns the ID of a Notion page from its URL, such as
+// https://www.notion.so/acme/Runbook-0123456789abcdef0123456789abcdef, or
+// the ID itself
+func notionPageID(ref string) (string, error) {
+	candidate := ref
+	if u, err := url.Parse(ref); err == nil && u.Host != "" {
+		candidate = strings.TrimRight(u.Path, "/")
+		if p := u.Query().Get("p"); p != "" {
+			candidate = p // A page opened as a peek
+		}
+	}
+	m := notionID.FindStringSubmatch(candidate)
+	if m == nil {
+		return "", fmt.Errorf("%q is not a Notion page URL or ID", ref)
+	}
+	return strings.ToLower(strings.Join(m[1:], "-")), nil
+}
+
+// notionText is a run of Notion rich text
+type notionText struct {
+	PlainText   string `json:"plain_text"`
+	Href        string `json:"href"`
+	Annotations struct {
+		Bold          bool `json:"bold"`
+		Italic        bool `json:"italic"`
+		Strikethrough bool `json:"strikethrough"`
+		Code          bool `json:"code"`
+	} `json:"annotations"`
+}
+
+// notionContent is the part of a block specific to its type
+type notionContent struct {
+	RichText   []notionText `json:"rich_text"`
+	Checked    bool         `json:"checked"`
+	Language   string       `json:"language"`
+	Title      string       `json:"title"`
+	Expression string       `json:"expression"`
+	URL        string       `json:"url"`
+	Caption    []notionText `json:"caption"`
+	External   struct {
+		URL string `json:"url"`
+	} `json:"external"`
+	File struct {
+		URL string `json:"url"`
+	} `json:"file"`
+}
+
+// notionBlock is a block of a page. Its content is under the key named by
+// its type, decoded by UnmarshalJSON.
+type notionBlock struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	HasChildren bool   `json:"has_children"`
+	Content     notionContent
+	Children    []notionBlock
+}
+
+func (b *notionBlock) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	type plain notionBlock
+	if err := json.Unmarshal(data, (*plain)(b)); err != nil {
+		return err
+	}
+	if content, ok := raw[b.Type]; ok {
+		return json.Unmarshal(content, &b.Content)
+	}
+	return nil
+}
+
+// fetch returns a page and its blocks as markdown
+func (n *notion) fetch(ctx context.Context, ref string) ([]Document, error) {
+	id, err := notionPageID(ref)
+	if err != nil {
+		return nil, err
+	}
+	var page struct {
+		Properties map[string]struct {
+			Type  string       `json:"type"`
+			Title []notionText `json:"title"`
+		} `json:"properties"`
+	}
+	if err := getJSON(ctx, notionAPI+"/pages/"+id, n.headers, &page); err != nil {
+		return nil, err
+	}
+	title := "Untitled"
+	for _, prop := range page.Properties {
+		if prop.Type == "title" && len(prop.Title) > 0 {
+			title = plainText(prop.Title)
+		}
+	}
+
+	blocks, err := n.children(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	md := "# " + title + "\n\n" + renderNotionBlocks(blocks)
+	return []Document{{Title: title, Source: ref, Content: []byte(tidyMarkdown(md)), Ext: ".md"}}, nil
+}
+
+// children returns the blocks under a block, with their own children
+func (n *notion) children(ctx context.Context, id string) ([]notionBlock, error) {
+	var blocks []notionBlock
+	cursor := ""
+	for {
+		endpoint := notionAPI + "/blocks/" + id + "/children?page_size=100"
+		if cursor != "" {
+			endpoint += "&start_cursor=" + url.QueryEscape(cursor)
+		}
+		var resp struct {
+			Results    []notionBlock `json:"results"`
+			HasMore    bool          `json:"has_more"`
+			NextCursor string        `json:"next_cursor"`
+		}
+		if err := getJSON(ctx, endpoint, n.headers, &resp); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, resp.Results...)
+		if !resp.HasMore || resp.NextCursor == "" {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	for i := range blocks {
+		// Child pages are documents of their own
+		if blocks[i].HasChildren && blocks[i].Type != "child_page" && blocks[i].Type != "child_database" {
+			children, err := n.children(ctx, blocks[i].ID)
+			if err != nil {
+				return nil, err
+			}
+			blocks[i].Children = children
+		}
+	}
+	return blocks, nil
+}
+
+// plainText joins rich text without formatting
+func plainText(texts []notionText) string {
+	var b strings.Builder
+	for _, t := range texts {
+		b.WriteString(t.PlainText)
+	}
+	return b.String()
+}
+
+// richText formats rich text as markdown
+func richText(texts []notionText) string {
+	var b strings.Builder
+	for _, t := range texts {
+		text := t.PlainText
+		if t.Annotations.Code {
+			text = wrap(text, "`")
+		}
+		if t.Annotations.Bold {
+			text = wrap(text, "**")
+		}
+		if t.Annotations.Italic {
+			text = wrap(text, "*")
+		}
+		if t.Annotations.Strikethrough {
+			text = wrap(text, "~~")
+		}
+		if t.Href != "" {
+			text = "[" + text + "](" + t.Href + ")"
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// renderNotionBlocks formats blocks as markdown, numbering each run of
+// numbered list items from 1
+func renderNotionBlocks(blocks []notionBlock) string {
+	var b strings.Builder
+	number := 0
+	for i, block := range blocks {
+		if block.Type == "numbered_list_item" {
+			number++
+		} else {
+			number = 0
+		}
+		text, pad := renderNotionBlock(block, number)
+		switch {
+		case text == "" && len(block.Children) > 0:
+			// Columns, synced blocks and others only hold children
+			text = strings.TrimSpace(renderNotionBlocks(block.Children))
+		case text == "":
+			continue
+		case len(block.Children) > 0:
+			children := strings.TrimSpace(renderNotionBlocks(block.Children))
+			if pad != "" {
+				children = pad + indent(children, pad)
+			}
+			text += "\n" + children
+		}
+		b.WriteString(text)
+		// List items of one list are on consecutive lines
+		if i+1 < len(blocks) && isListItem(block.Type) && blocks[i+1].Type == block.Type {
+			b.WriteString("\n")
+		} else {
+			b.WriteString("\n\n")
+		}
+	}
+	return b.String()
+}
+
+func isListItem(blockType string) bool {
+	return blockType == "bulleted_list_item" || blockType == "numbered_list_item" || blockType == "to_do"
+}
+
+// renderNotionBlock formats a block without its children, and returns the
+// indent its children need
+func renderNotionBlock(block notionBlock, number int) (string, string) {
+	c := block.Content
+	text := richText(c.RichText)
+	switch block.Type {
+	case "paragraph":
+		return text, ""
+	case "heading_1":
+		return "## " + text, ""
+	case "heading_2":
+		return "### " + text, ""
+	case "heading_3":
+		return "#### " + text, ""
+	case "bulleted_list_item":
+		return "- " + text, "  "
+	case "numbered_list_item":
+		marker := fmt.Sprintf("%d. ", number)
+		return marker + text, strings.Repeat(" ", len(marker))
+	case "to_do":
+		box := "[ ]"
+		if c.Checked {
+			box = "[x]"
+		}
+		return "- " + box + " " + text, "  "
+	case "toggle":
+		return "- " + text, "  "
+	case "quote", "callout":
+		return "> " + indent(text, "> "), "> "
+	case "code":
+		return strings.TrimSpace(fence(plainText(c.RichText), c.Language)), ""
+	case "divider":
+		return "---", ""
+	case "child_page", "child_database":
+		return "**" + c.Title + "**", ""
+	case "image":
+		src := c.File.URL
+		if src == "" {
+			src = c.External.URL
+		}
+		return "![" + plainText(c.Caption) + "](" + src + ")", ""
+	case "bookmark", "embed", "link_preview":
+		return "[" + c.URL + "](" + c.URL + ")", ""
+	case "equation":
+		return "$$" + c.Expression + "$$", ""
+	}
+	return "", ""
+}
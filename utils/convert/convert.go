@@ -0,0 +1,301 @@
+// Package convert imports prompts and chains written for other tools as
+// comanda workflows: OpenAI Assistants and Playground exports, LangChain
+// LCEL chains serialized to JSON, and plain prompt text files.
+//
+// Prompt variables become workflow params, so a converted workflow takes
+// the same values on the command line that the original took in code.
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source formats
+const (
+	FormatOpenAI    = "openai"
+	FormatLangChain = "langchain"
+	FormatText      = "text"
+)
+
+// Formats lists the source formats Convert accepts
+var Formats = []string{FormatOpenAI, FormatLangChain, FormatText}
+
+// Options tunes a conversion
+type Options struct {
+	Format string // Source format; detected from the data when empty
+	Model  string // Model for steps whose source names none
+	Name   string // Base name for the workflow's steps
+	Source string // Where the data came from, noted in the workflow's header
+}
+
+// Result is a converted workflow
+type Result struct {
+	Format   string   // The source format, as given or detected
+	Workflow []byte   // Workflow YAML
+	Warnings []string // Settings and features that were not carried over
+}
+
+// step is a workflow step being built
+type step struct {
+	name         string
+	responses    bool // An openai-responses step
+	input        string
+	model        string
+	instructions string
+	action       string
+	temperature  float64
+	topP         float64
+	maxTokens    int
+}
+
+// workflow collects steps, params and warnings during a conversion
+type workflow struct {
+	opts     Options
+	steps    []step
+	params   []string
+	declared map[string]bool
+	warnings []string
+}
+
+// Convert turns data in one of the supported formats into a workflow
+func Convert(data []byte, opts Options) (*Result, error) {
+	if opts.Format == "" {
+		format, err := Detect(data)
+		if err != nil {
+			return nil, err
+		}
+		opts.Format = format
+	}
+	if opts.Name == "" {
+		opts.Name = "prompt"
+	}
+	opts.Name = identifier(opts.Name)
+
+	w := &workflow{opts: opts, declared: make(map[string]bool)}
+	var err error
+	switch opts.Format {
+	case FormatOpenAI:
+		err = w.fromOpenAI(data)
+	case FormatLangChain:
+		err = w.fromLangChain(data)
+	case FormatText:
+		err = w.fromText(string(data))
+	default:
+		return nil, fmt.Errorf("unknown format '%s' (use %s)", opts.Format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(w.steps) == 0 {
+		return nil, fmt.Errorf("no prompts found to convert")
+	}
+	for i, s := range w.steps {
+		if len(w.steps) > 1 && s.name == opts.Name {
+			w.steps[i].name = fmt.Sprintf("%s_%d", opts.Name, i+1)
+		}
+		if s.model == "" {
+			return nil, fmt.Errorf("step '%s' has no model in the source; set one with --model", w.steps[i].name)
+		}
+	}
+
+	out, err := w.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Format: opts.Format, Workflow: out, Warnings: w.warnings}, nil
+}
+
+// Detect guesses the format of data: JSON with LangChain's serialization
+// markers, JSON shaped like an OpenAI export, or anything else as text
+func Detect(data []byte) (string, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return FormatText, nil
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(trimmed, &obj); err != nil {
+		return "", fmt.Errorf("input looks like JSON but could not be parsed: %w", err)
+	}
+	if _, ok := obj["lc"]; ok {
+		return FormatLangChain, nil
+	}
+	for _, key := range []string{"instructions", "messages", "prompt", "data"} {
+		if _, ok := obj[key]; ok {
+			return FormatOpenAI, nil
+		}
+	}
+	if obj["object"] == "assistant" {
+		return FormatOpenAI, nil
+	}
+	return "", fmt.Errorf("unrecognized JSON; use --from to name the format (%s)", strings.Join(Formats, ", "))
+}
+
+// fromText converts a prompt file. Sections separated by a line of "---"
+// become steps that each read the previous step's output.
+func (w *workflow) fromText(text string) error {
+	var sections []string
+	var current []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "---" {
+			sections = append(sections, strings.Join(current, "\n"))
+			current = nil
+			continue
+		}
+		current = append(current, line)
+	}
+	sections = append(sections, strings.Join(current, "\n"))
+
+	for _, section := range sections {
+		section = strings.TrimSpace(section)
+		if section == "" {
+			continue
+		}
+		input := "NA"
+		if len(w.steps) > 0 {
+			input = "STDIN"
+		}
+		w.steps = append(w.steps, step{
+			name:   w.opts.Name,
+			input:  input,
+			model:  w.opts.Model,
+			action: w.mustache(section),
+		})
+	}
+	return nil
+}
+
+// mustacheVariable matches {{name}} variables, as used by OpenAI prompts,
+// prompt files and LangChain's mustache templates
+var mustacheVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][\w.-]*)\s*\}\}`)
+
+// mustache replaces {{name}} variables with workflow params
+func (w *workflow) mustache(text string) string {
+	return mustacheVariable.ReplaceAllStringFunc(text, func(match string) string {
+		name := mustacheVariable.FindStringSubmatch(match)[1]
+		if strings.HasPrefix(name, "params.") || strings.HasPrefix(name, "env.") {
+			return match // Already comanda syntax
+		}
+		return w.param(name)
+	})
+}
+
+// param declares a workflow param and returns its placeholder
+func (w *workflow) param(name string) string {
+	name = identifier(name)
+	if !w.declared[name] {
+		w.declared[name] = true
+		w.params = append(w.params, name)
+	}
+	return "{{ params." + name + " }}"
+}
+
+// warn records something that was not carried over, once
+func (w *workflow) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	for _, existing := range w.warnings {
+		if existing == msg {
+			return
+		}
+	}
+	w.warnings = append(w.warnings, msg)
+}
+
+// identifier turns a name into one usable as a step or param name
+func identifier(name string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	id := strings.Trim(b.String(), "_")
+	if id == "" {
+		return "prompt"
+	}
+	if id[0] >= '0' && id[0] <= '9' {
+		id = "_" + id
+	}
+	return id
+}
+
+// marshal writes the workflow as YAML, keeping params first and the steps
+// and their keys in order
+func (w *workflow) marshal() ([]byte, error) {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	if w.opts.Source != "" {
+		doc.HeadComment = fmt.Sprintf("Converted from %s (%s) by comanda convert", w.opts.Source, w.opts.Format)
+	}
+
+	if len(w.params) > 0 {
+		params := &yaml.Node{Kind: yaml.MappingNode}
+		for _, name := range w.params {
+			params.Content = append(params.Content, scalar(name), mapping("required", "true"))
+		}
+		doc.Content = append(doc.Content, scalar("params"), params)
+	}
+
+	for _, s := range w.steps {
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		add := func(key, value string) {
+			node.Content = append(node.Content, scalar(key), scalar(value))
+		}
+		if s.responses {
+			add("type", "openai-responses")
+		}
+		add("input", s.input)
+		add("model", s.model)
+		if s.instructions != "" {
+			add("instructions", s.instructions)
+		}
+		if s.action != "" {
+			add("action", s.action)
+		}
+		if s.temperature != 0 {
+			add("temperature", strconv.FormatFloat(s.temperature, 'f', -1, 64))
+		}
+		if s.topP != 0 {
+			add("top_p", strconv.FormatFloat(s.topP, 'f', -1, 64))
+		}
+		if s.maxTokens != 0 {
+			add("max_output_tokens", strconv.Itoa(s.maxTokens))
+		}
+		add("output", "STDOUT")
+		doc.Content = append(doc.Content, scalar(s.name), node)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("error encoding workflow: %w", err)
+	}
+	enc.Close()
+	return buf.Bytes(), nil
+}
+
+// scalar returns a YAML scalar, in literal block style when multi-line
+func scalar(value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if strings.Contains(value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	return node
+}
+
+// mapping returns a one-entry mapping whose value is a plain scalar
+func mapping(key, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		scalar(key),
+		{Kind: yaml.ScalarNode, Tag: "!!bool", Value: value},
+	}}
+}
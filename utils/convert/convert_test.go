@@ -0,0 +1,207 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// convertedStep is the subset of a step the tests check
+type convertedStep struct {
+	Type         string  `yaml:"type"`
+	Input        string  `yaml:"input"`
+	Model        string  `yaml:"model"`
+	Instructions string  `yaml:"instructions"`
+	Action       string  `yaml:"action"`
+	Temperature  float64 `yaml:"temperature"`
+	Output       string  `yaml:"output"`
+}
+
+// parseWorkflow decodes a converted workflow's steps and param names
+func parseWorkflow(t *testing.T, data []byte) (map[string]convertedStep, []string) {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("converted workflow is not valid YAML: %v\n%s", err, data)
+	}
+	steps := make(map[string]convertedStep)
+	var params []string
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		if key == "params" {
+			for j := 0; j < len(value.Content); j += 2 {
+				params = append(params, value.Content[j].Value)
+			}
+			continue
+		}
+		var s convertedStep
+		if err := value.Decode(&s); err != nil {
+			t.Fatalf("step %s: %v", key, err)
+		}
+		steps[key] = s
+	}
+	return steps, params
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"Summarize the report", FormatText},
+		{`{"lc": 1, "type": "constructor", "id": ["langchain", "prompts", "prompt", "PromptTemplate"]}`, FormatLangChain},
+		{`{"object": "assistant", "model": "gpt-4o"}`, FormatOpenAI},
+		{`{"model": "gpt-4o", "messages": []}`, FormatOpenAI},
+	}
+	for _, tt := range tests {
+		got, err := Detect([]byte(tt.data))
+		if err != nil || got != tt.want {
+			t.Errorf("Detect(%s) = %q, %v; want %q", tt.data, got, err, tt.want)
+		}
+	}
+	if _, err := Detect([]byte(`{"foo": 1}`)); err == nil {
+		t.Error("Detect() expected an error for unrecognized JSON")
+	}
+}
+
+func TestConvertText(t *testing.T) {
+	text := "Summarize {{ doc }} for {{env.TEAM}}.\n---\nTranslate it to {{language}}.\n"
+	result, err := Convert([]byte(text), Options{Model: "gpt-4o-mini", Name: "brief"})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	steps, params := parseWorkflow(t, result.Workflow)
+	if strings.Join(params, ",") != "doc,language" {
+		t.Errorf("params = %v, want doc, language", params)
+	}
+	first, second := steps["brief_1"], steps["brief_2"]
+	if first.Input != "NA" || first.Action != "Summarize {{ params.doc }} for {{env.TEAM}}." {
+		t.Errorf("brief_1 = %+v", first)
+	}
+	if second.Input != "STDIN" || second.Model != "gpt-4o-mini" || second.Output != "STDOUT" {
+		t.Errorf("brief_2 = %+v", second)
+	}
+
+	if _, err := Convert([]byte(text), Options{Format: FormatText}); err == nil || !strings.Contains(err.Error(), "--model") {
+		t.Errorf("Convert() without a model error = %v", err)
+	}
+}
+
+func TestConvertOpenAIAssistant(t *testing.T) {
+	assistant := `{
+		"object": "assistant",
+		"name": "Math Tutor",
+		"model": "gpt-4o",
+		"instructions": "You tutor {{grade}} students.",
+		"tools": [{"type": "code_interpreter"}, {"type": "function", "function": {"name": "lookup"}}],
+		"temperature": 0.5
+	}`
+	result, err := Convert([]byte(assistant), Options{})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	steps, params := parseWorkflow(t, result.Workflow)
+	s, ok := steps["Math_Tutor"]
+	if !ok {
+		t.Fatalf("expected a step named after the assistant, got %v", steps)
+	}
+	if s.Type != "openai-responses" || s.Input != "STDIN" || s.Temperature != 0.5 || s.Instructions != "You tutor {{ params.grade }} students." {
+		t.Errorf("step = %+v", s)
+	}
+	if len(params) != 1 || params[0] != "grade" {
+		t.Errorf("params = %v", params)
+	}
+	warnings := strings.Join(result.Warnings, "\n")
+	if !strings.Contains(warnings, "code_interpreter") || !strings.Contains(warnings, "lookup") {
+		t.Errorf("warnings = %v, want both tools", result.Warnings)
+	}
+}
+
+func TestConvertOpenAIChat(t *testing.T) {
+	preset := `{
+		"model": "gpt-4o-mini",
+		"max_tokens": 500,
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "Classify: {{ticket}}"}]}
+		],
+		"response_format": {"type": "json_object"}
+	}`
+	result, err := Convert([]byte(preset), Options{Name: "triage"})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	steps, _ := parseWorkflow(t, result.Workflow)
+	s := steps["triage"]
+	if s.Instructions != "Be brief." || s.Action != "Classify: {{ params.ticket }}" || s.Input != "NA" {
+		t.Errorf("step = %+v", s)
+	}
+	if !strings.Contains(string(result.Workflow), "max_output_tokens: 500") {
+		t.Errorf("max_tokens was not converted:\n%s", result.Workflow)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "response_format") {
+		t.Errorf("warnings = %v", result.Warnings)
+	}
+
+	list := `{"object": "list", "data": [{"name": "a", "model": "gpt-4o"}, {"name": "b", "model": "gpt-4o"}]}`
+	if _, err := Convert([]byte(list), Options{}); err == nil || !strings.Contains(err.Error(), "a, b") {
+		t.Errorf("Convert() of two assistants error = %v", err)
+	}
+}
+
+const langChainSequence = `{
+  "lc": 1, "type": "constructor", "id": ["langchain", "schema", "runnable", "RunnableSequence"],
+  "kwargs": {
+    "first": {
+      "lc": 1, "type": "constructor", "id": ["langchain", "prompts", "chat", "ChatPromptTemplate"],
+      "kwargs": {"messages": [
+        {"lc": 1, "type": "constructor", "id": ["langchain", "schema", "messages", "SystemMessage"], "kwargs": {"content": "You write clearly."}},
+        {"lc": 1, "type": "constructor", "id": ["langchain", "prompts", "chat", "HumanMessagePromptTemplate"],
+         "kwargs": {"prompt": {"lc": 1, "type": "constructor", "id": ["langchain", "prompts", "prompt", "PromptTemplate"],
+           "kwargs": {"template": "Write about {topic} as {{\"json\": true}}.", "template_format": "f-string"}}}},
+        {"lc": 1, "type": "constructor", "id": ["langchain", "prompts", "chat", "MessagesPlaceholder"], "kwargs": {"variable_name": "history"}}
+      ]}
+    },
+    "middle": [
+      {"lc": 1, "type": "constructor", "id": ["langchain", "schema", "runnable", "RunnableBinding"],
+       "kwargs": {"bound": {"lc": 1, "type": "constructor", "id": ["langchain", "chat_models", "openai", "ChatOpenAI"], "kwargs": {"model_name": "gpt-4o", "temperature": 0.2}}}},
+      {"lc": 1, "type": "constructor", "id": ["langchain", "schema", "output_parser", "StrOutputParser"], "kwargs": {}},
+      {"lc": 1, "type": "constructor", "id": ["langchain", "prompts", "prompt", "PromptTemplate"], "kwargs": {"template": "Tighten this draft:\n\n{draft}"}}
+    ],
+    "last": {"lc": 1, "type": "constructor", "id": ["langchain_anthropic", "chat_models", "ChatAnthropic"], "kwargs": {}}
+  }
+}`
+
+func TestConvertLangChain(t *testing.T) {
+	result, err := Convert([]byte(langChainSequence), Options{Name: "chain", Model: "claude-sonnet-4-5"})
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if result.Format != FormatLangChain {
+		t.Errorf("Format = %q, want langchain", result.Format)
+	}
+	steps, params := parseWorkflow(t, result.Workflow)
+	if len(params) != 1 || params[0] != "topic" {
+		t.Errorf("params = %v, want topic", params)
+	}
+
+	first := steps["chain_1"]
+	wantAction := "You write clearly.\n\nWrite about {{ params.topic }} as {\"json\": true}."
+	if first.Model != "gpt-4o" || first.Input != "NA" || first.Action != wantAction {
+		t.Errorf("chain_1 = %+v", first)
+	}
+	// The draft variable is the first step's output, passed as input
+	second := steps["chain_2"]
+	if second.Model != "claude-sonnet-4-5" || second.Input != "STDIN" || second.Action != "Tighten this draft:" {
+		t.Errorf("chain_2 = %+v", second)
+	}
+
+	warnings := strings.Join(result.Warnings, "\n")
+	for _, want := range []string{"temperature", "history"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings %v do not mention %s", result.Warnings, want)
+		}
+	}
+}
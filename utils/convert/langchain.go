@@ -0,0 +1,295 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// lcTemplate is one message of a LangChain prompt
+type lcTemplate struct {
+	role     string // system, human or ai
+	template string
+	format   string // f-string (default), mustache or jinja2
+}
+
+// fromLangChain converts a chain serialized with langchain's dumps or
+// dumpd. Each prompt and the chat model after it become a step; later
+// steps read the previous step's output.
+func (w *workflow) fromLangChain(data []byte) error {
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("error parsing LangChain JSON: %w", err)
+	}
+
+	var pending *step
+	flush := func() {
+		if pending != nil {
+			pending.model = w.opts.Model
+			w.steps = append(w.steps, *pending)
+			pending = nil
+		}
+	}
+	for _, node := range lcSequence(root) {
+		kind := lcKind(node)
+		kwargs, _ := node["kwargs"].(map[string]interface{})
+		switch {
+		case node["type"] == "not_implemented":
+			w.warn("%s could not be serialized by LangChain and is not converted", kind)
+		case kind == "ChatPromptTemplate" || kind == "PromptTemplate":
+			flush()
+			s, err := w.lcPrompt(kind, kwargs)
+			if err != nil {
+				return err
+			}
+			pending = s
+		case lcIsModel(kind):
+			s := pending
+			if s == nil {
+				s = &step{name: w.opts.Name, input: "STDIN", action: "Respond to the input."}
+			}
+			s.model = lcModelName(kwargs)
+			if s.model == "" {
+				s.model = w.opts.Model
+			}
+			for _, setting := range []string{"temperature", "max_tokens", "top_p"} {
+				if v, ok := kwargs[setting]; ok && v != nil {
+					w.warn("%s setting %s is not converted; standard steps use the provider's default", kind, setting)
+				}
+			}
+			w.steps = append(w.steps, *s)
+			pending = nil
+		case kind == "StrOutputParser":
+		case strings.HasSuffix(kind, "OutputParser"):
+			w.warn("%s is not converted; describe the format in the prompt or add a validate-data step", kind)
+		default:
+			w.warn("%s is not converted", kind)
+		}
+	}
+	flush()
+	return nil
+}
+
+// lcSequence flattens a RunnableSequence into its parts, unwrapping
+// bindings such as model.bind(...)
+func lcSequence(node map[string]interface{}) []map[string]interface{} {
+	kwargs, _ := node["kwargs"].(map[string]interface{})
+	switch lcKind(node) {
+	case "RunnableSequence":
+		var parts []map[string]interface{}
+		if first, ok := kwargs["first"].(map[string]interface{}); ok {
+			parts = append(parts, lcSequence(first)...)
+		}
+		if middle, ok := kwargs["middle"].([]interface{}); ok {
+			for _, m := range middle {
+				if part, ok := m.(map[string]interface{}); ok {
+					parts = append(parts, lcSequence(part)...)
+				}
+			}
+		}
+		if last, ok := kwargs["last"].(map[string]interface{}); ok {
+			parts = append(parts, lcSequence(last)...)
+		}
+		return parts
+	case "RunnableBinding":
+		if bound, ok := kwargs["bound"].(map[string]interface{}); ok {
+			return lcSequence(bound)
+		}
+	}
+	return []map[string]interface{}{node}
+}
+
+// lcKind returns the class name of a serialized object, the last element
+// of its id
+func lcKind(node map[string]interface{}) string {
+	id, _ := node["id"].([]interface{})
+	if len(id) == 0 {
+		return "unknown object"
+	}
+	kind, _ := id[len(id)-1].(string)
+	return kind
+}
+
+// lcIsModel reports whether a class is a chat or completion model
+func lcIsModel(kind string) bool {
+	switch kind {
+	case "OpenAI", "AzureOpenAI", "Anthropic", "Ollama", "VertexAI":
+		return true
+	}
+	return strings.HasPrefix(kind, "Chat")
+}
+
+// lcModelName returns the model a LangChain model object is set up with
+func lcModelName(kwargs map[string]interface{}) string {
+	for _, key := range []string{"model_name", "model", "model_id", "deployment_name"} {
+		if name, ok := kwargs[key].(string); ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// lcPrompt builds a step from a prompt template. Its variables become
+// params, except in a later step with a single variable, which is the
+// previous step's output.
+func (w *workflow) lcPrompt(kind string, kwargs map[string]interface{}) (*step, error) {
+	var templates []lcTemplate
+	if kind == "PromptTemplate" {
+		templates = append(templates, lcPromptTemplate("human", kwargs))
+	} else {
+		messages, _ := kwargs["messages"].([]interface{})
+		for _, m := range messages {
+			message, ok := m.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			messageKwargs, _ := message["kwargs"].(map[string]interface{})
+			messageKind := lcKind(message)
+			role := lcRole(messageKind)
+			switch {
+			case messageKind == "MessagesPlaceholder":
+				w.warn("messages placeholder '%v' is not converted", messageKwargs["variable_name"])
+			case strings.HasSuffix(messageKind, "PromptTemplate"):
+				prompt, _ := messageKwargs["prompt"].(map[string]interface{})
+				promptKwargs, _ := prompt["kwargs"].(map[string]interface{})
+				templates = append(templates, lcPromptTemplate(role, promptKwargs))
+			default:
+				// A fixed message, such as SystemMessage
+				content := messageText(messageKwargs["content"])
+				templates = append(templates, lcTemplate{role: role, template: content, format: "fixed"})
+			}
+		}
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("%s has no messages to convert", kind)
+	}
+
+	later := len(w.steps) > 0
+	var names []string
+	for _, t := range templates {
+		names = append(names, lcVariables(t)...)
+	}
+	fromInput := later && len(unique(names)) == 1
+	replace := func(name string) string {
+		if fromInput {
+			return inputMarker
+		}
+		return w.param(name)
+	}
+
+	var system []string
+	var turns []string
+	for _, t := range templates {
+		text := referToInput(lcRender(t, replace))
+		switch t.role {
+		case "system":
+			system = append(system, text)
+		case "ai":
+			turns = append(turns, "Assistant: "+text)
+		default:
+			turns = append(turns, "User: "+text)
+		}
+	}
+	if len(turns) == 1 {
+		turns[0] = strings.TrimPrefix(turns[0], "User: ")
+	}
+
+	s := &step{
+		name:   w.opts.Name,
+		input:  "NA",
+		action: joinText(strings.Join(system, "\n\n"), strings.Join(turns, "\n\n")),
+	}
+	if later {
+		s.input = "STDIN"
+	}
+	return s, nil
+}
+
+// inputMarker stands in for a variable that receives the previous step's
+// output until referToInput rewrites it
+const inputMarker = "\x00input\x00"
+
+// referToInput drops lines holding only the previous step's output, which
+// comanda passes as the step's input, and refers to the input elsewhere
+func referToInput(text string) string {
+	if !strings.Contains(text, inputMarker) {
+		return text
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != inputMarker {
+			lines = append(lines, strings.ReplaceAll(line, inputMarker, "the input"))
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// lcPromptTemplate reads a PromptTemplate's text and format
+func lcPromptTemplate(role string, kwargs map[string]interface{}) lcTemplate {
+	template, _ := kwargs["template"].(string)
+	format, _ := kwargs["template_format"].(string)
+	if format == "" {
+		format = "f-string"
+	}
+	return lcTemplate{role: role, template: template, format: format}
+}
+
+// lcRole maps a message class to its role
+func lcRole(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "System"):
+		return "system"
+	case strings.HasPrefix(kind, "AI"):
+		return "ai"
+	}
+	return "human"
+}
+
+// fstringVariable matches f-string variables and escaped braces
+var fstringVariable = regexp.MustCompile(`\{\{|\}\}|\{([A-Za-z_][\w]*)\}`)
+
+// lcVariables lists a template's variables in order
+func lcVariables(t lcTemplate) []string {
+	var names []string
+	lcRender(t, func(name string) string {
+		names = append(names, name)
+		return ""
+	})
+	return names
+}
+
+// lcRender replaces a template's variables with replace(name) and unescapes
+// literal braces
+func lcRender(t lcTemplate, replace func(string) string) string {
+	switch t.format {
+	case "fixed":
+		return t.template
+	case "mustache", "jinja2":
+		return mustacheVariable.ReplaceAllStringFunc(t.template, func(match string) string {
+			return replace(mustacheVariable.FindStringSubmatch(match)[1])
+		})
+	}
+	return fstringVariable.ReplaceAllStringFunc(t.template, func(match string) string {
+		switch match {
+		case "{{":
+			return "{"
+		case "}}":
+			return "}"
+		}
+		return replace(fstringVariable.FindStringSubmatch(match)[1])
+	})
+}
+
+// unique returns names without duplicates
+func unique(names []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// openAIExport covers the OpenAI shapes convert reads: an assistant, a list
+// of assistants, a Playground preset or chat completions request, and a
+// legacy completions preset
+type openAIExport struct {
+	Object         string                   `json:"object"`
+	Name           string                   `json:"name"`
+	Model          string                   `json:"model"`
+	Instructions   string                   `json:"instructions"`
+	Tools          []map[string]interface{} `json:"tools"`
+	ResponseFormat interface{}              `json:"response_format"`
+	Temperature    float64                  `json:"temperature"`
+	TopP           float64                  `json:"top_p"`
+	MaxTokens      int                      `json:"max_tokens"`
+	MaxCompletion  int                      `json:"max_completion_tokens"`
+	Messages       []openAIMessage          `json:"messages"`
+	Prompt         interface{}              `json:"prompt"`
+	Data           []openAIExport           `json:"data"`
+}
+
+// openAIMessage is a chat message whose content is a string or a list of
+// content parts
+type openAIMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// fromOpenAI converts an OpenAI export. Assistants and chat presets become
+// openai-responses steps, which keep their instructions and sampling
+// settings.
+func (w *workflow) fromOpenAI(data []byte) error {
+	var export openAIExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return fmt.Errorf("error parsing OpenAI export: %w", err)
+	}
+	if len(export.Data) > 0 {
+		if len(export.Data) > 1 {
+			names := make([]string, len(export.Data))
+			for i, a := range export.Data {
+				names[i] = a.Name
+			}
+			return fmt.Errorf("export lists %d assistants (%s); save the one to convert on its own", len(export.Data), strings.Join(names, ", "))
+		}
+		export = export.Data[0]
+	}
+
+	s := step{
+		name:        w.opts.Name,
+		responses:   true,
+		input:       "NA",
+		model:       export.Model,
+		temperature: export.Temperature,
+		topP:        export.TopP,
+		maxTokens:   export.MaxTokens,
+	}
+	if s.model == "" {
+		s.model = w.opts.Model
+	}
+	if export.MaxCompletion != 0 {
+		s.maxTokens = export.MaxCompletion
+	}
+	if export.Name != "" && w.opts.Name == "prompt" {
+		s.name = identifier(export.Name)
+	}
+
+	switch {
+	case len(export.Messages) > 0:
+		var turns []string
+		for _, m := range export.Messages {
+			text := w.mustache(messageText(m.Content))
+			switch m.Role {
+			case "system", "developer":
+				s.instructions = joinText(s.instructions, text)
+			case "assistant":
+				turns = append(turns, "Assistant: "+text)
+			default:
+				turns = append(turns, "User: "+text)
+			}
+		}
+		if len(turns) == 1 {
+			turns[0] = strings.TrimPrefix(turns[0], "User: ")
+		}
+		s.action = strings.Join(turns, "\n\n")
+		if s.action == "" {
+			s.input = "STDIN"
+		}
+	case export.Prompt != nil:
+		s.action = w.mustache(messageText(export.Prompt))
+	default:
+		// An assistant answers whatever it is given
+		s.instructions = w.mustache(export.Instructions)
+		s.input = "STDIN"
+	}
+	if export.Messages != nil && export.Instructions != "" {
+		s.instructions = joinText(w.mustache(export.Instructions), s.instructions)
+	}
+	if s.action == "" && s.instructions == "" {
+		s.action = "Respond to the input."
+	}
+
+	for _, tool := range export.Tools {
+		w.warn("tool '%v' is not converted; add it to the step's tools or use an agent step", toolName(tool))
+	}
+	if !plainResponseFormat(export.ResponseFormat) {
+		w.warn("response_format is not converted; describe the format in the instructions or add a validate-data step")
+	}
+	w.steps = append(w.steps, s)
+	return nil
+}
+
+// messageText returns the text of message content given as a string or as
+// a list of parts. Image and other non-text parts are dropped.
+func messageText(content interface{}) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var parts []string
+		for _, part := range v {
+			switch p := part.(type) {
+			case string:
+				parts = append(parts, p)
+			case map[string]interface{}:
+				if text, ok := p["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// plainResponseFormat reports whether a response_format asks for plain text
+func plainResponseFormat(format interface{}) bool {
+	if m, ok := format.(map[string]interface{}); ok {
+		format = m["type"]
+	}
+	return format == nil || format == "auto" || format == "text"
+}
+
+// toolName names an assistant tool for warnings
+func toolName(tool map[string]interface{}) interface{} {
+	if fn, ok := tool["function"].(map[string]interface{}); ok && fn["name"] != nil {
+		return fn["name"]
+	}
+	return tool["type"]
+}
+
+// joinText joins two non-empty texts with a blank line
+func joinText(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + "\n\n" + b
+}
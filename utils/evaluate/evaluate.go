@@ -0,0 +1,410 @@
+// Package evaluate runs a workflow over a dataset and scores each output
+// with a judge model against a rubric.
+//
+// A dataset is a JSONL file with one item per line:
+//
+//	{"id": "refund", "input": "Customer asks for a refund", "params": {"tone": "formal"}, "expected": "Offers a refund"}
+//
+// The input is piped to the workflow as STDIN, params are bound to its
+// parameters and expected, if set, is shown to the judge as a reference.
+package evaluate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Scores a judge gives
+const (
+	MinScore = 1
+	MaxScore = 5
+)
+
+// DefaultThreshold is the lowest score that passes
+const DefaultThreshold = 4
+
+// DefaultRubric is what the judge grades against when no rubric is given
+const DefaultRubric = "The output correctly and completely does what the input asks, without inventing facts."
+
+// Item is one case of a dataset
+type Item struct {
+	ID       string            `json:"id"`
+	Input    string            `json:"input"`    // Piped to the workflow as STDIN
+	Params   map[string]string `json:"params"`   // Bound to the workflow's parameters
+	Expected string            `json:"expected"` // Reference answer shown to the judge
+}
+
+// LoadDataset reads a JSONL dataset. Blank lines are skipped and items
+// without an id are numbered by line.
+func LoadDataset(path string) ([]Item, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dataset: %w", err)
+	}
+	defer f.Close()
+
+	var items []Item
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var item Item
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			return nil, fmt.Errorf("error parsing dataset %s line %d: %w", path, line, err)
+		}
+		if item.ID == "" {
+			item.ID = strconv.Itoa(line)
+		}
+		if seen[item.ID] {
+			return nil, fmt.Errorf("dataset %s has more than one item with id '%s'", path, item.ID)
+		}
+		seen[item.ID] = true
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading dataset: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("dataset %s has no items", path)
+	}
+	return items, nil
+}
+
+// Verdict is a judge's score for one output
+type Verdict struct {
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
+// JudgePrompt asks the judge to score an item's output against the rubric
+func JudgePrompt(rubric string, item Item, output string) string {
+	if strings.TrimSpace(rubric) == "" {
+		rubric = DefaultRubric
+	}
+	var b strings.Builder
+	b.WriteString("You are grading the output of an AI workflow against a rubric.\n\n")
+	fmt.Fprintf(&b, "Rubric:\n<<<RUBRIC\n%s\nRUBRIC>>>\n\n", strings.TrimSpace(rubric))
+	if item.Input != "" {
+		fmt.Fprintf(&b, "Input given to the workflow:\n<<<INPUT\n%s\nINPUT>>>\n\n", strings.TrimSpace(item.Input))
+	}
+	if len(item.Params) > 0 {
+		b.WriteString("Parameters of the workflow:\n")
+		for _, name := range sortedKeys(item.Params) {
+			fmt.Fprintf(&b, "- %s: %s\n", name, item.Params[name])
+		}
+		b.WriteString("\n")
+	}
+	if item.Expected != "" {
+		fmt.Fprintf(&b, "Reference answer:\n<<<REFERENCE\n%s\nREFERENCE>>>\n\n", strings.TrimSpace(item.Expected))
+	}
+	fmt.Fprintf(&b, "Output to grade:\n<<<OUTPUT\n%s\nOUTPUT>>>\n\n", strings.TrimSpace(output))
+	fmt.Fprintf(&b, "Score the output from %d (fails the rubric) to %d (fully meets it). ", MinScore, MaxScore)
+	b.WriteString(`Respond with only a JSON object: {"score": <number>, "reason": "<one sentence>"}`)
+	return b.String()
+}
+
+// ParseVerdict reads the JSON object in a judge's response
+func ParseVerdict(response string) (Verdict, error) {
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return Verdict{}, fmt.Errorf("judge response has no JSON verdict: %q", truncate(response, 200))
+	}
+	var verdict Verdict
+	if err := json.Unmarshal([]byte(response[start:end+1]), &verdict); err != nil {
+		return Verdict{}, fmt.Errorf("error parsing judge verdict: %w", err)
+	}
+	if verdict.Score < MinScore || verdict.Score > MaxScore {
+		return Verdict{}, fmt.Errorf("judge score %g is outside %d to %d", verdict.Score, MinScore, MaxScore)
+	}
+	verdict.Reason = strings.TrimSpace(verdict.Reason)
+	return verdict, nil
+}
+
+// Options controls an evaluation
+type Options struct {
+	Judge      models.Provider // Provider of the judge model
+	JudgeModel string
+	Rubric     string
+	Threshold  float64 // Lowest passing score, DefaultThreshold when 0
+	Step       string  // Step whose output is judged; the workflow's last output when empty
+	EnvConfig  *config.EnvConfig
+	RuntimeDir string
+	Verbose    bool
+	Resolver   processor.ProviderResolver // Overrides the workflow's providers, for tests
+	Progress   func(n, total int, item Item)
+
+	// Variants forces prompt variants by step name. Other steps with
+	// variants split the dataset between them by item ID.
+	Variants map[string]string
+	Store    *history.Store // Records each item's run and score, when set
+	Dataset  string         // Dataset path recorded with each run
+}
+
+// ItemResult is the outcome of one dataset item
+type ItemResult struct {
+	ID        string  `json:"id"`
+	Output    string  `json:"output,omitempty"`
+	Score     float64 `json:"score,omitempty"`
+	Reason    string  `json:"reason,omitempty"`
+	Passed    bool    `json:"passed"`
+	Error     string  `json:"error,omitempty"` // The workflow or the judge failed
+	LatencyMS int64   `json:"latency_ms"`
+	Cost      float64 `json:"cost,omitempty"`       // Estimated cost of the workflow's steps
+	JudgeCost float64 `json:"judge_cost,omitempty"` // Estimated cost of judging
+
+	Variants map[string]string `json:"variants,omitempty"` // Step name -> prompt variant it used
+	RunID    string            `json:"run_id,omitempty"`   // Run recorded in the history store
+}
+
+// stepCollector records the steps of one run, and passes them on to the
+// history recorder when there is one
+type stepCollector struct {
+	mu      sync.Mutex
+	records []processor.StepRecord
+	next    processor.StepRecorder
+}
+
+func (c *stepCollector) RecordStep(record processor.StepRecord) {
+	c.mu.Lock()
+	c.records = append(c.records, record)
+	c.mu.Unlock()
+	if c.next != nil {
+		c.next.RecordStep(record)
+	}
+}
+
+// Run runs the workflow once per item and judges its output. Failures of
+// the workflow or the judge are part of an item's result; the returned
+// error means the workflow could not be read.
+func Run(workflowPath string, items []Item, opts Options) ([]ItemResult, error) {
+	data, err := os.ReadFile(workflowPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading YAML file %s: %w", workflowPath, err)
+	}
+	if opts.Threshold == 0 {
+		opts.Threshold = DefaultThreshold
+	}
+	if opts.EnvConfig == nil {
+		opts.EnvConfig = &config.EnvConfig{}
+	}
+
+	if abs, err := filepath.Abs(workflowPath); err == nil {
+		workflowPath = abs
+	}
+
+	results := make([]ItemResult, len(items))
+	for i, item := range items {
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(items), item)
+		}
+		results[i] = runItem(workflowPath, data, item, opts)
+	}
+	return results, nil
+}
+
+// runItem runs the workflow with one item and judges its output, recording
+// the run and its score in the history store when there is one
+func runItem(workflowPath string, workflow []byte, item Item, opts Options) (result ItemResult) {
+	result.ID = item.ID
+	bound, err := processor.BindParams(workflow, item.Params)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(bound, &dslConfig); err != nil {
+		result.Error = fmt.Sprintf("error parsing workflow: %v", err)
+		return result
+	}
+
+	collector := &stepCollector{}
+	var runErr error
+	if opts.Store != nil {
+		// History problems never stop an evaluation
+		if recorder, err := opts.Store.Start(workflowPath); err == nil {
+			collector.next = recorder
+			result.RunID = recorder.ID()
+			defer func() {
+				if result.Error == "" {
+					recorder.SetEval(history.Eval{Dataset: opts.Dataset, Item: item.ID, Judge: opts.JudgeModel, Score: result.Score, Passed: result.Passed})
+				}
+				recorder.Finish(runErr)
+			}()
+		}
+	}
+
+	proc := processor.NewProcessor(&dslConfig, opts.EnvConfig, &config.ServerConfig{}, opts.Verbose, opts.RuntimeDir)
+	proc.DisableSpinner()
+	proc.SetStepRecorder(collector)
+	if opts.Resolver != nil {
+		proc.SetProviderResolver(opts.Resolver)
+	}
+	proc.SetVariantKey(item.ID)
+	for step, variant := range opts.Variants {
+		proc.SetVariant(step, variant)
+	}
+	if item.Input != "" {
+		proc.SetLastOutput(item.Input)
+	}
+	started := time.Now()
+	runErr = proc.Process()
+	result.LatencyMS = time.Since(started).Milliseconds()
+	for _, record := range collector.records {
+		if cost, ok := models.EstimateCost(record.Model, record.Metrics.PromptTokens, record.Metrics.CompletionTokens); ok {
+			result.Cost += cost
+		}
+		if record.Variant != "" {
+			if result.Variants == nil {
+				result.Variants = make(map[string]string)
+			}
+			result.Variants[record.Name] = record.Variant
+		}
+	}
+	if runErr != nil {
+		result.Error = runErr.Error()
+		return result
+	}
+
+	result.Output = proc.LastOutput()
+	if opts.Step != "" {
+		found := false
+		for _, record := range collector.records {
+			if record.Name == opts.Step && record.Err == nil {
+				result.Output, found = record.Response, true
+			}
+		}
+		if !found {
+			result.Error = fmt.Sprintf("step '%s' did not run", opts.Step)
+			return result
+		}
+	}
+
+	prompt := JudgePrompt(opts.Rubric, item, result.Output)
+	response, err := opts.Judge.SendPrompt(opts.JudgeModel, prompt)
+	if cost, ok := models.EstimateCost(opts.JudgeModel, processor.EstimateTokens(prompt), processor.EstimateTokens(response)); ok {
+		result.JudgeCost = cost
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("judge failed: %v", err)
+		return result
+	}
+	verdict, err := ParseVerdict(response)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Score, result.Reason = verdict.Score, verdict.Reason
+	result.Passed = verdict.Score >= opts.Threshold
+	return result
+}
+
+// Summary aggregates the results of an evaluation
+type Summary struct {
+	Items     int
+	Scored    int // Items the judge scored
+	Passed    int
+	Errors    int // Items whose workflow or judge failed
+	MeanScore float64
+	PassRate  float64       // Share of all items that passed, from 0 to 1
+	Latency   time.Duration // Average workflow latency
+	Cost      float64       // Total estimated cost of the workflow runs
+	JudgeCost float64       // Total estimated cost of judging
+}
+
+// Summarize aggregates item results
+func Summarize(results []ItemResult) Summary {
+	s := Summary{Items: len(results)}
+	var total float64
+	var latency int64
+	for _, r := range results {
+		latency += r.LatencyMS
+		s.Cost += r.Cost
+		s.JudgeCost += r.JudgeCost
+		if r.Error != "" {
+			s.Errors++
+			continue
+		}
+		s.Scored++
+		total += r.Score
+		if r.Passed {
+			s.Passed++
+		}
+	}
+	if s.Scored > 0 {
+		s.MeanScore = total / float64(s.Scored)
+	}
+	if s.Items > 0 {
+		s.PassRate = float64(s.Passed) / float64(s.Items)
+		s.Latency = time.Duration(latency/int64(s.Items)) * time.Millisecond
+	}
+	return s
+}
+
+// VariantSummary aggregates the items whose run used one prompt variant of
+// a step
+type VariantSummary struct {
+	Step    string
+	Variant string
+	Summary
+}
+
+// SummarizeVariants aggregates item results by the prompt variants their
+// steps used, sorted by step and variant
+func SummarizeVariants(results []ItemResult) []VariantSummary {
+	type key struct{ step, variant string }
+	groups := make(map[key][]ItemResult)
+	for _, r := range results {
+		for step, variant := range r.Variants {
+			k := key{step, variant}
+			groups[k] = append(groups[k], r)
+		}
+	}
+	summaries := make([]VariantSummary, 0, len(groups))
+	for k, group := range groups {
+		summaries = append(summaries, VariantSummary{Step: k.step, Variant: k.variant, Summary: Summarize(group)})
+	}
+	slices.SortFunc(summaries, func(a, b VariantSummary) int {
+		if a.Step != b.Step {
+			return strings.Compare(a.Step, b.Step)
+		}
+		return strings.Compare(a.Variant, b.Variant)
+	})
+	return summaries
+}
+
+// sortedKeys lists a map's keys in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
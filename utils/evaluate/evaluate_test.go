@@ -0,0 +1,255 @@
+package evaluate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// echoProvider answers with scripted replies, or else upper-cases the
+// attached file or the prompt
+type echoProvider struct {
+	replies []string // Replies in order, for a judge; empty to echo
+	prompts []string
+}
+
+func (e *echoProvider) Name() string                        { return "openai" }
+func (e *echoProvider) SupportsModel(modelName string) bool { return true }
+func (e *echoProvider) Configure(apiKey string) error       { return nil }
+func (e *echoProvider) SetVerbose(verbose bool)             {}
+
+func (e *echoProvider) SendPrompt(modelName, prompt string) (string, error) {
+	e.prompts = append(e.prompts, prompt)
+	if e.replies != nil {
+		if len(e.replies) == 0 {
+			return "", errors.New("no more replies")
+		}
+		reply := e.replies[0]
+		e.replies = e.replies[1:]
+		return reply, nil
+	}
+	return strings.ToUpper(prompt), nil
+}
+
+func (e *echoProvider) SendPromptWithFile(modelName, prompt string, file models.FileInput) (string, error) {
+	e.prompts = append(e.prompts, prompt)
+	data, err := os.ReadFile(file.Path)
+	return strings.ToUpper(string(data)), err
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const evalWorkflow = `params:
+  tone:
+    default: friendly
+reply:
+  input: STDIN
+  model: gpt-4o
+  action: Reply in a {{ params.tone }} tone
+  output: STDOUT
+`
+
+func TestLoadDataset(t *testing.T) {
+	path := writeFile(t, "data.jsonl", `{"id": "a", "input": "hello"}
+
+{"input": "bye", "params": {"tone": "formal"}, "expected": "Goodbye"}
+`)
+	items, err := LoadDataset(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[1].ID != "3" || items[1].Params["tone"] != "formal" || items[1].Expected != "Goodbye" {
+		t.Errorf("LoadDataset() = %+v", items)
+	}
+
+	dup := writeFile(t, "dup.jsonl", `{"id": "a"}`+"\n"+`{"id": "a"}`)
+	if _, err := LoadDataset(dup); err == nil || !strings.Contains(err.Error(), "more than one item with id 'a'") {
+		t.Errorf("LoadDataset(duplicate ids) error = %v", err)
+	}
+	bad := writeFile(t, "bad.jsonl", `{"id": "a"}`+"\nnot json")
+	if _, err := LoadDataset(bad); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("LoadDataset(bad line) error = %v", err)
+	}
+}
+
+func TestParseVerdict(t *testing.T) {
+	verdict, err := ParseVerdict("```json\n{\"score\": 4.5, \"reason\": \" Mostly right. \"}\n```")
+	if err != nil || verdict.Score != 4.5 || verdict.Reason != "Mostly right." {
+		t.Errorf("ParseVerdict() = %+v, %v", verdict, err)
+	}
+	for _, response := range []string{"Looks good to me", `{"score": 9}`, `{"score": "high"}`} {
+		if _, err := ParseVerdict(response); err == nil {
+			t.Errorf("ParseVerdict(%q) succeeded", response)
+		}
+	}
+}
+
+func TestJudgePrompt(t *testing.T) {
+	prompt := JudgePrompt("", Item{Input: "hi", Params: map[string]string{"tone": "formal", "lang": "en"}, Expected: "Hello"}, "HELLO\n")
+	for _, want := range []string{DefaultRubric, "<<<INPUT\nhi\nINPUT>>>", "- lang: en\n- tone: formal", "<<<REFERENCE\nHello\nREFERENCE>>>", "<<<OUTPUT\nHELLO\nOUTPUT>>>"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt doesn't contain %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	workflow := writeFile(t, "reply.yaml", evalWorkflow)
+	items := []Item{
+		{ID: "greeting", Input: "hello there"},
+		{ID: "formal", Input: "good evening", Params: map[string]string{"tone": "formal"}},
+		{ID: "unknown", Params: map[string]string{"colour": "red"}},
+		{ID: "vague", Input: "what now"},
+	}
+	worker := &echoProvider{}
+	judge := &echoProvider{replies: []string{
+		`{"score": 5, "reason": "Friendly."}`,
+		`{"score": 2, "reason": "Not formal."}`,
+		`I can't grade this`,
+	}}
+	var seen []string
+	results, err := Run(workflow, items, Options{
+		Judge: judge, JudgeModel: "gpt-4o", Rubric: "Matches the tone",
+		Resolver: func(string) models.Provider { return worker },
+		Progress: func(n, total int, item Item) { seen = append(seen, item.ID) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 4 || len(results) != 4 {
+		t.Fatalf("Run() = %+v, progress %v", results, seen)
+	}
+
+	if r := results[0]; !r.Passed || r.Score != 5 || r.Output != "HELLO THERE" || r.Error != "" {
+		t.Errorf("result 1 = %+v", r)
+	}
+	if !strings.Contains(worker.prompts[1], "formal tone") {
+		t.Errorf("second workflow prompt = %q, want the bound tone", worker.prompts[1])
+	}
+	if r := results[1]; r.Passed || r.Score != 2 || r.Reason != "Not formal." {
+		t.Errorf("result 2 = %+v", r)
+	}
+	if r := results[2]; r.Error == "" || !strings.Contains(r.Error, "colour") {
+		t.Errorf("result 3 = %+v, want an unknown parameter error", r)
+	}
+	if r := results[3]; r.Passed || !strings.Contains(r.Error, "no JSON verdict") {
+		t.Errorf("result 4 = %+v", r)
+	}
+	if len(judge.prompts) != 3 || !strings.Contains(judge.prompts[0], "<<<RUBRIC\nMatches the tone\nRUBRIC>>>") {
+		t.Errorf("judge prompts = %q", judge.prompts)
+	}
+
+	summary := Summarize(results)
+	if summary.Items != 4 || summary.Scored != 2 || summary.Passed != 1 || summary.Errors != 2 || summary.MeanScore != 3.5 || summary.PassRate != 0.25 {
+		t.Errorf("Summarize() = %+v", summary)
+	}
+}
+
+func TestRunStep(t *testing.T) {
+	workflow := writeFile(t, "reply.yaml", evalWorkflow+`
+title:
+  input: NA
+  model: gpt-4o
+  action: Give it a title
+  output: STDOUT
+`)
+	worker := &echoProvider{}
+	judge := &echoProvider{replies: []string{`{"score": 4, "reason": "Fine."}`}}
+	results, err := Run(workflow, []Item{{Input: "hello"}}, Options{
+		Judge: judge, JudgeModel: "gpt-4o", Step: "reply",
+		Resolver: func(string) models.Provider { return worker },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results[0]; !r.Passed || r.Output != "HELLO" {
+		t.Errorf("result = %+v, want the reply step's output judged", r)
+	}
+
+	results, _ = Run(workflow, []Item{{Input: "hello"}}, Options{
+		Judge: judge, JudgeModel: "gpt-4o", Step: "missing",
+		Resolver: func(string) models.Provider { return worker },
+	})
+	if r := results[0]; r.Error != "step 'missing' did not run" {
+		t.Errorf("result = %+v", r)
+	}
+}
+
+func TestRunVariants(t *testing.T) {
+	workflow := writeFile(t, "reply.yaml", `reply:
+  input: NA
+  model: gpt-4o
+  variants:
+    - name: short
+      action: Reply briefly
+    - name: long
+      action: Reply at length
+  output: STDOUT
+`)
+	var items []Item
+	var replies []string
+	for i := 0; i < 20; i++ {
+		items = append(items, Item{ID: strconv.Itoa(i)})
+		replies = append(replies, `{"score": 4, "reason": "Fine."}`)
+	}
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	results, err := Run(workflow, items, Options{
+		Judge: &echoProvider{replies: replies}, JudgeModel: "gpt-4o", Threshold: DefaultThreshold,
+		Store: store, Dataset: "support.jsonl",
+		Resolver: func(string) models.Provider { return &echoProvider{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"short": "REPLY BRIEFLY", "long": "REPLY AT LENGTH"}
+	for _, r := range results {
+		if r.Output != want[r.Variants["reply"]] {
+			t.Errorf("result %s = %+v, want the output of its variant", r.ID, r)
+		}
+	}
+
+	variants := SummarizeVariants(results)
+	if len(variants) != 2 || variants[0].Variant != "long" || variants[1].Variant != "short" || variants[0].Items+variants[1].Items != 20 {
+		t.Fatalf("SummarizeVariants() = %+v", variants)
+	}
+
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 20 {
+		t.Fatalf("recorded %d runs, want 20", len(runs))
+	}
+	for _, run := range runs {
+		if run.Eval == nil || run.Eval.Dataset != "support.jsonl" || run.Eval.Score != 4 || !run.Eval.Passed || run.Steps[0].Variant == "" {
+			t.Errorf("run = %+v, eval %+v", run, run.Eval)
+		}
+	}
+
+	results, _ = Run(workflow, items[:2], Options{
+		Judge: &echoProvider{replies: replies}, JudgeModel: "gpt-4o", Variants: map[string]string{"reply": "short"},
+		Resolver: func(string) models.Provider { return &echoProvider{} },
+	})
+	for _, r := range results {
+		if r.Variants["reply"] != "short" || r.Output != "REPLY BRIEFLY" {
+			t.Errorf("forced result = %+v", r)
+		}
+	}
+}
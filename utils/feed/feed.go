@@ -0,0 +1,306 @@
+// Package feed reads RSS and Atom feeds
+package feed
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/connectors"
+)
+
+// maxFeedSize caps the size of a feed that is read
+const maxFeedSize = 20 * 1024 * 1024
+
+var client = &http.Client{Timeout: 60 * time.Second}
+
+// Item is an entry of a feed
+type Item struct {
+	ID         string // The entry's guid or id, or its link when it has neither
+	Feed       string // Title of the feed
+	Title      string
+	Link       string
+	Author     string
+	Published  time.Time // Zero when the feed doesn't date its entries
+	Categories []string
+	Content    string // Full content when the feed has it, the summary otherwise, as markdown
+}
+
+// Render returns the item as markdown
+func (i Item) Render() string {
+	var b strings.Builder
+	title := i.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	if i.Feed != "" {
+		fmt.Fprintf(&b, "- Feed: %s\n", i.Feed)
+	}
+	if !i.Published.IsZero() {
+		fmt.Fprintf(&b, "- Published: %s\n", i.Published.Format("2006-01-02 15:04 MST"))
+	}
+	if i.Author != "" {
+		fmt.Fprintf(&b, "- Author: %s\n", i.Author)
+	}
+	if len(i.Categories) > 0 {
+		fmt.Fprintf(&b, "- Categories: %s\n", strings.Join(i.Categories, ", "))
+	}
+	if i.Link != "" {
+		fmt.Fprintf(&b, "- Link: %s\n", i.Link)
+	}
+	if content := strings.TrimSpace(i.Content); content != "" {
+		fmt.Fprintf(&b, "\n%s\n", content)
+	}
+	return b.String()
+}
+
+// Fetch reads a feed from a URL
+func Fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed URL %s: %w", url, err)
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	req.Header.Set("User-Agent", "comanda-feed")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching feed %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("error fetching feed %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching feed %s: %w", url, err)
+	}
+	if len(data) > maxFeedSize {
+		return nil, fmt.Errorf("feed %s is larger than %d MB", url, maxFeedSize/(1024*1024))
+	}
+	return data, nil
+}
+
+// rssItem is an item of an RSS 2.0 or RSS 1.0 feed
+type rssItem struct {
+	GUID           string   `xml:"guid"`
+	About          string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title          string   `xml:"title"`
+	Link           string   `xml:"link"`
+	Description    string   `xml:"description"`
+	ContentEncoded string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate        string   `xml:"pubDate"`
+	Date           string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author         string   `xml:"author"`
+	Creator        string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories     []string `xml:"category"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",innerxml"`
+}
+
+type atomEntry struct {
+	ID        string   `xml:"id"`
+	Title     atomText `xml:"title"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Summary   atomText `xml:"summary"`
+	Content   atomText `xml:"content"`
+	Links     []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+	Authors []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+// document holds the parts of RSS 2.0, RSS 1.0 and Atom feeds that are read
+type document struct {
+	XMLName xml.Name
+	Title   atomText `xml:"title"` // Atom
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"` // RSS 2.0
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"` // RSS 1.0
+	Entries []atomEntry `xml:"entry"`
+}
+
+// Parse reads an RSS or Atom feed, returning its items in the feed's order
+func Parse(data []byte) ([]Item, error) {
+	var doc document
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("not an RSS or Atom feed: %w", err)
+	}
+
+	var items []Item
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss", "rdf":
+		title := doc.Channel.Title
+		for _, it := range append(doc.Channel.Items, doc.Items...) {
+			item := Item{
+				ID:         strings.TrimSpace(it.GUID),
+				Feed:       strings.TrimSpace(title),
+				Title:      strings.TrimSpace(it.Title),
+				Link:       strings.TrimSpace(it.Link),
+				Author:     strings.TrimSpace(firstNonEmpty(it.Creator, it.Author)),
+				Published:  parseDate(firstNonEmpty(it.PubDate, it.Date)),
+				Categories: trimAll(it.Categories),
+				Content:    markdown(firstNonEmpty(it.ContentEncoded, it.Description), true),
+			}
+			if item.ID == "" {
+				item.ID = strings.TrimSpace(it.About)
+			}
+			items = append(items, item)
+		}
+	case "feed":
+		title := text(doc.Title)
+		for _, e := range doc.Entries {
+			item := Item{
+				ID:        strings.TrimSpace(e.ID),
+				Feed:      title,
+				Title:     text(e.Title),
+				Published: parseDate(firstNonEmpty(e.Published, e.Updated)),
+			}
+			for _, link := range e.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					item.Link = strings.TrimSpace(link.Href)
+					break
+				}
+			}
+			for _, a := range e.Authors {
+				if name := strings.TrimSpace(a.Name); name != "" {
+					item.Author = name
+					break
+				}
+			}
+			for _, c := range e.Categories {
+				if term := strings.TrimSpace(c.Term); term != "" {
+					item.Categories = append(item.Categories, term)
+				}
+			}
+			content := e.Content
+			if strings.TrimSpace(content.Body) == "" {
+				content = e.Summary
+			}
+			item.Content = markdown(unwrapCDATA(content.Body), content.Type != "text")
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("not an RSS or Atom feed: the root element is <%s>", doc.XMLName.Local)
+	}
+
+	for i := range items {
+		if items[i].ID == "" {
+			items[i].ID = items[i].Link
+		}
+		if items[i].ID == "" {
+			sum := sha256.Sum256([]byte(items[i].Title + "\x00" + items[i].Content))
+			items[i].ID = hex.EncodeToString(sum[:16])
+		}
+	}
+	return items, nil
+}
+
+// text returns an Atom text construct as plain text
+func text(t atomText) string {
+	body := unwrapCDATA(t.Body)
+	if t.Type == "html" || t.Type == "xhtml" || strings.Contains(body, "&lt;") {
+		return strings.TrimSpace(markdown(body, true))
+	}
+	return strings.TrimSpace(unescape(body))
+}
+
+// markdown converts an entry's content to markdown. Atom content is kept
+// as raw XML, so its escaped HTML is unescaped first.
+func markdown(content string, isHTML bool) string {
+	content = strings.TrimSpace(content)
+	if strings.Contains(content, "&lt;") {
+		content = unescape(content)
+	}
+	if !isHTML || !strings.Contains(content, "<") {
+		return unescape(content)
+	}
+	md, err := connectors.HTMLToMarkdown(content)
+	if err != nil {
+		return content
+	}
+	return strings.TrimSpace(md)
+}
+
+// unescape decodes the XML entities of raw XML text
+func unescape(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	var out string
+	dec := xml.NewDecoder(strings.NewReader("<x>" + s + "</x>"))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	if err := dec.Decode(&out); err != nil {
+		return s
+	}
+	return out
+}
+
+func unwrapCDATA(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "<![CDATA[") && strings.HasSuffix(s, "]]>") {
+		return s[len("<![CDATA[") : len(s)-len("]]>")]
+	}
+	return s
+}
+
+// dateLayouts are the date formats feeds use, RFC 822 ones with and without
+// the day name, with numeric zones and zone names
+var dateLayouts = []string{
+	time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700", "2 Jan 2006 15:04:05 MST", "Mon, 2 Jan 2006 15:04 -0700", "Mon, 02 Jan 2006 15:04:05 Z",
+	time.RFC3339, time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02",
+}
+
+// parseDate reads a feed date, the zero time when it can't
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func trimAll(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
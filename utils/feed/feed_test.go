@@ -0,0 +1,86 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+)
+
+const rss = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+  <title>Platform Blog</title>
+  <item>
+    <title>Kubernetes 1.33 &amp; you</title>
+    <link>https://blog.example.com/k8s-133</link>
+    <guid isPermaLink="false">post-133</guid>
+    <pubDate>Tue, 03 Jun 2025 09:00:00 GMT</pubDate>
+    <dc:creator>Ana Silva</dc:creator>
+    <category>kubernetes</category>
+    <description>Short summary</description>
+    <content:encoded><![CDATA[<p>The <strong>full</strong> post.</p>]]></content:encoded>
+  </item>
+  <item>
+    <title>No guid</title>
+    <link>https://blog.example.com/no-guid</link>
+    <description>&lt;p&gt;Escaped &lt;em&gt;HTML&lt;/em&gt;&lt;/p&gt;</description>
+  </item>
+</channel>
+</rss>`
+
+const atom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type="text">Release notes</title>
+  <entry>
+    <id>tag:example.com,2025:v2</id>
+    <title>v2.0 released</title>
+    <link rel="alternate" href="https://example.com/v2"/>
+    <link rel="replies" href="https://example.com/v2#comments"/>
+    <updated>2025-06-02T10:00:00Z</updated>
+    <author><name>Bo</name></author>
+    <category term="release"/>
+    <summary>Summary only</summary>
+    <content type="html">&lt;ul&gt;&lt;li&gt;Faster&lt;/li&gt;&lt;/ul&gt;</content>
+  </entry>
+</feed>`
+
+func TestParseRSS(t *testing.T) {
+	items, err := Parse([]byte(rss))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	first := items[0]
+	if first.ID != "post-133" || first.Title != "Kubernetes 1.33 & you" || first.Author != "Ana Silva" || first.Feed != "Platform Blog" ||
+		first.Published.Format("2006-01-02") != "2025-06-03" || first.Content != "The **full** post." {
+		t.Errorf("first item = %+v", first)
+	}
+	if items[1].ID != "https://blog.example.com/no-guid" || items[1].Content != "Escaped *HTML*" {
+		t.Errorf("second item = %+v", items[1])
+	}
+	rendered := first.Render()
+	for _, want := range []string{"# Kubernetes 1.33 & you", "- Categories: kubernetes", "- Link: https://blog.example.com/k8s-133"} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("Render() = %s, want %q", rendered, want)
+		}
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	items, err := Parse([]byte(atom))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	e := items[0]
+	if e.ID != "tag:example.com,2025:v2" || e.Feed != "Release notes" || e.Link != "https://example.com/v2" || e.Author != "Bo" ||
+		e.Published.IsZero() || !strings.Contains(e.Content, "Faster") || strings.Contains(e.Content, "<li>") {
+		t.Errorf("entry = %+v", e)
+	}
+	if _, err := Parse([]byte("<html><body>Not found</body></html>")); err == nil {
+		t.Error("Parse accepted an HTML page")
+	}
+}
@@ -2,7 +2,10 @@ package fileutil
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -10,15 +13,36 @@ const (
 	MaxFileSize = 100 * 1024 * 1024
 )
 
+// SizeLimitError reports an input larger than the size allowed for it
+type SizeLimitError struct {
+	Path  string // File that was rejected
+	Size  int64  // Size of the file
+	Total int64  // Size of the step's inputs with this file, if more than Size
+	Limit int64  // Size allowed
+}
+
+func (e *SizeLimitError) Error() string {
+	if e.Total > e.Size {
+		return fmt.Sprintf("input %s (%s) brings the step's inputs to %s, over the limit of %s",
+			e.Path, FormatSize(e.Size), FormatSize(e.Total), FormatSize(e.Limit))
+	}
+	return fmt.Sprintf("input %s is %s, over the limit of %s", e.Path, FormatSize(e.Size), FormatSize(e.Limit))
+}
+
 // CheckFileSize verifies if a file is within acceptable size limits
 func CheckFileSize(path string) error {
+	return CheckFileSizeLimit(path, MaxFileSize)
+}
+
+// CheckFileSizeLimit verifies that a file is at most limit bytes
+func CheckFileSizeLimit(path string, limit int64) error {
 	info, err := os.Stat(path)
 	if err != nil {
 		return fmt.Errorf("error checking file size: %w", err)
 	}
 
-	if info.Size() > MaxFileSize {
-		return fmt.Errorf("file size %d bytes exceeds maximum allowed size of %d bytes", info.Size(), MaxFileSize)
+	if info.Size() > limit {
+		return &SizeLimitError{Path: path, Size: info.Size(), Limit: limit}
 	}
 
 	return nil
@@ -26,7 +50,12 @@ func CheckFileSize(path string) error {
 
 // SafeReadFile reads a file after checking its size
 func SafeReadFile(path string) ([]byte, error) {
-	if err := CheckFileSize(path); err != nil {
+	return ReadFileLimit(path, MaxFileSize)
+}
+
+// ReadFileLimit reads a file after checking it is at most limit bytes
+func ReadFileLimit(path string, limit int64) ([]byte, error) {
+	if err := CheckFileSizeLimit(path, limit); err != nil {
 		return nil, err
 	}
 
@@ -49,3 +78,81 @@ func SafeOpenFile(path string) (*os.File, error) {
 	}
 	return file, nil
 }
+
+// Spill reads r, keeping up to memLimit bytes in memory. Longer content is
+// written to a temporary file in dir named after pattern instead, and its
+// path returned with no data, so input of any size can be read without
+// running out of memory.
+func Spill(r io.Reader, memLimit int64, dir, pattern string) (data []byte, path string, err error) {
+	data, err = io.ReadAll(io.LimitReader(r, memLimit+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) <= memLimit {
+		return data, "", nil
+	}
+
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating temp file: %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, "", fmt.Errorf("error writing temp file: %w", err)
+	}
+	return nil, file.Name(), nil
+}
+
+// FormatSize formats a size such as 512 B, 1.5 KB or 2.3 GB
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// sizeUnits are the units ParseSize accepts, in powers of 1024
+var sizeUnits = map[string]int64{
+	"":   1,
+	"b":  1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+	"t":  1 << 40,
+	"tb": 1 << 40,
+}
+
+// ParseSize parses a size such as 4096, 512KB, 100MB or 1.5GB. Units are
+// powers of 1024 and case-insensitive.
+func ParseSize(s string) (int64, error) {
+	trimmed := strings.ToLower(strings.TrimSpace(s))
+	i := strings.IndexFunc(trimmed, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(trimmed)
+	}
+	number, unit := trimmed[:i], strings.TrimSpace(trimmed[i:])
+	multiplier, ok := sizeUnits[unit]
+	value, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size '%s': use a number of bytes or a size such as 512KB, 100MB or 2GB", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
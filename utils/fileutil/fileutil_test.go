@@ -0,0 +1,67 @@
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"4096":  4096,
+		"512KB": 512 << 10,
+		"100mb": 100 << 20,
+		"1.5G":  3 << 29,
+		" 2 GB": 2 << 30,
+	}
+	for in, want := range tests {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0", "-1MB", "10 parsecs", "MB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestSpill(t *testing.T) {
+	dir := t.TempDir()
+
+	data, path, err := Spill(strings.NewReader("small"), 8, dir, "spill-*.txt")
+	if err != nil || string(data) != "small" || path != "" {
+		t.Errorf("Spill() of small input = %q, %q, %v, want it in memory", data, path, err)
+	}
+
+	large := strings.Repeat("x", 20)
+	data, path, err = Spill(strings.NewReader(large), 8, dir, "spill-*.txt")
+	if err != nil || data != nil || path == "" {
+		t.Fatalf("Spill() of large input = %q, %q, %v, want a file", data, path, err)
+	}
+	if contents, _ := os.ReadFile(path); string(contents) != large {
+		t.Errorf("spilled file holds %q, want %q", contents, large)
+	}
+}
+
+func TestReadFileLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ReadFileLimit(path, 1024)
+	var sizeErr *SizeLimitError
+	if !errors.As(err, &sizeErr) || sizeErr.Size != 2048 || sizeErr.Limit != 1024 {
+		t.Fatalf("ReadFileLimit() error = %v, want a SizeLimitError", err)
+	}
+	if want := "input " + path + " is 2.0 KB, over the limit of 1.0 KB"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+	if data, err := ReadFileLimit(path, 4096); err != nil || len(data) != 2048 {
+		t.Errorf("ReadFileLimit() within the limit = %d bytes, %v", len(data), err)
+	}
+}
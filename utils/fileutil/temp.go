@@ -0,0 +1,65 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TempPatterns match the temporary files and directories comanda creates
+// in the system temp directory. They are normally removed when a run ends,
+// but are left behind when a run crashes or is killed.
+var TempPatterns = []string{
+	"comanda-chunks-*", // Chunked input files
+	"comanda-db-*",     // Database query results
+	"comanda-stdin-*",  // Piped input
+	"comanda-url-*",    // Downloaded URL content
+	"comanda-debug-*",  // Debugger step outputs
+}
+
+// TempFile is a leftover temporary file or directory
+type TempFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// FindTempFiles returns comanda's temporary files and directories in dir
+// last modified before cutoff
+func FindTempFiles(dir string, cutoff time.Time) ([]TempFile, error) {
+	var files []TempFile
+	for _, pattern := range TempPatterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("error listing temp files: %w", err)
+		}
+		for _, path := range matches {
+			info, err := os.Lstat(path)
+			if err != nil {
+				continue
+			}
+			file := TempFile{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+			if info.IsDir() {
+				// A directory is in use while anything in it is recent
+				file.Size = 0
+				filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+					if err != nil {
+						return nil
+					}
+					if fi.ModTime().After(file.ModTime) {
+						file.ModTime = fi.ModTime()
+					}
+					if !fi.IsDir() {
+						file.Size += fi.Size()
+					}
+					return nil
+				})
+			}
+			if file.ModTime.Before(cutoff) {
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,42 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	write := func(name string, size int, mtime time.Time) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	write("comanda-chunks-1/chunk_0.txt", 100, old)
+	write("comanda-chunks-1/chunk_1.txt", 50, old)
+	os.Chtimes(filepath.Join(dir, "comanda-chunks-1"), old, old)
+	write("comanda-chunks-2/chunk_0.txt", 10, time.Now()) // Still in use
+	os.Chtimes(filepath.Join(dir, "comanda-chunks-2"), old, old)
+	write("comanda-stdin-3.txt", 7, old)
+	write("comanda-url-4.html", 3, time.Now())
+	write("other-tool-5.txt", 1, old)
+
+	files, err := FindTempFiles(dir, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int64)
+	for _, f := range files {
+		got[filepath.Base(f.Path)] = f.Size
+	}
+	if len(got) != 2 || got["comanda-chunks-1"] != 150 || got["comanda-stdin-3.txt"] != 7 {
+		t.Errorf("FindTempFiles() = %v", got)
+	}
+}
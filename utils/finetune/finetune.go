@@ -0,0 +1,184 @@
+// Package finetune turns the prompts and responses of recorded runs into
+// fine-tuning data, and tracks the fine-tuning jobs started from it until
+// their models can be registered for workflows to use.
+//
+// Training data is JSONL in OpenAI's chat format, one conversation of a
+// user prompt and the assistant's response per line, optionally preceded
+// by a system message. Providers that take another format get the same
+// examples converted.
+package finetune
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Options select the prompts of recorded runs that become examples
+type Options struct {
+	Step     string  // Only prompts of this step; any step when empty
+	MinScore float64 // Only runs comanda eval scored at least this; any run when 0
+	System   string  // System message added to every example
+}
+
+// Stats counts the prompts Collect looked at and why it left some out
+type Stats struct {
+	Runs         int // Runs with at least one matching step
+	Prompts      int // Prompts of matching steps
+	Failed       int // Prompts that got an error or no response
+	Unscored     int // Prompts of runs below MinScore or never scored
+	MissingFiles int // Prompts whose attached file is gone and wasn't kept
+	Duplicates   int // Prompts sent again, which keep only their latest response
+}
+
+// Collect returns an example for each distinct prompt that the selected
+// steps of successful runs sent and got a response to. Runs are most recent
+// first, as Store.List returns them, so a prompt sent more than once keeps
+// its latest response.
+func Collect(runs []history.Run, opts Options) ([]models.TuningExample, Stats, error) {
+	var stats Stats
+	var examples []models.TuningExample
+	seen := make(map[string]bool)
+	for _, run := range runs {
+		if run.Status != history.StatusSucceeded {
+			continue
+		}
+		matched := false
+		for _, step := range run.Steps {
+			if step.Status != history.StatusSucceeded || (opts.Step != "" && step.Name != opts.Step) {
+				continue
+			}
+			prompts, err := step.Prompts()
+			if err != nil {
+				return nil, stats, fmt.Errorf("error reading run %s: %w", run.ID, err)
+			}
+			if len(prompts) > 0 {
+				matched = true
+			}
+			for _, prompt := range prompts {
+				stats.Prompts++
+				text, ok := promptText(prompt)
+				switch {
+				case prompt.Error != "" || strings.TrimSpace(prompt.Response) == "":
+					stats.Failed++
+				case opts.MinScore > 0 && (run.Eval == nil || run.Eval.Score < opts.MinScore):
+					stats.Unscored++
+				case !ok:
+					stats.MissingFiles++
+				default:
+					example := models.TuningExample{System: opts.System, Prompt: text, Response: prompt.Response}
+					if seen[text] {
+						stats.Duplicates++
+						continue
+					}
+					seen[text] = true
+					examples = append(examples, example)
+				}
+			}
+		}
+		if matched {
+			stats.Runs++
+		}
+	}
+	return examples, stats, nil
+}
+
+// promptText returns the prompt as the model received it. A text file
+// attached to the prompt is included the way the OpenAI provider sends
+// one; prompts with other attachments can't be rebuilt.
+func promptText(prompt processor.PromptRecord) (string, bool) {
+	if prompt.File == "" {
+		return prompt.Prompt, true
+	}
+	text := prompt.FileText
+	if text == "" {
+		data, err := os.ReadFile(prompt.File)
+		if err != nil || !utf8.Valid(data) {
+			return "", false
+		}
+		text = string(data)
+	}
+	return fmt.Sprintf("File content:\n%s\n\nUser prompt: %s", text, prompt.Prompt), true
+}
+
+// message is one message of a chat example
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// WriteJSONL writes examples in the chat format, one per line
+func WriteJSONL(w io.Writer, examples []models.TuningExample) error {
+	enc := json.NewEncoder(w)
+	for _, ex := range examples {
+		var messages []message
+		if ex.System != "" {
+			messages = append(messages, message{"system", ex.System})
+		}
+		messages = append(messages, message{"user", ex.Prompt}, message{"assistant", ex.Response})
+		if err := enc.Encode(map[string][]message{"messages": messages}); err != nil {
+			return fmt.Errorf("error writing examples: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadJSONL reads examples in the chat format. Each line must hold one
+// user message followed by one assistant message, after an optional
+// system message.
+func ReadJSONL(path string) ([]models.TuningExample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening training data: %w", err)
+	}
+	defer f.Close()
+
+	var examples []models.TuningExample
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var conversation struct {
+			Messages []message `json:"messages"`
+		}
+		if err := json.Unmarshal([]byte(line), &conversation); err != nil {
+			return nil, fmt.Errorf("error parsing %s line %d: %w", path, n, err)
+		}
+		var ex models.TuningExample
+		roles := make([]string, len(conversation.Messages))
+		for i, m := range conversation.Messages {
+			roles[i] = m.Role
+			switch m.Role {
+			case "system":
+				ex.System = m.Content
+			case "user":
+				ex.Prompt = m.Content
+			case "assistant":
+				ex.Response = m.Content
+			}
+		}
+		shape := strings.Join(roles, ",")
+		if shape != "user,assistant" && shape != "system,user,assistant" {
+			return nil, fmt.Errorf("%s line %d: want a user message and an assistant message, optionally after a system message, got [%s]", path, n, shape)
+		}
+		examples = append(examples, ex)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading training data: %w", err)
+	}
+	if len(examples) == 0 {
+		return nil, fmt.Errorf("%s has no examples", path)
+	}
+	return examples, nil
+}
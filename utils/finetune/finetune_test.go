@@ -0,0 +1,170 @@
+package finetune
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// recordRun records a run of one reply step that sent prompts, with a judge
+// score when score is above 0
+func recordRun(t *testing.T, store *history.Store, score float64, prompts ...processor.PromptRecord) {
+	t.Helper()
+	recorder, err := store.Start("/work/reply.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.RecordStep(processor.StepRecord{Name: "reply", Model: "gpt-4o-mini", Response: "ok", Prompts: prompts})
+	recorder.RecordStep(processor.StepRecord{Name: "title", Model: "gpt-4o-mini", Response: "ok",
+		Prompts: []processor.PromptRecord{{Model: "gpt-4o-mini", Prompt: "Title it", Response: "Refunds"}}})
+	if score > 0 {
+		recorder.SetEval(history.Eval{Item: "x", Score: score, Passed: score >= 4})
+	}
+	if err := recorder.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond) // Keep the runs' start times apart
+}
+
+func TestCollect(t *testing.T) {
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	recordRun(t, store, 5,
+		processor.PromptRecord{Prompt: "Reply to: where is my order?", Response: "It ships today."},
+		processor.PromptRecord{Prompt: "Reply", File: "/tmp/gone-stdin.txt", FileText: "I was charged twice", Response: "Sorry, refunded."},
+		processor.PromptRecord{Prompt: "Reply", File: "/tmp/gone-scan.png", Response: "A receipt."},
+		processor.PromptRecord{Prompt: "Reply to: hi", Error: "rate limited"})
+	recordRun(t, store, 2, processor.PromptRecord{Prompt: "Reply to: cancel", Response: "Done."})
+	recordRun(t, store, 0, processor.PromptRecord{Prompt: "Reply to: where is my order?", Response: "It ships tomorrow."})
+
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples, stats, err := Collect(runs, Options{Step: "reply", System: "You are support."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) != 3 || stats.Runs != 3 || stats.Prompts != 6 || stats.Failed != 1 || stats.MissingFiles != 1 || stats.Duplicates != 1 {
+		t.Fatalf("Collect() = %+v, stats %+v", examples, stats)
+	}
+	if examples[0].Prompt != "Reply to: where is my order?" || examples[0].Response != "It ships tomorrow." || examples[0].System != "You are support." {
+		t.Errorf("example 1 = %+v, want the latest response", examples[0])
+	}
+	if examples[2].Prompt != "File content:\nI was charged twice\n\nUser prompt: Reply" {
+		t.Errorf("example 3 prompt = %q, want the kept STDIN text", examples[2].Prompt)
+	}
+
+	examples, stats, _ = Collect(runs, Options{Step: "reply", MinScore: 4})
+	if len(examples) != 2 || stats.Unscored != 2 {
+		t.Errorf("Collect(min score 4) = %+v, stats %+v", examples, stats)
+	}
+	examples, _, _ = Collect(runs, Options{})
+	if len(examples) != 4 {
+		t.Errorf("Collect(every step) = %d examples, want the title prompt once more", len(examples))
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	examples := []models.TuningExample{
+		{System: "Be brief.", Prompt: "Hi", Response: "Hello"},
+		{Prompt: "Bye\nnow", Response: "Goodbye"},
+	}
+	var buf bytes.Buffer
+	if err := WriteJSONL(&buf, examples); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "train.jsonl")
+	os.WriteFile(path, buf.Bytes(), 0644)
+	read, err := ReadJSONL(path)
+	if err != nil || len(read) != 2 || read[0] != examples[0] || read[1] != examples[1] {
+		t.Errorf("ReadJSONL() = %+v, %v", read, err)
+	}
+
+	os.WriteFile(path, []byte(`{"messages": [{"role": "user", "content": "Hi"}]}`+"\n"), 0644)
+	if _, err := ReadJSONL(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("ReadJSONL(no assistant message) error = %v", err)
+	}
+}
+
+// fakeTuner reports the statuses in order
+type fakeTuner struct {
+	statuses []models.TuningJob
+}
+
+func (f *fakeTuner) StartTuning(req models.TuningRequest) (models.TuningJob, error) {
+	return models.TuningJob{ID: "ftjob-abc123", Status: models.TuningPending}, nil
+}
+
+func (f *fakeTuner) TuningStatus(jobID string) (models.TuningJob, error) {
+	if len(f.statuses) == 0 {
+		return models.TuningJob{}, errors.New("no more statuses")
+	}
+	status := f.statuses[0]
+	f.statuses = f.statuses[1:]
+	return status, nil
+}
+
+func TestJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	for _, id := range []string{"ftjob-abc123", "tunedModels/support-x1"} {
+		if err := Save(path, Job{ID: id, Provider: "openai", BaseModel: "gpt-4o-mini-2024-07-18", Status: models.TuningPending, Alias: "support-bot"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs, err := Load(path)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("Load() = %+v, %v", jobs, err)
+	}
+	if job, err := Find(jobs, "last"); err != nil || job.ID != "tunedModels/support-x1" {
+		t.Errorf("Find(last) = %+v, %v", job, err)
+	}
+	if _, err := Find(jobs, "x9"); err == nil {
+		t.Error("Find(x9) found a job")
+	}
+
+	job, _ := Find(jobs, "abc123")
+	tuner := &fakeTuner{statuses: []models.TuningJob{
+		{Status: models.TuningRunning},
+		{Status: models.TuningRunning},
+		{Status: models.TuningSucceeded, Model: "ft:gpt-4o-mini-2024-07-18:acme::abc123"},
+	}}
+	var updates []string
+	job, err = Wait(context.Background(), tuner, job, time.Millisecond, func(j Job) { updates = append(updates, j.Status) })
+	if err != nil || job.Model != "ft:gpt-4o-mini-2024-07-18:acme::abc123" || strings.Join(updates, ",") != "running,succeeded" {
+		t.Errorf("Wait() = %+v, %v, updates %v", job, err, updates)
+	}
+
+	env := &config.EnvConfig{Providers: map[string]*config.Provider{"openai": {APIKey: "key", Models: []config.Model{
+		{Name: "gpt-4o-mini-2024-07-18", Type: "external", Modes: []config.ModelMode{config.TextMode, config.FileMode}},
+	}}}}
+	if err := Register(env, job); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(env, job); err != nil {
+		t.Fatalf("Register() again: %v", err)
+	}
+	model, err := env.GetModelConfig("openai", job.Model)
+	if err != nil || !model.HasMode(config.FileMode) || len(env.Providers["openai"].Models) != 2 {
+		t.Errorf("registered model = %+v, %v", model, err)
+	}
+	if env.ResolveModel("support-bot") != job.Model {
+		t.Errorf("alias support-bot = %s", env.ResolveModel("support-bot"))
+	}
+	if err := Register(env, Job{ID: "ftjob-x", Provider: "openai", Status: models.TuningRunning}); err == nil {
+		t.Error("Register() of a running job succeeded")
+	}
+}
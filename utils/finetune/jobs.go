@@ -0,0 +1,178 @@
+package finetune
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// Job is a fine-tuning job started with comanda, kept so its status can be
+// checked and its model registered once it is ready
+type Job struct {
+	ID           string    `json:"id"`
+	Provider     string    `json:"provider"`
+	BaseModel    string    `json:"base_model"`
+	TrainingFile string    `json:"training_file"`
+	Examples     int       `json:"examples"`
+	Alias        string    `json:"alias,omitempty"` // Alias the tuned model is registered under
+	Status       string    `json:"status"`
+	Model        string    `json:"model,omitempty"` // The tuned model, once the job has succeeded
+	Error        string    `json:"error,omitempty"`
+	Registered   bool      `json:"registered,omitempty"` // The tuned model was added to the env config
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+}
+
+// Done reports whether the job has stopped, successfully or not
+func (j Job) Done() bool {
+	return models.TuningJob{Status: j.Status}.Done()
+}
+
+// DefaultPath returns the jobs file: finetune-jobs.json in the data
+// directory
+func DefaultPath() string {
+	return filepath.Join(config.DataDir(), "finetune-jobs.json")
+}
+
+// Load reads the jobs in a jobs file, most recent first; a missing file
+// has no jobs
+func Load(path string) ([]Job, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading jobs file: %w", err)
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("error parsing jobs file %s: %w", path, err)
+	}
+	return jobs, nil
+}
+
+// Save adds a job to the jobs file, or replaces the job with its ID
+func Save(path string, job Job) error {
+	jobs, err := Load(path)
+	if err != nil {
+		return err
+	}
+	job.Updated = time.Now()
+	replaced := false
+	for i := range jobs {
+		if jobs[i].ID == job.ID {
+			jobs[i], replaced = job, true
+		}
+	}
+	if !replaced {
+		jobs = append([]Job{job}, jobs...)
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding jobs: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+	return config.WriteFileAtomic(path, append(data, '\n'))
+}
+
+// Find returns the job whose ID is id or ends with it, so the short form
+// of a long provider ID can be used. "last" returns the most recent job.
+func Find(jobs []Job, id string) (Job, error) {
+	if id == "last" && len(jobs) > 0 {
+		return jobs[0], nil
+	}
+	var matches []Job
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+		if strings.HasSuffix(job.ID, id) {
+			matches = append(matches, job)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Job{}, fmt.Errorf("no fine-tuning job '%s'", id)
+	case 1:
+		return matches[0], nil
+	}
+	return Job{}, fmt.Errorf("'%s' matches %d fine-tuning jobs; use more of the ID", id, len(matches))
+}
+
+// Refresh asks the provider for the job's status
+func Refresh(tuner models.Tuner, job Job) (Job, error) {
+	state, err := tuner.TuningStatus(job.ID)
+	if err != nil {
+		return job, err
+	}
+	job.Status, job.Error = state.Status, state.Error
+	if state.Model != "" {
+		job.Model = state.Model
+	}
+	return job, nil
+}
+
+// Wait refreshes the job every interval until it is done or ctx is,
+// calling update with each change of status
+func Wait(ctx context.Context, tuner models.Tuner, job Job, interval time.Duration, update func(Job)) (Job, error) {
+	for {
+		status := job.Status
+		var err error
+		if job, err = Refresh(tuner, job); err != nil {
+			return job, err
+		}
+		if job.Status != status && update != nil {
+			update(job)
+		}
+		if job.Done() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Register enables a succeeded job's model in the env config, with the
+// modes of its base model when that is enabled and text otherwise, and
+// points the job's alias at it. The caller saves the env config.
+func Register(env *config.EnvConfig, job Job) error {
+	if job.Status != models.TuningSucceeded || job.Model == "" {
+		return fmt.Errorf("job %s has no tuned model yet (status %s)", job.ID, job.Status)
+	}
+	provider, err := env.GetProviderConfig(job.Provider)
+	if err != nil {
+		return fmt.Errorf("error registering %s: %w", job.Model, err)
+	}
+	modes := []config.ModelMode{config.TextMode}
+	registered := false
+	for _, m := range provider.Models {
+		switch m.Name {
+		case job.Model:
+			registered = true
+		case job.BaseModel:
+			modes = m.Modes
+		}
+	}
+	if !registered {
+		model := config.Model{Name: job.Model, Type: "external", Modes: modes}
+		if err := env.AddModelToProvider(job.Provider, model); err != nil {
+			return fmt.Errorf("error registering %s: %w", job.Model, err)
+		}
+	}
+	if job.Alias != "" {
+		return env.SetModelAlias(job.Alias, job.Model)
+	}
+	return nil
+}
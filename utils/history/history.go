@@ -0,0 +1,634 @@
+// Package history stores metadata and step outputs of past workflow runs.
+//
+// By default run records are kept in a SQLite database, history.db in the
+// store directory, saved once when the run starts and again when it
+// finishes. A store opened with OpenPostgres keeps them in a Postgres table
+// instead, so several machines can share them. Builds without cgo, which
+// can't use SQLite, append them to runs.jsonl, where the latest line for a
+// run ID wins. Step outputs are saved as files under runs/<id>/ either way.
+// The server's schedules are kept in the same place as run records: a
+// second table, or schedules.json.
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Run statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// ErrNotFound is returned when no run matches an ID
+var ErrNotFound = errors.New("run not found")
+
+// ErrCanceled is wrapped by the errors of runs that were cancelled, which
+// Finish records as canceled rather than failed
+var ErrCanceled = errors.New("run canceled")
+
+// Step is the record of one step of a run
+type Step struct {
+	Name             string    `json:"name"`
+	Model            string    `json:"model,omitempty"`
+	Provider         string    `json:"provider,omitempty"`
+	Status           string    `json:"status"`
+	Error            string    `json:"error,omitempty"`
+	Started          time.Time `json:"started"`
+	Finished         time.Time `json:"finished"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	Retries          int       `json:"retries,omitempty"`    // Provider calls retried while the step ran
+	CacheHits        int       `json:"cache_hits,omitempty"` // Unchanged inputs skipped in changed-only mode and prompts answered from the response cache
+	Cost             float64   `json:"cost,omitempty"`
+	Outputs          []string  `json:"outputs,omitempty"`     // Where the step wrote its response
+	OutputFile       string    `json:"output_file,omitempty"` // Copy of the response in the store
+	PromptFile       string    `json:"prompt_file,omitempty"` // The prompts the step sent, for comanda replay
+	Variant          string    `json:"variant,omitempty"`     // Prompt variant the step used
+}
+
+// Run is the record of one workflow run
+type Run struct {
+	ID         string    `json:"id"`
+	Workflow   string    `json:"workflow"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished,omitempty"`
+	Steps      []Step    `json:"steps,omitempty"`
+	OutputFile string    `json:"output_file,omitempty"` // Copy of the final output, for runs that save it
+	ReplayOf   string    `json:"replay_of,omitempty"`   // Run whose prompts this run sent again, for replays
+	Eval       *Eval     `json:"eval,omitempty"`        // Judge's score, for runs made by comanda eval
+}
+
+// Eval is the judge's score of a run made for a dataset item by comanda eval
+type Eval struct {
+	Dataset string  `json:"dataset"`
+	Item    string  `json:"item"`
+	Judge   string  `json:"judge"` // Model that scored the output
+	Score   float64 `json:"score,omitempty"`
+	Passed  bool    `json:"passed"`
+}
+
+// Cost returns the estimated cost of all steps in US dollars
+func (r *Run) Cost() float64 {
+	var total float64
+	for _, s := range r.Steps {
+		total += s.Cost
+	}
+	return total
+}
+
+// Tokens returns the estimated prompt and completion tokens of all steps
+func (r *Run) Tokens() (prompt, completion int) {
+	for _, s := range r.Steps {
+		prompt += s.PromptTokens
+		completion += s.CompletionTokens
+	}
+	return prompt, completion
+}
+
+// Outputs returns every output location written by the run
+func (r *Run) Outputs() []string {
+	var outputs []string
+	for _, s := range r.Steps {
+		outputs = append(outputs, s.Outputs...)
+	}
+	return outputs
+}
+
+// Step returns the step with the given name
+func (r *Run) Step(name string) (*Step, bool) {
+	for i := range r.Steps {
+		if r.Steps[i].Name == name {
+			return &r.Steps[i], true
+		}
+	}
+	return nil, false
+}
+
+// Store is a directory of step outputs and artifacts, with the run records
+// kept in the directory or a database
+type Store struct {
+	dir     string
+	mu      sync.Mutex
+	records records
+}
+
+// DefaultDir returns the history directory: COMANDA_HISTORY_DIR if set,
+// otherwise history in the data directory, moved there from ~/.comanda
+// the first time
+func DefaultDir() string {
+	if dir := os.Getenv("COMANDA_HISTORY_DIR"); dir != "" {
+		return dir
+	}
+	return config.MigrateLegacy("history", filepath.Join(config.DataDir(), "history"))
+}
+
+// Open returns the store in dir, creating the directory if needed, with
+// run records and schedules in its history.db SQLite database. When no
+// database can be created there, such as in a build without cgo, they are
+// kept in runs.jsonl and schedules.json instead.
+func Open(dir string) (*Store, error) {
+	store, err := openDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	_, statErr := os.Stat(filepath.Join(dir, "history.db"))
+	records, err := openSQLite(dir)
+	switch {
+	case err == nil:
+		store.records = records
+	case os.IsNotExist(statErr):
+		config.DebugLog("Keeping run history in runs.jsonl: %v", err)
+		store.records = &fileRecords{path: filepath.Join(dir, "runs.jsonl")}
+	default:
+		return nil, err
+	}
+	return store, nil
+}
+
+// openDir returns a store in dir without run records, creating the
+// directory if needed
+func openDir(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory %s: %w", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Close releases the store's database connection, if it has one
+func (s *Store) Close() error {
+	return s.records.close()
+}
+
+// Dir returns the store's directory
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Backend names where the store keeps run records: sqlite, postgres or
+// files, for runs.jsonl
+func (s *Store) Backend() string {
+	switch s.records.(type) {
+	case *sqliteRecords:
+		return "sqlite"
+	case *postgresRecords:
+		return "postgres"
+	}
+	return "files"
+}
+
+// NewRunID returns a sortable, unique run ID such as 20250102-150405-3fa2
+func NewRunID(now time.Time) string {
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// Save records the current state of a run, with secrets redacted from its
+// errors
+func (s *Store) Save(run *Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records.save(run.redacted())
+}
+
+// redacted returns a copy of the run with secrets redacted from its errors
+func (r *Run) redacted() *Run {
+	redacted := *r
+	redacted.Error = config.Redact(r.Error)
+	redacted.Steps = nil
+	for _, step := range r.Steps {
+		step.Error = config.Redact(step.Error)
+		redacted.Steps = append(redacted.Steps, step)
+	}
+	return &redacted
+}
+
+// List returns all runs, most recent first
+func (s *Store) List() ([]Run, error) {
+	s.mu.Lock()
+	runs, err := s.records.list()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Started.After(runs[j].Started)
+	})
+	return runs, nil
+}
+
+// Get returns the run whose ID is id or starts with it. "last" returns the
+// most recent run.
+func (s *Store) Get(id string) (*Run, error) {
+	runs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if id == "last" && len(runs) > 0 {
+		return &runs[0], nil
+	}
+	var found []Run
+	for _, run := range runs {
+		if run.ID == id {
+			return &run, nil
+		}
+		if strings.HasPrefix(run.ID, id) {
+			found = append(found, run)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	case 1:
+		return &found[0], nil
+	}
+	return nil, fmt.Errorf("run ID '%s' is ambiguous (%d runs match)", id, len(found))
+}
+
+// PruneResult reports what Prune removed, or would remove on a dry run
+type PruneResult struct {
+	Runs  []Run // Runs whose records and step outputs were removed
+	Bytes int64 // Size of their stored step outputs
+}
+
+// Prune removes runs that started before cutoff, along with their stored
+// step outputs. Queued and running runs are kept. With dryRun set it only
+// reports what would be removed.
+func (s *Store) Prune(cutoff time.Time, dryRun bool) (*PruneResult, error) {
+	runs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{}
+	expired := make(map[string]bool)
+	for _, run := range runs {
+		if run.Started.Before(cutoff) && run.Status != StatusQueued && run.Status != StatusRunning {
+			expired[run.ID] = true
+			result.Runs = append(result.Runs, run)
+			result.Bytes += dirSize(filepath.Join(s.dir, "runs", run.ID))
+		}
+	}
+	if dryRun || len(expired) == 0 {
+		return result, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.records.remove(expired); err != nil {
+		return nil, err
+	}
+	for id := range expired {
+		if err := os.RemoveAll(filepath.Join(s.dir, "runs", id)); err != nil {
+			return nil, fmt.Errorf("error removing outputs of run %s: %w", id, err)
+		}
+	}
+	return result, nil
+}
+
+// Retention limits the runs a store keeps. Zero values don't limit.
+type Retention struct {
+	Before          time.Time // Runs that started earlier are removed
+	MaxRuns         int       // Most recent runs kept
+	MaxBytes        int64     // Total size of the kept runs' step outputs and artifacts
+	ArtifactsBefore time.Time // Runs that started earlier lose their artifacts
+}
+
+// CollectResult reports what Collect removed
+type CollectResult struct {
+	Runs          []Run // Runs whose records, step outputs and artifacts were removed
+	Bytes         int64 // Size of their step outputs and artifacts
+	Artifacts     int   // Kept runs whose artifacts were removed
+	ArtifactBytes int64 // Size of those artifacts
+	Kept          int   // Runs left in the store
+	KeptBytes     int64 // Size of the finished ones' step outputs and artifacts
+}
+
+// Collect removes the runs over the retention limits, oldest first, and the
+// artifacts of runs past the artifact age. Queued and running runs are never
+// removed, nor counted against the limits.
+func (s *Store) Collect(limits Retention) (*CollectResult, error) {
+	runs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CollectResult{}
+	expired := make(map[string]bool)
+	var kept int
+	var keptBytes int64
+	var full bool // Set once a run went over the count or size limit; older runs go too
+	for _, run := range runs {
+		if run.Status == StatusQueued || run.Status == StatusRunning {
+			result.Kept++
+			continue
+		}
+		size := dirSize(filepath.Join(s.dir, "runs", run.ID))
+		full = full || (limits.MaxRuns > 0 && kept >= limits.MaxRuns) ||
+			(limits.MaxBytes > 0 && keptBytes+size > limits.MaxBytes)
+		if full || (!limits.Before.IsZero() && run.Started.Before(limits.Before)) {
+			expired[run.ID] = true
+			result.Runs = append(result.Runs, run)
+			result.Bytes += size
+			continue
+		}
+		if !limits.ArtifactsBefore.IsZero() && run.Started.Before(limits.ArtifactsBefore) {
+			artifacts := s.ArtifactsDir(run.ID)
+			if artifactSize := dirSize(artifacts); artifactSize > 0 {
+				if err := os.RemoveAll(artifacts); err != nil {
+					return nil, fmt.Errorf("error removing artifacts of run %s: %w", run.ID, err)
+				}
+				result.Artifacts++
+				result.ArtifactBytes += artifactSize
+				size -= artifactSize
+			}
+		}
+		kept++
+		keptBytes += size
+	}
+	result.Kept += kept
+	result.KeptBytes = keptBytes
+	if len(expired) == 0 {
+		return result, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.records.remove(expired); err != nil {
+		return nil, err
+	}
+	for id := range expired {
+		if err := os.RemoveAll(filepath.Join(s.dir, "runs", id)); err != nil {
+			return nil, fmt.Errorf("error removing outputs of run %s: %w", id, err)
+		}
+	}
+	return result, nil
+}
+
+// dirSize returns the total size of the files under dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// unsafeFileChars matches characters not allowed in step output file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SaveStepOutput stores a step's response, with secrets redacted, and
+// returns its path
+func (s *Store) SaveStepOutput(runID, step, output string) (string, error) {
+	dir := filepath.Join(s.dir, "runs", runID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create run directory: %w", err)
+	}
+	path := filepath.Join(dir, unsafeFileChars.ReplaceAllString(step, "_")+".txt")
+	if err := os.WriteFile(path, []byte(config.Redact(output)), 0644); err != nil {
+		return "", fmt.Errorf("failed to save output of step %s: %w", step, err)
+	}
+	return path, nil
+}
+
+// SaveStepPrompts stores the prompts a step sent, with secrets redacted,
+// and returns the path
+func (s *Store) SaveStepPrompts(runID, step string, prompts []processor.PromptRecord) (string, error) {
+	dir := filepath.Join(s.dir, "runs", runID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create run directory: %w", err)
+	}
+	redacted := make([]processor.PromptRecord, len(prompts))
+	for i, prompt := range prompts {
+		prompt.Prompt = config.Redact(prompt.Prompt)
+		prompt.FileText = config.Redact(prompt.FileText)
+		prompt.Response = config.Redact(prompt.Response)
+		prompt.Error = config.Redact(prompt.Error)
+		redacted[i] = prompt
+	}
+	data, err := json.MarshalIndent(redacted, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode prompts of step %s: %w", step, err)
+	}
+	path := filepath.Join(dir, unsafeFileChars.ReplaceAllString(step, "_")+".prompts.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save prompts of step %s: %w", step, err)
+	}
+	return path, nil
+}
+
+// Prompts reads the prompts a step sent; steps recorded without them have
+// none
+func (s *Step) Prompts() ([]processor.PromptRecord, error) {
+	if s.PromptFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(s.PromptFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompts of step '%s': %w", s.Name, err)
+	}
+	var prompts []processor.PromptRecord
+	if err := json.Unmarshal(data, &prompts); err != nil {
+		return nil, fmt.Errorf("error parsing prompts of step '%s': %w", s.Name, err)
+	}
+	return prompts, nil
+}
+
+// ArtifactsDir returns the directory holding copies of the files a run's
+// steps wrote
+func (s *Store) ArtifactsDir(runID string) string {
+	return filepath.Join(s.dir, "runs", runID, "artifacts")
+}
+
+// Recorder records the steps of one run as the processor finishes them. It
+// implements processor.StepRecorder.
+type Recorder struct {
+	store *Store
+	run   Run
+	mu    sync.Mutex
+}
+
+// Start saves a new running run for a workflow and returns its recorder.
+// workflow is the workflow file path, or a label for runs without one.
+func (s *Store) Start(workflow string) (*Recorder, error) {
+	now := time.Now()
+	r := &Recorder{store: s, run: Run{ID: NewRunID(now), Workflow: workflow, Status: StatusRunning, Started: now}}
+	if err := s.Save(&r.run); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// StartReplay saves a new running run that sends the prompts of run again,
+// as comanda replay does, and returns its recorder
+func (s *Store) StartReplay(of *Run) (*Recorder, error) {
+	now := time.Now()
+	r := &Recorder{store: s, run: Run{ID: NewRunID(now), Workflow: of.Workflow, Status: StatusRunning, Started: now, ReplayOf: of.ID}}
+	if err := s.Save(&r.run); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Enqueue saves a new run that waits to start, as the server does before a
+// worker picks the run up. Begin marks it running.
+func (s *Store) Enqueue(workflow string) (*Recorder, error) {
+	r := &Recorder{store: s, run: Run{ID: NewRunID(time.Now()), Workflow: workflow, Status: StatusQueued, Started: time.Now()}}
+	if err := s.Save(&r.run); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reopen returns a recorder that continues a queued run, such as one a
+// server suspended when it shut down. Steps recorded so far are kept.
+func (s *Store) Reopen(id string) (*Recorder, error) {
+	run, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status != StatusQueued {
+		return nil, fmt.Errorf("run %s is %s, not queued", run.ID, run.Status)
+	}
+	return &Recorder{store: s, run: *run}, nil
+}
+
+// Begin saves a queued run as running, from now
+func (r *Recorder) Begin() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Status = StatusRunning
+	r.run.Started = time.Now()
+	r.run.Error = ""
+	return r.store.Save(&r.run)
+}
+
+// Suspend saves a run that stopped before finishing as queued again, with
+// the reason, so it can be reopened and continued later
+func (r *Recorder) Suspend(reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Status = StatusQueued
+	r.run.Error = reason
+	return r.store.Save(&r.run)
+}
+
+// ID returns the run ID
+func (r *Recorder) ID() string {
+	return r.run.ID
+}
+
+// Store returns the store the run is recorded in
+func (r *Recorder) Store() *Store {
+	return r.store
+}
+
+// Run returns a copy of the run as recorded so far
+func (r *Recorder) Run() Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.run
+	run.Steps = append([]Step(nil), r.run.Steps...)
+	return run
+}
+
+// SaveOutput stores the run's final output, which Finish then records
+func (r *Recorder) SaveOutput(output string) error {
+	dir := filepath.Join(r.store.dir, "runs", r.run.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+	// Step outputs end in .txt, so this name can't clash with one
+	path := filepath.Join(dir, "output")
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to save output of run %s: %w", r.run.ID, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.OutputFile = path
+	return nil
+}
+
+// RecordStep adds a finished step to the run and stores its response
+func (r *Recorder) RecordStep(record processor.StepRecord) {
+	step := Step{
+		Name:             record.Name,
+		Model:            record.Model,
+		Provider:         record.Provider,
+		Status:           StatusSucceeded,
+		Started:          record.Started,
+		Finished:         record.Finished,
+		PromptTokens:     record.Metrics.PromptTokens,
+		CompletionTokens: record.Metrics.CompletionTokens,
+		Retries:          record.Metrics.Retries,
+		CacheHits:        record.Metrics.CacheHits,
+		Outputs:          record.Outputs,
+		Variant:          record.Variant,
+	}
+	if record.Err != nil {
+		step.Status = StatusFailed
+		step.Error = record.Err.Error()
+	}
+	step.Cost, _ = models.EstimateCost(record.Model, step.PromptTokens, step.CompletionTokens)
+	if record.Response != "" {
+		if path, err := r.store.SaveStepOutput(r.run.ID, record.Name, record.Response); err == nil {
+			step.OutputFile = path
+		}
+	}
+	if len(record.Prompts) > 0 {
+		if path, err := r.store.SaveStepPrompts(r.run.ID, record.Name, record.Prompts); err == nil {
+			step.PromptFile = path
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Steps = append(r.run.Steps, step)
+}
+
+// SetEval records the judge's score of the run, which Finish then saves
+func (r *Recorder) SetEval(eval Eval) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Eval = &eval
+}
+
+// Finish saves the final state of the run
+func (r *Recorder) Finish(runErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Finished = time.Now()
+	r.run.Status = StatusSucceeded
+	if runErr != nil {
+		r.run.Status = StatusFailed
+		if errors.Is(runErr, ErrCanceled) {
+			r.run.Status = StatusCanceled
+		}
+		r.run.Error = runErr.Error()
+	}
+	return r.store.Save(&r.run)
+}
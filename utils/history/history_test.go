@@ -0,0 +1,354 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestRecorder(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder, err := store.Start("/work/summarize.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run, err := store.Get(recorder.ID()); err != nil || run.Status != StatusRunning {
+		t.Fatalf("Get() before finish = %+v, %v", run, err)
+	}
+
+	started := time.Now()
+	recorder.RecordStep(processor.StepRecord{
+		Name:     "summarize/all",
+		Model:    "gpt-4o",
+		Provider: "openai",
+		Outputs:  []string{"summary.md"},
+		Response: "the summary",
+		Started:  started,
+		Finished: started.Add(2 * time.Second),
+		Metrics:  processor.PerformanceMetrics{PromptTokens: 1000, CompletionTokens: 100},
+	})
+	recorder.RecordStep(processor.StepRecord{Name: "publish", Err: errors.New("boom"), Started: started, Finished: started})
+	if err := recorder.Finish(errors.New("step processing error: boom")); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := store.List()
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("List() = %v, %v", runs, err)
+	}
+	run := runs[0]
+	if run.Status != StatusFailed || run.Workflow != "/work/summarize.yaml" || len(run.Steps) != 2 {
+		t.Fatalf("run = %+v", run)
+	}
+	if cost := run.Cost(); cost < 0.0034 || cost > 0.0036 {
+		t.Errorf("Cost() = %f, want 0.0035", cost)
+	}
+	if prompt, completion := run.Tokens(); prompt != 1000 || completion != 100 {
+		t.Errorf("Tokens() = %d, %d", prompt, completion)
+	}
+	if outputs := run.Outputs(); len(outputs) != 1 || outputs[0] != "summary.md" {
+		t.Errorf("Outputs() = %v", outputs)
+	}
+
+	step, ok := run.Step("summarize/all")
+	if !ok || !strings.HasSuffix(step.OutputFile, "summarize_all.txt") {
+		t.Fatalf("Step() = %+v", step)
+	}
+	if data, err := os.ReadFile(step.OutputFile); err != nil || string(data) != "the summary" {
+		t.Errorf("stored output = %q, %v", data, err)
+	}
+	if failed, _ := run.Step("publish"); failed.Status != StatusFailed || failed.Error != "boom" || failed.OutputFile != "" {
+		t.Errorf("failed step = %+v", failed)
+	}
+}
+
+func TestRecorderRedactsSecrets(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AddSecret("history-secret-1")
+	recorder, err := store.Start("/work/leak.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.RecordStep(processor.StepRecord{Name: "echo", Response: "key history-secret-1", Prompts: []processor.PromptRecord{
+		{Model: "gpt-4o", Prompt: "repeat history-secret-1", Response: "key history-secret-1"},
+	}})
+	recorder.RecordStep(processor.StepRecord{Name: "call", Err: errors.New("401 for history-secret-1")})
+	if err := recorder.Finish(errors.New("step call: 401 for history-secret-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := store.Get(recorder.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, _ := run.Step("call")
+	if strings.Contains(run.Error, "history-secret-1") || strings.Contains(failed.Error, "history-secret-1") {
+		t.Errorf("run record shows the secret: %q, %q", run.Error, failed.Error)
+	}
+	echo, _ := run.Step("echo")
+	if data, _ := os.ReadFile(echo.OutputFile); string(data) != "key ***" {
+		t.Errorf("stored output = %q, want the secret redacted", data)
+	}
+	prompts, err := echo.Prompts()
+	if err != nil || len(prompts) != 1 || prompts[0].Prompt != "repeat ***" || prompts[0].Response != "key ***" {
+		t.Errorf("Prompts() = %+v, %v, want the secret redacted", prompts, err)
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder, err := store.Enqueue("summarize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run, err := store.Get(recorder.ID()); err != nil || run.Status != StatusQueued {
+		t.Fatalf("Get() after Enqueue = %+v, %v", run, err)
+	}
+	if err := recorder.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if run := recorder.Run(); run.Status != StatusRunning {
+		t.Errorf("Run() after Begin = %+v", run)
+	}
+
+	if err := recorder.SaveOutput("final"); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	run, err := store.Get(recorder.ID())
+	if err != nil || run.Status != StatusSucceeded {
+		t.Fatalf("Get() after Finish = %+v, %v", run, err)
+	}
+	if data, err := os.ReadFile(run.OutputFile); err != nil || string(data) != "final" {
+		t.Errorf("stored output = %q, %v", data, err)
+	}
+}
+
+func TestSuspendAndReopen(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder, err := store.Enqueue("summarize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Begin()
+	recorder.RecordStep(processor.StepRecord{Name: "first", Model: "gpt-4o"})
+	if err := recorder.Suspend("server shutting down"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Reopen("missing"); err == nil {
+		t.Error("Reopen() of a missing run should fail")
+	}
+
+	reopened, err := store.Reopen(recorder.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := reopened.Run(); run.Status != StatusQueued || run.Error != "server shutting down" || len(run.Steps) != 1 {
+		t.Errorf("Run() after Reopen = %+v", run)
+	}
+	reopened.Begin()
+	reopened.RecordStep(processor.StepRecord{Name: "second", Model: "gpt-4o"})
+	if err := reopened.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	run, err := store.Get(recorder.ID())
+	if err != nil || run.Status != StatusSucceeded || run.Error != "" || len(run.Steps) != 2 {
+		t.Fatalf("Get() after Finish = %+v, %v", run, err)
+	}
+	if _, err := store.Reopen(recorder.ID()); err == nil {
+		t.Error("Reopen() of a finished run should fail")
+	}
+}
+
+func TestGet(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, id := range []string{"20250301-090000-aaaa", "20250301-090000-aabb", "20250302-120000-cccc"} {
+		store.Save(&Run{ID: id, Workflow: "w.yaml", Status: StatusSucceeded, Started: base.Add(time.Duration(i) * time.Hour)})
+	}
+
+	if run, err := store.Get("last"); err != nil || run.ID != "20250302-120000-cccc" {
+		t.Errorf("Get(last) = %v, %v", run, err)
+	}
+	if run, err := store.Get("20250302"); err != nil || run.ID != "20250302-120000-cccc" {
+		t.Errorf("Get(prefix) = %v, %v", run, err)
+	}
+	if _, err := store.Get("20250301-090000-aa"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Get(ambiguous) error = %v", err)
+	}
+	if _, err := store.Get("1999"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, id := range []string{"old", "recent"} {
+		run := &Run{ID: id, Workflow: "w.yaml", Status: StatusRunning, Started: base.AddDate(0, 0, i*10)}
+		store.Save(run)
+		run.Status = StatusSucceeded
+		store.Save(run)
+		if _, err := store.SaveStepOutput(id, "step", "0123456789"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Save(&Run{ID: "queued", Workflow: "w.yaml", Status: StatusQueued, Started: base})
+	store.Save(&Run{ID: "active", Workflow: "w.yaml", Status: StatusRunning, Started: base})
+	cutoff := base.AddDate(0, 0, 5)
+
+	result, err := store.Prune(cutoff, true)
+	if err != nil || len(result.Runs) != 1 || result.Runs[0].ID != "old" || result.Bytes != 10 {
+		t.Fatalf("Prune(dry run) = %+v, %v", result, err)
+	}
+	if _, err := store.Get("old"); err != nil {
+		t.Fatalf("dry run removed the run: %v", err)
+	}
+
+	if _, err := store.Prune(cutoff, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(old) after prune error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir(), "runs", "old")); !os.IsNotExist(err) {
+		t.Errorf("outputs of the pruned run still exist: %v", err)
+	}
+	if run, err := store.Get("recent"); err != nil || run.Status != StatusSucceeded {
+		t.Errorf("Get(recent) after prune = %+v, %v", run, err)
+	}
+	for _, id := range []string{"queued", "active"} {
+		if _, err := store.Get(id); err != nil {
+			t.Errorf("Prune removed unfinished run %s: %v", id, err)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	// newStore returns a store with four finished runs a day apart, each
+	// with 10 bytes of step output and a 5 byte artifact, and a running run
+	newStore := func(t *testing.T) *Store {
+		store, err := Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, id := range []string{"r1", "r2", "r3", "r4"} {
+			store.Save(&Run{ID: id, Workflow: "w", Status: StatusSucceeded, Started: base.AddDate(0, 0, i)})
+			store.SaveStepOutput(id, "step", "0123456789")
+			os.MkdirAll(store.ArtifactsDir(id), 0755)
+			os.WriteFile(filepath.Join(store.ArtifactsDir(id), "out.txt"), []byte("hello"), 0644)
+		}
+		store.Save(&Run{ID: "active", Workflow: "w", Status: StatusRunning, Started: base})
+		return store
+	}
+	ids := func(runs []Run) string {
+		var ids []string
+		for _, run := range runs {
+			ids = append(ids, run.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	tests := []struct {
+		name      string
+		limits    Retention
+		removed   string
+		artifacts int
+		keptBytes int64
+	}{
+		{"age", Retention{Before: base.AddDate(0, 0, 2)}, "r2,r1", 0, 30},
+		{"count", Retention{MaxRuns: 3}, "r1", 0, 45},
+		{"size", Retention{MaxBytes: 40}, "r2,r1", 0, 30},
+		{"artifacts", Retention{ArtifactsBefore: base.AddDate(0, 0, 1)}, "", 1, 55},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore(t)
+			result, err := store.Collect(tt.limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(result.Runs); got != tt.removed {
+				t.Errorf("removed runs = %q, want %q", got, tt.removed)
+			}
+			if result.Artifacts != tt.artifacts || result.KeptBytes != tt.keptBytes {
+				t.Errorf("result = %+v", result)
+			}
+			runs, _ := store.List()
+			if len(runs) != result.Kept {
+				t.Errorf("store has %d runs, Collect kept %d", len(runs), result.Kept)
+			}
+			if _, err := store.Get("active"); err != nil {
+				t.Errorf("running run was removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	runs := []Run{
+		{ID: "a", Workflow: "/w/review.yaml", Started: base, Steps: []Step{
+			{Name: "lint", Model: "gpt-4o", Provider: "openai", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5},
+			{Name: "summarize", Model: "claude-sonnet-4", Provider: "anthropic", PromptTokens: 200, CompletionTokens: 20, Cost: 1},
+		}},
+		{ID: "b", Workflow: "/w/review.yaml", Started: base.Add(48 * time.Hour), Steps: []Step{
+			{Name: "lint", Model: "gpt-4o", Provider: "openai", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5},
+		}},
+		{ID: "c", Workflow: "/w/other.yaml", Started: base.Add(72 * time.Hour), Steps: []Step{
+			{Name: "lint", Model: "llama3"},
+		}},
+	}
+
+	byStep, err := Aggregate(runs, ByStep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byStep) != 3 || byStep[0].Key != "review.yaml:lint" || byStep[0].Runs != 2 || byStep[0].Cost != 1 {
+		t.Errorf("Aggregate(step) = %+v", byStep)
+	}
+
+	byProvider, _ := Aggregate(runs, ByProvider)
+	if len(byProvider) != 3 || byProvider[2].Key != "(none)" || byProvider[2].Steps != 1 {
+		t.Errorf("Aggregate(provider) = %+v", byProvider)
+	}
+
+	byWorkflow, _ := Aggregate(Since(runs, base.Add(24*time.Hour)), ByWorkflow)
+	if len(byWorkflow) != 2 || byWorkflow[0].Key != "/w/review.yaml" || byWorkflow[0].PromptTokens != 100 {
+		t.Errorf("Aggregate(Since(...), workflow) = %+v", byWorkflow)
+	}
+
+	if _, err := Aggregate(runs, "team"); err == nil {
+		t.Error("Aggregate() with unknown grouping: expected an error")
+	}
+}
@@ -0,0 +1,138 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/lib/pq"
+)
+
+// postgresSchema creates the run table. Each run's full record is kept as
+// JSON, with its status, timing and usage in columns for reporting queries.
+const postgresSchema = `CREATE TABLE IF NOT EXISTS comanda_runs (
+	id TEXT PRIMARY KEY,
+	workflow TEXT NOT NULL,
+	status TEXT NOT NULL,
+	started TIMESTAMPTZ NOT NULL,
+	finished TIMESTAMPTZ,
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+	record JSONB NOT NULL
+)`
+
+// postgresScheduleSchema creates the table of the server's schedules
+const postgresScheduleSchema = `CREATE TABLE IF NOT EXISTS comanda_schedules (
+	id TEXT PRIMARY KEY,
+	record JSONB NOT NULL
+)`
+
+// postgresRecords keeps run records in the comanda_runs table
+type postgresRecords struct {
+	db *sql.DB
+}
+
+// OpenPostgres returns the store in dir, keeping run records and schedules
+// in the Postgres database at connStr. The tables are created if needed.
+func OpenPostgres(dir, connStr string) (*Store, error) {
+	store, err := openDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to history database: %w", err)
+	}
+	for _, schema := range []string{postgresSchema, postgresScheduleSchema} {
+		if _, err := db.Exec(schema); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create history table: %w", err)
+		}
+	}
+	store.records = &postgresRecords{db: db}
+	return store, nil
+}
+
+// OpenConfigured returns the store in dir, with run records in the database
+// the env config's history settings name, if any
+func OpenConfigured(dir string, envConfig *config.EnvConfig) (*Store, error) {
+	name := envConfig.HistorySettings().Database
+	if name == "" {
+		return Open(dir)
+	}
+	dbConfig, err := envConfig.GetDatabaseConfig(name)
+	if err != nil {
+		return nil, fmt.Errorf("history database %s: %w", name, err)
+	}
+	if dbConfig.Type != config.PostgreSQL {
+		return nil, fmt.Errorf("history database %s has type '%s'; only postgres is supported", name, dbConfig.Type)
+	}
+	return OpenPostgres(dir, dbConfig.GetConnectionString())
+}
+
+func (p *postgresRecords) save(run *Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("error encoding run %s: %w", run.ID, err)
+	}
+	var finished *time.Time
+	if !run.Finished.IsZero() {
+		finished = &run.Finished
+	}
+	prompt, completion := run.Tokens()
+	_, err = p.db.Exec(`INSERT INTO comanda_runs
+		(id, workflow, status, started, finished, prompt_tokens, completion_tokens, cost, record)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status, started = EXCLUDED.started, finished = EXCLUDED.finished,
+			prompt_tokens = EXCLUDED.prompt_tokens, completion_tokens = EXCLUDED.completion_tokens,
+			cost = EXCLUDED.cost, record = EXCLUDED.record`,
+		run.ID, run.Workflow, run.Status, run.Started, finished, prompt, completion, run.Cost(), data)
+	if err != nil {
+		return fmt.Errorf("error writing run history: %w", err)
+	}
+	return nil
+}
+
+func (p *postgresRecords) list() ([]Run, error) {
+	rows, err := p.db.Query(`SELECT record FROM comanda_runs`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading run history: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("error reading run history: %w", err)
+		}
+		var run Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			return nil, fmt.Errorf("error decoding run history: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading run history: %w", err)
+	}
+	return runs, nil
+}
+
+func (p *postgresRecords) remove(ids map[string]bool) error {
+	list := make([]string, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	if _, err := p.db.Exec(`DELETE FROM comanda_runs WHERE id = ANY($1)`, pq.Array(list)); err != nil {
+		return fmt.Errorf("error removing runs from history: %w", err)
+	}
+	return nil
+}
+
+func (p *postgresRecords) close() error {
+	return p.db.Close()
+}
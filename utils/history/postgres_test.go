@@ -0,0 +1,82 @@
+package history
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestOpenConfigured(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenConfigured(dir, &config.EnvConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, ok := store.records.(*postgresRecords); ok {
+		t.Errorf("records = %T, want local records without a history database", store.records)
+	}
+
+	missing := &config.EnvConfig{History: &config.HistoryConfig{Database: "runs"}}
+	if _, err := OpenConfigured(dir, missing); err == nil || !strings.Contains(err.Error(), "runs") {
+		t.Errorf("OpenConfigured() with an unknown database = %v", err)
+	}
+
+	other := &config.EnvConfig{
+		History:   &config.HistoryConfig{Database: "runs"},
+		Databases: map[string]config.DatabaseConfig{"runs": {Type: "mysql"}},
+	}
+	if _, err := OpenConfigured(dir, other); err == nil || !strings.Contains(err.Error(), "only postgres") {
+		t.Errorf("OpenConfigured() with a mysql database = %v", err)
+	}
+}
+
+// TestPostgresRecords runs against a real database when
+// COMANDA_TEST_POSTGRES_URL is set
+func TestPostgresRecords(t *testing.T) {
+	url := os.Getenv("COMANDA_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("COMANDA_TEST_POSTGRES_URL not set")
+	}
+	store, err := OpenPostgres(t.TempDir(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	run := &Run{ID: NewRunID(time.Now()), Workflow: "w", Status: StatusRunning, Started: time.Now()}
+	if err := store.Save(run); err != nil {
+		t.Fatal(err)
+	}
+	run.Status = StatusSucceeded
+	run.Finished = time.Now()
+	run.Steps = []Step{{Name: "s", PromptTokens: 10, CompletionTokens: 5}}
+	if err := store.Save(run); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(run.ID)
+	if err != nil || got.Status != StatusSucceeded || len(got.Steps) != 1 {
+		t.Fatalf("Get() = %+v, %v", got, err)
+	}
+
+	if _, err := store.Prune(time.Now().Add(time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(run.ID); err == nil {
+		t.Error("run still recorded after Prune()")
+	}
+
+	sched := &Schedule{ID: "test-" + run.ID, Workflow: "w", Cron: "@daily", Enabled: true}
+	if err := store.SaveSchedule(sched); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.GetSchedule(sched.ID); err != nil || got.Cron != "@daily" {
+		t.Fatalf("GetSchedule() = %+v, %v", got, err)
+	}
+	if err := store.RemoveSchedule(sched.ID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,112 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// records keeps run records and schedules for a Store. The store
+// serializes calls.
+type records interface {
+	save(run *Run) error
+	list() ([]Run, error)             // In any order
+	remove(ids map[string]bool) error // Records of the given runs
+	listSchedules() ([]Schedule, error)
+	saveSchedule(sched *Schedule) error
+	removeSchedule(id string) error
+	close() error
+}
+
+// fileRecords appends run records to a JSON Lines file
+type fileRecords struct {
+	path string
+}
+
+func (f *fileRecords) save(run *Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("error encoding run %s: %w", run.ID, err)
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening run history: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing run history: %w", err)
+	}
+	return nil
+}
+
+func (f *fileRecords) list() ([]Run, error) {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening run history: %w", err)
+	}
+	defer file.Close()
+
+	latest := make(map[string]Run)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil || run.ID == "" {
+			continue // Skip lines from an interrupted write
+		}
+		latest[run.ID] = run
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading run history: %w", err)
+	}
+
+	runs := make([]Run, 0, len(latest))
+	for _, run := range latest {
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// remove rewrites the file without the lines of the removed runs
+func (f *fileRecords) remove(ids map[string]bool) error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("error reading run history: %w", err)
+	}
+
+	var kept []byte
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		var run Run
+		if json.Unmarshal([]byte(line), &run) == nil && ids[run.ID] {
+			continue
+		}
+		kept = append(kept, line...)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "runs-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("error rewriting run history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(kept); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error rewriting run history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error rewriting run history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("error replacing run history: %w", err)
+	}
+	return nil
+}
+
+func (f *fileRecords) close() error {
+	return nil
+}
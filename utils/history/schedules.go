@@ -0,0 +1,249 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/schedule"
+)
+
+// Overlap policies decide what a schedule does when a run is due while the
+// run it started last is still queued or running
+const (
+	OverlapSkip           = "skip"            // Don't start the due run
+	OverlapQueue          = "queue"           // Start it once the previous run finished
+	OverlapCancelPrevious = "cancel-previous" // Stop the previous run and start the due one
+)
+
+// ErrScheduleNotFound is returned when no schedule has an ID
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Schedule runs a workflow stored on the server on a cron schedule
+type Schedule struct {
+	ID        string            `json:"id"`
+	Workflow  string            `json:"workflow"`
+	Cron      string            `json:"cron"`
+	Timezone  string            `json:"timezone,omitempty"` // IANA name, such as Europe/Paris; the server's local time when empty
+	Enabled   bool              `json:"enabled"`
+	Params    map[string]string `json:"params,omitempty"`  // Values for the workflow's parameters
+	Overlap   string            `json:"overlap,omitempty"` // skip (the default), queue or cancel-previous
+	Created   time.Time         `json:"created"`
+	LastRun   string            `json:"last_run,omitempty"` // ID of the latest run it started
+	LastRunAt time.Time         `json:"last_run_at,omitempty"`
+}
+
+// Validate checks the schedule's cron expression, time zone and overlap
+// policy
+func (s *Schedule) Validate() error {
+	if _, err := schedule.ParseCron(s.Cron); err != nil {
+		return err
+	}
+	if _, err := s.Location(); err != nil {
+		return err
+	}
+	switch s.Overlap {
+	case "", OverlapSkip, OverlapQueue, OverlapCancelPrevious:
+		return nil
+	}
+	return fmt.Errorf("invalid overlap policy '%s': use %s, %s or %s", s.Overlap, OverlapSkip, OverlapQueue, OverlapCancelPrevious)
+}
+
+// Location returns the time zone the cron expression is evaluated in
+func (s *Schedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone '%s': %w", s.Timezone, err)
+	}
+	return loc, nil
+}
+
+// OverlapPolicy returns the overlap policy, defaulting to skip
+func (s *Schedule) OverlapPolicy() string {
+	if s.Overlap == "" {
+		return OverlapSkip
+	}
+	return s.Overlap
+}
+
+// Next returns when the schedule is next due after t, or the zero time if
+// its expression is invalid or never matches
+func (s *Schedule) Next(t time.Time) time.Time {
+	cron, err := schedule.ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	loc, err := s.Location()
+	if err != nil {
+		return time.Time{}
+	}
+	return cron.Next(t.In(loc))
+}
+
+// Schedules returns the stored schedules, sorted by ID
+func (s *Store) Schedules() ([]Schedule, error) {
+	s.mu.Lock()
+	schedules, err := s.records.listSchedules()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+	return schedules, nil
+}
+
+// GetSchedule returns the schedule with an ID
+func (s *Store) GetSchedule(id string) (*Schedule, error) {
+	schedules, err := s.Schedules()
+	if err != nil {
+		return nil, err
+	}
+	for _, sched := range schedules {
+		if sched.ID == id {
+			return &sched, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrScheduleNotFound, id)
+}
+
+// SaveSchedule adds a schedule or replaces the one with its ID
+func (s *Store) SaveSchedule(sched *Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records.saveSchedule(sched)
+}
+
+// RemoveSchedule deletes a schedule. Runs it started are kept.
+func (s *Store) RemoveSchedule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records.removeSchedule(id)
+}
+
+// schedulesPath returns the file that keeps schedules next to the run
+// records file
+func (f *fileRecords) schedulesPath() string {
+	return filepath.Join(filepath.Dir(f.path), "schedules.json")
+}
+
+func (f *fileRecords) listSchedules() ([]Schedule, error) {
+	data, err := os.ReadFile(f.schedulesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading schedules: %w", err)
+	}
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("error parsing schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+func (f *fileRecords) saveSchedule(sched *Schedule) error {
+	schedules, err := f.listSchedules()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range schedules {
+		if schedules[i].ID == sched.ID {
+			schedules[i] = *sched
+			replaced = true
+		}
+	}
+	if !replaced {
+		schedules = append(schedules, *sched)
+	}
+	return f.writeSchedules(schedules)
+}
+
+func (f *fileRecords) removeSchedule(id string) error {
+	schedules, err := f.listSchedules()
+	if err != nil {
+		return err
+	}
+	for i, sched := range schedules {
+		if sched.ID == id {
+			return f.writeSchedules(append(schedules[:i], schedules[i+1:]...))
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrScheduleNotFound, id)
+}
+
+// writeSchedules replaces the schedules file, writing a temporary file first
+// so a server reading it never sees a partial one
+func (f *fileRecords) writeSchedules(schedules []Schedule) error {
+	if schedules == nil {
+		schedules = []Schedule{}
+	}
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding schedules: %w", err)
+	}
+	tmp := f.schedulesPath() + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing schedules: %w", err)
+	}
+	if err := os.Rename(tmp, f.schedulesPath()); err != nil {
+		return fmt.Errorf("error writing schedules: %w", err)
+	}
+	return nil
+}
+
+func (p *postgresRecords) listSchedules() ([]Schedule, error) {
+	rows, err := p.db.Query(`SELECT record FROM comanda_schedules`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("error reading schedules: %w", err)
+		}
+		var sched Schedule
+		if err := json.Unmarshal(data, &sched); err != nil {
+			return nil, fmt.Errorf("error decoding schedule: %w", err)
+		}
+		schedules = append(schedules, sched)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+func (p *postgresRecords) saveSchedule(sched *Schedule) error {
+	data, err := json.Marshal(sched)
+	if err != nil {
+		return fmt.Errorf("error encoding schedule %s: %w", sched.ID, err)
+	}
+	_, err = p.db.Exec(`INSERT INTO comanda_schedules (id, record) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET record = EXCLUDED.record`, sched.ID, data)
+	if err != nil {
+		return fmt.Errorf("error writing schedule: %w", err)
+	}
+	return nil
+}
+
+func (p *postgresRecords) removeSchedule(id string) error {
+	result, err := p.db.Exec(`DELETE FROM comanda_schedules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error removing schedule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrScheduleNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedules(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedules, err := store.Schedules(); err != nil || len(schedules) != 0 {
+		t.Fatalf("Schedules() on a new store = %v, %v", schedules, err)
+	}
+
+	nightly := &Schedule{ID: "nightly", Workflow: "report", Cron: "0 2 * * *", Enabled: true}
+	hourly := &Schedule{ID: "hourly", Workflow: "sync", Cron: "@hourly", Params: map[string]string{"env": "prod"}}
+	for _, sched := range []*Schedule{nightly, hourly} {
+		if err := store.SaveSchedule(sched); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nightly.LastRun = "20250102-020000-abcd"
+	if err := store.SaveSchedule(nightly); err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, err := store.Schedules()
+	if err != nil || len(schedules) != 2 || schedules[0].ID != "hourly" {
+		t.Fatalf("Schedules() = %+v, %v", schedules, err)
+	}
+	got, err := store.GetSchedule("nightly")
+	if err != nil || got.LastRun != nightly.LastRun {
+		t.Fatalf("GetSchedule() = %+v, %v", got, err)
+	}
+	if schedules[0].Params["env"] != "prod" {
+		t.Errorf("params = %v", schedules[0].Params)
+	}
+
+	if err := store.RemoveSchedule("nightly"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetSchedule("nightly"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("GetSchedule() after removal = %v", err)
+	}
+	if err := store.RemoveSchedule("nightly"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("RemoveSchedule() of a missing schedule = %v", err)
+	}
+}
+
+func TestScheduleValidateAndNext(t *testing.T) {
+	tests := []struct {
+		sched Schedule
+		ok    bool
+	}{
+		{Schedule{Cron: "0 9 * * mon-fri", Timezone: "America/New_York", Overlap: OverlapQueue}, true},
+		{Schedule{Cron: "0 9 * * *", Overlap: OverlapCancelPrevious}, true},
+		{Schedule{Cron: "0 9 * *"}, false},
+		{Schedule{Cron: "0 9 * * *", Timezone: "Mars/Olympus"}, false},
+		{Schedule{Cron: "0 9 * * *", Overlap: "replace"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.sched.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v", tt.sched, err)
+		}
+	}
+
+	// 09:00 in Tokyo is midnight UTC
+	sched := Schedule{Cron: "0 9 * * *", Timezone: "Asia/Tokyo"}
+	next := sched.Next(time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC))
+	if want := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("Next() = %v, want %v", next.UTC(), want)
+	}
+	if sched.OverlapPolicy() != OverlapSkip {
+		t.Errorf("default overlap = %s", sched.OverlapPolicy())
+	}
+}
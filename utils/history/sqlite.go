@@ -0,0 +1,220 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema creates the run and schedule tables, with the same columns
+// as the Postgres ones
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS comanda_runs (
+	id TEXT PRIMARY KEY,
+	workflow TEXT NOT NULL,
+	status TEXT NOT NULL,
+	started TIMESTAMP NOT NULL,
+	finished TIMESTAMP,
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	cost REAL NOT NULL DEFAULT 0,
+	record TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS comanda_schedules (
+	id TEXT PRIMARY KEY,
+	record TEXT NOT NULL
+)`
+
+// sqliteRecords keeps run records and schedules in history.db in the store
+// directory
+type sqliteRecords struct {
+	db *sql.DB
+}
+
+// openSQLite opens the history.db database in dir, creating its tables. A
+// new database imports the runs.jsonl and schedules.json files of earlier
+// versions, which are then renamed with an .imported suffix.
+func openSQLite(dir string) (*sqliteRecords, error) {
+	path := filepath.Join(dir, "history.db")
+	_, statErr := os.Stat(path)
+	isNew := os.IsNotExist(statErr)
+
+	// WAL and a busy timeout let the server and CLI commands share the file
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		if isNew {
+			os.Remove(path)
+		}
+		return nil, fmt.Errorf("failed to create history tables: %w", err)
+	}
+	records := &sqliteRecords{db: db}
+	if isNew {
+		if err := records.importFiles(&fileRecords{path: filepath.Join(dir, "runs.jsonl")}); err != nil {
+			db.Close()
+			os.Remove(path)
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// importFiles copies the run records and schedules kept in files into the
+// database and renames the files so they aren't imported again
+func (s *sqliteRecords) importFiles(files *fileRecords) error {
+	runs, err := files.list()
+	if err != nil {
+		return err
+	}
+	schedules, err := files.listSchedules()
+	if err != nil {
+		return err
+	}
+	for i := range runs {
+		if err := s.save(&runs[i]); err != nil {
+			return err
+		}
+	}
+	for i := range schedules {
+		if err := s.saveSchedule(&schedules[i]); err != nil {
+			return err
+		}
+	}
+	for _, path := range []string{files.path, files.schedulesPath()} {
+		if _, err := os.Stat(path); err == nil {
+			if err := os.Rename(path, path+".imported"); err != nil {
+				return fmt.Errorf("error renaming imported history file: %w", err)
+			}
+		}
+	}
+	if len(runs)+len(schedules) > 0 {
+		config.DebugLog("Imported %d run(s) and %d schedule(s) into the history database", len(runs), len(schedules))
+	}
+	return nil
+}
+
+func (s *sqliteRecords) save(run *Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("error encoding run %s: %w", run.ID, err)
+	}
+	var finished *time.Time
+	if !run.Finished.IsZero() {
+		finished = &run.Finished
+	}
+	prompt, completion := run.Tokens()
+	_, err = s.db.Exec(`INSERT INTO comanda_runs
+		(id, workflow, status, started, finished, prompt_tokens, completion_tokens, cost, record)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			status = excluded.status, started = excluded.started, finished = excluded.finished,
+			prompt_tokens = excluded.prompt_tokens, completion_tokens = excluded.completion_tokens,
+			cost = excluded.cost, record = excluded.record`,
+		run.ID, run.Workflow, run.Status, run.Started, finished, prompt, completion, run.Cost(), string(data))
+	if err != nil {
+		return fmt.Errorf("error writing run history: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteRecords) list() ([]Run, error) {
+	rows, err := s.db.Query(`SELECT record FROM comanda_runs`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading run history: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("error reading run history: %w", err)
+		}
+		var run Run
+		if err := json.Unmarshal([]byte(data), &run); err != nil {
+			return nil, fmt.Errorf("error decoding run history: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading run history: %w", err)
+	}
+	return runs, nil
+}
+
+func (s *sqliteRecords) remove(ids map[string]bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(ids))
+	for id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	if _, err := s.db.Exec(`DELETE FROM comanda_runs WHERE id IN (`+placeholders+`)`, args...); err != nil {
+		return fmt.Errorf("error removing runs from history: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteRecords) listSchedules() ([]Schedule, error) {
+	rows, err := s.db.Query(`SELECT record FROM comanda_schedules`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("error reading schedules: %w", err)
+		}
+		var sched Schedule
+		if err := json.Unmarshal([]byte(data), &sched); err != nil {
+			return nil, fmt.Errorf("error decoding schedule: %w", err)
+		}
+		schedules = append(schedules, sched)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+func (s *sqliteRecords) saveSchedule(sched *Schedule) error {
+	data, err := json.Marshal(sched)
+	if err != nil {
+		return fmt.Errorf("error encoding schedule %s: %w", sched.ID, err)
+	}
+	_, err = s.db.Exec(`INSERT INTO comanda_schedules (id, record) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET record = excluded.record`, sched.ID, string(data))
+	if err != nil {
+		return fmt.Errorf("error writing schedule: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteRecords) removeSchedule(id string) error {
+	result, err := s.db.Exec(`DELETE FROM comanda_schedules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("error removing schedule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrScheduleNotFound, id)
+	}
+	return nil
+}
+
+func (s *sqliteRecords) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,111 @@
+//go:build cgo
+
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteRecords(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.records.(*sqliteRecords); !ok {
+		t.Fatalf("records = %T, want SQLite records", store.records)
+	}
+
+	started := time.Now().Add(-time.Minute).Truncate(time.Second)
+	run := &Run{ID: "20250102-150405-aaaa", Workflow: "review.yaml", Status: StatusRunning, Started: started}
+	if err := store.Save(run); err != nil {
+		t.Fatal(err)
+	}
+	run.Status = StatusSucceeded
+	run.Finished = started.Add(30 * time.Second)
+	run.Steps = []Step{{Name: "review", Status: StatusSucceeded, PromptTokens: 100, Cost: 0.01}}
+	if err := store.Save(run); err != nil {
+		t.Fatal(err)
+	}
+	older := &Run{ID: "20250101-150405-bbbb", Workflow: "digest.yaml", Status: StatusFailed, Started: started.Add(-time.Hour)}
+	if err := store.Save(older); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSchedule(&Schedule{ID: "nightly", Workflow: "digest.yaml", Cron: "@daily", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Records outlive the process that wrote them
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != run.ID || runs[1].ID != older.ID {
+		t.Fatalf("List() = %+v, want the two runs, most recent first", runs)
+	}
+	if runs[0].Status != StatusSucceeded || len(runs[0].Steps) != 1 || runs[0].Cost() != 0.01 {
+		t.Errorf("List()[0] = %+v, want the latest save", runs[0])
+	}
+	if sched, err := store.GetSchedule("nightly"); err != nil || sched.Cron != "@daily" {
+		t.Errorf("GetSchedule() = %+v, %v", sched, err)
+	}
+
+	if err := store.records.remove(map[string]bool{older.ID: true}); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _ := store.List(); len(runs) != 1 {
+		t.Errorf("List() after remove = %d runs, want 1", len(runs))
+	}
+	if err := store.RemoveSchedule("nightly"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RemoveSchedule("nightly"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("RemoveSchedule() of a removed schedule = %v", err)
+	}
+}
+
+func TestSQLiteImportsFiles(t *testing.T) {
+	dir := t.TempDir()
+	lines := `{"id":"20250102-150405-aaaa","workflow":"review.yaml","status":"running","started":"2025-01-02T15:04:05Z"}
+{"id":"20250102-150405-aaaa","workflow":"review.yaml","status":"succeeded","started":"2025-01-02T15:04:05Z"}
+{"id":"20250103-150405-bbbb","workflow":"digest.yaml","status":"failed","started":"2025-01-03T15:04:05Z"}
+`
+	if err := os.WriteFile(filepath.Join(dir, "runs.jsonl"), []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schedules := `[{"id":"nightly","workflow":"digest.yaml","cron":"@daily","enabled":true,"created":"2025-01-01T00:00:00Z"}]`
+	if err := os.WriteFile(filepath.Join(dir, "schedules.json"), []byte(schedules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[1].Status != StatusSucceeded {
+		t.Errorf("List() = %+v, want the imported runs with their latest status", runs)
+	}
+	if list, err := store.Schedules(); err != nil || len(list) != 1 {
+		t.Errorf("Schedules() = %+v, %v", list, err)
+	}
+	for _, name := range []string{"runs.jsonl", "schedules.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name+".imported")); err != nil {
+			t.Errorf("%s wasn't renamed after its import: %v", name, err)
+		}
+	}
+}
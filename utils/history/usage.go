@@ -0,0 +1,117 @@
+package history
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Usage groupings
+const (
+	ByRun      = "run"
+	ByWorkflow = "workflow"
+	ByStep     = "step"
+	ByModel    = "model"
+	ByProvider = "provider"
+	ByVariant  = "variant"
+)
+
+// Groupings lists the supported usage groupings
+var Groupings = []string{ByRun, ByWorkflow, ByStep, ByModel, ByProvider, ByVariant}
+
+// Usage is the token and cost total of one group of steps
+type Usage struct {
+	Key              string  `json:"key"`
+	Runs             int     `json:"runs"`
+	Steps            int     `json:"steps"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Since returns the runs that started at or after t
+func Since(runs []Run, t time.Time) []Run {
+	var recent []Run
+	for _, run := range runs {
+		if !run.Started.Before(t) {
+			recent = append(recent, run)
+		}
+	}
+	return recent
+}
+
+// Aggregate totals the steps of runs by one of the Groupings. Groups are
+// sorted by cost, most expensive first.
+func Aggregate(runs []Run, by string) ([]Usage, error) {
+	keyOf, err := groupKey(by)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*Usage)
+	runIDs := make(map[string]map[string]bool)
+	for _, run := range runs {
+		for _, step := range run.Steps {
+			key := keyOf(run, step)
+			u, ok := totals[key]
+			if !ok {
+				u = &Usage{Key: key}
+				totals[key] = u
+				runIDs[key] = make(map[string]bool)
+			}
+			if !runIDs[key][run.ID] {
+				runIDs[key][run.ID] = true
+				u.Runs++
+			}
+			u.Steps++
+			u.PromptTokens += step.PromptTokens
+			u.CompletionTokens += step.CompletionTokens
+			u.Cost += step.Cost
+		}
+	}
+
+	usage := make([]Usage, 0, len(totals))
+	for _, u := range totals {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Cost != usage[j].Cost {
+			return usage[i].Cost > usage[j].Cost
+		}
+		return usage[i].Key < usage[j].Key
+	})
+	return usage, nil
+}
+
+// groupKey returns the function that names a step's group
+func groupKey(by string) (func(Run, Step) string, error) {
+	switch by {
+	case ByRun:
+		return func(r Run, s Step) string { return r.ID }, nil
+	case ByWorkflow:
+		return func(r Run, s Step) string { return r.Workflow }, nil
+	case ByStep:
+		// Step names are only unique within a workflow
+		return func(r Run, s Step) string { return filepath.Base(r.Workflow) + ":" + s.Name }, nil
+	case ByModel:
+		return func(r Run, s Step) string { return orUnknown(s.Model) }, nil
+	case ByProvider:
+		return func(r Run, s Step) string { return orUnknown(s.Provider) }, nil
+	case ByVariant:
+		return func(r Run, s Step) string {
+			if s.Variant == "" {
+				return "(none)"
+			}
+			return filepath.Base(r.Workflow) + ":" + s.Name + "@" + s.Variant
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown grouping '%s' (expected one of %v)", by, Groupings)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
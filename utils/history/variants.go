@@ -0,0 +1,77 @@
+package history
+
+import "sort"
+
+// VariantStats compares the runs in which a step used one of its prompt
+// variants
+type VariantStats struct {
+	Workflow  string  `json:"workflow"`
+	Step      string  `json:"step"`
+	Variant   string  `json:"variant"`
+	Runs      int     `json:"runs"`
+	Failed    int     `json:"failed"`         // Runs in which the step failed
+	Cost      float64 `json:"avg_cost"`       // Average estimated cost of the step
+	LatencyMS int64   `json:"avg_latency_ms"` // Average duration of the step
+	Scored    int     `json:"scored"`         // Runs a judge scored, made by comanda eval
+	MeanScore float64 `json:"mean_score,omitempty"`
+	Passed    int     `json:"passed"` // Scored runs that passed
+}
+
+// CompareVariants totals the runs of every step's prompt variants. Stats
+// are sorted by workflow and step, then by mean score and cost, best first.
+func CompareVariants(runs []Run) []VariantStats {
+	type key struct{ workflow, step, variant string }
+	totals := make(map[key]*VariantStats)
+	scores := make(map[key]float64)
+	for _, run := range runs {
+		for _, step := range run.Steps {
+			if step.Variant == "" {
+				continue
+			}
+			k := key{run.Workflow, step.Name, step.Variant}
+			v, ok := totals[k]
+			if !ok {
+				v = &VariantStats{Workflow: run.Workflow, Step: step.Name, Variant: step.Variant}
+				totals[k] = v
+			}
+			v.Runs++
+			if step.Status == StatusFailed {
+				v.Failed++
+			}
+			v.Cost += step.Cost
+			v.LatencyMS += step.Finished.Sub(step.Started).Milliseconds()
+			if run.Eval != nil && run.Eval.Score > 0 {
+				v.Scored++
+				scores[k] += run.Eval.Score
+				if run.Eval.Passed {
+					v.Passed++
+				}
+			}
+		}
+	}
+
+	stats := make([]VariantStats, 0, len(totals))
+	for k, v := range totals {
+		v.Cost /= float64(v.Runs)
+		v.LatencyMS /= int64(v.Runs)
+		if v.Scored > 0 {
+			v.MeanScore = scores[k] / float64(v.Scored)
+		}
+		stats = append(stats, *v)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		switch {
+		case a.Workflow != b.Workflow:
+			return a.Workflow < b.Workflow
+		case a.Step != b.Step:
+			return a.Step < b.Step
+		case a.MeanScore != b.MeanScore:
+			return a.MeanScore > b.MeanScore
+		case a.Cost != b.Cost:
+			return a.Cost < b.Cost
+		}
+		return a.Variant < b.Variant
+	})
+	return stats
+}
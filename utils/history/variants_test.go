@@ -0,0 +1,66 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestRecordVariantAndEval(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := store.Start("/work/reply.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.RecordStep(processor.StepRecord{Name: "reply", Model: "gpt-4o", Response: "Hi", Variant: "concise"})
+	recorder.SetEval(Eval{Dataset: "/work/support.jsonl", Item: "refund", Judge: "gpt-4o", Score: 4, Passed: true})
+	if err := recorder.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := store.Get(recorder.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Steps[0].Variant != "concise" || run.Eval == nil || run.Eval.Item != "refund" || run.Eval.Score != 4 {
+		t.Errorf("run = %+v, eval %+v", run, run.Eval)
+	}
+}
+
+func TestCompareVariants(t *testing.T) {
+	base := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	step := func(variant string, seconds int, cost float64) Step {
+		return Step{Name: "reply", Variant: variant, Status: StatusSucceeded, Started: base, Finished: base.Add(time.Duration(seconds) * time.Second), Cost: cost}
+	}
+	runs := []Run{
+		{Workflow: "/w/reply.yaml", Steps: []Step{step("concise", 1, 0.01), {Name: "title"}}, Eval: &Eval{Score: 3}},
+		{Workflow: "/w/reply.yaml", Steps: []Step{step("concise", 3, 0.03)}, Eval: &Eval{Score: 5, Passed: true}},
+		{Workflow: "/w/reply.yaml", Steps: []Step{step("detailed", 4, 0.05)}, Eval: &Eval{Score: 5, Passed: true}},
+		{Workflow: "/w/reply.yaml", Steps: []Step{step("detailed", 6, 0.07)}},
+		{Workflow: "/w/reply.yaml", Steps: []Step{{Name: "reply", Variant: "detailed", Status: StatusFailed}}},
+	}
+
+	stats := CompareVariants(runs)
+	if len(stats) != 2 {
+		t.Fatalf("CompareVariants() = %+v", stats)
+	}
+	detailed, concise := stats[0], stats[1]
+	if detailed.Variant != "detailed" || detailed.Runs != 3 || detailed.Failed != 1 || detailed.Scored != 1 || detailed.MeanScore != 5 || detailed.Passed != 1 {
+		t.Errorf("detailed = %+v", detailed)
+	}
+	if detailed.Cost != 0.04 || detailed.LatencyMS != 3333 {
+		t.Errorf("detailed averages = cost %f latency %d", detailed.Cost, detailed.LatencyMS)
+	}
+	if concise.Variant != "concise" || concise.Runs != 2 || concise.MeanScore != 4 || concise.Passed != 1 || concise.LatencyMS != 2000 {
+		t.Errorf("concise = %+v", concise)
+	}
+
+	byVariant, _ := Aggregate(runs, ByVariant)
+	if len(byVariant) != 3 || byVariant[0].Key != "reply.yaml:reply@detailed" || byVariant[2].Key != "(none)" {
+		t.Errorf("Aggregate(variant) = %+v", byVariant)
+	}
+}
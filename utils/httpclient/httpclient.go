@@ -0,0 +1,17 @@
+// Package httpclient provides the HTTP client shared by the integrations
+// that call third-party APIs, such as issue trackers, connectors, vector
+// stores, spreadsheets and Kafka REST proxies.
+package httpclient
+
+import (
+	"net/http"
+	"time"
+)
+
+// Timeout bounds each request, including reading the response, so a
+// service that stops answering fails the step instead of hanging the run
+const Timeout = 2 * time.Minute
+
+// Client makes the integrations' requests. It uses the default transport,
+// so requests are pooled and cancelled with the others comanda makes.
+var Client = &http.Client{Timeout: Timeout}
@@ -45,11 +45,27 @@ type Input struct {
 	Metadata     map[string]interface{} // For additional data like scraping config
 	ScrapeConfig *ScrapeConfig          // Specific configuration for web scraping
 	MimeType     string                 // Added MimeType field
+	Size         int64                  // Size of the file, for inputs added by reference
+}
+
+// Load returns the input's contents, reading them from its file when the
+// input was added by reference
+func (in *Input) Load() ([]byte, error) {
+	if in.Contents != nil || in.Size == 0 {
+		return in.Contents, nil
+	}
+	data, err := os.ReadFile(in.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", in.Path, err)
+	}
+	return data, nil
 }
 
 // Handler processes input files and directories
 type Handler struct {
-	inputs []*Input
+	inputs  []*Input
+	maxSize int64 // Most bytes of files read into memory, 0 for fileutil.MaxFileSize
+	read    int64 // Bytes of files read into memory so far
 }
 
 // NewHandler creates a new input handler
@@ -59,6 +75,70 @@ func NewHandler() *Handler {
 	}
 }
 
+// SetMaxInputSize limits the total size of the files read into memory
+func (h *Handler) SetMaxInputSize(limit int64) {
+	h.maxSize = limit
+}
+
+// maxInputSize returns the limit on the size of the files read into memory
+func (h *Handler) maxInputSize() int64 {
+	if h.maxSize > 0 {
+		return h.maxSize
+	}
+	return fileutil.MaxFileSize
+}
+
+// reserve counts a file of size bytes against the size limit before it is
+// read into memory
+func (h *Handler) reserve(path string, size int64) error {
+	limit := h.maxInputSize()
+	if size > limit {
+		return &fileutil.SizeLimitError{Path: path, Size: size, Limit: limit}
+	}
+	if h.read+size > limit {
+		return &fileutil.SizeLimitError{Path: path, Size: size, Total: h.read + size, Limit: limit}
+	}
+	h.read += size
+	return nil
+}
+
+// readFile reads a file into memory, counting it against the size limit
+func (h *Handler) readFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	if err := h.reserve(path, info.Size()); err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	return contents, nil
+}
+
+// AddFileReference adds a file input without reading it into memory, for
+// files sent to a model one at a time such as the chunks of a large input.
+// The file on its own must be within the size limit. Use Input.Load to
+// read it.
+func (h *Handler) AddFileReference(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error checking file size: %w", err)
+	}
+	if limit := h.maxInputSize(); info.Size() > limit {
+		return &fileutil.SizeLimitError{Path: path, Size: info.Size(), Limit: limit}
+	}
+	h.inputs = append(h.inputs, &Input{
+		Path:     path,
+		Type:     FileInput,
+		MimeType: h.getMimeType(path),
+		Size:     info.Size(),
+	})
+	return nil
+}
+
 // ProcessStdin handles string input as STDIN
 func (h *Handler) ProcessStdin(content string) error {
 	// Check if stdin is available and is a terminal/pipe
@@ -318,9 +398,9 @@ func (h *Handler) ProcessScrape(url string, config map[string]interface{}) error
 
 // processFile handles single file input
 func (h *Handler) processFile(path string) error {
-	contents, err := fileutil.SafeReadFile(path)
+	contents, err := h.readFile(path)
 	if err != nil {
-		return fmt.Errorf("error reading file %s: %w", path, err)
+		return err
 	}
 
 	input := &Input{
@@ -335,9 +415,9 @@ func (h *Handler) processFile(path string) error {
 
 // processSourceCode handles source code file input
 func (h *Handler) processSourceCode(path string) error {
-	contents, err := fileutil.SafeReadFile(path)
+	contents, err := h.readFile(path)
 	if err != nil {
-		return fmt.Errorf("error reading source code file %s: %w", path, err)
+		return err
 	}
 
 	input := &Input{
@@ -381,7 +461,14 @@ func (h *Handler) resizeImage(img image.Image) image.Image {
 // processImage handles image file input
 func (h *Handler) processImage(path string) error {
 	// Read the image file
-	imgFile, err := fileutil.SafeOpenFile(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error opening image %s: %w", path, err)
+	}
+	if err := h.reserve(path, info.Size()); err != nil {
+		return err
+	}
+	imgFile, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("error opening image %s: %w", path, err)
 	}
@@ -493,7 +580,7 @@ func (h *Handler) GetInputs() []*Input {
 func (h *Handler) GetFileContents(path string) ([]byte, error) {
 	for _, input := range h.inputs {
 		if input.Path == path {
-			return input.Contents, nil
+			return input.Load()
 		}
 	}
 	return nil, fmt.Errorf("file %s not found in processed inputs", path)
@@ -511,7 +598,19 @@ func (h *Handler) GetAllContents() []byte {
 	return allContents
 }
 
+// RetainInputs keeps only the inputs for which keep returns true
+func (h *Handler) RetainInputs(keep func(*Input) bool) {
+	retained := make([]*Input, 0, len(h.inputs))
+	for _, input := range h.inputs {
+		if keep(input) {
+			retained = append(retained, input)
+		}
+	}
+	h.inputs = retained
+}
+
 // Clear removes all processed inputs
 func (h *Handler) Clear() {
 	h.inputs = make([]*Input, 0)
+	h.read = 0
 }
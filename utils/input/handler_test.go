@@ -244,3 +244,37 @@ func TestContainsWildcard(t *testing.T) {
 		}
 	}
 }
+
+func TestMaxInputSize(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	first, second := write("a.txt", 600), write("b.txt", 600)
+
+	handler := NewHandler()
+	handler.SetMaxInputSize(1000)
+	if err := handler.ProcessPath(first); err != nil {
+		t.Fatalf("ProcessPath() within the limit error = %v", err)
+	}
+	err := handler.ProcessPath(second)
+	if err == nil || !strings.Contains(err.Error(), "brings the step's inputs to 1.2 KB, over the limit of 1000 B") {
+		t.Errorf("ProcessPath() over the total limit error = %v", err)
+	}
+
+	handler.Clear()
+	if err := handler.AddFileReference(second); err != nil {
+		t.Fatalf("AddFileReference() error = %v", err)
+	}
+	in := handler.GetInputs()[0]
+	if in.Contents != nil || in.Size != 600 {
+		t.Errorf("reference input = %+v, want no contents and its size", in)
+	}
+	if data, err := in.Load(); err != nil || len(data) != 600 {
+		t.Errorf("Load() = %d bytes, %v", len(data), err)
+	}
+}
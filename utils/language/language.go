@@ -0,0 +1,214 @@
+// Package language tells which language a text is written in, from its
+// script and its most common words, so translate steps can name the source
+// language in their prompts and leave text already in the target alone.
+package language
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// sampleRunes is how much of a text Detect reads
+const sampleRunes = 4000
+
+// names are the languages Detect knows, by ISO-639-1 code
+var names = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fa": "Persian",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"th": "Thai",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// stopwords are the most common words of the languages written in Latin
+// script, which tell them apart in a few sentences
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "on", "are", "this", "be", "as", "have", "not", "you", "we"},
+	"fr": {"le", "la", "les", "et", "des", "est", "un", "une", "du", "que", "dans", "pour", "pas", "qui", "sur", "au", "avec", "nous", "vous", "ce"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "von", "auf", "für", "ich", "wir", "auch", "es", "dem"},
+	"es": {"el", "la", "de", "que", "y", "los", "las", "en", "es", "por", "un", "una", "con", "para", "del", "se", "no", "lo", "como", "más"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "non", "sono", "del", "della", "con", "gli", "le", "si", "è", "nel", "anche", "questo"},
+	"pt": {"o", "a", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "os", "as", "no", "na", "se", "por", "são"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "voor", "met", "die", "we", "ook", "er", "aan", "maar", "ik"},
+	"pl": {"i", "w", "nie", "na", "się", "jest", "to", "że", "z", "do", "jak", "co", "ale", "o", "tak", "są", "przez", "czy", "od", "dla"},
+	"sv": {"och", "att", "det", "som", "en", "är", "på", "av", "för", "med", "till", "den", "har", "inte", "om", "ett", "vi", "jag", "de", "var"},
+}
+
+// letters are letters only one of the languages in Latin script uses
+var letters = map[rune]string{
+	'ñ': "es", '¿': "es", '¡': "es",
+	'ã': "pt", 'õ': "pt",
+	'ß': "de",
+	'ł': "pl", 'ą': "pl", 'ę': "pl", 'ś': "pl", 'ź': "pl", 'ż': "pl", 'ń': "pl",
+	'å': "sv",
+}
+
+// Name returns the English name of a language code, such as French for fr
+// or fr-CA, or the code itself when it isn't known
+func Name(code string) string {
+	if name, ok := names[strings.ToLower(base(code))]; ok {
+		return name
+	}
+	return code
+}
+
+// Code returns the ISO-639-1 code of a language given by code or English
+// name, ignoring any region, or an empty string when it isn't known
+func Code(language string) string {
+	language = strings.TrimSpace(language)
+	if code := strings.ToLower(base(language)); names[code] != "" {
+		return code
+	}
+	for code, name := range names {
+		if strings.EqualFold(name, language) {
+			return code
+		}
+	}
+	return ""
+}
+
+// base drops the region of a language tag such as pt-BR
+func base(tag string) string {
+	if i := strings.IndexAny(tag, "-_"); i > 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// Detect returns the code of the language a text is written in, or an
+// empty string when the text is too short or mixed to tell
+func Detect(text string) string {
+	scripts := make(map[string]int)
+	kana := 0
+	letterCount := 0
+	var sample strings.Builder
+	n := 0
+	for _, r := range text {
+		if n++; n > sampleRunes {
+			break
+		}
+		sample.WriteRune(r)
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letterCount++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			scripts["latin"]++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+			scripts["cjk"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["cjk"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["cyrillic"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["arabic"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Thai, r):
+			scripts["th"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		}
+	}
+	if letterCount == 0 {
+		return ""
+	}
+	script := ""
+	for s, count := range scripts {
+		if script == "" || count > scripts[script] || count == scripts[script] && s < script {
+			script = s
+		}
+	}
+	if scripts[script]*2 < letterCount {
+		return ""
+	}
+
+	s := sample.String()
+	switch script {
+	case "latin":
+		return detectLatin(s)
+	case "cjk":
+		// Japanese mixes kana into its kanji; Chinese has none
+		if kana*10 >= scripts["cjk"] {
+			return "ja"
+		}
+		return "zh"
+	case "cyrillic":
+		if strings.ContainsAny(s, "іїєґІЇЄҐ") {
+			return "uk"
+		}
+		return "ru"
+	case "arabic":
+		if strings.ContainsAny(s, "پچژگ") {
+			return "fa"
+		}
+		return "ar"
+	}
+	return script
+}
+
+// detectLatin tells the languages written in Latin script apart by their
+// common words and the letters only one of them uses
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	scores := make(map[string]float64)
+	for code, list := range stopwords {
+		set := make(map[string]bool, len(list))
+		for _, w := range list {
+			set[w] = true
+		}
+		for _, w := range words {
+			if set[w] {
+				scores[code]++
+			}
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		if code, ok := letters[r]; ok {
+			scores[code] += 0.5
+		}
+	}
+
+	codes := make([]string, 0, len(scores))
+	for code := range scores {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if scores[codes[i]] != scores[codes[j]] {
+			return scores[codes[i]] > scores[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	if len(codes) == 0 || scores[codes[0]] < 2 {
+		return ""
+	}
+	// A close second means the text is too mixed or short to tell
+	if len(codes) > 1 && scores[codes[0]] < scores[codes[1]]*1.25 {
+		return ""
+	}
+	return codes[0]
+}
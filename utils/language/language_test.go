@@ -0,0 +1,44 @@
+package language
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The quarterly report is ready, and we are happy with the results for this year.", "en"},
+		{"Le rapport trimestriel est prêt et nous sommes contents des résultats pour cette année.", "fr"},
+		{"Der Quartalsbericht ist fertig und wir sind mit den Ergebnissen für dieses Jahr zufrieden.", "de"},
+		{"El informe trimestral está listo y estamos contentos con los resultados de este año.", "es"},
+		{"Il rapporto trimestrale è pronto e siamo contenti dei risultati per questo anno.", "it"},
+		{"O relatório trimestral está pronto e estamos contentes com os resultados do ano.", "pt"},
+		{"Het kwartaalrapport is klaar en we zijn tevreden met de resultaten van dit jaar.", "nl"},
+		{"Raport kwartalny jest gotowy i jesteśmy zadowoleni z wyników w tym roku.", "pl"},
+		{"Квартальный отчёт готов, и мы довольны результатами этого года.", "ru"},
+		{"Квартальний звіт готовий, і ми задоволені результатами цього року.", "uk"},
+		{"四半期報告書の準備ができました。今年の結果に満足しています。", "ja"},
+		{"季度报告已经准备好了，我们对今年的结果很满意。", "zh"},
+		{"분기 보고서가 준비되었습니다.", "ko"},
+		{"Η τριμηνιαία έκθεση είναι έτοιμη.", "el"},
+		{"التقرير الفصلي جاهز", "ar"},
+		{"OK", ""},
+		{"12345 !!!", ""},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.text); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCodeAndName(t *testing.T) {
+	for in, want := range map[string]string{"fr": "fr", "French": "fr", "pt-BR": "pt", " german ": "de", "Klingon": ""} {
+		if got := Code(in); got != want {
+			t.Errorf("Code(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if Name("fr-CA") != "French" || Name("tlh") != "tlh" {
+		t.Errorf("Name() = %q, %q", Name("fr-CA"), Name("tlh"))
+	}
+}
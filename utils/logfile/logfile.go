@@ -0,0 +1,152 @@
+// Package logfile writes logs to a file that is rotated by size, keeping a
+// limited number of old files for a limited time.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupFormat is the timestamp added to rotated files, e.g.
+// comanda-2024-05-01T10-15-00.000.log
+const backupFormat = "2006-01-02T15-04-05.000"
+
+// Options controls rotation
+type Options struct {
+	MaxSize    int64         // Bytes before the file is rotated; 0 never rotates
+	MaxAge     time.Duration // Rotated files older than this are removed; 0 keeps them
+	MaxBackups int           // Rotated files to keep; 0 keeps all
+}
+
+// Writer appends to a log file and rotates it once it grows past MaxSize.
+// It is safe for concurrent use.
+type Writer struct {
+	path string
+	opts Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	now  func() time.Time
+}
+
+// Open opens or creates the log file at path, creating its directory
+func Open(path string, opts Options) (*Writer, error) {
+	w := &Writer{path: path, opts: opts, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating log directory: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.cleanup()
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would take the file past MaxSize
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.opts.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.opts.MaxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate renames the current file with a timestamp and starts a new one
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(w.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(w.path, ext), w.now().Format(backupFormat), ext)
+	if err := os.Rename(w.path, backup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error rotating log file: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.cleanup()
+	return nil
+}
+
+// Backups lists the rotated files of the log, oldest first
+func (w *Writer) Backups() []string {
+	ext := filepath.Ext(w.path)
+	prefix := filepath.Base(strings.TrimSuffix(w.path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return nil
+	}
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if _, err := time.Parse(backupFormat, stamp); err == nil {
+			backups = append(backups, filepath.Join(filepath.Dir(w.path), name))
+		}
+	}
+	// The timestamps sort chronologically
+	sort.Strings(backups)
+	return backups
+}
+
+// cleanup removes rotated files beyond MaxBackups or older than MaxAge
+func (w *Writer) cleanup() {
+	backups := w.Backups()
+	if w.opts.MaxBackups > 0 && len(backups) > w.opts.MaxBackups {
+		for _, path := range backups[:len(backups)-w.opts.MaxBackups] {
+			os.Remove(path)
+		}
+		backups = backups[len(backups)-w.opts.MaxBackups:]
+	}
+	if w.opts.MaxAge > 0 {
+		cutoff := w.now().Add(-w.opts.MaxAge)
+		for _, path := range backups {
+			if info, err := os.Stat(path); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(path)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "comanda.log")
+	w, err := Open(path, Options{MaxSize: 20, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer w.Close()
+	clock := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	w.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for _, line := range []string{"first line\n", "second line\n", "third line\n", "fourth line\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "fourth line\n" {
+		t.Errorf("current log = %q", data)
+	}
+	backups := w.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups to be kept, got %v", backups)
+	}
+	oldest, _ := os.ReadFile(backups[0])
+	if string(oldest) != "second line\n" {
+		t.Errorf("oldest kept backup = %q", oldest)
+	}
+	if !strings.HasPrefix(filepath.Base(backups[0]), "comanda-2024-05-01T10-00-") || filepath.Ext(backups[0]) != ".log" {
+		t.Errorf("unexpected backup name %s", backups[0])
+	}
+}
+
+func TestWriterAppendsAndRemovesOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "comanda.log")
+	if err := os.WriteFile(path, []byte("earlier run\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(dir, "comanda-2020-01-01T00-00-00.000.log")
+	recent := filepath.Join(dir, "comanda-2024-05-01T00-00-00.000.log")
+	unrelated := filepath.Join(dir, "comanda-notes.log")
+	for _, p := range []string{stale, recent, unrelated} {
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	os.Chtimes(stale, old, old)
+
+	w, err := Open(path, Options{MaxAge: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	w.Write([]byte("this run\n"))
+	w.Close()
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "earlier run\nthis run\n" {
+		t.Errorf("log = %q, expected the file to be appended to", data)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("backup older than MaxAge was not removed")
+	}
+	for _, p := range []string{recent, unrelated} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s was removed", p)
+		}
+	}
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Error("expected Write() after Close() to fail")
+	}
+}
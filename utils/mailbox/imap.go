@@ -0,0 +1,358 @@
+// Package mailbox reads messages from IMAP folders, for email inputs and
+// mail triggers. It speaks the small part of IMAP4rev1 they need: logging
+// in, searching a folder, fetching messages and flagging them as read.
+package mailbox
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// dialTimeout bounds connecting to a server
+const dialTimeout = 30 * time.Second
+
+// maxLiteral is the largest message, or other string, read from a server
+const maxLiteral = 50 << 20
+
+// Client is a connection to an IMAP server, logged in
+type Client struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	tag      int
+	selected string
+	stop     func() bool
+}
+
+// Query selects the messages of a folder; empty fields match any message
+type Query struct {
+	From    string    // Sender contains this
+	Subject string    // Subject contains this
+	Since   time.Time // Received on or after this day
+	Unseen  bool      // Not yet read
+}
+
+// Open connects to a mailbox's server and logs in. Cancelling ctx closes
+// the connection.
+func Open(ctx context.Context, cfg config.MailboxConfig) (*Client, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("mailbox has no host")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 993
+		if cfg.Plaintext {
+			port = 143
+		}
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if cfg.Plaintext {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: cfg.Host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	c := &Client{conn: conn, r: bufio.NewReader(conn)}
+	c.stop = context.AfterFunc(ctx, func() { conn.Close() })
+
+	greeting, err := c.readResponse()
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("error reading greeting of %s: %w", addr, err)
+	}
+	switch {
+	case strings.HasPrefix(greeting.text, "* PREAUTH"):
+		return c, nil
+	case !strings.HasPrefix(greeting.text, "* OK"):
+		c.close()
+		return nil, fmt.Errorf("%s refused the connection: %s", addr, greeting.text)
+	}
+	if _, err := c.command("LOGIN", quote(cfg.Username), quote(cfg.Password)); err != nil {
+		c.close()
+		return nil, fmt.Errorf("error logging in to %s as %s: %w", addr, cfg.Username, err)
+	}
+	return c, nil
+}
+
+// Close logs out and closes the connection
+func (c *Client) Close() error {
+	c.command("LOGOUT")
+	return c.close()
+}
+
+func (c *Client) close() error {
+	c.stop()
+	return c.conn.Close()
+}
+
+// Search returns the UIDs of the messages in folder that match q, oldest
+// first
+func (c *Client) Search(folder string, q Query) ([]uint32, error) {
+	if err := c.selectFolder(folder); err != nil {
+		return nil, err
+	}
+	var criteria []interface{}
+	utf8 := false
+	text := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if isASCII(value) {
+			criteria = append(criteria, key, quote(value))
+			return
+		}
+		utf8 = true
+		criteria = append(criteria, key, literal(value))
+	}
+	text("FROM", q.From)
+	text("SUBJECT", q.Subject)
+	if !q.Since.IsZero() {
+		criteria = append(criteria, "SINCE", q.Since.Format("2-Jan-2006"))
+	}
+	if q.Unseen {
+		criteria = append(criteria, "UNSEEN")
+	}
+	if len(criteria) == 0 {
+		criteria = append(criteria, "ALL")
+	}
+
+	args := []interface{}{"UID", "SEARCH"}
+	if utf8 {
+		args = append(args, "CHARSET", "UTF-8")
+	}
+	responses, err := c.command(append(args, criteria...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s: %w", folder, err)
+	}
+	var uids []uint32
+	for _, resp := range responses {
+		if !strings.HasPrefix(resp.text, "* SEARCH") {
+			continue
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(resp.text, "* SEARCH")) {
+			if uid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, nil
+}
+
+var fetchUID = regexp.MustCompile(`\bUID (\d+)`)
+
+// Fetch returns the messages with the given UIDs in the folder last
+// searched, in the order of uids, without flagging them as read
+func (c *Client) Fetch(uids []uint32) ([]Message, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	responses, err := c.command("UID", "FETCH", uidSet(uids), "(UID BODY.PEEK[])")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching messages: %w", err)
+	}
+	byUID := make(map[uint32]Message, len(uids))
+	for _, resp := range responses {
+		m := fetchUID.FindStringSubmatch(resp.text)
+		if m == nil || len(resp.literals) == 0 || !strings.Contains(resp.text, " FETCH ") {
+			continue
+		}
+		uid, _ := strconv.ParseUint(m[1], 10, 32)
+		msg, err := Parse(resp.literals[0])
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", uid, err)
+		}
+		msg.UID = uint32(uid)
+		byUID[msg.UID] = msg
+	}
+	messages := make([]Message, 0, len(byUID))
+	for _, uid := range uids {
+		if msg, ok := byUID[uid]; ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+// MarkSeen flags messages of folder as read
+func (c *Client) MarkSeen(folder string, uids []uint32) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	if err := c.selectFolder(folder); err != nil {
+		return err
+	}
+	if _, err := c.command("UID", "STORE", uidSet(uids), "+FLAGS.SILENT", `(\Seen)`); err != nil {
+		return fmt.Errorf("error marking messages in %s as read: %w", folder, err)
+	}
+	return nil
+}
+
+// selectFolder opens folder for reading and flagging messages
+func (c *Client) selectFolder(folder string) error {
+	if c.selected == folder {
+		return nil
+	}
+	if _, err := c.command("SELECT", quote(folder)); err != nil {
+		return fmt.Errorf("error opening folder %s: %w", folder, err)
+	}
+	c.selected = folder
+	return nil
+}
+
+// Read returns the newest messages in a folder that match q, up to limit
+// when it is above zero, oldest first
+func Read(ctx context.Context, cfg config.MailboxConfig, folder string, q Query, limit int) ([]Message, error) {
+	c, err := Open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	uids, err := c.Search(folder, q)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(uids) > limit {
+		uids = uids[len(uids)-limit:]
+	}
+	return c.Fetch(uids)
+}
+
+// MarkSeen flags messages of a folder as read
+func MarkSeen(ctx context.Context, cfg config.MailboxConfig, folder string, uids []uint32) error {
+	c, err := Open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.MarkSeen(folder, uids)
+}
+
+// literal is a command argument sent as an IMAP literal, for strings that
+// can't be quoted
+type literal string
+
+// response is a line a server sent, with the literals it carried. Each
+// literal's place in text holds its size in braces.
+type response struct {
+	text     string
+	literals [][]byte
+}
+
+var literalSize = regexp.MustCompile(`\{(\d+)\}$`)
+
+// readResponse reads a response line and the literals in it
+func (c *Client) readResponse() (response, error) {
+	var resp response
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		resp.text += line
+		m := literalSize.FindStringSubmatch(line)
+		if m == nil {
+			return resp, nil
+		}
+		size, err := strconv.Atoi(m[1])
+		if err != nil || size > maxLiteral {
+			return resp, fmt.Errorf("literal of %s bytes is too large", m[1])
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, data)
+	}
+}
+
+// command sends a command and returns the untagged responses to it, or
+// the server's reason when it fails
+func (c *Client) command(args ...interface{}) ([]response, error) {
+	c.tag++
+	tag := fmt.Sprintf("C%d", c.tag)
+	line := tag
+	for _, arg := range args {
+		lit, ok := arg.(literal)
+		if !ok {
+			line += " " + fmt.Sprint(arg)
+			continue
+		}
+		// Send the line so far and wait for the server to take the literal
+		if _, err := fmt.Fprintf(c.conn, "%s {%d}\r\n", line, len(lit)); err != nil {
+			return nil, err
+		}
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(resp.text, "+") {
+			return nil, errors.New(strings.TrimPrefix(resp.text, tag+" "))
+		}
+		line = string(lit)
+	}
+	if _, err := io.WriteString(c.conn, line+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	var untagged []response
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		status, tagged := strings.CutPrefix(resp.text, tag+" ")
+		if !tagged {
+			untagged = append(untagged, resp)
+			continue
+		}
+		if !strings.HasPrefix(status, "OK") {
+			return nil, errors.New(status)
+		}
+		return untagged, nil
+	}
+}
+
+// quote returns s as an IMAP quoted string. Line breaks, which a quoted
+// string can't hold, become spaces.
+func quote(s string) string {
+	s = strings.NewReplacer("\\", "\\\\", `"`, `\"`, "\r", " ", "\n", " ").Replace(s)
+	return `"` + s + `"`
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// uidSet returns uids as an IMAP sequence set
+func uidSet(uids []uint32) string {
+	parts := make([]string, len(uids))
+	for i, uid := range uids {
+		parts[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,264 @@
+package mailbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+const supportMessage = "From: =?UTF-8?Q?Ren=C3=A9e?= <renee@example.com>\r\n" +
+	"To: support@example.com\r\n" +
+	"Subject: Refund request\r\n" +
+	"Date: Mon, 02 Jun 2025 10:00:00 +0000\r\n" +
+	"Message-ID: <abc@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"I was charged twice, caf=E9 order 42.\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>I was charged <b>twice</b></p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"receipt.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"receipt.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0x\r\nLjQ=\r\n" +
+	"--outer--\r\n"
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(supportMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "Renée <renee@example.com>" || m.Subject != "Refund request" || m.MessageID != "abc@example.com" {
+		t.Errorf("headers = %q, %q, %q", m.From, m.Subject, m.MessageID)
+	}
+	if m.Text != "I was charged twice, café order 42." {
+		t.Errorf("Text = %q, want the plain part decoded", m.Text)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Filename != "receipt.pdf" || string(m.Attachments[0].Data) != "%PDF-1.4" {
+		t.Fatalf("Attachments = %+v", m.Attachments)
+	}
+	if rendered := m.Render(); !strings.Contains(rendered, "Attachments: receipt.pdf\n\nI was charged") {
+		t.Errorf("Render() = %q", rendered)
+	}
+	if date, _ := m.Field("date"); date != "2025-06-02T10:00:00Z" {
+		t.Errorf("Field(date) = %q", date)
+	}
+}
+
+func TestParseHTMLOnly(t *testing.T) {
+	m, err := Parse([]byte("Subject: Hi\r\nContent-Type: text/html\r\n\r\n<h1>Order</h1><p>Shipped <b>today</b></p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(m.Text, "# Order") || !strings.Contains(m.Text, "**today**") {
+		t.Errorf("Text = %q, want the HTML body as Markdown", m.Text)
+	}
+}
+
+// fakeIMAP serves a folder of messages over the IMAP commands the client
+// sends, recording them
+type fakeIMAP struct {
+	messages map[uint32]string
+	seen     map[uint32]bool
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func (f *fakeIMAP) serve(t *testing.T) config.MailboxConfig {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return config.MailboxConfig{Host: "127.0.0.1", Port: addr.Port, Username: "support", Password: `p"w`, Plaintext: true}
+}
+
+func (f *fakeIMAP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK fake IMAP ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		// Take literals the client sends
+		for strings.HasSuffix(line, "}") {
+			open := strings.LastIndex(line, "{")
+			size, _ := strconv.Atoi(line[open+1 : len(line)-1])
+			fmt.Fprint(conn, "+ go ahead\r\n")
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			rest, _ := r.ReadString('\n')
+			line = line[:open] + `"` + string(data) + `"` + strings.TrimRight(rest, "\r\n")
+		}
+		tag, cmd, _ := strings.Cut(line, " ")
+		f.mu.Lock()
+		f.commands = append(f.commands, cmd)
+		f.mu.Unlock()
+
+		switch {
+		case strings.HasPrefix(cmd, "LOGIN"):
+			if cmd != `LOGIN "support" "p\"w"` {
+				fmt.Fprintf(conn, "%s NO [AUTHENTICATIONFAILED] Invalid credentials\r\n", tag)
+				continue
+			}
+		case strings.HasPrefix(cmd, "UID SEARCH"):
+			var uids []string
+			for uid := uint32(1); uid <= uint32(len(f.messages)); uid++ {
+				msg := f.messages[uid]
+				if strings.Contains(cmd, "UNSEEN") && f.isSeen(uid) {
+					continue
+				}
+				if strings.Contains(cmd, `SUBJECT "Refund"`) && !strings.Contains(msg, "Subject: Refund") {
+					continue
+				}
+				uids = append(uids, strconv.Itoa(int(uid)))
+			}
+			fmt.Fprintf(conn, "* SEARCH %s\r\n", strings.Join(uids, " "))
+		case strings.HasPrefix(cmd, "UID FETCH"):
+			for _, field := range strings.Split(strings.Fields(cmd)[2], ",") {
+				uid, _ := strconv.Atoi(field)
+				msg := f.messages[uint32(uid)]
+				fmt.Fprintf(conn, "* %d FETCH (BODY[] {%d}\r\n%s UID %d)\r\n", uid, len(msg), msg, uid)
+			}
+		case strings.HasPrefix(cmd, "UID STORE"):
+			for _, field := range strings.Split(strings.Fields(cmd)[2], ",") {
+				uid, _ := strconv.Atoi(field)
+				f.mu.Lock()
+				f.seen[uint32(uid)] = true
+				f.mu.Unlock()
+			}
+		case cmd == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK LOGOUT completed\r\n", tag)
+			return
+		}
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+func (f *fakeIMAP) isSeen(uid uint32) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seen[uid]
+}
+
+func (f *fakeIMAP) sent(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var matched []string
+	for _, cmd := range f.commands {
+		if strings.HasPrefix(cmd, prefix) {
+			matched = append(matched, cmd)
+		}
+	}
+	return matched
+}
+
+func newFakeIMAP() *fakeIMAP {
+	return &fakeIMAP{
+		messages: map[uint32]string{
+			1: "Subject: Refund for order 7\r\n\r\nPlease refund.",
+			2: "Subject: Newsletter\r\n\r\nNews.",
+			3: supportMessage,
+		},
+		seen: map[uint32]bool{1: true},
+	}
+}
+
+func TestReadAndMarkSeen(t *testing.T) {
+	f := newFakeIMAP()
+	cfg := f.serve(t)
+	ctx := context.Background()
+
+	messages, err := Read(ctx, cfg, "INBOX", Query{Subject: "Refund", Unseen: true, Since: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)}, 10)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(messages) != 1 || messages[0].UID != 3 || messages[0].Subject != "Refund request" {
+		t.Fatalf("Read() = %+v, want the unread refund request", messages)
+	}
+	if search := f.sent("UID SEARCH"); len(search) != 1 || search[0] != `UID SEARCH SUBJECT "Refund" SINCE 1-Jun-2025 UNSEEN` {
+		t.Errorf("searched with %q", search)
+	}
+	if fetch := f.sent("UID FETCH"); len(fetch) != 1 || !strings.Contains(fetch[0], "BODY.PEEK[]") {
+		t.Errorf("fetched with %q, want messages left unread", fetch)
+	}
+
+	if err := MarkSeen(ctx, cfg, "INBOX", []uint32{3}); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if !f.isSeen(3) {
+		t.Error("message 3 not flagged as read")
+	}
+
+	// The newest messages are kept under a limit
+	messages, err = Read(ctx, cfg, "INBOX", Query{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].UID != 2 || messages[1].UID != 3 {
+		t.Errorf("Read() with limit 2 returned %d messages", len(messages))
+	}
+}
+
+func TestSearchNonASCIISendsLiteral(t *testing.T) {
+	f := newFakeIMAP()
+	cfg := f.serve(t)
+	c, err := Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Search("INBOX", Query{From: "Renée"}); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if search := f.sent("UID SEARCH"); len(search) != 1 || search[0] != `UID SEARCH CHARSET UTF-8 FROM "Renée"` {
+		t.Errorf("searched with %q", search)
+	}
+}
+
+func TestOpenWrongPassword(t *testing.T) {
+	f := newFakeIMAP()
+	cfg := f.serve(t)
+	cfg.Password = "wrong"
+	_, err := Open(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "Invalid credentials") {
+		t.Errorf("Open() error = %v, want the server's reason", err)
+	}
+}
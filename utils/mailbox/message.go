@@ -0,0 +1,240 @@
+package mailbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/connectors"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Message is an email, decoded
+type Message struct {
+	UID         uint32
+	MessageID   string
+	From        string
+	To          string
+	Cc          string
+	Subject     string
+	Date        time.Time
+	Text        string // The plain text body, or the HTML body converted to Markdown
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Field returns a field of the message by name: from, to, cc, subject,
+// date, message_id or uid
+func (m Message) Field(name string) (string, bool) {
+	switch name {
+	case "from":
+		return m.From, true
+	case "to":
+		return m.To, true
+	case "cc":
+		return m.Cc, true
+	case "subject":
+		return m.Subject, true
+	case "date":
+		if m.Date.IsZero() {
+			return "", true
+		}
+		return m.Date.Format(time.RFC3339), true
+	case "message_id":
+		return m.MessageID, true
+	case "uid":
+		return strconv.FormatUint(uint64(m.UID), 10), true
+	}
+	return "", false
+}
+
+// Render returns the message as text for a prompt: its headers, the names
+// of its attachments and its body
+func (m Message) Render() string {
+	var b strings.Builder
+	header := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	header("From", m.From)
+	header("To", m.To)
+	header("Cc", m.Cc)
+	if !m.Date.IsZero() {
+		header("Date", m.Date.Format(time.RFC1123Z))
+	}
+	header("Subject", m.Subject)
+	if len(m.Attachments) > 0 {
+		names := make([]string, len(m.Attachments))
+		for i, a := range m.Attachments {
+			names[i] = a.Filename
+		}
+		header("Attachments", strings.Join(names, ", "))
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.TrimSpace(m.Text))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Parse decodes a raw RFC 5322 message: its headers, its text body and
+// its attachments. A message with only an HTML body gets the body as
+// Markdown.
+func Parse(raw []byte) (Message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Message{}, fmt.Errorf("error parsing message: %w", err)
+	}
+	h := msg.Header
+	m := Message{
+		MessageID: strings.Trim(h.Get("Message-Id"), "<> "),
+		From:      decodeHeader(h.Get("From")),
+		To:        decodeHeader(h.Get("To")),
+		Cc:        decodeHeader(h.Get("Cc")),
+		Subject:   decodeHeader(h.Get("Subject")),
+	}
+	if date, err := h.Date(); err == nil {
+		m.Date = date
+	}
+
+	var parts bodyParts
+	if err := m.walk(textproto.MIMEHeader(h), msg.Body, &parts); err != nil {
+		return Message{}, fmt.Errorf("error reading body: %w", err)
+	}
+	switch {
+	case len(parts.plain) > 0:
+		m.Text = strings.Join(parts.plain, "\n\n")
+	case len(parts.html) > 0:
+		html := strings.Join(parts.html, "\n")
+		if m.Text, err = connectors.HTMLToMarkdown(html); err != nil {
+			m.Text = html
+		}
+	}
+	return m, nil
+}
+
+// bodyParts collects the inline text parts of a message
+type bodyParts struct {
+	plain, html []string
+}
+
+// walk reads a MIME part: the parts of multipart ones, inline text into
+// parts, and anything else as an attachment
+func (m *Message) walk(header textproto.MIMEHeader, body io.Reader, parts *bodyParts) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.walk(part.Header, part, parts); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename == "" && disposition != "attachment" {
+		switch mediaType {
+		case "text/plain":
+			parts.plain = append(parts.plain, decodeCharset(data, params["charset"]))
+			return nil
+		case "text/html":
+			parts.html = append(parts.html, decodeCharset(data, params["charset"]))
+			return nil
+		}
+	}
+
+	filename = filepath.Base(decodeHeader(filename))
+	if filename == "" || filename == "." || filename == string(filepath.Separator) {
+		filename = fmt.Sprintf("attachment-%d", len(m.Attachments)+1)
+		if mediaType == "message/rfc822" {
+			filename += ".eml"
+		} else if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	m.Attachments = append(m.Attachments, Attachment{Filename: filename, ContentType: mediaType, Data: data})
+	return nil
+}
+
+// decodeTransfer undoes a part's content transfer encoding
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// decodeCharset converts text in charset to UTF-8, leaving it as it is
+// when the charset is unknown
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "us-ascii":
+		return string(data)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(input), nil
+	},
+}
+
+// decodeHeader decodes the encoded words in a header, such as
+// =?UTF-8?Q?Caf=C3=A9?=
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
@@ -0,0 +1,344 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// ProtocolVersion is the MCP protocol revision the client speaks
+const ProtocolVersion = "2024-11-05"
+
+// defaultTimeout bounds each request when the server config doesn't set one
+const defaultTimeout = 60 * time.Second
+
+// ToolInfo describes a tool exposed by an MCP server
+type ToolInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// ResourceInfo describes a resource exposed by an MCP server
+type ResourceInfo struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+// rpcRequest is a JSON-RPC 2.0 request or notification (when ID is nil)
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 message received from the server
+type rpcResponse struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// rpcError is a JSON-RPC 2.0 error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Client talks to a single MCP server over its stdin/stdout
+type Client struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan rpcResponse
+	done    chan struct{}
+	readErr error
+	timeout time.Duration
+}
+
+// Start launches the server process and performs the MCP initialize handshake
+func Start(name string, cfg config.MCPServerConfig, environ []string) (*Client, error) {
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("MCP server %s has no command configured", name)
+	}
+
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = environ
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stdin pipe for MCP server %s: %w", name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stdout pipe for MCP server %s: %w", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting MCP server %s: %w", name, err)
+	}
+
+	timeout := defaultTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	c := &Client{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan rpcResponse),
+		done:    make(chan struct{}),
+		timeout: timeout,
+	}
+	go c.readLoop(stdout)
+
+	if err := c.initialize(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	config.DebugLog("[MCP] Connected to server %s", name)
+	return c, nil
+}
+
+// Name returns the configured server name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// initialize negotiates the protocol and signals the server that the client is ready
+func (c *Client) initialize() error {
+	params := map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "comanda", "version": "1.0"},
+	}
+	if _, err := c.call("initialize", params); err != nil {
+		return fmt.Errorf("MCP server %s failed to initialize: %w", c.name, err)
+	}
+	return c.notify("notifications/initialized", nil)
+}
+
+// ListTools returns every tool the server exposes, following pagination
+func (c *Client) ListTools() ([]ToolInfo, error) {
+	var all []ToolInfo
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		raw, err := c.call("tools/list", params)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tools      []ToolInfo `json:"tools"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return nil, fmt.Errorf("invalid tools/list response from %s: %w", c.name, err)
+		}
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a tool and returns its text content. A tool-level error
+// is returned as an error carrying the tool's message.
+func (c *Client) CallTool(name string, args map[string]interface{}) (string, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	raw, err := c.call("tools/call", map[string]interface{}{"name": name, "arguments": args})
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("invalid tools/call response from %s: %w", c.name, err)
+	}
+	var parts []string
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+		} else {
+			parts = append(parts, fmt.Sprintf("[%s content omitted]", content.Type))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if result.IsError {
+		return "", fmt.Errorf("%s", text)
+	}
+	return text, nil
+}
+
+// ListResources returns the resources the server exposes
+func (c *Client) ListResources() ([]ResourceInfo, error) {
+	raw, err := c.call("resources/list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Resources []ResourceInfo `json:"resources"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid resources/list response from %s: %w", c.name, err)
+	}
+	return result.Resources, nil
+}
+
+// ReadResource returns the text contents of a resource
+func (c *Client) ReadResource(uri string) (string, error) {
+	raw, err := c.call("resources/read", map[string]interface{}{"uri": uri})
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Contents []struct {
+			Text string `json:"text"`
+			Blob string `json:"blob"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("invalid resources/read response from %s: %w", c.name, err)
+	}
+	var parts []string
+	for _, content := range result.Contents {
+		if content.Blob != "" {
+			parts = append(parts, "[binary content omitted]")
+			continue
+		}
+		parts = append(parts, content.Text)
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// Close shuts the server down by closing its stdin and waiting for it to exit
+func (c *Client) Close() error {
+	c.stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- c.cmd.Wait() }()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		c.cmd.Process.Kill()
+		<-exited
+	}
+	config.DebugLog("[MCP] Closed server %s", c.name)
+	return nil
+}
+
+// call sends a request and waits for its response
+func (c *Client) call(method string, params interface{}) (json.RawMessage, error) {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan rpcResponse, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.send(rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		c.forget(id)
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, fmt.Errorf("MCP server %s: %s (code %d)", c.name, resp.Error.Message, resp.Error.Code)
+		}
+		return resp.Result, nil
+	case <-c.done:
+		return nil, fmt.Errorf("MCP server %s exited: %v", c.name, c.readErr)
+	case <-time.After(c.timeout):
+		c.forget(id)
+		return nil, fmt.Errorf("MCP server %s did not answer %s within %s", c.name, method, c.timeout)
+	}
+}
+
+// notify sends a notification, which has no response
+func (c *Client) notify(method string, params interface{}) error {
+	return c.send(rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// send writes one newline-delimited JSON-RPC message
+func (c *Client) send(req rpcRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error encoding %s request: %w", req.Method, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing to MCP server %s: %w", c.name, err)
+	}
+	return nil
+}
+
+// forget drops a pending request that will no longer be waited on
+func (c *Client) forget(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// readLoop dispatches responses to their waiting callers. Server-initiated
+// requests and notifications are logged and otherwise ignored.
+func (c *Client) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var resp rpcResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			config.DebugLog("[MCP] Ignoring non-JSON output from %s: %s", c.name, line)
+			continue
+		}
+		if resp.ID == nil || resp.Method != "" {
+			config.DebugLog("[MCP] Ignoring %s message from %s", resp.Method, c.name)
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[*resp.ID]
+		delete(c.pending, *resp.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+	c.readErr = scanner.Err()
+	if c.readErr == nil {
+		c.readErr = io.EOF
+	}
+	close(c.done)
+}
@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// TestHelperServer is not a real test: when launched by startTestServer it
+// acts as a minimal MCP server on stdin/stdout
+func TestHelperServer(t *testing.T) {
+	if os.Getenv("COMANDA_MCP_TEST_SERVER") != "1" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     *int64                 `json:"id"`
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue // Notifications need no answer
+		}
+
+		var result interface{}
+		switch req.Method {
+		case "initialize":
+			result = map[string]interface{}{"protocolVersion": ProtocolVersion, "capabilities": map[string]interface{}{}}
+		case "tools/list":
+			if req.Params["cursor"] == nil {
+				result = map[string]interface{}{
+					"tools":      []map[string]interface{}{{"name": "echo", "description": "Echo text", "inputSchema": map[string]interface{}{"type": "object"}}},
+					"nextCursor": "page2",
+				}
+			} else {
+				result = map[string]interface{}{"tools": []map[string]interface{}{{"name": "fail", "description": "Always fails"}}}
+			}
+		case "tools/call":
+			args, _ := req.Params["arguments"].(map[string]interface{})
+			if req.Params["name"] == "fail" {
+				result = map[string]interface{}{"isError": true, "content": []map[string]string{{"type": "text", "text": "boom"}}}
+			} else {
+				result = map[string]interface{}{"content": []map[string]string{{"type": "text", "text": fmt.Sprint(args["text"])}}}
+			}
+		case "resources/list":
+			result = map[string]interface{}{"resources": []map[string]string{{"uri": "memo://readme", "name": "Readme"}}}
+		case "resources/read":
+			result = map[string]interface{}{"contents": []map[string]string{{"uri": "memo://readme", "text": "read me"}}}
+		default:
+			resp, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{"code": -32601, "message": "method not found"}})
+			fmt.Println(string(resp))
+			continue
+		}
+		// A server notification interleaved with responses must be skipped by the client
+		fmt.Println(`{"jsonrpc":"2.0","method":"notifications/message","params":{}}`)
+		resp, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+		fmt.Println(string(resp))
+	}
+	os.Exit(0)
+}
+
+func startTestServer(t *testing.T) *Client {
+	t.Helper()
+	cfg := config.MCPServerConfig{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperServer"},
+		Env:     map[string]string{"COMANDA_MCP_TEST_SERVER": "1"},
+	}
+	client, err := Start("memo", cfg, os.Environ())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientTools(t *testing.T) {
+	client := startTestServer(t)
+
+	infos, err := client.ListTools()
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	if len(infos) != 2 || infos[0].Name != "echo" || infos[1].Name != "fail" {
+		t.Fatalf("ListTools() = %+v, want echo and fail across two pages", infos)
+	}
+
+	got, err := client.CallTool("echo", map[string]interface{}{"text": "hi"})
+	if err != nil || got != "hi" {
+		t.Errorf("CallTool(echo) = %q, %v", got, err)
+	}
+	if _, err := client.CallTool("fail", nil); err == nil || err.Error() != "boom" {
+		t.Errorf("CallTool(fail) error = %v, want boom", err)
+	}
+}
+
+func TestAdaptedTools(t *testing.T) {
+	client := startTestServer(t)
+
+	adapted, err := Tools(client)
+	if err != nil {
+		t.Fatalf("Tools() error = %v", err)
+	}
+	names := make(map[string]bool)
+	for _, tool := range adapted {
+		names[tool.Name()] = true
+	}
+	for _, want := range []string{"memo.echo", "memo.fail", "memo.read_resource"} {
+		if !names[want] {
+			t.Errorf("missing adapted tool %s in %v", want, names)
+		}
+	}
+
+	for _, tool := range adapted {
+		if tool.Name() != "memo.read_resource" {
+			continue
+		}
+		if !strings.Contains(tool.Description(), "memo://readme") {
+			t.Errorf("resource tool description %q should list resources", tool.Description())
+		}
+		got, err := tool.Call(map[string]interface{}{"uri": "memo://readme"})
+		if err != nil || got != "read me" {
+			t.Errorf("read_resource = %q, %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/tools"
+)
+
+// maxListedResources caps how many resource URIs are listed in a tool description
+const maxListedResources = 20
+
+// serverTool adapts an MCP tool to the agent tool interface
+type serverTool struct {
+	client *Client
+	info   ToolInfo
+}
+
+func (t *serverTool) Name() string { return t.client.name + "." + t.info.Name }
+
+func (t *serverTool) Description() string {
+	desc := strings.TrimSpace(t.info.Description)
+	if len(t.info.InputSchema) > 0 {
+		desc += " Arguments (JSON schema): " + string(t.info.InputSchema)
+	}
+	return desc
+}
+
+func (t *serverTool) Call(args map[string]interface{}) (string, error) {
+	result, err := t.client.CallTool(t.info.Name, args)
+	if err != nil {
+		return "", err
+	}
+	return tools.Truncate(result), nil
+}
+
+// resourceTool lets an agent read the resources an MCP server exposes
+type resourceTool struct {
+	client    *Client
+	resources []ResourceInfo
+}
+
+func (t *resourceTool) Name() string { return t.client.name + ".read_resource" }
+
+func (t *resourceTool) Description() string {
+	var uris []string
+	for i, r := range t.resources {
+		if i == maxListedResources {
+			uris = append(uris, fmt.Sprintf("... and %d more", len(t.resources)-maxListedResources))
+			break
+		}
+		entry := r.URI
+		if r.Name != "" {
+			entry += " (" + r.Name + ")"
+		}
+		uris = append(uris, entry)
+	}
+	return fmt.Sprintf(`Read a resource from the %s server. Resources: %s. Arguments: {"uri": "..."}`, t.client.name, strings.Join(uris, ", "))
+}
+
+func (t *resourceTool) Call(args map[string]interface{}) (string, error) {
+	uri, ok := args["uri"].(string)
+	if !ok || uri == "" {
+		return "", fmt.Errorf("missing required argument 'uri'")
+	}
+	result, err := t.client.ReadResource(uri)
+	if err != nil {
+		return "", err
+	}
+	return tools.Truncate(result), nil
+}
+
+// Tools returns the server's tools, named "<server>.<tool>", plus a
+// "<server>.read_resource" tool when the server exposes resources
+func Tools(c *Client) ([]tools.Tool, error) {
+	infos, err := c.ListTools()
+	if err != nil {
+		return nil, fmt.Errorf("error listing tools from MCP server %s: %w", c.name, err)
+	}
+	var result []tools.Tool
+	for _, info := range infos {
+		result = append(result, &serverTool{client: c, info: info})
+	}
+
+	// Resources are optional; servers without them answer with an error
+	resources, err := c.ListResources()
+	if err != nil {
+		config.DebugLog("[MCP] Server %s does not list resources: %v", c.name, err)
+	} else if len(resources) > 0 {
+		result = append(result, &resourceTool{client: c, resources: resources})
+	}
+	return result, nil
+}
@@ -9,12 +9,14 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/retry"
 )
 
 // AnthropicProvider handles Anthropic family of models
 type AnthropicProvider struct {
+	retryHook
 	apiKey  string
 	config  ModelConfig
 	verbose bool
@@ -34,8 +36,9 @@ func NewAnthropicProvider() *AnthropicProvider {
 // debugf prints debug information if verbose mode is enabled
 func (a *AnthropicProvider) debugf(format string, args ...interface{}) {
 	if a.verbose {
-		fmt.Printf("[DEBUG][Anthropic] "+format+"\n", args...)
+		config.ConsoleLog("[DEBUG][Anthropic] "+format, args...)
 	}
+	config.WriteLog("[DEBUG][Anthropic] ", format, args...)
 }
 
 // Name returns the provider name
@@ -150,8 +153,7 @@ func (a *AnthropicProvider) SendPrompt(modelName string, prompt string) (string,
 			req.Header.Set("x-api-key", a.apiKey)
 			req.Header.Set("anthropic-version", "2023-06-01")
 
-			client := &http.Client{}
-			resp, err := client.Do(req)
+			resp, err := httpClient.Do(req)
 			if err != nil {
 				return "", fmt.Errorf("failed to send request: %v", err)
 			}
@@ -192,7 +194,7 @@ func (a *AnthropicProvider) SendPrompt(modelName string, prompt string) (string,
 			return response.Content[0].Text, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		a.retryConfig(),
 	)
 
 	if err != nil {
@@ -308,8 +310,7 @@ func (a *AnthropicProvider) SendPromptWithFile(modelName string, prompt string,
 				req.Header.Set("anthropic-beta", "pdfs-2024-09-25")
 			}
 
-			client := &http.Client{}
-			resp, err := client.Do(req)
+			resp, err := httpClient.Do(req)
 			if err != nil {
 				return "", fmt.Errorf("failed to send request: %v", err)
 			}
@@ -350,7 +351,7 @@ func (a *AnthropicProvider) SendPromptWithFile(modelName string, prompt string,
 			return response.Content[0].Text, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		a.retryConfig(),
 	)
 
 	if err != nil {
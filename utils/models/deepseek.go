@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/retry"
 	openai "github.com/sashabaranov/go-openai"
@@ -12,6 +13,7 @@ import (
 
 // DeepseekProvider handles Deepseek family of models
 type DeepseekProvider struct {
+	retryHook
 	apiKey  string
 	config  ModelConfig
 	verbose bool
@@ -37,8 +39,9 @@ func (d *DeepseekProvider) Name() string {
 // debugf prints debug information if verbose mode is enabled
 func (d *DeepseekProvider) debugf(format string, args ...interface{}) {
 	if d.verbose {
-		fmt.Printf("[DEBUG][Deepseek] "+format+"\n", args...)
+		config.ConsoleLog("[DEBUG][Deepseek] "+format, args...)
 	}
+	config.WriteLog("[DEBUG][Deepseek] ", format, args...)
 }
 
 // SupportsModel checks if the given model name is supported by Deepseek
@@ -127,9 +130,7 @@ func (d *DeepseekProvider) SendPrompt(modelName string, prompt string) (string,
 
 	d.debugf("Model validation passed, preparing API call")
 
-	config := openai.DefaultConfig(d.apiKey)
-	config.BaseURL = "https://api.deepseek.com/v1"
-	client := openai.NewClientWithConfig(config)
+	client := newOpenAIClient(d.apiKey, "https://api.deepseek.com/v1")
 
 	// Use retry mechanism for API calls
 	result, err := retry.WithRetry(
@@ -155,7 +156,7 @@ func (d *DeepseekProvider) SendPrompt(modelName string, prompt string) (string,
 			return resp.Choices[0].Message.Content, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		d.retryConfig(),
 	)
 
 	if err != nil {
@@ -187,9 +188,7 @@ func (d *DeepseekProvider) SendPromptWithFile(modelName string, prompt string, f
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
 
-	config := openai.DefaultConfig(d.apiKey)
-	config.BaseURL = "https://api.deepseek.com/v1"
-	client := openai.NewClientWithConfig(config)
+	client := newOpenAIClient(d.apiKey, "https://api.deepseek.com/v1")
 
 	// For image files, handle them using vision capabilities
 	if strings.HasPrefix(file.MimeType, "image/") {
@@ -224,7 +223,7 @@ func (d *DeepseekProvider) SendPromptWithFile(modelName string, prompt string, f
 			return resp.Choices[0].Message.Content, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		d.retryConfig(),
 	)
 
 	if err != nil {
@@ -245,7 +244,7 @@ func (d *DeepseekProvider) handleFileAsVisionWithRetry(client *openai.Client, pr
 			return d.handleFileAsVision(client, prompt, fileData, mimeType, modelName)
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		d.retryConfig(),
 	)
 
 	if err != nil {
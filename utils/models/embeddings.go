@@ -0,0 +1,112 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/retry"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Embedder is implemented by providers that turn text into embedding
+// vectors, for indexing and searching vector stores
+type Embedder interface {
+	Embed(modelName string, texts []string) ([][]float32, error)
+}
+
+// DetectEmbeddingProviderFunc is the type for the embedding provider lookup
+// function
+type DetectEmbeddingProviderFunc func(modelName string) Provider
+
+// DetectEmbeddingProvider returns a new instance of the provider serving an
+// embedding model: OpenAI for its text-embedding models, and otherwise
+// Ollama when the model is pulled locally. It returns nil for other models.
+var DetectEmbeddingProvider DetectEmbeddingProviderFunc = defaultDetectEmbeddingProvider
+
+func defaultDetectEmbeddingProvider(modelName string) Provider {
+	if strings.HasPrefix(strings.ToLower(modelName), "text-embedding-") {
+		return NewOpenAIProvider()
+	}
+	if isModelAvailableLocally(modelName) {
+		return NewOllamaProvider()
+	}
+	return nil
+}
+
+// Embed returns the embeddings of texts, in order
+func (o *OpenAIProvider) Embed(modelName string, texts []string) ([][]float32, error) {
+	o.debugf("Embedding %d texts with %s", len(texts), modelName)
+	client := newOpenAIClient(o.apiKey, "")
+	result, err := retry.WithRetry(
+		func() (interface{}, error) {
+			resp, err := client.CreateEmbeddings(context.Background(), openai.EmbeddingRequestStrings{
+				Input: texts,
+				Model: openai.EmbeddingModel(modelName),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("OpenAI API error: %v", err)
+			}
+			return resp.Data, nil
+		},
+		retry.Is429Error,
+		o.retryConfig(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	data := result.([]openai.Embedding)
+	if len(data) != len(texts) {
+		return nil, fmt.Errorf("OpenAI returned %d embeddings for %d texts", len(data), len(texts))
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Index < data[j].Index })
+	vectors := make([][]float32, len(data))
+	for i, embedding := range data {
+		vectors[i] = embedding.Embedding
+	}
+	return vectors, nil
+}
+
+// ollamaEmbedResponse is the response of Ollama's /api/embed endpoint
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed returns the embeddings of texts, in order
+func (o *OllamaProvider) Embed(modelName string, texts []string) ([][]float32, error) {
+	o.debugf("Embedding %d texts with %s", len(texts), modelName)
+	body, err := json.Marshal(map[string]interface{}{"model": modelName, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	ollamaHost := os.Getenv("OLLAMA_HOST")
+	if ollamaHost == "" {
+		ollamaHost = "http://localhost:11434"
+	}
+	resp, err := ollamaClient.Post(ollamaHost+"/api/embed", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error calling Ollama API: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Ollama response: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var parsed ollamaEmbedResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing Ollama response: %w", err)
+	}
+	if len(parsed.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("Ollama returned %d embeddings for %d texts", len(parsed.Embeddings), len(texts))
+	}
+	return parsed.Embeddings, nil
+}
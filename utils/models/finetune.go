@@ -0,0 +1,264 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Fine-tuning job statuses, the same for every provider
+const (
+	TuningPending   = "pending"
+	TuningRunning   = "running"
+	TuningSucceeded = "succeeded"
+	TuningFailed    = "failed"
+	TuningCancelled = "cancelled"
+)
+
+// Tuner is implemented by providers that fine-tune models on their own
+// servers
+type Tuner interface {
+	StartTuning(req TuningRequest) (TuningJob, error)
+	TuningStatus(jobID string) (TuningJob, error)
+}
+
+// TuningExample is one prompt and the response the tuned model should give
+type TuningExample struct {
+	System   string // Instructions sent with the prompt, if any
+	Prompt   string
+	Response string
+}
+
+// TuningRequest describes a fine-tuning job
+type TuningRequest struct {
+	BaseModel  string
+	Training   []TuningExample
+	Validation []TuningExample // Held out to measure the tuned model; optional
+	Suffix     string          // Added to the tuned model's name
+	Epochs     int             // Passes over the training examples; the provider's default when 0
+}
+
+// TuningJob is the state of a fine-tuning job
+type TuningJob struct {
+	ID     string
+	Status string // One of the Tuning* statuses
+	Model  string // Name of the tuned model, once the job has succeeded
+	Error  string // Why the job failed, when the provider says
+}
+
+// Done reports whether the job has stopped, successfully or not
+func (j TuningJob) Done() bool {
+	return j.Status == TuningSucceeded || j.Status == TuningFailed || j.Status == TuningCancelled
+}
+
+// StartTuning uploads the examples as chat JSONL files and starts a
+// fine-tuning job
+func (o *OpenAIProvider) StartTuning(req TuningRequest) (TuningJob, error) {
+	o.debugf("Fine-tuning %s on %d examples", req.BaseModel, len(req.Training))
+	client := newOpenAIClient(o.apiKey, "")
+	ctx := context.Background()
+	upload := func(name string, examples []TuningExample) (string, error) {
+		data, err := chatJSONL(examples)
+		if err != nil {
+			return "", err
+		}
+		file, err := client.CreateFileBytes(ctx, openai.FileBytesRequest{Name: name, Bytes: data, Purpose: openai.PurposeFineTune})
+		if err != nil {
+			return "", fmt.Errorf("OpenAI API error uploading %s: %v", name, err)
+		}
+		return file.ID, nil
+	}
+
+	jobReq := openai.FineTuningJobRequest{Model: req.BaseModel, Suffix: req.Suffix}
+	var err error
+	if jobReq.TrainingFile, err = upload("training.jsonl", req.Training); err != nil {
+		return TuningJob{}, err
+	}
+	if len(req.Validation) > 0 {
+		if jobReq.ValidationFile, err = upload("validation.jsonl", req.Validation); err != nil {
+			return TuningJob{}, err
+		}
+	}
+	if req.Epochs > 0 {
+		jobReq.Hyperparameters = &openai.Hyperparameters{Epochs: req.Epochs}
+	}
+	job, err := client.CreateFineTuningJob(ctx, jobReq)
+	if err != nil {
+		return TuningJob{}, fmt.Errorf("OpenAI API error: %v", err)
+	}
+	return openAITuningJob(job), nil
+}
+
+// TuningStatus returns the state of a fine-tuning job
+func (o *OpenAIProvider) TuningStatus(jobID string) (TuningJob, error) {
+	client := newOpenAIClient(o.apiKey, "")
+	job, err := client.RetrieveFineTuningJob(context.Background(), jobID)
+	if err != nil {
+		return TuningJob{}, fmt.Errorf("OpenAI API error: %v", err)
+	}
+	return openAITuningJob(job), nil
+}
+
+// openAITuningJob converts an OpenAI fine-tuning job
+func openAITuningJob(job openai.FineTuningJob) TuningJob {
+	status := TuningRunning
+	switch job.Status {
+	case "validating_files", "queued":
+		status = TuningPending
+	case "succeeded":
+		status = TuningSucceeded
+	case "failed":
+		status = TuningFailed
+	case "cancelled":
+		status = TuningCancelled
+	}
+	return TuningJob{ID: job.ID, Status: status, Model: job.FineTunedModel}
+}
+
+// chatJSONL encodes examples in OpenAI's chat fine-tuning format, one
+// conversation per line
+func chatJSONL(examples []TuningExample) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, ex := range examples {
+		var messages []openai.ChatCompletionMessage
+		if ex.System != "" {
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: ex.System})
+		}
+		messages = append(messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: ex.Prompt},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: ex.Response})
+		if err := enc.Encode(map[string]interface{}{"messages": messages}); err != nil {
+			return nil, fmt.Errorf("error encoding training examples: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// googleAPIBase is the Gemini API's endpoint for tuned models
+var googleAPIBase = "https://generativelanguage.googleapis.com/v1beta"
+
+// googleTunedModel is a tuned model as the Gemini API describes it
+type googleTunedModel struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// StartTuning creates a tuned Gemini model from the examples, which are
+// sent inline. The job's ID is the tuned model's name, which becomes usable
+// once the job has succeeded.
+func (g *GoogleProvider) StartTuning(req TuningRequest) (TuningJob, error) {
+	g.debugf("Fine-tuning %s on %d examples", req.BaseModel, len(req.Training))
+	if len(req.Validation) > 0 {
+		return TuningJob{}, fmt.Errorf("Google fine-tuning doesn't take validation examples")
+	}
+	examples := make([]map[string]string, len(req.Training))
+	for i, ex := range req.Training {
+		input := ex.Prompt
+		if ex.System != "" {
+			input = ex.System + "\n\n" + ex.Prompt
+		}
+		examples[i] = map[string]string{"text_input": input, "output": ex.Response}
+	}
+	baseModel := req.BaseModel
+	if !strings.Contains(baseModel, "/") {
+		baseModel = "models/" + baseModel
+	}
+	task := map[string]interface{}{
+		"training_data": map[string]interface{}{"examples": map[string]interface{}{"examples": examples}},
+	}
+	if req.Epochs > 0 {
+		task["hyperparameters"] = map[string]int{"epoch_count": req.Epochs}
+	}
+	body := map[string]interface{}{"base_model": baseModel, "tuning_task": task}
+	if req.Suffix != "" {
+		body["display_name"] = req.Suffix
+	}
+
+	var operation struct {
+		Name     string `json:"name"`
+		Metadata struct {
+			TunedModel string `json:"tunedModel"`
+		} `json:"metadata"`
+	}
+	if err := g.tuningRequest(http.MethodPost, "tunedModels", body, &operation); err != nil {
+		return TuningJob{}, err
+	}
+	id := operation.Metadata.TunedModel
+	if id == "" {
+		id, _, _ = strings.Cut(operation.Name, "/operations/")
+	}
+	if id == "" {
+		return TuningJob{}, fmt.Errorf("Google API returned no tuned model name")
+	}
+	return TuningJob{ID: id, Status: TuningPending}, nil
+}
+
+// TuningStatus returns the state of a tuned model's job
+func (g *GoogleProvider) TuningStatus(jobID string) (TuningJob, error) {
+	var model googleTunedModel
+	if err := g.tuningRequest(http.MethodGet, jobID, nil, &model); err != nil {
+		return TuningJob{}, err
+	}
+	job := TuningJob{ID: jobID}
+	switch model.State {
+	case "ACTIVE":
+		job.Status, job.Model = TuningSucceeded, model.Name
+	case "FAILED":
+		job.Status = TuningFailed
+	case "CREATING":
+		job.Status = TuningRunning
+	default:
+		job.Status = TuningPending
+	}
+	return job, nil
+}
+
+// tuningRequest sends a request to the Gemini API and decodes its answer
+// into out
+func (g *GoogleProvider) tuningRequest(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error encoding request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, googleAPIBase+"/"+path, reader)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", g.apiKey)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Google API error: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading Google API response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("Google API error (%d): %s", resp.StatusCode, apiErr.Error.Message)
+		}
+		return fmt.Errorf("Google API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing Google API response: %w", err)
+	}
+	return nil
+}
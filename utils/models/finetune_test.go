@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChatJSONL(t *testing.T) {
+	data, err := chatJSONL([]TuningExample{
+		{System: "Be brief.", Prompt: "Hi", Response: "Hello"},
+		{Prompt: "Bye", Response: "Goodbye"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		`{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]}`,
+		`{"messages":[{"role":"user","content":"Bye"},{"role":"assistant","content":"Goodbye"}]}`,
+	}
+	if len(lines) != 2 || lines[0] != want[0] || lines[1] != want[1] {
+		t.Errorf("chatJSONL() =\n%s", data)
+	}
+}
+
+func TestGoogleTuning(t *testing.T) {
+	var created map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-goog-api-key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error": {"message": "API key not valid"}}`)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/tunedModels":
+			json.NewDecoder(r.Body).Decode(&created)
+			io.WriteString(w, `{"name": "tunedModels/support-x1/operations/op1", "metadata": {"tunedModel": "tunedModels/support-x1"}}`)
+		case r.URL.Path == "/tunedModels/support-x1":
+			io.WriteString(w, `{"name": "tunedModels/support-x1", "state": "ACTIVE"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error": {"message": "not found"}}`)
+		}
+	}))
+	defer server.Close()
+	previous := googleAPIBase
+	googleAPIBase = server.URL
+	t.Cleanup(func() { googleAPIBase = previous })
+
+	g := NewGoogleProvider()
+	g.Configure("key")
+	job, err := g.StartTuning(TuningRequest{
+		BaseModel: "gemini-1.5-flash-001-tuning", Suffix: "support", Epochs: 3,
+		Training: []TuningExample{{System: "Be brief.", Prompt: "Hi", Response: "Hello"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "tunedModels/support-x1" || job.Status != TuningPending {
+		t.Errorf("StartTuning() = %+v", job)
+	}
+	task, _ := json.Marshal(created["tuning_task"])
+	if created["base_model"] != "models/gemini-1.5-flash-001-tuning" || created["display_name"] != "support" ||
+		!strings.Contains(string(task), `"epoch_count":3`) || !strings.Contains(string(task), `{"output":"Hello","text_input":"Be brief.\n\nHi"}`) {
+		t.Errorf("request = %v", created)
+	}
+
+	job, err = g.TuningStatus("tunedModels/support-x1")
+	if err != nil || job.Status != TuningSucceeded || job.Model != "tunedModels/support-x1" || !job.Done() {
+		t.Errorf("TuningStatus() = %+v, %v", job, err)
+	}
+	if _, err := g.TuningStatus("tunedModels/missing"); err == nil || !strings.Contains(err.Error(), "(404): not found") {
+		t.Errorf("TuningStatus(missing) error = %v", err)
+	}
+}
+
+func TestTunedModelProviders(t *testing.T) {
+	for model, want := range map[string]string{"ft:gpt-4o-mini-2024-07-18:acme:support:abc123": "openai", "tunedModels/support-x1": "google"} {
+		if provider := DetectProvider(model); provider == nil || provider.Name() != want {
+			t.Errorf("DetectProvider(%s) = %v, want %s", model, provider, want)
+		}
+	}
+}
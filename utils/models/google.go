@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/retry"
 	"google.golang.org/api/option"
@@ -13,9 +15,13 @@ import (
 
 // GoogleProvider handles Google AI (Gemini) family of models
 type GoogleProvider struct {
+	retryHook
 	apiKey  string
 	config  ModelConfig
 	verbose bool
+
+	mu     sync.Mutex
+	client *genai.Client // Created on first use and kept so its connections are reused
 }
 
 // NewGoogleProvider creates a new Google provider instance
@@ -37,8 +43,9 @@ func (g *GoogleProvider) Name() string {
 // debugf prints debug information if verbose mode is enabled
 func (g *GoogleProvider) debugf(format string, args ...interface{}) {
 	if g.verbose {
-		fmt.Printf("[DEBUG][Google] "+format+"\n", args...)
+		config.ConsoleLog("[DEBUG][Google] "+format, args...)
 	}
+	config.WriteLog("[DEBUG][Google] ", format, args...)
 }
 
 // ValidateModel checks if the specific Google model variant is valid
@@ -68,11 +75,30 @@ func (g *GoogleProvider) Configure(apiKey string) error {
 	if apiKey == "" {
 		return fmt.Errorf("API key is required for Google provider")
 	}
+	g.mu.Lock()
 	g.apiKey = apiKey
+	g.client = nil
+	g.mu.Unlock()
 	g.debugf("API key configured successfully")
 	return nil
 }
 
+// genaiClient returns the provider's Gemini client, creating it on first
+// use. One client serves every call, rather than one per call, so requests
+// reuse its pooled connections.
+func (g *GoogleProvider) genaiClient(ctx context.Context) (*genai.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.client == nil {
+		client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Google AI client: %v", err)
+		}
+		g.client = client
+	}
+	return g.client, nil
+}
+
 // SendPrompt sends a prompt to the specified model and returns the response
 func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, error) {
 	g.debugf("Preparing to send prompt to model: %s", modelName)
@@ -94,11 +120,10 @@ func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, er
 	result, err := retry.WithRetry(
 		func() (interface{}, error) {
 			ctx := context.Background()
-			client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+			client, err := g.genaiClient(ctx)
 			if err != nil {
-				return "", fmt.Errorf("failed to create Google AI client: %v", err)
+				return "", err
 			}
-			defer client.Close()
 
 			// Initialize the model
 			model := client.GenerativeModel(modelName)
@@ -127,7 +152,7 @@ func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, er
 			return response, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		g.retryConfig(),
 	)
 
 	if err != nil {
@@ -163,11 +188,10 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 	result, err := retry.WithRetry(
 		func() (interface{}, error) {
 			ctx := context.Background()
-			client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+			client, err := g.genaiClient(ctx)
 			if err != nil {
-				return "", fmt.Errorf("failed to create Google AI client: %v", err)
+				return "", err
 			}
-			defer client.Close()
 
 			// Initialize the model
 			model := client.GenerativeModel(modelName)
@@ -205,7 +229,7 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 			return response, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		g.retryConfig(),
 	)
 
 	if err != nil {
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// httpClient sends the providers' API requests. Sharing one client keeps
+// connections to each provider pooled and alive between calls. Requests go
+// through http.DefaultTransport, which comanda sets up from the env
+// config's http settings, as it is when each request is sent.
+var httpClient = &http.Client{}
+
+// ollamaClient sends requests to a local Ollama server, which should answer
+// within 30 seconds
+var ollamaClient = &http.Client{Timeout: 30 * time.Second}
+
+// newOpenAIClient creates a client of an OpenAI-compatible API sending
+// through the shared HTTP client. baseURL is empty for OpenAI itself.
+func newOpenAIClient(apiKey, baseURL string) *openai.Client {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	config.HTTPClient = httpClient
+	return openai.NewClientWithConfig(config)
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/retry"
 	openai "github.com/sashabaranov/go-openai"
@@ -18,6 +19,7 @@ import (
 
 // MoonshotProvider handles Moonshot family of models
 type MoonshotProvider struct {
+	retryHook
 	apiKey  string
 	config  ModelConfig
 	verbose bool
@@ -43,8 +45,9 @@ func (o *MoonshotProvider) Name() string {
 // debugf prints debug information if verbose mode is enabled
 func (o *MoonshotProvider) debugf(format string, args ...interface{}) {
 	if o.verbose {
-		fmt.Printf("[DEBUG][Moonshot] "+format+"\n", args...)
+		config.ConsoleLog("[DEBUG][Moonshot] "+format, args...)
 	}
+	config.WriteLog("[DEBUG][Moonshot] ", format, args...)
 }
 
 // SupportsModel checks if the given model name is supported by Moonshot
@@ -128,9 +131,7 @@ func (o *MoonshotProvider) SendPrompt(modelName string, prompt string) (string,
 	o.debugf("Model validation passed, preparing API call")
 
 	// Create a custom client with the Moonshot base URL
-	config := openai.DefaultConfig(o.apiKey)
-	config.BaseURL = "https://api.moonshot.ai/v1"
-	client := openai.NewClientWithConfig(config)
+	client := newOpenAIClient(o.apiKey, "https://api.moonshot.ai/v1")
 
 	// Use retry mechanism for API calls
 	result, err := retry.WithRetry(
@@ -156,7 +157,7 @@ func (o *MoonshotProvider) SendPrompt(modelName string, prompt string) (string,
 			return resp.Choices[0].Message.Content, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -189,9 +190,7 @@ func (o *MoonshotProvider) SendPromptWithFile(modelName string, prompt string, f
 	}
 
 	// Create a custom client with the Moonshot base URL
-	config := openai.DefaultConfig(o.apiKey)
-	config.BaseURL = "https://api.moonshot.ai/v1"
-	client := openai.NewClientWithConfig(config)
+	client := newOpenAIClient(o.apiKey, "https://api.moonshot.ai/v1")
 
 	// Include the file content as part of the prompt
 	fileContent := string(fileData)
@@ -221,7 +220,7 @@ func (o *MoonshotProvider) SendPromptWithFile(modelName string, prompt string, f
 			return resp.Choices[0].Message.Content, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -452,8 +451,7 @@ func (o *MoonshotProvider) SendPromptWithResponses(config ResponsesConfig) (stri
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.apiKey))
 
 			// Send request
-			client := &http.Client{}
-			resp, err := client.Do(req)
+			resp, err := httpClient.Do(req)
 			if err != nil {
 				return nil, fmt.Errorf("failed to send HTTP request: %w", err)
 			}
@@ -489,7 +487,7 @@ func (o *MoonshotProvider) SendPromptWithResponses(config ResponsesConfig) (stri
 			return responseData, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -552,8 +550,7 @@ func (o *MoonshotProvider) SendPromptWithResponsesStream(config ResponsesConfig,
 	req.Header.Set("Accept", "text/event-stream")
 
 	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send HTTP request: %w", err)
 	}
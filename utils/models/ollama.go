@@ -8,14 +8,15 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
+	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/retry"
 )
 
 // OllamaProvider handles Ollama family of models
 type OllamaProvider struct {
+	retryHook
 	verbose bool
 }
 
@@ -45,8 +46,9 @@ func (o *OllamaProvider) Name() string {
 // debugf prints debug information if verbose mode is enabled
 func (o *OllamaProvider) debugf(format string, args ...interface{}) {
 	if o.verbose {
-		fmt.Printf("[DEBUG][Ollama] "+format+"\n", args...)
+		config.ConsoleLog("[DEBUG][Ollama] "+format, args...)
 	}
+	config.WriteLog("[DEBUG][Ollama] ", format, args...)
 }
 
 // SupportsModel for OllamaProvider. Since we now have proper provider ordering in DetectProvider,
@@ -100,8 +102,7 @@ func (o *OllamaProvider) SendPrompt(modelName string, prompt string) (string, er
 				ollamaHost = "http://localhost:11434"
 			}
 
-			client := &http.Client{Timeout: 30 * time.Second} // Add a 30-second timeout
-			resp, err := client.Post(ollamaHost+"/api/generate", "application/json", bytes.NewBuffer(jsonData))
+			resp, err := ollamaClient.Post(ollamaHost+"/api/generate", "application/json", bytes.NewBuffer(jsonData))
 			if err != nil {
 				o.debugf("Error calling Ollama API: %v", err)
 				return "", fmt.Errorf("error calling Ollama API: %v (is Ollama running?)", err)
@@ -143,7 +144,7 @@ func (o *OllamaProvider) SendPrompt(modelName string, prompt string) (string, er
 			return fullResponse.String(), nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -189,8 +190,7 @@ func (o *OllamaProvider) SendPromptWithFile(modelName string, prompt string, fil
 				ollamaHost = "http://localhost:11434"
 			}
 
-			client := &http.Client{Timeout: 30 * time.Second} // Add a 30-second timeout
-			resp, err := client.Post(ollamaHost+"/api/generate", "application/json", bytes.NewBuffer(jsonData))
+			resp, err := ollamaClient.Post(ollamaHost+"/api/generate", "application/json", bytes.NewBuffer(jsonData))
 			if err != nil {
 				return "", fmt.Errorf("error calling Ollama API: %v", err)
 			}
@@ -227,7 +227,7 @@ func (o *OllamaProvider) SendPromptWithFile(modelName string, prompt string, fil
 			return fullResponse.String(), nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/retry"
 	openai "github.com/sashabaranov/go-openai"
@@ -18,6 +19,7 @@ import (
 
 // OpenAIProvider handles OpenAI family of models
 type OpenAIProvider struct {
+	retryHook
 	apiKey  string
 	config  ModelConfig
 	verbose bool
@@ -43,8 +45,9 @@ func (o *OpenAIProvider) Name() string {
 // debugf prints debug information if verbose mode is enabled
 func (o *OpenAIProvider) debugf(format string, args ...interface{}) {
 	if o.verbose {
-		fmt.Printf("[DEBUG][OpenAI] "+format+"\n", args...)
+		config.ConsoleLog("[DEBUG][OpenAI] "+format, args...)
 	}
+	config.WriteLog("[DEBUG][OpenAI] ", format, args...)
 }
 
 // SupportsModel checks if the given model name is supported by OpenAI
@@ -74,6 +77,7 @@ func (o *OpenAIProvider) SupportsModel(modelName string) bool {
 		"o3-",         // o3 variants  
 		"o4-",         // o4 variants
 		"chatgpt-4o-",
+		"ft:",         // fine-tuned models
 	}
 
 	for _, pattern := range openaiPatterns {
@@ -157,7 +161,7 @@ func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, er
 
 	o.debugf("Model validation passed, preparing API call")
 
-	client := openai.NewClient(o.apiKey)
+	client := newOpenAIClient(o.apiKey, "")
 
 	// Check if this is a vision input by looking for base64 image data
 	if strings.HasPrefix(modelName, "gpt-4") && strings.Contains(prompt, ";base64,") {
@@ -188,7 +192,7 @@ func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, er
 			return resp.Choices[0].Message.Content, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -209,7 +213,7 @@ func (o *OpenAIProvider) handleVisionPromptWithRetry(client *openai.Client, prom
 			return o.handleVisionPrompt(client, prompt, modelName)
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -238,7 +242,7 @@ func (o *OpenAIProvider) SendPromptWithFile(modelName string, prompt string, fil
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
 
-	client := openai.NewClient(o.apiKey)
+	client := newOpenAIClient(o.apiKey, "")
 
 	// For GPT-4 Vision, handle image files
 	if strings.HasPrefix(modelName, "gpt-4") && strings.HasPrefix(file.MimeType, "image/") {
@@ -273,7 +277,7 @@ func (o *OpenAIProvider) SendPromptWithFile(modelName string, prompt string, fil
 			return resp.Choices[0].Message.Content, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -294,7 +298,7 @@ func (o *OpenAIProvider) handleFileAsVisionWithRetry(client *openai.Client, prom
 			return o.handleFileAsVision(client, prompt, fileData, mimeType, modelName)
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -623,8 +627,7 @@ func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.apiKey))
 
 			// Send request
-			client := &http.Client{}
-			resp, err := client.Do(req)
+			resp, err := httpClient.Do(req)
 			if err != nil {
 				return nil, fmt.Errorf("failed to send HTTP request: %w", err)
 			}
@@ -660,7 +663,7 @@ func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string
 			return responseData, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		o.retryConfig(),
 	)
 
 	if err != nil {
@@ -729,8 +732,7 @@ func (o *OpenAIProvider) SendPromptWithResponsesStream(config ResponsesConfig, h
 	req.Header.Set("Accept", "text/event-stream")
 
 	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send HTTP request: %w", err)
 	}
@@ -0,0 +1,117 @@
+package models
+
+import "strings"
+
+// Price is the list price of a model in US dollars per million tokens
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// modelPrices maps model name prefixes to list prices. Lookups use the
+// longest matching prefix so dated snapshots share their family's price.
+var modelPrices = map[string]Price{
+	"gpt-4o":            {Input: 2.50, Output: 10.00},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.60},
+	"gpt-4.1":           {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini":      {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":      {Input: 0.10, Output: 0.40},
+	"gpt-4-turbo":       {Input: 10.00, Output: 30.00},
+	"gpt-5":             {Input: 1.25, Output: 10.00},
+	"gpt-5-mini":        {Input: 0.25, Output: 2.00},
+	"gpt-5-nano":        {Input: 0.05, Output: 0.40},
+	"o1":                {Input: 15.00, Output: 60.00},
+	"o1-mini":           {Input: 1.10, Output: 4.40},
+	"o3":                {Input: 2.00, Output: 8.00},
+	"o3-mini":           {Input: 1.10, Output: 4.40},
+	"o4-mini":           {Input: 1.10, Output: 4.40},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4.00},
+	"claude-3-5-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-3-7-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-sonnet-4":   {Input: 3.00, Output: 15.00},
+	"claude-opus-4":     {Input: 15.00, Output: 75.00},
+	"gemini-1.5-flash":  {Input: 0.075, Output: 0.30},
+	"gemini-1.5-pro":    {Input: 1.25, Output: 5.00},
+	"gemini-2.0-flash":  {Input: 0.10, Output: 0.40},
+	"gemini-2.5-flash":  {Input: 0.30, Output: 2.50},
+	"gemini-2.5-pro":    {Input: 1.25, Output: 10.00},
+	"deepseek-chat":     {Input: 0.27, Output: 1.10},
+	"deepseek-reasoner": {Input: 0.55, Output: 2.19},
+	"grok-3":            {Input: 3.00, Output: 15.00},
+	"grok-3-mini":       {Input: 0.30, Output: 0.50},
+	"grok-4":            {Input: 3.00, Output: 15.00},
+}
+
+// contextWindows maps model name prefixes to context window sizes in tokens
+var contextWindows = map[string]int{
+	"gpt-4o":           128000,
+	"chatgpt-4o":       128000,
+	"gpt-4.1":          1047576,
+	"gpt-4-turbo":      128000,
+	"gpt-5":            400000,
+	"o1":               200000,
+	"o1-mini":          128000,
+	"o1-preview":       128000,
+	"o3":               200000,
+	"o4-mini":          200000,
+	"claude-3-5":       200000,
+	"claude-3-7":       200000,
+	"claude-sonnet-4":  200000,
+	"claude-opus-4":    200000,
+	"gemini-1.0-pro":   32760,
+	"gemini-1.5-flash": 1048576,
+	"gemini-1.5-pro":   2097152,
+	"gemini-2.0-flash": 1048576,
+	"gemini-2.5":       1048576,
+	"deepseek":         65536,
+	"grok-beta":        131072,
+	"grok-vision-beta": 8192,
+	"grok-3":           131072,
+	"grok-4":           256000,
+	"moonshot-v1-8k":   8192,
+	"moonshot-v1-32k":  32768,
+	"moonshot-v1-128k": 131072,
+	"moonshot-v1-auto": 131072,
+}
+
+// PriceFor returns the list price of a model. Local models and models
+// missing from the table report false.
+func PriceFor(modelName string) (Price, bool) {
+	prefix, ok := longestPrefix(modelName, modelPrices)
+	if !ok {
+		return Price{}, false
+	}
+	return modelPrices[prefix], true
+}
+
+// ContextWindow returns the maximum number of tokens a model accepts, and
+// false when it is unknown
+func ContextWindow(modelName string) (int, bool) {
+	prefix, ok := longestPrefix(modelName, contextWindows)
+	if !ok {
+		return 0, false
+	}
+	return contextWindows[prefix], true
+}
+
+// longestPrefix finds the longest key of table that prefixes the model name
+func longestPrefix[T any](modelName string, table map[string]T) (string, bool) {
+	modelName = strings.TrimSpace(strings.ToLower(modelName))
+	var best string
+	for prefix := range table {
+		if strings.HasPrefix(modelName, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	return best, best != ""
+}
+
+// EstimateCost returns the cost in US dollars of a request with the given
+// token counts, and false when the model's price is unknown
+func EstimateCost(modelName string, promptTokens, completionTokens int) (float64, bool) {
+	price, ok := PriceFor(modelName)
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6, true
+}
@@ -186,3 +186,55 @@ func defaultDetectProvider(modelName string) Provider {
 	config.DebugLog("[Provider] No third-party provider found, using Ollama as fallback for model %s", modelName)
 	return ollamaProvider
 }
+
+// ProviderByNameFunc is the type for the provider lookup function
+type ProviderByNameFunc func(providerName string) Provider
+
+// ProviderByName returns a new provider instance for a provider name, or nil if unknown
+var ProviderByName ProviderByNameFunc = defaultProviderByName
+
+// defaultProviderByName is the default implementation of ProviderByName
+func defaultProviderByName(providerName string) Provider {
+	switch strings.ToLower(providerName) {
+	case "openai":
+		return NewOpenAIProvider()
+	case "anthropic":
+		return NewAnthropicProvider()
+	case "google":
+		return NewGoogleProvider()
+	case "xai":
+		return NewXAIProvider()
+	case "deepseek":
+		return NewDeepseekProvider()
+	case "moonshot":
+		return NewMoonshotProvider()
+	case "ollama":
+		return NewOllamaProvider()
+	}
+	return nil
+}
+
+// DetectProviderWithPriority tries providers in the given order before falling
+// back to DetectProvider. Ollama only matches models that are pulled locally,
+// so listing it first prefers local models without it swallowing unknown names.
+func DetectProviderWithPriority(modelName string, priority []string) Provider {
+	for _, providerName := range priority {
+		provider := ProviderByName(providerName)
+		if provider == nil {
+			config.DebugLog("[Provider] Ignoring unknown provider %s in priority list", providerName)
+			continue
+		}
+		if provider.Name() == "ollama" {
+			if isModelAvailableLocally(modelName) {
+				config.DebugLog("[Provider] Priority match: ollama for model %s", modelName)
+				return provider
+			}
+			continue
+		}
+		if provider.SupportsModel(modelName) {
+			config.DebugLog("[Provider] Priority match: %s for model %s", provider.Name(), modelName)
+			return provider
+		}
+	}
+	return DetectProvider(modelName)
+}
@@ -97,6 +97,7 @@ func (r *ModelRegistry) initializeDefaultModels() {
 	r.RegisterFamilies("google", []string{
 		"gemini-1.5",
 		"gemini-2.5",
+		"tunedmodels/", // Fine-tuned models
 	})
 
 	// Moonshot models
@@ -193,3 +194,45 @@ func (r *ModelRegistry) GetAllModelsList() []string {
 func GetRegistry() *ModelRegistry {
 	return globalRegistry
 }
+
+// deprecatedModels maps retired or deprecated model names to a suggested replacement
+var deprecatedModels = map[string]string{
+	"gpt-3.5-turbo-0301":       "gpt-4o-mini",
+	"gpt-3.5-turbo-0613":       "gpt-4o-mini",
+	"gpt-4-32k":                "gpt-4.1",
+	"gpt-4-vision-preview":     "gpt-4o",
+	"gpt-4.5-preview":          "gpt-4.1",
+	"o1-preview":               "o1",
+	"o1-mini":                  "o3-mini",
+	"text-davinci-003":         "gpt-4o-mini",
+	"claude-2.0":               "claude-sonnet-4-20250514",
+	"claude-2.1":               "claude-sonnet-4-20250514",
+	"claude-instant-1.2":       "claude-3-5-haiku-latest",
+	"claude-3-sonnet-20240229": "claude-sonnet-4-20250514",
+	"claude-3-opus-20240229":   "claude-opus-4-20250514",
+	"gemini-pro":               "gemini-2.5-flash",
+	"gemini-1.0-pro":           "gemini-2.5-flash",
+	"gemini-1.5-pro":           "gemini-2.5-pro",
+	"gemini-1.5-flash":         "gemini-2.5-flash",
+	"grok-beta":                "grok-4",
+	"grok-vision-beta":         "grok-4",
+}
+
+// DeprecatedReplacement reports whether a model is deprecated and, if so,
+// the model suggested in its place
+func DeprecatedReplacement(modelName string) (string, bool) {
+	replacement, ok := deprecatedModels[strings.TrimSpace(strings.ToLower(modelName))]
+	return replacement, ok
+}
+
+// IsReasoningModel reports whether a model uses fixed sampling and ignores
+// temperature and top_p (OpenAI o-series and GPT-5, DeepSeek reasoner)
+func IsReasoningModel(modelName string) bool {
+	modelName = strings.TrimSpace(strings.ToLower(modelName))
+	for _, prefix := range []string{"o1", "o3", "o4-", "gpt-5", "deepseek-reasoner"} {
+		if strings.HasPrefix(modelName, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package models
+
+import "github.com/kris-hansen/comanda/utils/retry"
+
+// RetryReporter is implemented by providers that can report their retries
+// to a caller, such as the processor showing them as progress
+type RetryReporter interface {
+	SetRetryHook(hook func(retry.Attempt))
+}
+
+// retryHook is embedded in providers to implement RetryReporter
+type retryHook struct {
+	onRetry func(retry.Attempt)
+}
+
+// SetRetryHook sets the function told about each retry. With no hook,
+// retries are printed to the console.
+func (h *retryHook) SetRetryHook(hook func(retry.Attempt)) {
+	h.onRetry = hook
+}
+
+// retryConfig returns the default retry configuration reporting to the hook
+func (h *retryHook) retryConfig() retry.RetryConfig {
+	config := retry.DefaultRetryConfig
+	config.OnRetry = h.onRetry
+	return config
+}
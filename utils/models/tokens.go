@@ -0,0 +1,74 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ImageTokens is the estimated prompt size of one image input. Providers
+// scale images to a tile budget, which lands near this for typical inputs.
+const ImageTokens = 1000
+
+// pretokenizer splits text the way byte-pair tokenizers do before merging:
+// contractions, words with their leading space, numbers of up to three
+// digits, punctuation runs and whitespace
+var pretokenizer = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// tokenScale corrects for tokenizer families that produce more tokens than
+// OpenAI's for the same text, keyed by model name prefix
+var tokenScale = map[string]float64{
+	"claude":   1.15,
+	"gemini":   1.05,
+	"deepseek": 1.05,
+	"moonshot": 1.05,
+}
+
+// CountTokens estimates how many tokens a model's tokenizer produces for
+// text. It pre-tokenizes like the providers' byte-pair tokenizers and costs
+// each piece by its length and script. The providers' vocabularies are not
+// bundled, so this is an estimate, but it tracks the real count far better
+// than a flat characters-per-token ratio for code, numbers and non-Latin
+// scripts.
+func CountTokens(modelName, text string) int {
+	count := 0
+	for _, piece := range pretokenizer.FindAllString(text, -1) {
+		count += pieceTokens(piece)
+	}
+	if prefix, ok := longestPrefix(modelName, tokenScale); ok {
+		count = int(float64(count)*tokenScale[prefix] + 0.5)
+	}
+	return count
+}
+
+// pieceTokens estimates the tokens of one pre-tokenized piece
+func pieceTokens(piece string) int {
+	word := strings.TrimLeftFunc(piece, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	first, _ := utf8.DecodeRuneInString(word)
+	switch {
+	case strings.TrimSpace(piece) == "":
+		return 1 // Whitespace runs, such as indentation, are one token
+	case word == "":
+		// Punctuation runs merge into few tokens
+		return (utf8.RuneCountInString(strings.TrimSpace(piece)) + 1) / 2
+	case unicode.IsDigit(first):
+		return 1 // Numbers are split into groups of up to three digits
+	case len(word) == utf8.RuneCountInString(word):
+		// ASCII words: common words are one token, long ones split
+		if n := len(word); n > 8 {
+			return (n + 4) / 5
+		}
+		return 1
+	}
+
+	tokens := 0
+	for _, r := range word {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			tokens += 3 // Counted in thirds: CJK characters are about a token each
+		} else {
+			tokens++ // Other scripts average about three characters per token
+		}
+	}
+	return (tokens + 2) / 3
+}
@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		text     string
+		min, max int
+	}{
+		{"", 0, 0},
+		{"Hello, world!", 3, 5},
+		{"The quick brown fox jumps over the lazy dog.", 9, 11},
+		{"func main() {\n\tfmt.Println(\"hi\")\n}\n", 8, 14},
+		{"1234567890", 4, 4},
+		{"日本語のテキストです", 8, 12},
+	}
+	for _, tt := range tests {
+		if got := CountTokens("gpt-4o", tt.text); got < tt.min || got > tt.max {
+			t.Errorf("CountTokens(%q) = %d, want %d-%d", tt.text, got, tt.min, tt.max)
+		}
+	}
+
+	text := "The quarterly report shows steady growth across every region."
+	if CountTokens("claude-3-5-sonnet-latest", text) <= CountTokens("gpt-4o", text) {
+		t.Error("expected Claude models to count more tokens than OpenAI models")
+	}
+}
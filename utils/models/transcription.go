@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/retry"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// MaxAudioSize is the largest recording transcribed in one request
+const MaxAudioSize = 25 << 20
+
+// AudioExtensions are the recording formats transcription models accept
+var AudioExtensions = []string{".flac", ".m4a", ".mp3", ".mp4", ".mpeg", ".mpga", ".oga", ".ogg", ".wav", ".webm"}
+
+// IsAudioFile reports whether a file is a recording, by its extension
+func IsAudioFile(path string) bool {
+	return slices.Contains(AudioExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// Transcriber is implemented by providers that turn recorded speech into
+// text
+type Transcriber interface {
+	Transcribe(modelName, path string, opts TranscribeOptions) (string, error)
+}
+
+// TranscribeOptions tune a transcription
+type TranscribeOptions struct {
+	Language   string // ISO-639-1 code of the spoken language; detected when empty
+	Prompt     string // Names and terms the recording uses, spelled as they should be
+	Timestamps bool   // Start each segment on a line of its own with its start time
+}
+
+// DetectTranscriptionProviderFunc is the type for the transcription
+// provider lookup function
+type DetectTranscriptionProviderFunc func(modelName string) Provider
+
+// DetectTranscriptionProvider returns a new instance of the provider
+// serving a transcription model: OpenAI for whisper-1 and its -transcribe
+// models. It returns nil for other models.
+var DetectTranscriptionProvider DetectTranscriptionProviderFunc = defaultDetectTranscriptionProvider
+
+func defaultDetectTranscriptionProvider(modelName string) Provider {
+	name := strings.ToLower(modelName)
+	if strings.HasPrefix(name, "whisper-") || strings.HasSuffix(name, "-transcribe") {
+		return NewOpenAIProvider()
+	}
+	return nil
+}
+
+// Transcribe returns the text spoken in a recording
+func (o *OpenAIProvider) Transcribe(modelName, path string, opts TranscribeOptions) (string, error) {
+	o.debugf("Transcribing %s with %s", path, modelName)
+	req := openai.AudioRequest{
+		Model:    modelName,
+		FilePath: path,
+		Language: opts.Language,
+		Prompt:   opts.Prompt,
+		Format:   openai.AudioResponseFormatJSON,
+	}
+	if opts.Timestamps {
+		// Only whisper-1 returns segments; other models return the text alone
+		req.Format = openai.AudioResponseFormatVerboseJSON
+		req.TimestampGranularities = []openai.TranscriptionTimestampGranularity{openai.TranscriptionTimestampGranularitySegment}
+	}
+	client := newOpenAIClient(o.apiKey, "")
+	result, err := retry.WithRetry(
+		func() (interface{}, error) {
+			resp, err := client.CreateTranscription(context.Background(), req)
+			if err != nil {
+				return nil, fmt.Errorf("OpenAI API error: %v", err)
+			}
+			return resp, nil
+		},
+		retry.Is429Error,
+		o.retryConfig(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	resp := result.(openai.AudioResponse)
+	if !opts.Timestamps || len(resp.Segments) == 0 {
+		return strings.TrimSpace(resp.Text), nil
+	}
+	segments := make([]Segment, len(resp.Segments))
+	for i, s := range resp.Segments {
+		segments[i] = Segment{Start: s.Start, Text: s.Text}
+	}
+	return FormatSegments(segments), nil
+}
+
+// Segment is a stretch of a transcript and when it starts, in seconds
+type Segment struct {
+	Start float64
+	Text  string
+}
+
+// FormatSegments writes each segment on a line of its own, after its start
+// time as [mm:ss], or [h:mm:ss] past the first hour
+func FormatSegments(segments []Segment) string {
+	var b strings.Builder
+	for _, s := range segments {
+		text := strings.TrimSpace(s.Text)
+		if text == "" {
+			continue
+		}
+		seconds := int(s.Start)
+		stamp := fmt.Sprintf("%02d:%02d", seconds/60%60, seconds%60)
+		if seconds >= 3600 {
+			stamp = fmt.Sprintf("%d:%s", seconds/3600, stamp)
+		}
+		fmt.Fprintf(&b, "[%s] %s\n", stamp, text)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestFormatSegments(t *testing.T) {
+	got := FormatSegments([]Segment{
+		{Start: 0, Text: " Welcome, everyone."},
+		{Start: 75.4, Text: "  "},
+		{Start: 75.6, Text: "First, the budget."},
+		{Start: 3725, Text: "Thanks for joining."},
+	})
+	want := "[00:00] Welcome, everyone.\n[01:15] First, the budget.\n[1:02:05] Thanks for joining."
+	if got != want {
+		t.Errorf("FormatSegments() = %q, want %q", got, want)
+	}
+}
+
+func TestDetectTranscriptionProvider(t *testing.T) {
+	for model, want := range map[string]bool{"whisper-1": true, "gpt-4o-transcribe": true, "gpt-4o-mini-transcribe": true, "gpt-4o": false} {
+		if got := defaultDetectTranscriptionProvider(model) != nil; got != want {
+			t.Errorf("defaultDetectTranscriptionProvider(%s) found a provider: %v, want %v", model, got, want)
+		}
+	}
+	if !IsAudioFile("standup.M4A") || IsAudioFile("notes.txt") {
+		t.Error("IsAudioFile() doesn't tell recordings by their extension")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/retry"
 	openai "github.com/sashabaranov/go-openai"
@@ -13,6 +14,7 @@ import (
 
 // XAIProvider handles X.AI family of models
 type XAIProvider struct {
+	retryHook
 	apiKey  string
 	config  ModelConfig
 	verbose bool
@@ -45,8 +47,9 @@ func (x *XAIProvider) Name() string {
 // debugf prints debug information if verbose mode is enabled
 func (x *XAIProvider) debugf(format string, args ...interface{}) {
 	if x.verbose {
-		fmt.Printf("[DEBUG][XAI] "+format+"\n", args...)
+		config.ConsoleLog("[DEBUG][XAI] "+format, args...)
 	}
+	config.WriteLog("[DEBUG][XAI] ", format, args...)
 }
 
 // SupportsModel checks if the given model name is supported by X.AI
@@ -121,9 +124,7 @@ func (x *XAIProvider) SendPrompt(modelName string, prompt string) (string, error
 	x.debugf("Using configuration: Temperature=%.2f, MaxTokens=%d, TopP=%.2f",
 		x.config.Temperature, x.config.MaxTokens, x.config.TopP)
 
-	config := openai.DefaultConfig(x.apiKey)
-	config.BaseURL = "https://api.x.ai/v1"
-	client := openai.NewClientWithConfig(config)
+	client := newOpenAIClient(x.apiKey, "https://api.x.ai/v1")
 
 	// Use retry mechanism for API calls
 	result, err := retry.WithRetry(
@@ -162,7 +163,7 @@ func (x *XAIProvider) SendPrompt(modelName string, prompt string) (string, error
 			return resp.Choices[0].Message.Content, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		x.retryConfig(),
 	)
 
 	if err != nil {
@@ -194,9 +195,7 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
 
-	config := openai.DefaultConfig(x.apiKey)
-	config.BaseURL = "https://api.x.ai/v1"
-	client := openai.NewClientWithConfig(config)
+	client := newOpenAIClient(x.apiKey, "https://api.x.ai/v1")
 
 	// For image files, use MultiContent approach similar to OpenAI
 	if strings.HasPrefix(file.MimeType, "image/") {
@@ -250,7 +249,7 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 				return resp.Choices[0].Message.Content, nil
 			},
 			retry.Is429Error,
-			retry.DefaultRetryConfig,
+			x.retryConfig(),
 		)
 
 		if err != nil {
@@ -310,7 +309,7 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 			return resp.Choices[0].Message.Content, nil
 		},
 		retry.Is429Error,
-		retry.DefaultRetryConfig,
+		x.retryConfig(),
 	)
 
 	if err != nil {
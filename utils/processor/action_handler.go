@@ -11,7 +11,7 @@ import (
 )
 
 // processActions handles the action section of the DSL
-func (p *Processor) processActions(modelNames []string, actions []string) (string, error) {
+func (p *Processor) processActions(stepName string, modelNames []string, actions []string) (string, error) {
 	if len(modelNames) == 0 {
 		return "", fmt.Errorf("no model specified for actions")
 	}
@@ -30,21 +30,18 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 		// For NA model, concatenate all input contents
 		var contents []string
 		for _, inputItem := range inputs {
-			contents = append(contents, string(inputItem.Contents))
+			data, err := inputItem.Load()
+			if err != nil {
+				return "", err
+			}
+			contents = append(contents, string(data))
 		}
 		return strings.Join(contents, "\n"), nil
 	}
 
-	// Get provider by detecting it from the model name
-	provider := models.DetectProvider(modelName)
-	if provider == nil {
-		return "", fmt.Errorf("provider not found for model: %s", modelName)
-	}
-
-	// Use the configured provider instance
-	configuredProvider := p.providers[provider.Name()]
-	if configuredProvider == nil {
-		return "", fmt.Errorf("provider %s not configured", provider.Name())
+	configuredProvider, err := p.stepProvider(stepName, modelName)
+	if err != nil {
+		return "", err
 	}
 
 	p.debugf("Using model %s with provider %s", modelName, configuredProvider.Name())
@@ -53,14 +50,9 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 	for i, action := range actions {
 		p.debugf("Processing action %d/%d: %s", i+1, len(actions), action)
 
-		// Check if action is a markdown file
-		if strings.HasSuffix(strings.ToLower(action), ".md") {
-			content, err := fileutil.SafeReadFile(action)
-			if err != nil {
-				return "", fmt.Errorf("failed to read markdown file %s: %w", action, err)
-			}
-			action = string(content)
-			p.debugf("Loaded action content from markdown file: %s", action)
+		action, err := p.loadAction(action)
+		if err != nil {
+			return "", err
 		}
 
 		inputs := p.handler.GetInputs()
@@ -150,6 +142,10 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 
 			for i, file := range fileInputs {
 				p.debugf("Processing file %d/%d: %s", i+1, len(fileInputs), file.Path)
+				if err := p.interrupted(); err != nil {
+					return "", err
+				}
+				p.emitChunk(stepName, i+1, len(fileInputs))
 
 				// Try to process each file individually
 				result, err := configuredProvider.SendPromptWithFile(modelName,
@@ -195,3 +191,34 @@ func (p *Processor) processActions(modelNames []string, actions []string) (strin
 
 	return "", fmt.Errorf("no actions processed")
 }
+
+// stepProvider returns the configured provider of modelName, wrapped to
+// cache, trace and debug the step's prompts
+func (p *Processor) stepProvider(stepName, modelName string) (models.Provider, error) {
+	// Get provider by detecting it from the model name
+	provider := p.detectProvider(modelName)
+	if provider == nil {
+		return nil, fmt.Errorf("provider not found for model: %s", modelName)
+	}
+
+	// Use the configured provider instance
+	configuredProvider := p.providers[provider.Name()]
+	if configuredProvider == nil {
+		return nil, fmt.Errorf("provider %s not configured", provider.Name())
+	}
+	return p.debugProvider(stepName, p.traceProvider(stepName, p.cacheProvider(configuredProvider))), nil
+}
+
+// loadAction returns an action, or the contents of the markdown file it
+// names
+func (p *Processor) loadAction(action string) (string, error) {
+	if !strings.HasSuffix(strings.ToLower(action), ".md") {
+		return action, nil
+	}
+	content, err := fileutil.SafeReadFile(action)
+	if err != nil {
+		return "", fmt.Errorf("failed to read markdown file %s: %w", action, err)
+	}
+	p.debugf("Loaded action content from markdown file: %s", content)
+	return string(content), nil
+}
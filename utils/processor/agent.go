@@ -0,0 +1,354 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/tools"
+)
+
+// Agent step defaults
+const (
+	defaultAgentMaxIterations = 10
+	defaultAgentMaxTokens     = 100000
+)
+
+// AgentConfig configures a `type: agent` step's tools and guards
+type AgentConfig struct {
+	Tools           []string `yaml:"tools"`            // Allow-list of tools: http, shell, file_read, file_write, retrieval
+	MaxIterations   int      `yaml:"max_iterations"`   // Maximum model calls before giving up (default 10)
+	MaxTokens       int      `yaml:"max_tokens"`       // Budget of estimated prompt+response tokens across iterations (default 100000)
+	AllowedCommands []string `yaml:"allowed_commands"` // Commands the shell tool may run
+	AllowedHosts    []string `yaml:"allowed_hosts"`    // Hosts the http tool may call, including through redirects
+	RetrievalPaths  []string `yaml:"retrieval_paths"`  // Files or directories searched by the retrieval tool
+	MCPServers      []string `yaml:"mcp_servers"`      // MCP servers from the env config whose tools are offered
+}
+
+// agentReply is the JSON object the model answers with on each iteration
+type agentReply struct {
+	Tool  string                 `json:"tool"`
+	Args  map[string]interface{} `json:"args"`
+	Final *string                `json:"final"`
+}
+
+// validateAgentConfig checks an agent step's configuration
+func (p *Processor) validateAgentConfig(cfg *AgentConfig, modelNames []string) []string {
+	var errors []string
+	if len(modelNames) != 1 || modelNames[0] == "NA" {
+		errors = append(errors, "an agent step requires exactly one model")
+	}
+	if cfg == nil {
+		return errors
+	}
+	for _, name := range cfg.Tools {
+		switch name {
+		case "file_read", "file_write":
+		case "http":
+			if len(cfg.AllowedHosts) == 0 {
+				errors = append(errors, "the http tool requires 'allowed_hosts'")
+			}
+		case "shell":
+			if len(cfg.AllowedCommands) == 0 {
+				errors = append(errors, "the shell tool requires 'allowed_commands'")
+			}
+			if p.inServer() {
+				errors = append(errors, serverShellErrors(cfg.AllowedCommands, p.serverConfig.AgentTools.ShellCommands)...)
+			}
+		case "retrieval":
+			if len(cfg.RetrievalPaths) == 0 {
+				errors = append(errors, "the retrieval tool requires 'retrieval_paths'")
+			}
+		default:
+			errors = append(errors, fmt.Sprintf("unknown agent tool '%s'", name))
+		}
+	}
+	for _, name := range cfg.MCPServers {
+		if p.envConfig == nil || p.envConfig.MCPServers[name].Command == "" {
+			errors = append(errors, fmt.Sprintf("MCP server '%s' is not configured in the env file", name))
+		}
+	}
+	if cfg.MaxIterations < 0 || cfg.MaxTokens < 0 {
+		errors = append(errors, "'max_iterations' and 'max_tokens' cannot be negative")
+	}
+	return errors
+}
+
+// inServer reports whether the workflow runs in the server, where it may
+// come from any client and agent tools are limited by the server's settings
+func (p *Processor) inServer() bool {
+	return p.serverConfig != nil && p.serverConfig.DataDir != ""
+}
+
+// serverShellErrors reports the commands a step allows that the server
+// doesn't
+func serverShellErrors(commands, serverCommands []string) []string {
+	if len(serverCommands) == 0 {
+		return []string{"the shell tool is turned off in server runs; list the commands it may run in the server's agentTools.shellCommands"}
+	}
+	allowed := serverShellCommands(commands, serverCommands)
+	var errors []string
+	for _, command := range commands {
+		if !slices.Contains(allowed, command) {
+			errors = append(errors, fmt.Sprintf("shell command '%s' is not in the server's agentTools.shellCommands", command))
+		}
+	}
+	return errors
+}
+
+// serverShellCommands returns the commands a step allows that the server
+// allows too
+func serverShellCommands(commands, serverCommands []string) []string {
+	var allowed []string
+	for _, command := range commands {
+		if slices.Contains(serverCommands, command) {
+			allowed = append(allowed, command)
+		}
+	}
+	return allowed
+}
+
+// agentTools builds the allow-listed tools for an agent step
+func (p *Processor) agentTools(cfg *AgentConfig) map[string]tools.Tool {
+	available := make(map[string]tools.Tool)
+	if cfg == nil {
+		return available
+	}
+	dir := ""
+	if sb := p.getSandbox(); sb != nil {
+		dir = sb.Root()
+	}
+	for _, name := range cfg.Tools {
+		switch name {
+		case "http":
+			blockPrivate := p.inServer() && !p.serverConfig.AgentTools.AllowPrivateHosts
+			available[name] = tools.NewHTTPTool(cfg.AllowedHosts, blockPrivate)
+		case "shell":
+			commands := cfg.AllowedCommands
+			if p.inServer() {
+				commands = serverShellCommands(commands, p.serverConfig.AgentTools.ShellCommands)
+			}
+			if len(commands) > 0 {
+				available[name] = tools.NewShellTool(commands, dir, p.Environ())
+			}
+		case "file_read":
+			available[name] = tools.NewFileReadTool(p.confinePath)
+		case "file_write":
+			available[name] = tools.NewFileWriteTool(p.confinePath)
+		case "retrieval":
+			available[name] = tools.NewRetrievalTool(cfg.RetrievalPaths, p.confinePath)
+		}
+	}
+	return available
+}
+
+// processAgentStep lets the model call tools in a loop until it returns a final answer
+func (p *Processor) processAgentStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	modelName := p.NormalizeStringSlice(step.Config.Model)[0]
+	actions := p.NormalizeStringSlice(step.Config.Action)
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: strings.Join(actions, "\n")}
+	emit := func(msg string) {
+		if isParallel {
+			p.emitParallelProgress(msg, stepInfo, parallelID)
+		} else {
+			p.emitProgress(msg, stepInfo)
+		}
+	}
+	emit(fmt.Sprintf("Starting agent step: %s", step.Name))
+
+	cfg := step.Config.Agent
+	if cfg == nil {
+		cfg = &AgentConfig{}
+	}
+	maxIterations := cfg.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = defaultAgentMaxIterations
+	}
+	maxTokens := cfg.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultAgentMaxTokens
+	}
+
+	inputText, err := p.agentInput(step)
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.validateModel([]string{modelName}, nil); err != nil {
+		return "", fmt.Errorf("model validation error: %w", err)
+	}
+	if err := p.configureProviders(); err != nil {
+		return "", fmt.Errorf("provider configuration error: %w", err)
+	}
+	provider := p.GetModelProvider(modelName)
+	if provider == nil {
+		return "", fmt.Errorf("provider not configured for model %s", modelName)
+	}
+
+	available := p.agentTools(cfg)
+	serverTools, err := p.mcpTools(cfg.MCPServers)
+	if err != nil {
+		return "", err
+	}
+	for name, tool := range serverTools {
+		available[name] = tool
+	}
+
+	var transcript []string
+	usedTokens := 0
+	for iteration := 1; iteration <= maxIterations; iteration++ {
+		if err := p.interrupted(); err != nil {
+			return "", err
+		}
+		prompt := buildAgentPrompt(actions, inputText, available, transcript)
+		reply, err := p.traceProvider(step.Name, provider).SendPrompt(modelName, prompt)
+		if err != nil {
+			return "", fmt.Errorf("agent model call failed on iteration %d: %w", iteration, err)
+		}
+		usedTokens += estimateTokens(prompt) + estimateTokens(reply)
+		p.debugf("Agent step '%s' iteration %d: ~%d tokens used", step.Name, iteration, usedTokens)
+
+		parsed, ok := parseAgentReply(reply)
+		if !ok || parsed.Final != nil {
+			answer := reply
+			if ok {
+				answer = *parsed.Final
+			}
+			p.debugf("Agent step '%s' finished after %d iteration(s)", step.Name, iteration)
+			return p.finishAgentStep(step, modelName, answer, startTime)
+		}
+
+		if usedTokens > maxTokens {
+			return "", fmt.Errorf("agent step exceeded its token budget (~%d of %d) before finishing", usedTokens, maxTokens)
+		}
+
+		tool, allowed := available[parsed.Tool]
+		var result string
+		if !allowed {
+			result = fmt.Sprintf("Error: tool '%s' is not available", parsed.Tool)
+		} else {
+			emit(fmt.Sprintf("Agent step %s: iteration %d calling %s", step.Name, iteration, parsed.Tool))
+			out, err := tool.Call(parsed.Args)
+			if err != nil {
+				result = fmt.Sprintf("Error: %v", err)
+			} else {
+				result = out
+			}
+		}
+		argsJSON, _ := json.Marshal(parsed.Args)
+		transcript = append(transcript, fmt.Sprintf("[%d] Called %s with %s\nResult:\n%s", iteration, parsed.Tool, argsJSON, result))
+	}
+
+	return "", fmt.Errorf("agent step did not produce a final answer within %d iterations", maxIterations)
+}
+
+// agentInput collects the step's input as text for the agent's first prompt
+func (p *Processor) agentInput(step Step) (string, error) {
+	inputs := p.NormalizeStringSlice(step.Config.Input)
+	if len(inputs) == 0 || (len(inputs) == 1 && inputs[0] == "NA") {
+		return "", nil
+	}
+	if len(inputs) == 1 && strings.HasPrefix(inputs[0], "STDIN") {
+		return p.stdinContents(step.Config)
+	}
+	p.handler = newStepHandler(step.Config)
+	if err := p.processInputs(inputs); err != nil {
+		return "", fmt.Errorf("input processing error in step %s: %w", step.Name, inputSizeHint(err))
+	}
+	var parts []string
+	for _, in := range p.handler.GetInputs() {
+		if in.Type == input.ImageInput {
+			continue // Images cannot be carried in a text prompt
+		}
+		parts = append(parts, fmt.Sprintf("--- %s ---\n%s", in.Path, in.Contents))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// finishAgentStep applies postprocessing and writes the final answer to the step outputs
+func (p *Processor) finishAgentStep(step Step, modelName, answer string, startTime time.Time) (string, error) {
+	answer, err := p.postprocess(step, answer)
+	if err != nil {
+		return "", err
+	}
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if err := p.handleOutput(modelName, answer, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+	return answer, nil
+}
+
+// buildAgentPrompt renders the tool protocol, task and transcript so far
+func buildAgentPrompt(actions []string, inputText string, available map[string]tools.Tool, transcript []string) string {
+	var sb strings.Builder
+	sb.WriteString("You are completing a task step by step and may call tools to gather information or take actions.\n\n")
+	if len(available) > 0 {
+		sb.WriteString("Available tools:\n")
+		for _, name := range sortedToolNames(available) {
+			sb.WriteString(fmt.Sprintf("- %s: %s\n", name, available[name].Description()))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("Respond with exactly one JSON object and nothing else:\n")
+	if len(available) > 0 {
+		sb.WriteString(`- {"tool": "<name>", "args": {...}} to call a tool` + "\n")
+	}
+	sb.WriteString(`- {"final": "<answer>"} when the task is complete` + "\n\n")
+	sb.WriteString("Task:\n")
+	sb.WriteString(strings.Join(actions, "\n"))
+	sb.WriteString("\n")
+	if inputText != "" {
+		sb.WriteString("\nInput:\n")
+		sb.WriteString(inputText)
+		sb.WriteString("\n")
+	}
+	if len(transcript) > 0 {
+		sb.WriteString("\nTool calls so far:\n")
+		sb.WriteString(strings.Join(transcript, "\n\n"))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// parseAgentReply extracts the JSON reply, tolerating code fences and surrounding prose
+func parseAgentReply(reply string) (agentReply, bool) {
+	text := strings.TrimSpace(stripCodeFence(reply))
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return agentReply{}, false
+	}
+	var parsed agentReply
+	if err := json.Unmarshal([]byte(text[start:end+1]), &parsed); err != nil {
+		return agentReply{}, false
+	}
+	if parsed.Final == nil && parsed.Tool == "" {
+		return agentReply{}, false
+	}
+	return parsed, true
+}
+
+// estimateTokens approximates a token count at four characters per token
+func estimateTokens(s string) int {
+	return len(s) / 4
+}
+
+// EstimateTokens approximates a token count the way step metrics do
+func EstimateTokens(s string) int {
+	return estimateTokens(s)
+}
+
+// sortedToolNames lists tool names in a stable order for prompts
+func sortedToolNames(available map[string]tools.Tool) []string {
+	names := make([]string, 0, len(available))
+	for name := range available {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// scriptedProvider replies with a fixed sequence of responses and records prompts
+type scriptedProvider struct {
+	MockProvider
+	replies []string
+	prompts []string
+}
+
+func (s *scriptedProvider) SendPrompt(model, prompt string) (string, error) {
+	s.prompts = append(s.prompts, prompt)
+	if len(s.replies) == 0 {
+		return "", fmt.Errorf("no more scripted replies")
+	}
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+	return reply, nil
+}
+
+func withScriptedProvider(t *testing.T, replies ...string) *scriptedProvider {
+	t.Helper()
+	scripted := &scriptedProvider{MockProvider: MockProvider{name: "openai"}, replies: replies}
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		if scripted.SupportsModel(modelName) {
+			return scripted
+		}
+		return previous(modelName)
+	}
+	t.Cleanup(func() { models.DetectProvider = previous })
+	return scripted
+}
+
+func agentTestConfig(agent *AgentConfig) *DSLConfig {
+	return &DSLConfig{
+		Steps: []Step{
+			{
+				Name: "agent_step",
+				Config: StepConfig{
+					Type:   "agent",
+					Input:  "NA",
+					Model:  "gpt-4o",
+					Action: "Find the answer",
+					Output: "STDOUT",
+					Agent:  agent,
+				},
+			},
+		},
+	}
+}
+
+func TestAgentStepToolLoop(t *testing.T) {
+	notes := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(notes, []byte("the answer is 42"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scripted := withScriptedProvider(t,
+		fmt.Sprintf(`{"tool": "file_read", "args": {"path": %q}}`, notes),
+		`{"tool": "shell", "args": {"command": "rm -rf /"}}`,
+		"```json\n{\"final\": \"42\"}\n```",
+	)
+
+	proc := NewProcessor(agentTestConfig(&AgentConfig{Tools: []string{"file_read"}}), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if proc.LastOutput() != "42" {
+		t.Errorf("LastOutput() = %q, want 42", proc.LastOutput())
+	}
+	if len(scripted.prompts) != 3 {
+		t.Fatalf("expected 3 model calls, got %d", len(scripted.prompts))
+	}
+	if !strings.Contains(scripted.prompts[1], "the answer is 42") {
+		t.Error("expected the file_read result in the second prompt")
+	}
+	if !strings.Contains(scripted.prompts[2], "tool 'shell' is not available") {
+		t.Error("expected a disallowed tool to be reported back to the model")
+	}
+}
+
+func TestAgentStepMaxIterations(t *testing.T) {
+	withScriptedProvider(t,
+		`{"tool": "file_read", "args": {"path": "a"}}`,
+		`{"tool": "file_read", "args": {"path": "b"}}`,
+	)
+	proc := NewProcessor(agentTestConfig(&AgentConfig{Tools: []string{"file_read"}, MaxIterations: 2}), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err == nil || !strings.Contains(err.Error(), "within 2 iterations") {
+		t.Errorf("expected max iterations error, got %v", err)
+	}
+}
+
+func TestValidateAgentConfig(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+	errs := proc.validateAgentConfig(&AgentConfig{Tools: []string{"shell", "http", "retrieval", "teleport"}}, []string{"gpt-4o"})
+	joined := strings.Join(errs, "\n")
+	for _, want := range []string{"allowed_commands", "allowed_hosts", "retrieval_paths", "unknown agent tool 'teleport'"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected error mentioning %q, got %q", want, joined)
+		}
+	}
+	if errs := proc.validateAgentConfig(nil, []string{"gpt-4o", "claude-3-5-haiku-latest"}); len(errs) != 1 {
+		t.Errorf("expected a single-model error, got %v", errs)
+	}
+}
+
+func TestAgentShellToolInServer(t *testing.T) {
+	cfg := &AgentConfig{Tools: []string{"shell"}, AllowedCommands: []string{"grep", "sh"}}
+	server := &config.ServerConfig{DataDir: t.TempDir()}
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), server, false)
+
+	// The shell tool is off in server runs until the server allows commands
+	errs := strings.Join(proc.validateAgentConfig(cfg, []string{"gpt-4o"}), "\n")
+	if !strings.Contains(errs, "turned off in server runs") {
+		t.Errorf("expected the shell tool to be off, got %q", errs)
+	}
+	if _, ok := proc.agentTools(cfg)["shell"]; ok {
+		t.Error("agentTools() offered the shell tool in a server run")
+	}
+
+	server.AgentTools.ShellCommands = []string{"grep", "wc"}
+	errs = strings.Join(proc.validateAgentConfig(cfg, []string{"gpt-4o"}), "\n")
+	if !strings.Contains(errs, "'sh' is not in the server's agentTools.shellCommands") || strings.Contains(errs, "'grep'") {
+		t.Errorf("expected only sh to be rejected, got %q", errs)
+	}
+	shell, ok := proc.agentTools(cfg)["shell"]
+	if !ok {
+		t.Fatal("agentTools() didn't offer the shell tool")
+	}
+	if _, err := shell.Call(map[string]interface{}{"command": "sh -c id"}); err == nil {
+		t.Error("the shell tool ran a command the server doesn't allow")
+	}
+}
@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StepTypeApproval is the type of steps that wait for a person to approve
+// the run before it goes on
+const StepTypeApproval = "approval"
+
+// ErrRejected is wrapped by the error of a run stopped at an approval step,
+// because it was rejected or nobody decided in time
+var ErrRejected = errors.New("approval rejected")
+
+// ApprovalRequest is what an approval step asks a person to decide
+type ApprovalRequest struct {
+	Step    string    `json:"step"`
+	Message string    `json:"message"`
+	Content string    `json:"content,omitempty"` // The step's input, passed on once approved
+	Expires time.Time `json:"expires,omitempty"` // When the step gives up waiting; never when zero
+}
+
+// ApprovalDecision is a person's answer to an approval request
+type ApprovalDecision struct {
+	Approved bool   `json:"approved"`
+	By       string `json:"by,omitempty"`     // Who decided
+	Reason   string `json:"reason,omitempty"` // Why, as they put it
+}
+
+// Approver puts an approval request to a person and returns their
+// decision. It blocks until they decided or ctx is done.
+type Approver func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+
+// SetApprover sets who decides the run's approval steps. Without one,
+// approval steps fail.
+func (p *Processor) SetApprover(a Approver) {
+	p.approver = a
+}
+
+// isApprovalStep reports whether a step is an approval step
+func isApprovalStep(cfg StepConfig) bool {
+	return cfg.Type == StepTypeApproval
+}
+
+// approvalStepErrors lists the problems with an approval step
+func (p *Processor) approvalStepErrors(config StepConfig) []string {
+	var errors []string
+	if config.Approval != nil && config.Approval.Timeout != "" {
+		if d, err := time.ParseDuration(config.Approval.Timeout); err != nil || d <= 0 {
+			errors = append(errors, fmt.Sprintf("invalid approval.timeout '%s' (expected a duration such as 30m or 4h)", config.Approval.Timeout))
+		}
+	}
+	if config.Model != nil || config.Action != nil {
+		errors = append(errors, "approval steps don't take a model or action")
+	}
+	return errors
+}
+
+// processApprovalStep asks the approver to let the run go on, showing the
+// step's input, and passes the input on as its output once approved. A
+// rejection, or no decision before the timeout, fails the run.
+func (p *Processor) processApprovalStep(step Step, isParallel bool, parallelID string) (string, error) {
+	settings := ApprovalStep{}
+	if step.Config.Approval != nil {
+		settings = *step.Config.Approval
+	}
+	req := ApprovalRequest{Step: step.Name, Message: settings.Message}
+	if req.Message == "" {
+		req.Message = fmt.Sprintf("Approve step '%s' to continue the run?", step.Name)
+	}
+
+	inputs := p.NormalizeStringSlice(step.Config.Input)
+	switch {
+	case len(inputs) == 0 || inputs[0] == "NA":
+	case len(inputs) == 1 && strings.HasPrefix(inputs[0], "STDIN"):
+		stdin, err := p.stdinContents(step.Config)
+		if err != nil {
+			return "", fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+		}
+		req.Content = stdin
+	default:
+		p.handler = newStepHandler(step.Config)
+		if err := p.processInputs(inputs); err != nil {
+			return "", fmt.Errorf("input processing error in step %s: %w", step.Name, inputSizeHint(err))
+		}
+		var parts []string
+		for _, in := range p.handler.GetInputs() {
+			parts = append(parts, strings.TrimSpace(string(in.Contents)))
+		}
+		req.Content = strings.Join(parts, "\n\n")
+	}
+
+	if p.approver == nil {
+		return "", fmt.Errorf("approval step '%s' needs an approver: run the workflow in a terminal or through the server", step.Name)
+	}
+	ctx := p.context()
+	if settings.Timeout != "" {
+		timeout, err := time.ParseDuration(settings.Timeout)
+		if err != nil {
+			return "", fmt.Errorf("invalid approval.timeout in step %s: %w", step.Name, err)
+		}
+		req.Expires = time.Now().Add(timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, req.Expires)
+		defer cancel()
+	}
+
+	stepInfo := &StepInfo{Name: step.Name, Model: "NA", Action: "Wait for approval"}
+	stepMsg := fmt.Sprintf("Waiting for approval of step: %s", step.Name)
+	if isParallel {
+		p.emitParallelProgress(stepMsg, stepInfo, parallelID)
+	} else {
+		p.emitProgress(stepMsg, stepInfo)
+	}
+
+	decision, err := p.approver(ctx, req)
+	if err != nil {
+		if interrupted := p.interrupted(); interrupted != nil {
+			return "", interrupted
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", fmt.Errorf("%w: step '%s' wasn't approved within %s", ErrRejected, step.Name, settings.Timeout)
+		}
+		return "", fmt.Errorf("error waiting for approval of step %s: %w", step.Name, err)
+	}
+	who := ""
+	if decision.By != "" {
+		who = " by " + decision.By
+	}
+	if !decision.Approved {
+		reason := ""
+		if decision.Reason != "" {
+			reason = ": " + decision.Reason
+		}
+		return "", fmt.Errorf("%w: step '%s'%s%s", ErrRejected, step.Name, who, reason)
+	}
+	p.debugf("Step '%s' approved%s", step.Name, who)
+
+	if outputs := p.NormalizeStringSlice(step.Config.Output); len(outputs) > 0 {
+		metrics := &PerformanceMetrics{}
+		if err := p.handleOutput("NA", req.Content, outputs, metrics); err != nil {
+			return "", fmt.Errorf("output handling error: %w", err)
+		}
+	}
+	return req.Content, nil
+}
+
+// HasApprovalSteps reports whether the workflow has approval steps, which
+// need an approver to run
+func (c *DSLConfig) HasApprovalSteps() bool {
+	for _, step := range c.Steps {
+		if isApprovalStep(step.Config) {
+			return true
+		}
+	}
+	for _, group := range c.ParallelSteps {
+		for _, step := range group {
+			if isApprovalStep(step.Config) {
+				return true
+			}
+		}
+	}
+	return false
+}
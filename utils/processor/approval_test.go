@@ -0,0 +1,96 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func approvalTestConfig(settings *ApprovalStep) *DSLConfig {
+	return &DSLConfig{
+		Steps: []Step{
+			{
+				Name: "review",
+				Config: StepConfig{
+					Type:     StepTypeApproval,
+					Input:    "STDIN",
+					Output:   "STDOUT",
+					Approval: settings,
+				},
+			},
+		},
+	}
+}
+
+func TestApprovalStep(t *testing.T) {
+	var got ApprovalRequest
+	decide := func(decision ApprovalDecision) Approver {
+		return func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+			got = req
+			return decision, nil
+		}
+	}
+
+	proc := NewProcessor(approvalTestConfig(&ApprovalStep{Message: "Publish?"}), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetLastOutput("the draft")
+	proc.SetApprover(decide(ApprovalDecision{Approved: true, By: "ana"}))
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got.Step != "review" || got.Message != "Publish?" || got.Content != "the draft" || !got.Expires.IsZero() {
+		t.Errorf("unexpected request %+v", got)
+	}
+	if proc.LastOutput() != "the draft" {
+		t.Errorf("LastOutput() = %q, want the step's input", proc.LastOutput())
+	}
+
+	proc = NewProcessor(approvalTestConfig(nil), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetLastOutput("the draft")
+	proc.SetApprover(decide(ApprovalDecision{By: "ana", Reason: "off topic"}))
+	err := proc.Process()
+	if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "by ana: off topic") {
+		t.Errorf("expected rejection with reason, got %v", err)
+	}
+	if !strings.Contains(got.Message, "review") {
+		t.Errorf("default message = %q", got.Message)
+	}
+}
+
+func TestApprovalStepTimeout(t *testing.T) {
+	proc := NewProcessor(approvalTestConfig(&ApprovalStep{Timeout: "10ms"}), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetLastOutput("the draft")
+	proc.SetApprover(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		if req.Expires.IsZero() {
+			t.Error("expected the request to expire")
+		}
+		<-ctx.Done()
+		return ApprovalDecision{}, ctx.Err()
+	})
+	err := proc.Process()
+	if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "wasn't approved within 10ms") {
+		t.Errorf("expected timeout rejection, got %v", err)
+	}
+}
+
+func TestApprovalStepNeedsApprover(t *testing.T) {
+	cfg := approvalTestConfig(nil)
+	if !cfg.HasApprovalSteps() {
+		t.Error("HasApprovalSteps() = false")
+	}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetLastOutput("the draft")
+	if err := proc.Process(); err == nil || !strings.Contains(err.Error(), "needs an approver") {
+		t.Errorf("expected missing approver error, got %v", err)
+	}
+}
+
+func TestApprovalStepValidation(t *testing.T) {
+	cfg := approvalTestConfig(&ApprovalStep{Timeout: "soon"})
+	cfg.Steps[0].Config.Model = "gpt-4o"
+	proc := NewProcessor(cfg, createTestEnvConfig(), nil, false)
+	err := proc.validateStepConfig("review", cfg.Steps[0].Config)
+	if err == nil || !strings.Contains(err.Error(), "invalid approval.timeout 'soon'") || !strings.Contains(err.Error(), "don't take a model") {
+		t.Errorf("expected timeout and model errors, got %v", err)
+	}
+}
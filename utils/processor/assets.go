@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"sort"
+	"strings"
+)
+
+// Asset kinds
+const (
+	AssetInput    = "input"    // A static file or glob read by a step
+	AssetPrompt   = "prompt"   // A markdown file used as an action
+	AssetContext  = "context"  // A context file of a generate step
+	AssetWorkflow = "workflow" // A sub-workflow run by a process step
+	AssetEnvFile  = "env_file" // The workflow's dotenv file
+)
+
+// Asset is a file a workflow reads at run time
+type Asset struct {
+	Step string // Empty for workflow-level assets
+	Kind string
+	Path string // As written in the workflow; inputs may be globs
+}
+
+// Assets lists the files the workflow reads that are not produced by its own
+// steps: static inputs, markdown prompts, generate context files,
+// sub-workflows and the env file. URLs, database and scrape inputs, STDIN,
+// NA and screenshots are not files and are left out.
+func (p *Processor) Assets() []Asset {
+	var steps []Step
+	groupNames := make([]string, 0, len(p.config.ParallelSteps))
+	for name := range p.config.ParallelSteps {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, groupName := range groupNames {
+		steps = append(steps, p.config.ParallelSteps[groupName]...)
+	}
+	steps = append(steps, p.config.Steps...)
+	deferNames := make([]string, 0, len(p.config.Defer))
+	for name := range p.config.Defer {
+		deferNames = append(deferNames, name)
+	}
+	sort.Strings(deferNames)
+	for _, name := range deferNames {
+		steps = append(steps, Step{Name: name, Config: p.config.Defer[name]})
+	}
+
+	produced := make(map[string]bool)
+	for _, step := range steps {
+		for _, output := range p.NormalizeStringSlice(step.Config.Output) {
+			produced[output] = true
+		}
+		if step.Config.Generate != nil {
+			produced[step.Config.Generate.Output] = true
+		}
+	}
+	isProduced := func(path string) bool {
+		for output := range produced {
+			if output == path || (strings.ContainsAny(path, "*?[") && globMatch(path, output)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var assets []Asset
+	seen := make(map[[2]string]bool)
+	add := func(step, kind, path string) {
+		key := [2]string{kind, path}
+		if path == "" || seen[key] || isProduced(path) {
+			return
+		}
+		seen[key] = true
+		assets = append(assets, Asset{Step: step, Kind: kind, Path: path})
+	}
+
+	if p.config.EnvFile != "" {
+		add("", AssetEnvFile, p.config.EnvFile)
+	}
+	for _, step := range steps {
+		if _, isMap := step.Config.Input.(map[string]interface{}); !isMap {
+			for _, in := range p.NormalizeStringSlice(step.Config.Input) {
+				in, _ = p.parseVariableAssignment(in)
+				if !p.isSpecialInput(in) && !strings.HasPrefix(in, "STDIN") && !p.isURL(in) {
+					add(step.Name, AssetInput, in)
+				}
+			}
+		}
+		for _, action := range p.NormalizeStringSlice(step.Config.Action) {
+			if strings.HasSuffix(strings.ToLower(action), ".md") {
+				add(step.Name, AssetPrompt, action)
+			}
+		}
+		if step.Config.Generate != nil {
+			for _, file := range step.Config.Generate.ContextFiles {
+				add(step.Name, AssetContext, file)
+			}
+		}
+		if step.Config.Process != nil {
+			add(step.Name, AssetWorkflow, step.Config.Process.WorkflowFile)
+		}
+	}
+	return assets
+}
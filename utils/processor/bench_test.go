@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// discardProgress drops progress updates, so benchmarks don't print
+// responses
+type discardProgress struct{}
+
+func (discardProgress) WriteProgress(update ProgressUpdate) error { return nil }
+
+// withBenchmarkProvider answers every prompt at once with the mock provider
+func withBenchmarkProvider(b *testing.B) {
+	b.Helper()
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		return NewMockProvider("openai")
+	}
+	b.Cleanup(func() { models.DetectProvider = previous })
+}
+
+// newBenchmarkProcessor creates a quiet processor for cfg
+func newBenchmarkProcessor(cfg *DSLConfig) *Processor {
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.DisableSpinner()
+	proc.SetProgressWriter(discardProgress{})
+	return proc
+}
+
+func BenchmarkPromptAssembly(b *testing.B) {
+	withBenchmarkProvider(b)
+	for _, size := range []int{1 << 10, 1 << 20} {
+		stdin := strings.Repeat("The quick brown fox jumps over the lazy dog.\n", size/45)
+		b.Run(fmt.Sprintf("stdin=%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(stdin)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cfg := &DSLConfig{Steps: []Step{{Name: "summarize", Config: StepConfig{
+					Input: "STDIN", Model: "gpt-4o", Action: "Summarize this for the $team team", Output: "STDOUT",
+				}}}}
+				proc := newBenchmarkProcessor(cfg)
+				proc.variables["team"] = "platform"
+				proc.SetLastOutput(stdin)
+				if err := proc.Process(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSubstituteVariables(b *testing.B) {
+	proc := newBenchmarkProcessor(&DSLConfig{})
+	var action strings.Builder
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("var%03d", i)
+		proc.variables[name] = strings.Repeat("x", 200)
+		fmt.Fprintf(&action, "Compare $%s with the previous section. ", name)
+	}
+	text := action.String()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		proc.substituteVariables(text)
+	}
+}
+
+func BenchmarkParallelSteps(b *testing.B) {
+	withBenchmarkProvider(b)
+	for _, n := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("steps=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var group []Step
+				for j := 0; j < n; j++ {
+					group = append(group, Step{Name: fmt.Sprintf("step_%d", j), Config: StepConfig{
+						Input: "NA", Model: "gpt-4o-mini", Action: "Answer", Output: "STDOUT",
+					}})
+				}
+				proc := newBenchmarkProcessor(&DSLConfig{ParallelSteps: map[string][]Step{"fan-out": group}})
+				if err := proc.Process(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/broker"
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// consumeBroker and publishBroker receive messages from and send messages
+// to a Kafka or NATS broker; tests replace them
+var (
+	consumeBroker = broker.Consume
+	publishBroker = broker.Publish
+)
+
+// brokerKinds are the keys of a step's input or output map naming a broker
+var brokerKinds = []string{config.BrokerKafka, config.BrokerNATS}
+
+// brokerStep is the kafka or nats map of a step's input or output
+type brokerStep struct {
+	kind   string
+	broker string
+	topic  string // Kafka topic or NATS subject
+	group  string // Kafka consumer group, JetStream consumer or core NATS queue group
+	batch  int
+	wait   time.Duration
+	key    string // Kafka key of published messages
+	split  bool   // Publish each line of the output as a message
+}
+
+// brokerMap returns the kafka or nats map of an input or output map
+func brokerMap(v map[string]interface{}) (string, map[string]interface{}) {
+	for _, kind := range brokerKinds {
+		if spec, ok := v[kind].(map[string]interface{}); ok {
+			return kind, spec
+		}
+	}
+	return "", nil
+}
+
+// parseBrokerStep reads a kafka or nats map, such as
+// {broker: events, topic: orders, group: triage, batch: 50, wait: 10s}
+func parseBrokerStep(kind string, spec map[string]interface{}) (brokerStep, error) {
+	s := brokerStep{kind: kind}
+	var ok bool
+	if s.broker, ok = spec["broker"].(string); !ok || s.broker == "" {
+		return s, fmt.Errorf("%s needs a broker", kind)
+	}
+	if kind == config.BrokerKafka {
+		s.topic, _ = spec["topic"].(string)
+		s.group, _ = spec["group"].(string)
+	} else {
+		s.topic, _ = spec["subject"].(string)
+		if s.group, _ = spec["consumer"].(string); s.group == "" {
+			s.group, _ = spec["queue"].(string)
+		}
+	}
+	if batch, ok := spec["batch"].(int); ok {
+		if batch <= 0 {
+			return s, fmt.Errorf("%s batch must be positive", kind)
+		}
+		s.batch = batch
+	}
+	if wait, ok := spec["wait"].(string); ok && wait != "" {
+		d, err := time.ParseDuration(wait)
+		if err != nil || d <= 0 {
+			return s, fmt.Errorf("invalid %s wait %q", kind, wait)
+		}
+		s.wait = d
+	}
+	s.key, _ = spec["key"].(string)
+	if split, ok := spec["split"].(string); ok && split != "" {
+		if split != "lines" {
+			return s, fmt.Errorf("invalid %s split %q (expected lines)", kind, split)
+		}
+		s.split = true
+	}
+	return s, nil
+}
+
+// brokerConfig returns the broker a kafka or nats map names, checking its
+// type matches the map's key
+func (p *Processor) brokerConfig(s brokerStep) (config.BrokerConfig, error) {
+	cfg, err := p.envConfig.Broker(s.broker)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.Type != s.kind {
+		return cfg, fmt.Errorf("broker %q is %s, not %s", s.broker, cfg.Type, s.kind)
+	}
+	return cfg, nil
+}
+
+// consumeBrokerInput receives a batch of messages for a step and saves
+// their values in a temporary file, one per line. The batch is acked when
+// the run succeeds and released when it fails; see settleBatches.
+func (p *Processor) consumeBrokerInput(stepName, kind string, spec map[string]interface{}) (string, func(), error) {
+	s, err := parseBrokerStep(kind, spec)
+	if err != nil {
+		return "", nil, err
+	}
+	cfg, err := p.brokerConfig(s)
+	if err != nil {
+		return "", nil, err
+	}
+	p.debugf("Consuming from %s %s for step %s", s.broker, s.topic, stepName)
+	batch, err := consumeBroker(p.context(), cfg, broker.ConsumeOptions{Topic: s.topic, Group: s.group, Batch: s.batch, Wait: s.wait})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(batch.Messages) == 0 {
+		batch.Release()
+		return "", nil, fmt.Errorf("no messages arrived from %s", s.broker)
+	}
+
+	dir, err := os.MkdirTemp(config.TempDir(), "comanda-"+kind+"-*")
+	if err != nil {
+		batch.Release()
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	var b strings.Builder
+	for _, msg := range batch.Messages {
+		b.Write(msg.Value)
+		b.WriteByte('\n')
+	}
+	path := filepath.Join(dir, "messages.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		cleanup()
+		batch.Release()
+		return "", nil, fmt.Errorf("failed to save messages: %w", err)
+	}
+	p.trustPath(path)
+	p.debugf("Consumed %d message(s) for step %s", len(batch.Messages), stepName)
+
+	p.batchesMu.Lock()
+	p.batches = append(p.batches, batch)
+	p.batchesMu.Unlock()
+	return path, cleanup, nil
+}
+
+// settleBatches acks the messages the run consumed when it succeeded, and
+// releases them for redelivery when it failed
+func (p *Processor) settleBatches(runErr error) {
+	p.batchesMu.Lock()
+	batches := p.batches
+	p.batches = nil
+	p.batchesMu.Unlock()
+	for _, batch := range batches {
+		if runErr != nil {
+			if err := batch.Release(); err != nil {
+				p.debugf("Error releasing consumed messages: %v", err)
+			}
+			continue
+		}
+		// Acks go out even when the run's context has just ended
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := batch.Ack(ctx)
+		cancel()
+		if err != nil {
+			config.WriteLog("[RUN] ", "Consumed messages not acknowledged, so they will be delivered again: %v", err)
+			config.WarnLog("consumed messages not acknowledged: %v", err)
+		}
+	}
+}
+
+// publishBrokerOutput sends a step's output to a Kafka topic or NATS
+// subject, as one message or one per non-empty line
+func (p *Processor) publishBrokerOutput(response, kind string, spec map[string]interface{}) error {
+	s, err := parseBrokerStep(kind, spec)
+	if err != nil {
+		return err
+	}
+	if s.topic == "" {
+		if kind == config.BrokerKafka {
+			return fmt.Errorf("kafka output needs a topic")
+		}
+		return fmt.Errorf("nats output needs a subject")
+	}
+	cfg, err := p.brokerConfig(s)
+	if err != nil {
+		return err
+	}
+	values := []string{response}
+	if s.split {
+		values = nil
+		for _, line := range strings.Split(response, "\n") {
+			if strings.TrimSpace(line) != "" {
+				values = append(values, line)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	messages := make([]broker.Message, len(values))
+	for i, value := range values {
+		messages[i] = broker.Message{Value: []byte(value)}
+		if s.key != "" {
+			messages[i].Key = []byte(s.key)
+		}
+	}
+	p.debugf("Publishing %d message(s) to %s %s", len(messages), s.broker, s.topic)
+	return publishBroker(p.context(), cfg, s.topic, messages)
+}
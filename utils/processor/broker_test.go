@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/broker"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// fakeBroker records what kafka inputs and outputs consume, publish, ack
+// and release
+type fakeBroker struct {
+	opts      broker.ConsumeOptions
+	consumed  string // Contents of the input file when the step read it
+	acked     bool
+	released  bool
+	topic     string
+	published []broker.Message
+}
+
+func withFakeBroker(t *testing.T) *fakeBroker {
+	f := &fakeBroker{}
+	previousConsume, previousPublish := consumeBroker, publishBroker
+	consumeBroker = func(ctx context.Context, cfg config.BrokerConfig, opts broker.ConsumeOptions) (*broker.Batch, error) {
+		f.opts = opts
+		messages := []broker.Message{{Value: []byte(`{"id":1}`)}, {Value: []byte(`{"id":2}`)}}
+		ack := func(context.Context) error { f.acked = true; return nil }
+		release := func() error { f.released = true; return nil }
+		return broker.NewBatch(messages, ack, release), nil
+	}
+	publishBroker = func(ctx context.Context, cfg config.BrokerConfig, topic string, messages []broker.Message) error {
+		if f.acked {
+			t.Error("input acked before the output was published")
+		}
+		f.topic, f.published = topic, messages
+		return nil
+	}
+	t.Cleanup(func() { consumeBroker, publishBroker = previousConsume, previousPublish })
+	return f
+}
+
+// readingProvider answers with the contents of the file it's sent
+type readingProvider struct {
+	MockProvider
+}
+
+func (r *readingProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+	data, err := os.ReadFile(file.Path)
+	return "summary\n" + string(data), err
+}
+
+func brokerEnvConfig() *config.EnvConfig {
+	env := createTestEnvConfig()
+	env.Brokers = map[string]config.BrokerConfig{
+		"events": {Type: config.BrokerKafka, URL: "http://proxy.example.com"},
+	}
+	return env
+}
+
+func TestKafkaInputAndOutput(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	f := withFakeBroker(t)
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		return &readingProvider{MockProvider: MockProvider{name: "openai"}}
+	}
+	defer func() { models.DetectProvider = previous }()
+
+	cfg := &DSLConfig{Steps: []Step{{Name: "triage", Config: StepConfig{
+		Input: map[string]interface{}{"kafka": map[string]interface{}{
+			"broker": "events", "topic": "orders", "group": "triage", "batch": 50, "wait": "10s",
+		}},
+		Model:  "gpt-4o",
+		Action: "Summarize the orders",
+		Output: map[string]interface{}{"kafka": map[string]interface{}{
+			"broker": "events", "topic": "summaries", "key": "orders", "split": "lines",
+		}},
+	}}}}
+	proc := NewProcessor(cfg, brokerEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if f.opts.Topic != "orders" || f.opts.Group != "triage" || f.opts.Batch != 50 || f.opts.Wait.Seconds() != 10 {
+		t.Errorf("consumed with %+v", f.opts)
+	}
+	var values []string
+	for _, msg := range f.published {
+		if string(msg.Key) != "orders" {
+			t.Errorf("published with key %q, want orders", msg.Key)
+		}
+		values = append(values, string(msg.Value))
+	}
+	if f.topic != "summaries" || strings.Join(values, ",") != `summary,{"id":1},{"id":2}` {
+		t.Errorf("published %v to %s, want a message per line to summaries", values, f.topic)
+	}
+	if !f.acked || f.released {
+		t.Errorf("acked = %v, released = %v, want the batch acked after the run succeeded", f.acked, f.released)
+	}
+}
+
+func TestKafkaInputReleasedOnFailure(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	f := withFakeBroker(t)
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		return &failingProvider{MockProvider: MockProvider{name: "openai"}}
+	}
+	defer func() { models.DetectProvider = previous }()
+
+	cfg := &DSLConfig{Steps: []Step{{Name: "triage", Config: StepConfig{
+		Input:  map[string]interface{}{"kafka": map[string]interface{}{"broker": "events", "topic": "orders", "group": "triage"}},
+		Model:  "gpt-4o",
+		Action: "Summarize the orders",
+		Output: "STDOUT",
+	}}}}
+	proc := NewProcessor(cfg, brokerEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err == nil {
+		t.Fatal("Process() succeeded, want the provider's error")
+	}
+	if f.acked || !f.released {
+		t.Errorf("acked = %v, released = %v, want the batch released after the run failed", f.acked, f.released)
+	}
+}
+
+func TestBrokerValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, brokerEnvConfig(), createTestServerConfig(), false)
+	errs := proc.missingInputs(StepConfig{
+		Input:  map[string]interface{}{"nats": map[string]interface{}{"broker": "events", "subject": "orders"}},
+		Output: map[string]interface{}{"kafka": map[string]interface{}{"broker": "stream"}},
+	})
+	if len(errs) != 2 || !strings.Contains(errs[0], `broker "events" is kafka, not nats`) || !strings.Contains(errs[1], `broker "stream" is not configured`) {
+		t.Errorf("missingInputs() = %v, want the mismatched and unconfigured brokers", errs)
+	}
+	if _, err := parseBrokerStep("kafka", map[string]interface{}{"broker": "events", "split": "words"}); err == nil {
+		t.Error("parseBrokerStep accepted an unknown split")
+	}
+}
@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// ErrOverBudget is wrapped by the error of a run that stopped because its
+// steps went over the env config's budget
+var ErrOverBudget = errors.New("run over budget")
+
+// runUsage is the estimated tokens and cost of the steps a run finished
+type runUsage struct {
+	mu     sync.Mutex
+	tokens int
+	cost   float64
+}
+
+// charge counts the estimated tokens and cost of a finished step of model
+func (p *Processor) charge(model string, metrics *PerformanceMetrics) {
+	tokens := metrics.PromptTokens + metrics.CompletionTokens
+	if tokens == 0 {
+		return
+	}
+	cost := stepCost(model, metrics)
+	p.usage.mu.Lock()
+	defer p.usage.mu.Unlock()
+	p.usage.tokens += tokens
+	p.usage.cost += cost
+}
+
+// stepCost returns the estimated cost of a finished step of model, zero
+// when the model's prices are unknown
+func stepCost(model string, metrics *PerformanceMetrics) float64 {
+	cost, _ := models.EstimateCost(model, metrics.PromptTokens, metrics.CompletionTokens)
+	return cost
+}
+
+// overBudget returns an error wrapping ErrOverBudget once the run's steps
+// used more tokens or cost more than the budget allows, for checks before a
+// step starts
+func (p *Processor) overBudget() error {
+	budget := p.envConfig.BudgetSettings()
+	if budget.MaxRunTokens <= 0 && budget.MaxRunCost <= 0 {
+		return nil
+	}
+	p.usage.mu.Lock()
+	defer p.usage.mu.Unlock()
+	if budget.MaxRunTokens > 0 && p.usage.tokens > budget.MaxRunTokens {
+		return fmt.Errorf("%w: its steps used about %d tokens, over the budget of %d", ErrOverBudget, p.usage.tokens, budget.MaxRunTokens)
+	}
+	if budget.MaxRunCost > 0 && p.usage.cost > budget.MaxRunCost {
+		return fmt.Errorf("%w: its steps cost about $%.2f, over the budget of $%.2f", ErrOverBudget, p.usage.cost, budget.MaxRunCost)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestBudgetStopsRun(t *testing.T) {
+	provider := withInterruptingProvider(t, 0, nil)
+	envConfig := createTestEnvConfig()
+	envConfig.Budget = &config.Budget{MaxRunTokens: 1}
+
+	proc := NewProcessor(checkpointTestConfig("first", "second"), envConfig, createTestServerConfig(), false)
+	err := proc.Process()
+	if !errors.Is(err, ErrOverBudget) {
+		t.Fatalf("Process() error = %v, want ErrOverBudget", err)
+	}
+	if !strings.Contains(err.Error(), "over the budget of 1") {
+		t.Errorf("error doesn't explain the budget: %v", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("provider called %d times, want 1: no step should start over budget", provider.calls)
+	}
+
+	// Without a budget the run finishes
+	provider = withInterruptingProvider(t, 0, nil)
+	proc = NewProcessor(checkpointTestConfig("first", "second"), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider called %d times, want 2", provider.calls)
+	}
+}
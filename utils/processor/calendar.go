@@ -0,0 +1,280 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/calendar"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/connectors"
+)
+
+// fetchICS, fetchGoogleCalendar and calendarNow read calendars; tests
+// replace them
+var (
+	fetchICS            = calendar.FetchICS
+	fetchGoogleCalendar = calendar.FetchGoogle
+	calendarNow         = time.Now
+)
+
+// calendarFuncs are the functions of calendar input templates
+var calendarFuncs = template.FuncMap{
+	"join": func(sep string, values []string) string { return strings.Join(values, sep) },
+	"date": func(layout string, t time.Time) string { return t.Format(layout) },
+}
+
+// calendarInput is the calendar map of a step's input
+type calendarInput struct {
+	name     string // Calendar configured in calendars, when not inline
+	source   config.CalendarConfig
+	from     string
+	to       string // Relative to from
+	match    string // Summary substring, case-insensitive
+	limit    int
+	template *template.Template // Renders each event; Event.Render when nil
+	split    bool               // One file per event rather than an agenda
+}
+
+// parseCalendarInput reads a calendar input map, such as
+// {name: work, from: today, to: +1d, match: sync} or
+// {ics: https://example.com/team.ics, template: "..."}
+func parseCalendarInput(spec map[string]interface{}) (calendarInput, error) {
+	in := calendarInput{from: "now", to: "+1d", limit: 50}
+	in.name, _ = spec["name"].(string)
+	in.source.ICS, _ = spec["ics"].(string)
+	in.source.Google, _ = spec["google"].(string)
+	in.source.Timezone, _ = spec["timezone"].(string)
+	in.match, _ = spec["match"].(string)
+	set := 0
+	for _, v := range []string{in.name, in.source.ICS, in.source.Google} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return in, fmt.Errorf("calendar input needs one of name (a calendar in the env config), ics or google")
+	}
+	if v, ok := spec["from"].(string); ok {
+		in.from = v
+	}
+	if v, ok := spec["to"].(string); ok {
+		in.to = v
+	}
+	if v, ok := spec["limit"]; ok {
+		limit, ok := v.(int)
+		if !ok || limit < 1 {
+			return in, fmt.Errorf("calendar limit must be a positive number")
+		}
+		in.limit = limit
+	}
+	if split, _ := spec["split"].(string); split != "" {
+		if split != "events" {
+			return in, fmt.Errorf("invalid calendar split %q (expected events)", split)
+		}
+		in.split = true
+	}
+	if text, _ := spec["template"].(string); text != "" {
+		tmpl, err := template.New("calendar").Funcs(calendarFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return in, fmt.Errorf("invalid calendar template: %w", err)
+		}
+		in.template = tmpl
+	}
+	if _, err := in.source.Location(); err != nil {
+		return in, err
+	}
+	if _, _, err := in.window(time.Now()); err != nil {
+		return in, err
+	}
+	return in, nil
+}
+
+// window returns the times events are read between
+func (in calendarInput) window(now time.Time) (time.Time, time.Time, error) {
+	from, err := calendar.ParseTime(in.from, now)
+	if err != nil {
+		return from, from, fmt.Errorf("calendar from: %w", err)
+	}
+	to, err := calendar.ParseTime(in.to, from)
+	if err != nil {
+		return from, to, fmt.Errorf("calendar to: %w", err)
+	}
+	if !to.After(from) {
+		return from, to, fmt.Errorf("calendar to (%s) is not after from (%s)", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+	return from, to, nil
+}
+
+// calendarSource returns the ICS feed or Google Calendar of a calendar
+// input, with the timezone it sets
+func (p *Processor) calendarSource(in calendarInput) (config.CalendarConfig, error) {
+	if in.name == "" {
+		return in.source, nil
+	}
+	source, err := p.envConfig.Calendar(in.name)
+	if err != nil {
+		return source, err
+	}
+	if in.source.Timezone != "" {
+		source.Timezone = in.source.Timezone
+	}
+	return source, nil
+}
+
+// fetchCalendarInputs reads the events of a calendar input and saves them
+// in a temporary directory: an agenda in one file, or a file per event
+func (p *Processor) fetchCalendarInputs(stepName string, spec map[string]interface{}) ([]string, func(), error) {
+	in, err := parseCalendarInput(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	source, err := p.calendarSource(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc, err := source.Location()
+	if err != nil {
+		return nil, nil, err
+	}
+	from, to, err := in.window(calendarNow().In(loc))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.debugf("Reading calendar events from %s to %s for step %s", from.Format(time.RFC3339), to.Format(time.RFC3339), stepName)
+	var events []calendar.Event
+	if source.Google != "" {
+		settings := p.envConfig.ConnectorSettings()
+		if err := checkGoogleCalendar(settings); err != nil {
+			return nil, nil, err
+		}
+		token, err := googleToken(p.context(), settings)
+		if err != nil {
+			return nil, nil, err
+		}
+		if events, err = fetchGoogleCalendar(p.context(), token, source.Google, from, to, loc); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		src := source.ICS
+		if !calendar.IsURL(src) {
+			if src, err = p.confinePath(src); err != nil {
+				return nil, nil, err
+			}
+		}
+		data, err := fetchICS(p.context(), src)
+		if err != nil {
+			return nil, nil, err
+		}
+		if events, err = calendar.ParseICS(data, from, to, loc); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var kept []calendar.Event
+	for _, e := range events {
+		if in.match == "" || strings.Contains(strings.ToLower(e.Summary), strings.ToLower(in.match)) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) > in.limit {
+		kept = kept[:in.limit]
+	}
+
+	dir, err := os.MkdirTemp(config.TempDir(), "comanda-calendar-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	var paths []string
+	used := make(map[string]bool)
+	save := func(title, content string) error {
+		path := filepath.Join(dir, documentFileName(connectors.Document{Title: title, Ext: ".md"}, used))
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			return fmt.Errorf("failed to save %s: %w", title, err)
+		}
+		p.trustPath(path)
+		paths = append(paths, path)
+		return nil
+	}
+
+	rendered := make([]string, len(kept))
+	for i, e := range kept {
+		if rendered[i], err = in.render(e); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+	if in.split && len(kept) > 0 {
+		for i, e := range kept {
+			if err := save(e.Start.Format("2006-01-02 1504")+" "+e.Summary, rendered[i]); err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+		}
+	} else {
+		const layout = "Mon 2 Jan 2006 15:04 MST"
+		agenda := fmt.Sprintf("# Calendar events from %s to %s\n\n", from.Format(layout), to.Format(layout))
+		if len(kept) == 0 {
+			agenda += "No events.\n"
+		}
+		agenda += strings.Join(rendered, "\n")
+		if err := save("calendar", agenda); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+	p.debugf("Read %d calendar event(s) for step %s", len(kept), stepName)
+	return paths, cleanup, nil
+}
+
+// render returns an event the way the input's template writes it
+func (in calendarInput) render(e calendar.Event) (string, error) {
+	if in.template == nil {
+		return e.Render(), nil
+	}
+	var b strings.Builder
+	if err := in.template.Execute(&b, e); err != nil {
+		return "", fmt.Errorf("error rendering calendar template for %q: %w", e.Summary, err)
+	}
+	text := b.String()
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text, nil
+}
+
+// checkGoogleCalendar reports missing Google credentials for Google
+// Calendar inputs, which use the google_drive connector's
+func checkGoogleCalendar(settings config.ConnectorsConfig) error {
+	if connectors.CheckConfigured(settings, connectors.KindGoogleDrive) != nil {
+		return fmt.Errorf("google calendar inputs need connectors.google_drive in the env config, with an access_token or a client_id, client_secret and refresh_token allowed to read calendars")
+	}
+	return nil
+}
+
+// calendarErrors reports problems with the calendar map of a step's input
+func (p *Processor) calendarErrors(cfg StepConfig) []string {
+	input, _ := cfg.Input.(map[string]interface{})
+	spec, ok := input["calendar"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	in, err := parseCalendarInput(spec)
+	if err == nil {
+		var source config.CalendarConfig
+		if source, err = p.calendarSource(in); err == nil {
+			if _, err = source.Location(); err == nil && source.Google != "" {
+				err = checkGoogleCalendar(p.envConfig.ConnectorSettings())
+			}
+		}
+	}
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+const briefingICS = `BEGIN:VCALENDAR
+BEGIN:VEVENT
+UID:1
+SUMMARY:Acme renewal call
+DTSTART:20250602T140000Z
+DTEND:20250602T143000Z
+ATTENDEE;CN=Jo:mailto:jo@acme.example
+END:VEVENT
+BEGIN:VEVENT
+UID:2
+SUMMARY:Focus time
+DTSTART:20250602T090000Z
+DTEND:20250602T110000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:3
+SUMMARY:Globex intro call
+DTSTART:20250603T160000Z
+DTEND:20250603T163000Z
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestCalendarInput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "work.ics")
+	if err := os.WriteFile(path, []byte(briefingICS), 0644); err != nil {
+		t.Fatal(err)
+	}
+	previous := calendarNow
+	calendarNow = func() time.Time { return time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC) }
+	defer func() { calendarNow = previous }()
+
+	env := createTestEnvConfig()
+	env.Calendars = map[string]config.CalendarConfig{"work": {ICS: path, Timezone: "UTC"}}
+	proc := NewProcessor(&DSLConfig{}, env, nil, false)
+
+	paths, cleanup, err := proc.fetchCalendarInputs("brief", map[string]interface{}{"name": "work", "from": "today", "to": "+2d", "match": "call"})
+	if err != nil {
+		t.Fatalf("fetchCalendarInputs() error = %v", err)
+	}
+	defer cleanup()
+	data, _ := os.ReadFile(paths[0])
+	agenda := string(data)
+	if len(paths) != 1 || strings.Contains(agenda, "Focus time") || !strings.Contains(agenda, "- Attendees: Jo <jo@acme.example>") ||
+		strings.Index(agenda, "Acme") > strings.Index(agenda, "Globex") {
+		t.Errorf("agenda = %s", agenda)
+	}
+
+	paths, cleanup, err = proc.fetchCalendarInputs("brief", map[string]interface{}{
+		"ics":      path,
+		"timezone": "UTC",
+		"split":    "events",
+		"template": `Prepare for {{ .Summary }} at {{ .Start | date "15:04" }} with {{ join ", " .Attendees }}`,
+	})
+	if err != nil {
+		t.Fatalf("fetchCalendarInputs() error = %v", err)
+	}
+	defer cleanup()
+	if len(paths) != 2 {
+		t.Fatalf("got %d files, want one per event until tomorrow", len(paths))
+	}
+	data, _ = os.ReadFile(paths[1])
+	if string(data) != "Prepare for Acme renewal call at 14:00 with Jo <jo@acme.example>\n" {
+		t.Errorf("event file = %q", data)
+	}
+}
+
+func TestCalendarValidation(t *testing.T) {
+	env := createTestEnvConfig()
+	proc := NewProcessor(&DSLConfig{}, env, nil, false)
+	for want, spec := range map[string]map[string]interface{}{
+		"not configured":   {"name": "work"},
+		"one of name":      {"ics": "a.ics", "google": "primary"},
+		"not after from":   {"ics": "a.ics", "to": "-1d"},
+		"invalid calendar": {"ics": "a.ics", "template": "{{ .Summary"},
+		"google_drive":     {"google": "primary"},
+		"invalid timezone": {"ics": "a.ics", "timezone": "Mars/Olympus"},
+	} {
+		errs := proc.calendarErrors(StepConfig{Input: map[string]interface{}{"calendar": spec}})
+		if len(errs) != 1 || !strings.Contains(errs[0], want) {
+			t.Errorf("calendarErrors(%v) = %v, want %q", spec, errs, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/input"
+)
+
+// inputState is the on-disk record of input hashes from previous runs
+type inputState struct {
+	Steps map[string]map[string]string `json:"steps"` // step name -> input path -> sha256
+}
+
+// changeTracker skips step inputs whose content hash matches the last run
+type changeTracker struct {
+	path  string
+	mu    sync.Mutex
+	state inputState
+}
+
+// DefaultStatePath returns where input hashes for a workflow file are kept:
+// a .comanda directory next to the workflow
+func DefaultStatePath(workflowFile string) string {
+	base := filepath.Base(workflowFile)
+	return filepath.Join(filepath.Dir(workflowFile), ".comanda", base+".state.json")
+}
+
+// EnableChangedOnly makes the processor skip inputs that have not changed
+// since the last run recorded in statePath
+func (p *Processor) EnableChangedOnly(statePath string) error {
+	tracker := &changeTracker{
+		path:  statePath,
+		state: inputState{Steps: make(map[string]map[string]string)},
+	}
+
+	data, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading input state %s: %w", statePath, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &tracker.state); err != nil {
+			return fmt.Errorf("error parsing input state %s: %w", statePath, err)
+		}
+		if tracker.state.Steps == nil {
+			tracker.state.Steps = make(map[string]map[string]string)
+		}
+	}
+
+	p.changeTracker = tracker
+	p.debugf("Changed-only mode enabled, state file: %s", statePath)
+	return nil
+}
+
+// hashContents returns the hex sha256 of an input's contents
+func hashContents(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// trackable reports whether an input is a user file whose hash is meaningful
+func (p *Processor) trackable(in *input.Input) bool {
+	if p.isTrustedPath(in.Path) {
+		return false // STDIN buffers, fetched URLs and chunks change path every run
+	}
+	switch in.Type {
+	case input.FileInput, input.ImageInput, input.SourceCodeInput:
+		return true
+	}
+	return false
+}
+
+// filterUnchangedInputs drops unchanged inputs from the step handler. It
+// returns the hashes of the inputs that remain, how many inputs were dropped
+// because the last run's results still hold, and whether the whole step can
+// be skipped because nothing it reads has changed.
+func (p *Processor) filterUnchangedInputs(stepName string) (map[string]string, int, bool) {
+	t := p.changeTracker
+	t.mu.Lock()
+	previous := t.state.Steps[stepName]
+	t.mu.Unlock()
+
+	inputs := p.handler.GetInputs()
+	if len(inputs) == 0 {
+		return nil, 0, false
+	}
+
+	pending := make(map[string]string)
+	untracked := 0
+	skipped := 0
+	p.handler.RetainInputs(func(in *input.Input) bool {
+		if !p.trackable(in) {
+			untracked++
+			return true
+		}
+		hash := hashContents(in.Contents)
+		if previous != nil && previous[in.Path] == hash {
+			skipped++
+			p.debugf("Skipping unchanged input for step '%s': %s", stepName, in.Path)
+			return false
+		}
+		pending[in.Path] = hash
+		return true
+	})
+
+	if skipped > 0 {
+		p.debugf("Step '%s': %d unchanged input(s) skipped, %d changed", stepName, skipped, len(pending))
+	}
+	return pending, skipped, skipped > 0 && len(pending) == 0 && untracked == 0
+}
+
+// recordInputs stores hashes for inputs a step processed successfully
+func (p *Processor) recordInputs(stepName string, hashes map[string]string) {
+	if p.changeTracker == nil || len(hashes) == 0 {
+		return
+	}
+	t := p.changeTracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state.Steps[stepName] == nil {
+		t.state.Steps[stepName] = make(map[string]string)
+	}
+	for path, hash := range hashes {
+		t.state.Steps[stepName][path] = hash
+	}
+}
+
+// saveInputState writes the recorded hashes back to the state file
+func (p *Processor) saveInputState() error {
+	if p.changeTracker == nil {
+		return nil
+	}
+	t := p.changeTracker
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error encoding input state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("error creating state directory: %w", err)
+	}
+	if err := os.WriteFile(t.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing input state %s: %w", t.path, err)
+	}
+	p.debugf("Saved input state to %s", t.path)
+	return nil
+}
@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangedOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	doc1 := filepath.Join(tmpDir, "doc1.txt")
+	doc2 := filepath.Join(tmpDir, "doc2.txt")
+	output := filepath.Join(tmpDir, "summary.txt")
+	statePath := filepath.Join(tmpDir, ".comanda", "workflow.yaml.state.json")
+
+	for path, content := range map[string]string{doc1: "first", doc2: "second"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func() *Processor {
+		t.Helper()
+		cfg := &DSLConfig{
+			Steps: []Step{
+				{
+					Name: "summarize",
+					Config: StepConfig{
+						Input:  []string{doc1, doc2},
+						Model:  "gpt-4o",
+						Action: "summarize",
+						Output: output,
+					},
+				},
+			},
+		}
+		proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+		if err := proc.EnableChangedOnly(statePath); err != nil {
+			t.Fatalf("EnableChangedOnly() error = %v", err)
+		}
+		if err := proc.Process(); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		return proc
+	}
+
+	// First run processes everything and records hashes
+	run()
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("expected state file to be written: %v", err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Fatalf("expected output on first run: %v", err)
+	}
+
+	// Second run with no changes skips the step entirely
+	if err := os.Remove(output); err != nil {
+		t.Fatal(err)
+	}
+	run()
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("expected unchanged step to be skipped, output stat err = %v", err)
+	}
+
+	// Changing one document reprocesses only that document
+	if err := os.WriteFile(doc2, []byte("second, revised"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+	if err := proc.EnableChangedOnly(statePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.processInputs([]string{doc1, doc2}); err != nil {
+		t.Fatal(err)
+	}
+	changed, _, skip := proc.filterUnchangedInputs("summarize")
+	if skip {
+		t.Fatal("expected step not to be skipped after a change")
+	}
+	inputs := proc.handler.GetInputs()
+	if len(inputs) != 1 || inputs[0].Path != doc2 {
+		t.Errorf("expected only %s to remain, got %d input(s)", doc2, len(inputs))
+	}
+	if _, ok := changed[doc2]; !ok || len(changed) != 1 {
+		t.Errorf("expected changed hashes for %s only, got %v", doc2, changed)
+	}
+}
+
+func TestDefaultStatePath(t *testing.T) {
+	got := DefaultStatePath(filepath.Join("workflows", "daily.yaml"))
+	want := filepath.Join("workflows", ".comanda", "daily.yaml.state.json")
+	if got != want {
+		t.Errorf("DefaultStatePath() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,270 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrInterrupted is returned by Process when its context is cancelled, for
+// example by Ctrl-C
+var ErrInterrupted = errors.New("workflow interrupted")
+
+// Checkpoint records how far a run got, so it can be resumed without
+// repeating finished steps
+type Checkpoint struct {
+	Saved           time.Time                    `json:"saved"`
+	Reason          string                       `json:"reason"`                     // Why the run stopped
+	Steps           []string                     `json:"steps"`                      // The workflow's sequential steps when saved
+	Groups          []string                     `json:"parallel_groups,omitempty"`  // Parallel groups that finished
+	Completed       []string                     `json:"completed,omitempty"`        // Sequential steps that finished, in order
+	ParallelResults map[string]map[string]string `json:"parallel_results,omitempty"` // Outputs of finished groups, for join steps
+	LastOutput      string                       `json:"last_output"`                // STDIN for the next step
+	Variables       map[string]string            `json:"variables,omitempty"`
+}
+
+// checkpointer tracks a run's progress for its checkpoint file
+type checkpointer struct {
+	path     string
+	resumed  *Checkpoint // Progress loaded for --resume, if any
+	progress Checkpoint
+}
+
+// DefaultCheckpointPath returns where a workflow's checkpoint is kept: a
+// .comanda directory next to the workflow
+func DefaultCheckpointPath(workflowFile string) string {
+	base := filepath.Base(workflowFile)
+	return filepath.Join(filepath.Dir(workflowFile), ".comanda", base+".checkpoint.json")
+}
+
+// SetContext sets the context that stops the run. When it is cancelled no
+// further steps start, and Process returns an error wrapping
+// ErrInterrupted.
+func (p *Processor) SetContext(ctx context.Context) {
+	p.ctx = ctx
+}
+
+// context returns the run's context
+func (p *Processor) context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// interrupted returns an error wrapping ErrInterrupted once the run's
+// context is cancelled, or ErrMaxDuration once its deadline passed
+func (p *Processor) interrupted() error {
+	if err := pastDeadline(p.context()); err != nil {
+		return err
+	}
+	if err := p.context().Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInterrupted, err)
+	}
+	return nil
+}
+
+// callProvider makes a provider call the run's context can interrupt.
+// Providers don't take a context, so a call still in flight when the run is
+// cancelled is abandoned: the run stops at once, and the response is
+// dropped when it arrives.
+func (p *Processor) callProvider(send func() (string, error)) (string, error) {
+	ctx := p.context()
+	if ctx.Done() == nil {
+		return send()
+	}
+	if err := p.interrupted(); err != nil {
+		return "", err
+	}
+	type result struct {
+		response string
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := send()
+		done <- result{response, err}
+	}()
+	select {
+	case r := <-done:
+		return r.response, r.err
+	case <-ctx.Done():
+		return "", p.interrupted()
+	}
+}
+
+// SetDrain sets a context that stops the run more gently than the one set
+// by SetContext: once it is done, steps in flight finish and are kept, but
+// no further steps start, and Process returns an error wrapping
+// ErrInterrupted.
+func (p *Processor) SetDrain(ctx context.Context) {
+	p.drain = ctx
+}
+
+// stopping returns an error wrapping ErrInterrupted once the run is
+// interrupted or drained, ErrMaxDuration once it ran past its deadline, or
+// ErrOverBudget once it went over its budget, for checks before a step
+// starts
+func (p *Processor) stopping() error {
+	if err := p.interrupted(); err != nil {
+		return err
+	}
+	if p.drain != nil && p.drain.Err() != nil {
+		return fmt.Errorf("%w: stopped before the next step", ErrInterrupted)
+	}
+	return p.overBudget()
+}
+
+// EnableCheckpoint saves the run's progress to path when it is interrupted
+// or a step fails, and removes the file when the run succeeds. With resume,
+// progress saved earlier is loaded so finished steps are skipped.
+func (p *Processor) EnableCheckpoint(path string, resume bool) error {
+	cp := &checkpointer{path: path}
+	if resume {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no checkpoint to resume from at %s", path)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading checkpoint %s: %w", path, err)
+		}
+		var saved Checkpoint
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return fmt.Errorf("error parsing checkpoint %s: %w", path, err)
+		}
+		if err := p.checkResumable(&saved); err != nil {
+			return err
+		}
+		cp.resumed = &saved
+	}
+	p.checkpoint = cp
+	return nil
+}
+
+// checkResumable checks that the steps a checkpoint finished still begin
+// the workflow, so skipping them is safe
+func (p *Processor) checkResumable(saved *Checkpoint) error {
+	for i, name := range saved.Completed {
+		if i >= len(p.config.Steps) || p.config.Steps[i].Name != name {
+			return fmt.Errorf("the workflow's steps changed since the checkpoint was saved; run it without --resume")
+		}
+	}
+	for _, group := range saved.Groups {
+		if _, ok := p.config.ParallelSteps[group]; !ok {
+			return fmt.Errorf("parallel group '%s' is no longer in the workflow; run it without --resume", group)
+		}
+	}
+	return nil
+}
+
+// CompletedSteps returns the steps and parallel groups that finished in
+// this run or the run it resumed, in order
+func (p *Processor) CompletedSteps() []string {
+	if p.checkpoint == nil {
+		return p.completed
+	}
+	var done []string
+	if r := p.checkpoint.resumed; r != nil {
+		done = append(done, r.Groups...)
+		done = append(done, r.Completed...)
+	}
+	return append(done, p.completed...)
+}
+
+// resumeGroup reports whether a parallel group finished in the resumed run,
+// restoring its results
+func (p *Processor) resumeGroup(group string) bool {
+	if p.checkpoint == nil || p.checkpoint.resumed == nil {
+		return false
+	}
+	for _, done := range p.checkpoint.resumed.Groups {
+		if done == group {
+			p.parallelResults[group] = p.checkpoint.resumed.ParallelResults[group]
+			p.checkpoint.progress.Groups = append(p.checkpoint.progress.Groups, group)
+			return true
+		}
+	}
+	return false
+}
+
+// resumeSteps returns how many sequential steps finished in the resumed
+// run, restoring the last output and variables they left
+func (p *Processor) resumeSteps() int {
+	if p.checkpoint == nil || p.checkpoint.resumed == nil {
+		return 0
+	}
+	r := p.checkpoint.resumed
+	if len(r.Completed) > 0 {
+		p.SetLastOutput(r.LastOutput)
+		for name, value := range r.Variables {
+			p.variables[name] = value
+		}
+	}
+	p.checkpoint.progress.Completed = append(p.checkpoint.progress.Completed, r.Completed...)
+	return len(r.Completed)
+}
+
+// finishGroup records a parallel group that finished
+func (p *Processor) finishGroup(group string) {
+	p.completed = append(p.completed, group)
+	if p.checkpoint != nil {
+		p.checkpoint.progress.Groups = append(p.checkpoint.progress.Groups, group)
+	}
+}
+
+// finishStep records a sequential step that finished
+func (p *Processor) finishStep(name string) {
+	p.completed = append(p.completed, name)
+	if p.checkpoint != nil {
+		p.checkpoint.progress.Completed = append(p.checkpoint.progress.Completed, name)
+	}
+}
+
+// saveCheckpoint writes the run's progress after it stopped with runErr, or
+// removes the checkpoint after a successful run. Nothing is written when no
+// step finished.
+func (p *Processor) saveCheckpoint(runErr error) error {
+	cp := p.checkpoint
+	if cp == nil {
+		return nil
+	}
+	if runErr == nil {
+		if err := os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing checkpoint: %w", err)
+		}
+		return nil
+	}
+	if len(cp.progress.Groups) == 0 && len(cp.progress.Completed) == 0 {
+		return nil
+	}
+
+	progress := cp.progress
+	progress.Saved = time.Now()
+	progress.Reason = runErr.Error()
+	progress.LastOutput = p.lastOutput
+	progress.Variables = p.variables
+	progress.ParallelResults = p.parallelResults
+	for _, step := range p.config.Steps {
+		progress.Steps = append(progress.Steps, step.Name)
+	}
+
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding checkpoint: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0755); err != nil {
+		return fmt.Errorf("error creating checkpoint directory: %w", err)
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, cp.path); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// interruptingProvider numbers its replies and cancels the run on the call
+// given by cancelOn, as Ctrl-C during that request would
+type interruptingProvider struct {
+	MockProvider
+	calls    int
+	cancelOn int
+	cancel   context.CancelFunc
+}
+
+func (i *interruptingProvider) SendPrompt(model, prompt string) (string, error) {
+	i.calls++
+	if i.calls == i.cancelOn {
+		i.cancel()
+		return "", fmt.Errorf("request failed: %w", context.Canceled)
+	}
+	return fmt.Sprintf("reply %d", i.calls), nil
+}
+
+func (i *interruptingProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+	return i.SendPrompt(model, prompt)
+}
+
+func withInterruptingProvider(t *testing.T, cancelOn int, cancel context.CancelFunc) *interruptingProvider {
+	t.Helper()
+	provider := &interruptingProvider{MockProvider: MockProvider{name: "openai"}, cancelOn: cancelOn, cancel: cancel}
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		return provider
+	}
+	t.Cleanup(func() { models.DetectProvider = previous })
+	return provider
+}
+
+func checkpointTestConfig(names ...string) *DSLConfig {
+	cfg := &DSLConfig{}
+	for i, name := range names {
+		input := "STDIN"
+		if i == 0 {
+			input = "NA"
+		}
+		cfg.Steps = append(cfg.Steps, Step{Name: name, Config: StepConfig{
+			Input: input, Model: "gpt-4o", Action: "Continue", Output: "STDOUT",
+		}})
+	}
+	return cfg
+}
+
+func TestInterruptSavesCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".comanda", "review.yaml.checkpoint.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider := withInterruptingProvider(t, 2, cancel)
+
+	proc := NewProcessor(checkpointTestConfig("first", "second", "third"), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetContext(ctx)
+	if err := proc.EnableCheckpoint(path, false); err != nil {
+		t.Fatalf("EnableCheckpoint() error = %v", err)
+	}
+	err := proc.Process()
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Process() error = %v, want ErrInterrupted", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider called %d times, want 2: no step should start after the interrupt", provider.calls)
+	}
+	if done := proc.CompletedSteps(); strings.Join(done, ",") != "first" {
+		t.Errorf("CompletedSteps() = %v, want [first]", done)
+	}
+
+	// Resuming skips the finished step and starts from its output
+	provider = withInterruptingProvider(t, 0, nil)
+	proc = NewProcessor(checkpointTestConfig("first", "second", "third"), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.EnableCheckpoint(path, true); err != nil {
+		t.Fatalf("EnableCheckpoint(resume) error = %v", err)
+	}
+	if proc.lastOutput != "" {
+		t.Fatalf("lastOutput restored before the run started")
+	}
+	if err := proc.Process(); err != nil {
+		t.Fatalf("resumed Process() error = %v", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("resumed run called the provider %d times, want 2", provider.calls)
+	}
+	if done := proc.CompletedSteps(); strings.Join(done, ",") != "first,second,third" {
+		t.Errorf("CompletedSteps() = %v", done)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint not removed after a successful run: %v", err)
+	}
+}
+
+func TestDrainFinishesStepInFlight(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	drain, stop := context.WithCancel(context.Background())
+	defer stop()
+	provider := withInterruptingProvider(t, 0, nil)
+	models.DetectProvider = func(modelName string) models.Provider {
+		return drainingProvider{provider, stop}
+	}
+
+	proc := NewProcessor(checkpointTestConfig("first", "second", "third"), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetDrain(drain)
+	if err := proc.EnableCheckpoint(path, false); err != nil {
+		t.Fatalf("EnableCheckpoint() error = %v", err)
+	}
+	err := proc.Process()
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Process() error = %v, want ErrInterrupted", err)
+	}
+	// The drain began during the first step, which is kept
+	if done := proc.CompletedSteps(); strings.Join(done, ",") != "first" {
+		t.Errorf("CompletedSteps() = %v, want [first]", done)
+	}
+	if provider.calls != 1 {
+		t.Errorf("provider called %d times, want 1", provider.calls)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("checkpoint not saved: %v", err)
+	}
+}
+
+// drainingProvider begins a drain with each request it answers
+type drainingProvider struct {
+	*interruptingProvider
+	stop context.CancelFunc
+}
+
+func (d drainingProvider) SendPrompt(model, prompt string) (string, error) {
+	d.stop()
+	return d.interruptingProvider.SendPrompt(model, prompt)
+}
+
+func (d drainingProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+	return d.SendPrompt(model, prompt)
+}
+
+func TestCheckpointContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	withInterruptingProvider(t, 3, cancel)
+
+	proc := NewProcessor(checkpointTestConfig("first", "second", "third"), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetContext(ctx)
+	if err := proc.EnableCheckpoint(path, false); err != nil {
+		t.Fatal(err)
+	}
+	proc.Process()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("checkpoint not written: %v", err)
+	}
+	for _, want := range []string{`"completed": [`, `"first"`, `"second"`, `"last_output": "reply 2"`, "interrupted"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("checkpoint does not contain %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestResumeRejectsChangedWorkflow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := os.WriteFile(path, []byte(`{"completed": ["first", "renamed"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	proc := NewProcessor(checkpointTestConfig("first", "second"), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.EnableCheckpoint(path, true); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("EnableCheckpoint() error = %v, want a changed workflow error", err)
+	}
+	if err := proc.EnableCheckpoint(filepath.Join(t.TempDir(), "missing.json"), true); err == nil {
+		t.Error("EnableCheckpoint() expected an error without a checkpoint")
+	}
+}
+
+func TestInterruptBeforeStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	provider := withInterruptingProvider(t, 0, nil)
+
+	proc := NewProcessor(checkpointTestConfig("first"), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetContext(ctx)
+	proc.EnableCheckpoint(path, false)
+	if err := proc.Process(); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Process() error = %v, want ErrInterrupted", err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("provider called %d times after the run was cancelled", provider.calls)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("checkpoint written although no step finished")
+	}
+}
+
+func TestCancelAbandonsProviderCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	proc := NewProcessor(checkpointTestConfig("first"), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetContext(ctx)
+
+	response, err := proc.callProvider(func() (string, error) { return "reply", nil })
+	if response != "reply" || err != nil {
+		t.Fatalf("callProvider() = %q, %v", response, err)
+	}
+
+	// A call that never answers is left behind once the run is cancelled
+	hang := make(chan struct{})
+	defer close(hang)
+	started := make(chan struct{})
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err = proc.callProvider(func() (string, error) {
+		close(started)
+		<-hang
+		return "late", nil
+	})
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("callProvider() error = %v, want ErrInterrupted", err)
+	}
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/chunker"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// Defaults of a chunked step's parallel and max_attempts
+const (
+	DefaultChunkWorkers  = 4
+	DefaultChunkAttempts = 3
+)
+
+// chunkRetryWait is how long a failed chunk waits before its first retry;
+// it doubles for each retry after that
+var chunkRetryWait = time.Second
+
+// chunkWorkers returns how many of a step's chunks are sent at once
+func (p *Processor) chunkWorkers(chunk *ChunkConfig) int {
+	if p.debugger != nil {
+		return 1 // Prompts are reviewed one at a time, in order
+	}
+	if chunk.Parallel > 0 {
+		return chunk.Parallel
+	}
+	return DefaultChunkWorkers
+}
+
+// chunkAttempts returns how many times a chunk is sent before it fails
+func chunkAttempts(chunk *ChunkConfig) int {
+	if chunk.MaxAttempts > 0 {
+		return chunk.MaxAttempts
+	}
+	return DefaultChunkAttempts
+}
+
+// chunkResult is the response to one chunk
+type chunkResult struct {
+	response string
+	err      error
+}
+
+// processChunks sends each chunk of a step's input to the model with the
+// step's action, several at a time, and joins the responses in chunk
+// order. A chunk that fails is retried on its own; if it still fails, the
+// other chunks' responses are kept and the failure is listed after them.
+// The step fails only when every chunk does.
+func (p *Processor) processChunks(step Step, modelName string, actions []string, chunks *chunker.ChunkResult) (string, error) {
+	if len(actions) == 0 {
+		return "", fmt.Errorf("no actions processed")
+	}
+	provider, err := p.stepProvider(step.Name, modelName)
+	if err != nil {
+		return "", err
+	}
+	action, err := p.loadAction(actions[0])
+	if err != nil {
+		return "", err
+	}
+	action = p.substituteVariables(action)
+
+	inputs := p.handler.GetInputs()
+	total := len(inputs)
+	workers := p.chunkWorkers(step.Config.Chunk)
+	attempts := chunkAttempts(step.Config.Chunk)
+	p.debugf("Processing %d chunks of step %s with %d workers", total, step.Name, workers)
+
+	results := make([]chunkResult, total)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < total; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				response, err := p.sendChunk(step.Name, provider, modelName, action, inputs[i], i, chunks.TotalChunks, attempts)
+				results[i] = chunkResult{response, err}
+			}
+		}()
+	}
+	for i := 0; i < total; i++ {
+		if err := p.interrupted(); err != nil {
+			results[i].err = err
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if err := p.interrupted(); err != nil {
+		return "", err
+	}
+
+	var responses, failures []string
+	for i, result := range results {
+		if errors.Is(result.err, ErrStepSkipped) {
+			continue
+		}
+		if result.err != nil {
+			failures = append(failures, fmt.Sprintf("Error processing file %s: %v", inputs[i].Path, result.err))
+			continue
+		}
+		responses = append(responses, fmt.Sprintf("Results for %s:\n%s", inputs[i].Path, result.response))
+	}
+	if len(responses) == 0 && len(failures) > 0 {
+		return "", fmt.Errorf("all %d chunks failed processing: %s", total, strings.Join(failures, "; "))
+	}
+	if len(responses) == 0 {
+		return "", ErrStepSkipped // Every chunk was skipped in the debugger
+	}
+
+	combined := strings.Join(responses, "\n\n")
+	if len(failures) > 0 {
+		combined += fmt.Sprintf("\n\nWarning: %d of %d chunks could not be processed:\n", len(failures), total) +
+			strings.Join(failures, "\n")
+	}
+	return combined, nil
+}
+
+// sendChunk sends chunk i of total, retrying up to attempts times in all
+func (p *Processor) sendChunk(stepName string, provider models.Provider, modelName, action string, chunk *input.Input, i, total, attempts int) (string, error) {
+	p.emitChunk(stepName, i+1, total)
+	contents, err := chunk.Load()
+	if err != nil {
+		return "", fmt.Errorf("error reading chunk in step %s: %w", stepName, err)
+	}
+	prompt := strings.ReplaceAll(action, "{{ chunk_index }}", fmt.Sprintf("%d", i+1))
+	prompt = strings.ReplaceAll(prompt, "{{ total_chunks }}", fmt.Sprintf("%d", total))
+	prompt = strings.ReplaceAll(prompt, "{{ current_chunk }}", string(contents))
+	file := models.FileInput{Path: chunk.Path, MimeType: chunk.MimeType}
+
+	wait := chunkRetryWait
+	for attempt := 1; ; attempt++ {
+		response, err := provider.SendPromptWithFile(modelName, fmt.Sprintf("For this file: %s", prompt), file)
+		if err == nil || attempt >= attempts || errors.Is(err, ErrStepSkipped) || p.interrupted() != nil {
+			return response, err
+		}
+		p.emitChunkRetry(stepName, i+1, total, attempt, attempts-1, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-p.context().Done():
+			return "", p.interrupted()
+		}
+		wait *= 2
+	}
+}
+
+// emitChunkRetry reports that chunk n of total failed and is retried
+func (p *Processor) emitChunkRetry(stepName string, n, total, attempt, retries int, wait time.Duration, err error) {
+	msg := fmt.Sprintf("Chunk %d/%d of step %s failed, retrying in %v (attempt %d/%d): %v", n, total, stepName, wait, attempt, retries, err)
+	config.WriteLog("[RUN] ", "%s", msg)
+	p.debugf(msg)
+	p.emit(ProgressUpdate{
+		Type:        ProgressRetry,
+		Message:     msg,
+		Step:        p.runningStep(stepName),
+		Chunk:       n,
+		Chunks:      total,
+		Attempt:     attempt,
+		MaxAttempts: retries,
+		Wait:        wait,
+	})
+}
@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// chunkProvider answers each chunk after a delay that makes later chunks
+// finish first. Chunks listed in flaky fail once; those in broken always
+// fail.
+type chunkProvider struct {
+	MockProvider
+	flaky, broken map[string]bool
+
+	mu       sync.Mutex
+	calls    map[string]int
+	inFlight int
+	peak     int
+}
+
+var chunkName = regexp.MustCompile(`c\d+`)
+
+func (c *chunkProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+	name := chunkName.FindString(prompt)
+	c.mu.Lock()
+	c.calls[name]++
+	calls := c.calls[name]
+	c.inFlight++
+	if c.inFlight > c.peak {
+		c.peak = c.inFlight
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+
+	var n int
+	fmt.Sscanf(name, "c%d", &n)
+	time.Sleep(time.Duration(10-n) * 5 * time.Millisecond)
+	if c.broken[name] || (c.flaky[name] && calls == 1) {
+		return "", fmt.Errorf("server error for %s", name)
+	}
+	return "reply " + name, nil
+}
+
+func TestChunksRunInParallelInOrder(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	previousWait := chunkRetryWait
+	chunkRetryWait = 0
+	defer func() { chunkRetryWait = previousWait }()
+
+	provider := &chunkProvider{
+		MockProvider: MockProvider{name: "openai"},
+		flaky:        map[string]bool{"c3": true},
+		broken:       map[string]bool{"c5": true},
+		calls:        make(map[string]int),
+	}
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return provider }
+	defer func() { models.DetectProvider = previous }()
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("c1\nc2\nc3\nc4\nc5\nc6\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &DSLConfig{Steps: []Step{{Name: "summarize", Config: StepConfig{
+		Input:  path,
+		Model:  "gpt-4o",
+		Action: "Echo {{ current_chunk }} ({{ chunk_index }}/{{ total_chunks }})",
+		Output: "STDOUT",
+		Chunk:  &ChunkConfig{By: "lines", Size: 1, Parallel: 3},
+	}}}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	// Responses come back in chunk order, though later chunks finished first
+	var replies []string
+	for _, line := range strings.Split(proc.LastOutput(), "\n") {
+		if strings.HasPrefix(line, "reply ") {
+			replies = append(replies, strings.TrimPrefix(line, "reply "))
+		}
+	}
+	if got := strings.Join(replies, ","); got != "c1,c2,c3,c4,c6" {
+		t.Errorf("replies = %s, want c1,c2,c3,c4,c6", got)
+	}
+	if !strings.Contains(proc.LastOutput(), "1 of 6 chunks could not be processed") {
+		t.Errorf("output doesn't report the failed chunk:\n%s", proc.LastOutput())
+	}
+
+	// Only the failed chunks were retried
+	if provider.calls["c3"] != 2 || provider.calls["c5"] != DefaultChunkAttempts || provider.calls["c1"] != 1 {
+		t.Errorf("calls = %v, want c3 sent twice, c5 %d times and the rest once", provider.calls, DefaultChunkAttempts)
+	}
+	if provider.peak < 2 || provider.peak > 3 {
+		t.Errorf("%d chunks were sent at once, want 2 or 3 with parallel: 3", provider.peak)
+	}
+}
+
+func TestAllChunksFailing(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	previousWait := chunkRetryWait
+	chunkRetryWait = 0
+	defer func() { chunkRetryWait = previousWait }()
+
+	provider := &chunkProvider{
+		MockProvider: MockProvider{name: "openai"},
+		broken:       map[string]bool{"c1": true, "c2": true},
+		calls:        make(map[string]int),
+	}
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return provider }
+	defer func() { models.DetectProvider = previous }()
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("c1\nc2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &DSLConfig{Steps: []Step{{Name: "summarize", Config: StepConfig{
+		Input: path, Model: "gpt-4o", Action: "Echo {{ current_chunk }}", Output: "STDOUT",
+		Chunk: &ChunkConfig{By: "lines", Size: 1, MaxAttempts: 1},
+	}}}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	err := proc.Process()
+	if err == nil || !strings.Contains(err.Error(), "all 2 chunks failed") {
+		t.Errorf("Process() error = %v, want all chunks failed", err)
+	}
+	if provider.calls["c1"] != 1 {
+		t.Errorf("c1 sent %d times, want once with max_attempts: 1", provider.calls["c1"])
+	}
+}
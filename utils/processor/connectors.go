@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/connectors"
+)
+
+// fetchDocuments fetches the documents a connector input names; tests
+// replace it
+var fetchDocuments = connectors.Fetch
+
+// connectorInput returns the connector a step's input map names, such as
+// gdrive, and the documents it lists
+func connectorInput(input map[string]interface{}) (string, []string) {
+	for _, kind := range connectors.Kinds {
+		switch v := input[kind].(type) {
+		case string:
+			return kind, []string{v}
+		case []interface{}:
+			var refs []string
+			for _, item := range v {
+				if ref, ok := item.(string); ok {
+					refs = append(refs, ref)
+				}
+			}
+			return kind, refs
+		}
+	}
+	return "", nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._ -]+`)
+
+// documentFileName names the file a fetched document is saved in after its
+// title, numbering it when an earlier document took the name
+func documentFileName(doc connectors.Document, used map[string]bool) string {
+	base := strings.TrimSpace(unsafeFileChars.ReplaceAllString(doc.Title, "-"))
+	if base == "" {
+		base = "document"
+	}
+	if len(base) > 100 {
+		base = base[:100]
+	}
+	name := base + doc.Ext
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, doc.Ext)
+	}
+	used[name] = true
+	return name
+}
+
+// fetchConnectorInputs saves the documents a connector input names, named
+// after their titles, in a temporary directory. It returns their paths and
+// a function removing them.
+func (p *Processor) fetchConnectorInputs(stepName, kind string, refs []string) ([]string, func(), error) {
+	if len(refs) == 0 {
+		return nil, nil, fmt.Errorf("%s input of step %s names no documents", kind, stepName)
+	}
+	dir, err := os.MkdirTemp(config.TempDir(), "comanda-"+kind+"-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	var paths []string
+	used := make(map[string]bool)
+	for _, ref := range refs {
+		p.debugf("Fetching %s from %s for step %s", ref, kind, stepName)
+		docs, err := fetchDocuments(p.context(), p.envConfig.ConnectorSettings(), kind, ref)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		for _, doc := range docs {
+			path := filepath.Join(dir, documentFileName(doc, used))
+			if err := os.WriteFile(path, doc.Content, 0600); err != nil {
+				cleanup()
+				return nil, nil, fmt.Errorf("failed to save %s: %w", doc.Title, err)
+			}
+			p.trustPath(path)
+			paths = append(paths, path)
+		}
+	}
+	p.debugf("Fetched %d document(s) from %s for step %s", len(paths), kind, stepName)
+	return paths, cleanup, nil
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/connectors"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// withFakeDocuments makes connector inputs return a page titled Runbook
+// holding the ref, line by line
+func withFakeDocuments(t *testing.T) *[]string {
+	var fetched []string
+	previous := fetchDocuments
+	fetchDocuments = func(ctx context.Context, settings config.ConnectorsConfig, kind, ref string) ([]connectors.Document, error) {
+		fetched = append(fetched, kind+":"+ref)
+		content := strings.ReplaceAll(ref, ",", "\n")
+		return []connectors.Document{{Title: "Runbook", Source: ref, Content: []byte(content), Ext: ".md"}}, nil
+	}
+	t.Cleanup(func() { fetchDocuments = previous })
+	return &fetched
+}
+
+func TestConnectorInputIsChunked(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	fetched := withFakeDocuments(t)
+	provider := &chunkProvider{MockProvider: MockProvider{name: "openai"}, calls: make(map[string]int)}
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return provider }
+	defer func() { models.DetectProvider = previous }()
+
+	cfg := &DSLConfig{Steps: []Step{{Name: "summarize", Config: StepConfig{
+		Input:  map[string]interface{}{"notion": "c1,c2"},
+		Model:  "gpt-4o",
+		Action: "Echo {{ current_chunk }}",
+		Output: "STDOUT",
+		Chunk:  &ChunkConfig{By: "lines", Size: 1},
+	}}}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if len(*fetched) != 1 || (*fetched)[0] != "notion:c1,c2" {
+		t.Errorf("fetched %v, want the notion page", *fetched)
+	}
+	if provider.calls["c1"] != 1 || provider.calls["c2"] != 1 {
+		t.Errorf("calls = %v, want the page sent one line per chunk", provider.calls)
+	}
+}
+
+func TestConnectorInputFiles(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	fetched := withFakeDocuments(t)
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return NewMockProvider("openai") }
+	defer func() { models.DetectProvider = previous }()
+
+	cfg := &DSLConfig{Steps: []Step{{Name: "summarize", Config: StepConfig{
+		Input:     map[string]interface{}{"gdrive": []interface{}{"doc1", "doc2"}},
+		Model:     "gpt-4o",
+		Action:    "Summarize",
+		Output:    "STDOUT",
+		BatchMode: "individual",
+	}}}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := strings.Join(*fetched, " "); got != "gdrive:doc1 gdrive:doc2" {
+		t.Errorf("fetched %s, want both documents", got)
+	}
+	for _, name := range []string{"Runbook.md", "Runbook-2.md"} {
+		if !strings.Contains(proc.LastOutput(), string(filepath.Separator)+name) {
+			t.Errorf("output doesn't mention %s:\n%s", name, proc.LastOutput())
+		}
+	}
+
+	// The fetched documents are removed after the step
+	dirs, _ := filepath.Glob(filepath.Join(config.TempDir(), "comanda-gdrive-*"))
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "Runbook.md")); err == nil {
+			t.Errorf("fetched documents were left in %s", dir)
+		}
+	}
+}
+
+func TestConnectorInputValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.missingInputs(StepConfig{Input: map[string]interface{}{"confluence": "123"}})
+	if len(errs) != 1 || !strings.Contains(errs[0], "connectors.confluence") {
+		t.Errorf("missingInputs() = %v, want the missing Confluence credentials", errs)
+	}
+	if name := documentFileName(connectors.Document{Title: "Q3 / Plan: draft?", Ext: ".md"}, map[string]bool{}); name != "Q3 - Plan- draft-.md" {
+		t.Errorf("documentFileName() = %q", name)
+	}
+}
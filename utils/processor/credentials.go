@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"github.com/kris-hansen/comanda/utils/secrets"
+)
+
+// SetCredentials makes the run use a credential set of the env config
+// instead of the one its workflow names
+func (p *Processor) SetCredentials(name string) {
+	p.credentials = name
+}
+
+// credentialSet returns the credential set the run uses, if any
+func (p *Processor) credentialSet() string {
+	if p.credentials != "" {
+		return p.credentials
+	}
+	return p.config.Credentials
+}
+
+// useCredentials switches the run's providers to the keys of its credential
+// set. The keys are fetched from their secret manager for this run only;
+// the shared keys are left as they are.
+func (p *Processor) useCredentials() error {
+	name := p.credentialSet()
+	if name == "" || p.resolver != nil || p.envConfig == nil {
+		return nil
+	}
+	cfg, err := p.envConfig.WithCredentials(name, func(ref string) (string, error) {
+		return secrets.Default().Resolve(p.context(), ref)
+	})
+	if err != nil {
+		return err
+	}
+	p.envConfig = cfg
+	p.debugf("Using the provider keys of credential set %s", name)
+	return nil
+}
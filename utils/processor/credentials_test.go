@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+func TestUseCredentials(t *testing.T) {
+	resolver := secrets.New(config.SecretsConfig{})
+	resolver.Use("vault", mapSecrets{
+		"secret/data/acme":    `{"openai":"sk-acme"}`,
+		"secret/data/globex":  `{"openai":"sk-globex"}`,
+		"secret/data/initech": `{"other":"x"}`,
+	})
+	secrets.SetDefault(resolver)
+	t.Cleanup(func() { secrets.SetDefault(nil) })
+
+	envConfig := createTestEnvConfig()
+	envConfig.Credentials = map[string]config.CredentialSet{
+		"acme":    {"openai": "vault://secret/data/acme#openai"},
+		"globex":  {"openai": "vault://secret/data/globex#openai"},
+		"initech": {"openai": "vault://secret/data/initech#openai"},
+	}
+	var dslConfig DSLConfig
+	if err := yaml.Unmarshal([]byte("credentials: acme\nsummarize:\n  input: NA\n  model: gpt-4o\n  action: hi\n  output: STDOUT\n"), &dslConfig); err != nil {
+		t.Fatal(err)
+	}
+	if dslConfig.Credentials != "acme" {
+		t.Fatalf("Credentials = %q, want acme", dslConfig.Credentials)
+	}
+
+	proc := NewProcessor(&dslConfig, envConfig, nil, false)
+	if err := proc.useCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if key := proc.envConfig.Providers["openai"].APIKey; key != "sk-acme" {
+		t.Errorf("openai key = %s, want the workflow's credential set", key)
+	}
+	if envConfig.Providers["openai"].APIKey != "test-openai-key" {
+		t.Error("the shared key was replaced")
+	}
+
+	// A run's own set wins over the workflow's
+	proc = NewProcessor(&dslConfig, envConfig, nil, false)
+	proc.SetCredentials("globex")
+	if err := proc.useCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if key := proc.envConfig.Providers["openai"].APIKey; key != "sk-globex" {
+		t.Errorf("openai key = %s, want the run's credential set", key)
+	}
+
+	proc = NewProcessor(&dslConfig, envConfig, nil, false)
+	proc.SetCredentials("initech")
+	if err := proc.useCredentials(); err == nil || !strings.Contains(err.Error(), "credential set 'initech'") {
+		t.Errorf("useCredentials() error = %v, want one naming the set", err)
+	}
+
+	// Validation checks the set without fetching its keys
+	dslConfig.Credentials = "hooli"
+	issues := NewProcessor(&dslConfig, envConfig, nil, false).Validate()
+	if len(issues) == 0 || !strings.Contains(issues[0].Message, "credential set 'hooli' not found") {
+		t.Errorf("Validate() = %v, want the missing credential set reported", issues)
+	}
+}
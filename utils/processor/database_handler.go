@@ -46,7 +46,7 @@ func (p *Processor) handleDatabaseInput(input interface{}) error {
 			return fmt.Errorf("error converting results to JSON: %w", err)
 		}
 
-		p.lastOutput = string(jsonData)
+		p.SetLastOutput(string(jsonData))
 		return nil
 	} else {
 		// Handle write operation
@@ -55,7 +55,7 @@ func (p *Processor) handleDatabaseInput(input interface{}) error {
 			return fmt.Errorf("database write error: %w", err)
 		}
 
-		p.lastOutput = fmt.Sprintf("Affected rows: %d", affected)
+		p.SetLastOutput(fmt.Sprintf("Affected rows: %d", affected))
 		return nil
 	}
 }
@@ -88,6 +88,6 @@ func (p *Processor) handleDatabaseOutput(output string, dbConfig map[string]inte
 		return fmt.Errorf("database write error: %w", err)
 	}
 
-	p.lastOutput = fmt.Sprintf("Affected rows: %d", affected)
+	p.SetLastOutput(fmt.Sprintf("Affected rows: %d", affected))
 	return nil
 }
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMaxDuration is wrapped by the error of a run that stopped because it
+// ran past its max_duration
+var ErrMaxDuration = errors.New("run exceeded its max duration")
+
+// parseMaxDuration parses a workflow's max_duration, such as 30m or 1h30m
+func parseMaxDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max_duration %q: use a duration such as 90s, 30m or 2h", value)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid max_duration %q: it must be positive", value)
+	}
+	return d, nil
+}
+
+// SetMaxDuration limits how long the run may take, replacing the workflow's
+// max_duration. Zero keeps the workflow's limit.
+func (p *Processor) SetMaxDuration(d time.Duration) {
+	p.maxDuration = d
+}
+
+// MaxDuration returns how long the run may take: the limit set by
+// SetMaxDuration, or else the workflow's max_duration. Zero means no limit.
+func (p *Processor) MaxDuration() time.Duration {
+	if p.maxDuration > 0 {
+		return p.maxDuration
+	}
+	if p.config.MaxDuration == "" {
+		return 0
+	}
+	d, _ := parseMaxDuration(p.config.MaxDuration) // Checked when the workflow was parsed
+	return d
+}
+
+// WithMaxDuration returns a context that is done once d has passed, whose
+// cause wraps ErrMaxDuration. Callers set it as the run's context so HTTP
+// requests made for the run are tied to the same deadline. With d zero the
+// context only stops when ctx does.
+func WithMaxDuration(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, d, fmt.Errorf("%w of %s", ErrMaxDuration, d))
+}
+
+// pastDeadline returns the error of a run stopped by its max duration, or
+// nil when its context is live or was cancelled for another reason
+func pastDeadline(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMaxDuration) {
+		return cause
+	}
+	return nil
+}
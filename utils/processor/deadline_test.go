@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+// hangingProvider answers no prompt until released, as a provider retrying
+// a rate limit for minutes would
+type hangingProvider struct {
+	MockProvider
+	release chan struct{}
+}
+
+func (h *hangingProvider) SendPrompt(model, prompt string) (string, error) {
+	<-h.release
+	return "late", nil
+}
+
+func (h *hangingProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+	return h.SendPrompt(model, prompt)
+}
+
+func TestMaxDurationParsing(t *testing.T) {
+	var cfg DSLConfig
+	workflow := "max_duration: 30m\nsummarize:\n  input: NA\n  model: gpt-4o\n  action: Summarize\n  output: STDOUT\n"
+	if err := yaml.Unmarshal([]byte(workflow), &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(cfg.Steps) != 1 {
+		t.Fatalf("got %d steps, want 1: max_duration is not a step", len(cfg.Steps))
+	}
+
+	proc := NewProcessor(&cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	if got := proc.MaxDuration(); got != 30*time.Minute {
+		t.Errorf("MaxDuration() = %v, want 30m", got)
+	}
+	proc.SetMaxDuration(time.Minute)
+	if got := proc.MaxDuration(); got != time.Minute {
+		t.Errorf("MaxDuration() after SetMaxDuration = %v, want 1m", got)
+	}
+
+	for _, value := range []string{"soon", "0s", "-5m"} {
+		var bad DSLConfig
+		err := yaml.Unmarshal([]byte("max_duration: "+value+"\n"), &bad)
+		if err == nil || !strings.Contains(err.Error(), "max_duration") {
+			t.Errorf("max_duration %s: error = %v, want an invalid max_duration error", value, err)
+		}
+	}
+}
+
+func TestMaxDurationStopsRun(t *testing.T) {
+	provider := &hangingProvider{MockProvider: MockProvider{name: "openai"}, release: make(chan struct{})}
+	defer close(provider.release)
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return provider }
+	defer func() { models.DetectProvider = previous }()
+
+	proc := NewProcessor(checkpointTestConfig("first", "second"), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetMaxDuration(50 * time.Millisecond)
+	start := time.Now()
+	err := proc.Process()
+	if !errors.Is(err, ErrMaxDuration) {
+		t.Fatalf("Process() error = %v, want ErrMaxDuration", err)
+	}
+	if errors.Is(err, ErrInterrupted) {
+		t.Errorf("Process() error = %v, should not count as an interrupt", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Process() took %v, want it stopped at the deadline", elapsed)
+	}
+}
+
+func TestMaxDurationKeepsOuterDeadline(t *testing.T) {
+	// A parent context with a shorter deadline still stops the run
+	ctx, cancel := WithMaxDuration(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	proc := NewProcessor(checkpointTestConfig("first"), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetContext(ctx)
+	proc.SetMaxDuration(time.Hour)
+
+	hang := make(chan struct{})
+	defer close(hang)
+	_, err := proc.callProvider(func() (string, error) {
+		<-hang
+		return "late", nil
+	})
+	if !errors.Is(err, ErrMaxDuration) {
+		t.Errorf("callProvider() error = %v, want ErrMaxDuration", err)
+	}
+}
@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// ErrStepSkipped is returned by a step's prompt when a debugger skips it
+var ErrStepSkipped = errors.New("step skipped by debugger")
+
+// Debugger decisions
+const (
+	DebugSend    = "send"    // Send the prompt, possibly edited
+	DebugRespond = "respond" // Use a fake response instead of calling the model
+	DebugSkip    = "skip"    // Skip the rest of the step
+	DebugAbort   = "abort"   // Stop the workflow
+)
+
+// PromptRequest is a fully rendered prompt about to be sent to a model
+type PromptRequest struct {
+	Step   string
+	Model  string
+	Prompt string
+	File   string // Path of the attached file, if any
+}
+
+// PromptDecision tells the processor what to do with a prompt
+type PromptDecision struct {
+	Action   string
+	Prompt   string // Prompt to send, for DebugSend
+	Response string // Fake response, for DebugRespond
+}
+
+// StepDebugger is consulted before every prompt a step sends. It is called
+// from parallel steps concurrently.
+type StepDebugger interface {
+	BeforePrompt(req PromptRequest) PromptDecision
+}
+
+// SetDebugger sets the debugger that reviews prompts before they are sent
+func (p *Processor) SetDebugger(d StepDebugger) {
+	p.debugger = d
+}
+
+// debugProvider routes a step's prompts through the debugger, if one is set
+func (p *Processor) debugProvider(stepName string, provider models.Provider) models.Provider {
+	if p.debugger == nil {
+		return provider
+	}
+	return &debugProvider{Provider: provider, step: stepName, debugger: p.debugger}
+}
+
+// debugProvider asks the debugger about each prompt before passing it on
+type debugProvider struct {
+	models.Provider
+	step     string
+	debugger StepDebugger
+}
+
+func (d *debugProvider) SendPrompt(modelName, prompt string) (string, error) {
+	decision := d.debugger.BeforePrompt(PromptRequest{Step: d.step, Model: modelName, Prompt: prompt})
+	if response, done, err := d.resolve(decision); done {
+		return response, err
+	}
+	return d.Provider.SendPrompt(modelName, decision.Prompt)
+}
+
+func (d *debugProvider) SendPromptWithFile(modelName, prompt string, file models.FileInput) (string, error) {
+	decision := d.debugger.BeforePrompt(PromptRequest{Step: d.step, Model: modelName, Prompt: prompt, File: file.Path})
+	if response, done, err := d.resolve(decision); done {
+		return response, err
+	}
+	return d.Provider.SendPromptWithFile(modelName, decision.Prompt, file)
+}
+
+// resolve handles every decision except sending the prompt
+func (d *debugProvider) resolve(decision PromptDecision) (string, bool, error) {
+	switch decision.Action {
+	case DebugSend:
+		return "", false, nil
+	case DebugRespond:
+		return decision.Response, true, nil
+	case DebugSkip:
+		return "", true, ErrStepSkipped
+	case DebugAbort:
+		return "", true, fmt.Errorf("workflow stopped in debugger at step '%s'", d.step)
+	}
+	return "", true, fmt.Errorf("unknown debugger decision '%s'", decision.Action)
+}
@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+// scriptedDebugger returns a fixed decision per step and records the prompts it saw
+type scriptedDebugger struct {
+	decisions map[string]PromptDecision
+	seen      []PromptRequest
+}
+
+func (d *scriptedDebugger) BeforePrompt(req PromptRequest) PromptDecision {
+	d.seen = append(d.seen, req)
+	if decision, ok := d.decisions[req.Step]; ok {
+		return decision
+	}
+	return PromptDecision{Action: DebugSend, Prompt: req.Prompt}
+}
+
+func debuggerTestConfig() *DSLConfig {
+	step := func(name, action string) Step {
+		return Step{Name: name, Config: StepConfig{Input: "NA", Model: "gpt-4o", Action: action, Output: "STDOUT"}}
+	}
+	return &DSLConfig{Steps: []Step{
+		step("draft", "Draft the notes"),
+		step("edit", "Edit the notes"),
+		step("fake", "Translate the notes"),
+		step("skip", "Publish the notes"),
+	}}
+}
+
+func TestDebugger(t *testing.T) {
+	scripted := withScriptedProvider(t, "drafted", "edited")
+	debugger := &scriptedDebugger{decisions: map[string]PromptDecision{
+		"edit": {Action: DebugSend, Prompt: "Edit the notes tersely"},
+		"fake": {Action: DebugRespond, Response: "traduit"},
+		"skip": {Action: DebugSkip},
+	}}
+	recorder := &sliceRecorder{}
+
+	proc := NewProcessor(debuggerTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetDebugger(debugger)
+	proc.SetStepRecorder(recorder)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if len(debugger.seen) != 4 || debugger.seen[0].Prompt != "Draft the notes" || debugger.seen[0].Model != "gpt-4o" {
+		t.Errorf("debugger saw %+v", debugger.seen)
+	}
+	if strings.Join(scripted.prompts, "|") != "Draft the notes|Edit the notes tersely" {
+		t.Errorf("provider received %q", scripted.prompts)
+	}
+	responses := make(map[string]string)
+	for _, r := range recorder.records {
+		responses[r.Name] = r.Response
+	}
+	if responses["edit"] != "edited" || responses["fake"] != "traduit" || responses["skip"] != "" {
+		t.Errorf("step responses = %v", responses)
+	}
+}
+
+func TestDebuggerAbort(t *testing.T) {
+	withScriptedProvider(t)
+	proc := NewProcessor(debuggerTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetDebugger(&scriptedDebugger{decisions: map[string]PromptDecision{"draft": {Action: DebugAbort}}})
+	err := proc.Process()
+	if err == nil || !strings.Contains(err.Error(), "stopped in debugger at step 'draft'") {
+		t.Fatalf("Process() error = %v", err)
+	}
+}
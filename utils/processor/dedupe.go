@@ -0,0 +1,313 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StepTypeDedupe is the type of steps that drop near-duplicate items
+const StepTypeDedupe = "dedupe"
+
+// DefaultDedupeThreshold is the similarity at which a dedupe step counts
+// two items as duplicates when threshold is unset
+const DefaultDedupeThreshold = 0.9
+
+// What a dedupe step compares: whole inputs, their lines, paragraphs, CSV
+// rows or the chunks of the step's chunk configuration
+var dedupeUnits = []string{"documents", "lines", "paragraphs", "rows", "chunks"}
+
+// isDedupeStep reports whether a step is a dedupe step
+func isDedupeStep(cfg StepConfig) bool {
+	return cfg.Type == StepTypeDedupe
+}
+
+// dedupeStepErrors lists the problems with a dedupe step
+func (p *Processor) dedupeStepErrors(config StepConfig) []string {
+	var errors []string
+	if inputs := p.NormalizeStringSlice(config.Input); len(inputs) == 0 || inputs[0] == "NA" {
+		errors = append(errors, "dedupe steps need items as input: STDIN or files")
+	}
+	if modelNames := p.NormalizeStringSlice(config.Model); len(modelNames) != 1 || modelNames[0] == "NA" {
+		errors = append(errors, "dedupe steps need one embedding model")
+	}
+	if settings := config.Dedupe; settings != nil {
+		if settings.By != "" && !slices.Contains(dedupeUnits, settings.By) {
+			errors = append(errors, fmt.Sprintf("unknown dedupe.by '%s' (expected %s)", settings.By, strings.Join(dedupeUnits, ", ")))
+		}
+		if settings.By == "chunks" && config.Chunk == nil {
+			errors = append(errors, "dedupe.by chunks needs a chunk configuration")
+		}
+		if len(settings.Columns) > 0 && settings.By != "rows" {
+			errors = append(errors, "dedupe.columns needs dedupe.by rows")
+		}
+		if settings.Threshold < 0 || settings.Threshold > 1 {
+			errors = append(errors, "dedupe.threshold must be between 0 and 1")
+		}
+		if settings.Keep != "" && settings.Keep != "first" && settings.Keep != "longest" {
+			errors = append(errors, fmt.Sprintf("unknown dedupe.keep '%s' (expected first or longest)", settings.Keep))
+		}
+	}
+	if len(p.NormalizeStringSlice(config.Output)) == 0 {
+		errors = append(errors, "output is required for dedupe steps (can be STDOUT for console output)")
+	}
+	return errors
+}
+
+// dedupeItem is one of the things a dedupe step compares
+type dedupeItem struct {
+	source string   // Input the item comes from, with its chunk number for chunks
+	text   string   // The item as it is output
+	key    string   // The text compared
+	row    []string // The CSV row of a rows item
+}
+
+// dedupeItems splits a dedupe step's inputs into the items it compares.
+// For rows it returns the CSV header the inputs share too.
+func (p *Processor) dedupeItems(sources []vectorSource, settings DedupeStep, chunk *ChunkConfig) ([]dedupeItem, []string, error) {
+	var items []dedupeItem
+	var header []string
+	for _, src := range sources {
+		switch settings.By {
+		case "lines", "paragraphs":
+			sep := "\n"
+			if settings.By == "paragraphs" {
+				sep = "\n\n"
+			}
+			for _, part := range strings.Split(strings.ReplaceAll(src.text, "\r\n", "\n"), sep) {
+				if part = strings.TrimSpace(part); part != "" {
+					items = append(items, dedupeItem{source: src.name, text: part, key: part})
+				}
+			}
+		case "rows":
+			records, err := csv.NewReader(strings.NewReader(src.text)).ReadAll()
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing CSV %s: %w", src.name, err)
+			}
+			if len(records) == 0 {
+				continue
+			}
+			if header == nil {
+				header = records[0]
+				for _, column := range settings.Columns {
+					if !slices.Contains(header, column) {
+						return nil, nil, fmt.Errorf("CSV %s has no column %s", src.name, column)
+					}
+				}
+			} else if !slices.Equal(header, records[0]) {
+				return nil, nil, fmt.Errorf("CSV %s has other columns than the inputs before it", src.name)
+			}
+			for _, row := range records[1:] {
+				items = append(items, dedupeItem{source: src.name, key: rowKey(header, row, settings.Columns), row: row})
+			}
+		case "chunks":
+			chunks, err := splitSource(src.text, chunk)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to chunk %s: %w", src.name, err)
+			}
+			for i, text := range chunks {
+				text = strings.TrimSpace(text)
+				items = append(items, dedupeItem{source: fmt.Sprintf("%s#%d", src.name, i+1), text: text, key: text})
+			}
+		default:
+			if text := strings.TrimSpace(src.text); text != "" {
+				items = append(items, dedupeItem{source: src.name, text: text, key: text})
+			}
+		}
+	}
+	return items, header, nil
+}
+
+// rowKey returns the text of a row's columns that a dedupe step compares,
+// or of all its columns when none are named
+func rowKey(header, row, columns []string) string {
+	if len(columns) == 0 {
+		return rowFields(header, row)
+	}
+	lines := make([]string, len(columns))
+	for i, column := range columns {
+		if c := slices.Index(header, column); c < len(row) {
+			lines[i] = column + ": " + row[c]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cosineSimilarity returns the cosine similarity of two embeddings
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// clusterDuplicates groups items whose embeddings are at least threshold
+// similar, in input order: each item joins the most similar cluster whose
+// first item it is close enough to, or starts a new one. Items with the
+// same text, ignoring case and spacing, share a cluster without being
+// embedded. It returns the cluster of each item and the number of
+// clusters.
+func clusterDuplicates(items []dedupeItem, embedItems func([]string) ([][]float32, error), threshold float64) ([]int, int, error) {
+	clusters := make([]int, len(items))
+	exact := make(map[string]int)
+	var unique []int
+	for i, item := range items {
+		norm := strings.Join(strings.Fields(strings.ToLower(item.key)), " ")
+		if first, ok := exact[norm]; ok {
+			clusters[i] = -1 - first // Resolved once the first is clustered
+			continue
+		}
+		exact[norm] = i
+		unique = append(unique, i)
+	}
+
+	texts := make([]string, len(unique))
+	for n, i := range unique {
+		texts[n] = items[i].key
+	}
+	vectors, err := embedItems(texts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(vectors) != len(unique) {
+		return nil, 0, fmt.Errorf("got %d embeddings for %d items", len(vectors), len(unique))
+	}
+
+	var leaders [][]float32
+	for n, i := range unique {
+		best, bestScore := -1, threshold
+		for c, leader := range leaders {
+			if score := cosineSimilarity(vectors[n], leader); score >= bestScore {
+				best, bestScore = c, score
+			}
+		}
+		if best < 0 {
+			best = len(leaders)
+			leaders = append(leaders, vectors[n])
+		}
+		clusters[i] = best
+	}
+	for i, c := range clusters {
+		if c < 0 {
+			clusters[i] = clusters[-1-c]
+		}
+	}
+	return clusters, len(leaders), nil
+}
+
+// processDedupeStep embeds the step's items and outputs one of each group
+// of near-duplicates, in input order. Documents and chunks are labelled
+// with their source, and rows are output as CSV under their header.
+func (p *Processor) processDedupeStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	modelName := p.NormalizeStringSlice(step.Config.Model)[0]
+	settings := DedupeStep{}
+	if step.Config.Dedupe != nil {
+		settings = *step.Config.Dedupe
+	}
+	if settings.By == "" {
+		settings.By = "documents"
+	}
+	threshold := settings.Threshold
+	if threshold == 0 {
+		threshold = DefaultDedupeThreshold
+	}
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: "Drop duplicate " + settings.By}
+	emit := func(msg string) {
+		if isParallel {
+			p.emitParallelProgress(msg, stepInfo, parallelID)
+		} else {
+			p.emitProgress(msg, stepInfo)
+		}
+	}
+	emit(fmt.Sprintf("Finding duplicate %s for step: %s", settings.By, step.Name))
+
+	sources, err := p.vectorSources(step)
+	if err != nil {
+		return "", err
+	}
+	items, header, err := p.dedupeItems(sources, settings, step.Config.Chunk)
+	if err != nil {
+		return "", fmt.Errorf("error reading items in step %s: %w", step.Name, err)
+	}
+	if len(items) == 0 {
+		return "", fmt.Errorf("dedupe step '%s' has no items to compare", step.Name)
+	}
+
+	embedder, err := p.stepEmbedder(step, modelName)
+	if err != nil {
+		return "", err
+	}
+	clusters, count, err := clusterDuplicates(items, func(texts []string) ([][]float32, error) {
+		return embed(embedder, modelName, texts)
+	}, threshold)
+	if err != nil {
+		return "", err
+	}
+
+	// Each cluster keeps its first item, or its longest
+	kept := make([]int, count)
+	for c := range kept {
+		kept[c] = -1
+	}
+	for i, c := range clusters {
+		if kept[c] < 0 || settings.Keep == "longest" && len(items[i].key) > len(items[kept[c]].key) {
+			kept[c] = i
+		}
+	}
+	sort.Ints(kept)
+
+	var response string
+	switch settings.By {
+	case "rows":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(header)
+		for _, i := range kept {
+			w.Write(items[i].row)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return "", fmt.Errorf("error writing CSV output of step %s: %w", step.Name, err)
+		}
+		response = buf.String()
+	case "lines", "paragraphs":
+		parts := make([]string, len(kept))
+		for n, i := range kept {
+			parts[n] = items[i].text
+		}
+		sep := "\n"
+		if settings.By == "paragraphs" {
+			sep = "\n\n"
+		}
+		response = strings.Join(parts, sep)
+	default:
+		parts := make([]string, len(kept))
+		for n, i := range kept {
+			parts[n] = fmt.Sprintf("[%d] %s\n%s", n+1, items[i].source, items[i].text)
+		}
+		response = strings.Join(parts, "\n\n")
+	}
+	emit(fmt.Sprintf("Kept %d of %d %s for step: %s", len(kept), len(items), settings.By, step.Name))
+
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if err := p.handleOutput(modelName, response, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+	p.debugf("Step '%s' kept %d of %d items", step.Name, len(kept), len(items))
+	return response, nil
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+func runDedupe(t *testing.T, input string, settings *DedupeStep) (string, *letterEmbedder) {
+	t.Helper()
+	cfg := &DSLConfig{Steps: []Step{{Name: "dedupe", Config: StepConfig{
+		Type: StepTypeDedupe, Input: input, Model: "text-embedding-3-small", Output: "STDOUT", Dedupe: settings,
+	}}}}
+	embedder := &letterEmbedder{MockProvider: MockProvider{name: "openai"}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProviderResolver(func(modelName string) models.Provider { return embedder })
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	return proc.LastOutput(), embedder
+}
+
+func TestDedupeDocuments(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.md": "Zebras zigzag at the zoo.",
+		"b.md": "zebras zigzag at the zoo!!",
+		"c.md": "Banana bread baking tips",
+		"d.md": "ZEBRAS   zigzag at the zoo, and at the zoo.",
+	}
+	for name, text := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(text), 0644)
+	}
+
+	out, _ := runDedupe(t, filepath.Join(dir, "*.md"), nil)
+	want := "[1] " + filepath.Join(dir, "a.md") + "\nZebras zigzag at the zoo.\n\n[2] " + filepath.Join(dir, "c.md") + "\nBanana bread baking tips"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+
+	out, _ = runDedupe(t, filepath.Join(dir, "*.md"), &DedupeStep{Keep: "longest", Threshold: 0.8})
+	if !strings.Contains(out, "d.md\nZEBRAS") || strings.Contains(out, "a.md") || !strings.Contains(out, "[2] ") {
+		t.Errorf("output = %q, want the longest zebra document before the banana one", out)
+	}
+}
+
+func TestDedupeRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leads.csv")
+	os.WriteFile(path, []byte("id,company,notes\n1,Acme,wants a demo\n2,Globex,just browsing\n3,acme,Wants a demo\n4,Acme,wants a demo soon\n"), 0644)
+
+	out, embedder := runDedupe(t, path, &DedupeStep{By: "rows", Columns: []string{"company", "notes"}, Threshold: 0.99})
+	if want := "id,company,notes\n1,Acme,wants a demo\n2,Globex,just browsing\n4,Acme,wants a demo soon\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+	if embedder.calls != 1 {
+		t.Errorf("embedded %d times, want one request", embedder.calls)
+	}
+}
+
+func TestClusterDuplicates(t *testing.T) {
+	items := []dedupeItem{{key: "a"}, {key: "b"}, {key: " A "}, {key: "c"}}
+	vectors := map[string][]float32{"a": {1, 0}, "b": {0, 1}, "c": {0.9, 0.1}}
+	var embedded []string
+	clusters, count, err := clusterDuplicates(items, func(texts []string) ([][]float32, error) {
+		embedded = texts
+		out := make([][]float32, len(texts))
+		for i, text := range texts {
+			out[i] = vectors[text]
+		}
+		return out, nil
+	}, 0.95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || clusters[0] != 0 || clusters[1] != 1 || clusters[2] != 0 || clusters[3] != 0 {
+		t.Errorf("clusterDuplicates() = %v, %d", clusters, count)
+	}
+	if len(embedded) != 3 {
+		t.Errorf("embedded %q, want the exact duplicate left out", embedded)
+	}
+}
+
+func TestDedupeStepValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.stepConfigErrors("dedupe", StepConfig{
+		Type: StepTypeDedupe, Input: "NA", Model: "NA", Output: "STDOUT",
+		Dedupe: &DedupeStep{By: "chunks", Columns: []string{"title"}, Threshold: 1.5, Keep: "last"},
+	})
+	want := []string{"need items as input", "one embedding model", "needs a chunk configuration", "needs dedupe.by rows", "between 0 and 1", "unknown dedupe.keep 'last'"}
+	if len(errs) != len(want) {
+		t.Fatalf("stepConfigErrors() = %v, want %d errors", errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i], w) {
+			t.Errorf("error %d = %q, want it to mention %q", i, errs[i], w)
+		}
+	}
+}
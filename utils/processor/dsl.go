@@ -1,7 +1,9 @@
 package processor
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -9,10 +11,18 @@ import (
 	"sync"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/broker"
 	"github.com/kris-hansen/comanda/utils/chunker"
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/mcp"
 	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/retry"
+	"github.com/kris-hansen/comanda/utils/sandbox"
+	"github.com/kris-hansen/comanda/utils/seen"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
 )
 
@@ -33,18 +43,52 @@ type ProcessStepConfig struct {
 
 // Processor handles the DSL processing pipeline
 type Processor struct {
-	config       *DSLConfig
-	envConfig    *config.EnvConfig
-	serverConfig *config.ServerConfig // Add server config
-	handler      *input.Handler
-	validator    *input.Validator
-	providers    map[string]models.Provider
-	verbose      bool
-	lastOutput   string
-	spinner      *Spinner
-	variables    map[string]string // Store variables from STDIN
-	progress     ProgressWriter    // Progress writer for streaming updates
-	runtimeDir   string            // Runtime directory for file operations
+	config          *DSLConfig
+	envConfig       *config.EnvConfig
+	serverConfig    *config.ServerConfig // Add server config
+	handler         *input.Handler
+	validator       *input.Validator
+	providers       map[string]models.Provider
+	verbose         bool
+	lastOutput      string
+	lastOutputFile  string // Holds STDIN too large for lastOutput
+	spinner         *Spinner
+	variables       map[string]string // Store variables from STDIN
+	progress        ProgressWriter    // Progress writer for streaming updates
+	runtimeDir      string            // Runtime directory for file operations
+	sandbox         *sandbox.Sandbox  // Filesystem sandbox for server mode, built lazily
+	sandboxOnce     sync.Once
+	sandboxErr      error
+	trustedPaths    sync.Map                     // Internally created temp files that bypass the sandbox
+	workflowEnv     map[string]string            // Variables from the workflow's env and env_file sections
+	changeTracker   *changeTracker               // Input hashes from the last run, set in changed-only mode
+	pinnedProviders map[string]string            // Model name -> provider pinned by a step's provider field
+	parallelResults map[string]map[string]string // Parallel group -> step name -> output, for join steps
+	mcpClients      map[string]*mcp.Client       // MCP servers started for agent steps, by name
+	mcpMu           sync.Mutex
+	recorder        StepRecorder     // Receives finished steps for run history
+	resolver        ProviderResolver // Replaces provider detection and configuration, set by comanda test
+	debugger        StepDebugger     // Reviews prompts before they are sent, set by process --debugger
+	ctx             context.Context  // Stops the run when cancelled, set by SetContext
+	drain           context.Context  // Stops the run between steps when done, set by SetDrain
+	checkpoint      *checkpointer    // Saves progress for --resume, set by EnableCheckpoint
+	completed       []string         // Parallel groups and sequential steps finished in this run
+	stepContexts    sync.Map         // Step name -> context of the step's span, while it runs
+	usage           runUsage         // Estimated tokens and cost of the finished steps, checked against the budget
+	credentials     string           // Credential set replacing the workflow's, set by SetCredentials
+	summary         runSummary       // Per-step timings, tokens and cost, for the summary printed after a run
+	promptsMu       sync.Mutex
+	prompts         map[string][]PromptRecord // Step name -> prompts it sent, until its record is made
+	responseCache   *responseCache            // Answers repeated prompts, set by SetResponseCache
+	maxDuration     time.Duration             // Replaces the workflow's max_duration, set by SetMaxDuration
+	batchesMu       sync.Mutex
+	batches         []*broker.Batch // Messages consumed by kafka and nats inputs, settled when the run ends
+	seenMu          sync.Mutex
+	seenStores      map[string]*seen.Store // Items read by feed inputs by store path, recorded when the run succeeds
+	variantKey      string                 // Picks prompt variants by hash instead of at random, set by SetVariantKey
+	forcedVariants  map[string]string      // Step name -> prompt variant to use, set by SetVariant
+	variants        map[string]string      // Step name -> prompt variant this run uses
+	approver        Approver               // Decides approval steps, set by SetApprover
 }
 
 // UnmarshalYAML is a custom unmarshaler for DSLConfig to handle mixed types at the root level
@@ -84,6 +128,44 @@ func (c *DSLConfig) UnmarshalYAML(node *yaml.Node) error {
 
 			// Assign deferred steps to the config
 			c.Defer = deferredSteps
+		case "env":
+			if err := valueNode.Decode(&c.Env); err != nil {
+				return fmt.Errorf("failed to decode env section: %w", err)
+			}
+		case "env_file":
+			if err := valueNode.Decode(&c.EnvFile); err != nil {
+				return fmt.Errorf("failed to decode env_file: %w", err)
+			}
+		case "params":
+			if err := valueNode.Decode(&c.Params); err != nil {
+				return fmt.Errorf("failed to decode params section: %w", err)
+			}
+		case "webhooks":
+			if err := valueNode.Decode(&c.Webhooks); err != nil {
+				return fmt.Errorf("failed to decode webhooks section: %w", err)
+			}
+		case "concurrency":
+			if err := valueNode.Decode(&c.Concurrency); err != nil {
+				return fmt.Errorf("failed to decode concurrency section: %w", err)
+			}
+		case "credentials":
+			if err := valueNode.Decode(&c.Credentials); err != nil {
+				return fmt.Errorf("failed to decode credentials: %w", err)
+			}
+		case "max_duration":
+			if err := valueNode.Decode(&c.MaxDuration); err != nil {
+				return fmt.Errorf("failed to decode max_duration: %w", err)
+			}
+			if _, err := parseMaxDuration(c.MaxDuration); err != nil {
+				return err
+			}
+		case "runs_on":
+			// A single label or a list of them
+			if valueNode.Kind == yaml.ScalarNode {
+				c.RunsOn = []string{valueNode.Value}
+			} else if err := valueNode.Decode(&c.RunsOn); err != nil {
+				return fmt.Errorf("failed to decode runs_on: %w", err)
+			}
 		default:
 			// Try to decode as a standard step config first
 			var stepConfig StepConfig
@@ -208,9 +290,16 @@ func (p *Processor) SetProgressWriter(w ProgressWriter) {
 	p.spinner.SetProgressWriter(w)
 }
 
+// DisableSpinner stops the spinner from writing to the terminal, for
+// frontends that draw their own progress display
+func (p *Processor) DisableSpinner() {
+	p.spinner.Disable()
+}
+
 // SetLastOutput sets the last output value, useful for initializing with STDIN data
 func (p *Processor) SetLastOutput(output string) {
 	p.lastOutput = output
+	p.lastOutputFile = ""
 }
 
 // LastOutput returns the last output value
@@ -221,12 +310,15 @@ func (p *Processor) LastOutput() string {
 // debugf prints debug information if verbose mode is enabled
 func (p *Processor) debugf(format string, args ...interface{}) {
 	if p.verbose {
-		fmt.Printf("[DEBUG][DSL] "+format+"\n", args...)
+		config.ConsoleLog("[DEBUG][DSL] "+format, args...)
 	}
+	config.WriteLog("[DEBUG][DSL] ", format, args...)
 }
 
-// emitProgress sends a progress update if a progress writer is configured
+// emitProgress writes a step message to the log file and sends a progress
+// update if a progress writer is configured
 func (p *Processor) emitProgress(msg string, step *StepInfo) {
+	config.WriteLog("[RUN] ", "%s", msg)
 	if p.progress != nil {
 		p.progress.WriteProgress(ProgressUpdate{
 			Type:    ProgressStep,
@@ -238,6 +330,7 @@ func (p *Processor) emitProgress(msg string, step *StepInfo) {
 
 // emitProgressWithMetrics sends a progress update with performance metrics
 func (p *Processor) emitProgressWithMetrics(msg string, step *StepInfo, metrics *PerformanceMetrics) {
+	config.WriteLog("[RUN] ", "%s", msg)
 	if p.progress != nil {
 		p.progress.WriteProgress(ProgressUpdate{
 			Type:               ProgressStep,
@@ -250,6 +343,7 @@ func (p *Processor) emitProgressWithMetrics(msg string, step *StepInfo, metrics
 
 // emitParallelProgress sends a progress update for a parallel step
 func (p *Processor) emitParallelProgress(msg string, step *StepInfo, parallelID string) {
+	config.WriteLog("[RUN] ", "%s", msg)
 	if p.progress != nil {
 		p.progress.WriteProgress(ProgressUpdate{
 			Type:       ProgressParallelStep,
@@ -263,6 +357,7 @@ func (p *Processor) emitParallelProgress(msg string, step *StepInfo, parallelID
 
 // emitParallelProgressWithMetrics sends a progress update for a parallel step with performance metrics
 func (p *Processor) emitParallelProgressWithMetrics(msg string, step *StepInfo, parallelID string, metrics *PerformanceMetrics) {
+	config.WriteLog("[RUN] ", "%s", msg)
 	if p.progress != nil {
 		p.progress.WriteProgress(ProgressUpdate{
 			Type:               ProgressParallelStep,
@@ -275,8 +370,10 @@ func (p *Processor) emitParallelProgressWithMetrics(msg string, step *StepInfo,
 	}
 }
 
-// emitError sends an error update if a progress writer is configured
+// emitError writes an error to the log file and sends an error update if a
+// progress writer is configured
 func (p *Processor) emitError(err error) {
+	config.WriteLog("[ERROR] ", "%v", err)
 	if p.progress != nil {
 		p.progress.WriteProgress(ProgressUpdate{
 			Type:  ProgressError,
@@ -299,17 +396,26 @@ func (p *Processor) substituteVariables(text string) string {
 	for name, value := range p.variables {
 		text = strings.ReplaceAll(text, "$"+name, value)
 	}
-	return text
+	return p.interpolateEnv(text)
 }
 
 // validateStepConfig checks if all required fields are present in a step
 func (p *Processor) validateStepConfig(stepName string, config StepConfig) error {
+	if errors := p.stepConfigErrors(stepName, config); len(errors) > 0 {
+		return fmt.Errorf("validation errors in step '%s':\n- %s", stepName, strings.Join(errors, "\n- "))
+	}
+	return nil
+}
+
+// stepConfigErrors lists every problem with a step's configuration
+func (p *Processor) stepConfigErrors(stepName string, config StepConfig) []string {
 	var errors []string
 
 	isGenerateStep := config.Generate != nil
 	isProcessStep := config.Process != nil
-	isStandardStep := !isGenerateStep && !isProcessStep && config.Type != "openai-responses" // Standard steps are not generate, process, or openai-responses
+	isStandardStep := !isGenerateStep && !isProcessStep && config.Type != "openai-responses" && config.Type != "validate-data" && !isVectorStep(config) && !isTranscribeStep(config) && !isRenderStep(config) && !isTranslateStep(config) && !isDedupeStep(config) && !isSummarizeStep(config) && !isApprovalStep(config) // Standard steps are not generate, process, openai-responses, validate-data, index, retrieve, transcribe, render, translate, dedupe, summarize or approval
 	isOpenAIResponsesStep := config.Type == "openai-responses"
+	isValidateDataStep := config.Type == "validate-data"
 
 	// Ensure a step is of one type only
 	typeCount := 0
@@ -351,13 +457,34 @@ func (p *Processor) validateStepConfig(stepName string, config StepConfig) error
 			errors = append(errors, "model is required for standard steps (can be NA or a valid model name)")
 		}
 		actions := p.NormalizeStringSlice(config.Action)
-		if len(actions) == 0 {
+		if len(actions) == 0 && len(config.Variants) == 0 {
 			errors = append(errors, "action is required for standard steps")
 		}
 		outputs := p.NormalizeStringSlice(config.Output)
-		if len(outputs) == 0 {
+		outputMap, _ := config.Output.(map[string]interface{})
+		brokerKind, _ := brokerMap(outputMap)
+		trackerKind, _ := trackerMap(outputMap)
+		_, hasSpreadsheet := outputMap["spreadsheet"]
+		_, hasWebhook := outputMap["webhook"]
+		if len(outputs) == 0 && brokerKind == "" && trackerKind == "" && !hasSpreadsheet && !hasWebhook {
 			errors = append(errors, "output is required for standard steps (can be STDOUT for console output)")
 		}
+		if config.Ensemble != nil {
+			errors = append(errors, validateEnsembleConfig(config.Ensemble, modelNames)...)
+		}
+		if config.Join != nil {
+			errors = append(errors, p.validateJoinConfig(stepName, config.Join)...)
+		}
+		if config.Rows != nil {
+			errors = append(errors, validateRowsConfig(config.Rows, modelNames)...)
+			if config.Chunk != nil || config.Ensemble != nil {
+				errors = append(errors, "rows can't be used with chunk or ensemble")
+			}
+		}
+		if config.Type == "agent" {
+			errors = append(errors, p.validateAgentConfig(config.Agent, modelNames)...)
+		}
+		errors = append(errors, p.variantErrors(config)...)
 	} else if isOpenAIResponsesStep {
 		// Validation specific to openai-responses type
 		// For example, 'instructions' might be required instead of 'action'
@@ -365,6 +492,25 @@ func (p *Processor) validateStepConfig(stepName string, config StepConfig) error
 			// errors = append(errors, "'instructions' is required for 'openai-responses' type steps")
 		}
 		// Other openai-responses specific validations...
+	} else if isValidateDataStep {
+		if config.Input == nil {
+			errors = append(errors, "input tag is required for validate-data steps")
+		}
+		errors = append(errors, validateDataSchema(config.Schema)...)
+	} else if isVectorStep(config) {
+		errors = append(errors, p.vectorStepErrors(config)...)
+	} else if isTranscribeStep(config) {
+		errors = append(errors, p.transcribeStepErrors(config)...)
+	} else if isRenderStep(config) {
+		errors = append(errors, p.renderStepErrors(config)...)
+	} else if isTranslateStep(config) {
+		errors = append(errors, p.translateStepErrors(config)...)
+	} else if isDedupeStep(config) {
+		errors = append(errors, p.dedupeStepErrors(config)...)
+	} else if isSummarizeStep(config) {
+		errors = append(errors, p.summarizeStepErrors(config)...)
+	} else if isApprovalStep(config) {
+		errors = append(errors, p.approvalStepErrors(config)...)
 	} else if isGenerateStep {
 		if config.Generate.Action == nil {
 			errors = append(errors, "'action' is required within the 'generate' configuration")
@@ -378,11 +524,30 @@ func (p *Processor) validateStepConfig(stepName string, config StepConfig) error
 		}
 	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("validation errors in step '%s':\n- %s", stepName, strings.Join(errors, "\n- "))
+	if config.Provider != "" && models.ProviderByName(config.Provider) == nil {
+		errors = append(errors, fmt.Sprintf("unknown provider '%s'", config.Provider))
+	}
+	if len(config.Variants) > 0 && !isStandardStep {
+		errors = append(errors, "variants are only supported on standard steps")
+	}
+	if config.MaxInputSize != "" {
+		if _, err := fileutil.ParseSize(config.MaxInputSize); err != nil {
+			errors = append(errors, fmt.Sprintf("max_input_size: %v", err))
+		}
+	}
+	if config.Chunk != nil {
+		if config.Chunk.Parallel < 0 {
+			errors = append(errors, "chunk.parallel cannot be negative")
+		}
+		if config.Chunk.MaxAttempts < 0 {
+			errors = append(errors, "chunk.max_attempts cannot be negative")
+		}
+	}
+	if config.Postprocess != nil {
+		errors = append(errors, validatePostprocess(p.NormalizeStringSlice(config.Postprocess))...)
 	}
 
-	return nil
+	return errors
 }
 
 // validateDependencies checks for dependencies between steps and ensures parallel steps don't depend on each other
@@ -499,8 +664,35 @@ func (p *Processor) checkCircularDependencies(
 	return nil
 }
 
-// Process executes the DSL processing pipeline
+// Process executes the DSL processing pipeline. When the run's context is
+// cancelled, steps in flight are abandoned, no more steps start, and the
+// returned error wraps ErrInterrupted. A run past its MaxDuration stops the
+// same way with an error wrapping ErrMaxDuration.
 func (p *Processor) Process() error {
+	ctx, cancel := WithMaxDuration(p.context(), p.MaxDuration())
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "workflow",
+		trace.WithAttributes(attribute.Int("comanda.workflow.steps", len(p.config.Steps))))
+	p.ctx = ctx // Steps' spans are children of the run's
+	err := p.process()
+	p.settleBatches(err)
+	p.saveSeen(err)
+	if err != nil && !errors.Is(err, ErrInterrupted) && !errors.Is(err, ErrMaxDuration) && p.context().Err() != nil {
+		if deadline := pastDeadline(p.context()); deadline != nil {
+			err = fmt.Errorf("%w: %v", deadline, err)
+		} else {
+			err = fmt.Errorf("%w: %v", ErrInterrupted, err)
+		}
+	}
+	if cpErr := p.saveCheckpoint(err); cpErr != nil {
+		config.WarnLog("%v", cpErr)
+	}
+	endSpan(span, err)
+	return err
+}
+
+// process validates and runs the workflow's steps
+func (p *Processor) process() error {
 	// Check if we have any steps to process
 	if len(p.config.Steps) == 0 && len(p.config.ParallelSteps) == 0 {
 		err := fmt.Errorf("no steps defined in DSL configuration")
@@ -512,6 +704,24 @@ func (p *Processor) Process() error {
 	p.debugf("Initial validation passed: found %d sequential steps and %d parallel step groups",
 		len(p.config.Steps), len(p.config.ParallelSteps))
 
+	// Switch to the run's own provider keys before checking for them
+	if err := p.useCredentials(); err != nil {
+		p.emitError(err)
+		return fmt.Errorf("credentials error: %w", err)
+	}
+
+	// Steps with prompt variants get the action and model of one of them
+	if err := p.applyVariants(); err != nil {
+		p.emitError(err)
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Steps that name no model get the policy's default for their type
+	p.applyDefaultModels()
+
+	// Model aliases from the env config stand for the models they name
+	p.applyModelAliases()
+
 	// First validate all steps before processing
 	p.spinner.Start("Validating DSL configuration")
 
@@ -529,8 +739,14 @@ func (p *Processor) Process() error {
 			return fmt.Errorf("validation error: %w", err)
 		}
 
+		if err := p.pinProviders(step); err != nil {
+			p.spinner.Stop()
+			p.emitError(err)
+			return fmt.Errorf("validation error: %w", err)
+		}
+
 		// Validate model names only for standard or relevant steps
-		if step.Config.Generate == nil && step.Config.Process == nil && step.Config.Type != "openai-responses" {
+		if step.Config.Generate == nil && step.Config.Process == nil && step.Config.Type != "openai-responses" && step.Config.Type != "validate-data" && !isVectorStep(step.Config) && !isTranscribeStep(step.Config) && !isRenderStep(step.Config) && !isDedupeStep(step.Config) && !isApprovalStep(step.Config) {
 			modelNames := p.NormalizeStringSlice(step.Config.Model)
 			p.debugf("Normalized model names for step %s: %v", step.Name, modelNames)
 			if err := p.validateModel(modelNames, []string{"STDIN"}); err != nil { // STDIN is a placeholder here
@@ -558,8 +774,14 @@ func (p *Processor) Process() error {
 				return fmt.Errorf("validation error: %w", err)
 			}
 
+			if err := p.pinProviders(step); err != nil {
+				p.spinner.Stop()
+				p.emitError(err)
+				return fmt.Errorf("validation error: %w", err)
+			}
+
 			// Validate model names only for standard or relevant steps
-			if step.Config.Generate == nil && step.Config.Process == nil && step.Config.Type != "openai-responses" {
+			if step.Config.Generate == nil && step.Config.Process == nil && step.Config.Type != "openai-responses" && step.Config.Type != "validate-data" && !isVectorStep(step.Config) && !isTranscribeStep(step.Config) && !isRenderStep(step.Config) && !isDedupeStep(step.Config) && !isApprovalStep(step.Config) {
 				modelNames := p.NormalizeStringSlice(step.Config.Model)
 				p.debugf("Normalized model names for parallel step %s: %v", step.Name, modelNames)
 				if err := p.validateModel(modelNames, []string{"STDIN"}); err != nil { // STDIN is a placeholder
@@ -571,6 +793,13 @@ func (p *Processor) Process() error {
 		}
 	}
 
+	// Refuse models and settings the env config's policy doesn't allow
+	if err := p.checkPolicy(); err != nil {
+		p.spinner.Stop()
+		p.emitError(err)
+		return fmt.Errorf("validation error: %w", err)
+	}
+
 	// Validate dependencies between steps
 	p.debugf("Validating dependencies between steps")
 	if err := p.validateDependencies(); err != nil {
@@ -584,6 +813,23 @@ func (p *Processor) Process() error {
 	p.spinner.Stop()
 	p.debugf("All steps validated successfully")
 
+	// Load workflow-level environment before any step runs
+	if err := p.loadWorkflowEnv(); err != nil {
+		p.emitError(err)
+		return fmt.Errorf("environment loading error: %w", err)
+	}
+
+	// Shut down any MCP servers started by agent steps
+	defer p.closeMCPClients()
+
+	// Persist input hashes for changed-only mode, including after a failed
+	// step so inputs that completed are not reprocessed next time
+	defer func() {
+		if err := p.saveInputState(); err != nil {
+			config.WarnLog("%v", err)
+		}
+	}()
+
 	// Process steps with detailed logging and error handling
 	defer func() {
 		if r := recover(); r != nil {
@@ -592,11 +838,19 @@ func (p *Processor) Process() error {
 		}
 	}()
 
-	// Store results from parallel steps for use in sequential steps
-	parallelResults := make(map[string]string)
+	// Store results from parallel steps for use in sequential join steps
+	p.parallelResults = make(map[string]map[string]string)
 
 	// Process parallel steps first if any
 	for groupName, steps := range p.config.ParallelSteps {
+		if p.resumeGroup(groupName) {
+			p.debugf("Skipping parallel group '%s', finished before the checkpoint", groupName)
+			continue
+		}
+		if err := p.stopping(); err != nil {
+			p.emitError(err)
+			return err
+		}
 		p.spinner.Start(fmt.Sprintf("Processing parallel step group: %s", groupName))
 		p.debugf("Starting parallel processing for group '%s' with %d steps", groupName, len(steps))
 
@@ -623,6 +877,10 @@ func (p *Processor) Process() error {
 				defer wg.Done()
 
 				p.debugf("Starting goroutine for parallel step: %s", stepCopy.Name)
+				if err := p.stopping(); err != nil {
+					errorChan <- err
+					return
+				}
 
 				// Process the step
 				response, err := p.processStep(stepCopy, true, groupName)
@@ -657,30 +915,29 @@ func (p *Processor) Process() error {
 		}
 
 		// Collect results
+		p.parallelResults[groupName] = make(map[string]string)
 		for result := range resultChan {
 			p.debugf("Collected result from parallel step: %s", result.name)
-			parallelResults[result.name] = result.output
+			p.parallelResults[groupName][result.name] = result.output
 		}
 
 		p.spinner.Stop()
+		p.finishGroup(groupName)
 		p.debugf("Completed all parallel steps in group: %s", groupName)
 	}
 
-	// Process sequential steps
+	// Process sequential steps, skipping those a resumed run finished
+	resumed := p.resumeSteps()
 	for stepIndex, step := range p.config.Steps {
-		stepInfo := &StepInfo{
-			Name:   step.Name,
-			Model:  fmt.Sprintf("%v", step.Config.Model),
-			Action: fmt.Sprintf("%v", step.Config.Action),
+		if stepIndex < resumed {
+			p.debugf("Skipping step '%s', finished before the checkpoint", step.Name)
+			continue
 		}
-		if step.Config.Generate != nil {
-			stepInfo.Model = fmt.Sprintf("%v", step.Config.Generate.Model)
-			stepInfo.Action = fmt.Sprintf("%v", step.Config.Generate.Action)
-		} else if step.Config.Process != nil {
-			stepInfo.Action = fmt.Sprintf("Process workflow: %s", step.Config.Process.WorkflowFile)
-			stepInfo.Model = "N/A"
+		if err := p.stopping(); err != nil {
+			p.emitError(err)
+			return err
 		}
-
+		stepInfo := newStepInfo(step)
 		stepMsg := fmt.Sprintf("Processing step %d/%d: %s", stepIndex+1, len(p.config.Steps), step.Name)
 		p.emitProgress(stepMsg, stepInfo)
 		p.spinner.Start(stepMsg)
@@ -695,8 +952,15 @@ func (p *Processor) Process() error {
 			return fmt.Errorf("step processing error: %w", err)
 		}
 
+		// A step that ran while the run was interrupted may be incomplete
+		if err := p.interrupted(); err != nil {
+			p.spinner.Stop()
+			p.emitError(err)
+			return err
+		}
+
 		// Store the response for potential use as STDIN in next step
-		p.lastOutput = response
+		p.SetLastOutput(response)
 
 		p.spinner.Stop()
 		p.debugf("Successfully processed step: %s", step.Name)
@@ -705,6 +969,7 @@ func (p *Processor) Process() error {
 		if err := p.handleDeferredStep(); err != nil {
 			return err
 		}
+		p.finishStep(step.Name)
 
 		// Clear the handler's contents for the next step
 		p.handler = input.NewHandler()
@@ -719,12 +984,95 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	// Create performance metrics for this step
 	metrics := &PerformanceMetrics{}
 	startTime := time.Now()
+	retries := retry.Count()
+	hits := p.cacheHits()
+
+	stepInfo := newStepInfo(step)
+	p.emit(ProgressUpdate{
+		Type:       ProgressStepStarted,
+		Message:    fmt.Sprintf("Started step: %s", step.Name),
+		Step:       stepInfo,
+		IsParallel: isParallel,
+		ParallelID: parallelID,
+	})
+
+	span := p.startStepSpan(step)
+	response, err := p.runStep(step, isParallel, parallelID, metrics, startTime)
+	metrics.Retries = int(retry.Count() - retries)
+	metrics.CacheHits += int(p.cacheHits() - hits)
+	if metrics.TotalProcessingTime == 0 {
+		metrics.TotalProcessingTime = time.Since(startTime).Milliseconds()
+	}
+	p.endStepSpan(span, step, metrics, err)
+	p.recordStep(step, response, err, metrics, startTime)
+
+	p.emit(ProgressUpdate{
+		Type:               ProgressStepFinished,
+		Message:            fmt.Sprintf("Finished step: %s", step.Name),
+		Error:              err,
+		Step:               stepInfo,
+		IsParallel:         isParallel,
+		ParallelID:         parallelID,
+		PerformanceMetrics: metrics,
+	})
+	return response, err
+}
 
+// runStep dispatches a step to the handler for its type
+func (p *Processor) runStep(step Step, isParallel bool, parallelID string, metrics *PerformanceMetrics, startTime time.Time) (_ string, runErr error) {
 	// Check if this is an openai-responses step
 	if step.Config.Type == "openai-responses" {
 		return p.processResponsesStep(step, isParallel, parallelID)
 	}
 
+	// Check if this is an agent step
+	if step.Config.Type == "agent" {
+		return p.processAgentStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is a data validation step
+	if step.Config.Type == "validate-data" {
+		return p.processValidateDataStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is a vector store step
+	if step.Config.Type == StepTypeIndex {
+		return p.processIndexStep(step, isParallel, parallelID)
+	}
+	if step.Config.Type == StepTypeRetrieve {
+		return p.processRetrieveStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is a transcription step
+	if isTranscribeStep(step.Config) {
+		return p.processTranscribeStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is a document rendering step
+	if isRenderStep(step.Config) {
+		return p.processRenderStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is a translation step
+	if isTranslateStep(step.Config) {
+		return p.processTranslateStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is a deduplication step
+	if isDedupeStep(step.Config) {
+		return p.processDedupeStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is a summarization step
+	if isSummarizeStep(step.Config) {
+		return p.processSummarizeStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is an approval step
+	if isApprovalStep(step.Config) {
+		return p.processApprovalStep(step, isParallel, parallelID)
+	}
+
 	// Handle generate step
 	if step.Config.Generate != nil {
 		return p.processGenerateStep(step, isParallel, parallelID, metrics, startTime)
@@ -736,7 +1084,7 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	}
 
 	// Create a new handler for this step to avoid conflicts in parallel processing
-	stepHandler := input.NewHandler()
+	stepHandler := newStepHandler(step.Config)
 	p.handler = stepHandler
 
 	stepInfo := &StepInfo{
@@ -787,9 +1135,80 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 				return "", fmt.Errorf("failed to write database output to temp file: %w", err)
 			}
 			tmpFile.Close()
+			p.trustPath(tmpPath)
 
 			// Set the input to the temp file path
 			inputs = []string{tmpPath}
+		} else if kind, refs := connectorInput(v); kind != "" {
+			// Fetch documents from Google Drive, Notion or Confluence
+			paths, cleanup, err := p.fetchConnectorInputs(step.Name, kind, refs)
+			if err != nil {
+				return "", fmt.Errorf("%s input error in step %s: %w", kind, step.Name, err)
+			}
+			defer cleanup()
+			inputs = paths
+		} else if spec, ok := v["email"].(map[string]interface{}); ok {
+			// Read messages and their attachments from an IMAP folder
+			paths, cleanup, markSeen, err := p.fetchEmailInputs(step.Name, spec)
+			if err != nil {
+				return "", fmt.Errorf("email input error in step %s: %w", step.Name, err)
+			}
+			defer cleanup()
+			if markSeen != nil {
+				// Messages stay unread when the step fails, so a later run reads them again
+				defer func() {
+					if runErr != nil {
+						return
+					}
+					if err := markSeen(); err != nil {
+						config.WriteLog("[RUN] ", "Messages read by step %s not marked as read: %v", step.Name, err)
+						p.debugf("Error marking messages as read: %v", err)
+					}
+				}()
+			}
+			inputs = paths
+		} else if kind, spec := brokerMap(v); kind != "" {
+			// Consume a batch of messages, acked once the run succeeds
+			path, cleanup, err := p.consumeBrokerInput(step.Name, kind, spec)
+			if err != nil {
+				return "", fmt.Errorf("%s input error in step %s: %w", kind, step.Name, err)
+			}
+			defer cleanup()
+			inputs = []string{path}
+		} else if kind, spec := trackerMap(v); kind != "" {
+			// Fetch Jira or Linear issues with their comments
+			paths, cleanup, err := p.fetchTrackerInputs(step.Name, kind, spec)
+			if err != nil {
+				return "", fmt.Errorf("%s input error in step %s: %w", kind, step.Name, err)
+			}
+			defer cleanup()
+			inputs = paths
+		} else if spec, ok := v["feed"].(map[string]interface{}); ok {
+			// Read the feed items no earlier run has read
+			paths, cleanup, err := p.fetchFeedInputs(step.Name, spec)
+			if err != nil {
+				return "", fmt.Errorf("feed input error in step %s: %w", step.Name, err)
+			}
+			defer cleanup()
+			if len(paths) == 0 {
+				skipMsg := fmt.Sprintf("Skipping step %s: no new feed items", step.Name)
+				if isParallel {
+					p.emitParallelProgress(skipMsg, stepInfo, parallelID)
+				} else {
+					p.emitProgress(skipMsg, stepInfo)
+				}
+				p.debugf(skipMsg)
+				return "", nil
+			}
+			inputs = paths
+		} else if spec, ok := v["calendar"].(map[string]interface{}); ok {
+			// Read upcoming or past events from an ICS feed or Google Calendar
+			paths, cleanup, err := p.fetchCalendarInputs(step.Name, spec)
+			if err != nil {
+				return "", fmt.Errorf("calendar input error in step %s: %w", step.Name, err)
+			}
+			defer cleanup()
+			inputs = paths
 		} else if url, ok := v["url"].(string); ok {
 			// Handle scraping configuration
 			p.debugf("Scraping content from %s for step: %s", url, step.Name)
@@ -806,6 +1225,15 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	modelNames := p.NormalizeStringSlice(step.Config.Model)
 	actions := p.NormalizeStringSlice(step.Config.Action)
 
+	// Fan in the outputs of a parallel group
+	if step.Config.Join != nil {
+		joined, err := p.applyJoin(step, actions)
+		if err != nil {
+			return "", fmt.Errorf("join error in step %s: %w", step.Name, err)
+		}
+		actions = joined
+	}
+
 	p.debugf("Step configuration:")
 	p.debugf("- Inputs: %v", inputs)
 	p.debugf("- Models: %v", modelNames)
@@ -814,10 +1242,20 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	// Handle STDIN specially
 	if len(inputs) == 1 {
 		input := inputs[0]
-		if strings.HasPrefix(input, "STDIN") {
+		if strings.HasPrefix(input, "STDIN") && p.lastOutputFile != "" {
+			// STDIN too large to keep in memory is already in a file
+			if _, varName := p.parseVariableAssignment(input); varName != "" {
+				contents, err := p.stdinContents(step.Config)
+				if err != nil {
+					return "", fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+				}
+				p.variables[varName] = contents
+			}
+			p.debugf("Processing STDIN input for step %s from %s", step.Name, p.lastOutputFile)
+			inputs = []string{p.lastOutputFile}
+		} else if strings.HasPrefix(input, "STDIN") {
 			// Initialize empty input if none provided
 			if p.lastOutput == "" {
-				p.lastOutput = ""
 				p.debugf("No previous output available, using empty input")
 			}
 
@@ -832,7 +1270,6 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 			tmpFile, err := os.CreateTemp("", "comanda-stdin-*.txt")
 			if err != nil {
 				err = fmt.Errorf("failed to create temp file for STDIN: %w", err)
-				fmt.Printf("Error in step '%s': %v\n", step.Name, err)
 				return "", err
 			}
 			tmpPath := tmpFile.Name()
@@ -841,10 +1278,10 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 			if _, err := tmpFile.WriteString(p.lastOutput); err != nil {
 				tmpFile.Close()
 				err = fmt.Errorf("failed to write to temp file: %w", err)
-				fmt.Printf("Error in step '%s': %v\n", step.Name, err)
 				return "", err
 			}
 			tmpFile.Close()
+			p.trustPath(tmpPath)
 
 			// Update inputs to use the temporary file
 			inputs = []string{tmpPath}
@@ -861,6 +1298,14 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		if inputFile != "STDIN" && inputFile != "NA" {
 			p.debugf("Chunking enabled for step '%s', input file: %s", step.Name, inputFile)
 
+			if !p.isTrustedPath(inputFile) {
+				confined, err := p.confinePath(inputFile)
+				if err != nil {
+					return "", fmt.Errorf("chunk input rejected for step '%s': %w", step.Name, err)
+				}
+				inputFile = confined
+			}
+
 			// Convert the ChunkConfig from the YAML to the chunker's ChunkConfig
 			chunkConfig := chunker.ChunkConfig{
 				By:        step.Config.Chunk.By,
@@ -882,6 +1327,9 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 
 			// Replace the original input with the chunk paths
 			inputs = chunkResult.ChunkPaths
+			for _, chunkPath := range inputs {
+				p.trustPath(chunkPath)
+			}
 
 			// Ensure cleanup of temporary files when the step is done
 			defer func() {
@@ -894,16 +1342,39 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		}
 	}
 
-	// Process inputs for this step
-	if len(inputs) > 0 {
+	// Process inputs for this step. Chunks are read when they are sent to
+	// the model rather than all held in memory.
+	if chunkResult != nil {
+		for _, chunkPath := range inputs {
+			if err := p.handler.AddFileReference(chunkPath); err != nil {
+				return "", fmt.Errorf("input processing error in step %s: %w", step.Name, inputSizeHint(err))
+			}
+		}
+	} else if len(inputs) > 0 {
 		p.debugf("Processing inputs for step %s...", step.Name)
 		if err := p.processInputs(inputs); err != nil {
-			err = fmt.Errorf("input processing error in step %s: %w", step.Name, err)
-			fmt.Printf("Error: %v\n", err)
+			err = fmt.Errorf("input processing error in step %s: %w", step.Name, inputSizeHint(err))
 			return "", err
 		}
 	}
 
+	// In changed-only mode, drop inputs whose contents match the last run
+	var changedInputs map[string]string
+	if p.changeTracker != nil && chunkResult == nil {
+		var unchanged bool
+		changedInputs, metrics.CacheHits, unchanged = p.filterUnchangedInputs(step.Name)
+		if unchanged {
+			skipMsg := fmt.Sprintf("Skipping step %s: no changed inputs", step.Name)
+			if isParallel {
+				p.emitParallelProgress(skipMsg, stepInfo, parallelID)
+			} else {
+				p.emitProgress(skipMsg, stepInfo)
+			}
+			p.debugf(skipMsg)
+			return "", nil
+		}
+	}
+
 	// Record input processing time
 	metrics.InputProcessingTime = time.Since(inputStartTime).Milliseconds()
 	p.debugf("Input processing completed in %d ms", metrics.InputProcessingTime)
@@ -961,10 +1432,15 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 			}
 
 			if chunkIndex >= 0 {
+				chunkContents, err := currentInput.Load()
+				if err != nil {
+					return "", fmt.Errorf("error reading chunk in step %s: %w", step.Name, err)
+				}
+
 				// Replace placeholders with actual values
 				substituted = strings.ReplaceAll(substituted, "{{ chunk_index }}", fmt.Sprintf("%d", chunkIndex+1))
 				substituted = strings.ReplaceAll(substituted, "{{ total_chunks }}", fmt.Sprintf("%d", chunkResult.TotalChunks))
-				substituted = strings.ReplaceAll(substituted, "{{ current_chunk }}", string(currentInput.Contents))
+				substituted = strings.ReplaceAll(substituted, "{{ current_chunk }}", string(chunkContents))
 			}
 		}
 
@@ -975,7 +1451,27 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	}
 
 	p.debugf("Executing actions: models=%v actions=%v", modelNames, substitutedActions)
-	response, err := p.processActions(modelNames, substitutedActions)
+	var response string
+	var err error
+	if step.Config.Ensemble != nil {
+		response, err = p.processEnsemble(step, modelNames, substitutedActions)
+	} else if chunkResult != nil && modelNames[0] != "NA" {
+		response, err = p.processChunks(step, modelNames[0], actions, chunkResult)
+	} else if step.Config.Rows != nil {
+		response, err = p.processRows(step, modelNames[0], actions)
+	} else {
+		response, err = p.processActions(step.Name, modelNames, substitutedActions)
+	}
+	if errors.Is(err, ErrStepSkipped) {
+		skipMsg := fmt.Sprintf("Skipped step: %s", step.Name)
+		if isParallel {
+			p.emitParallelProgress(skipMsg, stepInfo, parallelID)
+		} else {
+			p.emitProgress(skipMsg, stepInfo)
+		}
+		p.debugf(skipMsg)
+		return "", nil
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("Action processing failed for step '%s': %v (models=%v actions=%v)",
 			step.Name, err, modelNames, substitutedActions)
@@ -984,10 +1480,29 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	}
 	p.debugf("Successfully processed actions for step: %s", step.Name)
 
+	// Clean up the response before it is written out or passed on
+	response, err = p.postprocess(step, response)
+	if err != nil {
+		return "", err
+	}
+
 	// Record action processing time
 	metrics.ActionProcessingTime = time.Since(actionStartTime).Milliseconds()
 	p.debugf("Action processing completed in %d ms", metrics.ActionProcessingTime)
 
+	// Estimate token usage for progress displays
+	for _, action := range substitutedActions {
+		metrics.PromptTokens += estimateTokens(action)
+	}
+	for _, in := range p.handler.GetInputs() {
+		if in.Contents == nil && in.Size > 0 {
+			metrics.PromptTokens += int(in.Size / 4) // Added by reference; estimated as estimateTokens does
+		} else if in.Type != input.ImageInput && in.Type != input.ScreenshotInput {
+			metrics.PromptTokens += estimateTokens(string(in.Contents))
+		}
+	}
+	metrics.CompletionTokens = estimateTokens(response)
+
 	// Start output processing time tracking
 	outputStartTime := time.Now()
 
@@ -1023,6 +1538,27 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 
 			p.debugf("Successfully processed database output for step: %s", step.Name)
 			handled = true
+		} else if kind, spec := brokerMap(v); kind != "" {
+			if err := p.publishBrokerOutput(response, kind, spec); err != nil {
+				return "", fmt.Errorf("%s output error in step %s: %w", kind, step.Name, err)
+			}
+			p.debugf("Successfully published output for step: %s", step.Name)
+			handled = true
+		} else if kind, spec := trackerMap(v); kind != "" {
+			if err := p.writeTrackerOutput(response, kind, spec); err != nil {
+				return "", fmt.Errorf("%s output error in step %s: %w", kind, step.Name, err)
+			}
+			handled = true
+		} else if spec, ok := v["spreadsheet"].(map[string]interface{}); ok {
+			if err := p.writeSpreadsheetOutput(response, spec); err != nil {
+				return "", fmt.Errorf("spreadsheet output error in step %s: %w", step.Name, err)
+			}
+			handled = true
+		} else if spec, ok := v["webhook"].(map[string]interface{}); ok {
+			if err := p.postWebhookOutput(step.Name, response, spec); err != nil {
+				return "", fmt.Errorf("webhook output error in step %s: %w", step.Name, err)
+			}
+			handled = true
 		}
 	}
 
@@ -1040,6 +1576,9 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		p.debugf("Successfully processed output for step: %s", step.Name)
 	}
 
+	// Remember the inputs this step has now processed
+	p.recordInputs(step.Name, changedInputs)
+
 	// Record output processing time
 	metrics.OutputProcessingTime = time.Since(outputStartTime).Milliseconds()
 	p.debugf("Output processing completed in %d ms", metrics.OutputProcessingTime)
@@ -1121,7 +1660,11 @@ func (p *Processor) processGenerateStep(step Step, isParallel bool, parallelID s
 	if step.Config.Input != nil {
 		inputValStr := fmt.Sprintf("%v", step.Config.Input)
 		if inputValStr == "STDIN" {
-			contextInput = p.lastOutput
+			stdin, err := p.stdinContents(step.Config)
+			if err != nil {
+				return "", err
+			}
+			contextInput = stdin
 			p.debugf("Generate step '%s' using STDIN content as part of prompt context.", step.Name)
 		} else if inputValStr != "NA" && inputValStr != "" {
 			// If Input is a file path or direct string
@@ -1131,7 +1674,11 @@ func (p *Processor) processGenerateStep(step Step, isParallel bool, parallelID s
 				// A more sophisticated approach might handle them differently.
 				var sb strings.Builder
 				for _, inputPath := range inputs {
-					content, err := os.ReadFile(inputPath)
+					confined, err := p.confinePath(inputPath)
+					if err != nil {
+						return "", fmt.Errorf("input for generate step '%s' rejected: %w", step.Name, err)
+					}
+					content, err := os.ReadFile(confined)
 					if err != nil {
 						p.debugf("Warning: could not read input file %s for generate step %s: %v", inputPath, step.Name, err)
 						continue // Or handle error more strictly
@@ -1148,7 +1695,11 @@ func (p *Processor) processGenerateStep(step Step, isParallel bool, parallelID s
 	// Add content from context_files
 	var contextFilesContent strings.Builder
 	for _, filePath := range step.Config.Generate.ContextFiles {
-		content, err := os.ReadFile(filePath)
+		confined, err := p.confinePath(filePath)
+		if err != nil {
+			return "", fmt.Errorf("context_file for generate step '%s' rejected: %w", step.Name, err)
+		}
+		content, err := os.ReadFile(confined)
 		if err != nil {
 			p.debugf("Warning: could not read context_file %s for generate step %s: %v", filePath, step.Name, err)
 			continue
@@ -1199,7 +1750,7 @@ IMPORTANT: When specifying models in the generated YAML, you MUST use one of the
 	// }
 
 	// Assuming provider is already configured via configureProviders() or similar mechanism
-	generatedResponse, err := provider.SendPrompt(genModelName, fullPrompt)
+	generatedResponse, err := p.traceProvider(step.Name, provider).SendPrompt(genModelName, fullPrompt)
 	if err != nil {
 		return "", fmt.Errorf("LLM execution failed for generate step '%s' with model '%s': %w", step.Name, genModelName, err)
 	}
@@ -1243,7 +1794,10 @@ IMPORTANT: When specifying models in the generated YAML, you MUST use one of the
 	}
 
 	// 5. Save the generated YAML to the output file
-	outputFilePath := step.Config.Generate.Output
+	outputFilePath, err := p.confinePath(step.Config.Generate.Output)
+	if err != nil {
+		return "", fmt.Errorf("output for generate step '%s' rejected: %w", step.Name, err)
+	}
 	if err := os.WriteFile(outputFilePath, []byte(yamlContent), 0644); err != nil {
 		return "", fmt.Errorf("failed to write generated workflow to '%s' in generate step '%s': %w", outputFilePath, step.Name, err)
 	}
@@ -1278,7 +1832,11 @@ func (p *Processor) processProcessStep(step Step, isParallel bool, parallelID st
 
 	// 1. Read the sub-workflow YAML file
 	subWorkflowPath := step.Config.Process.WorkflowFile
-	yamlFile, err := os.ReadFile(subWorkflowPath)
+	confinedWorkflowPath, err := p.confinePath(subWorkflowPath)
+	if err != nil {
+		return "", fmt.Errorf("workflow_file for process step '%s' rejected: %w", step.Name, err)
+	}
+	yamlFile, err := os.ReadFile(confinedWorkflowPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read sub-workflow file '%s' for process step '%s': %w", subWorkflowPath, step.Name, err)
 	}
@@ -1296,6 +1854,8 @@ func (p *Processor) processProcessStep(step Step, isParallel bool, parallelID st
 	if p.progress != nil { // Propagate progress writer if available
 		subProcessor.SetProgressWriter(p.progress)
 	}
+	subProcessor.responseCache = p.responseCache
+	subProcessor.SetContext(p.context()) // Bound by the parent's deadline as well as its own
 
 	// 3. Handle inputs for the sub-workflow (optional)
 	if step.Config.Process.Inputs != nil {
@@ -1313,7 +1873,11 @@ func (p *Processor) processProcessStep(step Step, isParallel bool, parallelID st
 
 	// If the parent 'process' step received STDIN, pass it to the sub-processor's lastOutput
 	if inputValStr := fmt.Sprintf("%v", step.Config.Input); inputValStr == "STDIN" {
-		subProcessor.SetLastOutput(p.lastOutput)
+		if p.lastOutputFile != "" {
+			subProcessor.SetLastOutputFile(p.lastOutputFile)
+		} else {
+			subProcessor.SetLastOutput(p.lastOutput)
+		}
 		p.debugf("Passing STDIN from parent step '%s' to sub-workflow '%s'", step.Name, subWorkflowPath)
 	}
 
@@ -1447,7 +2011,7 @@ func (p *Processor) validateGeneratedWorkflow(yamlContent string) error {
 		p.debugf("Checking if model '%s' in generated workflow is valid", modelName)
 
 		// Check if provider exists for this model
-		provider := models.DetectProvider(modelName)
+		provider := p.detectProvider(modelName)
 		if provider == nil {
 			invalidModels = append(invalidModels, fmt.Sprintf("%s (no provider found)", modelName))
 			continue
@@ -1513,7 +2077,7 @@ func (p *Processor) handleDeferredStep() error {
 	p.debugf("Executing deferred step: %s", deferredCall.StepName)
 
 	// Set the input for the deferred step
-	p.lastOutput = deferredCall.Input
+	p.SetLastOutput(deferredCall.Input)
 
 	// Create a Step object to process
 	deferredStep := Step{
@@ -1528,7 +2092,7 @@ func (p *Processor) handleDeferredStep() error {
 	}
 
 	// The output of the deferred step becomes the new lastOutput
-	p.lastOutput = response
+	p.SetLastOutput(response)
 
 	p.debugf("Successfully processed deferred step: %s", deferredCall.StepName)
 	return nil
@@ -1536,6 +2100,13 @@ func (p *Processor) handleDeferredStep() error {
 
 // getProviderForModel retrieves a model provider based on the model name
 func (p *Processor) getProviderForModel(modelName string) (models.Provider, error) {
+	if p.resolver != nil {
+		if provider := p.resolver(modelName); provider != nil {
+			return provider, nil
+		}
+		return nil, fmt.Errorf("no provider found for model %s", modelName)
+	}
+
 	// First, check if the provider is already initialized
 	for _, provider := range p.providers {
 		if provider.SupportsModel(modelName) {
@@ -1572,6 +2143,7 @@ func (p *Processor) getProviderForModel(modelName string) (models.Provider, erro
 						return nil, fmt.Errorf("failed to configure provider %s: %w", providerName, err)
 					}
 					newProvider.SetVerbose(p.verbose)
+					p.reportRetries(newProvider)
 					p.providers[providerName] = newProvider
 				}
 				return p.providers[providerName], nil
@@ -26,6 +26,15 @@ func init() {
 		}
 		return nil
 	}
+
+	// Pinned providers resolve to the same mocks
+	models.ProviderByName = func(providerName string) models.Provider {
+		switch providerName {
+		case "openai", "anthropic":
+			return NewMockProvider(providerName)
+		}
+		return nil
+	}
 }
 
 // Restore the original DetectProvider function
@@ -647,3 +647,30 @@ func TestFetchURL(t *testing.T) {
 		})
 	}
 }
+
+func TestUnmarshalYAMLWithWebhooks(t *testing.T) {
+	data := []byte(`webhooks:
+  - url: https://hooks.example.com/comanda
+    events: [failed]
+summarize:
+  input: STDIN
+  model: gpt-4o
+  action: Summarize this
+  output: STDOUT
+`)
+	var cfg DSLConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Webhook{{URL: "https://hooks.example.com/comanda", Events: []string{"failed"}}}
+	if !reflect.DeepEqual(cfg.Webhooks, want) {
+		t.Errorf("Webhooks = %+v, want %+v", cfg.Webhooks, want)
+	}
+	if len(cfg.Steps) != 1 {
+		t.Errorf("expected webhooks not to be parsed as a step, got %d steps", len(cfg.Steps))
+	}
+	issues, err := CheckStepFields(data)
+	if err != nil || len(issues) != 0 {
+		t.Errorf("CheckStepFields = %v, %v; want no issues", issues, err)
+	}
+}
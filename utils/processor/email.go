@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/connectors"
+	"github.com/kris-hansen/comanda/utils/mailbox"
+)
+
+// DefaultEmailLimit is how many of the newest matching messages an email
+// input reads when it sets no limit
+const DefaultEmailLimit = 20
+
+// readMailbox and markMailSeen read messages from and flag messages in an
+// IMAP folder; tests replace them
+var (
+	readMailbox  = mailbox.Read
+	markMailSeen = mailbox.MarkSeen
+)
+
+// emailInput is the email map of a step's input
+type emailInput struct {
+	mailbox     string
+	folder      string
+	query       mailbox.Query
+	limit       int
+	markSeen    bool
+	attachments bool
+}
+
+// parseEmailInput reads an email input map, such as
+// {mailbox: support, unseen: true, subject: refund, since: 7d}
+func parseEmailInput(spec map[string]interface{}) (emailInput, error) {
+	in := emailInput{limit: DefaultEmailLimit, attachments: true}
+	var ok bool
+	if in.mailbox, ok = spec["mailbox"].(string); !ok || in.mailbox == "" {
+		return in, fmt.Errorf("email input needs a mailbox")
+	}
+	in.folder, _ = spec["folder"].(string)
+	in.query.From, _ = spec["from"].(string)
+	in.query.Subject, _ = spec["subject"].(string)
+	in.query.Unseen, _ = spec["unseen"].(bool)
+	in.markSeen, _ = spec["mark_seen"].(bool)
+	if attachments, ok := spec["attachments"].(bool); ok {
+		in.attachments = attachments
+	}
+	if limit, ok := spec["limit"].(int); ok {
+		if limit <= 0 {
+			return in, fmt.Errorf("email input limit must be positive")
+		}
+		in.limit = limit
+	}
+	if since, ok := spec["since"].(string); ok && since != "" {
+		t, err := parseSince(since, time.Now())
+		if err != nil {
+			return in, err
+		}
+		in.query.Since = t
+	}
+	return in, nil
+}
+
+// parseSince reads an email input's since: a date such as 2025-06-01, or
+// an age such as 7d or 12h
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q: use a date such as 2025-06-01 or an age such as 7d or 12h", value)
+}
+
+// fetchEmailInputs saves the messages an email input selects, and their
+// attachments, in a temporary directory. It returns their paths, a
+// function removing them, and, when the input sets mark_seen, a function
+// flagging the messages as read.
+func (p *Processor) fetchEmailInputs(stepName string, spec map[string]interface{}) ([]string, func(), func() error, error) {
+	in, err := parseEmailInput(spec)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cfg, err := p.envConfig.Mailbox(in.mailbox)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	folder := cfg.FolderOr(in.folder)
+	p.debugf("Reading up to %d messages from %s/%s for step %s", in.limit, in.mailbox, folder, stepName)
+	messages, err := readMailbox(p.context(), cfg, folder, in.query, in.limit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil, nil, fmt.Errorf("no messages in %s/%s match the email input", in.mailbox, folder)
+	}
+
+	dir, err := os.MkdirTemp(config.TempDir(), "comanda-email-*")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	save := func(name string, data []byte) (string, error) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return "", fmt.Errorf("failed to save %s: %w", name, err)
+		}
+		p.trustPath(path)
+		return path, nil
+	}
+
+	var paths []string
+	var uids []uint32
+	used := make(map[string]bool)
+	for _, msg := range messages {
+		subject := msg.Subject
+		if subject == "" {
+			subject = fmt.Sprintf("message %d", msg.UID)
+		}
+		path, err := save(documentFileName(connectors.Document{Title: subject, Ext: ".txt"}, used), []byte(msg.Render()))
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+		paths = append(paths, path)
+		uids = append(uids, msg.UID)
+		if !in.attachments {
+			continue
+		}
+		for _, a := range msg.Attachments {
+			ext := filepath.Ext(a.Filename)
+			name := documentFileName(connectors.Document{Title: strings.TrimSuffix(a.Filename, ext), Ext: ext}, used)
+			path, err := save(name, a.Data)
+			if err != nil {
+				cleanup()
+				return nil, nil, nil, err
+			}
+			paths = append(paths, path)
+		}
+	}
+	p.debugf("Read %d message(s) with %d file(s) for step %s", len(messages), len(paths), stepName)
+
+	var markSeen func() error
+	if in.markSeen {
+		markSeen = func() error {
+			return markMailSeen(p.context(), cfg, folder, uids)
+		}
+	}
+	return paths, cleanup, markSeen, nil
+}
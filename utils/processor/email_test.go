@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/mailbox"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// failingProvider fails every prompt
+type failingProvider struct {
+	MockProvider
+}
+
+func (f *failingProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+	return "", errors.New("server error")
+}
+
+// withFakeMailbox makes email inputs read two support messages, one with an
+// attachment, and records the UIDs marked as read
+func withFakeMailbox(t *testing.T) (*mailbox.Query, *[]uint32) {
+	var query mailbox.Query
+	var marked []uint32
+	previousRead, previousMark := readMailbox, markMailSeen
+	readMailbox = func(ctx context.Context, cfg config.MailboxConfig, folder string, q mailbox.Query, limit int) ([]mailbox.Message, error) {
+		query = q
+		return []mailbox.Message{
+			{UID: 7, From: "ana@example.com", Subject: "Refund request", Text: "Charged twice",
+				Attachments: []mailbox.Attachment{{Filename: "receipt.txt", Data: []byte("order 42")}}},
+			{UID: 9, From: "bo@example.com", Subject: "Login broken", Text: "Can't sign in"},
+		}, nil
+	}
+	markMailSeen = func(ctx context.Context, cfg config.MailboxConfig, folder string, uids []uint32) error {
+		if folder != "Support" {
+			t.Errorf("marked messages in %s, want Support", folder)
+		}
+		marked = append(marked, uids...)
+		return nil
+	}
+	t.Cleanup(func() { readMailbox, markMailSeen = previousRead, previousMark })
+	return &query, &marked
+}
+
+func emailEnvConfig() *config.EnvConfig {
+	env := createTestEnvConfig()
+	env.Mailboxes = map[string]config.MailboxConfig{
+		"support": {Host: "imap.example.com", Username: "support@example.com", Folder: "Support"},
+	}
+	return env
+}
+
+func TestEmailInput(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	query, marked := withFakeMailbox(t)
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return NewMockProvider("openai") }
+	defer func() { models.DetectProvider = previous }()
+
+	cfg := &DSLConfig{Steps: []Step{{Name: "triage", Config: StepConfig{
+		Input: map[string]interface{}{"email": map[string]interface{}{
+			"mailbox": "support", "unseen": true, "subject": "refund", "mark_seen": true,
+		}},
+		Model:     "gpt-4o",
+		Action:    "Route each message to a team",
+		Output:    "STDOUT",
+		BatchMode: "individual",
+	}}}}
+	proc := NewProcessor(cfg, emailEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if !query.Unseen || query.Subject != "refund" {
+		t.Errorf("searched with %+v, want unseen messages about refunds", *query)
+	}
+	for _, name := range []string{"Refund request.txt", "receipt.txt", "Login broken.txt"} {
+		if !strings.Contains(proc.LastOutput(), string(filepath.Separator)+name) {
+			t.Errorf("output doesn't mention %s:\n%s", name, proc.LastOutput())
+		}
+	}
+	if len(*marked) != 2 || (*marked)[0] != 7 || (*marked)[1] != 9 {
+		t.Errorf("marked %v as read, want 7 and 9 after the step succeeded", *marked)
+	}
+}
+
+func TestEmailInputLeftUnreadOnFailure(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	_, marked := withFakeMailbox(t)
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		return &failingProvider{MockProvider: MockProvider{name: "openai"}}
+	}
+	defer func() { models.DetectProvider = previous }()
+
+	cfg := &DSLConfig{Steps: []Step{{Name: "triage", Config: StepConfig{
+		Input:  map[string]interface{}{"email": map[string]interface{}{"mailbox": "support", "mark_seen": true}},
+		Model:  "gpt-4o",
+		Action: "Route each message to a team",
+		Output: "STDOUT",
+	}}}}
+	proc := NewProcessor(cfg, emailEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err == nil {
+		t.Fatal("Process() succeeded, want the provider's error")
+	}
+	if len(*marked) != 0 {
+		t.Errorf("marked %v as read after the step failed", *marked)
+	}
+}
+
+func TestParseEmailInput(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Time{
+		"2025-06-01": time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		"7d":         time.Date(2025, 6, 3, 12, 0, 0, 0, time.UTC),
+		"12h":        time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC),
+	} {
+		if got, err := parseSince(value, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseSince(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseSince("last week", now); err == nil {
+		t.Error("parseSince accepted an invalid value")
+	}
+
+	if _, err := parseEmailInput(map[string]interface{}{"unseen": true}); err == nil {
+		t.Error("parseEmailInput accepted an input without a mailbox")
+	}
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.missingInputs(StepConfig{Input: map[string]interface{}{"email": map[string]interface{}{"mailbox": "sales"}}})
+	if len(errs) != 1 || !strings.Contains(errs[0], `mailbox "sales" is not configured`) {
+		t.Errorf("missingInputs() = %v, want the unconfigured mailbox", errs)
+	}
+}
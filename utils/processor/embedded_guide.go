@@ -148,6 +148,202 @@ step_name_for_processing:
 - ` + "`inputs`" + `: (map, optional) A map of key-value pairs to pass as initial variables to the sub-workflow. These can be accessed within the sub-workflow (e.g., as ` + "`$parent.key1`" + `).
 - **Note:** The ` + "`input`" + ` field for a ` + "`process`" + ` step is optional. If ` + "`input: STDIN`" + ` is used, the output of the previous step in the parent workflow will be available as the initial ` + "`STDIN`" + ` for the *first* step of the sub-workflow if that first step expects ` + "`STDIN`" + `.
 
+## 4. Ensemble Step Definition (` + "`ensemble`" + `)
+
+A standard step with an ` + "`ensemble`" + ` block sends the same action to every listed model in parallel and merges the answers.
+
+` + "```" + `yaml
+classify_ticket:
+  input: ticket.txt
+  model: [gpt-4o, claude-3-5-sonnet-latest]
+  action: "Classify this ticket as bug, feature or question"
+  output: STDOUT
+  ensemble:
+    strategy: vote        # vote | judge | concat
+    judge_model: gpt-4o   # required for judge
+    field: label          # optional, vote on one JSON field
+` + "```" + `
+
+## 5. Join Step Definition (` + "`join`" + `)
+
+A sequential standard step with a ` + "`join`" + ` block receives the outputs of a parallel group, keyed by step name.
+
+` + "```" + `yaml
+combine_analyses:
+  join:
+    group: analysis       # optional when there is only one parallel group
+    steps: [sentiment, topics]  # optional subset/order for join.all
+  input: NA
+  model: gpt-4o
+  action: "Merge these: {{ join.sentiment }} and {{ join.topics }}"  # or {{ join.all }}
+  output: STDOUT
+` + "```" + `
+
+## 6. Data Validation Step Definition (` + "`type: validate-data`" + `)
+
+Checks CSV/JSON/JSONL inputs against declared columns and fails fast with row-level errors. No model or action is needed.
+
+` + "```" + `yaml
+check_orders:
+  type: validate-data
+  input: orders.csv
+  schema:
+    columns:
+      order_id: {type: integer, required: true}  # string | integer | number | boolean | date
+      amount: number
+  output: STDOUT
+` + "```" + `
+
+## 7. Agent Step Definition (` + "`type: agent`" + `)
+
+The model repeatedly calls allow-listed tools until it returns a final answer. Requires exactly one model.
+
+` + "```" + `yaml
+research:
+  type: agent
+  input: NA
+  model: gpt-4o
+  action: "Summarize open incidents from the runbooks"
+  agent:
+    tools: [http, shell, file_read, file_write, retrieval]  # allow-list
+    allowed_commands: [grep, ls]   # required for shell; server runs only allow the server's agentTools.shellCommands
+    allowed_hosts: [api.example.com]  # required for http; redirects must stay within them
+    retrieval_paths: [runbooks/]   # required for retrieval
+    mcp_servers: [jira]            # MCP servers from the env config; tools appear as jira.<tool>
+    max_iterations: 10
+    max_tokens: 100000
+  output: STDOUT
+` + "```" + `
+
+## 8. Vector Store Steps (` + "`type: index`" + ` and ` + "`type: retrieve`" + `)
+
+` + "`index`" + ` embeds its inputs with an embedding model and adds them to a vector store configured under ` + "`vector_stores`" + ` in the env config (Qdrant, pgvector, Chroma or Pinecone). With ` + "`chunk`" + `, each chunk is a separate document. ` + "`retrieve`" + ` embeds its input as a query and outputs the ` + "`top_k`" + ` nearest documents with their sources, for a later step to use as context. No action is needed.
+
+` + "```" + `yaml
+index_docs:
+  type: index
+  input: docs/*.md
+  model: text-embedding-3-small   # OpenAI text-embedding-* or a local Ollama embedding model
+  chunk: {by: lines, size: 40, overlap: 5}
+  vector_store: {name: kb, collection: handbook}
+  output: STDOUT
+
+find_context:
+  type: retrieve
+  input: STDIN                    # the query
+  model: text-embedding-3-small   # same model used to index
+  vector_store: {name: kb, collection: handbook, top_k: 5}
+  output: STDOUT
+` + "```" + `
+
+## 9. Transcription Step (` + "`type: transcribe`" + `)
+
+` + "`transcribe`" + ` turns recordings (mp3, mp4, m4a, wav, webm, ogg, flac; up to 25MB each) into text with an OpenAI transcription model. Several inputs are output in order, each under a ` + "`## <file>`" + ` heading. No action is needed. Chunk and summarize the transcript in later steps.
+
+` + "```" + `yaml
+transcribe_call:
+  type: transcribe
+  input: "{{ params.file }}"      # files or globs; not STDIN
+  model: whisper-1                # or gpt-4o-transcribe, gpt-4o-mini-transcribe
+  transcribe:
+    language: en                  # optional, detected when unset
+    prompt: "Comanda, Kubernetes" # optional spelling hints
+    timestamps: true              # [mm:ss] before each segment (whisper-1 only)
+  output: "{{ params.file }}.md"
+` + "```" + `
+
+## 10. Render Step (` + "`type: render`" + `)
+
+` + "`render`" + ` writes markdown from STDIN or files as HTML, PDF or DOCX, picked by each output's extension (or ` + "`render.format`" + `). Use it after a step that writes a report. No model or action is needed.
+
+` + "```" + `yaml
+publish:
+  type: render
+  input: STDIN
+  render:
+    title: Weekly Report      # optional, defaults to the first heading
+    page_size: letter         # PDF only: a4 (default) or letter
+    template: brand.docx      # optional: .docx styles for DOCX, or a Go HTML template for HTML
+    css: report.css           # optional HTML stylesheet
+  output: [report.pdf, report.docx, report.html]
+` + "```" + `
+
+## 11. Translate Step (` + "`type: translate`" + `)
+
+` + "`translate`" + ` translates text from STDIN or files into ` + "`translate.to`" + `, a language code or name. The source language is detected unless ` + "`from`" + ` is set, and text already in the target language is passed through. Long texts are translated in parts of ` + "`chunk_tokens`" + ` (default 2000), each given the glossary and the end of the previous part so terms stay consistent. An optional ` + "`action`" + ` adds instructions.
+
+` + "```" + `yaml
+translate_docs:
+  type: translate
+  input: docs/guide.md
+  model: gpt-4o
+  translate:
+    to: de                    # required: code or name, such as de or German
+    from: en                  # optional, detected when omitted
+    glossary:                 # optional: terms translated the same way every time
+      dashboard: Dashboard
+    glossary_file: terms.csv  # optional CSV of term,translation rows
+    chunk_tokens: 1500        # optional
+  action: "Use the formal Sie"
+  output: docs/guide.de.md
+` + "```" + `
+
+## 12. Dedupe Step (` + "`type: dedupe`" + `)
+
+` + "`dedupe`" + ` embeds items from STDIN or files with an embedding model and passes on one of each group of near-duplicates, in input order. Use it before expensive steps over scraped or noisy text.
+
+` + "```" + `yaml
+drop_duplicates:
+  type: dedupe
+  input: scraped/*.md
+  model: text-embedding-3-small
+  dedupe:
+    by: documents        # documents (default), lines, paragraphs, rows (CSV) or chunks (needs a chunk block)
+    threshold: 0.92      # optional cosine similarity of duplicates (default 0.9)
+    keep: longest        # optional: first (default) or longest of each group
+    columns: [title]     # rows only: columns compared (default all)
+  output: STDOUT
+` + "```" + `
+
+Documents and chunks are output labelled ` + "`[n] source`" + `, lines and paragraphs as text, rows as CSV under the header. No action is needed.
+
+## 13. Summarize Step (` + "`type: summarize`" + `)
+
+` + "`summarize`" + ` summarizes text from STDIN or files, read as one document, splitting long texts into parts and combining the passes itself. An optional ` + "`action`" + ` says what to focus on.
+
+` + "```" + `yaml
+summarize_report:
+  type: summarize
+  input: report.md
+  model: gpt-4o-mini
+  summarize:
+    strategy: map-reduce   # stuff, map-reduce or refine; default: stuff when it fits in one prompt, else map-reduce
+    length: short          # short, medium, long, a number of words, or any length such as "3 paragraphs"
+    style: executive       # bullets, prose, executive, tldr, or any description
+    chunk_tokens: 3000     # optional: most text per prompt
+    parallel: 4            # optional: parts summarized at once by map-reduce
+  action: "Focus on risks"
+  output: STDOUT
+` + "```" + `
+
+` + "`stuff`" + ` sends the whole text in one prompt. ` + "`map-reduce`" + ` summarizes each part, then combines the summaries, in groups first if they don't fit in one prompt. ` + "`refine`" + ` summarizes the first part and updates that summary with each later part, in order. Parts are split at paragraphs, or by the step's ` + "`chunk`" + ` block when it has one.
+
+## 14. Approval Step (` + "`type: approval`" + `)
+
+` + "`approval`" + ` pauses the run until a person approves its input, then writes the input, unchanged, to its outputs and passes it on. A rejection, or no decision before ` + "`timeout`" + `, fails the run. It takes no ` + "`model`" + ` or ` + "`action`" + `.
+
+` + "```" + `yaml
+review_draft:
+  type: approval
+  input: STDIN
+  approval:
+    message: "Publish this announcement?"   # optional: question shown to the approver
+    timeout: 4h                             # optional: how long to wait
+  output: announcement.md
+` + "```" + `
+
+` + "`comanda process`" + ` asks on the terminal. In the server, the run sends the ` + "`approval_needed`" + ` webhook event and waits for ` + "`POST /runs/{id}/approval`" + `.
+
 ## Common Elements (for Standard Steps)
 
 ### Input Types
@@ -156,6 +352,12 @@ step_name_for_processing:
 - Multiple file paths: ` + "`input: [file1.txt, file2.txt]`" + `
 - Web scraping: ` + "`input: { url: \"https://example.com\" }`" + ` (Further scrape config under ` + "`scrape_config`" + ` map if needed)
 - Database query: ` + "`input: { database: { type: \"postgres\", query: \"SELECT * FROM users\" } }`" + `
+- Google Drive, Notion or Confluence documents, by URL or ID, converted to markdown: ` + "`input: { gdrive: <url> }`" + `, ` + "`input: { notion: [<url>, <url>] }`" + `, ` + "`input: { confluence: <url> }`" + ` (credentials under ` + "`connectors`" + ` in the env config)
+- Email messages and their attachments from an IMAP folder: ` + "`input: { email: { mailbox: support, unseen: true, subject: refund, since: 7d, limit: 20, mark_seen: true } }`" + ` (accounts under ` + "`mailboxes`" + ` in the env config; ` + "`mark_seen`" + ` marks messages as read only when the step succeeds)
+- Kafka and NATS messages, one value per line: ` + "`input: { kafka: { broker: events, topic: orders, group: triage, batch: 100, wait: 10s } }`" + ` or ` + "`input: { nats: { broker: bus, subject: orders.new, consumer: triage } }`" + `; publish a step's output with ` + "`output: { kafka: { broker: events, topic: reviews, split: lines } }`" + ` (brokers under ` + "`brokers`" + ` in the env config; consumed messages are acknowledged only when the run succeeds)
+- Jira and Linear issues with their comments: ` + "`input: { jira: { jql: \"project = ENG AND status = Open\", limit: 20 } }`" + `, ` + "`input: { jira: { issues: [ENG-1, ENG-2] } }`" + ` or ` + "`input: { linear: { team: ENG, state: Triage, label: bug } }`" + `; write the output back with ` + "`output: { jira: { action: create, project: ENG, type: Task } }`" + ` (first line is the title), ` + "`{ action: update, issue: ENG-1 }`" + ` (replaces the description) or ` + "`{ action: comment, issue: ENG-1 }`" + ` (credentials under ` + "`trackers`" + ` in the env config)
+- Calendar events from an ICS feed or Google Calendar, as one markdown agenda: ` + "`input: { calendar: { name: work, from: today, to: +1d, match: call } }`" + ` (calendars under ` + "`calendars`" + ` in the env config) or ` + "`{ ics: <url or file> }`" + ` / ` + "`{ google: primary }`" + `; ` + "`from`" + `/` + "`to`" + ` take now, today, tomorrow, offsets such as -7d or 12h, or dates; ` + "`split: events`" + ` saves a file per event and ` + "`template: '{{ .Start | date \"15:04\" }} {{ .Summary }}'`" + ` renders each event with a Go template
+- RSS and Atom feeds, new items only: ` + "`input: { feed: { urls: [https://example.com/feed.xml], since: 7d, match: security, limit: 10 } }`" + ` passes on the items no earlier successful run read, newest first, as one markdown digest (` + "`split: items`" + ` for a file per item); the step is skipped when nothing is new, and ` + "`key`" + ` names the store of read items
 - No input: ` + "`input: NA`" + `
 - Input with alias for variable: ` + "`input: path/to/file.txt as $my_var`" + `
 - List with aliases: ` + "`input: [file1.txt as $file1_content, file2.txt as $file2_content]`" + `
@@ -184,6 +386,9 @@ step_name:
   - ` + "`size`" + `: (Required) Number of lines or tokens per chunk.
   - ` + "`overlap`" + `: (Optional) Number of lines or tokens to include from the previous chunk, providing context continuity.
   - ` + "`max_chunks`" + `: (Optional) Maximum number of chunks to process, useful for testing or limiting processing.
+  - ` + "`parallel`" + `: (Optional) Chunks sent to the model at once (default 4). Responses are joined in chunk order.
+  - ` + "`max_attempts`" + `: (Optional) Times a failing chunk is sent before it is given up on (default 3). The other chunks' responses are kept.
+- ` + "`max_input_size`" + `: (Optional) Most input the step reads into memory, such as ` + "`500MB`" + ` (default 100MB). With chunking it applies to each chunk, so very large files should be chunked rather than given a larger limit.
 - ` + "`batch_mode: individual`" + `: Required when using chunking to process each chunk as a separate LLM call.
 - ` + "`{{ current_chunk }}`" + `: Template variable that gets replaced with the current chunk content in the action.
 - ` + "`{{ chunk_index }}`" + `: Template variable for the current chunk number (0-based), useful in output paths.
@@ -211,10 +416,54 @@ consolidate_results:
   output: "final_summary.txt"
 ` + "```" + `
 
+### CSV Rows
+Add a ` + "`rows`" + ` block to a standard step to apply its action to every row of a CSV input (one file or STDIN), and output the CSV with the answers in new columns:
+
+` + "```" + `yaml
+classify_leads:
+  input: leads.csv
+  model: gpt-4o-mini
+  rows:
+    columns: [category, priority]  # optional: new columns; default is one named after the step
+    batch: 1                       # optional: rows per prompt (default 1)
+    parallel: 4                    # optional: prompts sent at once (default 4)
+    max_attempts: 3                # optional
+  action: "Classify the lead from {{ company }}: {{ notes }}"
+  output: leads_classified.csv
+` + "```" + `
+
+- ` + "`{{ column name }}`" + `: The row's value of that column (one row per prompt only). ` + "`{{ row }}`" + ` is the whole row, ` + "`{{ rows }}`" + ` the batch as CSV with a ` + "`row`" + ` number, and ` + "`{{ row_index }}`" + `/` + "`{{ total_rows }}`" + ` count rows from 1. Rows the action doesn't mention are added after it.
+- comanda tells the model how to answer: the value alone for one column, or JSON objects with the columns as keys. New columns replace input columns of the same name.
+- A prompt whose answer fails or lacks a column is retried; if it still fails the step fails, unless ` + "`skip_errors: true`" + `, which leaves its cells empty.
+- ` + "`rows`" + ` can't be combined with ` + "`chunk`" + ` or ` + "`ensemble`" + `, and needs one model.
+
+### Prompt Variants
+Add ` + "`variants`" + ` to a standard step to A/B test versions of its prompt. Each run uses one variant, picked in proportion to ` + "`weight`" + `, and records which in the run history:
+
+` + "```" + `yaml
+reply:
+  input: STDIN
+  model: gpt-4o-mini
+  variants:
+    - name: concise
+      action: "Answer the customer in two sentences."
+    - name: detailed
+      action: "Answer the customer step by step, quoting the relevant policy."
+      model: gpt-4o   # optional: replaces the step's model
+      weight: 2       # optional: share of runs (default 1)
+  output: STDOUT
+` + "```" + `
+
+- A variant replaces the step's ` + "`action`" + ` (which can then be omitted) and, if it sets one, its ` + "`model`" + `.
+- Variant names must be unique within the step; variants are only supported on standard steps, and can't set a model on an ensemble step.
+- ` + "`comanda process --variant reply=concise`" + ` forces a variant. ` + "`comanda eval`" + ` splits the dataset between variants by item ID and reports each variant's scores.
+
 ### Models
 - Single model: ` + "`model: gpt-4o-mini`" + `
 - No model (for non-LLM operations): ` + "`model: NA`" + `
 - Multiple models (for comparison): ` + "`model: [gpt-4o-mini, claude-3-opus-20240229]`" + `
+- Model alias: ` + "`model: support-bot`" + ` uses the model a ` + "`comanda models alias`" + ` (or ` + "`comanda finetune submit --alias`" + `) points it at, such as a fine-tuned model
+- Pin a provider when a model name is ambiguous: ` + "`provider: openai`" + ` (one of openai, anthropic, google, xai, deepseek, moonshot, ollama)
 
 ### Actions
 - Single instruction: ` + "`action: \"Summarize this text.\"`" + `
@@ -226,13 +475,28 @@ consolidate_results:
 - Console: ` + "`output: STDOUT`" + `
 - File: ` + "`output: results.txt`" + `
 - Database: ` + "`output: { database: { type: \"postgres\", table: \"results_table\" } }`" + `
+- Spreadsheet: ` + "`output: report.xlsx`" + ` turns CSV or JSON output into a formatted, typed workbook; ` + "`output: { spreadsheet: { file: report.xlsx, sheet: Leads, columns: { score: integer, due: date } } }`" + ` sets column types (string, integer, number, boolean, date, datetime), and ` + "`output: { spreadsheet: { google_sheet: <sheet URL>, sheet: Leads } }`" + ` appends the rows to a Google Sheet
+- Webhook: ` + "`output: { webhook: { url: \"{{ env.HOOK_URL }}\", payload: '{\"summary\": {{ json .Output }}, \"score\": {{ .JSON.score }}}', secret: \"{{ env.HOOK_SECRET }}\" } }`" + ` posts a Go-templated JSON payload (` + "`.Output`" + `, ` + "`.JSON`" + ` for JSON output, ` + "`.Vars`" + `, ` + "`.Step`" + `, ` + "`.Time`" + `; ` + "`json`" + ` quotes a value) to Zapier, Make or any URL, signed with HMAC-SHA256 and retried
 - Output with alias (if supported for variable creation from output): ` + "`output: STDOUT as $step_output_var`" + `
 
+### Post-Processing
+- ` + "`postprocess: [extract_first_code_block, trim]`" + ` cleans the response before it is written out and passed to the next step.
+- Operations, applied in order: ` + "`strip_fences`" + `, ` + "`extract_first_code_block`" + `, ` + "`extract_last_code_block`" + `, ` + "`trim`" + `, ` + "`unescape_json`" + `.
+
 ## Variables
 - Definition: ` + "`input: data.txt as $initial_data`" + `
 - Reference: ` + "`action: \"Compare this analysis with $initial_data\"`" + `
 - Scope: Variables are typically scoped to the workflow. For ` + "`process`" + ` steps, parent variables are not directly accessible by default; use the ` + "`process.inputs`" + ` map to pass data.
 
+## Workflow Environment
+- Inline variables: a top-level ` + "`env:`" + ` map, e.g. ` + "`env: { REGION: us-east-1 }`" + `
+- File variables: a top-level ` + "`env_file: .env.workflow`" + ` (dotenv ` + "`KEY=VALUE`" + ` lines)
+- Reference: ` + "`action: \"Summarize the report for {{ env.REGION }}\"`" + `
+- ` + "`env`" + ` and ` + "`env_file`" + ` are reserved top-level keys and are not steps.
+
+## Run Time Limit
+- A top-level ` + "`max_duration: 30m`" + ` (a Go duration such as ` + "`90s`" + ` or ` + "`1h30m`" + `) stops the run once that time has passed, retries included. It is a reserved key, not a step.
+
 ## Validation Rules Summary (for LLM)
 
 1.  A step definition must clearly be one of: Standard, Generate, or Process.
@@ -420,6 +684,202 @@ step_name_for_processing:
 - ` + "`inputs`" + `: (map, optional) A map of key-value pairs to pass as initial variables to the sub-workflow. These can be accessed within the sub-workflow (e.g., as ` + "`$parent.key1`" + `).
 - **Note:** The ` + "`input`" + ` field for a ` + "`process`" + ` step is optional. If ` + "`input: STDIN`" + ` is used, the output of the previous step in the parent workflow will be available as the initial ` + "`STDIN`" + ` for the *first* step of the sub-workflow if that first step expects ` + "`STDIN`" + `.
 
+## 4. Ensemble Step Definition (` + "`ensemble`" + `)
+
+A standard step with an ` + "`ensemble`" + ` block sends the same action to every listed model in parallel and merges the answers.
+
+` + "```" + `yaml
+classify_ticket:
+  input: ticket.txt
+  model: [gpt-4o, claude-3-5-sonnet-latest]
+  action: "Classify this ticket as bug, feature or question"
+  output: STDOUT
+  ensemble:
+    strategy: vote        # vote | judge | concat
+    judge_model: gpt-4o   # required for judge
+    field: label          # optional, vote on one JSON field
+` + "```" + `
+
+## 5. Join Step Definition (` + "`join`" + `)
+
+A sequential standard step with a ` + "`join`" + ` block receives the outputs of a parallel group, keyed by step name.
+
+` + "```" + `yaml
+combine_analyses:
+  join:
+    group: analysis       # optional when there is only one parallel group
+    steps: [sentiment, topics]  # optional subset/order for join.all
+  input: NA
+  model: gpt-4o
+  action: "Merge these: {{ join.sentiment }} and {{ join.topics }}"  # or {{ join.all }}
+  output: STDOUT
+` + "```" + `
+
+## 6. Data Validation Step Definition (` + "`type: validate-data`" + `)
+
+Checks CSV/JSON/JSONL inputs against declared columns and fails fast with row-level errors. No model or action is needed.
+
+` + "```" + `yaml
+check_orders:
+  type: validate-data
+  input: orders.csv
+  schema:
+    columns:
+      order_id: {type: integer, required: true}  # string | integer | number | boolean | date
+      amount: number
+  output: STDOUT
+` + "```" + `
+
+## 7. Agent Step Definition (` + "`type: agent`" + `)
+
+The model repeatedly calls allow-listed tools until it returns a final answer. Requires exactly one model.
+
+` + "```" + `yaml
+research:
+  type: agent
+  input: NA
+  model: gpt-4o
+  action: "Summarize open incidents from the runbooks"
+  agent:
+    tools: [http, shell, file_read, file_write, retrieval]  # allow-list
+    allowed_commands: [grep, ls]   # required for shell; server runs only allow the server's agentTools.shellCommands
+    allowed_hosts: [api.example.com]  # required for http; redirects must stay within them
+    retrieval_paths: [runbooks/]   # required for retrieval
+    mcp_servers: [jira]            # MCP servers from the env config; tools appear as jira.<tool>
+    max_iterations: 10
+    max_tokens: 100000
+  output: STDOUT
+` + "```" + `
+
+## 8. Vector Store Steps (` + "`type: index`" + ` and ` + "`type: retrieve`" + `)
+
+` + "`index`" + ` embeds its inputs with an embedding model and adds them to a vector store configured under ` + "`vector_stores`" + ` in the env config (Qdrant, pgvector, Chroma or Pinecone). With ` + "`chunk`" + `, each chunk is a separate document. ` + "`retrieve`" + ` embeds its input as a query and outputs the ` + "`top_k`" + ` nearest documents with their sources, for a later step to use as context. No action is needed.
+
+` + "```" + `yaml
+index_docs:
+  type: index
+  input: docs/*.md
+  model: text-embedding-3-small   # OpenAI text-embedding-* or a local Ollama embedding model
+  chunk: {by: lines, size: 40, overlap: 5}
+  vector_store: {name: kb, collection: handbook}
+  output: STDOUT
+
+find_context:
+  type: retrieve
+  input: STDIN                    # the query
+  model: text-embedding-3-small   # same model used to index
+  vector_store: {name: kb, collection: handbook, top_k: 5}
+  output: STDOUT
+` + "```" + `
+
+## 9. Transcription Step (` + "`type: transcribe`" + `)
+
+` + "`transcribe`" + ` turns recordings (mp3, mp4, m4a, wav, webm, ogg, flac; up to 25MB each) into text with an OpenAI transcription model. Several inputs are output in order, each under a ` + "`## <file>`" + ` heading. No action is needed. Chunk and summarize the transcript in later steps.
+
+` + "```" + `yaml
+transcribe_call:
+  type: transcribe
+  input: "{{ params.file }}"      # files or globs; not STDIN
+  model: whisper-1                # or gpt-4o-transcribe, gpt-4o-mini-transcribe
+  transcribe:
+    language: en                  # optional, detected when unset
+    prompt: "Comanda, Kubernetes" # optional spelling hints
+    timestamps: true              # [mm:ss] before each segment (whisper-1 only)
+  output: "{{ params.file }}.md"
+` + "```" + `
+
+## 10. Render Step (` + "`type: render`" + `)
+
+` + "`render`" + ` writes markdown from STDIN or files as HTML, PDF or DOCX, picked by each output's extension (or ` + "`render.format`" + `). Use it after a step that writes a report. No model or action is needed.
+
+` + "```" + `yaml
+publish:
+  type: render
+  input: STDIN
+  render:
+    title: Weekly Report      # optional, defaults to the first heading
+    page_size: letter         # PDF only: a4 (default) or letter
+    template: brand.docx      # optional: .docx styles for DOCX, or a Go HTML template for HTML
+    css: report.css           # optional HTML stylesheet
+  output: [report.pdf, report.docx, report.html]
+` + "```" + `
+
+## 11. Translate Step (` + "`type: translate`" + `)
+
+` + "`translate`" + ` translates text from STDIN or files into ` + "`translate.to`" + `, a language code or name. The source language is detected unless ` + "`from`" + ` is set, and text already in the target language is passed through. Long texts are translated in parts of ` + "`chunk_tokens`" + ` (default 2000), each given the glossary and the end of the previous part so terms stay consistent. An optional ` + "`action`" + ` adds instructions.
+
+` + "```" + `yaml
+translate_docs:
+  type: translate
+  input: docs/guide.md
+  model: gpt-4o
+  translate:
+    to: de                    # required: code or name, such as de or German
+    from: en                  # optional, detected when omitted
+    glossary:                 # optional: terms translated the same way every time
+      dashboard: Dashboard
+    glossary_file: terms.csv  # optional CSV of term,translation rows
+    chunk_tokens: 1500        # optional
+  action: "Use the formal Sie"
+  output: docs/guide.de.md
+` + "```" + `
+
+## 12. Dedupe Step (` + "`type: dedupe`" + `)
+
+` + "`dedupe`" + ` embeds items from STDIN or files with an embedding model and passes on one of each group of near-duplicates, in input order. Use it before expensive steps over scraped or noisy text.
+
+` + "```" + `yaml
+drop_duplicates:
+  type: dedupe
+  input: scraped/*.md
+  model: text-embedding-3-small
+  dedupe:
+    by: documents        # documents (default), lines, paragraphs, rows (CSV) or chunks (needs a chunk block)
+    threshold: 0.92      # optional cosine similarity of duplicates (default 0.9)
+    keep: longest        # optional: first (default) or longest of each group
+    columns: [title]     # rows only: columns compared (default all)
+  output: STDOUT
+` + "```" + `
+
+Documents and chunks are output labelled ` + "`[n] source`" + `, lines and paragraphs as text, rows as CSV under the header. No action is needed.
+
+## 13. Summarize Step (` + "`type: summarize`" + `)
+
+` + "`summarize`" + ` summarizes text from STDIN or files, read as one document, splitting long texts into parts and combining the passes itself. An optional ` + "`action`" + ` says what to focus on.
+
+` + "```" + `yaml
+summarize_report:
+  type: summarize
+  input: report.md
+  model: gpt-4o-mini
+  summarize:
+    strategy: map-reduce   # stuff, map-reduce or refine; default: stuff when it fits in one prompt, else map-reduce
+    length: short          # short, medium, long, a number of words, or any length such as "3 paragraphs"
+    style: executive       # bullets, prose, executive, tldr, or any description
+    chunk_tokens: 3000     # optional: most text per prompt
+    parallel: 4            # optional: parts summarized at once by map-reduce
+  action: "Focus on risks"
+  output: STDOUT
+` + "```" + `
+
+` + "`stuff`" + ` sends the whole text in one prompt. ` + "`map-reduce`" + ` summarizes each part, then combines the summaries, in groups first if they don't fit in one prompt. ` + "`refine`" + ` summarizes the first part and updates that summary with each later part, in order. Parts are split at paragraphs, or by the step's ` + "`chunk`" + ` block when it has one.
+
+## 14. Approval Step (` + "`type: approval`" + `)
+
+` + "`approval`" + ` pauses the run until a person approves its input, then writes the input, unchanged, to its outputs and passes it on. A rejection, or no decision before ` + "`timeout`" + `, fails the run. It takes no ` + "`model`" + ` or ` + "`action`" + `.
+
+` + "```" + `yaml
+review_draft:
+  type: approval
+  input: STDIN
+  approval:
+    message: "Publish this announcement?"   # optional: question shown to the approver
+    timeout: 4h                             # optional: how long to wait
+  output: announcement.md
+` + "```" + `
+
+` + "`comanda process`" + ` asks on the terminal. In the server, the run sends the ` + "`approval_needed`" + ` webhook event and waits for ` + "`POST /runs/{id}/approval`" + `.
+
 ## Common Elements (for Standard Steps)
 
 ### Input Types
@@ -428,14 +888,64 @@ step_name_for_processing:
 - Multiple file paths: ` + "`input: [file1.txt, file2.txt]`" + `
 - Web scraping: ` + "`input: { url: \"https://example.com\" }`" + ` (Further scrape config under ` + "`scrape_config`" + ` map if needed)
 - Database query: ` + "`input: { database: { type: \"postgres\", query: \"SELECT * FROM users\" } }`" + `
+- Google Drive, Notion or Confluence documents, by URL or ID, converted to markdown: ` + "`input: { gdrive: <url> }`" + `, ` + "`input: { notion: [<url>, <url>] }`" + `, ` + "`input: { confluence: <url> }`" + ` (credentials under ` + "`connectors`" + ` in the env config)
+- Email messages and their attachments from an IMAP folder: ` + "`input: { email: { mailbox: support, unseen: true, subject: refund, since: 7d, limit: 20, mark_seen: true } }`" + ` (accounts under ` + "`mailboxes`" + ` in the env config; ` + "`mark_seen`" + ` marks messages as read only when the step succeeds)
+- Kafka and NATS messages, one value per line: ` + "`input: { kafka: { broker: events, topic: orders, group: triage, batch: 100, wait: 10s } }`" + ` or ` + "`input: { nats: { broker: bus, subject: orders.new, consumer: triage } }`" + `; publish a step's output with ` + "`output: { kafka: { broker: events, topic: reviews, split: lines } }`" + ` (brokers under ` + "`brokers`" + ` in the env config; consumed messages are acknowledged only when the run succeeds)
+- Jira and Linear issues with their comments: ` + "`input: { jira: { jql: \"project = ENG AND status = Open\", limit: 20 } }`" + `, ` + "`input: { jira: { issues: [ENG-1, ENG-2] } }`" + ` or ` + "`input: { linear: { team: ENG, state: Triage, label: bug } }`" + `; write the output back with ` + "`output: { jira: { action: create, project: ENG, type: Task } }`" + ` (first line is the title), ` + "`{ action: update, issue: ENG-1 }`" + ` (replaces the description) or ` + "`{ action: comment, issue: ENG-1 }`" + ` (credentials under ` + "`trackers`" + ` in the env config)
+- Calendar events from an ICS feed or Google Calendar, as one markdown agenda: ` + "`input: { calendar: { name: work, from: today, to: +1d, match: call } }`" + ` (calendars under ` + "`calendars`" + ` in the env config) or ` + "`{ ics: <url or file> }`" + ` / ` + "`{ google: primary }`" + `; ` + "`from`" + `/` + "`to`" + ` take now, today, tomorrow, offsets such as -7d or 12h, or dates; ` + "`split: events`" + ` saves a file per event and ` + "`template: '{{ .Start | date \"15:04\" }} {{ .Summary }}'`" + ` renders each event with a Go template
+- RSS and Atom feeds, new items only: ` + "`input: { feed: { urls: [https://example.com/feed.xml], since: 7d, match: security, limit: 10 } }`" + ` passes on the items no earlier successful run read, newest first, as one markdown digest (` + "`split: items`" + ` for a file per item); the step is skipped when nothing is new, and ` + "`key`" + ` names the store of read items
 - No input: ` + "`input: NA`" + `
 - Input with alias for variable: ` + "`input: path/to/file.txt as $my_var`" + `
 - List with aliases: ` + "`input: [file1.txt as $file1_content, file2.txt as $file2_content]`" + `
 
+### CSV Rows
+Add a ` + "`rows`" + ` block to a standard step to apply its action to every row of a CSV input (one file or STDIN), and output the CSV with the answers in new columns:
+
+` + "```" + `yaml
+classify_leads:
+  input: leads.csv
+  model: gpt-4o-mini
+  rows:
+    columns: [category, priority]  # optional: new columns; default is one named after the step
+    batch: 1                       # optional: rows per prompt (default 1)
+    parallel: 4                    # optional: prompts sent at once (default 4)
+    max_attempts: 3                # optional
+  action: "Classify the lead from {{ company }}: {{ notes }}"
+  output: leads_classified.csv
+` + "```" + `
+
+- ` + "`{{ column name }}`" + `: The row's value of that column (one row per prompt only). ` + "`{{ row }}`" + ` is the whole row, ` + "`{{ rows }}`" + ` the batch as CSV with a ` + "`row`" + ` number, and ` + "`{{ row_index }}`" + `/` + "`{{ total_rows }}`" + ` count rows from 1. Rows the action doesn't mention are added after it.
+- comanda tells the model how to answer: the value alone for one column, or JSON objects with the columns as keys. New columns replace input columns of the same name.
+- A prompt whose answer fails or lacks a column is retried; if it still fails the step fails, unless ` + "`skip_errors: true`" + `, which leaves its cells empty.
+- ` + "`rows`" + ` can't be combined with ` + "`chunk`" + ` or ` + "`ensemble`" + `, and needs one model.
+
+### Prompt Variants
+Add ` + "`variants`" + ` to a standard step to A/B test versions of its prompt. Each run uses one variant, picked in proportion to ` + "`weight`" + `, and records which in the run history:
+
+` + "```" + `yaml
+reply:
+  input: STDIN
+  model: gpt-4o-mini
+  variants:
+    - name: concise
+      action: "Answer the customer in two sentences."
+    - name: detailed
+      action: "Answer the customer step by step, quoting the relevant policy."
+      model: gpt-4o   # optional: replaces the step's model
+      weight: 2       # optional: share of runs (default 1)
+  output: STDOUT
+` + "```" + `
+
+- A variant replaces the step's ` + "`action`" + ` (which can then be omitted) and, if it sets one, its ` + "`model`" + `.
+- Variant names must be unique within the step; variants are only supported on standard steps, and can't set a model on an ensemble step.
+- ` + "`comanda process --variant reply=concise`" + ` forces a variant. ` + "`comanda eval`" + ` splits the dataset between variants by item ID and reports each variant's scores.
+
 ### Models
 - Single model: ` + "`model: gpt-4o-mini`" + `
 - No model (for non-LLM operations): ` + "`model: NA`" + `
 - Multiple models (for comparison): ` + "`model: [gpt-4o-mini, claude-3-opus-20240229]`" + `
+- Model alias: ` + "`model: support-bot`" + ` uses the model a ` + "`comanda models alias`" + ` (or ` + "`comanda finetune submit --alias`" + `) points it at, such as a fine-tuned model
+- Pin a provider when a model name is ambiguous: ` + "`provider: openai`" + ` (one of openai, anthropic, google, xai, deepseek, moonshot, ollama)
 - **IMPORTANT**: When specifying a model, you **must** use one of the supported models listed below. Do not use model names that are not in this list.
 
 ### Supported Models
@@ -451,13 +961,28 @@ step_name_for_processing:
 - Console: ` + "`output: STDOUT`" + `
 - File: ` + "`output: results.txt`" + `
 - Database: ` + "`output: { database: { type: \"postgres\", table: \"results_table\" } }`" + `
+- Spreadsheet: ` + "`output: report.xlsx`" + ` turns CSV or JSON output into a formatted, typed workbook; ` + "`output: { spreadsheet: { file: report.xlsx, sheet: Leads, columns: { score: integer, due: date } } }`" + ` sets column types (string, integer, number, boolean, date, datetime), and ` + "`output: { spreadsheet: { google_sheet: <sheet URL>, sheet: Leads } }`" + ` appends the rows to a Google Sheet
+- Webhook: ` + "`output: { webhook: { url: \"{{ env.HOOK_URL }}\", payload: '{\"summary\": {{ json .Output }}, \"score\": {{ .JSON.score }}}', secret: \"{{ env.HOOK_SECRET }}\" } }`" + ` posts a Go-templated JSON payload (` + "`.Output`" + `, ` + "`.JSON`" + ` for JSON output, ` + "`.Vars`" + `, ` + "`.Step`" + `, ` + "`.Time`" + `; ` + "`json`" + ` quotes a value) to Zapier, Make or any URL, signed with HMAC-SHA256 and retried
 - Output with alias (if supported for variable creation from output): ` + "`output: STDOUT as $step_output_var`" + `
 
+### Post-Processing
+- ` + "`postprocess: [extract_first_code_block, trim]`" + ` cleans the response before it is written out and passed to the next step.
+- Operations, applied in order: ` + "`strip_fences`" + `, ` + "`extract_first_code_block`" + `, ` + "`extract_last_code_block`" + `, ` + "`trim`" + `, ` + "`unescape_json`" + `.
+
 ## Variables
 - Definition: ` + "`input: data.txt as $initial_data`" + `
 - Reference: ` + "`action: \"Compare this analysis with $initial_data\"`" + `
 - Scope: Variables are typically scoped to the workflow. For ` + "`process`" + ` steps, parent variables are not directly accessible by default; use the ` + "`process.inputs`" + ` map to pass data.
 
+## Workflow Environment
+- Inline variables: a top-level ` + "`env:`" + ` map, e.g. ` + "`env: { REGION: us-east-1 }`" + `
+- File variables: a top-level ` + "`env_file: .env.workflow`" + ` (dotenv ` + "`KEY=VALUE`" + ` lines)
+- Reference: ` + "`action: \"Summarize the report for {{ env.REGION }}\"`" + `
+- ` + "`env`" + ` and ` + "`env_file`" + ` are reserved top-level keys and are not steps.
+
+## Run Time Limit
+- A top-level ` + "`max_duration: 30m`" + ` (a Go duration such as ` + "`90s`" + ` or ` + "`1h30m`" + `) stops the run once that time has passed, retries included. It is a reserved key, not a step.
+
 ## Validation Rules Summary (for LLM)
 
 1.  When specifying a model name, you **must** use one of the supported models listed in the "Supported Models" section. Do not use model names that are not explicitly listed as supported.
@@ -0,0 +1,244 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Ensemble merge strategies
+const (
+	EnsembleVote   = "vote"   // Majority vote over normalized (or structured) responses
+	EnsembleJudge  = "judge"  // A judge model picks the best response
+	EnsembleConcat = "concat" // All responses concatenated, e.g. for a later synthesis step
+)
+
+// EnsembleConfig configures a step that fans the same action out to several models
+type EnsembleConfig struct {
+	Strategy    string `yaml:"strategy"`     // "vote", "judge" or "concat"
+	JudgeModel  string `yaml:"judge_model"`  // Model used by the judge strategy
+	JudgeAction string `yaml:"judge_action"` // Optional custom instructions for the judge
+	Field       string `yaml:"field"`        // For vote: JSON field to vote on when responses are structured
+}
+
+// ensembleResponse holds a single model's answer within an ensemble
+type ensembleResponse struct {
+	model    string
+	response string
+	err      error
+}
+
+// validateEnsembleConfig checks an ensemble block for consistency
+func validateEnsembleConfig(cfg *EnsembleConfig, modelNames []string) []string {
+	var errors []string
+	switch cfg.Strategy {
+	case EnsembleVote, EnsembleConcat:
+	case EnsembleJudge:
+		if cfg.JudgeModel == "" {
+			errors = append(errors, "'judge_model' is required for the judge ensemble strategy")
+		}
+	case "":
+		errors = append(errors, "'strategy' is required within the 'ensemble' configuration")
+	default:
+		errors = append(errors, fmt.Sprintf("unknown ensemble strategy '%s' (expected vote, judge or concat)", cfg.Strategy))
+	}
+	if len(modelNames) < 2 {
+		errors = append(errors, "an ensemble step requires at least two models")
+	}
+	for _, m := range modelNames {
+		if m == "NA" {
+			errors = append(errors, "model NA cannot be used in an ensemble step")
+			break
+		}
+	}
+	return errors
+}
+
+// processEnsemble sends the actions to every model in parallel and merges the answers
+func (p *Processor) processEnsemble(step Step, modelNames []string, actions []string) (string, error) {
+	cfg := step.Config.Ensemble
+	p.debugf("Running ensemble step '%s' across %d models with strategy '%s'", step.Name, len(modelNames), cfg.Strategy)
+
+	results := make([]ensembleResponse, len(modelNames))
+	var wg sync.WaitGroup
+	for i, modelName := range modelNames {
+		wg.Add(1)
+		go func(i int, modelName string) {
+			defer wg.Done()
+			response, err := p.processActions(step.Name, []string{modelName}, actions)
+			results[i] = ensembleResponse{model: modelName, response: response, err: err}
+		}(i, modelName)
+	}
+	wg.Wait()
+
+	var succeeded []ensembleResponse
+	var failures []string
+	for _, r := range results {
+		if errors.Is(r.err, ErrStepSkipped) {
+			return "", ErrStepSkipped
+		}
+		if r.err != nil {
+			p.debugf("Ensemble model %s failed: %v", r.model, r.err)
+			failures = append(failures, fmt.Sprintf("%s: %v", r.model, r.err))
+			continue
+		}
+		succeeded = append(succeeded, r)
+	}
+	if len(succeeded) == 0 {
+		return "", fmt.Errorf("all ensemble models failed: %s", strings.Join(failures, "; "))
+	}
+	if len(failures) > 0 && !step.Config.SkipErrors {
+		return "", fmt.Errorf("ensemble models failed (set skip_errors to continue with the rest): %s", strings.Join(failures, "; "))
+	}
+
+	switch cfg.Strategy {
+	case EnsembleVote:
+		return p.ensembleVote(succeeded, cfg.Field)
+	case EnsembleJudge:
+		return p.ensembleJudge(succeeded, cfg, actions)
+	default:
+		return ensembleConcat(succeeded), nil
+	}
+}
+
+// ensembleVote returns the most common answer. Ties go to the model listed first.
+func (p *Processor) ensembleVote(responses []ensembleResponse, field string) (string, error) {
+	counts := make(map[string]int)
+	firstSeen := make(map[string]int)
+	for i, r := range responses {
+		key, err := voteKey(r.response, field)
+		if err != nil {
+			return "", fmt.Errorf("response from %s: %w", r.model, err)
+		}
+		counts[key]++
+		if _, ok := firstSeen[key]; !ok {
+			firstSeen[key] = i
+		}
+	}
+
+	bestKey := ""
+	bestCount := 0
+	for key, count := range counts {
+		if count > bestCount || (count == bestCount && firstSeen[key] < firstSeen[bestKey]) {
+			bestKey, bestCount = key, count
+		}
+	}
+	winner := responses[firstSeen[bestKey]]
+	p.debugf("Ensemble vote: %d/%d models agreed (first: %s)", bestCount, len(responses), winner.model)
+	return winner.response, nil
+}
+
+// voteKey normalizes a response for comparison. JSON responses are compared
+// structurally (or by a single field); plain text is compared case-insensitively.
+func voteKey(response, field string) (string, error) {
+	trimmed := strings.TrimSpace(stripCodeFence(response))
+
+	var structured interface{}
+	if err := json.Unmarshal([]byte(trimmed), &structured); err == nil {
+		if field != "" {
+			obj, ok := structured.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("vote field '%s' requires a JSON object response", field)
+			}
+			value, ok := obj[field]
+			if !ok {
+				return "", fmt.Errorf("vote field '%s' missing from response", field)
+			}
+			structured = value
+		}
+		canonical, err := json.Marshal(structured)
+		if err != nil {
+			return "", err
+		}
+		return strings.ToLower(string(canonical)), nil
+	}
+
+	if field != "" {
+		return "", fmt.Errorf("vote field '%s' requires a JSON response", field)
+	}
+	return strings.ToLower(strings.Join(strings.Fields(trimmed), " ")), nil
+}
+
+// stripCodeFence removes a surrounding markdown code fence if present
+func stripCodeFence(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") || len(trimmed) < 6 {
+		return s
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(trimmed, "```"), "```")
+	// Drop the language identifier on the opening line
+	if idx := strings.Index(inner, "\n"); idx >= 0 && !strings.ContainsAny(inner[:idx], "{[\"") {
+		inner = inner[idx+1:]
+	}
+	return inner
+}
+
+// ensembleJudge asks the judge model to select the best candidate
+func (p *Processor) ensembleJudge(responses []ensembleResponse, cfg *EnsembleConfig, actions []string) (string, error) {
+	if err := p.validateModel([]string{cfg.JudgeModel}, nil); err != nil {
+		return "", fmt.Errorf("judge model validation failed: %w", err)
+	}
+	if err := p.configureProviders(); err != nil {
+		return "", fmt.Errorf("judge provider configuration failed: %w", err)
+	}
+	provider := p.GetModelProvider(cfg.JudgeModel)
+	if provider == nil {
+		return "", fmt.Errorf("provider not configured for judge model %s", cfg.JudgeModel)
+	}
+
+	instructions := cfg.JudgeAction
+	if instructions == "" {
+		instructions = "Pick the candidate response that best fulfils the task. Consider correctness, completeness and adherence to the requested format."
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString(fmt.Sprintf("Task given to each candidate:\n%s\n\n", strings.Join(actions, "\n")))
+	for i, r := range responses {
+		prompt.WriteString(fmt.Sprintf("--- Candidate %d ---\n%s\n\n", i+1, r.response))
+	}
+	prompt.WriteString(instructions)
+	prompt.WriteString("\n\nReply with only the number of the best candidate.")
+
+	verdict, err := provider.SendPrompt(cfg.JudgeModel, prompt.String())
+	if err != nil {
+		return "", fmt.Errorf("judge model %s failed: %w", cfg.JudgeModel, err)
+	}
+
+	choice := parseJudgeChoice(verdict, len(responses))
+	if choice < 0 {
+		return "", fmt.Errorf("judge model %s returned an unusable verdict: %s", cfg.JudgeModel, truncate(verdict, 100))
+	}
+	p.debugf("Judge %s selected candidate %d (%s)", cfg.JudgeModel, choice+1, responses[choice].model)
+	return responses[choice].response, nil
+}
+
+// parseJudgeChoice extracts the first candidate number in range from a verdict
+func parseJudgeChoice(verdict string, candidates int) int {
+	for _, token := range strings.FieldsFunc(verdict, func(r rune) bool { return r < '0' || r > '9' }) {
+		n, err := strconv.Atoi(token)
+		if err == nil && n >= 1 && n <= candidates {
+			return n - 1
+		}
+	}
+	return -1
+}
+
+// ensembleConcat joins every response, labelled by model
+func ensembleConcat(responses []ensembleResponse) string {
+	parts := make([]string, len(responses))
+	for i, r := range responses {
+		parts[i] = fmt.Sprintf("Response from %s:\n%s", r.model, r.response)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// truncate shortens s to at most n characters for error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnsembleVote(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+
+	tests := []struct {
+		name      string
+		responses []ensembleResponse
+		field     string
+		want      string
+		expectErr bool
+	}{
+		{
+			name: "plain text majority ignores case and whitespace",
+			responses: []ensembleResponse{
+				{model: "a", response: "Positive"},
+				{model: "b", response: "negative"},
+				{model: "c", response: " positive\n"},
+			},
+			want: "Positive",
+		},
+		{
+			name: "tie goes to first model",
+			responses: []ensembleResponse{
+				{model: "a", response: "yes"},
+				{model: "b", response: "no"},
+			},
+			want: "yes",
+		},
+		{
+			name: "structured responses compared by field",
+			responses: []ensembleResponse{
+				{model: "a", response: `{"label": "spam", "confidence": 0.9}`},
+				{model: "b", response: "```json\n{\"label\": \"ham\"}\n```"},
+				{model: "c", response: `{"confidence": 0.6, "label": "ham"}`},
+			},
+			field: "label",
+			want:  "```json\n{\"label\": \"ham\"}\n```",
+		},
+		{
+			name: "field on non-JSON response",
+			responses: []ensembleResponse{
+				{model: "a", response: "spam"},
+				{model: "b", response: "ham"},
+			},
+			field:     "label",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := proc.ensembleVote(tt.responses, tt.field)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ensembleVote() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !tt.expectErr && got != tt.want {
+				t.Errorf("ensembleVote() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJudgeChoice(t *testing.T) {
+	tests := []struct {
+		verdict string
+		want    int
+	}{
+		{"2", 1},
+		{"Candidate 3 is best.", 2},
+		{"The best is 7, no wait, 1", 0},
+		{"none of them", -1},
+	}
+	for _, tt := range tests {
+		if got := parseJudgeChoice(tt.verdict, 3); got != tt.want {
+			t.Errorf("parseJudgeChoice(%q) = %d, want %d", tt.verdict, got, tt.want)
+		}
+	}
+}
+
+func TestValidateEnsembleConfig(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+
+	base := StepConfig{
+		Input:  "NA",
+		Model:  []string{"gpt-4o", "claude-3-5-sonnet-latest"},
+		Action: "classify",
+		Output: "STDOUT",
+	}
+
+	valid := base
+	valid.Ensemble = &EnsembleConfig{Strategy: EnsembleVote}
+	if err := proc.validateStepConfig("valid", valid); err != nil {
+		t.Errorf("unexpected error for valid ensemble: %v", err)
+	}
+
+	missingJudge := base
+	missingJudge.Ensemble = &EnsembleConfig{Strategy: EnsembleJudge}
+	if err := proc.validateStepConfig("judge", missingJudge); err == nil || !strings.Contains(err.Error(), "judge_model") {
+		t.Errorf("expected judge_model error, got %v", err)
+	}
+
+	singleModel := base
+	singleModel.Model = "gpt-4o"
+	singleModel.Ensemble = &EnsembleConfig{Strategy: EnsembleConcat}
+	if err := proc.validateStepConfig("single", singleModel); err == nil || !strings.Contains(err.Error(), "at least two models") {
+		t.Errorf("expected model count error, got %v", err)
+	}
+}
+
+func TestProcessEnsembleConcat(t *testing.T) {
+	cfg := &DSLConfig{
+		Steps: []Step{
+			{
+				Name: "ensemble_step",
+				Config: StepConfig{
+					Input:    "NA",
+					Model:    []string{"gpt-4o", "claude-3-5-sonnet-latest"},
+					Action:   "say something",
+					Output:   "STDOUT",
+					Ensemble: &EnsembleConfig{Strategy: EnsembleConcat},
+				},
+			},
+		},
+	}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	output := proc.LastOutput()
+	for _, model := range []string{"gpt-4o", "claude-3-5-sonnet-latest"} {
+		if !strings.Contains(output, "Response from "+model) {
+			t.Errorf("expected concatenated output to include %s, got %q", model, output)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/secrets"
+)
+
+// envPlaceholderPattern matches {{ env.NAME }} placeholders in actions and instructions
+var envPlaceholderPattern = regexp.MustCompile(`\{\{\s*env\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// loadWorkflowEnv reads the workflow's env_file (if any) and merges the inline
+// env map on top of it. Values are never logged, only variable names, and
+// are registered as secrets so logs that include them are redacted.
+func (p *Processor) loadWorkflowEnv() error {
+	env := make(map[string]string)
+	fileEnv := make(map[string]string)
+
+	if p.config.EnvFile != "" {
+		envFilePath, err := p.confinePath(p.config.EnvFile)
+		if err != nil {
+			return fmt.Errorf("env_file rejected: %w", err)
+		}
+		parsed, err := parseEnvFile(envFilePath)
+		if err != nil {
+			return err
+		}
+		fileEnv = parsed
+		for name, value := range fileEnv {
+			env[name] = value
+		}
+		p.debugf("Loaded %d variable(s) from env_file %s: %s", len(fileEnv), p.config.EnvFile, strings.Join(sortedKeys(fileEnv), ", "))
+	}
+
+	for name, value := range p.config.Env {
+		// Inline values may reference the process environment or env_file values
+		env[name] = os.Expand(value, func(ref string) string {
+			if v, ok := fileEnv[ref]; ok {
+				return v
+			}
+			return os.Getenv(ref)
+		})
+	}
+	if len(p.config.Env) > 0 {
+		p.debugf("Loaded %d inline env variable(s): %s", len(p.config.Env), strings.Join(sortedKeys(p.config.Env), ", "))
+	}
+
+	// Values such as vault://secret/data/ci#token are fetched from their
+	// secret manager
+	for _, name := range sortedKeys(env) {
+		if !config.IsSecretRef(env[name]) {
+			continue
+		}
+		value, err := secrets.Default().Resolve(p.context(), env[name])
+		if err != nil {
+			return fmt.Errorf("error resolving env variable %s: %w", name, err)
+		}
+		env[name] = value
+		p.debugf("Resolved env variable %s from its secret manager", name)
+	}
+
+	// Values are redacted from logs, since actions that use them are logged
+	// after substitution
+	for _, value := range env {
+		config.AddSecret(value)
+	}
+
+	p.workflowEnv = env
+	return nil
+}
+
+// parseEnvFile parses a dotenv-style file of KEY=VALUE lines. Blank lines,
+// comments, an optional "export " prefix and surrounding quotes are handled.
+func parseEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening env_file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid line %d in env_file %s: expected KEY=VALUE", lineNum, path)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("invalid line %d in env_file %s: empty variable name", lineNum, path)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if idx := strings.Index(value, " #"); idx >= 0 {
+			// Strip trailing comments from unquoted values
+			value = strings.TrimSpace(value[:idx])
+		}
+		env[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading env_file %s: %w", path, err)
+	}
+	return env, nil
+}
+
+// lookupEnv returns a workflow env value, falling back to the process environment
+func (p *Processor) lookupEnv(name string) (string, bool) {
+	if value, ok := p.workflowEnv[name]; ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// interpolateEnv replaces {{ env.NAME }} placeholders with their values.
+// Unknown names are left untouched so typos stay visible.
+func (p *Processor) interpolateEnv(text string) string {
+	if !strings.Contains(text, "env.") {
+		return text
+	}
+	return envPlaceholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := envPlaceholderPattern.FindStringSubmatch(match)[1]
+		if value, ok := p.lookupEnv(name); ok {
+			return value
+		}
+		p.debugf("Env placeholder '%s' has no value", name)
+		return match
+	})
+}
+
+// Environ returns the process environment with workflow env variables
+// applied, for steps that launch subprocesses or build outbound requests
+func (p *Processor) Environ() []string {
+	environ := os.Environ()
+	for _, name := range sortedKeys(p.workflowEnv) {
+		environ = append(environ, name+"="+p.workflowEnv[name])
+	}
+	return environ
+}
+
+// sortedKeys returns the keys of a string map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/secrets"
+)
+
+func TestUnmarshalYAMLWithEnv(t *testing.T) {
+	yamlContent := `
+env_file: .env.workflow
+env:
+  REGION: us-east-1
+summarize:
+  input: NA
+  model: NA
+  action: "Summarize for {{ env.REGION }}"
+  output: STDOUT
+`
+	var cfg DSLConfig
+	if err := yaml.Unmarshal([]byte(yamlContent), &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if cfg.EnvFile != ".env.workflow" {
+		t.Errorf("EnvFile = %q, want .env.workflow", cfg.EnvFile)
+	}
+	if cfg.Env["REGION"] != "us-east-1" {
+		t.Errorf("Env[REGION] = %q, want us-east-1", cfg.Env["REGION"])
+	}
+	if len(cfg.Steps) != 1 || cfg.Steps[0].Name != "summarize" {
+		t.Errorf("expected env sections not to be parsed as steps, got %+v", cfg.Steps)
+	}
+}
+
+func TestLoadWorkflowEnv(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "workflow.env")
+	content := strings.Join([]string{
+		"# comment",
+		"export API_HOST=api.example.com",
+		`QUOTED="hello world"`,
+		"TRAILING=value # note",
+		"",
+	}, "\n")
+	if err := os.WriteFile(envFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &DSLConfig{
+		EnvFile: envFile,
+		Env: map[string]string{
+			"ENDPOINT": "https://${API_HOST}/v1",
+			"QUOTED":   "override",
+		},
+	}
+	proc := NewProcessor(cfg, createTestEnvConfig(), nil, false)
+	if err := proc.loadWorkflowEnv(); err != nil {
+		t.Fatalf("loadWorkflowEnv() error = %v", err)
+	}
+
+	expected := map[string]string{
+		"API_HOST": "api.example.com",
+		"QUOTED":   "override",
+		"TRAILING": "value",
+		"ENDPOINT": "https://api.example.com/v1",
+	}
+	for name, want := range expected {
+		if got := proc.workflowEnv[name]; got != want {
+			t.Errorf("workflowEnv[%s] = %q, want %q", name, got, want)
+		}
+	}
+
+	got := proc.substituteVariables("Call {{ env.ENDPOINT }} and {{env.MISSING_VAR_XYZ}}")
+	want := "Call https://api.example.com/v1 and {{env.MISSING_VAR_XYZ}}"
+	if got != want {
+		t.Errorf("substituteVariables() = %q, want %q", got, want)
+	}
+}
+
+// mapSecrets is a secret manager holding the secrets of a map
+type mapSecrets map[string]string
+
+func (m mapSecrets) Fetch(ctx context.Context, path string) (*secrets.Secret, error) {
+	value, ok := m[path]
+	if !ok {
+		return nil, fmt.Errorf("no secret at %s", path)
+	}
+	return &secrets.Secret{Value: value}, nil
+}
+
+func TestLoadWorkflowEnvSecretRefs(t *testing.T) {
+	resolver := secrets.New(config.SecretsConfig{})
+	resolver.Use("vault", mapSecrets{"secret/data/ci": `{"token":"ci-token-123"}`})
+	secrets.SetDefault(resolver)
+	t.Cleanup(func() { secrets.SetDefault(nil) })
+
+	cfg := &DSLConfig{Env: map[string]string{
+		"CI_TOKEN": "vault://secret/data/ci#token",
+		"REGION":   "us-east-1",
+	}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), nil, false)
+	if err := proc.loadWorkflowEnv(); err != nil {
+		t.Fatalf("loadWorkflowEnv() error = %v", err)
+	}
+	if got := proc.workflowEnv["CI_TOKEN"]; got != "ci-token-123" {
+		t.Errorf("workflowEnv[CI_TOKEN] = %q, want ci-token-123", got)
+	}
+	if got := proc.workflowEnv["REGION"]; got != "us-east-1" {
+		t.Errorf("workflowEnv[REGION] = %q, want us-east-1", got)
+	}
+
+	cfg.Env["CI_TOKEN"] = "vault://secret/data/missing#token"
+	err := proc.loadWorkflowEnv()
+	if err == nil || !strings.Contains(err.Error(), "error resolving env variable CI_TOKEN") {
+		t.Errorf("loadWorkflowEnv() error = %v, want one naming CI_TOKEN", err)
+	}
+}
+
+func TestParseEnvFileInvalidLine(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "bad.env")
+	if err := os.WriteFile(envFile, []byte("NOT_AN_ASSIGNMENT\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseEnvFile(envFile); err == nil {
+		t.Error("parseEnvFile() expected error for line without '='")
+	}
+}
+
+func TestWorkflowEnvRedacted(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "workflow.env")
+	if err := os.WriteFile(envFile, []byte("HOOK_TOKEN=tok-file-3f9a1c77\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &DSLConfig{
+		EnvFile: envFile,
+		Env:     map[string]string{"API_TOKEN": "tok-inline-81d2e4b0"},
+	}
+	proc := NewProcessor(cfg, createTestEnvConfig(), nil, false)
+	if err := proc.loadWorkflowEnv(); err != nil {
+		t.Fatalf("loadWorkflowEnv() error = %v", err)
+	}
+
+	var logged bytes.Buffer
+	config.SetLogOutput(&logged)
+	defer config.SetLogOutput(nil)
+	action := proc.substituteVariables("Post with {{ env.HOOK_TOKEN }} and {{ env.API_TOKEN }}")
+	proc.debugf("Processing action %d/%d: %s", 1, 1, action)
+
+	for _, secret := range []string{"tok-file-3f9a1c77", "tok-inline-81d2e4b0"} {
+		if strings.Contains(logged.String(), secret) {
+			t.Errorf("debug log contains %q: %s", secret, logged.String())
+		}
+	}
+	if !strings.Contains(logged.String(), "Post with *** and ***") {
+		t.Errorf("debug log = %q, want the values redacted", logged.String())
+	}
+}
@@ -0,0 +1,330 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// DefaultExplainOutputTokens is the response size assumed for steps without
+// max_output_tokens
+const DefaultExplainOutputTokens = 1000
+
+// documentBytesPerToken estimates the text in PDF and Word files, whose
+// size is mostly markup and compressed streams
+const documentBytesPerToken = 6
+
+// Context window usage above which a step is reported as near the limit
+const contextWarnRatio = 0.8
+
+// Context window checks
+const (
+	ContextOK      = "ok"
+	ContextNear    = "near limit"
+	ContextExceeds = "exceeds"
+	ContextUnknown = "unknown"
+)
+
+// ExplainOptions tunes the estimates of Explain
+type ExplainOptions struct {
+	OutputTokens int    // Response size assumed for steps without max_output_tokens
+	Stdin        string // Input piped to the workflow, if any
+	StdinTokens  int    // Estimated tokens of piped input too large to pass as Stdin
+}
+
+// StepEstimate is the estimated size and cost of one model's calls in a step
+type StepEstimate struct {
+	Step          string   `json:"step"`
+	Group         string   `json:"group,omitempty"` // Parallel group or "defer"
+	Model         string   `json:"model"`
+	Requests      int      `json:"requests"`       // Model calls, more than one in individual batch mode
+	PromptTokens  int      `json:"prompt_tokens"`  // Across all requests
+	LargestPrompt int      `json:"largest_prompt"` // Largest single request, checked against the context window
+	OutputTokens  int      `json:"output_tokens"`  // Assumed, across all requests
+	Cost          float64  `json:"cost"`
+	Priced        bool     `json:"priced"`
+	ContextWindow int      `json:"context_window,omitempty"`
+	Context       string   `json:"context"`
+	Notes         []string `json:"notes,omitempty"`
+}
+
+// explainState carries estimated output sizes from step to step
+type explainState struct {
+	opts    ExplainOptions
+	last    explainText    // The previous step's output, or the piped input
+	outputs map[string]int // Estimated tokens of files written by earlier steps
+}
+
+// Explain estimates the prompt size, cost and context window use of every
+// model call in the workflow without running anything. Step outputs are
+// assumed to be opts.OutputTokens long, or max_output_tokens when set.
+func (p *Processor) Explain(opts ExplainOptions) []StepEstimate {
+	if opts.OutputTokens <= 0 {
+		opts.OutputTokens = DefaultExplainOutputTokens
+	}
+	state := &explainState{opts: opts, last: explainText{content: opts.Stdin, fixed: opts.StdinTokens}, outputs: make(map[string]int)}
+
+	groups := make(map[string]string)
+	for name, steps := range p.config.ParallelSteps {
+		for _, step := range steps {
+			groups[step.Name] = name
+		}
+	}
+	for name := range p.config.Defer {
+		groups[name] = "defer"
+	}
+
+	var estimates []StepEstimate
+	for i, step := range p.workflowSteps() {
+		stepEstimates, outputTokens := p.explainStep(step, state, i == 0)
+		for j := range stepEstimates {
+			stepEstimates[j].Group = groups[step.Name]
+		}
+		estimates = append(estimates, stepEstimates...)
+
+		if outputTokens > 0 {
+			state.last = explainText{fixed: outputTokens}
+			for _, output := range p.NormalizeStringSlice(step.Config.Output) {
+				if output != "STDOUT" {
+					state.outputs[output] = outputTokens
+				}
+			}
+		}
+	}
+	return estimates
+}
+
+// explainStep estimates one step for each of its models, and returns the
+// assumed size of its output
+func (p *Processor) explainStep(step Step, state *explainState, first bool) ([]StepEstimate, int) {
+	cfg := step.Config
+	modelNames := p.stepModels(cfg)
+	if cfg.Process != nil {
+		return []StepEstimate{{Step: step.Name, Model: "-", Context: ContextUnknown, Notes: []string{"sub-workflow not estimated; run explain on " + cfg.Process.WorkflowFile}}}, 0
+	}
+	if len(modelNames) == 0 {
+		return nil, 0
+	}
+
+	actions := p.NormalizeStringSlice(cfg.Action)
+	inputs := p.NormalizeStringSlice(cfg.Input)
+	if cfg.Generate != nil {
+		actions = p.NormalizeStringSlice(cfg.Generate.Action)
+		inputs = cfg.Generate.ContextFiles
+	}
+	// Runs use one prompt variant; estimate with the longest
+	for _, v := range cfg.Variants {
+		if variant := p.NormalizeStringSlice(v.Action); len(strings.Join(variant, "\n")) > len(strings.Join(actions, "\n")) {
+			actions = variant
+		}
+	}
+	instructions := p.interpolateEnv(strings.Join(actions, "\n") + "\n" + cfg.Instructions)
+
+	outputTokens := state.opts.OutputTokens
+	if cfg.MaxOutputTokens > 0 {
+		outputTokens = cfg.MaxOutputTokens
+	}
+
+	texts, fixedTokens, notes := p.explainInputs(inputs, state, first)
+	individual := cfg.BatchMode == "individual" && len(texts) > 1
+	switch {
+	case cfg.Agent != nil:
+		notes = append(notes, "agent steps call the model repeatedly; the estimate covers the first call")
+	case cfg.Chunk != nil:
+		notes = append(notes, "input is chunked; each chunk is a separate request")
+	case cfg.Rows != nil:
+		notes = append(notes, "each CSV row or batch of rows is a separate request; the estimate covers the whole file in one")
+	}
+	if len(cfg.Variants) > 0 {
+		notes = append(notes, fmt.Sprintf("each run uses one of %d prompt variants; the estimate uses the longest", len(cfg.Variants)))
+	}
+
+	var estimates []StepEstimate
+	var ensembleOutputs int
+	for _, model := range modelNames {
+		est := StepEstimate{Step: step.Name, Model: model, Requests: 1, Notes: notes}
+		base := models.CountTokens(model, instructions)
+		judge := cfg.Ensemble != nil && model == cfg.Ensemble.JudgeModel
+
+		switch {
+		case judge:
+			// The judge reads every ensemble answer
+			est.PromptTokens = base + ensembleOutputs
+			est.LargestPrompt = est.PromptTokens
+		case individual:
+			est.Requests = len(texts)
+			for _, text := range texts {
+				size := base + fixedTokens + text.tokens(model)
+				est.PromptTokens += size
+				if size > est.LargestPrompt {
+					est.LargestPrompt = size
+				}
+			}
+		default:
+			est.PromptTokens = base + fixedTokens
+			for _, text := range texts {
+				est.PromptTokens += text.tokens(model)
+			}
+			est.LargestPrompt = est.PromptTokens
+		}
+		if cfg.Ensemble != nil && !judge {
+			ensembleOutputs += outputTokens
+		}
+
+		est.OutputTokens = outputTokens * est.Requests
+		est.Cost, est.Priced = models.EstimateCost(model, est.PromptTokens, est.OutputTokens)
+		if provider := p.detectProvider(model); provider != nil && provider.Name() == "ollama" {
+			est.Priced = true // Local models cost nothing
+		}
+		est.ContextWindow, est.Context = contextCheck(model, est.LargestPrompt+outputTokens)
+		if cfg.Chunk != nil && est.Context != ContextUnknown {
+			est.Context = ContextOK
+		}
+		estimates = append(estimates, est)
+	}
+	return estimates, outputTokens
+}
+
+// explainText is an input whose tokens depend on the model's tokenizer
+type explainText struct {
+	content string
+	fixed   int // Tokens known without tokenizing, e.g. earlier step outputs
+}
+
+func (t explainText) tokens(model string) int {
+	if t.content == "" {
+		return t.fixed
+	}
+	return models.CountTokens(model, t.content) + t.fixed
+}
+
+// explainInputs reads a step's inputs. It returns one text per input file,
+// the tokens of inputs that don't depend on the model, such as images, and
+// notes about inputs that could not be measured.
+func (p *Processor) explainInputs(inputs []string, state *explainState, first bool) ([]explainText, int, []string) {
+	var texts []explainText
+	var fixed int
+	var notes []string
+	for _, in := range inputs {
+		in, _ = p.parseVariableAssignment(in)
+		switch {
+		case in == "" || in == "NA":
+		case strings.HasPrefix(in, "STDIN"):
+			if first && state.last.content == "" {
+				notes = append(notes, "STDIN: nothing piped, counted as empty")
+			}
+			texts = append(texts, state.last)
+		case in == "screenshot":
+			fixed += models.ImageTokens
+		case p.isURL(in):
+			notes = append(notes, fmt.Sprintf("%s: URL content not fetched", in))
+		default:
+			if tokens, ok := state.producedBy(in); ok {
+				texts = append(texts, explainText{fixed: tokens})
+				continue
+			}
+			files, err := p.explainFiles(in)
+			if err != nil || len(files) == 0 {
+				notes = append(notes, fmt.Sprintf("%s: not found", in))
+				continue
+			}
+			for _, file := range files {
+				text, tokens, note := p.explainFile(file)
+				if note != "" {
+					notes = append(notes, note)
+				}
+				if tokens > 0 {
+					fixed += tokens
+				} else {
+					texts = append(texts, explainText{content: text})
+				}
+			}
+		}
+	}
+	return texts, fixed, notes
+}
+
+// producedBy returns the estimated size of a file written by an earlier step
+func (s *explainState) producedBy(path string) (int, bool) {
+	if tokens, ok := s.outputs[path]; ok {
+		return tokens, true
+	}
+	if !strings.ContainsAny(path, "*?[") {
+		return 0, false
+	}
+	total, found := 0, false
+	for output, tokens := range s.outputs {
+		if globMatch(path, output) {
+			total += tokens
+			found = true
+		}
+	}
+	return total, found
+}
+
+// explainFiles resolves an input path or glob to files
+func (p *Processor) explainFiles(path string) ([]string, error) {
+	resolved := path
+	if p.runtimeDir != "" && !filepath.IsAbs(path) {
+		resolved = filepath.Join(p.runtimeDir, path)
+	}
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(resolved)
+		sort.Strings(matches)
+		return matches, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{resolved}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(resolved, func(file string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, file)
+		}
+		return err
+	})
+	return files, err
+}
+
+// explainFile returns a text file's contents, or the fixed token estimate
+// and a note for images and documents
+func (p *Processor) explainFile(path string) (string, int, string) {
+	if p.validator.IsImageFile(path) {
+		return "", models.ImageTokens, ""
+	}
+	if p.validator.IsDocumentFile(path) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", 0, fmt.Sprintf("%s: %v", path, err)
+		}
+		tokens := int(info.Size()) / documentBytesPerToken
+		return "", max(tokens, 1), fmt.Sprintf("%s: estimated from file size", filepath.Base(path))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", 0, fmt.Sprintf("%s: %v", path, err)
+	}
+	return string(data), 0, ""
+}
+
+// contextCheck compares a request's size with the model's context window
+func contextCheck(model string, tokens int) (int, string) {
+	window, ok := models.ContextWindow(model)
+	switch {
+	case !ok:
+		return 0, ContextUnknown
+	case tokens > window:
+		return window, ContextExceeds
+	case float64(tokens) > contextWarnRatio*float64(window):
+		return window, ContextNear
+	}
+	return window, ContextOK
+}
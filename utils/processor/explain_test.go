@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte(strings.Repeat("The meeting covered the quarterly roadmap.\n", 500)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &DSLConfig{Steps: []Step{
+		{Name: "summarize", Config: StepConfig{Input: notes, Model: []interface{}{"gpt-4o", "claude-3-5-sonnet-latest"}, Action: "Summarize", Output: "summary.md"}},
+		{Name: "review", Config: StepConfig{Input: "summary.md", Model: "moonshot-v1-8k", Action: "Review", Output: "STDOUT", MaxOutputTokens: 7500}},
+		{Name: "publish", Config: StepConfig{Input: "STDIN", Model: "gpt-4o-mini", Action: "Format", Output: "STDOUT"}},
+	}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	estimates := proc.Explain(ExplainOptions{OutputTokens: 500})
+	if len(estimates) != 4 {
+		t.Fatalf("Explain() returned %d estimates, want 4: %+v", len(estimates), estimates)
+	}
+
+	gpt, claude := estimates[0], estimates[1]
+	if gpt.PromptTokens < 3500 || gpt.PromptTokens > 6000 {
+		t.Errorf("gpt-4o prompt tokens = %d, expected about 4500", gpt.PromptTokens)
+	}
+	if claude.PromptTokens <= gpt.PromptTokens {
+		t.Errorf("expected Claude's tokenizer to count more tokens: %d <= %d", claude.PromptTokens, gpt.PromptTokens)
+	}
+	if !gpt.Priced || gpt.Cost <= 0 || gpt.OutputTokens != 500 || gpt.Context != ContextOK {
+		t.Errorf("unexpected gpt-4o estimate: %+v", gpt)
+	}
+
+	// The review step reads the summary written by the first step
+	review := estimates[2]
+	if review.PromptTokens < 500 || review.PromptTokens > 520 {
+		t.Errorf("review prompt tokens = %d, expected the assumed summary size", review.PromptTokens)
+	}
+	if review.Context != ContextNear {
+		t.Errorf("review context = %q, want %q", review.Context, ContextNear)
+	}
+	if publish := estimates[3]; publish.PromptTokens < 7500 {
+		t.Errorf("publish prompt tokens = %d, expected the review's max_output_tokens", publish.PromptTokens)
+	}
+}
+
+func TestExplainBatchAndMissingInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat("word ", 100)), 0644)
+	}
+	cfg := &DSLConfig{Steps: []Step{
+		{Name: "each", Config: StepConfig{Input: filepath.Join(dir, "*.txt"), Model: "gpt-4o", Action: "Tag", Output: "STDOUT", BatchMode: "individual"}},
+		{Name: "web", Config: StepConfig{Input: []interface{}{"https://example.com/page", "missing.txt"}, Model: "gpt-4o", Action: "Read", Output: "STDOUT"}},
+	}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	estimates := proc.Explain(ExplainOptions{})
+
+	each := estimates[0]
+	if each.Requests != 2 || each.OutputTokens != 2*DefaultExplainOutputTokens || each.LargestPrompt >= each.PromptTokens {
+		t.Errorf("unexpected individual batch estimate: %+v", each)
+	}
+	notes := strings.Join(estimates[1].Notes, "\n")
+	if !strings.Contains(notes, "URL content not fetched") || !strings.Contains(notes, "missing.txt: not found") {
+		t.Errorf("missing notes: %v", estimates[1].Notes)
+	}
+}
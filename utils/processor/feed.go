@@ -0,0 +1,192 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/connectors"
+	"github.com/kris-hansen/comanda/utils/feed"
+)
+
+// fetchFeed reads a feed; tests replace it
+var fetchFeed = feed.Fetch
+
+// DefaultFeedLimit is how many new items a feed input reads per run when
+// it sets no limit
+const DefaultFeedLimit = 20
+
+// feedInput is the feed map of a step's input
+type feedInput struct {
+	urls  []string
+	key   string // Name of the store of items already read
+	limit int
+	since time.Time
+	match string // Title or content substring, case-insensitive
+	split bool   // One file per item rather than a digest
+}
+
+// parseFeedInput reads a feed input map, such as
+// {urls: [https://example.com/feed.xml], since: 7d, limit: 10}
+func parseFeedInput(stepName string, spec map[string]interface{}) (feedInput, error) {
+	in := feedInput{limit: DefaultFeedLimit}
+	in.urls = append(specStrings(spec, "url"), specStrings(spec, "urls")...)
+	if len(in.urls) == 0 {
+		return in, fmt.Errorf("feed input needs a url or urls")
+	}
+	for _, u := range in.urls {
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			return in, fmt.Errorf("invalid feed URL %q: use an http or https URL", u)
+		}
+	}
+	in.match, _ = spec["match"].(string)
+	if v, ok := spec["limit"]; ok {
+		limit, ok := v.(int)
+		if !ok || limit <= 0 {
+			return in, fmt.Errorf("feed input limit must be positive")
+		}
+		in.limit = limit
+	}
+	if since, ok := spec["since"].(string); ok && since != "" {
+		t, err := parseSince(since, time.Now())
+		if err != nil {
+			return in, err
+		}
+		in.since = t
+	}
+	if split, _ := spec["split"].(string); split != "" {
+		if split != "items" {
+			return in, fmt.Errorf("invalid feed split %q (expected items)", split)
+		}
+		in.split = true
+	}
+	if in.key, _ = spec["key"].(string); in.key == "" {
+		urls := append([]string(nil), in.urls...)
+		sort.Strings(urls)
+		sum := sha256.Sum256([]byte(stepName + "\n" + strings.Join(urls, "\n")))
+		in.key = "feed-" + hex.EncodeToString(sum[:6])
+	}
+	return in, nil
+}
+
+// fetchFeedInputs reads the items of a feed input's feeds that no earlier
+// run read, newest first, and saves them in a temporary directory. It
+// returns no paths when there are no new items. The items are recorded as
+// read when the run succeeds.
+func (p *Processor) fetchFeedInputs(stepName string, spec map[string]interface{}) ([]string, func(), error) {
+	in, err := parseFeedInput(stepName, spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := p.openSeen(in.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type newItem struct {
+		feed.Item
+		seenID string
+	}
+	var items []newItem
+	var failed []string
+	var firstErr error
+	match := strings.ToLower(in.match)
+	for _, u := range in.urls {
+		p.debugf("Fetching feed %s for step %s", u, stepName)
+		data, err := fetchFeed(p.context(), u)
+		var parsed []feed.Item
+		if err == nil {
+			parsed, err = feed.Parse(data)
+		}
+		if err != nil {
+			// One feed being down shouldn't hold back the others
+			config.WriteLog("[RUN] ", "Feed %s skipped in step %s: %v", u, stepName, err)
+			p.debugf("Error reading feed %s: %v", u, err)
+			failed = append(failed, u)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("feed %s: %w", u, err)
+			}
+			continue
+		}
+		for _, item := range parsed {
+			id := u + " " + item.ID
+			switch {
+			case store.Has(id):
+			case !in.since.IsZero() && !item.Published.IsZero() && item.Published.Before(in.since):
+			case match != "" && !strings.Contains(strings.ToLower(item.Title+"\n"+item.Content), match):
+			default:
+				items = append(items, newItem{Item: item, seenID: id})
+			}
+		}
+	}
+	if len(failed) == len(in.urls) {
+		return nil, nil, firstErr
+	}
+	if len(failed) > 0 {
+		config.WarnLog("feeds skipped because they couldn't be read: %s", strings.Join(failed, ", "))
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Published.After(items[j].Published) })
+	if len(items) > in.limit {
+		// The older items are left for the next runs
+		items = items[:in.limit]
+	}
+	if len(items) == 0 {
+		return nil, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp(config.TempDir(), "comanda-feed-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	var paths []string
+	used := make(map[string]bool)
+	save := func(title, content string) error {
+		path := filepath.Join(dir, documentFileName(connectors.Document{Title: title, Ext: ".md"}, used))
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			return fmt.Errorf("failed to save %s: %w", title, err)
+		}
+		p.trustPath(path)
+		paths = append(paths, path)
+		return nil
+	}
+
+	var rendered []string
+	for _, item := range items {
+		rendered = append(rendered, item.Render())
+		store.Add(item.seenID)
+	}
+	if in.split {
+		for i, item := range items {
+			if err := save(item.Title, rendered[i]); err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+		}
+	} else if err := save("feeds", strings.Join(rendered, "\n---\n\n")); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	p.debugf("Read %d new feed item(s) for step %s", len(items), stepName)
+	return paths, cleanup, nil
+}
+
+// feedErrors reports problems with the feed map of a step's input
+func (p *Processor) feedErrors(cfg StepConfig) []string {
+	input, _ := cfg.Input.(map[string]interface{})
+	spec, ok := input["feed"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if _, err := parseFeedInput("", spec); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
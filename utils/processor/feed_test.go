@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+func feedXML(titles ...string) string {
+	var items strings.Builder
+	for i, title := range titles {
+		fmt.Fprintf(&items, "<item><guid>%s</guid><title>%s</title><pubDate>Mon, 0%d Jun 2025 09:00:00 GMT</pubDate></item>", title, title, i+1)
+	}
+	return `<rss version="2.0"><channel><title>Blog</title>` + items.String() + `</channel></rss>`
+}
+
+func TestFeedInputReadsNewItems(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("COMANDA_DATA_DIR", dir)
+	body := map[string]string{"https://blog.example.com/feed": feedXML("first", "second")}
+	previousFetch := fetchFeed
+	fetchFeed = func(ctx context.Context, url string) ([]byte, error) {
+		if data, ok := body[url]; ok {
+			return []byte(data), nil
+		}
+		return nil, fmt.Errorf("404 Not Found")
+	}
+	defer func() { fetchFeed = previousFetch }()
+	var provider models.Provider = &readingProvider{MockProvider: MockProvider{name: "openai"}}
+	previousDetect := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider { return provider }
+	defer func() { models.DetectProvider = previousDetect }()
+
+	output := filepath.Join(dir, "brief.md")
+	run := func() error {
+		cfg := &DSLConfig{Steps: []Step{{Name: "brief", Config: StepConfig{
+			Input: map[string]interface{}{"feed": map[string]interface{}{
+				"urls": []interface{}{"https://blog.example.com/feed", "https://down.example.com/feed"},
+			}},
+			Model:  "gpt-4o",
+			Action: "Brief me",
+			Output: output,
+		}}}}
+		os.Remove(output)
+		proc := NewProcessor(cfg, createTestEnvConfig(), nil, false)
+		proc.SetProgressWriter(discardProgress{})
+		return proc.Process()
+	}
+	read := func() string {
+		data, _ := os.ReadFile(output)
+		return string(data)
+	}
+
+	provider = &failingProvider{MockProvider: MockProvider{name: "openai"}}
+	if err := run(); err == nil {
+		t.Fatal("Process() succeeded, want the provider's error")
+	}
+	provider = &readingProvider{MockProvider: MockProvider{name: "openai"}}
+	if err := run(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := read(); !strings.Contains(got, "# first") || strings.Index(got, "# second") > strings.Index(got, "# first") {
+		t.Errorf("output = %s, want both items, newest first, after the failed run", got)
+	}
+
+	if err := run(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("step ran without new items: %s", read())
+	}
+
+	body["https://blog.example.com/feed"] = feedXML("first", "second", "third")
+	if err := run(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := read(); !strings.Contains(got, "# third") || strings.Contains(got, "# first") {
+		t.Errorf("output = %s, want only the new item", got)
+	}
+
+	delete(body, "https://blog.example.com/feed")
+	if err := run(); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Process() error = %v, want the feeds' error when none can be read", err)
+	}
+}
+
+func TestFeedValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+	for want, spec := range map[string]map[string]interface{}{
+		"needs a url":        {"limit": 5},
+		"http or https":      {"url": "ftp://example.com/feed"},
+		"limit must be":      {"url": "https://example.com/feed", "limit": 0},
+		"invalid since":      {"url": "https://example.com/feed", "since": "last week"},
+		"invalid feed split": {"url": "https://example.com/feed", "split": "entries"},
+	} {
+		errs := proc.feedErrors(StepConfig{Input: map[string]interface{}{"feed": spec}})
+		if len(errs) != 1 || !strings.Contains(errs[0], want) {
+			t.Errorf("feedErrors(%v) = %v, want %q", spec, errs, want)
+		}
+	}
+	a, _ := parseFeedInput("brief", map[string]interface{}{"urls": []interface{}{"https://a.example.com", "https://b.example.com"}})
+	b, _ := parseFeedInput("brief", map[string]interface{}{"urls": []interface{}{"https://b.example.com", "https://a.example.com"}})
+	if a.key != b.key || !strings.HasPrefix(a.key, "feed-") {
+		t.Errorf("keys %q and %q, want the same key whatever the order of the feeds", a.key, b.key)
+	}
+}
@@ -0,0 +1,272 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Graph output formats
+const (
+	GraphMermaid = "mermaid"
+	GraphDOT     = "dot"
+)
+
+// GraphNode is a step in the workflow graph
+type GraphNode struct {
+	ID    string
+	Name  string
+	Label string // Step name plus a short description of what it runs
+	Group string // Parallel group or "defer"; empty for sequential steps
+}
+
+// GraphEdge connects two steps
+type GraphEdge struct {
+	From   string
+	To     string
+	Label  string
+	Dashed bool // Ordering or conditional edges rather than data flow
+}
+
+// WorkflowGraph is the step/dependency structure of a workflow
+type WorkflowGraph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// Graph builds the workflow's graph: parallel groups, sequential steps,
+// deferred steps, and the file, STDIN and join dependencies between them
+func (p *Processor) Graph() *WorkflowGraph {
+	g := &WorkflowGraph{}
+	ids := make(map[string]string) // step name -> node ID
+	addNode := func(step Step, group string) {
+		id := fmt.Sprintf("n%d", len(g.Nodes))
+		ids[step.Name] = id
+		g.Nodes = append(g.Nodes, GraphNode{ID: id, Name: step.Name, Label: p.graphLabel(step), Group: group})
+	}
+
+	producers := make(map[string]string) // output file -> step name
+	recordOutputs := func(step Step) {
+		for _, output := range p.NormalizeStringSlice(step.Config.Output) {
+			if output != "STDOUT" {
+				producers[output] = step.Name
+			}
+		}
+	}
+	hasEdge := make(map[[2]string]bool)
+	addEdge := func(from, to, label string, dashed bool) {
+		key := [2]string{from, to}
+		if hasEdge[key] && !dashed {
+			return
+		}
+		hasEdge[key] = true
+		g.Edges = append(g.Edges, GraphEdge{From: ids[from], To: ids[to], Label: label, Dashed: dashed})
+	}
+	fileEdges := func(step Step) {
+		for _, in := range p.NormalizeStringSlice(step.Config.Input) {
+			in, _ = p.parseVariableAssignment(in)
+			for _, output := range sortedKeys(producers) {
+				if output == in || (strings.ContainsAny(in, "*?[") && globMatch(in, output)) {
+					addEdge(producers[output], step.Name, output, false)
+				}
+			}
+		}
+	}
+
+	groupNames := make([]string, 0, len(p.config.ParallelSteps))
+	for name := range p.config.ParallelSteps {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	groupSteps := make(map[string][]Step)
+	for _, groupName := range groupNames {
+		steps := append([]Step(nil), p.config.ParallelSteps[groupName]...)
+		sort.Slice(steps, func(i, j int) bool { return steps[i].Name < steps[j].Name })
+		groupSteps[groupName] = steps
+		for _, step := range steps {
+			addNode(step, groupName)
+			recordOutputs(step)
+		}
+	}
+
+	var previous string
+	for _, step := range p.config.Steps {
+		addNode(step, "")
+		fileEdges(step)
+		inputs := p.NormalizeStringSlice(step.Config.Input)
+		if previous != "" && len(inputs) == 1 && strings.HasPrefix(inputs[0], "STDIN") {
+			addEdge(previous, step.Name, "STDIN", false)
+		}
+		if step.Config.Join != nil {
+			groupName, err := p.joinGroupName(step.Config.Join)
+			if err == nil {
+				members := step.Config.Join.Steps
+				if len(members) == 0 {
+					for _, s := range groupSteps[groupName] {
+						members = append(members, s.Name)
+					}
+				}
+				for _, name := range members {
+					if _, ok := ids[name]; ok {
+						addEdge(name, step.Name, "join", false)
+					}
+				}
+			}
+		}
+		if previous != "" && !hasEdge[[2]string{previous, step.Name}] {
+			addEdge(previous, step.Name, "then", true)
+		}
+		recordOutputs(step)
+		previous = step.Name
+	}
+
+	deferNames := make([]string, 0, len(p.config.Defer))
+	for name := range p.config.Defer {
+		deferNames = append(deferNames, name)
+	}
+	sort.Strings(deferNames)
+	for _, name := range deferNames {
+		addNode(Step{Name: name, Config: p.config.Defer[name]}, "defer")
+	}
+	// A sequential step can hand off to a deferred step; link steps whose
+	// actions name the deferred step
+	for _, step := range p.config.Steps {
+		actions := strings.Join(p.NormalizeStringSlice(step.Config.Action), "\n")
+		for _, name := range deferNames {
+			if strings.Contains(actions, name) {
+				addEdge(step.Name, name, "defer", true)
+			}
+		}
+	}
+
+	return g
+}
+
+// graphLabel describes a step for its node
+func (p *Processor) graphLabel(step Step) string {
+	cfg := step.Config
+	switch {
+	case cfg.Generate != nil:
+		return fmt.Sprintf("%s\ngenerate: %s", step.Name, cfg.Generate.Output)
+	case cfg.Process != nil:
+		return fmt.Sprintf("%s\nprocess: %s", step.Name, cfg.Process.WorkflowFile)
+	case cfg.Type == "validate-data":
+		return fmt.Sprintf("%s\nvalidate-data", step.Name)
+	}
+	models := strings.Join(p.NormalizeStringSlice(cfg.Model), ", ")
+	if cfg.Type != "" {
+		return fmt.Sprintf("%s\n%s: %s", step.Name, cfg.Type, models)
+	}
+	return fmt.Sprintf("%s\n%s", step.Name, models)
+}
+
+// globMatch reports whether a produced file matches an input glob pattern
+func globMatch(pattern, name string) bool {
+	matched, err := filepath.Match(pattern, name)
+	return err == nil && matched
+}
+
+// Render formats the graph as Mermaid or Graphviz DOT
+func (g *WorkflowGraph) Render(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case GraphMermaid, "":
+		return g.renderMermaid(), nil
+	case GraphDOT:
+		return g.renderDOT(), nil
+	}
+	return "", fmt.Errorf("unknown graph format '%s' (expected mermaid or dot)", format)
+}
+
+// groups returns the node groups in first-seen order, with ungrouped nodes under ""
+func (g *WorkflowGraph) groups() ([]string, map[string][]GraphNode) {
+	var order []string
+	members := make(map[string][]GraphNode)
+	for _, node := range g.Nodes {
+		if _, ok := members[node.Group]; !ok {
+			order = append(order, node.Group)
+		}
+		members[node.Group] = append(members[node.Group], node)
+	}
+	return order, members
+}
+
+// groupTitle labels a group's subgraph
+func groupTitle(group string) string {
+	if group == "defer" {
+		return "deferred"
+	}
+	return "parallel: " + group
+}
+
+func (g *WorkflowGraph) renderMermaid() string {
+	escape := func(s string) string {
+		s = strings.ReplaceAll(s, `"`, "#quot;")
+		return strings.ReplaceAll(s, "\n", "<br/>")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	order, members := g.groups()
+	for i, group := range order {
+		indent := "  "
+		if group != "" {
+			sb.WriteString(fmt.Sprintf("  subgraph g%d[\"%s\"]\n", i, escape(groupTitle(group))))
+			indent = "    "
+		}
+		for _, node := range members[group] {
+			sb.WriteString(fmt.Sprintf("%s%s[\"%s\"]\n", indent, node.ID, escape(node.Label)))
+		}
+		if group != "" {
+			sb.WriteString("  end\n")
+		}
+	}
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		if edge.Dashed {
+			arrow = "-.->"
+		}
+		if edge.Label != "" {
+			sb.WriteString(fmt.Sprintf("  %s %s|\"%s\"| %s\n", edge.From, arrow, escape(edge.Label), edge.To))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %s %s %s\n", edge.From, arrow, edge.To))
+		}
+	}
+	return sb.String()
+}
+
+func (g *WorkflowGraph) renderDOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph workflow {\n  rankdir=TB;\n  node [shape=box];\n")
+	order, members := g.groups()
+	for i, group := range order {
+		indent := "  "
+		if group != "" {
+			sb.WriteString(fmt.Sprintf("  subgraph cluster_%d {\n    label=%s;\n", i, strconv.Quote(groupTitle(group))))
+			indent = "    "
+		}
+		for _, node := range members[group] {
+			sb.WriteString(fmt.Sprintf("%s%s [label=%s];\n", indent, node.ID, strconv.Quote(node.Label)))
+		}
+		if group != "" {
+			sb.WriteString("  }\n")
+		}
+	}
+	for _, edge := range g.Edges {
+		var attrs []string
+		if edge.Label != "" {
+			attrs = append(attrs, "label="+strconv.Quote(edge.Label))
+		}
+		if edge.Dashed {
+			attrs = append(attrs, "style=dashed")
+		}
+		if len(attrs) > 0 {
+			sb.WriteString(fmt.Sprintf("  %s -> %s [%s];\n", edge.From, edge.To, strings.Join(attrs, ", ")))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %s -> %s;\n", edge.From, edge.To))
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
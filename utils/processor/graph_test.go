@@ -0,0 +1,71 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+func graphTestConfig() *DSLConfig {
+	cfg := joinTestConfig()
+	cfg.Steps = append([]Step{
+		{Name: "extract", Config: StepConfig{Input: "raw.txt", Model: "gpt-4o", Action: "extract", Output: "facts.txt"}},
+		{Name: "review", Config: StepConfig{Input: "facts.txt", Model: "claude-3-5-sonnet", Action: "review, or hand off to escalate", Output: "STDOUT"}},
+	}, cfg.Steps...)
+	cfg.Steps = append(cfg.Steps, Step{Name: "publish", Config: StepConfig{Input: "STDIN", Model: "gpt-4o", Action: "publish", Output: "STDOUT"}})
+	cfg.Defer = map[string]StepConfig{
+		"escalate": {Input: "STDIN", Model: "gpt-4o", Action: "escalate", Output: "STDOUT"},
+	}
+	return cfg
+}
+
+func TestGraphEdges(t *testing.T) {
+	proc := NewProcessor(graphTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+	g := proc.Graph()
+
+	names := make(map[string]string)
+	for _, node := range g.Nodes {
+		names[node.ID] = node.Name
+	}
+	var edges []string
+	for _, edge := range g.Edges {
+		e := names[edge.From] + "->" + names[edge.To] + ":" + edge.Label
+		if edge.Dashed {
+			e += "(dashed)"
+		}
+		edges = append(edges, e)
+	}
+	got := strings.Join(edges, " ")
+	want := "extract->review:facts.txt sentiment->combine:join topics->combine:join review->combine:then(dashed) combine->publish:STDIN review->escalate:defer(dashed)"
+	if got != want {
+		t.Errorf("edges =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGraphRender(t *testing.T) {
+	proc := NewProcessor(graphTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+	g := proc.Graph()
+
+	mermaid, err := g.Render(GraphMermaid)
+	if err != nil {
+		t.Fatalf("Render(mermaid) error = %v", err)
+	}
+	for _, want := range []string{"flowchart TD", `subgraph g0["parallel: analysis"]`, `n0["sentiment<br/>gpt-4o"]`, `n2 -->|"facts.txt"| n3`, `-.->|"defer"|`} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("mermaid output missing %q:\n%s", want, mermaid)
+		}
+	}
+
+	dot, err := g.Render(GraphDOT)
+	if err != nil {
+		t.Fatalf("Render(dot) error = %v", err)
+	}
+	for _, want := range []string{"digraph workflow {", `label="parallel: analysis";`, `n0 [label="sentiment\ngpt-4o"];`, `n2 -> n3 [label="facts.txt"];`, `style=dashed`} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("dot output missing %q:\n%s", want, dot)
+		}
+	}
+
+	if _, err := g.Render("svg"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/input"
 )
 
@@ -119,7 +120,7 @@ func (p *Processor) fetchURL(urlStr string) (string, error) {
 		ext = ".json"
 	}
 
-	tmpFile, err := os.CreateTemp("", "comanda-url-*"+ext)
+	tmpFile, err := os.CreateTemp(config.TempDir(), "comanda-url-*"+ext)
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file for URL content: %w", err)
 	}
@@ -174,6 +175,7 @@ func (p *Processor) processInputs(inputs []string) error {
 					return err
 				}
 				defer os.Remove(tmpPath)
+				p.trustPath(tmpPath)
 				inputPath = tmpPath
 			}
 		}
@@ -258,6 +260,14 @@ func (p *Processor) processRegularInput(inputPath string) error {
 		p.debugf("- Data directory: %s", p.serverConfig.DataDir)
 	}
 
+	// In server mode every path is resolved and confined by the sandbox
+	if sb := p.getSandbox(); sb != nil {
+		return p.processSandboxedInput(sb, inputPath)
+	}
+	if p.sandboxErr != nil {
+		return fmt.Errorf("sandbox unavailable: %w", p.sandboxErr)
+	}
+
 	// Force server mode with runtime directory if available
 	if p.runtimeDir != "" {
 		p.debugf("IMPORTANT: Server mode with runtime directory is active")
@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/input"
+)
+
+// stepInputLimit returns the most bytes of input a step reads into memory:
+// its max_input_size, or fileutil.MaxFileSize when unset
+func stepInputLimit(config StepConfig) int64 {
+	if limit, err := fileutil.ParseSize(config.MaxInputSize); err == nil {
+		return limit
+	}
+	return fileutil.MaxFileSize
+}
+
+// newStepHandler creates an input handler enforcing the step's input limit
+func newStepHandler(config StepConfig) *input.Handler {
+	handler := input.NewHandler()
+	handler.SetMaxInputSize(stepInputLimit(config))
+	return handler
+}
+
+// inputSizeHint adds how to get past the limit to an input size error
+func inputSizeHint(err error) error {
+	var sizeErr *fileutil.SizeLimitError
+	if errors.As(err, &sizeErr) {
+		return fmt.Errorf("%w; split it with chunk: or raise the step's max_input_size", err)
+	}
+	return err
+}
+
+// SetLastOutputFile sets a file holding the last output, for STDIN data too
+// large to keep in memory. Steps reading STDIN read the file in their place,
+// so it must exist until the run finishes.
+func (p *Processor) SetLastOutputFile(path string) {
+	p.lastOutput = ""
+	p.lastOutputFile = path
+	p.trustPath(path)
+}
+
+// stdinContents returns the STDIN a step reads as text, reading the file
+// set by SetLastOutputFile within the step's input limit
+func (p *Processor) stdinContents(config StepConfig) (string, error) {
+	if p.lastOutputFile == "" {
+		return p.lastOutput, nil
+	}
+	data, err := fileutil.ReadFileLimit(p.lastOutputFile, stepInputLimit(config))
+	if err != nil {
+		return "", inputSizeHint(fmt.Errorf("error reading STDIN: %w", err))
+	}
+	return string(data), nil
+}
@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// naStep is a step passing its input through unchanged
+func naStep(input string, limit string) *DSLConfig {
+	return &DSLConfig{Steps: []Step{{Name: "pass", Config: StepConfig{
+		Input: input, Model: "NA", Action: "Pass through", Output: "STDOUT", MaxInputSize: limit,
+	}}}}
+}
+
+func TestMaxInputSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 2048)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := NewProcessor(naStep(path, "1KB"), createTestEnvConfig(), createTestServerConfig(), false)
+	err := proc.Process()
+	if err == nil || !strings.Contains(err.Error(), "over the limit of 1.0 KB") || !strings.Contains(err.Error(), "max_input_size") {
+		t.Errorf("Process() error = %v, want the limit and how to raise it", err)
+	}
+
+	proc = NewProcessor(naStep(path, "4KB"), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() within the limit error = %v", err)
+	}
+	if got := len(proc.LastOutput()); got != 2048 {
+		t.Errorf("output is %d bytes, want 2048", got)
+	}
+}
+
+func TestMaxInputSizeInvalid(t *testing.T) {
+	proc := NewProcessor(naStep("NA", "lots"), createTestEnvConfig(), createTestServerConfig(), false)
+	if errs := proc.stepConfigErrors("pass", proc.config.Steps[0].Config); len(errs) != 1 || !strings.Contains(errs[0], "max_input_size") {
+		t.Errorf("stepConfigErrors() = %v, want the invalid max_input_size", errs)
+	}
+}
+
+func TestLastOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comanda-stdin-1.txt")
+	if err := os.WriteFile(path, []byte("piped data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := NewProcessor(naStep("STDIN as $piped", ""), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetLastOutputFile(path)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := proc.LastOutput(); got != "piped data" {
+		t.Errorf("LastOutput() = %q, want the file's contents", got)
+	}
+	if got := proc.variables["piped"]; got != "piped data" {
+		t.Errorf("$piped = %q, want the file's contents", got)
+	}
+}
+
+func TestChunkedInputByReference(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("line\n", 400)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is over the limit, but each chunk is within it
+	config := naStep(path, "1KB")
+	config.Steps[0].Config.Chunk = &ChunkConfig{By: "lines", Size: 100}
+	proc := NewProcessor(config, createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := strings.Count(proc.LastOutput(), "line"); got != 400 {
+		t.Errorf("output has %d lines, want 400", got)
+	}
+}
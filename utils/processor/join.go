@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// JoinConfig makes a sequential step receive the outputs of a parallel group
+type JoinConfig struct {
+	Group string   `yaml:"group"` // Parallel group to join; optional when the workflow has only one
+	Steps []string `yaml:"steps"` // Optional subset and order of the group's steps
+}
+
+// joinPlaceholderPattern matches {{ join.STEP }} and {{ join.all }} placeholders in actions
+var joinPlaceholderPattern = regexp.MustCompile(`\{\{\s*join\.([A-Za-z0-9_\-]+)\s*\}\}`)
+
+// validateJoinConfig checks that a join step refers to an existing parallel group
+func (p *Processor) validateJoinConfig(stepName string, cfg *JoinConfig) []string {
+	var errors []string
+	for groupName, steps := range p.config.ParallelSteps {
+		for _, s := range steps {
+			if s.Name == stepName {
+				return append(errors, fmt.Sprintf("join step '%s' cannot run inside parallel group '%s'", stepName, groupName))
+			}
+		}
+	}
+
+	groupName, err := p.joinGroupName(cfg)
+	if err != nil {
+		return append(errors, err.Error())
+	}
+	members := make(map[string]bool)
+	for _, s := range p.config.ParallelSteps[groupName] {
+		members[s.Name] = true
+	}
+	for _, name := range cfg.Steps {
+		if !members[name] {
+			errors = append(errors, fmt.Sprintf("join step '%s' not found in parallel group '%s'", name, groupName))
+		}
+	}
+	return errors
+}
+
+// joinGroupName resolves which parallel group a join refers to
+func (p *Processor) joinGroupName(cfg *JoinConfig) (string, error) {
+	if cfg.Group != "" {
+		if _, ok := p.config.ParallelSteps[cfg.Group]; !ok {
+			return "", fmt.Errorf("join group '%s' is not a parallel group in this workflow", cfg.Group)
+		}
+		return cfg.Group, nil
+	}
+	switch len(p.config.ParallelSteps) {
+	case 0:
+		return "", fmt.Errorf("join requires a parallel group but the workflow has none")
+	case 1:
+		for groupName := range p.config.ParallelSteps {
+			return groupName, nil
+		}
+	}
+	return "", fmt.Errorf("join 'group' is required when the workflow has more than one parallel group")
+}
+
+// applyJoin substitutes parallel outputs into the step's actions. {{ join.STEP }}
+// is replaced with one step's output and {{ join.all }} with every output,
+// labelled by step name. Actions without placeholders get all outputs appended.
+func (p *Processor) applyJoin(step Step, actions []string) ([]string, error) {
+	groupName, err := p.joinGroupName(step.Config.Join)
+	if err != nil {
+		return nil, err
+	}
+	results, ok := p.parallelResults[groupName]
+	if !ok {
+		return nil, fmt.Errorf("parallel group '%s' has not produced any results", groupName)
+	}
+
+	order := step.Config.Join.Steps
+	if len(order) == 0 {
+		for name := range results {
+			order = append(order, name)
+		}
+		sort.Strings(order)
+	}
+
+	sections := make([]string, 0, len(order))
+	for _, name := range order {
+		sections = append(sections, fmt.Sprintf("=== %s ===\n%s", name, results[name]))
+	}
+	all := strings.Join(sections, "\n\n")
+
+	joined := make([]string, len(actions))
+	for i, action := range actions {
+		if !joinPlaceholderPattern.MatchString(action) {
+			joined[i] = action + "\n\n" + all
+			continue
+		}
+		var missing []string
+		joined[i] = joinPlaceholderPattern.ReplaceAllStringFunc(action, func(match string) string {
+			name := joinPlaceholderPattern.FindStringSubmatch(match)[1]
+			if name == "all" {
+				return all
+			}
+			output, ok := results[name]
+			if !ok {
+				missing = append(missing, name)
+				return match
+			}
+			return output
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("join placeholders refer to steps not in parallel group '%s': %s", groupName, strings.Join(missing, ", "))
+		}
+	}
+	p.debugf("Joined %d output(s) from parallel group '%s' into step '%s'", len(order), groupName, step.Name)
+	return joined, nil
+}
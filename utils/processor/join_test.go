@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+func joinTestConfig() *DSLConfig {
+	analysis := StepConfig{Input: "NA", Model: "gpt-4o", Action: "analyze", Output: "STDOUT"}
+	return &DSLConfig{
+		ParallelSteps: map[string][]Step{
+			"analysis": {
+				{Name: "sentiment", Config: analysis},
+				{Name: "topics", Config: analysis},
+			},
+		},
+		Steps: []Step{
+			{
+				Name: "combine",
+				Config: StepConfig{
+					Input:  "NA",
+					Model:  "gpt-4o",
+					Action: "Combine {{ join.sentiment }} with {{ join.topics }}",
+					Output: "STDOUT",
+					Join:   &JoinConfig{},
+				},
+			},
+		},
+	}
+}
+
+func TestJoinStep(t *testing.T) {
+	proc := NewProcessor(joinTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := len(proc.parallelResults["analysis"]); got != 2 {
+		t.Fatalf("expected 2 parallel results, got %d", got)
+	}
+
+	proc.parallelResults["analysis"] = map[string]string{"sentiment": "positive", "topics": "pricing"}
+	step := proc.config.Steps[0]
+
+	actions, err := proc.applyJoin(step, []string{"Combine {{ join.sentiment }} with {{join.topics}}", "Review:", "{{ join.all }}"})
+	if err != nil {
+		t.Fatalf("applyJoin() error = %v", err)
+	}
+	if actions[0] != "Combine positive with pricing" {
+		t.Errorf("templated action = %q", actions[0])
+	}
+	all := "=== sentiment ===\npositive\n\n=== topics ===\npricing"
+	if actions[1] != "Review:\n\n"+all {
+		t.Errorf("action without placeholders = %q", actions[1])
+	}
+	if actions[2] != all {
+		t.Errorf("join.all = %q", actions[2])
+	}
+
+	if _, err := proc.applyJoin(step, []string{"{{ join.missing }}"}); err == nil {
+		t.Error("expected error for unknown join placeholder")
+	}
+}
+
+func TestJoinValidation(t *testing.T) {
+	cfg := joinTestConfig()
+	cfg.Steps[0].Config.Join = &JoinConfig{Group: "nope"}
+	proc := NewProcessor(cfg, createTestEnvConfig(), nil, false)
+	if err := proc.validateStepConfig("combine", cfg.Steps[0].Config); err == nil || !strings.Contains(err.Error(), "not a parallel group") {
+		t.Errorf("expected unknown group error, got %v", err)
+	}
+
+	cfg.Steps[0].Config.Join = &JoinConfig{Steps: []string{"sentiment", "summary"}}
+	if err := proc.validateStepConfig("combine", cfg.Steps[0].Config); err == nil || !strings.Contains(err.Error(), "'summary' not found") {
+		t.Errorf("expected unknown step error, got %v", err)
+	}
+}
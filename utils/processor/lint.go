@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Lint finding levels, matching SARIF result levels
+const (
+	LintWarning = "warning"
+	LintNote    = "note"
+)
+
+// LintRules describes each lint rule by ID
+var LintRules = map[string]string{
+	"unreachable-step":      "Deferred step that no step hands off to",
+	"unused-output":         "Output file that no other step reads",
+	"chunk-overlap":         "Chunked input without overlap between chunks",
+	"deprecated-model":      "Model that is deprecated or retired by its provider",
+	"reasoning-temperature": "Sampling parameters set on a reasoning model that ignores them",
+}
+
+// LintFinding is a best-practice problem found in a workflow
+type LintFinding struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Step    string `json:"step,omitempty"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"` // Line of the step in the workflow file, when known
+}
+
+// StepLines maps step names to the line they are declared on in a workflow file
+func StepLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	walkStepNodes(data, func(name string, key, value *yaml.Node) {
+		if _, seen := lines[name]; !seen {
+			lines[name] = key.Line
+		}
+	})
+	return lines
+}
+
+// Lint checks the workflow against best-practice rules. Unlike Validate, the
+// findings don't stop a workflow from running.
+func (p *Processor) Lint() []LintFinding {
+	var findings []LintFinding
+	add := func(rule, level, step, msg string) {
+		findings = append(findings, LintFinding{Rule: rule, Level: level, Step: step, Message: msg})
+	}
+
+	for _, name := range p.unreachableDeferredSteps() {
+		add("unreachable-step", LintWarning, name,
+			"deferred step is never named in another step's action, so no step can hand off to it")
+	}
+	for _, step := range p.unusedOutputSteps() {
+		add("unused-output", LintNote, step[0], fmt.Sprintf("output '%s' is not read by any other step", step[1]))
+	}
+
+	for _, step := range p.workflowSteps() {
+		if step.Config.Chunk != nil && step.Config.Chunk.Overlap == 0 {
+			add("chunk-overlap", LintWarning, step.Name,
+				"chunked input has no 'overlap', so text split at chunk boundaries loses its context")
+		}
+		for _, modelName := range p.stepModels(step.Config) {
+			if replacement, ok := models.DeprecatedReplacement(modelName); ok {
+				add("deprecated-model", LintWarning, step.Name,
+					fmt.Sprintf("model %s is deprecated; consider %s", modelName, replacement))
+			}
+			if models.IsReasoningModel(modelName) && (step.Config.Temperature != 0 || step.Config.TopP != 0) {
+				add("reasoning-temperature", LintWarning, step.Name,
+					fmt.Sprintf("model %s ignores 'temperature' and 'top_p'", modelName))
+			}
+		}
+	}
+	return findings
+}
+
+// unreachableDeferredSteps lists deferred steps whose names appear in no
+// other step's action. A hand-off needs the previous step to output the
+// deferred step's name, which in practice means the action mentions it.
+func (p *Processor) unreachableDeferredSteps() []string {
+	var unreachable []string
+	for name := range p.config.Defer {
+		reachable := false
+		for _, step := range p.workflowSteps() {
+			if step.Name == name {
+				continue
+			}
+			text := strings.Join(p.NormalizeStringSlice(step.Config.Action), "\n") + "\n" + step.Config.Instructions
+			if strings.Contains(text, name) {
+				reachable = true
+				break
+			}
+		}
+		if !reachable {
+			unreachable = append(unreachable, name)
+		}
+	}
+	sort.Strings(unreachable)
+	return unreachable
+}
+
+// unusedOutputSteps lists [step, file] pairs for output files that no other
+// step reads. The final sequential step's outputs are the workflow's results
+// and are not reported.
+func (p *Processor) unusedOutputSteps() [][2]string {
+	var inputs []string
+	for _, step := range p.workflowSteps() {
+		for _, in := range p.NormalizeStringSlice(step.Config.Input) {
+			in, _ = p.parseVariableAssignment(in)
+			inputs = append(inputs, in)
+		}
+	}
+	consumed := func(output string) bool {
+		for _, in := range inputs {
+			if in == output || filepath.Base(in) == filepath.Base(output) {
+				return true
+			}
+			if strings.ContainsAny(in, "*?[") && (globMatch(in, output) || globMatch(filepath.Base(in), filepath.Base(output))) {
+				return true
+			}
+		}
+		return false
+	}
+
+	last := ""
+	if len(p.config.Steps) > 0 {
+		last = p.config.Steps[len(p.config.Steps)-1].Name
+	}
+	var unused [][2]string
+	for _, step := range p.workflowSteps() {
+		if step.Name == last {
+			continue
+		}
+		if _, deferred := p.config.Defer[step.Name]; deferred {
+			continue // Deferred steps run conditionally, so their outputs are treated as results
+		}
+		for _, output := range p.NormalizeStringSlice(step.Config.Output) {
+			if output != "" && output != "STDOUT" && !consumed(output) {
+				unused = append(unused, [2]string{step.Name, output})
+			}
+		}
+	}
+	return unused
+}
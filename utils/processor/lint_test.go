@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const lintTestWorkflow = `
+split:
+  input: notes.txt
+  model: o1-preview
+  action: "Split the notes. Reply {\"step\": \"escalate\"} if anything is urgent."
+  output: [parts.txt, debug.txt]
+  temperature: 0.2
+  chunk:
+    by: lines
+    size: 100
+summarize:
+  input: "parts*.txt"
+  model: gpt-4o
+  action: summarize
+  output: summary.txt
+defer:
+  escalate:
+    input: STDIN
+    model: gpt-4o
+    action: escalate
+    output: STDOUT
+  archive:
+    input: STDIN
+    model: gpt-4o
+    action: archive
+    output: STDOUT
+`
+
+func TestLint(t *testing.T) {
+	var cfg DSLConfig
+	if err := yaml.Unmarshal([]byte(lintTestWorkflow), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	proc := NewProcessor(&cfg, createTestEnvConfig(), createTestServerConfig(), false)
+
+	var got []string
+	for _, f := range proc.Lint() {
+		got = append(got, f.Rule+"/"+f.Level+"/"+f.Step)
+	}
+	want := []string{
+		"unreachable-step/warning/archive",
+		"unused-output/note/split",
+		"chunk-overlap/warning/split",
+		"deprecated-model/warning/split",
+		"reasoning-temperature/warning/split",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("findings = %v, want %v", got, want)
+	}
+
+	lines := StepLines([]byte(lintTestWorkflow))
+	if lines["split"] != 2 || lines["archive"] != 22 {
+		t.Errorf("StepLines() = %v", lines)
+	}
+}
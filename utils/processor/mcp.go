@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/mcp"
+	"github.com/kris-hansen/comanda/utils/tools"
+)
+
+// mcpTools starts (or reuses) the named MCP servers and returns their tools
+func (p *Processor) mcpTools(serverNames []string) (map[string]tools.Tool, error) {
+	available := make(map[string]tools.Tool)
+	for _, name := range serverNames {
+		client, err := p.mcpClient(name)
+		if err != nil {
+			return nil, err
+		}
+		serverTools, err := mcp.Tools(client)
+		if err != nil {
+			return nil, err
+		}
+		for _, tool := range serverTools {
+			available[tool.Name()] = tool
+		}
+		p.debugf("MCP server %s provides %d tool(s)", name, len(serverTools))
+	}
+	return available, nil
+}
+
+// mcpClient returns a running client for a configured MCP server, starting it
+// on first use so workflows that never need it don't pay for the process
+func (p *Processor) mcpClient(name string) (*mcp.Client, error) {
+	p.mcpMu.Lock()
+	defer p.mcpMu.Unlock()
+
+	if client, ok := p.mcpClients[name]; ok {
+		return client, nil
+	}
+	if p.envConfig == nil {
+		return nil, fmt.Errorf("MCP server '%s' is not configured", name)
+	}
+	cfg, ok := p.envConfig.MCPServers[name]
+	if !ok {
+		return nil, fmt.Errorf("MCP server '%s' is not configured", name)
+	}
+
+	client, err := mcp.Start(name, cfg, p.Environ())
+	if err != nil {
+		return nil, err
+	}
+	if p.mcpClients == nil {
+		p.mcpClients = make(map[string]*mcp.Client)
+	}
+	p.mcpClients[name] = client
+	return client, nil
+}
+
+// closeMCPClients stops every MCP server started during the run
+func (p *Processor) closeMCPClients() {
+	p.mcpMu.Lock()
+	defer p.mcpMu.Unlock()
+	for name, client := range p.mcpClients {
+		client.Close()
+		p.debugf("Stopped MCP server %s", name)
+	}
+	p.mcpClients = nil
+}
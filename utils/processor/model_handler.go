@@ -114,7 +114,7 @@ func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 	for _, modelName := range modelNames {
 		p.debugf("Starting validation for model: %s", modelName)
 		p.debugf("Attempting provider detection for model: %s", modelName)
-		provider := models.DetectProvider(modelName)
+		provider := p.detectProvider(modelName)
 		p.debugf("Provider detection result for %s: found=%v", modelName, provider != nil)
 		if provider == nil {
 			errMsg := fmt.Sprintf("unsupported model: %s (no provider found)", modelName)
@@ -131,6 +131,12 @@ func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 		}
 		p.debugf("Provider %s confirmed support for model %s", provider.Name(), modelName)
 
+		// Resolved providers are ready to use without local or env config checks
+		if p.resolver != nil {
+			p.providers[provider.Name()] = provider
+			continue
+		}
+
 		// Get provider name
 		providerName := provider.Name()
 
@@ -194,6 +200,7 @@ func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 		}
 
 		provider.SetVerbose(p.verbose)
+		p.reportRetries(provider)
 		// Store provider by provider name instead of model name
 		p.providers[provider.Name()] = provider
 		p.debugf("Model %s is supported by provider %s", modelName, provider.Name())
@@ -204,55 +211,65 @@ func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 // configureProviders sets up all detected providers with API keys
 func (p *Processor) configureProviders() error {
 	p.debugf("Configuring providers")
+	if p.resolver != nil {
+		return nil
+	}
 
 	for providerName, provider := range p.providers {
 		p.debugf("Configuring provider %s", providerName)
-
-		// Handle Ollama provider separately since it doesn't need an API key, but expects "LOCAL"
-		if providerName == "ollama" {
-			if err := provider.Configure("LOCAL"); err != nil { // Pass "LOCAL" as expected by OllamaProvider.Configure
-				return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
-			}
-			p.debugf("Successfully configured local provider %s", providerName)
-			continue
+		if err := p.configureProvider(providerName, provider); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		var providerConfig *config.Provider
-		var err error
-
-		switch providerName {
-		case "anthropic":
-			providerConfig, err = p.envConfig.GetProviderConfig("anthropic")
-		case "openai":
-			providerConfig, err = p.envConfig.GetProviderConfig("openai")
-		case "google":
-			providerConfig, err = p.envConfig.GetProviderConfig("google")
-		case "xai":
-			providerConfig, err = p.envConfig.GetProviderConfig("xai")
-		case "deepseek":
-			providerConfig, err = p.envConfig.GetProviderConfig("deepseek")
-		case "moonshot":
-			providerConfig, err = p.envConfig.GetProviderConfig("moonshot")
-		default:
-			return fmt.Errorf("unknown provider: %s", providerName)
+// configureProvider gives a provider its API key from the env config
+func (p *Processor) configureProvider(providerName string, provider models.Provider) error {
+	// Handle Ollama provider separately since it doesn't need an API key, but expects "LOCAL"
+	if providerName == "ollama" {
+		if err := provider.Configure("LOCAL"); err != nil { // Pass "LOCAL" as expected by OllamaProvider.Configure
+			return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
 		}
+		p.debugf("Successfully configured local provider %s", providerName)
+		return nil
+	}
 
-		if err != nil {
-			return fmt.Errorf("failed to get config for provider %s: %w", providerName, err)
-		}
+	var providerConfig *config.Provider
+	var err error
+
+	switch providerName {
+	case "anthropic":
+		providerConfig, err = p.envConfig.GetProviderConfig("anthropic")
+	case "openai":
+		providerConfig, err = p.envConfig.GetProviderConfig("openai")
+	case "google":
+		providerConfig, err = p.envConfig.GetProviderConfig("google")
+	case "xai":
+		providerConfig, err = p.envConfig.GetProviderConfig("xai")
+	case "deepseek":
+		providerConfig, err = p.envConfig.GetProviderConfig("deepseek")
+	case "moonshot":
+		providerConfig, err = p.envConfig.GetProviderConfig("moonshot")
+	default:
+		return fmt.Errorf("unknown provider: %s", providerName)
+	}
 
-		if providerConfig.APIKey == "" {
-			return fmt.Errorf("missing API key for provider %s", providerName)
-		}
+	if err != nil {
+		return fmt.Errorf("failed to get config for provider %s: %w", providerName, err)
+	}
 
-		p.debugf("Found API key for provider %s", providerName)
+	if providerConfig.APIKey == "" {
+		return fmt.Errorf("missing API key for provider %s", providerName)
+	}
 
-		if err := provider.Configure(providerConfig.APIKey); err != nil {
-			return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
-		}
+	p.debugf("Found API key for provider %s", providerName)
 
-		p.debugf("Successfully configured provider %s", providerName)
+	if err := provider.Configure(providerConfig.APIKey); err != nil {
+		return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
 	}
+
+	p.debugf("Successfully configured provider %s", providerName)
 	return nil
 }
 
@@ -263,7 +280,7 @@ func (p *Processor) GetModelProvider(modelName string) models.Provider {
 		return nil
 	}
 
-	provider := models.DetectProvider(modelName)
+	provider := p.detectProvider(modelName)
 	if provider == nil {
 		return nil
 	}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
 )
 
 // min returns the minimum of two integers
@@ -47,6 +50,7 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 				if err := p.progress.WriteProgress(ProgressUpdate{
 					Type:               ProgressOutput,
 					Stdout:             outputWithMetrics,
+					Step:               &StepInfo{Model: modelName},
 					PerformanceMetrics: metrics,
 				}); err != nil {
 					p.debugf("Error sending output event: %v", err)
@@ -54,11 +58,16 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 				}
 				p.debugf("Output event sent successfully")
 			} else {
-				// Fallback to direct console output
-				fmt.Printf("\nResponse from %s:\n%s\n", modelName, response)
+				// Fallback to direct console output. With --quiet only the
+				// response itself is printed.
+				if config.Quiet() {
+					fmt.Println(response)
+				} else {
+					fmt.Printf("\nResponse from %s:\n%s\n", modelName, response)
+				}
 
 				// Print performance metrics if available
-				if metrics != nil {
+				if metrics != nil && !config.Quiet() {
 					fmt.Printf("\nPerformance Metrics:\n"+
 						"- Input processing: %d ms\n"+
 						"- Model processing: %d ms\n"+
@@ -71,35 +80,24 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 				}
 			}
 			p.debugf("Response written to STDOUT")
-		} else {
-			// Determine the output path based on server mode and runtime directory
-			outputPath := output
-			if p.serverConfig != nil {
-				if p.runtimeDir != "" {
-					// When runtime directory is set, treat all output paths as relative to it
-					p.debugf("Using runtime directory: %s, output path: %s", p.runtimeDir, output)
-					outputPath = filepath.Join(p.serverConfig.DataDir, p.runtimeDir, output)
-				} else {
-					// No runtime directory, use DataDir directly
-					outputPath = filepath.Join(p.serverConfig.DataDir, output)
-				}
-				p.debugf("Resolved output path: %s", outputPath)
+		} else if strings.EqualFold(filepath.Ext(output), ".xlsx") {
+			// Structured output becomes a formatted workbook
+			if err := p.writeXLSX(output, response, "", "", nil); err != nil {
+				return fmt.Errorf("failed to write spreadsheet %s: %w", output, err)
 			}
-
-			// Create directory if it doesn't exist
-			dir := filepath.Dir(outputPath)
-			if dir != "." {
-				p.debugf("Creating directory if it doesn't exist: %s", dir)
-				if err := os.MkdirAll(dir, 0755); err != nil {
-					return fmt.Errorf("failed to create directory %s: %w", dir, err)
-				}
+		} else {
+			outputPath, err := p.resolveOutputPath(output)
+			if err != nil {
+				return err
 			}
 
 			// Write to file
 			p.debugf("Writing response to file: %s", outputPath)
-			fmt.Printf("\n==== DEBUG: Writing to file %s ====\n", outputPath)
-			fmt.Printf("Response length: %d characters\n", len(response))
-			fmt.Printf("First 100 characters: %s\n", response[:min(100, len(response))])
+			if p.verbose {
+				fmt.Printf("\n==== DEBUG: Writing to file %s ====\n", outputPath)
+				fmt.Printf("Response length: %d characters\n", len(response))
+				fmt.Printf("First 100 characters: %s\n", response[:min(100, len(response))])
+			}
 
 			if err := os.WriteFile(outputPath, []byte(response), 0644); err != nil {
 				errMsg := fmt.Sprintf("failed to write response to file %s: %v", outputPath, err)
@@ -110,9 +108,45 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 			p.debugf("Response successfully written to file: %s", outputPath)
 
 			// Print a message to the console to inform the user
-			fmt.Printf("\nResponse written to file: %s\n", outputPath)
-			fmt.Printf("==== END DEBUG ====\n\n")
+			config.InfoLog("\nResponse written to file: %s", outputPath)
+			if p.verbose {
+				fmt.Printf("==== END DEBUG ====\n\n")
+			}
 		}
 	}
 	return nil
 }
+
+// resolveOutputPath returns the path an output file is written to, based on
+// server mode and runtime directory, creating its directory
+func (p *Processor) resolveOutputPath(output string) (string, error) {
+	outputPath := output
+	if sb := p.getSandbox(); sb != nil {
+		resolved, err := sb.Resolve(output)
+		if err != nil {
+			return "", fmt.Errorf("output '%s' rejected: %w", output, err)
+		}
+		outputPath = resolved
+		p.debugf("Resolved output path: %s", outputPath)
+	} else if p.serverConfig != nil {
+		if p.runtimeDir != "" {
+			// When runtime directory is set, treat all output paths as relative to it
+			p.debugf("Using runtime directory: %s, output path: %s", p.runtimeDir, output)
+			outputPath = filepath.Join(p.serverConfig.DataDir, p.runtimeDir, output)
+		} else {
+			// No runtime directory, use DataDir directly
+			outputPath = filepath.Join(p.serverConfig.DataDir, output)
+		}
+		p.debugf("Resolved output path: %s", outputPath)
+	}
+
+	// Create directory if it doesn't exist
+	dir := filepath.Dir(outputPath)
+	if dir != "." {
+		p.debugf("Creating directory if it doesn't exist: %s", dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	return outputPath, nil
+}
@@ -178,3 +178,38 @@ func TestHandleOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleOutputSandbox(t *testing.T) {
+	dataDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	proc := &Processor{
+		serverConfig: &config.ServerConfig{
+			Enabled: true,
+			DataDir: dataDir,
+		},
+		runtimeDir: "runtime",
+	}
+
+	rejected := []string{
+		"../escape.txt",
+		"../../escape.txt",
+		filepath.Join(outsideDir, "escape.txt"),
+	}
+	for _, output := range rejected {
+		if err := proc.handleOutput("test-model", "content", []string{output}, nil); err == nil {
+			t.Errorf("handleOutput(%q) expected sandbox rejection", output)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("escape.txt should not have been written to the data directory")
+	}
+
+	if err := proc.handleOutput("test-model", "content", []string{"ok.txt"}, nil); err != nil {
+		t.Fatalf("handleOutput() unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "runtime", "ok.txt")); err != nil {
+		t.Errorf("expected output inside runtime directory: %v", err)
+	}
+}
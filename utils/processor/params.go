@@ -0,0 +1,238 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Param types
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamNumber = "number"
+	ParamBool   = "bool"
+	ParamFile   = "file"
+)
+
+// Param declares a workflow parameter in the params section
+type Param struct {
+	Type        string      `yaml:"type"`        // string (default), int, number, bool or file
+	Default     interface{} `yaml:"default"`     // Used when no value is given
+	Required    bool        `yaml:"required"`    // A value must be given when there is no default
+	Description string      `yaml:"description"` // Shown when a value is missing or invalid
+	Choices     []string    `yaml:"choices"`     // Allowed values, if limited
+}
+
+// paramPlaceholderPattern matches {{ params.NAME }} placeholders
+var paramPlaceholderPattern = regexp.MustCompile(`\{\{\s*params\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// ParseParamArgs parses name=value arguments, as given after -- on the
+// command line
+func ParseParamArgs(args []string) (map[string]string, error) {
+	values := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid parameter '%s': expected name=value", arg)
+		}
+		if _, dup := values[name]; dup {
+			return nil, fmt.Errorf("parameter '%s' is given more than once", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// BindParams checks values against the workflow's params section, fills in
+// defaults, and replaces every {{ params.NAME }} placeholder in the workflow
+// with its value. It returns the workflow ready to parse, and an error
+// listing every missing, unknown or invalid parameter.
+func BindParams(data []byte, values map[string]string) ([]byte, error) {
+	if len(values) == 0 && !strings.Contains(string(data), "params") {
+		return data, nil
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error parsing workflow: %w", err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return data, nil
+	}
+	doc := root.Content[0]
+
+	var declared map[string]Param
+	var paramsNode *yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "params" {
+			paramsNode = doc.Content[i+1]
+			if err := paramsNode.Decode(&declared); err != nil {
+				return nil, fmt.Errorf("failed to decode params section: %w", err)
+			}
+		}
+	}
+
+	resolved, err := resolveParams(declared, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var undeclared []string
+	replaced := false
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node == paramsNode {
+			return
+		}
+		if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "params.") {
+			node.Value = paramPlaceholderPattern.ReplaceAllStringFunc(node.Value, func(match string) string {
+				name := paramPlaceholderPattern.FindStringSubmatch(match)[1]
+				value, ok := resolved[name]
+				if !ok {
+					undeclared = append(undeclared, name)
+					return match
+				}
+				replaced = true
+				return value
+			})
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	if len(undeclared) > 0 {
+		return nil, fmt.Errorf("workflow uses undeclared parameter(s): %s (add them to the params section)", strings.Join(undeclared, ", "))
+	}
+	if !replaced {
+		return data, nil
+	}
+	out, err := yaml.Marshal(&root)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding workflow: %w", err)
+	}
+	return out, nil
+}
+
+// resolveParams validates values against the declarations and returns the
+// value of every parameter that has one
+func resolveParams(declared map[string]Param, values map[string]string) (map[string]string, error) {
+	var problems []string
+	for _, name := range sortedKeys(values) {
+		if _, ok := declared[name]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown parameter '%s'", name))
+		}
+	}
+
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resolved := make(map[string]string, len(declared))
+	for _, name := range names {
+		param := declared[name]
+		value, given := values[name]
+		if !given {
+			if param.Default == nil {
+				if param.Required {
+					problems = append(problems, fmt.Sprintf("missing required parameter '%s'%s", name, param.describe()))
+				}
+				resolved[name] = "" // Optional parameters without a value are empty
+				continue
+			}
+			value = fmt.Sprint(param.Default)
+		}
+		normalized, err := param.check(value)
+		if err != nil {
+			source := "value"
+			if !given {
+				source = "default"
+			}
+			problems = append(problems, fmt.Sprintf("invalid %s for parameter '%s': %v%s", source, name, err, param.describe()))
+			continue
+		}
+		resolved[name] = normalized
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("parameter error(s):\n- %s", strings.Join(problems, "\n- "))
+	}
+	return resolved, nil
+}
+
+// check validates a value against the parameter's type and choices, and
+// returns it in canonical form
+func (p Param) check(value string) (string, error) {
+	switch p.Type {
+	case "", ParamString:
+	case ParamInt:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not an integer", value)
+		}
+		value = strconv.Itoa(n)
+	case ParamNumber:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not a number", value)
+		}
+		value = strconv.FormatFloat(f, 'f', -1, 64)
+	case ParamBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not true or false", value)
+		}
+		value = strconv.FormatBool(b)
+	case ParamFile:
+		if _, err := os.Stat(value); err != nil {
+			return "", fmt.Errorf("file '%s' does not exist", value)
+		}
+	default:
+		return "", fmt.Errorf("unknown type '%s' (use string, int, number, bool or file)", p.Type)
+	}
+
+	if len(p.Choices) > 0 {
+		for _, choice := range p.Choices {
+			if value == choice {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("'%s' is not one of %s", value, strings.Join(p.Choices, ", "))
+	}
+	return value, nil
+}
+
+// validateDeclaration checks the parameter's type, and its default against
+// the type and choices. File defaults are checked when the workflow runs.
+func (p Param) validateDeclaration() error {
+	switch p.Type {
+	case "", ParamString, ParamInt, ParamNumber, ParamBool, ParamFile:
+	default:
+		return fmt.Errorf("unknown type '%s' (use string, int, number, bool or file)", p.Type)
+	}
+	if p.Default == nil || p.Type == ParamFile {
+		return nil
+	}
+	if _, err := p.check(fmt.Sprint(p.Default)); err != nil {
+		return fmt.Errorf("invalid default: %w", err)
+	}
+	return nil
+}
+
+// describe returns the description for error messages
+func (p Param) describe() string {
+	if p.Description == "" {
+		return ""
+	}
+	return " (" + p.Description + ")"
+}
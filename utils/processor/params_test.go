@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const paramsWorkflow = `
+params:
+  repo:
+    required: true
+    description: Repository name
+  pr:
+    type: int
+    required: true
+  depth:
+    type: int
+    default: 2
+  tone:
+    choices: [brief, detailed]
+    default: brief
+  dry_run:
+    type: bool
+review:
+  input: NA
+  model: NA
+  action: "Review PR {{ params.pr }} in {{ params.repo }} ({{ params.tone }}, depth {{ params.depth }}, dry run '{{ params.dry_run }}')"
+  output: STDOUT
+`
+
+func TestParseParamArgs(t *testing.T) {
+	values, err := ParseParamArgs([]string{"repo=foo", "query=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("ParseParamArgs() error = %v", err)
+	}
+	if values["repo"] != "foo" || values["query"] != "a=b" || values["empty"] != "" {
+		t.Errorf("ParseParamArgs() = %v", values)
+	}
+
+	for _, args := range [][]string{{"repo"}, {"=foo"}, {"repo=a", "repo=b"}} {
+		if _, err := ParseParamArgs(args); err == nil {
+			t.Errorf("ParseParamArgs(%v) expected an error", args)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	data, err := BindParams([]byte(paramsWorkflow), map[string]string{"repo": "comanda", "pr": "0123", "dry_run": "1"})
+	if err != nil {
+		t.Fatalf("BindParams() error = %v", err)
+	}
+
+	var cfg DSLConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want := "Review PR 123 in comanda (brief, depth 2, dry run 'true')"
+	if got := cfg.Steps[0].Config.Action; got != want {
+		t.Errorf("action = %q, want %q", got, want)
+	}
+	if len(cfg.Params) != 5 || cfg.Params["pr"].Type != ParamInt {
+		t.Errorf("Params = %+v", cfg.Params)
+	}
+	if len(cfg.Steps) != 1 {
+		t.Errorf("expected params not to be parsed as a step, got %d steps", len(cfg.Steps))
+	}
+}
+
+func TestBindParamsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   []string
+	}{
+		{"missing required", map[string]string{"pr": "1"}, []string{"missing required parameter 'repo' (Repository name)"}},
+		{"bad int", map[string]string{"repo": "x", "pr": "abc"}, []string{"invalid value for parameter 'pr'", "not an integer"}},
+		{"bad choice", map[string]string{"repo": "x", "pr": "1", "tone": "loud"}, []string{"'loud' is not one of brief, detailed"}},
+		{"unknown", map[string]string{"repo": "x", "pr": "1", "branch": "main"}, []string{"unknown parameter 'branch'"}},
+		{"all reported", map[string]string{"pr": "x"}, []string{"'repo'", "'pr'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := BindParams([]byte(paramsWorkflow), tt.values)
+			if err == nil {
+				t.Fatal("BindParams() expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBindParamsUndeclared(t *testing.T) {
+	workflow := `
+step:
+  input: NA
+  model: NA
+  action: "Use {{ params.missing }}"
+  output: STDOUT
+`
+	_, err := BindParams([]byte(workflow), nil)
+	if err == nil || !strings.Contains(err.Error(), "undeclared parameter(s): missing") {
+		t.Errorf("BindParams() error = %v, want undeclared parameter error", err)
+	}
+}
+
+func TestBindParamsUnchanged(t *testing.T) {
+	workflow := []byte("# comment kept\nstep:\n  input: NA\n  model: NA\n  action: hello\n  output: STDOUT\n")
+	data, err := BindParams(workflow, nil)
+	if err != nil {
+		t.Fatalf("BindParams() error = %v", err)
+	}
+	if string(data) != string(workflow) {
+		t.Errorf("BindParams() rewrote a workflow without params:\n%s", data)
+	}
+}
+
+func TestBindParamsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workflow := `
+params:
+  notes:
+    type: file
+step:
+  input: "{{ params.notes }}"
+  model: NA
+  action: hello
+  output: STDOUT
+`
+	data, err := BindParams([]byte(workflow), map[string]string{"notes": path})
+	if err != nil {
+		t.Fatalf("BindParams() error = %v", err)
+	}
+	if !strings.Contains(string(data), path) {
+		t.Errorf("input was not bound to %s:\n%s", path, data)
+	}
+
+	if _, err := BindParams([]byte(workflow), map[string]string{"notes": path + ".missing"}); err == nil {
+		t.Error("BindParams() expected an error for a missing file")
+	}
+}
+
+func TestValidateParamDeclarations(t *testing.T) {
+	cfg := DSLConfig{Params: map[string]Param{
+		"count": {Type: ParamInt, Default: "lots"},
+		"kind":  {Type: "list"},
+		"ok":    {Type: ParamBool, Default: true},
+	}}
+	if err := cfg.Params["ok"].validateDeclaration(); err != nil {
+		t.Errorf("validateDeclaration(ok) error = %v", err)
+	}
+	if err := cfg.Params["count"].validateDeclaration(); err == nil || !strings.Contains(err.Error(), "invalid default") {
+		t.Errorf("validateDeclaration(count) error = %v", err)
+	}
+	if err := cfg.Params["kind"].validateDeclaration(); err == nil || !strings.Contains(err.Error(), "unknown type 'list'") {
+		t.Errorf("validateDeclaration(kind) error = %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPolicy is wrapped by the error of a run refused because a step breaks
+// the env config's model policy
+var ErrPolicy = errors.New("refused by the model policy")
+
+// stepType returns the type of a step as default_models of the model
+// policy names it: standard, generate, process or the step's own type
+func stepType(cfg StepConfig) string {
+	switch {
+	case cfg.Generate != nil:
+		return "generate"
+	case cfg.Process != nil:
+		return "process"
+	case cfg.Type != "":
+		return cfg.Type
+	}
+	return "standard"
+}
+
+// applyDefaultModels gives steps that name no model the policy's default
+// model for their type
+func (p *Processor) applyDefaultModels() {
+	policy := p.envConfig.PolicySettings()
+	if len(policy.DefaultModels) == 0 {
+		return
+	}
+	apply := func(cfg *StepConfig) {
+		model := policy.DefaultModel(stepType(*cfg))
+		switch {
+		case model == "":
+		case cfg.Generate != nil:
+			if cfg.Generate.Model == nil {
+				cfg.Generate.Model = model
+			}
+		case cfg.Process != nil, cfg.Type == "validate-data", isVectorStep(*cfg):
+		case cfg.Model == nil:
+			cfg.Model = model
+		}
+	}
+	for i := range p.config.Steps {
+		apply(&p.config.Steps[i].Config)
+	}
+	for _, steps := range p.config.ParallelSteps {
+		for i := range steps {
+			apply(&steps[i].Config)
+		}
+	}
+	for name, cfg := range p.config.Defer {
+		apply(&cfg)
+		p.config.Defer[name] = cfg
+	}
+}
+
+// policyErrors lists how a step breaks the model policy
+func (p *Processor) policyErrors(step Step) []string {
+	policy := p.envConfig.PolicySettings()
+	var errs []string
+	if err := policy.CheckTemperature(step.Config.Temperature); err != nil {
+		errs = append(errs, err.Error())
+	}
+	modelNames := p.stepModels(step.Config)
+	if step.Config.Generate != nil && len(modelNames) == 0 && p.envConfig != nil && p.envConfig.DefaultGenerationModel != "" {
+		modelNames = []string{p.envConfig.DefaultGenerationModel}
+	}
+	for _, modelName := range modelNames {
+		if err := policy.CheckModel(modelName); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if provider := p.detectProvider(modelName); provider != nil {
+			if err := policy.CheckProvider(provider.Name()); err != nil {
+				errs = append(errs, fmt.Sprintf("model %s: %v", modelName, err))
+			}
+		}
+	}
+	return errs
+}
+
+// checkPolicy returns an error wrapping ErrPolicy when a step of the
+// workflow breaks the model policy
+func (p *Processor) checkPolicy() error {
+	policy := p.envConfig.PolicySettings()
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("invalid model policy: %w", err)
+	}
+	for _, step := range p.workflowSteps() {
+		if errs := p.policyErrors(step); len(errs) > 0 {
+			return fmt.Errorf("%w: step '%s': %s", ErrPolicy, step.Name, errs[0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestPolicyRefusesRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.Policy
+		step   func(*StepConfig) // Changes the second step
+		want   string
+	}{
+		{"denied model", config.Policy{DeniedModels: []string{"*-preview"}}, func(c *StepConfig) { c.Model = "o1-preview" }, "step 'second': model o1-preview is in denied_models (matches '*-preview')"},
+		{"provider", config.Policy{AllowedProviders: []string{"anthropic"}}, func(c *StepConfig) {}, "step 'first': model gpt-4o: provider openai is not in allowed_providers (anthropic)"},
+		{"temperature", config.Policy{MaxTemperature: 0.7}, func(c *StepConfig) { c.Temperature = 1.2 }, "step 'second': temperature 1.2 is above max_temperature 0.7"},
+	}
+	for _, tt := range tests {
+		provider := withInterruptingProvider(t, 0, nil)
+		envConfig := createTestEnvConfig()
+		policy := tt.policy
+		envConfig.Policy = &policy
+		dsl := checkpointTestConfig("first", "second")
+		tt.step(&dsl.Steps[1].Config)
+
+		err := NewProcessor(dsl, envConfig, createTestServerConfig(), false).Process()
+		if !errors.Is(err, ErrPolicy) {
+			t.Errorf("%s: Process() error = %v, want ErrPolicy", tt.name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+		if provider.calls != 0 {
+			t.Errorf("%s: provider called %d times before the policy was checked", tt.name, provider.calls)
+		}
+	}
+}
+
+func TestPolicyDefaultModels(t *testing.T) {
+	withInterruptingProvider(t, 0, nil)
+	envConfig := createTestEnvConfig()
+	envConfig.Policy = &config.Policy{DefaultModels: map[string]string{"default": "gpt-4o-mini", "generate": "gpt-4"}}
+	dsl := checkpointTestConfig("first")
+	dsl.Steps[0].Config.Model = nil
+	dsl.Steps = append(dsl.Steps, Step{Name: "plan", Config: StepConfig{Generate: &GenerateStepConfig{Action: "Plan", Output: "plan.yaml"}}})
+
+	proc := NewProcessor(dsl, envConfig, createTestServerConfig(), false)
+	proc.applyDefaultModels()
+	if got := proc.config.Steps[0].Config.Model; got != "gpt-4o-mini" {
+		t.Errorf("standard step model = %v, want gpt-4o-mini", got)
+	}
+	if got := proc.config.Steps[1].Config.Generate.Model; got != "gpt-4" {
+		t.Errorf("generate step model = %v, want gpt-4", got)
+	}
+	if issues := proc.Validate(); len(issues) > 0 {
+		t.Errorf("Validate() = %v", issues)
+	}
+}
@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Post-processing operations applied to a step's response before it is written out
+const (
+	PostprocessStripFences  = "strip_fences"             // Remove a markdown fence wrapping the whole response
+	PostprocessExtractFirst = "extract_first_code_block" // Keep only the first fenced code block
+	PostprocessExtractLast  = "extract_last_code_block"  // Keep only the last fenced code block
+	PostprocessTrim         = "trim"                     // Trim leading and trailing whitespace
+	PostprocessUnescapeJSON = "unescape_json"            // Decode a response that is a JSON-encoded string
+)
+
+// postprocessOperations lists the valid operations for error messages
+const postprocessOperations = "strip_fences, extract_first_code_block, extract_last_code_block, trim, unescape_json"
+
+// codeBlockPattern matches fenced markdown code blocks, capturing their body
+var codeBlockPattern = regexp.MustCompile("(?s)```[^\n]*\n(.*?)```")
+
+// validatePostprocess checks that every configured operation is known
+func validatePostprocess(ops []string) []string {
+	var errors []string
+	for _, op := range ops {
+		switch op {
+		case PostprocessStripFences, PostprocessExtractFirst, PostprocessExtractLast, PostprocessTrim, PostprocessUnescapeJSON:
+		default:
+			errors = append(errors, fmt.Sprintf("unknown postprocess operation '%s' (expected one of: %s)", op, postprocessOperations))
+		}
+	}
+	return errors
+}
+
+// postprocess applies the step's postprocess operations to a response, in order
+func (p *Processor) postprocess(step Step, response string) (string, error) {
+	ops := p.NormalizeStringSlice(step.Config.Postprocess)
+	for _, op := range ops {
+		var err error
+		response, err = applyPostprocess(op, response)
+		if err != nil {
+			return "", fmt.Errorf("postprocess '%s' failed for step '%s': %w", op, step.Name, err)
+		}
+		p.debugf("Applied postprocess '%s' to step '%s' output", op, step.Name)
+	}
+	return response, nil
+}
+
+// applyPostprocess runs a single post-processing operation
+func applyPostprocess(op, response string) (string, error) {
+	switch op {
+	case PostprocessStripFences:
+		return stripCodeFence(response), nil
+	case PostprocessExtractFirst, PostprocessExtractLast:
+		blocks := codeBlockPattern.FindAllStringSubmatch(response, -1)
+		if len(blocks) == 0 {
+			return "", fmt.Errorf("no fenced code block found in response")
+		}
+		if op == PostprocessExtractFirst {
+			return blocks[0][1], nil
+		}
+		return blocks[len(blocks)-1][1], nil
+	case PostprocessTrim:
+		return strings.TrimSpace(response), nil
+	case PostprocessUnescapeJSON:
+		trimmed := strings.TrimSpace(response)
+		if !strings.HasPrefix(trimmed, `"`) {
+			return response, nil // Not an encoded string, leave as-is
+		}
+		var decoded string
+		if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+			return "", fmt.Errorf("response is not a valid JSON string: %w", err)
+		}
+		return decoded, nil
+	default:
+		return "", fmt.Errorf("unknown operation")
+	}
+}
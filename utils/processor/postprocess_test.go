@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyPostprocess(t *testing.T) {
+	response := "Here is the script:\n\n```python\nprint('one')\n```\n\nAnd a test:\n\n```python\nassert True\n```\n"
+
+	tests := []struct {
+		name      string
+		op        string
+		input     string
+		want      string
+		expectErr bool
+	}{
+		{name: "strip fences", op: PostprocessStripFences, input: "```json\n{\"a\": 1}\n```", want: "{\"a\": 1}\n"},
+		{name: "strip fences leaves plain text", op: PostprocessStripFences, input: "plain", want: "plain"},
+		{name: "extract first code block", op: PostprocessExtractFirst, input: response, want: "print('one')\n"},
+		{name: "extract last code block", op: PostprocessExtractLast, input: response, want: "assert True\n"},
+		{name: "extract without code block", op: PostprocessExtractFirst, input: "no code here", expectErr: true},
+		{name: "trim", op: PostprocessTrim, input: "  \nvalue\n\n", want: "value"},
+		{name: "unescape json string", op: PostprocessUnescapeJSON, input: `"{\"a\": \"b\\nc\"}"`, want: "{\"a\": \"b\\nc\"}"},
+		{name: "unescape leaves objects alone", op: PostprocessUnescapeJSON, input: `{"a": 1}`, want: `{"a": 1}`},
+		{name: "unescape invalid string", op: PostprocessUnescapeJSON, input: `"unterminated`, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyPostprocess(tt.op, tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("applyPostprocess() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !tt.expectErr && got != tt.want {
+				t.Errorf("applyPostprocess() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostprocessValidationAndOrder(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+
+	step := Step{
+		Name: "codegen",
+		Config: StepConfig{
+			Input:       "NA",
+			Model:       "gpt-4o",
+			Action:      "write code",
+			Output:      "STDOUT",
+			Postprocess: []interface{}{"extract_last_code_block", "trim"},
+		},
+	}
+	if err := proc.validateStepConfig(step.Name, step.Config); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	got, err := proc.postprocess(step, "```go\nfmt.Println()\n```\n")
+	if err != nil {
+		t.Fatalf("postprocess() error = %v", err)
+	}
+	if got != "fmt.Println()" {
+		t.Errorf("postprocess() = %q, want %q", got, "fmt.Println()")
+	}
+
+	step.Config.Postprocess = "strip_everything"
+	if err := proc.validateStepConfig(step.Name, step.Config); err == nil || !strings.Contains(err.Error(), "unknown postprocess operation") {
+		t.Errorf("expected unknown operation error, got %v", err)
+	}
+}
@@ -1,5 +1,15 @@
 package processor
 
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/retry"
+)
+
 // ProgressType represents different types of progress updates
 type ProgressType int
 
@@ -10,6 +20,11 @@ const (
 	ProgressError
 	ProgressOutput       // New type for output events
 	ProgressParallelStep // New type for parallel step updates
+	ProgressStepStarted  // A step started running
+	ProgressStepFinished // A step finished, with its metrics and any error
+	ProgressChunk        // A step started on one of the files or chunks it processes in turn
+	ProgressDelta        // A streaming response received more text
+	ProgressRetry        // A provider is waiting to retry a rate-limited request
 )
 
 // StepInfo contains detailed information about a processing step
@@ -30,6 +45,24 @@ type ProgressUpdate struct {
 	IsParallel         bool                // Whether this update is from a parallel step
 	ParallelID         string              // Identifier for the parallel step group
 	PerformanceMetrics *PerformanceMetrics // Performance metrics for the step
+	Chunk              int                 // Number of the chunk, from 1, when Type is ProgressChunk
+	Chunks             int                 // Number of chunks the step processes
+	Delta              string              // Text received when Type is ProgressDelta
+	Attempt            int                 // Number of the retry, from 1, when Type is ProgressRetry
+	MaxAttempts        int                 // Retries allowed before the request fails
+	Wait               time.Duration       // Time waited before retrying
+	Provider           string              // Provider retrying the request
+}
+
+// Response returns the response in a ProgressOutput update without the
+// performance metrics appended to it for display
+func (u ProgressUpdate) Response() string {
+	if u.PerformanceMetrics != nil {
+		if i := strings.LastIndex(u.Stdout, "\n\nPerformance Metrics:"); i >= 0 {
+			return u.Stdout[:i]
+		}
+	}
+	return u.Stdout
 }
 
 // ProgressWriter is an interface for handling progress updates
@@ -50,3 +83,98 @@ func (w *channelProgressWriter) WriteProgress(update ProgressUpdate) error {
 	w.ch <- update
 	return nil
 }
+
+// ProgressFunc adapts a function to a ProgressWriter
+type ProgressFunc func(update ProgressUpdate) error
+
+// WriteProgress calls f(update)
+func (f ProgressFunc) WriteProgress(update ProgressUpdate) error {
+	return f(update)
+}
+
+// newStepInfo describes a step for progress updates
+func newStepInfo(step Step) *StepInfo {
+	info := &StepInfo{
+		Name:   step.Name,
+		Model:  fmt.Sprintf("%v", step.Config.Model),
+		Action: fmt.Sprintf("%v", step.Config.Action),
+	}
+	if step.Config.Generate != nil {
+		info.Model = fmt.Sprintf("%v", step.Config.Generate.Model)
+		info.Action = fmt.Sprintf("%v", step.Config.Generate.Action)
+	} else if step.Config.Process != nil {
+		info.Action = fmt.Sprintf("Process workflow: %s", step.Config.Process.WorkflowFile)
+		info.Model = "N/A"
+	}
+	if step.Config.Type == "openai-responses" {
+		info.Instructions = step.Config.Instructions
+	}
+	return info
+}
+
+// emit sends a typed progress update if a progress writer is configured
+func (p *Processor) emit(update ProgressUpdate) {
+	if p.progress != nil {
+		p.progress.WriteProgress(update)
+	}
+}
+
+// emitChunk reports that a step started on chunk n of total
+func (p *Processor) emitChunk(stepName string, n, total int) {
+	msg := fmt.Sprintf("Processing chunk %d/%d of step %s", n, total, stepName)
+	config.WriteLog("[RUN] ", "%s", msg)
+	p.emit(ProgressUpdate{
+		Type:    ProgressChunk,
+		Message: msg,
+		Step:    p.runningStep(stepName),
+		Chunk:   n,
+		Chunks:  total,
+	})
+}
+
+// reportRetries makes a provider report its retries as progress updates
+func (p *Processor) reportRetries(provider models.Provider) {
+	if reporter, ok := provider.(models.RetryReporter); ok {
+		name := provider.Name()
+		reporter.SetRetryHook(func(attempt retry.Attempt) {
+			p.emitRetry(name, attempt)
+		})
+	}
+}
+
+// emitRetry reports a provider's retry, printing it when there is no
+// progress writer. Providers are shared by the steps of a run, so the retry
+// is only attributed to a step when one step is running.
+func (p *Processor) emitRetry(provider string, attempt retry.Attempt) {
+	config.WriteLog("[RUN] ", "%s: %s", provider, attempt)
+	if p.progress == nil {
+		fmt.Println(attempt)
+		return
+	}
+	p.emit(ProgressUpdate{
+		Type:        ProgressRetry,
+		Message:     attempt.String(),
+		Step:        p.runningStep(""),
+		Attempt:     attempt.Attempt,
+		MaxAttempts: attempt.MaxRetries,
+		Wait:        attempt.Wait,
+		Provider:    provider,
+	})
+}
+
+// runningStep returns the step named name, or when name is empty the only
+// running step, if exactly one is running
+func (p *Processor) runningStep(name string) *StepInfo {
+	if name != "" {
+		return &StepInfo{Name: name}
+	}
+	var running []string
+	p.stepContexts.Range(func(key, _ interface{}) bool {
+		running = append(running, key.(string))
+		return len(running) < 2
+	})
+	if len(running) != 1 {
+		return nil
+	}
+	return &StepInfo{Name: running[0]}
+}
@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/retry"
+)
+
+// progressLog collects the progress updates of a run
+type progressLog struct {
+	mu      sync.Mutex
+	updates []ProgressUpdate
+}
+
+func (l *progressLog) WriteProgress(update ProgressUpdate) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.updates = append(l.updates, update)
+	return nil
+}
+
+// typed returns the updates of the given types
+func (l *progressLog) typed(types ...ProgressType) []ProgressUpdate {
+	var updates []ProgressUpdate
+	for _, update := range l.updates {
+		for _, t := range types {
+			if update.Type == t {
+				updates = append(updates, update)
+			}
+		}
+	}
+	return updates
+}
+
+func TestProgressEvents(t *testing.T) {
+	withInterruptingProvider(t, 0, nil)
+
+	var log progressLog
+	proc := NewProcessor(checkpointTestConfig("first", "second"), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(&log)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	steps := log.typed(ProgressStepStarted, ProgressStepFinished)
+	want := []struct {
+		typ  ProgressType
+		name string
+	}{
+		{ProgressStepStarted, "first"}, {ProgressStepFinished, "first"},
+		{ProgressStepStarted, "second"}, {ProgressStepFinished, "second"},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("got %d step events, want %d: %+v", len(steps), len(want), steps)
+	}
+	for i, w := range want {
+		if steps[i].Type != w.typ || steps[i].Step == nil || steps[i].Step.Name != w.name || steps[i].Step.Model != "gpt-4o" {
+			t.Errorf("event %d = %+v, want type %v for %s", i, steps[i], w.typ, w.name)
+		}
+	}
+	if finished := steps[1]; finished.Error != nil || finished.PerformanceMetrics == nil || finished.PerformanceMetrics.CompletionTokens == 0 {
+		t.Errorf("finished event = %+v, want metrics and no error", finished)
+	}
+
+	outputs := log.typed(ProgressOutput)
+	if len(outputs) != 2 || outputs[0].Step == nil || outputs[0].Step.Model != "gpt-4o" {
+		t.Errorf("output events = %+v, want one per step naming the model", outputs)
+	}
+}
+
+// retryingProvider is a provider that reports its retries
+type retryingProvider struct {
+	MockProvider
+	hook func(retry.Attempt)
+}
+
+func (r *retryingProvider) SetRetryHook(hook func(retry.Attempt)) {
+	r.hook = hook
+}
+
+func TestProgressRetry(t *testing.T) {
+	var log progressLog
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(&log)
+
+	provider := &retryingProvider{MockProvider: MockProvider{name: "openai"}}
+	proc.reportRetries(provider)
+	if provider.hook == nil {
+		t.Fatal("reportRetries() did not set the retry hook")
+	}
+
+	proc.stepContexts.Store("review", nil)
+	provider.hook(retry.Attempt{Attempt: 2, MaxRetries: 5, Wait: 4 * time.Second})
+	proc.stepContexts.Store("publish", nil)
+	provider.hook(retry.Attempt{Attempt: 1, MaxRetries: 5, Wait: time.Second})
+
+	retries := log.typed(ProgressRetry)
+	if len(retries) != 2 {
+		t.Fatalf("got %d retry events, want 2", len(retries))
+	}
+	first := retries[0]
+	if first.Step == nil || first.Step.Name != "review" || first.Provider != "openai" || first.Attempt != 2 ||
+		first.MaxAttempts != 5 || first.Wait != 4*time.Second || first.Message != "Rate limit detected, retrying in 4s (attempt 2/5)..." {
+		t.Errorf("retry event = %+v", first)
+	}
+	if retries[1].Step != nil {
+		t.Errorf("retry while two steps run attributed to %s", retries[1].Step.Name)
+	}
+}
+
+func TestProgressUpdateResponse(t *testing.T) {
+	update := ProgressUpdate{
+		Type:               ProgressOutput,
+		Stdout:             "answer\n\nPerformance Metrics:\n- Input processing: 1 ms\n",
+		PerformanceMetrics: &PerformanceMetrics{},
+	}
+	if got := update.Response(); got != "answer" {
+		t.Errorf("Response() = %q, want the response without metrics", got)
+	}
+	update.PerformanceMetrics = nil
+	if got := update.Response(); got != update.Stdout {
+		t.Errorf("Response() = %q, want Stdout unchanged without metrics", got)
+	}
+}
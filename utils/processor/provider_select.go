@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// pinProviders records the provider a step pins its models to. A pin applies
+// to the model name for the whole workflow, so conflicting pins are rejected.
+func (p *Processor) pinProviders(step Step) error {
+	if step.Config.Provider == "" {
+		return nil
+	}
+	if p.pinnedProviders == nil {
+		p.pinnedProviders = make(map[string]string)
+	}
+	for _, modelName := range p.NormalizeStringSlice(step.Config.Model) {
+		if modelName == "NA" {
+			continue
+		}
+		if existing, ok := p.pinnedProviders[modelName]; ok && existing != step.Config.Provider {
+			return fmt.Errorf("model %s is pinned to provider %s in another step, step '%s' pins it to %s",
+				modelName, existing, step.Name, step.Config.Provider)
+		}
+		p.pinnedProviders[modelName] = step.Config.Provider
+		p.debugf("Step '%s' pins model %s to provider %s", step.Name, modelName, step.Config.Provider)
+	}
+	return nil
+}
+
+// ProviderResolver returns the provider to use for a model, or nil if none
+type ProviderResolver func(modelName string) models.Provider
+
+// SetProviderResolver routes every model to the provider returned by resolve.
+// Resolved providers are used as-is: they are not configured with API keys and
+// their models need not be enabled in the env config. comanda test uses this to
+// replay recorded responses.
+func (p *Processor) SetProviderResolver(resolve ProviderResolver) {
+	p.resolver = resolve
+}
+
+// detectProvider resolves the provider for a model: a provider resolver wins,
+// then an explicit step pin, then the provider_priority order from the env
+// config, then the default detection
+func (p *Processor) detectProvider(modelName string) models.Provider {
+	if p.resolver != nil {
+		return p.resolver(modelName)
+	}
+	if providerName, ok := p.pinnedProviders[modelName]; ok {
+		return models.ProviderByName(providerName)
+	}
+	if p.envConfig != nil && len(p.envConfig.ProviderPriority) > 0 {
+		return models.DetectProviderWithPriority(modelName, p.envConfig.ProviderPriority)
+	}
+	return models.DetectProvider(modelName)
+}
+
+// applyModelAliases replaces the model aliases steps name with the models
+// they stand for
+func (p *Processor) applyModelAliases() {
+	if p.envConfig == nil || len(p.envConfig.ModelAliases) == 0 {
+		return
+	}
+	resolve := func(model interface{}) interface{} {
+		switch m := model.(type) {
+		case string:
+			return p.envConfig.ResolveModel(m)
+		case []interface{}:
+			resolved := make([]interface{}, len(m))
+			for i, name := range m {
+				if s, ok := name.(string); ok {
+					resolved[i] = p.envConfig.ResolveModel(s)
+				} else {
+					resolved[i] = name
+				}
+			}
+			return resolved
+		}
+		return model
+	}
+	apply := func(cfg *StepConfig) {
+		cfg.Model = resolve(cfg.Model)
+		if cfg.Generate != nil {
+			cfg.Generate.Model = resolve(cfg.Generate.Model)
+		}
+		if cfg.Ensemble != nil && cfg.Ensemble.JudgeModel != "" {
+			cfg.Ensemble.JudgeModel = p.envConfig.ResolveModel(cfg.Ensemble.JudgeModel)
+		}
+	}
+	for i := range p.config.Steps {
+		apply(&p.config.Steps[i].Config)
+	}
+	for _, steps := range p.config.ParallelSteps {
+		for i := range steps {
+			apply(&steps[i].Config)
+		}
+	}
+	for name, cfg := range p.config.Defer {
+		apply(&cfg)
+		p.config.Defer[name] = cfg
+	}
+}
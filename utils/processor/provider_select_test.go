@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPinProviders(t *testing.T) {
+	cfg := &DSLConfig{
+		Steps: []Step{
+			{
+				Name: "pinned",
+				Config: StepConfig{
+					Input:    "NA",
+					Model:    "gpt-4o",
+					Action:   "say hello",
+					Output:   "STDOUT",
+					Provider: "openai",
+				},
+			},
+		},
+	}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := proc.pinnedProviders["gpt-4o"]; got != "openai" {
+		t.Errorf("pinnedProviders[gpt-4o] = %q, want openai", got)
+	}
+	if provider := proc.detectProvider("gpt-4o"); provider == nil || provider.Name() != "openai" {
+		t.Errorf("detectProvider() did not honour the pin")
+	}
+
+	// A second step pinning the same model elsewhere is rejected
+	conflicting := Step{Name: "other", Config: cfg.Steps[0].Config}
+	conflicting.Config.Provider = "anthropic"
+	if err := proc.pinProviders(conflicting); err == nil || !strings.Contains(err.Error(), "pinned to provider openai") {
+		t.Errorf("expected conflicting pin error, got %v", err)
+	}
+}
+
+func TestUnknownProviderValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+	step := StepConfig{
+		Input:    "NA",
+		Model:    "gpt-4o",
+		Action:   "say hello",
+		Output:   "STDOUT",
+		Provider: "nonexistent",
+	}
+	if err := proc.validateStepConfig("bad", step); err == nil || !strings.Contains(err.Error(), "unknown provider") {
+		t.Errorf("expected unknown provider error, got %v", err)
+	}
+}
+
+func TestDetectProviderWithPriority(t *testing.T) {
+	envConfig := createTestEnvConfig()
+	envConfig.ProviderPriority = []string{"anthropic", "openai"}
+	proc := NewProcessor(&DSLConfig{}, envConfig, nil, false)
+
+	// Priority providers that don't support the model are passed over
+	if provider := proc.detectProvider("gpt-4o"); provider == nil || provider.Name() != "openai" {
+		t.Errorf("expected openai for gpt-4o, got %v", provider)
+	}
+	if provider := proc.detectProvider("claude-3-5-haiku-latest"); provider == nil || provider.Name() != "anthropic" {
+		t.Errorf("expected anthropic for claude-3-5-haiku-latest, got %v", provider)
+	}
+}
+
+func TestModelAliases(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	withScriptedProvider(t, "Hi", "Hi")
+	env := createTestEnvConfig()
+	env.ModelAliases = map[string]string{"support-bot": "gpt-4o-mini"}
+	cfg := &DSLConfig{Steps: []Step{
+		{Name: "reply", Config: StepConfig{Input: "NA", Model: "support-bot", Action: "Reply", Output: "STDOUT"}},
+		{Name: "compare", Config: StepConfig{Input: "NA", Model: []interface{}{"gpt-4o", "support-bot"}, Action: "Reply", Output: "STDOUT"}},
+	}}
+	proc := NewProcessor(cfg, env, createTestServerConfig(), false)
+	if got := proc.stepModels(cfg.Steps[1].Config); strings.Join(got, ",") != "gpt-4o,gpt-4o-mini" {
+		t.Errorf("stepModels() = %v, want the alias resolved", got)
+	}
+	proc.SetProgressWriter(discardProgress{})
+	recorder := &sliceRecorder{}
+	proc.SetStepRecorder(recorder)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if recorder.records[0].Model != "gpt-4o-mini" || recorder.records[1].Model != "gpt-4o,gpt-4o-mini" {
+		t.Errorf("recorded models = %s and %s, want the aliases resolved", recorder.records[0].Model, recorder.records[1].Model)
+	}
+}
@@ -0,0 +1,326 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/chunker"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/vectorstore"
+)
+
+// Step types that write to and read from vector stores
+const (
+	StepTypeIndex    = "index"
+	StepTypeRetrieve = "retrieve"
+)
+
+// DefaultTopK is how many matches a retrieve step returns when top_k is unset
+const DefaultTopK = 5
+
+// embedBatch is the most texts embedded in one request
+const embedBatch = 64
+
+// openVectorStore connects to a vector store; tests replace it
+var openVectorStore = vectorstore.Open
+
+// isVectorStep reports whether a step is an index or retrieve step
+func isVectorStep(cfg StepConfig) bool {
+	return cfg.Type == StepTypeIndex || cfg.Type == StepTypeRetrieve
+}
+
+// vectorStepErrors lists the problems with an index or retrieve step
+func (p *Processor) vectorStepErrors(config StepConfig) []string {
+	var errors []string
+	if config.Input == nil {
+		errors = append(errors, fmt.Sprintf("input tag is required for %s steps", config.Type))
+	}
+	if modelNames := p.NormalizeStringSlice(config.Model); len(modelNames) != 1 || modelNames[0] == "NA" {
+		errors = append(errors, fmt.Sprintf("%s steps need one embedding model", config.Type))
+	}
+	switch {
+	case config.VectorStore == nil || config.VectorStore.Name == "":
+		errors = append(errors, fmt.Sprintf("'vector_store' with a name is required for %s steps", config.Type))
+	case config.VectorStore.TopK < 0:
+		errors = append(errors, "vector_store top_k must not be negative")
+	}
+	return errors
+}
+
+// stepEmbedder returns the configured provider that embeds text for a step
+func (p *Processor) stepEmbedder(step Step, modelName string) (models.Embedder, error) {
+	var provider models.Provider
+	switch {
+	case p.resolver != nil:
+		provider = p.resolver(modelName)
+	case step.Config.Provider != "":
+		provider = models.ProviderByName(step.Config.Provider)
+	default:
+		provider = models.DetectEmbeddingProvider(modelName)
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("no provider found for embedding model %s", modelName)
+	}
+	embedder, ok := provider.(models.Embedder)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not create embeddings", provider.Name())
+	}
+	if p.resolver == nil {
+		provider.SetVerbose(p.verbose)
+		if err := p.configureProvider(provider.Name(), provider); err != nil {
+			return nil, err
+		}
+	}
+	return embedder, nil
+}
+
+// embed returns the embeddings of texts, a batch of them per request
+func embed(embedder models.Embedder, modelName string, texts []string) ([][]float32, error) {
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += embedBatch {
+		end := start + embedBatch
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := embedder.Embed(modelName, texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("error creating embeddings with %s: %w", modelName, err)
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// vectorSource is a text read by an index or retrieve step
+type vectorSource struct {
+	name, text string
+}
+
+// vectorSources reads a step's inputs as text
+func (p *Processor) vectorSources(step Step) ([]vectorSource, error) {
+	inputs := p.NormalizeStringSlice(step.Config.Input)
+	if len(inputs) == 1 && strings.HasPrefix(inputs[0], "STDIN") {
+		stdin, err := p.stdinContents(step.Config)
+		if err != nil {
+			return nil, fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+		}
+		return []vectorSource{{name: "STDIN", text: stdin}}, nil
+	}
+	p.handler = newStepHandler(step.Config)
+	if err := p.processInputs(inputs); err != nil {
+		return nil, fmt.Errorf("input processing error in step %s: %w", step.Name, inputSizeHint(err))
+	}
+	var sources []vectorSource
+	for _, in := range p.handler.GetInputs() {
+		sources = append(sources, vectorSource{name: in.Path, text: string(in.Contents)})
+	}
+	return sources, nil
+}
+
+// openStepStore connects to a step's vector store and returns it with the
+// collection the step uses
+func (p *Processor) openStepStore(step Step) (vectorstore.Store, string, error) {
+	settings := step.Config.VectorStore
+	store, err := openVectorStore(p.envConfig, settings.Name)
+	if err != nil {
+		return nil, "", fmt.Errorf("error opening vector store for step %s: %w", step.Name, err)
+	}
+	collection := settings.Collection
+	if collection == "" {
+		collection = p.envConfig.VectorStores[settings.Name].Collection
+	}
+	if collection == "" {
+		store.Close()
+		return nil, "", fmt.Errorf("step %s names no collection, and vector store %s has no default collection", step.Name, settings.Name)
+	}
+	return store, collection, nil
+}
+
+// splitSource splits a text into the chunks configured for a step, or
+// returns it whole when the step has no chunk configuration
+func splitSource(text string, chunk *ChunkConfig) ([]string, error) {
+	if chunk == nil {
+		return []string{text}, nil
+	}
+	file, err := os.CreateTemp(config.TempDir(), "comanda-index-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	file.Close()
+
+	result, err := chunker.SplitFile(file.Name(), chunker.ChunkConfig{
+		By:        chunk.By,
+		Size:      chunk.Size,
+		Overlap:   chunk.Overlap,
+		MaxChunks: chunk.MaxChunks,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer chunker.CleanupChunks(result)
+	chunks := make([]string, 0, len(result.ChunkPaths))
+	for _, path := range result.ChunkPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk: %w", err)
+		}
+		if strings.TrimSpace(string(data)) != "" {
+			chunks = append(chunks, string(data))
+		}
+	}
+	return chunks, nil
+}
+
+// processIndexStep embeds the step's inputs, split into chunks if it has a
+// chunk configuration, and adds them to its vector store. Each chunk is
+// identified by its input and position, so indexing an input again
+// replaces its chunks.
+func (p *Processor) processIndexStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	modelName := p.NormalizeStringSlice(step.Config.Model)[0]
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: "Index documents"}
+	stepMsg := fmt.Sprintf("Indexing documents for step: %s", step.Name)
+	if isParallel {
+		p.emitParallelProgress(stepMsg, stepInfo, parallelID)
+	} else {
+		p.emitProgress(stepMsg, stepInfo)
+	}
+
+	sources, err := p.vectorSources(step)
+	if err != nil {
+		return "", err
+	}
+	var docs []vectorstore.Document
+	for _, src := range sources {
+		chunks, err := splitSource(src.text, step.Config.Chunk)
+		if err != nil {
+			return "", fmt.Errorf("failed to chunk %s for step '%s': %w", src.name, step.Name, err)
+		}
+		for i, text := range chunks {
+			docs = append(docs, vectorstore.Document{
+				ID:       fmt.Sprintf("%s#%d", src.name, i+1),
+				Text:     text,
+				Metadata: map[string]string{"source": src.name, "chunk": fmt.Sprintf("%d", i+1)},
+			})
+		}
+	}
+	if len(docs) == 0 {
+		return "", fmt.Errorf("index step '%s' has no text to index", step.Name)
+	}
+
+	embedder, err := p.stepEmbedder(step, modelName)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Text
+	}
+	vectors, err := embed(embedder, modelName, texts)
+	if err != nil {
+		return "", err
+	}
+	for i := range docs {
+		docs[i].Vector = vectors[i]
+	}
+
+	store, collection, err := p.openStepStore(step)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+	if err := store.Upsert(p.context(), collection, docs); err != nil {
+		return "", fmt.Errorf("error indexing documents in step %s: %w", step.Name, err)
+	}
+
+	summary := fmt.Sprintf("Indexed %d chunk(s) from %d input(s) into %s/%s", len(docs), len(sources), step.Config.VectorStore.Name, collection)
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if err := p.handleOutput(modelName, summary, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+	p.debugf("Step '%s' indexed %d chunks", step.Name, len(docs))
+	return summary, nil
+}
+
+// processRetrieveStep finds the documents of the step's vector store
+// nearest to its input, and outputs them nearest first
+func (p *Processor) processRetrieveStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	modelName := p.NormalizeStringSlice(step.Config.Model)[0]
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: "Retrieve documents"}
+	stepMsg := fmt.Sprintf("Retrieving documents for step: %s", step.Name)
+	if isParallel {
+		p.emitParallelProgress(stepMsg, stepInfo, parallelID)
+	} else {
+		p.emitProgress(stepMsg, stepInfo)
+	}
+
+	sources, err := p.vectorSources(step)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, src := range sources {
+		parts = append(parts, src.text)
+	}
+	query := strings.TrimSpace(strings.Join(parts, "\n\n"))
+	if query == "" {
+		return "", fmt.Errorf("retrieve step '%s' has no query text", step.Name)
+	}
+
+	embedder, err := p.stepEmbedder(step, modelName)
+	if err != nil {
+		return "", err
+	}
+	vectors, err := embed(embedder, modelName, []string{query})
+	if err != nil {
+		return "", err
+	}
+
+	store, collection, err := p.openStepStore(step)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+	topK := step.Config.VectorStore.TopK
+	if topK == 0 {
+		topK = DefaultTopK
+	}
+	matches, err := store.Query(p.context(), collection, vectors[0], topK)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving documents in step %s: %w", step.Name, err)
+	}
+
+	response := formatMatches(matches)
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if err := p.handleOutput(modelName, response, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+	p.debugf("Step '%s' retrieved %d documents", step.Name, len(matches))
+	return response, nil
+}
+
+// formatMatches lists retrieved documents with their sources and scores,
+// ready to be given to a model as context
+func formatMatches(matches []vectorstore.Match) string {
+	if len(matches) == 0 {
+		return "No matching documents found."
+	}
+	parts := make([]string, len(matches))
+	for i, match := range matches {
+		source := match.ID
+		if s := match.Metadata["source"]; s != "" {
+			source = s
+		}
+		parts[i] = fmt.Sprintf("[%d] %s (score %.3f)\n%s", i+1, source, match.Score, strings.TrimSpace(match.Text))
+	}
+	return strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/vectorstore"
+)
+
+// letterEmbedder embeds texts as their letter counts, so texts sharing
+// words are near each other
+type letterEmbedder struct {
+	MockProvider
+	calls int
+}
+
+func (l *letterEmbedder) Embed(modelName string, texts []string) ([][]float32, error) {
+	l.calls++
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, 26)
+		for _, r := range strings.ToLower(text) {
+			if r >= 'a' && r <= 'z' {
+				vectors[i][r-'a']++
+			}
+		}
+	}
+	return vectors, nil
+}
+
+// memStore is a vector store in memory
+type memStore struct {
+	collections map[string]map[string]vectorstore.Document
+}
+
+func (m *memStore) Upsert(ctx context.Context, collection string, docs []vectorstore.Document) error {
+	if m.collections[collection] == nil {
+		m.collections[collection] = make(map[string]vectorstore.Document)
+	}
+	for _, doc := range docs {
+		m.collections[collection][doc.ID] = doc
+	}
+	return nil
+}
+
+func (m *memStore) Query(ctx context.Context, collection string, vector []float32, k int) ([]vectorstore.Match, error) {
+	var matches []vectorstore.Match
+	for _, doc := range m.collections[collection] {
+		matches = append(matches, vectorstore.Match{Document: doc, Score: cosine(doc.Vector, vector)})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+func (m *memStore) Close() error { return nil }
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i] * b[i])
+		na += float64(a[i] * a[i])
+		nb += float64(b[i] * b[i])
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func TestIndexAndRetrieve(t *testing.T) {
+	store := &memStore{collections: make(map[string]map[string]vectorstore.Document)}
+	previous := openVectorStore
+	openVectorStore = func(env *config.EnvConfig, name string) (vectorstore.Store, error) { return store, nil }
+	defer func() { openVectorStore = previous }()
+
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs.txt")
+	if err := os.WriteFile(docs, []byte("zebras zigzag at the zoo\nbanana bread baking\ncoffee and cocoa\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	query := filepath.Join(dir, "query.txt")
+	if err := os.WriteFile(query, []byte("zoo zebra"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := createTestEnvConfig()
+	env.VectorStores = map[string]config.VectorStoreConfig{"notes": {Type: config.VectorStoreQdrant, URL: "http://qdrant", Collection: "kb"}}
+	cfg := &DSLConfig{Steps: []Step{
+		{Name: "index", Config: StepConfig{
+			Type: StepTypeIndex, Input: docs, Model: "text-embedding-3-small", Output: "STDOUT",
+			Chunk:       &ChunkConfig{By: "lines", Size: 1},
+			VectorStore: &VectorStoreStep{Name: "notes"},
+		}},
+		{Name: "retrieve", Config: StepConfig{
+			Type: StepTypeRetrieve, Input: query, Model: "text-embedding-3-small", Output: "STDOUT",
+			VectorStore: &VectorStoreStep{Name: "notes", Collection: "kb", TopK: 1},
+		}},
+	}}
+	embedder := &letterEmbedder{MockProvider: MockProvider{name: "openai"}}
+	proc := NewProcessor(cfg, env, createTestServerConfig(), false)
+	proc.SetProviderResolver(func(modelName string) models.Provider { return embedder })
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if got := len(store.collections["kb"]); got != 3 {
+		t.Errorf("indexed %d documents, want one per line", got)
+	}
+	out := proc.LastOutput()
+	if !strings.Contains(out, "zebras zigzag at the zoo") || strings.Contains(out, "banana") {
+		t.Errorf("retrieved:\n%s\nwant only the zebra line", out)
+	}
+	if !strings.HasPrefix(out, "[1] "+docs) {
+		t.Errorf("retrieved:\n%s\nwant the match labelled with its source", out)
+	}
+}
+
+func TestVectorStepValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.stepConfigErrors("retrieve", StepConfig{Type: StepTypeRetrieve, Input: "STDIN", Model: "NA"})
+	want := []string{"one embedding model", "'vector_store' with a name is required"}
+	if len(errs) != len(want) {
+		t.Fatalf("stepConfigErrors() = %v, want %d errors", errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i], w) {
+			t.Errorf("error %d = %q, want it to mention %q", i, errs[i], w)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// StepRecord summarizes a finished step for run history
+type StepRecord struct {
+	Name     string
+	Model    string
+	Provider string
+	Outputs  []string // Output destinations the step wrote; none when it failed
+	Response string
+	Started  time.Time
+	Finished time.Time
+	Metrics  PerformanceMetrics
+	Err      error
+	Prompts  []PromptRecord // Prompts the step sent, as sent, with their responses
+	Variant  string         // Prompt variant the step used, for steps with variants
+}
+
+// PromptRecord is a prompt a step sent to a model, after rendering and any
+// debugger edits, and what the model answered, kept so comanda replay can
+// send it again
+type PromptRecord struct {
+	Model    string `json:"model"`
+	Prompt   string `json:"prompt"`
+	File     string `json:"file,omitempty"`      // Path of the attached file, if any
+	MimeType string `json:"mime_type,omitempty"` // Type of the attached file
+	FileText string `json:"file_text,omitempty"` // Contents of the attached file when it is small text, since files such as STDIN's are temporary
+	Response string `json:"response"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StepRecorder receives a record of every step the processor finishes,
+// including failed ones. It is called from parallel steps concurrently.
+type StepRecorder interface {
+	RecordStep(record StepRecord)
+}
+
+// SetStepRecorder sets the recorder that receives finished steps
+func (p *Processor) SetStepRecorder(r StepRecorder) {
+	p.recorder = r
+}
+
+// recordStep counts a finished step against the run's budget and passes it
+// to the recorder, if one is set
+func (p *Processor) recordStep(step Step, response string, err error, metrics *PerformanceMetrics, started time.Time) {
+	model := step.Config.Model
+	if step.Config.Generate != nil {
+		model = step.Config.Generate.Model
+	}
+	models := p.NormalizeStringSlice(model)
+	var modelName string
+	var cost float64
+	if len(models) > 0 && models[0] != "NA" {
+		p.charge(models[0], metrics)
+		modelName = strings.Join(models, ",")
+		cost = stepCost(models[0], metrics)
+	}
+	summary := StepSummary{
+		Name:             step.Name,
+		Model:            modelName,
+		Status:           StepSucceeded,
+		DurationMS:       time.Since(started).Milliseconds(),
+		PromptTokens:     metrics.PromptTokens,
+		CompletionTokens: metrics.CompletionTokens,
+		Retries:          metrics.Retries,
+		CacheHits:        metrics.CacheHits,
+		Cost:             cost,
+	}
+	if err != nil {
+		summary.Status = StepFailed
+		summary.Error = err.Error()
+	}
+	p.summarize(summary)
+
+	if p.recorder == nil {
+		return
+	}
+	var providerName string
+	if modelName != "" {
+		if provider := p.detectProvider(models[0]); provider != nil {
+			providerName = provider.Name()
+		}
+	}
+	var outputs []string
+	if _, isMap := step.Config.Output.(map[string]interface{}); isMap && err == nil {
+		outputs = []string{fmt.Sprintf("%v", step.Config.Output)}
+	} else if err == nil {
+		outputs = p.NormalizeStringSlice(step.Config.Output)
+	}
+
+	p.promptsMu.Lock()
+	prompts := p.prompts[step.Name]
+	delete(p.prompts, step.Name)
+	p.promptsMu.Unlock()
+
+	p.recorder.RecordStep(StepRecord{
+		Name:     step.Name,
+		Model:    modelName,
+		Provider: providerName,
+		Outputs:  outputs,
+		Response: response,
+		Started:  started,
+		Finished: time.Now(),
+		Metrics:  *metrics,
+		Err:      err,
+		Prompts:  prompts,
+		Variant:  p.variants[step.Name],
+	})
+}
+
+// recordPrompt keeps a prompt a step sent for its step record, when a
+// recorder is set
+func (p *Processor) recordPrompt(stepName string, prompt PromptRecord) {
+	if p.recorder == nil {
+		return
+	}
+	if prompt.File != "" {
+		prompt.FileText = attachedText(prompt.File)
+	}
+	p.promptsMu.Lock()
+	defer p.promptsMu.Unlock()
+	if p.prompts == nil {
+		p.prompts = make(map[string][]PromptRecord)
+	}
+	p.prompts[stepName] = append(p.prompts[stepName], prompt)
+}
+
+// maxRecordedFileText is the size of the largest attached file whose
+// contents prompt records keep
+const maxRecordedFileText = 256 * 1024
+
+// attachedText returns the contents of an attached file if it is text no
+// larger than maxRecordedFileText, and otherwise ""
+func attachedText(path string) string {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxRecordedFileText {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !utf8.Valid(data) {
+		return ""
+	}
+	return string(data)
+}
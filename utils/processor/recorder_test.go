@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+type sliceRecorder struct {
+	mu      sync.Mutex
+	records []StepRecord
+}
+
+func (r *sliceRecorder) RecordStep(record StepRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+func TestStepRecorder(t *testing.T) {
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		return NewMockProvider("openai")
+	}
+	t.Cleanup(func() { models.DetectProvider = previous })
+
+	proc := NewProcessor(joinTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+	recorder := &sliceRecorder{}
+	proc.SetStepRecorder(recorder)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	var names []string
+	for _, r := range recorder.records {
+		names = append(names, r.Name)
+		if r.Model != "gpt-4o" || r.Provider != "openai" || r.Err != nil {
+			t.Errorf("record %s = model %q provider %q err %v", r.Name, r.Model, r.Provider, r.Err)
+		}
+		if r.Response == "" || r.Metrics.CompletionTokens == 0 || r.Finished.Before(r.Started) {
+			t.Errorf("record %s missing response, tokens or timing: %+v", r.Name, r)
+		}
+		if len(r.Outputs) != 1 || r.Outputs[0] != "STDOUT" {
+			t.Errorf("record %s outputs = %v", r.Name, r.Outputs)
+		}
+		if len(r.Prompts) == 0 || r.Prompts[0].Model != "gpt-4o" || r.Prompts[0].Prompt == "" || r.Prompts[0].Response == "" {
+			t.Errorf("record %s prompts = %+v", r.Name, r.Prompts)
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "combine,sentiment,topics" {
+		t.Errorf("recorded steps = %v", names)
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	withInterruptingProvider(t, 0, nil)
+
+	proc := NewProcessor(checkpointTestConfig("first", "second"), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	summary := proc.Summary()
+	if len(summary) != 2 || summary[0].Name != "first" || summary[1].Name != "second" {
+		t.Fatalf("Summary() = %+v, want first and second", summary)
+	}
+	for _, s := range summary {
+		if s.Status != StepSucceeded || s.Model != "gpt-4o" {
+			t.Errorf("step %s status %q model %q", s.Name, s.Status, s.Model)
+		}
+		if s.PromptTokens == 0 || s.CompletionTokens == 0 || s.Cost == 0 {
+			t.Errorf("step %s missing tokens or cost: %+v", s.Name, s)
+		}
+	}
+}
+
+func TestRecordAttachedText(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	withScriptedProvider(t, "Bonjour")
+	proc := NewProcessor(&DSLConfig{Steps: []Step{{Name: "translate", Config: StepConfig{
+		Input: "STDIN", Model: "gpt-4o", Action: "Translate to French", Output: "STDOUT",
+	}}}}, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	proc.SetLastOutput("Hello")
+	recorder := &sliceRecorder{}
+	proc.SetStepRecorder(recorder)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	prompts := recorder.records[0].Prompts
+	if len(prompts) != 1 || prompts[0].File == "" || prompts[0].FileText != "Hello" {
+		t.Errorf("prompts = %+v, want STDIN's text kept with the prompt", prompts)
+	}
+}
@@ -0,0 +1,211 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/render"
+)
+
+// StepTypeRender is the type of steps that turn markdown into documents
+const StepTypeRender = "render"
+
+// renderFormats are the formats render steps write, by file extension
+var renderFormats = map[string]string{
+	".html": "html",
+	".htm":  "html",
+	".pdf":  "pdf",
+	".docx": "docx",
+}
+
+// isRenderStep reports whether a step is a render step
+func isRenderStep(cfg StepConfig) bool {
+	return cfg.Type == StepTypeRender
+}
+
+// renderFormat returns the format a render step writes an output in, or
+// an empty string when the output's extension names none
+func renderFormat(cfg StepConfig, output string) string {
+	if cfg.Render != nil && cfg.Render.Format != "" {
+		return strings.ToLower(cfg.Render.Format)
+	}
+	if output == "STDOUT" {
+		return "html"
+	}
+	return renderFormats[strings.ToLower(filepath.Ext(output))]
+}
+
+// renderStepErrors lists the problems with a render step
+func (p *Processor) renderStepErrors(config StepConfig) []string {
+	var errors []string
+	if inputs := p.NormalizeStringSlice(config.Input); len(inputs) == 0 || inputs[0] == "NA" {
+		errors = append(errors, "render steps need markdown as input: STDIN or markdown files")
+	}
+	opts := config.Render
+	if opts == nil {
+		opts = &RenderStep{}
+	}
+	switch strings.ToLower(opts.Format) {
+	case "", "html", "pdf", "docx":
+	default:
+		errors = append(errors, fmt.Sprintf("unknown render format '%s' (expected html, pdf or docx)", opts.Format))
+	}
+	if !render.ValidPageSize(opts.PageSize) {
+		errors = append(errors, fmt.Sprintf("unknown page_size '%s' (expected a4 or letter)", opts.PageSize))
+	}
+
+	outputs := p.NormalizeStringSlice(config.Output)
+	if len(outputs) == 0 {
+		errors = append(errors, "output is required for render steps: the files to write, such as report.pdf")
+	}
+	for _, output := range outputs {
+		switch format := renderFormat(config, output); {
+		case format == "" && output != "STDOUT":
+			errors = append(errors, fmt.Sprintf("can't tell the format of output '%s'; name it .html, .pdf or .docx or set render.format", output))
+		case output == "STDOUT" && format != "html":
+			errors = append(errors, fmt.Sprintf("only HTML can be written to STDOUT, not %s", format))
+		case opts.Template != "" && format == "docx" && !strings.EqualFold(filepath.Ext(opts.Template), ".docx"):
+			errors = append(errors, fmt.Sprintf("the template of DOCX output '%s' must be a .docx file", output))
+		case opts.Template != "" && format == "html" && strings.EqualFold(filepath.Ext(opts.Template), ".docx"):
+			errors = append(errors, fmt.Sprintf("the template of HTML output '%s' must be an HTML template, not a .docx file", output))
+		}
+	}
+	return errors
+}
+
+// readStepFile reads a file a step's settings name. In server mode the
+// path is confined to the sandbox; in the CLI a relative path is read from
+// the runtime directory, if any.
+func (p *Processor) readStepFile(path string) ([]byte, error) {
+	resolved := path
+	if p.getSandbox() == nil && p.runtimeDir != "" && !filepath.IsAbs(path) {
+		resolved = filepath.Join(p.runtimeDir, path)
+	}
+	resolved, err := p.confinePath(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' rejected: %w", path, err)
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// processRenderStep writes the markdown of the step's input to each of its
+// outputs as a document in the output's format. It outputs the files it
+// wrote, or the HTML page when it only writes to STDOUT.
+func (p *Processor) processRenderStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	stepInfo := &StepInfo{Name: step.Name, Model: "NA", Action: "Render documents"}
+	stepMsg := fmt.Sprintf("Rendering documents for step: %s", step.Name)
+	if isParallel {
+		p.emitParallelProgress(stepMsg, stepInfo, parallelID)
+	} else {
+		p.emitProgress(stepMsg, stepInfo)
+	}
+
+	var markdown string
+	inputs := p.NormalizeStringSlice(step.Config.Input)
+	if len(inputs) == 1 && strings.HasPrefix(inputs[0], "STDIN") {
+		stdin, err := p.stdinContents(step.Config)
+		if err != nil {
+			return "", fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+		}
+		markdown = stdin
+	} else {
+		p.handler = newStepHandler(step.Config)
+		if err := p.processInputs(inputs); err != nil {
+			return "", fmt.Errorf("input processing error in step %s: %w", step.Name, inputSizeHint(err))
+		}
+		var parts []string
+		for _, in := range p.handler.GetInputs() {
+			parts = append(parts, strings.TrimSpace(string(in.Contents)))
+		}
+		markdown = strings.Join(parts, "\n\n")
+	}
+	if strings.TrimSpace(markdown) == "" {
+		return "", fmt.Errorf("render step '%s' has no markdown to render", step.Name)
+	}
+
+	settings := step.Config.Render
+	if settings == nil {
+		settings = &RenderStep{}
+	}
+	doc := render.Parse(markdown)
+	opts := render.Options{Title: settings.Title, PageSize: settings.PageSize}
+	if settings.CSS != "" {
+		css, err := p.readStepFile(settings.CSS)
+		if err != nil {
+			return "", fmt.Errorf("error loading stylesheet in step %s: %w", step.Name, err)
+		}
+		opts.CSS = string(css)
+	}
+	var template []byte
+	if settings.Template != "" {
+		var err error
+		if template, err = p.readStepFile(settings.Template); err != nil {
+			return "", fmt.Errorf("error loading template in step %s: %w", step.Name, err)
+		}
+	}
+
+	var rendered []string
+	var page string
+	for _, output := range p.NormalizeStringSlice(step.Config.Output) {
+		format := renderFormat(step.Config, output)
+		opts.Template, opts.Reference = "", nil
+		if format == "docx" {
+			opts.Reference = template
+		} else {
+			opts.Template = string(template)
+		}
+		if opts.Title == "" && doc.Title() == "" && output != "STDOUT" {
+			opts.Title = strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+		}
+
+		var buf bytes.Buffer
+		var err error
+		switch format {
+		case "html":
+			err = render.WriteHTML(&buf, doc, opts)
+		case "pdf":
+			err = render.WritePDF(&buf, doc, opts)
+		case "docx":
+			err = render.WriteDOCX(&buf, doc, opts)
+		default:
+			err = fmt.Errorf("can't tell the format of output '%s'", output)
+		}
+		if err != nil {
+			return "", fmt.Errorf("error rendering %s in step %s: %w", output, step.Name, err)
+		}
+
+		if output == "STDOUT" {
+			page = buf.String()
+			metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+			if err := p.handleOutput("NA", buf.String(), []string{output}, metrics); err != nil {
+				return "", fmt.Errorf("output handling error: %w", err)
+			}
+			continue
+		}
+		outputPath, err := p.resolveOutputPath(output)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+			return "", fmt.Errorf("failed to write document %s: %w", outputPath, err)
+		}
+		config.InfoLog("\n%s document written to file: %s", strings.ToUpper(format), outputPath)
+		rendered = append(rendered, output)
+	}
+
+	p.debugf("Step '%s' rendered %d document(s)", step.Name, len(rendered))
+	if len(rendered) == 0 {
+		return page, nil
+	}
+	return fmt.Sprintf("Rendered %s", strings.Join(rendered, ", ")), nil
+}
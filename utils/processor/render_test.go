@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderStep(t *testing.T) {
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.md")
+	os.WriteFile(report, []byte("# Weekly Report\n\n- **Revenue** up\n"), 0644)
+	tmpl := filepath.Join(dir, "page.html")
+	os.WriteFile(tmpl, []byte("<h1 class=\"cover\">{{ .Title }}</h1>{{ .Body }}"), 0644)
+
+	cfg := &DSLConfig{Steps: []Step{
+		{Name: "render", Config: StepConfig{
+			Type: StepTypeRender, Input: report,
+			Output: []interface{}{filepath.Join(dir, "out", "report.pdf"), filepath.Join(dir, "out", "report.docx"), filepath.Join(dir, "out", "report.html")},
+			Render: &RenderStep{Template: tmpl, PageSize: "letter"},
+		}},
+	}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if errs := proc.stepConfigErrors("render", cfg.Steps[0].Config); len(errs) == 0 || !strings.Contains(errs[0], "must be a .docx file") {
+		t.Errorf("stepConfigErrors() = %v, want the HTML template refused for DOCX output", errs)
+	}
+	cfg.Steps[0].Config.Output = []interface{}{filepath.Join(dir, "out", "report.pdf"), filepath.Join(dir, "out", "report.html")}
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	pdf, err := os.ReadFile(filepath.Join(dir, "out", "report.pdf"))
+	if err != nil || !strings.HasPrefix(string(pdf), "%PDF-") || !strings.Contains(string(pdf), "/Title (Weekly Report)") {
+		t.Errorf("report.pdf isn't a PDF of the report (error %v)", err)
+	}
+	html, _ := os.ReadFile(filepath.Join(dir, "out", "report.html"))
+	if want := "<h1 class=\"cover\">Weekly Report</h1><h1>Weekly Report</h1>\n<ul>\n<li><strong>Revenue</strong> up\n</li>\n</ul>\n"; string(html) != want {
+		t.Errorf("report.html = %q, want %q", html, want)
+	}
+	if out := proc.LastOutput(); !strings.Contains(out, "report.pdf") || !strings.Contains(out, "report.html") {
+		t.Errorf("LastOutput() = %q, want the documents written", out)
+	}
+}
+
+func TestRenderStepValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.stepConfigErrors("render", StepConfig{
+		Type: StepTypeRender, Input: "NA", Output: []interface{}{"notes.txt", "STDOUT"},
+		Render: &RenderStep{Format: "pdf", PageSize: "a3"},
+	})
+	want := []string{"need markdown as input", "unknown page_size 'a3'", "only HTML can be written to STDOUT"}
+	if len(errs) != len(want) {
+		t.Fatalf("stepConfigErrors() = %v, want %d errors", errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i], w) {
+			t.Errorf("error %d = %q, want it to mention %q", i, errs[i], w)
+		}
+	}
+	if errs := proc.stepConfigErrors("render", StepConfig{Type: StepTypeRender, Input: "STDIN", Output: "notes.txt"}); len(errs) != 1 || !strings.Contains(errs[0], "can't tell the format") {
+		t.Errorf("stepConfigErrors() = %v, want the output's format unknown", errs)
+	}
+}
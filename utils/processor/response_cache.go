@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/respcache"
+)
+
+// responseCache answers repeated prompts from the on-disk cache
+type responseCache struct {
+	store *respcache.Cache
+	hits  atomic.Int64 // Prompts answered from the cache in this run
+}
+
+// SetResponseCache answers prompts the cache holds a response to without
+// calling the model, and saves the responses of the calls that are made
+func (p *Processor) SetResponseCache(store *respcache.Cache) {
+	if store == nil {
+		p.responseCache = nil
+		return
+	}
+	p.responseCache = &responseCache{store: store}
+}
+
+// cacheHits returns the number of prompts answered from the cache so far
+func (p *Processor) cacheHits() int64 {
+	if p.responseCache == nil {
+		return 0
+	}
+	return p.responseCache.hits.Load()
+}
+
+// cacheProvider wraps a provider to use the response cache, when set
+func (p *Processor) cacheProvider(provider models.Provider) models.Provider {
+	if p.responseCache == nil {
+		return provider
+	}
+	return &cachedProvider{Provider: provider, processor: p}
+}
+
+// cachedProvider returns cached responses to prompts sent before, and
+// caches the responses it receives. Failed calls are not cached.
+type cachedProvider struct {
+	models.Provider
+	processor *Processor
+}
+
+func (c *cachedProvider) SendPrompt(modelName, prompt string) (string, error) {
+	key := respcache.Key(c.Name(), modelName, prompt)
+	return c.cached(key, modelName, func() (string, error) {
+		return c.Provider.SendPrompt(modelName, prompt)
+	})
+}
+
+func (c *cachedProvider) SendPromptWithFile(modelName, prompt string, file models.FileInput) (string, error) {
+	digest, err := respcache.FileDigest(file.Path)
+	if err != nil {
+		// The provider reports the unreadable file
+		return c.Provider.SendPromptWithFile(modelName, prompt, file)
+	}
+	key := respcache.Key(c.Name(), modelName, prompt, file.MimeType, digest)
+	return c.cached(key, modelName, func() (string, error) {
+		return c.Provider.SendPromptWithFile(modelName, prompt, file)
+	})
+}
+
+// cached returns the response of key from the cache, or else calls send
+// and caches its response
+func (c *cachedProvider) cached(key, modelName string, send func() (string, error)) (string, error) {
+	cache := c.processor.responseCache
+	if entry, ok := cache.store.Get(key); ok {
+		cache.hits.Add(1)
+		c.processor.debugf("Answered prompt to %s from the response cache", modelName)
+		return entry.Response, nil
+	}
+
+	response, err := send()
+	if err != nil || response == "" {
+		return response, err
+	}
+	entry := respcache.Entry{Provider: c.Name(), Model: modelName, Response: response, Created: time.Now()}
+	if err := cache.store.Put(key, entry); err != nil {
+		c.processor.debugf("Error caching response: %v", err)
+	}
+	return response, nil
+}
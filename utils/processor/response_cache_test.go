@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/respcache"
+)
+
+func TestResponseCache(t *testing.T) {
+	provider := withInterruptingProvider(t, 0, nil)
+	cache := respcache.Open(t.TempDir(), 0)
+
+	run := func() (*Processor, *progressLog) {
+		var log progressLog
+		proc := NewProcessor(checkpointTestConfig("first"), createTestEnvConfig(), createTestServerConfig(), false)
+		proc.SetProgressWriter(&log)
+		proc.SetResponseCache(cache)
+		if err := proc.Process(); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		return proc, &log
+	}
+
+	run()
+	proc, log := run()
+	if provider.calls != 1 {
+		t.Errorf("provider called %d times, want once with the second run answered from the cache", provider.calls)
+	}
+	if got := proc.LastOutput(); got != "reply 1" {
+		t.Errorf("LastOutput() = %q, want the cached response", got)
+	}
+	finished := log.typed(ProgressStepFinished)
+	if len(finished) != 1 || finished[0].PerformanceMetrics.CacheHits != 1 {
+		t.Errorf("finished events = %+v, want one cache hit", finished)
+	}
+}
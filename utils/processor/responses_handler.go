@@ -73,6 +73,13 @@ func (h *responsesStreamHandler) OnOutputItemAdded(index int, item map[string]in
 func (h *responsesStreamHandler) OnOutputTextDelta(itemID string, index int, contentIndex int, delta string) {
 	// Append to current text
 	h.currentText.WriteString(delta)
+	h.processor.emit(ProgressUpdate{
+		Type:       ProgressDelta,
+		Step:       &StepInfo{Name: h.stepName},
+		IsParallel: h.isParallel,
+		ParallelID: h.parallelID,
+		Delta:      delta,
+	})
 
 	// Only send progress updates periodically to avoid flooding
 	if h.currentText.Len()%100 == 0 {
@@ -373,7 +380,7 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 	modelName := modelNames[0]
 
 	// Get the OpenAI provider
-	provider := models.DetectProvider(modelName)
+	provider := p.detectProvider(modelName)
 	if provider == nil || provider.Name() != "openai" {
 		return "", fmt.Errorf("openai-responses step requires an OpenAI model, got: %s", modelName)
 	}
@@ -602,11 +609,20 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 	p.debugf("Processing output for responses step '%s': model=%s outputs=%v",
 		step.Name, modelName, outputs)
 
+	// Apply any postprocess operations before writing the text out
+	writeOutput := func(text string) error {
+		text, err := p.postprocess(step, text)
+		if err != nil {
+			return err
+		}
+		return p.handleOutput(modelName, text, outputs, metrics)
+	}
+
 	// Extract the text from the response using our improved extraction function
 	var responseData map[string]interface{}
 	if err := json.Unmarshal([]byte(response), &responseData); err != nil {
 		// If we can't parse the response, use it as-is
-		if err := p.handleOutput(modelName, response, outputs, metrics); err != nil {
+		if err := writeOutput(response); err != nil {
 			errMsg := fmt.Sprintf("Output processing failed for responses step '%s': %v (model=%s outputs=%v)",
 				step.Name, err, modelName, outputs)
 			p.debugf("Output processing error: %s", errMsg)
@@ -617,7 +633,7 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		extractedText, err := p.extractOutputTextFromResponse(responseData)
 		if err != nil {
 			// If extraction fails, use the original response
-			if err := p.handleOutput(modelName, response, outputs, metrics); err != nil {
+			if err := writeOutput(response); err != nil {
 				errMsg := fmt.Sprintf("Output processing failed for responses step '%s': %v (model=%s outputs=%v)",
 					step.Name, err, modelName, outputs)
 				p.debugf("Output processing error: %s", errMsg)
@@ -625,7 +641,7 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 			}
 		} else {
 			// Use the extracted text
-			if err := p.handleOutput(modelName, extractedText, outputs, metrics); err != nil {
+			if err := writeOutput(extractedText); err != nil {
 				errMsg := fmt.Sprintf("Output processing failed for responses step '%s': %v (model=%s outputs=%v)",
 					step.Name, err, modelName, outputs)
 				p.debugf("Output processing error: %s", errMsg)
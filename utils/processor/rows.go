@@ -0,0 +1,406 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// RowsConfig applies a step's action to each row of a CSV input, or to
+// batches of rows, and outputs the CSV with the answers as new columns
+type RowsConfig struct {
+	Columns     []string `yaml:"columns,omitempty"`      // New columns the model fills; one named after the step when empty
+	Batch       int      `yaml:"batch,omitempty"`        // Rows per prompt; 1 when 0
+	Parallel    int      `yaml:"parallel,omitempty"`     // Prompts sent at once; DefaultChunkWorkers when 0
+	MaxAttempts int      `yaml:"max_attempts,omitempty"` // Times a prompt is sent before it is given up on; DefaultChunkAttempts when 0
+}
+
+// rowPlaceholder matches the {{ name }} placeholders of a rows action
+var rowPlaceholder = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// rowsBatch is the rows one prompt of a rows step covers
+type rowsBatch struct {
+	first int // Index of the batch's first row
+	rows  [][]string
+}
+
+// rowsResult is the new columns' values for a batch's rows, or its error
+type rowsResult struct {
+	values [][]string
+	err    error
+}
+
+// validateRowsConfig checks a rows block for consistency
+func validateRowsConfig(cfg *RowsConfig, modelNames []string) []string {
+	var errors []string
+	if cfg.Batch < 0 {
+		errors = append(errors, "rows.batch cannot be negative")
+	}
+	if cfg.Parallel < 0 {
+		errors = append(errors, "rows.parallel cannot be negative")
+	}
+	if cfg.MaxAttempts < 0 {
+		errors = append(errors, "rows.max_attempts cannot be negative")
+	}
+	seen := make(map[string]bool)
+	for _, column := range cfg.Columns {
+		if strings.TrimSpace(column) == "" {
+			errors = append(errors, "rows.columns cannot contain an empty name")
+		} else if seen[column] {
+			errors = append(errors, fmt.Sprintf("rows.columns lists '%s' twice", column))
+		}
+		seen[column] = true
+	}
+	if len(modelNames) != 1 || modelNames[0] == "NA" {
+		errors = append(errors, "a rows step needs one model")
+	}
+	return errors
+}
+
+// rowsColumns returns the columns a rows step adds
+func rowsColumns(step Step) []string {
+	if len(step.Config.Rows.Columns) > 0 {
+		return step.Config.Rows.Columns
+	}
+	return []string{step.Name}
+}
+
+// rowsWorkers returns how many of a rows step's prompts are sent at once
+func (p *Processor) rowsWorkers(rows *RowsConfig) int {
+	if p.debugger != nil {
+		return 1 // Prompts are reviewed one at a time, in order
+	}
+	if rows.Parallel > 0 {
+		return rows.Parallel
+	}
+	return DefaultChunkWorkers
+}
+
+// processRows reads the step's CSV input and sends each row, or batch of
+// rows, to the model with the step's action, several prompts at a time. It
+// returns the CSV with the answers in the new columns, which replace any
+// input columns of the same name. A batch that fails is retried on its
+// own; if it still fails, the step fails unless skip_errors is set, which
+// leaves the batch's new cells empty.
+func (p *Processor) processRows(step Step, modelName string, actions []string) (string, error) {
+	if len(actions) == 0 {
+		return "", fmt.Errorf("no actions processed")
+	}
+	inputs := p.handler.GetInputs()
+	if len(inputs) != 1 {
+		return "", fmt.Errorf("rows steps read one CSV input, got %d inputs", len(inputs))
+	}
+	data, err := inputs[0].Load()
+	if err != nil {
+		return "", fmt.Errorf("error reading CSV input in step %s: %w", step.Name, err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("error parsing CSV input in step %s: %w", step.Name, err)
+	}
+	if len(records) < 2 {
+		return "", fmt.Errorf("CSV input of step %s has no rows under its header", step.Name)
+	}
+	header, rows := records[0], records[1:]
+
+	provider, err := p.stepProvider(step.Name, modelName)
+	if err != nil {
+		return "", err
+	}
+	action, err := p.loadAction(actions[0])
+	if err != nil {
+		return "", err
+	}
+	action = p.substituteVariables(action)
+
+	cfg := step.Config.Rows
+	size := cfg.Batch
+	if size <= 0 {
+		size = 1
+	}
+	var batches []rowsBatch
+	for first := 0; first < len(rows); first += size {
+		batches = append(batches, rowsBatch{first: first, rows: rows[first:min(first+size, len(rows))]})
+	}
+	columns := rowsColumns(step)
+	attempts := DefaultChunkAttempts
+	if cfg.MaxAttempts > 0 {
+		attempts = cfg.MaxAttempts
+	}
+	workers := p.rowsWorkers(cfg)
+	p.debugf("Processing %d rows of step %s in %d prompts with %d workers", len(rows), step.Name, len(batches), workers)
+
+	results := make([]rowsResult, len(batches))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(batches); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				values, err := p.sendRows(step.Name, provider, modelName, action, header, columns, batches[i], i, len(batches), len(rows), attempts)
+				results[i] = rowsResult{values, err}
+			}
+		}()
+	}
+	for i := range batches {
+		if err := p.interrupted(); err != nil {
+			results[i].err = err
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if err := p.interrupted(); err != nil {
+		return "", err
+	}
+
+	var failures []string
+	skipped := 0
+	for i, result := range results {
+		if errors.Is(result.err, ErrStepSkipped) {
+			skipped++
+			continue
+		}
+		if result.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", rowRange(batches[i]), result.err))
+		}
+	}
+	if skipped == len(batches) {
+		return "", ErrStepSkipped // Every prompt was skipped in the debugger
+	}
+	if len(failures) == len(batches) {
+		return "", fmt.Errorf("all %d prompts failed: %s", len(batches), strings.Join(failures, "; "))
+	}
+	if len(failures) > 0 && !step.Config.SkipErrors {
+		return "", fmt.Errorf("%d of %d prompts failed (set skip_errors to leave their cells empty): %s", len(failures), len(batches), strings.Join(failures, "; "))
+	}
+	if len(failures) > 0 {
+		config.WarnLog("step %s left the cells of %d of %d prompts empty:\n%s", step.Name, len(failures), len(batches), strings.Join(failures, "\n"))
+	}
+
+	// The new columns replace input columns of the same name
+	positions := make([]int, len(columns))
+	for i, column := range columns {
+		if positions[i] = slices.Index(header, column); positions[i] < 0 {
+			positions[i] = len(header)
+			header = append(header, column)
+		}
+	}
+	out := [][]string{header}
+	for b, batch := range batches {
+		for r, row := range batch.rows {
+			row = append(row, make([]string, max(0, len(header)-len(row)))...)
+			for c, pos := range positions {
+				row[pos] = ""
+				if results[b].err == nil {
+					row[pos] = results[b].values[r][c]
+				}
+			}
+			out = append(out, row)
+		}
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(out); err != nil {
+		return "", fmt.Errorf("error writing CSV output of step %s: %w", step.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// sendRows sends batch i of total to the model, retrying up to attempts
+// times in all, and returns the new columns' values for each of its rows
+func (p *Processor) sendRows(stepName string, provider models.Provider, modelName, action string, header, columns []string, batch rowsBatch, i, total, rowCount, attempts int) ([][]string, error) {
+	p.emitChunk(stepName, i+1, total)
+	prompt := rowsPrompt(action, header, columns, batch, rowCount)
+
+	wait := chunkRetryWait
+	for attempt := 1; ; attempt++ {
+		response, err := provider.SendPrompt(modelName, prompt)
+		var values [][]string
+		if err == nil {
+			values, err = parseRowsResponse(response, columns, batch)
+		}
+		if err == nil || attempt >= attempts || errors.Is(err, ErrStepSkipped) || p.interrupted() != nil {
+			return values, err
+		}
+		p.emitChunkRetry(stepName, i+1, total, attempt, attempts-1, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-p.context().Done():
+			return nil, p.interrupted()
+		}
+		wait *= 2
+	}
+}
+
+// rowsPrompt fills the action's placeholders for a batch of rows and says
+// how to answer. With one row per prompt, {{ column }} is the row's value
+// of a column and {{ row }} the whole row; {{ rows }} is the batch as CSV,
+// with a row number before each row. {{ row_index }} and {{ total_rows }}
+// number the rows from 1. Rows the action doesn't mention are added after
+// it.
+func rowsPrompt(action string, header, columns []string, batch rowsBatch, rowCount int) string {
+	numbered := func() string {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(append([]string{"row"}, header...))
+		for r, row := range batch.rows {
+			w.Write(append([]string{fmt.Sprint(batch.first + r + 1)}, row...))
+		}
+		w.Flush()
+		return strings.TrimSpace(buf.String())
+	}
+	single := len(batch.rows) == 1
+	mentioned := false
+	prompt := rowPlaceholder.ReplaceAllStringFunc(action, func(match string) string {
+		name := rowPlaceholder.FindStringSubmatch(match)[1]
+		switch name {
+		case "rows":
+			mentioned = true
+			return numbered()
+		case "row_index":
+			return fmt.Sprint(batch.first + 1)
+		case "total_rows":
+			return fmt.Sprint(rowCount)
+		}
+		if !single {
+			return match
+		}
+		if name == "row" {
+			mentioned = true
+			return rowFields(header, batch.rows[0])
+		}
+		if c := slices.Index(header, name); c >= 0 {
+			mentioned = true
+			if c < len(batch.rows[0]) {
+				return batch.rows[0][c]
+			}
+			return ""
+		}
+		return match
+	})
+
+	var b strings.Builder
+	b.WriteString(prompt)
+	if !mentioned {
+		if single {
+			fmt.Fprintf(&b, "\n\nRow:\n%s", rowFields(header, batch.rows[0]))
+		} else {
+			fmt.Fprintf(&b, "\n\nRows:\n%s", numbered())
+		}
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = fmt.Sprintf("%q", column)
+	}
+	switch {
+	case !single:
+		fmt.Fprintf(&b, "\n\nAnswer with a JSON array of one object per row, in order, each with the key \"row\" (the row's number) and the keys %s. Output only the JSON.", strings.Join(quoted, ", "))
+	case len(columns) > 1:
+		fmt.Fprintf(&b, "\n\nAnswer with a JSON object with the keys %s. Output only the JSON.", strings.Join(quoted, ", "))
+	default:
+		b.WriteString("\n\nAnswer with the value only, without a preamble or notes.")
+	}
+	return b.String()
+}
+
+// rowFields formats a row as one "column: value" line per column
+func rowFields(header, row []string) string {
+	lines := make([]string, len(header))
+	for c, name := range header {
+		value := ""
+		if c < len(row) {
+			value = row[c]
+		}
+		lines[c] = name + ": " + value
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseRowsResponse reads the new columns' values for a batch's rows from
+// the model's answer: the value itself for one row and column, a JSON
+// object for one row, or a JSON array of objects for several
+func parseRowsResponse(response string, columns []string, batch rowsBatch) ([][]string, error) {
+	response = strings.TrimSpace(stripCodeFence(response))
+	if len(batch.rows) == 1 && len(columns) == 1 {
+		return [][]string{{response}}, nil
+	}
+	if len(batch.rows) == 1 {
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(response), &object); err != nil {
+			return nil, fmt.Errorf("answer is not a JSON object: %w", err)
+		}
+		row, err := rowValues(object, columns)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{row}, nil
+	}
+
+	var objects []map[string]interface{}
+	if err := json.Unmarshal([]byte(response), &objects); err != nil {
+		return nil, fmt.Errorf("answer is not a JSON array of objects: %w", err)
+	}
+	values := make([][]string, len(batch.rows))
+	for i, object := range objects {
+		r := i
+		if number, ok := object["row"].(float64); ok {
+			r = int(number) - batch.first - 1
+		}
+		if r < 0 || r >= len(batch.rows) {
+			return nil, fmt.Errorf("answer has row %v, which isn't in the batch", object["row"])
+		}
+		row, err := rowValues(object, columns)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", batch.first+r+1, err)
+		}
+		values[r] = row
+	}
+	for r, v := range values {
+		if v == nil {
+			return nil, fmt.Errorf("answer has no object for row %d", batch.first+r+1)
+		}
+	}
+	return values, nil
+}
+
+// rowValues returns an answer object's values of the columns, as text
+func rowValues(object map[string]interface{}, columns []string) ([]string, error) {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value, ok := object[column]
+		if !ok {
+			return nil, fmt.Errorf("answer has no %q", column)
+		}
+		switch v := value.(type) {
+		case nil:
+		case string:
+			values[i] = v
+		default:
+			encoded, _ := json.Marshal(v)
+			values[i] = string(encoded)
+		}
+	}
+	return values, nil
+}
+
+// rowRange names the rows of a batch, counting from 1
+func rowRange(batch rowsBatch) string {
+	if len(batch.rows) == 1 {
+		return fmt.Sprintf("row %d", batch.first+1)
+	}
+	return fmt.Sprintf("rows %d-%d", batch.first+1, batch.first+len(batch.rows))
+}
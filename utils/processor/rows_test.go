@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func rowsTestConfig(path, action string, rows *RowsConfig) *DSLConfig {
+	return &DSLConfig{Steps: []Step{{Name: "classify", Config: StepConfig{
+		Input:  path,
+		Model:  "gpt-4o",
+		Action: action,
+		Output: "STDOUT",
+		Rows:   rows,
+	}}}}
+}
+
+func writeLeads(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "leads.csv")
+	if err := os.WriteFile(path, []byte("company,notes\nAcme,\"wants a demo, soon\"\nGlobex,just browsing\nInitech,renewal due\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRowsOneAtATime(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	scripted := withScriptedProvider(t, "hot", "```\ncold\n```", "warm")
+	cfg := rowsTestConfig(writeLeads(t), "Rate {{ company }} ({{ row_index }}/{{ total_rows }}): {{ notes }}", &RowsConfig{Parallel: 1})
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if len(scripted.prompts) != 3 {
+		t.Fatalf("sent %d prompts, want one per row", len(scripted.prompts))
+	}
+	if p := scripted.prompts[0]; !strings.HasPrefix(p, "Rate Acme (1/3): wants a demo, soon\n\nAnswer with the value only") {
+		t.Errorf("first prompt = %q", p)
+	}
+	want := "company,notes,classify\nAcme,\"wants a demo, soon\",hot\nGlobex,just browsing,cold\nInitech,renewal due,warm\n"
+	if got := proc.LastOutput(); got != want {
+		t.Errorf("LastOutput() = %q, want %q", got, want)
+	}
+}
+
+func TestRowsInBatches(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	withScriptedProvider(t,
+		`[{"row": 2, "score": 2, "reason": "browsing"}, {"row": 1, "score": 9, "reason": "demo"}]`,
+		`{"score": 5, "reason": "renewal"}`,
+	)
+	cfg := rowsTestConfig(writeLeads(t), "Score each lead", &RowsConfig{Batch: 2, Columns: []string{"score", "notes"}, Parallel: 1, MaxAttempts: 1})
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err == nil || !strings.Contains(err.Error(), `rows 1-2: row 2: answer has no "notes"`) {
+		t.Fatalf("Process() error = %v, want the answers without notes refused", err)
+	}
+
+	scripted := withScriptedProvider(t,
+		`[{"row": 2, "score": 2, "notes": "browsing"}, {"row": 1, "score": 9, "notes": "demo"}]`,
+		`{"score": 5, "notes": "renewal"}`,
+	)
+	proc = NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if p := scripted.prompts[0]; !strings.Contains(p, "Rows:\nrow,company,notes\n1,Acme,\"wants a demo, soon\"\n2,Globex,just browsing") || !strings.Contains(p, `"row" (the row's number) and the keys "score", "notes"`) {
+		t.Errorf("first prompt = %q", p)
+	}
+	if p := scripted.prompts[1]; !strings.Contains(p, "Row:\ncompany: Initech\nnotes: renewal due") || !strings.Contains(p, `JSON object with the keys "score", "notes"`) {
+		t.Errorf("second prompt = %q", p)
+	}
+	want := "company,notes,score\nAcme,demo,9\nGlobex,browsing,2\nInitech,renewal,5\n"
+	if got := proc.LastOutput(); got != want {
+		t.Errorf("LastOutput() = %q, want %q", got, want)
+	}
+}
+
+func TestRowsSkipErrors(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	previousWait := chunkRetryWait
+	chunkRetryWait = 0
+	defer func() { chunkRetryWait = previousWait }()
+
+	withScriptedProvider(t, "hot", "cold")
+	cfg := rowsTestConfig(writeLeads(t), "Rate {{ row }}", &RowsConfig{Parallel: 1, MaxAttempts: 1, Columns: []string{"rating"}})
+	cfg.Steps[0].Config.SkipErrors = true
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	want := "company,notes,rating\nAcme,\"wants a demo, soon\",hot\nGlobex,just browsing,cold\nInitech,renewal due,\n"
+	if got := proc.LastOutput(); got != want {
+		t.Errorf("LastOutput() = %q, want %q", got, want)
+	}
+}
+
+func TestRowsValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.stepConfigErrors("classify", StepConfig{
+		Input: "leads.csv", Model: []interface{}{"gpt-4o", "gpt-4o-mini"}, Action: "Rate it", Output: "STDOUT",
+		Rows:  &RowsConfig{Batch: -1, Columns: []string{"score", "score"}},
+		Chunk: &ChunkConfig{By: "lines", Size: 10},
+	})
+	want := []string{"rows.batch cannot be negative", "lists 'score' twice", "needs one model", "can't be used with chunk"}
+	if len(errs) != len(want) {
+		t.Fatalf("stepConfigErrors() = %v, want %d errors", errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i], w) {
+			t.Errorf("error %d = %q, want it to mention %q", i, errs[i], w)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/sandbox"
+)
+
+// getSandbox returns the filesystem sandbox for this processor, or nil when
+// running without a server data directory (plain CLI mode)
+func (p *Processor) getSandbox() *sandbox.Sandbox {
+	p.sandboxOnce.Do(func() {
+		if p.serverConfig == nil || p.serverConfig.DataDir == "" {
+			return
+		}
+		root := filepath.Join(p.serverConfig.DataDir, p.runtimeDir)
+		sb, err := sandbox.New(root, p.serverConfig.AllowedPaths)
+		if err != nil {
+			p.sandboxErr = err
+			return
+		}
+		p.sandbox = sb
+		p.debugf("Filesystem sandbox rooted at: %s", sb.Root())
+	})
+	return p.sandbox
+}
+
+// confinePath resolves a workflow-supplied path through the sandbox when one
+// is active. Outside server mode the path is returned unchanged.
+func (p *Processor) confinePath(path string) (string, error) {
+	sb := p.getSandbox()
+	if p.sandboxErr != nil {
+		return "", fmt.Errorf("sandbox unavailable: %w", p.sandboxErr)
+	}
+	if sb == nil {
+		return path, nil
+	}
+	resolved, err := sb.Resolve(path)
+	if err != nil {
+		p.debugf("Sandbox rejected path '%s': %v", path, err)
+		return "", err
+	}
+	return resolved, nil
+}
+
+// trustPath marks a file created internally by the processor (STDIN buffers,
+// fetched URLs, chunks) so it bypasses the sandbox when read back as input
+func (p *Processor) trustPath(path string) {
+	p.trustedPaths.Store(path, true)
+}
+
+// isTrustedPath reports whether path was created internally by the processor
+func (p *Processor) isTrustedPath(path string) bool {
+	_, ok := p.trustedPaths.Load(path)
+	return ok
+}
+
+// processSandboxedInput resolves a file or glob input inside the sandbox
+func (p *Processor) processSandboxedInput(sb *sandbox.Sandbox, inputPath string) error {
+	if p.isTrustedPath(inputPath) {
+		p.debugf("Input '%s' was created internally, skipping sandbox resolution", inputPath)
+		return p.processFile(inputPath)
+	}
+
+	resolved, err := sb.Resolve(inputPath)
+	if err != nil {
+		return fmt.Errorf("input '%s' rejected: %w", inputPath, err)
+	}
+
+	if strings.ContainsAny(inputPath, "*?[") {
+		if err := os.MkdirAll(sb.Root(), 0755); err != nil {
+			return fmt.Errorf("failed to create runtime directory '%s': %w", sb.Root(), err)
+		}
+		matches, err := filepath.Glob(resolved)
+		if err != nil {
+			return fmt.Errorf("error processing wildcard pattern %s: %w", inputPath, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("glob pattern '%s' did not match any files", inputPath)
+		}
+		for _, match := range matches {
+			// Each match is re-resolved so a symlink inside the root cannot escape it
+			confined, err := sb.Resolve(match)
+			if err != nil {
+				return fmt.Errorf("glob match '%s' rejected: %w", match, err)
+			}
+			info, err := os.Stat(confined)
+			if err != nil {
+				return fmt.Errorf("error accessing matched path %s: %w", confined, err)
+			}
+			if info.IsDir() {
+				continue
+			}
+			if err := p.processFile(confined); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if p.isOutputInOtherSteps(inputPath) {
+				p.debugf("File '%s' does not exist yet but will be created as output in another step", inputPath)
+				return nil
+			}
+			return fmt.Errorf("input file '%s' not found (checked path: %s)", inputPath, resolved)
+		}
+		return fmt.Errorf("error accessing input path '%s': %w", resolved, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("input path '%s' is a directory, not a file", resolved)
+	}
+
+	return p.processFile(resolved)
+}
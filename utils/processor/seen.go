@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"path/filepath"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/seen"
+)
+
+// seenDir returns where the items inputs have already read are kept: in
+// the server's data directory, or the user's
+func (p *Processor) seenDir() string {
+	if p.serverConfig != nil && p.serverConfig.DataDir != "" {
+		return filepath.Join(p.serverConfig.DataDir, ".comanda", "seen")
+	}
+	return filepath.Join(config.DataDir(), "seen")
+}
+
+// openSeen returns the store of items named name, opening it once per run
+func (p *Processor) openSeen(name string) (*seen.Store, error) {
+	path := seen.Path(p.seenDir(), name)
+	p.seenMu.Lock()
+	defer p.seenMu.Unlock()
+	if store, ok := p.seenStores[path]; ok {
+		return store, nil
+	}
+	store, err := seen.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if p.seenStores == nil {
+		p.seenStores = make(map[string]*seen.Store)
+	}
+	p.seenStores[path] = store
+	return store, nil
+}
+
+// saveSeen records the items read in this run once it succeeds; after a
+// failure they are read again by the next run
+func (p *Processor) saveSeen(runErr error) {
+	if runErr != nil {
+		return
+	}
+	p.seenMu.Lock()
+	defer p.seenMu.Unlock()
+	for _, store := range p.seenStores {
+		if err := store.Save(); err != nil {
+			config.WriteLog("[RUN] ", "Items read by this run not recorded: %v", err)
+			config.WarnLog("items read by this run were not recorded and will be read again: %v", err)
+		}
+	}
+}
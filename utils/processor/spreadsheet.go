@@ -0,0 +1,280 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/connectors"
+	"github.com/kris-hansen/comanda/utils/spreadsheet"
+)
+
+// appendToSheet and googleToken write rows to a Google Sheet with the
+// Google Drive credentials; tests replace them
+var (
+	appendToSheet = spreadsheet.Append
+	googleToken   = connectors.GoogleAccessToken
+)
+
+// spreadsheetOutput is the spreadsheet map of a step's output
+type spreadsheetOutput struct {
+	file        string // XLSX file to write
+	googleSheet string // Google Sheet URL or ID to append to
+	sheet       string
+	format      string            // csv, json or jsonl; detected when empty
+	columns     map[string]string // Column name -> type, replacing the inferred type
+}
+
+// parseSpreadsheetOutput reads a spreadsheet output map, such as
+// {file: leads.xlsx, columns: {amount: number}} or
+// {google_sheet: https://docs.google.com/spreadsheets/d/..., sheet: Leads}
+func parseSpreadsheetOutput(spec map[string]interface{}) (spreadsheetOutput, error) {
+	out := spreadsheetOutput{}
+	out.file, _ = spec["file"].(string)
+	out.googleSheet, _ = spec["google_sheet"].(string)
+	out.sheet, _ = spec["sheet"].(string)
+	out.format, _ = spec["format"].(string)
+	if (out.file == "") == (out.googleSheet == "") {
+		return out, fmt.Errorf("spreadsheet output needs a file or a google_sheet")
+	}
+	switch out.format {
+	case "", "csv", "json", "jsonl":
+	default:
+		return out, fmt.Errorf("invalid spreadsheet format %q (expected csv, json or jsonl)", out.format)
+	}
+	if columns, ok := spec["columns"].(map[string]interface{}); ok {
+		out.columns = make(map[string]string, len(columns))
+		for name, v := range columns {
+			typ, _ := v.(string)
+			if !spreadsheet.ValidType(typ) {
+				return out, fmt.Errorf("column %s has invalid type %q (expected %s)", name, typ, strings.Join(spreadsheet.Types, ", "))
+			}
+			out.columns[name] = typ
+		}
+	}
+	return out, nil
+}
+
+// parseTable reads CSV, a JSON array of objects or JSON lines from a
+// step's output, inside a markdown code fence or not. JSON columns are in
+// the order their keys first appear.
+func parseTable(response, format string, columns map[string]string) (spreadsheet.Table, error) {
+	var table spreadsheet.Table
+	data := []byte(strings.TrimSpace(stripCodeFence(response)))
+	detected := format == ""
+	if detected {
+		format = detectDataFormat("", data)
+	}
+
+	var names []string
+	var records []map[string]interface{}
+	switch format {
+	case "csv":
+		rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return table, fmt.Errorf("error parsing CSV output: %w", err)
+		}
+		if len(rows) > 0 {
+			for _, name := range rows[0] {
+				names = append(names, strings.TrimSpace(name))
+			}
+			for _, row := range rows[1:] {
+				record := make(map[string]interface{}, len(names))
+				for i, name := range names {
+					if i < len(row) {
+						record[name] = row[i]
+					}
+				}
+				records = append(records, record)
+			}
+		}
+		if detected && (len(names) < 2 || len(records) == 0) {
+			// Prose parses as CSV with a header line only
+			return table, fmt.Errorf("output is not CSV with a header and rows, a JSON array or JSON lines; set format: csv for other CSV")
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		seen := make(map[string]bool)
+		read := func() error {
+			keys, record, err := decodeOrderedObject(dec)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if !seen[key] {
+					seen[key] = true
+					names = append(names, key)
+				}
+			}
+			records = append(records, record)
+			return nil
+		}
+		if format == "json" {
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return table, fmt.Errorf("expected a JSON array of objects")
+			}
+			for dec.More() {
+				if err := read(); err != nil {
+					return table, fmt.Errorf("error parsing JSON output: %w", err)
+				}
+			}
+		} else {
+			for dec.More() {
+				if err := read(); err != nil {
+					return table, fmt.Errorf("error parsing JSON lines output, line %d: %w", len(records)+1, err)
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return table, fmt.Errorf("output has no columns")
+	}
+
+	for _, name := range names {
+		table.Columns = append(table.Columns, spreadsheet.Column{Name: name, Type: columns[name]})
+	}
+	for _, record := range records {
+		row := make([]interface{}, len(names))
+		for i, name := range names {
+			row[i] = record[name]
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	var unknown []string
+	for name := range columns {
+		if !slices.Contains(names, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return table, fmt.Errorf("columns %s are not in the output", strings.Join(unknown, ", "))
+	}
+	table.InferTypes()
+	return table, nil
+}
+
+// decodeOrderedObject decodes the next JSON object, returning its keys in
+// order with the object
+func decodeOrderedObject(dec *json.Decoder) ([]string, map[string]interface{}, error) {
+	if tok, err := dec.Token(); err != nil {
+		return nil, nil, err
+	} else if tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected an object, got %v", tok)
+	}
+	var keys []string
+	record := make(map[string]interface{})
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := tok.(string)
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if _, dup := record[key]; !dup {
+			keys = append(keys, key)
+		}
+		record[key] = value
+	}
+	if _, err := dec.Token(); err != nil { // The closing brace
+		return nil, nil, err
+	}
+	return keys, record, nil
+}
+
+// writeXLSX converts a step's output to a formatted XLSX file
+func (p *Processor) writeXLSX(output, response, sheet, format string, columns map[string]string) error {
+	table, err := parseTable(response, format, columns)
+	if err != nil {
+		return err
+	}
+	outputPath, err := p.resolveOutputPath(output)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if sheet == "" {
+		sheet = strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+	}
+	if err := spreadsheet.WriteXLSX(&buf, sheet, table); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write spreadsheet %s: %w", outputPath, err)
+	}
+	config.InfoLog("\nSpreadsheet with %d row(s) written to file: %s", len(table.Rows), outputPath)
+	return nil
+}
+
+// writeSpreadsheetOutput writes a step's output to an XLSX file or
+// appends it to a Google Sheet
+func (p *Processor) writeSpreadsheetOutput(response string, spec map[string]interface{}) error {
+	out, err := parseSpreadsheetOutput(spec)
+	if err != nil {
+		return err
+	}
+	if out.file != "" {
+		return p.writeXLSX(out.file, response, out.sheet, out.format, out.columns)
+	}
+
+	id, err := spreadsheet.SpreadsheetID(out.googleSheet)
+	if err != nil {
+		return err
+	}
+	table, err := parseTable(response, out.format, out.columns)
+	if err != nil {
+		return err
+	}
+	settings := p.envConfig.ConnectorSettings()
+	if err := checkGoogleSheets(settings); err != nil {
+		return err
+	}
+	token, err := googleToken(p.context(), settings)
+	if err != nil {
+		return err
+	}
+	if err := appendToSheet(p.context(), token, id, out.sheet, table); err != nil {
+		return err
+	}
+	config.InfoLog("\nAppended %d row(s) to Google Sheet %s", len(table.Rows), id)
+	return nil
+}
+
+// checkGoogleSheets reports missing Google credentials for Google Sheets
+// outputs, which use the google_drive connector's
+func checkGoogleSheets(settings config.ConnectorsConfig) error {
+	if connectors.CheckConfigured(settings, connectors.KindGoogleDrive) != nil {
+		return fmt.Errorf("google_sheet outputs need connectors.google_drive in the env config, with an access_token or a client_id, client_secret and refresh_token allowed to edit spreadsheets")
+	}
+	return nil
+}
+
+// spreadsheetErrors reports problems with the spreadsheet map of a step's
+// output
+func (p *Processor) spreadsheetErrors(cfg StepConfig) []string {
+	output, _ := cfg.Output.(map[string]interface{})
+	spec, ok := output["spreadsheet"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	out, err := parseSpreadsheetOutput(spec)
+	if err == nil && out.googleSheet != "" {
+		if _, err = spreadsheet.SpreadsheetID(out.googleSheet); err == nil {
+			err = checkGoogleSheets(p.envConfig.ConnectorSettings())
+		}
+	}
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
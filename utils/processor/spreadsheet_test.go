@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"archive/zip"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/spreadsheet"
+)
+
+func TestParseTable(t *testing.T) {
+	response := "Here are the leads:\n```json\n[{\"name\":\"Acme\",\"score\":87,\"since\":\"2025-06-01\"},{\"name\":\"Globex\",\"score\":\"91\",\"region\":\"EU\"}]\n```"
+	table, err := parseTable(stripPreamble(response), "", map[string]string{"score": "number"})
+	if err != nil {
+		t.Fatalf("parseTable() error = %v", err)
+	}
+	var got []string
+	for _, col := range table.Columns {
+		got = append(got, col.Name+":"+col.Type)
+	}
+	if strings.Join(got, ",") != "name:string,score:number,since:date,region:string" {
+		t.Errorf("columns = %v, want key order and types", got)
+	}
+
+	table, err = parseTable("name,amount\nAcme,12.5\nGlobex,3\n", "", nil)
+	if err != nil || len(table.Rows) != 2 || table.Columns[1].Type != spreadsheet.TypeNumber {
+		t.Errorf("parseTable(csv) = %+v, %v", table, err)
+	}
+	if _, err := parseTable(`[{"a":1}]`, "", map[string]string{"b": "integer"}); err == nil {
+		t.Error("parseTable accepted a typed column missing from the output")
+	}
+}
+
+// stripPreamble drops the text before a code fence, as a postprocess step
+// would
+func stripPreamble(s string) string {
+	return s[strings.Index(s, "```"):]
+}
+
+func TestXLSXOutput(t *testing.T) {
+	dir := t.TempDir()
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+	path := filepath.Join(dir, "leads.xlsx")
+	if err := proc.handleOutput("gpt-4o", `{"name":"Acme","score":87}`+"\n"+`{"name":"Globex","score":91}`, []string{path}, nil); err != nil {
+		t.Fatalf("handleOutput() error = %v", err)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("output isn't a workbook: %v", err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 6 {
+		t.Errorf("workbook has %d parts, want 6", len(zr.File))
+	}
+
+	if err := proc.handleOutput("gpt-4o", "Sorry, I can't help with that.", []string{path}, nil); err == nil {
+		t.Error("handleOutput() wrote unstructured output to an xlsx file")
+	}
+}
+
+func TestGoogleSheetOutput(t *testing.T) {
+	var sheet, id string
+	var rows int
+	previousAppend, previousToken := appendToSheet, googleToken
+	appendToSheet = func(ctx context.Context, token, spreadsheetID, sheetName string, table spreadsheet.Table) error {
+		id, sheet, rows = spreadsheetID, sheetName, len(table.Rows)
+		return nil
+	}
+	googleToken = func(ctx context.Context, settings config.ConnectorsConfig) (string, error) { return "tok", nil }
+	defer func() { appendToSheet, googleToken = previousAppend, previousToken }()
+
+	env := createTestEnvConfig()
+	proc := NewProcessor(&DSLConfig{}, env, createTestServerConfig(), false)
+	spec := map[string]interface{}{"google_sheet": "https://docs.google.com/spreadsheets/d/abc123/edit", "sheet": "Leads"}
+	if err := proc.writeSpreadsheetOutput("name,score\nAcme,87\n", spec); err == nil || !strings.Contains(err.Error(), "connectors.google_drive") {
+		t.Fatalf("writeSpreadsheetOutput() error = %v, want the missing credentials", err)
+	}
+	if errs := proc.spreadsheetErrors(StepConfig{Output: map[string]interface{}{"spreadsheet": spec}}); len(errs) != 1 {
+		t.Errorf("spreadsheetErrors() = %v, want the missing credentials", errs)
+	}
+
+	env.Connectors = &config.ConnectorsConfig{GoogleDrive: &config.GoogleDriveConfig{AccessToken: "tok"}}
+	if err := proc.writeSpreadsheetOutput("name,score\nAcme,87\n", spec); err != nil {
+		t.Fatalf("writeSpreadsheetOutput() error = %v", err)
+	}
+	if id != "abc123" || sheet != "Leads" || rows != 1 {
+		t.Errorf("appended %d rows to %s/%s", rows, id, sheet)
+	}
+	if _, err := parseSpreadsheetOutput(map[string]interface{}{"file": "a.xlsx", "columns": map[string]interface{}{"x": "money"}}); err == nil {
+		t.Error("parseSpreadsheetOutput accepted an unknown column type")
+	}
+}
@@ -0,0 +1,363 @@
+package processor
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StepTypeSummarize is the type of steps that summarize text
+const StepTypeSummarize = "summarize"
+
+// Strategies of a summarize step
+const (
+	SummarizeStuff     = "stuff"      // The whole text in one prompt
+	SummarizeMapReduce = "map-reduce" // Each part summarized at once, then the summaries combined
+	SummarizeRefine    = "refine"     // A summary of the first part, refined with each part after it
+)
+
+// summarizeStrategies lists the strategies a summarize step accepts
+var summarizeStrategies = []string{SummarizeStuff, SummarizeMapReduce, SummarizeRefine}
+
+// defaultSummarizeChunkTokens is the most text a summarize step sends in
+// one prompt; longer texts are summarized in parts
+const defaultSummarizeChunkTokens = 3000
+
+// summaryLengths are the words of the named lengths of a summary
+var summaryLengths = map[string]string{
+	"short":  "about 100 words",
+	"medium": "about 250 words",
+	"long":   "about 600 words",
+}
+
+// summaryStyles describe the named styles of a summary
+var summaryStyles = map[string]string{
+	"bullets":   "a bulleted list of the key points",
+	"prose":     "flowing paragraphs of prose",
+	"executive": "an executive summary: the bottom line first, then the key points, risks and next steps",
+	"tldr":      "one or two sentences",
+}
+
+// isSummarizeStep reports whether a step is a summarize step
+func isSummarizeStep(cfg StepConfig) bool {
+	return cfg.Type == StepTypeSummarize
+}
+
+// summarizeStepErrors lists the problems with a summarize step
+func (p *Processor) summarizeStepErrors(config StepConfig) []string {
+	var errors []string
+	if inputs := p.NormalizeStringSlice(config.Input); len(inputs) == 0 || inputs[0] == "NA" {
+		errors = append(errors, "summarize steps need text as input: STDIN or files")
+	}
+	if modelNames := p.NormalizeStringSlice(config.Model); len(modelNames) != 1 || modelNames[0] == "NA" {
+		errors = append(errors, "summarize steps need one model")
+	}
+	if settings := config.Summarize; settings != nil {
+		if settings.Strategy != "" && !slices.Contains(summarizeStrategies, settings.Strategy) {
+			errors = append(errors, fmt.Sprintf("unknown summarize.strategy '%s' (expected %s)", settings.Strategy, strings.Join(summarizeStrategies, ", ")))
+		}
+		if settings.ChunkTokens < 0 {
+			errors = append(errors, "'summarize.chunk_tokens' can't be negative")
+		}
+		if settings.Parallel < 0 {
+			errors = append(errors, "'summarize.parallel' can't be negative")
+		}
+	}
+	if len(p.NormalizeStringSlice(config.Output)) == 0 {
+		errors = append(errors, "output is required for summarize steps (can be STDOUT for console output)")
+	}
+	return errors
+}
+
+// summaryLength returns the length instruction of a summary: a named
+// length, a number of words, or the length as written
+func summaryLength(length string) string {
+	length = strings.TrimSpace(length)
+	if words, ok := summaryLengths[strings.ToLower(length)]; ok {
+		return words
+	}
+	if n, err := strconv.Atoi(length); err == nil {
+		return fmt.Sprintf("about %d words", n)
+	}
+	return length
+}
+
+// summaryStyle returns the style instruction of a summary: a named style
+// or the style as written
+func summaryStyle(style string) string {
+	style = strings.TrimSpace(style)
+	if description, ok := summaryStyles[strings.ToLower(style)]; ok {
+		return description
+	}
+	return style
+}
+
+// summaryRequirements lists the length, style and focus of the summary a
+// prompt asks for
+func summaryRequirements(settings SummarizeStep, focus string) string {
+	var b strings.Builder
+	if settings.Length != "" {
+		fmt.Fprintf(&b, "- Length: %s.\n", summaryLength(settings.Length))
+	}
+	if settings.Style != "" {
+		fmt.Fprintf(&b, "- Style: %s.\n", summaryStyle(settings.Style))
+	}
+	if focus != "" {
+		fmt.Fprintf(&b, "- Focus: %s\n", focus)
+	}
+	b.WriteString("- Output only the summary, without a preamble or notes.\n")
+	return b.String()
+}
+
+// stuffPrompt asks for the summary of a whole text
+func stuffPrompt(text string, settings SummarizeStep, focus string) string {
+	return "Summarize the text between the markers.\n\n" + summaryRequirements(settings, focus) +
+		fmt.Sprintf("\n<<<TEXT\n%s\nTEXT>>>", text)
+}
+
+// mapPrompt asks for the summary of one part of a longer text, to be
+// combined with the others'
+func mapPrompt(text string, part, parts int, focus string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Summarize part %d of %d of a longer document, between the markers. Your summary will be combined with those of the other parts, so keep every key fact, figure, name and decision, and leave out the rest.\n", part, parts)
+	if focus != "" {
+		fmt.Fprintf(&b, "Focus on: %s\n", focus)
+	}
+	b.WriteString("Output only the summary.\n")
+	fmt.Fprintf(&b, "\n<<<TEXT\n%s\nTEXT>>>", text)
+	return b.String()
+}
+
+// reducePrompt asks for one summary of the summaries of a text's parts.
+// The last reduce is given the length and style of the summary; those
+// before it keep the key facts for it.
+func reducePrompt(summaries []string, settings SummarizeStep, focus string, final bool) string {
+	var b strings.Builder
+	b.WriteString("Combine these summaries of consecutive parts of one document, in order, into one summary of the whole document. Merge repeated points.\n\n")
+	if final {
+		b.WriteString(summaryRequirements(settings, focus))
+	} else {
+		b.WriteString("- Keep every key fact, figure, name and decision.\n- Output only the summary.\n")
+	}
+	b.WriteString("\n<<<SUMMARIES\n")
+	for i, summary := range summaries {
+		fmt.Fprintf(&b, "[Part %d]\n%s\n\n", i+1, summary)
+	}
+	b.WriteString("SUMMARIES>>>")
+	return b.String()
+}
+
+// refinePrompt asks for a summary updated with the next part of the text
+func refinePrompt(summary, text string, part, parts int, settings SummarizeStep, focus string) string {
+	return fmt.Sprintf("Here is a summary of parts 1 to %d of a document, and part %d of %d. Refine the summary so it covers the new part too, changing it only where the new part adds to or corrects it.\n\n", part-1, part, parts) +
+		summaryRequirements(settings, focus) +
+		fmt.Sprintf("\n<<<SUMMARY\n%s\nSUMMARY>>>\n\n<<<TEXT\n%s\nTEXT>>>", summary, text)
+}
+
+// summaryParts splits the text a summarize step reads into the parts it
+// summarizes: the chunks of the step's chunk configuration, or parts of
+// chunk_tokens split at paragraphs
+func summaryParts(text string, step Step, maxTokens int) ([]string, error) {
+	if step.Config.Chunk == nil {
+		return splitParagraphs(text, maxTokens), nil
+	}
+	chunks, err := splitSource(text, step.Config.Chunk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk the input of step '%s': %w", step.Name, err)
+	}
+	return chunks, nil
+}
+
+// processSummarizeStep summarizes the step's inputs, read as one text,
+// with its strategy. Without one, texts that fit in one prompt are
+// stuffed and longer ones map-reduced.
+func (p *Processor) processSummarizeStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	modelName := p.NormalizeStringSlice(step.Config.Model)[0]
+	settings := SummarizeStep{}
+	if step.Config.Summarize != nil {
+		settings = *step.Config.Summarize
+	}
+	maxTokens := settings.ChunkTokens
+	if maxTokens == 0 {
+		maxTokens = defaultSummarizeChunkTokens
+	}
+	focus := strings.Join(p.NormalizeStringSlice(step.Config.Action), "\n")
+
+	sources, err := p.vectorSources(step)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, src := range sources {
+		if text := strings.TrimSpace(src.text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return "", fmt.Errorf("summarize step '%s' has no text to summarize", step.Name)
+	}
+	text := strings.Join(texts, "\n\n")
+
+	parts := []string{text}
+	if settings.Strategy != SummarizeStuff {
+		if parts, err = summaryParts(text, step, maxTokens); err != nil {
+			return "", err
+		}
+	}
+	strategy := settings.Strategy
+	if strategy == "" {
+		strategy = SummarizeStuff
+		if len(parts) > 1 {
+			strategy = SummarizeMapReduce
+		}
+	}
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: "Summarize (" + strategy + ")"}
+	emit := func(msg string) {
+		if isParallel {
+			p.emitParallelProgress(msg, stepInfo, parallelID)
+		} else {
+			p.emitProgress(msg, stepInfo)
+		}
+	}
+	emit(fmt.Sprintf("Summarizing %d part(s) with %s for step: %s", len(parts), strategy, step.Name))
+
+	if err := p.validateModel([]string{modelName}, nil); err != nil {
+		return "", fmt.Errorf("model validation error: %w", err)
+	}
+	if err := p.configureProviders(); err != nil {
+		return "", fmt.Errorf("provider configuration error: %w", err)
+	}
+	provider, err := p.stepProvider(step.Name, modelName)
+	if err != nil {
+		return "", err
+	}
+	send := func(prompt string) (string, error) {
+		if err := p.interrupted(); err != nil {
+			return "", err
+		}
+		reply, err := provider.SendPrompt(modelName, prompt)
+		if err != nil {
+			return "", fmt.Errorf("error summarizing in step %s: %w", step.Name, err)
+		}
+		return strings.TrimSpace(reply), nil
+	}
+
+	var summary string
+	switch strategy {
+	case SummarizeStuff:
+		summary, err = send(stuffPrompt(text, settings, focus))
+	case SummarizeRefine:
+		summary, err = p.refineSummary(step.Name, parts, settings, focus, send)
+	default:
+		summary, err = p.mapReduceSummary(step.Name, parts, settings, focus, maxTokens, send)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if err := p.handleOutput(modelName, summary, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+	return summary, nil
+}
+
+// refineSummary summarizes the first part, then refines the summary with
+// each part after it, in order
+func (p *Processor) refineSummary(stepName string, parts []string, settings SummarizeStep, focus string, send func(string) (string, error)) (string, error) {
+	p.emitChunk(stepName, 1, len(parts))
+	summary, err := send(stuffPrompt(parts[0], settings, focus))
+	for i := 1; i < len(parts) && err == nil; i++ {
+		p.emitChunk(stepName, i+1, len(parts))
+		summary, err = send(refinePrompt(summary, parts[i], i+1, len(parts), settings, focus))
+	}
+	return summary, err
+}
+
+// mapReduceSummary summarizes the parts several at a time, then combines
+// the summaries. Summaries too long to combine in one prompt are combined
+// in groups first, until they fit.
+func (p *Processor) mapReduceSummary(stepName string, parts []string, settings SummarizeStep, focus string, maxTokens int, send func(string) (string, error)) (string, error) {
+	if len(parts) == 1 {
+		return send(stuffPrompt(parts[0], settings, focus))
+	}
+	workers := DefaultChunkWorkers
+	if settings.Parallel > 0 {
+		workers = settings.Parallel
+	}
+	if p.debugger != nil {
+		workers = 1 // Prompts are reviewed one at a time, in order
+	}
+
+	summaries := make([]string, len(parts))
+	errs := make([]error, len(parts))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(parts); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				p.emitChunk(stepName, i+1, len(parts))
+				summaries[i], errs[i] = send(mapPrompt(parts[i], i+1, len(parts), focus))
+			}
+		}()
+	}
+	for i := range parts {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return "", fmt.Errorf("part %d: %w", i+1, err)
+		}
+	}
+
+	// Combine groups of summaries that fit in one prompt until all do
+	for totalTokens(summaries) > maxTokens && len(summaries) > 1 {
+		var groups [][]string
+		var group []string
+		size := 0
+		for _, summary := range summaries {
+			tokens := estimateTokens(summary)
+			if len(group) > 0 && size+tokens > maxTokens {
+				groups = append(groups, group)
+				group, size = nil, 0
+			}
+			group = append(group, summary)
+			size += tokens
+		}
+		groups = append(groups, group)
+		if len(groups) == len(summaries) {
+			break // Each summary fills a prompt alone; combine them all at once
+		}
+		p.debugf("Step '%s' combines %d summaries in %d groups", stepName, len(summaries), len(groups))
+		combined := make([]string, len(groups))
+		for i, group := range groups {
+			if len(group) == 1 {
+				combined[i] = group[0]
+				continue
+			}
+			var err error
+			if combined[i], err = send(reducePrompt(group, settings, focus, false)); err != nil {
+				return "", err
+			}
+		}
+		summaries = combined
+	}
+	return send(reducePrompt(summaries, settings, focus, true))
+}
+
+// totalTokens returns the estimated tokens of texts
+func totalTokens(texts []string) int {
+	n := 0
+	for _, text := range texts {
+		n += estimateTokens(text)
+	}
+	return n
+}
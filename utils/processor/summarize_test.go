@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runSummarize(t *testing.T, text string, settings *SummarizeStep, replies ...string) (string, *scriptedProvider) {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "report.md")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scripted := withScriptedProvider(t, replies...)
+	cfg := &DSLConfig{Steps: []Step{{Name: "summarize", Config: StepConfig{
+		Type: StepTypeSummarize, Input: path, Model: "gpt-4o", Action: "What changed for customers", Output: "STDOUT", Summarize: settings,
+	}}}}
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	return proc.LastOutput(), scripted
+}
+
+// longReport has three paragraphs of about 50 tokens each
+var longReport = strings.Repeat("Revenue grew in the first quarter. ", 6) + "\n\n" +
+	strings.Repeat("Churn fell after the pricing change. ", 6) + "\n\n" +
+	strings.Repeat("The mobile app shipped in March. ", 6)
+
+func TestSummarizeStuff(t *testing.T) {
+	out, scripted := runSummarize(t, "Revenue grew 12%.", &SummarizeStep{Length: "50", Style: "bullets"}, "- Revenue grew 12%")
+	if out != "- Revenue grew 12%" {
+		t.Errorf("output = %q", out)
+	}
+	if len(scripted.prompts) != 1 {
+		t.Fatalf("sent %d prompts, want 1", len(scripted.prompts))
+	}
+	for _, want := range []string{"- Length: about 50 words.", "- Style: a bulleted list of the key points.", "- Focus: What changed for customers", "<<<TEXT\nRevenue grew 12%.\nTEXT>>>"} {
+		if !strings.Contains(scripted.prompts[0], want) {
+			t.Errorf("prompt doesn't contain %q:\n%s", want, scripted.prompts[0])
+		}
+	}
+}
+
+func TestSummarizeMapReduce(t *testing.T) {
+	out, scripted := runSummarize(t, longReport, &SummarizeStep{ChunkTokens: 60, Parallel: 1, Style: "a haiku"},
+		"Revenue up.", "Churn down.", "App shipped.", "Growth, loyalty, launch.")
+	if out != "Growth, loyalty, launch." {
+		t.Errorf("output = %q", out)
+	}
+	if len(scripted.prompts) != 4 {
+		t.Fatalf("sent %d prompts, want three maps and a reduce", len(scripted.prompts))
+	}
+	if p := scripted.prompts[1]; !strings.HasPrefix(p, "Summarize part 2 of 3") || !strings.Contains(p, "Churn fell") || strings.Contains(p, "Style:") {
+		t.Errorf("second map prompt = %q", p)
+	}
+	if p := scripted.prompts[3]; !strings.Contains(p, "[Part 1]\nRevenue up.\n\n[Part 2]\nChurn down.\n\n[Part 3]\nApp shipped.") || !strings.Contains(p, "- Style: a haiku.") {
+		t.Errorf("reduce prompt = %q", p)
+	}
+}
+
+func TestSummarizeMapReduceCollapses(t *testing.T) {
+	long := strings.Repeat("word ", 32)
+	_, scripted := runSummarize(t, longReport, &SummarizeStep{Strategy: SummarizeMapReduce, ChunkTokens: 100, Parallel: 1},
+		long, long, long, "Combined first two.", "Final.")
+	if len(scripted.prompts) != 5 {
+		t.Fatalf("sent %d prompts, want three maps, a partial reduce and a final one", len(scripted.prompts))
+	}
+	if p := scripted.prompts[3]; !strings.Contains(p, "- Keep every key fact") || strings.Contains(p, "[Part 3]") {
+		t.Errorf("partial reduce prompt = %q", p)
+	}
+	if p := scripted.prompts[4]; !strings.Contains(p, "[Part 1]\nCombined first two.\n\n[Part 2]\n"+strings.TrimSpace(long)) {
+		t.Errorf("final reduce prompt = %q", p)
+	}
+}
+
+func TestSummarizeRefine(t *testing.T) {
+	out, scripted := runSummarize(t, longReport, &SummarizeStep{Strategy: SummarizeRefine, ChunkTokens: 60},
+		"Revenue up.", "Revenue up, churn down.", "Revenue up, churn down, app shipped.")
+	if out != "Revenue up, churn down, app shipped." {
+		t.Errorf("output = %q", out)
+	}
+	if p := scripted.prompts[2]; !strings.HasPrefix(p, "Here is a summary of parts 1 to 2 of a document, and part 3 of 3.") || !strings.Contains(p, "<<<SUMMARY\nRevenue up, churn down.\nSUMMARY>>>") || !strings.Contains(p, "mobile app") {
+		t.Errorf("last refine prompt = %q", p)
+	}
+}
+
+func TestSummarizeStepValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.stepConfigErrors("summarize", StepConfig{
+		Type: StepTypeSummarize, Input: "NA", Model: "NA",
+		Summarize: &SummarizeStep{Strategy: "mapreduce", ChunkTokens: -1},
+	})
+	want := []string{"need text as input", "need one model", "unknown summarize.strategy 'mapreduce'", "chunk_tokens' can't be negative", "output is required"}
+	if len(errs) != len(want) {
+		t.Fatalf("stepConfigErrors() = %v, want %d errors", errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i], w) {
+			t.Errorf("error %d = %q, want it to mention %q", i, errs[i], w)
+		}
+	}
+}
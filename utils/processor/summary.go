@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"sync"
+)
+
+// Step statuses in a run summary
+const (
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+)
+
+// StepSummary is a finished step's line in the summary printed after a run
+type StepSummary struct {
+	Name             string  `json:"name"`
+	Model            string  `json:"model,omitempty"`
+	Status           string  `json:"status"`
+	DurationMS       int64   `json:"duration_ms"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Retries          int     `json:"retries"`
+	CacheHits        int     `json:"cache_hits"`
+	Cost             float64 `json:"cost"`
+	Error            string  `json:"error,omitempty"`
+}
+
+// runSummary collects the summaries of the steps a run finished
+type runSummary struct {
+	mu    sync.Mutex
+	steps []StepSummary
+}
+
+// Summary returns the steps the run finished, including failed ones, in the
+// order they finished
+func (p *Processor) Summary() []StepSummary {
+	p.summary.mu.Lock()
+	defer p.summary.mu.Unlock()
+	return append([]StepSummary(nil), p.summary.steps...)
+}
+
+// summarize adds a finished step to the run summary
+func (p *Processor) summarize(step StepSummary) {
+	p.summary.mu.Lock()
+	defer p.summary.mu.Unlock()
+	p.summary.steps = append(p.summary.steps, step)
+}
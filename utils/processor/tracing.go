@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// tracer creates a span for each run, each step and each model call. Spans
+// are only exported once a tracer provider is installed, see the telemetry
+// package.
+var tracer = otel.Tracer("github.com/kris-hansen/comanda/utils/processor")
+
+// startStepSpan starts the span of a step and makes it the parent of the
+// step's model calls
+func (p *Processor) startStepSpan(step Step) trace.Span {
+	ctx, span := tracer.Start(p.context(), "step "+step.Name,
+		trace.WithAttributes(attribute.String("comanda.step.name", step.Name)))
+	p.stepContexts.Store(step.Name, ctx)
+	return span
+}
+
+// endStepSpan records a step's model, token estimates and error on its span
+func (p *Processor) endStepSpan(span trace.Span, step Step, metrics *PerformanceMetrics, err error) {
+	p.stepContexts.Delete(step.Name)
+	if models := p.NormalizeStringSlice(step.Config.Model); len(models) > 0 {
+		span.SetAttributes(attribute.StringSlice("comanda.step.models", models))
+	}
+	span.SetAttributes(
+		attribute.Int("gen_ai.usage.input_tokens", metrics.PromptTokens),
+		attribute.Int("gen_ai.usage.output_tokens", metrics.CompletionTokens),
+	)
+	endSpan(span, err)
+}
+
+// stepContext returns the context of a running step's span
+func (p *Processor) stepContext(stepName string) context.Context {
+	if ctx, ok := p.stepContexts.Load(stepName); ok {
+		return ctx.(context.Context)
+	}
+	return p.context()
+}
+
+// traceProvider gives each of a step's model calls its own span
+func (p *Processor) traceProvider(stepName string, provider models.Provider) models.Provider {
+	return &tracedProvider{Provider: provider, step: stepName, processor: p}
+}
+
+// tracedProvider wraps each prompt in a client span carrying the model and
+// the estimated tokens sent and received, and lets the run's context
+// interrupt it
+type tracedProvider struct {
+	models.Provider
+	step      string
+	processor *Processor
+}
+
+func (t *tracedProvider) SendPrompt(modelName, prompt string) (string, error) {
+	span := t.start(modelName, prompt)
+	response, err := t.processor.callProvider(func() (string, error) {
+		return t.Provider.SendPrompt(modelName, prompt)
+	})
+	t.end(span, response, err)
+	t.record(PromptRecord{Model: modelName, Prompt: prompt}, response, err)
+	return response, err
+}
+
+func (t *tracedProvider) SendPromptWithFile(modelName, prompt string, file models.FileInput) (string, error) {
+	span := t.start(modelName, prompt)
+	span.SetAttributes(attribute.String("comanda.input.file", file.Path))
+	response, err := t.processor.callProvider(func() (string, error) {
+		return t.Provider.SendPromptWithFile(modelName, prompt, file)
+	})
+	t.end(span, response, err)
+	t.record(PromptRecord{Model: modelName, Prompt: prompt, File: file.Path, MimeType: file.MimeType}, response, err)
+	return response, err
+}
+
+// record keeps the prompt for the step's record, for comanda replay
+func (t *tracedProvider) record(prompt PromptRecord, response string, err error) {
+	prompt.Response = response
+	if err != nil {
+		prompt.Error = err.Error()
+	}
+	t.processor.recordPrompt(t.step, prompt)
+}
+
+func (t *tracedProvider) start(modelName, prompt string) trace.Span {
+	_, span := tracer.Start(t.processor.stepContext(t.step), "chat "+modelName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.system", t.Provider.Name()),
+			attribute.String("gen_ai.request.model", modelName),
+			attribute.String("comanda.step.name", t.step),
+			attribute.Int("gen_ai.usage.input_tokens", estimateTokens(prompt)),
+		))
+	return span
+}
+
+func (t *tracedProvider) end(span trace.Span, response string, err error) {
+	span.SetAttributes(attribute.Int("gen_ai.usage.output_tokens", estimateTokens(response)))
+	endSpan(span, err)
+}
+
+// endSpan records err, if any, with secrets redacted, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		message := config.RedactError(err)
+		span.RecordError(errors.New(message))
+		span.SetStatus(codes.Error, message)
+	}
+	span.End()
+}
@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+func TestTracingSpans(t *testing.T) {
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		return NewMockProvider("openai")
+	}
+	t.Cleanup(func() { models.DetectProvider = previous })
+
+	spans := tracetest.NewSpanRecorder()
+	previousProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previousProvider) })
+
+	proc := NewProcessor(joinTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans.Ended() {
+		byName[span.Name()] = span
+	}
+	run, ok := byName["workflow"]
+	if !ok {
+		t.Fatalf("no workflow span among %d spans", len(spans.Ended()))
+	}
+
+	for _, step := range []string{"sentiment", "topics", "combine"} {
+		span, ok := byName["step "+step]
+		if !ok {
+			t.Errorf("no span for step %s", step)
+			continue
+		}
+		if span.Parent().SpanID() != run.SpanContext().SpanID() {
+			t.Errorf("step %s span is not a child of the workflow span", step)
+		}
+	}
+
+	calls := 0
+	for _, span := range spans.Ended() {
+		if span.Name() != "chat gpt-4o" {
+			continue
+		}
+		calls++
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		step := attrs["comanda.step.name"].AsString()
+		parent, ok := byName["step "+step]
+		if !ok || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("model call of step %q is not a child of its step span", step)
+		}
+		if attrs["gen_ai.system"].AsString() != "openai" || attrs["gen_ai.usage.output_tokens"].AsInt64() == 0 {
+			t.Errorf("model call attributes = %v", span.Attributes())
+		}
+	}
+	if calls != 3 {
+		t.Errorf("model call spans = %d, want 3", calls)
+	}
+}
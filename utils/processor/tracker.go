@@ -0,0 +1,214 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/connectors"
+	"github.com/kris-hansen/comanda/utils/tracker"
+)
+
+// fetchIssues, createIssue, updateIssue and commentOnIssue read and write
+// Jira and Linear issues; tests replace them
+var (
+	fetchIssues    = tracker.Fetch
+	createIssue    = tracker.Create
+	updateIssue    = tracker.Update
+	commentOnIssue = tracker.AddComment
+)
+
+// trackerMap returns the jira or linear map of an input or output map
+func trackerMap(v map[string]interface{}) (string, map[string]interface{}) {
+	for _, kind := range tracker.Kinds {
+		if spec, ok := v[kind].(map[string]interface{}); ok {
+			return kind, spec
+		}
+	}
+	return "", nil
+}
+
+// specStrings reads a string or list of strings from a map
+func specStrings(spec map[string]interface{}, key string) []string {
+	switch v := spec[key].(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// parseIssueQuery reads a jira or linear input map, such as
+// {jql: "project = ENG AND status = Open", limit: 20} or {issues: [ENG-1]}
+func parseIssueQuery(kind string, spec map[string]interface{}) (tracker.Query, error) {
+	q := tracker.Query{Keys: specStrings(spec, "issues")}
+	q.JQL, _ = spec["jql"].(string)
+	q.Team, _ = spec["team"].(string)
+	q.State, _ = spec["state"].(string)
+	q.Label, _ = spec["label"].(string)
+	q.Assignee, _ = spec["assignee"].(string)
+	if limit, ok := spec["limit"].(int); ok {
+		if limit <= 0 {
+			return q, fmt.Errorf("%s input limit must be positive", kind)
+		}
+		q.Limit = limit
+	}
+	if kind == tracker.KindJira && len(q.Keys) == 0 && q.JQL == "" {
+		return q, fmt.Errorf("jira input needs issues or a jql query")
+	}
+	if kind == tracker.KindLinear && len(q.Keys) == 0 && q.Team == "" && q.State == "" && q.Label == "" && q.Assignee == "" {
+		return q, fmt.Errorf("linear input needs issues or a team, state, label or assignee")
+	}
+	return q, nil
+}
+
+// issueOutput is a jira or linear output map
+type issueOutput struct {
+	action string // create, update or comment
+	issue  string
+	change tracker.Change
+}
+
+// parseIssueOutput reads a jira or linear output map, such as
+// {action: create, project: ENG, type: Bug, labels: [triage]} or
+// {action: comment, issue: ENG-123}
+func parseIssueOutput(kind string, spec map[string]interface{}) (issueOutput, error) {
+	out := issueOutput{}
+	out.action, _ = spec["action"].(string)
+	out.issue, _ = spec["issue"].(string)
+	out.change.Project, _ = spec["project"].(string)
+	out.change.Type, _ = spec["type"].(string)
+	out.change.Title, _ = spec["title"].(string)
+	out.change.Labels = specStrings(spec, "labels")
+	if out.action == "" {
+		out.action = "create"
+		if out.issue != "" {
+			out.action = "comment"
+		}
+	}
+	switch out.action {
+	case "create":
+		if out.change.Project == "" {
+			return out, fmt.Errorf("%s output creating an issue needs a project", kind)
+		}
+	case "update", "comment":
+		if out.issue == "" {
+			return out, fmt.Errorf("%s output to %s an issue needs the issue", kind, out.action)
+		}
+	default:
+		return out, fmt.Errorf("invalid %s output action %q (expected create, update or comment)", kind, out.action)
+	}
+	return out, nil
+}
+
+// fetchTrackerInputs saves the issues a jira or linear input selects, as
+// markdown with their comments, in a temporary directory. It returns their
+// paths and a function removing them.
+func (p *Processor) fetchTrackerInputs(stepName, kind string, spec map[string]interface{}) ([]string, func(), error) {
+	q, err := parseIssueQuery(kind, spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.debugf("Fetching issues from %s for step %s", kind, stepName)
+	issues, err := fetchIssues(p.context(), p.envConfig.TrackerSettings(), kind, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(issues) == 0 {
+		return nil, nil, fmt.Errorf("no %s issues match the input", kind)
+	}
+
+	dir, err := os.MkdirTemp(config.TempDir(), "comanda-"+kind+"-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	var paths []string
+	used := make(map[string]bool)
+	for _, issue := range issues {
+		name := documentFileName(connectors.Document{Title: issue.Key + " " + issue.Title, Ext: ".md"}, used)
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(issue.Render()), 0600); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to save %s: %w", issue.Key, err)
+		}
+		p.trustPath(path)
+		paths = append(paths, path)
+	}
+	p.debugf("Fetched %d issue(s) from %s for step %s", len(paths), kind, stepName)
+	return paths, cleanup, nil
+}
+
+// writeTrackerOutput creates an issue from a step's output, replaces an
+// issue's description with it, or posts it as a comment. A created issue
+// without a title takes the output's first line as its title.
+func (p *Processor) writeTrackerOutput(response, kind string, spec map[string]interface{}) error {
+	out, err := parseIssueOutput(kind, spec)
+	if err != nil {
+		return err
+	}
+	settings := p.envConfig.TrackerSettings()
+	response = strings.TrimSpace(response)
+	switch out.action {
+	case "create":
+		out.change.Description = response
+		if out.change.Title == "" {
+			first, rest, _ := strings.Cut(response, "\n")
+			out.change.Title = strings.TrimSpace(strings.TrimLeft(first, "# "))
+			out.change.Description = strings.TrimSpace(rest)
+		}
+		issue, err := createIssue(p.context(), settings, kind, out.change)
+		if err != nil {
+			return err
+		}
+		config.InfoLog("\nCreated %s issue %s: %s", kind, issue.Key, issue.URL)
+	case "update":
+		out.change.Description = response
+		if err := updateIssue(p.context(), settings, kind, out.issue, out.change); err != nil {
+			return err
+		}
+		p.debugf("Updated %s issue %s", kind, out.issue)
+	default:
+		if err := commentOnIssue(p.context(), settings, kind, out.issue, response); err != nil {
+			return err
+		}
+		p.debugf("Commented on %s issue %s", kind, out.issue)
+	}
+	return nil
+}
+
+// trackerErrors reports problems with the jira and linear maps of a step's
+// input and output
+func (p *Processor) trackerErrors(cfg StepConfig) []string {
+	var errors []string
+	if input, ok := cfg.Input.(map[string]interface{}); ok {
+		if kind, spec := trackerMap(input); kind != "" {
+			if _, err := parseIssueQuery(kind, spec); err != nil {
+				errors = append(errors, err.Error())
+			} else if err := tracker.CheckConfigured(p.envConfig.TrackerSettings(), kind); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+	if output, ok := cfg.Output.(map[string]interface{}); ok {
+		if kind, spec := trackerMap(output); kind != "" {
+			if _, err := parseIssueOutput(kind, spec); err != nil {
+				errors = append(errors, err.Error())
+			} else if err := tracker.CheckConfigured(p.envConfig.TrackerSettings(), kind); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+	return errors
+}
@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/tracker"
+)
+
+func TestJiraInputAndComment(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	var query tracker.Query
+	var commented []string
+	previousFetch, previousComment := fetchIssues, commentOnIssue
+	fetchIssues = func(ctx context.Context, settings config.TrackersConfig, kind string, q tracker.Query) ([]tracker.Issue, error) {
+		query = q
+		return []tracker.Issue{{Key: "ENG-1", Title: "Login fails", Status: "Open"}}, nil
+	}
+	commentOnIssue = func(ctx context.Context, settings config.TrackersConfig, kind, key, body string) error {
+		commented = append(commented, kind+" "+key+": "+body)
+		return nil
+	}
+	defer func() { fetchIssues, commentOnIssue = previousFetch, previousComment }()
+	previous := models.DetectProvider
+	models.DetectProvider = func(modelName string) models.Provider {
+		return &readingProvider{MockProvider: MockProvider{name: "openai"}}
+	}
+	defer func() { models.DetectProvider = previous }()
+
+	env := createTestEnvConfig()
+	env.Trackers = &config.TrackersConfig{Jira: &config.JiraConfig{URL: "https://acme.atlassian.net", Email: "bot@acme.com", APIToken: "tok"}}
+	cfg := &DSLConfig{Steps: []Step{{Name: "triage", Config: StepConfig{
+		Input:  map[string]interface{}{"jira": map[string]interface{}{"issues": "ENG-1"}},
+		Model:  "gpt-4o",
+		Action: "Suggest a cause",
+		Output: map[string]interface{}{"jira": map[string]interface{}{"issue": "ENG-1"}},
+	}}}}
+	proc := NewProcessor(cfg, env, createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if len(query.Keys) != 1 || query.Keys[0] != "ENG-1" {
+		t.Errorf("fetched with %+v", query)
+	}
+	if len(commented) != 1 || !strings.HasPrefix(commented[0], "jira ENG-1: summary\n# ENG-1: Login fails") {
+		t.Errorf("commented %q, want the step's output on ENG-1", commented)
+	}
+}
+
+func TestWriteTrackerOutputCreate(t *testing.T) {
+	var created tracker.Change
+	previous := createIssue
+	createIssue = func(ctx context.Context, settings config.TrackersConfig, kind string, c tracker.Change) (tracker.Issue, error) {
+		created = c
+		return tracker.Issue{Key: "ENG-9"}, nil
+	}
+	defer func() { createIssue = previous }()
+
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	spec := map[string]interface{}{"project": "ENG", "type": "Bug", "labels": []interface{}{"triage"}}
+	if err := proc.writeTrackerOutput("## Crash on save\n\nThe editor crashes.\n", "linear", spec); err != nil {
+		t.Fatal(err)
+	}
+	if created.Title != "Crash on save" || created.Description != "The editor crashes." || created.Labels[0] != "triage" {
+		t.Errorf("created %+v, want the first line as the title", created)
+	}
+}
+
+func TestTrackerValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.missingInputs(StepConfig{
+		Input:  map[string]interface{}{"linear": map[string]interface{}{"team": "ENG"}},
+		Output: map[string]interface{}{"jira": map[string]interface{}{"action": "update"}},
+	})
+	if len(errs) != 2 || !strings.Contains(errs[0], "trackers.linear.api_key") || !strings.Contains(errs[1], "needs the issue") {
+		t.Errorf("missingInputs() = %v, want the missing credentials and issue", errs)
+	}
+	if _, err := parseIssueQuery("jira", map[string]interface{}{"limit": 5}); err == nil {
+		t.Error("parseIssueQuery accepted a jira input without issues or jql")
+	}
+}
@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// StepTypeTranscribe is the type of steps that turn recordings into text
+const StepTypeTranscribe = "transcribe"
+
+// isTranscribeStep reports whether a step is a transcribe step
+func isTranscribeStep(cfg StepConfig) bool {
+	return cfg.Type == StepTypeTranscribe
+}
+
+// transcribeStepErrors lists the problems with a transcribe step
+func (p *Processor) transcribeStepErrors(config StepConfig) []string {
+	var errors []string
+	inputs := p.NormalizeStringSlice(config.Input)
+	switch {
+	case len(inputs) == 0:
+		errors = append(errors, "input tag is required for transcribe steps")
+	case strings.HasPrefix(inputs[0], "STDIN") || inputs[0] == "NA":
+		errors = append(errors, "transcribe steps need audio files as input")
+	}
+	if modelNames := p.NormalizeStringSlice(config.Model); len(modelNames) != 1 || modelNames[0] == "NA" {
+		errors = append(errors, "transcribe steps need one transcription model, such as whisper-1 or gpt-4o-transcribe")
+	}
+	if len(p.NormalizeStringSlice(config.Output)) == 0 {
+		errors = append(errors, "output is required for transcribe steps (can be STDOUT for console output)")
+	}
+	return errors
+}
+
+// stepTranscriber returns the configured provider that transcribes
+// recordings for a step
+func (p *Processor) stepTranscriber(step Step, modelName string) (models.Transcriber, error) {
+	var provider models.Provider
+	switch {
+	case p.resolver != nil:
+		provider = p.resolver(modelName)
+	case step.Config.Provider != "":
+		provider = models.ProviderByName(step.Config.Provider)
+	default:
+		provider = models.DetectTranscriptionProvider(modelName)
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("no provider found for transcription model %s", modelName)
+	}
+	transcriber, ok := provider.(models.Transcriber)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not transcribe audio", provider.Name())
+	}
+	if p.resolver == nil {
+		provider.SetVerbose(p.verbose)
+		if err := p.configureProvider(provider.Name(), provider); err != nil {
+			return nil, err
+		}
+	}
+	return transcriber, nil
+}
+
+// audioInputs resolves a step's inputs to the recordings they name,
+// expanding globs. In server mode the paths are confined to the sandbox;
+// in the CLI relative paths are read from the runtime directory, if any.
+func (p *Processor) audioInputs(inputs []string) ([]string, error) {
+	var paths []string
+	for _, input := range inputs {
+		path := input
+		if p.getSandbox() == nil && p.runtimeDir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(p.runtimeDir, path)
+		}
+		resolved, err := p.confinePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("input '%s' rejected: %w", input, err)
+		}
+		matches := []string{resolved}
+		if strings.ContainsAny(input, "*?[") {
+			if matches, err = filepath.Glob(resolved); err != nil {
+				return nil, fmt.Errorf("error processing wildcard pattern %s: %w", input, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("glob pattern '%s' did not match any files", input)
+			}
+		}
+		for _, match := range matches {
+			// A symlink a glob matched can't lead out of the sandbox
+			if match, err = p.confinePath(match); err != nil {
+				return nil, fmt.Errorf("input '%s' rejected: %w", input, err)
+			}
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, fmt.Errorf("error accessing %s: %w", match, err)
+			}
+			if info.IsDir() {
+				continue
+			}
+			if !models.IsAudioFile(match) {
+				return nil, fmt.Errorf("%s is not a recording (expected %s)", match, strings.Join(models.AudioExtensions, ", "))
+			}
+			if info.Size() > models.MaxAudioSize {
+				return nil, fmt.Errorf("%s is %s, more than the %s a recording can be; split it or lower its bitrate", match,
+					fileutil.FormatSize(info.Size()), fileutil.FormatSize(models.MaxAudioSize))
+			}
+			paths = append(paths, match)
+		}
+	}
+	return paths, nil
+}
+
+// processTranscribeStep outputs the text spoken in the step's recordings.
+// Several recordings are transcribed in order, each under a heading naming
+// its file.
+func (p *Processor) processTranscribeStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	modelName := p.NormalizeStringSlice(step.Config.Model)[0]
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: "Transcribe recordings"}
+	stepMsg := fmt.Sprintf("Transcribing recordings for step: %s", step.Name)
+	if isParallel {
+		p.emitParallelProgress(stepMsg, stepInfo, parallelID)
+	} else {
+		p.emitProgress(stepMsg, stepInfo)
+	}
+
+	paths, err := p.audioInputs(p.NormalizeStringSlice(step.Config.Input))
+	if err != nil {
+		return "", fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("transcribe step '%s' has no recordings to transcribe", step.Name)
+	}
+	transcriber, err := p.stepTranscriber(step, modelName)
+	if err != nil {
+		return "", err
+	}
+
+	var opts models.TranscribeOptions
+	if t := step.Config.Transcribe; t != nil {
+		opts = models.TranscribeOptions{Language: t.Language, Prompt: t.Prompt, Timestamps: t.Timestamps}
+	}
+	parts := make([]string, len(paths))
+	for i, path := range paths {
+		text, err := transcriber.Transcribe(modelName, path, opts)
+		if err != nil {
+			return "", fmt.Errorf("error transcribing %s in step %s: %w", filepath.Base(path), step.Name, err)
+		}
+		parts[i] = text
+		if len(paths) > 1 {
+			parts[i] = fmt.Sprintf("## %s\n\n%s", filepath.Base(path), text)
+		}
+	}
+
+	response := strings.Join(parts, "\n\n")
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if err := p.handleOutput(modelName, response, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+	p.debugf("Step '%s' transcribed %d recording(s)", step.Name, len(paths))
+	return response, nil
+}
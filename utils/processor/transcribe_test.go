@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// echoTranscriber "transcribes" a recording as its contents
+type echoTranscriber struct {
+	MockProvider
+	opts models.TranscribeOptions
+}
+
+func (e *echoTranscriber) Transcribe(modelName, path string, opts models.TranscribeOptions) (string, error) {
+	e.opts = opts
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+func TestTranscribeStep(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a-standup.m4a"), []byte("We ship on Friday."), 0644)
+	os.WriteFile(filepath.Join(dir, "b-retro.mp3"), []byte("Deploys were slow."), 0644)
+
+	cfg := &DSLConfig{Steps: []Step{
+		{Name: "transcribe", Config: StepConfig{
+			Type: StepTypeTranscribe, Input: filepath.Join(dir, "*"), Model: "whisper-1", Output: "STDOUT",
+			Transcribe: &TranscribeStep{Language: "en", Prompt: "Comanda"},
+		}},
+	}}
+	transcriber := &echoTranscriber{MockProvider: MockProvider{name: "openai"}}
+	newProc := func() *Processor {
+		proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+		proc.SetProviderResolver(func(modelName string) models.Provider { return transcriber })
+		proc.SetProgressWriter(discardProgress{})
+		return proc
+	}
+
+	// The glob matches a file that isn't a recording
+	os.WriteFile(filepath.Join(dir, "c-notes.txt"), []byte("x"), 0644)
+	if err := newProc().Process(); err == nil || !strings.Contains(err.Error(), "not a recording") {
+		t.Fatalf("Process() error = %v, want the text file refused", err)
+	}
+	cfg.Steps[0].Config.Input = filepath.Join(dir, "*.m*")
+	proc := newProc()
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if transcriber.opts.Language != "en" || transcriber.opts.Prompt != "Comanda" {
+		t.Errorf("transcribed with %+v, want the step's options", transcriber.opts)
+	}
+	transcript := proc.LastOutput()
+	want := "## a-standup.m4a\n\nWe ship on Friday.\n\n## b-retro.mp3\n\nDeploys were slow."
+	if transcript != want {
+		t.Errorf("transcript = %q, want %q", transcript, want)
+	}
+}
+
+func TestTranscribeStepValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.stepConfigErrors("transcribe", StepConfig{Type: StepTypeTranscribe, Input: "STDIN", Model: "NA"})
+	want := []string{"need audio files as input", "one transcription model", "output is required"}
+	if len(errs) != len(want) {
+		t.Fatalf("stepConfigErrors() = %v, want %d errors", errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i], w) {
+			t.Errorf("error %d = %q, want it to mention %q", i, errs[i], w)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package processor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/language"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// StepTypeTranslate is the type of steps that translate text
+const StepTypeTranslate = "translate"
+
+// defaultTranslateChunkTokens is the most text a translate step sends in
+// one prompt; longer documents are translated in parts
+const defaultTranslateChunkTokens = 2000
+
+// translateContextChars is how much of the previous part's translation
+// the prompt of a long document's next part repeats, so the parts read as
+// one text
+const translateContextChars = 600
+
+// isTranslateStep reports whether a step is a translate step
+func isTranslateStep(cfg StepConfig) bool {
+	return cfg.Type == StepTypeTranslate
+}
+
+// translateStepErrors lists the problems with a translate step
+func (p *Processor) translateStepErrors(config StepConfig) []string {
+	var errors []string
+	if inputs := p.NormalizeStringSlice(config.Input); len(inputs) == 0 || inputs[0] == "NA" {
+		errors = append(errors, "translate steps need text as input: STDIN or files")
+	}
+	if modelNames := p.NormalizeStringSlice(config.Model); len(modelNames) != 1 || modelNames[0] == "NA" {
+		errors = append(errors, "translate steps need one model")
+	}
+	if config.Translate == nil || strings.TrimSpace(config.Translate.To) == "" {
+		errors = append(errors, "'translate.to' is required: the language to translate into, such as fr or French")
+	} else if config.Translate.ChunkTokens < 0 {
+		errors = append(errors, "'translate.chunk_tokens' can't be negative")
+	}
+	if len(p.NormalizeStringSlice(config.Output)) == 0 {
+		errors = append(errors, "output is required for translate steps (can be STDOUT for console output)")
+	}
+	return errors
+}
+
+// translateGlossary returns the step's glossary with the terms of its
+// glossary file, a CSV file of term and translation rows
+func (p *Processor) translateGlossary(settings *TranslateStep) (map[string]string, error) {
+	glossary := make(map[string]string)
+	if settings.GlossaryFile != "" {
+		data, err := p.readStepFile(settings.GlossaryFile)
+		if err != nil {
+			return nil, err
+		}
+		reader := csv.NewReader(strings.NewReader(string(data)))
+		reader.FieldsPerRecord = -1
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing glossary %s: %w", settings.GlossaryFile, err)
+		}
+		for i, row := range rows {
+			if len(row) < 2 {
+				return nil, fmt.Errorf("glossary %s row %d: want a term and its translation", settings.GlossaryFile, i+1)
+			}
+			if term := strings.TrimSpace(row[0]); term != "" {
+				glossary[term] = strings.TrimSpace(row[1])
+			}
+		}
+	}
+	for term, translation := range settings.Glossary {
+		glossary[term] = translation
+	}
+	return glossary, nil
+}
+
+// splitParagraphs splits a text into parts of at most maxTokens at
+// paragraph breaks, keeping code blocks whole where they fit. Paragraphs
+// longer than a part are split at lines, then words.
+func splitParagraphs(text string, maxTokens int) []string {
+	if estimateTokens(text) <= maxTokens {
+		return []string{text}
+	}
+	maxChars := maxTokens * 4
+
+	// Paragraphs, with the blank lines inside code blocks kept
+	var paragraphs []string
+	var current []string
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+		}
+		if strings.TrimSpace(line) == "" && !inCode {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, strings.Join(current, "\n"))
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, strings.Join(current, "\n"))
+	}
+
+	var pieces []string
+	for _, para := range paragraphs {
+		if len(para) <= maxChars {
+			pieces = append(pieces, para)
+			continue
+		}
+		for _, line := range strings.Split(para, "\n") {
+			for len(line) > maxChars {
+				cut := strings.LastIndex(line[:maxChars], " ")
+				if cut <= 0 {
+					cut = maxChars
+				}
+				pieces = append(pieces, line[:cut])
+				line = strings.TrimLeft(line[cut:], " ")
+			}
+			pieces = append(pieces, line)
+		}
+	}
+
+	var parts []string
+	var part strings.Builder
+	for _, piece := range pieces {
+		if part.Len() > 0 && part.Len()+2+len(piece) > maxChars {
+			parts = append(parts, part.String())
+			part.Reset()
+		}
+		if part.Len() > 0 {
+			part.WriteString("\n\n")
+		}
+		part.WriteString(piece)
+	}
+	if part.Len() > 0 {
+		parts = append(parts, part.String())
+	}
+	return parts
+}
+
+// translationPrompt returns the prompt translating one part of a text.
+// The parts after the first repeat the end of the translation before them.
+func translationPrompt(text, from, to string, glossary map[string]string, instructions string, part, parts int, previous string) string {
+	var b strings.Builder
+	if from == "" {
+		fmt.Fprintf(&b, "You are a professional translator. Translate the text between the markers into %s.\n\n", to)
+	} else {
+		fmt.Fprintf(&b, "You are a professional translator. Translate the text between the markers from %s into %s.\n\n", from, to)
+	}
+	b.WriteString("- Output only the translation, without the markers, a preamble or notes.\n")
+	b.WriteString("- Keep the meaning, tone and register of the original.\n")
+	b.WriteString("- Keep the formatting exactly: markdown, line breaks, lists, tables and blank lines.\n")
+	b.WriteString("- Leave code, URLs, email addresses and placeholders such as {{ name }} or %s as they are.\n")
+	if len(glossary) > 0 {
+		b.WriteString("- Translate these terms as given, every time they appear:\n")
+		terms := make([]string, 0, len(glossary))
+		for term := range glossary {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		for _, term := range terms {
+			fmt.Fprintf(&b, "  - %s → %s\n", term, glossary[term])
+		}
+	}
+	if instructions != "" {
+		fmt.Fprintf(&b, "\nAlso: %s\n", instructions)
+	}
+	if parts > 1 {
+		fmt.Fprintf(&b, "\nThis is part %d of %d of a longer document.", part, parts)
+		if previous != "" {
+			fmt.Fprintf(&b, " Keep the terms and style of the translation so far, which ended:\n\"\"\"\n%s\n\"\"\"", previous)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n<<<TEXT\n%s\nTEXT>>>", text)
+	return b.String()
+}
+
+// cleanTranslation removes the markers a model repeats around its reply
+func cleanTranslation(reply string) string {
+	reply = strings.TrimSpace(reply)
+	reply = strings.TrimPrefix(reply, "<<<TEXT")
+	reply = strings.TrimSuffix(reply, "TEXT>>>")
+	return strings.TrimSpace(reply)
+}
+
+// processTranslateStep translates the step's inputs into the target
+// language. The source language is detected unless set, and text already
+// in the target language is output as it is. Long texts are translated in
+// parts, each given the glossary and the end of the part before it.
+func (p *Processor) processTranslateStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	modelName := p.NormalizeStringSlice(step.Config.Model)[0]
+	settings := step.Config.Translate
+	to := language.Name(settings.To)
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: "Translate into " + to}
+	emit := func(msg string) {
+		if isParallel {
+			p.emitParallelProgress(msg, stepInfo, parallelID)
+		} else {
+			p.emitProgress(msg, stepInfo)
+		}
+	}
+	emit(fmt.Sprintf("Translating into %s for step: %s", to, step.Name))
+
+	sources, err := p.vectorSources(step)
+	if err != nil {
+		return "", err
+	}
+	glossary, err := p.translateGlossary(settings)
+	if err != nil {
+		return "", fmt.Errorf("error loading glossary in step %s: %w", step.Name, err)
+	}
+	maxTokens := settings.ChunkTokens
+	if maxTokens == 0 {
+		maxTokens = defaultTranslateChunkTokens
+	}
+	instructions := strings.Join(p.NormalizeStringSlice(step.Config.Action), "\n")
+
+	var provider models.Provider
+	translations := make([]string, 0, len(sources))
+	for _, src := range sources {
+		text := strings.TrimSpace(src.text)
+		if text == "" {
+			continue
+		}
+		from := settings.From
+		if from == "" {
+			from = language.Detect(text)
+			p.debugf("Step '%s' detected %s as %q", step.Name, src.name, from)
+		}
+		if code := language.Code(from); code != "" && code == language.Code(settings.To) {
+			p.debugf("Step '%s' left %s as it is, already in %s", step.Name, src.name, to)
+			translations = append(translations, text)
+			continue
+		}
+
+		if provider == nil {
+			if err := p.validateModel([]string{modelName}, nil); err != nil {
+				return "", fmt.Errorf("model validation error: %w", err)
+			}
+			if err := p.configureProviders(); err != nil {
+				return "", fmt.Errorf("provider configuration error: %w", err)
+			}
+			configured := p.GetModelProvider(modelName)
+			if configured == nil {
+				return "", fmt.Errorf("provider not configured for model %s", modelName)
+			}
+			provider = p.traceProvider(step.Name, configured)
+		}
+
+		parts := splitParagraphs(text, maxTokens)
+		translated := make([]string, len(parts))
+		previous := ""
+		for i, part := range parts {
+			if err := p.interrupted(); err != nil {
+				return "", err
+			}
+			if len(parts) > 1 {
+				emit(fmt.Sprintf("Translating part %d of %d for step: %s", i+1, len(parts), step.Name))
+			}
+			prompt := translationPrompt(part, language.Name(from), to, glossary, instructions, i+1, len(parts), previous)
+			reply, err := provider.SendPrompt(modelName, prompt)
+			if err != nil {
+				return "", fmt.Errorf("error translating %s in step %s: %w", src.name, step.Name, err)
+			}
+			translated[i] = cleanTranslation(reply)
+			previous = translated[i]
+			if len(previous) > translateContextChars {
+				previous = previous[len(previous)-translateContextChars:]
+				if cut := strings.IndexAny(previous, " \n"); cut >= 0 {
+					previous = "…" + previous[cut:]
+				}
+			}
+		}
+		translations = append(translations, strings.Join(translated, "\n\n"))
+	}
+	if len(translations) == 0 {
+		return "", fmt.Errorf("translate step '%s' has no text to translate", step.Name)
+	}
+
+	response := strings.Join(translations, "\n\n")
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if err := p.handleOutput(modelName, response, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+	return response, nil
+}
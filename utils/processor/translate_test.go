@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func translateTestConfig(input, output string, settings *TranslateStep) *DSLConfig {
+	return &DSLConfig{Steps: []Step{
+		{Name: "translate", Config: StepConfig{
+			Type: StepTypeTranslate, Input: input, Model: "gpt-4o", Output: output, Translate: settings,
+		}},
+	}}
+}
+
+func TestTranslateStep(t *testing.T) {
+	dir := t.TempDir()
+	note := filepath.Join(dir, "note.md")
+	os.WriteFile(note, []byte("Le rapport trimestriel est prêt et nous sommes contents des résultats du tableau de bord."), 0644)
+	glossary := filepath.Join(dir, "glossary.csv")
+	os.WriteFile(glossary, []byte("tableau de bord,dashboard\nrapport,memo\n"), 0644)
+
+	scripted := withScriptedProvider(t, "<<<TEXT\nThe quarterly report is ready and we are happy with the dashboard results.\nTEXT>>>")
+	out := filepath.Join(dir, "note.en.md")
+	cfg := translateTestConfig(note, out, &TranslateStep{To: "en", GlossaryFile: glossary, Glossary: map[string]string{"rapport": "report"}})
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if len(scripted.prompts) != 1 {
+		t.Fatalf("sent %d prompts, want 1", len(scripted.prompts))
+	}
+	prompt := scripted.prompts[0]
+	for _, want := range []string{"from French into English", "tableau de bord → dashboard", "rapport → report", "<<<TEXT\nLe rapport"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt doesn't contain %q:\n%s", want, prompt)
+		}
+	}
+	got, _ := os.ReadFile(out)
+	if want := "The quarterly report is ready and we are happy with the dashboard results."; string(got) != want {
+		t.Errorf("translation = %q, want %q", got, want)
+	}
+}
+
+func TestTranslateStepLongText(t *testing.T) {
+	dir := t.TempDir()
+	doc := filepath.Join(dir, "doc.md")
+	first := strings.Repeat("The report is ready and the results are good. ", 8)
+	second := strings.Repeat("We are happy with the year and the team. ", 8)
+	os.WriteFile(doc, []byte(first+"\n\n"+second), 0644)
+
+	scripted := withScriptedProvider(t, "Le rapport est prêt.", "Nous sommes contents.")
+	cfg := translateTestConfig(doc, "STDOUT", &TranslateStep{To: "French", ChunkTokens: 100})
+	proc := NewProcessor(cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if len(scripted.prompts) != 2 {
+		t.Fatalf("sent %d prompts, want 2", len(scripted.prompts))
+	}
+	if p := scripted.prompts[0]; !strings.Contains(p, "from English into French") || !strings.Contains(p, "part 1 of 2") {
+		t.Errorf("first prompt = %q, want part 1 of 2 from English", p)
+	}
+	if p := scripted.prompts[1]; !strings.Contains(p, "part 2 of 2") || !strings.Contains(p, "Le rapport est prêt.") {
+		t.Errorf("second prompt = %q, want part 2 with the translation so far", p)
+	}
+	if got, want := proc.LastOutput(), "Le rapport est prêt.\n\nNous sommes contents."; got != want {
+		t.Errorf("LastOutput() = %q, want %q", got, want)
+	}
+}
+
+func TestTranslateStepSameLanguage(t *testing.T) {
+	dir := t.TempDir()
+	note := filepath.Join(dir, "note.md")
+	os.WriteFile(note, []byte("The quarterly report is ready, and we are happy with the results for this year."), 0644)
+
+	scripted := withScriptedProvider(t)
+	proc := NewProcessor(translateTestConfig(note, "STDOUT", &TranslateStep{To: "en"}), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if len(scripted.prompts) != 0 {
+		t.Errorf("sent %d prompts for text already in English", len(scripted.prompts))
+	}
+	if !strings.HasPrefix(proc.LastOutput(), "The quarterly report") {
+		t.Errorf("LastOutput() = %q, want the text as it was", proc.LastOutput())
+	}
+}
+
+func TestTranslateStepValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.stepConfigErrors("translate", StepConfig{
+		Type: StepTypeTranslate, Input: "NA", Model: []interface{}{"gpt-4o", "gpt-4o-mini"},
+		Translate: &TranslateStep{To: " "},
+	})
+	want := []string{"need text as input", "need one model", "'translate.to' is required", "output is required"}
+	if len(errs) != len(want) {
+		t.Fatalf("stepConfigErrors() = %v, want %d errors", errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i], w) {
+			t.Errorf("error %d = %q, want it to mention %q", i, errs[i], w)
+		}
+	}
+}
+
+func TestSplitParagraphs(t *testing.T) {
+	code := "```go\nfunc main() {\n\n\tprintln(\"hi\")\n}\n```"
+	text := strings.Repeat("a ", 30) + "\n\n" + code + "\n\n" + strings.Repeat("b ", 30)
+	parts := splitParagraphs(text, 20)
+	if len(parts) != 3 {
+		t.Fatalf("splitParagraphs() = %q, want 3 parts", parts)
+	}
+	if parts[1] != code {
+		t.Errorf("part 2 = %q, want the code block whole", parts[1])
+	}
+	if got := splitParagraphs("short", 20); len(got) != 1 || got[0] != "short" {
+		t.Errorf("splitParagraphs(short) = %q", got)
+	}
+	for _, part := range splitParagraphs(strings.Repeat("word ", 100), 10) {
+		if len(part) > 40 {
+			t.Errorf("part %q is longer than 40 characters", part)
+		}
+	}
+}
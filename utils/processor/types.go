@@ -6,6 +6,9 @@ type ChunkConfig struct {
 	Size      int    `yaml:"size"`       // Chunk size (e.g., 10000 lines)
 	Overlap   int    `yaml:"overlap"`    // Lines/bytes to overlap between chunks for context
 	MaxChunks int    `yaml:"max_chunks"` // Limit total chunks to prevent overload
+
+	Parallel    int `yaml:"parallel,omitempty"`     // Chunks sent to the model at once; DefaultChunkWorkers when 0
+	MaxAttempts int `yaml:"max_attempts,omitempty"` // Times a chunk is sent before it is given up on; DefaultChunkAttempts when 0
 }
 
 // StepConfig represents the configuration for a single step
@@ -19,6 +22,11 @@ type StepConfig struct {
 	BatchMode  string       `yaml:"batch_mode"`      // How to process multiple files: "combined" (default) or "individual"
 	SkipErrors bool         `yaml:"skip_errors"`     // Whether to continue processing if some files fail
 	Chunk      *ChunkConfig `yaml:"chunk,omitempty"` // Configuration for chunking large files
+	// Postprocess lists operations applied to the response before output, e.g. [strip_fences, trim]
+	Postprocess interface{} `yaml:"postprocess,omitempty"` // Can be string or []string
+	Provider    string      `yaml:"provider,omitempty"`    // Pin the step's models to a provider, e.g. "openai"
+	// MaxInputSize caps the total size of the step's file inputs, e.g. "500MB"
+	MaxInputSize string `yaml:"max_input_size,omitempty"`
 
 	// OpenAI Responses API specific fields
 	Instructions       string                   `yaml:"instructions"`         // System message
@@ -33,6 +41,101 @@ type StepConfig struct {
 	// Meta-processing fields
 	Generate *GenerateStepConfig `yaml:"generate,omitempty"` // Configuration for generating a workflow
 	Process  *ProcessStepConfig  `yaml:"process,omitempty"`  // Configuration for processing a sub-workflow
+
+	// Ensemble fans the action out to every listed model and merges the answers
+	Ensemble *EnsembleConfig `yaml:"ensemble,omitempty"`
+
+	// Rows applies the action to each row of a CSV input
+	Rows *RowsConfig `yaml:"rows,omitempty"`
+
+	// Variants are versions of the action, and optionally the model, that
+	// runs are split between so their quality and cost can be compared
+	Variants []PromptVariant `yaml:"variants,omitempty"`
+
+	// Join feeds the outputs of a parallel group into this step's actions
+	Join *JoinConfig `yaml:"join,omitempty"`
+
+	// Schema declares the expected columns for a validate-data step
+	Schema *DataSchema `yaml:"schema,omitempty"`
+
+	// Agent configures the tools and guards of a `type: agent` step
+	Agent *AgentConfig `yaml:"agent,omitempty"`
+
+	// VectorStore names the store and collection of an index or retrieve step
+	VectorStore *VectorStoreStep `yaml:"vector_store,omitempty"`
+
+	// Transcribe tunes a `type: transcribe` step
+	Transcribe *TranscribeStep `yaml:"transcribe,omitempty"`
+
+	// Render sets the format and look of a `type: render` step's documents
+	Render *RenderStep `yaml:"render,omitempty"`
+
+	// Translate sets the languages and terms of a `type: translate` step
+	Translate *TranslateStep `yaml:"translate,omitempty"`
+
+	// Dedupe sets the items and threshold of a `type: dedupe` step
+	Dedupe *DedupeStep `yaml:"dedupe,omitempty"`
+
+	// Summarize sets the strategy, length and style of a `type: summarize` step
+	Summarize *SummarizeStep `yaml:"summarize,omitempty"`
+
+	// Approval sets the question and deadline of a `type: approval` step
+	Approval *ApprovalStep `yaml:"approval,omitempty"`
+}
+
+// VectorStoreStep is the vector store an index or retrieve step uses
+type VectorStoreStep struct {
+	Name       string `yaml:"name"`                 // Entry of vector_stores in the env config
+	Collection string `yaml:"collection,omitempty"` // The store's default collection when empty
+	TopK       int    `yaml:"top_k,omitempty"`      // Matches a retrieve step returns; DefaultTopK when 0
+}
+
+// TranscribeStep tunes how a transcribe step turns recordings into text
+type TranscribeStep struct {
+	Language   string `yaml:"language,omitempty"`   // ISO-639-1 code of the spoken language; detected when empty
+	Prompt     string `yaml:"prompt,omitempty"`     // Names and terms the recordings use, spelled as they should be
+	Timestamps bool   `yaml:"timestamps,omitempty"` // Start each segment with its time (whisper-1 only)
+}
+
+// RenderStep sets how a render step turns markdown into documents
+type RenderStep struct {
+	Format   string `yaml:"format,omitempty"`    // html, pdf or docx; taken from each output's extension when empty
+	Title    string `yaml:"title,omitempty"`     // Document title; the first heading when empty
+	Template string `yaml:"template,omitempty"`  // HTML page template, or a .docx whose styles DOCX documents use
+	CSS      string `yaml:"css,omitempty"`       // Stylesheet replacing the default one of HTML documents
+	PageSize string `yaml:"page_size,omitempty"` // PDF page size: a4 or letter; defaults to a4
+}
+
+// TranslateStep sets what a translate step translates into, and how
+type TranslateStep struct {
+	To           string            `yaml:"to"`                      // Target language, a name or ISO-639-1 code
+	From         string            `yaml:"from,omitempty"`          // Source language; detected when empty
+	Glossary     map[string]string `yaml:"glossary,omitempty"`      // Terms and the translations to use for them
+	GlossaryFile string            `yaml:"glossary_file,omitempty"` // CSV file of term,translation rows
+	ChunkTokens  int               `yaml:"chunk_tokens,omitempty"`  // Most text sent in one prompt; defaults to 2000
+}
+
+// SummarizeStep sets how a summarize step summarizes and what it writes
+type SummarizeStep struct {
+	Strategy    string `yaml:"strategy,omitempty"`     // stuff, map-reduce or refine; stuff when the text fits in one prompt, else map-reduce
+	Length      string `yaml:"length,omitempty"`       // short, medium, long, a number of words, or any length such as "3 paragraphs"
+	Style       string `yaml:"style,omitempty"`        // bullets, prose, executive, tldr, or any description
+	ChunkTokens int    `yaml:"chunk_tokens,omitempty"` // Most text sent in one prompt; defaults to 3000
+	Parallel    int    `yaml:"parallel,omitempty"`     // Parts summarized at once by map-reduce; DefaultChunkWorkers when 0
+}
+
+// ApprovalStep sets what an approval step asks and how long it waits
+type ApprovalStep struct {
+	Message string `yaml:"message,omitempty"` // Question put to the approver; names the step when empty
+	Timeout string `yaml:"timeout,omitempty"` // How long to wait, such as 4h, before the run fails; no limit when empty
+}
+
+// DedupeStep sets what a dedupe step compares and how alike duplicates are
+type DedupeStep struct {
+	By        string   `yaml:"by,omitempty"`        // documents (default), lines, paragraphs, rows or chunks
+	Columns   []string `yaml:"columns,omitempty"`   // Columns rows are compared on; all when empty
+	Threshold float64  `yaml:"threshold,omitempty"` // Cosine similarity of duplicates; DefaultDedupeThreshold when 0
+	Keep      string   `yaml:"keep,omitempty"`      // Item kept of each group: first (default) or longest
 }
 
 // Step represents a named step in the DSL
@@ -46,6 +149,34 @@ type DSLConfig struct {
 	Steps         []Step
 	ParallelSteps map[string][]Step     // Steps that can be executed in parallel
 	Defer         map[string]StepConfig `yaml:"defer,omitempty"`
+	Env           map[string]string     `yaml:"env,omitempty"`      // Workflow-level environment variables
+	EnvFile       string                `yaml:"env_file,omitempty"` // Path to a dotenv file loaded before the run
+	Params        map[string]Param      `yaml:"params,omitempty"`   // Parameters supplied on the command line, bound by BindParams
+	Webhooks      []Webhook             `yaml:"webhooks,omitempty"` // Notified when runs started through the server finish
+	Concurrency   Concurrency           `yaml:"concurrency,omitempty"`
+	RunsOn        []string              `yaml:"runs_on,omitempty"`      // Labels a worker needs for the server to hand it the workflow's runs
+	Credentials   string                `yaml:"credentials,omitempty"`  // Credential set of the env config the workflow's providers use instead of the shared keys
+	MaxDuration   string                `yaml:"max_duration,omitempty"` // Longest the run may take, such as 30m; unlimited when empty
+}
+
+// Run limit policies decide what the server does with a run of a workflow
+// that already has max_concurrent_runs runs in progress
+const (
+	OnLimitQueue  = "queue"  // Wait for one of them to finish
+	OnLimitReject = "reject" // Refuse the run
+)
+
+// Concurrency limits how many runs of a workflow the server executes at once
+type Concurrency struct {
+	MaxRuns   int    `yaml:"max_concurrent_runs,omitempty"` // Unlimited when 0
+	OnLimit   string `yaml:"on_limit,omitempty"`            // queue (the default) or reject
+	MaxQueued int    `yaml:"max_queued_runs,omitempty"`     // Runs waiting for a slot before new ones are refused; bounded only by the server's queue when 0
+}
+
+// Webhook is a URL notified about a workflow's runs
+type Webhook struct {
+	URL    string   `yaml:"url" json:"url"`
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"` // completed, failed and/or approval_needed; all when empty
 }
 
 // StepDependency represents a dependency between steps
@@ -66,4 +197,8 @@ type PerformanceMetrics struct {
 	ActionProcessingTime int64 // Time in milliseconds for action processing
 	OutputProcessingTime int64 // Time in milliseconds for output processing
 	TotalProcessingTime  int64 // Total time in milliseconds for the step
+	PromptTokens         int   // Estimated tokens sent to the model
+	CompletionTokens     int   // Estimated tokens in the model's response
+	Retries              int   // Provider calls retried while the step ran, including those of steps running alongside it
+	CacheHits            int   // Inputs skipped in changed-only mode because they are unchanged since the last run, and prompts answered from the response cache
 }
@@ -0,0 +1,342 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/connectors"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationIssue is a single problem found when validating a workflow
+type ValidationIssue struct {
+	Step    string `json:"step,omitempty"` // Empty for workflow-level problems
+	Message string `json:"message"`
+}
+
+// String formats the issue for console output
+func (i ValidationIssue) String() string {
+	if i.Step == "" {
+		return i.Message
+	}
+	return fmt.Sprintf("step '%s': %s", i.Step, i.Message)
+}
+
+// stepFieldNames holds the YAML keys a step may use, taken from StepConfig's tags
+var stepFieldNames = func() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(StepConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]; name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// CheckStepFields reports step keys in a workflow file that comanda does not
+// recognize, which the YAML decoder otherwise ignores silently
+func CheckStepFields(data []byte) ([]ValidationIssue, error) {
+	var issues []ValidationIssue
+	err := walkStepNodes(data, func(name string, key, value *yaml.Node) {
+		if value.Kind != yaml.MappingNode {
+			issues = append(issues, ValidationIssue{Step: name, Message: "step must be a mapping of fields"})
+			return
+		}
+		for i := 0; i < len(value.Content); i += 2 {
+			if field := value.Content[i].Value; !stepFieldNames[field] {
+				issues = append(issues, ValidationIssue{Step: name, Message: fmt.Sprintf("unknown field '%s' (line %d)", field, value.Content[i].Line)})
+			}
+		}
+	})
+	return issues, err
+}
+
+// walkStepNodes calls fn with the key and value node of every sequential,
+// parallel and deferred step in a workflow file, in document order
+func walkStepNodes(data []byte, fn func(name string, key, value *yaml.Node)) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	group := func(node *yaml.Node) {
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i < len(node.Content); i += 2 {
+			fn(node.Content[i].Value, node.Content[i], node.Content[i+1])
+		}
+	}
+
+	root := doc.Content[0]
+	var cfg DSLConfig
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "env", "env_file", "params", "webhooks", "concurrency", "runs_on", "credentials", "max_duration":
+		case "defer":
+			group(value)
+		case "parallel":
+			if value.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 1; j < len(value.Content); j += 2 {
+				group(value.Content[j])
+			}
+		default:
+			if cfg.isParallelStepGroup(value) {
+				group(value)
+			} else {
+				fn(key.Value, key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks the workflow without running it and returns every problem
+// found: step configuration, provider pins, models and their API keys, input
+// files that don't exist, and dependencies between steps
+func (p *Processor) Validate() []ValidationIssue {
+	return p.validate(true)
+}
+
+// ValidateStructure checks only what the workflow itself gets wrong: step
+// configuration, provider pins, models and dependencies. API keys and input
+// files are left out since they depend on the machine the workflow runs on.
+func (p *Processor) ValidateStructure() []ValidationIssue {
+	return p.validate(false)
+}
+
+func (p *Processor) validate(checkEnv bool) []ValidationIssue {
+	if len(p.config.Steps) == 0 && len(p.config.ParallelSteps) == 0 {
+		return []ValidationIssue{{Message: "no steps defined in DSL configuration"}}
+	}
+
+	var issues []ValidationIssue
+	add := func(step string, messages ...string) {
+		for _, msg := range messages {
+			issues = append(issues, ValidationIssue{Step: step, Message: msg})
+		}
+	}
+
+	// The keys of the run's credential set count as present without being
+	// fetched
+	if name := p.credentialSet(); name != "" && p.envConfig != nil {
+		cfg, err := p.envConfig.WithCredentials(name, func(ref string) (string, error) { return ref, nil })
+		if err == nil {
+			shared := p.envConfig
+			p.envConfig = cfg
+			defer func() { p.envConfig = shared }()
+		} else if checkEnv {
+			add("", err.Error())
+		}
+	}
+
+	p.applyDefaultModels()
+	if checkEnv {
+		if err := p.envConfig.PolicySettings().Validate(); err != nil {
+			add("", fmt.Sprintf("policy: %v", err))
+		}
+	}
+	for _, step := range p.workflowSteps() {
+		add(step.Name, p.stepConfigErrors(step.Name, step.Config)...)
+		if err := p.pinProviders(step); err != nil {
+			add(step.Name, err.Error())
+		}
+		for _, modelName := range p.stepModels(step.Config) {
+			if err := p.validateModel([]string{modelName}, nil); err != nil {
+				add(step.Name, err.Error())
+			} else if checkEnv {
+				if err := p.checkAPIKey(modelName); err != nil {
+					add(step.Name, err.Error())
+				}
+			}
+		}
+		if checkEnv {
+			add(step.Name, p.missingInputs(step.Config)...)
+			for _, msg := range p.policyErrors(step) {
+				add(step.Name, "policy: "+msg)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(p.config.Params))
+	for name := range p.config.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := p.config.Params[name].validateDeclaration(); err != nil {
+			add("", fmt.Sprintf("param '%s': %v", name, err))
+		}
+	}
+
+	if err := p.config.Concurrency.validate(); err != nil {
+		add("", fmt.Sprintf("concurrency: %v", err))
+	}
+	if err := p.validateDependencies(); err != nil {
+		add("", err.Error())
+	}
+	return issues
+}
+
+// workflowSteps lists parallel, sequential and deferred steps in a stable order
+func (p *Processor) workflowSteps() []Step {
+	var steps []Step
+	groupNames := make([]string, 0, len(p.config.ParallelSteps))
+	for name := range p.config.ParallelSteps {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, name := range groupNames {
+		group := append([]Step(nil), p.config.ParallelSteps[name]...)
+		sort.Slice(group, func(i, j int) bool { return group[i].Name < group[j].Name })
+		steps = append(steps, group...)
+	}
+	steps = append(steps, p.config.Steps...)
+
+	deferNames := make([]string, 0, len(p.config.Defer))
+	for name := range p.config.Defer {
+		deferNames = append(deferNames, name)
+	}
+	sort.Strings(deferNames)
+	for _, name := range deferNames {
+		steps = append(steps, Step{Name: name, Config: p.config.Defer[name]})
+	}
+	return steps
+}
+
+// stepModels lists the models a step will call
+func (p *Processor) stepModels(cfg StepConfig) []string {
+	var names []string
+	switch {
+	case cfg.Generate != nil:
+		names = p.NormalizeStringSlice(cfg.Generate.Model)
+	case cfg.Process != nil, cfg.Type == "validate-data", isVectorStep(cfg), isTranscribeStep(cfg), isRenderStep(cfg), isDedupeStep(cfg), isApprovalStep(cfg):
+	default:
+		names = p.NormalizeStringSlice(cfg.Model)
+		if cfg.Ensemble != nil && cfg.Ensemble.JudgeModel != "" {
+			names = append(names, cfg.Ensemble.JudgeModel)
+		}
+		for _, v := range cfg.Variants {
+			if v.Model != "" && !slices.Contains(names, v.Model) {
+				names = append(names, v.Model)
+			}
+		}
+	}
+
+	var result []string
+	for _, name := range names {
+		if name != "" && name != "NA" {
+			result = append(result, p.envConfig.ResolveModel(name))
+		}
+	}
+	return result
+}
+
+// checkAPIKey reports a missing API key for the provider serving a model
+func (p *Processor) checkAPIKey(modelName string) error {
+	provider := p.detectProvider(modelName)
+	if provider == nil || provider.Name() == "ollama" {
+		return nil
+	}
+	providerConfig, err := p.envConfig.GetProviderConfig(provider.Name())
+	if err != nil || providerConfig.APIKey == "" {
+		return fmt.Errorf("missing API key for provider %s (model %s)", provider.Name(), modelName)
+	}
+	return nil
+}
+
+// missingInputs reports file inputs and glob patterns that match nothing.
+// Files produced by another step are skipped since they appear at run time.
+func (p *Processor) missingInputs(cfg StepConfig) []string {
+	var errors []string
+	if input, ok := cfg.Input.(map[string]interface{}); ok {
+		if kind, _ := connectorInput(input); kind != "" {
+			if err := connectors.CheckConfigured(p.envConfig.ConnectorSettings(), kind); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+		if spec, ok := input["email"].(map[string]interface{}); ok {
+			in, err := parseEmailInput(spec)
+			if err == nil {
+				_, err = p.envConfig.Mailbox(in.mailbox)
+			}
+			if err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+	// Brokers of kafka and nats inputs and outputs
+	for _, v := range []interface{}{cfg.Input, cfg.Output} {
+		m, _ := v.(map[string]interface{})
+		if kind, spec := brokerMap(m); kind != "" {
+			s, err := parseBrokerStep(kind, spec)
+			if err == nil {
+				_, err = p.brokerConfig(s)
+			}
+			if err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+	errors = append(errors, p.trackerErrors(cfg)...)
+	errors = append(errors, p.spreadsheetErrors(cfg)...)
+	errors = append(errors, p.calendarErrors(cfg)...)
+	errors = append(errors, p.webhookErrors(cfg)...)
+	errors = append(errors, p.feedErrors(cfg)...)
+	paths := p.NormalizeStringSlice(cfg.Input)
+	if cfg.Process != nil && cfg.Process.WorkflowFile != "" {
+		paths = append(paths, cfg.Process.WorkflowFile)
+	}
+
+	for _, path := range paths {
+		path, _ = p.parseVariableAssignment(path)
+		if path == "" || paramPlaceholderPattern.MatchString(path) || p.isSpecialInput(path) || strings.HasPrefix(path, "STDIN") || p.isURL(path) || p.isOutputInOtherSteps(path) {
+			continue
+		}
+		resolved := path
+		if p.runtimeDir != "" && !filepath.IsAbs(path) {
+			resolved = filepath.Join(p.runtimeDir, path)
+		}
+		if strings.ContainsAny(path, "*?[") {
+			matches, err := filepath.Glob(resolved)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("invalid input pattern '%s': %v", path, err))
+			} else if len(matches) == 0 {
+				errors = append(errors, fmt.Sprintf("input pattern '%s' matches no files", path))
+			}
+			continue
+		}
+		if _, err := os.Stat(resolved); err != nil {
+			errors = append(errors, fmt.Sprintf("input file '%s' does not exist", path))
+		}
+	}
+	return errors
+}
+
+// validate checks the run limit and its policy
+func (c Concurrency) validate() error {
+	if c.MaxRuns < 0 || c.MaxQueued < 0 {
+		return fmt.Errorf("max_concurrent_runs and max_queued_runs can't be negative")
+	}
+	switch c.OnLimit {
+	case "", OnLimitQueue, OnLimitReject:
+	default:
+		return fmt.Errorf("unknown on_limit '%s' (use %s or %s)", c.OnLimit, OnLimitQueue, OnLimitReject)
+	}
+	if c.MaxRuns == 0 && (c.OnLimit != "" || c.MaxQueued != 0) {
+		return fmt.Errorf("on_limit and max_queued_runs need max_concurrent_runs")
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultMaxDataErrors caps the row-level errors reported by a validate-data step
+const defaultMaxDataErrors = 50
+
+// DataSchema declares the expected shape of tabular input for a validate-data step
+type DataSchema struct {
+	Format    string                `yaml:"format"`     // "csv", "json" or "jsonl"; detected from the file extension when empty
+	Columns   map[string]ColumnSpec `yaml:"columns"`    // Column name -> expected type and presence
+	MaxErrors int                   `yaml:"max_errors"` // Maximum row errors to report (default 50)
+}
+
+// ColumnSpec describes a single column. It can be written as a bare type
+// ("integer") or as a mapping with type and required.
+type ColumnSpec struct {
+	Type     string `yaml:"type"`     // string, integer, number, boolean or date
+	Required bool   `yaml:"required"` // Whether every row must have a non-empty value
+}
+
+// UnmarshalYAML allows the shorthand `column: type`
+func (c *ColumnSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Type = node.Value
+		return nil
+	}
+	type plain ColumnSpec
+	return node.Decode((*plain)(c))
+}
+
+// validateDataSchema checks a validate-data step's schema declaration
+func validateDataSchema(schema *DataSchema) []string {
+	if schema == nil {
+		return []string{"'schema' is required for validate-data steps"}
+	}
+	var errors []string
+	switch schema.Format {
+	case "", "csv", "json", "jsonl":
+	default:
+		errors = append(errors, fmt.Sprintf("unknown schema format '%s' (expected csv, json or jsonl)", schema.Format))
+	}
+	if len(schema.Columns) == 0 {
+		errors = append(errors, "schema must declare at least one column")
+	}
+	for _, name := range sortedColumnNames(schema.Columns) {
+		switch schema.Columns[name].Type {
+		case "", "string", "integer", "number", "boolean", "date":
+		default:
+			errors = append(errors, fmt.Sprintf("column '%s' has unknown type '%s'", name, schema.Columns[name].Type))
+		}
+	}
+	return errors
+}
+
+// processValidateDataStep checks each input against the step's schema and
+// fails the step with a row-level report if any row does not conform
+func (p *Processor) processValidateDataStep(step Step, isParallel bool, parallelID string) (string, error) {
+	startTime := time.Now()
+	stepInfo := &StepInfo{Name: step.Name, Model: "NA", Action: "Validate data"}
+	stepMsg := fmt.Sprintf("Validating data for step: %s", step.Name)
+	if isParallel {
+		p.emitParallelProgress(stepMsg, stepInfo, parallelID)
+	} else {
+		p.emitProgress(stepMsg, stepInfo)
+	}
+
+	schema := step.Config.Schema
+	maxErrors := schema.MaxErrors
+	if maxErrors <= 0 {
+		maxErrors = defaultMaxDataErrors
+	}
+
+	type dataSource struct {
+		name     string
+		contents []byte
+	}
+	var sources []dataSource
+	inputs := p.NormalizeStringSlice(step.Config.Input)
+	if len(inputs) == 1 && strings.HasPrefix(inputs[0], "STDIN") {
+		stdin, err := p.stdinContents(step.Config)
+		if err != nil {
+			return "", fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+		}
+		sources = append(sources, dataSource{name: "STDIN", contents: []byte(stdin)})
+	} else {
+		p.handler = newStepHandler(step.Config)
+		if err := p.processInputs(inputs); err != nil {
+			return "", fmt.Errorf("input processing error in step %s: %w", step.Name, inputSizeHint(err))
+		}
+		for _, in := range p.handler.GetInputs() {
+			sources = append(sources, dataSource{name: in.Path, contents: in.Contents})
+		}
+	}
+	if len(sources) == 0 {
+		return "", fmt.Errorf("validate-data step '%s' has no inputs to check", step.Name)
+	}
+
+	var report []string
+	var rowErrors []string
+	for _, src := range sources {
+		format := schema.Format
+		if format == "" {
+			format = detectDataFormat(src.name, src.contents)
+		}
+		rows, errs, err := validateDataRows(src.contents, format, schema.Columns)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s as %s: %w", src.name, format, err)
+		}
+		for _, e := range errs {
+			rowErrors = append(rowErrors, fmt.Sprintf("%s: %s", src.name, e))
+		}
+		report = append(report, fmt.Sprintf("%s: %d row(s), %d error(s)", src.name, rows, len(errs)))
+	}
+
+	if len(rowErrors) > 0 {
+		shown := rowErrors
+		if len(shown) > maxErrors {
+			shown = shown[:maxErrors]
+		}
+		msg := fmt.Sprintf("data validation failed with %d error(s):\n- %s", len(rowErrors), strings.Join(shown, "\n- "))
+		if len(rowErrors) > maxErrors {
+			msg += fmt.Sprintf("\n- ... %d more", len(rowErrors)-maxErrors)
+		}
+		return "", fmt.Errorf("%s", msg)
+	}
+
+	summary := "Data validation passed:\n" + strings.Join(report, "\n")
+	metrics := &PerformanceMetrics{TotalProcessingTime: time.Since(startTime).Milliseconds()}
+	if err := p.handleOutput("NA", summary, p.NormalizeStringSlice(step.Config.Output), metrics); err != nil {
+		return "", fmt.Errorf("output handling error: %w", err)
+	}
+	p.debugf("Step '%s' validated %d input(s)", step.Name, len(sources))
+	return summary, nil
+}
+
+// detectDataFormat picks a format from the file extension, then the content
+func detectDataFormat(name string, contents []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	trimmed := bytes.TrimSpace(contents)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return "json"
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return "jsonl"
+	}
+	return "csv"
+}
+
+// validateDataRows parses the data and returns the number of rows and the
+// row-level errors found. Rows are numbered from 1; for CSV the header is row 0.
+func validateDataRows(contents []byte, format string, columns map[string]ColumnSpec) (int, []string, error) {
+	records, err := parseDataRecords(contents, format)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var errs []string
+	names := sortedColumnNames(columns)
+	for i, record := range records {
+		for _, name := range names {
+			spec := columns[name]
+			value, present := record[name]
+			if !present || value == nil || value == "" {
+				if spec.Required {
+					errs = append(errs, fmt.Sprintf("row %d: missing required column '%s'", i+1, name))
+				}
+				continue
+			}
+			if err := checkDataValue(value, spec.Type); err != nil {
+				errs = append(errs, fmt.Sprintf("row %d: column '%s': %v", i+1, name, err))
+			}
+		}
+	}
+	return len(records), errs, nil
+}
+
+// parseDataRecords converts CSV, a JSON array or JSON lines into records.
+// CSV values are strings; JSON values keep their decoded types.
+func parseDataRecords(contents []byte, format string) ([]map[string]interface{}, error) {
+	var records []map[string]interface{}
+	switch format {
+	case "csv":
+		reader := csv.NewReader(bytes.NewReader(contents))
+		header, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			record := make(map[string]interface{}, len(header))
+			for i, name := range header {
+				if i < len(row) {
+					record[strings.TrimSpace(name)] = row[i]
+				}
+			}
+			records = append(records, record)
+		}
+	case "json":
+		if err := json.Unmarshal(contents, &records); err != nil {
+			return nil, fmt.Errorf("expected a JSON array of objects: %w", err)
+		}
+	case "jsonl":
+		decoder := json.NewDecoder(bytes.NewReader(contents))
+		for {
+			var record map[string]interface{}
+			if err := decoder.Decode(&record); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("line %d: %w", len(records)+1, err)
+			}
+			records = append(records, record)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format '%s'", format)
+	}
+	return records, nil
+}
+
+// checkDataValue verifies a single value against a column type
+func checkDataValue(value interface{}, typ string) error {
+	switch v := value.(type) {
+	case string:
+		switch typ {
+		case "", "string":
+			return nil
+		case "integer":
+			if _, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err != nil {
+				return fmt.Errorf("expected integer, got %q", v)
+			}
+		case "number":
+			if _, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				return fmt.Errorf("expected number, got %q", v)
+			}
+		case "boolean":
+			if _, err := strconv.ParseBool(strings.TrimSpace(v)); err != nil {
+				return fmt.Errorf("expected boolean, got %q", v)
+			}
+		case "date":
+			if !isDate(strings.TrimSpace(v)) {
+				return fmt.Errorf("expected date (YYYY-MM-DD or RFC 3339), got %q", v)
+			}
+		}
+	case float64:
+		switch typ {
+		case "", "number":
+			return nil
+		case "integer":
+			if v != math.Trunc(v) {
+				return fmt.Errorf("expected integer, got %v", v)
+			}
+		default:
+			return fmt.Errorf("expected %s, got number %v", typ, v)
+		}
+	case bool:
+		if typ != "" && typ != "boolean" {
+			return fmt.Errorf("expected %s, got boolean %v", typ, v)
+		}
+	default:
+		if typ != "" {
+			return fmt.Errorf("expected %s, got %T", typ, value)
+		}
+	}
+	return nil
+}
+
+// isDate accepts YYYY-MM-DD dates and RFC 3339 timestamps
+func isDate(s string) bool {
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+// sortedColumnNames returns column names in a stable order for reporting
+func sortedColumnNames(columns map[string]ColumnSpec) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
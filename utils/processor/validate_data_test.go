@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateDataRows(t *testing.T) {
+	columns := map[string]ColumnSpec{
+		"id":      {Type: "integer", Required: true},
+		"email":   {Type: "string", Required: true},
+		"amount":  {Type: "number"},
+		"shipped": {Type: "date"},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		data     string
+		rows     int
+		contains []string
+	}{
+		{
+			name:   "valid csv",
+			format: "csv",
+			data:   "id,email,amount,shipped\n1,a@example.com,9.99,2024-01-02\n2,b@example.com,,\n",
+			rows:   2,
+		},
+		{
+			name:   "csv row errors",
+			format: "csv",
+			data:   "id,email,amount\nabc,a@example.com,1\n2,,ten\n",
+			rows:   2,
+			contains: []string{
+				"row 1: column 'id': expected integer",
+				"row 2: missing required column 'email'",
+				"row 2: column 'amount': expected number",
+			},
+		},
+		{
+			name:     "json array",
+			format:   "json",
+			data:     `[{"id": 1, "email": "a@example.com"}, {"id": 1.5, "email": "b@example.com", "shipped": "soon"}]`,
+			rows:     2,
+			contains: []string{"row 2: column 'id': expected integer", "row 2: column 'shipped': expected date"},
+		},
+		{
+			name:     "json lines",
+			format:   "jsonl",
+			data:     "{\"id\": 1, \"email\": \"a@example.com\"}\n{\"id\": 2}\n",
+			rows:     2,
+			contains: []string{"row 2: missing required column 'email'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, errs, err := validateDataRows([]byte(tt.data), tt.format, columns)
+			if err != nil {
+				t.Fatalf("validateDataRows() error = %v", err)
+			}
+			if rows != tt.rows {
+				t.Errorf("rows = %d, want %d", rows, tt.rows)
+			}
+			if len(errs) != len(tt.contains) {
+				t.Fatalf("got %d error(s) %v, want %d", len(errs), errs, len(tt.contains))
+			}
+			joined := strings.Join(errs, "\n")
+			for _, want := range tt.contains {
+				if !strings.Contains(joined, want) {
+					t.Errorf("errors %q missing %q", joined, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDataStep(t *testing.T) {
+	yamlContent := `
+check_orders:
+  type: validate-data
+  input: ORDERS
+  schema:
+    columns:
+      id: {type: integer, required: true}
+      email: string
+  output: STDOUT
+`
+	dir := t.TempDir()
+	orders := filepath.Join(dir, "orders.csv")
+	yamlContent = strings.Replace(yamlContent, "ORDERS", orders, 1)
+
+	var cfg DSLConfig
+	if err := yaml.Unmarshal([]byte(yamlContent), &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got := cfg.Steps[0].Config.Schema.Columns["email"].Type; got != "string" {
+		t.Errorf("shorthand column type = %q, want string", got)
+	}
+
+	if err := os.WriteFile(orders, []byte("id,email\n1,a@example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	proc := NewProcessor(&cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if !strings.Contains(proc.LastOutput(), "1 row(s), 0 error(s)") {
+		t.Errorf("unexpected summary %q", proc.LastOutput())
+	}
+
+	if err := os.WriteFile(orders, []byte("id,email\nx,a@example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	proc = NewProcessor(&cfg, createTestEnvConfig(), createTestServerConfig(), false)
+	if err := proc.Process(); err == nil || !strings.Contains(err.Error(), "row 1: column 'id'") {
+		t.Errorf("expected row-level validation error, got %v", err)
+	}
+}
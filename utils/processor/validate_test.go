@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckStepFields(t *testing.T) {
+	data := []byte(`
+env:
+  REGION: us
+summarize:
+  input: NA
+  modle: gpt-4o
+  action: summarize
+  output: STDOUT
+parallel:
+  fanout:
+    one:
+      input: NA
+      model: gpt-4o
+      action: a
+      output: STDOUT
+      temprature: 0.2
+`)
+	issues, err := CheckStepFields(data)
+	if err != nil {
+		t.Fatalf("CheckStepFields() error = %v", err)
+	}
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %v", issues)
+	}
+	if issues[0].Step != "summarize" || !strings.Contains(issues[0].Message, "unknown field 'modle'") {
+		t.Errorf("unexpected first issue: %v", issues[0])
+	}
+	if issues[1].Step != "one" || !strings.Contains(issues[1].Message, "unknown field 'temprature'") {
+		t.Errorf("unexpected second issue: %v", issues[1])
+	}
+}
+
+func TestValidateCollectsAllIssues(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(existing, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg DSLConfig
+	workflow := `
+first:
+  input: ` + existing + `
+  model: gpt-4o
+  action: summarize
+  output: summary.txt
+second:
+  input: summary.txt
+  model: claude-3-5-sonnet-latest
+  action: review
+  output: STDOUT
+third:
+  input: [` + filepath.Join(dir, "missing.txt") + `, "` + filepath.Join(dir, "*.csv") + `"]
+  model: not-a-model
+  action: check
+  output: STDOUT
+fourth:
+  input: NA
+  model: gpt-4o
+  output: STDOUT
+`
+	if err := yaml.Unmarshal([]byte(workflow), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	envConfig := createTestEnvConfig()
+	envConfig.Providers["anthropic"].APIKey = ""
+	proc := NewProcessor(&cfg, envConfig, createTestServerConfig(), false)
+	issues := proc.Validate()
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	joined := strings.Join(got, "\n")
+	for _, want := range []string{
+		"step 'second': missing API key for provider anthropic",
+		"not-a-model",
+		"step 'third': input file '" + filepath.Join(dir, "missing.txt") + "' does not exist",
+		"step 'third': input pattern '" + filepath.Join(dir, "*.csv") + "' matches no files",
+		"step 'fourth': action is required for standard steps",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing issue %q in:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "step 'first'") {
+		t.Errorf("unexpected issue for valid step:\n%s", joined)
+	}
+
+	// The structural check keeps workflow mistakes and drops setup problems
+	got = nil
+	for _, issue := range proc.ValidateStructure() {
+		got = append(got, issue.String())
+	}
+	joined = strings.Join(got, "\n")
+	if !strings.Contains(joined, "not-a-model") || !strings.Contains(joined, "action is required") {
+		t.Errorf("ValidateStructure() missed workflow issues:\n%s", joined)
+	}
+	if strings.Contains(joined, "API key") || strings.Contains(joined, "does not exist") {
+		t.Errorf("ValidateStructure() reported environment issues:\n%s", joined)
+	}
+}
+
+func TestValidateConcurrency(t *testing.T) {
+	tests := []struct {
+		section string
+		want    string // Expected issue, none when empty
+	}{
+		{"max_concurrent_runs: 2\n  on_limit: reject", ""},
+		{"max_concurrent_runs: 1\n  max_queued_runs: 10", ""},
+		{"max_concurrent_runs: -1", "max_concurrent_runs and max_queued_runs can't be negative"},
+		{"max_concurrent_runs: 2\n  on_limit: drop", "unknown on_limit 'drop'"},
+		{"on_limit: queue", "on_limit and max_queued_runs need max_concurrent_runs"},
+	}
+	for _, tt := range tests {
+		workflow := "concurrency:\n  " + tt.section + "\nsummarize:\n  input: NA\n  model: gpt-4o\n  action: summarize\n  output: STDOUT\n"
+		var cfg DSLConfig
+		if err := yaml.Unmarshal([]byte(workflow), &cfg); err != nil {
+			t.Fatalf("%q: %v", tt.section, err)
+		}
+		if len(cfg.Steps) != 1 {
+			t.Errorf("%q: expected concurrency not to be parsed as a step, got %d steps", tt.section, len(cfg.Steps))
+		}
+		var got []string
+		for _, issue := range NewProcessor(&cfg, createTestEnvConfig(), createTestServerConfig(), false).ValidateStructure() {
+			got = append(got, issue.String())
+		}
+		joined := strings.Join(got, "\n")
+		if tt.want == "" && joined != "" {
+			t.Errorf("%q: unexpected issues:\n%s", tt.section, joined)
+		}
+		if tt.want != "" && !strings.Contains(joined, "concurrency: "+tt.want) {
+			t.Errorf("%q: missing issue %q in:\n%s", tt.section, tt.want, joined)
+		}
+	}
+}
+
+func TestParseRunsOn(t *testing.T) {
+	for section, want := range map[string][]string{"runs_on: gpu": {"gpu"}, "runs_on: [gpu, linux]": {"gpu", "linux"}} {
+		var cfg DSLConfig
+		if err := yaml.Unmarshal([]byte(section+"\nsummarize:\n  input: NA\n  model: gpt-4o\n  action: summarize\n  output: STDOUT\n"), &cfg); err != nil {
+			t.Fatalf("%q: %v", section, err)
+		}
+		if len(cfg.Steps) != 1 || strings.Join(cfg.RunsOn, ",") != strings.Join(want, ",") {
+			t.Errorf("%q: got runs_on %v and %d steps", section, cfg.RunsOn, len(cfg.Steps))
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+)
+
+// PromptVariant is one version of a step's prompt in an A/B experiment.
+// Each run of the workflow picks one of a step's variants, in proportion
+// to their weights, and records which it used.
+type PromptVariant struct {
+	Name   string      `yaml:"name"`
+	Action interface{} `yaml:"action"`           // Replaces the step's action; string or []string
+	Model  string      `yaml:"model,omitempty"`  // Replaces the step's model when set
+	Weight int         `yaml:"weight,omitempty"` // Share of runs relative to the other variants; 1 when 0
+}
+
+// weight returns the variant's share of runs
+func (v PromptVariant) weight() int {
+	if v.Weight == 0 {
+		return 1
+	}
+	return v.Weight
+}
+
+// variantErrors lists the problems with a step's prompt variants
+func (p *Processor) variantErrors(config StepConfig) []string {
+	var errors []string
+	seen := make(map[string]bool)
+	for i, v := range config.Variants {
+		if v.Name == "" {
+			errors = append(errors, fmt.Sprintf("variant %d needs a name", i+1))
+		} else if seen[v.Name] {
+			errors = append(errors, fmt.Sprintf("variant '%s' is declared more than once", v.Name))
+		}
+		seen[v.Name] = true
+		if len(p.NormalizeStringSlice(v.Action)) == 0 {
+			errors = append(errors, fmt.Sprintf("variant '%s' needs an action", v.Name))
+		}
+		if v.Weight < 0 {
+			errors = append(errors, fmt.Sprintf("variant '%s' has a negative weight", v.Name))
+		}
+		if v.Model != "" && config.Ensemble != nil {
+			errors = append(errors, fmt.Sprintf("variant '%s' can't set a model on an ensemble step", v.Name))
+		}
+	}
+	return errors
+}
+
+// SetVariantKey makes runs pick prompt variants by a hash of key and the
+// step name instead of at random, so the same key always gets the same
+// variants. comanda eval uses each dataset item's ID to split the dataset
+// between variants.
+func (p *Processor) SetVariantKey(key string) {
+	p.variantKey = key
+}
+
+// SetVariant makes the run use the named variant of a step
+func (p *Processor) SetVariant(step, variant string) {
+	if p.forcedVariants == nil {
+		p.forcedVariants = make(map[string]string)
+	}
+	p.forcedVariants[step] = variant
+}
+
+// pickVariant chooses one of a step's variants by weight, at random or by
+// the hash of key when it is set
+func pickVariant(variants []PromptVariant, step, key string) PromptVariant {
+	total := 0
+	for _, v := range variants {
+		total += v.weight()
+	}
+	var n int
+	if key != "" {
+		sum := sha256.Sum256([]byte(key + "\x00" + step))
+		n = int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	} else {
+		n = rand.IntN(total)
+	}
+	for _, v := range variants {
+		if n -= v.weight(); n < 0 {
+			return v
+		}
+	}
+	return variants[len(variants)-1]
+}
+
+// applyVariants gives every step with prompt variants the action and model
+// of the variant this run uses, and remembers the choice for the run's step
+// records
+func (p *Processor) applyVariants() error {
+	p.variants = make(map[string]string)
+	apply := func(name string, cfg *StepConfig) error {
+		if len(cfg.Variants) == 0 {
+			return nil
+		}
+		var chosen PromptVariant
+		if forced, ok := p.forcedVariants[name]; ok {
+			found := false
+			for _, v := range cfg.Variants {
+				if v.Name == forced {
+					chosen, found = v, true
+				}
+			}
+			if !found {
+				return fmt.Errorf("step '%s' has no variant '%s'", name, forced)
+			}
+		} else {
+			chosen = pickVariant(cfg.Variants, name, p.variantKey)
+		}
+		cfg.Action = chosen.Action
+		if chosen.Model != "" {
+			cfg.Model = chosen.Model
+		}
+		p.variants[name] = chosen.Name
+		p.debugf("Step '%s' uses prompt variant '%s'", name, chosen.Name)
+		return nil
+	}
+
+	for i := range p.config.Steps {
+		if err := apply(p.config.Steps[i].Name, &p.config.Steps[i].Config); err != nil {
+			return err
+		}
+	}
+	for _, steps := range p.config.ParallelSteps {
+		for i := range steps {
+			if err := apply(steps[i].Name, &steps[i].Config); err != nil {
+				return err
+			}
+		}
+	}
+	for name, cfg := range p.config.Defer {
+		if err := apply(name, &cfg); err != nil {
+			return err
+		}
+		p.config.Defer[name] = cfg
+	}
+
+	var unknown []string
+	for step := range p.forcedVariants {
+		if _, ok := p.variants[step]; !ok {
+			unknown = append(unknown, step)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("step '%s' has no prompt variants", unknown[0])
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func variantTestConfig() *DSLConfig {
+	return &DSLConfig{Steps: []Step{{Name: "reply", Config: StepConfig{
+		Input: "NA", Model: "gpt-4o", Output: "STDOUT",
+		Variants: []PromptVariant{
+			{Name: "concise", Action: "Reply in one sentence"},
+			{Name: "detailed", Action: "Reply step by step", Model: "gpt-4o-mini", Weight: 3},
+		},
+	}}}}
+}
+
+func runVariant(t *testing.T, setup func(*Processor)) (*scriptedProvider, StepRecord) {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	scripted := withScriptedProvider(t, "Hello.")
+	proc := NewProcessor(variantTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+	proc.SetProgressWriter(discardProgress{})
+	recorder := &sliceRecorder{}
+	proc.SetStepRecorder(recorder)
+	setup(proc)
+	if err := proc.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	return scripted, recorder.records[0]
+}
+
+func TestVariantForced(t *testing.T) {
+	scripted, record := runVariant(t, func(p *Processor) { p.SetVariant("reply", "detailed") })
+	if record.Variant != "detailed" || record.Model != "gpt-4o-mini" {
+		t.Errorf("record = variant %q model %q, want detailed on gpt-4o-mini", record.Variant, record.Model)
+	}
+	if !strings.Contains(scripted.prompts[0], "Reply step by step") {
+		t.Errorf("prompt = %q, want the detailed action", scripted.prompts[0])
+	}
+
+	_, record = runVariant(t, func(p *Processor) { p.SetVariant("reply", "concise") })
+	if record.Variant != "concise" || record.Model != "gpt-4o" {
+		t.Errorf("record = variant %q model %q, want concise on the step's model", record.Variant, record.Model)
+	}
+}
+
+func TestVariantUnknown(t *testing.T) {
+	for _, forced := range [][2]string{{"reply", "verbose"}, {"title", "short"}} {
+		proc := NewProcessor(variantTestConfig(), createTestEnvConfig(), createTestServerConfig(), false)
+		proc.SetProgressWriter(discardProgress{})
+		proc.SetVariant(forced[0], forced[1])
+		if err := proc.Process(); err == nil || !strings.Contains(err.Error(), "has no") {
+			t.Errorf("Process() with variant %s=%s error = %v", forced[0], forced[1], err)
+		}
+	}
+}
+
+func TestPickVariant(t *testing.T) {
+	variants := variantTestConfig().Steps[0].Config.Variants
+	counts := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		counts[pickVariant(variants, "reply", "").Name]++
+	}
+	if counts["detailed"] < 240 || counts["detailed"] > 360 {
+		t.Errorf("picked %v in 400 runs, want about three detailed to one concise", counts)
+	}
+
+	first := pickVariant(variants, "reply", "item-7").Name
+	for i := 0; i < 10; i++ {
+		if got := pickVariant(variants, "reply", "item-7").Name; got != first {
+			t.Fatalf("pickVariant() with a key gave %s, then %s", first, got)
+		}
+	}
+	keyed := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		keyed[pickVariant(variants, "reply", strconv.Itoa(i)).Name] = true
+	}
+	if len(keyed) != 2 {
+		t.Errorf("keys picked %v, want both variants", keyed)
+	}
+}
+
+func TestVariantValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	errs := proc.stepConfigErrors("reply", StepConfig{
+		Input: "NA", Model: []interface{}{"gpt-4o", "claude-sonnet-4-20250514"}, Output: "STDOUT",
+		Ensemble: &EnsembleConfig{Strategy: "judge", JudgeModel: "gpt-4o"},
+		Variants: []PromptVariant{
+			{Name: "a", Action: "Reply"},
+			{Name: "a", Model: "gpt-4o-mini", Weight: -1},
+			{Action: "Reply"},
+		},
+	})
+	want := []string{"declared more than once", "'a' needs an action", "negative weight", "can't set a model on an ensemble step", "variant 3 needs a name"}
+	for _, w := range want {
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err, w)
+		}
+		if !found {
+			t.Errorf("stepConfigErrors() = %v, want an error mentioning %q", errs, w)
+		}
+	}
+	for _, err := range errs {
+		if strings.Contains(err, "action is required") {
+			t.Errorf("stepConfigErrors() = %v, want no action needed on a step with variants", errs)
+		}
+	}
+
+	errs = proc.stepConfigErrors("translate", StepConfig{
+		Type: StepTypeTranslate, Input: "STDIN", Model: "gpt-4o", Output: "STDOUT",
+		Translate: &TranslateStep{To: "fr"}, Variants: []PromptVariant{{Name: "a", Action: "Translate"}},
+	})
+	if len(errs) != 1 || errs[0] != "variants are only supported on standard steps" {
+		t.Errorf("stepConfigErrors(translate) = %v", errs)
+	}
+}
@@ -0,0 +1,170 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/webhook/outbound"
+)
+
+// webhookBackoff is the wait before a webhook output's first retry; tests
+// shorten it
+var webhookBackoff = 2 * time.Second
+
+// webhookEvent is the X-Comanda-Event header of webhook outputs
+const webhookEvent = "output"
+
+// webhookFuncs are the functions of webhook payload templates
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// defaultWebhookPayload is posted when a webhook output has no payload
+const defaultWebhookPayload = `{"step": {{ json .Step }}, "output": {{ json .Output }}, "time": {{ json .Time }}}`
+
+// webhookOutput is the webhook map of a step's output
+type webhookOutput struct {
+	url      string
+	payload  *template.Template
+	headers  map[string]string
+	secret   string
+	attempts int
+}
+
+// webhookData is what webhook payload templates are executed with
+type webhookData struct {
+	Step   string
+	Output string
+	JSON   interface{}       // The output parsed as JSON, nil when it isn't JSON
+	Vars   map[string]string // Variables set with "as $name"
+	Time   time.Time
+}
+
+// parseWebhookOutput reads a webhook output map, such as
+// {url: https://hooks.zapier.com/..., payload: '{"summary": {{ json .Output }}}'}.
+// {{ env.NAME }} placeholders are replaced by interpolate.
+func parseWebhookOutput(spec map[string]interface{}, interpolate func(string) string) (webhookOutput, error) {
+	out := webhookOutput{attempts: 3, headers: make(map[string]string)}
+	rawURL, _ := spec["url"].(string)
+	if rawURL == "" {
+		return out, fmt.Errorf("webhook output needs a url")
+	}
+	out.url = interpolate(rawURL)
+	secret, _ := spec["secret"].(string)
+	out.secret = interpolate(secret)
+	if headers, ok := spec["headers"].(map[string]interface{}); ok {
+		for name, v := range headers {
+			value, ok := v.(string)
+			if !ok {
+				return out, fmt.Errorf("webhook header %s must be a string", name)
+			}
+			out.headers[name] = interpolate(value)
+		}
+	}
+	if v, ok := spec["attempts"]; ok {
+		attempts, ok := v.(int)
+		if !ok || attempts < 1 {
+			return out, fmt.Errorf("webhook attempts must be a positive number")
+		}
+		out.attempts = attempts
+	}
+	text, _ := spec["payload"].(string)
+	if text == "" {
+		text = defaultWebhookPayload
+	}
+	tmpl, err := template.New("payload").Funcs(webhookFuncs).Option("missingkey=zero").Parse(interpolate(text))
+	if err != nil {
+		return out, fmt.Errorf("invalid webhook payload template: %w", err)
+	}
+	out.payload = tmpl
+	return out, nil
+}
+
+// webhookHosts returns the hosts webhook outputs may post to: those of the
+// server's webhooks when running in the server, any otherwise
+func (p *Processor) webhookHosts() []string {
+	if p.serverConfig == nil {
+		return nil
+	}
+	return p.serverConfig.Webhooks.AllowedHosts
+}
+
+// renderWebhookPayload executes a payload template, checking that it
+// produced JSON
+func renderWebhookPayload(tmpl *template.Template, data webhookData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error rendering webhook payload: %w", err)
+	}
+	body := bytes.TrimSpace(buf.Bytes())
+	if !json.Valid(body) {
+		preview := string(body)
+		if len(preview) > 200 {
+			preview = preview[:200] + "..."
+		}
+		return nil, fmt.Errorf("webhook payload is not valid JSON (use {{ json .Output }} to quote text): %s", preview)
+	}
+	return body, nil
+}
+
+// postWebhookOutput posts a step's output to a webhook, as the JSON its
+// payload template builds
+func (p *Processor) postWebhookOutput(stepName, response string, spec map[string]interface{}) error {
+	out, err := parseWebhookOutput(spec, p.interpolateEnv)
+	if err != nil {
+		return err
+	}
+	if err := outbound.CheckURL(out.url, p.webhookHosts()); err != nil {
+		return err
+	}
+	data := webhookData{Step: stepName, Output: response, Vars: p.variables, Time: time.Now().UTC()}
+	if trimmed := strings.TrimSpace(stripCodeFence(response)); json.Valid([]byte(trimmed)) {
+		json.Unmarshal([]byte(trimmed), &data.JSON)
+	}
+	body, err := renderWebhookPayload(out.payload, data)
+	if err != nil {
+		return err
+	}
+
+	sender := outbound.NewSender(out.secret)
+	sender.Attempts = out.attempts
+	sender.Backoff = webhookBackoff
+	headers := map[string]string{
+		outbound.EventHeader:    webhookEvent,
+		outbound.DeliveryHeader: fmt.Sprintf("%s.%d", stepName, data.Time.UnixNano()),
+	}
+	for name, value := range out.headers {
+		headers[name] = value
+	}
+	if err := sender.Post(p.context(), out.url, body, headers); err != nil {
+		return err
+	}
+	config.InfoLog("\nPosted output of step %s to webhook %s", stepName, outbound.RedactURL(out.url))
+	return nil
+}
+
+// webhookErrors reports problems with the webhook map of a step's output
+func (p *Processor) webhookErrors(cfg StepConfig) []string {
+	output, _ := cfg.Output.(map[string]interface{})
+	spec, ok := output["webhook"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	out, err := parseWebhookOutput(spec, p.interpolateEnv)
+	if err == nil && !strings.Contains(out.url, "{{") {
+		// URLs from env variables that aren't set yet are checked when posting
+		err = outbound.CheckURL(out.url, p.webhookHosts())
+	}
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/webhook/outbound"
+)
+
+func TestWebhookOutput(t *testing.T) {
+	var calls int
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer srv.Close()
+	previous := webhookBackoff
+	webhookBackoff = time.Millisecond
+	defer func() { webhookBackoff = previous }()
+	t.Setenv("HOOK_SECRET", "s3cret")
+
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)
+	proc.variables["account"] = "Acme"
+	spec := map[string]interface{}{
+		"url":     srv.URL + "/hooks/catch/1/abc",
+		"secret":  "{{ env.HOOK_SECRET }}",
+		"headers": map[string]interface{}{"X-Source": "comanda"},
+		"payload": `{"account": {{ json .Vars.account }}, "score": {{ .JSON.score }}, "reasons": {{ json .JSON.reasons }}, "step": "{{ .Step }}"}`,
+	}
+	response := "```json\n{\"score\": 87, \"reasons\": [\"budget\", \"timing\"]}\n```"
+	if err := proc.postWebhookOutput("score_lead", response, spec); err != nil {
+		t.Fatalf("postWebhookOutput() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d deliveries, want a retry after the 502", calls)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("body %s: %v", body, err)
+	}
+	if got["account"] != "Acme" || got["score"] != float64(87) || len(got["reasons"].([]interface{})) != 2 || got["step"] != "score_lead" {
+		t.Errorf("payload = %s", body)
+	}
+	ts, _ := strconv.ParseInt(header.Get(outbound.TimestampHeader), 10, 64)
+	if header.Get(outbound.SignatureHeader) != outbound.Sign("s3cret", ts, "output", body) || header.Get("X-Source") != "comanda" {
+		t.Errorf("headers = %v, want the signature and custom header", header)
+	}
+
+	delete(spec, "payload")
+	if err := proc.postWebhookOutput("notify", "plain \"text\"", spec); err != nil {
+		t.Fatalf("postWebhookOutput() error = %v", err)
+	}
+	if !strings.Contains(string(body), `"output": "plain \"text\""`) {
+		t.Errorf("default payload = %s", body)
+	}
+
+	spec["payload"] = `{"summary": {{ .Output }}}`
+	if err := proc.postWebhookOutput("notify", "not json", spec); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("postWebhookOutput() error = %v, want the invalid payload", err)
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	proc := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false)
+	proc.serverConfig.Webhooks.AllowedHosts = []string{"hooks.zapier.com"}
+	for want, spec := range map[string]map[string]interface{}{
+		"needs a url":     {"payload": "{}"},
+		"is not allowed":  {"url": "https://example.com/hook"},
+		"invalid webhook": {"url": "https://hooks.zapier.com/x", "payload": "{{ .Output "},
+		"attempts":        {"url": "https://hooks.zapier.com/x", "attempts": 0},
+	} {
+		errs := proc.webhookErrors(StepConfig{Output: map[string]interface{}{"webhook": spec}})
+		if len(errs) != 1 || !strings.Contains(errs[0], want) {
+			t.Errorf("webhookErrors(%v) = %v, want %q", spec, errs, want)
+		}
+	}
+	if errs := proc.webhookErrors(StepConfig{Output: map[string]interface{}{"webhook": map[string]interface{}{"url": "{{ env.UNSET_HOOK_URL }}"}}}); len(errs) != 0 {
+		t.Errorf("webhookErrors() = %v, want URLs from env variables left to run time", errs)
+	}
+}
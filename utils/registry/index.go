@@ -0,0 +1,244 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexFile is the name of an index registry's index
+const IndexFile = "index.json"
+
+// errNotFound is returned by a store for a missing file
+var errNotFound = errors.New("not found")
+
+// Index lists the versions of each workflow in an index registry
+type Index struct {
+	Workflows map[string][]IndexEntry `json:"workflows"`
+}
+
+// IndexEntry is one pushed version of a workflow
+type IndexEntry struct {
+	Version   string    `json:"version"`
+	Path      string    `json:"path"` // Bundle location relative to the index
+	Digest    string    `json:"digest"`
+	Signature string    `json:"signature,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// store reads and writes files of an index registry
+type store interface {
+	get(name string) ([]byte, error)
+	put(name string, data []byte) error
+}
+
+// indexRegistry keeps bundles next to an index.json, on a web server that
+// accepts PUT for pushes or in a directory
+type indexRegistry struct {
+	store store
+}
+
+func (r *indexRegistry) loadIndex() (*Index, error) {
+	data, err := r.store.get(IndexFile)
+	index := &Index{Workflows: make(map[string][]IndexEntry)}
+	if errors.Is(err, errNotFound) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading registry index: %w", err)
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("error parsing registry index: %w", err)
+	}
+	if index.Workflows == nil {
+		index.Workflows = make(map[string][]IndexEntry)
+	}
+	return index, nil
+}
+
+// Push uploads the bundle, then adds it to the index. An existing version
+// with different contents is only replaced when overwrite is set.
+func (r *indexRegistry) Push(ref Ref, artifact Artifact, overwrite bool) error {
+	index, err := r.loadIndex()
+	if err != nil {
+		return err
+	}
+	entries := index.Workflows[ref.Name]
+	existing := -1
+	for i, e := range entries {
+		if e.Version == ref.Tag {
+			existing = i
+		}
+	}
+	if existing >= 0 && entries[existing].Digest != artifact.Digest && !overwrite {
+		return fmt.Errorf("%s already exists with different contents (use --force to replace it)", ref)
+	}
+
+	entry := IndexEntry{
+		Version:   ref.Tag,
+		Path:      path.Join(ref.Name, ref.Tag+".tgz"),
+		Digest:    artifact.Digest,
+		Signature: artifact.Signature,
+		Created:   time.Now().UTC(),
+	}
+	if err := r.store.put(entry.Path, artifact.Bundle); err != nil {
+		return fmt.Errorf("error uploading bundle: %w", err)
+	}
+	if existing >= 0 {
+		entries[existing] = entry
+	} else {
+		entries = append(entries, entry)
+	}
+	index.Workflows[ref.Name] = entries
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding registry index: %w", err)
+	}
+	if err := r.store.put(IndexFile, append(data, '\n')); err != nil {
+		return fmt.Errorf("error updating registry index: %w", err)
+	}
+	return nil
+}
+
+// Pull downloads a version listed in the index. The "latest" tag means the
+// most recently pushed version unless a version is named latest.
+func (r *indexRegistry) Pull(ref Ref) (*Artifact, error) {
+	index, err := r.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	entries := index.Workflows[ref.Name]
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s is not in the registry", ref.Name)
+	}
+	var entry *IndexEntry
+	for i := range entries {
+		if entries[i].Version == ref.Tag {
+			entry = &entries[i]
+		}
+	}
+	if entry == nil && ref.Tag == DefaultTag {
+		entry = &entries[0]
+		for i := range entries {
+			if entries[i].Created.After(entry.Created) {
+				entry = &entries[i]
+			}
+		}
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%s has no version %s", ref.Name, ref.Tag)
+	}
+
+	if clean := path.Clean(entry.Path); path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return nil, fmt.Errorf("registry index has an unsafe path for %s: %s", ref, entry.Path)
+	}
+	data, err := r.store.get(entry.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", entry.Path, err)
+	}
+	if err := verifyDigest(data, entry.Digest); err != nil {
+		return nil, err
+	}
+	return &Artifact{Bundle: data, Digest: entry.Digest, Signature: entry.Signature}, nil
+}
+
+// Tags lists a workflow's versions, oldest first
+func (r *indexRegistry) Tags(ref Ref) ([]string, error) {
+	index, err := r.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	entries := append([]IndexEntry(nil), index.Workflows[ref.Name]...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+	var tags []string
+	for _, e := range entries {
+		tags = append(tags, e.Version)
+	}
+	return tags, nil
+}
+
+// dirStore is an index registry in a local or shared directory
+type dirStore struct {
+	dir string
+}
+
+func (s dirStore) get(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	return data, err
+}
+
+func (s dirStore) put(name string, data []byte) error {
+	target := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// Write then rename so readers never see a partial file
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// httpStore is an index registry served over HTTP(S). Pushing needs a
+// server that accepts PUT, such as WebDAV or a generic artifact repository.
+type httpStore struct {
+	base   string
+	client *http.Client
+	creds  credentials
+}
+
+func (s *httpStore) url(name string) string {
+	return strings.TrimSuffix(s.base, "/") + "/" + name
+}
+
+func (s *httpStore) get(name string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.creds.apply(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", s.url(name), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *httpStore) put(name string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.url(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	s.creds.apply(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("PUT %s: %s %s", s.url(name), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
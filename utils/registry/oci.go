@@ -0,0 +1,358 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OCI media types of a workflow artifact
+const (
+	ArtifactType     = "application/vnd.comanda.workflow.v1"
+	BundleMediaType  = "application/vnd.comanda.workflow.bundle.v1.tar+gzip"
+	ociManifestType  = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyType     = "application/vnd.oci.empty.v1+json"
+	signatureKey     = "dev.comanda.signature"
+	bundleDigestKey  = "dev.comanda.bundle.digest"
+	ociCreatedKey    = "org.opencontainers.image.created"
+	ociTitleKey      = "org.opencontainers.image.title"
+	maxManifestBytes = 4 << 20
+)
+
+// ociEmptyConfig is the empty JSON config blob of an artifact manifest
+var ociEmptyConfig = []byte("{}")
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ociRegistry stores bundles as OCI artifacts through the distribution API,
+// so they can live in the same registry as container images
+type ociRegistry struct {
+	client *http.Client
+	creds  credentials
+	token  string // Bearer token from the registry's token service
+}
+
+// Push uploads the bundle and an artifact manifest tagged with ref.Tag. Like
+// image tags, an existing tag is moved to the new manifest.
+func (r *ociRegistry) Push(ref Ref, artifact Artifact, overwrite bool) error {
+	if strings.HasPrefix(ref.Tag, "sha256:") {
+		return fmt.Errorf("push needs a tag, not a digest")
+	}
+	if err := r.pushBlob(ref, ociEmptyConfig); err != nil {
+		return err
+	}
+	if err := r.pushBlob(ref, artifact.Bundle); err != nil {
+		return err
+	}
+
+	annotations := map[string]string{
+		ociCreatedKey:   time.Now().UTC().Format(time.RFC3339),
+		bundleDigestKey: artifact.Digest,
+	}
+	if artifact.Signature != "" {
+		annotations[signatureKey] = artifact.Signature
+	}
+	manifest, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestType,
+		ArtifactType:  ArtifactType,
+		Config:        ociDescriptor{MediaType: ociEmptyType, Digest: Digest(ociEmptyConfig), Size: int64(len(ociEmptyConfig))},
+		Layers: []ociDescriptor{{
+			MediaType:   BundleMediaType,
+			Digest:      artifact.Digest,
+			Size:        int64(len(artifact.Bundle)),
+			Annotations: map[string]string{ociTitleKey: ref.Name[strings.LastIndex(ref.Name, "/")+1:] + ".tgz"},
+		}},
+		Annotations: annotations,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+
+	resp, err := r.do(ref, http.MethodPut, r.url(ref, "manifests/"+ref.Tag), bytes.NewReader(manifest), ociManifestType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return responseError("pushing manifest", resp)
+	}
+	return nil
+}
+
+// pushBlob uploads a blob unless the registry already has it
+func (r *ociRegistry) pushBlob(ref Ref, data []byte) error {
+	digest := Digest(data)
+	resp, err := r.do(ref, http.MethodHead, r.url(ref, "blobs/"+digest), nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = r.do(ref, http.MethodPost, r.url(ref, "blobs/uploads/"), nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError("starting upload", resp)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return fmt.Errorf("registry returned no upload location")
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = r.do(ref, http.MethodPut, location.String(), bytes.NewReader(data), "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError("uploading blob", resp)
+	}
+	return nil
+}
+
+// Pull downloads the artifact's bundle and checks its digest
+func (r *ociRegistry) Pull(ref Ref) (*Artifact, error) {
+	resp, err := r.do(ref, http.MethodGet, r.url(ref, "manifests/"+ref.Tag), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s not found", ref)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("fetching manifest", resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %w", err)
+	}
+	if strings.HasPrefix(ref.Tag, "sha256:") {
+		if err := verifyDigest(data, ref.Tag); err != nil {
+			return nil, fmt.Errorf("manifest %w", err)
+		}
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %w", err)
+	}
+
+	var layer *ociDescriptor
+	for i := range manifest.Layers {
+		if manifest.Layers[i].MediaType == BundleMediaType {
+			layer = &manifest.Layers[i]
+		}
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("%s is not a comanda workflow", ref)
+	}
+
+	resp, err = r.do(ref, http.MethodGet, r.url(ref, "blobs/"+layer.Digest), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("downloading bundle", resp)
+	}
+	bundle, err := io.ReadAll(io.LimitReader(resp.Body, layer.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading bundle: %w", err)
+	}
+	if err := verifyDigest(bundle, layer.Digest); err != nil {
+		return nil, err
+	}
+	return &Artifact{Bundle: bundle, Digest: layer.Digest, Signature: manifest.Annotations[signatureKey]}, nil
+}
+
+// Tags lists the repository's tags
+func (r *ociRegistry) Tags(ref Ref) ([]string, error) {
+	resp, err := r.do(ref, http.MethodGet, r.url(ref, "tags/list"), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("listing tags", resp)
+	}
+	var list struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("error parsing tag list: %w", err)
+	}
+	return list.Tags, nil
+}
+
+// url returns a distribution API URL for the repository. Registries on
+// localhost are reached over plain HTTP.
+func (r *ociRegistry) url(ref Ref, suffix string) string {
+	scheme := "https"
+	if host := strings.Split(ref.Host, ":")[0]; host == "localhost" || host == "127.0.0.1" {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.Host, ref.Name, suffix)
+}
+
+// do sends a request, answering a Bearer challenge from the registry's token
+// service and retrying once. Tokens are scoped, so a push may need a new one
+// after a pull-scoped request.
+func (r *ociRegistry) do(ref Ref, method, target string, body *bytes.Reader, contentType string) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		var reqBody io.Reader
+		if body != nil {
+			body.Seek(0, io.SeekStart)
+			reqBody = body
+		}
+		req, err := http.NewRequest(method, target, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if method == http.MethodGet || method == http.MethodHead {
+			req.Header.Set("Accept", ociManifestType)
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		} else {
+			r.creds.apply(req)
+		}
+		return r.client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, fmt.Errorf("error contacting registry %s: %w", ref.Host, err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("registry %s requires authentication; set COMANDA_REGISTRY_USER and COMANDA_REGISTRY_PASSWORD or COMANDA_REGISTRY_TOKEN", ref.Host)
+	}
+	if err := r.fetchToken(challenge); err != nil {
+		return nil, err
+	}
+	resp, err = send()
+	if err != nil {
+		return nil, fmt.Errorf("error contacting registry %s: %w", ref.Host, err)
+	}
+	return resp, nil
+}
+
+// fetchToken gets a token from the realm named in a Bearer challenge, e.g.
+// Bearer realm="https://auth.example.com/token",service="registry",scope="repository:team/review:pull"
+func (r *ociRegistry) fetchToken(challenge string) error {
+	params := parseChallenge(challenge[len("bearer "):])
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("registry sent an invalid authentication challenge")
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if r.creds.username != "" {
+		req.SetBasicAuth(r.creds.username, r.creds.password)
+	} else if r.creds.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.creds.token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error getting registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("getting registry token", resp)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("error parsing registry token: %w", err)
+	}
+	r.token = token.Token
+	if r.token == "" {
+		r.token = token.AccessToken
+	}
+	if r.token == "" {
+		return fmt.Errorf("registry token service returned no token")
+	}
+	return nil
+}
+
+// parseChallenge parses the key="value" pairs of an authentication challenge
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+		params[key] = value
+		s = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return params
+}
+
+// responseError describes a failed registry response
+func responseError(action string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("registry error %s: %s %s", action, resp.Status, strings.TrimSpace(string(body)))
+}
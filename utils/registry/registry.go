@@ -0,0 +1,170 @@
+// Package registry pushes and pulls workflow bundles to and from shared
+// registries: OCI registries (oci://), static HTTPS indexes (https://) and
+// index directories on a shared filesystem (file://).
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Reference schemes
+const (
+	SchemeOCI   = "oci"
+	SchemeHTTPS = "https"
+	SchemeHTTP  = "http"
+	SchemeFile  = "file"
+)
+
+// DefaultTag is used when a reference has no tag
+const DefaultTag = "latest"
+
+// Ref names a workflow in a registry, e.g. oci://ghcr.io/team/review:1.2.0
+// or https://workflows.example.com/review:1.2.0
+type Ref struct {
+	Scheme string
+	Host   string // Registry host, for OCI
+	Base   string // Index URL or directory, for index registries
+	Name   string // Repository (OCI) or workflow name (index)
+	Tag    string // Tag or version; an OCI reference may use a digest instead
+}
+
+// String formats the reference
+func (r Ref) String() string {
+	sep := ":"
+	if strings.HasPrefix(r.Tag, "sha256:") {
+		sep = "@"
+	}
+	if r.Scheme == SchemeOCI {
+		return fmt.Sprintf("oci://%s/%s%s%s", r.Host, r.Name, sep, r.Tag)
+	}
+	return fmt.Sprintf("%s/%s%s%s", r.Base, r.Name, sep, r.Tag)
+}
+
+var (
+	validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	validTag  = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)
+)
+
+// ParseRef parses a reference. The last path segment holds the name and an
+// optional :tag or @sha256:digest.
+func ParseRef(s string) (Ref, error) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok {
+		return Ref{}, fmt.Errorf("invalid reference '%s': expected oci://, https:// or file:// (e.g. oci://ghcr.io/team/review:1.0)", s)
+	}
+	ref := Ref{Scheme: strings.ToLower(scheme)}
+	switch ref.Scheme {
+	case SchemeOCI, SchemeHTTPS, SchemeHTTP, SchemeFile:
+	default:
+		return Ref{}, fmt.Errorf("unsupported registry scheme '%s' (use oci, https or file)", scheme)
+	}
+
+	slash := strings.LastIndex(rest, "/")
+	if slash <= 0 || slash == len(rest)-1 {
+		return Ref{}, fmt.Errorf("invalid reference '%s': expected <registry>/<name>[:tag]", s)
+	}
+	dir, last := rest[:slash], rest[slash+1:]
+	name, tag := last, DefaultTag
+	if i := strings.Index(last, "@"); i >= 0 {
+		name, tag = last[:i], last[i+1:]
+		if !strings.HasPrefix(tag, "sha256:") || ref.Scheme != SchemeOCI {
+			return Ref{}, fmt.Errorf("invalid reference '%s': only oci references take an @sha256: digest (use --digest to pin others)", s)
+		}
+	} else if i := strings.LastIndex(last, ":"); i >= 0 {
+		name, tag = last[:i], last[i+1:]
+	}
+	if !validName.MatchString(name) || !(validTag.MatchString(tag) || strings.HasPrefix(tag, "sha256:")) {
+		return Ref{}, fmt.Errorf("invalid reference '%s': names and tags may contain letters, digits, '.', '_' and '-'", s)
+	}
+
+	ref.Tag = tag
+	if ref.Scheme == SchemeOCI {
+		host, repo, _ := strings.Cut(dir, "/")
+		ref.Host = host
+		ref.Name = strings.Trim(repo+"/"+name, "/")
+		for _, part := range strings.Split(ref.Name, "/") {
+			if !validName.MatchString(part) {
+				return Ref{}, fmt.Errorf("invalid reference '%s': bad repository path", s)
+			}
+		}
+	} else {
+		ref.Base = ref.Scheme + "://" + dir
+		ref.Name = name
+	}
+	return ref, nil
+}
+
+// Artifact is a bundle stored in a registry
+type Artifact struct {
+	Bundle    []byte
+	Digest    string // sha256:<hex> of the bundle
+	Signature string // Base64 Ed25519 signature of the digest, if signed
+}
+
+// Digest returns the sha256:<hex> digest of data
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Registry stores workflow bundles by name and tag
+type Registry interface {
+	Push(ref Ref, artifact Artifact, overwrite bool) error
+	Pull(ref Ref) (*Artifact, error)
+	Tags(ref Ref) ([]string, error)
+}
+
+// Open returns the registry a reference points to
+func Open(ref Ref) Registry {
+	switch ref.Scheme {
+	case SchemeOCI:
+		return &ociRegistry{client: newClient(), creds: credentialsFromEnv()}
+	case SchemeFile:
+		return &indexRegistry{store: dirStore{dir: strings.TrimPrefix(ref.Base, "file://")}}
+	}
+	return &indexRegistry{store: &httpStore{base: ref.Base, client: newClient(), creds: credentialsFromEnv()}}
+}
+
+// credentials authenticate to a registry
+type credentials struct {
+	username, password, token string
+}
+
+// credentialsFromEnv reads COMANDA_REGISTRY_TOKEN, or COMANDA_REGISTRY_USER
+// and COMANDA_REGISTRY_PASSWORD
+func credentialsFromEnv() credentials {
+	return credentials{
+		username: os.Getenv("COMANDA_REGISTRY_USER"),
+		password: os.Getenv("COMANDA_REGISTRY_PASSWORD"),
+		token:    os.Getenv("COMANDA_REGISTRY_TOKEN"),
+	}
+}
+
+// apply adds the credentials to a request
+func (c credentials) apply(req *http.Request) {
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+func newClient() *http.Client {
+	return &http.Client{Timeout: 2 * time.Minute}
+}
+
+// verifyDigest checks downloaded data against its expected digest
+func verifyDigest(data []byte, want string) error {
+	if got := Digest(data); got != want {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", want, got)
+	}
+	return nil
+}
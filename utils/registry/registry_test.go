@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := map[string]string{
+		"oci://ghcr.io/team/review:1.2.0":      "oci|ghcr.io||team/review|1.2.0",
+		"oci://localhost:5000/review":          "oci|localhost:5000||review|latest",
+		"oci://ghcr.io/team/review@sha256:abc": "oci|ghcr.io||team/review|sha256:abc",
+		"https://wf.example.com/team/review:2": "https||https://wf.example.com/team|review|2",
+		"file:///srv/workflows/review:v1":      "file||file:///srv/workflows|review|v1",
+	}
+	for in, want := range tests {
+		ref, err := ParseRef(in)
+		if err != nil {
+			t.Errorf("ParseRef(%q) error = %v", in, err)
+			continue
+		}
+		if got := strings.Join([]string{ref.Scheme, ref.Host, ref.Base, ref.Name, ref.Tag}, "|"); got != want {
+			t.Errorf("ParseRef(%q) = %s, want %s", in, got, want)
+		}
+		if ref.String() != in && !strings.HasSuffix(in, "/review") {
+			t.Errorf("String() = %s, want %s", ref.String(), in)
+		}
+	}
+	for _, in := range []string{"review.yaml", "ftp://host/review", "oci://ghcr.io/", "https://host/review@sha256:abc", "oci://ghcr.io/review:../x"} {
+		if _, err := ParseRef(in); err == nil {
+			t.Errorf("ParseRef(%q): expected an error", in)
+		}
+	}
+}
+
+func TestIndexRegistry(t *testing.T) {
+	dir := t.TempDir()
+	ref, err := ParseRef("file://" + filepath.ToSlash(dir) + "/review:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := Open(ref)
+	v1 := Artifact{Bundle: []byte("bundle v1"), Digest: Digest([]byte("bundle v1"))}
+	if err := reg.Push(ref, v1, false); err != nil {
+		t.Fatal(err)
+	}
+	// Pushing the same contents again is fine; different contents need overwrite
+	if err := reg.Push(ref, v1, false); err != nil {
+		t.Errorf("re-push: %v", err)
+	}
+	v2 := Artifact{Bundle: []byte("bundle v2"), Digest: Digest([]byte("bundle v2"))}
+	if err := reg.Push(ref, v2, false); err == nil {
+		t.Error("expected an error replacing a version")
+	}
+	ref2 := ref
+	ref2.Tag = "2.0"
+	if err := reg.Push(ref2, v2, false); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := reg.Pull(ref)
+	if err != nil || string(got.Bundle) != "bundle v1" {
+		t.Errorf("Pull(1.0) = %v, %v", got, err)
+	}
+	ref.Tag = DefaultTag
+	if got, err := reg.Pull(ref); err != nil || string(got.Bundle) != "bundle v2" {
+		t.Errorf("Pull(latest) = %v, %v", got, err)
+	}
+	if tags, err := reg.Tags(ref); err != nil || strings.Join(tags, ",") != "1.0,2.0" {
+		t.Errorf("Tags() = %v, %v", tags, err)
+	}
+}
+
+// fakeOCI is a minimal in-memory distribution API that requires a bearer
+// token from its token endpoint
+type fakeOCI struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	server    *httptest.Server
+}
+
+func newFakeOCI(t *testing.T) *fakeOCI {
+	f := &fakeOCI{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeOCI) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/token" {
+		if user, pass, _ := r.BasicAuth(); user != "ci" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"token":"tok-`+r.URL.Query().Get("scope")+`"}`)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer tok-") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+f.server.URL+`/token",service="fake",scope="repository:team/review:pull,push"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/team/review/")
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && path == "blobs/uploads/":
+		w.Header().Set("Location", "/v2/team/review/blobs/uploads/1?state=x")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "blobs/uploads/"):
+		digest := r.URL.Query().Get("digest")
+		if Digest(body) != digest || r.URL.Query().Get("state") != "x" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.blobs[digest] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "blobs/"):
+		data, ok := f.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "manifests/"):
+		f.manifests[strings.TrimPrefix(path, "manifests/")] = body
+		f.manifests[Digest(body)] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "manifests/"):
+		data, ok := f.manifests[strings.TrimPrefix(path, "manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case path == "tags/list":
+		io.WriteString(w, `{"name":"team/review","tags":["1.0"]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestOCIRegistry(t *testing.T) {
+	fake := newFakeOCI(t)
+	t.Setenv("COMANDA_REGISTRY_USER", "ci")
+	t.Setenv("COMANDA_REGISTRY_PASSWORD", "secret")
+	t.Setenv("COMANDA_REGISTRY_TOKEN", "")
+
+	ref, err := ParseRef("oci://" + strings.TrimPrefix(fake.server.URL, "http://") + "/team/review:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := Open(ref)
+	bundle := []byte("bundle contents")
+	artifact := Artifact{Bundle: bundle, Digest: Digest(bundle), Signature: "c2ln"}
+	if err := reg.Push(ref, artifact, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.blobs) != 2 {
+		t.Errorf("registry has %d blobs, want the config and the bundle", len(fake.blobs))
+	}
+
+	got, err := Open(ref).Pull(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Bundle) != string(bundle) || got.Digest != artifact.Digest || got.Signature != "c2ln" {
+		t.Errorf("Pull() = %+v", got)
+	}
+
+	// Pull by manifest digest
+	ref.Tag = Digest(fake.manifests["1.0"])
+	if _, err := Open(ref).Pull(ref); err != nil {
+		t.Errorf("Pull by digest: %v", err)
+	}
+	if tags, err := reg.Tags(ref); err != nil || len(tags) != 1 {
+		t.Errorf("Tags() = %v, %v", tags, err)
+	}
+
+	t.Setenv("COMANDA_REGISTRY_PASSWORD", "wrong")
+	if _, err := Open(ref).Pull(ref); err == nil {
+		t.Error("expected an authentication error")
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	private, public := filepath.Join(dir, "key"), filepath.Join(dir, "key.pub")
+	if err := GenerateKeys(private, public); err != nil {
+		t.Fatal(err)
+	}
+	artifact := &Artifact{Digest: Digest([]byte("bundle"))}
+	if err := Verify(artifact, public); err == nil {
+		t.Error("expected an error for an unsigned artifact")
+	}
+	signature, err := Sign(artifact.Digest, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact.Signature = signature
+	if err := Verify(artifact, public); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+	artifact.Digest = Digest([]byte("tampered"))
+	if err := Verify(artifact, public); err == nil {
+		t.Error("expected a verification error for a changed digest")
+	}
+}
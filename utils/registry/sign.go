@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// GenerateKeys writes a new Ed25519 signing key to privatePath and its public
+// key to publicPath, both PEM encoded
+func GenerateKeys(privatePath, publicPath string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("error generating key: %w", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		return fmt.Errorf("error writing private key: %w", err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		return fmt.Errorf("error writing public key: %w", err)
+	}
+	return nil
+}
+
+// readPEM reads the first PEM block of a file
+func readPEM(path, kind string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", kind, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s %s is not PEM encoded", kind, path)
+	}
+	return block.Bytes, nil
+}
+
+// Sign signs a bundle digest with the private key at keyPath and returns the
+// base64 signature
+func Sign(digest, keyPath string) (string, error) {
+	der, err := readPEM(keyPath, "signing key")
+	if err != nil {
+		return "", err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return "", fmt.Errorf("error parsing signing key: %w", err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("signing key %s is not an Ed25519 key", keyPath)
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte(digest))), nil
+}
+
+// Verify checks an artifact's signature against the public key at keyPath
+func Verify(artifact *Artifact, keyPath string) error {
+	der, err := readPEM(keyPath, "public key")
+	if err != nil {
+		return err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("error parsing public key: %w", err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("public key %s is not an Ed25519 key", keyPath)
+	}
+	if artifact.Signature == "" {
+		return fmt.Errorf("the workflow is not signed")
+	}
+	signature, err := base64.StdEncoding.DecodeString(artifact.Signature)
+	if err != nil || !ed25519.Verify(public, []byte(artifact.Digest), signature) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// docx holds the parts of a DOCX document being written
+type docx struct {
+	body  strings.Builder
+	links []string // Hyperlink targets, relationship rIdN+linkRelBase
+	lists []docxList
+}
+
+// docxList is a list's numbering instance, which restarts its numbers
+type docxList struct {
+	ordered bool
+	level   int
+	start   int
+}
+
+// linkRelBase is the relationship id of the first hyperlink; the ones
+// before it are the document's styles and numbering
+const linkRelBase = 3
+
+// WriteDOCX writes the document as a Word document, styled with the styles
+// of opts.Reference when set
+func WriteDOCX(w io.Writer, d *Document, opts Options) error {
+	styles := docxStylesXML
+	if opts.Reference != nil {
+		var err error
+		if styles, err = referenceStyles(opts.Reference); err != nil {
+			return err
+		}
+	}
+
+	doc := &docx{}
+	doc.blocks(d.Blocks, "", 0)
+
+	var document strings.Builder
+	document.WriteString(xml.Header)
+	document.WriteString(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body>`)
+	document.WriteString(doc.body.String())
+	width, height := pageSize(opts.PageSize)
+	fmt.Fprintf(&document, `<w:sectPr><w:pgSz w:w="%.0f" w:h="%.0f"/><w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="708" w:footer="708" w:gutter="0"/></w:sectPr>`, width*20, height*20)
+	document.WriteString(`</w:body></w:document>`)
+
+	var rels strings.Builder
+	rels.WriteString(xml.Header)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	rels.WriteString(`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+	rels.WriteString(`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>`)
+	for i, link := range doc.links {
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"/>`, i+linkRelBase, escape(link))
+	}
+	rels.WriteString(`</Relationships>`)
+
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypesXML},
+		{"_rels/.rels", docxRootRelsXML},
+		{"docProps/core.xml", fmt.Sprintf(coreXML, escape(opts.title(d)), time.Now().UTC().Format(time.RFC3339))},
+		{"word/document.xml", document.String()},
+		{"word/_rels/document.xml.rels", rels.String()},
+		{"word/styles.xml", styles},
+		{"word/numbering.xml", doc.numberingXML()},
+	}
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// referenceStyles returns the styles of a DOCX file
+func referenceStyles(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("error reading reference document: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "word/styles.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("error reading reference document: %w", err)
+		}
+		defer rc.Close()
+		styles, err := io.ReadAll(rc)
+		if err != nil {
+			return "", fmt.Errorf("error reading reference document: %w", err)
+		}
+		return string(styles), nil
+	}
+	return "", fmt.Errorf("reference document has no styles; is it a .docx file?")
+}
+
+// blocks writes blocks as paragraphs of the style, or their own style when
+// it is empty, at a list depth
+func (doc *docx) blocks(blocks []Block, style string, depth int) {
+	for _, block := range blocks {
+		switch block.Kind {
+		case Heading:
+			doc.paragraph(fmt.Sprintf("Heading%d", block.Level), "", block.Text)
+		case Paragraph:
+			doc.paragraph(or(style, "Normal"), "", block.Text)
+		case Code:
+			doc.body.WriteString(`<w:p><w:pPr><w:pStyle w:val="SourceCode"/></w:pPr>`)
+			for i, line := range strings.Split(block.Code, "\n") {
+				if i > 0 {
+					doc.body.WriteString(`<w:r><w:br/></w:r>`)
+				}
+				fmt.Fprintf(&doc.body, `<w:r><w:t xml:space="preserve">%s</w:t></w:r>`, escape(line))
+			}
+			doc.body.WriteString(`</w:p>`)
+		case Quote:
+			doc.blocks(block.Blocks, "Quote", depth)
+		case List:
+			doc.lists = append(doc.lists, docxList{ordered: block.Ordered, level: depth, start: block.Start})
+			num := len(doc.lists)
+			for _, item := range block.Items {
+				for i, b := range item {
+					switch {
+					case i == 0 && b.Kind == Paragraph:
+						doc.paragraph("ListParagraph", fmt.Sprintf(`<w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr>`, depth, num), b.Text)
+					case b.Kind == Paragraph:
+						doc.paragraph("ListParagraph", fmt.Sprintf(`<w:ind w:left="%d"/>`, 720*(depth+1)), b.Text)
+					default:
+						doc.blocks([]Block{b}, style, depth+1)
+					}
+				}
+			}
+		case Table:
+			doc.table(block)
+		case Rule:
+			doc.body.WriteString(`<w:p><w:pPr><w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="D0D7DE"/></w:pBdr></w:pPr></w:p>`)
+		}
+	}
+}
+
+func or(s, fallback string) string {
+	if s != "" {
+		return s
+	}
+	return fallback
+}
+
+// paragraph writes a paragraph of a style with extra paragraph properties
+func (doc *docx) paragraph(style, props string, inlines []Inline) {
+	fmt.Fprintf(&doc.body, `<w:p><w:pPr><w:pStyle w:val="%s"/>%s</w:pPr>`, style, props)
+	doc.runs(inlines, false)
+	doc.body.WriteString(`</w:p>`)
+}
+
+// runs writes inlines as runs, bold when they head a table
+func (doc *docx) runs(inlines []Inline, bold bool) {
+	for _, in := range inlines {
+		if in.Break {
+			doc.body.WriteString(`<w:r><w:br/></w:r>`)
+			continue
+		}
+		var props strings.Builder
+		if in.Link != "" {
+			props.WriteString(`<w:rStyle w:val="Hyperlink"/>`)
+		}
+		if in.Style&Bold != 0 || bold {
+			props.WriteString(`<w:b/>`)
+		}
+		if in.Style&Italic != 0 || in.Image != "" {
+			props.WriteString(`<w:i/>`)
+		}
+		if in.Style&Strike != 0 {
+			props.WriteString(`<w:strike/>`)
+		}
+		if in.Style&Mono != 0 {
+			props.WriteString(`<w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:shd w:val="clear" w:color="auto" w:fill="F3F4F6"/>`)
+		}
+		run := fmt.Sprintf(`<w:r><w:rPr>%s</w:rPr><w:t xml:space="preserve">%s</w:t></w:r>`, props.String(), escape(in.Text))
+		if in.Link != "" {
+			doc.links = append(doc.links, in.Link)
+			run = fmt.Sprintf(`<w:hyperlink r:id="rId%d">%s</w:hyperlink>`, len(doc.links)-1+linkRelBase, run)
+		}
+		doc.body.WriteString(run)
+	}
+}
+
+// table writes a table with a shaded header row that repeats on each page
+func (doc *docx) table(block Block) {
+	doc.body.WriteString(`<w:tbl><w:tblPr><w:tblStyle w:val="TableGrid"/><w:tblW w:w="0" w:type="auto"/></w:tblPr><w:tblGrid>`)
+	for range block.Header {
+		doc.body.WriteString(`<w:gridCol/>`)
+	}
+	doc.body.WriteString(`</w:tblGrid>`)
+	rows := append([][][]Inline{block.Header}, block.Rows...)
+	for r, row := range rows {
+		doc.body.WriteString(`<w:tr>`)
+		if r == 0 {
+			doc.body.WriteString(`<w:trPr><w:tblHeader/></w:trPr>`)
+		}
+		for i, cell := range row {
+			doc.body.WriteString(`<w:tc>`)
+			if r == 0 {
+				doc.body.WriteString(`<w:tcPr><w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/></w:tcPr>`)
+			}
+			doc.body.WriteString(`<w:p><w:pPr><w:spacing w:before="0" w:after="0"/>`)
+			if align := block.Align[i]; align != "" {
+				fmt.Fprintf(&doc.body, `<w:jc w:val="%s"/>`, align)
+			}
+			doc.body.WriteString(`</w:pPr>`)
+			doc.runs(cell, r == 0)
+			doc.body.WriteString(`</w:p></w:tc>`)
+		}
+		doc.body.WriteString(`</w:tr>`)
+	}
+	doc.body.WriteString(`</w:tbl><w:p/>`)
+}
+
+// numberingXML returns the numbering of the document's lists: one
+// abstract numbering for bullets and one for numbers, and an instance of
+// them for each list
+func (doc *docx) numberingXML() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`)
+	bullets := []string{"•", "◦", "▪"}
+	for abstract, ordered := range []bool{false, true} {
+		fmt.Fprintf(&b, `<w:abstractNum w:abstractNumId="%d"><w:multiLevelType w:val="hybridMultilevel"/>`, abstract)
+		for level := 0; level < 9; level++ {
+			format, text := "bullet", bullets[level%len(bullets)]
+			if ordered {
+				format = []string{"decimal", "lowerLetter", "lowerRoman"}[level%3]
+				text = fmt.Sprintf("%%%d.", level+1)
+			}
+			fmt.Fprintf(&b, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="%s"/><w:lvlText w:val="%s"/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`,
+				level, format, text, 720*(level+1))
+		}
+		b.WriteString(`</w:abstractNum>`)
+	}
+	for i, list := range doc.lists {
+		abstract := 0
+		if list.ordered {
+			abstract = 1
+		}
+		fmt.Fprintf(&b, `<w:num w:numId="%d"><w:abstractNumId w:val="%d"/>`, i+1, abstract)
+		if list.ordered {
+			fmt.Fprintf(&b, `<w:lvlOverride w:ilvl="%d"><w:startOverride w:val="%d"/></w:lvlOverride>`, list.level, list.start)
+		}
+		b.WriteString(`</w:num>`)
+	}
+	b.WriteString(`</w:numbering>`)
+	return b.String()
+}
+
+// escape escapes text for XML, dropping the characters XML can't hold
+func escape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != 0xFFFE && r != 0xFFFF) {
+			return r
+		}
+		return -1
+	}, s)
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const docxContentTypesXML = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+	`<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>` +
+	`<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>` +
+	`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+	`</Types>`
+
+const docxRootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+	`</Relationships>`
+
+const coreXML = xml.Header + `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+	`<dc:title>%s</dc:title><dc:creator>comanda</dc:creator><dcterms:created xsi:type="dcterms:W3CDTF">%s</dcterms:created>` +
+	`</cp:coreProperties>`
+
+// docxStylesXML holds the paragraph, character and table styles the
+// document uses when no reference document is given
+var docxStylesXML = xml.Header + `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+	`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Calibri" w:cs="Calibri"/><w:sz w:val="22"/><w:szCs w:val="22"/></w:rPr></w:rPrDefault>` +
+	`<w:pPrDefault><w:pPr><w:spacing w:after="160" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+	`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:rPr><w:sz w:val="56"/></w:rPr></w:style>` +
+	headingStyle(1, 40, "1F3864") + headingStyle(2, 32, "2F5496") + headingStyle(3, 27, "2F5496") +
+	headingStyle(4, 24, "2F5496") + headingStyle(5, 22, "2F5496") + headingStyle(6, 22, "595959") +
+	`<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:qFormat/>` +
+	`<w:pPr><w:pBdr><w:left w:val="single" w:sz="18" w:space="8" w:color="D0D7DE"/></w:pBdr><w:ind w:left="360"/></w:pPr><w:rPr><w:color w:val="57606A"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="SourceCode"><w:name w:val="Source Code"/><w:basedOn w:val="Normal"/>` +
+	`<w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/><w:spacing w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="19"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:spacing w:after="60"/><w:ind w:left="720"/><w:contextualSpacing/></w:pPr></w:style>` +
+	`<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr></w:style>` +
+	`<w:style w:type="table" w:styleId="TableGrid"><w:name w:val="Table Grid"/><w:tblPr><w:tblBorders>` +
+	`<w:top w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/><w:left w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/>` +
+	`<w:bottom w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/><w:right w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/>` +
+	`<w:insideH w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/>` +
+	`</w:tblBorders><w:tblCellMar><w:left w:w="108" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>` +
+	`</w:styles>`
+
+// headingStyle returns the style of a heading level, its size in half points
+func headingStyle(level, size int, color string) string {
+	return fmt.Sprintf(`<w:style w:type="paragraph" w:styleId="Heading%d"><w:name w:val="heading %d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/>`+
+		`<w:pPr><w:keepNext/><w:spacing w:before="%d" w:after="80"/><w:outlineLvl w:val="%d"/></w:pPr><w:rPr><w:b/><w:color w:val="%s"/><w:sz w:val="%d"/></w:rPr></w:style>`,
+		level, level, 360-40*level, level-1, color, size)
+}
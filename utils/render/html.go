@@ -0,0 +1,210 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// Options are the settings of a rendered document
+type Options struct {
+	Title     string // Document title; the first heading when empty
+	CSS       string // Stylesheet of HTML documents, replacing the default one
+	Template  string // Go template of HTML pages, given Title, Body, CSS and Date
+	Reference []byte // DOCX file whose styles DOCX documents use
+	PageSize  string // PDF page size: a4 or letter; defaults to a4
+}
+
+// title returns the document's title
+func (o Options) title(d *Document) string {
+	if o.Title != "" {
+		return o.Title
+	}
+	return d.Title()
+}
+
+// DefaultCSS is the stylesheet of HTML documents
+const DefaultCSS = `body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; font-size: 16px; line-height: 1.6; color: #24292f; max-width: 46em; margin: 2em auto; padding: 0 1em; }
+h1, h2, h3, h4, h5, h6 { line-height: 1.25; margin: 1.5em 0 0.5em; }
+h1 { font-size: 2em; border-bottom: 1px solid #d8dee4; padding-bottom: 0.3em; }
+h2 { font-size: 1.5em; border-bottom: 1px solid #d8dee4; padding-bottom: 0.3em; }
+a { color: #0969da; }
+code { font-family: ui-monospace, Menlo, Consolas, monospace; font-size: 0.875em; background: #f3f4f6; padding: 0.15em 0.3em; border-radius: 4px; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; border-radius: 6px; line-height: 1.45; }
+pre code { background: none; padding: 0; }
+blockquote { margin: 0; padding: 0 1em; color: #57606a; border-left: 0.25em solid #d0d7de; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #d0d7de; padding: 0.4em 0.8em; }
+th { background: #f6f8fa; }
+hr { border: 0; border-top: 1px solid #d0d7de; margin: 2em 0; }
+img { max-width: 100%; }
+`
+
+// defaultTemplate is the page HTML documents are written in
+const defaultTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }}</title>
+<style>
+{{ .CSS }}</style>
+</head>
+<body>
+{{ .Body }}</body>
+</html>
+`
+
+// WriteHTML writes the document as an HTML page
+func WriteHTML(w io.Writer, d *Document, opts Options) error {
+	text := defaultTemplate
+	if opts.Template != "" {
+		text = opts.Template
+	}
+	tmpl, err := template.New("page").Parse(text)
+	if err != nil {
+		return fmt.Errorf("error parsing HTML template: %w", err)
+	}
+	css := DefaultCSS
+	if opts.CSS != "" {
+		css = opts.CSS
+	}
+	return tmpl.Execute(w, map[string]interface{}{
+		"Title": opts.title(d),
+		"Body":  template.HTML(d.HTML()),
+		"CSS":   template.CSS(css),
+		"Date":  time.Now().Format("2006-01-02"),
+	})
+}
+
+// HTML returns the document's blocks as HTML, without a page around them
+func (d *Document) HTML() string {
+	var b strings.Builder
+	writeHTMLBlocks(&b, d.Blocks, false)
+	return b.String()
+}
+
+// writeHTMLBlocks writes blocks; tight list items leave their paragraphs
+// unwrapped
+func writeHTMLBlocks(b *strings.Builder, blocks []Block, tight bool) {
+	for _, block := range blocks {
+		switch block.Kind {
+		case Heading:
+			fmt.Fprintf(b, "<h%d>%s</h%d>\n", block.Level, inlineHTML(block.Text), block.Level)
+		case Paragraph:
+			if tight {
+				fmt.Fprintf(b, "%s\n", inlineHTML(block.Text))
+			} else {
+				fmt.Fprintf(b, "<p>%s</p>\n", inlineHTML(block.Text))
+			}
+		case Code:
+			class := ""
+			if block.Lang != "" {
+				class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(block.Lang))
+			}
+			fmt.Fprintf(b, "<pre><code%s>%s\n</code></pre>\n", class, html.EscapeString(block.Code))
+		case Quote:
+			b.WriteString("<blockquote>\n")
+			writeHTMLBlocks(b, block.Blocks, false)
+			b.WriteString("</blockquote>\n")
+		case List:
+			tag := "ul"
+			if block.Ordered {
+				tag = "ol"
+				if block.Start != 1 {
+					fmt.Fprintf(b, "<ol start=\"%d\">\n", block.Start)
+				} else {
+					b.WriteString("<ol>\n")
+				}
+			} else {
+				b.WriteString("<ul>\n")
+			}
+			for _, item := range block.Items {
+				b.WriteString("<li>")
+				writeHTMLBlocks(b, item, paragraphs(item) <= 1)
+				b.WriteString("</li>\n")
+			}
+			fmt.Fprintf(b, "</%s>\n", tag)
+		case Table:
+			b.WriteString("<table>\n<thead>\n<tr>")
+			for i, cell := range block.Header {
+				fmt.Fprintf(b, "<th%s>%s</th>", alignAttr(block.Align[i]), inlineHTML(cell))
+			}
+			b.WriteString("</tr>\n</thead>\n<tbody>\n")
+			for _, row := range block.Rows {
+				b.WriteString("<tr>")
+				for i, cell := range row {
+					fmt.Fprintf(b, "<td%s>%s</td>", alignAttr(block.Align[i]), inlineHTML(cell))
+				}
+				b.WriteString("</tr>\n")
+			}
+			b.WriteString("</tbody>\n</table>\n")
+		case Rule:
+			b.WriteString("<hr>\n")
+		}
+	}
+}
+
+// paragraphs counts the paragraphs of a list item; an item of one is
+// written without a paragraph around it
+func paragraphs(blocks []Block) int {
+	n := 0
+	for _, b := range blocks {
+		if b.Kind == Paragraph {
+			n++
+		}
+	}
+	return n
+}
+
+func alignAttr(align string) string {
+	if align == "" {
+		return ""
+	}
+	return fmt.Sprintf(` style="text-align: %s"`, align)
+}
+
+// inlineHTML returns inlines as HTML, with their styles nested as tags
+func inlineHTML(inlines []Inline) string {
+	var b strings.Builder
+	for _, in := range inlines {
+		if in.Break {
+			b.WriteString("<br>\n")
+			continue
+		}
+		if in.Image != "" {
+			fmt.Fprintf(&b, `<img src="%s" alt="%s">`, html.EscapeString(safeURL(in.Image)), html.EscapeString(in.Text))
+			continue
+		}
+		text := html.EscapeString(in.Text)
+		if in.Style&Mono != 0 {
+			text = "<code>" + text + "</code>"
+		}
+		if in.Style&Italic != 0 {
+			text = "<em>" + text + "</em>"
+		}
+		if in.Style&Bold != 0 {
+			text = "<strong>" + text + "</strong>"
+		}
+		if in.Style&Strike != 0 {
+			text = "<del>" + text + "</del>"
+		}
+		if in.Link != "" {
+			text = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(safeURL(in.Link)), text)
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// safeURL returns a link target, or # for one that would run script
+func safeURL(target string) string {
+	scheme := strings.ToLower(strings.TrimSpace(target))
+	if strings.HasPrefix(scheme, "javascript:") || strings.HasPrefix(scheme, "vbscript:") {
+		return "#"
+	}
+	return target
+}
@@ -0,0 +1,523 @@
+// Package render turns markdown, such as a report a workflow wrote, into
+// styled HTML, PDF and DOCX documents without external tools. It reads the
+// markdown models write: headings, paragraphs, lists, code blocks, block
+// quotes, tables and rules, with emphasis, code, links and images inline.
+package render
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Block kinds
+const (
+	Heading = iota + 1
+	Paragraph
+	Code
+	Quote
+	List
+	Table
+	Rule
+)
+
+// Inline styles, combined as bits
+const (
+	Bold = 1 << iota
+	Italic
+	Mono
+	Strike
+)
+
+// Document is parsed markdown
+type Document struct {
+	Blocks []Block
+}
+
+// Block is a block of a document
+type Block struct {
+	Kind  int
+	Level int      // Heading level, 1 to 6
+	Text  []Inline // Heading and paragraph text
+
+	Lang string // Code block language
+	Code string // Code block text, without the last newline
+
+	Blocks []Block // Quote contents
+
+	Ordered bool      // Numbered list
+	Start   int       // Number of an ordered list's first item
+	Items   [][]Block // List items
+
+	Header [][]Inline   // Table header cells
+	Rows   [][][]Inline // Table rows of cells
+	Align  []string     // Table column alignment: left, center, right or empty
+}
+
+// Inline is a run of text of one style
+type Inline struct {
+	Text  string
+	Style int
+	Link  string // Link target
+	Image string // Image source, with Text as its alt text
+	Break bool   // A hard line break; Text is empty
+}
+
+// Title returns the text of the document's first heading
+func (d *Document) Title() string {
+	for _, b := range d.Blocks {
+		if b.Kind == Heading {
+			return PlainText(b.Text)
+		}
+	}
+	return ""
+}
+
+// PlainText returns the text of inlines without styles
+func PlainText(inlines []Inline) string {
+	var b strings.Builder
+	for _, in := range inlines {
+		if in.Break {
+			b.WriteString(" ")
+		}
+		b.WriteString(in.Text)
+	}
+	return b.String()
+}
+
+var (
+	fencePattern     = regexp.MustCompile("^ {0,3}(```+|~~~+)\\s*([^`\\s]*)")
+	headingPattern   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	rulePattern      = regexp.MustCompile(`^ {0,3}([-*_])(?:\s*([-*_])){2,}\s*$`)
+	listPattern      = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])( +|$)`)
+	quotePattern     = regexp.MustCompile(`^ {0,3}> ?`)
+	delimiterPattern = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// Parse reads markdown
+func Parse(markdown string) *Document {
+	markdown = strings.ReplaceAll(strings.ReplaceAll(markdown, "\r\n", "\n"), "\t", "    ")
+	return &Document{Blocks: parseBlocks(strings.Split(markdown, "\n"))}
+}
+
+// isRule reports whether a line is a thematic break of one character
+func isRule(line string) bool {
+	m := rulePattern.FindStringSubmatch(line)
+	return m != nil && strings.Count(line, m[1]) == len(strings.Join(strings.Fields(line), ""))
+}
+
+// startsBlock reports whether a line starts a block other than a paragraph,
+// which ends the paragraph before it
+func startsBlock(line string) bool {
+	return fencePattern.MatchString(line) || headingPattern.MatchString(line) || isRule(line) ||
+		quotePattern.MatchString(line) || listPattern.MatchString(strings.TrimLeft(line, " "))
+}
+
+func parseBlocks(lines []string) []Block {
+	var blocks []Block
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+
+		case fencePattern.MatchString(line):
+			m := fencePattern.FindStringSubmatch(line)
+			fence := m[1]
+			indent := len(line) - len(strings.TrimLeft(line, " "))
+			var code []string
+			for i++; i < len(lines); i++ {
+				if t := strings.TrimSpace(lines[i]); strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+					i++
+					break
+				}
+				code = append(code, trimIndent(lines[i], indent))
+			}
+			blocks = append(blocks, Block{Kind: Code, Lang: m[2], Code: strings.Join(code, "\n")})
+
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			blocks = append(blocks, Block{Kind: Heading, Level: len(m[1]), Text: parseInlines(m[2])})
+			i++
+
+		case isRule(line):
+			blocks = append(blocks, Block{Kind: Rule})
+			i++
+
+		case quotePattern.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				if loc := quotePattern.FindStringIndex(lines[i]); loc != nil {
+					quoted = append(quoted, lines[i][loc[1]:])
+				} else if len(quoted) > 0 && !startsBlock(lines[i]) {
+					quoted = append(quoted, lines[i]) // A lazy continuation of the quoted paragraph
+				} else {
+					break
+				}
+			}
+			blocks = append(blocks, Block{Kind: Quote, Blocks: parseBlocks(quoted)})
+
+		case listPattern.MatchString(line):
+			var list Block
+			list, i = parseList(lines, i)
+			blocks = append(blocks, list)
+
+		case strings.Contains(line, "|") && i+1 < len(lines) && delimiterPattern.MatchString(lines[i+1]) && strings.Contains(lines[i+1], "-"):
+			var table Block
+			table, i = parseTable(lines, i)
+			blocks = append(blocks, table)
+
+		default:
+			var text []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				if len(text) > 0 && startsBlock(lines[i]) {
+					break
+				}
+				text = append(text, lines[i])
+			}
+			blocks = append(blocks, Block{Kind: Paragraph, Text: parseParagraph(text)})
+		}
+	}
+	return blocks
+}
+
+// trimIndent removes up to n leading spaces
+func trimIndent(line string, n int) string {
+	for n > 0 && strings.HasPrefix(line, " ") {
+		line, n = line[1:], n-1
+	}
+	return line
+}
+
+// parseParagraph reads the inlines of a paragraph's lines, which are
+// joined by spaces, or by a hard break after two trailing spaces or a
+// backslash
+func parseParagraph(lines []string) []Inline {
+	var inlines []Inline
+	for i, line := range lines {
+		hard := strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\")
+		line = strings.TrimSpace(line)
+		if hard {
+			line = strings.TrimSuffix(line, "\\")
+		}
+		if i < len(lines)-1 && !hard {
+			line += " "
+		}
+		inlines = append(inlines, parseInlines(line)...)
+		if hard && i < len(lines)-1 {
+			inlines = append(inlines, Inline{Break: true})
+		}
+	}
+	return merge(inlines)
+}
+
+// parseList reads the list starting at lines[i], returning it with the
+// index of the line after it. An item holds the lines indented under its
+// marker, so nested lists and paragraphs are its blocks.
+func parseList(lines []string, i int) (Block, int) {
+	m := listPattern.FindStringSubmatch(lines[i])
+	indent := len(m[1])
+	marker := m[2]
+	ordered := marker[0] >= '0' && marker[0] <= '9'
+	list := Block{Kind: List, Ordered: ordered, Start: 1}
+	if ordered {
+		list.Start, _ = strconv.Atoi(marker[:len(marker)-1])
+	}
+	delimiter := marker[len(marker)-1:]
+
+	for i < len(lines) {
+		m := listPattern.FindStringSubmatch(lines[i])
+		if m == nil || len(m[1]) != indent {
+			break
+		}
+		if itemOrdered := m[2][0] >= '0' && m[2][0] <= '9'; itemOrdered != ordered || m[2][len(m[2])-1:] != delimiter {
+			break
+		}
+		content := len(m[0])
+		if m[3] == "" || len(m[3]) > 4 {
+			content = len(m[1]) + len(m[2]) + 1
+		}
+		item := []string{lines[i][min(content, len(lines[i])):]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line ends the item unless indented lines follow
+				next := i + 1
+				for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+					next++
+				}
+				if next < len(lines) && leadingSpaces(lines[next]) >= content {
+					item = append(item, "")
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) >= content {
+				item = append(item, trimIndent(line, content))
+				continue
+			}
+			if startsBlock(line) || (strings.Contains(line, "|") && leadingSpaces(line) < content && len(item) > 0 && item[len(item)-1] == "") {
+				break
+			}
+			item = append(item, strings.TrimLeft(line, " ")) // A lazy continuation of the item's paragraph
+		}
+		list.Items = append(list.Items, parseBlocks(item))
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			next := listPattern.FindStringSubmatch(lines[min(i+1, len(lines)-1)])
+			if i+1 >= len(lines) || next == nil || len(next[1]) != indent {
+				return list, i
+			}
+			i++
+		}
+	}
+	return list, i
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// parseTable reads the pipe table starting at lines[i], returning it with
+// the index of the line after it
+func parseTable(lines []string, i int) (Block, int) {
+	table := Block{Kind: Table}
+	for _, cell := range splitRow(lines[i]) {
+		table.Header = append(table.Header, parseInlines(cell))
+	}
+	for _, cell := range splitRow(lines[i+1]) {
+		switch left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":"); {
+		case left && right:
+			table.Align = append(table.Align, "center")
+		case right:
+			table.Align = append(table.Align, "right")
+		case left:
+			table.Align = append(table.Align, "left")
+		default:
+			table.Align = append(table.Align, "")
+		}
+	}
+	for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+		cells := splitRow(lines[i])
+		row := make([][]Inline, len(table.Header))
+		for j := range row {
+			if j < len(cells) {
+				row[j] = parseInlines(cells[j])
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	for len(table.Align) < len(table.Header) {
+		table.Align = append(table.Align, "")
+	}
+	return table, i
+}
+
+// splitRow splits a table row into its trimmed cells, keeping pipes that
+// are escaped or inside code
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			inCode = !inCode
+			cell.WriteByte(c)
+		case c == '|' && !inCode:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// parseInlines reads the emphasis, code, links and images of a line
+func parseInlines(s string) []Inline {
+	return merge(inlines(s, 0, ""))
+}
+
+func inlines(s string, style int, link string) []Inline {
+	var result []Inline
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			result = append(result, Inline{Text: text.String(), Style: style, Link: link})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!|<>~", s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			n := runLength(s, i, '`')
+			if end := strings.Index(s[i+n:], strings.Repeat("`", n)); end >= 0 {
+				flush()
+				code := s[i+n : i+n+end]
+				if t := strings.TrimSpace(code); t != "" && strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") {
+					code = code[1 : len(code)-1]
+				}
+				result = append(result, Inline{Text: code, Style: style | Mono, Link: link})
+				i += n + end + n
+				continue
+			}
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case c == '*' || c == '_':
+			n := runLength(s, i, c)
+			if n > 3 {
+				n = 3
+			}
+			if end := closingRun(s, i+n, c, n); end >= 0 && i+n < len(s) && s[i+n] != ' ' && (c == '*' || i == 0 || !isWordChar(s[i-1])) {
+				flush()
+				add := map[int]int{1: Italic, 2: Bold, 3: Bold | Italic}[n]
+				result = append(result, inlines(s[i+n:end], style|add, link)...)
+				i = end + n
+				continue
+			}
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case c == '~' && strings.HasPrefix(s[i:], "~~"):
+			if end := strings.Index(s[i+2:], "~~"); end > 0 {
+				flush()
+				result = append(result, inlines(s[i+2:i+2+end], style|Strike, link)...)
+				i += 2 + end + 2
+				continue
+			}
+
+		case c == '!' && strings.HasPrefix(s[i:], "!["):
+			if alt, target, end, ok := linkAt(s, i+1); ok {
+				flush()
+				result = append(result, Inline{Text: alt, Style: style, Link: link, Image: target})
+				i = end
+				continue
+			}
+
+		case c == '[' && link == "":
+			if label, target, end, ok := linkAt(s, i); ok {
+				flush()
+				result = append(result, inlines(label, style, target)...)
+				i = end
+				continue
+			}
+
+		case c == '<' && link == "":
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				if target := s[i+1 : i+end]; (strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "mailto:")) && !strings.ContainsAny(target, " <") {
+					flush()
+					result = append(result, Inline{Text: strings.TrimPrefix(target, "mailto:"), Style: style, Link: target})
+					i += end + 1
+					continue
+				}
+			}
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return result
+}
+
+// runLength counts the times c repeats from s[i]
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// closingRun returns where the run of n c's closing emphasis opened before
+// from starts, or -1. A closing run follows text rather than a space; with
+// underscores it ends a word.
+func closingRun(s string, from int, c byte, n int) int {
+	for j := from; j+n <= len(s); j++ {
+		if s[j] == '`' {
+			if end := strings.IndexByte(s[j+1:], '`'); end >= 0 {
+				j += end + 1
+			}
+			continue
+		}
+		if s[j] != c {
+			continue
+		}
+		run := runLength(s, j, c)
+		if run >= n && j > from && s[j-1] != ' ' && (c == '*' || j+run >= len(s) || !isWordChar(s[j+run])) {
+			return j + run - n
+		}
+		j += run - 1
+	}
+	return -1
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// linkAt reads a [label](target "title") link starting at s[i], returning
+// the label and target and the index after the link
+func linkAt(s string, i int) (label, target string, end int, ok bool) {
+	depth := 0
+	close := -1
+	for j := i; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] == '[' {
+			depth++
+		} else if s[j] == ']' {
+			if depth--; depth == 0 {
+				close = j
+				break
+			}
+		}
+	}
+	if close < 0 || close+1 >= len(s) || s[close+1] != '(' {
+		return "", "", 0, false
+	}
+	paren := strings.IndexByte(s[close+1:], ')')
+	if paren < 0 {
+		return "", "", 0, false
+	}
+	target = strings.TrimSpace(s[close+2 : close+1+paren])
+	if sp := strings.IndexAny(target, " \t"); sp > 0 {
+		target = target[:sp] // Drop the title
+	}
+	target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+	return s[i+1 : close], target, close + 2 + paren, true
+}
+
+// merge joins adjacent inlines of the same style and link
+func merge(inlines []Inline) []Inline {
+	var result []Inline
+	for _, in := range inlines {
+		if n := len(result); n > 0 && !in.Break && !result[n-1].Break && in.Image == "" && result[n-1].Image == "" &&
+			result[n-1].Style == in.Style && result[n-1].Link == in.Link {
+			result[n-1].Text += in.Text
+			continue
+		}
+		result = append(result, in)
+	}
+	return result
+}
@@ -0,0 +1,710 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// pageSizes are the PDF page sizes, width and height in points
+var pageSizes = map[string][2]float64{
+	"a4":     {595.28, 841.89},
+	"letter": {612, 792},
+}
+
+// ValidPageSize reports whether a page size is known; empty is a4
+func ValidPageSize(name string) bool {
+	_, ok := pageSizes[strings.ToLower(name)]
+	return ok || name == ""
+}
+
+// pageSize returns the width and height of a page size, in points
+func pageSize(name string) (float64, float64) {
+	size, ok := pageSizes[strings.ToLower(name)]
+	if !ok {
+		size = pageSizes["a4"]
+	}
+	return size[0], size[1]
+}
+
+// Fonts of PDF documents: the standard fonts every reader has, so none
+// are embedded
+const (
+	fontRegular = iota
+	fontBold
+	fontItalic
+	fontBoldItalic
+	fontMono
+)
+
+var fontNames = []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique", "Courier"}
+
+// helveticaWidths are the widths of Helvetica's characters from space to
+// tilde, in thousandths of the font size
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// helveticaBoldWidths are the widths of Helvetica-Bold's characters from
+// space to tilde
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsiPunctuation maps the punctuation models write outside Latin-1 to
+// its WinAnsiEncoding codes, with the codes' Helvetica widths
+var winAnsiPunctuation = map[rune]struct {
+	code  byte
+	width int
+}{
+	'€': {0x80, 556}, '…': {0x85, 1000}, '‘': {0x91, 222}, '’': {0x92, 222},
+	'“': {0x93, 333}, '”': {0x94, 333}, '•': {0x95, 350}, '–': {0x96, 556}, '—': {0x97, 1000},
+}
+
+// punctuationWidths are the widths of winAnsiPunctuation, by code
+var punctuationWidths = func() map[byte]int {
+	widths := make(map[byte]int)
+	for _, p := range winAnsiPunctuation {
+		widths[p.code] = p.width
+	}
+	return widths
+}()
+
+// encode returns text in WinAnsiEncoding, the encoding of the standard
+// fonts; characters it can't hold become question marks
+func encode(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch p, ok := winAnsiPunctuation[r]; {
+		case ok:
+			b = append(b, p.code)
+		case r == '\t':
+			b = append(b, ' ', ' ', ' ', ' ')
+		case r >= 0x20 && r < 0x7F || r >= 0xA0 && r <= 0xFF:
+			b = append(b, byte(r))
+		case r < 0x20:
+		default:
+			b = append(b, '?')
+		}
+	}
+	return string(b)
+}
+
+// textWidth returns the width of encoded text in a font, in points
+func textWidth(s string, font int, size float64) float64 {
+	if font == fontMono {
+		return float64(len(s)) * 600 * size / 1000
+	}
+	widths := &helveticaWidths
+	if font == fontBold || font == fontBoldItalic {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 32 && c <= 126:
+			total += widths[c-32]
+		case punctuationWidths[c] > 0:
+			total += punctuationWidths[c]
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Layout of PDF documents, in points
+const (
+	pdfMargin      = 72
+	pdfBodySize    = 11
+	pdfBodyLeading = 15.4
+	pdfCodeSize    = 9
+	pdfCodeLeading = 12
+	pdfTableSize   = 10
+	pdfListIndent  = 18
+	pdfQuoteIndent = 14
+	pdfCellPadding = 4
+)
+
+var headingSizes = []float64{20, 16, 13.5, 12, 11, 11}
+
+// Colors of PDF documents
+var (
+	colorText   = [3]float64{0.14, 0.16, 0.18}
+	colorMuted  = [3]float64{0.34, 0.38, 0.42}
+	colorLink   = [3]float64{0.04, 0.41, 0.85}
+	colorBorder = [3]float64{0.82, 0.84, 0.87}
+	colorShade  = [3]float64{0.965, 0.973, 0.98}
+)
+
+// pdf lays a document out on pages
+type pdf struct {
+	width, height float64
+	pages         []*bytes.Buffer // Content streams
+	annots        [][]string      // Link annotations of each page
+	y             float64         // Top of the next line, from the top of the page
+}
+
+// layout is where blocks are laid out
+type layout struct {
+	indent float64 // From the left margin
+	color  [3]float64
+	quotes []float64 // Quote bars, from the left margin
+	tight  bool      // In a list, with less space between blocks
+}
+
+// WritePDF writes the document as a PDF of the page size in opts
+func WritePDF(w io.Writer, d *Document, opts Options) error {
+	p := &pdf{}
+	p.width, p.height = pageSize(opts.PageSize)
+	p.newPage()
+	p.blocks(d.Blocks, layout{color: colorText})
+	for i, page := range p.pages {
+		label := fmt.Sprintf("%d / %d", i+1, len(p.pages))
+		fmt.Fprintf(page, "%s rg BT /F%d 9 Tf %s %s Td (%s) Tj ET\n", rgb(colorMuted), fontRegular+1,
+			num((p.width-textWidth(label, fontRegular, 9))/2), num(pdfMargin/2), label)
+	}
+	return p.write(w, opts.title(d))
+}
+
+func (p *pdf) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.annots = append(p.annots, nil)
+	p.y = pdfMargin
+}
+
+// page returns the content stream of the current page
+func (p *pdf) page() *bytes.Buffer {
+	return p.pages[len(p.pages)-1]
+}
+
+// need starts a new page unless h points fit on this one
+func (p *pdf) need(h float64) {
+	if p.y+h > p.height-pdfMargin && p.y > pdfMargin {
+		p.newPage()
+	}
+}
+
+// space adds space between blocks, which a new page drops
+func (p *pdf) space(h float64) {
+	if p.y > pdfMargin {
+		p.y += h
+	}
+}
+
+// contentWidth returns the width of lines in a layout
+func (p *pdf) contentWidth(ctx layout) float64 {
+	return p.width - 2*pdfMargin - ctx.indent
+}
+
+// rect fills a rectangle whose top left is x, y from the top of the page
+func (p *pdf) rect(x, y, w, h float64, color [3]float64) {
+	fmt.Fprintf(p.page(), "%s rg %s %s %s %s re f\n", rgb(color), num(x), num(p.height-y-h), num(w), num(h))
+}
+
+// line strokes a line from the top of the page
+func (p *pdf) line(x1, y1, x2, y2, width float64, color [3]float64) {
+	fmt.Fprintf(p.page(), "%s RG %s w %s %s m %s %s l S\n", rgb(color), num(width), num(x1), num(p.height-y1), num(x2), num(p.height-y2))
+}
+
+func (p *pdf) blocks(blocks []Block, ctx layout) {
+	after := 8.0
+	if ctx.tight {
+		after = 3
+	}
+	for _, block := range blocks {
+		switch block.Kind {
+		case Heading:
+			size := headingSizes[block.Level-1]
+			leading := size * 1.3
+			p.need(leading + 2*pdfBodyLeading) // Keep the heading with its text
+			p.space(size * 0.7)
+			p.text(block.Text, Bold, size, leading, ctx, "")
+			if block.Level <= 2 {
+				p.y += 3
+				p.line(pdfMargin+ctx.indent, p.y, p.width-pdfMargin, p.y, 0.75, colorBorder)
+				p.y += 3
+			}
+			p.space(4)
+		case Paragraph:
+			p.text(block.Text, 0, pdfBodySize, pdfBodyLeading, ctx, "")
+			p.space(after)
+		case Code:
+			p.code(block.Code, ctx)
+			p.space(after)
+		case Quote:
+			inner := ctx
+			inner.quotes = append(append([]float64(nil), ctx.quotes...), ctx.indent)
+			inner.indent += pdfQuoteIndent
+			inner.color = colorMuted
+			p.blocks(block.Blocks, inner)
+		case List:
+			inner := ctx
+			inner.indent += pdfListIndent
+			inner.tight = true
+			for i, item := range block.Items {
+				marker := "•"
+				if block.Ordered {
+					marker = fmt.Sprintf("%d.", block.Start+i)
+				}
+				if len(item) > 0 && item[0].Kind == Paragraph {
+					p.text(item[0].Text, 0, pdfBodySize, pdfBodyLeading, inner, marker)
+					p.space(3)
+					item = item[1:]
+				}
+				p.blocks(item, inner)
+			}
+			if !ctx.tight {
+				p.space(after - 3)
+			}
+		case Table:
+			p.table(block, ctx)
+			p.space(after + 4)
+		case Rule:
+			p.need(12)
+			p.y += 6
+			p.line(pdfMargin+ctx.indent, p.y, p.width-pdfMargin, p.y, 0.75, colorBorder)
+			p.y += 6 + after
+		}
+	}
+}
+
+// piece is text of one font in a word
+type piece struct {
+	text   string // WinAnsi-encoded
+	font   int
+	size   float64
+	link   string
+	strike bool
+}
+
+// word is text lines break around; hard breaks are words of their own
+type word struct {
+	pieces []piece
+	width  float64
+	br     bool
+}
+
+// words splits inlines into words, adding style to each
+func words(inlines []Inline, style int, size float64) []word {
+	var result []word
+	var current word
+	end := func() {
+		if len(current.pieces) > 0 {
+			result = append(result, current)
+		}
+		current = word{}
+	}
+	for _, in := range inlines {
+		if in.Break {
+			end()
+			result = append(result, word{br: true})
+			continue
+		}
+		s := style | in.Style
+		text := in.Text
+		if in.Image != "" {
+			s |= Italic
+		}
+		font, fontSize := fontRegular, size
+		switch {
+		case s&Mono != 0:
+			font, fontSize = fontMono, size*0.9
+		case s&Bold != 0 && s&Italic != 0:
+			font = fontBoldItalic
+		case s&Bold != 0:
+			font = fontBold
+		case s&Italic != 0:
+			font = fontItalic
+		}
+		for i, part := range strings.Split(text, " ") {
+			if i > 0 {
+				end()
+			}
+			if part == "" {
+				continue
+			}
+			encoded := encode(part)
+			width := textWidth(encoded, font, fontSize)
+			current.pieces = append(current.pieces, piece{text: encoded, font: font, size: fontSize, link: in.Link, strike: s&Strike != 0})
+			current.width += width
+		}
+	}
+	end()
+	return result
+}
+
+// split breaks a word wider than a line into pieces that fit
+func split(w word, width float64) []word {
+	var result []word
+	var current word
+	for _, pc := range w.pieces {
+		for len(pc.text) > 0 {
+			n := len(pc.text)
+			for n > 1 && current.width+textWidth(pc.text[:n], pc.font, pc.size) > width {
+				n--
+			}
+			if current.width > 0 && current.width+textWidth(pc.text[:n], pc.font, pc.size) > width {
+				result = append(result, current)
+				current = word{}
+				continue
+			}
+			part := pc
+			part.text = pc.text[:n]
+			current.pieces = append(current.pieces, part)
+			current.width += textWidth(part.text, part.font, part.size)
+			pc.text = pc.text[n:]
+		}
+	}
+	return append(result, current)
+}
+
+// spaceWidth returns the width of the space after a word
+func spaceWidth(w word) float64 {
+	last := w.pieces[len(w.pieces)-1]
+	return textWidth(" ", last.font, last.size)
+}
+
+// wrap breaks words into lines no wider than width
+func wrap(ws []word, width float64) [][]word {
+	var lines [][]word
+	var line []word
+	lineWidth := 0.0
+	for _, w := range ws {
+		if w.br {
+			lines = append(lines, line)
+			line, lineWidth = nil, 0
+			continue
+		}
+		for _, part := range split(w, width) {
+			if len(line) > 0 && lineWidth+spaceWidth(line[len(line)-1])+part.width > width {
+				lines = append(lines, line)
+				line, lineWidth = nil, 0
+			}
+			if len(line) > 0 {
+				lineWidth += spaceWidth(line[len(line)-1])
+			}
+			line = append(line, part)
+			lineWidth += part.width
+		}
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// text lays out wrapped text, with a list marker before its first line
+func (p *pdf) text(inlines []Inline, style int, size, leading float64, ctx layout, marker string) {
+	x := pdfMargin + ctx.indent
+	for i, line := range wrap(words(inlines, style, size), p.contentWidth(ctx)) {
+		p.need(leading)
+		p.quoteBars(ctx, leading)
+		baseline := p.y + leading*0.75
+		if i == 0 && marker != "" {
+			fmt.Fprintf(p.page(), "%s rg BT /F%d %s Tf %s %s Td (%s) Tj ET\n", rgb(ctx.color), fontRegular+1, num(size),
+				num(x-pdfListIndent), num(p.height-baseline), escapeString(encode(marker)))
+		}
+		p.drawLine(line, x, baseline, ctx.color)
+		p.y += leading
+	}
+}
+
+// quoteBars draws the bars of the quotes a line of height h is in
+func (p *pdf) quoteBars(ctx layout, h float64) {
+	for _, q := range ctx.quotes {
+		p.rect(pdfMargin+q, p.y, 3, h, colorBorder)
+	}
+}
+
+// drawLine draws a line of words from x, joining the pieces of a font into
+// one string
+func (p *pdf) drawLine(line []word, x, baseline float64, color [3]float64) {
+	type run struct {
+		piece
+		x, width float64
+	}
+	var runs []run
+	for i, w := range line {
+		if i > 0 {
+			x += spaceWidth(line[i-1])
+		}
+		for j, pc := range w.pieces {
+			width := textWidth(pc.text, pc.font, pc.size)
+			if n := len(runs); n > 0 {
+				last := &runs[n-1]
+				if last.font == pc.font && last.size == pc.size && last.link == pc.link && last.strike == pc.strike {
+					gap := ""
+					if j == 0 {
+						gap = " "
+					}
+					last.text += gap + pc.text
+					last.width = x + width - last.x
+					x += width
+					continue
+				}
+			}
+			runs = append(runs, run{piece: pc, x: x, width: width})
+			x += width
+		}
+	}
+
+	for _, r := range runs {
+		c := color
+		if r.link != "" {
+			c = colorLink
+		}
+		fmt.Fprintf(p.page(), "%s rg BT /F%d %s Tf %s %s Td (%s) Tj ET\n", rgb(c), r.font+1, num(r.size), num(r.x), num(p.height-baseline), escapeString(r.text))
+		if r.strike {
+			mid := baseline - r.size*0.3
+			p.line(r.x, mid, r.x+r.width, mid, 0.6, c)
+		}
+		if r.link != "" {
+			p.line(r.x, baseline+1.5, r.x+r.width, baseline+1.5, 0.5, c)
+			p.annots[len(p.annots)-1] = append(p.annots[len(p.annots)-1], fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect [%s %s %s %s] /Border [0 0 0] /A << /S /URI /URI (%s) >> >>",
+				num(r.x), num(p.height-baseline-2), num(r.x+r.width), num(p.height-baseline+r.size), escapeString(r.link)))
+		}
+	}
+}
+
+// code lays out a code block on a shaded background, breaking lines too
+// long for the page
+func (p *pdf) code(text string, ctx layout) {
+	x := pdfMargin + ctx.indent
+	width := p.contentWidth(ctx)
+	chars := int((width - 16) / (600 * pdfCodeSize / 1000))
+	var lines []string
+	for _, line := range strings.Split(encode(strings.ReplaceAll(text, "\t", "    ")), "\n") {
+		for len(line) > chars {
+			lines = append(lines, line[:chars])
+			line = line[chars:]
+		}
+		lines = append(lines, line)
+	}
+	p.need(6 + pdfCodeLeading)
+	p.quoteBars(ctx, 6)
+	p.rect(x, p.y, width, 6, colorShade)
+	p.y += 6
+	for _, line := range lines {
+		p.need(pdfCodeLeading)
+		p.quoteBars(ctx, pdfCodeLeading)
+		p.rect(x, p.y, width, pdfCodeLeading, colorShade)
+		fmt.Fprintf(p.page(), "%s rg BT /F%d %d Tf %s %s Td (%s) Tj ET\n", rgb(colorText), fontMono+1, pdfCodeSize,
+			num(x+8), num(p.height-p.y-pdfCodeLeading*0.75), escapeString(line))
+		p.y += pdfCodeLeading
+	}
+	p.need(6)
+	p.quoteBars(ctx, 6)
+	p.rect(x, p.y, width, 6, colorShade)
+	p.y += 6
+}
+
+// table lays out a table with a shaded header row, sizing its columns to
+// their text and wrapping cells when the page is too narrow
+func (p *pdf) table(block Block, ctx layout) {
+	const leading = pdfTableSize * 1.3
+	cols := len(block.Header)
+	if cols == 0 {
+		return
+	}
+	rows := append([][][]Inline{block.Header}, block.Rows...)
+	cells := make([][][]word, len(rows))
+	natural := make([]float64, cols)
+	least := make([]float64, cols)
+	for r, row := range rows {
+		style := 0
+		if r == 0 {
+			style = Bold
+		}
+		cells[r] = make([][]word, cols)
+		for c := 0; c < cols; c++ {
+			var cell []Inline
+			if c < len(row) {
+				cell = row[c]
+			}
+			ws := words(cell, style, pdfTableSize)
+			cells[r][c] = ws
+			width := 0.0
+			for i, w := range ws {
+				if i > 0 {
+					width += spaceWidth(ws[i-1])
+				}
+				width += w.width
+				least[c] = math.Max(least[c], w.width)
+			}
+			natural[c] = math.Max(natural[c], width)
+		}
+	}
+
+	available := p.contentWidth(ctx) - float64(cols)*2*pdfCellPadding
+	widths := make([]float64, cols)
+	totalNatural, totalLeast := sum(natural), sum(least)
+	switch {
+	case totalNatural <= available:
+		copy(widths, natural)
+	case totalLeast < available:
+		for c := range widths {
+			widths[c] = least[c] + (available-totalLeast)*(natural[c]-least[c])/(totalNatural-totalLeast)
+		}
+	default:
+		for c := range widths {
+			widths[c] = available / float64(cols)
+		}
+	}
+
+	for r := range rows {
+		lines := make([][][]word, cols)
+		height := 0.0
+		for c := range widths {
+			lines[c] = wrap(cells[r][c], math.Max(widths[c], 1))
+			height = math.Max(height, float64(len(lines[c]))*leading)
+		}
+		height += 2 * pdfCellPadding
+		p.need(height)
+		x := pdfMargin + ctx.indent
+		if r == 0 {
+			total := sum(widths) + float64(cols)*2*pdfCellPadding
+			p.rect(x, p.y, total, height, colorShade)
+		}
+		for c, width := range widths {
+			cellWidth := width + 2*pdfCellPadding
+			for i, line := range lines[c] {
+				lineX := x + pdfCellPadding
+				lineWidth := 0.0
+				for j, w := range line {
+					if j > 0 {
+						lineWidth += spaceWidth(line[j-1])
+					}
+					lineWidth += w.width
+				}
+				switch block.Align[c] {
+				case "right":
+					lineX += width - lineWidth
+				case "center":
+					lineX += (width - lineWidth) / 2
+				}
+				p.drawLine(line, lineX, p.y+pdfCellPadding+float64(i)*leading+leading*0.75, ctx.color)
+			}
+			fmt.Fprintf(p.page(), "%s RG 0.5 w %s %s %s %s re S\n", rgb(colorBorder), num(x), num(p.height-p.y-height), num(cellWidth), num(height))
+			x += cellWidth
+		}
+		p.y += height
+	}
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// write writes the pages as a PDF file
+func (p *pdf) write(w io.Writer, title string) error {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 3 are the catalog, page tree and document information,
+	// then the fonts, then each page and its content
+	fontBase := 4
+	pageBase := fontBase + len(fontNames)
+	var kids []string
+	for i := range p.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageBase+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object(fmt.Sprintf("<< /Title %s /Producer (comanda) /CreationDate (D:%s) >>", textString(title), time.Now().UTC().Format("20060102150405Z")))
+	var fonts []string
+	for i, name := range fontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fonts = append(fonts, fmt.Sprintf("/F%d %d 0 R", i+1, fontBase+i))
+	}
+	for i, page := range p.pages {
+		annots := ""
+		if len(p.annots[i]) > 0 {
+			annots = fmt.Sprintf(" /Annots [%s]", strings.Join(p.annots[i], " "))
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << %s >> >> /Contents %d 0 R%s >>",
+			num(p.width), num(p.height), strings.Join(fonts, " "), pageBase+2*i+1, annots))
+
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// escapeString escapes text for a PDF string
+func escapeString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`).Replace(s)
+}
+
+// textString returns text as a PDF text string, in UTF-16 when it isn't
+// ASCII
+func textString(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + escapeString(s) + ")"
+	}
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// num formats a number for a content stream
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func rgb(c [3]float64) string {
+	return num(c[0]) + " " + num(c[1]) + " " + num(c[2])
+}
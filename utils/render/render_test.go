@@ -0,0 +1,246 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const report = `# Quarterly *Report*
+
+Revenue grew **12%** this quarter, see [the dashboard](https://example.com/q3).
+Churn held at ` + "`2.1%`" + `.
+
+## Highlights
+
+- Closed 3 deals
+  - Acme & Co
+  - Globex
+- Hired a_b_c engineers
+
+3. Ship the API
+4. Launch ~~beta~~ GA
+
+> Best quarter yet.
+> — the CEO
+
+| Region | Revenue |
+|:-------|--------:|
+| EMEA   | $1.2M   |
+| APAC \| ANZ | $0.8M |
+
+` + "```go\nfmt.Println(\"hi\")\n```" + `
+
+---
+`
+
+func TestParse(t *testing.T) {
+	doc := Parse(report)
+	kinds := []int{Heading, Paragraph, Heading, List, List, Quote, Table, Code, Rule}
+	if len(doc.Blocks) != len(kinds) {
+		t.Fatalf("parsed %d blocks, want %d: %+v", len(doc.Blocks), len(kinds), doc.Blocks)
+	}
+	for i, kind := range kinds {
+		if doc.Blocks[i].Kind != kind {
+			t.Errorf("block %d kind = %d, want %d", i, doc.Blocks[i].Kind, kind)
+		}
+	}
+	if doc.Title() != "Quarterly Report" {
+		t.Errorf("Title() = %q", doc.Title())
+	}
+
+	para := doc.Blocks[1].Text
+	want := []Inline{
+		{Text: "Revenue grew "}, {Text: "12%", Style: Bold}, {Text: " this quarter, see "},
+		{Text: "the dashboard", Link: "https://example.com/q3"}, {Text: ". Churn held at "},
+		{Text: "2.1%", Style: Mono}, {Text: "."},
+	}
+	if len(para) != len(want) {
+		t.Fatalf("paragraph = %+v, want %+v", para, want)
+	}
+	for i := range want {
+		if para[i] != want[i] {
+			t.Errorf("inline %d = %+v, want %+v", i, para[i], want[i])
+		}
+	}
+
+	bullets := doc.Blocks[3]
+	if len(bullets.Items) != 2 || len(bullets.Items[0]) != 2 || bullets.Items[0][1].Kind != List || len(bullets.Items[0][1].Items) != 2 {
+		t.Errorf("nested list = %+v", bullets)
+	}
+	if text := PlainText(bullets.Items[1][0].Text); text != "Hired a_b_c engineers" {
+		t.Errorf("intraword underscores became emphasis: %q", text)
+	}
+	if numbered := doc.Blocks[4]; !numbered.Ordered || numbered.Start != 3 || numbered.Items[1][0].Text[1].Style != Strike {
+		t.Errorf("ordered list = %+v", numbered)
+	}
+	table := doc.Blocks[6]
+	if table.Align[0] != "left" || table.Align[1] != "right" || PlainText(table.Rows[1][0]) != "APAC | ANZ" {
+		t.Errorf("table = %+v", table)
+	}
+	if code := doc.Blocks[7]; code.Lang != "go" || code.Code != `fmt.Println("hi")` {
+		t.Errorf("code = %+v", code)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, Parse(report), Options{}); err != nil {
+		t.Fatalf("WriteHTML() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<title>Quarterly Report</title>",
+		"<h1>Quarterly <em>Report</em></h1>",
+		`<a href="https://example.com/q3">the dashboard</a>`,
+		"<li>Acme &amp; Co\n</li>",
+		`<ol start="3">`,
+		"<del>beta</del>",
+		`<td style="text-align: right">$1.2M</td>`,
+		`<pre><code class="language-go">fmt.Println(&#34;hi&#34;)`,
+		"border-collapse",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	opts := Options{Title: "Q3", CSS: "body { color: red; }", Template: "<h1>{{ .Title }}</h1><style>{{ .CSS }}</style>{{ .Body }}"}
+	if err := WriteHTML(&buf, Parse("Hi <b>"), opts); err != nil {
+		t.Fatalf("WriteHTML() error = %v", err)
+	}
+	if want := "<h1>Q3</h1><style>body { color: red; }</style><p>Hi &lt;b&gt;</p>\n"; buf.String() != want {
+		t.Errorf("templated HTML = %q, want %q", buf.String(), want)
+	}
+}
+
+// unzip returns the files of a zip archive
+func unzip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestWriteDOCX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDOCX(&buf, Parse(report), Options{}); err != nil {
+		t.Fatalf("WriteDOCX() error = %v", err)
+	}
+	files := unzip(t, buf.Bytes())
+	document := files["word/document.xml"]
+	for _, want := range []string{
+		`<w:pStyle w:val="Heading1"/>`,
+		`<w:hyperlink r:id="rId3">`,
+		`<w:ilvl w:val="1"/><w:numId w:val="2"/>`,
+		`Acme &amp; Co`,
+		`<w:pStyle w:val="Quote"/>`,
+		`<w:tblHeader/>`,
+		`<w:jc w:val="right"/>`,
+		`<w:pStyle w:val="SourceCode"/>`,
+	} {
+		if !strings.Contains(document, want) {
+			t.Errorf("document.xml missing %q", want)
+		}
+	}
+	if !strings.Contains(files["word/_rels/document.xml.rels"], `Target="https://example.com/q3" TargetMode="External"`) {
+		t.Error("link relationship missing")
+	}
+	if !strings.Contains(files["word/numbering.xml"], `<w:num w:numId="3"><w:abstractNumId w:val="1"/><w:lvlOverride w:ilvl="0"><w:startOverride w:val="3"/>`) {
+		t.Errorf("numbered list doesn't start at 3: %s", files["word/numbering.xml"])
+	}
+	if !strings.Contains(files["docProps/core.xml"], "<dc:title>Quarterly Report</dc:title>") {
+		t.Error("title missing")
+	}
+
+	// A reference document's styles replace the default ones
+	var ref bytes.Buffer
+	zw := zip.NewWriter(&ref)
+	fw, _ := zw.Create("word/styles.xml")
+	io.WriteString(fw, "<w:styles>house style</w:styles>")
+	zw.Close()
+	buf.Reset()
+	if err := WriteDOCX(&buf, Parse("# Hi"), Options{Reference: ref.Bytes()}); err != nil {
+		t.Fatalf("WriteDOCX() error = %v", err)
+	}
+	if styles := unzip(t, buf.Bytes())["word/styles.xml"]; styles != "<w:styles>house style</w:styles>" {
+		t.Errorf("styles = %q, want the reference document's", styles)
+	}
+	if err := WriteDOCX(&buf, Parse("# Hi"), Options{Reference: []byte("not a zip")}); err == nil {
+		t.Error("WriteDOCX() accepted a reference document that isn't a DOCX file")
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	// Enough text for a second page
+	markdown := report + strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit. ", 60)
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, Parse(markdown), Options{PageSize: "letter"}); err != nil {
+		t.Fatalf("WritePDF() error = %v", err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF file")
+	}
+	if !bytes.Contains(data, []byte("/Count 2 ")) || !bytes.Contains(data, []byte("/MediaBox [0 0 612 792]")) {
+		t.Error("want two letter pages")
+	}
+	if !bytes.Contains(data, []byte("/Title (Quarterly Report)")) || !bytes.Contains(data, []byte("/URI (https://example.com/q3)")) {
+		t.Error("title or link annotation missing")
+	}
+
+	// Each object is where the cross-reference table says
+	xref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)
+	start, _ := strconv.Atoi(string(xref[1]))
+	if !bytes.HasPrefix(data[start:], []byte("xref\n")) {
+		t.Fatal("startxref doesn't point at the xref table")
+	}
+	for i, m := range regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[start:], -1) {
+		offset, _ := strconv.Atoi(string(m[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj\n"; !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("object %d isn't at offset %d", i+1, offset)
+		}
+	}
+
+	var text strings.Builder
+	for _, m := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(data, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			t.Fatalf("content stream isn't compressed: %v", err)
+		}
+		content, _ := io.ReadAll(zr)
+		text.Write(content)
+	}
+	for _, want := range []string{"(Quarterly) Tj", "/F2 20 Tf", "(Best quarter yet. \x97 the CEO) Tj", "(APAC | ANZ) Tj", `(fmt.Println\("hi"\)) Tj`, "(1 / 2) Tj", "(2 / 2) Tj"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("pages missing %q", want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	ws := words([]Inline{{Text: "aaaa bbbb "}, {Text: "cccc", Style: Bold}, {Text: "dd"}}, 0, 10)
+	lines := wrap(ws, textWidth("aaaa bbbb", fontRegular, 10))
+	if len(lines) != 2 || len(lines[1]) != 1 || len(lines[1][0].pieces) != 2 {
+		t.Errorf("wrap() = %+v, want the bold word joined to the text after it on a second line", lines)
+	}
+	long := words([]Inline{{Text: strings.Repeat("x", 100)}}, 0, 10)
+	if lines := wrap(long, 100); len(lines) < 2 {
+		t.Errorf("a word wider than the line wasn't broken: %d lines", len(lines))
+	}
+}
@@ -0,0 +1,348 @@
+// Package respcache keeps model responses on disk, so a prompt sent again
+// to the same model is answered without calling the provider.
+//
+// Entries are content-addressed: each is a JSON file named after the
+// SHA-256 of the provider, model, prompt and attached file, under a
+// subdirectory named after the hash's first two characters. The cache is
+// bounded in size; when a response is saved past the limit, the least
+// recently used entries are removed. Use is tracked by the files'
+// modification times, which a hit updates, so the order survives restarts
+// and is shared by every process using the directory.
+package respcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/fileutil"
+)
+
+// DefaultMaxSize is the size the cache is kept under when none is set
+const DefaultMaxSize = 512 * 1024 * 1024
+
+// Entry is a cached response
+type Entry struct {
+	Provider string    `json:"provider"`
+	Model    string    `json:"model"`
+	Response string    `json:"response"`
+	Created  time.Time `json:"created"`
+}
+
+// Stats describes the contents of the cache
+type Stats struct {
+	Dir     string    `json:"dir"`
+	Entries int       `json:"entries"`
+	Size    int64     `json:"size"`
+	MaxSize int64     `json:"max_size"`
+	Oldest  time.Time `json:"oldest,omitempty"` // Least recently used entry
+	Newest  time.Time `json:"newest,omitempty"` // Most recently used entry
+}
+
+// Cache is an on-disk response cache. It is safe for concurrent use.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu     sync.Mutex
+	files  map[string]*file // By key, loaded from the directory on first use
+	size   int64
+	loaded bool
+}
+
+// file is an entry on disk
+type file struct {
+	path string
+	size int64
+	used time.Time
+}
+
+// opened holds the caches opened in this process by directory, so runs
+// sharing a directory share its index and size limit
+var (
+	openedMu sync.Mutex
+	opened   = make(map[string]*Cache)
+)
+
+// Open returns the cache kept in dir, limited to maxSize bytes, or
+// DefaultMaxSize when maxSize is not positive. The directory is created
+// when the first response is saved.
+func Open(dir string, maxSize int64) *Cache {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	openedMu.Lock()
+	defer openedMu.Unlock()
+	if c, ok := opened[dir]; ok {
+		c.mu.Lock()
+		c.maxSize = maxSize
+		c.mu.Unlock()
+		return c
+	}
+	c := &Cache{dir: dir, maxSize: maxSize}
+	opened[dir] = c
+	return c
+}
+
+// FromConfig opens the cache of the env config's response_cache settings.
+// It returns nil when the cache is not enabled.
+func FromConfig(env *config.EnvConfig) (*Cache, error) {
+	settings := env.ResponseCacheSettings()
+	if !settings.Enabled {
+		return nil, nil
+	}
+	return OpenSettings(settings)
+}
+
+// OpenSettings opens the cache of the given settings, enabled or not
+func OpenSettings(settings config.ResponseCacheConfig) (*Cache, error) {
+	var maxSize int64
+	if settings.MaxSize != "" {
+		size, err := fileutil.ParseSize(settings.MaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("response_cache.max_size: %w", err)
+		}
+		maxSize = size
+	}
+	return Open(settings.Dir, maxSize), nil
+}
+
+// Key returns the cache key of a request made of parts, such as the
+// provider, model and prompt. Parts are length-prefixed, so moving text
+// from one part to the next gives a different key.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		io.WriteString(h, strconv.Itoa(len(part)))
+		io.WriteString(h, ":")
+		io.WriteString(h, part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FileDigest returns the SHA-256 of a file's contents, for the key of a
+// prompt sent with a file. The file is streamed rather than read into
+// memory.
+func FileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// path returns where the entry of key is kept
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// entryKey returns the key of the entry at path, and whether path is laid
+// out like an entry, so files the cache didn't write are left alone
+func (c *Cache) entryKey(path string) (string, bool) {
+	rel, err := filepath.Rel(c.dir, path)
+	if err != nil {
+		return "", false
+	}
+	shard, name := filepath.Split(rel)
+	key := strings.TrimSuffix(name, ".json")
+	if len(key) != sha256.Size*2 || name == key || filepath.Clean(shard) != key[:2] {
+		return "", false
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// load indexes the entries on disk, once
+func (c *Cache) load() error {
+	if c.loaded {
+		return nil
+	}
+	c.files = make(map[string]*file)
+	c.size = 0
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		key, ok := c.entryKey(path)
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed by another process
+		}
+		c.files[key] = &file{path: path, size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading response cache %s: %w", c.dir, err)
+	}
+	c.loaded = true
+	return nil
+}
+
+// Get returns the cached response of key, marking it as recently used
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	if f, ok := c.files[key]; ok {
+		f.used = now
+	}
+	return entry, true
+}
+
+// Put saves the response of key, then removes the least recently used
+// entries while the cache is over its size limit
+func (c *Cache) Put(key string, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return err
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating response cache directory: %w", err)
+	}
+	// Write to a temporary file and rename it, so readers in other
+	// processes never see a partly written entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error saving response: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error saving response: %w", err)
+	}
+
+	if old, ok := c.files[key]; ok {
+		c.size -= old.size
+	}
+	c.files[key] = &file{path: path, size: int64(len(data)), used: time.Now()}
+	c.size += int64(len(data))
+	return c.evict()
+}
+
+// evict removes the least recently used entries until the cache fits
+func (c *Cache) evict() error {
+	if c.size <= c.maxSize {
+		return nil
+	}
+	keys := make([]string, 0, len(c.files))
+	for key := range c.files {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.files[keys[i]].used.Before(c.files[keys[j]].used)
+	})
+	for _, key := range keys {
+		if c.size <= c.maxSize {
+			break
+		}
+		f := c.files[key]
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error evicting cached response: %w", err)
+		}
+		c.size -= f.size
+		delete(c.files, key)
+	}
+	return nil
+}
+
+// Stats reports the entries in the cache
+func (c *Cache) Stats() (Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loaded = false // Pick up entries saved by other processes
+	if err := c.load(); err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{Dir: c.dir, Entries: len(c.files), Size: c.size, MaxSize: c.maxSize}
+	for _, f := range c.files {
+		if stats.Oldest.IsZero() || f.used.Before(stats.Oldest) {
+			stats.Oldest = f.used
+		}
+		if f.used.After(stats.Newest) {
+			stats.Newest = f.used
+		}
+	}
+	return stats, nil
+}
+
+// Clear removes every entry, and returns what the cache held. Only the
+// entry files and the subdirectories they leave empty are removed, so a
+// cache pointed at a directory holding other files doesn't delete them.
+func (c *Cache) Clear() (Stats, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	shards := make(map[string]bool)
+	for key, f := range c.files {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return Stats{}, fmt.Errorf("error clearing response cache: %w", err)
+		}
+		c.size -= f.size
+		delete(c.files, key)
+		shards[filepath.Dir(f.path)] = true
+	}
+	for shard := range shards {
+		os.Remove(shard) // Fails while it holds other files
+	}
+	os.Remove(c.dir)
+	return stats, nil
+}
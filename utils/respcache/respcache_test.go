@@ -0,0 +1,124 @@
+package respcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reopen returns the cache in dir as a new process would see it
+func reopen(dir string, maxSize int64) *Cache {
+	openedMu.Lock()
+	delete(opened, dir)
+	openedMu.Unlock()
+	return Open(dir, maxSize)
+}
+
+func TestPutGet(t *testing.T) {
+	dir := t.TempDir()
+	cache := Open(dir, 0)
+	key := Key("openai", "gpt-4o", "Summarize")
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("Get() found an entry in an empty cache")
+	}
+	if err := cache.Put(key, Entry{Provider: "openai", Model: "gpt-4o", Response: "A summary"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	// The entry survives a restart
+	entry, ok := reopen(dir, 0).Get(key)
+	if !ok || entry.Response != "A summary" {
+		t.Errorf("Get() after reopening = %+v, %v", entry, ok)
+	}
+}
+
+func TestKey(t *testing.T) {
+	if Key("ab", "c") == Key("a", "bc") {
+		t.Error("Key() is the same for different parts with the same text")
+	}
+	if Key("openai", "gpt-4o", "hi") != Key("openai", "gpt-4o", "hi") {
+		t.Error("Key() differs for the same parts")
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	response := strings.Repeat("x", 100)
+	size := int64(len(`{"provider":"","model":"","response":"","created":"0001-01-01T00:00:00Z"}`) + len(response))
+	cache := Open(dir, 3*size)
+
+	keys := []string{Key("a"), Key("b"), Key("c")}
+	for i, key := range keys {
+		if err := cache.Put(key, Entry{Response: response}); err != nil {
+			t.Fatal(err)
+		}
+		// Make the order of use unambiguous
+		used := time.Now().Add(time.Duration(i-10) * time.Minute)
+		os.Chtimes(cache.path(key), used, used)
+		cache.files[key].used = used
+	}
+	cache.Get(keys[0]) // a is now the most recently used
+
+	if err := cache.Put(Key("d"), Entry{Response: response}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(keys[1]); ok {
+		t.Error("the least recently used entry was kept")
+	}
+	for _, key := range []string{keys[0], keys[2], Key("d")} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("entry %s was evicted", key[:8])
+		}
+	}
+
+	stats, err := reopen(dir, 3*size).Stats()
+	if err != nil || stats.Entries != 3 || stats.Size > 3*size {
+		t.Errorf("Stats() = %+v, %v, want 3 entries within the limit", stats, err)
+	}
+}
+
+func TestClear(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "responses")
+	cache := Open(dir, 0)
+	stats, err := cache.Stats()
+	if err != nil || stats.Entries != 0 {
+		t.Fatalf("Stats() of a missing directory = %+v, %v", stats, err)
+	}
+	cache.Put(Key("a"), Entry{Response: "one"})
+	cache.Put(Key("b"), Entry{Response: "two"})
+
+	cleared, err := cache.Clear()
+	if err != nil || cleared.Entries != 2 {
+		t.Fatalf("Clear() = %+v, %v, want 2 entries removed", cleared, err)
+	}
+	if stats, _ := cache.Stats(); stats.Entries != 0 || stats.Size != 0 {
+		t.Errorf("Stats() after Clear() = %+v", stats)
+	}
+}
+
+func TestClearKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.json")
+	shared := filepath.Join(dir, Key("a")[:2], "settings.json")
+	os.MkdirAll(filepath.Dir(shared), 0700)
+	os.WriteFile(notes, []byte("{}"), 0644)
+	os.WriteFile(shared, []byte("{}"), 0644)
+
+	cache := Open(dir, 0)
+	cache.Put(Key("a"), Entry{Response: "one"})
+	cache.Put(Key("b"), Entry{Response: "two"})
+	cleared, err := cache.Clear()
+	if err != nil || cleared.Entries != 2 {
+		t.Fatalf("Clear() = %+v, %v, want only the 2 entries", cleared, err)
+	}
+	for _, path := range []string{notes, shared} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Clear() removed %s", path)
+		}
+	}
+	if _, err := os.Stat(filepath.Dir(cache.path(Key("b")))); !os.IsNotExist(err) {
+		t.Error("Clear() left an empty entry directory")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/kris-hansen/comanda/utils/config"
@@ -15,6 +16,22 @@ type RetryConfig struct {
 	InitialWait time.Duration // Initial wait time before first retry
 	MaxWait     time.Duration // Maximum wait time between retries
 	Factor      float64       // Exponential backoff factor
+
+	// OnRetry, if set, is told about each retry instead of it being printed
+	OnRetry func(Attempt)
+}
+
+// Attempt describes a retry that is about to happen
+type Attempt struct {
+	Attempt    int           // Number of this retry, starting at 1
+	MaxRetries int           // Retries allowed before giving up
+	Wait       time.Duration // Time waited before retrying
+	Err        error         // Error that caused the retry
+}
+
+// String formats the retry as the message printed when there is no OnRetry
+func (a Attempt) String() string {
+	return fmt.Sprintf("Rate limit detected, retrying in %v (attempt %d/%d)...", a.Wait, a.Attempt, a.MaxRetries)
 }
 
 // DefaultRetryConfig provides sensible defaults for retry operations
@@ -25,6 +42,15 @@ var DefaultRetryConfig = RetryConfig{
 	Factor:      2.0,
 }
 
+// retries counts the retries of every operation since the program started
+var retries atomic.Int64
+
+// Count returns how many times operations have been retried since the
+// program started, so callers can measure the retries made while they ran
+func Count() int64 {
+	return retries.Load()
+}
+
 // WithRetry executes the given function with retry logic
 // It will retry the function if it returns an error that matches the shouldRetry function
 func WithRetry(operation func() (interface{}, error), shouldRetry func(error) bool, config RetryConfig) (interface{}, error) {
@@ -58,11 +84,17 @@ func WithRetry(operation func() (interface{}, error), shouldRetry func(error) bo
 		config.DebugLog("Received retryable error: %v. Retrying in %v (attempt %d/%d)",
 			err, retryWait, attempt+1, config.MaxRetries)
 
-		// Also print a brief message in non-debug mode
-		fmt.Printf("Rate limit detected, retrying in %v (attempt %d/%d)...\n",
-			retryWait, attempt+1, config.MaxRetries)
+		// Report the retry, printing a brief message unless the caller
+		// shows retries itself
+		next := Attempt{Attempt: attempt + 1, MaxRetries: config.MaxRetries, Wait: retryWait, Err: err}
+		if config.OnRetry != nil {
+			config.OnRetry(next)
+		} else {
+			fmt.Println(next)
+		}
 
 		// Wait before next retry
+		retries.Add(1)
 		time.Sleep(retryWait)
 
 		// Increase wait time for next iteration
@@ -0,0 +1,179 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathEscape is returned when a path resolves outside the sandbox root
+var ErrPathEscape = errors.New("path escapes sandbox")
+
+// Sandbox confines file reads and writes to a root directory. Absolute paths
+// are only accepted when they fall under the root or an allow-listed prefix,
+// and symlinks are resolved so they cannot be used to step outside either.
+type Sandbox struct {
+	root        string   // Absolute, cleaned root directory
+	realRoot    string   // Root with symlinks resolved
+	allowed     []string // Absolute allow-listed prefixes
+	realAllowed []string // Allow-listed prefixes with symlinks resolved
+}
+
+// New creates a sandbox rooted at root. allowedPaths lists absolute paths
+// (files or directories) outside the root that may still be accessed.
+func New(root string, allowedPaths []string) (*Sandbox, error) {
+	if root == "" {
+		return nil, fmt.Errorf("sandbox root is required")
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sandbox root %s: %w", root, err)
+	}
+
+	s := &Sandbox{
+		root:     absRoot,
+		realRoot: evalExisting(absRoot),
+	}
+
+	for _, allowed := range allowedPaths {
+		if allowed == "" {
+			continue
+		}
+		if !filepath.IsAbs(allowed) {
+			return nil, fmt.Errorf("allowed path %s must be absolute", allowed)
+		}
+		cleaned := filepath.Clean(allowed)
+		s.allowed = append(s.allowed, cleaned)
+		s.realAllowed = append(s.realAllowed, evalExisting(cleaned))
+	}
+
+	return s, nil
+}
+
+// Root returns the absolute sandbox root
+func (s *Sandbox) Root() string {
+	return s.root
+}
+
+// Resolve maps path to an absolute location confined to the sandbox.
+// Relative paths are joined with the root; absolute paths must lie under the
+// root or an allow-listed prefix. Every symlink on the way, including one
+// whose target does not exist yet, is resolved and the result must stay
+// within the same boundary.
+func (s *Sandbox) Resolve(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("empty path")
+	}
+
+	var target string
+	if filepath.IsAbs(path) {
+		target = filepath.Clean(path)
+		if !within(target, s.root) && !withinAny(target, s.allowed) {
+			return "", fmt.Errorf("absolute path %s is not allowed: %w", path, ErrPathEscape)
+		}
+	} else {
+		target = filepath.Join(s.root, path)
+		if !within(target, s.root) {
+			return "", fmt.Errorf("path %s attempts directory traversal: %w", path, ErrPathEscape)
+		}
+	}
+
+	real, err := resolveLinks(target)
+	if err != nil {
+		return "", fmt.Errorf("error resolving path %s: %w", path, err)
+	}
+	if !within(real, s.realRoot) && !withinAny(real, s.realAllowed) {
+		return "", fmt.Errorf("path %s resolves through a symlink to %s: %w", path, real, ErrPathEscape)
+	}
+
+	return target, nil
+}
+
+// within reports whether path is base or lies beneath it
+func within(path, base string) bool {
+	if path == base {
+		return true
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// withinAny reports whether path lies under any of the given bases
+func withinAny(path string, bases []string) bool {
+	for _, base := range bases {
+		if within(path, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxLinks bounds the symlinks followed while resolving one path, as the
+// kernel does, so link cycles fail instead of looping
+const maxLinks = 40
+
+// evalExisting resolves symlinks in path component by component and
+// re-appends the components that do not exist yet. A symlink whose target
+// does not exist is still followed, so a dangling link resolves to where a
+// write through it would land. Paths that can't be resolved are returned
+// unchanged.
+func evalExisting(path string) string {
+	resolved, err := resolveLinks(path)
+	if err != nil {
+		return path
+	}
+	return resolved
+}
+
+// resolveLinks returns path with every symlink among its existing
+// components replaced by its target
+func resolveLinks(path string) (string, error) {
+	volume := filepath.VolumeName(path)
+	pending := strings.Split(filepath.Clean(path[len(volume):]), string(os.PathSeparator))
+	resolved := volume + string(os.PathSeparator)
+	links := 0
+	for len(pending) > 0 {
+		part := pending[0]
+		pending = pending[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		info, err := os.Lstat(next)
+		if os.IsNotExist(err) {
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("too many symlinks in %s", path)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			volume = filepath.VolumeName(target)
+			resolved = volume + string(os.PathSeparator)
+			target = target[len(volume):]
+		}
+		pending = append(strings.Split(filepath.Clean(target), string(os.PathSeparator)), pending...)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,108 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	allowedDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "inner")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dangling links, whose targets a write would create
+	links := map[string]string{
+		"dangling":          filepath.Join(outside, "missing", "x"),
+		"dangling-relative": filepath.Join("..", filepath.Base(outside), "y"),
+		"dangling-inside":   filepath.Join("sub", "later.txt"),
+		"dangling-chain":    "dangling",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sb, err := New(root, []string{allowedDir})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		want      string
+		expectErr bool
+	}{
+		{name: "relative file", path: "file.txt", want: filepath.Join(root, "file.txt")},
+		{name: "nested new file", path: "sub/new/file.txt", want: filepath.Join(root, "sub/new/file.txt")},
+		{name: "dot segments inside root", path: "sub/../file.txt", want: filepath.Join(root, "file.txt")},
+		{name: "parent traversal", path: "../file.txt", expectErr: true},
+		{name: "deep traversal", path: "sub/../../file.txt", expectErr: true},
+		{name: "absolute inside root", path: filepath.Join(root, "file.txt"), want: filepath.Join(root, "file.txt")},
+		{name: "absolute outside root", path: filepath.Join(outside, "file.txt"), expectErr: true},
+		{name: "absolute allow-listed", path: filepath.Join(allowedDir, "file.txt"), want: filepath.Join(allowedDir, "file.txt")},
+		{name: "symlink escape", path: "escape/file.txt", expectErr: true},
+		{name: "symlink inside root", path: "inner/file.txt", want: filepath.Join(root, "inner/file.txt")},
+		{name: "dangling symlink escape", path: "dangling", expectErr: true},
+		{name: "dangling relative symlink escape", path: "dangling-relative", expectErr: true},
+		{name: "chained dangling symlink escape", path: "dangling-chain", expectErr: true},
+		{name: "dangling symlink inside root", path: "dangling-inside", want: filepath.Join(root, "dangling-inside")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sb.Resolve(tt.path)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Resolve(%q) = %q, expected error", tt.path, got)
+				}
+				if !errors.Is(err, ErrPathEscape) {
+					t.Errorf("Resolve(%q) error = %v, expected ErrPathEscape", tt.path, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) unexpected error: %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsRelativeAllowedPath(t *testing.T) {
+	if _, err := New(t.TempDir(), []string{"relative/path"}); err == nil {
+		t.Error("New() expected error for relative allowed path")
+	}
+}
+
+func TestResolveSymlinkCycle(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink("b", filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(root, "b")); err != nil {
+		t.Fatal(err)
+	}
+	sb, err := New(root, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, err := sb.Resolve("a/file.txt"); err == nil {
+		t.Errorf("Resolve() = %q, expected an error for a symlink cycle", got)
+	}
+}
@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// Wednesday
+	from := time.Date(2025, 1, 15, 10, 30, 45, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"0 7 * * *", time.Date(2025, 1, 16, 7, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2025, 1, 15, 10, 40, 0, 0, time.UTC)},
+		{"15,45 9-17 * * *", time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2025, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2025, 1, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * fri", time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)}, // Either day field matches
+		{"30 4 29 feb *", time.Date(2028, 2, 29, 4, 30, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"5/30 * * * *", time.Date(2025, 1, 15, 10, 35, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("ParseCron(%q).Next() = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *", "* * * * funday"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q): expected an error", expr)
+		}
+	}
+}
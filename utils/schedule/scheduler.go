@@ -0,0 +1,299 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Job runs a workflow on a cron schedule
+type Job struct {
+	ID           string    `json:"id"`
+	Cron         string    `json:"cron"`
+	Workflow     string    `json:"workflow"` // Absolute path of the workflow file
+	Dir          string    `json:"dir"`      // Working directory the workflow runs in
+	Jitter       string    `json:"jitter,omitempty"`
+	AllowOverlap bool      `json:"allow_overlap,omitempty"`
+	Created      time.Time `json:"created"`
+}
+
+// JitterDuration returns the job's maximum random start delay
+func (j Job) JitterDuration() time.Duration {
+	d, _ := time.ParseDuration(j.Jitter)
+	return d
+}
+
+// Validate checks the job's cron expression and jitter
+func (j Job) Validate() error {
+	if _, err := ParseCron(j.Cron); err != nil {
+		return err
+	}
+	if j.Jitter != "" {
+		if d, err := time.ParseDuration(j.Jitter); err != nil || d < 0 {
+			return fmt.Errorf("invalid jitter '%s' (use e.g. 30s or 5m)", j.Jitter)
+		}
+	}
+	return nil
+}
+
+// DefaultPath returns the schedule file: COMANDA_SCHEDULE_FILE if set,
+// otherwise schedules.json in the data directory, moved there from
+// ~/.comanda the first time
+func DefaultPath() string {
+	if path := os.Getenv("COMANDA_SCHEDULE_FILE"); path != "" {
+		return path
+	}
+	return config.MigrateLegacy("schedules.json", filepath.Join(config.DataDir(), "schedules.json"))
+}
+
+// Load reads the jobs in a schedule file; a missing file has no jobs
+func Load(path string) ([]Job, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading schedule file: %w", err)
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("error parsing schedule file %s: %w", path, err)
+	}
+	return jobs, nil
+}
+
+// Save writes jobs to a schedule file
+func Save(path string, jobs []Job) error {
+	if jobs == nil {
+		jobs = []Job{}
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding schedule: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create schedule directory: %w", err)
+	}
+	// Write then rename so a running scheduler never reads a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing schedule file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// jobIDChars matches characters not allowed in job IDs
+var jobIDChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Add validates a job and appends it to the schedule file. An empty ID is
+// derived from the workflow file name.
+func Add(path string, job Job) (Job, error) {
+	if err := job.Validate(); err != nil {
+		return job, err
+	}
+	jobs, err := Load(path)
+	if err != nil {
+		return job, err
+	}
+	taken := make(map[string]bool)
+	for _, j := range jobs {
+		taken[j.ID] = true
+	}
+	if job.ID == "" {
+		base := filepath.Base(job.Workflow)
+		base = jobIDChars.ReplaceAllString(base[:len(base)-len(filepath.Ext(base))], "-")
+		job.ID = base
+		for n := 2; taken[job.ID]; n++ {
+			job.ID = fmt.Sprintf("%s-%d", base, n)
+		}
+	} else if taken[job.ID] {
+		return job, fmt.Errorf("a scheduled job named '%s' already exists", job.ID)
+	}
+	if job.Created.IsZero() {
+		job.Created = time.Now()
+	}
+	return job, Save(path, append(jobs, job))
+}
+
+// Remove deletes a job from the schedule file
+func Remove(path, id string) error {
+	jobs, err := Load(path)
+	if err != nil {
+		return err
+	}
+	for i, j := range jobs {
+		if j.ID == id {
+			return Save(path, append(jobs[:i], jobs[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no scheduled job named '%s'", id)
+}
+
+// pollInterval is how often the scheduler checks the schedule file for changes
+const pollInterval = 30 * time.Second
+
+// jobState tracks when a job next runs and whether it is running
+type jobState struct {
+	job     Job
+	cron    *Cron
+	due     time.Time // Scheduled time, before jitter
+	start   time.Time // due plus jitter
+	running bool
+}
+
+// Scheduler runs the jobs in a schedule file until its context ends. The
+// file is re-read when it changes, so jobs can be added while it runs.
+type Scheduler struct {
+	Path string
+	Run  func(job Job) error // Runs a job's workflow
+	Logf func(format string, args ...interface{})
+
+	mu      sync.Mutex
+	jobs    map[string]*jobState
+	modTime time.Time
+	wg      sync.WaitGroup
+	jitter  func(max time.Duration) time.Duration
+}
+
+// Start runs the scheduler until ctx is done, then waits for running jobs
+func (s *Scheduler) Start(ctx context.Context) error {
+	if s.jitter == nil {
+		s.jitter = func(max time.Duration) time.Duration {
+			if max <= 0 {
+				return 0
+			}
+			return time.Duration(rand.Int63n(int64(max)))
+		}
+	}
+	defer s.wg.Wait()
+	for {
+		if err := s.reload(time.Now()); err != nil {
+			s.logf("Error loading schedule: %v", err)
+		}
+		s.tick(time.Now())
+
+		wait := time.Until(s.nextStart())
+		if wait > pollInterval {
+			wait = pollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reload re-reads the schedule file if it changed, keeping the state of
+// jobs whose schedule is unchanged
+func (s *Scheduler) reload(now time.Time) error {
+	info, err := os.Stat(s.Path)
+	var modTime time.Time
+	if err == nil {
+		modTime = info.ModTime()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobs != nil && modTime.Equal(s.modTime) {
+		return nil
+	}
+	jobs, err := Load(s.Path)
+	if err != nil {
+		return err
+	}
+	s.modTime = modTime
+
+	previous := s.jobs
+	s.jobs = make(map[string]*jobState)
+	for _, job := range jobs {
+		if old, ok := previous[job.ID]; ok && old.job == job {
+			s.jobs[job.ID] = old
+			continue
+		}
+		cron, err := ParseCron(job.Cron)
+		if err != nil {
+			s.logf("Skipping job %s: %v", job.ID, err)
+			continue
+		}
+		state := &jobState{job: job, cron: cron}
+		s.schedule(state, now)
+		s.jobs[job.ID] = state
+		s.logf("Scheduled %s (%s) next at %s", job.ID, job.Cron, state.start.Format(time.RFC1123))
+	}
+	return nil
+}
+
+// schedule sets a job's next run after now
+func (s *Scheduler) schedule(state *jobState, now time.Time) {
+	state.due = state.cron.Next(now)
+	state.start = state.due
+	if !state.due.IsZero() {
+		state.start = state.due.Add(s.jitter(state.job.JitterDuration()))
+	}
+}
+
+// tick starts every job whose start time has passed
+func (s *Scheduler) tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, state := range s.jobs {
+		if state.start.IsZero() || now.Before(state.start) {
+			continue
+		}
+		due := state.due
+		s.schedule(state, now)
+		if state.running && !state.job.AllowOverlap {
+			s.logf("Skipping %s run due at %s: the previous run is still running", state.job.ID, due.Format(time.Kitchen))
+			continue
+		}
+		state.running = true
+		s.wg.Add(1)
+		go s.runJob(state)
+	}
+}
+
+// runJob runs one job and marks it finished
+func (s *Scheduler) runJob(state *jobState) {
+	defer s.wg.Done()
+	s.logf("Running %s: %s", state.job.ID, state.job.Workflow)
+	err := s.Run(state.job)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state.running = false
+	if err != nil {
+		s.logf("Run of %s failed: %v", state.job.ID, err)
+	} else {
+		s.logf("Run of %s succeeded", state.job.ID)
+	}
+}
+
+// nextStart returns the earliest upcoming start time, or the poll time
+func (s *Scheduler) nextStart() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := time.Now().Add(pollInterval)
+	for _, state := range s.jobs {
+		if !state.start.IsZero() && state.start.Before(next) {
+			next = state.start
+		}
+	}
+	return next
+}
+
+func (s *Scheduler) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
@@ -0,0 +1,80 @@
+package schedule
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	first, err := Add(path, Job{Cron: "0 7 * * *", Workflow: "/flows/daily digest.yaml"})
+	if err != nil || first.ID != "daily-digest" {
+		t.Fatalf("Add() = %+v, %v", first, err)
+	}
+	second, err := Add(path, Job{Cron: "@hourly", Workflow: "/other/daily digest.yaml", Jitter: "5m"})
+	if err != nil || second.ID != "daily-digest-2" {
+		t.Fatalf("Add() second = %+v, %v", second, err)
+	}
+	if _, err := Add(path, Job{ID: "daily-digest", Cron: "@daily", Workflow: "/x.yaml"}); err == nil {
+		t.Error("Add() with a taken ID: expected an error")
+	}
+	if _, err := Add(path, Job{Cron: "@daily", Workflow: "/x.yaml", Jitter: "soon"}); err == nil {
+		t.Error("Add() with bad jitter: expected an error")
+	}
+
+	if err := Remove(path, "daily-digest"); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := Load(path)
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "daily-digest-2" || jobs[0].JitterDuration() != 5*time.Minute {
+		t.Fatalf("Load() = %+v, %v", jobs, err)
+	}
+	if err := Remove(path, "missing"); err == nil {
+		t.Error("Remove() of a missing job: expected an error")
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	Add(path, Job{ID: "slow", Cron: "* * * * *", Workflow: "/slow.yaml"})
+	Add(path, Job{ID: "overlap", Cron: "* * * * *", Workflow: "/overlap.yaml", AllowOverlap: true, Jitter: "30s"})
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	runs := make(map[string]int)
+	s := &Scheduler{
+		Path:   path,
+		jitter: func(max time.Duration) time.Duration { return max / 2 },
+		Run: func(job Job) error {
+			mu.Lock()
+			runs[job.ID]++
+			mu.Unlock()
+			<-release
+			return nil
+		},
+	}
+
+	now := time.Date(2025, 1, 15, 10, 0, 10, 0, time.Local)
+	if err := s.reload(now); err != nil {
+		t.Fatal(err)
+	}
+	if start := s.jobs["overlap"].start; !start.Equal(time.Date(2025, 1, 15, 10, 1, 15, 0, time.Local)) {
+		t.Errorf("jittered start = %v", start)
+	}
+
+	s.tick(now.Add(time.Minute))      // slow starts; overlap waits for its jitter
+	s.tick(now.Add(65 * time.Second)) // overlap starts
+	s.tick(now.Add(2 * time.Minute))  // slow is still running and is skipped
+	s.tick(now.Add(125 * time.Second))
+	close(release)
+	s.wg.Wait()
+
+	if runs["slow"] != 1 || runs["overlap"] != 2 {
+		t.Errorf("runs = %v, want slow 1 and overlap 2", runs)
+	}
+	if s.jobs["slow"].running {
+		t.Error("slow is still marked running")
+	}
+}
@@ -0,0 +1,183 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// awsCredentials sign requests to AWS
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// awsSecrets reads secrets from AWS Secrets Manager. The path of a
+// reference is the secret's name or ARN.
+type awsSecrets struct {
+	region   string
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newAWSSecrets(c *config.AWSSecretsConfig) *awsSecrets {
+	a := &awsSecrets{
+		region: os.Getenv("AWS_REGION"),
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+	if a.region == "" {
+		a.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c != nil {
+		if c.Region != "" {
+			a.region = c.Region
+		}
+		a.endpoint = c.Endpoint
+	}
+	return a
+}
+
+func (a *awsSecrets) Fetch(ctx context.Context, path string) (*Secret, error) {
+	// An ARN names its region, which wins over the configured one
+	region := a.region
+	if strings.HasPrefix(path, "arn:") {
+		if parts := strings.Split(path, ":"); len(parts) > 3 && parts[3] != "" {
+			region = parts[3]
+		}
+	}
+	if region == "" {
+		return nil, errors.New("no AWS region: set AWS_REGION or secrets.aws.region")
+	}
+	creds := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return nil, errors.New("no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	endpoint := a.endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": path})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signV4(req, body, creds, region, "secretsmanager", a.now())
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var resp struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+		Type         string `json:"__type"`
+		Message      string `json:"message"` // Also matches the Message of some errors
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&resp); err != nil && res.StatusCode < 300 {
+		return nil, fmt.Errorf("error decoding the AWS response: %w", err)
+	}
+	if res.StatusCode >= 300 {
+		if i := strings.LastIndex(resp.Type, "#"); i >= 0 {
+			resp.Type = resp.Type[i+1:]
+		}
+		return nil, fmt.Errorf("AWS Secrets Manager returned %s: %s %s", res.Status, resp.Type, resp.Message)
+	}
+	if resp.SecretString == "" {
+		return &Secret{Value: string(resp.SecretBinary)}, nil
+	}
+	return &Secret{Value: resp.SecretString}, nil
+}
+
+// signV4 signs req with AWS Signature Version 4
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,175 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// azureVaultResource is the resource Key Vault tokens are issued for
+const azureVaultResource = "https://vault.azure.net"
+
+// azureKeyVault reads secrets from Azure Key Vault. The path of a reference
+// is vault/secret[/version], where vault is the vault's name or, outside
+// the public cloud, its host.
+type azureKeyVault struct {
+	tenantID string
+	clientID string
+	client   *http.Client
+
+	loginURL string // Microsoft Entra ID, for service principals
+	imdsURL  string // Instance metadata service, for managed identities
+	vaultURL string // Format of a vault's URL given its name
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newAzureKeyVault(c *config.AzureKeyVaultConfig) *azureKeyVault {
+	a := &azureKeyVault{
+		tenantID: os.Getenv("AZURE_TENANT_ID"),
+		clientID: os.Getenv("AZURE_CLIENT_ID"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		loginURL: "https://login.microsoftonline.com",
+		imdsURL:  "http://169.254.169.254/metadata/identity/oauth2/token",
+		vaultURL: "https://%s.vault.azure.net",
+	}
+	if c != nil {
+		if c.TenantID != "" {
+			a.tenantID = c.TenantID
+		}
+		if c.ClientID != "" {
+			a.clientID = c.ClientID
+		}
+	}
+	return a
+}
+
+func (a *azureKeyVault) Fetch(ctx context.Context, path string) (*Secret, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("'%s' is not a secret (expected vault/secret[/version])", path)
+	}
+	base := fmt.Sprintf(a.vaultURL, parts[0])
+	if strings.Contains(parts[0], ".") {
+		base = "https://" + parts[0]
+	}
+	token, err := a.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/secrets/"+strings.Join(parts[1:], "/")+"?api-version=7.4", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var resp struct {
+		Value string `json:"value"`
+	}
+	if err := a.do(req, &resp); err != nil {
+		return nil, err
+	}
+	return &Secret{Value: resp.Value}, nil
+}
+
+// accessToken returns a token for Key Vault, as the service principal
+// whose secret is in AZURE_CLIENT_SECRET or else as the machine's managed
+// identity, reusing it until shortly before it expires
+func (a *azureKeyVault) accessToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expires) {
+		return a.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	if secret := os.Getenv("AZURE_CLIENT_SECRET"); secret != "" {
+		if a.tenantID == "" || a.clientID == "" {
+			return "", errors.New("AZURE_CLIENT_SECRET needs a tenant and client ID: set AZURE_TENANT_ID and AZURE_CLIENT_ID or secrets.azure")
+		}
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {a.clientID},
+			"client_secret": {secret},
+			"scope":         {azureVaultResource + "/.default"},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, a.loginURL+"/"+url.PathEscape(a.tenantID)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureVaultResource}}
+		if a.clientID != "" {
+			query.Set("client_id", a.clientID)
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, a.imdsURL+"?"+query.Encode(), nil)
+		if err == nil {
+			req.Header.Set("Metadata", "true")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		AccessToken string          `json:"access_token"`
+		ExpiresIn   json.RawMessage `json:"expires_in"` // A number, or a string from the metadata service
+	}
+	if err := a.do(req, &resp); err != nil {
+		return "", fmt.Errorf("error getting an Azure token: %w", err)
+	}
+	seconds, _ := strconv.Atoi(strings.Trim(string(resp.ExpiresIn), `"`))
+	a.token = resp.AccessToken
+	a.expires = time.Now().Add(time.Duration(seconds)*time.Second - time.Minute)
+	config.DebugLog("Got an Azure token for Key Vault lasting %ds", seconds)
+	return a.token, nil
+}
+
+// do sends a request to Azure and decodes its response into out
+func (a *azureKeyVault) do(req *http.Request, out interface{}) error {
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		var failure struct {
+			Error            json.RawMessage `json:"error"`
+			ErrorDescription string          `json:"error_description"`
+		}
+		json.Unmarshal(data, &failure)
+		var nested struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		switch {
+		case json.Unmarshal(failure.Error, &nested) == nil && nested.Message != "":
+			return fmt.Errorf("azure returned %s: %s %s", res.Status, nested.Code, nested.Message)
+		case failure.ErrorDescription != "":
+			return fmt.Errorf("azure returned %s: %s", res.Status, failure.ErrorDescription)
+		}
+		return fmt.Errorf("azure returned %s", res.Status)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error decoding the azure response: %w", err)
+	}
+	return nil
+}
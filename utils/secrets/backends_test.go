@@ -0,0 +1,224 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVault(t *testing.T) {
+	var renewed string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root-token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/comanda":
+			w.Write([]byte(`{"data":{"data":{"openai":"sk-from-vault"},"metadata":{"version":3}}}`))
+		case "/v1/database/creds/app":
+			w.Write([]byte(`{"lease_id":"database/creds/app/abc","lease_duration":3600,"renewable":true,"data":{"username":"v-app","password":"pw"}}`))
+		case "/v1/sys/leases/renew":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			renewed = body["lease_id"]
+			w.Write([]byte(`{"lease_id":"database/creds/app/abc","lease_duration":1800,"renewable":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("VAULT_TOKEN", "root-token")
+	v := newVault(&config.VaultConfig{Address: srv.URL, Namespace: "team"})
+	ctx := context.Background()
+
+	secret, err := v.Fetch(ctx, "secret/data/comanda")
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{"openai": "sk-from-vault"}, secret.Fields)
+		assert.False(t, secret.Renewable)
+	}
+
+	secret, err = v.Fetch(ctx, "database/creds/app")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "pw", secret.Fields["password"])
+		assert.Equal(t, time.Hour, secret.TTL)
+		assert.True(t, secret.Renewable)
+		ttl, err := v.Renew(ctx, secret)
+		assert.NoError(t, err)
+		assert.Equal(t, 30*time.Minute, ttl)
+		assert.Equal(t, "database/creds/app/abc", renewed)
+	}
+
+	_, err = v.Fetch(ctx, "secret/data/missing")
+	assert.ErrorContains(t, err, "vault returned 404")
+	t.Setenv("VAULT_TOKEN", "wrong")
+	_, err = v.Fetch(ctx, "secret/data/comanda")
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestAWSSecrets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body["SecretId"] != "prod/comanda" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException","Message":"Secrets Manager can't find the specified secret."}`))
+			return
+		}
+		w.Write([]byte(`{"Name":"prod/comanda","SecretString":"{\"openai\":\"sk-from-aws\"}"}`))
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	a := newAWSSecrets(&config.AWSSecretsConfig{Region: "eu-west-1", Endpoint: srv.URL})
+	ctx := context.Background()
+
+	secret, err := a.Fetch(ctx, "prod/comanda")
+	if assert.NoError(t, err) {
+		value, err := pick(secret, "openai")
+		assert.NoError(t, err)
+		assert.Equal(t, "sk-from-aws", value)
+	}
+	_, err = a.Fetch(ctx, "prod/other")
+	assert.ErrorContains(t, err, "ResourceNotFoundException Secrets Manager can't find the specified secret.")
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	_, err = a.Fetch(ctx, "prod/comanda")
+	assert.ErrorContains(t, err, "no AWS credentials")
+}
+
+func TestGCPSecrets(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if !strings.HasPrefix(r.URL.Path, "/v1/projects/acme/secrets/openai/") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"message":"Secret not found","status":"NOT_FOUND"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":    "projects/acme/secrets/openai/versions/2",
+			"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("sk-from-gcp"))},
+		})
+	}))
+	defer srv.Close()
+	g := newGCPSecrets(&config.GCPSecretsConfig{Project: "acme"})
+	g.opts = []option.ClientOption{option.WithEndpoint(srv.URL), option.WithoutAuthentication()}
+	ctx := context.Background()
+
+	for _, path := range []string{"openai", "acme/openai/2", "projects/acme/secrets/openai"} {
+		secret, err := g.Fetch(ctx, path)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, "sk-from-gcp", secret.Value)
+		}
+	}
+	assert.Equal(t, []string{
+		"/v1/projects/acme/secrets/openai/versions/latest:access",
+		"/v1/projects/acme/secrets/openai/versions/2:access",
+		"/v1/projects/acme/secrets/openai/versions/latest:access",
+	}, requested)
+
+	_, err := g.Fetch(ctx, "other")
+	assert.ErrorContains(t, err, "Secret not found")
+	g.project = ""
+	_, err = g.Fetch(ctx, "openai")
+	assert.ErrorContains(t, err, "names no project")
+}
+
+func TestAzureKeyVault(t *testing.T) {
+	tokens := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/tenant-1/oauth2/v2.0/token":
+			r.ParseForm()
+			if r.PostForm.Get("client_secret") != "sp-secret" || r.PostForm.Get("scope") != "https://vault.azure.net/.default" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"invalid_client","error_description":"bad client secret"}`))
+				return
+			}
+			tokens++
+			w.Write([]byte(`{"access_token":"sp-token","expires_in":3599}`))
+		case r.URL.Path == "/imds":
+			if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != "https://vault.azure.net" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tokens++
+			w.Write([]byte(`{"access_token":"mi-token","expires_in":"3599"}`))
+		case strings.HasPrefix(r.URL.Path, "/acme-kv/secrets/"):
+			if auth := r.Header.Get("Authorization"); auth != "Bearer sp-token" && auth != "Bearer mi-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("api-version") == "" || r.URL.Path != "/acme-kv/secrets/openai/v1" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"code":"SecretNotFound","message":"A secret with (name/id) other was not found"}}`))
+				return
+			}
+			io.WriteString(w, `{"value":"sk-from-azure","id":"https://acme-kv.vault.azure.net/secrets/openai/v1"}`)
+		}
+	}))
+	defer srv.Close()
+	newBackend := func() *azureKeyVault {
+		a := newAzureKeyVault(&config.AzureKeyVaultConfig{TenantID: "tenant-1", ClientID: "client-1"})
+		a.loginURL, a.imdsURL, a.vaultURL = srv.URL, srv.URL+"/imds", srv.URL+"/%s"
+		return a
+	}
+	ctx := context.Background()
+
+	// As a service principal
+	t.Setenv("AZURE_CLIENT_SECRET", "sp-secret")
+	a := newBackend()
+	for i := 0; i < 2; i++ {
+		secret, err := a.Fetch(ctx, "acme-kv/openai/v1")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "sk-from-azure", secret.Value)
+		}
+	}
+	assert.Equal(t, 1, tokens, "the token is reused")
+	_, err := a.Fetch(ctx, "acme-kv/other")
+	assert.ErrorContains(t, err, "SecretNotFound")
+	_, err = a.Fetch(ctx, "openai")
+	assert.ErrorContains(t, err, "expected vault/secret[/version]")
+
+	// As a managed identity
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	secret, err := newBackend().Fetch(ctx, "acme-kv/openai/v1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "sk-from-azure", secret.Value)
+	}
+
+	t.Setenv("AZURE_CLIENT_SECRET", "wrong")
+	_, err = newBackend().Fetch(ctx, "acme-kv/openai/v1")
+	assert.ErrorContains(t, err, "bad client secret")
+}
@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// gcpSecrets reads secrets from Google Secret Manager with the application
+// default credentials. The path of a reference is a secret version's
+// resource name, project/secret[/version], or a secret of the configured
+// project; versions default to latest.
+type gcpSecrets struct {
+	project string
+	opts    []option.ClientOption
+
+	once    sync.Once
+	service *secretmanager.Service
+	err     error
+}
+
+func newGCPSecrets(c *config.GCPSecretsConfig) *gcpSecrets {
+	g := &gcpSecrets{project: os.Getenv("GOOGLE_CLOUD_PROJECT")}
+	if c != nil {
+		if c.Project != "" {
+			g.project = c.Project
+		}
+		if c.CredentialsFile != "" {
+			g.opts = append(g.opts, option.WithCredentialsFile(c.CredentialsFile))
+		}
+	}
+	return g
+}
+
+func (g *gcpSecrets) Fetch(ctx context.Context, path string) (*Secret, error) {
+	name, err := g.versionName(path)
+	if err != nil {
+		return nil, err
+	}
+	// The service outlives the context of the first fetch
+	g.once.Do(func() {
+		g.service, g.err = secretmanager.NewService(context.Background(), g.opts...)
+	})
+	if g.err != nil {
+		return nil, fmt.Errorf("error connecting to Secret Manager: %w", g.err)
+	}
+	resp, err := g.service.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Payload == nil {
+		return nil, fmt.Errorf("%s has no payload", name)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the payload of %s: %w", name, err)
+	}
+	return &Secret{Value: string(data)}, nil
+}
+
+// versionName returns the resource name of the secret version path names
+func (g *gcpSecrets) versionName(path string) (string, error) {
+	if strings.HasPrefix(path, "projects/") {
+		if strings.Contains(path, "/versions/") {
+			return path, nil
+		}
+		return path + "/versions/latest", nil
+	}
+	parts := strings.Split(path, "/")
+	switch len(parts) {
+	case 1:
+		if g.project == "" {
+			return "", fmt.Errorf("secret '%s' names no project: set GOOGLE_CLOUD_PROJECT or secrets.gcp.project", path)
+		}
+		return fmt.Sprintf("projects/%s/secrets/%s/versions/latest", g.project, parts[0]), nil
+	case 2:
+		return fmt.Sprintf("projects/%s/secrets/%s/versions/latest", parts[0], parts[1]), nil
+	case 3:
+		return fmt.Sprintf("projects/%s/secrets/%s/versions/%s", parts[0], parts[1], parts[2]), nil
+	}
+	return "", fmt.Errorf("'%s' is not a secret (expected [project/]secret[/version])", path)
+}
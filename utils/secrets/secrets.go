@@ -0,0 +1,294 @@
+// Package secrets resolves references such as
+// vault://secret/data/comanda#openai to the secrets they name in HashiCorp
+// Vault, AWS Secrets Manager, Google Secret Manager or Azure Key Vault,
+// caching them and renewing their leases.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// maintainInterval is how often Run renews leases and drops expired secrets
+const maintainInterval = 30 * time.Second
+
+// Secret is a secret fetched from a secret manager
+type Secret struct {
+	Value     string            // The secret, when it is a single value
+	Fields    map[string]string // The values of a secret that holds several
+	TTL       time.Duration     // How long the secret stays valid, zero when its manager doesn't say
+	LeaseID   string            // Lease to renew to keep the secret valid
+	Renewable bool
+}
+
+// Backend fetches secrets from one secret manager
+type Backend interface {
+	// Fetch returns the secret at path, the part of a reference between the
+	// scheme and the field
+	Fetch(ctx context.Context, path string) (*Secret, error)
+}
+
+// Renewer is a backend whose secrets have leases that can be renewed
+type Renewer interface {
+	// Renew extends the secret's lease and returns how long it now lasts
+	Renew(ctx context.Context, secret *Secret) (time.Duration, error)
+}
+
+// Keeper is a backend whose own credentials expire unless they are renewed
+type Keeper interface {
+	// KeepAlive renews the backend's credentials until ctx is done
+	KeepAlive(ctx context.Context) error
+}
+
+// cached is a fetched secret and when it stops being reused
+type cached struct {
+	scheme  string
+	secret  *Secret
+	expires time.Time
+	renewAt time.Time // Zero unless the secret's lease is renewed
+}
+
+// Resolver resolves references to secrets through the backend of their
+// scheme. It is safe for concurrent use.
+type Resolver struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	backends map[string]Backend
+	cache    map[string]*cached // By reference without its field
+	used     map[string]bool    // Schemes resolved through
+	kept     map[string]bool    // Schemes whose credentials Run keeps alive
+}
+
+// New returns a resolver using the backends the settings configure, or
+// their environment defaults
+func New(settings config.SecretsConfig) *Resolver {
+	r := &Resolver{
+		ttl:      settings.CacheDuration(),
+		now:      time.Now,
+		backends: make(map[string]Backend),
+		cache:    make(map[string]*cached),
+		used:     make(map[string]bool),
+		kept:     make(map[string]bool),
+	}
+	r.Use("vault", newVault(settings.Vault))
+	r.Use("aws-sm", newAWSSecrets(settings.AWS))
+	r.Use("gcp-sm", newGCPSecrets(settings.GCP))
+	r.Use("azure-kv", newAzureKeyVault(settings.Azure))
+	return r
+}
+
+// Use makes backend resolve the references with scheme
+func (r *Resolver) Use(scheme string, backend Backend) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.backends[scheme] = backend
+}
+
+// Resolve returns the secret ref names, fetching it unless it was fetched
+// recently. The secret is redacted from logs from then on.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	scheme, path, field, err := parseRef(ref)
+	if err != nil {
+		return "", err
+	}
+	key := scheme + "://" + path
+
+	r.mu.Lock()
+	backend := r.backends[scheme]
+	var secret *Secret
+	if entry := r.cache[key]; entry != nil && r.now().Before(entry.expires) {
+		secret = entry.secret
+	}
+	r.mu.Unlock()
+	if backend == nil {
+		return "", fmt.Errorf("no backend for %s:// references", scheme)
+	}
+
+	if secret == nil {
+		if secret, err = backend.Fetch(ctx, path); err != nil {
+			return "", fmt.Errorf("error fetching %s: %w", key, err)
+		}
+		r.store(scheme, key, secret)
+		config.DebugLog("Fetched secret %s", key)
+	}
+
+	value, err := pick(secret, field)
+	if err != nil {
+		return "", fmt.Errorf("secret %s %w", key, err)
+	}
+	config.AddSecret(value)
+	return value, nil
+}
+
+// store caches a fetched secret until its lease ends, renewing it halfway
+// through when it can be, or for the cache TTL otherwise
+func (r *Resolver) store(scheme, key string, secret *Secret) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	entry := &cached{scheme: scheme, secret: secret, expires: now.Add(r.ttl)}
+	if secret.TTL > 0 {
+		if _, ok := r.backends[scheme].(Renewer); ok && secret.Renewable {
+			entry.expires = now.Add(secret.TTL)
+			entry.renewAt = now.Add(secret.TTL / 2)
+		} else if secret.TTL < r.ttl {
+			entry.expires = now.Add(secret.TTL)
+		}
+	}
+	r.cache[key] = entry
+	r.used[scheme] = true
+}
+
+// Run renews the leases of fetched secrets halfway through them, drops the
+// secrets that expired and keeps the credentials of the backends in use
+// alive, until ctx is done
+func (r *Resolver) Run(ctx context.Context) {
+	ticker := time.NewTicker(maintainInterval)
+	defer ticker.Stop()
+	for {
+		r.maintain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintain does one round of Run's upkeep
+func (r *Resolver) maintain(ctx context.Context) {
+	r.mu.Lock()
+	for scheme := range r.used {
+		keeper, ok := r.backends[scheme].(Keeper)
+		if !ok || r.kept[scheme] {
+			continue
+		}
+		r.kept[scheme] = true
+		go func(scheme string) {
+			if err := keeper.KeepAlive(ctx); err != nil && ctx.Err() == nil {
+				config.VerboseLog("Stopped renewing the %s credentials: %v", scheme, err)
+			}
+		}(scheme)
+	}
+	due := make(map[string]*cached)
+	renewers := make(map[string]Renewer)
+	now := r.now()
+	for key, entry := range r.cache {
+		switch {
+		case !entry.renewAt.IsZero() && !now.Before(entry.renewAt) && now.Before(entry.expires):
+			due[key] = entry
+			renewers[key] = r.backends[entry.scheme].(Renewer)
+		case !now.Before(entry.expires):
+			delete(r.cache, key)
+		}
+	}
+	r.mu.Unlock()
+
+	for key, entry := range due {
+		ttl, err := renewers[key].Renew(ctx, entry.secret)
+		r.mu.Lock()
+		if err != nil || ttl <= 0 {
+			// Keep the secret until its lease ends, then fetch it again
+			entry.renewAt = time.Time{}
+			config.VerboseLog("Could not renew the lease of %s, it expires at %s: %v", key, entry.expires.Format(time.RFC3339), err)
+		} else {
+			now := r.now()
+			entry.expires = now.Add(ttl)
+			entry.renewAt = now.Add(ttl / 2)
+			config.DebugLog("Renewed the lease of %s for %s", key, ttl)
+		}
+		r.mu.Unlock()
+	}
+}
+
+var (
+	defaultMu       sync.Mutex
+	defaultResolver *Resolver
+)
+
+// SetDefault makes r the resolver Default returns
+func SetDefault(r *Resolver) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultResolver = r
+}
+
+// Default returns the resolver set with SetDefault, or one using the
+// environment defaults of every backend
+func Default() *Resolver {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultResolver == nil {
+		defaultResolver = New(config.SecretsConfig{})
+	}
+	return defaultResolver
+}
+
+// parseRef splits a reference such as vault://secret/data/comanda#openai
+// into its scheme, path and field
+func parseRef(ref string) (scheme, path, field string, err error) {
+	if !config.IsSecretRef(ref) {
+		return "", "", "", fmt.Errorf("'%s' is not a secret reference (expected %s://<path>[#field])", ref, strings.Join(config.SecretSchemes, "|"))
+	}
+	scheme, rest, _ := strings.Cut(ref, "://")
+	path, field, _ = strings.Cut(rest, "#")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", "", "", fmt.Errorf("secret reference '%s' names no secret", ref)
+	}
+	return scheme, path, field, nil
+}
+
+// pick returns the field of a secret, which may be a field of a JSON
+// object secret. Without a field it returns the secret itself, or its only
+// field.
+func pick(secret *Secret, field string) (string, error) {
+	fields := secret.Fields
+	if fields == nil && field != "" {
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(secret.Value), &object); err != nil {
+			return "", fmt.Errorf("is not a JSON object, so it has no field '%s'", field)
+		}
+		fields = stringFields(object)
+	}
+
+	if field == "" {
+		if fields == nil {
+			return secret.Value, nil
+		}
+		if len(fields) == 1 {
+			for _, value := range fields {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("has %d fields; name one with #<field>", len(fields))
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("has no field '%s'", field)
+	}
+	return value, nil
+}
+
+// stringFields returns the values of a JSON object as strings, with
+// values other than strings in their JSON form
+func stringFields(object map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(object))
+	for name, value := range object {
+		if s, ok := value.(string); ok {
+			fields[name] = s
+			continue
+		}
+		data, _ := json.Marshal(value)
+		fields[name] = string(data)
+	}
+	return fields
+}
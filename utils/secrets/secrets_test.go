@@ -0,0 +1,133 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBackend serves secrets from a map and counts its fetches and renewals
+type fakeBackend struct {
+	secrets  map[string]*Secret
+	fetches  int
+	renewals int
+	renewTTL time.Duration
+	renewErr error
+}
+
+func (f *fakeBackend) Fetch(ctx context.Context, path string) (*Secret, error) {
+	f.fetches++
+	secret, ok := f.secrets[path]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copied := *secret
+	if secret.Fields != nil {
+		copied.Fields = make(map[string]string)
+		for name, value := range secret.Fields {
+			copied.Fields[name] = value
+		}
+	}
+	return &copied, nil
+}
+
+func (f *fakeBackend) Renew(ctx context.Context, secret *Secret) (time.Duration, error) {
+	f.renewals++
+	return f.renewTTL, f.renewErr
+}
+
+// newTestResolver returns a resolver using backend for vault:// references
+// and a clock the test moves
+func newTestResolver(backend Backend) (*Resolver, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	r := New(config.SecretsConfig{CacheTTL: 60})
+	r.now = func() time.Time { return now }
+	r.Use("vault", backend)
+	return r, &now
+}
+
+func TestResolve(t *testing.T) {
+	backend := &fakeBackend{secrets: map[string]*Secret{
+		"secret/data/comanda": {Fields: map[string]string{"openai": "sk-openai-1", "anthropic": "sk-ant-1"}},
+		"kv/single":           {Fields: map[string]string{"token": "only-one"}},
+		"json":                {Value: `{"user":"app","port":5432}`},
+		"plain":               {Value: "plain-secret"},
+	}}
+	r, now := newTestResolver(backend)
+	ctx := context.Background()
+
+	value, err := r.Resolve(ctx, "vault://secret/data/comanda#openai")
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-openai-1", value)
+	value, err = r.Resolve(ctx, "vault://secret/data/comanda#anthropic")
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-ant-1", value)
+	assert.Equal(t, 1, backend.fetches, "fields of one secret share a fetch")
+	assert.Equal(t, "***", config.Redact("sk-openai-1"))
+
+	_, err = r.Resolve(ctx, "vault://secret/data/comanda")
+	assert.ErrorContains(t, err, "has 2 fields")
+	_, err = r.Resolve(ctx, "vault://secret/data/comanda#google")
+	assert.ErrorContains(t, err, "has no field 'google'")
+
+	value, _ = r.Resolve(ctx, "vault://kv/single")
+	assert.Equal(t, "only-one", value)
+	value, _ = r.Resolve(ctx, "vault://json#port")
+	assert.Equal(t, "5432", value)
+	value, _ = r.Resolve(ctx, "vault://plain")
+	assert.Equal(t, "plain-secret", value)
+	_, err = r.Resolve(ctx, "vault://plain#user")
+	assert.ErrorContains(t, err, "not a JSON object")
+
+	_, err = r.Resolve(ctx, "vault://missing")
+	assert.ErrorContains(t, err, "error fetching vault://missing: not found")
+	_, err = r.Resolve(ctx, "keychain://openai")
+	assert.ErrorContains(t, err, "not a secret reference")
+
+	// Secrets are fetched again once the cache TTL passes
+	fetches := backend.fetches
+	backend.secrets["secret/data/comanda"].Fields["openai"] = "sk-openai-2"
+	*now = now.Add(59 * time.Second)
+	value, _ = r.Resolve(ctx, "vault://secret/data/comanda#openai")
+	assert.Equal(t, "sk-openai-1", value)
+	*now = now.Add(time.Second)
+	value, _ = r.Resolve(ctx, "vault://secret/data/comanda#openai")
+	assert.Equal(t, "sk-openai-2", value)
+	assert.Equal(t, fetches+1, backend.fetches)
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	backend := &fakeBackend{
+		secrets:  map[string]*Secret{"database/creds/app": {Fields: map[string]string{"password": "p1"}, TTL: 10 * time.Minute, LeaseID: "lease-1", Renewable: true}},
+		renewTTL: 10 * time.Minute,
+	}
+	r, now := newTestResolver(backend)
+	ctx := context.Background()
+
+	// A leased secret outlives the cache TTL while its lease is renewed
+	_, err := r.Resolve(ctx, "vault://database/creds/app#password")
+	assert.NoError(t, err)
+	*now = now.Add(4 * time.Minute)
+	r.maintain(ctx)
+	assert.Equal(t, 0, backend.renewals)
+	*now = now.Add(time.Minute)
+	r.maintain(ctx)
+	assert.Equal(t, 1, backend.renewals)
+	*now = now.Add(9 * time.Minute)
+	r.Resolve(ctx, "vault://database/creds/app#password")
+	assert.Equal(t, 1, backend.fetches)
+
+	// A lease that can't be renewed is left to expire, then fetched again
+	backend.renewErr = errors.New("lease not found")
+	r.maintain(ctx)
+	assert.Equal(t, 2, backend.renewals)
+	*now = now.Add(time.Minute)
+	r.maintain(ctx)
+	assert.Equal(t, 2, backend.renewals)
+	r.Resolve(ctx, "vault://database/creds/app#password")
+	assert.Equal(t, 2, backend.fetches)
+}
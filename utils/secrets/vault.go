@@ -0,0 +1,191 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// vault reads secrets from HashiCorp Vault. The path of a reference is the
+// API path after /v1/, such as secret/data/comanda for a KV version 2
+// engine or database/creds/readonly for dynamic credentials.
+type vault struct {
+	address   string
+	namespace string
+	tokenFile string
+	client    *http.Client
+}
+
+func newVault(c *config.VaultConfig) *vault {
+	v := &vault{
+		address:   os.Getenv("VAULT_ADDR"),
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if c != nil {
+		if c.Address != "" {
+			v.address = c.Address
+		}
+		if c.Namespace != "" {
+			v.namespace = c.Namespace
+		}
+		v.tokenFile = c.TokenFile
+	}
+	return v
+}
+
+// vaultResponse is the envelope of Vault's API responses
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		LeaseDuration int  `json:"lease_duration"`
+		Renewable     bool `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func (v *vault) Fetch(ctx context.Context, path string) (*Secret, error) {
+	resp, err := v.call(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := resp.Data
+	// KV version 2 nests the secret under data, beside its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	if data == nil {
+		return nil, fmt.Errorf("vault has no secret at %s", path)
+	}
+	return &Secret{
+		Fields:    stringFields(data),
+		TTL:       time.Duration(resp.LeaseDuration) * time.Second,
+		LeaseID:   resp.LeaseID,
+		Renewable: resp.Renewable && resp.LeaseID != "",
+	}, nil
+}
+
+// Renew extends the lease of a dynamic secret
+func (v *vault) Renew(ctx context.Context, secret *Secret) (time.Duration, error) {
+	resp, err := v.call(ctx, http.MethodPut, "sys/leases/renew", map[string]string{"lease_id": secret.LeaseID})
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// KeepAlive renews the token halfway through its TTL while it is renewable
+func (v *vault) KeepAlive(ctx context.Context) error {
+	resp, err := v.call(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+	if err != nil {
+		return err
+	}
+	ttl, _ := resp.Data["ttl"].(float64)
+	renewable, _ := resp.Data["renewable"].(bool)
+	for renewable && ttl > 0 {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Duration(ttl) * time.Second / 2):
+		}
+		resp, err := v.call(ctx, http.MethodPost, "auth/token/renew-self", map[string]string{})
+		if err != nil {
+			return err
+		}
+		if resp.Auth == nil {
+			return errors.New("vault renewed the token without returning its lease")
+		}
+		ttl, renewable = float64(resp.Auth.LeaseDuration), resp.Auth.Renewable
+		config.DebugLog("Renewed the Vault token for %ds", resp.Auth.LeaseDuration)
+	}
+	return nil
+}
+
+// token returns the Vault token from VAULT_TOKEN, the token file or
+// ~/.vault-token, read each time so a token an agent rotates is picked up
+func (v *vault) token() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	files := []string{v.tokenFile}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".vault-token"))
+	}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			return strings.TrimSpace(string(data)), nil
+		} else if err != nil && file == v.tokenFile {
+			return "", fmt.Errorf("error reading the vault token: %w", err)
+		}
+	}
+	return "", errors.New("no vault token: set VAULT_TOKEN or secrets.vault.token_file")
+}
+
+// call sends a request to the Vault API and decodes its response
+func (v *vault) call(ctx context.Context, method, path string, body interface{}) (*vaultResponse, error) {
+	if v.address == "" {
+		return nil, errors.New("no vault address: set VAULT_ADDR or secrets.vault.address")
+	}
+	token, err := v.token()
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(v.address, "/")+"/v1/"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var resp vaultResponse
+	if res.StatusCode == http.StatusNoContent {
+		return &resp, nil
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&resp); err != nil && res.StatusCode < 300 {
+		return nil, fmt.Errorf("error decoding the vault response: %w", err)
+	}
+	if res.StatusCode >= 300 {
+		if len(resp.Errors) > 0 {
+			return nil, fmt.Errorf("vault returned %s: %s", res.Status, strings.Join(resp.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault returned %s", res.Status)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,125 @@
+// Package seen remembers the items workflows have processed, such as feed
+// entries, so that later runs only get new ones
+package seen
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxItems caps the items a store remembers; the oldest are forgotten first
+const MaxItems = 10000
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Path returns the file of the store named name in dir
+func Path(dir, name string) string {
+	return filepath.Join(dir, unsafeNameChars.ReplaceAllString(name, "-")+".json")
+}
+
+// Store is a set of item IDs kept in a JSON file. Items added are only
+// written by Save, so a run that fails leaves them unseen for the next one.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	items map[string]time.Time // ID -> when it was first seen
+	added map[string]time.Time
+}
+
+// Open reads the store kept in path; a missing file is an empty store
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, added: make(map[string]time.Time)}
+	items, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	s.items = items
+	return s, nil
+}
+
+func read(path string) (map[string]time.Time, error) {
+	items := make(map[string]time.Time)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading seen items %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("error parsing seen items %s: %w", path, err)
+	}
+	return items, nil
+}
+
+// Has reports whether an item was seen by an earlier run or added in this
+// one
+func (s *Store) Has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, saved := s.items[id]
+	_, added := s.added[id]
+	return saved || added
+}
+
+// Add marks an item seen once the store is saved
+func (s *Store) Add(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; !ok {
+		s.added[id] = time.Now().UTC()
+	}
+}
+
+// Save writes the items added to the file, merged with those other runs
+// saved since the store was opened
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.added) == 0 {
+		return nil
+	}
+	items, err := read(s.path)
+	if err != nil {
+		return err
+	}
+	for id, t := range s.added {
+		if _, ok := items[id]; !ok {
+			items[id] = t
+		}
+	}
+	if len(items) > MaxItems {
+		ids := make([]string, 0, len(items))
+		for id := range items {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return items[ids[i]].After(items[ids[j]]) })
+		for _, id := range ids[MaxItems:] {
+			delete(items, id)
+		}
+	}
+
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding seen items: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("error creating seen items directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing seen items %s: %w", s.path, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("error writing seen items %s: %w", s.path, err)
+	}
+	s.items = items
+	s.added = make(map[string]time.Time)
+	return nil
+}
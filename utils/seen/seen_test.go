@@ -0,0 +1,38 @@
+package seen
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := Path(t.TempDir(), "news/tech feeds")
+	if filepath.Base(path) != "news-tech-feeds.json" {
+		t.Errorf("Path() = %s", path)
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	s.Add("a")
+	if !s.Has("a") || s.Has("b") {
+		t.Error("Has() doesn't report the items added")
+	}
+	if reopened, _ := Open(path); reopened.Has("a") {
+		t.Error("item written before Save")
+	}
+
+	// Another run saves an item in the meantime
+	other, _ := Open(path)
+	other.Add("b")
+	if err := other.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	reopened, err := Open(path)
+	if err != nil || !reopened.Has("a") || !reopened.Has("b") {
+		t.Errorf("after Save, store has a: %v, b: %v (%v)", reopened.Has("a"), reopened.Has("b"), err)
+	}
+}
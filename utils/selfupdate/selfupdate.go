@@ -0,0 +1,269 @@
+// Package selfupdate finds comanda releases on GitHub, verifies the
+// downloaded binary and replaces the running executable with it.
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release asset names besides the binaries
+const (
+	ChecksumsAsset = "checksums.txt"
+	SignatureAsset = "checksums.txt.sig" // Base64 Ed25519 signature of checksums.txt
+)
+
+// Release is a published release and its downloadable files
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	URL    string  `json:"html_url"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Find returns the asset with the given name
+func (r *Release) Find(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// Updater talks to the GitHub releases API of a repository
+type Updater struct {
+	APIBase string // e.g. https://api.github.com
+	Repo    string // owner/name
+	Token   string // Optional, raises the API rate limit
+	Client  *http.Client
+}
+
+// New returns an updater for a GitHub repository, authenticated with
+// GITHUB_TOKEN when it is set
+func New(repo string) *Updater {
+	return &Updater{
+		APIBase: "https://api.github.com",
+		Repo:    repo,
+		Token:   os.Getenv("GITHUB_TOKEN"),
+		Client:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Release looks up a release by tag, or the latest release when tag is empty
+func (u *Updater) Release(tag string) (*Release, error) {
+	url := fmt.Sprintf("%s/repos/%s/releases/latest", u.APIBase, u.Repo)
+	if tag != "" {
+		if !strings.HasPrefix(tag, "v") {
+			tag = "v" + tag
+		}
+		url = fmt.Sprintf("%s/repos/%s/releases/tags/%s", u.APIBase, u.Repo, tag)
+	}
+	data, err := u.get(url, "application/vnd.github+json")
+	if err != nil {
+		return nil, fmt.Errorf("error looking up release: %w", err)
+	}
+	var release Release
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("error parsing release: %w", err)
+	}
+	return &release, nil
+}
+
+// Download fetches a release asset
+func (u *Updater) Download(asset Asset) ([]byte, error) {
+	data, err := u.get(asset.URL, "application/octet-stream")
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", asset.Name, err)
+	}
+	return data, nil
+}
+
+func (u *Updater) get(url, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if u.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.Token)
+	}
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("not found (%s)", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// AssetName is the release binary for a platform, e.g. comanda-darwin-arm64
+func AssetName(goos, goarch string) string {
+	name := fmt.Sprintf("comanda-%s-%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// CurrentAssetName is the release binary for the running platform
+func CurrentAssetName() string {
+	return AssetName(runtime.GOOS, runtime.GOARCH)
+}
+
+// CompareVersions compares dotted versions such as v0.0.69 and 0.1.0
+// numerically, returning -1, 0 or 1. Missing parts count as zero, and
+// anything after a '-' or '+' is ignored.
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, s := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(s)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// ValidVersion reports whether v looks like a release version
+func ValidVersion(v string) bool {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if v == "" {
+		return false
+	}
+	for _, s := range strings.Split(v, ".") {
+		if _, err := strconv.Atoi(s); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyChecksum checks a downloaded file against a checksums.txt in
+// sha256sum format
+func VerifyChecksum(checksums []byte, name string, data []byte) error {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, fields[0]) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, fields[0], got)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s has no checksum for %s", ChecksumsAsset, name)
+}
+
+// VerifySignature checks the base64 Ed25519 signature of checksums.txt
+// against a PEM encoded public key
+func VerifySignature(checksums, signature, publicKeyPEM []byte) error {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return fmt.Errorf("release public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing release public key: %w", err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("release public key is not an Ed25519 key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(public, checksums, sig) {
+		return fmt.Errorf("signature verification of %s failed", ChecksumsAsset)
+	}
+	return nil
+}
+
+// Replace swaps the executable at path for a new binary. The binary is
+// written next to it and renamed over it, so the executable is never left
+// half written. Windows can't replace a running executable, so there the old
+// one is moved aside to <path>.old first.
+func Replace(path string, binary []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".comanda-upgrade-*")
+	if err != nil {
+		return fmt.Errorf("cannot write to %s: %w", dir, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("error moving the old executable aside: %w", err)
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			os.Rename(old, path)
+			return fmt.Errorf("error installing the new executable: %w", err)
+		}
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error installing the new executable: %w", err)
+	}
+	return nil
+}
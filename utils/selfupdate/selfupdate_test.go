@@ -0,0 +1,153 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.0.69", "v0.0.70", -1},
+		{"v0.1.0", "0.0.99", 1},
+		{"v1.2", "1.2.0", 0},
+		{"0.0.10", "0.0.9", 1},
+		{"v1.0.0-rc1", "1.0.0", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if ValidVersion("unknown") || ValidVersion("") || !ValidVersion("v0.0.69") {
+		t.Error("ValidVersion() misclassified a version")
+	}
+}
+
+func TestAssetName(t *testing.T) {
+	if got := AssetName("darwin", "arm64"); got != "comanda-darwin-arm64" {
+		t.Errorf("AssetName() = %q", got)
+	}
+	if got := AssetName("windows", "amd64"); got != "comanda-windows-amd64.exe" {
+		t.Errorf("AssetName() = %q", got)
+	}
+}
+
+func sha(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	binary := []byte("new comanda")
+	checksums := []byte(fmt.Sprintf("%s  comanda-linux-amd64\n%s *comanda-darwin-arm64\n", sha(binary), sha([]byte("other"))))
+
+	if err := VerifyChecksum(checksums, "comanda-linux-amd64", binary); err != nil {
+		t.Errorf("VerifyChecksum() error = %v", err)
+	}
+	if err := VerifyChecksum(checksums, "comanda-darwin-arm64", binary); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	if err := VerifyChecksum(checksums, "comanda-windows-386.exe", binary); err == nil {
+		t.Error("expected an error for a file without a checksum")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	checksums := []byte("abc  comanda-linux-amd64\n")
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, checksums)) + "\n")
+
+	if err := VerifySignature(checksums, signature, key); err != nil {
+		t.Errorf("VerifySignature() error = %v", err)
+	}
+	if err := VerifySignature([]byte("def  comanda-linux-amd64\n"), signature, key); err == nil {
+		t.Error("expected tampered checksums to fail verification")
+	}
+}
+
+func TestReleaseAndDownload(t *testing.T) {
+	binary := []byte("new comanda")
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/comanda/releases/latest", "/repos/owner/comanda/releases/tags/v0.0.70":
+			json.NewEncoder(w).Encode(Release{Tag: "v0.0.70", Assets: []Asset{
+				{Name: "comanda-linux-amd64", URL: server.URL + "/download/comanda-linux-amd64"},
+			}})
+		case "/download/comanda-linux-amd64":
+			w.Write(binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u := &Updater{APIBase: server.URL, Repo: "owner/comanda", Client: server.Client()}
+	for _, tag := range []string{"", "0.0.70"} {
+		release, err := u.Release(tag)
+		if err != nil {
+			t.Fatalf("Release(%q) error = %v", tag, err)
+		}
+		if release.Tag != "v0.0.70" {
+			t.Errorf("Release(%q).Tag = %q", tag, release.Tag)
+		}
+	}
+	release, _ := u.Release("")
+	asset, ok := release.Find("comanda-linux-amd64")
+	if !ok {
+		t.Fatal("Find() did not find the binary")
+	}
+	data, err := u.Download(asset)
+	if err != nil || string(data) != string(binary) {
+		t.Errorf("Download() = %q, %v", data, err)
+	}
+	if _, err := u.Release("v9.9.9"); err == nil {
+		t.Error("expected an error for a missing release")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comanda")
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Replace(path, []byte("new")); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("executable contains %q, %v", data, err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("replaced executable is not executable: %v", info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
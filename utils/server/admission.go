@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/chunker"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// bytesPerToken is how many bytes of text make a token, for estimates made
+// before a run's steps report what they used
+const bytesPerToken = 4
+
+// admitRun checks a run against the server's run limits before it is
+// queued. Step settings over a limit are lowered to it when the limits say
+// to downgrade, and the run is refused otherwise; inputs over a limit always
+// refuse it. It returns a note for each setting it lowered.
+func (s *Server) admitRun(dslConfig *processor.DSLConfig, proc *processor.Processor, req RunRequest) ([]string, error) {
+	limits := s.config.RunLimits
+	var notes []string
+	var refusal error
+	check := func(step string, cfg *processor.StepConfig) {
+		if refusal != nil {
+			return
+		}
+		if limits.MaxChunks > 0 && cfg.Chunk != nil {
+			chunks := cfg.Chunk.MaxChunks
+			if chunks <= 0 {
+				chunks = chunker.DefaultMaxChunks
+			}
+			if chunks > limits.MaxChunks {
+				if !limits.Downgrade() {
+					refusal = refuseRun(http.StatusUnprocessableEntity, "Run not admitted: step '%s' may split its input into %d chunks, over the limit of %d", step, chunks, limits.MaxChunks)
+					return
+				}
+				cfg.Chunk.MaxChunks = limits.MaxChunks
+				notes = append(notes, fmt.Sprintf("step '%s': max_chunks lowered from %d to %d", step, chunks, limits.MaxChunks))
+			}
+		}
+		if limits.MaxTokens > 0 && cfg.MaxOutputTokens > limits.MaxTokens {
+			if !limits.Downgrade() {
+				refusal = refuseRun(http.StatusUnprocessableEntity, "Run not admitted: step '%s' asks for %d output tokens, over the limit of %d", step, cfg.MaxOutputTokens, limits.MaxTokens)
+				return
+			}
+			notes = append(notes, fmt.Sprintf("step '%s': max_output_tokens lowered from %d to %d", step, cfg.MaxOutputTokens, limits.MaxTokens))
+			cfg.MaxOutputTokens = limits.MaxTokens
+		}
+		if limits.MaxFileSizeMB > 0 {
+			for _, file := range s.inputFiles(proc, cfg.Input, req.RuntimeDir) {
+				if file.size > int64(limits.MaxFileSizeMB)<<20 {
+					refusal = refuseRun(http.StatusUnprocessableEntity, "Run not admitted: input '%s' of step '%s' is larger than the limit of %d MB", file.name, step, limits.MaxFileSizeMB)
+					return
+				}
+			}
+		}
+	}
+
+	eachStep(dslConfig, check)
+	if refusal != nil {
+		return nil, refusal
+	}
+
+	if limits.MaxTokens > 0 {
+		if estimate := len(req.Input) / bytesPerToken; estimate > limits.MaxTokens {
+			return nil, refuseRun(http.StatusUnprocessableEntity, "Run not admitted: its input is about %d tokens, over the limit of %d", estimate, limits.MaxTokens)
+		}
+	}
+	return notes, nil
+}
+
+// eachStep calls fn with the name and settings of each of a workflow's
+// steps, parallel steps and deferred steps, in the same order every time.
+// Changes fn makes to the settings are kept.
+func eachStep(dslConfig *processor.DSLConfig, fn func(name string, cfg *processor.StepConfig)) {
+	for i := range dslConfig.Steps {
+		fn(dslConfig.Steps[i].Name, &dslConfig.Steps[i].Config)
+	}
+	groups := make([]string, 0, len(dslConfig.ParallelSteps))
+	for group := range dslConfig.ParallelSteps {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		steps := dslConfig.ParallelSteps[group]
+		for i := range steps {
+			fn(steps[i].Name, &steps[i].Config)
+		}
+	}
+	deferred := make([]string, 0, len(dslConfig.Defer))
+	for name := range dslConfig.Defer {
+		deferred = append(deferred, name)
+	}
+	sort.Strings(deferred)
+	for _, name := range deferred {
+		cfg := dslConfig.Defer[name]
+		fn(name, &cfg)
+		dslConfig.Defer[name] = cfg
+	}
+}
+
+// inputFile is an input file a step will read
+type inputFile struct {
+	name string // As the step names it, possibly a pattern
+	path string
+	size int64
+}
+
+// inputFiles returns the files named by a step's input that exist before
+// the run starts. Files written by earlier steps of the run aren't known
+// yet.
+func (s *Server) inputFiles(proc *processor.Processor, input interface{}, runtimeDir string) []inputFile {
+	var files []inputFile
+	for _, name := range proc.NormalizeStringSlice(input) {
+		if name == "" || name == "STDIN" || name == "NA" || strings.Contains(name, "://") {
+			continue
+		}
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.config.DataDir, runtimeDir, name)
+		}
+		paths := []string{path}
+		if strings.ContainsAny(name, "*?[") {
+			paths, _ = filepath.Glob(path)
+		}
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				files = append(files, inputFile{name: name, path: path, size: info.Size()})
+			}
+		}
+	}
+	return files
+}
+
+// runBudget stops a run once its steps used more tokens than the run limits
+// allow
+type runBudget struct {
+	processor.StepRecorder
+	limit int
+	stop  context.CancelFunc
+
+	mu       sync.Mutex
+	used     int
+	exceeded bool
+}
+
+// RecordStep records a finished step and counts its tokens
+func (b *runBudget) RecordStep(record processor.StepRecord) {
+	b.StepRecorder.RecordStep(record)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += record.Metrics.PromptTokens + record.Metrics.CompletionTokens
+	if b.used > b.limit && !b.exceeded {
+		b.exceeded = true
+		b.stop()
+	}
+}
+
+// limitRun applies the run limits to a run about to start: it returns the
+// context the run executes with, the recorder its steps go to, and a
+// function that explains an error the run stopped with when a limit stopped
+// it
+func (s *Server) limitRun(job *runJob) (context.Context, processor.StepRecorder, func(error) error) {
+	limits := s.config.RunLimits
+	ctx := job.ctx
+	var recorder processor.StepRecorder = job.recorder
+	if limits.MaxDuration <= 0 && limits.MaxTokens <= 0 {
+		return ctx, recorder, func(err error) error { return err }
+	}
+
+	maxDuration := time.Duration(limits.MaxDuration) * time.Second
+	ctx, cancel := context.WithCancel(ctx)
+	if maxDuration > 0 {
+		ctx, cancel = context.WithTimeout(job.ctx, maxDuration)
+	}
+	var budget *runBudget
+	if limits.MaxTokens > 0 {
+		run := job.recorder.Run()
+		prompt, completion := run.Tokens() // Steps finished before a restart count too
+		budget = &runBudget{StepRecorder: job.recorder, limit: limits.MaxTokens, stop: cancel, used: prompt + completion}
+		recorder = budget
+	}
+
+	explain := func(err error) error {
+		defer cancel()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("run stopped: it exceeded its time limit of %s", maxDuration)
+		}
+		if budget != nil {
+			budget.mu.Lock()
+			defer budget.mu.Unlock()
+			if budget.exceeded {
+				return fmt.Errorf("run stopped: its steps used %d tokens, over the limit of %d", budget.used, budget.limit)
+			}
+		}
+		return err
+	}
+	return ctx, recorder, explain
+}
+
+// validateRunLimits checks the run limits' policy
+func validateRunLimits(limits config.RunLimits) error {
+	switch limits.OnExceed {
+	case "", config.OnExceedReject, config.OnExceedDowngrade:
+		return nil
+	}
+	return fmt.Errorf("runLimits: unknown onExceed '%s'; use %s or %s", limits.OnExceed, config.OnExceedReject, config.OnExceedDowngrade)
+}
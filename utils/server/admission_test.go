@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkedWorkflow reads report.txt in chunks without capping their number
+const chunkedWorkflow = `
+summarize:
+  input: report.txt
+  model: gpt-4o
+  action: Summarize this
+  output: STDOUT
+  chunk:
+    by: lines
+    size: 10
+`
+
+func TestAdmitRunRejects(t *testing.T) {
+	s := newAPITestServer(t)
+	s.config.RunLimits = config.RunLimits{MaxChunks: 10, MaxFileSizeMB: 1, MaxTokens: 100}
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "chunked.yaml"), []byte(chunkedWorkflow), 0644)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte(testWorkflow), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "chunked"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "100 chunks, over the limit of 10")
+
+	// Inputs over a limit refuse the run whatever the policy
+	s.config.RunLimits.OnExceed = config.OnExceedDowngrade
+	require.NoError(t, os.WriteFile(filepath.Join(s.config.DataDir, "report.txt"), make([]byte, 2<<20), 0644))
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "chunked"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "input 'report.txt' of step 'summarize' is larger than the limit of 1 MB")
+
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Input: strings.Repeat("word ", 100)})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "about 125 tokens, over the limit of 100")
+
+	// Refused runs aren't recorded
+	store, _ := s.runStore()
+	runs, _ := store.List()
+	assert.Empty(t, runs)
+}
+
+func TestAdmitRunDowngrades(t *testing.T) {
+	s := newAPITestServer(t)
+	s.config.RunLimits = config.RunLimits{MaxChunks: 10, OnExceed: config.OnExceedDowngrade}
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "chunked.yaml"), []byte(chunkedWorkflow), 0644)
+	os.WriteFile(filepath.Join(s.config.DataDir, "report.txt"), []byte(strings.Repeat("line\n", 50)), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "chunked", Wait: true})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp RunResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, []string{"step 'summarize': max_chunks lowered from 100 to 10"}, resp.Adjustments)
+	assert.True(t, resp.Success, resp.Error)
+}
+
+func TestRunLimitsStopRuns(t *testing.T) {
+	t.Run("tokens", func(t *testing.T) {
+		s := newScheduleTestServer(t)
+		s.config.RunLimits = config.RunLimits{MaxTokens: 5}
+
+		w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Input: "text", Wait: true})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp RunResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		require.NotNil(t, resp.Run)
+		assert.Equal(t, history.StatusFailed, resp.Run.Status)
+		assert.Contains(t, resp.Error, "over the limit of 5")
+		assert.Len(t, resp.Run.Steps, 1) // refine never started
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		s := newScheduleTestServer(t)
+		s.config.RunLimits = config.RunLimits{MaxDuration: 1}
+		release := blockPrompts(t)
+
+		w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Input: "text"})
+		assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		time.Sleep(1200 * time.Millisecond)
+		close(release)
+
+		runs := scheduleRuns(t, s)
+		require.Len(t, runs, 1)
+		assert.Equal(t, history.StatusFailed, runs[0].Status)
+		assert.Contains(t, runs[0].Error, "exceeded its time limit of 1s")
+	})
+}
+
+func TestWorkspaceRunLimits(t *testing.T) {
+	server := &config.ServerConfig{RunLimits: config.RunLimits{MaxTokens: 1000, MaxChunks: 20}}
+	ws := server.ForWorkspace(&config.Workspace{Name: "team", RunLimits: config.RunLimits{MaxTokens: 50, OnExceed: config.OnExceedDowngrade}})
+	assert.Equal(t, config.RunLimits{MaxTokens: 50, MaxChunks: 20, OnExceed: config.OnExceedDowngrade}, ws.RunLimits)
+
+	assert.Error(t, validateRunLimits(config.RunLimits{OnExceed: "shrink"}))
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/webhook"
+)
+
+// ApprovalRequestBody approves or rejects an approval step a run waits at
+type ApprovalRequestBody struct {
+	Step     string `json:"step,omitempty"` // Needed only while the run waits at several steps
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// pendingApproval is an approval step a run is waiting at
+type pendingApproval struct {
+	req      processor.ApprovalRequest
+	decision chan processor.ApprovalDecision // Buffered for the one decision
+}
+
+// approver returns the approver of a job's approval steps. It tells the
+// run's webhooks that an approval is needed, then waits for a decision
+// posted to /runs/{id}/approval.
+func (s *Server) approver(job *runJob) processor.Approver {
+	return func(ctx context.Context, req processor.ApprovalRequest) (processor.ApprovalDecision, error) {
+		pending := &pendingApproval{req: req, decision: make(chan processor.ApprovalDecision, 1)}
+		job.mu.Lock()
+		if job.approvals == nil {
+			job.approvals = make(map[string]*pendingApproval)
+		}
+		job.approvals[req.Step] = pending
+		job.mu.Unlock()
+		defer func() {
+			job.mu.Lock()
+			delete(job.approvals, req.Step)
+			job.mu.Unlock()
+		}()
+
+		s.logf("Run %s of workflow %s is waiting for approval of step %s", job.recorder.ID(), job.workflow, req.Step)
+		if len(job.webhooks) > 0 {
+			run := job.recorder.Run()
+			go s.sendWebhooks(job.webhooks, webhook.Payload{Event: webhook.EventApprovalNeeded, Run: &run, Approval: &req})
+		}
+		select {
+		case decision := <-pending.decision:
+			return decision, nil
+		case <-ctx.Done():
+			return processor.ApprovalDecision{}, ctx.Err()
+		}
+	}
+}
+
+// pendingApprovals returns the approval requests the run waits on, by step
+func (j *runJob) pendingApprovals() []processor.ApprovalRequest {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var requests []processor.ApprovalRequest
+	for _, pending := range j.approvals {
+		requests = append(requests, pending.req)
+	}
+	sort.Slice(requests, func(a, b int) bool { return requests[a].Step < requests[b].Step })
+	return requests
+}
+
+// decide passes a decision to the approval step the run waits at. The step
+// may be left empty while the run waits at only one.
+func (j *runJob) decide(step string, decision processor.ApprovalDecision) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	pending, ok := j.approvals[step]
+	if step == "" && len(j.approvals) == 1 {
+		for _, only := range j.approvals {
+			pending, ok = only, true
+		}
+	}
+	switch {
+	case ok:
+		delete(j.approvals, pending.req.Step)
+		pending.decision <- decision
+		return nil
+	case len(j.approvals) == 0:
+		return fmt.Errorf("run %s is not waiting for approval", j.recorder.ID())
+	case step == "":
+		return fmt.Errorf("run %s is waiting for approval of %d steps; name the step", j.recorder.ID(), len(j.approvals))
+	}
+	return fmt.Errorf("run %s is not waiting for approval of step %s", j.recorder.ID(), step)
+}
+
+// handleRunApproval approves or rejects the approval step a running run
+// waits at, as the caller
+func (s *Server) handleRunApproval(w http.ResponseWriter, r *http.Request, run *history.Run) {
+	var body ApprovalRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	job, ok := s.runQueue().job(run.ID)
+	if !ok {
+		sendJSONError(w, http.StatusConflict, fmt.Sprintf("Run %s is not running; it %s", run.ID, run.Status))
+		return
+	}
+	decision := processor.ApprovalDecision{Approved: body.Approved, By: s.requestActor(r), Reason: body.Reason}
+	if err := job.decide(body.Step, decision); err != nil {
+		sendJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	verb := "rejected"
+	if body.Approved {
+		verb = "approved"
+	}
+	s.logf("Run %s of workflow %s %s by %s", run.ID, job.workflow, verb, decision.By)
+	json.NewEncoder(w).Encode(s.runResponse(run))
+}
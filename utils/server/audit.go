@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/audit"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// actorKey carries who a run is started for
+type actorKey struct{}
+
+// withActor returns ctx naming who the runs it starts are started for
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorOf returns who ctx starts runs for
+func actorOf(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// requestActor names who sent a request: the caller it was authenticated
+// as, or what started it when it carries no credential
+func (s *Server) requestActor(r *http.Request) string {
+	if actor := actorOf(r.Context()); actor != "" {
+		return actor
+	}
+	if caller, ok := r.Context().Value(principalKey{}).(*principal); ok {
+		return caller.name
+	}
+	if name, ok := strings.CutPrefix(r.URL.Path, "/hooks/"); ok {
+		return fmt.Sprintf("trigger '%s'", name)
+	}
+	if s.config.AuthRequired() && !isPublicPath(r.URL.Path) {
+		return "unauthenticated"
+	}
+	return "anonymous"
+}
+
+// record appends an event to the audit log, when one is kept
+func (s *Server) record(e audit.Event) {
+	if s.audit == nil {
+		return
+	}
+	if s.workspace != nil {
+		e.Workspace = s.workspace.Name
+	}
+	e.Error = config.Redact(e.Error)
+	for name, value := range e.Params {
+		e.Params[name] = config.Redact(value)
+	}
+	if err := s.audit.Record(e); err != nil {
+		s.logf("%v", err)
+	}
+}
+
+// auditRequest records a request and the status it was answered with.
+// Health checks and the web UI's static files are left out.
+func (s *Server) auditRequest(r *http.Request, status int) {
+	if s.audit == nil || r.Method == http.MethodOptions || r.URL.Path == "/health" || r.URL.Path == "/" ||
+		r.URL.Path == "/openapi.json" || strings.HasPrefix(r.URL.Path, "/ui/") {
+		return
+	}
+	s.record(audit.Event{
+		Action: audit.ActionRequest,
+		Actor:  s.requestActor(r),
+		Client: r.RemoteAddr,
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: status,
+	})
+}
+
+// auditQueued records a run accepted into the queue
+func (s *Server) auditQueued(job *runJob) {
+	params := make(map[string]string, len(job.req.Params))
+	for name, value := range job.req.Params {
+		params[name] = fmt.Sprint(value)
+	}
+	input := audit.Digest("input", []byte(job.input))
+	s.record(audit.Event{
+		Action:   audit.ActionRunQueued,
+		Actor:    job.actor,
+		RunID:    job.recorder.ID(),
+		Workflow: job.workflow,
+		Params:   params,
+		Input:    &input,
+	})
+}
+
+// auditFinished records how a run ended and digests of what it produced:
+// its final output and the files it wrote
+func (s *Server) auditFinished(job *runJob, run history.Run, output string) {
+	var outputs []audit.Output
+	if output != "" {
+		outputs = append(outputs, audit.Digest("output", []byte(output)))
+	}
+	dir := job.recorder.Store().ArtifactsDir(run.ID)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if digest, err := audit.DigestFile(filepath.ToSlash(rel), path); err == nil {
+			outputs = append(outputs, digest)
+		}
+		return nil
+	})
+	prompt, completion := run.Tokens()
+	s.record(audit.Event{
+		Action:           audit.ActionRunFinished,
+		Actor:            job.actor,
+		RunID:            run.ID,
+		Workflow:         run.Workflow,
+		Result:           run.Status,
+		Error:            run.Error,
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		Outputs:          outputs,
+	})
+}
+
+// auditSteps records the provider calls of a run's steps as they finish
+type auditSteps struct {
+	processor.StepRecorder
+	server *Server
+	job    *runJob
+}
+
+// RecordStep records a finished step, and the provider call it made
+func (a auditSteps) RecordStep(record processor.StepRecord) {
+	a.StepRecorder.RecordStep(record)
+	if record.Model == "" {
+		return // The step called no model
+	}
+	e := audit.Event{
+		Action:           audit.ActionProviderCall,
+		Actor:            a.job.actor,
+		RunID:            a.job.recorder.ID(),
+		Workflow:         a.job.workflow,
+		Step:             record.Name,
+		Provider:         record.Provider,
+		Model:            record.Model,
+		PromptTokens:     record.Metrics.PromptTokens,
+		CompletionTokens: record.Metrics.CompletionTokens,
+		Result:           history.StatusSucceeded,
+	}
+	if record.Err != nil {
+		e.Result, e.Error = history.StatusFailed, record.Err.Error()
+	} else {
+		for _, output := range record.Outputs {
+			e.Outputs = append(e.Outputs, audit.Digest(output, []byte(record.Response)))
+		}
+	}
+	a.server.record(e)
+}
+
+// handleAudit serves /audit, exporting the audit log's events as JSONL or
+// CSV, and /audit/verify, checking the log's chain of hashes. A workspace
+// exports only its own events.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.audit == nil {
+		w.Header().Set("Content-Type", "application/json")
+		sendJSONError(w, http.StatusNotFound, "The audit log is not enabled; add an audit section to the server configuration")
+		return
+	}
+
+	if r.URL.Path == "/audit/verify" {
+		w.Header().Set("Content-Type", "application/json")
+		count, err := s.audit.Verify()
+		if err != nil {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(AuditVerifyResponse{Success: false, Events: count, Error: err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(AuditVerifyResponse{Success: true, Events: count})
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{Actor: query.Get("actor"), RunID: query.Get("run"), Action: query.Get("action")}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				sendJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s must be an RFC 3339 time, such as 2025-01-02T15:04:05Z", name))
+				return
+			}
+			*t = parsed
+		}
+	}
+	export := func(fn func(audit.Event) error) error {
+		return s.audit.Export(filter, func(e audit.Event) error {
+			if s.workspace != nil && e.Workspace != s.workspace.Name {
+				return nil
+			}
+			return fn(e)
+		})
+	}
+
+	var err error
+	switch format := query.Get("format"); format {
+	case "", "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		err = export(func(e audit.Event) error { return encoder.Encode(e) })
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		err = writeAuditCSV(w, export)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		sendJSONError(w, http.StatusBadRequest, "format must be jsonl or csv")
+		return
+	}
+	if err != nil {
+		s.logf("Error exporting audit log: %v", err)
+	}
+}
+
+// auditCSVHeader names the columns of CSV exports
+var auditCSVHeader = []string{"seq", "time", "action", "actor", "workspace", "client", "method", "path", "status",
+	"run_id", "workflow", "params", "step", "provider", "model", "prompt_tokens", "completion_tokens", "result", "error", "outputs", "hash"}
+
+// writeAuditCSV writes the events export produces as CSV. Parameters are
+// written as JSON, and outputs as name=sha256 pairs.
+func writeAuditCSV(w http.ResponseWriter, export func(func(audit.Event) error) error) error {
+	out := csv.NewWriter(w)
+	out.Write(auditCSVHeader)
+	err := export(func(e audit.Event) error {
+		var params string
+		if len(e.Params) > 0 {
+			data, _ := json.Marshal(e.Params)
+			params = string(data)
+		}
+		outputs := make([]string, len(e.Outputs))
+		for i, o := range e.Outputs {
+			outputs[i] = o.Name + "=" + o.SHA256
+		}
+		return out.Write([]string{
+			strconv.FormatInt(e.Seq, 10), e.Time.Format(time.RFC3339Nano), e.Action, e.Actor, e.Workspace, e.Client,
+			e.Method, e.Path, strconv.Itoa(e.Status), e.RunID, e.Workflow, params, e.Step, e.Provider, e.Model,
+			strconv.Itoa(e.PromptTokens), strconv.Itoa(e.CompletionTokens), e.Result, e.Error, strings.Join(outputs, " "), e.Hash,
+		})
+	})
+	out.Flush()
+	if err != nil {
+		return err
+	}
+	return out.Error()
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/audit"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAuditTestServer returns a routed server keeping an audit log, with an
+// admin key named ops and a run key named ci
+func newAuditTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := newScheduleTestServer(t)
+	s.config.Enabled = true
+	s.config.APIKeys = []config.APIKey{
+		{Name: "ops", Key: "admin-key", Scope: config.ScopeAdmin},
+		{Name: "ci", Key: "run-key", Scope: config.ScopeRun},
+	}
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	t.Cleanup(func() { log.Close() })
+	s.audit = log
+	s.mux = http.NewServeMux()
+	s.routes()
+	return s
+}
+
+// sendWithKey sends a request with a key through the server's routes
+func sendWithKey(s *Server, method, target, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+// auditEvents exports the server's audit log as JSONL and decodes it
+func auditEvents(t *testing.T, s *Server, query string) []audit.Event {
+	t.Helper()
+	w := sendWithKey(s, http.MethodGet, "/audit"+query, "admin-key", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	var events []audit.Event
+	decoder := json.NewDecoder(w.Body)
+	for decoder.More() {
+		var e audit.Event
+		require.NoError(t, decoder.Decode(&e))
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestAuditRecordsRuns(t *testing.T) {
+	s := newAuditTestServer(t)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "writer.yaml"), []byte(`params:
+  topic:
+    required: true
+draft:
+  input: STDIN
+  model: gpt-4o
+  action: Write about {{ params.topic }}
+  output: drafts/draft.txt
+`), 0644)
+
+	w := sendWithKey(s, http.MethodPost, "/runs", "run-key", `{"workflow": "writer", "input": "text", "params": {"topic": "tides"}, "wait": true}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp RunResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	require.NotNil(t, resp.Run)
+
+	events := auditEvents(t, s, "?run="+resp.Run.ID)
+	var actions []string
+	for _, e := range events {
+		assert.Equal(t, "API key 'ci'", e.Actor)
+		actions = append(actions, e.Action)
+	}
+	require.Equal(t, []string{audit.ActionRunQueued, audit.ActionProviderCall, audit.ActionRunFinished}, actions)
+
+	queued := events[0]
+	assert.Equal(t, "writer", queued.Workflow)
+	assert.Equal(t, map[string]string{"topic": "tides"}, queued.Params)
+	require.NotNil(t, queued.Input)
+	assert.Equal(t, audit.Digest("input", []byte("text")), *queued.Input)
+
+	call := events[1]
+	assert.Equal(t, "draft", call.Step)
+	assert.Equal(t, "gpt-4o", call.Model)
+	assert.Equal(t, "succeeded", call.Result)
+	require.Len(t, call.Outputs, 1)
+
+	finished := events[2]
+	assert.Equal(t, "succeeded", finished.Result)
+	var names []string
+	for _, o := range finished.Outputs {
+		names = append(names, o.Name)
+	}
+	assert.Contains(t, names, "drafts/draft.txt")
+
+	// The request that started the run is recorded with who sent it
+	requests := auditEvents(t, s, "?action=request&actor="+url.QueryEscape("API key 'ci'"))
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPost, requests[0].Method)
+	assert.Equal(t, "/runs", requests[0].Path)
+	assert.Equal(t, http.StatusCreated, requests[0].Status)
+
+	w = sendWithKey(s, http.MethodGet, "/audit/verify", "admin-key", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var verify AuditVerifyResponse
+	json.NewDecoder(w.Body).Decode(&verify)
+	assert.True(t, verify.Success, verify.Error)
+	assert.Greater(t, verify.Events, 5)
+}
+
+func TestAuditExport(t *testing.T) {
+	s := newAuditTestServer(t)
+	sendWithKey(s, http.MethodGet, "/runs", "run-key", "")
+	sendWithKey(s, http.MethodGet, "/runs", "wrong-key", "")
+
+	// Failed authentication is recorded too
+	events := auditEvents(t, s, "?action=request")
+	require.Len(t, events, 2)
+	assert.Equal(t, "API key 'ci'", events[0].Actor)
+	assert.Equal(t, "unauthenticated", events[1].Actor)
+	assert.Equal(t, http.StatusUnauthorized, events[1].Status)
+
+	w := sendWithKey(s, http.MethodGet, "/audit?format=csv&action=request&actor="+url.QueryEscape("API key 'ci'"), "admin-key", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, auditCSVHeader, rows[0])
+	assert.Equal(t, "API key 'ci'", rows[1][3])
+
+	w = sendWithKey(s, http.MethodGet, "/audit?since=yesterday", "admin-key", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = sendWithKey(s, http.MethodGet, "/audit?format=xml", "admin-key", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = sendWithKey(s, http.MethodGet, "/audit", "run-key", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuditNotEnabled(t *testing.T) {
+	s := newAPITestServer(t)
+	w := apiRequest(s.handleAudit, http.MethodGet, "/audit", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAuditWorkspaceEvents(t *testing.T) {
+	s := newAuditTestServer(t)
+	s.record(audit.Event{Action: audit.ActionRequest, Actor: "ops"})
+	ws := &Server{config: s.config, workspace: &config.Workspace{Name: "team"}, audit: s.audit}
+	ws.record(audit.Event{Action: audit.ActionRequest, Actor: "ops"})
+
+	w := apiRequest(ws.handleAudit, http.MethodGet, "/audit", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"workspace":"team"`)
+}
@@ -1,59 +1,196 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kris-hansen/comanda/utils/config"
 	"gopkg.in/yaml.v3"
 )
 
+// Scope levels; each scope includes the ones below it
+var scopeLevels = map[string]int{
+	config.ScopeRead:  1,
+	config.ScopeRun:   2,
+	config.ScopeAdmin: 3,
+}
+
+// principal is the caller a request was authenticated as
+type principal struct {
+	name      string // Shown in logs and errors
+	limitKey  string // Identifies the caller's rate limit bucket
+	scope     string
+	rateLimit int    // Requests per minute; 0 for no limit
+	workspace string // The workspace the caller is confined to, if any
+}
+
+type principalKey struct{}
+
+// checkAuth reports whether a request may proceed, writing the error
+// response if not. See authorize.
 func checkAuth(serverConfig *config.ServerConfig, w http.ResponseWriter, r *http.Request) bool {
-	if !serverConfig.Enabled {
+	_, ok := authorize(serverConfig, w, r)
+	return ok
+}
+
+// authorize authenticates a request, checks that the caller's scope covers
+// it and applies the caller's rate limit. It returns the request carrying the
+// caller, so handlers that check again are not authenticated or counted twice.
+func authorize(serverConfig *config.ServerConfig, w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if !serverConfig.AuthRequired() {
 		config.VerboseLog("Authentication disabled")
 		config.DebugLog("Auth check skipped: server auth is disabled")
-		return true
+		return r, true
+	}
+	if _, ok := r.Context().Value(principalKey{}).(*principal); ok {
+		return r, true
 	}
 
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		config.VerboseLog("Missing Authorization header")
 		config.DebugLog("Auth failed: no Authorization header present in request")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ProcessResponse{
-			Success: false,
-			Error:   "Authorization header required",
-		})
-		return false
+		writeAuthError(w, http.StatusUnauthorized, "Authorization header required")
+		return r, false
 	}
 
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
 		config.VerboseLog("Invalid authorization header format")
 		config.DebugLog("Auth failed: malformed Authorization header: %s", maskToken(authHeader))
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ProcessResponse{
-			Success: false,
-			Error:   "Invalid authorization header format",
-		})
-		return false
+		writeAuthError(w, http.StatusUnauthorized, "Invalid authorization header format")
+		return r, false
 	}
 
-	if parts[1] != serverConfig.BearerToken {
+	caller, err := authenticate(serverConfig, parts[1])
+	if err != nil {
 		config.VerboseLog("Invalid bearer token")
-		config.DebugLog("Auth failed: invalid bearer token provided")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ProcessResponse{
-			Success: false,
-			Error:   "Invalid bearer token",
-		})
-		return false
+		config.DebugLog("Auth failed: %v", err)
+		writeAuthError(w, http.StatusUnauthorized, err.Error())
+		return r, false
+	}
+
+	if need := requiredScope(r); scopeLevels[caller.scope] < scopeLevels[need] {
+		config.VerboseLog("Insufficient scope for %s", caller.name)
+		config.DebugLog("Auth failed: %s has scope '%s', %s %s needs '%s'", caller.name, caller.scope, r.Method, r.URL.Path, need)
+		writeAuthError(w, http.StatusForbidden,
+			fmt.Sprintf("%s has scope '%s'; this request needs '%s'", caller.name, caller.scope, need))
+		return r, false
+	}
+
+	if ok, retry := limiter.allow(caller.limitKey, caller.rateLimit, time.Now()); !ok {
+		config.VerboseLog("Rate limit exceeded for %s", caller.name)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		writeAuthError(w, http.StatusTooManyRequests,
+			fmt.Sprintf("rate limit of %d requests per minute exceeded for %s", caller.rateLimit, caller.name))
+		return r, false
 	}
 
 	config.VerboseLog("Authentication successful")
-	config.DebugLog("Auth successful: valid bearer token")
-	return true
+	config.DebugLog("Auth successful: %s with scope '%s'", caller.name, caller.scope)
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, caller)), true
+}
+
+// authenticate identifies the caller presenting token: the server's bearer
+// token, one of its API keys, a token issued at OIDC sign-in or a valid JWT
+func authenticate(serverConfig *config.ServerConfig, token string) (*principal, error) {
+	if serverConfig.BearerToken != "" && tokensEqual(token, serverConfig.BearerToken) {
+		return &principal{name: "bearer token", limitKey: "bearer", scope: config.ScopeAdmin}, nil
+	}
+	for _, key := range serverConfig.APIKeys {
+		if key.Key != "" && tokensEqual(token, key.Key) {
+			return &principal{
+				name:      fmt.Sprintf("API key '%s'", key.Name),
+				limitKey:  "key:" + key.Name,
+				scope:     key.Scope,
+				rateLimit: key.RateLimit,
+				workspace: key.Workspace,
+			}, nil
+		}
+	}
+	if serverConfig.OIDC != nil && looksLikeJWT(token) {
+		caller, err := sessionPrincipal(serverConfig.OIDC, token, time.Now())
+		if err == nil {
+			return caller, nil
+		}
+		if serverConfig.JWT == nil {
+			return nil, fmt.Errorf("Invalid bearer token: %v", err)
+		}
+	}
+	if serverConfig.JWT != nil && looksLikeJWT(token) {
+		claims, err := validateJWT(serverConfig.JWT, token, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bearer token: %v", err)
+		}
+		claim := serverConfig.JWT.ScopeClaim
+		if claim == "" {
+			claim = "scope"
+		}
+		workspaceClaim := serverConfig.JWT.WorkspaceClaim
+		if workspaceClaim == "" {
+			workspaceClaim = "workspace"
+		}
+		workspace, _ := claims.all[workspaceClaim].(string)
+		caller := &principal{
+			name:      fmt.Sprintf("token subject '%s'", claims.Subject),
+			limitKey:  "jwt:" + claims.Subject,
+			rateLimit: serverConfig.JWT.RateLimit,
+			workspace: workspace,
+		}
+		for _, scope := range claims.scopes(claim) {
+			if scopeLevels[scope] > scopeLevels[caller.scope] {
+				caller.scope = scope
+			}
+		}
+		return caller, nil
+	}
+	return nil, errors.New("Invalid bearer token")
+}
+
+// requiredScope returns the scope a request needs. Reading needs the read
+// scope and running workflows, or cancelling or approving runs, the run
+// scope; everything else changes the server and needs admin.
+func requiredScope(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/env/") || strings.HasPrefix(path, "/audit"):
+		return config.ScopeAdmin
+	case path == "/process" || path == "/yaml/process" || path == "/generate":
+		return config.ScopeRun
+	case (path == "/runs" || path == "/v1/chat/completions") && r.Method == http.MethodPost:
+		return config.ScopeRun
+	case strings.HasPrefix(path, "/runs/") && r.Method == http.MethodDelete:
+		return config.ScopeRun // Whoever may start runs may cancel them
+	case strings.HasPrefix(path, "/runs/") && strings.HasSuffix(path, "/approval") && r.Method == http.MethodPost:
+		return config.ScopeRun
+	case path == "/workflows" && r.URL.Query().Get("dryRun") == "true":
+		return config.ScopeRead // Only checks the workflow
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return config.ScopeRead
+	}
+	return config.ScopeAdmin
+}
+
+// tokensEqual compares tokens in constant time
+func tokensEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// writeAuthError writes an authentication or authorization failure
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ProcessResponse{
+		Success: false,
+		Error:   message,
+	})
 }
 
 // containsStdin checks if a string contains STDIN, handling variable assignments
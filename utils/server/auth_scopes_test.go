@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// signJWT builds a token with the given claims, signed by sign
+func signJWT(alg string, claims map[string]interface{}, sign func(signed string) []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(signed))
+}
+
+func hs256(secret string) func(string) []byte {
+	return func(signed string) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	}
+}
+
+// authStatus sends a request through authorize and returns the status code
+func authStatus(serverConfig *config.ServerConfig, method, target, token string) int {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	if _, ok := authorize(serverConfig, w, r); !ok {
+		return w.Code
+	}
+	return http.StatusOK
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	serverConfig := &config.ServerConfig{
+		BearerToken: "legacy",
+		APIKeys: []config.APIKey{
+			{Name: "viewer", Key: "read-key", Scope: config.ScopeRead},
+			{Name: "ci", Key: "run-key", Scope: config.ScopeRun},
+		},
+	}
+	assert.True(t, serverConfig.AuthRequired())
+
+	tests := []struct {
+		method, target, token string
+		want                  int
+	}{
+		{http.MethodGet, "/runs", "", http.StatusUnauthorized},
+		{http.MethodGet, "/runs", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/runs", "read-key", http.StatusOK},
+		{http.MethodPost, "/runs", "read-key", http.StatusForbidden},
+		{http.MethodGet, "/process?filename=x.yaml", "read-key", http.StatusForbidden},
+		{http.MethodPost, "/runs", "run-key", http.StatusOK},
+		{http.MethodPost, "/runs/20250102-150405-3fa2/approval", "read-key", http.StatusForbidden},
+		{http.MethodPost, "/runs/20250102-150405-3fa2/approval", "run-key", http.StatusOK},
+		{http.MethodPost, "/yaml/process", "run-key", http.StatusOK},
+		{http.MethodPut, "/workflows/x", "run-key", http.StatusForbidden},
+		{http.MethodPost, "/workflows", "read-key", http.StatusForbidden},
+		{http.MethodPost, "/workflows?dryRun=true", "read-key", http.StatusOK},
+		{http.MethodPost, "/env/decrypt", "run-key", http.StatusForbidden},
+		{http.MethodGet, "/audit", "read-key", http.StatusForbidden},
+		{http.MethodGet, "/metrics", "read-key", http.StatusOK},
+		{http.MethodPost, "/v1/chat/completions", "read-key", http.StatusForbidden},
+		{http.MethodPost, "/v1/chat/completions", "run-key", http.StatusOK},
+		{http.MethodPut, "/workflows/x", "legacy", http.StatusOK},
+	}
+	for _, tt := range tests {
+		got := authStatus(serverConfig, tt.method, tt.target, tt.token)
+		assert.Equal(t, tt.want, got, "%s %s with %q", tt.method, tt.target, tt.token)
+	}
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	serverConfig := &config.ServerConfig{
+		APIKeys: []config.APIKey{{Name: "rate-limit-test", Key: "limited", Scope: config.ScopeRead, RateLimit: 2}},
+	}
+	assert.Equal(t, http.StatusOK, authStatus(serverConfig, http.MethodGet, "/runs", "limited"))
+	assert.Equal(t, http.StatusOK, authStatus(serverConfig, http.MethodGet, "/runs", "limited"))
+
+	r := httptest.NewRequest(http.MethodGet, "/runs", nil)
+	r.Header.Set("Authorization", "Bearer limited")
+	w := httptest.NewRecorder()
+	_, ok := authorize(serverConfig, w, r)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestAuthorizeCountsRequestOnce(t *testing.T) {
+	serverConfig := &config.ServerConfig{
+		APIKeys: []config.APIKey{{Name: "count-once-test", Key: "once", Scope: config.ScopeAdmin, RateLimit: 1}},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/list", nil)
+	r.Header.Set("Authorization", "Bearer once")
+	r, ok := authorize(serverConfig, httptest.NewRecorder(), r)
+	assert.True(t, ok)
+	// Handlers check auth again with the request they were given
+	assert.True(t, checkAuth(serverConfig, httptest.NewRecorder(), r))
+}
+
+func TestJWTAuth(t *testing.T) {
+	serverConfig := &config.ServerConfig{
+		JWT: &config.JWTConfig{Secret: "s3cret", Issuer: "https://id.example.com", Audience: "comanda"},
+	}
+	now := time.Now()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "alice",
+			"iss":   "https://id.example.com",
+			"aud":   []string{"comanda", "other"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "profile run",
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	valid := signJWT("HS256", claims(nil), hs256("s3cret"))
+	assert.Equal(t, http.StatusOK, authStatus(serverConfig, http.MethodPost, "/runs", valid))
+	assert.Equal(t, http.StatusForbidden, authStatus(serverConfig, http.MethodDelete, "/workflows/x", valid))
+
+	rejected := map[string]string{
+		"wrong secret": signJWT("HS256", claims(nil), hs256("guess")),
+		"expired":      signJWT("HS256", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()}), hs256("s3cret")),
+		"not yet":      signJWT("HS256", claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()}), hs256("s3cret")),
+		"issuer":       signJWT("HS256", claims(map[string]interface{}{"iss": "https://evil.example.com"}), hs256("s3cret")),
+		"audience":     signJWT("HS256", claims(map[string]interface{}{"aud": "someone-else"}), hs256("s3cret")),
+		"alg none":     signJWT("none", claims(nil), func(string) []byte { return nil }),
+	}
+	for name, token := range rejected {
+		assert.Equal(t, http.StatusUnauthorized, authStatus(serverConfig, http.MethodGet, "/runs", token), name)
+	}
+
+	noScope := signJWT("HS256", claims(map[string]interface{}{"scope": "profile"}), hs256("s3cret"))
+	assert.Equal(t, http.StatusForbidden, authStatus(serverConfig, http.MethodGet, "/runs", noScope))
+}
+
+func TestJWTPublicKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	publicPEM := func(key interface{}) string {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		assert.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	claims := map[string]interface{}{"sub": "svc", "roles": []string{"admin"}}
+
+	rsaToken := signJWT("RS256", claims, func(signed string) []byte {
+		digest := sha256.Sum256([]byte(signed))
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		return sig
+	})
+	esToken := signJWT("ES256", claims, func(signed string) []byte {
+		digest := sha256.Sum256([]byte(signed))
+		r, s, _ := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	})
+
+	rsaConfig := &config.ServerConfig{JWT: &config.JWTConfig{PublicKey: publicPEM(&rsaKey.PublicKey), ScopeClaim: "roles"}}
+	assert.Equal(t, http.StatusOK, authStatus(rsaConfig, http.MethodDelete, "/workflows/x", rsaToken))
+	assert.Equal(t, http.StatusUnauthorized, authStatus(rsaConfig, http.MethodGet, "/runs", esToken))
+
+	ecConfig := &config.ServerConfig{JWT: &config.JWTConfig{PublicKey: publicPEM(&ecKey.PublicKey), ScopeClaim: "roles"}}
+	assert.Equal(t, http.StatusOK, authStatus(ecConfig, http.MethodDelete, "/workflows/x", esToken))
+
+	// A token signed with the public key as an HMAC secret is refused
+	confused := signJWT("HS256", claims, hs256(rsaConfig.JWT.PublicKey))
+	assert.Equal(t, http.StatusUnauthorized, authStatus(rsaConfig, http.MethodGet, "/runs", confused))
+}
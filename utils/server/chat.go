@@ -0,0 +1,294 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// directChatWorkflow is the name runs answering a chat request with a
+// model directly are recorded under
+const directChatWorkflow = "chat"
+
+// ChatContent is the text of a chat message. Clients send it as a string
+// or as a list of content parts, of which the text parts are kept.
+type ChatContent string
+
+// UnmarshalJSON accepts a string or a list of content parts
+func (c *ChatContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = ChatContent(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or a list of content parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*c = ChatContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// ChatMessage is one message of a conversation
+type ChatMessage struct {
+	Role    string      `json:"role"` // system, user or assistant
+	Content ChatContent `json:"content"`
+}
+
+// ChatCompletionRequest is an OpenAI-style chat completion request
+type ChatCompletionRequest struct {
+	Model    string        `json:"model"` // A model or workflow the chat section maps requests to
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream,omitempty"` // Send the answer as server-sent events
+	User     string        `json:"user,omitempty"`
+}
+
+// ChatChoice is an answer of a chat completion. Streamed chunks carry
+// Delta instead of Message.
+type ChatChoice struct {
+	Index        int          `json:"index"`
+	Message      *ChatMessage `json:"message,omitempty"`
+	Delta        *ChatMessage `json:"delta,omitempty"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+}
+
+// ChatUsage counts the tokens a chat completion used
+type ChatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatCompletionResponse is an OpenAI-style chat completion, or one chunk
+// of a streamed one
+type ChatCompletionResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"` // chat.completion, or chat.completion.chunk when streamed
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   *ChatUsage   `json:"usage,omitempty"`
+}
+
+// ChatModel is a model clients may name in chat completion requests
+type ChatModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ChatModelList lists the models clients may name
+type ChatModelList struct {
+	Object string      `json:"object"`
+	Data   []ChatModel `json:"data"`
+}
+
+// ChatError is an error in the shape OpenAI clients expect
+type ChatError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+	} `json:"error"`
+}
+
+// sendChatError writes an error OpenAI clients can read
+func sendChatError(w http.ResponseWriter, status int, code, message string) {
+	var resp ChatError
+	resp.Error.Message = message
+	resp.Error.Type = "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		resp.Error.Type = "server_error"
+	}
+	resp.Error.Code = code
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleChatCompletions serves /v1/chat/completions, answering a chat
+// completion request with a run of the workflow or model the request's
+// model maps to. The run is queued, limited, recorded and audited like one
+// started through POST /runs.
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendChatError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+	if s.config.Chat == nil {
+		sendChatError(w, http.StatusNotFound, "", "Chat completions are not enabled; add a chat section to the server configuration")
+		return
+	}
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendChatError(w, http.StatusBadRequest, "", fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if len(req.Messages) == 0 {
+		sendChatError(w, http.StatusBadRequest, "", "messages is required")
+		return
+	}
+	name, content, ok := s.chatWorkflow(req.Model)
+	if !ok {
+		sendChatError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("The model '%s' does not exist", req.Model))
+		return
+	}
+
+	runReq := RunRequest{Workflow: name, Input: chatInput(req.Messages)}
+	ctx := withActor(traceContext(r), s.requestActor(r))
+	var job *runJob
+	var err error
+	if content != nil {
+		job, err = s.submitWorkflow(ctx, name, content, true, runReq, "")
+	} else {
+		job, err = s.queueRun(ctx, runReq)
+	}
+	if err != nil {
+		var reqErr *runRequestError
+		if !errors.As(err, &reqErr) {
+			sendChatError(w, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		if reqErr.status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "30")
+		}
+		sendChatError(w, reqErr.status, "", reqErr.message)
+		return
+	}
+	w.Header().Set("X-Comanda-Run", job.recorder.ID())
+
+	select {
+	case <-job.done:
+	case <-r.Context().Done():
+		return // The run carries on and is recorded
+	}
+	run := job.recorder.Run()
+	output, runErr := job.result()
+	if runErr != nil {
+		sendChatError(w, http.StatusBadGateway, "", fmt.Sprintf("Run %s failed: %s", run.ID, run.Error))
+		return
+	}
+
+	prompt, completion := run.Tokens()
+	resp := ChatCompletionResponse{
+		ID:      "chatcmpl-" + run.ID,
+		Object:  "chat.completion",
+		Created: run.Started.Unix(),
+		Model:   req.Model,
+		Choices: []ChatChoice{{Message: &ChatMessage{Role: "assistant", Content: ChatContent(output)}, FinishReason: "stop"}},
+		Usage:   &ChatUsage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion},
+	}
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	// Runs answer all at once, so the stream is the whole answer in one
+	// chunk followed by the end of the stream
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	resp.Object = "chat.completion.chunk"
+	resp.Choices[0].Delta, resp.Choices[0].Message = resp.Choices[0].Message, nil
+	data, _ := json.Marshal(resp)
+	fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// handleChatModels serves /v1/models, listing the models chat completion
+// requests may name
+func (s *Server) handleChatModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendChatError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+	if s.config.Chat == nil {
+		sendChatError(w, http.StatusNotFound, "", "Chat completions are not enabled; add a chat section to the server configuration")
+		return
+	}
+	chat := s.config.Chat
+	var names []string
+	for name := range chat.Models {
+		names = append(names, name)
+	}
+	if chat.Direct && s.env() != nil {
+		names = append(names, s.env().GetAllConfiguredModels()...)
+	}
+	if chat.Workflow != "" {
+		names = append(names, chat.Workflow)
+	}
+	sort.Strings(names)
+
+	list := ChatModelList{Object: "list", Data: []ChatModel{}}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			list.Data = append(list.Data, ChatModel{ID: name, Object: "model", Created: time.Now().Unix(), OwnedBy: "comanda"})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// chatWorkflow returns the stored workflow answering requests for model,
+// or for a model answered directly, the name to record its runs under and
+// a one-step workflow sending the conversation to it. It reports false
+// when nothing answers model.
+func (s *Server) chatWorkflow(model string) (string, []byte, bool) {
+	chat := s.config.Chat
+	if workflow, ok := chat.Models[model]; ok {
+		return workflow, nil, true
+	}
+	if chat.Direct && model != "" && s.env() != nil {
+		for _, configured := range s.env().GetAllConfiguredModels() {
+			if configured != model {
+				continue
+			}
+			content, _ := yaml.Marshal(map[string]interface{}{
+				directChatWorkflow: map[string]string{
+					"input":  "STDIN",
+					"model":  model,
+					"action": "Reply to the last message of this conversation as the assistant.",
+					"output": "STDOUT",
+				},
+			})
+			return directChatWorkflow, content, true
+		}
+	}
+	if chat.Workflow != "" {
+		return chat.Workflow, nil, true
+	}
+	return "", nil, false
+}
+
+// chatInput renders a conversation as a run's input. A lone user message
+// is passed as it is; longer conversations are written out turn by turn.
+func chatInput(messages []ChatMessage) string {
+	if len(messages) == 1 && messages[0].Role == "user" {
+		return string(messages[0].Content)
+	}
+	turns := make([]string, len(messages))
+	for i, m := range messages {
+		turns[i] = fmt.Sprintf("%s: %s", m.Role, m.Content)
+	}
+	return strings.Join(turns, "\n\n")
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatCompletionsWorkflow(t *testing.T) {
+	s := newScheduleTestServer(t)
+	s.config.Chat = &config.ChatConfig{Models: map[string]string{"summarizer": "summary"}}
+
+	w := apiRequest(s.handleChatCompletions, http.MethodPost, "/v1/chat/completions", map[string]interface{}{
+		"model":    "summarizer",
+		"messages": []map[string]interface{}{{"role": "user", "content": []map[string]string{{"type": "text", "text": "the report"}}}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp ChatCompletionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "chat.completion", resp.Object)
+	assert.Equal(t, "summarizer", resp.Model)
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "assistant", resp.Choices[0].Message.Role)
+	assert.Contains(t, string(resp.Choices[0].Message.Content), "Shorten this")
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason)
+
+	// The answer is a recorded run of the workflow
+	runs := scheduleRuns(t, s)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "summary", runs[0].Workflow)
+	assert.Equal(t, "chatcmpl-"+runs[0].ID, resp.ID)
+	assert.Equal(t, runs[0].ID, w.Header().Get("X-Comanda-Run"))
+
+	w = apiRequest(s.handleChatCompletions, http.MethodPost, "/v1/chat/completions", ChatCompletionRequest{
+		Model: "gpt-4o", Messages: []ChatMessage{{Role: "user", Content: "hi"}},
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"model_not_found"`)
+}
+
+func TestChatCompletionsDirect(t *testing.T) {
+	s := newAPITestServer(t)
+	s.config.Chat = &config.ChatConfig{Direct: true}
+
+	w := apiRequest(s.handleChatCompletions, http.MethodPost, "/v1/chat/completions", ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []ChatMessage{{Role: "system", Content: "Be brief"}, {Role: "user", Content: "What is comanda?"}},
+		Stream:   true,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	require.Len(t, events, 2)
+	assert.Equal(t, "data: [DONE]", events[1])
+
+	var chunk ChatCompletionResponse
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(events[0], "data: ")), &chunk))
+	assert.Equal(t, "chat.completion.chunk", chunk.Object)
+	require.Len(t, chunk.Choices, 1)
+	assert.Contains(t, string(chunk.Choices[0].Delta.Content), "Reply to the last message")
+
+	runs := scheduleRuns(t, s)
+	require.Len(t, runs, 1)
+	assert.Equal(t, directChatWorkflow, runs[0].Workflow)
+	assert.Equal(t, "gpt-4o", runs[0].Steps[0].Model)
+
+	// Run limits apply as they do to POST /runs
+	s.config.RunLimits = config.RunLimits{MaxTokens: 2}
+	w = apiRequest(s.handleChatCompletions, http.MethodPost, "/v1/chat/completions", ChatCompletionRequest{
+		Model: "gpt-4o", Messages: []ChatMessage{{Role: "user", Content: ChatContent(strings.Repeat("word ", 10))}},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"type":"invalid_request_error"`)
+}
+
+func TestChatModels(t *testing.T) {
+	s := newAPITestServer(t)
+	w := apiRequest(s.handleChatModels, http.MethodGet, "/v1/models", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	s.config.Chat = &config.ChatConfig{Workflow: "assistant", Models: map[string]string{"summarizer": "summary"}, Direct: true}
+	w = apiRequest(s.handleChatModels, http.MethodGet, "/v1/models", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list ChatModelList
+	json.NewDecoder(w.Body).Decode(&list)
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []string{"assistant", "gpt-4o", "summarizer"}, ids)
+}
+
+func TestChatInput(t *testing.T) {
+	assert.Equal(t, "hi", chatInput([]ChatMessage{{Role: "user", Content: "hi"}}))
+	assert.Equal(t, "system: Be brief\n\nuser: hi", chatInput([]ChatMessage{{Role: "system", Content: "Be brief"}, {Role: "user", Content: "hi"}}))
+}
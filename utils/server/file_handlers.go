@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -178,6 +179,12 @@ func (s *Server) handleFileOperation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Multipart requests upload files rather than create one from JSON
+	if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		s.handleMultipartUpload(w, r)
+		return
+	}
+
 	var filePath string
 	var content string
 
@@ -524,13 +531,19 @@ func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse multipart form with 32MB limit
+	// Parse multipart form within the upload size limit
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.Uploads.MaxBytes())
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		config.VerboseLog("Error parsing multipart form: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		status, message := http.StatusBadRequest, "Error parsing form data"
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status, message = uploadError(err, s.config.Uploads)
+		}
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(FileUploadResponse{
 			Success: false,
-			Error:   "Error parsing form data",
+			Error:   message,
 		})
 		return
 	}
@@ -548,6 +561,21 @@ func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
+	// Check the file's type from its content
+	mimeType, content, err := sniffUpload(file)
+	if err == nil {
+		err = checkUploadType(mimeType, s.config.Uploads.AllowedTypes)
+	}
+	if err != nil {
+		config.VerboseLog("Rejected upload: %v", err)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(FileUploadResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	// Get path from form or use filename
 	filePath := r.FormValue("path")
 	if filePath == "" {
@@ -597,7 +625,7 @@ func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 	defer dst.Close()
 
 	// Copy file contents
-	if _, err := io.Copy(dst, file); err != nil {
+	if _, err := io.Copy(dst, content); err != nil {
 		config.VerboseLog("Error copying file: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(FileUploadResponse{
@@ -619,6 +647,7 @@ func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fileInfo.MimeType = mimeType
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(FileUploadResponse{
 		Success: true,
@@ -761,9 +790,9 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// First unmarshal into a map to preserve step names
-	var rawConfig map[string]processor.StepConfig
-	if err := yaml.Unmarshal([]byte(req.Content), &rawConfig); err != nil {
+	// Unmarshal into the DSL config so step order and workflow-level sections are preserved
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal([]byte(req.Content), &dslConfig); err != nil {
 		if req.Streaming {
 			w.Header().Set("Content-Type", "text/event-stream")
 			w.Header().Set("Cache-Control", "no-cache")
@@ -791,20 +820,13 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert map to ordered Steps slice
-	var dslConfig processor.DSLConfig
-	for name, config := range rawConfig {
-		dslConfig.Steps = append(dslConfig.Steps, processor.Step{
-			Name:   name,
-			Config: config,
-		})
-	}
-
 	// Get runtime directory from query parameter
 	runtimeDir := r.URL.Query().Get("runtimeDir")
 
 	// Create processor instance with validation enabled and runtime directory
-	proc := processor.NewProcessor(&dslConfig, s.envConfig, s.config, true, runtimeDir)
+	proc := processor.NewProcessor(&dslConfig, s.env(), s.config, true, runtimeDir)
+	proc.SetContext(traceContext(r))
+	useResponseCache(proc, s.env())
 
 	// Set input if provided
 	if req.Input != "" {
@@ -871,6 +893,9 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 				}
 				return
 			case update := <-progressChan:
+				if typed, _ := sseWriter.SendProgressEvent(update); typed {
+					continue
+				}
 				switch update.Type {
 				case processor.ProgressSpinner:
 					sseWriter.SendSpinner(update.Message)
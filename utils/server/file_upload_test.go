@@ -177,3 +177,86 @@ func TestHandleFileUpload(t *testing.T) {
 		}
 	})
 }
+
+// multipartBody builds a multipart form with a file field for each name
+func multipartBody(t *testing.T, files map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, content)
+	}
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+func TestMultipartFilesUpload(t *testing.T) {
+	s := newAPITestServer(t)
+	s.config.Uploads = config.Uploads{MaxSizeMB: 1, AllowedTypes: []string{"text/*", "application/pdf"}}
+
+	upload := func(files map[string]string) *httptest.ResponseRecorder {
+		body, contentType := multipartBody(t, files)
+		req := httptest.NewRequest(http.MethodPost, "/files?runtimeDir=inputs", body)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.handleFileOperation(w, req)
+		return w
+	}
+
+	w := upload(map[string]string{"notes.txt": "meeting notes", "report.pdf": "%PDF-1.7\n..."})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp MultiUploadResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Files) != 2 {
+		t.Fatalf("expected 2 files, got %+v", resp.Files)
+	}
+	types := map[string]string{}
+	for _, f := range resp.Files {
+		types[f.Name] = f.MimeType
+	}
+	if types["report.pdf"] != "application/pdf" || !strings.HasPrefix(types["notes.txt"], "text/plain") {
+		t.Errorf("unexpected detected types: %v", types)
+	}
+	if data, err := os.ReadFile(filepath.Join(s.config.DataDir, "inputs", "notes.txt")); err != nil || string(data) != "meeting notes" {
+		t.Errorf("notes.txt = %q, %v", data, err)
+	}
+
+	// Types are judged from content, not the file name, and a refused file
+	// means none of the request's files are kept
+	w = upload(map[string]string{"a.txt": "fine", "b.txt": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"})
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(s.config.DataDir, "inputs", "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected a.txt to be removed, got %v", err)
+	}
+
+	w = upload(map[string]string{"big.txt": strings.Repeat("x", 2<<20)})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", w.Code)
+	}
+
+	// Directories in file names are dropped, so files stay in the runtime directory
+	w = upload(map[string]string{"../../escape.txt": "x"})
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(s.config.DataDir, "inputs", "escape.txt")); err != nil {
+		t.Errorf("expected escape.txt in the runtime directory: %v", err)
+	}
+
+	body, contentType := multipartBody(t, map[string]string{"x.txt": "x"})
+	req := httptest.NewRequest(http.MethodPost, "/files?runtimeDir=../outside", body)
+	req.Header.Set("Content-Type", contentType)
+	w = httptest.NewRecorder()
+	s.handleFileOperation(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a runtime directory outside the data directory, got %d", w.Code)
+	}
+}
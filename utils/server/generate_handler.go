@@ -59,7 +59,7 @@ func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
 	// Determine which model to use
 	modelForGeneration := req.Model
 	if modelForGeneration == "" {
-		modelForGeneration = s.envConfig.DefaultGenerationModel
+		modelForGeneration = s.env().DefaultGenerationModel
 	}
 	if modelForGeneration == "" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -99,7 +99,7 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 	}
 
 	// Attempt to configure the provider with API key from envConfig
-	providerConfig, err := s.envConfig.GetProviderConfig(provider.Name())
+	providerConfig, err := s.env().GetProviderConfig(provider.Name())
 	if err != nil {
 		// If provider is not in envConfig, it might be a public one like Ollama
 		config.VerboseLog("Provider %s not found in env configuration. Assuming it does not require an API key.", provider.Name())
@@ -222,9 +222,9 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 	// Log YAML content details before parsing
 	config.DebugLog("Processing YAML content: length=%d bytes", len(yamlContent))
 
-	// First unmarshal into a map to preserve step names (same as CLI)
-	var rawConfig map[string]processor.StepConfig
-	if err := yaml.Unmarshal(yamlContent, &rawConfig); err != nil {
+	// Unmarshal into the DSL config (same as CLI) so workflow-level sections are honored
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(yamlContent, &dslConfig); err != nil {
 		config.VerboseLog("Error parsing YAML: %v", err)
 		config.DebugLog("YAML parse error: content_preview='%s' error=%v", truncateString(string(yamlContent), 200), err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -249,15 +249,9 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 		return
 	}
 
-	// Convert map to ordered Steps slice (same as CLI)
-	var dslConfig processor.DSLConfig
-	config.DebugLog("Converting YAML to DSL config: step_count=%d", len(rawConfig))
-	for name, stepConfig := range rawConfig {
-		config.DebugLog("Processing step: name=%s model=%v action=%v", name, stepConfig.Model, stepConfig.Action)
-		dslConfig.Steps = append(dslConfig.Steps, processor.Step{
-			Name:   name,
-			Config: stepConfig,
-		})
+	config.DebugLog("Parsed YAML to DSL config: step_count=%d", len(dslConfig.Steps))
+	for _, step := range dslConfig.Steps {
+		config.DebugLog("Processing step: name=%s model=%v action=%v", step.Name, step.Config.Model, step.Config.Action)
 	}
 
 	// Get runtime directory from query parameter or calculate from path
@@ -279,6 +273,8 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 	// Create and configure processor with runtime directory
 	config.DebugLog("Creating processor instance with validation enabled")
 	proc := processor.NewProcessor(&dslConfig, envConfig, serverConfig, true, runtimeDir)
+	proc.SetContext(traceContext(r))
+	useResponseCache(proc, envConfig)
 	config.DebugLog("Processor created successfully with config: steps=%d, runtimeDir=%s", len(dslConfig.Steps), runtimeDir)
 
 	// Handle POST input with detailed logging
@@ -435,6 +431,9 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 					config.DebugLog("Warning: SSE writer is nil while receiving progress update")
 					continue
 				}
+				if typed, _ := sw.SendProgressEvent(update); typed {
+					continue
+				}
 				switch update.Type {
 				case processor.ProgressStep:
 					// For initial and completion messages, send as plain text
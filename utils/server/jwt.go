@@ -0,0 +1,249 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// jwtLeeway allows for clock differences between the issuer and the server
+const jwtLeeway = time.Minute
+
+// jwtClaims holds the registered claims checked on every token, along with
+// all claims so the configured scope claim can be read
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  interface{} `json:"aud"` // A string or a list of strings
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	all       map[string]interface{}
+}
+
+// looksLikeJWT reports whether a bearer token has the three-part JWT shape
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// parsedJWT is a token split into the parts its signature and claims are
+// checked with
+type parsedJWT struct {
+	alg       string
+	kid       string // Names the issuer's signing key, when it has several
+	signed    string // The header and payload the signature covers
+	signature []byte
+	claims    *jwtClaims
+}
+
+// parseJWT decodes a token without checking its signature or claims
+func parseJWT(token string) (*parsedJWT, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid token signature encoding")
+	}
+	claims := &jwtClaims{}
+	if err := decodeJWTPart(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if err := decodeJWTPart(parts[1], &claims.all); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	return &parsedJWT{
+		alg:       header.Alg,
+		kid:       header.Kid,
+		signed:    parts[0] + "." + parts[1],
+		signature: signature,
+		claims:    claims,
+	}, nil
+}
+
+// validateJWT checks a token's signature and claims against cfg and returns
+// its claims
+func validateJWT(cfg *config.JWTConfig, token string, now time.Time) (*jwtClaims, error) {
+	jwt, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(cfg, jwt.alg, jwt.signed, jwt.signature); err != nil {
+		return nil, err
+	}
+	if err := jwt.claims.check(cfg.Issuer, cfg.Audience, now); err != nil {
+		return nil, err
+	}
+	return jwt.claims, nil
+}
+
+// check checks the token's lifetime, and its issuer and audience when they
+// are set
+func (c *jwtClaims) check(issuer, audience string, now time.Time) error {
+	if c.ExpiresAt != nil && now.After(unixTime(*c.ExpiresAt).Add(jwtLeeway)) {
+		return errors.New("token has expired")
+	}
+	if c.NotBefore != nil && now.Add(jwtLeeway).Before(unixTime(*c.NotBefore)) {
+		return errors.New("token is not valid yet")
+	}
+	if issuer != "" && c.Issuer != issuer {
+		return fmt.Errorf("token issuer '%s' is not accepted", c.Issuer)
+	}
+	if audience != "" && !c.hasAudience(audience) {
+		return errors.New("token is not intended for this server")
+	}
+	return nil
+}
+
+// verifyJWTSignature checks the signature with the key configured for alg.
+// Only the algorithm matching the configured key is accepted, so a token
+// cannot choose to be checked against a public key as if it were a secret.
+func verifyJWTSignature(cfg *config.JWTConfig, alg, signed string, signature []byte) error {
+	switch alg {
+	case "HS256":
+		if cfg.Secret == "" {
+			return errors.New("HS256 tokens are not accepted")
+		}
+		if !hmac.Equal(signature, hs256Sum(cfg.Secret, signed)) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "RS256", "ES256":
+		key, err := parsePublicKey(cfg.PublicKey)
+		if err != nil {
+			return err
+		}
+		return verifyPublicKeySignature(key, alg, signed, signature)
+	default:
+		return fmt.Errorf("unsupported token algorithm '%s'", alg)
+	}
+}
+
+// verifyPublicKeySignature checks an RS256 or ES256 signature with an RSA
+// or ECDSA public key; alg must match the key's type
+func verifyPublicKeySignature(key interface{}, alg, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(signature) != 64 {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return errors.New("invalid token signature")
+		}
+	default:
+		return errors.New("unsupported public key type")
+	}
+	return nil
+}
+
+// issueJWT returns a token carrying claims, signed with HS256 using secret
+func issueJWT(secret string, claims map[string]interface{}) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(hs256Sum(secret, signed)), nil
+}
+
+// hs256Sum returns the HMAC-SHA256 of signed keyed with secret
+func hs256Sum(secret, signed string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// parsePublicKey decodes a PEM-encoded public key
+func parsePublicKey(data string) (interface{}, error) {
+	if data == "" {
+		return nil, errors.New("no public key is configured for signed tokens")
+	}
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid public key: no PEM data found")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, nil
+}
+
+// decodeJWTPart decodes a base64url-encoded JSON token segment into v
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// unixTime converts a NumericDate claim to a time
+func unixTime(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+// hasAudience reports whether the aud claim includes audience
+func (c *jwtClaims) hasAudience(audience string) bool {
+	switch aud := c.Audience.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scopes returns the values of the named claim, which may be a
+// space-separated string or a list of strings
+func (c *jwtClaims) scopes(claim string) []string {
+	switch v := c.all[claim].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var scopes []string
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				scopes = append(scopes, str)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
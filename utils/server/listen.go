@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listen opens the server's socket. A socket passed by systemd socket
+// activation is used when there is one, so connections wait in its backlog
+// while the server restarts. Otherwise addr is bound, with SO_REUSEPORT when
+// reusePort is set, so a new server can bind the port while this one
+// drains.
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	if ln, err := activatedListener(); ln != nil || err != nil {
+		return ln, err
+	}
+	if !reusePort {
+		return net.Listen("tcp", addr)
+	}
+	lc := net.ListenConfig{Control: reusePortControl}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// activatedListener returns the first socket systemd passed to the process,
+// or nil when it passed none
+func activatedListener() (net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if pid != strconv.Itoa(os.Getpid()) || fds == "" || fds == "0" {
+		return nil, nil
+	}
+	// Workflows' commands must not take the socket for their own
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(3, "listen-socket") // SD_LISTEN_FDS_START
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("error using the socket passed by systemd: %w", err)
+	}
+	return ln, nil
+}
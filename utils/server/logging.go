@@ -11,8 +11,9 @@ import (
 	"github.com/kris-hansen/comanda/utils/config"
 )
 
-// logger is a custom logger for HTTP requests, shared across the package
-var logger = log.New(os.Stdout, "", log.LstdFlags)
+// logger is a custom logger for HTTP requests, shared across the package.
+// It redacts secrets, such as bearer tokens in query strings.
+var logger = log.New(config.RedactWriter(os.Stdout), "", log.LstdFlags)
 
 func logRequest(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -27,7 +28,7 @@ func logRequest(handler http.HandlerFunc) http.HandlerFunc {
 
 		// Debug level logging - more detailed internal information
 		config.DebugLog("Request details:")
-		config.DebugLog("- Headers: %v", r.Header)
+		config.DebugLog("- Headers:\n%s", config.RedactHeaders(r.Header))
 		config.DebugLog("- Remote Address: %s", r.RemoteAddr)
 		config.DebugLog("- TLS: %v", r.TLS != nil)
 		config.DebugLog("- Content Length: %d", r.ContentLength)
@@ -44,10 +45,11 @@ func logRequest(handler http.HandlerFunc) http.HandlerFunc {
 		duration := time.Since(start)
 
 		// Basic log entry for all requests
-		logEntry := fmt.Sprintf("Request: method=%s path=%s query=%s auth=%s status=%d duration=%v",
+		logEntry := fmt.Sprintf("Request: method=%s path=%s query=%s client=%s auth=%s status=%d duration=%v",
 			r.Method,
 			r.URL.Path,
 			r.URL.RawQuery,
+			r.RemoteAddr,
 			authInfo,
 			wrapped.statusCode,
 			duration)
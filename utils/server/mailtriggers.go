@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/mailbox"
+)
+
+// mailTriggerBatch is the most messages a mail trigger starts runs for at
+// each check; the rest wait for the next one
+const mailTriggerBatch = 20
+
+// openMailbox connects to a mail trigger's mailbox; tests replace it
+var openMailbox = func(ctx context.Context, cfg config.MailboxConfig) (mailClient, error) {
+	return mailbox.Open(ctx, cfg)
+}
+
+// mailClient is the part of a mailbox connection mail triggers use
+type mailClient interface {
+	Search(folder string, q mailbox.Query) ([]uint32, error)
+	Fetch(uids []uint32) ([]mailbox.Message, error)
+	MarkSeen(folder string, uids []uint32) error
+	Close() error
+}
+
+// runMailTriggers checks the folder of each mail trigger at its interval
+// until ctx is cancelled
+func (s *Server) runMailTriggers(ctx context.Context) {
+	for _, trigger := range s.config.MailTriggers {
+		go func(trigger config.MailTrigger) {
+			for {
+				s.checkMailTrigger(ctx, trigger)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(trigger.PollInterval()):
+				}
+			}
+		}(trigger)
+	}
+}
+
+// checkMailTrigger starts a run of the trigger's workflow for each unread
+// message in its folder, oldest first. A message is marked as read once
+// its run is queued, so it starts one run; when a run can't be queued, it
+// and the later messages stay unread until the next check.
+func (s *Server) checkMailTrigger(ctx context.Context, trigger config.MailTrigger) {
+	target := s
+	if trigger.Workspace != "" {
+		var err error
+		if target, err = s.workspaceServer(trigger.Workspace); err != nil {
+			s.logf("Mail trigger %s: %v", trigger.Name, err)
+			return
+		}
+	}
+	cfg, err := s.env().Mailbox(trigger.Mailbox)
+	if err != nil {
+		s.logf("Mail trigger %s: %v", trigger.Name, err)
+		return
+	}
+	folder := cfg.FolderOr(trigger.Folder)
+
+	client, err := openMailbox(ctx, cfg)
+	if err != nil {
+		s.logf("Mail trigger %s: %v", trigger.Name, err)
+		return
+	}
+	defer client.Close()
+	uids, err := client.Search(folder, mailbox.Query{From: trigger.From, Subject: trigger.Subject, Unseen: true})
+	if err != nil {
+		s.logf("Mail trigger %s: %v", trigger.Name, err)
+		return
+	}
+	if len(uids) > mailTriggerBatch {
+		uids = uids[:mailTriggerBatch]
+	}
+	messages, err := client.Fetch(uids)
+	if err != nil {
+		s.logf("Mail trigger %s: %v", trigger.Name, err)
+		return
+	}
+
+	for _, msg := range messages {
+		req, err := target.mailRunRequest(trigger, msg)
+		if err != nil {
+			s.logf("Mail trigger %s: message %d: %v", trigger.Name, msg.UID, err)
+			return
+		}
+		job, err := target.queueRun(withActor(context.Background(), fmt.Sprintf("mail trigger '%s'", trigger.Name)), req)
+		if err != nil {
+			s.logf("Mail trigger %s: run not started for message %d: %v", trigger.Name, msg.UID, err)
+			return
+		}
+		if err := client.MarkSeen(folder, []uint32{msg.UID}); err != nil {
+			s.logf("Mail trigger %s: %v", trigger.Name, err)
+			return
+		}
+		s.logf("Mail trigger %s: started run %s of workflow %s for message from %s", trigger.Name, job.recorder.ID(), trigger.Workflow, msg.From)
+	}
+}
+
+// mailRunRequest returns the run a message starts: the rendered message as
+// input and the params the trigger reads from its fields. Attachments are
+// saved in a runtime directory of their own, which the run's relative file
+// paths resolve in.
+func (s *Server) mailRunRequest(trigger config.MailTrigger, msg mailbox.Message) (RunRequest, error) {
+	params := make(map[string]interface{}, len(trigger.Params))
+	for param, field := range trigger.Params {
+		value, ok := msg.Field(field)
+		if !ok {
+			return RunRequest{}, fmt.Errorf("param %s reads unknown message field '%s'", param, field)
+		}
+		params[param] = value
+	}
+	req := RunRequest{Workflow: trigger.Workflow, Input: msg.Render(), Params: params}
+	if len(msg.Attachments) == 0 {
+		return req, nil
+	}
+
+	req.RuntimeDir = filepath.Join("mail", trigger.Name, fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405"), msg.UID))
+	dir := filepath.Join(s.config.DataDir, req.RuntimeDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return RunRequest{}, fmt.Errorf("error creating runtime directory: %w", err)
+	}
+	for _, a := range msg.Attachments {
+		if err := os.WriteFile(filepath.Join(dir, a.Filename), a.Data, 0644); err != nil {
+			return RunRequest{}, fmt.Errorf("error saving attachment %s: %w", a.Filename, err)
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/mailbox"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMailClient serves unread messages and records those marked as read
+type fakeMailClient struct {
+	messages []mailbox.Message
+	query    mailbox.Query
+	seen     []uint32
+}
+
+func (f *fakeMailClient) Search(folder string, q mailbox.Query) ([]uint32, error) {
+	f.query = q
+	var uids []uint32
+	for _, msg := range f.messages {
+		uids = append(uids, msg.UID)
+	}
+	return uids, nil
+}
+
+func (f *fakeMailClient) Fetch(uids []uint32) ([]mailbox.Message, error) {
+	return f.messages, nil
+}
+
+func (f *fakeMailClient) MarkSeen(folder string, uids []uint32) error {
+	f.seen = append(f.seen, uids...)
+	return nil
+}
+
+func (f *fakeMailClient) Close() error {
+	return nil
+}
+
+func newMailTriggerTestServer(t *testing.T) (*Server, *fakeMailClient) {
+	t.Helper()
+	s := newAPITestServer(t)
+	s.envConfig.Mailboxes = map[string]config.MailboxConfig{"support": {Host: "imap.example.com", Username: "support"}}
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "push.yaml"), []byte(triggerWorkflow), 0644)
+
+	client := &fakeMailClient{messages: []mailbox.Message{
+		{UID: 4, From: "ana@example.com", Subject: "acme/api is down", Text: "500s since noon",
+			Attachments: []mailbox.Attachment{{Filename: "trace.txt", Data: []byte("panic: nil map")}}},
+		{UID: 5, From: "bo@example.com", Subject: "acme/web is slow", Text: "Pages take 10s"},
+	}}
+	previous := openMailbox
+	openMailbox = func(ctx context.Context, cfg config.MailboxConfig) (mailClient, error) { return client, nil }
+	t.Cleanup(func() { openMailbox = previous })
+	return s, client
+}
+
+func TestMailTrigger(t *testing.T) {
+	s, client := newMailTriggerTestServer(t)
+	trigger := config.MailTrigger{Name: "support", Workflow: "push", Mailbox: "support", Subject: "acme",
+		Params: map[string]string{"repo": "subject"}}
+	s.checkMailTrigger(context.Background(), trigger)
+
+	assert.Equal(t, mailbox.Query{Subject: "acme", Unseen: true}, client.query)
+	assert.Equal(t, []uint32{4, 5}, client.seen)
+
+	store, _ := s.runStore()
+	var runs []history.Run
+	assert.Eventually(t, func() bool {
+		runs, _ = store.List()
+		for _, run := range runs {
+			if run.Status == history.StatusQueued || run.Status == history.StatusRunning {
+				return false
+			}
+		}
+		return len(runs) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, run := range runs {
+		assert.Equal(t, history.StatusSucceeded, run.Status, run.Error)
+	}
+
+	// The attachment is saved in the runtime directory of its message's run
+	traces, _ := filepath.Glob(filepath.Join(s.config.DataDir, "mail", "support", "*", "trace.txt"))
+	assert.Len(t, traces, 1)
+}
+
+func TestMailTriggerLeavesUnqueuedMessagesUnread(t *testing.T) {
+	s, client := newMailTriggerTestServer(t)
+	s.checkMailTrigger(context.Background(), config.MailTrigger{Name: "support", Workflow: "missing", Mailbox: "support"})
+	assert.Empty(t, client.seen)
+
+	// A param read from an unknown field stops the check before any run
+	s.checkMailTrigger(context.Background(), config.MailTrigger{Name: "support", Workflow: "push", Mailbox: "support",
+		Params: map[string]string{"repo": "body"}})
+	assert.Empty(t, client.seen)
+}
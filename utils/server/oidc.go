@@ -0,0 +1,651 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Claims of the tokens the server issues: sessions are accepted as bearer
+// tokens, login state only by the sign-in callback
+const (
+	sessionIssuer   = "comanda"
+	sessionAudience = "comanda"
+	loginAudience   = "comanda-login"
+)
+
+// RFC 8693 token exchange
+const (
+	tokenExchangeGrant = "urn:ietf:params:oauth:grant-type:token-exchange"
+	idTokenType        = "urn:ietf:params:oauth:token-type:id_token"
+	jwtTokenType       = "urn:ietf:params:oauth:token-type:jwt"
+	accessTokenType    = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+const (
+	loginCookie         = "comanda_login"  // Holds the sign-in state between /auth/login and /auth/callback
+	loginTimeout        = 10 * time.Minute // How long users have to sign in with the provider
+	jwksRefreshInterval = time.Minute      // Unknown key IDs refetch the keys at most this often
+)
+
+// AuthInfo tells the web UI how users can sign in
+type AuthInfo struct {
+	SignIn bool `json:"sign_in"` // Users can sign in with the OIDC provider at /auth/login
+}
+
+// TokenExchangeRequest is the form posted to /auth/token
+type TokenExchangeRequest struct {
+	GrantType        string `json:"grant_type"`         // urn:ietf:params:oauth:grant-type:token-exchange
+	SubjectToken     string `json:"subject_token"`      // An ID token the provider issued to the configured client
+	SubjectTokenType string `json:"subject_token_type"` // urn:ietf:params:oauth:token-type:id_token
+}
+
+// TokenExchangeResponse carries a token for the API
+type TokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"` // Seconds until the token expires
+	Scope           string `json:"scope"`
+}
+
+// OAuthError is an error in the shape OAuth clients expect
+type OAuthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// oidcProvider signs users in with an OpenID Connect provider and checks the
+// ID tokens it issues. The provider's discovery document and keys are
+// fetched on first use. It is shared with workspaces.
+type oidcProvider struct {
+	cfg    *config.OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]interface{} // Signing keys, by key ID
+	keysFetched time.Time
+}
+
+// oidcDiscovery is the part of the provider's discovery document sign-in uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// newOIDCProvider checks the OIDC settings
+func newOIDCProvider(cfg *config.OIDCConfig) (*oidcProvider, error) {
+	switch {
+	case cfg.Issuer == "":
+		return nil, errors.New("oidc: an issuer is required")
+	case cfg.ClientID == "":
+		return nil, errors.New("oidc: a clientId is required")
+	case cfg.SessionSecret == "":
+		return nil, errors.New("oidc: a sessionSecret is required")
+	case cfg.DefaultScope != "" && scopeLevels[cfg.DefaultScope] == 0:
+		return nil, fmt.Errorf("oidc: unknown defaultScope '%s'", cfg.DefaultScope)
+	}
+	for _, role := range cfg.Roles {
+		if role.Group == "" {
+			return nil, errors.New("oidc: every role needs a group")
+		}
+		if scopeLevels[role.Scope] == 0 {
+			return nil, fmt.Errorf("oidc: role for group '%s' has unknown scope '%s'", role.Group, role.Scope)
+		}
+	}
+	return &oidcProvider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// discover returns the provider's discovery document
+func (p *oidcProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	var doc oidcDiscovery
+	if err := p.getJSON(ctx, issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("error reading the OIDC discovery document: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("the OIDC discovery document is for issuer '%s', not '%s'", doc.Issuer, p.cfg.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("the OIDC discovery document lacks an authorization, token or JWKS endpoint")
+	}
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// key returns the provider's signing key with the given ID, refetching the
+// provider's keys when it is unknown, as it is after the keys are rotated
+func (p *oidcProvider) key(ctx context.Context, kid string) (interface{}, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key '%s'", kid)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, doc.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("error reading the provider's signing keys: %w", err)
+	}
+	p.keys = make(map[string]interface{})
+	for _, k := range set.Keys {
+		if key, err := k.publicKey(); err == nil && (k.Use == "" || k.Use == "sig") {
+			p.keys[k.Kid] = key
+		}
+	}
+	p.keysFetched = time.Now()
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key '%s'", kid)
+}
+
+// findKey looks a key up by ID. Tokens without one may use the only key.
+func (p *oidcProvider) findKey(kid string) interface{} {
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// verify checks an ID token's signature and claims and returns its claims.
+// A nonce, when given, must match the one the token carries.
+func (p *oidcProvider) verify(ctx context.Context, token, nonce string, now time.Time) (*jwtClaims, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jwt, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	if jwt.alg != "RS256" && jwt.alg != "ES256" {
+		return nil, fmt.Errorf("unsupported token algorithm '%s'", jwt.alg)
+	}
+	key, err := p.key(ctx, jwt.kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyPublicKeySignature(key, jwt.alg, jwt.signed, jwt.signature); err != nil {
+		return nil, err
+	}
+	if jwt.claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	if err := jwt.claims.check(doc.Issuer, p.cfg.ClientID, now); err != nil {
+		return nil, err
+	}
+	if nonce != "" {
+		if got, _ := jwt.claims.all["nonce"].(string); !tokensEqual(got, nonce) {
+			return nil, errors.New("token was not issued for this sign-in")
+		}
+	}
+	return jwt.claims, nil
+}
+
+// exchangeCode trades an authorization code for the user's ID token
+func (p *oidcProvider) exchangeCode(ctx context.Context, code, verifier, redirectURL string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error reaching the provider: %w", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		reason := body.ErrorDescription
+		if reason == "" {
+			reason = body.Error
+		}
+		if reason == "" {
+			reason = resp.Status
+		}
+		return "", fmt.Errorf("the provider refused the sign-in: %s", reason)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("the provider returned no ID token")
+	}
+	return body.IDToken, nil
+}
+
+// getJSON fetches a JSON document from the provider
+func (p *oidcProvider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// role returns the scope and workspace of a user in groups: those of the
+// first role whose group they are in, or the default scope. An empty scope
+// means the user may not use the server.
+func (p *oidcProvider) role(groups []string) (scope, workspace string) {
+	for _, role := range p.cfg.Roles {
+		if slices.Contains(groups, role.Group) {
+			return role.Scope, role.Workspace
+		}
+	}
+	return p.cfg.DefaultScope, ""
+}
+
+// issueSession returns a token for the user an ID token identifies, carrying
+// the scope and workspace of their role, and that scope
+func (p *oidcProvider) issueSession(claims *jwtClaims, now time.Time) (string, string, error) {
+	groupsClaim := p.cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	user := oidcUser(claims)
+	scope, workspace := p.role(claims.scopes(groupsClaim))
+	if scope == "" {
+		return "", "", fmt.Errorf("user '%s' is not in any group allowed to use this server", user)
+	}
+	session := map[string]interface{}{
+		"iss":   sessionIssuer,
+		"aud":   sessionAudience,
+		"sub":   claims.Subject,
+		"name":  user,
+		"scope": scope,
+		"iat":   now.Unix(),
+		"exp":   now.Add(p.cfg.SessionDuration()).Unix(),
+	}
+	if workspace != "" {
+		session["workspace"] = workspace
+	}
+	token, err := issueJWT(p.cfg.SessionSecret, session)
+	return token, scope, err
+}
+
+// oidcUser names the user an ID token identifies: their email address, or
+// their subject when the token has none
+func oidcUser(claims *jwtClaims) string {
+	for _, claim := range []string{"email", "preferred_username"} {
+		if v, _ := claims.all[claim].(string); v != "" {
+			return v
+		}
+	}
+	return claims.Subject
+}
+
+// sessionPrincipal authenticates a token issued at sign-in or by token
+// exchange
+func sessionPrincipal(cfg *config.OIDCConfig, token string, now time.Time) (*principal, error) {
+	claims, err := validateJWT(&config.JWTConfig{Secret: cfg.SessionSecret, Issuer: sessionIssuer, Audience: sessionAudience}, token, now)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := claims.all["name"].(string)
+	scope, _ := claims.all["scope"].(string)
+	workspace, _ := claims.all["workspace"].(string)
+	return &principal{
+		name:      fmt.Sprintf("user '%s'", name),
+		limitKey:  "user:" + claims.Subject,
+		scope:     scope,
+		rateLimit: cfg.RateLimit,
+		workspace: workspace,
+	}, nil
+}
+
+// handleAuthInfo serves /auth, telling the web UI whether users can sign in
+func (s *Server) handleAuthInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	json.NewEncoder(w).Encode(AuthInfo{SignIn: s.oidc != nil})
+}
+
+// handleLogin serves /auth/login, sending the user to the provider to sign
+// in. The state, nonce and PKCE verifier the callback checks are kept in a
+// short-lived signed cookie.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.oidc == nil {
+		w.Header().Set("Content-Type", "application/json")
+		sendJSONError(w, http.StatusNotFound, "Sign-in is not enabled; add an oidc section to the server configuration")
+		return
+	}
+	doc, err := s.oidc.discover(r.Context())
+	if err != nil {
+		s.logf("Error starting sign-in: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		sendJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	now := time.Now()
+	state, nonce, verifier := randomToken(), randomToken(), randomToken()
+	redirectURL := s.callbackURL(r)
+	cookie, err := issueJWT(s.oidc.cfg.SessionSecret, map[string]interface{}{
+		"iss":      sessionIssuer,
+		"aud":      loginAudience,
+		"exp":      now.Add(loginTimeout).Unix(),
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"redirect": redirectURL,
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    cookie,
+		Path:     s.basePath() + "/auth/",
+		MaxAge:   int(loginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.URL.Scheme == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	scopes := s.oidc.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.oidc.cfg.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	target := doc.AuthorizationEndpoint
+	if strings.Contains(target, "?") {
+		target += "&" + query.Encode()
+	} else {
+		target += "?" + query.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleCallback serves /auth/callback, where the provider sends users back
+// after they sign in. It checks the sign-in, issues a session token for the
+// user's role and hands it to the web UI, or returns it when the UI is
+// disabled.
+func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.oidc == nil {
+		sendJSONError(w, http.StatusNotFound, "Sign-in is not enabled; add an oidc section to the server configuration")
+		return
+	}
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		if description := query.Get("error_description"); description != "" {
+			reason = description
+		}
+		sendJSONError(w, http.StatusUnauthorized, "Sign-in failed: "+reason)
+		return
+	}
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, "Sign-in has not been started or has timed out; start again at /auth/login")
+		return
+	}
+	now := time.Now()
+	login, err := validateJWT(&config.JWTConfig{Secret: s.oidc.cfg.SessionSecret, Issuer: sessionIssuer, Audience: loginAudience}, cookie.Value, now)
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, "Sign-in has not been started or has timed out; start again at /auth/login")
+		return
+	}
+	state, _ := login.all["state"].(string)
+	if state == "" || !tokensEqual(query.Get("state"), state) {
+		sendJSONError(w, http.StatusBadRequest, "Sign-in state does not match; start again at /auth/login")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: s.basePath() + "/auth/", MaxAge: -1})
+
+	verifier, _ := login.all["verifier"].(string)
+	redirectURL, _ := login.all["redirect"].(string)
+	nonce, _ := login.all["nonce"].(string)
+	idToken, err := s.oidc.exchangeCode(r.Context(), query.Get("code"), verifier, redirectURL)
+	if err != nil {
+		s.logf("Error completing sign-in: %v", err)
+		sendJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	claims, err := s.oidc.verify(r.Context(), idToken, nonce, now)
+	if err != nil {
+		s.logf("Error completing sign-in: %v", err)
+		sendJSONError(w, http.StatusUnauthorized, "Invalid ID token: "+err.Error())
+		return
+	}
+	session, scope, err := s.oidc.issueSession(claims, now)
+	if err != nil {
+		sendJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	s.logf("User '%s' signed in with scope '%s'", oidcUser(claims), scope)
+
+	if s.config.DisableUI {
+		json.NewEncoder(w).Encode(s.tokenResponse(session, scope))
+		return
+	}
+	// The fragment isn't sent to servers, so the token stays out of logs
+	http.Redirect(w, r, s.basePath()+"/ui/#/login/"+session, http.StatusFound)
+}
+
+// handleTokenExchange serves /auth/token, exchanging an ID token the
+// provider issued to the client for a token for the API, as in RFC 8693.
+// Errors are written as OAuth errors, which token exchange clients expect.
+func (s *Server) handleTokenExchange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		sendOAuthError(w, http.StatusMethodNotAllowed, "invalid_request", "Method not allowed")
+		return
+	}
+	if s.oidc == nil {
+		sendOAuthError(w, http.StatusNotFound, "invalid_request", "Token exchange is not enabled; add an oidc section to the server configuration")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		sendOAuthError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Invalid form: %v", err))
+		return
+	}
+	req := TokenExchangeRequest{
+		GrantType:        r.PostForm.Get("grant_type"),
+		SubjectToken:     r.PostForm.Get("subject_token"),
+		SubjectTokenType: r.PostForm.Get("subject_token_type"),
+	}
+	if req.GrantType != tokenExchangeGrant {
+		sendOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be "+tokenExchangeGrant)
+		return
+	}
+	if req.SubjectTokenType != idTokenType && req.SubjectTokenType != jwtTokenType {
+		sendOAuthError(w, http.StatusBadRequest, "invalid_request", "subject_token_type must be "+idTokenType)
+		return
+	}
+	if req.SubjectToken == "" {
+		sendOAuthError(w, http.StatusBadRequest, "invalid_request", "subject_token is required")
+		return
+	}
+	now := time.Now()
+	claims, err := s.oidc.verify(r.Context(), req.SubjectToken, "", now)
+	if err != nil {
+		sendOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid subject_token: "+err.Error())
+		return
+	}
+	session, scope, err := s.oidc.issueSession(claims, now)
+	if err != nil {
+		sendOAuthError(w, http.StatusForbidden, "access_denied", err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(s.tokenResponse(session, scope))
+}
+
+// tokenResponse describes a session token
+func (s *Server) tokenResponse(token, scope string) TokenExchangeResponse {
+	return TokenExchangeResponse{
+		AccessToken:     token,
+		IssuedTokenType: accessTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(s.oidc.cfg.SessionDuration().Seconds()),
+		Scope:           scope,
+	}
+}
+
+// callbackURL returns where the provider sends users back to: the
+// configured redirect URL, or /auth/callback on the host they signed in on
+func (s *Server) callbackURL(r *http.Request) string {
+	if s.oidc.cfg.RedirectURL != "" {
+		return s.oidc.cfg.RedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.URL.Scheme == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.basePath() + "/auth/callback"
+}
+
+// sendOAuthError writes an error in the form OAuth clients read
+func sendOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(OAuthError{Error: code, Description: description})
+}
+
+// randomToken returns 32 random bytes, base64url-encoded
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwk is an RSA or EC public key in a provider's JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key
+func (k jwk) publicKey() (interface{}, error) {
+	decode := func(v string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(b) == 0 {
+			return nil, errors.New("invalid key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOIDC is an OpenID Connect provider that signs ID tokens with an RSA
+// key and issues one for the code "good-code"
+type fakeOIDC struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string                 // PKCE challenge of the sign-in in progress
+	claims    map[string]interface{} // Claims of the ID tokens the token endpoint issues
+}
+
+func newFakeOIDC(t *testing.T) *fakeOIDC {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeOIDC{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		e := big.NewInt(int64(key.E)).Bytes()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "use": "sig", "kid": "k1",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(e),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != f.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad code"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.idToken(f.claims)})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// idToken returns a token the provider signed, issued to the client "comanda"
+func (f *fakeOIDC) idToken(claims map[string]interface{}) string {
+	all := map[string]interface{}{"iss": f.URL, "aud": "comanda", "exp": time.Now().Add(time.Hour).Unix()}
+	for k, v := range claims {
+		all[k] = v
+	}
+	return signJWT("RS256", all, func(signed string) []byte {
+		digest := sha256.Sum256([]byte(signed))
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+		return sig
+	})
+}
+
+// newOIDCTestServer returns a server signing users in with provider
+func newOIDCTestServer(t *testing.T, provider *fakeOIDC) *Server {
+	t.Helper()
+	s := newAPITestServer(t)
+	s.config.OIDC = &config.OIDCConfig{
+		Issuer:        provider.URL,
+		ClientID:      "comanda",
+		SessionSecret: "session-secret",
+		Roles: []config.OIDCRole{
+			{Group: "ml-team", Scope: config.ScopeRun, Workspace: "ml"},
+			{Group: "platform", Scope: config.ScopeAdmin},
+		},
+	}
+	s.config.Workspaces = []config.Workspace{{Name: "ml"}}
+	var err error
+	if s.oidc, err = newOIDCProvider(s.config.OIDC); err != nil {
+		t.Fatal(err)
+	}
+	s.mux = http.NewServeMux()
+	s.routes()
+	return s
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	provider := newFakeOIDC(t)
+	provider.claims = map[string]interface{}{"sub": "u1", "email": "ada@example.com", "groups": []string{"platform"}}
+	s := newOIDCTestServer(t, provider)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://comanda.test/auth/login", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	query := location.Query()
+	assert.Equal(t, provider.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "http://comanda.test/auth/callback", query.Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	provider.challenge = query.Get("code_challenge")
+	provider.claims["nonce"] = query.Get("nonce")
+	cookies := w.Result().Cookies()
+
+	callback := func(state string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/auth/callback?code=good-code&state="+url.QueryEscape(state), nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	w = callback("forged")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = callback(query.Get("state"))
+	assert.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	token, ok := strings.CutPrefix(w.Header().Get("Location"), "/ui/#/login/")
+	if !assert.True(t, ok, w.Header().Get("Location")) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, authStatus(s.config, http.MethodDelete, "/workflows/x", token))
+	caller, err := authenticate(s.config, token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "user 'ada@example.com'", caller.name)
+		assert.Equal(t, "", caller.workspace)
+	}
+
+	// Sign-in without the state cookie is refused
+	cookies = nil
+	assert.Equal(t, http.StatusBadRequest, callback(query.Get("state")).Code)
+}
+
+func TestOIDCTokenExchange(t *testing.T) {
+	provider := newFakeOIDC(t)
+	s := newOIDCTestServer(t, provider)
+	exchange := func(subjectToken string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		form := url.Values{
+			"grant_type":         {tokenExchangeGrant},
+			"subject_token":      {subjectToken},
+			"subject_token_type": {idTokenType},
+		}
+		r := httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		var body map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&body)
+		return w, body
+	}
+
+	w, body := exchange(provider.idToken(map[string]interface{}{"sub": "u2", "email": "bo@example.com", "groups": []string{"ml-team", "platform"}}))
+	assert.Equal(t, http.StatusOK, w.Code, body)
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.Equal(t, "run", body["scope"])
+	token, _ := body["access_token"].(string)
+	caller, err := authenticate(s.config, token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, config.ScopeRun, caller.scope)
+		assert.Equal(t, "ml", caller.workspace, "the first matching role applies")
+	}
+	assert.Equal(t, http.StatusForbidden, authStatus(s.config, http.MethodDelete, "/workflows/x", token))
+
+	// Users in none of the roles' groups are refused without a default scope
+	w, body = exchange(provider.idToken(map[string]interface{}{"sub": "u3", "groups": []string{"sales"}}))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "access_denied", body["error"])
+
+	// Tokens issued to other clients are refused
+	w, _ = exchange(provider.idToken(map[string]interface{}{"sub": "u2", "aud": "other-app", "groups": []string{"platform"}}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The session's own tokens can't be exchanged
+	w, _ = exchange(token)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOIDCConfigChecked(t *testing.T) {
+	_, err := newOIDCProvider(&config.OIDCConfig{Issuer: "https://idp.example.com", ClientID: "comanda"})
+	assert.ErrorContains(t, err, "sessionSecret")
+	_, err = newOIDCProvider(&config.OIDCConfig{Issuer: "https://idp.example.com", ClientID: "comanda", SessionSecret: "s",
+		Roles: []config.OIDCRole{{Group: "eng", Scope: "owner"}}})
+	assert.ErrorContains(t, err, "unknown scope 'owner'")
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Version is the server version reported in the OpenAPI spec
+var Version = "dev"
+
+// apiOperation documents one method of an endpoint for the OpenAPI spec
+type apiOperation struct {
+	method   string
+	path     string // Path parameters in braces, as in /runs/{id}
+	id       string // operationId; the Go client names its methods after it
+	tag      string
+	summary  string
+	scope    string // Scope an API key needs; empty for public endpoints
+	query    []apiParam
+	request  interface{} // JSON request body
+	upload   bool        // Request is a multipart form with file fields instead
+	form     bool        // Request is a URL-encoded form of request's fields instead
+	response interface{} // JSON response body
+	produces string      // Content type of a response that isn't JSON
+	status   int         // Success status; 200 when unset
+}
+
+// apiParam documents a query parameter
+type apiParam struct {
+	name        string
+	typ         string // string, integer or boolean
+	description string
+}
+
+var runtimeDirParam = apiParam{"runtimeDir", "string", "Directory in the data directory that file paths are relative to"}
+
+// apiOperations lists every operation the server routes, in the order the
+// spec presents them
+var apiOperations = []apiOperation{
+	{method: http.MethodGet, path: "/health", id: "getHealth", tag: "server", summary: "Check that the server is up", scope: config.ScopeRead, response: HealthResponse{}},
+	{method: http.MethodGet, path: "/openapi.json", id: "getOpenAPI", tag: "server", summary: "Get this specification", response: map[string]interface{}{}},
+
+	{method: http.MethodGet, path: "/list", id: "listFiles", tag: "files", summary: "List files in the data directory", scope: config.ScopeRead,
+		query: []apiParam{{"path", "string", "Directory to list"}}, response: ListResponse{}},
+	{method: http.MethodPost, path: "/files", id: "uploadFiles", tag: "files", summary: "Upload files into a runtime directory", scope: config.ScopeAdmin,
+		query: []apiParam{runtimeDirParam}, upload: true, response: MultiUploadResponse{}, status: http.StatusCreated},
+	{method: http.MethodPut, path: "/files", id: "updateFile", tag: "files", summary: "Replace a file's content", scope: config.ScopeAdmin, request: FileRequest{}, response: FileResponse{}},
+	{method: http.MethodDelete, path: "/files", id: "deleteFile", tag: "files", summary: "Delete a file", scope: config.ScopeAdmin,
+		query: []apiParam{{"path", "string", "File to delete"}}, response: FileResponse{}},
+	{method: http.MethodPost, path: "/files/bulk", id: "createFiles", tag: "files", summary: "Create several files", scope: config.ScopeAdmin, request: BulkFileRequest{}, response: BulkFileResponse{}},
+	{method: http.MethodPut, path: "/files/bulk", id: "updateFiles", tag: "files", summary: "Replace several files", scope: config.ScopeAdmin, request: BulkFileRequest{}, response: BulkFileResponse{}},
+	{method: http.MethodDelete, path: "/files/bulk", id: "deleteFiles", tag: "files", summary: "Delete several files", scope: config.ScopeAdmin,
+		request: struct {
+			Files []string `json:"files"`
+		}{}, response: BulkFileResponse{}},
+	{method: http.MethodPost, path: "/files/backup", id: "backupFiles", tag: "files", summary: "Back up the data directory to a zip file", scope: config.ScopeAdmin, response: BackupResponse{}},
+	{method: http.MethodPost, path: "/files/restore", id: "restoreFiles", tag: "files", summary: "Restore the data directory from a backup", scope: config.ScopeAdmin, request: RestoreRequest{}, response: SuccessResponse{}},
+	{method: http.MethodGet, path: "/files/content", id: "getFileContent", tag: "files", summary: "Get a file's content", scope: config.ScopeRead,
+		query: []apiParam{{"path", "string", "File to read"}}, produces: "text/plain"},
+	{method: http.MethodPost, path: "/files/upload", id: "uploadFile", tag: "files", summary: "Upload one file to a path", scope: config.ScopeAdmin,
+		query: []apiParam{runtimeDirParam}, upload: true, response: FileUploadResponse{}},
+	{method: http.MethodGet, path: "/files/download", id: "downloadFile", tag: "files", summary: "Download a file", scope: config.ScopeRead,
+		query: []apiParam{{"path", "string", "File to download"}}, produces: "application/octet-stream"},
+
+	{method: http.MethodGet, path: "/providers", id: "listProviders", tag: "providers", summary: "List providers and their models", scope: config.ScopeRead, response: ProviderListResponse{}},
+	{method: http.MethodPut, path: "/providers", id: "updateProvider", tag: "providers", summary: "Add or update a provider", scope: config.ScopeAdmin, request: ProviderRequest{}, response: SuccessResponse{}},
+	{method: http.MethodPost, path: "/providers/validate", id: "validateProvider", tag: "providers", summary: "Check a provider's API key", scope: config.ScopeAdmin, request: ProviderRequest{}, response: SuccessResponse{}},
+	{method: http.MethodDelete, path: "/providers/{provider}", id: "deleteProvider", tag: "providers", summary: "Remove a provider", scope: config.ScopeAdmin, response: SuccessResponse{}},
+	{method: http.MethodGet, path: "/providers/{provider}/models", id: "listProviderModels", tag: "providers", summary: "List a provider's configured models", scope: config.ScopeRead, response: ConfiguredModelListResponse{}},
+	{method: http.MethodPost, path: "/providers/{provider}/models", id: "addProviderModel", tag: "providers", summary: "Configure a model", scope: config.ScopeAdmin, request: AddModelRequest{}, response: SuccessResponse{}},
+	{method: http.MethodGet, path: "/providers/{provider}/available-models", id: "listAvailableModels", tag: "providers", summary: "List the models a provider offers", scope: config.ScopeRead, response: AvailableModelListResponse{}},
+	{method: http.MethodPut, path: "/providers/{provider}/models/{model}", id: "updateProviderModel", tag: "providers", summary: "Change a model's modes", scope: config.ScopeAdmin, request: UpdateModelRequest{}, response: SuccessResponse{}},
+	{method: http.MethodDelete, path: "/providers/{provider}/models/{model}", id: "deleteProviderModel", tag: "providers", summary: "Remove a model", scope: config.ScopeAdmin, response: SuccessResponse{}},
+
+	{method: http.MethodPost, path: "/env/encrypt", id: "encryptEnv", tag: "environment", summary: "Encrypt the environment file", scope: config.ScopeAdmin, request: EnvironmentRequest{}, response: EnvironmentResponse{}},
+	{method: http.MethodPost, path: "/env/decrypt", id: "decryptEnv", tag: "environment", summary: "Decrypt the environment file", scope: config.ScopeAdmin, request: EnvironmentRequest{}, response: EnvironmentResponse{}},
+
+	{method: http.MethodPost, path: "/yaml/upload", id: "uploadYAML", tag: "processing", summary: "Store a workflow file", scope: config.ScopeAdmin,
+		query: []apiParam{runtimeDirParam}, request: YAMLRequest{}, response: ProcessResponse{}},
+	{method: http.MethodPost, path: "/yaml/process", id: "processYAML", tag: "processing", summary: "Run workflow YAML sent in the request", scope: config.ScopeRun,
+		query: []apiParam{runtimeDirParam, {"streaming", "boolean", "Stream progress as server-sent events"}}, request: YAMLRequest{}, response: ProcessResponse{}},
+	{method: http.MethodPost, path: "/process", id: "processFile", tag: "processing", summary: "Run a workflow file from the data directory", scope: config.ScopeRun,
+		query: []apiParam{{"filename", "string", "Workflow file to run"}, {"input", "string", "Input for steps reading STDIN"}, runtimeDirParam, {"streaming", "boolean", "Stream progress as server-sent events"}},
+		request: struct {
+			Input     string `json:"input,omitempty"`
+			Streaming bool   `json:"streaming,omitempty"`
+		}{}, response: ProcessResponse{}},
+	{method: http.MethodPost, path: "/generate", id: "generateWorkflow", tag: "processing", summary: "Generate workflow YAML from a prompt", scope: config.ScopeRun, request: GenerateRequest{}, response: GenerateResponse{}},
+
+	{method: http.MethodGet, path: "/workflows", id: "listWorkflows", tag: "workflows", summary: "List stored workflows", scope: config.ScopeRead, response: WorkflowListResponse{}},
+	{method: http.MethodPost, path: "/workflows", id: "createWorkflow", tag: "workflows", summary: "Store a new workflow", scope: config.ScopeAdmin,
+		query: []apiParam{{"dryRun", "boolean", "Only check the workflow, responding with status 200 and needing only the read scope"}}, request: WorkflowRequest{}, response: WorkflowResponse{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/workflows/{name}", id: "getWorkflow", tag: "workflows", summary: "Get a workflow and its YAML", scope: config.ScopeRead, response: WorkflowResponse{}},
+	{method: http.MethodPut, path: "/workflows/{name}", id: "putWorkflow", tag: "workflows", summary: "Create or replace a workflow", scope: config.ScopeAdmin, request: WorkflowRequest{}, response: WorkflowResponse{}},
+	{method: http.MethodDelete, path: "/workflows/{name}", id: "deleteWorkflow", tag: "workflows", summary: "Delete a workflow", scope: config.ScopeAdmin, response: WorkflowResponse{}},
+
+	{method: http.MethodPost, path: "/runs", id: "startRun", tag: "runs", summary: "Queue a run of a stored workflow", scope: config.ScopeRun, request: RunRequest{}, response: RunResponse{}, status: http.StatusAccepted},
+	{method: http.MethodGet, path: "/runs", id: "listRuns", tag: "runs", summary: "List runs, most recent first", scope: config.ScopeRead,
+		query: []apiParam{{"workflow", "string", "Only runs of this workflow"}, {"limit", "integer", "Most runs to return"}}, response: RunListResponse{}},
+	{method: http.MethodGet, path: "/runs/{id}", id: "getRun", tag: "runs", summary: "Get a run's status, steps and output", scope: config.ScopeRead, response: RunResponse{}},
+	{method: http.MethodDelete, path: "/runs/{id}", id: "cancelRun", tag: "runs", summary: "Cancel a queued or running run, keeping what it finished", scope: config.ScopeRun, response: RunResponse{}},
+	{method: http.MethodPost, path: "/runs/{id}/approval", id: "decideApproval", tag: "runs", summary: "Approve or reject the approval step a run waits at", scope: config.ScopeRun, request: ApprovalRequestBody{}, response: RunResponse{}},
+	{method: http.MethodGet, path: "/runs/{id}/events", id: "streamRun", tag: "runs", summary: "Follow a run as server-sent events until it finishes", scope: config.ScopeRead, produces: "text/event-stream"},
+	{method: http.MethodGet, path: "/runs/{id}/steps/{step}/output", id: "getStepOutput", tag: "runs", summary: "Get a step's response", scope: config.ScopeRead, produces: "text/plain"},
+	{method: http.MethodGet, path: "/runs/{id}/artifacts", id: "listArtifacts", tag: "runs", summary: "List the files a run wrote", scope: config.ScopeRead, response: ArtifactListResponse{}},
+	{method: http.MethodGet, path: "/runs/{id}/artifacts/{path}", id: "downloadArtifact", tag: "runs", summary: "Download a file a run wrote; path may contain slashes", scope: config.ScopeRead, produces: "application/octet-stream"},
+
+	{method: http.MethodGet, path: "/schedules", id: "listSchedules", tag: "schedules", summary: "List schedules and when they next run", scope: config.ScopeRead, response: ScheduleListResponse{}},
+	{method: http.MethodPost, path: "/schedules", id: "createSchedule", tag: "schedules", summary: "Run a stored workflow on a cron schedule", scope: config.ScopeAdmin, request: ScheduleRequest{}, response: ScheduleResponse{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/schedules/{id}", id: "getSchedule", tag: "schedules", summary: "Get a schedule", scope: config.ScopeRead, response: ScheduleResponse{}},
+	{method: http.MethodPut, path: "/schedules/{id}", id: "putSchedule", tag: "schedules", summary: "Create or replace a schedule", scope: config.ScopeAdmin, request: ScheduleRequest{}, response: ScheduleResponse{}},
+	{method: http.MethodDelete, path: "/schedules/{id}", id: "deleteSchedule", tag: "schedules", summary: "Delete a schedule; its runs are kept", scope: config.ScopeAdmin, response: ScheduleResponse{}},
+
+	{method: http.MethodGet, path: "/audit", id: "exportAudit", tag: "audit", summary: "Export the audit log, oldest event first", scope: config.ScopeAdmin,
+		query: []apiParam{{"since", "string", "Only events at or after this RFC 3339 time"}, {"until", "string", "Only events before this RFC 3339 time"},
+			{"actor", "string", "Only events of this actor"}, {"run", "string", "Only events of this run"}, {"action", "string", "Only events of this action"},
+			{"format", "string", "jsonl (the default) or csv"}}, produces: "application/x-ndjson"},
+	{method: http.MethodGet, path: "/audit/verify", id: "verifyAudit", tag: "audit", summary: "Check that no audit event was changed or removed", scope: config.ScopeAdmin, response: AuditVerifyResponse{}},
+
+	{method: http.MethodGet, path: "/metrics", id: "getMetrics", tag: "metrics", summary: "Get what garbage collection removed and reclaimed, in the Prometheus text format", scope: config.ScopeRead, produces: "text/plain"},
+
+	{method: http.MethodPost, path: "/v1/chat/completions", id: "createChatCompletion", tag: "chat", summary: "Answer an OpenAI-style chat completion with a workflow or model", scope: config.ScopeRun,
+		request: ChatCompletionRequest{}, response: ChatCompletionResponse{}},
+	{method: http.MethodGet, path: "/v1/models", id: "listChatModels", tag: "chat", summary: "List the models chat completions may name", scope: config.ScopeRead, response: ChatModelList{}},
+
+	{method: http.MethodPost, path: "/hooks/{name}", id: "triggerWorkflow", tag: "triggers", summary: "Deliver a signed webhook to a trigger", request: map[string]interface{}{}, response: RunResponse{}, status: http.StatusAccepted},
+	{method: http.MethodGet, path: "/watches", id: "listWatches", tag: "triggers", summary: "List watch triggers with the files in their folders and the runs those started", scope: config.ScopeRead, response: WatchListResponse{}},
+
+	{method: http.MethodGet, path: "/auth", id: "getAuthInfo", tag: "auth", summary: "Tell whether users can sign in with an OIDC provider", response: AuthInfo{}},
+	{method: http.MethodGet, path: "/auth/login", id: "signIn", tag: "auth", summary: "Send the user to the OIDC provider to sign in", status: http.StatusFound},
+	{method: http.MethodGet, path: "/auth/callback", id: "completeSignIn", tag: "auth", summary: "Complete a sign-in and hand the web UI a token", status: http.StatusFound,
+		query: []apiParam{{"code", "string", "Authorization code the provider issued"}, {"state", "string", "State the sign-in started with"}}},
+	{method: http.MethodPost, path: "/auth/token", id: "exchangeToken", tag: "auth", summary: "Exchange an ID token from the OIDC provider for an API token (RFC 8693)",
+		request: TokenExchangeRequest{}, form: true, response: TokenExchangeResponse{}},
+}
+
+// handleOpenAPI serves the OpenAPI specification of the server's API
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	spec, err := OpenAPISpec(Version)
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// OpenAPISpec returns the OpenAPI 3 specification of the server's API as
+// indented JSON. Schemas are derived from the request and response types,
+// so the spec follows changes to them.
+func OpenAPISpec(version string) ([]byte, error) {
+	schemas := &schemaBuilder{components: make(map[string]interface{})}
+	paths := make(map[string]map[string]interface{})
+	for _, op := range apiOperations {
+		if paths[op.path] == nil {
+			paths[op.path] = make(map[string]interface{})
+		}
+		paths[op.path][strings.ToLower(op.method)] = op.spec(schemas)
+	}
+	schemas.components["ErrorResponse"] = schemas.schema(reflect.TypeOf(ErrorResponse{}))
+
+	spec := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "comanda server API",
+			"version":     version,
+			"description": "Manage and run comanda workflows. Authenticate with a bearer token, API key or JWT; each operation lists the API key scope it needs as x-comanda-scope.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []string{}}},
+	}
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// spec returns the OpenAPI operation object
+func (op apiOperation) spec(schemas *schemaBuilder) map[string]interface{} {
+	var params []interface{}
+	for _, m := range pathParamPattern.FindAllStringSubmatch(op.path, -1) {
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, q := range op.query {
+		params = append(params, map[string]interface{}{
+			"name": q.name, "in": "query", "description": q.description, "schema": map[string]interface{}{"type": q.typ},
+		})
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case op.produces != "":
+		success["content"] = map[string]interface{}{
+			op.produces: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+		}
+	case op.response != nil:
+		success["content"] = jsonContent(schemas.schema(reflect.TypeOf(op.response)))
+	}
+
+	spec := map[string]interface{}{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     jsonContent(map[string]interface{}{"$ref": "#/components/schemas/ErrorResponse"}),
+			},
+		},
+	}
+	if len(params) > 0 {
+		spec["parameters"] = params
+	}
+	if op.scope == "" {
+		spec["security"] = []interface{}{}
+	} else {
+		spec["x-comanda-scope"] = op.scope
+	}
+	switch {
+	case op.upload:
+		spec["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"multipart/form-data": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"file": map[string]interface{}{"type": "string", "format": "binary"},
+							"path": map[string]interface{}{"type": "string"},
+						},
+					},
+				},
+			},
+		}
+	case op.form:
+		spec["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/x-www-form-urlencoded": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(op.request))},
+			},
+		}
+	case op.request != nil:
+		t := reflect.TypeOf(op.request)
+		spec["requestBody"] = map[string]interface{}{
+			"required": bodyRequired(t),
+			"content":  jsonContent(schemas.schema(t)),
+		}
+	}
+	return spec
+}
+
+// bodyRequired reports whether a request body must be sent: always, unless
+// every field of its struct is optional
+func bodyRequired(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("json"); tag != "-" && !strings.Contains(tag, ",omitempty") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// schemaBuilder derives JSON schemas from Go types, collecting named structs
+// as components
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of t, or a reference to it for named structs
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := b.components[t.Name()]; !ok {
+			b.components[t.Name()] = nil // Placeholder, for types that refer to themselves
+			b.components[t.Name()] = b.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Struct:
+		return b.object(t)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	}
+	return map[string]interface{}{} // Any value
+}
+
+// object returns the schema of a struct from its JSON field tags. Fields
+// without omitempty are required.
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// Embedded struct fields are encoded as if they were this struct's
+			embedded := b.object(field.Type)
+			for key, value := range embedded["properties"].(map[string]interface{}) {
+				properties[key] = value
+			}
+			if fields, ok := embedded["required"].([]string); ok {
+				required = append(required, fields...)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	data, err := OpenAPISpec("1.2.3")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Info       map[string]interface{}                       `json:"info"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+	assert.Equal(t, "1.2.3", spec.Info["version"])
+
+	startRun := spec.Paths["/runs"]["post"]
+	assert.Equal(t, "startRun", startRun["operationId"])
+	assert.Equal(t, config.ScopeRun, startRun["x-comanda-scope"])
+	assert.Contains(t, spec.Paths["/runs/{id}"]["get"]["parameters"].([]interface{})[0], "in")
+
+	runRequest := spec.Components.Schemas["RunRequest"]
+	assert.Equal(t, []interface{}{"workflow"}, runRequest["required"])
+	assert.Contains(t, runRequest["properties"], "webhooks")
+	assert.Contains(t, spec.Components.Schemas, "Run")
+	assert.Contains(t, spec.Components.Schemas, "Webhook")
+	assert.Contains(t, spec.Components.Schemas, "ErrorResponse")
+
+	ids := make(map[string]bool)
+	for _, op := range apiOperations {
+		assert.False(t, ids[op.id], "duplicate operationId %s", op.id)
+		ids[op.id] = true
+	}
+}
+
+func TestOpenAPIOperationsAreRouted(t *testing.T) {
+	s := newAPITestServer(t)
+	s.mux = http.NewServeMux()
+	s.routes()
+	for _, op := range apiOperations {
+		path := strings.NewReplacer("{provider}", "openai", "{model}", "gpt-4o", "{name}", "x", "{id}", "x", "{step}", "x", "{path}", "x").Replace(op.path)
+		r := httptest.NewRequest(op.method, path, strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.NotEqual(t, http.StatusMethodNotAllowed, w.Code, "%s %s", op.method, op.path)
+		assert.NotContains(t, w.Body.String(), "404 page not found", "%s %s", op.method, op.path)
+	}
+}
+
+func TestOpenAPIEndpointIsPublic(t *testing.T) {
+	s := newAPITestServer(t)
+	s.mux = http.NewServeMux()
+	s.config.Enabled = true
+	s.config.BearerToken = "secret"
+	s.routes()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"operationId": "startRun"`)
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/workflows", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
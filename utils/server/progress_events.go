@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	cfg "github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// progressEvents names the server-sent event of each typed progress update
+var progressEvents = map[processor.ProgressType]string{
+	processor.ProgressStepStarted:  "step_started",
+	processor.ProgressStepFinished: "step_finished",
+	processor.ProgressChunk:        "chunk",
+	processor.ProgressDelta:        "delta",
+	processor.ProgressRetry:        "retry",
+}
+
+// ProgressEvent is the data of a typed progress event in a streamed run
+type ProgressEvent struct {
+	Step             string `json:"step,omitempty"`
+	Model            string `json:"model,omitempty"`
+	ParallelGroup    string `json:"parallel_group,omitempty"`
+	Message          string `json:"message,omitempty"`
+	Error            string `json:"error,omitempty"`
+	DurationMS       int64  `json:"duration_ms,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	Chunk            int    `json:"chunk,omitempty"`
+	Chunks           int    `json:"chunks,omitempty"`
+	Delta            string `json:"delta,omitempty"`
+	Attempt          int    `json:"attempt,omitempty"`
+	MaxAttempts      int    `json:"max_attempts,omitempty"`
+	WaitMS           int64  `json:"wait_ms,omitempty"`
+	Provider         string `json:"provider,omitempty"`
+}
+
+// newProgressEvent converts a typed progress update to its event data
+func newProgressEvent(update processor.ProgressUpdate) ProgressEvent {
+	event := ProgressEvent{
+		ParallelGroup: update.ParallelID,
+		Message:       update.Message,
+		Error:         cfg.RedactError(update.Error),
+		Chunk:         update.Chunk,
+		Chunks:        update.Chunks,
+		Delta:         update.Delta,
+		Attempt:       update.Attempt,
+		MaxAttempts:   update.MaxAttempts,
+		WaitMS:        update.Wait.Milliseconds(),
+		Provider:      update.Provider,
+	}
+	if update.Step != nil {
+		event.Step = update.Step.Name
+		event.Model = update.Step.Model
+	}
+	if m := update.PerformanceMetrics; m != nil && update.Type == processor.ProgressStepFinished {
+		event.DurationMS = m.TotalProcessingTime
+		event.PromptTokens = m.PromptTokens
+		event.CompletionTokens = m.CompletionTokens
+	}
+	return event
+}
+
+// SendProgressEvent sends a typed progress update as the event named after
+// its type, such as step_started or retry. It reports whether the update
+// had a typed event.
+func (sw *sseWriter) SendProgressEvent(update processor.ProgressUpdate) (bool, error) {
+	name, ok := progressEvents[update.Type]
+	if !ok {
+		return false, nil
+	}
+	jsonData, err := json.Marshal(newProgressEvent(update))
+	if err != nil {
+		debugLog("[SSE] Error marshaling %s event: %v", name, err)
+		return true, err
+	}
+	event := fmt.Sprintf("event: %s\ndata: %s\n\n", name, jsonData)
+	if _, err := sw.w.Write([]byte(event)); err != nil {
+		debugLog("[SSE] Error writing %s event: %v", name, err)
+		return true, err
+	}
+	sw.f.Flush()
+	return true, nil
+}
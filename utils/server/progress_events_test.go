@@ -0,0 +1,42 @@
+package server
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+func TestSendProgressEvent(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := &sseWriter{w: rec, f: rec}
+
+	step := &processor.StepInfo{Name: "review", Model: "gpt-4o"}
+	for _, update := range []processor.ProgressUpdate{
+		{Type: processor.ProgressStepStarted, Step: step, Message: "Started step: review"},
+		{Type: processor.ProgressRetry, Step: step, Attempt: 1, MaxAttempts: 5, Wait: 2 * time.Second, Provider: "openai"},
+		{Type: processor.ProgressStepFinished, Step: step, Error: errors.New("failed"),
+			PerformanceMetrics: &processor.PerformanceMetrics{TotalProcessingTime: 900, PromptTokens: 10}},
+	} {
+		if typed, err := sw.SendProgressEvent(update); !typed || err != nil {
+			t.Fatalf("SendProgressEvent(%v) = %v, %v", update.Type, typed, err)
+		}
+	}
+	if typed, _ := sw.SendProgressEvent(processor.ProgressUpdate{Type: processor.ProgressStep}); typed {
+		t.Error("SendProgressEvent() sent an untyped progress update")
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"event: step_started\ndata: {\"step\":\"review\",\"model\":\"gpt-4o\",\"message\":\"Started step: review\"}\n\n",
+		"event: retry\ndata: {\"step\":\"review\",\"model\":\"gpt-4o\",\"attempt\":1,\"max_attempts\":5,\"wait_ms\":2000,\"provider\":\"openai\"}\n\n",
+		"event: step_finished\ndata: {\"step\":\"review\",\"model\":\"gpt-4o\",\"error\":\"failed\",\"duration_ms\":900,\"prompt_tokens\":10}\n\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("stream missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -17,7 +17,7 @@ func sendJSONError(w http.ResponseWriter, statusCode int, message string) {
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(ErrorResponse{
 		Success: false,
-		Error:   message,
+		Error:   config.Redact(message),
 	})
 }
 
@@ -46,7 +46,7 @@ func (s *Server) handleGetProviders(w http.ResponseWriter, r *http.Request) {
 	// Get provider configurations
 	for _, p := range providerList {
 		if p.provider != nil {
-			if provider, err := s.envConfig.GetProviderConfig(p.name); err == nil {
+			if provider, err := s.env().GetProviderConfig(p.name); err == nil {
 				providers = append(providers, ProviderInfo{
 					Name:    p.name,
 					Models:  getModelNames(provider.Models),
@@ -70,7 +70,7 @@ func (s *Server) handleGetConfiguredModels(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	providerConfig, err := s.envConfig.GetProviderConfig(providerName)
+	providerConfig, err := s.env().GetProviderConfig(providerName)
 	if err != nil {
 		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Provider '%s' not found", providerName))
 		return
@@ -100,7 +100,7 @@ func (s *Server) handleGetAvailableModels(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get API key if needed (e.g., for OpenAI)
-	providerConfig, err := s.envConfig.GetProviderConfig(providerName)
+	providerConfig, err := s.env().GetProviderConfig(providerName)
 	apiKey := ""
 	if err == nil { // Provider exists, get its key
 		apiKey = providerConfig.APIKey
@@ -172,7 +172,7 @@ func (s *Server) handleAddModel(w http.ResponseWriter, r *http.Request, provider
 	}
 
 	// Add model to config
-	if err := s.envConfig.AddModelToProvider(providerName, newModel); err != nil {
+	if err := s.env().AddModelToProvider(providerName, newModel); err != nil {
 		// Check if it's a "provider not found" error
 		if strings.Contains(err.Error(), "not found") {
 			sendJSONError(w, http.StatusNotFound, err.Error())
@@ -183,7 +183,7 @@ func (s *Server) handleAddModel(w http.ResponseWriter, r *http.Request, provider
 	}
 
 	// Save the updated configuration
-	if err := config.SaveEnvConfig(config.GetEnvPath(), s.envConfig); err != nil {
+	if err := config.SaveEnvConfig(config.GetEnvPath(), s.env()); err != nil {
 		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error saving configuration: %v", err))
 		return
 	}
@@ -222,7 +222,7 @@ func (s *Server) handleUpdateModel(w http.ResponseWriter, r *http.Request, provi
 	}
 
 	// Update model modes in config
-	if err := s.envConfig.UpdateModelModes(providerName, modelName, req.Modes); err != nil {
+	if err := s.env().UpdateModelModes(providerName, modelName, req.Modes); err != nil {
 		// Check if it's a "not found" error
 		if strings.Contains(err.Error(), "not found") {
 			sendJSONError(w, http.StatusNotFound, err.Error())
@@ -233,7 +233,7 @@ func (s *Server) handleUpdateModel(w http.ResponseWriter, r *http.Request, provi
 	}
 
 	// Save the updated configuration
-	if err := config.SaveEnvConfig(config.GetEnvPath(), s.envConfig); err != nil {
+	if err := config.SaveEnvConfig(config.GetEnvPath(), s.env()); err != nil {
 		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error saving configuration: %v", err))
 		return
 	}
@@ -252,7 +252,7 @@ func (s *Server) handleDeleteModel(w http.ResponseWriter, r *http.Request, provi
 		return
 	}
 
-	providerConfig, err := s.envConfig.GetProviderConfig(providerName)
+	providerConfig, err := s.env().GetProviderConfig(providerName)
 	if err != nil {
 		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Provider '%s' not found", providerName))
 		return
@@ -277,7 +277,7 @@ func (s *Server) handleDeleteModel(w http.ResponseWriter, r *http.Request, provi
 	providerConfig.Models = newModels
 
 	// Save the updated configuration
-	if err := config.SaveEnvConfig(config.GetEnvPath(), s.envConfig); err != nil {
+	if err := config.SaveEnvConfig(config.GetEnvPath(), s.env()); err != nil {
 		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error saving configuration: %v", err))
 		return
 	}
@@ -369,18 +369,18 @@ func (s *Server) handleUpdateProvider(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get existing provider or create new one
-	provider, err := s.envConfig.GetProviderConfig(req.Name)
+	provider, err := s.env().GetProviderConfig(req.Name)
 	if err != nil {
 		// Provider doesn't exist, create new one
 		provider = &config.Provider{
 			Models: make([]config.Model, 0),
 		}
-		s.envConfig.AddProvider(req.Name, *provider)
+		s.env().AddProvider(req.Name, *provider)
 	}
 
 	// Update API key if provided
 	if req.APIKey != "" {
-		if err := s.envConfig.UpdateAPIKey(req.Name, req.APIKey); err != nil {
+		if err := s.env().UpdateAPIKey(req.Name, req.APIKey); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{
 				"error": fmt.Sprintf("Error updating API key: %v", err),
@@ -427,7 +427,7 @@ func (s *Server) handleUpdateProvider(w http.ResponseWriter, r *http.Request) {
 				Name:  modelName,
 				Modes: []config.ModelMode{config.TextMode}, // Default to text mode
 			}
-			if err := s.envConfig.AddModelToProvider(req.Name, model); err != nil {
+			if err := s.env().AddModelToProvider(req.Name, model); err != nil {
 				config.VerboseLog("Error adding model %s: %v", modelName, err)
 				// Continue with other models
 			}
@@ -435,7 +435,7 @@ func (s *Server) handleUpdateProvider(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save the updated configuration
-	if err := config.SaveEnvConfig(config.GetEnvPath(), s.envConfig); err != nil {
+	if err := config.SaveEnvConfig(config.GetEnvPath(), s.env()); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": fmt.Sprintf("Error saving configuration: %v", err),
@@ -466,11 +466,11 @@ func (s *Server) handleDeleteProvider(w http.ResponseWriter, r *http.Request, pr
 	}
 
 	// Remove provider from configuration and save
-	if s.envConfig.Providers != nil {
-		delete(s.envConfig.Providers, providerName)
+	if s.env().Providers != nil {
+		delete(s.env().Providers, providerName)
 
 		// Save the updated configuration
-		if err := config.SaveEnvConfig(config.GetEnvPath(), s.envConfig); err != nil {
+		if err := config.SaveEnvConfig(config.GetEnvPath(), s.env()); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{
 				"error": fmt.Sprintf("Error saving configuration: %v", err),
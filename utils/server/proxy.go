@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the peers whose forwarding headers are believed
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses addresses and CIDR ranges, such as 10.0.0.1
+// or 10.0.0.0/8
+func parseTrustedProxies(entries []string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("trustedProxies: invalid address '%s'", entry)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trustedProxies: invalid range '%s'", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusts reports whether addr, an IP with or without a port, is a trusted
+// proxy
+func (p trustedProxies) trusts(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded returns the request as the client sent it to the proxy in front
+// of the server: with the client's address, scheme and host taken from the
+// X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host headers. The
+// headers are only believed from trusted proxies; from anyone else the
+// request is returned unchanged.
+func (p trustedProxies) forwarded(r *http.Request) *http.Request {
+	if len(p) == 0 || !p.trusts(r.RemoteAddr) {
+		return r
+	}
+	fr := r.Clone(r.Context())
+	if client := p.clientAddr(r.Header.Values("X-Forwarded-For")); client != "" {
+		fr.RemoteAddr = client
+	}
+	if proto := firstValue(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+		fr.URL.Scheme = proto
+	}
+	if host := firstValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+		fr.Host = host
+	}
+	return fr
+}
+
+// clientAddr returns the client's address from X-Forwarded-For: the last
+// address not added by a trusted proxy. Addresses before it were set by the
+// client and can't be believed.
+func (p trustedProxies) clientAddr(headers []string) string {
+	var hops []string
+	for _, header := range headers {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !p.trusts(hops[i]) || i == 0 {
+			if net.ParseIP(hops[i]) == nil {
+				return ""
+			}
+			return hops[i]
+		}
+	}
+	return ""
+}
+
+// firstValue returns the first of a header's comma-separated values, which
+// the proxy nearest the client set
+func firstValue(header string) string {
+	value, _, _ := strings.Cut(header, ",")
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// normalizeBasePath returns a base path as /prefix, or "" when the server
+// is served at the root
+func normalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// basePath returns the path prefix the server is reached under
+func (s *Server) basePath() string {
+	return normalizeBasePath(s.config.BasePath)
+}
+
+// withBasePath serves handler under the configured base path, stripping it
+// from request paths. Requests outside the base path are not found.
+func (s *Server) withBasePath(handler http.Handler) http.Handler {
+	base := s.basePath()
+	if base == "" {
+		return handler
+	}
+	stripped := http.StripPrefix(base, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == base {
+			http.Redirect(w, r, base+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, base+"/") {
+			sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Not found: the server is served under %s/", base))
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
+}
+
+// handler returns the server's handler for its HTTP server: forwarding
+// headers from trusted proxies are applied, then the base path stripped,
+// before requests are sent to their workspace
+func (s *Server) handler(proxies trustedProxies) http.Handler {
+	next := s.withBasePath(s)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, proxies.forwarded(r))
+	})
+}
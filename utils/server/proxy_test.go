@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5", "::1"})
+	require.NoError(t, err)
+	assert.True(t, proxies.trusts("10.1.2.3:4000"))
+	assert.True(t, proxies.trusts("192.168.1.5"))
+	assert.True(t, proxies.trusts("[::1]:8080"))
+	assert.False(t, proxies.trusts("192.168.1.6:80"))
+	assert.False(t, proxies.trusts("not-an-address"))
+
+	_, err = parseTrustedProxies([]string{"10.0.0.0/99"})
+	assert.Error(t, err)
+	_, err = parseTrustedProxies([]string{"proxy.internal"})
+	assert.Error(t, err)
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	request := func(peer string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/runs", nil)
+		r.RemoteAddr = peer
+		r.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.9, 10.0.0.2")
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "comanda.example.com")
+		return r
+	}
+
+	// From a trusted proxy, the client is the last address no trusted
+	// proxy added; the one before it was set by the client
+	r := proxies.forwarded(request("10.0.0.1:5000"))
+	assert.Equal(t, "203.0.113.9", r.RemoteAddr)
+	assert.Equal(t, "https", r.URL.Scheme)
+	assert.Equal(t, "comanda.example.com", r.Host)
+
+	// From anyone else the headers are ignored
+	r = proxies.forwarded(request("203.0.113.50:5000"))
+	assert.Equal(t, "203.0.113.50:5000", r.RemoteAddr)
+	assert.Equal(t, "example.com", r.Host)
+
+	// Without trusted proxies nothing is believed
+	r = trustedProxies(nil).forwarded(request("10.0.0.1:5000"))
+	assert.Equal(t, "10.0.0.1:5000", r.RemoteAddr)
+
+	// When every hop is trusted the first is the client
+	assert.Equal(t, "10.0.0.9", proxies.clientAddr([]string{"10.0.0.9, 10.0.0.2"}))
+	assert.Equal(t, "", proxies.clientAddr([]string{"unknown"}))
+}
+
+func TestBasePath(t *testing.T) {
+	s := newAPITestServer(t)
+	s.mux = http.NewServeMux()
+	s.config.BasePath = "/comanda/"
+	s.routes()
+	handler := s.handler(nil)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("/comanda/health").Code)
+	assert.Equal(t, http.StatusOK, get("/comanda/ui/").Code)
+	assert.Equal(t, http.StatusNotFound, get("/health").Code)
+	assert.Equal(t, http.StatusNotFound, get("/comandas/health").Code)
+
+	w := get("/comanda")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/comanda/", w.Header().Get("Location"))
+	w = get("/comanda/")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/comanda/ui/", w.Header().Get("Location"))
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// errQueueFull is returned when every worker is busy and the queue is full
+var errQueueFull = errors.New("run queue is full")
+
+// errWorkflowBusy is returned when a workflow has as many runs in progress
+// as its concurrency section allows and refuses more
+var errWorkflowBusy = errors.New("workflow has too many runs in progress")
+
+// runJob is a run of a stored workflow, waiting for or held by a worker
+type runJob struct {
+	recorder   *history.Recorder
+	proc       *processor.Processor
+	req        RunRequest // Queues the run again when a shutdown suspends it
+	input      string
+	runtimeDir string
+	webhooks   []processor.Webhook // Notified once the run finishes
+	workflow   string
+	limit      processor.Concurrency // Runs of the workflow executed at once
+	adjusted   []string              // Settings lowered to fit the run limits
+	actor      string                // Who the run was started for, for the audit log
+	inline     []byte                // Content of a workflow that isn't stored, for resuming the run
+	runsOn     []string              // Labels of the remote workers that may execute the run
+	priority   string                // Priority class of the run; empty is interactive
+	content    []byte                // The workflow with its parameters bound, sent to a remote worker
+	ctx        context.Context
+	cancel     context.CancelFunc // Stops the run before its next step
+	done       chan struct{}      // Closed once the run is finished and recorded
+
+	mu       sync.Mutex
+	progress string // Latest progress message from the processor
+	output   string
+	err      error
+	started  bool  // Set once a worker picks the run up
+	canceled error // Why the run was cancelled, once it is
+
+	approvals map[string]*pendingApproval // Approval steps the run waits at, by step
+
+	recording sync.WaitGroup // Held while a run cancelled before it started is recorded
+}
+
+// stop cancels the run with reason. It reports whether a worker had picked
+// the run up already, and false for ok when the run was cancelled before.
+// The caller records a run that hadn't started, then calls recording.Done.
+func (j *runJob) stop(reason error) (started, ok bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.canceled != nil {
+		return j.started, false
+	}
+	j.canceled = reason
+	j.cancel()
+	if !j.started {
+		j.recording.Add(1)
+	}
+	return j.started, true
+}
+
+// begin marks the run picked up by a worker. It returns why the run was
+// cancelled if it was, before it started.
+func (j *runJob) begin() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.started = true
+	return j.canceled
+}
+
+// cancelReason returns why the run was cancelled, or nil
+func (j *runJob) cancelReason() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.canceled
+}
+
+// WriteProgress keeps the latest step message for status polling
+func (j *runJob) WriteProgress(update processor.ProgressUpdate) error {
+	if update.Message == "" {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress = update.Message
+	return nil
+}
+
+// latestProgress returns the latest progress message
+func (j *runJob) latestProgress() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// result returns the run's final output and error once it is done
+func (j *runJob) result() (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.output, j.err
+}
+
+// Priority classes of runs. Runs waiting for a worker start in the order
+// they were queued within their class, interactive runs before batch ones.
+const (
+	PriorityInteractive = "interactive" // Runs someone is waiting for; the default
+	PriorityBatch       = "batch"       // Scheduled and bulk runs that can wait
+)
+
+// priorityClasses are the priority classes in the order workers serve them
+var priorityClasses = []string{PriorityInteractive, PriorityBatch}
+
+// checkPriority returns an error for an unknown priority class. Empty is
+// interactive.
+func checkPriority(priority string) error {
+	switch priority {
+	case "", PriorityInteractive, PriorityBatch:
+		return nil
+	}
+	return fmt.Errorf("unknown priority '%s' (use %s or %s)", priority, PriorityInteractive, PriorityBatch)
+}
+
+// runQueue executes submitted runs on a fixed pool of workers. Interactive
+// runs are started before batch runs, except that while batch runs wait,
+// every batchEvery-th run started is one of them so they aren't starved.
+// Runs of a workflow with a concurrency limit are held back while the
+// workflow has that many runs queued or running, and are queued in the
+// place of the first of them that finishes.
+type runQueue struct {
+	depth      int // Jobs that may wait for a worker or be held
+	batchEvery int
+	run        func(*runJob)
+	draining   context.Context // Done once stop is called
+	stop       context.CancelFunc
+
+	mu      sync.Mutex
+	ready   *sync.Cond           // Signalled when a job is queued
+	queued  map[string][]*runJob // Jobs waiting for a worker by priority class
+	streak  int                  // Interactive jobs started in a row while batch jobs waited
+	active  map[string]*runJob   // Queued, held and running jobs by run ID
+	running map[string]int       // Queued and running jobs by workflow
+	held    map[string][]*runJob // Jobs waiting for a run of their workflow to finish
+	waiting int                  // Held jobs of all workflows
+}
+
+// newRunQueue starts workers that call run for each submitted job. Up to
+// depth jobs wait for a free worker, and while batch jobs wait at least
+// every batchEvery-th job started is one of them.
+func newRunQueue(workers, depth, batchEvery int, run func(*runJob)) *runQueue {
+	draining, stop := context.WithCancel(context.Background())
+	q := &runQueue{
+		depth:      depth,
+		batchEvery: batchEvery,
+		draining:   draining,
+		stop:       stop,
+		run:        run,
+		queued:     make(map[string][]*runJob),
+		active:     make(map[string]*runJob),
+		running:    make(map[string]int),
+		held:       make(map[string][]*runJob),
+	}
+	q.ready = sync.NewCond(&q.mu)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// work runs jobs as they are queued
+func (q *runQueue) work() {
+	for {
+		job := q.next()
+		q.run(job)
+		q.finish(job)
+	}
+}
+
+// next waits for a queued job and takes the one to start: the first
+// interactive job, unless batch jobs have waited through batchEvery-1
+// interactive ones in a row
+func (q *runQueue) next() *runJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.queuedJobs() == 0 {
+		q.ready.Wait()
+	}
+	interactive, batch := q.queued[PriorityInteractive], q.queued[PriorityBatch]
+	class := PriorityInteractive
+	if len(batch) > 0 && (len(interactive) == 0 || q.streak >= q.batchEvery-1) {
+		class = PriorityBatch
+	}
+	switch {
+	case class == PriorityBatch:
+		q.streak = 0
+	case len(batch) > 0:
+		q.streak++
+	default:
+		q.streak = 0
+	}
+	job := q.queued[class][0]
+	q.queued[class] = q.queued[class][1:]
+	return job
+}
+
+// queuedJobs returns the number of jobs waiting for a worker. The caller
+// holds mu.
+func (q *runQueue) queuedJobs() int {
+	n := 0
+	for _, class := range priorityClasses {
+		n += len(q.queued[class])
+	}
+	return n
+}
+
+// enqueue adds a job to the queue of its priority class and wakes a
+// worker. The caller holds mu.
+func (q *runQueue) enqueue(job *runJob) {
+	class := job.priority
+	if class == "" {
+		class = PriorityInteractive
+	}
+	q.queued[class] = append(q.queued[class], job)
+	q.ready.Signal()
+}
+
+// finish marks a job done, and queues the next held job of its workflow in
+// its place
+func (q *runQueue) finish(job *runJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.release(job)
+}
+
+// release removes a job that was queued or running, and queues the next
+// held job of its workflow in its place. The caller holds mu.
+func (q *runQueue) release(job *runJob) {
+	delete(q.active, job.recorder.ID())
+	close(job.done)
+
+	if held := q.held[job.workflow]; len(held) > 0 {
+		q.held[job.workflow] = held[1:]
+		q.waiting--
+		q.enqueue(held[0])
+		return
+	}
+	delete(q.held, job.workflow)
+	if q.running[job.workflow]--; q.running[job.workflow] <= 0 {
+		delete(q.running, job.workflow)
+	}
+}
+
+// submit queues a job, or holds it back when its workflow is at its limit.
+// It returns errQueueFull when the queued and held jobs fill the queue's
+// depth, and errWorkflowBusy when the workflow refuses more runs, without
+// waiting.
+func (q *runQueue) submit(job *runJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queuedJobs()+q.waiting >= q.depth {
+		return errQueueFull
+	}
+	if limit := job.limit; limit.MaxRuns > 0 && q.running[job.workflow] >= limit.MaxRuns {
+		held := q.held[job.workflow]
+		if limit.OnLimit == processor.OnLimitReject || (limit.MaxQueued > 0 && len(held) >= limit.MaxQueued) {
+			return errWorkflowBusy
+		}
+		q.held[job.workflow] = append(held, job)
+		q.waiting++
+		q.active[job.recorder.ID()] = job
+		return nil
+	}
+	q.running[job.workflow]++
+	q.active[job.recorder.ID()] = job
+	q.enqueue(job)
+	return nil
+}
+
+// withdraw removes a job that no worker picked up yet from the queue,
+// reporting whether it found it. A job that was queued rather than held
+// gives its workflow's place to the next held job.
+func (q *runQueue) withdraw(job *runJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	held := q.held[job.workflow]
+	for i, j := range held {
+		if j == job {
+			q.held[job.workflow] = append(held[:i:i], held[i+1:]...)
+			q.waiting--
+			delete(q.active, job.recorder.ID())
+			close(job.done)
+			return true
+		}
+	}
+	for _, class := range priorityClasses {
+		queued := q.queued[class]
+		for i, j := range queued {
+			if j == job {
+				q.queued[class] = append(queued[:i:i], queued[i+1:]...)
+				q.release(job)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// job returns the queued or running job of a run
+func (q *runQueue) job(id string) (*runJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.active[id]
+	return job, ok
+}
+
+// wait returns once no job is queued, held or running, or ctx is done
+func (q *runQueue) wait(ctx context.Context) error {
+	for {
+		q.mu.Lock()
+		var next *runJob
+		for _, job := range q.active {
+			next = job
+			break
+		}
+		q.mu.Unlock()
+		if next == nil {
+			return nil
+		}
+		select {
+		case <-next.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pending returns the jobs that are still queued, held or running
+func (q *runQueue) pending() []*runJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]*runJob, 0, len(q.active))
+	for _, job := range q.active {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunQueueDepth(t *testing.T) {
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newJob := func() *runJob {
+		recorder, err := store.Enqueue("w")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &runJob{recorder: recorder, done: make(chan struct{})}
+	}
+
+	release := make(chan struct{})
+	started := make(chan string, 3)
+	q := newRunQueue(1, 1, 1, func(job *runJob) {
+		started <- job.recorder.ID()
+		<-release
+	})
+
+	first, second := newJob(), newJob()
+	assert.NoError(t, q.submit(first))
+	assert.Equal(t, first.recorder.ID(), <-started) // The worker holds the first job
+	assert.NoError(t, q.submit(second))             // The second waits in the queue
+	assert.ErrorIs(t, q.submit(newJob()), errQueueFull)
+
+	_, ok := q.job(second.recorder.ID())
+	assert.True(t, ok)
+
+	close(release)
+	<-first.done
+	<-second.done
+	_, ok = q.job(first.recorder.ID())
+	assert.False(t, ok)
+}
+
+func TestRunQueueWorkflowLimit(t *testing.T) {
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newJob := func(workflow string, limit processor.Concurrency) *runJob {
+		recorder, err := store.Enqueue(workflow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &runJob{recorder: recorder, workflow: workflow, limit: limit, done: make(chan struct{})}
+	}
+
+	release := make(chan struct{})
+	started := make(chan *runJob, 5)
+	q := newRunQueue(2, 10, 1, func(job *runJob) {
+		started <- job
+		<-release
+	})
+
+	queued := processor.Concurrency{MaxRuns: 1, MaxQueued: 1}
+	first, second := newJob("digest", queued), newJob("digest", queued)
+	assert.NoError(t, q.submit(first))
+	assert.Equal(t, first, <-started)
+	assert.NoError(t, q.submit(second)) // Held until the first finishes
+	assert.ErrorIs(t, q.submit(newJob("digest", queued)), errWorkflowBusy)
+	_, ok := q.job(second.recorder.ID())
+	assert.True(t, ok)
+
+	rejected := processor.Concurrency{MaxRuns: 1, OnLimit: processor.OnLimitReject}
+	other := newJob("triage", rejected)
+	assert.NoError(t, q.submit(other)) // Other workflows use the free worker
+	assert.Equal(t, other, <-started)
+	assert.ErrorIs(t, q.submit(newJob("triage", rejected)), errWorkflowBusy)
+
+	select {
+	case job := <-started:
+		t.Fatalf("run %s started while its workflow was at its limit", job.recorder.ID())
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release <- struct{}{} // Finish one of the running jobs
+	release <- struct{}{}
+	assert.Equal(t, second, <-started)
+	close(release)
+	<-second.done
+	<-other.done
+	assert.NoError(t, q.submit(newJob("triage", rejected)))
+}
+
+func TestRunQueuePriority(t *testing.T) {
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newJob := func(priority string) *runJob {
+		recorder, err := store.Enqueue("w")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &runJob{recorder: recorder, workflow: "w", priority: priority, done: make(chan struct{})}
+	}
+
+	release := make(chan struct{})
+	started := make(chan *runJob, 10)
+	q := newRunQueue(1, 10, 3, func(job *runJob) {
+		started <- job
+		<-release
+	})
+	blocker := newJob(PriorityInteractive)
+	assert.NoError(t, q.submit(blocker))
+	assert.Equal(t, blocker, <-started)
+
+	// Batch runs queued first wait for interactive ones, but one in every
+	// three runs started is a batch run while any wait
+	batch := []*runJob{newJob(PriorityBatch), newJob(PriorityBatch)}
+	interactive := []*runJob{newJob(""), newJob(PriorityInteractive), newJob(PriorityInteractive), newJob(PriorityInteractive)}
+	for _, job := range append(append([]*runJob{}, batch...), interactive...) {
+		assert.NoError(t, q.submit(job))
+	}
+	want := []*runJob{interactive[0], interactive[1], batch[0], interactive[2], interactive[3], batch[1]}
+	for _, job := range want {
+		release <- struct{}{}
+		assert.Equal(t, job.recorder.ID(), (<-started).recorder.ID())
+	}
+	close(release)
+}
+
+func TestRunQueueWithdraw(t *testing.T) {
+	store, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newJob := func() *runJob {
+		recorder, err := store.Enqueue("w")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &runJob{recorder: recorder, workflow: "w", limit: processor.Concurrency{MaxRuns: 2}, done: make(chan struct{})}
+	}
+
+	release := make(chan struct{})
+	started := make(chan *runJob, 5)
+	q := newRunQueue(1, 10, 1, func(job *runJob) {
+		started <- job
+		<-release
+	})
+	first, queued, held := newJob(), newJob(), newJob()
+	assert.NoError(t, q.submit(first))
+	assert.Equal(t, first, <-started)
+	assert.NoError(t, q.submit(queued)) // Waits for the worker
+	assert.NoError(t, q.submit(held))   // Waits for a run of the workflow to finish
+
+	// Withdrawing the queued job lets the held one take its place
+	assert.True(t, q.withdraw(queued))
+	<-queued.done
+	release <- struct{}{}
+	assert.Equal(t, held, <-started)
+	close(release)
+	<-held.done
+	_, ok := q.job(queued.recorder.ID())
+	assert.False(t, ok)
+}
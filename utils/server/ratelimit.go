@@ -0,0 +1,50 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter holds the rate limit buckets of all callers
+var limiter = &rateLimiter{buckets: make(map[string]*tokenBucket)}
+
+// rateLimiter gives each caller a token bucket holding a minute's worth of
+// requests, refilled continuously
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from key's bucket, reporting whether one was available
+// and, if not, how long until one will be. A limit of 0 allows everything.
+func (l *rateLimiter) allow(key string, perMinute int, now time.Time) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(perMinute)
+	rate := capacity / time.Minute.Seconds()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	l := &rateLimiter{buckets: make(map[string]*tokenBucket)}
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		ok, _ := l.allow("k", 60, now)
+		assert.True(t, ok)
+	}
+	ok, wait := l.allow("k", 60, now)
+	assert.False(t, ok)
+	assert.InDelta(t, time.Second, wait, float64(10*time.Millisecond))
+
+	ok, _ = l.allow("k", 60, now.Add(time.Second))
+	assert.True(t, ok)
+	ok, _ = l.allow("other", 0, now)
+	assert.True(t, ok)
+}
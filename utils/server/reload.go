@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ReloadConfig, when set, loads the environment configuration again the way
+// it was loaded at startup. A running server calls it when the environment
+// file changes, and at every check when settings reference a secret manager,
+// so rotated keys reach new runs without a restart.
+var ReloadConfig func() (*config.EnvConfig, error)
+
+// env returns the environment configuration new runs use
+func (s *Server) env() *config.EnvConfig {
+	s.envMu.RLock()
+	defer s.envMu.RUnlock()
+	return s.envConfig
+}
+
+// setEnv makes new runs use cfg; runs already started keep theirs
+func (s *Server) setEnv(cfg *config.EnvConfig) {
+	s.envMu.Lock()
+	s.envConfig = cfg
+	s.envMu.Unlock()
+}
+
+// fileStamp tells whether a file changed
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// watchConfig reloads the environment configuration every interval when
+// the file at path changed or settings reference a secret manager, until
+// ctx is done
+func (s *Server) watchConfig(ctx context.Context, path string, every time.Duration) {
+	last := stampFile(path)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stamp := stampFile(path)
+		changed := stamp != last
+		if !changed && !s.env().HasSecretRefs() {
+			continue
+		}
+		cfg, err := ReloadConfig()
+		if err != nil {
+			// Report a broken file once; secret managers are retried quietly
+			if changed {
+				logger.Printf("Keeping the current configuration: %v", err)
+			} else {
+				config.DebugLog("Error reloading secrets: %v", err)
+			}
+			last = stamp
+			continue
+		}
+		last = stamp
+		s.reload(cfg)
+	}
+}
+
+// reload makes new runs of the server and its workspaces use cfg when it
+// differs from the configuration in use
+func (s *Server) reload(cfg *config.EnvConfig) {
+	current := s.env()
+	if sameConfig(current, cfg) {
+		return
+	}
+	changes := configChanges(current, cfg)
+	s.setEnv(cfg)
+
+	s.workspacesMu.Lock()
+	for name, ws := range s.workspaces {
+		wsConfig := ws.workspace
+		if server := cfg.Server; server != nil {
+			if reloaded := server.FindWorkspace(name); reloaded != nil {
+				wsConfig = reloaded
+			}
+		}
+		ws.setEnv(cfg.ForWorkspace(ws.config, wsConfig))
+	}
+	s.workspacesMu.Unlock()
+
+	if len(changes) == 0 {
+		changes = []string{"settings"}
+	}
+	logger.Printf("Reloaded the configuration for new runs: %s changed", strings.Join(changes, ", "))
+}
+
+// sameConfig reports whether two configurations hold the same settings
+func sameConfig(a, b *config.EnvConfig) bool {
+	dataA, errA := yaml.Marshal(a)
+	dataB, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// configChanges describes how the keys and models of two configurations
+// differ, without showing the keys
+func configChanges(old, cfg *config.EnvConfig) []string {
+	changes := providerChanges("", old.Providers, cfg.Providers)
+	if old.DefaultGenerationModel != cfg.DefaultGenerationModel {
+		changes = append(changes, "default model")
+	}
+	if !reflect.DeepEqual(old.ProviderPriority, cfg.ProviderPriority) {
+		changes = append(changes, "provider priority")
+	}
+	if old.Server != nil && cfg.Server != nil {
+		for _, ws := range cfg.Server.Workspaces {
+			var before map[string]*config.Provider
+			if previous := old.Server.FindWorkspace(ws.Name); previous != nil {
+				before = previous.Providers
+			}
+			changes = append(changes, providerChanges("workspace "+ws.Name+" ", before, ws.Providers)...)
+		}
+	}
+	return changes
+}
+
+// providerChanges describes how two sets of providers differ
+func providerChanges(prefix string, old, cfg map[string]*config.Provider) []string {
+	names := make(map[string]bool)
+	for name := range old {
+		names[name] = true
+	}
+	for name := range cfg {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var changes []string
+	for _, name := range sorted {
+		before, after := old[name], cfg[name]
+		switch {
+		case before == nil && after == nil:
+		case before == nil:
+			changes = append(changes, prefix+name+" added")
+		case after == nil:
+			changes = append(changes, prefix+name+" removed")
+		default:
+			if before.APIKey != after.APIKey {
+				changes = append(changes, prefix+name+" key")
+			}
+			if !reflect.DeepEqual(before.Models, after.Models) {
+				changes = append(changes, prefix+name+" models")
+			}
+		}
+	}
+	return changes
+}
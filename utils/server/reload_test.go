@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchConfig(t *testing.T) {
+	s := newWorkspaceTestServer(t)
+	alpha, err := s.workspaceServer("alpha")
+	if !assert.NoError(t, err) {
+		return
+	}
+	started := s.env()
+
+	path := filepath.Join(t.TempDir(), ".env")
+	os.WriteFile(path, []byte("providers: {}\n"), 0644)
+	var loads atomic.Int32
+	var loaded atomic.Pointer[config.EnvConfig]
+	ReloadConfig = func() (*config.EnvConfig, error) {
+		loads.Add(1)
+		if cfg := loaded.Load(); cfg != nil {
+			return cfg, nil
+		}
+		return nil, errors.New("error parsing env file")
+	}
+	t.Cleanup(func() { ReloadConfig = nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchConfig(ctx, path, 10*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+
+	// A file that fails to load keeps the configuration in use
+	os.WriteFile(path, []byte("providers: [\n"), 0644)
+	assert.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Same(t, started, s.env())
+
+	// Rotated keys reach the server and its workspaces
+	rotated := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {APIKey: "rotated-key", Models: started.Providers["openai"].Models},
+		},
+		Server: &config.ServerConfig{
+			DataDir:    started.Server.DataDir,
+			Workspaces: []config.Workspace{{Name: "alpha", Providers: map[string]*config.Provider{"openai": {APIKey: "alpha-rotated"}}}},
+		},
+	}
+	loaded.Store(rotated)
+	os.WriteFile(path, []byte("providers:\n  openai: {}\n"), 0644)
+	assert.Eventually(t, func() bool { return s.env() == rotated }, time.Second, 5*time.Millisecond)
+	provider, err := alpha.env().GetProviderConfig("openai")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alpha-rotated", provider.APIKey)
+		assert.Len(t, provider.Models, 1)
+	}
+	assert.Equal(t, "shared-key", started.Providers["openai"].APIKey, "runs already started keep their keys")
+
+	// Without secret references, an unchanged file isn't loaded again
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), loads.Load())
+}
+
+func TestConfigChanges(t *testing.T) {
+	models := []config.Model{{Name: "gpt-4o", Type: "external", Modes: []config.ModelMode{config.TextMode}}}
+	old := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai":    {APIKey: "sk-1", Models: models},
+			"anthropic": {APIKey: "sk-ant"},
+		},
+		DefaultGenerationModel: "gpt-4o",
+		Server:                 &config.ServerConfig{Workspaces: []config.Workspace{{Name: "alpha"}}},
+	}
+	cfg := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {APIKey: "sk-2", Models: append(models, config.Model{Name: "gpt-4o-mini", Type: "external"})},
+			"google": {APIKey: "g"},
+		},
+		DefaultGenerationModel: "gpt-4o-mini",
+		Server:                 &config.ServerConfig{Workspaces: []config.Workspace{{Name: "alpha", Providers: map[string]*config.Provider{"openai": {APIKey: "a"}}}}},
+	}
+	assert.Equal(t, []string{
+		"anthropic removed", "google added", "openai key", "openai models", "default model", "workspace alpha openai added",
+	}, configChanges(old, cfg))
+	assert.True(t, sameConfig(old, old))
+	assert.False(t, sameConfig(old, cfg))
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+// What garbage collection removes, as metrics label them
+const (
+	gcRuns      = "runs"
+	gcArtifacts = "artifacts"
+	gcCaches    = "caches"
+)
+
+// gcStats counts what garbage collection removed since the server started.
+// It is shared with workspaces.
+type gcStats struct {
+	mu          sync.Mutex
+	collections int
+	last        time.Time
+	removed     map[string]int   // Items removed, by what they were
+	reclaimed   map[string]int64 // Bytes freed, by what was removed
+	keptRuns    int              // Runs stored after the last collection
+	keptBytes   int64            // Their size
+}
+
+func newGCStats() *gcStats {
+	return &gcStats{removed: make(map[string]int), reclaimed: make(map[string]int64)}
+}
+
+// runRetention applies the retention limits now and then every collection
+// interval until ctx is done
+func (s *Server) runRetention(ctx context.Context) {
+	s.collectGarbage(time.Now())
+	ticker := time.NewTicker(s.config.Retention.CollectInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.collectGarbage(now)
+		}
+	}
+}
+
+// collectGarbage removes the runs and artifacts of this server and its
+// workspaces that are over the retention limits, and the temp files runs
+// left behind, counting what it reclaimed
+func (s *Server) collectGarbage(now time.Time) {
+	retention := s.config.Retention
+	removed := make(map[string]int)
+	reclaimed := make(map[string]int64)
+	var keptRuns int
+	var keptBytes int64
+
+	servers := []*Server{s}
+	for _, ws := range s.config.Workspaces {
+		if server, err := s.workspaceServer(ws.Name); err == nil {
+			servers = append(servers, server)
+		}
+	}
+	for _, server := range servers {
+		store, err := server.runStore()
+		if err != nil {
+			s.logf("Error collecting garbage: %v", err)
+			continue
+		}
+		limits := history.Retention{MaxRuns: retention.MaxRuns, MaxBytes: int64(retention.MaxSizeMB) << 20}
+		if retention.MaxAgeDays > 0 {
+			limits.Before = now.AddDate(0, 0, -retention.MaxAgeDays)
+		}
+		if retention.ArtifactMaxAgeDays > 0 {
+			limits.ArtifactsBefore = now.AddDate(0, 0, -retention.ArtifactMaxAgeDays)
+		}
+		result, err := store.Collect(limits)
+		if err != nil {
+			server.logf("Error collecting garbage: %v", err)
+			continue
+		}
+		removed[gcRuns] += len(result.Runs)
+		reclaimed[gcRuns] += result.Bytes
+		removed[gcArtifacts] += result.Artifacts
+		reclaimed[gcArtifacts] += result.ArtifactBytes
+		keptRuns += result.Kept
+		keptBytes += result.KeptBytes
+	}
+
+	files, err := fileutil.FindTempFiles(os.TempDir(), now.Add(-retention.CacheMaxAge()))
+	if err != nil {
+		s.logf("Error collecting garbage: %v", err)
+	}
+	for _, file := range files {
+		if err := os.RemoveAll(file.Path); err != nil {
+			s.logf("Error removing %s: %v", file.Path, err)
+			continue
+		}
+		removed[gcCaches]++
+		reclaimed[gcCaches] += file.Size
+	}
+
+	if total := removed[gcRuns] + removed[gcArtifacts] + removed[gcCaches]; total > 0 {
+		s.logf("Garbage collection removed %d run(s), the artifacts of %d run(s) and %d temp file(s), reclaiming %d bytes",
+			removed[gcRuns], removed[gcArtifacts], removed[gcCaches], reclaimed[gcRuns]+reclaimed[gcArtifacts]+reclaimed[gcCaches])
+	}
+
+	stats := s.gc
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.collections++
+	stats.last = now
+	for kind, n := range removed {
+		stats.removed[kind] += n
+	}
+	for kind, n := range reclaimed {
+		stats.reclaimed[kind] += n
+	}
+	stats.keptRuns, stats.keptBytes = keptRuns, keptBytes
+}
+
+// handleMetrics serves /metrics: what garbage collection removed and
+// reclaimed, in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	stats := s.gc
+	if stats == nil {
+		stats = newGCStats() // Retention isn't configured: nothing was collected
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP comanda_gc_collections_total Garbage collections run since the server started.")
+	fmt.Fprintln(w, "# TYPE comanda_gc_collections_total counter")
+	fmt.Fprintf(w, "comanda_gc_collections_total %d\n", stats.collections)
+	fmt.Fprintln(w, "# HELP comanda_gc_removed_total Runs, run artifacts and temp files garbage collection removed.")
+	fmt.Fprintln(w, "# TYPE comanda_gc_removed_total counter")
+	for _, kind := range []string{gcRuns, gcArtifacts, gcCaches} {
+		fmt.Fprintf(w, "comanda_gc_removed_total{kind=%q} %d\n", kind, stats.removed[kind])
+	}
+	fmt.Fprintln(w, "# HELP comanda_gc_reclaimed_bytes_total Disk space garbage collection freed.")
+	fmt.Fprintln(w, "# TYPE comanda_gc_reclaimed_bytes_total counter")
+	for _, kind := range []string{gcRuns, gcArtifacts, gcCaches} {
+		fmt.Fprintf(w, "comanda_gc_reclaimed_bytes_total{kind=%q} %d\n", kind, stats.reclaimed[kind])
+	}
+	if stats.collections == 0 {
+		return
+	}
+	fmt.Fprintln(w, "# HELP comanda_gc_last_collection_timestamp_seconds When garbage collection last ran.")
+	fmt.Fprintln(w, "# TYPE comanda_gc_last_collection_timestamp_seconds gauge")
+	fmt.Fprintf(w, "comanda_gc_last_collection_timestamp_seconds %d\n", stats.last.Unix())
+	fmt.Fprintln(w, "# HELP comanda_stored_runs Runs kept after the last garbage collection.")
+	fmt.Fprintln(w, "# TYPE comanda_stored_runs gauge")
+	fmt.Fprintf(w, "comanda_stored_runs %d\n", stats.keptRuns)
+	fmt.Fprintln(w, "# HELP comanda_stored_run_bytes Size of the kept runs' step outputs and artifacts.")
+	fmt.Fprintln(w, "# TYPE comanda_stored_run_bytes gauge")
+	fmt.Fprintf(w, "comanda_stored_run_bytes %d\n", stats.keptBytes)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	old := time.Now().Add(-48 * time.Hour)
+	leftover := filepath.Join(tmp, "comanda-stdin-1.txt")
+	os.WriteFile(leftover, []byte("piped"), 0644)
+	os.Chtimes(leftover, old, old)
+
+	s := newAPITestServer(t)
+	s.config.Retention = &config.Retention{MaxRuns: 2}
+	s.gc = newGCStats()
+	store, _ := s.runStore()
+	base := time.Now().Add(-time.Hour)
+	for i, id := range []string{"r1", "r2", "r3"} {
+		store.Save(&history.Run{ID: id, Workflow: "summary", Status: history.StatusSucceeded, Started: base.Add(time.Duration(i) * time.Minute)})
+		store.SaveStepOutput(id, "step", "0123456789")
+	}
+
+	s.collectGarbage(time.Now())
+
+	runs, _ := store.List()
+	if assert.Len(t, runs, 2) {
+		assert.Equal(t, "r3", runs[0].ID)
+		assert.Equal(t, "r2", runs[1].ID)
+	}
+	assert.NoFileExists(t, leftover)
+
+	w := apiRequest(s.handleMetrics, http.MethodGet, "/metrics", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "comanda_gc_collections_total 1\n")
+	assert.Contains(t, body, `comanda_gc_removed_total{kind="runs"} 1`)
+	assert.Contains(t, body, `comanda_gc_reclaimed_bytes_total{kind="runs"} 10`)
+	assert.Contains(t, body, `comanda_gc_removed_total{kind="caches"} 1`)
+	assert.Contains(t, body, `comanda_gc_reclaimed_bytes_total{kind="caches"} 5`)
+	assert.Contains(t, body, "comanda_stored_runs 2\n")
+	assert.Contains(t, body, "comanda_stored_run_bytes 20\n")
+}
+
+func TestMetricsWithoutRetention(t *testing.T) {
+	s := newAPITestServer(t)
+	w := apiRequest(s.handleMetrics, http.MethodGet, "/metrics", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "comanda_gc_collections_total 0\n")
+	assert.NotContains(t, w.Body.String(), "comanda_stored_runs")
+}
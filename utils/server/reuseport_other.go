@@ -0,0 +1,14 @@
+//go:build !unix
+
+package server
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// reusePortControl refuses to bind, as SO_REUSEPORT isn't available
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return fmt.Errorf("reusePort is not supported on %s", runtime.GOOS)
+}
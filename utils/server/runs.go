@@ -0,0 +1,722 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/respcache"
+	"github.com/kris-hansen/comanda/utils/sandbox"
+	"gopkg.in/yaml.v3"
+)
+
+// cancelWait is how long cancelling a running run waits for it to stop
+// before responding
+const cancelWait = 5 * time.Second
+
+// runEventInterval is how often a run's event stream checks it for changes
+const runEventInterval = 500 * time.Millisecond
+
+// runStore returns the store that records the server's runs, opening it on
+// first use. Run records go to the history database when the env config
+// names one, so the CLI's history commands can read them too.
+func (s *Server) runStore() (*history.Store, error) {
+	s.storeOnce.Do(func() {
+		dir := s.config.HistoryDir
+		if dir == "" {
+			dir = filepath.Join(s.config.DataDir, ".comanda", "runs")
+		}
+		s.store, s.storeErr = history.OpenConfigured(dir, s.env())
+	})
+	return s.store, s.storeErr
+}
+
+// useResponseCache makes a run answer repeated prompts from the response
+// cache, when the env config enables it
+func useResponseCache(proc *processor.Processor, env *config.EnvConfig) {
+	cache, err := respcache.FromConfig(env)
+	if err != nil {
+		config.DebugLog("[Server] Running without the response cache: %v", err)
+	}
+	proc.SetResponseCache(cache)
+}
+
+// handleRuns serves /runs: GET lists past runs, most recent first, and POST
+// runs a stored workflow
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListRuns(w, r)
+	case http.MethodPost:
+		s.handleStartRun(w, r)
+	default:
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleRun serves the paths under /runs/{id}
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Expected formats:
+	// {id} -> the run and its steps
+	// {id}/approval -> POST approves or rejects the step the run waits at
+	// {id}/events -> the run as server-sent events until it finishes
+	// {id}/steps/{step}/output -> a step's response
+	// {id}/artifacts -> files the run wrote
+	// {id}/artifacts/{path} -> one of those files
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/runs/"), "/", 3)
+	if parts[0] == "" {
+		sendJSONError(w, http.StatusBadRequest, "Run ID is required in the path")
+		return
+	}
+
+	store, err := s.runStore()
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	run, err := store.Get(parts[0])
+	if errors.Is(err, history.ErrNotFound) {
+		sendJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if len(parts) != 1 {
+			sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		s.handleCancelRun(w, r, store, run)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if len(parts) != 2 || parts[1] != "approval" {
+			sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		s.handleRunApproval(w, r, run)
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		json.NewEncoder(w).Encode(s.runResponse(run))
+	case parts[1] == "events" && len(parts) == 2:
+		s.handleRunEvents(w, r, store, run.ID)
+	case parts[1] == "steps" && len(parts) == 3 && strings.HasSuffix(parts[2], "/output"):
+		s.handleStepOutput(w, run, strings.TrimSuffix(parts[2], "/output"))
+	case parts[1] == "artifacts" && len(parts) == 2:
+		s.handleListArtifacts(w, store, run)
+	case parts[1] == "artifacts":
+		s.handleArtifactDownload(w, r, store, run, parts[2])
+	default:
+		sendJSONError(w, http.StatusNotFound, "Invalid path")
+	}
+}
+
+// handleCancelRun cancels a queued or running run. A queued run is recorded
+// as canceled at once. A running run stops its provider calls in flight and
+// starts no further steps; it is recorded as canceled with the steps,
+// output and artifacts it finished, and the response waits a moment for
+// that. It is 202 Accepted if the run hasn't stopped by then, as a run on a
+// remote worker may not have.
+func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request, store *history.Store, run *history.Run) {
+	job, ok := s.runQueue().job(run.ID)
+	if !ok {
+		sendJSONError(w, http.StatusConflict, fmt.Sprintf("Run %s is not queued or running; it %s", run.ID, run.Status))
+		return
+	}
+	reason := history.ErrCanceled
+	if actor := s.requestActor(r); actor != "anonymous" {
+		reason = fmt.Errorf("%w by %s", history.ErrCanceled, actor)
+	}
+	started, stopped := job.stop(reason)
+	if stopped {
+		s.logf("Run %s of workflow %s: %v", run.ID, job.workflow, reason)
+		if !started {
+			// Recorded before it leaves the queue, so followers see the end
+			s.finishRun(job, "", reason)
+			job.recording.Done()
+			s.runQueue().withdraw(job)
+		}
+	}
+
+	status := http.StatusOK
+	if started {
+		select {
+		case <-job.done:
+		case <-r.Context().Done():
+			return
+		case <-time.After(cancelWait):
+			status = http.StatusAccepted
+		}
+	}
+	if latest, err := store.Get(run.ID); err == nil {
+		run = latest
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(s.runResponse(run))
+}
+
+// runResponse describes a run. While the run is queued or running its steps
+// so far and latest progress message come from its worker; once it finished
+// the final output is included.
+func (s *Server) runResponse(run *history.Run) RunResponse {
+	resp := RunResponse{Success: run.Status != history.StatusFailed && run.Status != history.StatusCanceled, Error: run.Error, Run: run}
+	if job, ok := s.runQueue().job(run.ID); ok {
+		live := job.recorder.Run()
+		resp.Run = &live
+		resp.Progress = job.latestProgress()
+		resp.Approvals = job.pendingApprovals()
+	} else if run.OutputFile != "" {
+		if data, err := os.ReadFile(run.OutputFile); err == nil {
+			resp.Output = string(data)
+		}
+	}
+	return resp
+}
+
+// handleRunEvents streams a run as server-sent events: a run event whenever
+// its status, steps or progress change, then a done event with the final
+// record and output once it is no longer queued or running
+func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request, store *history.Store, id string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, _ := w.(http.Flusher)
+
+	ticker := time.NewTicker(runEventInterval)
+	defer ticker.Stop()
+	var last []byte
+	for {
+		// A run leaves the queue only once its final record is saved, so
+		// checking the queue first never misses the end of the run
+		_, active := s.runQueue().job(id)
+		var data []byte
+		event := "run"
+		run, err := store.Get(id)
+		if err != nil {
+			event = "error"
+			data, _ = json.Marshal(ErrorResponse{Success: false, Error: err.Error()})
+		} else {
+			data, _ = json.Marshal(s.runResponse(run))
+			if !active {
+				event = "done"
+			}
+		}
+
+		if event != "run" || !bytes.Equal(data, last) {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			if flusher != nil {
+				flusher.Flush()
+			}
+			last = data
+		}
+		if event != "run" {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleListRuns returns past runs. The workflow query parameter keeps runs
+// of one workflow and limit caps how many are returned.
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	store, err := s.runStore()
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	runs, err := store.List()
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			sendJSONError(w, http.StatusBadRequest, "limit must be a non-negative number")
+			return
+		}
+	}
+	workflow := r.URL.Query().Get("workflow")
+
+	shown := []history.Run{}
+	for _, run := range runs {
+		if workflow != "" && run.Workflow != workflow {
+			continue
+		}
+		shown = append(shown, run)
+		if limit > 0 && len(shown) == limit {
+			break
+		}
+	}
+	json.NewEncoder(w).Encode(RunListResponse{Success: true, Runs: shown})
+}
+
+// runQueue returns the server's run queue, starting its workers on first use
+func (s *Server) runQueue() *runQueue {
+	s.queueOnce.Do(func() {
+		s.queue = newRunQueue(s.config.Queue.WorkerCount(), s.config.Queue.MaxQueued(), s.config.Queue.BatchInterval(), s.executeRun)
+	})
+	return s.queue
+}
+
+// handleStartRun queues a run of a stored workflow and responds with its
+// ID straight away. With wait set in the request it responds once the run
+// finished, with the final output.
+func (s *Server) handleStartRun(w http.ResponseWriter, r *http.Request) {
+	var req RunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	s.startRun(w, r, req)
+}
+
+// startRun queues the run req asks for and writes the response
+func (s *Server) startRun(w http.ResponseWriter, r *http.Request, req RunRequest) {
+	// Runs outlive the request that queued them
+	job, err := s.queueRun(withActor(traceContext(r), s.requestActor(r)), req)
+	if err != nil {
+		var reqErr *runRequestError
+		if !errors.As(err, &reqErr) {
+			sendJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if reqErr.status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "30")
+		}
+		sendJSONError(w, reqErr.status, reqErr.message)
+		return
+	}
+	recorder := job.recorder
+	w.Header().Set("Location", s.basePath()+"/runs/"+recorder.ID())
+
+	if !req.Wait {
+		run := recorder.Run()
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(RunResponse{Success: true, Run: &run, Adjustments: job.adjusted})
+		return
+	}
+
+	select {
+	case <-job.done:
+	case <-r.Context().Done():
+		return // The run carries on; the client can poll for it
+	}
+	run := recorder.Run()
+	output, runErr := job.result()
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(RunResponse{
+		Success:     runErr == nil,
+		Error:       run.Error,
+		Run:         &run,
+		Output:      output,
+		Adjustments: job.adjusted,
+	})
+}
+
+// runRequestError is a run request that was refused, with the status to
+// respond with
+type runRequestError struct {
+	status  int
+	message string
+}
+
+func (e *runRequestError) Error() string {
+	return e.message
+}
+
+func refuseRun(status int, format string, args ...interface{}) error {
+	return &runRequestError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// queueRun checks a run request and queues its run, returning the run's
+// job. The run executes with ctx, so cancelling it stops the run.
+func (s *Server) queueRun(ctx context.Context, req RunRequest) (*runJob, error) {
+	return s.submitRun(ctx, req, "")
+}
+
+// submitRun queues the run of a request. With resumeID it continues that
+// suspended run instead of recording a new one, skipping the steps its
+// checkpoint finished.
+func (s *Server) submitRun(ctx context.Context, req RunRequest, resumeID string) (*runJob, error) {
+	if req.Workflow == "" {
+		return nil, refuseRun(http.StatusBadRequest, "workflow is required")
+	}
+	if req.RuntimeDir != "" {
+		if _, err := s.validatePath(req.RuntimeDir); err != nil {
+			return nil, refuseRun(http.StatusForbidden, "Invalid runtime directory: %v", err)
+		}
+	}
+
+	path, err := s.workflowPath(req.Workflow)
+	if err != nil {
+		return nil, refuseRun(http.StatusBadRequest, "%s", err.Error())
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, refuseRun(http.StatusNotFound, "Workflow '%s' not found", req.Workflow)
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading workflow: %v", err)
+	}
+	return s.submitWorkflow(ctx, strings.TrimSuffix(filepath.Base(path), ".yaml"), content, false, req, resumeID)
+}
+
+// submitWorkflow queues a run of the workflow content, recorded under
+// name. Inline workflows aren't stored, so their content is kept with the
+// run in case a shutdown suspends it.
+func (s *Server) submitWorkflow(ctx context.Context, name string, content []byte, inline bool, req RunRequest, resumeID string) (*runJob, error) {
+	if s.draining.Load() {
+		return nil, refuseRun(http.StatusServiceUnavailable, "Run not started: the server is shutting down")
+	}
+	if err := checkPriority(req.Priority); err != nil {
+		return nil, refuseRun(http.StatusBadRequest, "%s", err.Error())
+	}
+	var source []byte
+	if inline {
+		source = content
+	}
+
+	params := make(map[string]string, len(req.Params))
+	for param, value := range req.Params {
+		params[param] = fmt.Sprint(value)
+	}
+	content, err := processor.BindParams(content, params)
+	if err != nil {
+		return nil, refuseRun(http.StatusBadRequest, "%s", err.Error())
+	}
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(content, &dslConfig); err != nil {
+		return nil, refuseRun(http.StatusBadRequest, "Error parsing workflow: %v", err)
+	}
+	if len(dslConfig.RunsOn) > 0 && s.workers == nil {
+		return nil, refuseRun(http.StatusUnprocessableEntity, "Run not started: workflow '%s' runs on workers labelled %s, and the server has no remoteWorkers section", name, strings.Join(dslConfig.RunsOn, ", "))
+	}
+	hooks := append(dslConfig.Webhooks, req.Webhooks...)
+	if err := s.checkWebhooks(hooks); err != nil {
+		return nil, refuseRun(http.StatusBadRequest, "%s", err.Error())
+	}
+	if err := s.ensureRuntimeDir(req.RuntimeDir); err != nil {
+		return nil, err
+	}
+
+	// Runs on remote workers use the credential sets of the workers
+	credentials := req.Credentials
+	if credentials == "" {
+		credentials = dslConfig.Credentials
+	}
+	if credentials != "" && len(dslConfig.RunsOn) == 0 {
+		if err := s.env().CheckCredentialSet(credentials); err != nil {
+			return nil, refuseRun(http.StatusUnprocessableEntity, "Run not started: %v", err)
+		}
+	}
+
+	proc := processor.NewProcessor(&dslConfig, s.env(), s.config, false, req.RuntimeDir)
+	proc.SetCredentials(req.Credentials)
+	useResponseCache(proc, s.env())
+	adjustments, err := s.admitRun(&dslConfig, proc, req)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := s.runStore()
+	if err != nil {
+		return nil, err
+	}
+	var recorder *history.Recorder
+	if resumeID != "" {
+		recorder, err = store.Reopen(resumeID)
+	} else if err = s.checkRunQuota(store); err != nil {
+		return nil, refuseRun(http.StatusTooManyRequests, "%s", err.Error())
+	} else {
+		recorder, err = store.Enqueue(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range adjustments {
+		s.logf("Run %s of workflow %s downgraded: %s", recorder.ID(), name, note)
+	}
+	checkpoint := s.checkpointPath(recorder.ID())
+	_, statErr := os.Stat(checkpoint)
+	if err := proc.EnableCheckpoint(checkpoint, statErr == nil); err != nil {
+		recorder.Finish(err)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	job := &runJob{
+		recorder:   recorder,
+		proc:       proc,
+		req:        req,
+		input:      req.Input,
+		runtimeDir: req.RuntimeDir,
+		webhooks:   hooks,
+		workflow:   name,
+		limit:      dslConfig.Concurrency,
+		adjusted:   adjustments,
+		actor:      actorOf(ctx),
+		inline:     source,
+		runsOn:     dslConfig.RunsOn,
+		priority:   req.Priority,
+		content:    content,
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	if err := s.runQueue().submit(job); errors.Is(err, errWorkflowBusy) {
+		cancel()
+		recorder.Finish(err)
+		return nil, refuseRun(http.StatusTooManyRequests, "Run not started: workflow '%s' is at its limit of %d concurrent runs", name, dslConfig.Concurrency.MaxRuns)
+	} else if err != nil {
+		cancel()
+		recorder.Finish(err)
+		return nil, refuseRun(http.StatusServiceUnavailable, "Run not started: %v", err)
+	}
+	if resumeID == "" {
+		s.auditQueued(job)
+	}
+	config.VerboseLog("Queued run %s of workflow %s", recorder.ID(), name)
+	return job, nil
+}
+
+// executeRun runs a queued job on a worker, or has a remote worker run it
+// when its workflow names runs_on labels, recording its steps, final output
+// and artifacts
+func (s *Server) executeRun(job *runJob) {
+	defer job.cancel()
+	recorder := job.recorder
+	if job.begin() != nil {
+		job.recording.Wait() // Cancelled while it was queued; leave once that is recorded
+		return
+	}
+	if s.draining.Load() {
+		s.suspendRun(job) // Don't start runs while stopping
+		return
+	}
+	if err := recorder.Begin(); err != nil {
+		config.VerboseLog("Error recording run %s: %v", recorder.ID(), err)
+	}
+
+	ctx, stepRecorder, explain := s.limitRun(job)
+	if s.audit != nil {
+		stepRecorder = auditSteps{StepRecorder: stepRecorder, server: s, job: job}
+	}
+
+	config.VerboseLog("Starting run %s of workflow %s", recorder.ID(), recorder.Run().Workflow)
+	var output string
+	var runErr error
+	if len(job.runsOn) > 0 {
+		output, runErr = s.runRemote(ctx, job, stepRecorder)
+		runErr = explain(runErr)
+	} else {
+		proc := job.proc
+		proc.SetStepRecorder(stepRecorder)
+		proc.SetProgressWriter(job)
+		proc.SetContext(ctx)
+		proc.SetDrain(s.runQueue().draining)
+		proc.SetApprover(s.approver(job))
+		proc.SetLastOutput(job.input)
+		proc.DisableSpinner()
+		runErr = explain(proc.Process())
+		output = proc.LastOutput()
+	}
+	canceled := job.cancelReason()
+	if canceled != nil {
+		runErr = canceled
+	} else if errors.Is(runErr, processor.ErrInterrupted) && s.draining.Load() {
+		s.suspendRun(job)
+		return
+	}
+	os.Remove(s.checkpointPath(recorder.ID())) // Only a shutdown resumes runs
+	if runErr == nil || (canceled != nil && output != "") {
+		// A cancelled run keeps the output of the last step it finished
+		if err := recorder.SaveOutput(output); err != nil {
+			config.VerboseLog("Error saving output of run %s: %v", recorder.ID(), err)
+		}
+	}
+	run := recorder.Run()
+	s.saveArtifacts(recorder.Store(), &run, job.runtimeDir)
+	s.finishRun(job, output, runErr)
+}
+
+// finishRun records a run's outcome, and tells the audit log and the run's
+// webhooks about it
+func (s *Server) finishRun(job *runJob, output string, runErr error) {
+	recorder := job.recorder
+	if err := recorder.Finish(runErr); err != nil {
+		config.VerboseLog("Error recording run %s: %v", recorder.ID(), err)
+	}
+	if s.audit != nil {
+		s.auditFinished(job, recorder.Run(), output)
+	}
+	if len(job.webhooks) > 0 {
+		go s.notifyWebhooks(job.webhooks, recorder.Run(), output)
+	}
+
+	job.mu.Lock()
+	job.output, job.err = output, runErr
+	job.mu.Unlock()
+}
+
+// saveArtifacts copies the files a run's steps wrote into the run's
+// artifacts directory, so later runs writing the same paths don't replace
+// them. Outputs that aren't files, such as STDOUT, are skipped, and so are
+// paths the run's sandbox doesn't allow.
+func (s *Server) saveArtifacts(store *history.Store, run *history.Run, runtimeDir string) {
+	sb, err := sandbox.New(filepath.Join(s.config.DataDir, runtimeDir), s.config.AllowedPaths)
+	if err != nil {
+		config.VerboseLog("Error saving artifacts of run %s: %v", run.ID, err)
+		return
+	}
+	for _, output := range run.Outputs() {
+		if output == "STDOUT" {
+			continue
+		}
+		source, err := sb.Resolve(output)
+		if err != nil {
+			config.VerboseLog("Skipping artifact %s of run %s: %v", output, run.ID, err)
+			continue
+		}
+		name := filepath.Base(source)
+		if rel, err := filepath.Rel(sb.Root(), source); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		if info, err := os.Stat(source); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		target := filepath.Join(store.ArtifactsDir(run.ID), name)
+		if err := copyFile(source, target); err != nil {
+			config.VerboseLog("Error saving artifact %s of run %s: %v", output, run.ID, err)
+		}
+	}
+}
+
+// copyFile copies a file, creating the target's directory
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// handleStepOutput returns a step's stored response as plain text
+func (s *Server) handleStepOutput(w http.ResponseWriter, run *history.Run, name string) {
+	step, ok := run.Step(name)
+	if !ok {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Run %s has no step '%s'", run.ID, name))
+		return
+	}
+	if step.OutputFile == "" {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Step '%s' has no stored output", name))
+		return
+	}
+	data, err := os.ReadFile(step.OutputFile)
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error reading output of step '%s': %v", name, err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(data)
+}
+
+// handleListArtifacts lists the files a run wrote
+func (s *Server) handleListArtifacts(w http.ResponseWriter, store *history.Store, run *history.Run) {
+	dir := store.ArtifactsDir(run.ID)
+	artifacts := []ArtifactInfo{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, ArtifactInfo{Path: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error listing artifacts: %v", err))
+		return
+	}
+	json.NewEncoder(w).Encode(ArtifactListResponse{Success: true, Artifacts: artifacts})
+}
+
+// handleArtifactDownload sends one of the files a run wrote
+func (s *Server) handleArtifactDownload(w http.ResponseWriter, r *http.Request, store *history.Store, run *history.Run, name string) {
+	dir := store.ArtifactsDir(run.ID)
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		sendJSONError(w, http.StatusForbidden, "Invalid artifact path: access denied")
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Run %s has no artifact '%s'", run.ID, name))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Run %s has no artifact '%s'", run.ID, name))
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		head := make([]byte, sniffLen)
+		n, _ := io.ReadFull(f, head)
+		contentType = http.DetectContentType(head[:n])
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error reading artifact: %v", err))
+			return
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(path)}))
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
@@ -0,0 +1,457 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunWorkflow(t *testing.T) {
+	s := newAPITestServer(t)
+	workflow := `params:
+  topic:
+    required: true
+draft:
+  input: STDIN
+  model: gpt-4o
+  action: Write about {{ params.topic }}
+  output: drafts/draft.txt
+`
+	w := apiRequest(s.handleWorkflows, http.MethodPost, "/workflows", WorkflowRequest{Name: "writer", Content: workflow})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// Missing params are rejected before anything runs
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "writer"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "topic")
+
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{
+		Workflow: "writer",
+		Input:    "notes",
+		Params:   map[string]interface{}{"topic": "otters"},
+		Wait:     true,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var started RunResponse
+	json.NewDecoder(w.Body).Decode(&started)
+	assert.True(t, started.Success)
+	if !assert.NotNil(t, started.Run) {
+		return
+	}
+	assert.Equal(t, history.StatusSucceeded, started.Run.Status)
+	assert.Equal(t, "writer", started.Run.Workflow)
+	id := started.Run.ID
+
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+id, nil)
+	var got RunResponse
+	json.NewDecoder(w.Body).Decode(&got)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, started.Output, got.Output)
+	if assert.Len(t, got.Run.Steps, 1) {
+		assert.Equal(t, "draft", got.Run.Steps[0].Name)
+	}
+
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+id+"/steps/draft/output", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Write about otters")
+
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+id+"/artifacts", nil)
+	var artifacts ArtifactListResponse
+	json.NewDecoder(w.Body).Decode(&artifacts)
+	if assert.Len(t, artifacts.Artifacts, 1) {
+		assert.Equal(t, "drafts/draft.txt", artifacts.Artifacts[0].Path)
+	}
+
+	// The artifact is a copy, so it survives the file being overwritten
+	os.WriteFile(filepath.Join(s.config.DataDir, "drafts", "draft.txt"), []byte("replaced"), 0644)
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+id+"/artifacts/drafts/draft.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Write about otters")
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "draft.txt")
+
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+id+"/artifacts/../../runs.jsonl", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = apiRequest(s.handleRuns, http.MethodGet, "/runs?workflow=writer", nil)
+	var list RunListResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	assert.Len(t, list.Runs, 1)
+}
+
+func TestRunArtifactsStayInSandbox(t *testing.T) {
+	s := newAPITestServer(t)
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(secret, []byte("do not share"), 0600)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "leak.yaml"), []byte(strings.Replace(testWorkflow, "output: STDOUT", "output: "+secret, 1)), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "leak", Input: "text", Wait: true})
+	var resp RunResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if assert.NotNil(t, resp.Run, w.Body.String()) {
+		assert.Equal(t, history.StatusFailed, resp.Run.Status)
+	}
+
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+resp.Run.ID+"/artifacts", nil)
+	var artifacts ArtifactListResponse
+	json.NewDecoder(w.Body).Decode(&artifacts)
+	assert.Empty(t, artifacts.Artifacts)
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+resp.Run.ID+"/artifacts/secret.txt", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "do not share")
+
+	// Outputs the sandbox rejects are skipped even when a step recorded them
+	store, err := s.runStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(s.config.DataDir, "report.txt"), []byte("report"), 0644)
+	run := &history.Run{ID: "artifacts-test", Steps: []history.Step{{Outputs: []string{secret, "../secret.txt", "report.txt"}}}}
+	s.saveArtifacts(store, run, "")
+	entries, _ := os.ReadDir(store.ArtifactsDir(run.ID))
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "report.txt", entries[0].Name())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	s := newAPITestServer(t)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "missing"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "x", RuntimeDir: "../outside"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte(testWorkflow), 0644)
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Priority: "urgent"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown priority 'urgent'")
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Credentials: "acme"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "credential set 'acme' not found")
+
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/20200101-000000-0000", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = apiRequest(s.handleRun, http.MethodDelete, "/runs/20200101-000000-0000", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCancelRun(t *testing.T) {
+	s := newAPITestServer(t)
+	release := blockPrompts(t)
+	defer close(release)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte("concurrency:\n  max_concurrent_runs: 1\n"+testWorkflow+
+		"\nrefine:\n  input: STDIN\n  model: gpt-4o\n  action: Shorten this\n  output: STDOUT\n"), 0644)
+	submit := func() string {
+		w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Input: "text"})
+		var resp RunResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp.Run == nil {
+			t.Fatal(w.Body.String())
+		}
+		return resp.Run.ID
+	}
+	running, held := submit(), submit()
+
+	// A run waiting for its workflow's concurrency limit is canceled at once
+	w := apiRequest(s.handleRun, http.MethodDelete, "/runs/"+held, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp RunResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	assert.False(t, resp.Success)
+	if assert.NotNil(t, resp.Run) {
+		assert.Equal(t, history.StatusCanceled, resp.Run.Status)
+		assert.Equal(t, "run canceled", resp.Run.Error)
+	}
+
+	// A running run stops in the step in flight and keeps those it finished
+	release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		w := apiRequest(s.handleRun, http.MethodGet, "/runs/"+running, nil)
+		var got RunResponse
+		json.NewDecoder(w.Body).Decode(&got)
+		return got.Run != nil && len(got.Run.Steps) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	w = apiRequest(s.handleRun, http.MethodDelete, "/runs/"+running, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resp = RunResponse{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if assert.NotNil(t, resp.Run) {
+		assert.Equal(t, history.StatusCanceled, resp.Run.Status)
+		if assert.Len(t, resp.Run.Steps, 2) {
+			assert.Equal(t, history.StatusSucceeded, resp.Run.Steps[0].Status)
+			assert.Equal(t, history.StatusFailed, resp.Run.Steps[1].Status)
+		}
+	}
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+running+"/steps/summarize/output", nil)
+	assert.Contains(t, w.Body.String(), "Summarize this")
+
+	// Finished runs can't be canceled
+	w = apiRequest(s.handleRun, http.MethodDelete, "/runs/"+running, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestRunRecordsFailure(t *testing.T) {
+	s := newAPITestServer(t)
+	workflow := strings.Replace(testWorkflow, "input: STDIN", "input: missing.txt", 1)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "broken.yaml"), []byte(workflow), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "broken", Wait: true})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var resp RunResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	assert.False(t, resp.Success)
+	assert.NotEmpty(t, resp.Error)
+	if assert.NotNil(t, resp.Run) {
+		assert.Equal(t, history.StatusFailed, resp.Run.Status)
+	}
+}
+
+func TestRunQueuedAsync(t *testing.T) {
+	s := newAPITestServer(t)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte(testWorkflow), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Input: "text"})
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var queued RunResponse
+	json.NewDecoder(w.Body).Decode(&queued)
+	if !assert.NotNil(t, queued.Run) {
+		return
+	}
+	assert.Equal(t, "/runs/"+queued.Run.ID, w.Header().Get("Location"))
+	assert.Contains(t, []string{history.StatusQueued, history.StatusRunning}, queued.Run.Status)
+
+	var got RunResponse
+	assert.Eventually(t, func() bool {
+		w := apiRequest(s.handleRun, http.MethodGet, "/runs/"+queued.Run.ID, nil)
+		got = RunResponse{}
+		json.NewDecoder(w.Body).Decode(&got)
+		return got.Run != nil && got.Run.Status == history.StatusSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, got.Output, "Summarize this")
+}
+
+func TestRunConcurrencyLimit(t *testing.T) {
+	s := newAPITestServer(t)
+	release := blockPrompts(t)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte("concurrency:\n  max_concurrent_runs: 1\n  on_limit: reject\n"+testWorkflow), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Input: "text"})
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Input: "text"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "limit of 1 concurrent runs")
+
+	close(release)
+	store, _ := s.runStore()
+	assert.Eventually(t, func() bool {
+		runs, _ := store.List()
+		statuses := map[string]int{}
+		for _, run := range runs {
+			statuses[run.Status]++
+		}
+		return statuses[history.StatusSucceeded] == 1 && statuses[history.StatusFailed] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRunEvents(t *testing.T) {
+	s := newAPITestServer(t)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte(testWorkflow), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary", Input: "text"})
+	var queued RunResponse
+	json.NewDecoder(w.Body).Decode(&queued)
+	if !assert.NotNil(t, queued.Run) {
+		return
+	}
+
+	// The stream ends by itself once the run finished
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+queued.Run.ID+"/events", nil)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	last := events[len(events)-1]
+	if !assert.True(t, strings.HasPrefix(last, "event: done\ndata: "), last) {
+		return
+	}
+	for _, event := range events[:len(events)-1] {
+		assert.True(t, strings.HasPrefix(event, "event: run\n"), event)
+	}
+	var done RunResponse
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(last, "event: done\ndata: ")), &done))
+	assert.Equal(t, history.StatusSucceeded, done.Run.Status)
+	assert.Len(t, done.Run.Steps, 1)
+	assert.Contains(t, done.Output, "Summarize this")
+
+	// A finished run's stream is just the done event
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+queued.Run.ID+"/events", nil)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "event: done\n"))
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "event: "))
+}
+
+func TestRunNotifiesWebhooks(t *testing.T) {
+	s := newAPITestServer(t)
+	s.config.Webhooks.Secret = "hook-secret"
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte(testWorkflow), 0644)
+
+	deliveries := make(chan webhook.Payload, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if webhook.Verify("hook-secret", r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.EventHeader), r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now()) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload webhook.Payload
+		json.Unmarshal(body, &payload)
+		deliveries <- payload
+	}))
+	defer hook.Close()
+
+	// Subscriptions to unknown events are rejected before anything runs
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{
+		Workflow: "summary",
+		Webhooks: []processor.Webhook{{URL: hook.URL, Events: []string{"approved"}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{
+		Workflow: "summary",
+		Input:    "text",
+		Wait:     true,
+		Webhooks: []processor.Webhook{
+			{URL: hook.URL, Events: []string{webhook.EventFailed}},
+			{URL: hook.URL},
+		},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var started RunResponse
+	json.NewDecoder(w.Body).Decode(&started)
+
+	select {
+	case payload := <-deliveries:
+		assert.Equal(t, webhook.EventCompleted, payload.Event)
+		if assert.NotNil(t, payload.Run) {
+			assert.Equal(t, started.Run.ID, payload.Run.ID)
+		}
+		assert.Equal(t, started.Output, payload.Output)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not notified")
+	}
+	select {
+	case payload := <-deliveries:
+		t.Fatalf("unexpected %s delivery to a webhook subscribed only to failures", payload.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRunApproval(t *testing.T) {
+	s := newAPITestServer(t)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "publish.yaml"), []byte(`review:
+  type: approval
+  input: STDIN
+  approval:
+    message: Publish this draft?
+  output: STDOUT
+`), 0644)
+
+	deliveries := make(chan webhook.Payload, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhook.Payload
+		json.NewDecoder(r.Body).Decode(&payload)
+		deliveries <- payload
+	}))
+	defer hook.Close()
+	waitFor := func(event string) webhook.Payload {
+		t.Helper()
+		select {
+		case payload := <-deliveries:
+			if payload.Event != event {
+				t.Fatalf("got %s delivery, want %s", payload.Event, event)
+			}
+			return payload
+		case <-time.After(5 * time.Second):
+			t.Fatalf("webhook was not notified of %s", event)
+		}
+		return webhook.Payload{}
+	}
+	submit := func() string {
+		w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{
+			Workflow: "publish",
+			Input:    "the draft",
+			Webhooks: []processor.Webhook{{URL: hook.URL}},
+		})
+		var resp RunResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp.Run == nil {
+			t.Fatal(w.Body.String())
+		}
+		return resp.Run.ID
+	}
+
+	id := submit()
+	needed := waitFor(webhook.EventApprovalNeeded)
+	if assert.NotNil(t, needed.Approval) {
+		assert.Equal(t, "review", needed.Approval.Step)
+		assert.Equal(t, "Publish this draft?", needed.Approval.Message)
+		assert.Equal(t, "the draft", needed.Approval.Content)
+	}
+	w := apiRequest(s.handleRun, http.MethodGet, "/runs/"+id, nil)
+	var waiting RunResponse
+	json.NewDecoder(w.Body).Decode(&waiting)
+	if assert.Len(t, waiting.Approvals, 1) {
+		assert.Equal(t, "review", waiting.Approvals[0].Step)
+	}
+
+	w = apiRequest(s.handleRun, http.MethodPost, "/runs/"+id+"/approval", ApprovalRequestBody{Step: "draft", Approved: true})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = apiRequest(s.handleRun, http.MethodPost, "/runs/"+id+"/approval", ApprovalRequestBody{Approved: true})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	completed := waitFor(webhook.EventCompleted)
+	assert.Contains(t, completed.Output, "the draft")
+
+	// A run that is no longer waiting can't be approved
+	w = apiRequest(s.handleRun, http.MethodPost, "/runs/"+id+"/approval", ApprovalRequestBody{Approved: true})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// A rejection fails the run with the reason
+	id = submit()
+	waitFor(webhook.EventApprovalNeeded)
+	w = apiRequest(s.handleRun, http.MethodPost, "/runs/"+id+"/approval", ApprovalRequestBody{Reason: "off topic"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	failed := waitFor(webhook.EventFailed)
+	if assert.NotNil(t, failed.Run) {
+		assert.Contains(t, failed.Run.Error, "off topic")
+	}
+}
+
+func TestRunRejectsDisallowedWebhookHost(t *testing.T) {
+	s := newAPITestServer(t)
+	s.config.Webhooks.AllowedHosts = []string{"hooks.example.com"}
+	os.MkdirAll(s.workflowsDir(), 0755)
+	workflow := "webhooks:\n  - url: https://elsewhere.example.com/hook\n" + testWorkflow
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte(workflow), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "summary"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "not allowed")
+}
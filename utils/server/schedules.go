@@ -0,0 +1,339 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+// scheduledRun is the latest run a schedule started
+type scheduledRun struct {
+	job     *runJob
+	pending bool // A run that came due meanwhile waits for job to finish
+}
+
+// running reports whether the run is queued or running
+func (r *scheduledRun) running() bool {
+	if r.job == nil {
+		return false
+	}
+	select {
+	case <-r.job.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// handleSchedules serves /schedules: GET lists schedules and POST creates one
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListSchedules(w, r)
+	case http.MethodPost:
+		var req ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, http.StatusBadRequest, "Invalid request format")
+			return
+		}
+		if req.ID == "" {
+			req.ID = strings.TrimSuffix(strings.TrimSuffix(req.Workflow, ".yaml"), ".yml")
+		}
+		s.saveSchedule(w, req, false)
+	default:
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleSchedule serves /schedules/{id}: GET returns the schedule, PUT
+// creates or replaces it and DELETE removes it
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id := strings.TrimPrefix(r.URL.Path, "/schedules/")
+	if id == "" || strings.Contains(id, "/") {
+		sendJSONError(w, http.StatusNotFound, "Invalid path")
+		return
+	}
+	store, err := s.runStore()
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sched, err := store.GetSchedule(id)
+		if errors.Is(err, history.ErrScheduleNotFound) {
+			sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Schedule '%s' not found", id))
+			return
+		} else if err != nil {
+			sendJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(ScheduleResponse{Success: true, Schedule: scheduleInfo(*sched, time.Now())})
+	case http.MethodPut:
+		var req ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, http.StatusBadRequest, "Invalid request format")
+			return
+		}
+		req.ID = id
+		s.saveSchedule(w, req, true)
+	case http.MethodDelete:
+		if err := store.RemoveSchedule(id); errors.Is(err, history.ErrScheduleNotFound) {
+			sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Schedule '%s' not found", id))
+			return
+		} else if err != nil {
+			sendJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(ScheduleResponse{Success: true, Message: "Schedule deleted"})
+	default:
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleListSchedules returns every schedule with its next run
+func (s *Server) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	store, err := s.runStore()
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	schedules, err := store.Schedules()
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now()
+	infos := make([]ScheduleInfo, 0, len(schedules))
+	for _, sched := range schedules {
+		infos = append(infos, *scheduleInfo(sched, now))
+	}
+	json.NewEncoder(w).Encode(ScheduleListResponse{Success: true, Schedules: infos})
+}
+
+// saveSchedule validates and stores a schedule. With replace set an existing
+// schedule is overwritten, keeping its creation time and latest run;
+// otherwise it is a conflict.
+func (s *Server) saveSchedule(w http.ResponseWriter, req ScheduleRequest, replace bool) {
+	sched := history.Schedule{
+		ID:       req.ID,
+		Workflow: req.Workflow,
+		Cron:     req.Cron,
+		Timezone: req.Timezone,
+		Enabled:  req.Enabled == nil || *req.Enabled,
+		Params:   req.Params,
+		Overlap:  req.Overlap,
+		Created:  time.Now(),
+	}
+	if !workflowNamePattern.MatchString(sched.ID) {
+		sendJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid schedule ID '%s': use letters, digits, '.', '_' and '-'", sched.ID))
+		return
+	}
+	if sched.Workflow == "" || sched.Cron == "" {
+		sendJSONError(w, http.StatusBadRequest, "workflow and cron are required")
+		return
+	}
+	if err := sched.Validate(); err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	path, err := s.workflowPath(sched.Workflow)
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Workflow '%s' not found", sched.Workflow))
+		return
+	}
+
+	store, err := s.runStore()
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	existing, err := store.GetSchedule(sched.ID)
+	if err != nil && !errors.Is(err, history.ErrScheduleNotFound) {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if existing != nil && !replace {
+		sendJSONError(w, http.StatusConflict, fmt.Sprintf("Schedule '%s' already exists; use PUT /schedules/%s to replace it", sched.ID, sched.ID))
+		return
+	}
+	if existing != nil {
+		sched.Created, sched.LastRun, sched.LastRunAt = existing.Created, existing.LastRun, existing.LastRunAt
+	}
+	if err := store.SaveSchedule(&sched); err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.logf("Saved schedule %s (%s) of workflow %s", sched.ID, sched.Cron, sched.Workflow)
+
+	status, message := http.StatusCreated, "Schedule created"
+	if existing != nil {
+		status, message = http.StatusOK, "Schedule updated"
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ScheduleResponse{Success: true, Message: message, Schedule: scheduleInfo(sched, time.Now())})
+}
+
+// scheduleInfo adds a schedule's next run after now
+func scheduleInfo(sched history.Schedule, now time.Time) *ScheduleInfo {
+	info := &ScheduleInfo{Schedule: sched}
+	if next := sched.Next(now); sched.Enabled && !next.IsZero() {
+		info.NextRun = &next
+	}
+	return info
+}
+
+// runScheduler starts the runs of this server's and its workspaces'
+// schedules as they come due, until ctx is done. Schedules are read from
+// the run store each minute, so changes made through the API or the CLI
+// apply from the next minute. Runs that came due while the server was down
+// are not made up.
+func (s *Server) runScheduler(ctx context.Context) {
+	last := time.Now()
+	for {
+		next := last.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		now := time.Now()
+		s.startDueSchedules(last, now)
+		for _, ws := range s.config.Workspaces {
+			server, err := s.workspaceServer(ws.Name)
+			if err != nil {
+				s.logf("Schedules of workspace %s: %v", ws.Name, err)
+				continue
+			}
+			server.startDueSchedules(last, now)
+		}
+		last = now
+	}
+}
+
+// startDueSchedules starts the runs of enabled schedules that came due after
+// after and by now
+func (s *Server) startDueSchedules(after, now time.Time) {
+	store, err := s.runStore()
+	if err != nil {
+		s.logf("Error reading schedules: %v", err)
+		return
+	}
+	schedules, err := store.Schedules()
+	if err != nil {
+		s.logf("Error reading schedules: %v", err)
+		return
+	}
+	for _, sched := range schedules {
+		if due := sched.Next(after); sched.Enabled && !due.IsZero() && !due.After(now) {
+			s.startScheduled(sched)
+		}
+	}
+}
+
+// startScheduled starts a due run of a schedule, applying its overlap policy
+// when the run it started last is still in progress
+func (s *Server) startScheduled(sched history.Schedule) {
+	s.schedulesMu.Lock()
+	defer s.schedulesMu.Unlock()
+	if s.scheduled == nil {
+		s.scheduled = make(map[string]*scheduledRun)
+	}
+	latest := s.scheduled[sched.ID]
+	if latest == nil {
+		latest = &scheduledRun{}
+		s.scheduled[sched.ID] = latest
+	}
+
+	if latest.running() {
+		previous := latest.job.recorder.ID()
+		switch sched.OverlapPolicy() {
+		case history.OverlapQueue:
+			if latest.pending {
+				s.logf("Schedule %s: a run already waits for run %s; skipping this one", sched.ID, previous)
+				return
+			}
+			s.logf("Schedule %s: waiting for run %s to finish", sched.ID, previous)
+			latest.pending = true
+			go s.startAfter(latest.job, sched.ID)
+			return
+		case history.OverlapCancelPrevious:
+			s.logf("Schedule %s: cancelling run %s", sched.ID, previous)
+			latest.job.cancel()
+		default:
+			s.logf("Schedule %s: skipping this run, run %s is still in progress", sched.ID, previous)
+			return
+		}
+	}
+	s.launchScheduled(latest, sched)
+}
+
+// startAfter starts a schedule's waiting run once the previous one finished,
+// unless the schedule was removed or disabled meanwhile
+func (s *Server) startAfter(previous *runJob, id string) {
+	<-previous.done
+
+	s.schedulesMu.Lock()
+	defer s.schedulesMu.Unlock()
+	latest := s.scheduled[id]
+	latest.pending = false
+	store, err := s.runStore()
+	if err != nil {
+		s.logf("Schedule %s: %v", id, err)
+		return
+	}
+	sched, err := store.GetSchedule(id)
+	if err != nil || !sched.Enabled {
+		return
+	}
+	s.launchScheduled(latest, *sched)
+}
+
+// launchScheduled queues a batch run of a schedule's workflow and records
+// it as the schedule's latest run. The caller holds schedulesMu.
+func (s *Server) launchScheduled(latest *scheduledRun, sched history.Schedule) {
+	params := make(map[string]interface{}, len(sched.Params))
+	for name, value := range sched.Params {
+		params[name] = value
+	}
+	job, err := s.queueRun(withActor(context.Background(), fmt.Sprintf("schedule '%s'", sched.ID)), RunRequest{Workflow: sched.Workflow, Params: params, Priority: PriorityBatch})
+	if err != nil {
+		s.logf("Schedule %s: run not started: %v", sched.ID, err)
+		return
+	}
+	latest.job = job
+	s.logf("Schedule %s: started run %s of workflow %s", sched.ID, job.recorder.ID(), sched.Workflow)
+
+	store := job.recorder.Store()
+	current, err := store.GetSchedule(sched.ID)
+	if err != nil {
+		return // Removed since it came due
+	}
+	current.LastRun, current.LastRunAt = job.recorder.ID(), time.Now()
+	if err := store.SaveSchedule(current); err != nil {
+		s.logf("Schedule %s: %v", sched.ID, err)
+	}
+}
+
+// logf logs a message about background work, naming the workspace it
+// belongs to
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.workspace != nil {
+		format = "[" + s.workspace.Name + "] " + format
+	}
+	logger.Printf(format, args...)
+}
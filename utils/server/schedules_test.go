@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingProvider answers prompts once release is closed
+type blockingProvider struct {
+	*MockProvider
+	release chan struct{}
+}
+
+func (p blockingProvider) SendPrompt(model, prompt string) (string, error) {
+	<-p.release
+	return p.MockProvider.SendPrompt(model, prompt)
+}
+
+func (p blockingProvider) SendPromptWithFile(model, prompt string, file models.FileInput) (string, error) {
+	<-p.release
+	return p.MockProvider.SendPromptWithFile(model, prompt, file)
+}
+
+// blockPrompts makes gpt-4o prompts wait until the returned channel is
+// closed
+func blockPrompts(t *testing.T) chan struct{} {
+	t.Helper()
+	release := make(chan struct{})
+	detect := models.DetectProvider
+	models.DetectProvider = func(model string) models.Provider {
+		return blockingProvider{MockProvider: detect(model).(*MockProvider), release: release}
+	}
+	t.Cleanup(func() { models.DetectProvider = detect })
+	return release
+}
+
+// newScheduleTestServer returns a server with the test workflow stored as
+// summary
+func newScheduleTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := newAPITestServer(t)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "summary.yaml"), []byte(testWorkflow+"\nrefine:\n  input: STDIN\n  model: gpt-4o\n  action: Shorten this\n  output: STDOUT\n"), 0644)
+	return s
+}
+
+// scheduleRuns returns the server's runs once none is queued or running
+func scheduleRuns(t *testing.T, s *Server) []history.Run {
+	t.Helper()
+	store, _ := s.runStore()
+	var runs []history.Run
+	assert.Eventually(t, func() bool {
+		runs, _ = store.List()
+		for _, run := range runs {
+			if run.Status == history.StatusQueued || run.Status == history.StatusRunning {
+				return false
+			}
+		}
+		s.schedulesMu.Lock()
+		defer s.schedulesMu.Unlock()
+		latest := s.scheduled["summary"]
+		return latest == nil || !latest.pending
+	}, 5*time.Second, 10*time.Millisecond)
+	return runs
+}
+
+func TestScheduleCRUD(t *testing.T) {
+	s := newScheduleTestServer(t)
+
+	w := apiRequest(s.handleSchedules, http.MethodPost, "/schedules", ScheduleRequest{Workflow: "summary", Cron: "0 7 * * mon-fri", Timezone: "Europe/Paris", Params: map[string]string{"topic": "sales"}})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created ScheduleResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if !assert.NotNil(t, created.Schedule) {
+		return
+	}
+	assert.Equal(t, "summary", created.Schedule.ID)
+	assert.True(t, created.Schedule.Enabled)
+	if assert.NotNil(t, created.Schedule.NextRun) {
+		paris, _ := time.LoadLocation("Europe/Paris")
+		assert.Equal(t, 7, created.Schedule.NextRun.In(paris).Hour())
+	}
+
+	w = apiRequest(s.handleSchedules, http.MethodPost, "/schedules", ScheduleRequest{Workflow: "summary", Cron: "@daily"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	tests := []struct {
+		name string
+		req  ScheduleRequest
+		want int
+	}{
+		{"bad cron", ScheduleRequest{ID: "a", Workflow: "summary", Cron: "every day"}, http.StatusBadRequest},
+		{"bad timezone", ScheduleRequest{ID: "b", Workflow: "summary", Cron: "@daily", Timezone: "Nowhere/Town"}, http.StatusBadRequest},
+		{"bad overlap", ScheduleRequest{ID: "c", Workflow: "summary", Cron: "@daily", Overlap: "replace"}, http.StatusBadRequest},
+		{"bad id", ScheduleRequest{ID: "../x", Workflow: "summary", Cron: "@daily"}, http.StatusBadRequest},
+		{"missing workflow", ScheduleRequest{ID: "d", Workflow: "missing", Cron: "@daily"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := apiRequest(s.handleSchedules, http.MethodPost, "/schedules", tt.req)
+		assert.Equal(t, tt.want, w.Code, "%s: %s", tt.name, w.Body.String())
+	}
+
+	disabled := false
+	w = apiRequest(s.handleSchedule, http.MethodPut, "/schedules/summary", ScheduleRequest{Workflow: "summary", Cron: "@hourly", Enabled: &disabled, Overlap: history.OverlapQueue})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = apiRequest(s.handleSchedules, http.MethodGet, "/schedules", nil)
+	var list ScheduleListResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if assert.Len(t, list.Schedules, 1) {
+		got := list.Schedules[0]
+		assert.Equal(t, "@hourly", got.Cron)
+		assert.False(t, got.Enabled)
+		assert.Nil(t, got.NextRun)
+		assert.Equal(t, created.Schedule.Created.Unix(), got.Created.Unix())
+	}
+
+	w = apiRequest(s.handleSchedule, http.MethodDelete, "/schedules/summary", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = apiRequest(s.handleSchedule, http.MethodGet, "/schedules/summary", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestStartDueSchedules(t *testing.T) {
+	s := newScheduleTestServer(t)
+	store, _ := s.runStore()
+	store.SaveSchedule(&history.Schedule{ID: "summary", Workflow: "summary", Cron: "*/5 * * * *", Enabled: true})
+	store.SaveSchedule(&history.Schedule{ID: "off", Workflow: "summary", Cron: "* * * * *"})
+	store.SaveSchedule(&history.Schedule{ID: "later", Workflow: "summary", Cron: "0 0 1 1 *", Enabled: true})
+
+	now := time.Date(2025, 3, 4, 10, 5, 0, 0, time.Local)
+	s.startDueSchedules(now.Add(-time.Minute), now)
+	runs := scheduleRuns(t, s)
+	if !assert.Len(t, runs, 1) {
+		return
+	}
+	assert.Equal(t, history.StatusSucceeded, runs[0].Status)
+
+	sched, _ := store.GetSchedule("summary")
+	assert.Equal(t, runs[0].ID, sched.LastRun)
+
+	// Nothing is due in the following minute
+	s.startDueSchedules(now, now.Add(time.Minute))
+	assert.Len(t, scheduleRuns(t, s), 1)
+}
+
+func TestScheduleOverlapPolicies(t *testing.T) {
+	tests := []struct {
+		overlap  string
+		runs     int
+		statuses []string // Of the runs, in any order: starting a run resets its start time
+	}{
+		// The second and third runs come due while the first is running
+		{history.OverlapSkip, 1, []string{history.StatusSucceeded}},
+		{history.OverlapQueue, 2, []string{history.StatusSucceeded, history.StatusSucceeded}},
+		{history.OverlapCancelPrevious, 3, []string{history.StatusFailed, history.StatusFailed, history.StatusSucceeded}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overlap, func(t *testing.T) {
+			s := newScheduleTestServer(t)
+			release := blockPrompts(t)
+			sched := history.Schedule{ID: "summary", Workflow: "summary", Cron: "* * * * *", Enabled: true, Overlap: tt.overlap}
+			store, _ := s.runStore()
+			store.SaveSchedule(&sched)
+
+			s.startScheduled(sched)
+			assert.Eventually(t, func() bool {
+				s.schedulesMu.Lock()
+				id := s.scheduled["summary"].job.recorder.ID()
+				s.schedulesMu.Unlock()
+				run, err := store.Get(id)
+				return err == nil && run.Status == history.StatusRunning
+			}, 5*time.Second, 10*time.Millisecond)
+			s.startScheduled(sched)
+			s.startScheduled(sched)
+			close(release)
+
+			runs := scheduleRuns(t, s)
+			if !assert.Len(t, runs, tt.runs) {
+				return
+			}
+			var statuses []string
+			for _, run := range runs {
+				statuses = append(statuses, run.Status)
+			}
+			assert.ElementsMatch(t, tt.statuses, statuses)
+		})
+	}
+}
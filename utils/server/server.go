@@ -1,22 +1,57 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/audit"
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // Server represents the HTTP server
 type Server struct {
 	mux       *http.ServeMux
 	config    *config.ServerConfig
-	envConfig *config.EnvConfig
+	envConfig *config.EnvConfig // Replaced when the environment file changes; read with env
+	envMu     sync.RWMutex
+
+	queue     *runQueue // Started on first use by runQueue
+	queueOnce sync.Once
+	store     *history.Store // Opened on first use by runStore
+	storeErr  error
+	storeOnce sync.Once
+
+	scheduled     map[string]*scheduledRun // Latest run of each schedule, by schedule ID
+	schedulesMu   sync.Mutex
+	stopScheduler context.CancelFunc
+
+	draining atomic.Bool // Set once the server stops taking runs
+
+	acme  *autocert.Manager // Obtains certificates when TLS uses ACME
+	audit *audit.Log        // Set when the audit log is enabled; shared with workspaces
+
+	workers *workerPool // Set when remote workers may join; shared with workspaces
+	gc      *gcStats    // Set when retention is configured; shared with workspaces
+
+	oidc *oidcProvider // Set when OIDC sign-in is configured; shared with workspaces
+
+	workspace    *config.Workspace  // Set on the servers of workspaces
+	workspaces   map[string]*Server // Servers of the workspaces set up so far
+	workspacesMu sync.Mutex
 }
 
 // validatePath ensures a path is relative and within the data directory
@@ -201,8 +236,12 @@ func (s *Server) combinedMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 
 		// For non-OPTIONS requests, proceed with logging and auth
 		logRequest(func(w http.ResponseWriter, r *http.Request) {
-			if !checkAuth(s.config, w, r) {
-				return
+			defer func() { s.auditRequest(r, w.(*responseWriter).statusCode) }()
+			if !isPublicPath(r.URL.Path) {
+				var ok bool
+				if r, ok = authorize(s.config, w, r); !ok {
+					return
+				}
 			}
 			handler(w, r)
 		})(rw, r)
@@ -211,21 +250,68 @@ func (s *Server) combinedMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 
 // New creates a new HTTP server with the given configuration
 func New(envConfig *config.EnvConfig) (*http.Server, error) {
+	_, server, err := newServer(envConfig)
+	return server, err
+}
+
+// newServer creates the server and the HTTP server that serves it
+func newServer(envConfig *config.EnvConfig) (*Server, *http.Server, error) {
 	// Get server configuration
 	serverConfig := envConfig.GetServerConfig()
 	if serverConfig == nil {
-		return nil, fmt.Errorf("server configuration not found")
+		return nil, nil, fmt.Errorf("server configuration not found")
 	}
 
+	// Keep request logs in the log file too, when one is configured
+	logger.SetOutput(config.ConsoleAndLog(os.Stdout))
+
 	// Create data directory if it doesn't exist
 	if err := os.MkdirAll(serverConfig.DataDir, 0755); err != nil {
-		return nil, fmt.Errorf("error creating data directory: %v", err)
+		return nil, nil, fmt.Errorf("error creating data directory: %v", err)
+	}
+
+	tlsConfig, manager, err := newTLSConfig(serverConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	proxies, err := parseTrustedProxies(serverConfig.TrustedProxies)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateRunLimits(serverConfig.RunLimits); err != nil {
+		return nil, nil, err
+	}
+	for _, ws := range serverConfig.Workspaces {
+		if err := validateRunLimits(ws.RunLimits); err != nil {
+			return nil, nil, fmt.Errorf("workspace '%s': %w", ws.Name, err)
+		}
 	}
 
 	s := &Server{
 		mux:       http.NewServeMux(),
 		config:    serverConfig,
 		envConfig: envConfig,
+		acme:      manager,
+	}
+	if serverConfig.Audit != nil {
+		if s.audit, err = audit.OpenConfigured(serverConfig.AuditFile(), serverConfig.Audit.Database, envConfig); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if serverConfig.RemoteWorkers != nil {
+		if serverConfig.RemoteWorkers.Token == "" {
+			return nil, nil, fmt.Errorf("remoteWorkers: a token is required")
+		}
+		s.workers = newWorkerPool(serverConfig.RemoteWorkers)
+	}
+	if serverConfig.Retention != nil {
+		s.gc = newGCStats()
+	}
+	if serverConfig.OIDC != nil {
+		if s.oidc, err = newOIDCProvider(serverConfig.OIDC); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	// No default runtime directory is created
@@ -233,15 +319,40 @@ func New(envConfig *config.EnvConfig) (*http.Server, error) {
 	// Register routes
 	s.routes()
 
+	// Continue the runs the last shutdown suspended
+	s.resumeRuns()
+	for _, ws := range serverConfig.Workspaces {
+		if server, err := s.workspaceServer(ws.Name); err == nil {
+			server.resumeRuns()
+		}
+	}
+
+	// Start runs of schedules as they come due, of mail triggers as
+	// messages arrive and of watch triggers as files do, and remove what's
+	// past the retention limits
+	ctx, stop := context.WithCancel(context.Background())
+	s.stopScheduler = stop
+	go s.runScheduler(ctx)
+	if len(serverConfig.MailTriggers) > 0 {
+		go s.runMailTriggers(ctx)
+	}
+	if len(serverConfig.WatchTriggers) > 0 {
+		go s.runWatchTriggers(ctx)
+	}
+	if s.gc != nil {
+		go s.runRetention(ctx)
+	}
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", serverConfig.Port),
-		Handler:      s.mux,
+		Handler:      otelhttp.NewHandler(s.handler(proxies), "comanda.server", otelhttp.WithSpanNameFormatter(spanName)),
+		TLSConfig:    tlsConfig,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 120 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
 
-	return server, nil
+	return s, server, nil
 }
 
 // routes sets up the server routes
@@ -376,40 +487,144 @@ func (s *Server) routes() {
 
 	// Process endpoint - requires auth
 	s.mux.HandleFunc("/process", s.combinedMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		handleProcess(w, r, s.config, s.envConfig)
+		handleProcess(w, r, s.config, s.env())
 	}))
 
 	// Generate endpoint - requires auth
 	s.mux.HandleFunc("/generate", s.combinedMiddleware(s.handleGenerate))
+
+	// Workflow and run API - requires auth
+	s.mux.HandleFunc("/workflows", s.combinedMiddleware(s.handleWorkflows))
+	s.mux.HandleFunc("/workflows/", s.combinedMiddleware(s.handleWorkflow))
+	s.mux.HandleFunc("/runs", s.combinedMiddleware(s.handleRuns))
+	s.mux.HandleFunc("/runs/", s.combinedMiddleware(s.handleRun))
+	s.mux.HandleFunc("/schedules", s.combinedMiddleware(s.handleSchedules))
+	s.mux.HandleFunc("/audit", s.combinedMiddleware(s.handleAudit))
+	s.mux.HandleFunc("/v1/chat/completions", s.combinedMiddleware(s.handleChatCompletions))
+	s.mux.HandleFunc("/v1/models", s.combinedMiddleware(s.handleChatModels))
+	s.mux.HandleFunc("/audit/verify", s.combinedMiddleware(s.handleAudit))
+	s.mux.HandleFunc("/metrics", s.combinedMiddleware(s.handleMetrics))
+	s.mux.HandleFunc("/schedules/", s.combinedMiddleware(s.handleSchedule))
+	s.mux.HandleFunc("/watches", s.combinedMiddleware(s.handleWatches))
+
+	// Workflow triggers - authenticated by payload signature
+	s.mux.HandleFunc("/hooks/", s.combinedMiddleware(s.handleTrigger))
+
+	// OIDC sign-in and token exchange - no auth required
+	s.mux.HandleFunc("/auth", s.combinedMiddleware(s.handleAuthInfo))
+	s.mux.HandleFunc("/auth/login", s.combinedMiddleware(s.handleLogin))
+	s.mux.HandleFunc("/auth/callback", s.combinedMiddleware(s.handleCallback))
+	s.mux.HandleFunc("/auth/token", s.combinedMiddleware(s.handleTokenExchange))
+
+	// API specification - no auth required
+	s.mux.HandleFunc("/openapi.json", s.combinedMiddleware(s.handleOpenAPI))
+
+	// Web UI - its files need no auth; the page sends the user's token with
+	// each API call
+	if !s.config.DisableUI {
+		s.mux.HandleFunc("/ui/", s.combinedMiddleware(s.handleUI))
+		s.mux.HandleFunc("GET /{$}", s.combinedMiddleware(s.handleRoot))
+	}
 }
 
 // Run creates and starts the HTTP server with the given configuration
 func Run(envConfig *config.EnvConfig) error {
-	server, err := New(envConfig)
+	s, server, err := newServer(envConfig)
 	if err != nil {
 		return err
 	}
+	if s.audit != nil {
+		defer s.audit.Close() // After shutdown, so draining runs are recorded
+	}
 
 	serverConfig := envConfig.GetServerConfig()
 	if serverConfig == nil {
 		return fmt.Errorf("server configuration not found")
 	}
 
+	scheme := "http"
+	if server.TLSConfig != nil {
+		scheme = "https"
+	}
+	address := fmt.Sprintf("%s://localhost:%d%s", scheme, serverConfig.Port, s.basePath())
+
 	fmt.Printf("Starting server on port %d...\n", serverConfig.Port)
 	fmt.Printf("Data directory: %s\n", serverConfig.DataDir)
 	fmt.Printf("Runtime directories can be specified with the runtimeDir query parameter\n")
+	if server.TLSConfig != nil {
+		fmt.Print("Serving HTTPS")
+		if server.TLSConfig.ClientAuth == tls.RequireAndVerifyClientCert {
+			fmt.Print(", client certificates required")
+		}
+		fmt.Println()
+	}
+	if !serverConfig.DisableUI {
+		fmt.Printf("Web UI: %s/ui/\n", address)
+	}
 
-	if serverConfig.Enabled {
+	if !serverConfig.Enabled && serverConfig.AuthRequired() {
+		fmt.Printf("Authentication is required: %d API key(s) configured", len(serverConfig.APIKeys))
+		if serverConfig.JWT != nil {
+			fmt.Print(", JWT bearer tokens accepted")
+		}
+		fmt.Println()
+	} else if serverConfig.Enabled {
 		fmt.Println("Authentication is enabled. Bearer token required.")
-		fmt.Printf("Example usage: curl -H 'Authorization: Bearer %s' 'http://localhost:%d/process?filename=examples/openai-example.yaml'\n",
-			maskToken(serverConfig.BearerToken), serverConfig.Port)
+		fmt.Printf("Example usage: curl -H 'Authorization: Bearer %s' '%s/process?filename=examples/openai-example.yaml'\n",
+			maskToken(serverConfig.BearerToken), address)
 	} else {
-		fmt.Printf("Example usage: curl 'http://localhost:%d/process?filename=examples/openai-example.yaml'\n", serverConfig.Port)
+		fmt.Printf("Example usage: curl '%s/process?filename=examples/openai-example.yaml'\n", address)
 	}
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	ln, err := listen(server.Addr, serverConfig.ReusePort)
+	if err != nil {
 		return fmt.Errorf("server failed to start: %v", err)
 	}
 
+	// On Ctrl+C or SIGTERM, drain runs before exiting; a second signal exits
+	// at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	if server.TLSConfig != nil {
+		go func() { served <- server.ServeTLS(ln, "", "") }()
+	} else {
+		go func() { served <- server.Serve(ln) }()
+	}
+	if s.acme != nil && serverConfig.TLS.ACME.HTTPPort > 0 {
+		// Answer HTTP-01 challenges, sending other requests to HTTPS
+		challenges := &http.Server{
+			Addr:              fmt.Sprintf(":%d", serverConfig.TLS.ACME.HTTPPort),
+			Handler:           s.acme.HTTPHandler(nil),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := challenges.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Printf("ACME challenge server stopped: %v", err)
+			}
+		}()
+		defer challenges.Close()
+	}
+	if every := serverConfig.ReloadEvery(); ReloadConfig != nil && every > 0 {
+		go s.watchConfig(ctx, config.GetEnvPath(), every)
+	}
+	if s.workers != nil {
+		stopWorkers, err := s.serveWorkers(server.TLSConfig)
+		if err != nil {
+			server.Close()
+			return err
+		}
+		defer stopWorkers() // After shutdown, so leased runs can report
+	}
+	select {
+	case err := <-served:
+		if err != http.ErrServerClosed {
+			return fmt.Errorf("server failed to start: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+	stop()
+	s.shutdown(server, serverConfig.DrainDuration())
 	return nil
 }
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// suspendedReason is recorded on runs a shutdown stopped
+const suspendedReason = "Interrupted by server shutdown; resumes when the server restarts"
+
+// suspendedRun is a run a shutdown stopped, saved so the next server
+// continues it
+type suspendedRun struct {
+	RunID   string     `json:"run_id"`
+	Request RunRequest `json:"request"`
+	Actor   string     `json:"actor,omitempty"`   // Who the run was started for
+	Content string     `json:"content,omitempty"` // The workflow, when it isn't stored
+}
+
+// suspendedDir returns where suspended runs and their checkpoints are kept
+func (s *Server) suspendedDir() string {
+	return filepath.Join(s.config.DataDir, ".comanda", "suspended")
+}
+
+// checkpointPath returns where a run's progress is saved when a shutdown
+// stops it
+func (s *Server) checkpointPath(runID string) string {
+	return filepath.Join(s.suspendedDir(), runID+".checkpoint.json")
+}
+
+// shutdown stops the HTTP server and drains runs, waiting up to timeout.
+// Runs still in a step when it ends are recorded as failed.
+func (s *Server) shutdown(server *http.Server, timeout time.Duration) {
+	fmt.Printf("Shutting down: waiting up to %s for runs to finish their current step...\n", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	drained := make(chan error, 1)
+	go func() { drained <- s.drain(ctx) }()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+	}
+	if err := <-drained; err != nil {
+		n := s.abandonRuns()
+		fmt.Printf("Stopped with %d run(s) still in a step; they are recorded as failed\n", n)
+		return
+	}
+	fmt.Println("All runs stopped")
+}
+
+// drain stops this server and its workspaces' servers taking new runs, and
+// asks the runs they have to stop once their current step finishes. Queued
+// runs and runs stopped this way are suspended, to resume when the server
+// restarts. It returns once every run stopped, or with ctx's error.
+func (s *Server) drain(ctx context.Context) error {
+	servers := s.withWorkspaces()
+	if s.stopScheduler != nil {
+		s.stopScheduler()
+	}
+	for _, server := range servers {
+		server.draining.Store(true)
+		server.runQueue().stop()
+	}
+	for _, server := range servers {
+		if err := server.runQueue().wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abandonRuns records the runs a drain didn't stop in time as failed and
+// returns how many there were
+func (s *Server) abandonRuns() int {
+	n := 0
+	for _, server := range s.withWorkspaces() {
+		for _, job := range server.runQueue().pending() {
+			job.recorder.Finish(errors.New("server shut down before the run's step finished"))
+			n++
+		}
+	}
+	return n
+}
+
+// withWorkspaces returns this server and the servers of the workspaces set
+// up so far
+func (s *Server) withWorkspaces() []*Server {
+	s.workspacesMu.Lock()
+	defer s.workspacesMu.Unlock()
+	servers := []*Server{s}
+	for _, ws := range s.workspaces {
+		servers = append(servers, ws)
+	}
+	return servers
+}
+
+// suspendRun saves a run a shutdown stopped, so the next server resumes it
+// from its checkpoint
+func (s *Server) suspendRun(job *runJob) {
+	id := job.recorder.ID()
+	data, err := json.Marshal(suspendedRun{RunID: id, Request: job.req, Actor: job.actor, Content: string(job.inline)})
+	if err == nil {
+		if err = os.MkdirAll(s.suspendedDir(), 0755); err == nil {
+			err = os.WriteFile(filepath.Join(s.suspendedDir(), id+".json"), data, 0600)
+		}
+	}
+	if err != nil {
+		s.logf("Error suspending run %s: %v", id, err)
+		job.recorder.Finish(fmt.Errorf("stopped by server shutdown: %w", err))
+		return
+	}
+	if err := job.recorder.Suspend(suspendedReason); err != nil {
+		s.logf("Error recording run %s: %v", id, err)
+	}
+	job.mu.Lock()
+	job.err = errors.New(suspendedReason)
+	job.mu.Unlock()
+}
+
+// resumeRuns queues the runs the last shutdown suspended again, in the
+// order they were started
+func (s *Server) resumeRuns() {
+	entries, err := os.ReadDir(s.suspendedDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".checkpoint.json") {
+			continue
+		}
+		path := filepath.Join(s.suspendedDir(), name)
+		data, err := os.ReadFile(path)
+		os.Remove(path)
+		var run suspendedRun
+		if err == nil {
+			err = json.Unmarshal(data, &run)
+		}
+		if err != nil {
+			s.logf("Error reading suspended run %s: %v", name, err)
+			continue
+		}
+		ctx := withActor(context.Background(), run.Actor)
+		if run.Content != "" {
+			_, err = s.submitWorkflow(ctx, run.Request.Workflow, []byte(run.Content), true, run.Request, run.RunID)
+		} else {
+			_, err = s.submitRun(ctx, run.Request, run.RunID)
+		}
+		if err != nil {
+			s.logf("Run %s not resumed: %v", run.RunID, err)
+			s.failSuspended(run.RunID, err)
+			continue
+		}
+		s.logf("Resumed run %s of workflow %s", run.RunID, run.Request.Workflow)
+	}
+}
+
+// failSuspended records a suspended run that couldn't be resumed as failed
+func (s *Server) failSuspended(id string, cause error) {
+	os.Remove(s.checkpointPath(id))
+	store, err := s.runStore()
+	if err != nil {
+		return
+	}
+	if recorder, err := store.Reopen(id); err == nil {
+		recorder.Finish(fmt.Errorf("not resumed after restart: %w", cause))
+	}
+}
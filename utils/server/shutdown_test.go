@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainSuspendsAndResumesRuns(t *testing.T) {
+	s := newScheduleTestServer(t)
+	s.config.Queue.Workers = 1
+	release := blockPrompts(t)
+	store, _ := s.runStore()
+
+	running, err := s.queueRun(context.Background(), RunRequest{Workflow: "summary", Input: "text"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	waiting, err := s.queueRun(context.Background(), RunRequest{Workflow: "summary", Input: "more text"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Eventually(t, func() bool {
+		run, err := store.Get(running.recorder.ID())
+		return err == nil && run.Status == history.StatusRunning
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	drained := make(chan error, 1)
+	go func() { drained <- s.drain(ctx) }()
+
+	assert.Eventually(t, s.draining.Load, time.Second, time.Millisecond)
+	_, err = s.queueRun(context.Background(), RunRequest{Workflow: "summary"})
+	var reqErr *runRequestError
+	if assert.True(t, errors.As(err, &reqErr)) {
+		assert.Equal(t, http.StatusServiceUnavailable, reqErr.status)
+	}
+
+	close(release) // The first step finishes; the second doesn't start
+	assert.NoError(t, <-drained)
+	for _, job := range []*runJob{running, waiting} {
+		run, err := store.Get(job.recorder.ID())
+		if assert.NoError(t, err) {
+			assert.Equal(t, history.StatusQueued, run.Status)
+			assert.Equal(t, suspendedReason, run.Error)
+		}
+		assert.FileExists(t, filepath.Join(s.suspendedDir(), job.recorder.ID()+".json"))
+	}
+	run, _ := store.Get(running.recorder.ID())
+	assert.Len(t, run.Steps, 1)
+	assert.FileExists(t, s.checkpointPath(running.recorder.ID()))
+
+	restarted := &Server{config: s.config, envConfig: s.envConfig}
+	restarted.resumeRuns()
+	for _, job := range []*runJob{running, waiting} {
+		var run *history.Run
+		assert.Eventually(t, func() bool {
+			run, _ = store.Get(job.recorder.ID())
+			return run != nil && run.Status == history.StatusSucceeded
+		}, 5*time.Second, 10*time.Millisecond)
+		if run != nil {
+			assert.Empty(t, run.Error)
+			assert.Len(t, run.Steps, 2) // Resumed runs don't repeat finished steps
+		}
+	}
+	entries, _ := os.ReadDir(s.suspendedDir())
+	assert.Empty(t, entries)
+}
+
+func TestResumeFailsRunsOfDeletedWorkflows(t *testing.T) {
+	s := newScheduleTestServer(t)
+	store, _ := s.runStore()
+	recorder, _ := store.Enqueue("summary")
+	s.suspendRun(&runJob{recorder: recorder, req: RunRequest{Workflow: "summary"}})
+	os.Remove(filepath.Join(s.workflowsDir(), "summary.yaml"))
+
+	s.resumeRuns()
+	run, err := store.Get(recorder.ID())
+	if assert.NoError(t, err) {
+		assert.Equal(t, history.StatusFailed, run.Status)
+		assert.Contains(t, run.Error, "not resumed after restart")
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SO_REUSEPORT is not available on Windows")
+	}
+	first, err := listen("127.0.0.1:0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	addr := first.Addr().String()
+
+	// A new server can bind the port while the old one still holds it
+	second, err := listen(addr, true)
+	if assert.NoError(t, err) {
+		second.Close()
+	}
+	if ln, err := net.Listen("tcp", addr); err == nil {
+		ln.Close()
+		t.Error("expected binding without SO_REUSEPORT to fail")
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newTLSConfig returns the TLS settings the server is served with, and the
+// ACME manager when certificates are obtained automatically. Both are nil
+// when the server serves plain HTTP.
+func newTLSConfig(c *config.ServerConfig) (*tls.Config, *autocert.Manager, error) {
+	t := c.TLS
+	if t == nil {
+		return nil, nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch t.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, nil, fmt.Errorf("tls: unsupported minVersion '%s'; use 1.2 or 1.3", t.MinVersion)
+	}
+
+	var manager *autocert.Manager
+	switch {
+	case t.ACME != nil:
+		if t.CertFile != "" || t.KeyFile != "" {
+			return nil, nil, fmt.Errorf("tls: set either certFile and keyFile or acme, not both")
+		}
+		if len(t.ACME.Domains) == 0 {
+			return nil, nil, fmt.Errorf("tls: acme needs at least one domain")
+		}
+		cacheDir := t.ACME.CacheDir
+		if cacheDir == "" {
+			cacheDir = filepath.Join(c.DataDir, ".comanda", "acme")
+		}
+		manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(t.ACME.Domains...),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      t.ACME.Email,
+		}
+		if t.ACME.DirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: t.ACME.DirectoryURL}
+		}
+		tlsConfig.GetCertificate = manager.GetCertificate
+		tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	case t.CertFile != "" && t.KeyFile != "":
+		pair := &keyPair{certFile: t.CertFile, keyFile: t.KeyFile}
+		if _, err := pair.load(); err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.GetCertificate = pair.getCertificate
+	default:
+		return nil, nil, fmt.Errorf("tls: set certFile and keyFile, or acme")
+	}
+
+	if t.ClientCA == "" {
+		if t.ClientAuth != "" {
+			return nil, nil, fmt.Errorf("tls: clientAuth needs a clientCA to verify certificates against")
+		}
+		return tlsConfig, manager, nil
+	}
+	data, err := os.ReadFile(t.ClientCA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("tls: error reading clientCA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, nil, fmt.Errorf("tls: no PEM certificates found in clientCA %s", t.ClientCA)
+	}
+	tlsConfig.ClientCAs = pool
+	switch t.ClientAuth {
+	case "", config.ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case config.ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, nil, fmt.Errorf("tls: unknown clientAuth '%s'; use %s or %s", t.ClientAuth, config.ClientAuthRequire, config.ClientAuthOptional)
+	}
+	return tlsConfig, manager, nil
+}
+
+// keyPair serves a certificate and key from files, loading them again when
+// the certificate file changes so renewed certificates are picked up
+// without a restart
+type keyPair struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// load reads the certificate and key when the certificate file changed
+// since they were last read
+func (p *keyPair) load() (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, err := os.Stat(p.certFile)
+	if err != nil {
+		if p.cert != nil {
+			return p.cert, nil // Keep serving the last certificate while the file is replaced
+		}
+		return nil, fmt.Errorf("tls: error reading certFile: %w", err)
+	}
+	if p.cert != nil && info.ModTime().Equal(p.modified) {
+		return p.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		if p.cert != nil {
+			logger.Printf("Keeping the current TLS certificate: %v", err)
+			return p.cert, nil
+		}
+		return nil, fmt.Errorf("tls: error loading certificate: %w", err)
+	}
+	p.cert = &cert
+	p.modified = info.ModTime()
+	return p.cert, nil
+}
+
+func (p *keyPair) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return p.load()
+}
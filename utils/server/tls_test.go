@@ -0,0 +1,185 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate with its key, signed by parent or self-signed
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, ca bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  ca,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write saves the certificate and key as PEM files, returning their paths
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTLSClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test CA", nil, true)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "server", ca, false).write(t, dir, "server")
+	client := newTestCert(t, "client", ca, false)
+	stranger := newTestCert(t, "stranger", nil, false)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	// get connects presenting cert, if any, even when its CA isn't one the
+	// server asked for
+	get := func(url string, cert ...tls.Certificate) error {
+		tlsConfig := &tls.Config{RootCAs: roots, GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if len(cert) == 0 {
+				return &tls.Certificate{}, nil
+			}
+			return &cert[0], nil
+		}}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := c.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Certificates from other CAs are refused either way; connections
+	// without one only when certificates are required
+	for _, test := range []struct {
+		clientAuth  string
+		withoutCert bool
+	}{
+		{clientAuth: "", withoutCert: false},
+		{clientAuth: config.ClientAuthOptional, withoutCert: true},
+	} {
+		t.Run("clientAuth="+test.clientAuth, func(t *testing.T) {
+			tlsConfig, manager, err := newTLSConfig(&config.ServerConfig{TLS: &config.TLSConfig{
+				CertFile: certFile, KeyFile: keyFile, ClientCA: caFile, ClientAuth: test.clientAuth,
+			}})
+			require.NoError(t, err)
+			assert.Nil(t, manager)
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			server := &http.Server{Handler: http.NotFoundHandler(), TLSConfig: tlsConfig, ErrorLog: log.New(io.Discard, "", 0)}
+			go server.ServeTLS(ln, "", "")
+			defer server.Close()
+			url := "https://" + ln.Addr().String()
+
+			assert.NoError(t, get(url, client.tlsCertificate()))
+			assert.Equal(t, test.withoutCert, get(url) == nil)
+			assert.Error(t, get(url, stranger.tlsCertificate()))
+		})
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newTestCert(t, "server", nil, false).write(t, dir, "server")
+
+	for name, tlsConfig := range map[string]*config.TLSConfig{
+		"no certificate":   {},
+		"missing key":      {CertFile: certFile},
+		"unreadable files": {CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile},
+		"both sources":     {CertFile: certFile, KeyFile: keyFile, ACME: &config.ACMEConfig{Domains: []string{"example.com"}}},
+		"no acme domains":  {ACME: &config.ACMEConfig{}},
+		"bad min version":  {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.1"},
+		"clientAuth alone": {CertFile: certFile, KeyFile: keyFile, ClientAuth: config.ClientAuthRequire},
+		"clientCA not PEM": {CertFile: certFile, KeyFile: keyFile, ClientCA: keyFile},
+		"bad clientAuth":   {CertFile: certFile, KeyFile: keyFile, ClientCA: certFile, ClientAuth: "sometimes"},
+	} {
+		_, _, err := newTLSConfig(&config.ServerConfig{TLS: tlsConfig})
+		assert.Error(t, err, name)
+	}
+
+	tlsConfig, manager, err := newTLSConfig(&config.ServerConfig{DataDir: dir, TLS: &config.TLSConfig{
+		ACME: &config.ACMEConfig{Domains: []string{"comanda.example.com"}}, MinVersion: "1.3",
+	}})
+	require.NoError(t, err)
+	require.NotNil(t, manager)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.NotNil(t, tlsConfig.GetCertificate)
+}
+
+func TestKeyPairReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newTestCert(t, "first", nil, false).write(t, dir, "server")
+	pair := &keyPair{certFile: certFile, keyFile: keyFile}
+	cert, err := pair.getCertificate(nil)
+	require.NoError(t, err)
+	first, _ := x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "first", first.Subject.CommonName)
+
+	// A renewed certificate is served once its file changes
+	newTestCert(t, "second", nil, false).write(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	cert, err = pair.getCertificate(nil)
+	require.NoError(t, err)
+	second, _ := x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "second", second.Subject.CommonName)
+
+	// A broken replacement leaves the last certificate in place
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0600))
+	require.NoError(t, os.Chtimes(certFile, later.Add(time.Minute), later.Add(time.Minute)))
+	cert, err = pair.getCertificate(nil)
+	require.NoError(t, err)
+	kept, _ := x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "second", kept.Subject.CommonName)
+}
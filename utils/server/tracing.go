@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceContext returns a context carrying only the request's trace, so a
+// workflow the request starts is traced as part of it without being
+// cancelled with it
+func traceContext(r *http.Request) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(r.Context()))
+}
+
+// spanName names a request's span after its method and route, with IDs and
+// names left out so requests to the same endpoint share a name
+func spanName(_ string, r *http.Request) string {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	switch parts[0] {
+	case "runs", "workflows", "providers", "schedules":
+		if len(parts) == 2 && parts[1] != "" && parts[1] != "validate" {
+			return r.Method + " /" + parts[0] + "/{id}"
+		}
+	}
+	return r.Method + " " + r.URL.Path
+}
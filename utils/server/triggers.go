@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/webhook"
+)
+
+// maxTriggerPayload is the largest webhook body a trigger accepts
+const maxTriggerPayload = 5 << 20
+
+// triggerTolerance is how old a signed timestamp may be before a delivery
+// is treated as a replay
+const triggerTolerance = 5 * time.Minute
+
+// isPublicPath reports whether a request needs no bearer token: the API
+// spec, the web UI's files, sign-in, which issues tokens, and trigger
+// endpoints, which are called by other services that prove who they are by
+// signing the payload
+func isPublicPath(path string) bool {
+	return path == "/openapi.json" || path == "/" || strings.HasPrefix(path, "/ui/") || strings.HasPrefix(path, "/hooks/") ||
+		path == "/auth" || strings.HasPrefix(path, "/auth/")
+}
+
+// handleTrigger starts the workflow of the trigger named in the path when
+// its service sends a correctly signed webhook for an event it subscribes to
+func (s *Server) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/hooks/")
+	trigger := s.config.FindTrigger(name)
+	if trigger == nil {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Trigger '%s' not found", name))
+		return
+	}
+	if trigger.Secret == "" {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Trigger '%s' has no secret configured", name))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTriggerPayload))
+	if err != nil {
+		sendJSONError(w, http.StatusRequestEntityTooLarge, "Payload too large")
+		return
+	}
+	if err := verifyTrigger(trigger, r.Header, body, time.Now()); err != nil {
+		config.VerboseLog("Rejected delivery to trigger %s: %v", name, err)
+		sendJSONError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		sendJSONError(w, http.StatusBadRequest, "Payload is not valid JSON")
+		return
+	}
+	event := triggerEvent(trigger, r.Header, payload)
+	if len(trigger.Events) > 0 && !webhook.Wants(trigger.Events, event) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ProcessResponse{Success: true, Message: fmt.Sprintf("Event '%s' ignored", event)})
+		return
+	}
+
+	params := make(map[string]interface{}, len(trigger.Params))
+	for param, path := range trigger.Params {
+		if value, ok := payloadField(payload, path); ok {
+			params[param] = value
+		}
+	}
+
+	target := s
+	if trigger.Workspace != "" {
+		if target, err = s.workspaceServer(trigger.Workspace); err != nil {
+			sendJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	config.VerboseLog("Trigger %s received event '%s'", name, event)
+	target.startRun(w, r, RunRequest{Workflow: trigger.Workflow, Input: string(body), Params: params})
+}
+
+// verifyTrigger checks a delivery's signature the way its source signs them
+func verifyTrigger(trigger *config.Trigger, header http.Header, body []byte, now time.Time) error {
+	switch trigger.Source {
+	case config.TriggerGitHub:
+		signature := header.Get("X-Hub-Signature-256")
+		if signature == "" {
+			return errors.New("missing X-Hub-Signature-256 header")
+		}
+		mac := hmac.New(sha256.New, []byte(trigger.Secret))
+		mac.Write(body)
+		if !hmac.Equal([]byte(signature), []byte("sha256="+hex.EncodeToString(mac.Sum(nil)))) {
+			return errors.New("invalid webhook signature")
+		}
+		return nil
+	case config.TriggerStripe:
+		return verifyStripeSignature(trigger.Secret, header.Get("Stripe-Signature"), body, now)
+	default:
+		signature := header.Get(webhook.SignatureHeader)
+		if signature == "" {
+			return fmt.Errorf("missing %s header", webhook.SignatureHeader)
+		}
+		return webhook.Verify(trigger.Secret, header.Get(webhook.TimestampHeader), header.Get(webhook.EventHeader), signature, body, triggerTolerance, now)
+	}
+}
+
+// verifyStripeSignature checks a Stripe-Signature header of the form
+// t=<timestamp>,v1=<signature>[,v1=<signature>...]
+func verifyStripeSignature(secret, header string, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("missing or malformed Stripe-Signature header")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > triggerTolerance || age < -triggerTolerance {
+		return errors.New("webhook timestamp is too old")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	expected := []byte(hex.EncodeToString(mac.Sum(nil)))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), expected) {
+			return nil
+		}
+	}
+	return errors.New("invalid webhook signature")
+}
+
+// triggerEvent returns the event a delivery reports: a header for GitHub
+// and generic webhooks, the payload's type for Stripe
+func triggerEvent(trigger *config.Trigger, header http.Header, payload interface{}) string {
+	switch trigger.Source {
+	case config.TriggerGitHub:
+		return header.Get("X-GitHub-Event")
+	case config.TriggerStripe:
+		event, _ := payloadField(payload, "type")
+		return event
+	default:
+		return header.Get(webhook.EventHeader)
+	}
+}
+
+// payloadField returns the field of a JSON payload at a dotted path, such
+// as repository.full_name or commits.0.message. Objects and lists are
+// returned as JSON.
+func payloadField(payload interface{}, path string) (string, bool) {
+	value := payload
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			field, ok := v[key]
+			if !ok {
+				return "", false
+			}
+			value = field
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+			value = v[i]
+		default:
+			return "", false
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number, bool:
+		return fmt.Sprint(v), true
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+}
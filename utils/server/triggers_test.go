@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+const triggerWorkflow = `params:
+  repo:
+    required: true
+summarize:
+  input: STDIN
+  model: gpt-4o
+  action: Summarize the push to {{ params.repo }}
+  output: STDOUT
+`
+
+// newTriggerTestServer returns a server that requires auth, with a stored
+// workflow and a trigger of each source running it
+func newTriggerTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := newAPITestServer(t)
+	s.mux = http.NewServeMux()
+	s.config.Enabled = true
+	s.config.BearerToken = "operator-token"
+	s.config.Triggers = []config.Trigger{
+		{Name: "gh", Workflow: "push", Source: config.TriggerGitHub, Secret: "gh-secret", Events: []string{"push"},
+			Params: map[string]string{"repo": "repository.full_name"}},
+		{Name: "pay", Workflow: "push", Source: config.TriggerStripe, Secret: "whsec_test",
+			Params: map[string]string{"repo": "data.object.id"}},
+		{Name: "any", Workflow: "push", Secret: "generic-secret", Params: map[string]string{"repo": "repo"}},
+	}
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "push.yaml"), []byte(triggerWorkflow), 0644)
+	s.routes()
+	return s
+}
+
+func hookRequest(s *Server, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+// waitForQueuedRun waits until the run a trigger queued has finished, so it
+// doesn't write to the data directory after the test
+func waitForQueuedRun(t *testing.T, s *Server, w *httptest.ResponseRecorder) {
+	t.Helper()
+	var queued RunResponse
+	json.NewDecoder(w.Body).Decode(&queued)
+	if !assert.NotNil(t, queued.Run) {
+		return
+	}
+	assert.Eventually(t, func() bool {
+		var got RunResponse
+		json.NewDecoder(apiRequest(s.handleRun, http.MethodGet, "/runs/"+queued.Run.ID, nil).Body).Decode(&got)
+		return got.Run != nil && (got.Run.Status == history.StatusSucceeded || got.Run.Status == history.StatusFailed)
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func hmacHex(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHubTrigger(t *testing.T) {
+	s := newTriggerTestServer(t)
+	body := `{"ref":"refs/heads/main","repository":{"full_name":"acme/api"}}`
+	signed := map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + hmacHex("gh-secret", body)}
+
+	w := hookRequest(s, "/hooks/gh", body, signed)
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var queued RunResponse
+	json.NewDecoder(w.Body).Decode(&queued)
+	if !assert.NotNil(t, queued.Run) {
+		return
+	}
+	assert.Equal(t, "push", queued.Run.Workflow)
+
+	assert.Eventually(t, func() bool {
+		r := httptest.NewRequest(http.MethodGet, "/runs/"+queued.Run.ID+"/steps/summarize/output", nil)
+		r.Header.Set("Authorization", "Bearer operator-token")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code == http.StatusOK && strings.Contains(w.Body.String(), "acme/api")
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// A wrong signature is refused
+	w = hookRequest(s, "/hooks/gh", body, map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + hmacHex("wrong", body)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Events the trigger doesn't subscribe to are acknowledged without a run
+	signed["X-GitHub-Event"] = "ping"
+	w = hookRequest(s, "/hooks/gh", body, signed)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "ignored")
+
+	w = hookRequest(s, "/hooks/missing", body, signed)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestStripeTrigger(t *testing.T) {
+	s := newTriggerTestServer(t)
+	body := `{"type":"charge.succeeded","data":{"object":{"id":"ch_123"}}}`
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	header := fmt.Sprintf("t=%s,v1=%s,v1=%s", ts, hmacHex("old-secret", ts+"."+body), hmacHex("whsec_test", ts+"."+body))
+	w := hookRequest(s, "/hooks/pay", body, map[string]string{"Stripe-Signature": header})
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	waitForQueuedRun(t, s, w)
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	header = fmt.Sprintf("t=%s,v1=%s", old, hmacHex("whsec_test", old+"."+body))
+	w = hookRequest(s, "/hooks/pay", body, map[string]string{"Stripe-Signature": header})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestGenericTrigger(t *testing.T) {
+	s := newTriggerTestServer(t)
+	now := time.Now().Unix()
+
+	body := `{"repo":"acme/web"}`
+	w := hookRequest(s, "/hooks/any", body, map[string]string{
+		webhook.EventHeader:     "deploy",
+		webhook.TimestampHeader: strconv.FormatInt(now, 10),
+		webhook.SignatureHeader: webhook.Sign("generic-secret", now, "deploy", []byte(body)),
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	waitForQueuedRun(t, s, w)
+
+	// The event is signed, so a delivery can't be replayed as another event
+	w = hookRequest(s, "/hooks/any", body, map[string]string{
+		webhook.EventHeader:     "rollback",
+		webhook.TimestampHeader: strconv.FormatInt(now, 10),
+		webhook.SignatureHeader: webhook.Sign("generic-secret", now, "deploy", []byte(body)),
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// A payload missing a required param's field can't start a run
+	body = `{"other":"x"}`
+	w = hookRequest(s, "/hooks/any", body, map[string]string{
+		webhook.TimestampHeader: strconv.FormatInt(now, 10),
+		webhook.SignatureHeader: webhook.Sign("generic-secret", now, "", []byte(body)),
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "repo")
+
+	w = hookRequest(s, "/hooks/any", body, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestPayloadField(t *testing.T) {
+	var payload interface{}
+	decoder := json.NewDecoder(strings.NewReader(`{"a":{"b":[{"c":"x"},{"n":42}]},"flag":true,"obj":{"k":1}}`))
+	decoder.UseNumber()
+	decoder.Decode(&payload)
+
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"a.b.0.c", "x", true},
+		{"a.b.1.n", "42", true},
+		{"flag", "true", true},
+		{"obj", `{"k":1}`, true},
+		{"a.b.5", "", false},
+		{"a.missing", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := payloadField(payload, tt.path)
+		assert.Equal(t, tt.ok, ok, tt.path)
+		assert.Equal(t, tt.want, got, tt.path)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	cfg "github.com/kris-hansen/comanda/utils/config" // Added alias cfg
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
 )
 
 // debugLog provides local logging to avoid circular imports
@@ -40,6 +42,7 @@ type FileInfo struct {
 	CreatedAt  time.Time `json:"createdAt"`
 	ModifiedAt time.Time `json:"modifiedAt"`
 	Methods    string    `json:"methods,omitempty"`
+	MimeType   string    `json:"mimeType,omitempty"` // Detected from the content of uploaded files
 }
 
 // FileRequest represents a request to create/edit a file
@@ -64,6 +67,14 @@ type FileUploadResponse struct {
 	File    FileInfo `json:"file,omitempty"`
 }
 
+// MultiUploadResponse represents a response for uploading several files at once
+type MultiUploadResponse struct {
+	Success bool       `json:"success"`
+	Message string     `json:"message,omitempty"`
+	Error   string     `json:"error,omitempty"`
+	Files   []FileInfo `json:"files,omitempty"`
+}
+
 // ListResponse represents the response for file listing
 type ListResponse struct {
 	Success bool       `json:"success"`
@@ -145,6 +156,148 @@ type YAMLRequest struct {
 	Streaming bool   `json:"streaming"`
 }
 
+// WorkflowInfo describes a stored workflow
+type WorkflowInfo struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+	Content    string    `json:"content,omitempty"` // Only when a single workflow is requested
+}
+
+// WorkflowRequest represents a request to create or replace a workflow
+type WorkflowRequest struct {
+	Name    string `json:"name"` // Required when creating with POST /workflows
+	Content string `json:"content"`
+}
+
+// WorkflowResponse represents a response for workflow operations
+type WorkflowResponse struct {
+	Success  bool                        `json:"success"`
+	Message  string                      `json:"message,omitempty"`
+	Error    string                      `json:"error,omitempty"`
+	Workflow *WorkflowInfo               `json:"workflow,omitempty"`
+	Issues   []processor.ValidationIssue `json:"issues,omitempty"` // Why a workflow was rejected
+}
+
+// WorkflowListResponse represents the response for workflow listing
+type WorkflowListResponse struct {
+	Success   bool           `json:"success"`
+	Workflows []WorkflowInfo `json:"workflows"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// RunRequest represents a request to run a stored workflow
+type RunRequest struct {
+	Workflow   string                 `json:"workflow"`
+	Input      string                 `json:"input,omitempty"`      // STDIN for the first step
+	Params     map[string]interface{} `json:"params,omitempty"`     // Values for the workflow's params section
+	RuntimeDir string                 `json:"runtimeDir,omitempty"` // Directory in DataDir that file paths are relative to
+	Wait       bool                   `json:"wait,omitempty"`       // Respond when the run finished rather than once it is queued
+	Webhooks   []processor.Webhook    `json:"webhooks,omitempty"`   // Notified when the run finishes, besides the workflow's own
+	Priority   string                 `json:"priority,omitempty"`   // interactive (the default) or batch
+	// Credential set of the env config the run's providers use instead of
+	// the one the workflow names or the shared keys
+	Credentials string `json:"credentials,omitempty"`
+}
+
+// RunResponse represents a run and, once it finished, its final output
+type RunResponse struct {
+	Success     bool                        `json:"success"`
+	Error       string                      `json:"error,omitempty"`
+	Run         *history.Run                `json:"run,omitempty"`
+	Progress    string                      `json:"progress,omitempty"`  // Latest step message while the run is in progress
+	Approvals   []processor.ApprovalRequest `json:"approvals,omitempty"` // Approval steps the run waits at
+	Output      string                      `json:"output,omitempty"`
+	Adjustments []string                    `json:"adjustments,omitempty"` // Workflow settings lowered to fit the server\'s run limits
+}
+
+// AuditVerifyResponse reports whether the audit log's chain of hashes is
+// intact
+type AuditVerifyResponse struct {
+	Success bool   `json:"success"`
+	Events  int    `json:"events"` // Events checked
+	Error   string `json:"error,omitempty"`
+}
+
+// RunListResponse represents the response for run listing
+type RunListResponse struct {
+	Success bool          `json:"success"`
+	Runs    []history.Run `json:"runs"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ArtifactInfo describes a file written by a run
+type ArtifactInfo struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ArtifactListResponse represents the response for listing a run's artifacts
+type ArtifactListResponse struct {
+	Success   bool           `json:"success"`
+	Artifacts []ArtifactInfo `json:"artifacts"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// ScheduleRequest creates or replaces a schedule
+type ScheduleRequest struct {
+	ID       string            `json:"id,omitempty"` // Defaults to the workflow's name; set by the path for PUT
+	Workflow string            `json:"workflow"`
+	Cron     string            `json:"cron"`
+	Timezone string            `json:"timezone,omitempty"` // IANA name; the server's local time when empty
+	Enabled  *bool             `json:"enabled,omitempty"`  // true when left out
+	Params   map[string]string `json:"params,omitempty"`   // Values for the workflow's params section
+	Overlap  string            `json:"overlap,omitempty"`  // skip (the default), queue or cancel-previous
+}
+
+// ScheduleInfo is a schedule and when it next runs
+type ScheduleInfo struct {
+	history.Schedule
+	NextRun *time.Time `json:"next_run,omitempty"` // Unset while the schedule is disabled
+}
+
+// ScheduleResponse represents the result of a schedule operation
+type ScheduleResponse struct {
+	Success  bool          `json:"success"`
+	Message  string        `json:"message,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Schedule *ScheduleInfo `json:"schedule,omitempty"`
+}
+
+// ScheduleListResponse represents the response for schedule listing
+type ScheduleListResponse struct {
+	Success   bool           `json:"success"`
+	Schedules []ScheduleInfo `json:"schedules"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// WatchedFile is a file in a watch trigger's folder and the run it started
+type WatchedFile struct {
+	Name     string     `json:"name"`
+	Size     int64      `json:"size"`
+	Modified time.Time  `json:"modified"`
+	RunID    string     `json:"run_id,omitempty"`
+	Queued   *time.Time `json:"queued,omitempty"`
+	Status   string     `json:"status"`          // waiting until the file starts its run, then the run's status
+	Error    string     `json:"error,omitempty"` // Why the run failed
+}
+
+// WatchInfo is a watch trigger and the files in its folder
+type WatchInfo struct {
+	Name      string        `json:"name"`
+	Workflow  string        `json:"workflow"`
+	Dir       string        `json:"dir"`
+	Workspace string        `json:"workspace,omitempty"`
+	Files     []WatchedFile `json:"files"`
+}
+
+// WatchListResponse represents the response for watch trigger listing
+type WatchListResponse struct {
+	Success bool        `json:"success"`
+	Watches []WatchInfo `json:"watches"`
+	Error   string      `json:"error,omitempty"`
+}
+
 // flushingResponseWriter implements http.Flusher interface
 type flushingResponseWriter struct {
 	http.ResponseWriter
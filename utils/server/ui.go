@@ -0,0 +1,38 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles is the web UI: a single page that browses workflows and runs by
+// calling the API with the token the user enters
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiPolicy keeps the UI's pages to its own scripts and styles and out of
+// other sites' frames
+const uiPolicy = "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'"
+
+// handleUI serves the web UI's files under /ui/
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Security-Policy", uiPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.StripPrefix("/ui/", http.FileServer(http.FS(files))).ServeHTTP(w, r)
+}
+
+// handleRoot sends browsers opening the server's address to the web UI
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, s.basePath()+"/ui/", http.StatusFound)
+}
@@ -0,0 +1,487 @@
+// The comanda web UI: browse stored workflows and past runs, follow a run
+// while it executes, and check and start workflows. It calls the same API as
+// any other client, with the token entered in the header or issued when the
+// user signs in with the server's OIDC provider.
+(function () {
+  'use strict';
+
+  const view = document.getElementById('view');
+  const base = new URL('../', location.href).pathname; // The UI is served from <base>ui/
+  const settings = {
+    token: localStorage.getItem('comanda.token') || '',
+    workspace: localStorage.getItem('comanda.workspace') || '',
+  };
+
+  let generation = 0; // Bumped on navigation so slow responses don't draw over a newer view
+  let stream = null; // Aborts the run being followed
+  let timer = null; // Refreshes the runs list
+  let signIn = false; // Whether the server signs users in with an OIDC provider
+
+  // el builds an element. Strings and numbers become text nodes, so data from
+  // the API is never interpreted as HTML.
+  function el(tag, attrs, ...children) {
+    const node = document.createElement(tag);
+    for (const [key, value] of Object.entries(attrs || {})) {
+      if (value === undefined || value === null || value === false) continue;
+      if (key.startsWith('on')) node.addEventListener(key.slice(2), value);
+      else if (key === 'className') node.className = value;
+      else if (key === 'value') node.value = value;
+      else node.setAttribute(key, value === true ? '' : value);
+    }
+    for (const child of children.flat()) {
+      if (child === undefined || child === null || child === false) continue;
+      node.append(child instanceof Node ? child : document.createTextNode(String(child)));
+    }
+    return node;
+  }
+
+  function render(gen, ...nodes) {
+    if (gen !== generation) return false;
+    view.replaceChildren(...nodes);
+    return true;
+  }
+
+  // API calls
+
+  class APIError extends Error {
+    constructor(status, message, body) {
+      super(message);
+      this.status = status;
+      this.body = body || {};
+    }
+  }
+
+  function headers(extra) {
+    const h = Object.assign({ Accept: 'application/json' }, extra);
+    if (settings.token) h.Authorization = 'Bearer ' + settings.token;
+    if (settings.workspace) h['X-Comanda-Workspace'] = settings.workspace;
+    return h;
+  }
+
+  function apiURL(path) {
+    return base + path.replace(/^\//, '');
+  }
+
+  async function api(method, path, body) {
+    const init = { method, headers: headers() };
+    if (body !== undefined) {
+      init.headers['Content-Type'] = 'application/json';
+      init.body = JSON.stringify(body);
+    }
+    const resp = await fetch(apiURL(path), init);
+    const text = await resp.text();
+    let data;
+    try {
+      data = text ? JSON.parse(text) : {};
+    } catch (e) {
+      data = { error: text };
+    }
+    if (!resp.ok) throw new APIError(resp.status, data.error || resp.statusText, data);
+    return data;
+  }
+
+  // followRun reads a run's event stream, calling onUpdate with each version
+  // of the run until it finished
+  async function followRun(id, onUpdate) {
+    const controller = new AbortController();
+    stream = controller;
+    const resp = await fetch(apiURL('/runs/' + encodeURIComponent(id) + '/events'), {
+      headers: headers({ Accept: 'text/event-stream' }),
+      signal: controller.signal,
+    });
+    if (!resp.ok) {
+      const data = await resp.json().catch(() => ({}));
+      throw new APIError(resp.status, data.error || resp.statusText, data);
+    }
+    const reader = resp.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) return;
+      buffer += decoder.decode(value, { stream: true });
+      let end;
+      while ((end = buffer.indexOf('\n\n')) >= 0) {
+        const block = buffer.slice(0, end);
+        buffer = buffer.slice(end + 2);
+        let event = 'message';
+        let data = '';
+        for (const line of block.split('\n')) {
+          if (line.startsWith('event: ')) event = line.slice(7);
+          else if (line.startsWith('data: ')) data += line.slice(6);
+        }
+        if (!data) continue;
+        const payload = JSON.parse(data);
+        if (event === 'error') throw new APIError(500, payload.error, payload);
+        onUpdate(payload, event === 'done');
+      }
+    }
+  }
+
+  // download fetches a file with the API credentials and saves it
+  async function download(path, name) {
+    const resp = await fetch(apiURL(path), { headers: headers({ Accept: '*/*' }) });
+    if (!resp.ok) {
+      const data = await resp.json().catch(() => ({}));
+      throw new APIError(resp.status, data.error || resp.statusText, data);
+    }
+    const link = el('a', { href: URL.createObjectURL(await resp.blob()), download: name });
+    link.click();
+    setTimeout(() => URL.revokeObjectURL(link.href), 1000);
+  }
+
+  // Formatting
+
+  function hasTime(value) {
+    return value && !value.startsWith('0001-');
+  }
+
+  function formatTime(value) {
+    return hasTime(value) ? new Date(value).toLocaleString() : '—';
+  }
+
+  function formatDuration(started, finished) {
+    if (!hasTime(started)) return '—';
+    const end = hasTime(finished) ? new Date(finished) : new Date();
+    const seconds = Math.max(0, (end - new Date(started)) / 1000);
+    if (seconds < 60) return seconds.toFixed(1) + 's';
+    return Math.floor(seconds / 60) + 'm ' + Math.round(seconds % 60) + 's';
+  }
+
+  function formatTokens(n) {
+    return n ? n.toLocaleString() : '—';
+  }
+
+  function formatCost(cost) {
+    return cost ? '$' + cost.toFixed(4) : '—';
+  }
+
+  function totals(run) {
+    const t = { prompt: 0, completion: 0, cost: 0 };
+    for (const step of run.steps || []) {
+      t.prompt += step.prompt_tokens || 0;
+      t.completion += step.completion_tokens || 0;
+      t.cost += step.cost || 0;
+    }
+    return t;
+  }
+
+  function statusLabel(status) {
+    return el('span', { className: 'status status-' + status }, status);
+  }
+
+  function table(columns, rows, empty) {
+    if (rows.length === 0) return el('p', { className: 'muted' }, empty);
+    return el('table', {},
+      el('thead', {}, el('tr', {}, columns.map(([label, cls]) => el('th', { className: cls }, label)))),
+      el('tbody', {}, rows));
+  }
+
+  function notice(kind, message, items) {
+    return el('div', { className: 'notice ' + kind }, message,
+      items && items.length ? el('ul', {}, items.map((item) => el('li', {}, item))) : null);
+  }
+
+  function errorNotice(err) {
+    if (err.status === 401 && signIn) {
+      return el('div', { className: 'notice error' }, 'The server needs a token: ',
+        el('a', { href: apiURL('/auth/login') }, 'sign in'), ' or enter an API token above and save.');
+    }
+    if (err.status === 401) return notice('error', 'The server needs a token: enter an API token above and save.');
+    if (err.status === 403) return notice('error', err.message + '. The token may lack the scope this needs.');
+    const issues = ((err.body && err.body.issues) || []).map((i) => (i.step ? i.step + ': ' : '') + i.message);
+    return notice('error', err.message, issues);
+  }
+
+  // Views
+
+  async function showRuns(gen, params) {
+    const workflow = params.get('workflow') || '';
+    let path = '/runs?limit=100';
+    if (workflow) path += '&workflow=' + encodeURIComponent(workflow);
+    const data = await api('GET', path);
+
+    const rows = data.runs.map((run) => {
+      const t = totals(run);
+      return el('tr', { className: 'clickable', onclick: () => { location.hash = '#/runs/' + encodeURIComponent(run.id); } },
+        el('td', {}, run.id),
+        el('td', {}, run.workflow),
+        el('td', {}, statusLabel(run.status)),
+        el('td', {}, formatTime(run.started)),
+        el('td', { className: 'num' }, formatDuration(run.started, run.finished)),
+        el('td', { className: 'num' }, formatTokens(t.prompt + t.completion)),
+        el('td', { className: 'num' }, formatCost(t.cost)));
+    });
+    const shown = render(gen,
+      el('h1', {}, workflow ? 'Runs of ' + workflow : 'Runs'),
+      workflow ? el('p', {}, el('a', { href: '#/runs' }, 'All runs')) : null,
+      table([['Run'], ['Workflow'], ['Status'], ['Started'], ['Duration', 'num'], ['Tokens', 'num'], ['Cost', 'num']], rows, 'No runs yet.'));
+
+    // Keep the list current while runs are in progress
+    if (shown && data.runs.some((run) => run.status === 'queued' || run.status === 'running')) {
+      timer = setTimeout(() => showRuns(gen, params).catch((err) => showError(gen, err)), 3000);
+    }
+  }
+
+  async function showRun(gen, id) {
+    const live = el('div');
+    const stepOutput = el('div');
+    const artifacts = el('div');
+    render(gen, live, stepOutput, artifacts);
+
+    const showStepOutput = async (step) => {
+      try {
+        const resp = await fetch(apiURL('/runs/' + encodeURIComponent(id) + '/steps/' + encodeURIComponent(step) + '/output'),
+          { headers: headers({ Accept: 'text/plain' }) });
+        const text = await resp.text();
+        if (!resp.ok) {
+          let message = resp.statusText;
+          try {
+            message = JSON.parse(text).error || message;
+          } catch (e) {
+            // Not a JSON error response
+          }
+          throw new APIError(resp.status, message);
+        }
+        stepOutput.replaceChildren(el('h2', {}, 'Output of ' + step), el('pre', {}, text));
+      } catch (err) {
+        stepOutput.replaceChildren(errorNotice(err));
+      }
+    };
+
+    const update = (resp, done) => {
+      if (gen !== generation) return;
+      const run = resp.run;
+      const t = totals(run);
+      const steps = (run.steps || []).map((step) => el('tr', {},
+        el('td', {}, step.name),
+        el('td', {}, step.model || '—'),
+        el('td', {}, statusLabel(step.status), step.error ? el('div', { className: 'muted' }, step.error) : null),
+        el('td', { className: 'num' }, formatDuration(step.started, step.finished)),
+        el('td', { className: 'num' }, formatTokens(step.prompt_tokens)),
+        el('td', { className: 'num' }, formatTokens(step.completion_tokens)),
+        el('td', { className: 'num' }, formatCost(step.cost)),
+        el('td', {}, step.status === 'succeeded' ? el('button', { onclick: () => showStepOutput(step.name) }, 'Output') : null)));
+
+      const cancel = () => api('DELETE', '/runs/' + encodeURIComponent(id)).catch((err) => live.append(errorNotice(err)));
+      live.replaceChildren(
+        el('h1', {}, 'Run ' + run.id + ' ', statusLabel(run.status), ' ',
+          !done && !run.error ? el('button', { onclick: cancel }, 'Cancel') : null),
+        el('div', { className: 'summary' },
+          el('div', {}, el('span', {}, 'Workflow'), el('a', { href: '#/workflows/' + encodeURIComponent(run.workflow) }, run.workflow)),
+          el('div', {}, el('span', {}, 'Started'), formatTime(run.started)),
+          el('div', {}, el('span', {}, 'Duration'), formatDuration(run.started, run.finished)),
+          el('div', {}, el('span', {}, 'Prompt tokens'), formatTokens(t.prompt)),
+          el('div', {}, el('span', {}, 'Completion tokens'), formatTokens(t.completion)),
+          el('div', {}, el('span', {}, 'Cost'), formatCost(t.cost))),
+        run.error ? notice('error', run.error) : null,
+        !done && resp.progress ? el('p', { className: 'muted' }, resp.progress) : null,
+        el('h2', {}, 'Steps'),
+        table([['Step'], ['Model'], ['Status'], ['Duration', 'num'], ['Prompt', 'num'], ['Completion', 'num'], ['Cost', 'num'], ['']],
+          steps, done ? 'The run has no steps.' : 'Waiting for the first step…'),
+        done && resp.output ? [el('h2', {}, 'Output'), el('pre', {}, resp.output)] : null);
+
+      if (done) showArtifacts(gen, id, artifacts);
+    };
+    await followRun(id, update);
+  }
+
+  async function showArtifacts(gen, id, container) {
+    const data = await api('GET', '/runs/' + encodeURIComponent(id) + '/artifacts').catch(() => ({ artifacts: [] }));
+    if (gen !== generation || data.artifacts.length === 0) return;
+    const rows = data.artifacts.map((a) => el('tr', {},
+      el('td', {}, a.path),
+      el('td', { className: 'num' }, a.size.toLocaleString() + ' bytes'),
+      el('td', {}, el('button', {
+        onclick: () => download('/runs/' + encodeURIComponent(id) + '/artifacts/' + a.path.split('/').map(encodeURIComponent).join('/'),
+          a.path.split('/').pop()).catch((err) => container.append(errorNotice(err))),
+      }, 'Download'))));
+    container.replaceChildren(el('h2', {}, 'Artifacts'), table([['File'], ['Size', 'num'], ['']], rows, ''));
+  }
+
+  async function showWorkflows(gen) {
+    const data = await api('GET', '/workflows');
+    const rows = data.workflows.map((wf) => el('tr', { className: 'clickable', onclick: () => { location.hash = '#/workflows/' + encodeURIComponent(wf.name); } },
+      el('td', {}, wf.name),
+      el('td', { className: 'num' }, wf.size.toLocaleString() + ' bytes'),
+      el('td', {}, formatTime(wf.modifiedAt))));
+    render(gen,
+      el('h1', {}, 'Workflows'),
+      el('div', { className: 'toolbar' }, el('button', { onclick: () => { location.hash = '#/new-workflow'; } }, 'New workflow')),
+      table([['Name'], ['Size', 'num'], ['Modified']], rows, 'No workflows stored yet.'));
+  }
+
+  // parseParams reads name=value lines into run parameters
+  function parseParams(text) {
+    const params = {};
+    for (const line of text.split('\n')) {
+      if (!line.trim()) continue;
+      const eq = line.indexOf('=');
+      if (eq < 1) throw new APIError(400, 'Parameters are name=value lines: "' + line.trim() + '" has no name');
+      params[line.slice(0, eq).trim()] = line.slice(eq + 1).trim();
+    }
+    return params;
+  }
+
+  function workflowEditor(content) {
+    return el('textarea', { rows: 18, spellcheck: 'false', value: content });
+  }
+
+  async function validate(content) {
+    return api('POST', '/workflows?dryRun=true', { content });
+  }
+
+  async function showWorkflow(gen, name) {
+    const data = await api('GET', '/workflows/' + encodeURIComponent(name));
+    let stored = data.workflow.content;
+    const editor = workflowEditor(stored);
+    const result = el('div');
+    const input = el('textarea', { rows: 4, placeholder: 'Input for steps reading STDIN' });
+    const params = el('textarea', { rows: 3, placeholder: 'topic=Q3 results' });
+    const runtimeDir = el('input', { placeholder: 'Optional directory with the run\'s input files' });
+
+    const check = async () => {
+      try {
+        await validate(editor.value);
+        result.replaceChildren(notice('ok', 'The workflow is valid.'));
+        return true;
+      } catch (err) {
+        result.replaceChildren(errorNotice(err));
+        return false;
+      }
+    };
+    const save = async () => {
+      try {
+        await api('PUT', '/workflows/' + encodeURIComponent(name), { content: editor.value });
+        stored = editor.value;
+        result.replaceChildren(notice('ok', 'Workflow saved.'));
+        return true;
+      } catch (err) {
+        result.replaceChildren(errorNotice(err));
+        return false;
+      }
+    };
+    const run = async () => {
+      if (!(await check())) return;
+      if (editor.value !== stored && !(await save())) return;
+      try {
+        const resp = await api('POST', '/runs', {
+          workflow: name,
+          input: input.value || undefined,
+          params: parseParams(params.value),
+          runtimeDir: runtimeDir.value.trim() || undefined,
+        });
+        location.hash = '#/runs/' + encodeURIComponent(resp.run.id);
+      } catch (err) {
+        result.replaceChildren(errorNotice(err));
+      }
+    };
+
+    render(gen,
+      el('h1', {}, name),
+      el('p', {}, el('a', { href: '#/runs?workflow=' + encodeURIComponent(name) }, 'Runs of this workflow')),
+      editor,
+      el('div', { className: 'toolbar' },
+        el('button', { onclick: check }, 'Validate'),
+        el('button', { onclick: save }, 'Save')),
+      result,
+      el('h2', {}, 'Run'),
+      el('div', { className: 'fields' },
+        el('label', {}, 'Input'), input,
+        el('label', {}, 'Parameters'), params,
+        el('label', {}, 'Runtime directory'), runtimeDir),
+      el('div', { className: 'toolbar' },
+        el('button', { className: 'primary', onclick: run }, 'Validate and run'),
+        el('span', { className: 'muted' }, 'Unsaved changes are saved first.')));
+  }
+
+  function showNewWorkflow(gen) {
+    const name = el('input', { placeholder: 'summarize' });
+    const editor = workflowEditor('summarize:\n  input: STDIN\n  model: gpt-4o\n  action: Summarize this\n  output: STDOUT\n');
+    const result = el('div');
+    const create = async () => {
+      try {
+        await api('POST', '/workflows', { name: name.value.trim(), content: editor.value });
+        location.hash = '#/workflows/' + encodeURIComponent(name.value.trim());
+      } catch (err) {
+        result.replaceChildren(errorNotice(err));
+      }
+    };
+    render(gen,
+      el('h1', {}, 'New workflow'),
+      el('div', { className: 'fields' }, el('label', {}, 'Name'), name),
+      el('h2', {}, 'YAML'),
+      editor,
+      el('div', { className: 'toolbar' },
+        el('button', {
+          onclick: () => validate(editor.value)
+            .then(() => result.replaceChildren(notice('ok', 'The workflow is valid.')))
+            .catch((err) => result.replaceChildren(errorNotice(err))),
+        }, 'Validate'),
+        el('button', { className: 'primary', onclick: create }, 'Create')),
+      result);
+  }
+
+  function showError(gen, err) {
+    if (err.name === 'AbortError') return;
+    render(gen, errorNotice(err));
+  }
+
+  async function route() {
+    generation++;
+    const gen = generation;
+    if (stream) stream.abort();
+    stream = null;
+    clearTimeout(timer);
+
+    const [path, query] = (location.hash.slice(1) || '/runs').split('?');
+    const parts = path.split('/').filter(Boolean).map(decodeURIComponent);
+    if (parts[0] === 'login') {
+      // Sign-in hands over its token in the fragment; keep it, and drop it
+      // from the address and history
+      saveSettings(parts[1] || '', settings.workspace);
+      location.replace('#/runs');
+      return;
+    }
+    for (const link of document.querySelectorAll('[data-nav]')) {
+      link.classList.toggle('active', link.dataset.nav === (parts[0] === 'new-workflow' ? 'workflows' : parts[0]));
+    }
+    try {
+      if (parts[0] === 'workflows' && parts[1]) await showWorkflow(gen, parts[1]);
+      else if (parts[0] === 'workflows') await showWorkflows(gen);
+      else if (parts[0] === 'new-workflow') showNewWorkflow(gen);
+      else if (parts[0] === 'runs' && parts[1]) await showRun(gen, parts[1]);
+      else await showRuns(gen, new URLSearchParams(query || ''));
+    } catch (err) {
+      showError(gen, err);
+    }
+  }
+
+  const tokenInput = document.getElementById('token');
+  const workspaceInput = document.getElementById('workspace');
+  function saveSettings(token, workspace) {
+    settings.token = token;
+    settings.workspace = workspace;
+    tokenInput.value = token;
+    workspaceInput.value = workspace;
+    localStorage.setItem('comanda.token', token);
+    localStorage.setItem('comanda.workspace', workspace);
+  }
+
+  tokenInput.value = settings.token;
+  workspaceInput.value = settings.workspace;
+  document.getElementById('settings').addEventListener('submit', (e) => {
+    e.preventDefault();
+    saveSettings(tokenInput.value.trim(), workspaceInput.value.trim());
+    route();
+  });
+
+  // Offer sign-in when the server has an OIDC provider
+  api('GET', '/auth').then((info) => {
+    signIn = Boolean(info.sign_in);
+    document.getElementById('signin').hidden = !signIn;
+  }).catch(() => {});
+
+  window.addEventListener('hashchange', route);
+  route();
+})();
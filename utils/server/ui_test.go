@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebUI(t *testing.T) {
+	s := newAPITestServer(t)
+	s.mux = http.NewServeMux()
+	s.config.Enabled = true
+	s.config.BearerToken = "secret"
+	s.routes()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// The page and its assets need no token
+	w := get("/ui/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<script src="app.js">`)
+	assert.Equal(t, uiPolicy, w.Header().Get("Content-Security-Policy"))
+	w = get("/ui/app.js")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/events")
+
+	w = get("/")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/ui/", w.Header().Get("Location"))
+
+	// The API still does, and other paths aren't sent to the UI
+	assert.Equal(t, http.StatusUnauthorized, get("/runs").Code)
+	assert.Equal(t, http.StatusNotFound, get("/missing").Code)
+}
+
+func TestWebUIDisabled(t *testing.T) {
+	s := newAPITestServer(t)
+	s.mux = http.NewServeMux()
+	s.config.DisableUI = true
+	s.routes()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// sniffLen is how much of a file is read to detect its type
+const sniffLen = 512
+
+// handleMultipartUpload stores each file of a multipart POST /files request
+// in the runtime directory named by the runtimeDir query parameter, under
+// the file's own name. Files are checked against the upload size limit and
+// allowed types as they stream in; when one is refused, none are kept.
+func (s *Server) handleMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	runtimeDir := r.URL.Query().Get("runtimeDir")
+	if runtimeDir != "" {
+		if _, err := s.validatePath(runtimeDir); err != nil {
+			sendJSONError(w, http.StatusForbidden, fmt.Sprintf("Invalid runtime directory: %v", err))
+			return
+		}
+	}
+	if err := s.ensureRuntimeDir(runtimeDir); err != nil {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error ensuring runtime directory: %v", err))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.Uploads.MaxBytes())
+	reader, err := r.MultipartReader()
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, "Error parsing form data")
+		return
+	}
+
+	var saved []string
+	var files []FileInfo
+	fail := func(status int, message string) {
+		for _, path := range saved {
+			os.Remove(path)
+		}
+		sendJSONError(w, status, message)
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			status, message := uploadError(err, s.config.Uploads)
+			fail(status, message)
+			return
+		}
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		name := filepath.Base(filepath.FromSlash(strings.ReplaceAll(part.FileName(), "\\", "/")))
+		if name == "." || name == string(filepath.Separator) || strings.HasPrefix(name, ".") {
+			fail(http.StatusBadRequest, fmt.Sprintf("Invalid file name '%s'", part.FileName()))
+			return
+		}
+		fullPath, err := s.validatePath(filepath.Join(runtimeDir, name))
+		if err != nil {
+			fail(http.StatusForbidden, fmt.Sprintf("Invalid file path: %v", err))
+			return
+		}
+
+		mimeType, content, err := sniffUpload(part)
+		if err != nil {
+			status, message := uploadError(err, s.config.Uploads)
+			fail(status, message)
+			return
+		}
+		if err := checkUploadType(mimeType, s.config.Uploads.AllowedTypes); err != nil {
+			fail(http.StatusUnsupportedMediaType, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		if err := writeUpload(fullPath, content); err != nil {
+			status, message := uploadError(err, s.config.Uploads)
+			fail(status, message)
+			return
+		}
+		saved = append(saved, fullPath)
+		part.Close()
+
+		info, err := s.getFileInfo(fullPath)
+		if err != nil {
+			fail(http.StatusInternalServerError, fmt.Sprintf("Error getting file info: %v", err))
+			return
+		}
+		info.MimeType = mimeType
+		files = append(files, info)
+		config.VerboseLog("Uploaded %s (%s, %d bytes)", info.Path, mimeType, info.Size)
+	}
+	if len(files) == 0 {
+		sendJSONError(w, http.StatusBadRequest, "No file provided")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MultiUploadResponse{
+		Success: true,
+		Message: fmt.Sprintf("Uploaded %d file(s)", len(files)),
+		Files:   files,
+	})
+}
+
+// sniffUpload detects a file's type from its first bytes, returning a reader
+// that still yields the whole file
+func sniffUpload(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// checkUploadType checks a detected type against the allowed types, which
+// may end in /* to allow a whole family such as image/*
+func checkUploadType(mimeType string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = mimeType
+	}
+	for _, a := range allowed {
+		if a == mediaType || (strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*"))) {
+			return nil
+		}
+	}
+	return fmt.Errorf("file type %s is not allowed", mediaType)
+}
+
+// writeUpload writes an upload next to its destination and moves it into
+// place once complete, so a failed upload never leaves a partial file
+func writeUpload(path string, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating directories: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error saving file: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// uploadError returns the status and message for an error reading an upload
+func uploadError(err error, uploads config.Uploads) (int, string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds the limit of %d MB", uploads.MaxBytes()>>20)
+	}
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	if errors.As(err, &pathErr) || errors.As(err, &linkErr) {
+		return http.StatusInternalServerError, err.Error()
+	}
+	return http.StatusBadRequest, fmt.Sprintf("Error reading upload: %v", err)
+}
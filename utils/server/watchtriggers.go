@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/seen"
+)
+
+// watchTriggerBatch is the most runs a watch trigger starts at each check;
+// the other files wait for the next one
+const watchTriggerBatch = 20
+
+// watchWaiting is the status of a file that hasn't started its run yet
+const watchWaiting = "waiting"
+
+// watchedFile is what a watch trigger keeps about a file in its folder
+type watchedFile struct {
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Since    time.Time `json:"since"`            // When the file was first seen at this size and time
+	RunID    string    `json:"runId,omitempty"`  // The run the file started
+	Queued   time.Time `json:"queued,omitempty"` // When that run was queued
+}
+
+// runWatchTriggers checks the folder of each watch trigger at its interval
+// until ctx is cancelled
+func (s *Server) runWatchTriggers(ctx context.Context) {
+	for _, trigger := range s.config.WatchTriggers {
+		go func(trigger config.WatchTrigger) {
+			for {
+				s.checkWatchTrigger(trigger, time.Now())
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(trigger.PollInterval()):
+				}
+			}
+		}(trigger)
+	}
+}
+
+// watchTarget returns the server whose data directory a watch trigger's
+// folder is in
+func (s *Server) watchTarget(trigger config.WatchTrigger) (*Server, error) {
+	if trigger.Workspace == "" || s.workspace != nil {
+		return s, nil
+	}
+	return s.workspaceServer(trigger.Workspace)
+}
+
+// watchStatePath returns the file that keeps what a watch trigger knows of
+// the files in its folder
+func (s *Server) watchStatePath(name string) string {
+	return seen.Path(filepath.Join(s.config.DataDir, ".comanda", "watch"), name)
+}
+
+// loadWatchState reads the files a watch trigger knows of, by name
+func loadWatchState(path string) (map[string]watchedFile, error) {
+	files := make(map[string]watchedFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return files, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading watch state: %w", err)
+	}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("error parsing watch state %s: %w", path, err)
+	}
+	return files, nil
+}
+
+// saveWatchState writes the files a watch trigger knows of, replacing the
+// file at once so a crash can't leave it half written
+func saveWatchState(path string, files map[string]watchedFile) error {
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating watch state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".watch-*")
+	if err != nil {
+		return fmt.Errorf("error saving watch state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error saving watch state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error saving watch state: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// watchMatches reports whether a file in a watch trigger's folder starts
+// runs: one matching its pattern, or a recording when it has none. Hidden
+// files, such as those sync tools write to first, never do.
+func watchMatches(trigger config.WatchTrigger, name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	if trigger.Pattern == "" {
+		return models.IsAudioFile(name)
+	}
+	matched, err := filepath.Match(trigger.Pattern, name)
+	return err == nil && matched
+}
+
+// checkWatchTrigger starts a run of the trigger's workflow for each file in
+// its folder that has stayed unchanged for the settle time since it was
+// first seen, in name order. A file starts one run; replaced by a file of
+// another size or modification time, it starts another. When a run can't
+// be queued, it and the later files wait for the next check.
+func (s *Server) checkWatchTrigger(trigger config.WatchTrigger, now time.Time) {
+	now = now.UTC()
+	target, err := s.watchTarget(trigger)
+	if err != nil {
+		s.logf("Watch trigger %s: %v", trigger.Name, err)
+		return
+	}
+	if _, err := target.validatePath(trigger.Dir); err != nil {
+		s.logf("Watch trigger %s: invalid folder '%s': %v", trigger.Name, trigger.Dir, err)
+		return
+	}
+	entries, err := os.ReadDir(filepath.Join(target.config.DataDir, trigger.Dir))
+	if err != nil {
+		s.logf("Watch trigger %s: %v", trigger.Name, err)
+		return
+	}
+	statePath := target.watchStatePath(trigger.Name)
+	known, err := loadWatchState(statePath)
+	if err != nil {
+		s.logf("Watch trigger %s: %v", trigger.Name, err)
+		return
+	}
+
+	// Files no longer in the folder are forgotten
+	files := make(map[string]watchedFile)
+	var ready []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !watchMatches(trigger, entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		file := watchedFile{Size: info.Size(), Modified: info.ModTime().UTC(), Since: now}
+		if prev, ok := known[entry.Name()]; ok && prev.Size == file.Size && prev.Modified.Equal(file.Modified) {
+			file = prev
+		}
+		files[entry.Name()] = file
+		if file.RunID == "" && now.Sub(file.Since) >= trigger.SettleTime() {
+			ready = append(ready, entry.Name())
+		}
+	}
+	if len(ready) > watchTriggerBatch {
+		ready = ready[:watchTriggerBatch]
+	}
+
+	for _, name := range ready {
+		req := RunRequest{
+			Workflow:   trigger.Workflow,
+			Params:     map[string]interface{}{trigger.FileParam(): name},
+			RuntimeDir: trigger.Dir,
+		}
+		job, err := target.queueRun(withActor(context.Background(), fmt.Sprintf("watch trigger '%s'", trigger.Name)), req)
+		if err != nil {
+			s.logf("Watch trigger %s: run not started for %s: %v", trigger.Name, name, err)
+			break
+		}
+		file := files[name]
+		file.RunID, file.Queued = job.recorder.ID(), now
+		files[name] = file
+		s.logf("Watch trigger %s: started run %s of workflow %s for %s", trigger.Name, file.RunID, trigger.Workflow, name)
+	}
+	if !maps.Equal(files, known) {
+		if err := saveWatchState(statePath, files); err != nil {
+			s.logf("Watch trigger %s: %v", trigger.Name, err)
+		}
+	}
+}
+
+// handleWatches serves /watches: GET lists the watch triggers with the
+// files in their folders and the status of the runs they started
+func (s *Server) handleWatches(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	resp := WatchListResponse{Success: true, Watches: []WatchInfo{}}
+	for _, trigger := range s.config.WatchTriggers {
+		info, err := s.watchInfo(trigger)
+		if err != nil {
+			sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Watch trigger %s: %v", trigger.Name, err))
+			return
+		}
+		resp.Watches = append(resp.Watches, info)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// watchInfo returns a watch trigger with the files it knows of, by name
+func (s *Server) watchInfo(trigger config.WatchTrigger) (WatchInfo, error) {
+	info := WatchInfo{Name: trigger.Name, Workflow: trigger.Workflow, Dir: trigger.Dir, Workspace: trigger.Workspace, Files: []WatchedFile{}}
+	target, err := s.watchTarget(trigger)
+	if err != nil {
+		return info, err
+	}
+	files, err := loadWatchState(target.watchStatePath(trigger.Name))
+	if err != nil {
+		return info, err
+	}
+	runs := make(map[string]history.Run)
+	if len(files) > 0 {
+		store, err := target.runStore()
+		if err != nil {
+			return info, err
+		}
+		list, err := store.List()
+		if err != nil {
+			return info, err
+		}
+		for _, run := range list {
+			runs[run.ID] = run
+		}
+	}
+
+	for name, file := range files {
+		wf := WatchedFile{Name: name, Size: file.Size, Modified: file.Modified, RunID: file.RunID, Status: watchWaiting}
+		if file.RunID != "" {
+			queued := file.Queued
+			wf.Queued = &queued
+			// Runs removed by retention leave the status empty
+			run := runs[file.RunID]
+			wf.Status, wf.Error = run.Status, run.Error
+		}
+		info.Files = append(info.Files, wf)
+	}
+	sort.Slice(info.Files, func(i, j int) bool { return info.Files[i].Name < info.Files[j].Name })
+	return info, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/stretchr/testify/assert"
+)
+
+const watchWorkflow = `params:
+  recording:
+    required: true
+summarize:
+  input: STDIN
+  model: gpt-4o
+  action: Summarize {{ params.recording }}
+  output: STDOUT
+`
+
+// watchedRuns returns the runs a watch trigger has started, once they
+// have all finished
+func watchedRuns(t *testing.T, s *Server, want int) []history.Run {
+	t.Helper()
+	store, _ := s.runStore()
+	var runs []history.Run
+	assert.Eventually(t, func() bool {
+		runs, _ = store.List()
+		for _, run := range runs {
+			if run.Status == history.StatusQueued || run.Status == history.StatusRunning {
+				return false
+			}
+		}
+		return len(runs) == want
+	}, 5*time.Second, 10*time.Millisecond)
+	return runs
+}
+
+func TestWatchTrigger(t *testing.T) {
+	s := newAPITestServer(t)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "minutes.yaml"), []byte(watchWorkflow), 0644)
+	inbox := filepath.Join(s.config.DataDir, "recordings")
+	os.MkdirAll(inbox, 0755)
+	os.WriteFile(filepath.Join(inbox, "standup.m4a"), []byte("audio"), 0644)
+	os.WriteFile(filepath.Join(inbox, "agenda.txt"), []byte("not a recording"), 0644)
+	os.WriteFile(filepath.Join(inbox, ".retro.m4a.part"), []byte("half"), 0644)
+	trigger := config.WatchTrigger{Name: "minutes", Workflow: "minutes", Dir: "recordings", Param: "recording", Settle: 10}
+	s.config.WatchTriggers = []config.WatchTrigger{trigger}
+
+	// A new file waits for the settle time before starting its run, once
+	start := time.Now()
+	s.checkWatchTrigger(trigger, start)
+	s.checkWatchTrigger(trigger, start.Add(5*time.Second))
+	watchedRuns(t, s, 0)
+	s.checkWatchTrigger(trigger, start.Add(11*time.Second))
+	s.checkWatchTrigger(trigger, start.Add(20*time.Second))
+	runs := watchedRuns(t, s, 1)
+	assert.Equal(t, history.StatusSucceeded, runs[0].Status, runs[0].Error)
+
+	w := apiRequest(s.handleWatches, http.MethodGet, "/watches", nil)
+	var list WatchListResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	if assert.Len(t, list.Watches, 1) && assert.Len(t, list.Watches[0].Files, 1) {
+		file := list.Watches[0].Files[0]
+		assert.Equal(t, "standup.m4a", file.Name)
+		assert.Equal(t, runs[0].ID, file.RunID)
+		assert.Equal(t, history.StatusSucceeded, file.Status)
+	}
+
+	// A file replaced by another recording starts another run
+	os.WriteFile(filepath.Join(inbox, "standup.m4a"), []byte("new audio"), 0644)
+	s.checkWatchTrigger(trigger, start.Add(30*time.Second))
+	watchedRuns(t, s, 1)
+	s.checkWatchTrigger(trigger, start.Add(41*time.Second))
+	watchedRuns(t, s, 2)
+}
+
+func TestWatchTriggerRetriesUnqueuedFiles(t *testing.T) {
+	s := newAPITestServer(t)
+	os.MkdirAll(filepath.Join(s.config.DataDir, "in"), 0755)
+	os.WriteFile(filepath.Join(s.config.DataDir, "in", "call.csv"), []byte("a,b"), 0644)
+	trigger := config.WatchTrigger{Name: "calls", Workflow: "missing", Dir: "in", Pattern: "*.csv"}
+	start := time.Now()
+	s.checkWatchTrigger(trigger, start)
+	s.checkWatchTrigger(trigger, start.Add(time.Minute))
+
+	files, err := loadWatchState(s.watchStatePath("calls"))
+	assert.NoError(t, err)
+	assert.Empty(t, files["call.csv"].RunID, "a file whose run wasn't queued waits for the next check")
+
+	assert.False(t, watchMatches(config.WatchTrigger{}, "notes.txt"))
+	assert.True(t, watchMatches(config.WatchTrigger{}, "Interview.MP3"))
+}
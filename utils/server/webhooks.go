@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/webhook"
+)
+
+// checkWebhooks checks that webhooks have usable URLs on allowed hosts and
+// subscribe to known events
+func (s *Server) checkWebhooks(hooks []processor.Webhook) error {
+	for _, hook := range hooks {
+		if err := webhook.CheckURL(hook.URL, s.config.Webhooks.AllowedHosts); err != nil {
+			return err
+		}
+		for _, event := range hook.Events {
+			if !webhook.ValidEvent(event) {
+				return fmt.Errorf("unknown webhook event '%s': use %s, %s or %s", event, webhook.EventCompleted, webhook.EventFailed, webhook.EventApprovalNeeded)
+			}
+		}
+	}
+	return nil
+}
+
+// notifyWebhooks tells the webhooks subscribed to a finished run's outcome
+// about it. Failed deliveries are retried, then logged.
+func (s *Server) notifyWebhooks(hooks []processor.Webhook, run history.Run, output string) {
+	payload := webhook.Payload{Event: webhook.EventCompleted, Run: &run, Output: output}
+	if run.Status == history.StatusFailed || run.Status == history.StatusCanceled {
+		payload.Event, payload.Output = webhook.EventFailed, ""
+	}
+	s.sendWebhooks(hooks, payload)
+}
+
+// sendWebhooks posts a payload to the webhooks subscribed to its event
+func (s *Server) sendWebhooks(hooks []processor.Webhook, payload webhook.Payload) {
+	payload.Time = time.Now()
+	sender := webhook.NewSender(s.config.Webhooks.Secret)
+	for _, hook := range hooks {
+		if !webhook.Wants(hook.Events, payload.Event) {
+			continue
+		}
+		if err := sender.Send(context.Background(), hook.URL, payload); err != nil {
+			logger.Printf("Webhook for run %s: %v", payload.Run.ID, err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/worker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/yaml.v3"
+)
+
+// leaseWait is how long a worker's lease request waits for a run before the
+// worker is told to ask again
+const leaseWait = 25 * time.Second
+
+// remoteCheckInterval is how often a leased run's worker is checked for
+// having stopped reporting
+const remoteCheckInterval = time.Second
+
+// workerPool hands runs of workflows with runs_on labels to the remote
+// workers that join the server, and takes their reports. It is shared with
+// workspaces.
+type workerPool struct {
+	timeout time.Duration // How long a worker may go without reporting
+
+	mu      sync.Mutex
+	waiting []*remoteRun          // Runs not leased yet, oldest first
+	leased  map[string]*remoteRun // Runs leased to workers, by run ID
+	ready   chan struct{}         // Closed when a run is added, for lease requests waiting for one
+}
+
+// newWorkerPool returns a pool of workers
+func newWorkerPool(c *config.RemoteWorkers) *workerPool {
+	return &workerPool{
+		timeout: c.ReportTimeout(),
+		leased:  make(map[string]*remoteRun),
+		ready:   make(chan struct{}),
+	}
+}
+
+// remoteRun is a run waiting for or leased to a worker
+type remoteRun struct {
+	lease    worker.Lease
+	labels   []string
+	job      *runJob
+	recorder processor.StepRecorder // Takes the steps the worker reports
+	ctx      context.Context        // Done when the worker should stop the run
+
+	worker string    // The worker it was leased to
+	seen   time.Time // When the worker last reported it
+	leased chan struct{}
+
+	done   chan struct{} // Closed once the worker reported the run's result
+	output string
+	err    error
+	files  []worker.File
+}
+
+// Lease hands a worker the oldest waiting run whose labels it all carries,
+// waiting up to leaseWait for one. The lease has no run when none came.
+func (p *workerPool) Lease(ctx context.Context, req *worker.LeaseRequest) (*worker.Lease, error) {
+	timer := time.NewTimer(leaseWait)
+	defer timer.Stop()
+	for {
+		p.mu.Lock()
+		for i, run := range p.waiting {
+			if !hasLabels(req.Labels, run.labels) {
+				continue
+			}
+			p.waiting = append(p.waiting[:i:i], p.waiting[i+1:]...)
+			run.worker, run.seen = req.Worker, time.Now()
+			p.leased[run.lease.RunID] = run
+			close(run.leased)
+			p.mu.Unlock()
+			lease := run.lease
+			return &lease, nil
+		}
+		ready := p.ready
+		p.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-timer.C:
+			return &worker.Lease{}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Report records what a worker reports about a run leased to it. The reply
+// tells the worker to stop the run when it was cancelled, or is no longer
+// leased to it.
+func (p *workerPool) Report(ctx context.Context, report *worker.Report) (*worker.ReportReply, error) {
+	p.mu.Lock()
+	run, ok := p.leased[report.RunID]
+	if !ok || run.worker != report.Worker {
+		p.mu.Unlock()
+		return &worker.ReportReply{Cancel: true}, nil
+	}
+	run.seen = time.Now()
+	if report.Done {
+		delete(p.leased, report.RunID)
+	}
+	p.mu.Unlock()
+
+	if report.Step != nil {
+		run.recorder.RecordStep(report.Step.Record())
+	}
+	if report.Progress != "" {
+		run.job.WriteProgress(processor.ProgressUpdate{Message: report.Progress})
+	}
+	if report.Done {
+		run.output, run.files = report.Output, report.Files
+		if report.Error != "" {
+			run.err = errors.New(report.Error)
+		}
+		close(run.done)
+		return &worker.ReportReply{}, nil
+	}
+	return &worker.ReportReply{Cancel: run.ctx.Err() != nil}, nil
+}
+
+// add offers a run to the workers
+func (p *workerPool) add(run *remoteRun) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waiting = append(p.waiting, run)
+	close(p.ready)
+	p.ready = make(chan struct{})
+}
+
+// withdraw takes back a run no worker leased yet, reporting false when one
+// already did
+func (p *workerPool) withdraw(run *remoteRun) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, waiting := range p.waiting {
+		if waiting == run {
+			p.waiting = append(p.waiting[:i:i], p.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// expire takes back a leased run whose worker stopped reporting it,
+// reporting whether it did
+func (p *workerPool) expire(run *remoteRun) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.leased[run.lease.RunID] != run || time.Since(run.seen) <= p.timeout {
+		return false
+	}
+	delete(p.leased, run.lease.RunID)
+	return true
+}
+
+// hasLabels reports whether labels include all of wanted
+func hasLabels(labels, wanted []string) bool {
+	have := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		have[label] = true
+	}
+	for _, label := range wanted {
+		if !have[label] {
+			return false
+		}
+	}
+	return true
+}
+
+// runRemote has a worker carrying the run's labels execute it, and returns
+// its final output once the worker reports it. The files the run's steps
+// wrote are copied into the runtime directory, as if they ran here. A run
+// no worker leased before the server started draining returns
+// processor.ErrInterrupted, so it is suspended; leased runs keep going.
+func (s *Server) runRemote(ctx context.Context, job *runJob, recorder processor.StepRecorder) (string, error) {
+	lease, err := s.remoteLease(job)
+	if err != nil {
+		return "", err
+	}
+	run := &remoteRun{
+		lease:    lease,
+		labels:   job.runsOn,
+		job:      job,
+		recorder: recorder,
+		ctx:      ctx,
+		leased:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	job.WriteProgress(processor.ProgressUpdate{Message: fmt.Sprintf("Waiting for a worker labelled %s", strings.Join(job.runsOn, ", "))})
+	s.workers.add(run)
+
+	ticker := time.NewTicker(remoteCheckInterval)
+	defer ticker.Stop()
+	cancelled, draining := ctx.Done(), s.runQueue().draining.Done()
+	leased := run.leased
+	for {
+		select {
+		case <-run.done:
+			if run.err != nil {
+				return "", run.err
+			}
+			s.writeRemoteFiles(job, run.files)
+			return run.output, nil
+		case <-leased:
+			leased = nil
+			config.VerboseLog("Run %s leased to worker %s", lease.RunID, run.worker)
+			job.WriteProgress(processor.ProgressUpdate{Message: fmt.Sprintf("Running on worker %s", run.worker)})
+		case <-cancelled:
+			cancelled = nil // A leased run stops when its worker next reports
+			if s.workers.withdraw(run) {
+				return "", ctx.Err()
+			}
+		case <-draining:
+			draining = nil
+			if s.workers.withdraw(run) {
+				return "", processor.ErrInterrupted
+			}
+		case <-ticker.C:
+			if s.workers.expire(run) {
+				return "", fmt.Errorf("worker %s stopped reporting the run for over %s", run.worker, s.workers.timeout)
+			}
+		}
+	}
+}
+
+// remoteLease describes a run to the worker that leases it, with the input
+// files its steps name under the runtime directory. Inputs given by
+// absolute paths are read on the worker.
+func (s *Server) remoteLease(job *runJob) (worker.Lease, error) {
+	lease := worker.Lease{
+		RunID:       job.recorder.ID(),
+		Workflow:    job.workflow,
+		Content:     string(job.content),
+		Input:       job.input,
+		RuntimeDir:  job.runtimeDir,
+		MaxChunks:   s.config.RunLimits.MaxChunks,
+		MaxTokens:   s.config.RunLimits.MaxTokens,
+		Credentials: job.req.Credentials,
+	}
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(job.content, &dslConfig); err != nil {
+		return lease, fmt.Errorf("error parsing workflow: %w", err)
+	}
+	dir := filepath.Join(s.config.DataDir, job.runtimeDir)
+	sent := make(map[string]bool)
+	var readErr error
+	eachStep(&dslConfig, func(step string, cfg *processor.StepConfig) {
+		for _, file := range s.inputFiles(job.proc, cfg.Input, job.runtimeDir) {
+			rel, err := filepath.Rel(dir, file.path)
+			if err != nil || filepath.IsAbs(file.name) || sent[rel] || readErr != nil {
+				continue
+			}
+			sent[rel] = true
+			content, err := os.ReadFile(file.path)
+			if err != nil {
+				readErr = fmt.Errorf("error reading input '%s' of step '%s': %w", file.name, step, err)
+				continue
+			}
+			lease.Files = append(lease.Files, worker.File{Path: filepath.ToSlash(rel), Content: content})
+		}
+	})
+	return lease, readErr
+}
+
+// writeRemoteFiles writes the files a worker's run wrote into the run's
+// runtime directory
+func (s *Server) writeRemoteFiles(job *runJob, files []worker.File) {
+	for _, file := range files {
+		path, err := s.validatePath(filepath.Join(job.runtimeDir, filepath.FromSlash(file.Path)))
+		if err == nil {
+			if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+				err = os.WriteFile(path, file.Content, 0644)
+			}
+		}
+		if err != nil {
+			s.logf("Error saving file %s of run %s: %v", file.Path, job.recorder.ID(), err)
+		}
+	}
+}
+
+// serveWorkers starts the gRPC service remote workers join, over TLS when
+// the server serves HTTPS. It returns a function that stops it.
+func (s *Server) serveWorkers(tlsConfig *tls.Config) (func(), error) {
+	c := s.config.RemoteWorkers
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", c.ListenPort()))
+	if err != nil {
+		return nil, fmt.Errorf("error listening for remote workers: %v", err)
+	}
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := worker.NewServer(s.workers, c.Token, opts...)
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			logger.Printf("Worker service stopped: %v", err)
+		}
+	}()
+	fmt.Printf("Remote workers join on port %d\n", c.ListenPort())
+	return server.Stop, nil
+}
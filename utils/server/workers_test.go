@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/worker"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const remoteWorkflow = `runs_on: [gpu]
+summarize:
+  input: notes.txt
+  model: gpt-4o
+  action: Summarize this
+  output: summaries/notes.md
+`
+
+// startTestWorker serves the server's worker pool and starts an agent
+// carrying labels that executes runs with the server's providers
+func startTestWorker(t *testing.T, s *Server, labels ...string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := worker.NewServer(s.workers, "secret")
+	go service.Serve(ln)
+	t.Cleanup(service.Stop)
+
+	client, err := worker.NewClient(ln.Addr().String(), "secret", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	agent := &worker.Agent{Client: client, Name: "gpu-box", Labels: labels, EnvConfig: s.envConfig, Dir: t.TempDir()}
+	go func() {
+		agent.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		service.Stop() // Ends the agent's lease request
+		<-stopped
+		client.Close()
+	})
+}
+
+func TestRunOnRemoteWorker(t *testing.T) {
+	s := newAPITestServer(t)
+	s.workers = newWorkerPool(&config.RemoteWorkers{Token: "secret"})
+	startTestWorker(t, s, "gpu", "ollama")
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "remote.yaml"), []byte(remoteWorkflow), 0644)
+	os.WriteFile(filepath.Join(s.config.DataDir, "notes.txt"), []byte("meeting notes"), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "remote", Wait: true})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp RunResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	assert.True(t, resp.Success, resp.Error)
+	if !assert.NotNil(t, resp.Run) {
+		return
+	}
+	assert.Equal(t, history.StatusSucceeded, resp.Run.Status)
+	if assert.Len(t, resp.Run.Steps, 1) {
+		assert.Equal(t, "summarize", resp.Run.Steps[0].Name)
+		assert.Equal(t, "gpt-4o", resp.Run.Steps[0].Model)
+	}
+
+	// The file the worker's step wrote is saved here, and kept as an artifact
+	data, err := os.ReadFile(filepath.Join(s.config.DataDir, "summaries", "notes.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Summarize this")
+	w = apiRequest(s.handleRun, http.MethodGet, "/runs/"+resp.Run.ID+"/artifacts/summaries/notes.md", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRunOnRemoteWorkerRefused(t *testing.T) {
+	s := newAPITestServer(t)
+	os.MkdirAll(s.workflowsDir(), 0755)
+	os.WriteFile(filepath.Join(s.workflowsDir(), "remote.yaml"), []byte(remoteWorkflow), 0644)
+
+	w := apiRequest(s.handleRuns, http.MethodPost, "/runs", RunRequest{Workflow: "remote"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "remoteWorkers")
+}
+
+func TestWorkerPoolLeasesByLabel(t *testing.T) {
+	pool := newWorkerPool(&config.RemoteWorkers{Token: "secret"})
+	run := &remoteRun{
+		lease:  worker.Lease{RunID: "r1"},
+		labels: []string{"gpu"},
+		ctx:    context.Background(),
+		leased: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	pool.add(run)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := pool.Lease(ctx, &worker.LeaseRequest{Worker: "cpu-box", Labels: []string{"cpu"}})
+	assert.Error(t, err, "a worker without the run's labels gets nothing")
+
+	lease, err := pool.Lease(context.Background(), &worker.LeaseRequest{Worker: "gpu-box", Labels: []string{"gpu", "ollama"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "r1", lease.RunID)
+	assert.False(t, pool.withdraw(run), "a leased run can't be withdrawn")
+
+	// Reports from another worker are told to stop
+	reply, _ := pool.Report(context.Background(), &worker.Report{Worker: "cpu-box", RunID: "r1"})
+	assert.True(t, reply.Cancel)
+
+	// A worker that stops reporting loses the run
+	pool.timeout = 0
+	assert.True(t, pool.expire(run))
+	reply, _ = pool.Report(context.Background(), &worker.Report{Worker: "gpu-box", RunID: "r1"})
+	assert.True(t, reply.Cancel)
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"gopkg.in/yaml.v3"
+)
+
+// workflowNamePattern matches the names workflows are stored under
+var workflowNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// workflowsDir returns the directory stored workflows are kept in
+func (s *Server) workflowsDir() string {
+	return filepath.Join(s.config.DataDir, "workflows")
+}
+
+// workflowPath returns the file a workflow is stored in. A .yaml or .yml
+// extension on the name is ignored.
+func (s *Server) workflowPath(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".yaml"), ".yml")
+	if !workflowNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid workflow name '%s': use letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(s.workflowsDir(), name+".yaml"), nil
+}
+
+// handleWorkflows serves /workflows: GET lists stored workflows and POST
+// creates one, or with dryRun=true only checks it
+func (s *Server) handleWorkflows(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListWorkflows(w, r)
+	case http.MethodPost:
+		var req WorkflowRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, http.StatusBadRequest, "Invalid request format")
+			return
+		}
+		if r.URL.Query().Get("dryRun") == "true" {
+			s.handleCheckWorkflow(w, req.Content)
+			return
+		}
+		if req.Name == "" {
+			sendJSONError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		s.saveWorkflow(w, req.Name, req.Content, false)
+	default:
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleWorkflow serves /workflows/{name}: GET returns the workflow, PUT
+// creates or replaces it and DELETE removes it
+func (s *Server) handleWorkflow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := strings.TrimPrefix(r.URL.Path, "/workflows/")
+	if name == "" || strings.Contains(name, "/") {
+		sendJSONError(w, http.StatusNotFound, "Invalid path")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetWorkflow(w, r, name)
+	case http.MethodPut:
+		var req WorkflowRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, http.StatusBadRequest, "Invalid request format")
+			return
+		}
+		s.saveWorkflow(w, name, req.Content, true)
+	case http.MethodDelete:
+		s.handleDeleteWorkflow(w, r, name)
+	default:
+		sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleListWorkflows returns every stored workflow, sorted by name
+func (s *Server) handleListWorkflows(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(s.workflowsDir())
+	if err != nil && !os.IsNotExist(err) {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error listing workflows: %v", err))
+		return
+	}
+
+	workflows := []WorkflowInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		workflows = append(workflows, WorkflowInfo{
+			Name:       strings.TrimSuffix(entry.Name(), ".yaml"),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+		})
+	}
+	sort.Slice(workflows, func(i, j int) bool { return workflows[i].Name < workflows[j].Name })
+
+	json.NewEncoder(w).Encode(WorkflowListResponse{Success: true, Workflows: workflows})
+}
+
+// handleGetWorkflow returns a stored workflow with its content
+func (s *Server) handleGetWorkflow(w http.ResponseWriter, r *http.Request, name string) {
+	path, err := s.workflowPath(name)
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	info, content, err := readWorkflow(path)
+	if os.IsNotExist(err) {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Workflow '%s' not found", name))
+		return
+	}
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error reading workflow: %v", err))
+		return
+	}
+	info.Content = string(content)
+
+	json.NewEncoder(w).Encode(WorkflowResponse{Success: true, Workflow: info})
+}
+
+// saveWorkflow validates and stores a workflow. With replace set an existing
+// workflow is overwritten; otherwise it is a conflict.
+func (s *Server) saveWorkflow(w http.ResponseWriter, name, content string, replace bool) {
+	path, err := s.workflowPath(name)
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(content) == "" {
+		sendJSONError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	if issues := s.checkWorkflow([]byte(content)); len(issues) > 0 {
+		sendWorkflowIssues(w, issues)
+		return
+	}
+
+	_, statErr := os.Stat(path)
+	exists := statErr == nil
+	if exists && !replace {
+		stored := strings.TrimSuffix(filepath.Base(path), ".yaml")
+		sendJSONError(w, http.StatusConflict, fmt.Sprintf("Workflow '%s' already exists; use PUT /workflows/%s to replace it", stored, stored))
+		return
+	}
+
+	if err := os.MkdirAll(s.workflowsDir(), 0755); err != nil {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error creating workflows directory: %v", err))
+		return
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error saving workflow: %v", err))
+		return
+	}
+	config.VerboseLog("Saved workflow %s", path)
+
+	info, _, err := readWorkflow(path)
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error reading workflow: %v", err))
+		return
+	}
+	status, message := http.StatusCreated, "Workflow created"
+	if exists {
+		status, message = http.StatusOK, "Workflow updated"
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(WorkflowResponse{Success: true, Message: message, Workflow: info})
+}
+
+// handleCheckWorkflow checks a workflow without storing it
+func (s *Server) handleCheckWorkflow(w http.ResponseWriter, content string) {
+	if strings.TrimSpace(content) == "" {
+		sendJSONError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	if issues := s.checkWorkflow([]byte(content)); len(issues) > 0 {
+		sendWorkflowIssues(w, issues)
+		return
+	}
+	json.NewEncoder(w).Encode(WorkflowResponse{Success: true, Message: "Workflow is valid"})
+}
+
+// sendWorkflowIssues refuses a workflow with the problems found in it
+func sendWorkflowIssues(w http.ResponseWriter, issues []processor.ValidationIssue) {
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(WorkflowResponse{
+		Success: false,
+		Error:   fmt.Sprintf("Workflow has %d problem(s)", len(issues)),
+		Issues:  issues,
+	})
+}
+
+// checkWorkflow parses a workflow and checks its structure, as validate
+// does. API keys and input files are not checked since they may be supplied
+// when the workflow runs.
+func (s *Server) checkWorkflow(content []byte) []processor.ValidationIssue {
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(content, &dslConfig); err != nil {
+		return []processor.ValidationIssue{{Message: fmt.Sprintf("invalid YAML: %v", err)}}
+	}
+	issues, err := processor.CheckStepFields(content)
+	if err != nil {
+		return []processor.ValidationIssue{{Message: fmt.Sprintf("invalid YAML: %v", err)}}
+	}
+	if err := s.checkWebhooks(dslConfig.Webhooks); err != nil {
+		issues = append(issues, processor.ValidationIssue{Message: err.Error()})
+	}
+	proc := processor.NewProcessor(&dslConfig, s.env(), s.config, false)
+	return append(issues, proc.ValidateStructure()...)
+}
+
+// handleDeleteWorkflow removes a stored workflow. Its past runs are kept.
+func (s *Server) handleDeleteWorkflow(w http.ResponseWriter, r *http.Request, name string) {
+	path, err := s.workflowPath(name)
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := os.Remove(path); os.IsNotExist(err) {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Workflow '%s' not found", name))
+		return
+	} else if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error deleting workflow: %v", err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(SuccessResponse{Success: true, Message: "Workflow deleted"})
+}
+
+// readWorkflow returns a stored workflow's metadata and content
+func readWorkflow(path string) (*WorkflowInfo, []byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &WorkflowInfo{
+		Name:       strings.TrimSuffix(filepath.Base(path), ".yaml"),
+		Size:       stat.Size(),
+		ModifiedAt: stat.ModTime(),
+	}, content, nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAPITestServer returns a server with a temporary data directory and the
+// mock gpt-4o model configured
+func newAPITestServer(t *testing.T) *Server {
+	t.Helper()
+	return &Server{
+		config: &config.ServerConfig{DataDir: t.TempDir()},
+		envConfig: &config.EnvConfig{
+			Providers: map[string]*config.Provider{
+				"openai": {
+					APIKey: "test-key",
+					Models: []config.Model{{Name: "gpt-4o", Type: "external", Modes: []config.ModelMode{config.TextMode}}},
+				},
+			},
+		},
+	}
+}
+
+// apiRequest sends a request to a handler and returns the recorded response
+func apiRequest(handler http.HandlerFunc, method, target string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(method, target, &buf))
+	return w
+}
+
+const testWorkflow = `summarize:
+  input: STDIN
+  model: gpt-4o
+  action: Summarize this
+  output: STDOUT
+`
+
+func TestWorkflowCRUD(t *testing.T) {
+	s := newAPITestServer(t)
+
+	w := apiRequest(s.handleWorkflows, http.MethodPost, "/workflows", WorkflowRequest{Name: "summary", Content: testWorkflow})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.FileExists(t, filepath.Join(s.config.DataDir, "workflows", "summary.yaml"))
+
+	w = apiRequest(s.handleWorkflows, http.MethodPost, "/workflows", WorkflowRequest{Name: "summary", Content: testWorkflow})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = apiRequest(s.handleWorkflows, http.MethodGet, "/workflows", nil)
+	var list WorkflowListResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if assert.Len(t, list.Workflows, 1) {
+		assert.Equal(t, "summary", list.Workflows[0].Name)
+		assert.Empty(t, list.Workflows[0].Content)
+	}
+
+	w = apiRequest(s.handleWorkflow, http.MethodGet, "/workflows/summary.yaml", nil)
+	var got WorkflowResponse
+	json.NewDecoder(w.Body).Decode(&got)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testWorkflow, got.Workflow.Content)
+
+	w = apiRequest(s.handleWorkflow, http.MethodPut, "/workflows/summary", WorkflowRequest{Content: testWorkflow + "\n"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = apiRequest(s.handleWorkflow, http.MethodDelete, "/workflows/summary", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = apiRequest(s.handleWorkflow, http.MethodGet, "/workflows/summary", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSaveWorkflowRejectsInvalid(t *testing.T) {
+	s := newAPITestServer(t)
+
+	tests := []struct {
+		name    string
+		request WorkflowRequest
+		status  int
+	}{
+		{"bad name", WorkflowRequest{Name: "../escape", Content: testWorkflow}, http.StatusBadRequest},
+		{"no content", WorkflowRequest{Name: "empty"}, http.StatusBadRequest},
+		{"bad yaml", WorkflowRequest{Name: "broken", Content: "step: [unclosed"}, http.StatusUnprocessableEntity},
+		{"unknown field", WorkflowRequest{Name: "typo", Content: testWorkflow + "  outptu: x\n"}, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiRequest(s.handleWorkflows, http.MethodPost, "/workflows", tt.request)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+
+	entries, _ := os.ReadDir(s.workflowsDir())
+	assert.Empty(t, entries)
+}
+
+func TestCheckWorkflowDryRun(t *testing.T) {
+	s := newAPITestServer(t)
+
+	w := apiRequest(s.handleWorkflows, http.MethodPost, "/workflows?dryRun=true", WorkflowRequest{Content: testWorkflow})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Workflow is valid")
+
+	w = apiRequest(s.handleWorkflows, http.MethodPost, "/workflows?dryRun=true", WorkflowRequest{Content: testWorkflow + "  outptu: x\n"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var got WorkflowResponse
+	json.NewDecoder(w.Body).Decode(&got)
+	assert.NotEmpty(t, got.Issues)
+
+	// Nothing is stored, even with a name
+	apiRequest(s.handleWorkflows, http.MethodPost, "/workflows?dryRun=true", WorkflowRequest{Name: "summary", Content: testWorkflow})
+	entries, _ := os.ReadDir(s.workflowsDir())
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+)
+
+// workspaceHeader lets callers that are not confined to a workspace choose one
+const workspaceHeader = "X-Comanda-Workspace"
+
+// ServeHTTP sends each request to the server of its workspace, or serves it
+// from the shared data directory when it has none
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := s.requestWorkspace(r)
+	if err != nil {
+		s.handleCORS(w, r)
+		sendJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if name == "" {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+	ws, err := s.workspaceServer(name)
+	if err != nil {
+		s.handleCORS(w, r)
+		sendJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if changesSharedSettings(r) {
+		s.handleCORS(w, r)
+		sendJSONError(w, http.StatusForbidden, "Provider and environment settings are shared by all workspaces and cannot be changed from one")
+		return
+	}
+	ws.mux.ServeHTTP(w, r)
+}
+
+// changesSharedSettings reports whether a request changes settings kept in
+// the shared env file
+func changesSharedSettings(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/env/") {
+		return true
+	}
+	if !strings.HasPrefix(r.URL.Path, "/providers") || r.URL.Path == "/providers/validate" {
+		return false
+	}
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+}
+
+// requestWorkspace returns the workspace a request belongs to. Callers
+// confined to a workspace always use theirs; others may pick one with the
+// X-Comanda-Workspace header. Invalid credentials are left for the auth
+// checks of the server the request is sent to.
+func (s *Server) requestWorkspace(r *http.Request) (string, error) {
+	requested := r.Header.Get(workspaceHeader)
+	if !s.config.AuthRequired() {
+		return requested, nil
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return requested, nil
+	}
+	caller, err := authenticate(s.config, token)
+	if err != nil || caller.workspace == "" {
+		return requested, nil
+	}
+	if requested != "" && requested != caller.workspace {
+		return "", fmt.Errorf("%s belongs to workspace '%s'", caller.name, caller.workspace)
+	}
+	return caller.workspace, nil
+}
+
+// workspaceServer returns the server of the named workspace, setting it up on
+// first use. It shares this server's auth settings, but has its own data
+// directory, run history, run queue and provider credentials.
+func (s *Server) workspaceServer(name string) (*Server, error) {
+	s.workspacesMu.Lock()
+	defer s.workspacesMu.Unlock()
+	if ws, ok := s.workspaces[name]; ok {
+		return ws, nil
+	}
+
+	wsConfig := s.config.FindWorkspace(name)
+	if wsConfig == nil {
+		return nil, fmt.Errorf("workspace '%s' does not exist", name)
+	}
+	serverConfig := s.config.ForWorkspace(wsConfig)
+	if err := os.MkdirAll(serverConfig.DataDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating data directory of workspace '%s': %v", name, err)
+	}
+	ws := &Server{
+		mux:       http.NewServeMux(),
+		config:    serverConfig,
+		envConfig: s.env().ForWorkspace(serverConfig, wsConfig),
+		workspace: wsConfig,
+		audit:     s.audit,
+		workers:   s.workers,
+		gc:        s.gc,
+		oidc:      s.oidc,
+	}
+	ws.routes()
+	if s.workspaces == nil {
+		s.workspaces = make(map[string]*Server)
+	}
+	s.workspaces[name] = ws
+	return ws, nil
+}
+
+// checkRunQuota returns an error when the workspace has started as many runs
+// today as it may
+func (s *Server) checkRunQuota(store *history.Store) error {
+	if s.workspace == nil || s.workspace.RunsPerDay <= 0 {
+		return nil
+	}
+	runs, err := store.List()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	started := 0
+	for _, run := range runs { // Most recent first
+		if run.Started.Before(today) {
+			break
+		}
+		started++
+	}
+	if started >= s.workspace.RunsPerDay {
+		return fmt.Errorf("workspace '%s' has started its %d runs for today", s.workspace.Name, s.workspace.RunsPerDay)
+	}
+	return nil
+}
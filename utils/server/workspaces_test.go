@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newWorkspaceTestServer returns a server with workspaces alpha and beta and
+// a key for each, plus an operator key that is not confined to either
+func newWorkspaceTestServer(t *testing.T) *Server {
+	t.Helper()
+	envConfig := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {
+				APIKey: "shared-key",
+				Models: []config.Model{{Name: "gpt-4o", Type: "external", Modes: []config.ModelMode{config.TextMode}}},
+			},
+		},
+		Server: &config.ServerConfig{
+			DataDir: t.TempDir(),
+			APIKeys: []config.APIKey{
+				{Name: "ops", Key: "ops-key", Scope: config.ScopeAdmin},
+				{Name: "alpha-ci", Key: "alpha-key", Scope: config.ScopeAdmin, Workspace: "alpha"},
+				{Name: "beta-ci", Key: "beta-key", Scope: config.ScopeAdmin, Workspace: "beta"},
+			},
+			Workspaces: []config.Workspace{
+				{Name: "alpha", RunsPerDay: 1, Providers: map[string]*config.Provider{"openai": {APIKey: "alpha-openai"}}},
+				{Name: "beta"},
+			},
+		},
+	}
+	s := &Server{mux: http.NewServeMux(), config: envConfig.Server, envConfig: envConfig}
+	s.routes()
+	return s
+}
+
+// workspaceRequest sends a request through the server's workspace routing
+func workspaceRequest(s *Server, method, target, token, workspace string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	r := httptest.NewRequest(method, target, &buf)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if workspace != "" {
+		r.Header.Set(workspaceHeader, workspace)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	s := newWorkspaceTestServer(t)
+
+	w := workspaceRequest(s, http.MethodPost, "/workflows", "alpha-key", "", WorkflowRequest{Name: "summary", Content: testWorkflow})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.FileExists(t, filepath.Join(s.config.DataDir, "workspaces", "alpha", "workflows", "summary.yaml"))
+
+	listed := func(token, workspace string) []WorkflowInfo {
+		w := workspaceRequest(s, http.MethodGet, "/workflows", token, workspace, nil)
+		var resp WorkflowListResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.Workflows
+	}
+	assert.Len(t, listed("alpha-key", ""), 1)
+	assert.Empty(t, listed("beta-key", ""))
+	assert.Empty(t, listed("ops-key", ""))
+	assert.Len(t, listed("ops-key", "alpha"), 1)
+
+	// Confined keys cannot pick another workspace
+	w = workspaceRequest(s, http.MethodGet, "/workflows", "beta-key", "alpha", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = workspaceRequest(s, http.MethodGet, "/workflows", "ops-key", "gamma", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Invalid credentials are still refused inside a workspace
+	w = workspaceRequest(s, http.MethodGet, "/workflows", "wrong", "alpha", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Shared settings cannot be changed from a workspace
+	w = workspaceRequest(s, http.MethodPost, "/env/encrypt", "alpha-key", "", map[string]string{"password": "x"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestWorkspaceRunsAndQuota(t *testing.T) {
+	s := newWorkspaceTestServer(t)
+	dir := filepath.Join(s.config.DataDir, "workspaces", "alpha", "workflows")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "summary.yaml"), []byte(testWorkflow), 0644)
+
+	w := workspaceRequest(s, http.MethodPost, "/runs", "alpha-key", "", RunRequest{Workflow: "summary", Input: "text", Wait: true})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp RunResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if assert.NotNil(t, resp.Run) {
+		// The run is only visible inside its workspace
+		w = workspaceRequest(s, http.MethodGet, "/runs/"+resp.Run.ID, "beta-key", "", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = workspaceRequest(s, http.MethodGet, "/runs/"+resp.Run.ID, "alpha-key", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w = workspaceRequest(s, http.MethodPost, "/runs", "alpha-key", "", RunRequest{Workflow: "summary", Input: "text"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "runs for today")
+
+	alpha, err := s.workspaceServer("alpha")
+	assert.NoError(t, err)
+	provider, err := alpha.envConfig.GetProviderConfig("openai")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alpha-openai", provider.APIKey)
+		assert.Len(t, provider.Models, 1, "models are shared when the workspace only sets credentials")
+	}
+	assert.Equal(t, "shared-key", s.envConfig.Providers["openai"].APIKey)
+}
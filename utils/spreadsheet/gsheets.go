@@ -0,0 +1,238 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/httpclient"
+)
+
+// sheetsAPI is the Google Sheets API; tests point it at a fake server
+var sheetsAPI = "https://sheets.googleapis.com/v4/spreadsheets"
+
+var (
+	spreadsheetIDPath  = regexp.MustCompile(`/spreadsheets/d/([A-Za-z0-9_-]+)`)
+	spreadsheetIDValue = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// SpreadsheetID returns the ID of a Google Sheet from its URL, such as
+// https://docs.google.com/spreadsheets/d/<id>/edit, or the ID itself
+func SpreadsheetID(ref string) (string, error) {
+	if spreadsheetIDValue.MatchString(ref) {
+		return ref, nil
+	}
+	if m := spreadsheetIDPath.FindStringSubmatch(ref); m != nil {
+		return m[1], nil
+	}
+	return "", fmt.Errorf("%q is not a Google Sheets URL or spreadsheet ID", ref)
+}
+
+// sheets calls the Google Sheets API for one spreadsheet
+type sheets struct {
+	token string
+	id    string
+}
+
+func (s sheets) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, sheetsAPI+"/"+url.PathEscape(s.id)+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := httpclient.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			msg = apiErr.Error.Message
+		}
+		return fmt.Errorf("Google Sheets API error (status %d): %s", resp.StatusCode, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// sheetID returns the ID of the sheet titled title, adding the sheet when
+// the spreadsheet has none
+func (s sheets) sheetID(ctx context.Context, title string) (int64, error) {
+	var meta struct {
+		Sheets []struct {
+			Properties struct {
+				SheetID int64  `json:"sheetId"`
+				Title   string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	if err := s.do(ctx, http.MethodGet, "?fields=sheets.properties(sheetId,title)", nil, &meta); err != nil {
+		return 0, err
+	}
+	for _, sheet := range meta.Sheets {
+		if sheet.Properties.Title == title {
+			return sheet.Properties.SheetID, nil
+		}
+	}
+	var added struct {
+		Replies []struct {
+			AddSheet struct {
+				Properties struct {
+					SheetID int64 `json:"sheetId"`
+				} `json:"properties"`
+			} `json:"addSheet"`
+		} `json:"replies"`
+	}
+	request := map[string]interface{}{"addSheet": map[string]interface{}{"properties": map[string]string{"title": title}}}
+	if err := s.do(ctx, http.MethodPost, ":batchUpdate", map[string]interface{}{"requests": []interface{}{request}}, &added); err != nil {
+		return 0, fmt.Errorf("error adding sheet %s: %w", title, err)
+	}
+	if len(added.Replies) == 0 {
+		return 0, fmt.Errorf("error adding sheet %s: no reply", title)
+	}
+	return added.Replies[0].AddSheet.Properties.SheetID, nil
+}
+
+// header returns the first row of a sheet
+func (s sheets) header(ctx context.Context, title string) ([]string, error) {
+	var values struct {
+		Values [][]interface{} `json:"values"`
+	}
+	cellRange := "'" + strings.ReplaceAll(title, "'", "''") + "'!1:1"
+	if err := s.do(ctx, http.MethodGet, "/values/"+url.PathEscape(cellRange), nil, &values); err != nil {
+		return nil, err
+	}
+	var header []string
+	if len(values.Values) > 0 {
+		for _, v := range values.Values[0] {
+			header = append(header, strings.TrimSpace(fmt.Sprint(v)))
+		}
+	}
+	return header, nil
+}
+
+// Append adds the table's rows below the last row of a sheet of a Google
+// Sheet, adding the sheet if it is missing. A sheet without a header row
+// gets the table's column names in bold first; one with a header gets the
+// values under the columns of the same names. Values are written typed,
+// never as formulas. Column types must be set, see InferTypes.
+func Append(ctx context.Context, token, spreadsheetID, sheet string, t Table) error {
+	s := sheets{token: token, id: spreadsheetID}
+	sheet = SheetName(sheet)
+	id, err := s.sheetID(ctx, sheet)
+	if err != nil {
+		return err
+	}
+	header, err := s.header(ctx, sheet)
+	if err != nil {
+		return err
+	}
+
+	// order[i] is the table column written in the sheet's column i
+	var rows []interface{}
+	order := make([]int, len(t.Columns))
+	if len(header) == 0 {
+		var cells []interface{}
+		for i, col := range t.Columns {
+			order[i] = i
+			cells = append(cells, map[string]interface{}{
+				"userEnteredValue":  map[string]string{"stringValue": col.Name},
+				"userEnteredFormat": map[string]interface{}{"textFormat": map[string]bool{"bold": true}},
+			})
+		}
+		rows = append(rows, map[string]interface{}{"values": cells})
+	} else {
+		position := make(map[string]int, len(header))
+		for i, name := range header {
+			position[name] = i
+		}
+		order = make([]int, len(header))
+		for i := range order {
+			order[i] = -1
+		}
+		for i, col := range t.Columns {
+			j, ok := position[col.Name]
+			if !ok {
+				return fmt.Errorf("column %s is not in the header of sheet %s", col.Name, sheet)
+			}
+			order[j] = i
+		}
+	}
+
+	for r, row := range t.Rows {
+		cells, err := t.Cells(row)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", r+1, err)
+		}
+		values := make([]interface{}, len(order))
+		for i, col := range order {
+			values[i] = map[string]interface{}{}
+			if col >= 0 {
+				values[i] = cellData(cells[col])
+			}
+		}
+		rows = append(rows, map[string]interface{}{"values": values})
+	}
+
+	request := map[string]interface{}{"appendCells": map[string]interface{}{
+		"sheetId": id,
+		"rows":    rows,
+		"fields":  "userEnteredValue,userEnteredFormat(numberFormat,textFormat)",
+	}}
+	if err := s.do(ctx, http.MethodPost, ":batchUpdate", map[string]interface{}{"requests": []interface{}{request}}, nil); err != nil {
+		return fmt.Errorf("error appending to sheet %s: %w", sheet, err)
+	}
+	return nil
+}
+
+// cellData returns a cell as the API's CellData
+func cellData(cell Cell) map[string]interface{} {
+	if cell.Empty {
+		return map[string]interface{}{}
+	}
+	format := func(typ, pattern string) map[string]interface{} {
+		return map[string]interface{}{"numberFormat": map[string]string{"type": typ, "pattern": pattern}}
+	}
+	switch cell.Type {
+	case TypeInteger:
+		return map[string]interface{}{"userEnteredValue": map[string]float64{"numberValue": cell.Number}, "userEnteredFormat": format("NUMBER", "0")}
+	case TypeNumber:
+		return map[string]interface{}{"userEnteredValue": map[string]float64{"numberValue": cell.Number}}
+	case TypeBoolean:
+		return map[string]interface{}{"userEnteredValue": map[string]bool{"boolValue": cell.Bool}}
+	case TypeDate:
+		return map[string]interface{}{"userEnteredValue": map[string]float64{"numberValue": serial(cell.Time)}, "userEnteredFormat": format("DATE", "yyyy-mm-dd")}
+	case TypeDateTime:
+		return map[string]interface{}{"userEnteredValue": map[string]float64{"numberValue": serial(cell.Time)}, "userEnteredFormat": format("DATE_TIME", "yyyy-mm-dd hh:mm:ss")}
+	}
+	return map[string]interface{}{"userEnteredValue": map[string]string{"stringValue": cell.String}}
+}
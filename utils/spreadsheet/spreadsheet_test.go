@@ -0,0 +1,194 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInferTypes(t *testing.T) {
+	table := Table{
+		Columns: []Column{{Name: "id"}, {Name: "amount"}, {Name: "active"}, {Name: "signed_up"}, {Name: "zip"}, {Name: "seen"}, {Name: "note", Type: TypeString}},
+		Rows: [][]interface{}{
+			{float64(1), "10", true, "2025-06-01", "02134", "2025-06-01", "42"},
+			{float64(2), "10.5", false, "", "94105", "2025-06-01T10:00:00Z", "x"},
+		},
+	}
+	table.InferTypes()
+	want := []string{TypeInteger, TypeNumber, TypeBoolean, TypeDate, TypeString, TypeDateTime, TypeString}
+	for i, col := range table.Columns {
+		if col.Type != want[i] {
+			t.Errorf("column %s type = %s, want %s", col.Name, col.Type, want[i])
+		}
+	}
+	if _, err := table.Cells([]interface{}{"one"}); err == nil {
+		t.Error("Cells() accepted text in an integer column")
+	}
+}
+
+func TestSerial(t *testing.T) {
+	if got := serial(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)); got != 45658.5 {
+		t.Errorf("serial() = %v, want 45658.5", got)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	table := Table{
+		Columns: []Column{{Name: "name"}, {Name: "deals"}, {Name: "closed"}},
+		Rows:    [][]interface{}{{"Acme & Co", float64(3), "2025-06-01"}, {"Globex", nil, "2025-06-02"}},
+	}
+	table.InferTypes()
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, "Q2: deals", table); err != nil {
+		t.Fatalf("WriteXLSX() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/styles.xml"} {
+		if files[name] == "" {
+			t.Errorf("missing %s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="Q2 deals"`) {
+		t.Errorf("workbook.xml = %s, want the sheet name without the colon", files["xl/workbook.xml"])
+	}
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`,
+		`<t xml:space="preserve">Acme &amp; Co</t>`,
+		`<c r="B2" s="2"><v>3</v></c>`,
+		`<c r="C2" s="3"><v>45809</v></c>`,
+		`<row r="3"><c r="A3" t="inlineStr">`,
+		`state="frozen"`,
+		`<autoFilter ref="A1:C3"/>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet1.xml doesn't contain %s:\n%s", want, sheet)
+		}
+	}
+	if strings.Contains(sheet, `r="B3"`) {
+		t.Error("empty cell written")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
+
+// fakeSheets serves one spreadsheet with a sheet Leads, whose header is
+// header
+type fakeSheets struct {
+	header   []string
+	added    string
+	appended []interface{}
+}
+
+func (f *fakeSheets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer tok" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"message":"Request had invalid authentication credentials."}}`)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/sheet1":
+		fmt.Fprint(w, `{"sheets":[{"properties":{"sheetId":7,"title":"Leads"}}]}`)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/sheet1/values/"):
+		values := [][]string{}
+		if f.header != nil {
+			values = append(values, f.header)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"values": values})
+	case r.URL.Path == "/sheet1:batchUpdate":
+		var body struct {
+			Requests []map[string]map[string]interface{} `json:"requests"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if add, ok := body.Requests[0]["addSheet"]; ok {
+			f.added = add["properties"].(map[string]interface{})["title"].(string)
+			fmt.Fprint(w, `{"replies":[{"addSheet":{"properties":{"sheetId":9}}}]}`)
+			return
+		}
+		f.appended = body.Requests[0]["appendCells"]["rows"].([]interface{})
+		fmt.Fprint(w, `{}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func cellJSON(row interface{}) string {
+	data, _ := json.Marshal(row.(map[string]interface{})["values"])
+	return string(data)
+}
+
+func TestAppend(t *testing.T) {
+	f := &fakeSheets{header: []string{"email", "score", "source"}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	previous := sheetsAPI
+	sheetsAPI = srv.URL
+	defer func() { sheetsAPI = previous }()
+
+	table := Table{
+		Columns: []Column{{Name: "score"}, {Name: "email"}},
+		Rows:    [][]interface{}{{float64(87), "=HYPERLINK(\"x\")"}},
+	}
+	table.InferTypes()
+	if err := Append(context.Background(), "tok", "sheet1", "Leads", table); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if len(f.appended) != 1 {
+		t.Fatalf("appended %d rows, want 1 with the existing header kept", len(f.appended))
+	}
+	got := cellJSON(f.appended[0])
+	want := `[{"userEnteredValue":{"stringValue":"=HYPERLINK(\"x\")"}},{"userEnteredFormat":{"numberFormat":{"pattern":"0","type":"NUMBER"}},"userEnteredValue":{"numberValue":87}},{}]`
+	if got != want {
+		t.Errorf("appended %s\nwant %s", got, want)
+	}
+
+	f.header = nil
+	if err := Append(context.Background(), "tok", "sheet1", "Scores", table); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if f.added != "Scores" || len(f.appended) != 2 || !strings.Contains(cellJSON(f.appended[0]), `"bold":true`) {
+		t.Errorf("added %q and appended %v, want a new sheet with a bold header", f.added, f.appended)
+	}
+
+	table.Columns[0].Name = "rank"
+	f.header = []string{"email", "score"}
+	if err := Append(context.Background(), "tok", "sheet1", "Leads", table); err == nil || !strings.Contains(err.Error(), "rank is not in the header") {
+		t.Errorf("Append() error = %v, want the unknown column", err)
+	}
+	if err := Append(context.Background(), "bad", "sheet1", "Leads", table); err == nil || !strings.Contains(err.Error(), "invalid authentication") {
+		t.Errorf("Append() error = %v, want the API's message", err)
+	}
+}
+
+func TestSpreadsheetID(t *testing.T) {
+	if id, err := SpreadsheetID("https://docs.google.com/spreadsheets/d/1AbC_d-9/edit#gid=0"); err != nil || id != "1AbC_d-9" {
+		t.Errorf("SpreadsheetID() = %q, %v", id, err)
+	}
+	if _, err := SpreadsheetID("https://example.com/x"); err == nil {
+		t.Error("SpreadsheetID accepted a URL that isn't a spreadsheet's")
+	}
+}
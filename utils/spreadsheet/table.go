@@ -0,0 +1,237 @@
+// Package spreadsheet writes tables to XLSX files and appends them to
+// Google Sheets, with each column typed so numbers, dates and booleans are
+// stored as such rather than as text.
+package spreadsheet
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types
+const (
+	TypeString   = "string"
+	TypeInteger  = "integer"
+	TypeNumber   = "number"
+	TypeBoolean  = "boolean"
+	TypeDate     = "date"
+	TypeDateTime = "datetime"
+)
+
+// Types lists the column types
+var Types = []string{TypeString, TypeInteger, TypeNumber, TypeBoolean, TypeDate, TypeDateTime}
+
+// Column is a column of a table
+type Column struct {
+	Name string
+	Type string // One of Types; inferred from the values when empty
+}
+
+// Table is rows of values under named columns. Values are strings, as
+// read from CSV, or the float64s, bools and strings JSON decodes to; nil
+// is an empty cell.
+type Table struct {
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// Cell is a typed value ready to be written
+type Cell struct {
+	Type   string
+	String string    // TypeString
+	Number float64   // TypeInteger and TypeNumber
+	Bool   bool      // TypeBoolean
+	Time   time.Time // TypeDate and TypeDateTime
+	Empty  bool
+}
+
+// dateLayouts are the layouts date and datetime values are read in
+var (
+	dateLayouts     = []string{"2006-01-02", "2006/01/02"}
+	dateTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+)
+
+func parseTime(s string, layouts []string) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// detect returns the narrowest type a non-empty value fits
+func detect(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return TypeInteger
+		}
+		return TypeNumber
+	case bool:
+		return TypeBoolean
+	case string:
+		s := strings.TrimSpace(v)
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil && !leadingZero(s) {
+			return TypeInteger
+		}
+		if _, err := strconv.ParseFloat(s, 64); err == nil && !leadingZero(s) {
+			return TypeNumber
+		}
+		if s == "true" || s == "false" || s == "TRUE" || s == "FALSE" {
+			return TypeBoolean
+		}
+		if _, ok := parseTime(s, dateLayouts); ok {
+			return TypeDate
+		}
+		if _, ok := parseTime(s, dateTimeLayouts); ok {
+			return TypeDateTime
+		}
+	}
+	return TypeString
+}
+
+// leadingZero reports values such as 007 or 0123, which are identifiers
+// and postcodes rather than numbers
+func leadingZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0' && s[1] != '.'
+}
+
+// widen returns the type holding values of both types
+func widen(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case (a == TypeInteger && b == TypeNumber) || (a == TypeNumber && b == TypeInteger):
+		return TypeNumber
+	case (a == TypeDate && b == TypeDateTime) || (a == TypeDateTime && b == TypeDate):
+		return TypeDateTime
+	}
+	return TypeString
+}
+
+// InferTypes sets the type of each column without one to the narrowest
+// type all its values fit, string when it has none
+func (t *Table) InferTypes() {
+	for i := range t.Columns {
+		if t.Columns[i].Type != "" {
+			continue
+		}
+		typ := ""
+		for _, row := range t.Rows {
+			if i >= len(row) || isEmpty(row[i]) {
+				continue
+			}
+			typ = widen(typ, detect(row[i]))
+		}
+		if typ == "" {
+			typ = TypeString
+		}
+		t.Columns[i].Type = typ
+	}
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	s, ok := value.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// Cells converts a row to typed cells, by its columns' types
+func (t *Table) Cells(row []interface{}) ([]Cell, error) {
+	cells := make([]Cell, len(t.Columns))
+	for i, col := range t.Columns {
+		var value interface{}
+		if i < len(row) {
+			value = row[i]
+		}
+		cell, err := convert(value, col.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		cells[i] = cell
+	}
+	return cells, nil
+}
+
+// convert reads a value as a cell of a type
+func convert(value interface{}, typ string) (Cell, error) {
+	if isEmpty(value) {
+		return Cell{Type: typ, Empty: true}, nil
+	}
+	cell := Cell{Type: typ}
+	var s string
+	switch v := value.(type) {
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		s = strings.TrimSpace(v)
+	case map[string]interface{}, []interface{}:
+		return cell, fmt.Errorf("nested value %v can't be a cell", value)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	var ok bool
+	switch typ {
+	case TypeInteger, TypeNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return cell, fmt.Errorf("expected %s, got %q", typ, s)
+		}
+		cell.Number = n
+		return cell, nil
+	case TypeBoolean:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return cell, fmt.Errorf("expected boolean, got %q", s)
+		}
+		cell.Bool = b
+		return cell, nil
+	case TypeDate:
+		if cell.Time, ok = parseTime(s, dateLayouts); !ok {
+			if cell.Time, ok = parseTime(s, dateTimeLayouts); !ok {
+				return cell, fmt.Errorf("expected date, got %q", s)
+			}
+		}
+		return cell, nil
+	case TypeDateTime:
+		if cell.Time, ok = parseTime(s, dateTimeLayouts); !ok {
+			if cell.Time, ok = parseTime(s, dateLayouts); !ok {
+				return cell, fmt.Errorf("expected date and time, got %q", s)
+			}
+		}
+		return cell, nil
+	}
+	cell.Type = TypeString
+	cell.String = s
+	return cell, nil
+}
+
+// serialEpoch is day 0 of spreadsheet date serials, in both Excel's 1900
+// date system and Google Sheets
+var serialEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// serial returns a time as a spreadsheet date serial: days since the epoch,
+// with the time of day as the fraction. Times keep their wall clock, as
+// spreadsheets have no time zones.
+func serial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Sub(serialEpoch).Hours() / 24
+}
+
+// ValidType reports whether typ is a column type
+func ValidType(typ string) bool {
+	for _, t := range Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Styles of the workbook's cells, indexes into its cellXfs
+const (
+	styleDefault = iota
+	styleHeader
+	styleInteger
+	styleDate
+	styleDateTime
+)
+
+// maxColumnWidth caps the width of a column, in characters
+const maxColumnWidth = 60
+
+// invalidSheetChars are the characters Excel doesn't allow in sheet names
+var invalidSheetChars = strings.NewReplacer("[", "", "]", "", ":", "", "*", "", "?", "", "/", "", `\`, "")
+
+// SheetName returns name as a valid sheet name, Sheet1 when it is empty
+func SheetName(name string) string {
+	name = strings.TrimSpace(invalidSheetChars.Replace(name))
+	if utf8.RuneCountInString(name) > 31 {
+		name = string([]rune(name)[:31])
+	}
+	if name == "" {
+		return "Sheet1"
+	}
+	return name
+}
+
+// WriteXLSX writes a workbook with one sheet holding the table: a bold
+// header row that stays in view while scrolling, with filters, and columns
+// sized to their contents. Column types must be set, see InferTypes.
+func WriteXLSX(w io.Writer, sheet string, t Table) error {
+	data, err := sheetXML(t)
+	if err != nil {
+		return err
+	}
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, escape(SheetName(sheet)))},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+		{"xl/styles.xml", stylesXML},
+		{"xl/worksheets/sheet1.xml", data},
+	}
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// sheetXML returns the worksheet holding the table
+func sheetXML(t Table) (string, error) {
+	widths := make([]int, len(t.Columns))
+	var rows strings.Builder
+	rows.WriteString(`<row r="1">`)
+	for i, col := range t.Columns {
+		widths[i] = utf8.RuneCountInString(col.Name)
+		fmt.Fprintf(&rows, `<c r="%s1" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, columnName(i), styleHeader, escape(col.Name))
+	}
+	rows.WriteString(`</row>`)
+
+	for r, row := range t.Rows {
+		cells, err := t.Cells(row)
+		if err != nil {
+			return "", fmt.Errorf("row %d: %w", r+1, err)
+		}
+		n := r + 2
+		fmt.Fprintf(&rows, `<row r="%d">`, n)
+		for i, cell := range cells {
+			if cell.Empty {
+				continue
+			}
+			ref := columnName(i) + strconv.Itoa(n)
+			var text string
+			switch cell.Type {
+			case TypeInteger:
+				text = strconv.FormatFloat(cell.Number, 'f', -1, 64)
+				fmt.Fprintf(&rows, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleInteger, text)
+			case TypeNumber:
+				text = strconv.FormatFloat(cell.Number, 'f', -1, 64)
+				fmt.Fprintf(&rows, `<c r="%s"><v>%s</v></c>`, ref, text)
+			case TypeBoolean:
+				text = "FALSE"
+				v := 0
+				if cell.Bool {
+					text, v = "TRUE", 1
+				}
+				fmt.Fprintf(&rows, `<c r="%s" t="b"><v>%d</v></c>`, ref, v)
+			case TypeDate:
+				text = "0000-00-00"
+				fmt.Fprintf(&rows, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDate, strconv.FormatFloat(serial(cell.Time), 'f', -1, 64))
+			case TypeDateTime:
+				text = "0000-00-00 00:00:00"
+				fmt.Fprintf(&rows, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDateTime, strconv.FormatFloat(serial(cell.Time), 'f', -1, 64))
+			default:
+				text = cell.String
+				fmt.Fprintf(&rows, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(cell.String))
+			}
+			if first, _, _ := strings.Cut(text, "\n"); utf8.RuneCountInString(first) > widths[i] {
+				widths[i] = utf8.RuneCountInString(first)
+			}
+		}
+		rows.WriteString(`</row>`)
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(t.Columns) > 0 {
+		b.WriteString(`<cols>`)
+		for i, width := range widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, min(width+2, maxColumnWidth))
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	b.WriteString(rows.String())
+	b.WriteString(`</sheetData>`)
+	if len(t.Columns) > 0 {
+		fmt.Fprintf(&b, `<autoFilter ref="A1:%s%d"/>`, columnName(len(t.Columns)-1), len(t.Rows)+1)
+	}
+	b.WriteString(`</worksheet>`)
+	return b.String(), nil
+}
+
+// columnName returns the letters naming a zero-based column: A, B, ... Z,
+// AA, AB and so on
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// escape escapes text for XML, dropping the characters XML can't hold
+func escape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != 0xFFFE && r != 0xFFFF) {
+			return r
+		}
+		return -1
+	}, s)
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const contentTypesXML = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const rootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookXML = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const workbookRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// stylesXML holds the cell styles, in the order of the style constants
+const stylesXML = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
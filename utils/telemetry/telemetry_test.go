@@ -0,0 +1,36 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestEnabled(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+
+	if Enabled(config.TracingConfig{}, getenv) {
+		t.Error("tracing enabled without settings or environment")
+	}
+	if !Enabled(config.TracingConfig{Enabled: true}, getenv) {
+		t.Error("tracing not enabled by settings")
+	}
+	env["OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"] = "http://localhost:4318/v1/traces"
+	if !Enabled(config.TracingConfig{}, getenv) {
+		t.Error("tracing not enabled by OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	}
+}
+
+func TestSetupDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	stop, err := Setup(context.Background(), config.TracingConfig{}, "test")
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := stop(context.Background()); err != nil {
+		t.Errorf("stop() error = %v", err)
+	}
+}
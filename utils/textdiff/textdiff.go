@@ -0,0 +1,244 @@
+// Package textdiff compares texts line by line or word by word.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Op kinds
+const (
+	Equal  = ' '
+	Delete = '-'
+	Insert = '+'
+)
+
+// Op is one element of an edit script: a token kept, deleted from the first
+// text or inserted from the second
+type Op struct {
+	Kind byte
+	Text string
+}
+
+// maxCells bounds the comparison table; larger inputs have their differing
+// middle reported as one replaced block
+const maxCells = 16 << 20
+
+// Diff returns a shortest edit script turning a into b
+func Diff(a, b []string) []Op {
+	// Common prefix and suffix need no table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	for _, s := range a[:prefix] {
+		ops = append(ops, Op{Equal, s})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, s := range a[len(a)-suffix:] {
+		ops = append(ops, Op{Equal, s})
+	}
+	return ops
+}
+
+// lcsDiff diffs via the longest common subsequence table
+func lcsDiff(a, b []string) []Op {
+	var ops []Op
+	if (len(a)+1)*(len(b)+1) > maxCells {
+		for _, s := range a {
+			ops = append(ops, Op{Delete, s})
+		}
+		for _, s := range b {
+			ops = append(ops, Op{Insert, s})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, Op{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Op{Delete, a[i]})
+			i++
+		default:
+			ops = append(ops, Op{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, Op{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, Op{Insert, b[j]})
+	}
+	return ops
+}
+
+// splitLines splits text into lines without their newlines
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Unified returns a unified diff of two texts with the given lines of
+// context, or "" if they are equal
+func Unified(fromName, toName, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	ops := Diff(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for start := 0; start < len(ops); {
+		// Find the next change and extend the hunk while changes are
+		// within two contexts of each other
+		first := start
+		for first < len(ops) && ops[first].Kind == Equal {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for k := first; k < len(ops); k++ {
+			if ops[k].Kind != Equal {
+				last = k
+			} else if k-last > 2*context {
+				break
+			}
+		}
+		lo := max(first-context, start)
+		hi := min(last+context+1, len(ops))
+
+		// Line numbers of the hunk start in each text
+		aLine, bLine := 1, 1
+		for _, op := range ops[:lo] {
+			if op.Kind != Insert {
+				aLine++
+			}
+			if op.Kind != Delete {
+				bLine++
+			}
+		}
+		var aCount, bCount int
+		for _, op := range ops[lo:hi] {
+			if op.Kind != Insert {
+				aCount++
+			}
+			if op.Kind != Delete {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+		for _, op := range ops[lo:hi] {
+			out.WriteByte(op.Kind)
+			out.WriteString(op.Text)
+			out.WriteByte('\n')
+		}
+		start = hi
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk's start line and length; an empty range starts
+// at the line before it
+func hunkRange(line, count int) string {
+	if count == 0 {
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitWords splits text into alternating runs of whitespace and non-space
+// characters, so joining the tokens restores the text
+func splitWords(text string) []string {
+	var tokens []string
+	start, space := 0, false
+	for i, r := range text {
+		if i > start && unicode.IsSpace(r) != space {
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
+
+// Words returns b with the words changed from a marked as [-deleted-] and
+// {+inserted+}, like git diff --word-diff=plain
+func Words(a, b string) string {
+	ops := Diff(splitWords(a), splitWords(b))
+
+	var out strings.Builder
+	for k := 0; k < len(ops); {
+		if ops[k].Kind == Equal {
+			out.WriteString(ops[k].Text)
+			k++
+			continue
+		}
+		// Gather a run of changes, treating whitespace between changed
+		// words as part of the change
+		var deleted, inserted strings.Builder
+		for k < len(ops) && (ops[k].Kind != Equal || isSpace(ops[k].Text) && k+1 < len(ops) && ops[k+1].Kind != Equal) {
+			switch ops[k].Kind {
+			case Delete:
+				deleted.WriteString(ops[k].Text)
+			case Insert:
+				inserted.WriteString(ops[k].Text)
+			default:
+				deleted.WriteString(ops[k].Text)
+				inserted.WriteString(ops[k].Text)
+			}
+			k++
+		}
+		if deleted.Len() > 0 {
+			out.WriteString("[-" + deleted.String() + "-]")
+		}
+		if inserted.Len() > 0 {
+			out.WriteString("{+" + inserted.String() + "+}")
+		}
+	}
+	return out.String()
+}
+
+// isSpace reports whether a token is whitespace
+func isSpace(token string) bool {
+	return strings.TrimSpace(token) == ""
+}
@@ -0,0 +1,64 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\n2\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+	want := `--- a
++++ b
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+@@ -10 +10,2 @@
+ ten
++eleven
+`
+	if got := Unified("a", "b", a, b, 1); got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+	// Nearby changes share a hunk
+	if got := Unified("a", "b", a, b, 3); strings.Count(got, "@@ -") != 2 {
+		t.Errorf("expected two hunks with 3 lines of context:\n%s", got)
+	}
+	if got := Unified("a", "b", a, a, 3); got != "" {
+		t.Errorf("Unified() of equal texts = %q", got)
+	}
+	if got := Unified("a", "b", "", "new\n", 3); !strings.Contains(got, "@@ -0,0 +1 @@\n+new\n") {
+		t.Errorf("Unified() from empty =\n%s", got)
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct{ a, b, want string }{
+		{"The quick brown fox", "The quick brown fox", "The quick brown fox"},
+		{"The quick brown fox", "The slow brown fox", "The [-quick-]{+slow+} brown fox"},
+		{"The quick brown fox jumps", "The lazy red fox jumps", "The [-quick brown-]{+lazy red+} fox jumps"},
+		{"A fox", "A red fox", "A {+red +}fox"},
+		{"Café au lait", "Café noir", "Café [-au lait-]{+noir+}"},
+	}
+	for _, tt := range tests {
+		if got := Words(tt.a, tt.b); got != tt.want {
+			t.Errorf("Words(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDiffLargeInput(t *testing.T) {
+	a := make([]string, 5000)
+	b := make([]string, 5000)
+	for i := range a {
+		a[i] = "a" + strings.Repeat("x", i%7)
+		b[i] = "b" + strings.Repeat("x", i%5)
+	}
+	a[0], b[0] = "same", "same"
+	ops := Diff(a, b)
+	if ops[0] != (Op{Equal, "same"}) || len(ops) != 1+2*4999 {
+		t.Errorf("Diff() returned %d ops starting %v", len(ops), ops[0])
+	}
+}
@@ -0,0 +1,394 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/fileutil"
+)
+
+// MaxResultSize caps how much of a tool's output is returned to the model
+const MaxResultSize = 20000
+
+// Tool is an action a model can invoke from an agent step
+type Tool interface {
+	Name() string
+	Description() string // What the tool does and the arguments it takes
+	Call(args map[string]interface{}) (string, error)
+}
+
+// PathResolver maps a requested path to one the tool is allowed to access,
+// e.g. through the server-mode sandbox
+type PathResolver func(path string) (string, error)
+
+// Truncate shortens a tool result to MaxResultSize
+func Truncate(result string) string {
+	if len(result) <= MaxResultSize {
+		return result
+	}
+	return result[:MaxResultSize] + fmt.Sprintf("\n... [truncated %d bytes]", len(result)-MaxResultSize)
+}
+
+// stringArg returns a string argument, or an error if it is required and missing
+func stringArg(args map[string]interface{}, name string, required bool) (string, error) {
+	value, ok := args[name]
+	if !ok || value == nil {
+		if required {
+			return "", fmt.Errorf("missing required argument '%s'", name)
+		}
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("argument '%s' must be a string", name)
+	}
+	return s, nil
+}
+
+// maxRedirects is how many redirects the http tool follows
+const maxRedirects = 10
+
+// httpTool performs HTTP requests to an allow-list of hosts
+type httpTool struct {
+	allowedHosts []string
+	client       *http.Client
+}
+
+// NewHTTPTool creates an HTTP tool limited to allowedHosts, which every
+// redirect must stay within too. An empty host list allows no host. With
+// blockPrivate, loopback, private and link-local addresses can't be
+// reached, whatever name they are reached by.
+func NewHTTPTool(allowedHosts []string, blockPrivate bool) Tool {
+	t := &httpTool{allowedHosts: allowedHosts}
+	t.client = &http.Client{Timeout: 30 * time.Second, CheckRedirect: t.checkRedirect}
+	if blockPrivate {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, Control: refusePrivate}
+		t.client.Transport = &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			ForceAttemptHTTP2:   true,
+		}
+	}
+	return t
+}
+
+// checkRedirect refuses redirects to hosts the tool may not call
+func (t *httpTool) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return t.checkURL(req.URL)
+}
+
+// checkURL reports whether the tool may request u
+func (t *httpTool) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid URL '%s'", u.Redacted())
+	}
+	if !t.hostAllowed(u.Hostname()) {
+		return fmt.Errorf("host '%s' is not in the allowed hosts list", u.Hostname())
+	}
+	return nil
+}
+
+// refusePrivate stops connections to loopback, private, link-local and
+// unspecified addresses. It checks the address being dialled, so names
+// that resolve to such addresses are refused too.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("address %s is private and can't be reached", host)
+	}
+	return nil
+}
+
+func (t *httpTool) Name() string { return "http" }
+
+func (t *httpTool) Description() string {
+	return `Make an HTTP request. Arguments: {"url": "https://...", "method": "GET or POST (default GET)", "body": "optional request body"}`
+}
+
+func (t *httpTool) Call(args map[string]interface{}) (string, error) {
+	rawURL, err := stringArg(args, "url", true)
+	if err != nil {
+		return "", err
+	}
+	method, err := stringArg(args, "method", false)
+	if err != nil {
+		return "", err
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+	body, err := stringArg(args, "body", false)
+	if err != nil {
+		return "", err
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL '%s'", rawURL)
+	}
+	if err := t.checkURL(parsed); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), rawURL, strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxResultSize+1))
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+	return Truncate(fmt.Sprintf("HTTP %d\n%s", resp.StatusCode, data)), nil
+}
+
+func (t *httpTool) hostAllowed(host string) bool {
+	for _, allowed := range t.allowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellTool runs allow-listed commands without a shell, so pipes,
+// redirects and substitutions are not interpreted
+type shellTool struct {
+	allowedCommands []string
+	dir             string
+	env             []string
+	timeout         time.Duration
+}
+
+// NewShellTool creates a shell tool limited to the given command names,
+// run in dir with the given environment
+func NewShellTool(allowedCommands []string, dir string, env []string) Tool {
+	return &shellTool{
+		allowedCommands: allowedCommands,
+		dir:             dir,
+		env:             env,
+		timeout:         60 * time.Second,
+	}
+}
+
+func (t *shellTool) Name() string { return "shell" }
+
+func (t *shellTool) Description() string {
+	return fmt.Sprintf(`Run a command (no shell features such as pipes or redirects). Allowed commands: %s. Arguments: {"command": "grep -n TODO main.go"}`,
+		strings.Join(t.allowedCommands, ", "))
+}
+
+func (t *shellTool) Call(args map[string]interface{}) (string, error) {
+	command, err := stringArg(args, "command", true)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+	allowed := false
+	for _, name := range t.allowedCommands {
+		if fields[0] == name {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("command '%s' is not in the allowed commands list", fields[0])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Dir = t.dir
+	cmd.Env = t.env
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command timed out after %s", t.timeout)
+	}
+	result := out.String()
+	if err != nil {
+		// A non-zero exit is reported to the model rather than failing the step
+		result += fmt.Sprintf("\n[exit: %v]", err)
+	}
+	return Truncate(result), nil
+}
+
+// fileReadTool reads files through a PathResolver
+type fileReadTool struct {
+	resolve PathResolver
+}
+
+// NewFileReadTool creates a tool that reads files
+func NewFileReadTool(resolve PathResolver) Tool {
+	return &fileReadTool{resolve: resolve}
+}
+
+func (t *fileReadTool) Name() string { return "file_read" }
+
+func (t *fileReadTool) Description() string {
+	return `Read a text file. Arguments: {"path": "relative/or/absolute/path.txt"}`
+}
+
+func (t *fileReadTool) Call(args map[string]interface{}) (string, error) {
+	path, err := stringArg(args, "path", true)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := t.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := fileutil.SafeReadFile(resolved)
+	if err != nil {
+		return "", err
+	}
+	return Truncate(string(data)), nil
+}
+
+// fileWriteTool writes files through a PathResolver
+type fileWriteTool struct {
+	resolve PathResolver
+}
+
+// NewFileWriteTool creates a tool that writes files, creating parent directories
+func NewFileWriteTool(resolve PathResolver) Tool {
+	return &fileWriteTool{resolve: resolve}
+}
+
+func (t *fileWriteTool) Name() string { return "file_write" }
+
+func (t *fileWriteTool) Description() string {
+	return `Write (overwrite) a text file. Arguments: {"path": "output.txt", "content": "file contents"}`
+}
+
+func (t *fileWriteTool) Call(args map[string]interface{}) (string, error) {
+	path, err := stringArg(args, "path", true)
+	if err != nil {
+		return "", err
+	}
+	content, err := stringArg(args, "content", true)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := t.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
+		return "", fmt.Errorf("error creating directory: %w", err)
+	}
+	if err := os.WriteFile(resolved, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("error writing file: %w", err)
+	}
+	return fmt.Sprintf("Wrote %d bytes to %s", len(content), path), nil
+}
+
+// retrievalTool does keyword search over text files under a set of paths
+type retrievalTool struct {
+	paths   []string
+	resolve PathResolver
+}
+
+// NewRetrievalTool creates a tool that searches files under paths for passages
+// matching a query
+func NewRetrievalTool(paths []string, resolve PathResolver) Tool {
+	return &retrievalTool{paths: paths, resolve: resolve}
+}
+
+func (t *retrievalTool) Name() string { return "retrieval" }
+
+func (t *retrievalTool) Description() string {
+	return fmt.Sprintf(`Search documents (%s) for passages relevant to a query. Arguments: {"query": "search terms"}`,
+		strings.Join(t.paths, ", "))
+}
+
+// passage is a scored excerpt returned by the retrieval tool
+type passage struct {
+	source string
+	text   string
+	score  int
+}
+
+func (t *retrievalTool) Call(args map[string]interface{}) (string, error) {
+	query, err := stringArg(args, "query", true)
+	if err != nil {
+		return "", err
+	}
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return "", fmt.Errorf("empty query")
+	}
+
+	var passages []passage
+	for _, root := range t.paths {
+		resolved, err := t.resolve(root)
+		if err != nil {
+			return "", err
+		}
+		err = filepath.Walk(resolved, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || info.Size() > fileutil.MaxFileSize {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil || bytes.IndexByte(data, 0) >= 0 {
+				return nil // Skip unreadable and binary files
+			}
+			for _, chunk := range strings.Split(string(data), "\n\n") {
+				lower := strings.ToLower(chunk)
+				score := 0
+				for _, term := range terms {
+					score += strings.Count(lower, term)
+				}
+				if score > 0 {
+					passages = append(passages, passage{source: path, text: strings.TrimSpace(chunk), score: score})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("error searching %s: %w", root, err)
+		}
+	}
+
+	if len(passages) == 0 {
+		return "No matching passages found.", nil
+	}
+	sort.SliceStable(passages, func(i, j int) bool { return passages[i].score > passages[j].score })
+	if len(passages) > 5 {
+		passages = passages[:5]
+	}
+	var sb strings.Builder
+	for _, p := range passages {
+		sb.WriteString(fmt.Sprintf("--- %s ---\n%s\n\n", p.source, p.text))
+	}
+	return Truncate(sb.String()), nil
+}
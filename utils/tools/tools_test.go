@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func identity(path string) (string, error) { return path, nil }
+
+func TestShellToolAllowList(t *testing.T) {
+	tool := NewShellTool([]string{"echo"}, "", os.Environ())
+
+	out, err := tool.Call(map[string]interface{}{"command": "echo hello; rm -rf /"})
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	// Arguments are passed to echo verbatim rather than interpreted by a shell
+	if strings.TrimSpace(out) != "hello; rm -rf /" {
+		t.Errorf("Call() = %q", out)
+	}
+
+	if _, err := tool.Call(map[string]interface{}{"command": "rm -rf /tmp/x"}); err == nil {
+		t.Error("expected command outside the allow-list to be rejected")
+	}
+}
+
+func TestFileTools(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes", "out.txt")
+
+	write := NewFileWriteTool(identity)
+	if _, err := write.Call(map[string]interface{}{"path": path, "content": "remember the milk"}); err != nil {
+		t.Fatalf("write Call() error = %v", err)
+	}
+
+	read := NewFileReadTool(identity)
+	got, err := read.Call(map[string]interface{}{"path": path})
+	if err != nil || got != "remember the milk" {
+		t.Errorf("read Call() = %q, %v", got, err)
+	}
+
+	if _, err := read.Call(map[string]interface{}{}); err == nil {
+		t.Error("expected missing path argument error")
+	}
+}
+
+func TestRetrievalTool(t *testing.T) {
+	dir := t.TempDir()
+	doc := "Refunds are processed within 5 days.\n\nShipping is free over $50.\n\nRefunds for damaged goods are immediate."
+	if err := os.WriteFile(filepath.Join(dir, "policy.md"), []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tool := NewRetrievalTool([]string{dir}, identity)
+	got, err := tool.Call(map[string]interface{}{"query": "refunds"})
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if !strings.Contains(got, "within 5 days") || !strings.Contains(got, "damaged goods") || strings.Contains(got, "Shipping") {
+		t.Errorf("unexpected passages: %q", got)
+	}
+}
+
+func TestHTTPToolHostAllowList(t *testing.T) {
+	tool := NewHTTPTool([]string{"api.example.com"}, false)
+	if _, err := tool.Call(map[string]interface{}{"url": "https://evil.example.net/"}); err == nil || !strings.Contains(err.Error(), "not in the allowed hosts") {
+		t.Errorf("expected host rejection, got %v", err)
+	}
+	if _, err := tool.Call(map[string]interface{}{"url": "file:///etc/passwd"}); err == nil {
+		t.Error("expected non-HTTP URL to be rejected")
+	}
+	if _, err := NewHTTPTool(nil, false).Call(map[string]interface{}{"url": "https://api.example.com/"}); err == nil {
+		t.Error("expected an empty host list to allow no host")
+	}
+}
+
+func TestHTTPToolRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer target.Close()
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer redirector.Close()
+
+	// The redirect goes to localhost, which isn't allowed
+	tool := NewHTTPTool([]string{"127.0.0.1"}, false)
+	result, err := tool.Call(map[string]interface{}{"url": redirector.URL})
+	if err == nil || !strings.Contains(err.Error(), "host 'localhost' is not in the allowed hosts") || strings.Contains(result, "internal") {
+		t.Errorf("expected the redirect to be refused, got %q, %v", result, err)
+	}
+
+	tool = NewHTTPTool([]string{"127.0.0.1", "localhost"}, false)
+	if result, err := tool.Call(map[string]interface{}{"url": redirector.URL}); err != nil || !strings.Contains(result, "internal") {
+		t.Errorf("expected the redirect to an allowed host to be followed, got %q, %v", result, err)
+	}
+}
+
+func TestHTTPToolBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		tool := NewHTTPTool([]string{host}, true)
+		url := strings.Replace(server.URL, "127.0.0.1", host, 1)
+		if result, err := tool.Call(map[string]interface{}{"url": url}); err == nil || !strings.Contains(err.Error(), "private") {
+			t.Errorf("expected %s to be refused, got %q, %v", host, result, err)
+		}
+	}
+}
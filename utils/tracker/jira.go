@@ -0,0 +1,184 @@
+package tracker
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// jiraPage is the most issues a Jira search request returns
+const jiraPage = 100
+
+// jira reads and writes issues through the Jira REST API v2, which takes
+// and returns descriptions and comments as plain text
+type jira struct {
+	baseURL string
+	cloud   bool // Jira Cloud, which has its own search endpoint
+	headers map[string]string
+}
+
+func newJira(settings *config.JiraConfig) *jira {
+	auth := "Bearer " + settings.Token
+	if settings.Token == "" {
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(settings.Email+":"+settings.APIToken))
+	}
+	return &jira{
+		baseURL: strings.TrimRight(settings.URL, "/"),
+		cloud:   settings.Token == "",
+		headers: map[string]string{"Authorization": auth},
+	}
+}
+
+// jiraIssue is an issue as the search endpoint returns it
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string   `json:"summary"`
+		Description string   `json:"description"`
+		Labels      []string `json:"labels"`
+		Status      *struct {
+			Name string `json:"name"`
+		} `json:"status"`
+		Assignee *struct {
+			DisplayName string `json:"displayName"`
+		} `json:"assignee"`
+		Comment struct {
+			Comments []struct {
+				Author struct {
+					DisplayName string `json:"displayName"`
+				} `json:"author"`
+				Body    string `json:"body"`
+				Created string `json:"created"`
+			} `json:"comments"`
+		} `json:"comment"`
+	} `json:"fields"`
+}
+
+func (j *jira) issue(raw jiraIssue) Issue {
+	f := raw.Fields
+	issue := Issue{
+		Key:         raw.Key,
+		Title:       f.Summary,
+		Labels:      f.Labels,
+		URL:         j.baseURL + "/browse/" + raw.Key,
+		Description: f.Description,
+	}
+	if f.Status != nil {
+		issue.Status = f.Status.Name
+	}
+	if f.Assignee != nil {
+		issue.Assignee = f.Assignee.DisplayName
+	}
+	for _, c := range f.Comment.Comments {
+		issue.Comments = append(issue.Comments, Comment{Author: c.Author.DisplayName, Created: c.Created, Body: c.Body})
+	}
+	return issue
+}
+
+// fetch searches with the query's JQL, or for the issues it names, paging
+// until the limit
+func (j *jira) fetch(ctx context.Context, q Query) ([]Issue, error) {
+	jql := q.JQL
+	if len(q.Keys) > 0 {
+		quoted := make([]string, len(q.Keys))
+		for i, key := range q.Keys {
+			quoted[i] = strconv.Quote(key)
+		}
+		jql = "key in (" + strings.Join(quoted, ", ") + ")"
+	}
+	if jql == "" {
+		return nil, fmt.Errorf("jira inputs need a jql query or issue keys")
+	}
+	path := "/rest/api/2/search"
+	if j.cloud {
+		path = "/rest/api/2/search/jql" // Jira Cloud retired /search
+	}
+
+	var issues []Issue
+	var pageToken string
+	for len(issues) < q.Limit {
+		params := url.Values{
+			"jql":        {jql},
+			"maxResults": {fmt.Sprint(min(q.Limit-len(issues), jiraPage))},
+			"fields":     {"summary,status,assignee,labels,description,comment"},
+		}
+		if j.cloud && pageToken != "" {
+			params.Set("nextPageToken", pageToken)
+		} else if !j.cloud {
+			params.Set("startAt", fmt.Sprint(len(issues)))
+		}
+		var page struct {
+			Issues        []jiraIssue `json:"issues"`
+			NextPageToken string      `json:"nextPageToken"`
+			Total         int         `json:"total"`
+		}
+		if err := send(ctx, http.MethodGet, j.baseURL+path+"?"+params.Encode(), j.headers, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, raw := range page.Issues {
+			issues = append(issues, j.issue(raw))
+		}
+		if len(page.Issues) == 0 || (j.cloud && page.NextPageToken == "") || (!j.cloud && len(issues) >= page.Total) {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+	if len(issues) > q.Limit {
+		issues = issues[:q.Limit]
+	}
+	return issues, nil
+}
+
+func (j *jira) create(ctx context.Context, c Change) (Issue, error) {
+	issueType := c.Type
+	if issueType == "" {
+		issueType = "Task"
+	}
+	fields := map[string]interface{}{
+		"project":   map[string]string{"key": c.Project},
+		"issuetype": map[string]string{"name": issueType},
+		"summary":   c.Title,
+	}
+	if c.Description != "" {
+		fields["description"] = c.Description
+	}
+	if len(c.Labels) > 0 {
+		fields["labels"] = c.Labels
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := send(ctx, http.MethodPost, j.baseURL+"/rest/api/2/issue", j.headers, map[string]interface{}{"fields": fields}, &created); err != nil {
+		return Issue{}, err
+	}
+	return Issue{Key: created.Key, Title: c.Title, URL: j.baseURL + "/browse/" + created.Key}, nil
+}
+
+func (j *jira) update(ctx context.Context, key string, c Change) error {
+	fields := map[string]interface{}{}
+	if c.Title != "" {
+		fields["summary"] = c.Title
+	}
+	if c.Description != "" {
+		fields["description"] = c.Description
+	}
+	body := map[string]interface{}{"fields": fields}
+	if len(c.Labels) > 0 {
+		var add []map[string]string
+		for _, label := range c.Labels {
+			add = append(add, map[string]string{"add": label})
+		}
+		body["update"] = map[string]interface{}{"labels": add}
+	}
+	return send(ctx, http.MethodPut, j.baseURL+"/rest/api/2/issue/"+url.PathEscape(key), j.headers, body, nil)
+}
+
+func (j *jira) comment(ctx context.Context, key, body string) error {
+	return send(ctx, http.MethodPost, j.baseURL+"/rest/api/2/issue/"+url.PathEscape(key)+"/comment", j.headers, map[string]string{"body": body}, nil)
+}
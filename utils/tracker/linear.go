@@ -0,0 +1,277 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// linearURL is Linear's GraphQL endpoint; tests replace it
+var linearURL = "https://api.linear.app/graphql"
+
+// linearPage is the most issues a Linear query returns
+const linearPage = 250
+
+// linear reads and writes issues through Linear's GraphQL API
+type linear struct {
+	headers map[string]string
+}
+
+func newLinear(settings *config.LinearConfig) *linear {
+	return &linear{headers: map[string]string{"Authorization": settings.APIKey}}
+}
+
+// linearIssueFields are the fields of the issues a query returns
+const linearIssueFields = `id identifier title description url
+	state { name }
+	assignee { name }
+	labels { nodes { id name } }
+	comments { nodes { body createdAt user { name } } }`
+
+// linearIssue is an issue as the API returns it
+type linearIssue struct {
+	ID          string `json:"id"`
+	Identifier  string `json:"identifier"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	State       *struct {
+		Name string `json:"name"`
+	} `json:"state"`
+	Assignee *struct {
+		Name string `json:"name"`
+	} `json:"assignee"`
+	Labels struct {
+		Nodes []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Comments struct {
+		Nodes []struct {
+			Body      string `json:"body"`
+			CreatedAt string `json:"createdAt"`
+			User      *struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"nodes"`
+	} `json:"comments"`
+}
+
+func (raw linearIssue) issue() Issue {
+	issue := Issue{Key: raw.Identifier, Title: raw.Title, URL: raw.URL, Description: raw.Description}
+	if raw.State != nil {
+		issue.Status = raw.State.Name
+	}
+	if raw.Assignee != nil {
+		issue.Assignee = raw.Assignee.Name
+	}
+	for _, label := range raw.Labels.Nodes {
+		issue.Labels = append(issue.Labels, label.Name)
+	}
+	for _, c := range raw.Comments.Nodes {
+		author := "unknown"
+		if c.User != nil {
+			author = c.User.Name
+		}
+		issue.Comments = append(issue.Comments, Comment{Author: author, Created: c.CreatedAt, Body: c.Body})
+	}
+	return issue
+}
+
+// query runs a GraphQL query or mutation and decodes its data into out
+func (l *linear) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	var resp struct {
+		Data   interface{} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	resp.Data = out
+	err := send(ctx, http.MethodPost, linearURL, l.headers, map[string]interface{}{"query": query, "variables": variables}, &resp)
+	if len(resp.Errors) > 0 {
+		// Linear reports errors in the body, with a 200 or 400 status
+		return fmt.Errorf("%s", resp.Errors[0].Message)
+	}
+	return err
+}
+
+// lookup returns the issue an identifier such as ENG-123 names
+func (l *linear) lookup(ctx context.Context, key string) (linearIssue, error) {
+	var data struct {
+		Issue linearIssue `json:"issue"`
+	}
+	err := l.query(ctx, `query($id: String!) { issue(id: $id) { `+linearIssueFields+` } }`, map[string]interface{}{"id": key}, &data)
+	return data.Issue, err
+}
+
+// fetch returns the issues the query names, or those matching its
+// filters, most recently updated first
+func (l *linear) fetch(ctx context.Context, q Query) ([]Issue, error) {
+	var issues []Issue
+	if len(q.Keys) > 0 {
+		for _, key := range q.Keys {
+			raw, err := l.lookup(ctx, key)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			issues = append(issues, raw.issue())
+		}
+		return issues, nil
+	}
+
+	filter := map[string]interface{}{}
+	if q.Team != "" {
+		filter["team"] = map[string]interface{}{"key": map[string]string{"eq": q.Team}}
+	}
+	if q.State != "" {
+		filter["state"] = map[string]interface{}{"name": map[string]string{"eqIgnoreCase": q.State}}
+	}
+	if q.Label != "" {
+		filter["labels"] = map[string]interface{}{"name": map[string]string{"eqIgnoreCase": q.Label}}
+	}
+	if q.Assignee != "" {
+		filter["assignee"] = map[string]interface{}{"email": map[string]string{"eq": q.Assignee}}
+	}
+	if len(filter) == 0 {
+		return nil, fmt.Errorf("linear inputs need issue keys or a team, state, label or assignee")
+	}
+	const search = `query($filter: IssueFilter, $first: Int, $after: String) {
+	issues(filter: $filter, first: $first, after: $after, orderBy: updatedAt) {
+		nodes { ` + linearIssueFields + ` }
+		pageInfo { hasNextPage endCursor }
+	}
+}`
+	var after interface{}
+	for len(issues) < q.Limit {
+		var data struct {
+			Issues struct {
+				Nodes    []linearIssue `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"issues"`
+		}
+		variables := map[string]interface{}{"filter": filter, "first": min(q.Limit-len(issues), linearPage), "after": after}
+		if err := l.query(ctx, search, variables, &data); err != nil {
+			return nil, err
+		}
+		for _, raw := range data.Issues.Nodes {
+			issues = append(issues, raw.issue())
+		}
+		if !data.Issues.PageInfo.HasNextPage {
+			break
+		}
+		after = data.Issues.PageInfo.EndCursor
+	}
+	return issues, nil
+}
+
+// labelIDs returns the IDs of the labels named
+func (l *linear) labelIDs(ctx context.Context, names []string) ([]string, error) {
+	var data struct {
+		IssueLabels struct {
+			Nodes []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"nodes"`
+		} `json:"issueLabels"`
+	}
+	filter := map[string]interface{}{"name": map[string]interface{}{"in": names}}
+	if err := l.query(ctx, `query($filter: IssueLabelFilter) { issueLabels(filter: $filter) { nodes { id name } } }`, map[string]interface{}{"filter": filter}, &data); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		id := ""
+		for _, label := range data.IssueLabels.Nodes {
+			if strings.EqualFold(label.Name, name) {
+				id = label.ID
+				break
+			}
+		}
+		if id == "" {
+			return nil, fmt.Errorf("no label named %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (l *linear) create(ctx context.Context, c Change) (Issue, error) {
+	var teams struct {
+		Teams struct {
+			Nodes []struct {
+				ID string `json:"id"`
+			} `json:"nodes"`
+		} `json:"teams"`
+	}
+	filter := map[string]interface{}{"key": map[string]string{"eq": c.Project}}
+	if err := l.query(ctx, `query($filter: TeamFilter) { teams(filter: $filter) { nodes { id } } }`, map[string]interface{}{"filter": filter}, &teams); err != nil {
+		return Issue{}, err
+	}
+	if len(teams.Teams.Nodes) == 0 {
+		return Issue{}, fmt.Errorf("no team with key %s", c.Project)
+	}
+	input := map[string]interface{}{"teamId": teams.Teams.Nodes[0].ID, "title": c.Title}
+	if c.Description != "" {
+		input["description"] = c.Description
+	}
+	if len(c.Labels) > 0 {
+		ids, err := l.labelIDs(ctx, c.Labels)
+		if err != nil {
+			return Issue{}, err
+		}
+		input["labelIds"] = ids
+	}
+	var data struct {
+		IssueCreate struct {
+			Issue linearIssue `json:"issue"`
+		} `json:"issueCreate"`
+	}
+	const mutation = `mutation($input: IssueCreateInput!) { issueCreate(input: $input) { issue { identifier title url } } }`
+	if err := l.query(ctx, mutation, map[string]interface{}{"input": input}, &data); err != nil {
+		return Issue{}, err
+	}
+	return data.IssueCreate.Issue.issue(), nil
+}
+
+func (l *linear) update(ctx context.Context, key string, c Change) error {
+	current, err := l.lookup(ctx, key)
+	if err != nil {
+		return err
+	}
+	input := map[string]interface{}{}
+	if c.Title != "" {
+		input["title"] = c.Title
+	}
+	if c.Description != "" {
+		input["description"] = c.Description
+	}
+	if len(c.Labels) > 0 {
+		ids, err := l.labelIDs(ctx, c.Labels)
+		if err != nil {
+			return err
+		}
+		// labelIds replaces the issue's labels, so keep the ones it has
+		for _, label := range current.Labels.Nodes {
+			ids = append(ids, label.ID)
+		}
+		input["labelIds"] = ids
+	}
+	const mutation = `mutation($id: String!, $input: IssueUpdateInput!) { issueUpdate(id: $id, input: $input) { success } }`
+	return l.query(ctx, mutation, map[string]interface{}{"id": current.ID, "input": input}, nil)
+}
+
+func (l *linear) comment(ctx context.Context, key, body string) error {
+	current, err := l.lookup(ctx, key)
+	if err != nil {
+		return err
+	}
+	const mutation = `mutation($input: CommentCreateInput!) { commentCreate(input: $input) { success } }`
+	return l.query(ctx, mutation, map[string]interface{}{"input": map[string]string{"issueId": current.ID, "body": body}}, nil)
+}
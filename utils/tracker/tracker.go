@@ -0,0 +1,259 @@
+// Package tracker reads issues from and writes issues to Jira and Linear,
+// for workflows that triage tickets or draft release notes without a
+// separate bot doing the ticket I/O. Credentials come from the trackers
+// section of the env config, or of the workspace a server run is in.
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/httpclient"
+)
+
+// Tracker kinds, the keys of a step's input or output that name issues
+const (
+	KindJira   = "jira"
+	KindLinear = "linear"
+)
+
+// Kinds lists the tracker kinds
+var Kinds = []string{KindJira, KindLinear}
+
+// DefaultLimit is how many issues a query returns when it sets no limit
+const DefaultLimit = 50
+
+// Issue is an issue read from a tracker
+type Issue struct {
+	Key         string // Such as ENG-123
+	Title       string
+	Status      string
+	Assignee    string
+	Labels      []string
+	URL         string
+	Description string
+	Comments    []Comment
+}
+
+// Comment is a comment on an issue
+type Comment struct {
+	Author  string
+	Created string
+	Body    string
+}
+
+// Render returns the issue as markdown: its title, fields, description and
+// comments
+func (i Issue) Render() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s: %s\n\n", i.Key, i.Title)
+	if i.Status != "" {
+		fmt.Fprintf(&b, "Status: %s\n", i.Status)
+	}
+	if i.Assignee != "" {
+		fmt.Fprintf(&b, "Assignee: %s\n", i.Assignee)
+	}
+	if len(i.Labels) > 0 {
+		fmt.Fprintf(&b, "Labels: %s\n", strings.Join(i.Labels, ", "))
+	}
+	if i.URL != "" {
+		fmt.Fprintf(&b, "URL: %s\n", i.URL)
+	}
+	if desc := strings.TrimSpace(i.Description); desc != "" {
+		fmt.Fprintf(&b, "\n%s\n", desc)
+	}
+	if len(i.Comments) > 0 {
+		b.WriteString("\n## Comments\n")
+		for _, c := range i.Comments {
+			fmt.Fprintf(&b, "\n%s, %s:\n%s\n", c.Author, c.Created, strings.TrimSpace(c.Body))
+		}
+	}
+	return b.String()
+}
+
+// Query selects the issues a fetch returns: the issues Keys names, or
+// those matching JQL on Jira and Team, State, Label and Assignee on Linear
+type Query struct {
+	Keys     []string
+	JQL      string
+	Team     string // Linear team key
+	State    string // Linear workflow state name
+	Label    string // Linear label name
+	Assignee string // Linear assignee email
+	Limit    int
+}
+
+// Change is an issue to create, or the fields of an issue to update. A
+// field left empty is not changed, and labels are added to the issue's.
+type Change struct {
+	Project     string // Jira project key or Linear team key, when creating
+	Type        string // Jira issue type when creating, Task by default
+	Title       string
+	Description string
+	Labels      []string
+}
+
+// Fetch returns the issues a query selects
+func Fetch(ctx context.Context, settings config.TrackersConfig, kind string, q Query) ([]Issue, error) {
+	if err := CheckConfigured(settings, kind); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	var issues []Issue
+	var err error
+	if kind == KindJira {
+		issues, err = newJira(settings.Jira).fetch(ctx, q)
+	} else {
+		issues, err = newLinear(settings.Linear).fetch(ctx, q)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching issues from %s: %w", kind, err)
+	}
+	return issues, nil
+}
+
+// Create creates an issue and returns its key and URL
+func Create(ctx context.Context, settings config.TrackersConfig, kind string, c Change) (Issue, error) {
+	if err := CheckConfigured(settings, kind); err != nil {
+		return Issue{}, err
+	}
+	if c.Project == "" || c.Title == "" {
+		return Issue{}, fmt.Errorf("creating a %s issue needs a project and title", kind)
+	}
+	var issue Issue
+	var err error
+	if kind == KindJira {
+		issue, err = newJira(settings.Jira).create(ctx, c)
+	} else {
+		issue, err = newLinear(settings.Linear).create(ctx, c)
+	}
+	if err != nil {
+		return Issue{}, fmt.Errorf("error creating %s issue in %s: %w", kind, c.Project, err)
+	}
+	return issue, nil
+}
+
+// Update changes the fields of an issue that c sets
+func Update(ctx context.Context, settings config.TrackersConfig, kind, key string, c Change) error {
+	if err := CheckConfigured(settings, kind); err != nil {
+		return err
+	}
+	var err error
+	if kind == KindJira {
+		err = newJira(settings.Jira).update(ctx, key, c)
+	} else {
+		err = newLinear(settings.Linear).update(ctx, key, c)
+	}
+	if err != nil {
+		return fmt.Errorf("error updating %s: %w", key, err)
+	}
+	return nil
+}
+
+// AddComment posts a comment on an issue
+func AddComment(ctx context.Context, settings config.TrackersConfig, kind, key, body string) error {
+	if err := CheckConfigured(settings, kind); err != nil {
+		return err
+	}
+	var err error
+	if kind == KindJira {
+		err = newJira(settings.Jira).comment(ctx, key, body)
+	} else {
+		err = newLinear(settings.Linear).comment(ctx, key, body)
+	}
+	if err != nil {
+		return fmt.Errorf("error commenting on %s: %w", key, err)
+	}
+	return nil
+}
+
+// CheckConfigured reports whether the env config has the credentials a
+// tracker kind needs
+func CheckConfigured(settings config.TrackersConfig, kind string) error {
+	switch kind {
+	case KindJira:
+		j := settings.Jira
+		if j == nil || j.URL == "" || (j.Token == "" && (j.Email == "" || j.APIToken == "")) {
+			return fmt.Errorf("jira steps need trackers.jira in the env config, with a url and an email and api_token or a token")
+		}
+	case KindLinear:
+		if settings.Linear == nil || settings.Linear.APIKey == "" {
+			return fmt.Errorf("linear steps need trackers.linear.api_key in the env config")
+		}
+	default:
+		return fmt.Errorf("unknown tracker %q (expected %s)", kind, strings.Join(Kinds, ", "))
+	}
+	return nil
+}
+
+// statusError is the error of a request the tracker answered with an
+// error status
+type statusError struct {
+	Status int
+	Body   string
+}
+
+func (e *statusError) Error() string {
+	switch e.Status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("access denied (status %d), check the credentials: %s", e.Status, e.Body)
+	case http.StatusNotFound:
+		return fmt.Sprintf("not found (status 404), or not visible to the configured credentials: %s", e.Body)
+	}
+	return fmt.Sprintf("status %d: %s", e.Status, e.Body)
+}
+
+// send sends body, if not nil, as JSON and decodes the JSON response into
+// out, if not nil
+func send(ctx context.Context, method, url string, headers map[string]string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := httpclient.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(data))
+		if len(msg) > 300 {
+			msg = msg[:300] + "..."
+		}
+		return &statusError{Status: resp.StatusCode, Body: msg}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	return nil
+}
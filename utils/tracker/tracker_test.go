@@ -0,0 +1,180 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestJira(t *testing.T) {
+	var created, updated, commented map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "me@acme.com" || pass != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.URL.Path == "/rest/api/2/search/jql":
+			if jql := r.URL.Query().Get("jql"); jql != `key in ("ENG-1")` && jql != "project = ENG" {
+				t.Errorf("jql = %q", jql)
+			}
+			if r.URL.Query().Get("nextPageToken") == "" {
+				fmt.Fprint(w, `{"issues":[{"key":"ENG-1","fields":{"summary":"Login fails","description":"Steps to reproduce","labels":["bug"],
+					"status":{"name":"Open"},"assignee":{"displayName":"Ana"},
+					"comment":{"comments":[{"author":{"displayName":"Bo"},"body":"Seen on iOS too","created":"2025-06-01"}]}}}],
+					"nextPageToken":"p2"}`)
+				return
+			}
+			fmt.Fprint(w, `{"issues":[{"key":"ENG-2","fields":{"summary":"Slow search"}}]}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/rest/api/2/issue":
+			created = body
+			fmt.Fprint(w, `{"key":"ENG-3"}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/rest/api/2/issue/ENG-1":
+			updated = body
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/rest/api/2/issue/ENG-1/comment":
+			commented = body
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	settings := config.TrackersConfig{Jira: &config.JiraConfig{URL: srv.URL, Email: "me@acme.com", APIToken: "tok"}}
+	ctx := context.Background()
+
+	issues, err := Fetch(ctx, settings, KindJira, Query{JQL: "project = ENG"})
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(issues) != 2 || issues[1].Key != "ENG-2" {
+		t.Fatalf("Fetch() = %+v, want both pages", issues)
+	}
+	text := issues[0].Render()
+	for _, want := range []string{"# ENG-1: Login fails", "Status: Open", "Assignee: Ana", "Labels: bug", srv.URL + "/browse/ENG-1", "Steps to reproduce", "Bo, 2025-06-01:\nSeen on iOS too"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Render() doesn't contain %q:\n%s", want, text)
+		}
+	}
+	if issues, err := Fetch(ctx, settings, KindJira, Query{Keys: []string{"ENG-1"}, Limit: 1}); err != nil || len(issues) != 1 {
+		t.Errorf("Fetch(keys) = %v, %v", issues, err)
+	}
+
+	issue, err := Create(ctx, settings, KindJira, Change{Project: "ENG", Title: "Release notes", Description: "Notes", Labels: []string{"release"}})
+	if err != nil || issue.Key != "ENG-3" {
+		t.Fatalf("Create() = %+v, %v", issue, err)
+	}
+	fields := created["fields"].(map[string]interface{})
+	if fields["summary"] != "Release notes" || fields["issuetype"].(map[string]interface{})["name"] != "Task" {
+		t.Errorf("created %v", fields)
+	}
+
+	if err := Update(ctx, settings, KindJira, "ENG-1", Change{Description: "Triaged", Labels: []string{"p1"}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated["fields"].(map[string]interface{})["description"] != "Triaged" || updated["update"] == nil {
+		t.Errorf("updated %v", updated)
+	}
+	if err := AddComment(ctx, settings, KindJira, "ENG-1", "Likely the token refresh"); err != nil || commented["body"] != "Likely the token refresh" {
+		t.Errorf("AddComment() error = %v, posted %v", err, commented)
+	}
+
+	settings.Jira.APIToken = "wrong"
+	if _, err := Fetch(ctx, settings, KindJira, Query{JQL: "project = ENG"}); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("Fetch() error = %v, want access denied", err)
+	}
+}
+
+func TestLinear(t *testing.T) {
+	var requests []string
+	var mutations []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "lin_api_key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case strings.Contains(req.Query, "issues(filter"):
+			requests = append(requests, fmt.Sprint(req.Variables["filter"]))
+			fmt.Fprint(w, `{"data":{"issues":{"nodes":[{"id":"u1","identifier":"ENG-7","title":"Crash on save","url":"https://linear.app/acme/issue/ENG-7",
+				"state":{"name":"Triage"},"labels":{"nodes":[{"id":"l1","name":"Bug"}]},"comments":{"nodes":[]}}],"pageInfo":{"hasNextPage":false}}}}`)
+		case strings.Contains(req.Query, "issue(id"):
+			if req.Variables["id"] != "ENG-7" {
+				fmt.Fprint(w, `{"errors":[{"message":"Entity not found"}],"data":null}`)
+				return
+			}
+			fmt.Fprint(w, `{"data":{"issue":{"id":"u1","identifier":"ENG-7","title":"Crash on save","labels":{"nodes":[{"id":"l1","name":"Bug"}]}}}}`)
+		case strings.Contains(req.Query, "teams("):
+			fmt.Fprint(w, `{"data":{"teams":{"nodes":[{"id":"t1"}]}}}`)
+		case strings.Contains(req.Query, "issueLabels("):
+			fmt.Fprint(w, `{"data":{"issueLabels":{"nodes":[{"id":"l2","name":"P1"}]}}}`)
+		case strings.Contains(req.Query, "issueCreate"):
+			mutations = append(mutations, req.Variables)
+			fmt.Fprint(w, `{"data":{"issueCreate":{"issue":{"identifier":"ENG-8","title":"Follow up","url":"https://linear.app/acme/issue/ENG-8"}}}}`)
+		default:
+			mutations = append(mutations, req.Variables)
+			fmt.Fprint(w, `{"data":{}}`)
+		}
+	}))
+	defer srv.Close()
+	previous := linearURL
+	linearURL = srv.URL
+	defer func() { linearURL = previous }()
+	settings := config.TrackersConfig{Linear: &config.LinearConfig{APIKey: "lin_api_key"}}
+	ctx := context.Background()
+
+	issues, err := Fetch(ctx, settings, KindLinear, Query{Team: "ENG", State: "Triage"})
+	if err != nil || len(issues) != 1 || issues[0].Status != "Triage" || issues[0].Labels[0] != "Bug" {
+		t.Fatalf("Fetch() = %+v, %v", issues, err)
+	}
+	if !strings.Contains(requests[0], "team:map[key:map[eq:ENG]]") {
+		t.Errorf("filter = %s", requests[0])
+	}
+	if _, err := Fetch(ctx, settings, KindLinear, Query{Keys: []string{"ENG-99"}}); err == nil || !strings.Contains(err.Error(), "Entity not found") {
+		t.Errorf("Fetch() error = %v, want Linear's error", err)
+	}
+
+	issue, err := Create(ctx, settings, KindLinear, Change{Project: "ENG", Title: "Follow up", Labels: []string{"p1"}})
+	if err != nil || issue.Key != "ENG-8" {
+		t.Fatalf("Create() = %+v, %v", issue, err)
+	}
+	input := mutations[0]["input"].(map[string]interface{})
+	if input["teamId"] != "t1" || fmt.Sprint(input["labelIds"]) != "[l2]" {
+		t.Errorf("created with %v", input)
+	}
+
+	if err := Update(ctx, settings, KindLinear, "ENG-7", Change{Labels: []string{"P1"}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if update := mutations[1]; update["id"] != "u1" || fmt.Sprint(update["input"].(map[string]interface{})["labelIds"]) != "[l2 l1]" {
+		t.Errorf("updated with %v, want the new label added to the issue's", update)
+	}
+	if err := AddComment(ctx, settings, KindLinear, "ENG-7", "Fixed in 2.3"); err != nil {
+		t.Fatalf("AddComment() error = %v", err)
+	}
+	if comment := mutations[2]["input"].(map[string]interface{}); comment["issueId"] != "u1" || comment["body"] != "Fixed in 2.3" {
+		t.Errorf("commented with %v", comment)
+	}
+}
+
+func TestCheckConfigured(t *testing.T) {
+	if err := CheckConfigured(config.TrackersConfig{}, KindJira); err == nil || !strings.Contains(err.Error(), "trackers.jira") {
+		t.Errorf("CheckConfigured() = %v, want the missing settings", err)
+	}
+	if err := CheckConfigured(config.TrackersConfig{Jira: &config.JiraConfig{URL: "https://jira.acme.com", Token: "pat"}}, KindJira); err != nil {
+		t.Errorf("CheckConfigured() = %v, want a personal access token accepted", err)
+	}
+}
@@ -0,0 +1,116 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// chroma is a Chroma server, used through its v1 API
+type chroma struct {
+	api restClient
+
+	mu  sync.Mutex
+	ids map[string]string // Collection name -> Chroma's ID for it
+}
+
+func newChroma(settings config.VectorStoreConfig) *chroma {
+	headers := map[string]string{}
+	if settings.APIKey != "" {
+		headers["Authorization"] = "Bearer " + settings.APIKey
+	}
+	return &chroma{api: newRESTClient(settings.URL, headers), ids: make(map[string]string)}
+}
+
+// collectionID returns the ID of a collection, creating the collection if
+// it doesn't exist
+func (c *chroma) collectionID(ctx context.Context, collection string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id, ok := c.ids[collection]; ok {
+		return id, nil
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	body := map[string]interface{}{
+		"name":          collection,
+		"get_or_create": true,
+		"metadata":      map[string]string{"hnsw:space": "cosine"},
+	}
+	if err := c.api.do(ctx, http.MethodPost, "/api/v1/collections", body, &resp); err != nil {
+		return "", fmt.Errorf("error opening Chroma collection %s: %w", collection, err)
+	}
+	c.ids[collection] = resp.ID
+	return resp.ID, nil
+}
+
+func (c *chroma) Upsert(ctx context.Context, collection string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	id, err := c.collectionID(ctx, collection)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(docs))
+	embeddings := make([][]float32, len(docs))
+	texts := make([]string, len(docs))
+	metadatas := make([]map[string]string, len(docs))
+	for i, doc := range docs {
+		ids[i], embeddings[i], texts[i] = doc.ID, doc.Vector, doc.Text
+		metadatas[i] = doc.Metadata
+		if metadatas[i] == nil {
+			metadatas[i] = map[string]string{} // Chroma rejects null metadata
+		}
+	}
+	body := map[string]interface{}{"ids": ids, "embeddings": embeddings, "documents": texts, "metadatas": metadatas}
+	if err := c.api.do(ctx, http.MethodPost, "/api/v1/collections/"+url.PathEscape(id)+"/upsert", body, nil); err != nil {
+		return fmt.Errorf("error adding documents to Chroma collection %s: %w", collection, err)
+	}
+	return nil
+}
+
+func (c *chroma) Query(ctx context.Context, collection string, vector []float32, k int) ([]Match, error) {
+	id, err := c.collectionID(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		IDs       [][]string                 `json:"ids"`
+		Documents [][]string                 `json:"documents"`
+		Metadatas [][]map[string]interface{} `json:"metadatas"`
+		Distances [][]float64                `json:"distances"`
+	}
+	body := map[string]interface{}{
+		"query_embeddings": [][]float32{vector},
+		"n_results":        k,
+		"include":          []string{"documents", "metadatas", "distances"},
+	}
+	if err := c.api.do(ctx, http.MethodPost, "/api/v1/collections/"+url.PathEscape(id)+"/query", body, &resp); err != nil {
+		return nil, fmt.Errorf("error searching Chroma collection %s: %w", collection, err)
+	}
+	if len(resp.IDs) == 0 {
+		return nil, nil
+	}
+	matches := make([]Match, len(resp.IDs[0]))
+	for i, docID := range resp.IDs[0] {
+		matches[i].ID = docID
+		if len(resp.Documents) > 0 && i < len(resp.Documents[0]) {
+			matches[i].Text = resp.Documents[0][i]
+		}
+		if len(resp.Metadatas) > 0 && i < len(resp.Metadatas[0]) {
+			matches[i].Metadata = stringMap(resp.Metadatas[0][i])
+		}
+		if len(resp.Distances) > 0 && i < len(resp.Distances[0]) {
+			matches[i].Score = 1 - resp.Distances[0][i] // Cosine distance
+		}
+	}
+	return matches, nil
+}
+
+func (c *chroma) Close() error { return nil }
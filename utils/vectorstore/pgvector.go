@@ -0,0 +1,137 @@
+package vectorstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/lib/pq"
+)
+
+// pgvector keeps each collection in a PostgreSQL table with a vector
+// column, using the pgvector extension
+type pgvector struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	created map[string]bool // Tables known to exist
+}
+
+func openPgvector(dbConfig config.DatabaseConfig) (*pgvector, error) {
+	if dbConfig.Type != config.PostgreSQL {
+		return nil, fmt.Errorf("pgvector needs a PostgreSQL database, not %s", dbConfig.Type)
+	}
+	db, err := sql.Open("postgres", dbConfig.GetConnectionString())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to vector database: %w", err)
+	}
+	return &pgvector{db: db, created: make(map[string]bool)}, nil
+}
+
+// vectorLiteral formats a vector as pgvector's text input, such as [1,2.5]
+func vectorLiteral(vector []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, value := range vector {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(value), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// ensure creates the table of a collection, for vectors of size dims
+func (p *pgvector) ensure(ctx context.Context, collection string, dims int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.created[collection] {
+		return nil
+	}
+	if _, err := p.db.ExecContext(ctx, "CREATE EXTENSION IF NOT EXISTS vector"); err != nil {
+		return fmt.Errorf("error enabling pgvector: %w", err)
+	}
+	schema := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	content TEXT NOT NULL,
+	metadata JSONB NOT NULL DEFAULT '{}',
+	embedding vector(%d) NOT NULL
+)`, pq.QuoteIdentifier(collection), dims)
+	if _, err := p.db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("error creating vector table %s: %w", collection, err)
+	}
+	p.created[collection] = true
+	return nil
+}
+
+func (p *pgvector) Upsert(ctx context.Context, collection string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	if err := p.ensure(ctx, collection, len(docs[0].Vector)); err != nil {
+		return err
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, content, metadata, embedding)
+VALUES ($1, $2, $3, $4::vector)
+ON CONFLICT (id) DO UPDATE SET content = EXCLUDED.content, metadata = EXCLUDED.metadata, embedding = EXCLUDED.embedding`,
+		pq.QuoteIdentifier(collection)))
+	if err != nil {
+		return fmt.Errorf("error adding documents to %s: %w", collection, err)
+	}
+	defer stmt.Close()
+	for _, doc := range docs {
+		metadata, err := json.Marshal(doc.Metadata)
+		if err != nil {
+			return err
+		}
+		if doc.Metadata == nil {
+			metadata = []byte("{}")
+		}
+		if _, err := stmt.ExecContext(ctx, doc.ID, doc.Text, string(metadata), vectorLiteral(doc.Vector)); err != nil {
+			return fmt.Errorf("error adding document %s to %s: %w", doc.ID, collection, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error adding documents to %s: %w", collection, err)
+	}
+	return nil
+}
+
+func (p *pgvector) Query(ctx context.Context, collection string, vector []float32, k int) ([]Match, error) {
+	query := fmt.Sprintf(`SELECT id, content, metadata, 1 - (embedding <=> $1::vector)
+FROM %s ORDER BY embedding <=> $1::vector LIMIT $2`, pq.QuoteIdentifier(collection))
+	rows, err := p.db.QueryContext(ctx, query, vectorLiteral(vector), k)
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s: %w", collection, err)
+	}
+	defer rows.Close()
+	var matches []Match
+	for rows.Next() {
+		var match Match
+		var metadata []byte
+		if err := rows.Scan(&match.ID, &match.Text, &metadata, &match.Score); err != nil {
+			return nil, fmt.Errorf("error reading match from %s: %w", collection, err)
+		}
+		if err := json.Unmarshal(metadata, &match.Metadata); err != nil {
+			return nil, fmt.Errorf("error reading match from %s: %w", collection, err)
+		}
+		if len(match.Metadata) == 0 {
+			match.Metadata = nil
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
+
+func (p *pgvector) Close() error { return p.db.Close() }
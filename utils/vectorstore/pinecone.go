@@ -0,0 +1,77 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// pineconeBatch is the most vectors sent in one upsert request, as
+// Pinecone recommends
+const pineconeBatch = 100
+
+// pinecone is a Pinecone index, reached at its host. Collections are
+// namespaces of the index.
+type pinecone struct {
+	api restClient
+}
+
+func newPinecone(settings config.VectorStoreConfig) *pinecone {
+	headers := map[string]string{"X-Pinecone-API-Version": "2024-07"}
+	if settings.APIKey != "" {
+		headers["Api-Key"] = settings.APIKey
+	}
+	return &pinecone{api: newRESTClient(settings.URL, headers)}
+}
+
+type pineconeVector struct {
+	ID       string                 `json:"id"`
+	Values   []float32              `json:"values,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Score    float64                `json:"score,omitempty"`
+}
+
+func (p *pinecone) Upsert(ctx context.Context, collection string, docs []Document) error {
+	for start := 0; start < len(docs); start += pineconeBatch {
+		end := start + pineconeBatch
+		if end > len(docs) {
+			end = len(docs)
+		}
+		vectors := make([]pineconeVector, 0, end-start)
+		for _, doc := range docs[start:end] {
+			metadata := map[string]interface{}{"text": doc.Text}
+			for key, value := range doc.Metadata {
+				metadata[key] = value
+			}
+			vectors = append(vectors, pineconeVector{ID: doc.ID, Values: doc.Vector, Metadata: metadata})
+		}
+		body := map[string]interface{}{"vectors": vectors, "namespace": collection}
+		if err := p.api.do(ctx, http.MethodPost, "/vectors/upsert", body, nil); err != nil {
+			return fmt.Errorf("error adding vectors to Pinecone namespace %s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+func (p *pinecone) Query(ctx context.Context, collection string, vector []float32, k int) ([]Match, error) {
+	var resp struct {
+		Matches []pineconeVector `json:"matches"`
+	}
+	body := map[string]interface{}{"vector": vector, "topK": k, "includeMetadata": true, "namespace": collection}
+	if err := p.api.do(ctx, http.MethodPost, "/query", body, &resp); err != nil {
+		return nil, fmt.Errorf("error querying Pinecone namespace %s: %w", collection, err)
+	}
+	matches := make([]Match, len(resp.Matches))
+	for i, match := range resp.Matches {
+		text, _ := match.Metadata["text"].(string)
+		matches[i] = Match{
+			Document: Document{ID: match.ID, Text: text, Metadata: stringMap(match.Metadata, "text")},
+			Score:    match.Score,
+		}
+	}
+	return matches, nil
+}
+
+func (p *pinecone) Close() error { return nil }
@@ -0,0 +1,102 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// qdrant is a Qdrant server. Points are identified by a UUID derived from
+// the document ID, which is kept in the payload with the text.
+type qdrant struct {
+	api restClient
+
+	mu      sync.Mutex
+	created map[string]bool // Collections known to exist
+}
+
+func newQdrant(settings config.VectorStoreConfig) *qdrant {
+	headers := map[string]string{}
+	if settings.APIKey != "" {
+		headers["api-key"] = settings.APIKey
+	}
+	return &qdrant{api: newRESTClient(settings.URL, headers), created: make(map[string]bool)}
+}
+
+type qdrantPoint struct {
+	ID      string                 `json:"id"`
+	Vector  []float32              `json:"vector,omitempty"`
+	Payload map[string]interface{} `json:"payload"`
+	Score   float64                `json:"score,omitempty"`
+}
+
+// ensure creates the collection for vectors of size dims if it doesn't exist
+func (q *qdrant) ensure(ctx context.Context, collection string, dims int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.created[collection] {
+		return nil
+	}
+	path := "/collections/" + url.PathEscape(collection)
+	err := q.api.do(ctx, http.MethodGet, path, nil, nil)
+	var status *statusError
+	if errors.As(err, &status) && status.Status == http.StatusNotFound {
+		body := map[string]interface{}{"vectors": map[string]interface{}{"size": dims, "distance": "Cosine"}}
+		err = q.api.do(ctx, http.MethodPut, path, body, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating Qdrant collection %s: %w", collection, err)
+	}
+	q.created[collection] = true
+	return nil
+}
+
+func (q *qdrant) Upsert(ctx context.Context, collection string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	if err := q.ensure(ctx, collection, len(docs[0].Vector)); err != nil {
+		return err
+	}
+	points := make([]qdrantPoint, len(docs))
+	for i, doc := range docs {
+		payload := map[string]interface{}{"doc_id": doc.ID, "text": doc.Text}
+		for key, value := range doc.Metadata {
+			payload[key] = value
+		}
+		points[i] = qdrantPoint{ID: pointID(doc.ID), Vector: doc.Vector, Payload: payload}
+	}
+	path := "/collections/" + url.PathEscape(collection) + "/points?wait=true"
+	if err := q.api.do(ctx, http.MethodPut, path, map[string]interface{}{"points": points}, nil); err != nil {
+		return fmt.Errorf("error adding points to Qdrant collection %s: %w", collection, err)
+	}
+	return nil
+}
+
+func (q *qdrant) Query(ctx context.Context, collection string, vector []float32, k int) ([]Match, error) {
+	var resp struct {
+		Result []qdrantPoint `json:"result"`
+	}
+	body := map[string]interface{}{"vector": vector, "limit": k, "with_payload": true}
+	path := "/collections/" + url.PathEscape(collection) + "/points/search"
+	if err := q.api.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+		return nil, fmt.Errorf("error searching Qdrant collection %s: %w", collection, err)
+	}
+	matches := make([]Match, len(resp.Result))
+	for i, point := range resp.Result {
+		id, _ := point.Payload["doc_id"].(string)
+		text, _ := point.Payload["text"].(string)
+		matches[i] = Match{
+			Document: Document{ID: id, Text: text, Metadata: stringMap(point.Payload, "doc_id", "text")},
+			Score:    point.Score,
+		}
+	}
+	return matches, nil
+}
+
+func (q *qdrant) Close() error { return nil }
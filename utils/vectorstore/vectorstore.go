@@ -0,0 +1,172 @@
+// Package vectorstore keeps text with its embedding vectors in a vector
+// database and finds the texts nearest to a query vector, for the index
+// and retrieve steps of retrieval-augmented workflows.
+//
+// Qdrant, Chroma and Pinecone are reached through their HTTP APIs and
+// pgvector through PostgreSQL. Each store is configured by name under
+// vector_stores in the env config. Collections, or tables for pgvector,
+// are created with cosine distance when the first documents are added;
+// Pinecone indexes must be created beforehand, and collections are
+// namespaces of the index.
+package vectorstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/httpclient"
+)
+
+// Document is a text and its embedding
+type Document struct {
+	ID       string            `json:"id"`
+	Text     string            `json:"text"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Vector   []float32         `json:"-"`
+}
+
+// Match is a document found by a query, with its cosine similarity to the
+// query vector: 1 for the same direction, lower for less similar
+type Match struct {
+	Document
+	Score float64 `json:"score"`
+}
+
+// Store is a vector database
+type Store interface {
+	// Upsert adds documents to a collection, replacing those with the
+	// same IDs, and creates the collection if needed
+	Upsert(ctx context.Context, collection string, docs []Document) error
+	// Query returns the k documents of a collection nearest to vector,
+	// nearest first
+	Query(ctx context.Context, collection string, vector []float32, k int) ([]Match, error)
+	// Close releases the store's connections
+	Close() error
+}
+
+// Open connects to the vector store configured under name in env
+func Open(env *config.EnvConfig, name string) (Store, error) {
+	settings, err := env.VectorStore(name)
+	if err != nil {
+		return nil, err
+	}
+	switch settings.Type {
+	case config.VectorStoreQdrant:
+		return newQdrant(settings), nil
+	case config.VectorStoreChroma:
+		return newChroma(settings), nil
+	case config.VectorStorePinecone:
+		return newPinecone(settings), nil
+	default:
+		db, ok := env.Databases[settings.Database]
+		if !ok {
+			return nil, fmt.Errorf("vector store %q uses database %q, which is not configured in databases", name, settings.Database)
+		}
+		return openPgvector(db)
+	}
+}
+
+// restClient sends JSON requests to a store's HTTP API
+type restClient struct {
+	baseURL string
+	headers map[string]string
+}
+
+func newRESTClient(baseURL string, headers map[string]string) restClient {
+	return restClient{baseURL: strings.TrimRight(baseURL, "/"), headers: headers}
+}
+
+// statusError is the error of a request the store answered with an error
+// status
+type statusError struct {
+	Status int
+	Body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Status, e.Body)
+}
+
+// do sends body, if not nil, as JSON to path and decodes the response into
+// out, if not nil
+func (c restClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := httpclient.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &statusError{Status: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// pointID turns a document ID into the UUID stores that only take UUIDs
+// identify it by. The same ID always gives the same UUID.
+func pointID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	sum[6] = sum[6]&0x0f | 0x50 // Version 5, name-based
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// stringMap converts metadata decoded from JSON to strings
+func stringMap(values map[string]interface{}, skip ...string) map[string]string {
+	metadata := make(map[string]string)
+	for key, value := range values {
+		if contains(skip, key) {
+			continue
+		}
+		if s, ok := value.(string); ok {
+			metadata[key] = s
+		} else {
+			metadata[key] = fmt.Sprint(value)
+		}
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
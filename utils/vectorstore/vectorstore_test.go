@@ -0,0 +1,180 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// request is a request a fake store received
+type request struct {
+	Method, Path, Query string
+	Header              http.Header
+	Body                map[string]interface{}
+}
+
+// fakeServer records requests and answers each path with the JSON in
+// responses, or 404 when it has none
+func fakeServer(t *testing.T, responses map[string]string) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Header: r.Header}
+		json.NewDecoder(r.Body).Decode(&req.Body)
+		requests = append(requests, req)
+		resp, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			http.Error(w, `{"status":"not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(resp))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+var docs = []Document{
+	{ID: "a.md#1", Text: "alpha", Vector: []float32{1, 0}, Metadata: map[string]string{"source": "a.md"}},
+	{ID: "b.md#1", Text: "beta", Vector: []float32{0, 1}},
+}
+
+func TestQdrant(t *testing.T) {
+	server, requests := fakeServer(t, map[string]string{
+		"PUT /collections/kb":        `{"result":true}`,
+		"PUT /collections/kb/points": `{"result":{"status":"completed"}}`,
+		"POST /collections/kb/points/search": `{"result":[
+			{"id":"x","score":0.9,"payload":{"doc_id":"a.md#1","text":"alpha","source":"a.md"}}]}`,
+	})
+	store := newQdrant(config.VectorStoreConfig{Type: config.VectorStoreQdrant, URL: server.URL + "/", APIKey: "secret"})
+	ctx := context.Background()
+	if err := store.Upsert(ctx, "kb", docs); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if err := store.Upsert(ctx, "kb", docs[:1]); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	// The collection is looked up and created once, then points are added
+	var calls []string
+	for _, r := range *requests {
+		calls = append(calls, r.Method+" "+r.Path)
+	}
+	want := []string{"GET /collections/kb", "PUT /collections/kb", "PUT /collections/kb/points", "PUT /collections/kb/points"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("requests = %v, want %v", calls, want)
+	}
+	create := (*requests)[1]
+	if got := create.Body["vectors"]; !reflect.DeepEqual(got, map[string]interface{}{"size": 2.0, "distance": "Cosine"}) {
+		t.Errorf("collection vectors = %v, want size 2 with cosine distance", got)
+	}
+	upsert := (*requests)[2]
+	if upsert.Header.Get("api-key") != "secret" || upsert.Query != "wait=true" {
+		t.Errorf("upsert header api-key = %q, query = %q", upsert.Header.Get("api-key"), upsert.Query)
+	}
+	point := upsert.Body["points"].([]interface{})[0].(map[string]interface{})
+	if point["id"] != pointID("a.md#1") || point["payload"].(map[string]interface{})["doc_id"] != "a.md#1" {
+		t.Errorf("point = %v, want the UUID of the document ID and the ID in the payload", point)
+	}
+
+	matches, err := store.Query(ctx, "kb", []float32{1, 0}, 3)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	wantMatch := Match{Document: Document{ID: "a.md#1", Text: "alpha", Metadata: map[string]string{"source": "a.md"}}, Score: 0.9}
+	if len(matches) != 1 || !reflect.DeepEqual(matches[0], wantMatch) {
+		t.Errorf("Query() = %+v, want %+v", matches, wantMatch)
+	}
+	if limit := (*requests)[4].Body["limit"]; limit != 3.0 {
+		t.Errorf("search limit = %v, want 3", limit)
+	}
+}
+
+func TestChroma(t *testing.T) {
+	server, requests := fakeServer(t, map[string]string{
+		"POST /api/v1/collections":              `{"id":"c-123","name":"kb"}`,
+		"POST /api/v1/collections/c-123/upsert": `true`,
+		"POST /api/v1/collections/c-123/query": `{"ids":[["b.md#1"]],"documents":[["beta"]],
+			"metadatas":[[{}]],"distances":[[0.25]]}`,
+	})
+	store := newChroma(config.VectorStoreConfig{Type: config.VectorStoreChroma, URL: server.URL, APIKey: "secret"})
+	ctx := context.Background()
+	if err := store.Upsert(ctx, "kb", docs); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	matches, err := store.Query(ctx, "kb", []float32{0, 1}, 1)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(*requests) != 3 {
+		t.Fatalf("got %d requests, want the collection opened once", len(*requests))
+	}
+	open := (*requests)[0]
+	if open.Body["get_or_create"] != true || open.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("collection request = %+v", open)
+	}
+	upsert := (*requests)[1].Body
+	if !reflect.DeepEqual(upsert["ids"], []interface{}{"a.md#1", "b.md#1"}) ||
+		!reflect.DeepEqual(upsert["metadatas"], []interface{}{map[string]interface{}{"source": "a.md"}, map[string]interface{}{}}) {
+		t.Errorf("upsert body = %v", upsert)
+	}
+	if len(matches) != 1 || matches[0].ID != "b.md#1" || matches[0].Text != "beta" || matches[0].Score != 0.75 {
+		t.Errorf("Query() = %+v, want b.md#1 with score 1 - distance", matches)
+	}
+}
+
+func TestPinecone(t *testing.T) {
+	server, requests := fakeServer(t, map[string]string{
+		"POST /vectors/upsert": `{"upsertedCount":2}`,
+		"POST /query":          `{"matches":[{"id":"a.md#1","score":0.8,"metadata":{"text":"alpha","source":"a.md"}}]}`,
+	})
+	store := newPinecone(config.VectorStoreConfig{Type: config.VectorStorePinecone, URL: server.URL, APIKey: "secret"})
+	ctx := context.Background()
+	many := make([]Document, pineconeBatch+1)
+	for i := range many {
+		many[i] = Document{ID: fmt.Sprint(i), Text: "t", Vector: []float32{1}}
+	}
+	if err := store.Upsert(ctx, "kb", many); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("got %d upsert requests for %d vectors, want 2", len(*requests), len(many))
+	}
+	first := (*requests)[0]
+	if first.Header.Get("Api-Key") != "secret" || first.Body["namespace"] != "kb" {
+		t.Errorf("upsert request = %+v, want the key and the collection as namespace", first)
+	}
+
+	matches, err := store.Query(ctx, "kb", []float32{1, 0}, 2)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	query := (*requests)[2].Body
+	if query["topK"] != 2.0 || query["includeMetadata"] != true || query["namespace"] != "kb" {
+		t.Errorf("query body = %v", query)
+	}
+	want := Match{Document: Document{ID: "a.md#1", Text: "alpha", Metadata: map[string]string{"source": "a.md"}}, Score: 0.8}
+	if len(matches) != 1 || !reflect.DeepEqual(matches[0], want) {
+		t.Errorf("Query() = %+v, want %+v", matches, want)
+	}
+}
+
+func TestVectorLiteral(t *testing.T) {
+	if got := vectorLiteral([]float32{1, -0.5, 0.1}); got != "[1,-0.5,0.1]" {
+		t.Errorf("vectorLiteral() = %s", got)
+	}
+}
+
+func TestPointID(t *testing.T) {
+	id := pointID("a.md#1")
+	if id != pointID("a.md#1") || id == pointID("a.md#2") {
+		t.Errorf("pointID() should be stable and differ between documents")
+	}
+	if len(id) != 36 || id[14] != '5' {
+		t.Errorf("pointID() = %s, want a version 5 UUID", id)
+	}
+}
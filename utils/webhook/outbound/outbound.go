@@ -0,0 +1,144 @@
+// Package outbound signs JSON bodies and posts them to webhook URLs,
+// retrying failed deliveries. It is the transport of run notifications and
+// of webhook outputs.
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Comanda-Event"
+	DeliveryHeader  = "X-Comanda-Delivery" // Unique per delivery, the same for its retries
+	TimestampHeader = "X-Comanda-Timestamp"
+	SignatureHeader = "X-Comanda-Signature" // sha256=<hex HMAC of "<timestamp>.<event>.<body>">
+)
+
+// CheckURL checks that a webhook URL is an absolute http or https URL whose
+// host is in allowedHosts, when that list is not empty
+func CheckURL(rawURL string, allowedHosts []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL '%s': use an absolute http or https URL", rawURL)
+	}
+	if len(allowedHosts) == 0 {
+		return nil
+	}
+	for _, host := range allowedHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook host '%s' is not allowed", u.Hostname())
+}
+
+// RedactURL returns a URL without its credentials, path and query, which
+// often hold the webhook's secret, such as Zapier's catch hook IDs
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "***"
+	}
+	return u.Scheme + "://" + u.Host + "/..."
+}
+
+// Sign returns the signature of a payload sent at timestamp for event. The
+// event is signed too, so a delivery can't be replayed as another event.
+func Sign(secret string, timestamp int64, event string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s.", timestamp, event)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender delivers JSON bodies, retrying failed deliveries with increasing
+// waits
+type Sender struct {
+	Client   *http.Client
+	Secret   string        // Signs deliveries; they are unsigned when empty
+	Attempts int           // Deliveries tried before giving up
+	Backoff  time.Duration // Wait before the first retry, doubled for each one after
+}
+
+// NewSender returns a sender with a 10 second timeout that tries each
+// delivery three times
+func NewSender(secret string) *Sender {
+	return &Sender{
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		Secret:   secret,
+		Attempts: 3,
+		Backoff:  2 * time.Second,
+	}
+}
+
+// Post posts a JSON body to url with extra headers, signed when the sender
+// has a secret. Responses other than 2xx, except 4xx responses that
+// retrying won't change, are retried.
+func (s *Sender) Post(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	wait := s.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.deliver(ctx, url, body, headers)
+		if err == nil || !retry || attempt >= s.Attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// deliver makes one delivery, reporting whether a failure is worth
+// retrying. Errors show the URL redacted, as it may hold a secret.
+func (s *Sender) deliver(ctx context.Context, rawURL string, body []byte, headers map[string]string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("error creating webhook request for %s: %w", RedactURL(rawURL), unwrapURLError(err))
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "comanda-webhook")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.Secret, timestamp, req.Header.Get(EventHeader), body))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("webhook delivery to %s failed: %w", RedactURL(rawURL), unwrapURLError(err))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return retry, fmt.Errorf("webhook delivery to %s failed: %s", RedactURL(rawURL), resp.Status)
+}
+
+// unwrapURLError drops the URL that net/http puts in its errors
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
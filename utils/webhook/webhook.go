@@ -0,0 +1,117 @@
+// Package webhook posts signed JSON notifications about runs to URLs that
+// downstream systems register, and verifies signed payloads.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"github.com/kris-hansen/comanda/utils/webhook/outbound"
+)
+
+// Events a webhook can subscribe to
+const (
+	EventCompleted      = "completed"       // The run finished successfully
+	EventFailed         = "failed"          // The run stopped with an error or was canceled
+	EventApprovalNeeded = "approval_needed" // The run is waiting at an approval step
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = outbound.EventHeader
+	DeliveryHeader  = outbound.DeliveryHeader // The run ID and event, unique per notification
+	TimestampHeader = outbound.TimestampHeader
+	SignatureHeader = outbound.SignatureHeader // sha256=<hex HMAC of "<timestamp>.<event>.<body>">
+)
+
+// Payload is the JSON body posted to webhooks
+type Payload struct {
+	Event  string       `json:"event"`
+	Time   time.Time    `json:"time"`
+	Run    *history.Run `json:"run"`
+	Output string       `json:"output,omitempty"` // Final output of a completed run
+
+	// Approval is what the run waits to have approved, for approval_needed
+	Approval *processor.ApprovalRequest `json:"approval,omitempty"`
+}
+
+// ValidEvent reports whether event is one webhooks can subscribe to
+func ValidEvent(event string) bool {
+	return event == EventCompleted || event == EventFailed || event == EventApprovalNeeded
+}
+
+// Wants reports whether a subscription to events includes event. An empty
+// subscription includes every event.
+func Wants(events []string, event string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL checks that a webhook URL is an absolute http or https URL whose
+// host is in allowedHosts, when that list is not empty
+func CheckURL(rawURL string, allowedHosts []string) error {
+	return outbound.CheckURL(rawURL, allowedHosts)
+}
+
+// Sign returns the signature of a payload sent at timestamp for event
+func Sign(secret string, timestamp int64, event string, body []byte) string {
+	return outbound.Sign(secret, timestamp, event, body)
+}
+
+// Verify checks a delivery's signature and that its timestamp is within
+// tolerance of now, so captured deliveries cannot be replayed later
+func Verify(secret, timestamp, event, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid webhook timestamp")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhook timestamp is too old")
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, event, body))) {
+		return errors.New("invalid webhook signature")
+	}
+	return nil
+}
+
+// Sender delivers payloads, retrying failed deliveries with increasing waits
+type Sender struct {
+	*outbound.Sender
+}
+
+// NewSender returns a sender with a 10 second timeout that tries each
+// delivery three times
+func NewSender(secret string) *Sender {
+	return &Sender{outbound.NewSender(secret)}
+}
+
+// Send posts the payload to url. Responses other than 2xx, except 4xx
+// responses that retrying won't change, are retried.
+func (s *Sender) Send(ctx context.Context, url string, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %w", err)
+	}
+	headers := map[string]string{EventHeader: payload.Event}
+	if payload.Run != nil {
+		headers[DeliveryHeader] = payload.Run.ID + "." + payload.Event
+		if payload.Approval != nil {
+			headers[DeliveryHeader] += "." + payload.Approval.Step
+		}
+	}
+	return s.Post(ctx, url, body, headers)
+}
@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/history"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"completed"}`)
+	sig := Sign("secret", now.Unix(), "completed", body)
+
+	assert.NoError(t, Verify("secret", "1700000000", "completed", sig, body, 5*time.Minute, now))
+	assert.Error(t, Verify("other", "1700000000", "completed", sig, body, 5*time.Minute, now))
+	assert.Error(t, Verify("secret", "1700000000", "completed", sig, []byte(`{}`), 5*time.Minute, now))
+	assert.Error(t, Verify("secret", "1700000000", "failed", sig, body, 5*time.Minute, now))
+	assert.Error(t, Verify("secret", "1700000000", "completed", sig, body, 5*time.Minute, now.Add(time.Hour)))
+	assert.Error(t, Verify("secret", "soon", "completed", sig, body, 5*time.Minute, now))
+}
+
+func TestCheckURL(t *testing.T) {
+	assert.NoError(t, CheckURL("https://hooks.example.com/comanda", nil))
+	assert.NoError(t, CheckURL("https://Hooks.Example.com:8443/x", []string{"hooks.example.com"}))
+	assert.Error(t, CheckURL("https://other.example.com/x", []string{"hooks.example.com"}))
+	assert.Error(t, CheckURL("ftp://hooks.example.com/x", nil))
+	assert.Error(t, CheckURL("/relative", nil))
+}
+
+func TestSendRetriesAndSigns(t *testing.T) {
+	var calls int32
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer srv.Close()
+
+	sender := NewSender("secret")
+	sender.Backoff = time.Millisecond
+	run := &history.Run{ID: "20240101-000000-abcd", Status: history.StatusSucceeded}
+	err := sender.Send(context.Background(), srv.URL, Payload{Event: EventCompleted, Time: time.Now(), Run: run, Output: "done"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, EventCompleted, header.Get(EventHeader))
+	assert.Equal(t, run.ID+".completed", header.Get(DeliveryHeader))
+	assert.NoError(t, Verify("secret", header.Get(TimestampHeader), header.Get(EventHeader), header.Get(SignatureHeader), body, time.Minute, time.Now()))
+}
+
+func TestSendDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	sender := NewSender("")
+	sender.Backoff = time.Millisecond
+	err := sender.Send(context.Background(), srv.URL, Payload{Event: EventFailed})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,283 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/chunker"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// Agent leases runs from a server and executes them
+type Agent struct {
+	Client    *Client
+	Name      string
+	Labels    []string
+	EnvConfig *config.EnvConfig // Providers the runs' steps use
+	Dir       string            // Each run works in its own directory under Dir, removed once it's reported
+	Slots     int               // Runs executed at once; 1 when unset
+	Heartbeat time.Duration     // How often a running run is reported; 15s when unset
+	Logf      func(format string, args ...interface{})
+}
+
+// retryDelay is how long an agent waits after the server can't be reached
+const retryDelay = 5 * time.Second
+
+// Run leases and executes runs until ctx is done. Runs in progress finish
+// before it returns.
+func (a *Agent) Run(ctx context.Context) error {
+	slots := a.Slots
+	if slots < 1 {
+		slots = 1
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, slots)
+	for i := 0; i < slots; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.work(ctx); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// work leases runs one at a time
+func (a *Agent) work(ctx context.Context) error {
+	for ctx.Err() == nil {
+		lease, err := a.Client.Lease(ctx, &LeaseRequest{Worker: a.Name, Labels: a.Labels})
+		if status.Code(err) == codes.Unauthenticated {
+			return fmt.Errorf("server refused the worker: %w", err)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				a.logf("Error leasing a run: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryDelay):
+				}
+			}
+			continue
+		}
+		if lease.RunID == "" {
+			continue
+		}
+		a.logf("Running %s of workflow %s", lease.RunID, lease.Workflow)
+		if err := a.execute(lease); err != nil {
+			a.logf("Run %s failed: %v", lease.RunID, err)
+		} else {
+			a.logf("Run %s finished", lease.RunID)
+		}
+	}
+	return nil
+}
+
+// execute runs a leased workflow and reports its result. The run isn't
+// stopped when the agent is: the server is still waiting for it.
+func (a *Agent) execute(lease *Lease) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &reporter{agent: a, runID: lease.RunID, cancel: cancel}
+
+	dataDir := filepath.Join(a.Dir, lease.RunID)
+	defer os.RemoveAll(dataDir)
+	output, runErr := a.process(ctx, lease, dataDir, r)
+
+	done := &Report{Worker: a.Name, RunID: lease.RunID, Done: true, Output: output}
+	if runErr != nil {
+		done.Error = runErr.Error()
+	} else {
+		done.Files = collectOutputs(filepath.Join(dataDir, lease.RuntimeDir), r.outputs())
+	}
+	if _, err := a.Client.Report(context.Background(), done); err != nil {
+		return fmt.Errorf("error reporting the result: %w", err)
+	}
+	return runErr
+}
+
+// process runs the leased workflow in dataDir
+func (a *Agent) process(ctx context.Context, lease *Lease, dataDir string, r *reporter) (string, error) {
+	runtimeDir := filepath.Join(dataDir, lease.RuntimeDir)
+	for _, file := range lease.Files {
+		path, err := within(runtimeDir, file.Path)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, file.Content, 0644); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(runtimeDir, 0755); err != nil {
+		return "", err
+	}
+
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal([]byte(lease.Content), &dslConfig); err != nil {
+		return "", fmt.Errorf("error parsing workflow: %w", err)
+	}
+	applyLimits(&dslConfig, lease.MaxChunks, lease.MaxTokens)
+
+	proc := processor.NewProcessor(&dslConfig, a.EnvConfig, &config.ServerConfig{DataDir: dataDir}, false, lease.RuntimeDir)
+	proc.SetCredentials(lease.Credentials)
+	proc.SetStepRecorder(r)
+	proc.SetProgressWriter(r)
+	proc.SetContext(ctx)
+	proc.SetLastOutput(lease.Input)
+	proc.DisableSpinner()
+
+	stop := r.heartbeat(a.heartbeat())
+	defer stop()
+	if err := proc.Process(); err != nil {
+		return "", err
+	}
+	return proc.LastOutput(), nil
+}
+
+func (a *Agent) heartbeat() time.Duration {
+	if a.Heartbeat > 0 {
+		return a.Heartbeat
+	}
+	return 15 * time.Second
+}
+
+func (a *Agent) logf(format string, args ...interface{}) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
+
+// applyLimits lowers step settings over the server's run limits, as the
+// server does when it admits a run with the downgrade policy
+func applyLimits(dslConfig *processor.DSLConfig, maxChunks, maxTokens int) {
+	limit := func(cfg *processor.StepConfig) {
+		if maxChunks > 0 && cfg.Chunk != nil && (cfg.Chunk.MaxChunks <= 0 && chunker.DefaultMaxChunks > maxChunks || cfg.Chunk.MaxChunks > maxChunks) {
+			cfg.Chunk.MaxChunks = maxChunks
+		}
+		if maxTokens > 0 && cfg.MaxOutputTokens > maxTokens {
+			cfg.MaxOutputTokens = maxTokens
+		}
+	}
+	for i := range dslConfig.Steps {
+		limit(&dslConfig.Steps[i].Config)
+	}
+	for _, steps := range dslConfig.ParallelSteps {
+		for i := range steps {
+			limit(&steps[i].Config)
+		}
+	}
+	for name, cfg := range dslConfig.Defer {
+		limit(&cfg)
+		dslConfig.Defer[name] = cfg
+	}
+}
+
+// collectOutputs reads the files a run's steps wrote into runtimeDir
+func collectOutputs(runtimeDir string, outputs []string) []File {
+	var files []File
+	seen := make(map[string]bool)
+	for _, output := range outputs {
+		if output == "STDOUT" || filepath.IsAbs(output) || seen[output] {
+			continue
+		}
+		seen[output] = true
+		path, err := within(runtimeDir, output)
+		if err != nil {
+			continue
+		}
+		if content, err := os.ReadFile(path); err == nil {
+			files = append(files, File{Path: filepath.ToSlash(filepath.Clean(output)), Content: content})
+		}
+	}
+	return files
+}
+
+// within returns name joined to dir, refusing names that leave it
+func within(dir, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file %s is outside the run's directory", name)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// reporter sends a leased run's steps and progress to the server
+type reporter struct {
+	agent  *Agent
+	runID  string
+	cancel context.CancelFunc // Stops the run when the server cancels it
+
+	mu    sync.Mutex
+	steps []string // Outputs of the finished steps
+}
+
+// RecordStep reports a finished step
+func (r *reporter) RecordStep(record processor.StepRecord) {
+	r.mu.Lock()
+	r.steps = append(r.steps, record.Outputs...)
+	r.mu.Unlock()
+	step := StepFromRecord(record)
+	r.send(&Report{Step: &step})
+}
+
+// WriteProgress reports a progress message
+func (r *reporter) WriteProgress(update processor.ProgressUpdate) error {
+	if update.Message != "" {
+		r.send(&Report{Progress: update.Message})
+	}
+	return nil
+}
+
+// heartbeat reports the run every interval until stop is called, so the
+// server knows the worker is still working on it
+func (r *reporter) heartbeat(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r.send(&Report{})
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+func (r *reporter) send(report *Report) {
+	report.Worker, report.RunID = r.agent.Name, r.runID
+	reply, err := r.agent.Client.Report(context.Background(), report)
+	if err != nil {
+		r.agent.logf("Error reporting run %s: %v", r.runID, err)
+		return
+	}
+	if reply.Cancel {
+		r.cancel()
+	}
+}
+
+func (r *reporter) outputs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.steps
+}
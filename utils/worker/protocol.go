@@ -0,0 +1,244 @@
+// Package worker lets remote agents execute the server's runs. Workers join
+// the server over gRPC and lease queued runs of workflows whose runs_on
+// labels they all carry, such as a GPU box serving Ollama models. They run
+// each workflow with their own providers and report its steps, progress and
+// result back, so the server records the run as if it ran it itself.
+//
+// The service is described by hand rather than generated from a .proto
+// file, and its messages are encoded as JSON.
+package worker
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the gRPC service workers call
+const ServiceName = "comanda.worker.v1.Workers"
+
+// MaxMessageSize caps a message, which carries a run's input and output
+// files
+const MaxMessageSize = 64 << 20
+
+// LeaseRequest asks for a run to execute
+type LeaseRequest struct {
+	Worker string   `json:"worker"` // Name the worker reports under
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Lease is a run handed to a worker. RunID is empty when no run was ready
+// before the server stopped waiting.
+type Lease struct {
+	RunID      string `json:"run_id,omitempty"`
+	Workflow   string `json:"workflow,omitempty"`
+	Content    string `json:"content,omitempty"` // The workflow with its parameters bound
+	Input      string `json:"input,omitempty"`
+	RuntimeDir string `json:"runtime_dir,omitempty"`
+	Files      []File `json:"files,omitempty"`      // Input files from the server, relative to the runtime directory
+	MaxChunks  int    `json:"max_chunks,omitempty"` // Run limits the server lowers step settings to
+	MaxTokens  int    `json:"max_tokens,omitempty"`
+	// Credential set of the worker's env config the run uses instead of the
+	// one its workflow names
+	Credentials string `json:"credentials,omitempty"`
+}
+
+// File is a file sent with a lease or a result
+type File struct {
+	Path    string `json:"path"`
+	Content []byte `json:"content"`
+}
+
+// Step is a finished step of a leased run
+type Step struct {
+	Name             string    `json:"name"`
+	Model            string    `json:"model,omitempty"`
+	Provider         string    `json:"provider,omitempty"`
+	Outputs          []string  `json:"outputs,omitempty"`
+	Response         string    `json:"response,omitempty"`
+	Started          time.Time `json:"started"`
+	Finished         time.Time `json:"finished"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// StepFromRecord describes a step the processor recorded
+func StepFromRecord(r processor.StepRecord) Step {
+	step := Step{
+		Name:             r.Name,
+		Model:            r.Model,
+		Provider:         r.Provider,
+		Outputs:          r.Outputs,
+		Response:         r.Response,
+		Started:          r.Started,
+		Finished:         r.Finished,
+		PromptTokens:     r.Metrics.PromptTokens,
+		CompletionTokens: r.Metrics.CompletionTokens,
+	}
+	if r.Err != nil {
+		step.Error = r.Err.Error()
+	}
+	return step
+}
+
+// Record returns the step as the processor records it
+func (s Step) Record() processor.StepRecord {
+	r := processor.StepRecord{
+		Name:     s.Name,
+		Model:    s.Model,
+		Provider: s.Provider,
+		Outputs:  s.Outputs,
+		Response: s.Response,
+		Started:  s.Started,
+		Finished: s.Finished,
+		Metrics:  processor.PerformanceMetrics{PromptTokens: s.PromptTokens, CompletionTokens: s.CompletionTokens},
+	}
+	if s.Error != "" {
+		r.Err = remoteError(s.Error)
+	}
+	return r
+}
+
+// remoteError is an error reported by a worker
+type remoteError string
+
+func (e remoteError) Error() string { return string(e) }
+
+// Report tells the server how a leased run is going. Workers send one for
+// each finished step, with progress messages, periodically to show they are
+// still working, and once with Done set when the run ends.
+type Report struct {
+	Worker   string `json:"worker"`
+	RunID    string `json:"run_id"`
+	Step     *Step  `json:"step,omitempty"`
+	Progress string `json:"progress,omitempty"`
+	Done     bool   `json:"done,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Files    []File `json:"files,omitempty"` // Files the run's steps wrote, relative to the runtime directory
+}
+
+// ReportReply answers a report
+type ReportReply struct {
+	Cancel bool `json:"cancel,omitempty"` // Stop the run: it was cancelled or is no longer leased to the worker
+}
+
+// Server hands out runs and takes reports about them
+type Server interface {
+	Lease(ctx context.Context, req *LeaseRequest) (*Lease, error)
+	Report(ctx context.Context, report *Report) (*ReportReply, error)
+}
+
+// jsonCodec encodes messages as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+// serviceDesc describes the service to gRPC
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Lease", Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(LeaseRequest)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req any) (any, error) { return srv.(Server).Lease(ctx, req.(*LeaseRequest)) }
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Lease"}, handler)
+		}},
+		{MethodName: "Report", Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			report := new(Report)
+			if err := dec(report); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req any) (any, error) { return srv.(Server).Report(ctx, req.(*Report)) }
+			if interceptor == nil {
+				return handler(ctx, report)
+			}
+			return interceptor(ctx, report, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Report"}, handler)
+		}},
+	},
+}
+
+// NewServer returns a gRPC server serving impl to workers presenting token
+func NewServer(impl Server, token string, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ForceServerCodec(jsonCodec{}),
+		grpc.MaxRecvMsgSize(MaxMessageSize),
+		grpc.MaxSendMsgSize(MaxMessageSize),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			var presented string
+			if values := md.Get("authorization"); len(values) > 0 {
+				presented = strings.TrimPrefix(values[0], "Bearer ")
+			}
+			if presented == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				return nil, status.Error(codes.Unauthenticated, "invalid worker token")
+			}
+			return handler(ctx, req)
+		}),
+	)
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&serviceDesc, impl)
+	return s
+}
+
+// Client calls the server's worker service
+type Client struct {
+	conn  *grpc.ClientConn
+	token string
+}
+
+// NewClient returns a client of the server at target, such as
+// comanda.example.com:9090, joining with token. opts set the connection's
+// transport credentials.
+func NewClient(target, token string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append(opts, grpc.WithDefaultCallOptions(
+		grpc.ForceCodec(jsonCodec{}),
+		grpc.MaxCallRecvMsgSize(MaxMessageSize),
+		grpc.MaxCallSendMsgSize(MaxMessageSize),
+	))
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, token: token}, nil
+}
+
+// Lease asks for a run, waiting until one is ready or the server gives up
+func (c *Client) Lease(ctx context.Context, req *LeaseRequest) (*Lease, error) {
+	lease := new(Lease)
+	err := c.conn.Invoke(c.authorize(ctx), "/"+ServiceName+"/Lease", req, lease)
+	return lease, err
+}
+
+// Report sends a report about a leased run
+func (c *Client) Report(ctx context.Context, report *Report) (*ReportReply, error) {
+	reply := new(ReportReply)
+	err := c.conn.Invoke(c.authorize(ctx), "/"+ServiceName+"/Report", report, reply)
+	return reply, err
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) authorize(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+}
@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// fakeServer leases one run and keeps the reports it gets
+type fakeServer struct {
+	lease   *Lease
+	reports chan *Report
+}
+
+func (f *fakeServer) Lease(ctx context.Context, req *LeaseRequest) (*Lease, error) {
+	if f.lease == nil {
+		return &Lease{}, nil
+	}
+	lease := f.lease
+	f.lease = nil
+	return lease, nil
+}
+
+func (f *fakeServer) Report(ctx context.Context, report *Report) (*ReportReply, error) {
+	f.reports <- report
+	return &ReportReply{}, nil
+}
+
+// serve starts a worker service for impl and returns a client of it
+func serve(t *testing.T, impl Server, token string) *Client {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(impl, "secret")
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+	client, err := NewClient(ln.Addr().String(), token, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	impl := &fakeServer{lease: &Lease{RunID: "r1", Files: []File{{Path: "in.txt", Content: []byte("hi")}}}, reports: make(chan *Report, 1)}
+	client := serve(t, impl, "secret")
+
+	lease, err := client.Lease(context.Background(), &LeaseRequest{Worker: "w1", Labels: []string{"gpu"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.RunID != "r1" || len(lease.Files) != 1 || string(lease.Files[0].Content) != "hi" {
+		t.Fatalf("lease = %+v", lease)
+	}
+
+	started := time.Now().Truncate(time.Second)
+	step := Step{Name: "draft", Model: "gpt-4o", Started: started, PromptTokens: 3, Error: "boom"}
+	if _, err := client.Report(context.Background(), &Report{Worker: "w1", RunID: "r1", Step: &step}); err != nil {
+		t.Fatal(err)
+	}
+	got := (<-impl.reports).Step.Record()
+	if got.Name != "draft" || !got.Started.Equal(started) || got.Metrics.PromptTokens != 3 || got.Err == nil || got.Err.Error() != "boom" {
+		t.Errorf("step record = %+v", got)
+	}
+}
+
+func TestClientWrongToken(t *testing.T) {
+	client := serve(t, &fakeServer{}, "wrong")
+	_, err := client.Lease(context.Background(), &LeaseRequest{Worker: "w1"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Lease() error = %v, want Unauthenticated", err)
+	}
+
+	// An agent gives up instead of retrying
+	agent := &Agent{Client: client, Name: "w1", Dir: t.TempDir()}
+	if err := agent.Run(context.Background()); err == nil {
+		t.Fatal("Run() = nil, want an error")
+	}
+}
+
+func TestApplyLimits(t *testing.T) {
+	dslConfig := processor.DSLConfig{
+		Steps: []processor.Step{
+			{Name: "big", Config: processor.StepConfig{MaxOutputTokens: 5000, Chunk: &processor.ChunkConfig{MaxChunks: 50}}},
+			{Name: "small", Config: processor.StepConfig{MaxOutputTokens: 100, Chunk: &processor.ChunkConfig{MaxChunks: 2}}},
+		},
+		Defer: map[string]processor.StepConfig{"later": {MaxOutputTokens: 5000}},
+	}
+	applyLimits(&dslConfig, 10, 1000)
+
+	if cfg := dslConfig.Steps[0].Config; cfg.MaxOutputTokens != 1000 || cfg.Chunk.MaxChunks != 10 {
+		t.Errorf("big step = %d tokens, %d chunks", cfg.MaxOutputTokens, cfg.Chunk.MaxChunks)
+	}
+	if cfg := dslConfig.Steps[1].Config; cfg.MaxOutputTokens != 100 || cfg.Chunk.MaxChunks != 2 {
+		t.Errorf("small step = %d tokens, %d chunks", cfg.MaxOutputTokens, cfg.Chunk.MaxChunks)
+	}
+	if cfg := dslConfig.Defer["later"]; cfg.MaxOutputTokens != 1000 {
+		t.Errorf("deferred step = %d tokens", cfg.MaxOutputTokens)
+	}
+}
+
+func TestCollectOutputs(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "out"), 0755)
+	os.WriteFile(filepath.Join(dir, "out", "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "..", "escaped.txt"), []byte("x"), 0644)
+
+	files := collectOutputs(dir, []string{"STDOUT", "out/a.txt", "out/a.txt", "../escaped.txt", "missing.txt", "/etc/passwd"})
+	if len(files) != 1 || files[0].Path != "out/a.txt" || string(files[0].Content) != "a" {
+		t.Fatalf("collectOutputs() = %+v", files)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"a.txt":        true,
+		"sub/../b.txt": true,
+		"..":           false,
+		"../a.txt":     false,
+		"sub/../../a":  false,
+		"/abs.txt":     false,
+	} {
+		_, err := within("/data", name)
+		if (err == nil) != ok {
+			t.Errorf("within(%q) error = %v", name, err)
+		}
+	}
+}
+
+func TestReporterStopsCancelledRun(t *testing.T) {
+	impl := &cancellingServer{}
+	client := serve(t, impl, "secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &reporter{agent: &Agent{Client: client, Name: "w1"}, runID: "r1", cancel: cancel}
+
+	r.RecordStep(processor.StepRecord{Name: "draft", Outputs: []string{"out.txt"}, Err: errors.New("boom")})
+	if ctx.Err() == nil {
+		t.Fatal("run was not cancelled")
+	}
+	if outputs := r.outputs(); len(outputs) != 1 || outputs[0] != "out.txt" {
+		t.Errorf("outputs() = %v", outputs)
+	}
+}
+
+// cancellingServer tells workers to stop every run
+type cancellingServer struct{}
+
+func (cancellingServer) Lease(ctx context.Context, req *LeaseRequest) (*Lease, error) {
+	return &Lease{}, nil
+}
+
+func (cancellingServer) Report(ctx context.Context, report *Report) (*ReportReply, error) {
+	return &ReportReply{Cancel: true}, nil
+}
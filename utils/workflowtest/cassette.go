@@ -0,0 +1,215 @@
+package workflowtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// Interaction is one recorded provider request and its response
+type Interaction struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	Prompt     string `json:"prompt"`
+	File       string `json:"file,omitempty"`        // Base name of the attached file
+	FileSHA256 string `json:"file_sha256,omitempty"` // Hash of the attached file's contents
+	Response   string `json:"response"`
+}
+
+// key identifies the request an interaction answers. Attached files match by
+// contents, since inputs such as STDIN are passed as temporary files.
+func (i Interaction) key() string {
+	sum := sha256.Sum256([]byte(i.Model + "\x00" + i.Prompt + "\x00" + i.FileSHA256))
+	return hex.EncodeToString(sum[:])
+}
+
+// Cassette holds the provider interactions of one workflow run. Identical
+// requests are answered in the order they were recorded, repeating the last
+// response once they run out.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+
+	mu     sync.Mutex
+	played map[string]int // Request key -> responses already replayed
+}
+
+// LoadCassette reads a cassette file
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("error parsing cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path, creating its directory if needed
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create test data directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing cassette: %w", err)
+	}
+	return nil
+}
+
+// add records an interaction
+func (c *Cassette) add(i Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, i)
+}
+
+// replay returns the next recorded response to a request
+func (c *Cassette) replay(request Interaction) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := request.key()
+	var matches []string
+	for _, i := range c.Interactions {
+		if i.key() == key {
+			matches = append(matches, i.Response)
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no recorded response for model %s and prompt %q; re-record with --mode record", request.Model, truncate(request.Prompt, 80))
+	}
+	if c.played == nil {
+		c.played = make(map[string]int)
+	}
+	n := c.played[key]
+	c.played[key]++
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	return matches[n], nil
+}
+
+// providerName returns the provider recorded for a model, if any
+func (c *Cassette) providerName(modelName string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, i := range c.Interactions {
+		if i.Model == modelName {
+			return i.Provider
+		}
+	}
+	return ""
+}
+
+// request builds the interaction for a prompt and optional file
+func request(provider, modelName, prompt string, file *models.FileInput) (Interaction, error) {
+	i := Interaction{Provider: provider, Model: modelName, Prompt: prompt}
+	if file != nil {
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return i, fmt.Errorf("error reading file %s: %w", file.Path, err)
+		}
+		sum := sha256.Sum256(data)
+		i.File = filepath.Base(file.Path)
+		i.FileSHA256 = hex.EncodeToString(sum[:])
+	}
+	return i, nil
+}
+
+// truncate shortens s to at most n bytes for error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// replayProvider answers prompts from a cassette
+type replayProvider struct {
+	name     string
+	cassette *Cassette
+}
+
+func (r *replayProvider) Name() string                        { return r.name }
+func (r *replayProvider) SupportsModel(modelName string) bool { return true }
+func (r *replayProvider) Configure(apiKey string) error       { return nil }
+func (r *replayProvider) SetVerbose(verbose bool)             {}
+
+func (r *replayProvider) SendPrompt(modelName, prompt string) (string, error) {
+	req, _ := request(r.name, modelName, prompt, nil)
+	return r.cassette.replay(req)
+}
+
+func (r *replayProvider) SendPromptWithFile(modelName, prompt string, file models.FileInput) (string, error) {
+	req, err := request(r.name, modelName, prompt, &file)
+	if err != nil {
+		return "", err
+	}
+	return r.cassette.replay(req)
+}
+
+// recordProvider passes prompts to a real provider and records the responses
+type recordProvider struct {
+	models.Provider
+	cassette *Cassette
+}
+
+func (r *recordProvider) SendPrompt(modelName, prompt string) (string, error) {
+	response, err := r.Provider.SendPrompt(modelName, prompt)
+	if err == nil {
+		req, _ := request(r.Name(), modelName, prompt, nil)
+		req.Response = response
+		r.cassette.add(req)
+	}
+	return response, err
+}
+
+func (r *recordProvider) SendPromptWithFile(modelName, prompt string, file models.FileInput) (string, error) {
+	response, err := r.Provider.SendPromptWithFile(modelName, prompt, file)
+	if err == nil {
+		if req, reqErr := request(r.Name(), modelName, prompt, &file); reqErr == nil {
+			req.Response = response
+			r.cassette.add(req)
+		}
+	}
+	return response, err
+}
+
+// mockProvider returns a deterministic response derived from each request,
+// for testing a workflow's plumbing without recorded responses
+type mockProvider struct{}
+
+func (m *mockProvider) Name() string                        { return "mock" }
+func (m *mockProvider) SupportsModel(modelName string) bool { return true }
+func (m *mockProvider) Configure(apiKey string) error       { return nil }
+func (m *mockProvider) SetVerbose(verbose bool)             {}
+
+func (m *mockProvider) SendPrompt(modelName, prompt string) (string, error) {
+	req, _ := request("mock", modelName, prompt, nil)
+	return mockResponse(req), nil
+}
+
+func (m *mockProvider) SendPromptWithFile(modelName, prompt string, file models.FileInput) (string, error) {
+	req, err := request("mock", modelName, prompt, &file)
+	if err != nil {
+		return "", err
+	}
+	return mockResponse(req), nil
+}
+
+// mockResponse names the model and a short hash of the request
+func mockResponse(req Interaction) string {
+	return fmt.Sprintf("mock response from %s (request %s)", req.Model, req.key()[:12])
+}
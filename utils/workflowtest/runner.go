@@ -0,0 +1,374 @@
+// Package workflowtest runs workflows against recorded or mock provider
+// responses and checks their step outputs against golden files and
+// assertions.
+//
+// The test data for a workflow foo.yaml lives next to it in testdata/foo/:
+//
+//	cassette.json     recorded provider responses, written in record mode
+//	golden/<step>.txt expected output of each step, written with Update
+//	assertions.yaml   optional checks on step outputs, keyed by step name
+package workflowtest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Provider modes
+const (
+	ModeReplay = "replay" // Answer prompts from the cassette
+	ModeRecord = "record" // Call the configured providers and write the cassette
+	ModeMock   = "mock"   // Answer prompts with deterministic mock responses
+)
+
+// Step check results
+const (
+	StatusPass    = "pass"
+	StatusFail    = "fail"
+	StatusUpdated = "updated"
+)
+
+// Options controls how a workflow test runs
+type Options struct {
+	Mode      string
+	Update    bool              // Rewrite golden files instead of comparing against them
+	EnvConfig *config.EnvConfig // Provider configuration, needed in record mode
+	Verbose   bool
+}
+
+// StepResult is the outcome of checking one step's output
+type StepResult struct {
+	Name    string
+	Status  string
+	Message string // Why the step failed, or what was updated
+}
+
+// Result is the outcome of testing one workflow
+type Result struct {
+	Workflow string
+	Steps    []StepResult
+	Err      error // The workflow failed to run
+}
+
+// Passed reports whether the workflow ran and every step check passed
+func (r *Result) Passed() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, s := range r.Steps {
+		if s.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// Assertion is a check on a step's output. Every field that is set must hold.
+type Assertion struct {
+	Contains    string `yaml:"contains"`
+	NotContains string `yaml:"not_contains"`
+	Matches     string `yaml:"matches"` // Regular expression
+	Equals      string `yaml:"equals"`
+}
+
+// Check returns an error describing the first condition output fails
+func (a Assertion) Check(output string) error {
+	if a.Contains != "" && !strings.Contains(output, a.Contains) {
+		return fmt.Errorf("output does not contain %q", a.Contains)
+	}
+	if a.NotContains != "" && strings.Contains(output, a.NotContains) {
+		return fmt.Errorf("output contains %q", a.NotContains)
+	}
+	if a.Matches != "" {
+		re, err := regexp.Compile(a.Matches)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", a.Matches, err)
+		}
+		if !re.MatchString(output) {
+			return fmt.Errorf("output does not match %q", a.Matches)
+		}
+	}
+	if a.Equals != "" && strings.TrimSpace(output) != strings.TrimSpace(a.Equals) {
+		return fmt.Errorf("output is not equal to %q", truncate(a.Equals, 80))
+	}
+	return nil
+}
+
+// TestDir returns the directory holding a workflow's test data
+func TestDir(workflowPath string) string {
+	base := filepath.Base(workflowPath)
+	return filepath.Join(filepath.Dir(workflowPath), "testdata", strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// HasTestData reports whether a workflow has a test data directory
+func HasTestData(workflowPath string) bool {
+	info, err := os.Stat(TestDir(workflowPath))
+	return err == nil && info.IsDir()
+}
+
+// unsafeFileChars matches characters not allowed in golden file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// goldenPath returns the golden file of a step
+func goldenPath(dir, step string) string {
+	return filepath.Join(dir, "golden", unsafeFileChars.ReplaceAllString(step, "_")+".txt")
+}
+
+// stepCollector records the response of every finished step in order.
+// A step that runs more than once gets a #2, #3... suffix on later runs.
+type stepCollector struct {
+	mu      sync.Mutex
+	records []processor.StepRecord
+	seen    map[string]int
+}
+
+func (c *stepCollector) RecordStep(record processor.StepRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]int)
+	}
+	c.seen[record.Name]++
+	if n := c.seen[record.Name]; n > 1 {
+		record.Name = fmt.Sprintf("%s#%d", record.Name, n)
+	}
+	c.records = append(c.records, record)
+}
+
+// Run executes a workflow with test providers and checks its step outputs
+func Run(workflowPath string, opts Options) *Result {
+	result := &Result{Workflow: workflowPath}
+	dir := TestDir(workflowPath)
+
+	data, err := os.ReadFile(workflowPath)
+	if err != nil {
+		result.Err = fmt.Errorf("error reading workflow: %w", err)
+		return result
+	}
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(data, &dslConfig); err != nil {
+		result.Err = fmt.Errorf("error parsing workflow: %w", err)
+		return result
+	}
+	assertions, err := LoadAssertions(AssertionsPath(workflowPath))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	envConfig := opts.EnvConfig
+	if envConfig == nil {
+		envConfig = &config.EnvConfig{}
+	}
+	cassettePath := filepath.Join(dir, "cassette.json")
+	var cassette *Cassette
+	var resolve processor.ProviderResolver
+	switch opts.Mode {
+	case ModeReplay, "":
+		if cassette, err = LoadCassette(cassettePath); err != nil {
+			result.Err = fmt.Errorf("%w (record responses with --mode record)", err)
+			return result
+		}
+		resolve = replayResolver(cassette)
+	case ModeRecord:
+		cassette = &Cassette{}
+		resolve = recordResolver(cassette, envConfig)
+	case ModeMock:
+		mock := &mockProvider{}
+		resolve = func(string) models.Provider { return mock }
+	default:
+		result.Err = fmt.Errorf("unknown mode '%s' (expected %s, %s or %s)", opts.Mode, ModeReplay, ModeRecord, ModeMock)
+		return result
+	}
+
+	collector := &stepCollector{}
+	proc := processor.NewProcessor(&dslConfig, envConfig, &config.ServerConfig{}, opts.Verbose)
+	proc.DisableSpinner()
+	proc.SetProviderResolver(resolve)
+	proc.SetStepRecorder(collector)
+	if err := proc.Process(); err != nil {
+		result.Err = err
+		return result
+	}
+	if opts.Mode == ModeRecord {
+		if err := cassette.Save(cassettePath); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	ran := make(map[string]bool)
+	for _, record := range collector.records {
+		ran[record.Name] = true
+		result.Steps = append(result.Steps, checkStep(dir, record, assertions[record.Name], opts.Update))
+	}
+	for name := range assertions {
+		if !ran[name] {
+			result.Steps = append(result.Steps, StepResult{Name: name, Status: StatusFail, Message: "step has assertions but did not run"})
+		}
+	}
+	return result
+}
+
+// checkStep compares a step's output with its golden file and assertions
+func checkStep(dir string, record processor.StepRecord, assertions []Assertion, update bool) StepResult {
+	step := StepResult{Name: record.Name, Status: StatusPass}
+	if record.Err != nil {
+		step.Status = StatusFail
+		step.Message = record.Err.Error()
+		return step
+	}
+
+	golden := goldenPath(dir, record.Name)
+	if update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			return StepResult{Name: record.Name, Status: StatusFail, Message: err.Error()}
+		}
+		if err := os.WriteFile(golden, []byte(record.Response), 0644); err != nil {
+			return StepResult{Name: record.Name, Status: StatusFail, Message: err.Error()}
+		}
+		step.Status = StatusUpdated
+		step.Message = "wrote " + golden
+	} else if want, err := os.ReadFile(golden); err == nil {
+		if msg := diffOutput(string(want), record.Response); msg != "" {
+			step.Status = StatusFail
+			step.Message = fmt.Sprintf("output differs from %s: %s", golden, msg)
+			return step
+		}
+	} else if len(assertions) == 0 {
+		step.Status = StatusFail
+		step.Message = fmt.Sprintf("no golden file %s (create it with --update)", golden)
+		return step
+	}
+
+	for _, a := range assertions {
+		if err := a.Check(record.Response); err != nil {
+			step.Status = StatusFail
+			step.Message = err.Error()
+			return step
+		}
+	}
+	return step
+}
+
+// diffOutput describes the first line where got differs from want, or
+// returns an empty string if they match
+func diffOutput(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		switch {
+		case i >= len(gotLines):
+			return fmt.Sprintf("line %d: missing %q", i+1, truncate(wantLines[i], 80))
+		case i >= len(wantLines):
+			return fmt.Sprintf("line %d: unexpected %q", i+1, truncate(gotLines[i], 80))
+		case wantLines[i] != gotLines[i]:
+			return fmt.Sprintf("line %d: want %q, got %q", i+1, truncate(wantLines[i], 80), truncate(gotLines[i], 80))
+		}
+	}
+	return "outputs differ"
+}
+
+// AssertionsPath returns the assertions file of a workflow
+func AssertionsPath(workflowPath string) string {
+	return filepath.Join(TestDir(workflowPath), "assertions.yaml")
+}
+
+// LoadAssertions reads an assertions file; a missing file means no assertions
+func LoadAssertions(path string) (map[string][]Assertion, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading assertions: %w", err)
+	}
+	var assertions map[string][]Assertion
+	if err := yaml.Unmarshal(data, &assertions); err != nil {
+		return nil, fmt.Errorf("error parsing assertions %s: %w", path, err)
+	}
+	return assertions, nil
+}
+
+// replayResolver answers every model from the cassette, under the name of
+// the provider that recorded it
+func replayResolver(cassette *Cassette) processor.ProviderResolver {
+	var mu sync.Mutex
+	byName := make(map[string]models.Provider)
+	return func(modelName string) models.Provider {
+		name := cassette.providerName(modelName)
+		if name == "" {
+			name = "replay"
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := byName[name]; !ok {
+			byName[name] = &replayProvider{name: name, cassette: cassette}
+		}
+		return byName[name]
+	}
+}
+
+// recordResolver wraps the provider each model would normally use,
+// configured from the env config, in a recorder
+func recordResolver(cassette *Cassette, envConfig *config.EnvConfig) processor.ProviderResolver {
+	var mu sync.Mutex
+	byName := make(map[string]models.Provider)
+	return func(modelName string) models.Provider {
+		var provider models.Provider
+		if len(envConfig.ProviderPriority) > 0 {
+			provider = models.DetectProviderWithPriority(modelName, envConfig.ProviderPriority)
+		} else {
+			provider = models.DetectProvider(modelName)
+		}
+		if provider == nil {
+			return nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if existing, ok := byName[provider.Name()]; ok {
+			return existing
+		}
+		apiKey := "LOCAL"
+		if provider.Name() != "ollama" {
+			providerConfig, err := envConfig.GetProviderConfig(provider.Name())
+			if err != nil || providerConfig.APIKey == "" {
+				return &failingProvider{Provider: provider, err: fmt.Errorf("missing API key for provider %s", provider.Name())}
+			}
+			apiKey = providerConfig.APIKey
+		}
+		if err := provider.Configure(apiKey); err != nil {
+			return &failingProvider{Provider: provider, err: fmt.Errorf("failed to configure provider %s: %w", provider.Name(), err)}
+		}
+		byName[provider.Name()] = &recordProvider{Provider: provider, cassette: cassette}
+		return byName[provider.Name()]
+	}
+}
+
+// failingProvider reports why a provider could not be set up for recording
+type failingProvider struct {
+	models.Provider
+	err error
+}
+
+func (f *failingProvider) SendPrompt(modelName, prompt string) (string, error) {
+	return "", f.err
+}
+
+func (f *failingProvider) SendPromptWithFile(modelName, prompt string, file models.FileInput) (string, error) {
+	return "", f.err
+}
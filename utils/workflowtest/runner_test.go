@@ -0,0 +1,127 @@
+package workflowtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testWorkflow = `summarize:
+  input: NA
+  model: gpt-4o
+  action: Summarize the release notes
+  output: STDOUT
+
+title:
+  input: STDIN
+  model: claude-sonnet-4-20250514
+  action: Write a title for this summary
+  output: STDOUT
+`
+
+func writeWorkflow(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notes.yaml")
+	if err := os.WriteFile(path, []byte(testWorkflow), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(TestDir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMockModeGolden(t *testing.T) {
+	path := writeWorkflow(t)
+
+	result := Run(path, Options{Mode: ModeMock})
+	if result.Passed() {
+		t.Fatalf("expected missing golden files to fail, got %+v", result)
+	}
+
+	result = Run(path, Options{Mode: ModeMock, Update: true})
+	if !result.Passed() || len(result.Steps) != 2 || result.Steps[0].Status != StatusUpdated {
+		t.Fatalf("Run(update) = %+v", result)
+	}
+	golden, err := os.ReadFile(filepath.Join(TestDir(path), "golden", "summarize.txt"))
+	if err != nil || !strings.HasPrefix(string(golden), "mock response from gpt-4o") {
+		t.Fatalf("golden file = %q, %v", golden, err)
+	}
+
+	if result = Run(path, Options{Mode: ModeMock}); !result.Passed() {
+		t.Fatalf("Run() after update = %+v", result)
+	}
+
+	writeTestFile(t, filepath.Join(TestDir(path), "golden", "title.txt"), "A different title\n")
+	result = Run(path, Options{Mode: ModeMock})
+	if result.Passed() || result.Steps[1].Status != StatusFail || !strings.Contains(result.Steps[1].Message, "line 1") {
+		t.Fatalf("Run() with changed golden = %+v", result)
+	}
+}
+
+func TestReplayWithAssertions(t *testing.T) {
+	path := writeWorkflow(t)
+	dir := TestDir(path)
+
+	if result := Run(path, Options{}); result.Err == nil || !strings.Contains(result.Err.Error(), "--mode record") {
+		t.Fatalf("Run() without cassette = %+v", result)
+	}
+
+	cassette := &Cassette{Interactions: []Interaction{
+		{Provider: "openai", Model: "gpt-4o", Prompt: "Summarize the release notes", Response: "Faster builds and a new cache."},
+	}}
+	if err := cassette.Save(filepath.Join(dir, "cassette.json")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "assertions.yaml"), `summarize:
+  - contains: cache
+  - matches: "(?i)faster"
+  - not_contains: error
+`)
+
+	// The title step's prompt was never recorded
+	if result := Run(path, Options{}); result.Err == nil || !strings.Contains(result.Err.Error(), "no recorded response") {
+		t.Fatalf("Run() with unrecorded prompt = %+v", result)
+	}
+
+	cassette.Interactions = cassette.Interactions[:1]
+	writeTestFile(t, path, strings.SplitN(testWorkflow, "\n\n", 2)[0]+"\n")
+	result := Run(path, Options{})
+	if !result.Passed() || len(result.Steps) != 1 || result.Steps[0].Name != "summarize" {
+		t.Fatalf("Run() = %+v", result)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "assertions.yaml"), "summarize:\n  - contains: regression\nmissing:\n  - contains: x\n")
+	result = Run(path, Options{})
+	if result.Passed() || len(result.Steps) != 2 {
+		t.Fatalf("Run() with failing assertions = %+v", result)
+	}
+	if result.Steps[0].Message != `output does not contain "regression"` || result.Steps[1].Message != "step has assertions but did not run" {
+		t.Errorf("step results = %+v", result.Steps)
+	}
+}
+
+func TestDiffOutput(t *testing.T) {
+	tests := []struct{ want, got, msg string }{
+		{"a\nb", "a\nb", ""},
+		{"a\nb", "a\nc", `line 2: want "b", got "c"`},
+		{"a", "a\nb", `line 2: unexpected "b"`},
+		{"a\nb", "a", `line 2: missing "b"`},
+	}
+	for _, tt := range tests {
+		if msg := diffOutput(tt.want, tt.got); msg != tt.msg {
+			t.Errorf("diffOutput(%q, %q) = %q, want %q", tt.want, tt.got, msg, tt.msg)
+		}
+	}
+}